@@ -33,3 +33,109 @@ type BPFInstruction struct {
 	// K is a constant parameter. The meaning depends on the value of OpCode.
 	K uint32
 }
+
+// BPFInsn is a raw eBPF virtual machine instruction, struct bpf_insn in
+// include/uapi/linux/bpf.h.
+type BPFInsn struct {
+	// OpCode is the operation to execute.
+	OpCode uint8
+
+	// Regs holds the destination register in its 4 least significant bits
+	// and the source register in its 4 most significant bits.
+	Regs uint8
+
+	// Off is a signed offset, used by memory accesses and jumps.
+	Off int16
+
+	// Imm is a signed immediate constant.
+	Imm int32
+}
+
+// BPFInsnSize is the size of a BPFInsn.
+const BPFInsnSize = 8
+
+// Dst returns the destination register of the instruction.
+func (i BPFInsn) Dst() uint8 {
+	return i.Regs & 0xf
+}
+
+// Src returns the source register of the instruction.
+func (i BPFInsn) Src() uint8 {
+	return i.Regs >> 4
+}
+
+// Values of the source register of BPF_LD|BPF_IMM|BPF_DW instructions.
+const (
+	BPF_PSEUDO_MAP_FD    = 1
+	BPF_PSEUDO_MAP_VALUE = 2
+)
+
+// Source register of BPF_CALL instructions calling BPF functions.
+const BPF_PSEUDO_CALL = 1
+
+// eBPF map types, from enum bpf_map_type.
+const (
+	BPF_MAP_TYPE_UNSPEC = 0
+	BPF_MAP_TYPE_HASH   = 1
+	BPF_MAP_TYPE_ARRAY  = 2
+)
+
+// Flags for updating map elements.
+const (
+	BPF_ANY     = 0
+	BPF_NOEXIST = 1
+	BPF_EXIST   = 2
+)
+
+// eBPF helper functions, from enum bpf_func_id.
+const (
+	BPF_FUNC_map_lookup_elem = 1
+	BPF_FUNC_map_update_elem = 2
+	BPF_FUNC_map_delete_elem = 3
+	BPF_FUNC_ktime_get_ns    = 5
+	BPF_FUNC_redirect        = 23
+	BPF_FUNC_skb_load_bytes  = 26
+)
+
+// Flags of bpf_redirect.
+const BPF_F_INGRESS = 1
+
+// Offsets of the fields of struct __sk_buff, the context of socket filter and
+// tc programs.
+const (
+	SKBuffLen            = 0
+	SKBuffPktType        = 4
+	SKBuffMark           = 8
+	SKBuffQueueMapping   = 12
+	SKBuffProtocol       = 16
+	SKBuffVlanPresent    = 20
+	SKBuffVlanTCI        = 24
+	SKBuffVlanProto      = 28
+	SKBuffPriority       = 32
+	SKBuffIngressIfindex = 36
+	SKBuffIfindex        = 40
+	SKBuffTCIndex        = 44
+	SKBuffCB             = 48
+	SKBuffHash           = 68
+	SKBuffTCClassID      = 72
+	SKBuffData           = 76
+	SKBuffDataEnd        = 80
+
+	// SKBuffCBSize is the size of the cb field.
+	SKBuffCBSize = 20
+)
+
+// Return values of tc classifiers and actions, from
+// include/uapi/linux/pkt_cls.h.
+const (
+	TC_ACT_UNSPEC     = -1
+	TC_ACT_OK         = 0
+	TC_ACT_RECLASSIFY = 1
+	TC_ACT_SHOT       = 2
+	TC_ACT_PIPE       = 3
+	TC_ACT_STOLEN     = 4
+	TC_ACT_QUEUED     = 5
+	TC_ACT_REPEAT     = 6
+	TC_ACT_REDIRECT   = 7
+	TC_ACT_TRAP       = 8
+)
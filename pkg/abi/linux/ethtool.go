@@ -0,0 +1,79 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// SIOCETHTOOL commands, from uapi/linux/ethtool.h.
+const (
+	ETHTOOL_GDRVINFO   = 0x3
+	ETHTOOL_GSTRINGS   = 0x1b
+	ETHTOOL_GSTATS     = 0x1d
+	ETHTOOL_GSSET_INFO = 0x37
+)
+
+// String sets, from uapi/linux/ethtool.h.
+const (
+	ETH_SS_TEST  = 0
+	ETH_SS_STATS = 1
+)
+
+// ETH_GSTRING_LEN is the length of the strings of a string set, from
+// uapi/linux/ethtool.h.
+const ETH_GSTRING_LEN = 32
+
+// EthtoolCmd is the command word which starts all SIOCETHTOOL structures.
+type EthtoolCmd struct {
+	Cmd uint32
+}
+
+// EthtoolDrvInfo is struct ethtool_drvinfo, from uapi/linux/ethtool.h.
+type EthtoolDrvInfo struct {
+	Cmd         uint32
+	Driver      [32]byte
+	Version     [32]byte
+	FWVersion   [32]byte
+	BusInfo     [32]byte
+	EROMVersion [32]byte
+	Reserved2   [12]byte
+	NPrivFlags  uint32
+	NStats      uint32
+	TestInfoLen uint32
+	EEDumpLen   uint32
+	RegDumpLen  uint32
+}
+
+// EthtoolSsetInfo is struct ethtool_sset_info, from uapi/linux/ethtool.h,
+// without its trailing data array. The array holds the length of each string
+// set in SsetMask, as a uint32.
+type EthtoolSsetInfo struct {
+	Cmd      uint32
+	Reserved uint32
+	SsetMask uint64
+}
+
+// EthtoolGStrings is struct ethtool_gstrings, from uapi/linux/ethtool.h,
+// without its trailing data array. The array holds Len strings of
+// ETH_GSTRING_LEN bytes.
+type EthtoolGStrings struct {
+	Cmd       uint32
+	StringSet uint32
+	Len       uint32
+}
+
+// EthtoolStats is struct ethtool_stats, from uapi/linux/ethtool.h, without its
+// trailing data array. The array holds NStats statistics, as uint64s.
+type EthtoolStats struct {
+	Cmd    uint32
+	NStats uint32
+}
@@ -89,7 +89,10 @@ const (
 
 // ioctl(2) requests provided by uapi/asm-generic/sockios.h
 const (
-	SIOCGSTAMP = 0x8906
+	SIOCINQ     = FIONREAD
+	SIOCOUTQ    = TIOCOUTQ
+	SIOCGSTAMP  = 0x8906
+	SIOCOUTQNSD = 0x894b
 )
 
 // ioctl(2) directions. Used to calculate requests number.
@@ -159,3 +159,19 @@ const (
 	IPV6_RECVFRAGSIZE     = 77
 	IPV6_FREEBIND         = 78
 )
+
+// Socket options from uapi/linux/icmp.h.
+const (
+	ICMP_FILTER = 1
+)
+
+// Socket options from uapi/linux/icmpv6.h.
+const (
+	ICMPV6_FILTER = 1
+)
+
+// Sizes of the filters set with ICMP_FILTER and ICMPV6_FILTER.
+const (
+	SizeOfICMPFilter   = 4
+	SizeOfICMPv6Filter = 32
+)
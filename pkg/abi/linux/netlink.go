@@ -111,6 +111,13 @@ const NetlinkAttrHeaderSize = 4
 // uapi/linux/netlink.h.
 const NLA_ALIGNTO = 4
 
+// Flags of the type of netlink attributes, from uapi/linux/netlink.h.
+const (
+	NLA_F_NESTED        = 1 << 15
+	NLA_F_NET_BYTEORDER = 1 << 14
+	NLA_TYPE_MASK       = ^(NLA_F_NESTED | NLA_F_NET_BYTEORDER) & 0xffff
+)
+
 // Socket options, from uapi/linux/netlink.h.
 const (
 	NETLINK_ADD_MEMBERSHIP   = 1
@@ -84,6 +84,23 @@ const (
 	RTM_GETNSID = 90
 )
 
+// Multicast groups of NETLINK_ROUTE sockets, from uapi/linux/rtnetlink.h.
+const (
+	RTNLGRP_NONE        = 0
+	RTNLGRP_LINK        = 1
+	RTNLGRP_NOTIFY      = 2
+	RTNLGRP_NEIGH       = 3
+	RTNLGRP_TC          = 4
+	RTNLGRP_IPV4_IFADDR = 5
+	RTNLGRP_IPV4_MROUTE = 6
+	RTNLGRP_IPV4_ROUTE  = 7
+	RTNLGRP_IPV4_RULE   = 8
+	RTNLGRP_IPV6_IFADDR = 9
+	RTNLGRP_IPV6_MROUTE = 10
+	RTNLGRP_IPV6_ROUTE  = 11
+	RTNLGRP_MAX         = 33
+)
+
 // InterfaceInfoMessage is struct ifinfomsg, from uapi/linux/rtnetlink.h.
 type InterfaceInfoMessage struct {
 	Family uint8
@@ -163,6 +180,23 @@ const (
 	IFLA_GSO_MAX_SIZE    = 41
 )
 
+// Attributes nested in IFLA_LINKINFO, from uapi/linux/if_link.h.
+const (
+	IFLA_INFO_UNSPEC     = 0
+	IFLA_INFO_KIND       = 1
+	IFLA_INFO_DATA       = 2
+	IFLA_INFO_XSTATS     = 3
+	IFLA_INFO_SLAVE_KIND = 4
+	IFLA_INFO_SLAVE_DATA = 5
+)
+
+// Attributes nested in the IFLA_INFO_DATA of veth interfaces, from
+// uapi/linux/veth.h.
+const (
+	VETH_INFO_UNSPEC = 0
+	VETH_INFO_PEER   = 1
+)
+
 // InterfaceAddrMessage is struct ifaddrmsg, from uapi/linux/if_addr.h.
 type InterfaceAddrMessage struct {
 	Family    uint8
@@ -346,3 +380,70 @@ type RtAttr struct {
 
 // SizeOfRtAttr is the size of RtAttr.
 const SizeOfRtAttr = 4
+
+// TrafficControlMessage is struct tcmsg, from uapi/linux/rtnetlink.h.
+type TrafficControlMessage struct {
+	Family  uint8
+	_       uint8
+	_       uint16
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+// Traffic control attributes, from uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC         = 0
+	TCA_KIND           = 1
+	TCA_OPTIONS        = 2
+	TCA_STATS          = 3
+	TCA_XSTATS         = 4
+	TCA_RATE           = 5
+	TCA_FCNT           = 6
+	TCA_STATS2         = 7
+	TCA_STAB           = 8
+	TCA_PAD            = 9
+	TCA_DUMP_INVISIBLE = 10
+	TCA_CHAIN          = 11
+	TCA_HW_OFFLOAD     = 12
+	TCA_INGRESS_BLOCK  = 13
+	TCA_EGRESS_BLOCK   = 14
+	TCA_DUMP_FLAGS     = 15
+)
+
+// NeighborMessage is struct ndmsg, from uapi/linux/neighbour.h.
+type NeighborMessage struct {
+	Family  uint8
+	_       uint8
+	_       uint16
+	Ifindex int32
+	State   uint16
+	Flags   uint8
+	Type    uint8
+}
+
+// SizeOfNeighborMessage is the size of NeighborMessage.
+const SizeOfNeighborMessage = 12
+
+// Neighbor attributes, from uapi/linux/neighbour.h.
+const (
+	NDA_UNSPEC    = 0
+	NDA_DST       = 1
+	NDA_LLADDR    = 2
+	NDA_CACHEINFO = 3
+	NDA_PROBES    = 4
+)
+
+// Neighbor cache entry states, from uapi/linux/neighbour.h.
+const (
+	NUD_INCOMPLETE = 0x01
+	NUD_REACHABLE  = 0x02
+	NUD_STALE      = 0x04
+	NUD_DELAY      = 0x08
+	NUD_PROBE      = 0x10
+	NUD_FAILED     = 0x20
+	NUD_NOARP      = 0x40
+	NUD_PERMANENT  = 0x80
+	NUD_NONE       = 0x00
+)
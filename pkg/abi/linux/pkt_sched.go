@@ -0,0 +1,193 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Traffic control handles, from uapi/linux/pkt_sched.h.
+const (
+	TC_H_MAJ_MASK = 0xFFFF0000
+	TC_H_MIN_MASK = 0x0000FFFF
+	TC_H_UNSPEC   = 0
+	TC_H_ROOT     = 0xFFFFFFFF
+	TC_H_INGRESS  = 0xFFFFFFF1
+	TC_H_CLSACT   = TC_H_INGRESS
+)
+
+// PSCHED_SHIFT is the number of bits nanoseconds are shifted by to get the
+// packet scheduler ticks used by some traffic control parameters, from
+// include/net/pkt_sched.h.
+const PSCHED_SHIFT = 6
+
+// TCRateSpec is struct tc_ratespec, from uapi/linux/pkt_sched.h.
+type TCRateSpec struct {
+	CellLog   uint8
+	LinkLayer uint8
+	Overhead  uint16
+	CellAlign int16
+	MPU       uint16
+	Rate      uint32
+}
+
+// Packet priorities, from uapi/linux/pkt_sched.h.
+const (
+	TC_PRIO_BESTEFFORT       = 0
+	TC_PRIO_FILLER           = 1
+	TC_PRIO_BULK             = 2
+	TC_PRIO_INTERACTIVE_BULK = 4
+	TC_PRIO_INTERACTIVE      = 6
+	TC_PRIO_CONTROL          = 7
+	TC_PRIO_MAX              = 15
+)
+
+// TCQ_PRIO_BANDS is the maximum number of bands of the prio discipline, from
+// uapi/linux/pkt_sched.h.
+const TCQ_PRIO_BANDS = 16
+
+// TCPrioQopt is struct tc_prio_qopt, from uapi/linux/pkt_sched.h.
+type TCPrioQopt struct {
+	Bands   int32
+	PrioMap [TC_PRIO_MAX + 1]uint8
+}
+
+// TCFifoQopt is struct tc_fifo_qopt, from uapi/linux/pkt_sched.h.
+type TCFifoQopt struct {
+	Limit uint32
+}
+
+// TCSFQQopt is struct tc_sfq_qopt, from uapi/linux/pkt_sched.h.
+type TCSFQQopt struct {
+	Quantum       uint32
+	PerturbPeriod int32
+	Limit         uint32
+	Divisor       uint32
+	Flows         uint32
+}
+
+// TCTBFQopt is struct tc_tbf_qopt, from uapi/linux/pkt_sched.h.
+type TCTBFQopt struct {
+	Rate     TCRateSpec
+	PeakRate TCRateSpec
+	Limit    uint32
+	Buffer   uint32
+	MTU      uint32
+}
+
+// TBF attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+	TCA_TBF_PAD     = 8
+)
+
+// TCNetemQopt is struct tc_netem_qopt, from uapi/linux/pkt_sched.h.
+type TCNetemQopt struct {
+	Latency   uint32
+	Limit     uint32
+	Loss      uint32
+	Gap       uint32
+	Duplicate uint32
+	Jitter    uint32
+}
+
+// TCNetemCorr is struct tc_netem_corr, from uapi/linux/pkt_sched.h.
+type TCNetemCorr struct {
+	DelayCorr uint32
+	LossCorr  uint32
+	DupCorr   uint32
+}
+
+// TCNetemReorder is struct tc_netem_reorder, from uapi/linux/pkt_sched.h.
+type TCNetemReorder struct {
+	Probability uint32
+	Correlation uint32
+}
+
+// TCNetemCorrupt is struct tc_netem_corrupt, from uapi/linux/pkt_sched.h.
+type TCNetemCorrupt struct {
+	Probability uint32
+	Correlation uint32
+}
+
+// TCNetemRate is struct tc_netem_rate, from uapi/linux/pkt_sched.h.
+type TCNetemRate struct {
+	Rate           uint32
+	PacketOverhead int32
+	CellSize       uint32
+	CellOverhead   int32
+}
+
+// NETEM attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_NETEM_UNSPEC     = 0
+	TCA_NETEM_CORR       = 1
+	TCA_NETEM_DELAY_DIST = 2
+	TCA_NETEM_REORDER    = 3
+	TCA_NETEM_CORRUPT    = 4
+	TCA_NETEM_LOSS       = 5
+	TCA_NETEM_RATE       = 6
+	TCA_NETEM_ECN        = 7
+	TCA_NETEM_RATE64     = 8
+	TCA_NETEM_PAD        = 9
+	TCA_NETEM_LATENCY64  = 10
+	TCA_NETEM_JITTER64   = 11
+	TCA_NETEM_SLOT       = 12
+	TCA_NETEM_SLOT_DIST  = 13
+)
+
+// FQ_CODEL attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_FQ_CODEL_UNSPEC          = 0
+	TCA_FQ_CODEL_TARGET          = 1
+	TCA_FQ_CODEL_LIMIT           = 2
+	TCA_FQ_CODEL_INTERVAL        = 3
+	TCA_FQ_CODEL_ECN             = 4
+	TCA_FQ_CODEL_FLOWS           = 5
+	TCA_FQ_CODEL_QUANTUM         = 6
+	TCA_FQ_CODEL_CE_THRESHOLD    = 7
+	TCA_FQ_CODEL_DROP_BATCH_SIZE = 8
+	TCA_FQ_CODEL_MEMORY_LIMIT    = 9
+)
+
+// Statistics attributes, from uapi/linux/gen_stats.h.
+const (
+	TCA_STATS_UNSPEC     = 0
+	TCA_STATS_BASIC      = 1
+	TCA_STATS_RATE_EST   = 2
+	TCA_STATS_QUEUE      = 3
+	TCA_STATS_APP        = 4
+	TCA_STATS_RATE_EST64 = 5
+	TCA_STATS_PAD        = 6
+)
+
+// GnetStatsBasic is struct gnet_stats_basic, from uapi/linux/gen_stats.h.
+type GnetStatsBasic struct {
+	Bytes   uint64
+	Packets uint32
+	_       uint32
+}
+
+// GnetStatsQueue is struct gnet_stats_queue, from uapi/linux/gen_stats.h.
+type GnetStatsQueue struct {
+	QLen       uint32
+	Backlog    uint32
+	Drops      uint32
+	Requeues   uint32
+	Overlimits uint32
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// NETLINK_SOCK_DIAG message types, from uapi/linux/sock_diag.h.
+const (
+	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+)
+
+// inet_diag extensions, requested in InetDiagReqV2.Ext as bit (ext - 1) and
+// reported as netlink attributes, from uapi/linux/inet_diag.h.
+const (
+	INET_DIAG_NONE    = 0
+	INET_DIAG_MEMINFO = 1
+	INET_DIAG_INFO    = 2
+)
+
+// InetDiagSockID is struct inet_diag_sockid, from uapi/linux/inet_diag.h.
+type InetDiagSockID struct {
+	// SPort and DPort are in network byte order.
+	SPort uint16
+	DPort uint16
+
+	// Src and Dst hold an IPv4 address in their first 4 bytes, or an IPv6
+	// address.
+	Src [16]byte
+	Dst [16]byte
+
+	If     uint32
+	Cookie [2]uint32
+}
+
+// InetDiagReqV2 is struct inet_diag_req_v2, from uapi/linux/inet_diag.h.
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	_        uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+// InetDiagReqV2Size is the size of InetDiagReqV2.
+const InetDiagReqV2Size = 56
+
+// InetDiagMsg is struct inet_diag_msg, from uapi/linux/inet_diag.h.
+type InetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// InetDiagMsgSize is the size of InetDiagMsg.
+const InetDiagMsgSize = 72
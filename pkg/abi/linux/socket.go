@@ -204,6 +204,7 @@ const (
 	SO_PEERGROUPS            = 59
 	SO_ZEROCOPY              = 60
 	SO_TXTIME                = 61
+	SO_BINDTOIFINDEX         = 62
 )
 
 // enum socket_state, from uapi/linux/net.h.
@@ -454,6 +455,18 @@ type ControlMessageIPPacketInfo struct {
 	DestinationAddr InetAddr
 }
 
+// ControlMessageIPv6PathMTU is an IPV6_PATHMTU socket control message, which
+// is also the value of the IPV6_PATHMTU socket option.
+//
+// ControlMessageIPv6PathMTU represents struct ip6_mtuinfo from
+// uapi/linux/ipv6.h.
+//
+// +marshal
+type ControlMessageIPv6PathMTU struct {
+	Addr SockAddrInet6
+	MTU  uint32
+}
+
 // SizeOfControlMessageCredentials is the binary size of a
 // ControlMessageCredentials struct.
 var SizeOfControlMessageCredentials = int(binary.Size(ControlMessageCredentials{}))
@@ -474,10 +487,21 @@ const SizeOfControlMessageTOS = 1
 // SizeOfControlMessageTClass is the size of an IPV6_TCLASS control message.
 const SizeOfControlMessageTClass = 4
 
+// SizeOfControlMessageTTL is the size of an IP_TTL control message.
+const SizeOfControlMessageTTL = 4
+
+// SizeOfControlMessageHopLimit is the size of an IPV6_HOPLIMIT control
+// message.
+const SizeOfControlMessageHopLimit = 4
+
 // SizeOfControlMessageIPPacketInfo is the size of an IP_PKTINFO
 // control message.
 const SizeOfControlMessageIPPacketInfo = 12
 
+// SizeOfControlMessageIPv6PathMTU is the size of an IPV6_PATHMTU control
+// message.
+const SizeOfControlMessageIPv6PathMTU = 32
+
 // SCM_MAX_FD is the maximum number of FDs accepted in a single sendmsg call.
 // From net/scm.h.
 const SCM_MAX_FD = 253
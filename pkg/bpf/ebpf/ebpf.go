@@ -0,0 +1,211 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ebpf runs extended BPF programs, as loaded with bpf(2) on Linux.
+//
+// Programs are not verified ahead of time like on Linux. Instead, all memory
+// accesses are checked as programs run, and programs which attempt invalid
+// accesses are aborted.
+package ebpf
+
+import (
+	"fmt"
+)
+
+const (
+	// MaxInstructions is the maximum number of instructions in a program,
+	// and is equal to Linux's BPF_COMPLEXITY_LIMIT_INSNS.
+	MaxInstructions = 1000000
+
+	// MaxExecutedInstructions is the maximum number of instructions a run
+	// of a program executes before being aborted.
+	MaxExecutedInstructions = 1000000
+
+	// StackSize is the size of the stack of programs, and is equal to
+	// Linux's MAX_BPF_STACK.
+	StackSize = 512
+
+	// NumRegisters is the number of registers of the virtual machine.
+	NumRegisters = 11
+)
+
+// Parts of a linux.BPFInsn.OpCode. Compare to the Linux kernel's
+// include/uapi/linux/bpf.h and include/uapi/linux/bpf_common.h.
+const (
+	// Instruction class, stored in bits 0-2.
+	Ld                   = 0x00
+	Ldx                  = 0x01
+	St                   = 0x02
+	Stx                  = 0x03
+	Alu                  = 0x04 // 32-bit arithmetic
+	Jmp                  = 0x05
+	Jmp32                = 0x06 // jumps comparing 32-bit operands
+	Alu64                = 0x07 // 64-bit arithmetic
+	instructionClassMask = 0x07
+
+	// Size of a memory access, stored in bits 3-4.
+	W            = 0x00 // 32 bits
+	H            = 0x08 // 16 bits
+	B            = 0x10 // 8 bits
+	DW           = 0x18 // 64 bits
+	loadSizeMask = 0x18
+
+	// Mode of a memory access, stored in bits 5-7.
+	Imm          = 0x00 // 64-bit immediate, in two instructions
+	Abs          = 0x20 // packet data at offset Imm, in network order
+	Ind          = 0x40 // packet data at offset Src+Imm, in network order
+	Mem          = 0x60 // memory at address Src+Off or Dst+Off
+	Atomic       = 0xc0 // atomic addition to memory at address Dst+Off
+	loadModeMask = 0xe0
+
+	// Source operand of arithmetic and jump instructions, stored in bit 3.
+	K             = 0x00 // Imm
+	X             = 0x08 // Src
+	srcAluJmpMask = 0x08
+
+	// Arithmetic instructions, stored in bits 4-7.
+	Add        = 0x00
+	Sub        = 0x10
+	Mul        = 0x20
+	Div        = 0x30
+	Or         = 0x40
+	And        = 0x50
+	Lsh        = 0x60
+	Rsh        = 0x70
+	Neg        = 0x80
+	Mod        = 0x90
+	Xor        = 0xa0
+	Mov        = 0xb0
+	Arsh       = 0xc0
+	End        = 0xd0 // byte swap, to the order selected by the source
+	aluMask    = 0xf0
+	ToLE       = 0x00 // End to little endian
+	ToBE       = 0x08 // End to big endian
+	endianMask = 0x08
+
+	// Jump instructions, stored in bits 4-7.
+	Ja      = 0x00
+	Jeq     = 0x10
+	Jgt     = 0x20
+	Jge     = 0x30
+	Jset    = 0x40
+	Jne     = 0x50
+	Jsgt    = 0x60
+	Jsge    = 0x70
+	Call    = 0x80
+	Exit    = 0x90
+	Jlt     = 0xa0
+	Jle     = 0xb0
+	Jslt    = 0xc0
+	Jsle    = 0xd0
+	jmpMask = 0xf0
+)
+
+// Registers of the virtual machine.
+const (
+	// R0 holds return values.
+	R0 = iota
+	// R1 to R5 hold arguments. R1 points to the context when programs
+	// start.
+	R1
+	R2
+	R3
+	R4
+	R5
+	// R6 to R9 are preserved by helper calls.
+	R6
+	R7
+	R8
+	R9
+	// R10 is the read-only frame pointer, pointing to the end of the stack.
+	R10
+)
+
+// Possible values for Error.Code.
+const (
+	// InvalidInstructionCount indicates that a program has zero instructions
+	// or more than MaxInstructions instructions.
+	InvalidInstructionCount = iota
+
+	// InvalidOpcode indicates that a program contains an instruction with an
+	// invalid or unsupported opcode.
+	InvalidOpcode
+
+	// InvalidRegister indicates that a program contains an instruction
+	// using a non-existent register, or writing to R10.
+	InvalidRegister
+
+	// InvalidJumpTarget indicates that a program contains a jump whose target
+	// is outside of the program's bounds.
+	InvalidJumpTarget
+
+	// InvalidEndOfProgram indicates that the last instruction of a program
+	// is neither an exit nor a jump.
+	InvalidEndOfProgram
+
+	// InvalidMap indicates that a program references a map which was not
+	// provided.
+	InvalidMap
+
+	// InvalidHelper indicates that a program called an unknown helper.
+	InvalidHelper
+
+	// InvalidMemoryAccess indicates that a program executed an out of
+	// bounds, misaligned or forbidden memory access.
+	InvalidMemoryAccess
+
+	// TooManyInstructions indicates that a program executed more than
+	// MaxExecutedInstructions instructions.
+	TooManyInstructions
+)
+
+// Error is an error encountered while compiling or running an eBPF program.
+type Error struct {
+	// Code indicates the kind of error that occurred.
+	Code int
+
+	// PC is the program counter (index into the list of instructions) at which
+	// the error occurred.
+	PC int
+}
+
+func (e Error) codeString() string {
+	switch e.Code {
+	case InvalidInstructionCount:
+		return "invalid number of instructions"
+	case InvalidOpcode:
+		return "invalid instruction opcode"
+	case InvalidRegister:
+		return "invalid register"
+	case InvalidJumpTarget:
+		return "jump target out of bounds"
+	case InvalidEndOfProgram:
+		return "last instruction must be an exit or a jump"
+	case InvalidMap:
+		return "invalid map"
+	case InvalidHelper:
+		return "unknown helper"
+	case InvalidMemoryAccess:
+		return "invalid memory access"
+	case TooManyInstructions:
+		return "too many instructions executed"
+	default:
+		return "unknown error"
+	}
+}
+
+// Error implements error.Error.
+func (e Error) Error() string {
+	return fmt.Sprintf("at l%d: %s", e.PC, e.codeString())
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// mapsSection is the section of object files holding the definitions of maps.
+const mapsSection = "maps"
+
+// mapDefSize is the minimum size of map definitions, struct bpf_map_def in
+// libbpf, whose map_flags and later fields are ignored.
+const mapDefSize = 16
+
+// Collection holds the programs and maps of an object file.
+type Collection struct {
+	// Programs holds the programs of the object file by section, e.g.
+	// "classifier".
+	Programs map[string]*Program
+
+	// Maps holds the maps of the object file by name.
+	Maps map[string]*Map
+}
+
+// LoadCollection loads the programs and maps of a little endian ELF object file
+// compiled for the BPF target, as with "clang -target bpfel". Programs are the
+// executable sections of the file, and maps must be defined in the "maps"
+// section, as struct bpf_map_def. Maps defined with BTF are not supported.
+func LoadCollection(r io.ReaderAt) (*Collection, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	if f.Machine != elf.EM_BPF || f.Class != elf.ELFCLASS64 || f.ByteOrder != binary.LittleEndian {
+		return nil, fmt.Errorf("not a 64-bit little endian BPF object file")
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	c := &Collection{
+		Programs: make(map[string]*Program),
+		Maps:     make(map[string]*Map),
+	}
+
+	// Create the maps, indexed by their symbols.
+	var maps []*Map
+	mapIndex := make(map[int]int32)
+	if s := f.Section(mapsSection); s != nil {
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		section := elf.SectionIndex(sectionIndex(f, s))
+		for i, sym := range syms {
+			if sym.Section == section && elf.ST_TYPE(sym.Info) == elf.STT_OBJECT {
+				if sym.Value+mapDefSize > uint64(len(data)) {
+					return nil, fmt.Errorf("map %q is truncated", sym.Name)
+				}
+				def := data[sym.Value:]
+				m, err := NewMap(MapSpec{
+					Name:       sym.Name,
+					Type:       binary.LittleEndian.Uint32(def),
+					KeySize:    binary.LittleEndian.Uint32(def[4:]),
+					ValueSize:  binary.LittleEndian.Uint32(def[8:]),
+					MaxEntries: binary.LittleEndian.Uint32(def[12:]),
+				})
+				if err != nil {
+					return nil, err
+				}
+				// The null symbol isn't returned by f.Symbols.
+				mapIndex[i+1] = int32(len(maps))
+				maps = append(maps, m)
+				c.Maps[sym.Name] = m
+			}
+		}
+	}
+
+	for idx, s := range f.Sections {
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_EXECINSTR == 0 || s.Size == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		if len(data)%linux.BPFInsnSize != 0 {
+			return nil, fmt.Errorf("section %q has a partial instruction", s.Name)
+		}
+		insns := make([]linux.BPFInsn, len(data)/linux.BPFInsnSize)
+		for i := range insns {
+			b := data[i*linux.BPFInsnSize:]
+			insns[i] = linux.BPFInsn{
+				OpCode: b[0],
+				Regs:   b[1],
+				Off:    int16(binary.LittleEndian.Uint16(b[2:])),
+				Imm:    int32(binary.LittleEndian.Uint32(b[4:])),
+			}
+		}
+		if err := relocate(f, idx, syms, mapIndex, insns); err != nil {
+			return nil, fmt.Errorf("relocating section %q: %v", s.Name, err)
+		}
+		p, err := Compile(insns, maps)
+		if err != nil {
+			return nil, fmt.Errorf("compiling section %q: %v", s.Name, err)
+		}
+		c.Programs[s.Name] = p
+	}
+	return c, nil
+}
+
+// sectionIndex returns the index of s in f.
+func sectionIndex(f *elf.File, s *elf.Section) int {
+	for i, other := range f.Sections {
+		if other == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// relocate applies the relocations of the section with index idx to insns.
+// Only references to maps are supported.
+func relocate(f *elf.File, idx int, syms []elf.Symbol, mapIndex map[int]int32, insns []linux.BPFInsn) error {
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_REL || int(s.Info) != idx {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return err
+		}
+		const relSize = 16
+		for ; len(data) >= relSize; data = data[relSize:] {
+			off := binary.LittleEndian.Uint64(data)
+			sym := int(elf.R_SYM64(binary.LittleEndian.Uint64(data[8:])))
+			if sym <= 0 || sym > len(syms) {
+				return fmt.Errorf("invalid symbol %d", sym)
+			}
+			m, ok := mapIndex[sym]
+			if !ok {
+				return fmt.Errorf("unsupported reference to symbol %q", syms[sym-1].Name)
+			}
+			i := off / linux.BPFInsnSize
+			if off%linux.BPFInsnSize != 0 || i >= uint64(len(insns)) || insns[i].OpCode != Ld|Imm|DW {
+				return fmt.Errorf("invalid reference to map %q at offset %d", syms[sym-1].Name, off)
+			}
+			insns[i].Regs = insns[i].Dst() | linux.BPF_PSEUDO_MAP_FD<<4
+			insns[i].Imm = m
+		}
+	}
+	return nil
+}
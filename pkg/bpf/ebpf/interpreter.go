@@ -0,0 +1,526 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// Programs address memory regions with the 32 most significant bits of
+// pointers, and offsets within them with the 32 least significant bits. The
+// null pointer is in no region.
+const (
+	regionStack   = 1
+	regionContext = 2
+	regionPacket  = 3
+	// regionMap is the region of the first map of the program. Maps can't
+	// be accessed directly.
+	regionMap = 1 << 20
+	// regionValue is the region of the first map value looked up by a run of
+	// the program.
+	regionValue = 1 << 21
+)
+
+// address returns a pointer to off in region.
+func address(region, off uint32) uint64 {
+	return uint64(region)<<32 | uint64(off)
+}
+
+// PacketAddress returns a pointer to the byte at off in the packet of a run,
+// for contexts to point to packets.
+func PacketAddress(off int) uint64 {
+	return address(regionPacket, uint32(off))
+}
+
+// Context is the context of programs, which R1 points to when they start. It
+// is accessed by fields.
+type Context interface {
+	// Load returns the value of the field of size bytes at off, and whether
+	// the field can be read.
+	Load(off, size int) (uint64, bool)
+
+	// Store sets the field of size bytes at off to v, and returns whether
+	// the field can be written.
+	Store(off, size int, v uint64) bool
+}
+
+// Helper is a function programs can call. It's called with the values of R1 to
+// R5, and returns the value of R0. Errors abort the program.
+type Helper func(m *Machine, args [5]uint64) (uint64, error)
+
+// Env is the environment of a run of a program.
+type Env struct {
+	// Context is the context of the program. It may be nil.
+	Context Context
+
+	// Packet is the packet the program processes. It is read-only.
+	Packet []byte
+
+	// Helpers are the helpers available to the program, besides helpers
+	// manipulating maps and linux.BPF_FUNC_ktime_get_ns.
+	Helpers map[int32]Helper
+}
+
+// Machine is the state of a running program.
+type Machine struct {
+	p   *Program
+	env *Env
+
+	regs  [NumRegisters]uint64
+	stack [StackSize]byte
+
+	// values holds the map values looked up by the program.
+	values [][]byte
+}
+
+// Env returns the environment of the running program.
+func (m *Machine) Env() *Env {
+	return m.env
+}
+
+// Memory returns the size bytes of memory at addr, which are written to if
+// write is true. It returns false if the memory can't be accessed. The
+// context can't be accessed with Memory.
+func (m *Machine) Memory(addr uint64, size int, write bool) ([]byte, bool) {
+	region, off := uint32(addr>>32), uint64(uint32(addr))
+	var mem []byte
+	switch {
+	case region == regionStack:
+		mem = m.stack[:]
+	case region == regionPacket && !write:
+		mem = m.env.Packet
+	case region >= regionValue && region-regionValue < uint32(len(m.values)):
+		mem = m.values[region-regionValue]
+	default:
+		return nil, false
+	}
+	if size < 0 || off+uint64(size) > uint64(len(mem)) {
+		return nil, false
+	}
+	return mem[off : off+uint64(size)], true
+}
+
+// mapAt returns the map addr points to.
+func (m *Machine) mapAt(addr uint64) (*Map, bool) {
+	region, off := uint32(addr>>32), uint32(addr)
+	if off != 0 || region < regionMap || region-regionMap >= uint32(len(m.p.maps)) {
+		return nil, false
+	}
+	return m.p.maps[region-regionMap], true
+}
+
+// monotonicBase is the origin of the time returned by
+// linux.BPF_FUNC_ktime_get_ns.
+var monotonicBase = time.Now()
+
+// errno returns the value returned by helpers failing with err.
+func errno(err error) uint64 {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(syscall.Errno); ok {
+		return uint64(-int64(e))
+	}
+	return uint64(-int64(syscall.EINVAL))
+}
+
+// call calls the helper with ID id.
+func (m *Machine) call(pc int, id int32) error {
+	var args [5]uint64
+	copy(args[:], m.regs[R1:R5+1])
+	switch id {
+	case linux.BPF_FUNC_map_lookup_elem:
+		mp, ok := m.mapAt(args[0])
+		if !ok {
+			return Error{InvalidMap, pc}
+		}
+		key, ok := m.Memory(args[1], int(mp.spec.KeySize), false)
+		if !ok {
+			return Error{InvalidMemoryAccess, pc}
+		}
+		m.regs[R0] = 0
+		if v, ok := mp.lookupLocked(key); ok {
+			m.values = append(m.values, v)
+			m.regs[R0] = address(regionValue+uint32(len(m.values)-1), 0)
+		}
+	case linux.BPF_FUNC_map_update_elem:
+		mp, ok := m.mapAt(args[0])
+		if !ok {
+			return Error{InvalidMap, pc}
+		}
+		key, ok := m.Memory(args[1], int(mp.spec.KeySize), false)
+		if !ok {
+			return Error{InvalidMemoryAccess, pc}
+		}
+		value, ok := m.Memory(args[2], int(mp.spec.ValueSize), false)
+		if !ok {
+			return Error{InvalidMemoryAccess, pc}
+		}
+		// Values are copied to the map, so they must not alias it.
+		m.regs[R0] = errno(mp.updateLocked(key, append([]byte(nil), value...), args[3]))
+	case linux.BPF_FUNC_map_delete_elem:
+		mp, ok := m.mapAt(args[0])
+		if !ok {
+			return Error{InvalidMap, pc}
+		}
+		key, ok := m.Memory(args[1], int(mp.spec.KeySize), false)
+		if !ok {
+			return Error{InvalidMemoryAccess, pc}
+		}
+		m.regs[R0] = errno(mp.deleteLocked(key))
+	case linux.BPF_FUNC_ktime_get_ns:
+		m.regs[R0] = uint64(time.Since(monotonicBase))
+	default:
+		h, ok := m.env.Helpers[id]
+		if !ok {
+			return Error{InvalidHelper, pc}
+		}
+		r0, err := h(m, args)
+		if err != nil {
+			return err
+		}
+		m.regs[R0] = r0
+	}
+	return nil
+}
+
+// sizeOf returns the size in bytes of memory accesses of insn.
+func sizeOf(insn linux.BPFInsn) int {
+	switch insn.OpCode & loadSizeMask {
+	case W:
+		return 4
+	case H:
+		return 2
+	case B:
+		return 1
+	default:
+		return 8
+	}
+}
+
+// load loads size bytes at addr.
+func (m *Machine) load(addr uint64, size int) (uint64, bool) {
+	if uint32(addr>>32) == regionContext {
+		if m.env.Context == nil {
+			return 0, false
+		}
+		return m.env.Context.Load(int(uint32(addr)), size)
+	}
+	b, ok := m.Memory(addr, size, false)
+	if !ok {
+		return 0, false
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), true
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b)), true
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b)), true
+	default:
+		return binary.LittleEndian.Uint64(b), true
+	}
+}
+
+// store stores the size least significant bytes of v at addr.
+func (m *Machine) store(addr uint64, size int, v uint64) bool {
+	if uint32(addr>>32) == regionContext {
+		if m.env.Context == nil {
+			return false
+		}
+		return m.env.Context.Store(int(uint32(addr)), size, v)
+	}
+	b, ok := m.Memory(addr, size, true)
+	if !ok {
+		return false
+	}
+	switch size {
+	case 1:
+		b[0] = uint8(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, v)
+	}
+	return true
+}
+
+// loadPacket loads size bytes of the packet at off in network order, for
+// legacy packet accesses.
+func (m *Machine) loadPacket(off uint64, size int) (uint64, bool) {
+	if off+uint64(size) > uint64(len(m.env.Packet)) {
+		return 0, false
+	}
+	b := m.env.Packet[off : off+uint64(size)]
+	switch size {
+	case 1:
+		return uint64(b[0]), true
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), true
+	default:
+		return uint64(binary.BigEndian.Uint32(b)), true
+	}
+}
+
+// alu64 returns the result of the 64-bit arithmetic operation op.
+func alu64(op uint8, dst, src uint64) uint64 {
+	switch op {
+	case Add:
+		return dst + src
+	case Sub:
+		return dst - src
+	case Mul:
+		return dst * src
+	case Div:
+		if src == 0 {
+			return 0
+		}
+		return dst / src
+	case Or:
+		return dst | src
+	case And:
+		return dst & src
+	case Lsh:
+		return dst << (src & 63)
+	case Rsh:
+		return dst >> (src & 63)
+	case Neg:
+		return -dst
+	case Mod:
+		if src == 0 {
+			return dst
+		}
+		return dst % src
+	case Xor:
+		return dst ^ src
+	case Mov:
+		return src
+	default: // Arsh
+		return uint64(int64(dst) >> (src & 63))
+	}
+}
+
+// alu32 returns the result of the 32-bit arithmetic operation op.
+func alu32(op uint8, dst, src uint32) uint32 {
+	switch op {
+	case Add:
+		return dst + src
+	case Sub:
+		return dst - src
+	case Mul:
+		return dst * src
+	case Div:
+		if src == 0 {
+			return 0
+		}
+		return dst / src
+	case Or:
+		return dst | src
+	case And:
+		return dst & src
+	case Lsh:
+		return dst << (src & 31)
+	case Rsh:
+		return dst >> (src & 31)
+	case Neg:
+		return -dst
+	case Mod:
+		if src == 0 {
+			return dst
+		}
+		return dst % src
+	case Xor:
+		return dst ^ src
+	case Mov:
+		return src
+	default: // Arsh
+		return uint32(int32(dst) >> (src & 31))
+	}
+}
+
+// byteSwap converts the size least significant bits of v to the byte order
+// selected by insn.
+func byteSwap(insn linux.BPFInsn, v uint64) uint64 {
+	// Like Linux, programs are run with the byte order of the host, which
+	// is little endian on all supported architectures.
+	toBE := insn.OpCode&endianMask == ToBE
+	switch insn.Imm {
+	case 16:
+		if toBE {
+			return uint64(bits.ReverseBytes16(uint16(v)))
+		}
+		return uint64(uint16(v))
+	case 32:
+		if toBE {
+			return uint64(bits.ReverseBytes32(uint32(v)))
+		}
+		return uint64(uint32(v))
+	default:
+		if toBE {
+			return bits.ReverseBytes64(v)
+		}
+		return v
+	}
+}
+
+// condition returns whether the condition of the jump op holds.
+func condition(op uint8, dst, src uint64, is32 bool) bool {
+	if is32 {
+		dst, src = uint64(uint32(dst)), uint64(uint32(src))
+	}
+	sdst, ssrc := int64(dst), int64(src)
+	if is32 {
+		sdst, ssrc = int64(int32(dst)), int64(int32(src))
+	}
+	switch op {
+	case Ja:
+		return true
+	case Jeq:
+		return dst == src
+	case Jgt:
+		return dst > src
+	case Jge:
+		return dst >= src
+	case Jset:
+		return dst&src != 0
+	case Jne:
+		return dst != src
+	case Jsgt:
+		return sdst > ssrc
+	case Jsge:
+		return sdst >= ssrc
+	case Jlt:
+		return dst < src
+	case Jle:
+		return dst <= src
+	case Jslt:
+		return sdst < ssrc
+	default: // Jsle
+		return sdst <= ssrc
+	}
+}
+
+// Run runs p in env, and returns the value of R0 when it exits. The maps p
+// references are locked while it runs.
+func (p *Program) Run(env *Env) (uint64, error) {
+	for _, mp := range p.lockOrder {
+		mp.mu.Lock()
+		defer mp.mu.Unlock()
+	}
+
+	m := Machine{
+		p:   p,
+		env: env,
+	}
+	m.regs[R1] = address(regionContext, 0)
+	m.regs[R10] = address(regionStack, StackSize)
+
+	for pc, executed := 0, 0; ; pc, executed = pc+1, executed+1 {
+		if executed >= MaxExecutedInstructions {
+			return 0, Error{TooManyInstructions, pc}
+		}
+		insn := p.instructions[pc]
+		dst, src := &m.regs[insn.Dst()], m.regs[insn.Src()]
+		switch insn.OpCode & instructionClassMask {
+		case Ld:
+			switch insn.OpCode & loadModeMask {
+			case Imm:
+				pc++
+				if insn.Src() == linux.BPF_PSEUDO_MAP_FD {
+					*dst = address(regionMap+uint32(insn.Imm), 0)
+				} else {
+					*dst = uint64(uint32(insn.Imm)) | uint64(uint32(p.instructions[pc].Imm))<<32
+				}
+			case Abs, Ind:
+				off := uint64(uint32(insn.Imm))
+				if insn.OpCode&loadModeMask == Ind {
+					off = uint64(uint32(src + off))
+				}
+				v, ok := m.loadPacket(off, sizeOf(insn))
+				if !ok {
+					// Like Linux, out of bounds legacy packet
+					// accesses exit the program.
+					return 0, nil
+				}
+				m.regs[R0] = v
+			}
+		case Ldx:
+			v, ok := m.load(src+uint64(insn.Off), sizeOf(insn))
+			if !ok {
+				return 0, Error{InvalidMemoryAccess, pc}
+			}
+			*dst = v
+		case St:
+			if !m.store(*dst+uint64(insn.Off), sizeOf(insn), uint64(insn.Imm)) {
+				return 0, Error{InvalidMemoryAccess, pc}
+			}
+		case Stx:
+			addr, size, v := *dst+uint64(insn.Off), sizeOf(insn), src
+			if insn.OpCode&loadModeMask == Atomic {
+				// The context can't be accessed atomically.
+				if uint32(addr>>32) == regionContext {
+					return 0, Error{InvalidMemoryAccess, pc}
+				}
+				old, ok := m.load(addr, size)
+				if !ok {
+					return 0, Error{InvalidMemoryAccess, pc}
+				}
+				v += old
+			}
+			if !m.store(addr, size, v) {
+				return 0, Error{InvalidMemoryAccess, pc}
+			}
+		case Alu, Alu64:
+			op := insn.OpCode & aluMask
+			if op == End {
+				*dst = byteSwap(insn, *dst)
+				break
+			}
+			operand := uint64(int64(insn.Imm))
+			if insn.OpCode&srcAluJmpMask == X {
+				operand = src
+			}
+			if insn.OpCode&instructionClassMask == Alu64 {
+				*dst = alu64(op, *dst, operand)
+			} else {
+				*dst = uint64(alu32(op, uint32(*dst), uint32(operand)))
+			}
+		case Jmp, Jmp32:
+			switch op := insn.OpCode & jmpMask; op {
+			case Call:
+				if err := m.call(pc, insn.Imm); err != nil {
+					return 0, err
+				}
+			case Exit:
+				return m.regs[R0], nil
+			default:
+				operand := uint64(int64(insn.Imm))
+				if insn.OpCode&srcAluJmpMask == X {
+					operand = src
+				}
+				if condition(op, *dst, operand, insn.OpCode&instructionClassMask == Jmp32) {
+					pc += int(insn.Off)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+func insn(op uint8, dst, src uint8, off int16, imm int32) linux.BPFInsn {
+	return linux.BPFInsn{OpCode: op, Regs: dst | src<<4, Off: off, Imm: imm}
+}
+
+// ldMap returns the instructions loading a pointer to maps[idx] in dst.
+func ldMap(dst uint8, idx int32) []linux.BPFInsn {
+	return []linux.BPFInsn{
+		insn(Ld|Imm|DW, dst, linux.BPF_PSEUDO_MAP_FD, 0, idx),
+		insn(0, 0, 0, 0, 0),
+	}
+}
+
+func program(parts ...interface{}) []linux.BPFInsn {
+	var insns []linux.BPFInsn
+	for _, p := range parts {
+		switch p := p.(type) {
+		case linux.BPFInsn:
+			insns = append(insns, p)
+		case []linux.BPFInsn:
+			insns = append(insns, p...)
+		}
+	}
+	return insns
+}
+
+var exit = insn(Jmp|Exit, 0, 0, 0, 0)
+
+func TestCompile(t *testing.T) {
+	m, err := NewMap(MapSpec{Type: linux.BPF_MAP_TYPE_ARRAY, KeySize: 4, ValueSize: 8, MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("NewMap(_): %s", err)
+	}
+	for _, test := range []struct {
+		name  string
+		insns []linux.BPFInsn
+		maps  []*Map
+		want  int
+	}{
+		{
+			name:  "empty",
+			insns: nil,
+			want:  InvalidInstructionCount,
+		},
+		{
+			name:  "no exit",
+			insns: program(insn(Alu64|Mov|K, R0, 0, 0, 0)),
+			want:  InvalidEndOfProgram,
+		},
+		{
+			name:  "write to frame pointer",
+			insns: program(insn(Alu64|Mov|K, R10, 0, 0, 0), exit),
+			want:  InvalidRegister,
+		},
+		{
+			name:  "invalid register",
+			insns: program(insn(Alu64|Mov|K, 11, 0, 0, 0), exit),
+			want:  InvalidRegister,
+		},
+		{
+			name:  "jump out of bounds",
+			insns: program(insn(Jmp|Jeq|K, R0, 0, 1, 0), exit),
+			want:  InvalidJumpTarget,
+		},
+		{
+			name:  "jump into immediate",
+			insns: program(insn(Jmp|Ja, 0, 0, 1, 0), ldMap(R1, 0), exit),
+			maps:  []*Map{m},
+			want:  InvalidJumpTarget,
+		},
+		{
+			name:  "missing map",
+			insns: program(ldMap(R1, 1), exit),
+			maps:  []*Map{m},
+			want:  InvalidMap,
+		},
+		{
+			name:  "function call",
+			insns: program(insn(Jmp|Call, 0, linux.BPF_PSEUDO_CALL, 0, 1), exit),
+			want:  InvalidOpcode,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile(test.insns, test.maps)
+			if e, ok := err.(Error); !ok || e.Code != test.want {
+				t.Errorf("got Compile(_, _) = %v, want error code %d", err, test.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	packet := []byte{0x45, 0x00, 0x01, 0x02, 0x03, 0x04}
+	for _, test := range []struct {
+		name  string
+		insns []linux.BPFInsn
+		want  uint64
+	}{
+		{
+			name: "64-bit arithmetic",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, -1),
+				insn(Alu64|Add|K, R0, 0, 0, 3),
+				insn(Alu64|Mul|K, R0, 0, 0, 5),
+				exit,
+			),
+			want: 10,
+		},
+		{
+			name: "32-bit arithmetic is zero extended",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, -1),
+				insn(Alu|Add|K, R0, 0, 0, 1),
+				insn(Alu|Sub|K, R0, 0, 0, 1),
+				exit,
+			),
+			want: 0xffffffff,
+		},
+		{
+			name: "division by zero",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, 7),
+				insn(Alu64|Mov|K, R1, 0, 0, 0),
+				insn(Alu64|Div|X, R0, R1, 0, 0),
+				exit,
+			),
+			want: 0,
+		},
+		{
+			name: "modulo by zero",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, 7),
+				insn(Alu64|Mod|K, R0, 0, 0, 0),
+				exit,
+			),
+			want: 7,
+		},
+		{
+			name: "arithmetic shift",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, -16),
+				insn(Alu64|Arsh|K, R0, 0, 0, 2),
+				exit,
+			),
+			want: 0xfffffffffffffffc,
+		},
+		{
+			name: "byte swap",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, 0x1234),
+				insn(Alu|End|ToBE, R0, 0, 0, 16),
+				exit,
+			),
+			want: 0x3412,
+		},
+		{
+			name: "64-bit immediate",
+			insns: program(
+				insn(Ld|Imm|DW, R0, 0, 0, 2),
+				insn(0, 0, 0, 0, 1),
+				exit,
+			),
+			want: 1<<32 | 2,
+		},
+		{
+			name: "signed jump",
+			insns: program(
+				insn(Alu64|Mov|K, R1, 0, 0, -1),
+				insn(Alu64|Mov|K, R0, 0, 0, 1),
+				insn(Jmp|Jsgt|K, R1, 0, 1, 0),
+				insn(Alu64|Mov|K, R0, 0, 0, 2),
+				exit,
+			),
+			want: 2,
+		},
+		{
+			name: "32-bit jump",
+			insns: program(
+				insn(Ld|Imm|DW, R1, 0, 0, 5),
+				insn(0, 0, 0, 0, 1),
+				insn(Alu64|Mov|K, R0, 0, 0, 1),
+				insn(Jmp32|Jeq|K, R1, 0, 1, 5),
+				insn(Alu64|Mov|K, R0, 0, 0, 2),
+				exit,
+			),
+			want: 1,
+		},
+		{
+			name: "bounded loop",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, 0),
+				insn(Alu64|Add|K, R0, 0, 0, 1),
+				insn(Jmp|Jlt|K, R0, 0, -2, 10),
+				exit,
+			),
+			want: 10,
+		},
+		{
+			name: "stack",
+			insns: program(
+				insn(St|Mem|DW, R10, 0, -8, 40),
+				insn(Alu64|Mov|K, R1, 0, 0, 2),
+				insn(Stx|Atomic|DW, R10, R1, -8, 0),
+				insn(Ldx|Mem|DW, R0, R10, -8, 0),
+				exit,
+			),
+			want: 42,
+		},
+		{
+			name: "legacy packet access",
+			insns: program(
+				insn(Alu64|Mov|K, R1, 0, 0, 1),
+				insn(Ld|Ind|H, 0, R1, 0, 1),
+				exit,
+			),
+			want: 0x0102,
+		},
+		{
+			name: "legacy packet access out of bounds",
+			insns: program(
+				insn(Alu64|Mov|K, R0, 0, 0, 1),
+				insn(Ld|Abs|W, 0, 0, 0, 4),
+				exit,
+			),
+			want: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Compile(test.insns, nil)
+			if err != nil {
+				t.Fatalf("Compile(_, nil): %s", err)
+			}
+			got, err := p.Run(&Env{Packet: packet})
+			if err != nil {
+				t.Fatalf("p.Run(_): %s", err)
+			}
+			if got != test.want {
+				t.Errorf("got p.Run(_) = %#x, want = %#x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		insns []linux.BPFInsn
+		want  int
+	}{
+		{
+			name:  "null pointer",
+			insns: program(insn(Ldx|Mem|W, R0, R0, 0, 0), exit),
+			want:  InvalidMemoryAccess,
+		},
+		{
+			name:  "stack overflow",
+			insns: program(insn(St|Mem|W, R10, 0, 0, 0), exit),
+			want:  InvalidMemoryAccess,
+		},
+		{
+			name:  "stack underflow",
+			insns: program(insn(Ldx|Mem|DW, R0, R10, -StackSize-8, 0), exit),
+			want:  InvalidMemoryAccess,
+		},
+		{
+			name:  "context without context",
+			insns: program(insn(Ldx|Mem|W, R0, R1, 0, 0), exit),
+			want:  InvalidMemoryAccess,
+		},
+		{
+			name:  "unknown helper",
+			insns: program(insn(Jmp|Call, 0, 0, 0, 1000), exit),
+			want:  InvalidHelper,
+		},
+		{
+			name:  "infinite loop",
+			insns: program(insn(Jmp|Ja, 0, 0, -1, 0)),
+			want:  TooManyInstructions,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Compile(test.insns, nil)
+			if err != nil {
+				t.Fatalf("Compile(_, nil): %s", err)
+			}
+			_, err = p.Run(&Env{})
+			if e, ok := err.(Error); !ok || e.Code != test.want {
+				t.Errorf("got p.Run(_) = %v, want error code %d", err, test.want)
+			}
+		})
+	}
+}
+
+// testContext is a context with a single writable 32-bit field.
+type testContext struct {
+	field uint32
+}
+
+func (c *testContext) Load(off, size int) (uint64, bool) {
+	return uint64(c.field), off == 0 && size == 4
+}
+
+func (c *testContext) Store(off, size int, v uint64) bool {
+	c.field = uint32(v)
+	return off == 0 && size == 4
+}
+
+func TestContextAndHelpers(t *testing.T) {
+	p, err := Compile(program(
+		insn(Ldx|Mem|W, R6, R1, 0, 0),
+		insn(Alu64|Add|K, R6, 0, 0, 1),
+		insn(Stx|Mem|W, R1, R6, 0, 0),
+		insn(Alu64|Mov|X, R1, R6, 0, 0),
+		insn(Jmp|Call, 0, 0, 0, 100),
+		exit,
+	), nil)
+	if err != nil {
+		t.Fatalf("Compile(_, nil): %s", err)
+	}
+	ctx := testContext{field: 41}
+	got, err := p.Run(&Env{
+		Context: &ctx,
+		Helpers: map[int32]Helper{
+			100: func(_ *Machine, args [5]uint64) (uint64, error) {
+				return args[0] * 2, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("p.Run(_): %s", err)
+	}
+	if got != 84 {
+		t.Errorf("got p.Run(_) = %d, want = 84", got)
+	}
+	if ctx.field != 42 {
+		t.Errorf("got context field = %d, want = 42", ctx.field)
+	}
+}
+
+func TestMaps(t *testing.T) {
+	counters, err := NewMap(MapSpec{Name: "counters", Type: linux.BPF_MAP_TYPE_HASH, KeySize: 4, ValueSize: 8, MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("NewMap(_): %s", err)
+	}
+	// The program counts its runs for the key in R6, inserting the
+	// element on the first run.
+	p, err := Compile(program(
+		insn(Alu64|Mov|K, R6, 0, 0, 7),
+		insn(Stx|Mem|W, R10, R6, -4, 0),
+		ldMap(R1, 0),
+		insn(Alu64|Mov|X, R2, R10, 0, 0),
+		insn(Alu64|Add|K, R2, 0, 0, -4),
+		insn(Jmp|Call, 0, 0, 0, linux.BPF_FUNC_map_lookup_elem),
+		insn(Jmp|Jeq|K, R0, 0, 4, 0),
+		// The element exists, increment it.
+		insn(Alu64|Mov|K, R1, 0, 0, 1),
+		insn(Stx|Atomic|DW, R0, R1, 0, 0),
+		insn(Alu64|Mov|K, R0, 0, 0, 0),
+		exit,
+		// Insert the element.
+		insn(St|Mem|DW, R10, 0, -16, 1),
+		ldMap(R1, 0),
+		insn(Alu64|Mov|X, R2, R10, 0, 0),
+		insn(Alu64|Add|K, R2, 0, 0, -4),
+		insn(Alu64|Mov|X, R3, R10, 0, 0),
+		insn(Alu64|Add|K, R3, 0, 0, -16),
+		insn(Alu64|Mov|K, R4, 0, 0, linux.BPF_NOEXIST),
+		insn(Jmp|Call, 0, 0, 0, linux.BPF_FUNC_map_update_elem),
+		exit,
+	), []*Map{counters})
+	if err != nil {
+		t.Fatalf("Compile(_, _): %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got, err := p.Run(&Env{}); err != nil || got != 0 {
+			t.Fatalf("got p.Run(_) = (%d, %v), want = (0, nil)", got, err)
+		}
+	}
+	key := []byte{7, 0, 0, 0}
+	v, err := counters.Lookup(key)
+	if err != nil {
+		t.Fatalf("counters.Lookup(%v): %s", key, err)
+	}
+	if got := binary.LittleEndian.Uint64(v); got != 3 {
+		t.Errorf("got counter = %d, want = 3", got)
+	}
+
+	if err := counters.Delete(key); err != nil {
+		t.Fatalf("counters.Delete(%v): %s", key, err)
+	}
+	if _, err := counters.Lookup(key); err != syscall.ENOENT {
+		t.Errorf("got counters.Lookup(%v) = %v after deletion, want = %s", key, err, syscall.ENOENT)
+	}
+	for _, k := range [][]byte{{1, 0, 0, 0}, {2, 0, 0, 0}} {
+		if err := counters.Update(k, make([]byte, 8), linux.BPF_ANY); err != nil {
+			t.Fatalf("counters.Update(%v, _, BPF_ANY): %s", k, err)
+		}
+	}
+	// The map is full.
+	if got, err := p.Run(&Env{}); err != nil || got != uint64(-int64(syscall.E2BIG)) {
+		t.Errorf("got p.Run(_) = (%d, %v) with a full map, want = (%d, nil)", int64(got), err, -int64(syscall.E2BIG))
+	}
+	if got := len(counters.Entries()); got != 2 {
+		t.Errorf("got %d entries, want 2", got)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// MapSpec describes a map.
+type MapSpec struct {
+	// Name is the name of the map.
+	Name string
+
+	// Type is the type of the map, linux.BPF_MAP_TYPE_HASH or
+	// linux.BPF_MAP_TYPE_ARRAY.
+	Type uint32
+
+	// KeySize and ValueSize are the sizes of the keys and values of the
+	// map. The keys of arrays are 32-bit indices.
+	KeySize   uint32
+	ValueSize uint32
+
+	// MaxEntries is the maximum number of entries of the map.
+	MaxEntries uint32
+}
+
+// lastMapID is the ID of the last created map.
+var lastMapID uint64
+
+// Map is a map shared by programs and their users.
+type Map struct {
+	spec MapSpec
+
+	// id orders the locking of maps.
+	id uint64
+
+	// mu protects the values of the map, including the elements pointed to
+	// by running programs. Programs lock the maps they reference while they
+	// run.
+	mu sync.Mutex
+
+	// hash holds the elements of hash maps by key.
+	hash map[string][]byte
+
+	// array holds the elements of arrays.
+	array [][]byte
+}
+
+// MapEntry is an element of a map.
+type MapEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// NewMap creates a new map.
+func NewMap(spec MapSpec) (*Map, error) {
+	if spec.ValueSize == 0 || spec.MaxEntries == 0 {
+		return nil, fmt.Errorf("map %q has empty values or no entries", spec.Name)
+	}
+	m := &Map{
+		spec: spec,
+		id:   atomic.AddUint64(&lastMapID, 1),
+	}
+	switch spec.Type {
+	case linux.BPF_MAP_TYPE_HASH:
+		if spec.KeySize == 0 {
+			return nil, fmt.Errorf("map %q has empty keys", spec.Name)
+		}
+		m.hash = make(map[string][]byte)
+	case linux.BPF_MAP_TYPE_ARRAY:
+		if spec.KeySize != 4 {
+			return nil, fmt.Errorf("array %q has keys of %d bytes, want 4", spec.Name, spec.KeySize)
+		}
+		m.array = make([][]byte, spec.MaxEntries)
+		for i := range m.array {
+			m.array[i] = make([]byte, spec.ValueSize)
+		}
+	default:
+		return nil, fmt.Errorf("map %q has unsupported type %d", spec.Name, spec.Type)
+	}
+	return m, nil
+}
+
+// Spec returns the description of m.
+func (m *Map) Spec() MapSpec {
+	return m.spec
+}
+
+// index returns the index of the element of the array m with key.
+func (m *Map) index(key []byte) (uint32, bool) {
+	i := uint32(key[0]) | uint32(key[1])<<8 | uint32(key[2])<<16 | uint32(key[3])<<24
+	return i, i < m.spec.MaxEntries
+}
+
+// lookupLocked returns the value of the element with key, which is not
+// copied.
+//
+// Precondition: m.mu must be locked.
+func (m *Map) lookupLocked(key []byte) ([]byte, bool) {
+	if m.hash != nil {
+		v, ok := m.hash[string(key)]
+		return v, ok
+	}
+	i, ok := m.index(key)
+	if !ok {
+		return nil, false
+	}
+	return m.array[i], true
+}
+
+// updateLocked sets the value of the element with key, as per flags, one of
+// linux.BPF_ANY, linux.BPF_NOEXIST and linux.BPF_EXIST.
+//
+// Precondition: m.mu must be locked.
+func (m *Map) updateLocked(key, value []byte, flags uint64) error {
+	if flags > linux.BPF_EXIST {
+		return syscall.EINVAL
+	}
+	if m.hash == nil {
+		i, ok := m.index(key)
+		if !ok {
+			return syscall.E2BIG
+		}
+		if flags == linux.BPF_NOEXIST {
+			// Elements of arrays always exist.
+			return syscall.EEXIST
+		}
+		copy(m.array[i], value)
+		return nil
+	}
+
+	old, ok := m.hash[string(key)]
+	switch {
+	case ok && flags == linux.BPF_NOEXIST:
+		return syscall.EEXIST
+	case !ok && flags == linux.BPF_EXIST:
+		return syscall.ENOENT
+	case ok:
+		// Programs may hold pointers to the old value.
+		copy(old, value)
+		return nil
+	case len(m.hash) >= int(m.spec.MaxEntries):
+		return syscall.E2BIG
+	}
+	m.hash[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+// deleteLocked deletes the element with key.
+//
+// Precondition: m.mu must be locked.
+func (m *Map) deleteLocked(key []byte) error {
+	if m.hash == nil {
+		// Elements of arrays can't be deleted.
+		return syscall.EINVAL
+	}
+	if _, ok := m.hash[string(key)]; !ok {
+		return syscall.ENOENT
+	}
+	delete(m.hash, string(key))
+	return nil
+}
+
+// checkKey checks that key has the size of the keys of m.
+func (m *Map) checkKey(key []byte) error {
+	if len(key) != int(m.spec.KeySize) {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// Lookup returns a copy of the value of the element with key.
+func (m *Map) Lookup(key []byte) ([]byte, error) {
+	if err := m.checkKey(key); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.lookupLocked(key)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Update sets the value of the element with key, as per flags, one of
+// linux.BPF_ANY, linux.BPF_NOEXIST and linux.BPF_EXIST.
+func (m *Map) Update(key, value []byte, flags uint64) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+	if len(value) != int(m.spec.ValueSize) {
+		return syscall.EINVAL
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateLocked(key, value, flags)
+}
+
+// Delete deletes the element with key.
+func (m *Map) Delete(key []byte) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteLocked(key)
+}
+
+// Entries returns a copy of the elements of m, ordered by key.
+func (m *Map) Entries() []MapEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []MapEntry
+	if m.hash == nil {
+		for i, v := range m.array {
+			entries = append(entries, MapEntry{
+				Key:   []byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)},
+				Value: append([]byte(nil), v...),
+			})
+		}
+		return entries
+	}
+	for k, v := range m.hash {
+		entries = append(entries, MapEntry{
+			Key:   []byte(k),
+			Value: append([]byte(nil), v...),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return string(entries[i].Key) < string(entries[j].Key)
+	})
+	return entries
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// Program is an eBPF program that has been validated for consistency.
+type Program struct {
+	instructions []linux.BPFInsn
+
+	// maps are the maps the program references, by index.
+	maps []*Map
+
+	// lockOrder holds the maps the program references, once each, in the
+	// order they are locked in.
+	lockOrder []*Map
+}
+
+// Length returns the number of instructions in the program.
+func (p *Program) Length() int {
+	return len(p.instructions)
+}
+
+// Maps returns the maps the program references.
+func (p *Program) Maps() []*Map {
+	return p.maps
+}
+
+// Compile validates the instructions of a program, and binds it to maps.
+// Instructions loading maps, with source register linux.BPF_PSEUDO_MAP_FD, use
+// their immediate as an index into maps instead of a file descriptor.
+//
+// Unlike Linux, Compile doesn't verify that the program accesses memory
+// safely, which is checked as the program runs instead. Calls to BPF functions
+// and loads of map values are not supported.
+func Compile(insns []linux.BPFInsn, maps []*Map) (*Program, error) {
+	if len(insns) == 0 || len(insns) > MaxInstructions {
+		return nil, Error{InvalidInstructionCount, len(insns)}
+	}
+
+	// immediates holds the second instructions of 64-bit immediate loads,
+	// which must not be jumped to.
+	immediates := make(map[int]bool)
+	var jumps []int
+	for pc := 0; pc < len(insns); pc++ {
+		i := insns[pc]
+		if i.Dst() >= NumRegisters || i.Src() >= NumRegisters {
+			return nil, Error{InvalidRegister, pc}
+		}
+		switch i.OpCode & instructionClassMask {
+		case Ld:
+			if i.Dst() == R10 {
+				return nil, Error{InvalidRegister, pc}
+			}
+			switch i.OpCode {
+			case Ld | Imm | DW:
+				// The immediate spans two instructions.
+				if pc+1 >= len(insns) || insns[pc+1].OpCode != 0 || insns[pc+1].Regs != 0 {
+					return nil, Error{InvalidOpcode, pc}
+				}
+				switch i.Src() {
+				case 0:
+				case linux.BPF_PSEUDO_MAP_FD:
+					if i.Imm < 0 || int(i.Imm) >= len(maps) || insns[pc+1].Imm != 0 {
+						return nil, Error{InvalidMap, pc}
+					}
+				default:
+					return nil, Error{InvalidOpcode, pc}
+				}
+				immediates[pc+1] = true
+				pc++
+			case Ld | Abs | W, Ld | Abs | H, Ld | Abs | B, Ld | Ind | W, Ld | Ind | H, Ld | Ind | B:
+			default:
+				return nil, Error{InvalidOpcode, pc}
+			}
+		case Ldx:
+			if i.Dst() == R10 {
+				return nil, Error{InvalidRegister, pc}
+			}
+			if i.OpCode&loadModeMask != Mem {
+				return nil, Error{InvalidOpcode, pc}
+			}
+		case St:
+			if i.OpCode&loadModeMask != Mem {
+				return nil, Error{InvalidOpcode, pc}
+			}
+		case Stx:
+			switch i.OpCode & loadModeMask {
+			case Mem:
+			case Atomic:
+				// Only atomic additions are supported.
+				if size := i.OpCode & loadSizeMask; (size != W && size != DW) || i.Imm != 0 {
+					return nil, Error{InvalidOpcode, pc}
+				}
+			default:
+				return nil, Error{InvalidOpcode, pc}
+			}
+		case Alu, Alu64:
+			if i.Dst() == R10 {
+				return nil, Error{InvalidRegister, pc}
+			}
+			switch i.OpCode & aluMask {
+			case Add, Sub, Mul, Div, Or, And, Lsh, Rsh, Mod, Xor, Mov, Arsh:
+			case Neg:
+				if i.OpCode&srcAluJmpMask != K {
+					return nil, Error{InvalidOpcode, pc}
+				}
+			case End:
+				if i.OpCode&instructionClassMask != Alu || (i.Imm != 16 && i.Imm != 32 && i.Imm != 64) {
+					return nil, Error{InvalidOpcode, pc}
+				}
+			default:
+				return nil, Error{InvalidOpcode, pc}
+			}
+		case Jmp, Jmp32:
+			switch op := i.OpCode & jmpMask; op {
+			case Call:
+				// Helpers are looked up as the program runs.
+				if i.OpCode != Jmp|Call || i.Src() != 0 {
+					return nil, Error{InvalidOpcode, pc}
+				}
+			case Exit:
+				if i.OpCode != Jmp|Exit {
+					return nil, Error{InvalidOpcode, pc}
+				}
+			case Ja, Jeq, Jgt, Jge, Jset, Jne, Jsgt, Jsge, Jlt, Jle, Jslt, Jsle:
+				if op == Ja && i.OpCode != Jmp|Ja {
+					return nil, Error{InvalidOpcode, pc}
+				}
+				if target := pc + 1 + int(i.Off); target < 0 || target >= len(insns) {
+					return nil, Error{InvalidJumpTarget, pc}
+				}
+				jumps = append(jumps, pc)
+			default:
+				return nil, Error{InvalidOpcode, pc}
+			}
+		}
+	}
+
+	for _, pc := range jumps {
+		if immediates[pc+1+int(insns[pc].Off)] {
+			return nil, Error{InvalidJumpTarget, pc}
+		}
+	}
+
+	// The program must not run past its end.
+	if last := insns[len(insns)-1].OpCode; last != Jmp|Exit && last != Jmp|Ja {
+		return nil, Error{InvalidEndOfProgram, len(insns) - 1}
+	}
+
+	p := &Program{
+		instructions: insns,
+		maps:         maps,
+	}
+	seen := make(map[*Map]bool)
+	for _, m := range maps {
+		if m == nil {
+			return nil, Error{InvalidMap, 0}
+		}
+		if !seen[m] {
+			seen[m] = true
+			p.lockOrder = append(p.lockOrder, m)
+		}
+	}
+	// Lock maps in a global order so that programs sharing maps don't
+	// deadlock.
+	sort.Slice(p.lockOrder, func(i, j int) bool {
+		return p.lockOrder[i].id < p.lockOrder[j].id
+	})
+	return p, nil
+}
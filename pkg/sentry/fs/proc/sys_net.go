@@ -17,6 +17,9 @@ package proc
 import (
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -25,8 +28,14 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/device"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
@@ -367,20 +376,22 @@ func (f *tcpRecoveryFile) Write(ctx context.Context, _ *fs.File, src usermem.IOS
 }
 
 func (p *proc) newSysNetCore(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
-	// The following files are simple stubs until they are implemented in
-	// netstack, most of these files are configuration related. We use the
-	// value closest to the actual netstack behavior or any empty file,
-	// all of these files will have mode 0444 (read-only for all users).
 	contents := map[string]*fs.Inode{
+		"rmem_default": newSocketBufferInode(ctx, msrc, s, tcpRMem, false /* max */),
+		"rmem_max":     newSocketBufferInode(ctx, msrc, s, tcpRMem, true /* max */),
+		"somaxconn":    newSoMaxConnInode(ctx, msrc, s),
+		"wmem_default": newSocketBufferInode(ctx, msrc, s, tcpWMem, false /* max */),
+		"wmem_max":     newSocketBufferInode(ctx, msrc, s, tcpWMem, true /* max */),
+
+		// The following files are simple stubs until they are implemented
+		// in netstack, most of these files are configuration related. We
+		// use the value closest to the actual netstack behavior or any
+		// empty file, all of these files will have mode 0444 (read-only
+		// for all users).
 		"default_qdisc": newStaticProcInode(ctx, msrc, []byte("pfifo_fast")),
 		"message_burst": newStaticProcInode(ctx, msrc, []byte("10")),
 		"message_cost":  newStaticProcInode(ctx, msrc, []byte("5")),
 		"optmem_max":    newStaticProcInode(ctx, msrc, []byte("0")),
-		"rmem_default":  newStaticProcInode(ctx, msrc, []byte("212992")),
-		"rmem_max":      newStaticProcInode(ctx, msrc, []byte("212992")),
-		"somaxconn":     newStaticProcInode(ctx, msrc, []byte("128")),
-		"wmem_default":  newStaticProcInode(ctx, msrc, []byte("212992")),
-		"wmem_max":      newStaticProcInode(ctx, msrc, []byte("212992")),
 	}
 
 	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
@@ -395,18 +406,939 @@ func (p *proc) newSysNetCore(ctx context.Context, msrc *fs.MountSource, s inet.S
 type ipForwarding struct {
 	fsutil.SimpleFileInode
 
+	stack    inet.Stack `state:"wait"`
+	protocol tcpip.NetworkProtocolNumber
+
+	// readOnly is true for the IPv6 forwarding files of individual
+	// interfaces, as netstack doesn't support per interface forwarding.
+	readOnly bool
+
+	// enabled stores the forwarding state on save.
+	// We must save/restore this here, since a netstack instance
+	// is created on restore.
+	enabled *bool
+}
+
+func newIPForwardingInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, protocol tcpip.NetworkProtocolNumber, readOnly bool) *fs.Inode {
+	mode := linux.FileMode(0644)
+	if readOnly {
+		mode = 0444
+	}
+	ipf := &ipForwarding{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(mode), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+		protocol:        protocol,
+		readOnly:        readOnly,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, ipf, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate. Truncate is called when
+// O_TRUNC is specified for any kind of existing Dirent but is not called via
+// (f)truncate for proc files.
+func (*ipForwarding) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// +stateify savable
+type ipForwardingFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	ipf *ipForwarding
+
+	stack inet.Stack `state:"wait"`
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (ipf *ipForwarding) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &ipForwardingFile{
+		stack: ipf.stack,
+		ipf:   ipf,
+	}), nil
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *ipForwardingFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+
+	// The stack is always queried, as the IPv6 forwarding files of all
+	// interfaces share the same setting.
+	enabled := f.stack.Forwarding(f.ipf.protocol)
+	f.ipf.enabled = &enabled
+
+	val := "0\n"
+	if *f.ipf.enabled {
+		// Technically, this is not quite compatible with Linux. Linux
+		// stores these as an integer, so if you write "2" into
+		// ip_forward, you should get 2 back.
+		val = "1\n"
+	}
+	n, err := dst.CopyOut(ctx, []byte(val))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+//
+// Offset is ignored, multiple writes are not supported.
+func (f *ipForwardingFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if f.ipf.readOnly {
+		return 0, syserror.EPERM
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Only consider size of one memory page for input for performance reasons.
+	// We are only reading if it's zero or not anyway.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if f.ipf.enabled == nil {
+		f.ipf.enabled = new(bool)
+	}
+	*f.ipf.enabled = v != 0
+	return n, f.stack.SetForwarding(f.ipf.protocol, *f.ipf.enabled)
+}
+
+// portRangeInode is used to read/write the netstack ephemeral port range.
+//
+// +stateify savable
+type portRangeInode struct {
+	fsutil.SimpleFileInode
+
+	stack inet.Stack `state:"wait"`
+
+	// start and end store the port range during save, and set it in netstack
+	// on restore. We must save/restore this here, since a netstack instance
+	// is created on restore.
+	start uint16
+	end   uint16
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*portRangeInode)(nil)
+
+func newPortRangeInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	pr := &portRangeInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, pr, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*portRangeInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (pr *portRangeInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &portRangeFile{pr: pr}), nil
+}
+
+// +stateify savable
+type portRangeFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	pr *portRangeInode
+}
+
+var _ fs.FileOperations = (*portRangeFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *portRangeFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	f.pr.mu.Lock()
+	defer f.pr.mu.Unlock()
+
+	start, end := f.pr.stack.PortRange()
+	s := fmt.Sprintf("%d\t%d\n", start, end)
+	n, err := dst.CopyOut(ctx, []byte(s))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *portRangeFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	f.pr.mu.Lock()
+	defer f.pr.mu.Unlock()
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	start, end := f.pr.stack.PortRange()
+	buf := []int32{int32(start), int32(end)}
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	// Linux rejects ranges that are empty or contain port 0.
+	if buf[0] <= 0 || buf[1] > math.MaxUint16 || buf[0] > buf[1] {
+		return 0, syserror.EINVAL
+	}
+	return n, f.pr.stack.SetPortRange(uint16(buf[0]), uint16(buf[1]))
+}
+
+// pingGroupRangeInode is used to read/write the range of groups whose members
+// may create ICMP echo sockets.
+//
+// +stateify savable
+type pingGroupRangeInode struct {
+	fsutil.SimpleFileInode
+
+	stack inet.Stack `state:"wait"`
+
+	// low and high store the group range during save, and set it in
+	// netstack on restore.
+	low  auth.KGID
+	high auth.KGID
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*pingGroupRangeInode)(nil)
+
+func newPingGroupRangeInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	pg := &pingGroupRangeInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, pg, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*pingGroupRangeInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (pg *pingGroupRangeInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &pingGroupRangeFile{pg: pg}), nil
+}
+
+// +stateify savable
+type pingGroupRangeFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	pg *pingGroupRangeInode
+}
+
+var _ fs.FileOperations = (*pingGroupRangeFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *pingGroupRangeFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	f.pg.mu.Lock()
+	defer f.pg.mu.Unlock()
+
+	ns := auth.CredentialsFromContext(ctx).UserNamespace
+	low, high := f.pg.stack.PingGroupRange()
+	s := fmt.Sprintf("%d\t%d\n", low.In(ns).OrOverflow(), high.In(ns).OrOverflow())
+	n, err := dst.CopyOut(ctx, []byte(s))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *pingGroupRangeFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	f.pg.mu.Lock()
+	defer f.pg.mu.Unlock()
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]int32, 2)
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] < 0 || buf[1] < 0 {
+		return 0, syserror.EINVAL
+	}
+
+	// As in Linux, the groups are in the writer's user namespace, and a
+	// range with high < low disables ICMP echo sockets for all groups.
+	ns := auth.CredentialsFromContext(ctx).UserNamespace
+	low := ns.MapToKGID(auth.GID(buf[0]))
+	high := ns.MapToKGID(auth.GID(buf[1]))
+	if !low.Ok() || !high.Ok() {
+		return 0, syserror.EINVAL
+	}
+	if high < low {
+		low, high = 1, 0
+	}
+	if err := f.pg.stack.SetPingGroupRange(low, high); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// reservedPortsInode is used to read/write the ports netstack never picks as
+// ephemeral ports.
+//
+// +stateify savable
+type reservedPortsInode struct {
+	fsutil.SimpleFileInode
+
+	stack inet.Stack `state:"wait"`
+
+	// ports stores the reserved ports during save, and sets them in netstack
+	// on restore. We must save/restore this here, since a netstack instance
+	// is created on restore.
+	ports []uint16
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*reservedPortsInode)(nil)
+
+func newReservedPortsInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	rp := &reservedPortsInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, rp, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*reservedPortsInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (rp *reservedPortsInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &reservedPortsFile{rp: rp}), nil
+}
+
+// +stateify savable
+type reservedPortsFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	rp *reservedPortsInode
+}
+
+var _ fs.FileOperations = (*reservedPortsFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *reservedPortsFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	f.rp.mu.Lock()
+	defer f.rp.mu.Unlock()
+
+	s := inet.FormatPortList(f.rp.stack.LocalReservedPorts()) + "\n"
+	if offset >= int64(len(s)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, []byte(s[offset:]))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *reservedPortsFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	f.rp.mu.Lock()
+	defer f.rp.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	ports, err := inet.ParsePortList(string(buf[:n]))
+	if err != nil {
+		return 0, syserror.EINVAL
+	}
+	return int64(n), f.rp.stack.SetLocalReservedPorts(ports)
+}
+
+// transportMemInode is used to read/write the memory limits of a netstack
+// transport protocol.
+//
+// +stateify savable
+type transportMemInode struct {
+	fsutil.SimpleFileInode
+
+	protocol tcpip.TransportProtocolNumber
+	stack    inet.Stack `state:"wait"`
+
+	// limits stores the memory limits during save, and sets them in netstack
+	// on restore. We must save/restore this here, since a netstack instance
+	// is created on restore.
+	limits inet.TransportMemoryLimits
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*transportMemInode)(nil)
+
+func newTransportMemInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, protocol tcpip.TransportProtocolNumber) *fs.Inode {
+	tm := &transportMemInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		protocol:        protocol,
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, tm, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*transportMemInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (tm *transportMemInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &transportMemFile{tm: tm}), nil
+}
+
+// +stateify savable
+type transportMemFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	tm *transportMemInode
+}
+
+var _ fs.FileOperations = (*transportMemFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *transportMemFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	f.tm.mu.Lock()
+	defer f.tm.mu.Unlock()
+
+	limits, err := f.tm.stack.TransportMemoryLimits(f.tm.protocol)
+	if err != nil {
+		return 0, err
+	}
+	s := fmt.Sprintf("%d\t%d\t%d\n", limits.Min, limits.Pressure, limits.Max)
+	n, err := dst.CopyOut(ctx, []byte(s))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *transportMemFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	f.tm.mu.Lock()
+	defer f.tm.mu.Unlock()
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	limits, err := f.tm.stack.TransportMemoryLimits(f.tm.protocol)
+	if err != nil {
+		return 0, err
+	}
+	buf := []int32{int32(limits.Min), int32(limits.Pressure), int32(limits.Max)}
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	newLimits := inet.TransportMemoryLimits{
+		Min:      int(buf[0]),
+		Pressure: int(buf[1]),
+		Max:      int(buf[2]),
+	}
+	return n, f.tm.stack.SetTransportMemoryLimits(f.tm.protocol, newLimits)
+}
+
+// tcpCongestionControlInode is used to read/write the congestion control
+// algorithm of netstack, or to list the available ones.
+//
+// +stateify savable
+type tcpCongestionControlInode struct {
+	fsutil.SimpleFileInode
+
+	stack inet.Stack `state:"wait"`
+
+	// available is true for tcp_available_congestion_control, which is
+	// read-only.
+	available bool
+
+	// cc stores the congestion control algorithm during save, and sets it in
+	// netstack on restore. We must save/restore this here, since a netstack
+	// instance is created on restore.
+	cc string
+}
+
+var _ fs.InodeOperations = (*tcpCongestionControlInode)(nil)
+
+func newTCPCongestionControlInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, available bool) *fs.Inode {
+	mode := linux.FileMode(0644)
+	if available {
+		mode = 0444
+	}
+	cc := &tcpCongestionControlInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(mode), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+		available:       available,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, cc, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*tcpCongestionControlInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (cc *tcpCongestionControlInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &tcpCongestionControlFile{cc: cc}), nil
+}
+
+// +stateify savable
+type tcpCongestionControlFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	cc *tcpCongestionControlInode
+}
+
+var _ fs.FileOperations = (*tcpCongestionControlFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *tcpCongestionControlFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+
+	var s string
+	if f.cc.available {
+		available, err := f.cc.stack.TCPAvailableCongestionControl()
+		if err != nil {
+			return 0, err
+		}
+		s = strings.Join(available, " ")
+	} else {
+		cc, err := f.cc.stack.TCPCongestionControl()
+		if err != nil {
+			return 0, err
+		}
+		s = cc
+	}
+	n, err := dst.CopyOut(ctx, []byte(s+"\n"))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *tcpCongestionControlFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if f.cc.available {
+		return 0, syserror.EPERM
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	cc := strings.TrimSpace(string(buf[:n]))
+	if cc == "" {
+		return 0, syserror.EINVAL
+	}
+	if err := f.cc.stack.SetTCPCongestionControl(cc); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// socketBufferInode is used to read/write the default or maximum size of the
+// buffers of non-TCP sockets.
+//
+// +stateify savable
+type socketBufferInode struct {
+	fsutil.SimpleFileInode
+
+	dir   tcpMemDir
+	max   bool
+	stack inet.Stack `state:"wait"`
+
+	// size stores the buffer sizes during save, and sets them in netstack on
+	// restore. We must save/restore this here, since a netstack instance is
+	// created on restore.
+	size inet.SocketBufferSize
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*socketBufferInode)(nil)
+
+func newSocketBufferInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, dir tcpMemDir, max bool) *fs.Inode {
+	sb := &socketBufferInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		dir:             dir,
+		max:             max,
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, sb, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*socketBufferInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (sb *socketBufferInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &socketBufferFile{sb: sb}), nil
+}
+
+// readSize returns the buffer sizes of sb's stack.
+func (sb *socketBufferInode) readSize() (inet.SocketBufferSize, error) {
+	switch sb.dir {
+	case tcpRMem:
+		return sb.stack.SocketReceiveBufferSize()
+	case tcpWMem:
+		return sb.stack.SocketSendBufferSize()
+	default:
+		panic(fmt.Sprintf("unknown socketBufferInode type: %v", sb.dir))
+	}
+}
+
+// writeSize sets the buffer sizes of sb's stack.
+func (sb *socketBufferInode) writeSize(size inet.SocketBufferSize) error {
+	switch sb.dir {
+	case tcpRMem:
+		return sb.stack.SetSocketReceiveBufferSize(size)
+	case tcpWMem:
+		return sb.stack.SetSocketSendBufferSize(size)
+	default:
+		panic(fmt.Sprintf("unknown socketBufferInode type: %v", sb.dir))
+	}
+}
+
+// +stateify savable
+type socketBufferFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	sb *socketBufferInode
+}
+
+var _ fs.FileOperations = (*socketBufferFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *socketBufferFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	f.sb.mu.Lock()
+	defer f.sb.mu.Unlock()
+
+	size, err := f.sb.readSize()
+	if err != nil {
+		return 0, err
+	}
+	v := size.Default
+	if f.sb.max {
+		v = size.Max
+	}
+	n, err := dst.CopyOut(ctx, []byte(fmt.Sprintf("%d\n", v)))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *socketBufferFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	f.sb.mu.Lock()
+	defer f.sb.mu.Unlock()
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, syserror.EINVAL
+	}
+	size, err := f.sb.readSize()
+	if err != nil {
+		return 0, err
+	}
+	if f.sb.max {
+		size.Max = int(v)
+	} else {
+		size.Default = int(v)
+	}
+	if err := f.sb.writeSize(size); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// soMaxConnInode is used to read/write the maximum backlog of listening
+// sockets of netstack.
+//
+// +stateify savable
+type soMaxConnInode struct {
+	fsutil.SimpleFileInode
+
 	stack inet.Stack `state:"wait"`
 
-	// enabled stores the IPv4 forwarding state on save.
-	// We must save/restore this here, since a netstack instance
-	// is created on restore.
-	enabled *bool
+	// maxConn stores the maximum backlog during save, and sets it in netstack
+	// on restore. We must save/restore this here, since a netstack instance
+	// is created on restore.
+	maxConn int
+}
+
+var _ fs.InodeOperations = (*soMaxConnInode)(nil)
+
+func newSoMaxConnInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	mc := &soMaxConnInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, mc, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*soMaxConnInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (mc *soMaxConnInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &soMaxConnFile{mc: mc}), nil
+}
+
+// +stateify savable
+type soMaxConnFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	mc *soMaxConnInode
 }
 
-func newIPForwardingInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
-	ipf := &ipForwarding{
-		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), linux.PROC_SUPER_MAGIC),
+var _ fs.FileOperations = (*soMaxConnFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *soMaxConnFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, []byte(fmt.Sprintf("%d\n", f.mc.stack.SoMaxConn())))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *soMaxConnFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.mc.stack.SetSoMaxConn(int(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipv6ConfSetting is a setting in /proc/sys/net/ipv6/conf/<interface>.
+//
+// +stateify savable
+type ipv6ConfSetting int
+
+const (
+	ipv6AcceptRA ipv6ConfSetting = iota
+	ipv6Autoconf
+	ipv6DADTransmits
+	ipv6UseTempAddr
+	ipv6MTU
+)
+
+// ipv6ConfInode is used to read/write the neighbor discovery settings and the
+// MTU of an interface.
+//
+// +stateify savable
+type ipv6ConfInode struct {
+	fsutil.SimpleFileInode
+
+	stack   inet.Stack `state:"wait"`
+	idx     int32
+	setting ipv6ConfSetting
+
+	// mu protects against concurrent reads/writes to files based on this
+	// inode.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ fs.InodeOperations = (*ipv6ConfInode)(nil)
+
+func newIPv6ConfInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, idx int32, setting ipv6ConfSetting) *fs.Inode {
+	c := &ipv6ConfInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
 		stack:           s,
+		idx:             idx,
+		setting:         setting,
 	}
 	sattr := fs.StableAttr{
 		DeviceID:  device.ProcDevice.DeviceID(),
@@ -414,88 +1346,230 @@ func newIPForwardingInode(ctx context.Context, msrc *fs.MountSource, s inet.Stac
 		BlockSize: usermem.PageSize,
 		Type:      fs.SpecialFile,
 	}
-	return fs.NewInode(ctx, ipf, msrc, sattr)
+	return fs.NewInode(ctx, c, msrc, sattr)
 }
 
-// Truncate implements fs.InodeOperations.Truncate. Truncate is called when
-// O_TRUNC is specified for any kind of existing Dirent but is not called via
-// (f)truncate for proc files.
-func (*ipForwarding) Truncate(context.Context, *fs.Inode, int64) error {
+// Truncate implements fs.InodeOperations.Truncate.
+func (*ipv6ConfInode) Truncate(context.Context, *fs.Inode, int64) error {
 	return nil
 }
 
+// GetFile implements fs.InodeOperations.GetFile.
+func (c *ipv6ConfInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &ipv6ConfFile{c: c}), nil
+}
+
 // +stateify savable
-type ipForwardingFile struct {
+type ipv6ConfFile struct {
 	fsutil.FileGenericSeek          `state:"nosave"`
 	fsutil.FileNoIoctl              `state:"nosave"`
 	fsutil.FileNoMMap               `state:"nosave"`
 	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
 	fsutil.FileNoopFlush            `state:"nosave"`
 	fsutil.FileNoopFsync            `state:"nosave"`
-	fsutil.FileNoopRelease          `state:"nosave"`
 	fsutil.FileNotDirReaddir        `state:"nosave"`
 	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
 	waiter.AlwaysReady              `state:"nosave"`
 
-	ipf *ipForwarding
+	c *ipv6ConfInode
+}
+
+var _ fs.FileOperations = (*ipv6ConfFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *ipv6ConfFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+
+	conf, err := f.c.stack.IPv6Conf(f.c.idx)
+	if err != nil {
+		return 0, err
+	}
+	var v int
+	switch f.c.setting {
+	case ipv6AcceptRA:
+		v = boolToInt(conf.AcceptRA)
+	case ipv6Autoconf:
+		v = boolToInt(conf.Autoconf)
+	case ipv6DADTransmits:
+		v = conf.DADTransmits
+	case ipv6UseTempAddr:
+		v = boolToInt(conf.UseTempAddr)
+	case ipv6MTU:
+		v = int(conf.MTU)
+	default:
+		panic(fmt.Sprintf("unknown ipv6ConfSetting: %v", f.c.setting))
+	}
+	n, err := dst.CopyOut(ctx, []byte(fmt.Sprintf("%d\n", v)))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *ipv6ConfFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	conf, err := f.c.stack.IPv6Conf(f.c.idx)
+	if err != nil {
+		return 0, err
+	}
+	// Like other boolean settings, values other than 0 and 1 read back as 1.
+	switch f.c.setting {
+	case ipv6AcceptRA:
+		conf.AcceptRA = v > 0
+	case ipv6Autoconf:
+		conf.Autoconf = v > 0
+	case ipv6DADTransmits:
+		if v < 0 {
+			return 0, syserror.EINVAL
+		}
+		conf.DADTransmits = int(v)
+	case ipv6UseTempAddr:
+		conf.UseTempAddr = v > 0
+	case ipv6MTU:
+		// As on Linux, the MTU can neither be below the minimum MTU of
+		// IPv6 nor above the MTU of the interface.
+		iface, ok := f.c.stack.Interfaces()[f.c.idx]
+		if !ok {
+			return 0, syserror.ENODEV
+		}
+		if v < header.IPv6MinimumMTU || uint32(v) > iface.MTU {
+			return 0, syserror.EINVAL
+		}
+		conf.MTU = uint32(v)
+	default:
+		panic(fmt.Sprintf("unknown ipv6ConfSetting: %v", f.c.setting))
+	}
+	if err := f.c.stack.SetIPv6Conf(f.c.idx, conf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ipv6HopLimitInode is used to read/write the default hop limit of IPv6
+// packets.
+//
+// +stateify savable
+type ipv6HopLimitInode struct {
+	fsutil.SimpleFileInode
 
 	stack inet.Stack `state:"wait"`
+
+	// readOnly is true for the files of individual interfaces, as netstack
+	// doesn't support per interface hop limits.
+	readOnly bool
+
+	// hopLimit stores the hop limit during save, and sets it in netstack on
+	// restore. We must save/restore this here, since a netstack instance is
+	// created on restore.
+	hopLimit int
+}
+
+var _ fs.InodeOperations = (*ipv6HopLimitInode)(nil)
+
+func newIPv6HopLimitInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, readOnly bool) *fs.Inode {
+	mode := linux.FileMode(0644)
+	if readOnly {
+		mode = 0444
+	}
+	hl := &ipv6HopLimitInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(mode), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+		readOnly:        readOnly,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, hl, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*ipv6HopLimitInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
 }
 
 // GetFile implements fs.InodeOperations.GetFile.
-func (ipf *ipForwarding) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+func (hl *ipv6HopLimitInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
 	flags.Pread = true
 	flags.Pwrite = true
-	return fs.NewFile(ctx, dirent, flags, &ipForwardingFile{
-		stack: ipf.stack,
-		ipf:   ipf,
-	}), nil
+	return fs.NewFile(ctx, dirent, flags, &ipv6HopLimitFile{hl: hl}), nil
 }
 
+// +stateify savable
+type ipv6HopLimitFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	hl *ipv6HopLimitInode
+}
+
+var _ fs.FileOperations = (*ipv6HopLimitFile)(nil)
+
 // Read implements fs.FileOperations.Read.
-func (f *ipForwardingFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+func (f *ipv6HopLimitFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
 	if offset != 0 {
 		return 0, io.EOF
 	}
-
-	if f.ipf.enabled == nil {
-		enabled := f.stack.Forwarding(ipv4.ProtocolNumber)
-		f.ipf.enabled = &enabled
-	}
-
-	val := "0\n"
-	if *f.ipf.enabled {
-		// Technically, this is not quite compatible with Linux. Linux
-		// stores these as an integer, so if you write "2" into
-		// ip_forward, you should get 2 back.
-		val = "1\n"
+	hopLimit, err := f.hl.stack.IPv6HopLimit()
+	if err != nil {
+		return 0, err
 	}
-	n, err := dst.CopyOut(ctx, []byte(val))
+	n, err := dst.CopyOut(ctx, []byte(fmt.Sprintf("%d\n", hopLimit)))
 	return int64(n), err
 }
 
 // Write implements fs.FileOperations.Write.
-//
-// Offset is ignored, multiple writes are not supported.
-func (f *ipForwardingFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+func (f *ipv6HopLimitFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if f.hl.readOnly {
+		return 0, syserror.EPERM
+	}
 	if src.NumBytes() == 0 {
 		return 0, nil
 	}
 
-	// Only consider size of one memory page for input for performance reasons.
-	// We are only reading if it's zero or not anyway.
 	src = src.TakeFirst(usermem.PageSize - 1)
-
 	var v int32
 	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
 	if err != nil {
-		return n, err
+		return 0, err
 	}
-	if f.ipf.enabled == nil {
-		f.ipf.enabled = new(bool)
+	if err := f.hl.stack.SetIPv6HopLimit(int(v)); err != nil {
+		return 0, err
 	}
-	*f.ipf.enabled = v != 0
-	return n, f.stack.SetForwarding(ipv4.ProtocolNumber, *f.ipf.enabled)
+	return n, nil
 }
 
 func (p *proc) newSysNetIPv4Dir(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
@@ -504,24 +1578,31 @@ func (p *proc) newSysNetIPv4Dir(ctx context.Context, msrc *fs.MountSource, s ine
 		"tcp_sack": newTCPSackInode(ctx, msrc, s),
 
 		// Add ip_forward.
-		"ip_forward": newIPForwardingInode(ctx, msrc, s),
+		"ip_forward": newIPForwardingInode(ctx, msrc, s, ipv4.ProtocolNumber, false /* readOnly */),
+
+		// Add ip_local_port_range.
+		"ip_local_port_range": newPortRangeInode(ctx, msrc, s),
+
+		// Add ip_local_reserved_ports.
+		"ip_local_reserved_ports": newReservedPortsInode(ctx, msrc, s),
+
+		// Add ping_group_range.
+		"ping_group_range": newPingGroupRangeInode(ctx, msrc, s),
 
 		// The following files are simple stubs until they are
 		// implemented in netstack, most of these files are
 		// configuration related. We use the value closest to the
 		// actual netstack behavior or any empty file, all of these
 		// files will have mode 0444 (read-only for all users).
-		"ip_local_port_range":     newStaticProcInode(ctx, msrc, []byte("16000   65535")),
-		"ip_local_reserved_ports": newStaticProcInode(ctx, msrc, []byte("")),
-		"ipfrag_time":             newStaticProcInode(ctx, msrc, []byte("30")),
-		"ip_nonlocal_bind":        newStaticProcInode(ctx, msrc, []byte("0")),
-		"ip_no_pmtu_disc":         newStaticProcInode(ctx, msrc, []byte("1")),
+		"ipfrag_time":      newStaticProcInode(ctx, msrc, []byte("30")),
+		"ip_nonlocal_bind": newStaticProcInode(ctx, msrc, []byte("0")),
+		"ip_no_pmtu_disc":  newStaticProcInode(ctx, msrc, []byte("1")),
 
 		// tcp_allowed_congestion_control tell the user what they are
 		// able to do as an unprivledged process so we leave it empty.
 		"tcp_allowed_congestion_control":   newStaticProcInode(ctx, msrc, []byte("")),
-		"tcp_available_congestion_control": newStaticProcInode(ctx, msrc, []byte("reno")),
-		"tcp_congestion_control":           newStaticProcInode(ctx, msrc, []byte("reno")),
+		"tcp_available_congestion_control": newTCPCongestionControlInode(ctx, msrc, s, true /* available */),
+		"tcp_congestion_control":           newTCPCongestionControlInode(ctx, msrc, s, false /* available */),
 
 		// Many of the following stub files are features netstack
 		// doesn't support. The unsupported features return "0" to
@@ -559,6 +1640,16 @@ func (p *proc) newSysNetIPv4Dir(ctx context.Context, msrc *fs.MountSource, s ine
 		contents["tcp_wmem"] = newTCPMemInode(ctx, msrc, s, tcpWMem)
 	}
 
+	// Add tcp_mem.
+	if _, err := s.TransportMemoryLimits(header.TCPProtocolNumber); err == nil {
+		contents["tcp_mem"] = newTransportMemInode(ctx, msrc, s, header.TCPProtocolNumber)
+	}
+
+	// Add udp_mem.
+	if _, err := s.TransportMemoryLimits(header.UDPProtocolNumber); err == nil {
+		contents["udp_mem"] = newTransportMemInode(ctx, msrc, s, header.UDPProtocolNumber)
+	}
+
 	// Add tcp_recovery.
 	if _, err := s.TCPRecovery(); err == nil {
 		contents["tcp_recovery"] = newTCPRecoveryInode(ctx, msrc, s)
@@ -568,18 +1659,182 @@ func (p *proc) newSysNetIPv4Dir(ctx context.Context, msrc *fs.MountSource, s ine
 	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
 }
 
-func (p *proc) newSysNetDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
-	var contents map[string]*fs.Inode
-	// TODO(gvisor.dev/issue/1833): Support for using the network stack in the
-	// network namespace of the calling process.
-	if s := p.k.RootNetworkNamespace().Stack(); s != nil {
-		contents = map[string]*fs.Inode{
-			"ipv4": p.newSysNetIPv4Dir(ctx, msrc, s),
-			"core": p.newSysNetCore(ctx, msrc, s),
+func (p *proc) newSysNetIPv6Dir(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	contents := map[string]*fs.Inode{
+		"conf": p.newSysNetIPv6ConfDir(ctx, msrc, s),
+	}
+	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+}
+
+// newSysNetIPv6ConfDir returns the /proc/sys/net/ipv6/conf directory.
+// Netstack doesn't support per interface forwarding or hop limits, so these
+// files of each interface are read-only views of the global settings.
+func (p *proc) newSysNetIPv6ConfDir(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	newConfDir := func(contents map[string]*fs.Inode) *fs.Inode {
+		d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
+		return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+	}
+
+	contents := map[string]*fs.Inode{
+		"all": newConfDir(map[string]*fs.Inode{
+			"forwarding": newIPForwardingInode(ctx, msrc, s, ipv6.ProtocolNumber, false /* readOnly */),
+			"hop_limit":  newIPv6HopLimitInode(ctx, msrc, s, false /* readOnly */),
+		}),
+		"default": newConfDir(map[string]*fs.Inode{
+			"forwarding": newIPForwardingInode(ctx, msrc, s, ipv6.ProtocolNumber, false /* readOnly */),
+			"hop_limit":  newIPv6HopLimitInode(ctx, msrc, s, false /* readOnly */),
+		}),
+	}
+	for idx, iface := range s.Interfaces() {
+		if _, ok := contents[iface.Name]; ok || iface.Name == "" {
+			continue
 		}
+		contents[iface.Name] = newConfDir(map[string]*fs.Inode{
+			"accept_ra":     newIPv6ConfInode(ctx, msrc, s, idx, ipv6AcceptRA),
+			"autoconf":      newIPv6ConfInode(ctx, msrc, s, idx, ipv6Autoconf),
+			"dad_transmits": newIPv6ConfInode(ctx, msrc, s, idx, ipv6DADTransmits),
+			"forwarding":    newIPForwardingInode(ctx, msrc, s, ipv6.ProtocolNumber, true /* readOnly */),
+			"hop_limit":     newIPv6HopLimitInode(ctx, msrc, s, true /* readOnly */),
+			"mtu":           newIPv6ConfInode(ctx, msrc, s, idx, ipv6MTU),
+			"use_tempaddr":  newIPv6ConfInode(ctx, msrc, s, idx, ipv6UseTempAddr),
+		})
 	}
 	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
 }
 
+// sysNetDir is the /proc/sys/net directory. As in Linux, its contents show the
+// settings of the network namespace of the task accessing it. The entries of
+// the root network namespace are kept, as they save and restore its settings.
+//
+// +stateify savable
+type sysNetDir struct {
+	ramfs.Dir
+
+	p *proc
+}
+
+func (p *proc) newSysNetDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	contents := make(map[string]*fs.Inode)
+	s := p.k.RootNetworkNamespace().Stack()
+	for _, name := range sysNetNames(s) {
+		contents[name] = p.newSysNetEntry(ctx, msrc, s, name)
+	}
+	d := &sysNetDir{
+		Dir: *ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555)),
+		p:   p,
+	}
+	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+}
+
+// sysNetNames returns the names of the entries of /proc/sys/net for s.
+func sysNetNames(s inet.Stack) []string {
+	if s == nil {
+		return nil
+	}
+	names := []string{"core", "ipv4"}
+	if s.SupportsIPv6() {
+		names = append(names, "ipv6")
+	}
+	return names
+}
+
+// newSysNetEntry returns the entry name of /proc/sys/net for s, or nil if
+// there is none.
+func (p *proc) newSysNetEntry(ctx context.Context, msrc *fs.MountSource, s inet.Stack, name string) *fs.Inode {
+	switch name {
+	case "core":
+		return p.newSysNetCore(ctx, msrc, s)
+	case "ipv4":
+		return p.newSysNetIPv4Dir(ctx, msrc, s)
+	case "ipv6":
+		if !s.SupportsIPv6() {
+			return nil
+		}
+		return p.newSysNetIPv6Dir(ctx, msrc, s)
+	default:
+		return nil
+	}
+}
+
+// stack returns the network stack of the task in ctx, or that of the root
+// network namespace if ctx has no task.
+func (d *sysNetDir) stack(ctx context.Context) inet.Stack {
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		return t.NetworkContext()
+	}
+	return d.p.k.RootNetworkNamespace().Stack()
+}
+
+// Lookup implements fs.InodeOperations.Lookup.
+func (d *sysNetDir) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Dirent, error) {
+	s := d.stack(ctx)
+	if s == nil {
+		return nil, syserror.ENOENT
+	}
+	if s == d.p.k.RootNetworkNamespace().Stack() {
+		return d.Dir.Lookup(ctx, dir, name)
+	}
+
+	inode := d.p.newSysNetEntry(ctx, dir.MountSource, s, name)
+	if inode == nil {
+		return nil, syserror.ENOENT
+	}
+	return fs.NewDirent(ctx, inode, name), nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (d *sysNetDir) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, dirent, flags, &sysNetDirFile{iops: d}), nil
+}
+
+// sysNetDirFile implements fs.FileOperations for /proc/sys/net.
+//
+// +stateify savable
+type sysNetDirFile struct {
+	fsutil.DirFileOperations        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+
+	iops *sysNetDir
+}
+
+var _ fs.FileOperations = (*sysNetDirFile)(nil)
+
+// Readdir implements fs.FileOperations.Readdir.
+func (f *sysNetDirFile) Readdir(ctx context.Context, file *fs.File, ser fs.DentrySerializer) (int64, error) {
+	offset := file.Offset()
+	dirCtx := &fs.DirCtx{
+		Serializer: ser,
+	}
+
+	root := fs.RootFromContext(ctx)
+	if root != nil {
+		defer root.DecRef(ctx)
+	}
+	dot, dotdot := file.Dirent.GetDotAttrs(root)
+	m := map[string]fs.DentAttr{
+		".":  dot,
+		"..": dotdot,
+	}
+	names := append(sysNetNames(f.iops.stack(ctx)), ".", "..")
+	for _, name := range names {
+		if _, ok := m[name]; !ok {
+			m[name] = fs.GenericDentAttr(fs.SpecialDirectory, device.ProcDevice)
+		}
+	}
+
+	if offset >= int64(len(names)) {
+		return offset, nil
+	}
+	sort.Strings(names)
+	for _, name := range names[offset:] {
+		if err := dirCtx.DirEmit(name, m[name]); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
 // LINT.ThenChange(../../fsimpl/proc/tasks_sys.go)
@@ -16,8 +16,6 @@ package proc
 
 import (
 	"fmt"
-
-	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 )
 
 // beforeSave is invoked by stateify.
@@ -45,11 +43,145 @@ func (s *tcpSack) afterLoad() {
 	}
 }
 
+// beforeSave is invoked by stateify.
+func (cc *tcpCongestionControlInode) beforeSave() {
+	if cc.available {
+		return
+	}
+	v, err := cc.stack.TCPCongestionControl()
+	if err != nil {
+		panic(fmt.Sprintf("failed to read TCP congestion control algorithm: %v", err))
+	}
+	cc.cc = v
+}
+
 // afterLoad is invoked by stateify.
-func (ipf *ipForwarding) afterLoad() {
+func (cc *tcpCongestionControlInode) afterLoad() {
+	if cc.available {
+		return
+	}
+	if err := cc.stack.SetTCPCongestionControl(cc.cc); err != nil {
+		panic(fmt.Sprintf("failed to set previous TCP congestion control algorithm %q: %v", cc.cc, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (sb *socketBufferInode) beforeSave() {
+	size, err := sb.readSize()
+	if err != nil {
+		panic(fmt.Sprintf("failed to read socket send / receive buffer sizes: %v", err))
+	}
+	sb.size = size
+}
+
+// afterLoad is invoked by stateify.
+func (sb *socketBufferInode) afterLoad() {
+	if err := sb.writeSize(sb.size); err != nil {
+		panic(fmt.Sprintf("failed to write previous socket send / receive buffer sizes [%v]: %v", sb.size, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (mc *soMaxConnInode) beforeSave() {
+	mc.maxConn = mc.stack.SoMaxConn()
+}
+
+// afterLoad is invoked by stateify.
+func (mc *soMaxConnInode) afterLoad() {
+	if err := mc.stack.SetSoMaxConn(mc.maxConn); err != nil {
+		panic(fmt.Sprintf("failed to set previous somaxconn %d: %v", mc.maxConn, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (ipf *ipForwarding) beforeSave() {
+	// Several files may share the same setting, such as the IPv6 forwarding
+	// files, so the saved state must not be older than the last write.
 	if ipf.enabled != nil {
-		if err := ipf.stack.SetForwarding(ipv4.ProtocolNumber, *ipf.enabled); err != nil {
-			panic(fmt.Sprintf("failed to set IPv4 forwarding [%v]: %v", *ipf.enabled, err))
+		enabled := ipf.stack.Forwarding(ipf.protocol)
+		ipf.enabled = &enabled
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (ipf *ipForwarding) afterLoad() {
+	if ipf.enabled != nil && !ipf.readOnly {
+		if err := ipf.stack.SetForwarding(ipf.protocol, *ipf.enabled); err != nil {
+			panic(fmt.Sprintf("failed to set forwarding of network protocol %d [%v]: %v", ipf.protocol, *ipf.enabled, err))
 		}
 	}
 }
+
+// beforeSave is invoked by stateify.
+func (hl *ipv6HopLimitInode) beforeSave() {
+	if hl.readOnly {
+		return
+	}
+	hopLimit, err := hl.stack.IPv6HopLimit()
+	if err != nil {
+		panic(fmt.Sprintf("failed to read IPv6 hop limit: %v", err))
+	}
+	hl.hopLimit = hopLimit
+}
+
+// afterLoad is invoked by stateify.
+func (hl *ipv6HopLimitInode) afterLoad() {
+	if hl.readOnly {
+		return
+	}
+	if err := hl.stack.SetIPv6HopLimit(hl.hopLimit); err != nil {
+		panic(fmt.Sprintf("failed to set previous IPv6 hop limit %d: %v", hl.hopLimit, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (pr *portRangeInode) beforeSave() {
+	pr.start, pr.end = pr.stack.PortRange()
+}
+
+// afterLoad is invoked by stateify.
+func (pr *portRangeInode) afterLoad() {
+	if err := pr.stack.SetPortRange(pr.start, pr.end); err != nil {
+		panic(fmt.Sprintf("failed to set previous local port range [%d, %d]: %v", pr.start, pr.end, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (pg *pingGroupRangeInode) beforeSave() {
+	pg.low, pg.high = pg.stack.PingGroupRange()
+}
+
+// afterLoad is invoked by stateify.
+func (pg *pingGroupRangeInode) afterLoad() {
+	if err := pg.stack.SetPingGroupRange(pg.low, pg.high); err != nil {
+		panic(fmt.Sprintf("failed to set previous ping group range [%d, %d]: %v", pg.low, pg.high, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (rp *reservedPortsInode) beforeSave() {
+	rp.ports = rp.stack.LocalReservedPorts()
+}
+
+// afterLoad is invoked by stateify.
+func (rp *reservedPortsInode) afterLoad() {
+	if err := rp.stack.SetLocalReservedPorts(rp.ports); err != nil {
+		panic(fmt.Sprintf("failed to set previous local reserved ports %v: %v", rp.ports, err))
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (tm *transportMemInode) beforeSave() {
+	limits, err := tm.stack.TransportMemoryLimits(tm.protocol)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get memory limits of transport protocol %d: %v", tm.protocol, err))
+	}
+	tm.limits = limits
+}
+
+// afterLoad is invoked by stateify.
+func (tm *transportMemInode) afterLoad() {
+	if err := tm.stack.SetTransportMemoryLimits(tm.protocol, tm.limits); err != nil {
+		panic(fmt.Sprintf("failed to set previous memory limits %+v of transport protocol %d: %v", tm.limits, tm.protocol, err))
+	}
+}
@@ -15,10 +15,15 @@
 package proc
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -196,3 +201,400 @@ func TestIPForwarding(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryPortRange(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.PortRangeStart, s.PortRangeEnd = 16000, 65535
+	f := &portRangeFile{pr: &portRangeInode{stack: s}}
+
+	buf := make([]byte, 100)
+	n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got, want := string(buf[:n]), "16000\t65535\n"; got != want {
+		t.Errorf("Bad string: got %q, want %q", got, want)
+	}
+}
+
+// TestConfigurePortRange tests the implementation of
+// /proc/sys/net/ipv4/ip_local_port_range.
+func TestConfigurePortRange(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		str       string
+		wantErr   error
+		wantStart uint16
+		wantEnd   uint16
+	}{
+		{str: "1024 2048", wantStart: 1024, wantEnd: 2048},
+		{str: "32768\t60999\n", wantStart: 32768, wantEnd: 60999},
+		{str: "5000 5000", wantStart: 5000, wantEnd: 5000},
+		{str: "0 2048", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+		{str: "2048 1024", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+		{str: "1024 65536", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+	} {
+		t.Run(c.str, func(t *testing.T) {
+			s := inet.NewTestStack()
+			s.PortRangeStart, s.PortRangeEnd = 16000, 65535
+			f := &portRangeFile{pr: &portRangeInode{stack: s}}
+
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+				t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+			}
+			if s.PortRangeStart != c.wantStart || s.PortRangeEnd != c.wantEnd {
+				t.Errorf("got port range [%d, %d], want [%d, %d]", s.PortRangeStart, s.PortRangeEnd, c.wantStart, c.wantEnd)
+			}
+		})
+	}
+}
+
+// TestPingGroupRange tests the implementation of
+// /proc/sys/net/ipv4/ping_group_range.
+func TestPingGroupRange(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		str      string
+		wantErr  error
+		wantLow  auth.KGID
+		wantHigh auth.KGID
+		wantRead string
+	}{
+		{str: "100 200", wantLow: 100, wantHigh: 200, wantRead: "100\t200\n"},
+		{str: "0\t2147483647\n", wantLow: 0, wantHigh: 2147483647, wantRead: "0\t2147483647\n"},
+		// An empty range disables ICMP echo sockets.
+		{str: "200 100", wantLow: 1, wantHigh: 0, wantRead: "1\t0\n"},
+		{str: "-1 100", wantErr: syserror.EINVAL, wantLow: 1, wantHigh: 0, wantRead: "1\t0\n"},
+	} {
+		t.Run(c.str, func(t *testing.T) {
+			s := inet.NewTestStack()
+			s.PingGroupLow, s.PingGroupHigh = 1, 0
+			f := &pingGroupRangeFile{pg: &pingGroupRangeInode{stack: s}}
+
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+				t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+			}
+			if s.PingGroupLow != c.wantLow || s.PingGroupHigh != c.wantHigh {
+				t.Errorf("got ping group range [%d, %d], want [%d, %d]", s.PingGroupLow, s.PingGroupHigh, c.wantLow, c.wantHigh)
+			}
+
+			buf := make([]byte, 100)
+			n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if got := string(buf[:n]); got != c.wantRead {
+				t.Errorf("Bad string: got %q, want %q", got, c.wantRead)
+			}
+		})
+	}
+}
+
+// TestLocalReservedPorts tests the implementation of
+// /proc/sys/net/ipv4/ip_local_reserved_ports.
+func TestLocalReservedPorts(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	f := &reservedPortsFile{rp: &reservedPortsInode{stack: s}}
+
+	const str = "8080,9000-9002\n"
+	src := usermem.BytesIOSequence([]byte(str))
+	if n, err := f.Write(ctx, nil, src, 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("f.Write(ctx, nil, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	if got, want := s.ReservedPorts, []uint16{8080, 9000, 9001, 9002}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got s.ReservedPorts = %v, want %v", got, want)
+	}
+
+	buf := make([]byte, 100)
+	n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := string(buf[:n]); got != str {
+		t.Errorf("Bad string: got %q, want %q", got, str)
+	}
+
+	if _, err := f.Write(ctx, nil, usermem.BytesIOSequence([]byte("9002-9000")), 0); err != syserror.EINVAL {
+		t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", "9002-9000", err, syserror.EINVAL)
+	}
+}
+
+// TestIPv6Forwarding tests the implementation of
+// /proc/sys/net/ipv6/conf/*/forwarding.
+func TestIPv6Forwarding(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+
+	all := &ipForwardingFile{stack: s, ipf: &ipForwarding{stack: s, protocol: ipv6.ProtocolNumber}}
+	src := usermem.BytesIOSequence([]byte("1"))
+	if n, err := all.Write(ctx, nil, src, 0); n != 1 || err != nil {
+		t.Fatalf("all.Write(ctx, nil, %q, 0) = (%d, %v), want (1, nil)", "1", n, err)
+	}
+	if !s.IPForwarding {
+		t.Errorf("got s.IPForwarding = false, want true")
+	}
+
+	// The files of interfaces show the global setting, and can't change it.
+	iface := &ipForwardingFile{stack: s, ipf: &ipForwarding{stack: s, protocol: ipv6.ProtocolNumber, readOnly: true}}
+	buf := make([]byte, 100)
+	n, err := iface.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got, want := string(buf[:n]), "1\n"; got != want {
+		t.Errorf("Bad string: got %q, want %q", got, want)
+	}
+	src = usermem.BytesIOSequence([]byte("0"))
+	if _, err := iface.Write(ctx, nil, src, 0); err != syserror.EPERM {
+		t.Errorf("iface.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", "0", err, syserror.EPERM)
+	}
+	if !s.IPForwarding {
+		t.Errorf("got s.IPForwarding = false, want true")
+	}
+}
+
+// TestTCPCongestionControl tests the implementation of
+// /proc/sys/net/ipv4/tcp_congestion_control and
+// /proc/sys/net/ipv4/tcp_available_congestion_control.
+func TestTCPCongestionControl(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.CongestionControl = "reno"
+	s.AvailableCC = []string{"reno", "cubic"}
+
+	available := &tcpCongestionControlFile{cc: &tcpCongestionControlInode{stack: s, available: true}}
+	buf := make([]byte, 100)
+	n, err := available.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got, want := string(buf[:n]), "reno cubic\n"; got != want {
+		t.Errorf("Bad string: got %q, want %q", got, want)
+	}
+	if _, err := available.Write(ctx, nil, usermem.BytesIOSequence([]byte("cubic")), 0); err != syserror.EPERM {
+		t.Errorf("available.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", "cubic", err, syserror.EPERM)
+	}
+
+	f := &tcpCongestionControlFile{cc: &tcpCongestionControlInode{stack: s}}
+	for _, c := range []struct {
+		str     string
+		wantErr error
+		want    string
+	}{
+		{str: "cubic\n", want: "cubic"},
+		{str: "reno", want: "reno"},
+		{str: "bbr", wantErr: syserror.ENOENT, want: "reno"},
+		{str: " \n", wantErr: syserror.EINVAL, want: "reno"},
+	} {
+		t.Run(c.str, func(t *testing.T) {
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+				t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+			}
+			n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if got, want := string(buf[:n]), c.want+"\n"; got != want {
+				t.Errorf("Bad string: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestSocketBufferSize tests the implementation of
+// /proc/sys/net/core/{r,w}mem_{default,max}.
+func TestSocketBufferSize(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name    string
+		dir     tcpMemDir
+		max     bool
+		str     string
+		wantErr error
+		want    inet.SocketBufferSize
+	}{
+		{name: "rmem_default", dir: tcpRMem, str: "4096\n", want: inet.SocketBufferSize{Default: 4096, Max: 2000}},
+		{name: "rmem_max", dir: tcpRMem, max: true, str: "8192", want: inet.SocketBufferSize{Default: 1000, Max: 8192}},
+		{name: "wmem_default", dir: tcpWMem, str: "4096", want: inet.SocketBufferSize{Default: 4096, Max: 2000}},
+		{name: "wmem_max", dir: tcpWMem, max: true, str: "8192", want: inet.SocketBufferSize{Default: 1000, Max: 8192}},
+		{name: "zero", dir: tcpRMem, str: "0", wantErr: syserror.EINVAL, want: inet.SocketBufferSize{Default: 1000, Max: 2000}},
+		{name: "negative", dir: tcpWMem, max: true, str: "-1", wantErr: syserror.EINVAL, want: inet.SocketBufferSize{Default: 1000, Max: 2000}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s := inet.NewTestStack()
+			s.RecvBufSize = inet.SocketBufferSize{Default: 1000, Max: 2000}
+			s.SendBufSize = inet.SocketBufferSize{Default: 1000, Max: 2000}
+			f := &socketBufferFile{sb: &socketBufferInode{stack: s, dir: c.dir, max: c.max}}
+
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+				t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+			}
+			got := s.RecvBufSize
+			if c.dir == tcpWMem {
+				got = s.SendBufSize
+			}
+			if got != c.want {
+				t.Errorf("got buffer sizes %+v, want %+v", got, c.want)
+			}
+
+			buf := make([]byte, 100)
+			n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			want := c.want.Default
+			if c.max {
+				want = c.want.Max
+			}
+			if got, want := string(buf[:n]), fmt.Sprintf("%d\n", want); got != want {
+				t.Errorf("Bad string: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestSoMaxConn tests the implementation of /proc/sys/net/core/somaxconn.
+func TestSoMaxConn(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.MaxConn = 128
+	f := &soMaxConnFile{mc: &soMaxConnInode{stack: s}}
+
+	const str = "4096\n"
+	src := usermem.BytesIOSequence([]byte(str))
+	if n, err := f.Write(ctx, nil, src, 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("f.Write(ctx, nil, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	if s.MaxConn != 4096 {
+		t.Errorf("got s.MaxConn = %d, want 4096", s.MaxConn)
+	}
+
+	buf := make([]byte, 100)
+	n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := string(buf[:n]); got != str {
+		t.Errorf("Bad string: got %q, want %q", got, str)
+	}
+}
+
+// TestIPv6Conf tests the implementation of the neighbor discovery settings in
+// /proc/sys/net/ipv6/conf/<interface>.
+func TestIPv6Conf(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.IPv6Confs[1] = inet.IPv6Conf{AcceptRA: true, DADTransmits: 1}
+
+	for _, c := range []struct {
+		setting ipv6ConfSetting
+		initial string
+		str     string
+		wantErr error
+		want    inet.IPv6Conf
+	}{
+		{setting: ipv6AcceptRA, initial: "1\n", str: "0", want: inet.IPv6Conf{DADTransmits: 1}},
+		{setting: ipv6Autoconf, initial: "0\n", str: "1", want: inet.IPv6Conf{Autoconf: true, DADTransmits: 1}},
+		{setting: ipv6DADTransmits, initial: "1\n", str: "3", want: inet.IPv6Conf{Autoconf: true, DADTransmits: 3}},
+		{setting: ipv6DADTransmits, initial: "3\n", str: "-1", wantErr: syserror.EINVAL, want: inet.IPv6Conf{Autoconf: true, DADTransmits: 3}},
+		{setting: ipv6UseTempAddr, initial: "0\n", str: "2", want: inet.IPv6Conf{Autoconf: true, DADTransmits: 3, UseTempAddr: true}},
+		{setting: ipv6UseTempAddr, initial: "1\n", str: "-1", want: inet.IPv6Conf{Autoconf: true, DADTransmits: 3}},
+	} {
+		f := &ipv6ConfFile{c: &ipv6ConfInode{stack: s, idx: 1, setting: c.setting}}
+		buf := make([]byte, 100)
+		n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+		if err != nil {
+			t.Fatalf("Read for setting %d failed: %v", c.setting, err)
+		}
+		if got := string(buf[:n]); got != c.initial {
+			t.Errorf("Bad string for setting %d: got %q, want %q", c.setting, got, c.initial)
+		}
+		src := usermem.BytesIOSequence([]byte(c.str))
+		if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+			t.Errorf("f.Write(ctx, nil, %q, 0) for setting %d = (_, %v), want (_, %v)", c.str, c.setting, err, c.wantErr)
+		}
+		if got := s.IPv6Confs[1]; got != c.want {
+			t.Errorf("got s.IPv6Confs[1] = %+v after setting %d, want %+v", got, c.setting, c.want)
+		}
+	}
+
+	missing := &ipv6ConfFile{c: &ipv6ConfInode{stack: s, idx: 2, setting: ipv6AcceptRA}}
+	if _, err := missing.Write(ctx, nil, usermem.BytesIOSequence([]byte("1")), 0); err != syserror.ENODEV {
+		t.Errorf("missing.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", "1", err, syserror.ENODEV)
+	}
+}
+
+// TestIPv6MTU tests the implementation of /proc/sys/net/ipv6/conf/<interface>/mtu.
+func TestIPv6MTU(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.InterfacesMap[1] = inet.Interface{Name: "eth0", MTU: 1500}
+	s.IPv6Confs[1] = inet.IPv6Conf{MTU: 1500}
+	f := &ipv6ConfFile{c: &ipv6ConfInode{stack: s, idx: 1, setting: ipv6MTU}}
+
+	for _, c := range []struct {
+		str     string
+		wantErr error
+		want    uint32
+	}{
+		{str: "1280", want: 1280},
+		{str: "1279", wantErr: syserror.EINVAL, want: 1280},
+		{str: "1501", wantErr: syserror.EINVAL, want: 1280},
+		{str: "1500", want: 1500},
+	} {
+		src := usermem.BytesIOSequence([]byte(c.str))
+		if _, err := f.Write(ctx, nil, src, 0); err != c.wantErr {
+			t.Errorf("f.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+		}
+		if got := s.IPv6Confs[1].MTU; got != c.want {
+			t.Errorf("got s.IPv6Confs[1].MTU = %d after writing %q, want %d", got, c.str, c.want)
+		}
+	}
+
+	buf := make([]byte, 100)
+	n, err := f.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got, want := string(buf[:n]), "1500\n"; got != want {
+		t.Errorf("Bad string: got %q, want %q", got, want)
+	}
+}
+
+// TestIPv6HopLimit tests the implementation of
+// /proc/sys/net/ipv6/conf/*/hop_limit.
+func TestIPv6HopLimit(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.HopLimit = 64
+	all := &ipv6HopLimitFile{hl: &ipv6HopLimitInode{stack: s}}
+	iface := &ipv6HopLimitFile{hl: &ipv6HopLimitInode{stack: s, readOnly: true}}
+
+	if n, err := all.Write(ctx, nil, usermem.BytesIOSequence([]byte("32")), 0); n != 2 || err != nil {
+		t.Fatalf("all.Write(ctx, nil, %q, 0) = (%d, %v), want (2, nil)", "32", n, err)
+	}
+	if s.HopLimit != 32 {
+		t.Errorf("got s.HopLimit = %d, want 32", s.HopLimit)
+	}
+
+	buf := make([]byte, 100)
+	n, err := iface.Read(ctx, nil, usermem.BytesIOSequence(buf), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got, want := string(buf[:n]), "32\n"; got != want {
+		t.Errorf("Bad string: got %q, want %q", got, want)
+	}
+	if _, err := iface.Write(ctx, nil, usermem.BytesIOSequence([]byte("16")), 0); err != syserror.EPERM {
+		t.Errorf("iface.Write(ctx, nil, %q, 0) = (_, %v), want (_, %v)", "16", err, syserror.EPERM)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsbridge"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
@@ -353,6 +354,9 @@ type namespaceSymlink struct {
 	ramfs.Symlink
 
 	t *kernel.Task
+
+	// ns is the name of the namespace type, e.g. "net".
+	ns string
 }
 
 func newNamespaceSymlink(ctx context.Context, t *kernel.Task, msrc *fs.MountSource, name string) *fs.Inode {
@@ -364,6 +368,7 @@ func newNamespaceSymlink(ctx context.Context, t *kernel.Task, msrc *fs.MountSour
 	n := &namespaceSymlink{
 		Symlink: *ramfs.NewSymlink(ctx, fs.RootOwner, target),
 		t:       t,
+		ns:      name,
 	}
 	return newProcInode(ctx, n, msrc, fs.Symlink, t)
 }
@@ -373,6 +378,11 @@ func (n *namespaceSymlink) Readlink(ctx context.Context, inode *fs.Inode) (strin
 	if err := checkTaskState(n.t); err != nil {
 		return "", err
 	}
+	if n.ns == "net" {
+		// Network namespaces are identified for real, so that tasks can be
+		// told apart by the namespace they are in.
+		return fmt.Sprintf("net:[%d]", n.t.NetworkNamespace().ID()), nil
+	}
 	return n.Symlink.Readlink(ctx, inode)
 }
 
@@ -385,11 +395,53 @@ func (n *namespaceSymlink) Getlink(ctx context.Context, inode *fs.Inode) (*fs.Di
 		return nil, err
 	}
 
+	if n.ns == "net" {
+		netns := n.t.NetworkNamespace()
+		iops := &netNamespaceInode{
+			NoReadWriteFileInode: fsutil.NoReadWriteFileInode{
+				InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, fs.FilePermsFromMode(0777), linux.PROC_SUPER_MAGIC),
+			},
+			netns: netns,
+		}
+		name := fmt.Sprintf("net:[%d]", netns.ID())
+		return fs.NewDirent(ctx, newProcInode(ctx, iops, inode.MountSource, fs.RegularFile, nil), name), nil
+	}
+
 	// Create a new regular file to fake the namespace file.
 	iops := fsutil.NewNoReadWriteFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0777), linux.PROC_SUPER_MAGIC)
 	return fs.NewDirent(ctx, newProcInode(ctx, iops, inode.MountSource, fs.RegularFile, nil), n.Symlink.Target), nil
 }
 
+// netNamespaceInode is the file a /proc/[pid]/ns/net symlink resolves to.
+//
+// +stateify savable
+type netNamespaceInode struct {
+	fsutil.NoReadWriteFileInode
+
+	// netns is the network namespace represented by the inode.
+	netns *inet.Namespace
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (i *netNamespaceInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, dirent, flags, &netNamespaceFile{netns: i.netns}), nil
+}
+
+// netNamespaceFile is an open /proc/[pid]/ns/net file, which can be passed to
+// setns(2).
+//
+// +stateify savable
+type netNamespaceFile struct {
+	fsutil.NoReadWriteFile
+
+	netns *inet.Namespace
+}
+
+// NetworkNamespace implements inet.NamespaceFile.NetworkNamespace.
+func (f *netNamespaceFile) NetworkNamespace() *inet.Namespace {
+	return f.netns
+}
+
 func newNamespaceDir(ctx context.Context, t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
 	contents := map[string]*fs.Inode{
 		"net":  newNamespaceSymlink(ctx, t, msrc, "net"),
@@ -25,6 +25,7 @@ import (
 	fslock "gvisor.dev/gvisor/pkg/sentry/fs/lock"
 	"gvisor.dev/gvisor/pkg/sentry/fsbridge"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
@@ -997,6 +998,9 @@ type namespaceSymlink struct {
 	kernfs.StaticSymlink
 
 	task *kernel.Task
+
+	// ns is the name of the namespace type, e.g. "net".
+	ns string
 }
 
 func (fs *filesystem) newNamespaceSymlink(ctx context.Context, task *kernel.Task, ino uint64, ns string) kernfs.Inode {
@@ -1005,7 +1009,7 @@ func (fs *filesystem) newNamespaceSymlink(ctx context.Context, task *kernel.Task
 	// the inode number by sticking the symlink inode in its place.
 	target := fmt.Sprintf("%s:[%d]", ns, ino)
 
-	inode := &namespaceSymlink{task: task}
+	inode := &namespaceSymlink{task: task, ns: ns}
 	// Note: credentials are overridden by taskOwnedInode.
 	inode.Init(ctx, task.Credentials(), linux.UNNAMED_MAJOR, fs.devMinor, ino, target)
 
@@ -1018,6 +1022,11 @@ func (s *namespaceSymlink) Readlink(ctx context.Context, mnt *vfs.Mount) (string
 	if err := checkTaskState(s.task); err != nil {
 		return "", err
 	}
+	if s.ns == "net" {
+		// Network namespaces are identified for real, so that tasks can be
+		// told apart by the namespace they are in.
+		return fmt.Sprintf("net:[%d]", s.task.NetworkNamespace().ID()), nil
+	}
 	return s.StaticSymlink.Readlink(ctx, mnt)
 }
 
@@ -1030,6 +1039,9 @@ func (s *namespaceSymlink) Getlink(ctx context.Context, mnt *vfs.Mount) (vfs.Vir
 	// Create a synthetic inode to represent the namespace.
 	fs := mnt.Filesystem().Impl().(*filesystem)
 	nsInode := &namespaceInode{}
+	if s.ns == "net" {
+		nsInode.netns = s.task.NetworkNamespace()
+	}
 	nsInode.Init(ctx, auth.CredentialsFromContext(ctx), linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), 0444)
 	dentry := &kernfs.Dentry{}
 	dentry.Init(&fs.Filesystem, nsInode)
@@ -1051,6 +1063,10 @@ type namespaceInode struct {
 	kernfs.InodeNotSymlink
 
 	locks vfs.FileLocks
+
+	// netns is the network namespace represented by the inode, if it
+	// represents one.
+	netns *inet.Namespace
 }
 
 var _ kernfs.Inode = (*namespaceInode)(nil)
@@ -1101,6 +1117,11 @@ func (fd *namespaceFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) err
 	return fd.inode.SetStat(ctx, vfs, creds, opts)
 }
 
+// NetworkNamespace implements inet.NamespaceFile.NetworkNamespace.
+func (fd *namespaceFD) NetworkNamespace() *inet.Namespace {
+	return fd.inode.netns
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *namespaceFD) Release(ctx context.Context) {
 	fd.inode.DecRef(ctx)
@@ -17,6 +17,9 @@ package proc
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -27,7 +30,10 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -39,6 +45,31 @@ const (
 	tcpWMem
 )
 
+// ipv4ConfSetting is a setting in /proc/sys/net/ipv4/conf/<interface>.
+//
+// +stateify savable
+type ipv4ConfSetting int
+
+const (
+	ipv4ARPIgnore ipv4ConfSetting = iota
+	ipv4ARPAnnounce
+	ipv4ARPFilter
+	ipv4LogMartians
+)
+
+// ipv6ConfSetting is a setting in /proc/sys/net/ipv6/conf/<interface>.
+//
+// +stateify savable
+type ipv6ConfSetting int
+
+const (
+	ipv6AcceptRA ipv6ConfSetting = iota
+	ipv6Autoconf
+	ipv6DADTransmits
+	ipv6UseTempAddr
+	ipv6MTU
+)
+
 // newSysDir returns the dentry corresponding to /proc/sys directory.
 func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
 	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
@@ -53,80 +84,254 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			"mmap_min_addr":     fs.newInode(ctx, root, 0444, &mmapMinAddrData{k: k}),
 			"overcommit_memory": fs.newInode(ctx, root, 0444, newStaticFile("0\n")),
 		}),
-		"net": fs.newSysNetDir(ctx, root, k),
+		"net": fs.newSysNetInode(ctx, root, k),
+	})
+}
+
+// sysNetInode represents the inode for the /proc/sys/net directory. As in
+// Linux, its contents show the settings of the network namespace of the task
+// accessing it.
+//
+// +stateify savable
+type sysNetInode struct {
+	implStatFS
+	kernfs.InodeAlwaysValid
+	kernfs.InodeAttrs
+	kernfs.InodeDirectoryNoNewChildren
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotSymlink
+	kernfs.OrderedChildren
+
+	locks vfs.FileLocks
+
+	fs   *filesystem
+	k    *kernel.Kernel
+	root *auth.Credentials
+}
+
+var _ kernfs.Inode = (*sysNetInode)(nil)
+
+func (fs *filesystem) newSysNetInode(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
+	inode := &sysNetInode{
+		fs:   fs,
+		k:    k,
+		root: root,
+	}
+	inode.InodeAttrs.Init(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), linux.ModeDirectory|0555)
+	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	return inode
+}
+
+// stack returns the network stack of the task in ctx, or that of the root
+// network namespace if ctx has no task.
+func (i *sysNetInode) stack(ctx context.Context) inet.Stack {
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		return t.NetworkContext()
+	}
+	return i.k.RootNetworkNamespace().Stack()
+}
+
+// Lookup implements kernfs.inodeDirectory.Lookup.
+func (i *sysNetInode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	stack := i.stack(ctx)
+	dir := i.fs.newStaticDir(ctx, i.root, i.fs.newSysNetContents(ctx, i.root, stack))
+	defer dir.DecRef(ctx)
+
+	child, err := dir.Lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &sysNetEntryInode{Inode: child, stack: stack, sysNet: i}, nil
+}
+
+// IterDirents implements kernfs.inodeDirectory.IterDirents.
+func (i *sysNetInode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	contents := i.fs.newSysNetContents(ctx, i.root, i.stack(ctx))
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dir := i.fs.newStaticDir(ctx, i.root, contents)
+	defer dir.DecRef(ctx)
+
+	for idx := relOffset; idx < int64(len(names)); idx++ {
+		dirent := vfs.Dirent{
+			Name:    names[idx],
+			Type:    linux.DT_DIR,
+			Ino:     i.fs.NextIno(),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *sysNetInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd, err := kernfs.NewGenericDirectoryFD(rp.Mount(), d, &i.OrderedChildren, &i.locks, &opts, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return fd.VFSFileDescription(), nil
+}
+
+// SetStat implements kernfs.Inode.SetStat not allowing inode attributes to be
+// changed.
+func (*sysNetInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return syserror.EPERM
+}
+
+// sysNetEntryInode is a directory of /proc/sys/net. It remains valid as long
+// as it is accessed from the network namespace it shows the settings of.
+//
+// +stateify savable
+type sysNetEntryInode struct {
+	kernfs.Inode
+
+	stack  inet.Stack `state:"wait"`
+	sysNet *sysNetInode
+}
+
+// Valid implements kernfs.Inode.Valid.
+func (i *sysNetEntryInode) Valid(ctx context.Context) bool {
+	return i.sysNet.stack(ctx) == i.stack && i.Inode.Valid(ctx)
+}
+
+// newSysNetContents returns the contents of the /proc/sys/net directory
+// showing the settings of stack.
+func (fs *filesystem) newSysNetContents(ctx context.Context, root *auth.Credentials, stack inet.Stack) map[string]kernfs.Inode {
+	if stack == nil {
+		return nil
+	}
+	contents := map[string]kernfs.Inode{
+		"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"conf":                    fs.newSysNetIPv4ConfDir(ctx, root, stack),
+			"tcp_recovery":            fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
+			"tcp_rmem":                fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
+			"tcp_sack":                fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
+			"tcp_abort_on_overflow":   fs.newInode(ctx, root, 0644, &tcpAbortOnOverflowData{stack: stack}),
+			"tcp_wmem":                fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
+			"tcp_mem":                 fs.newInode(ctx, root, 0644, &transportMemData{stack: stack, protocol: header.TCPProtocolNumber}),
+			"udp_mem":                 fs.newInode(ctx, root, 0644, &transportMemData{stack: stack, protocol: header.UDPProtocolNumber}),
+			"ip_forward":              fs.newInode(ctx, root, 0644, &ipForwarding{stack: stack}),
+			"ip_local_port_range":     fs.newInode(ctx, root, 0644, &portRangeData{stack: stack}),
+			"ip_local_reserved_ports": fs.newInode(ctx, root, 0644, &reservedPortsData{stack: stack}),
+			"ping_group_range":        fs.newInode(ctx, root, 0644, &pingGroupRangeData{stack: stack}),
+			"icmp_echo_enable_probe":  fs.newInode(ctx, root, 0644, &icmpEchoEnableProbeData{stack: stack}),
+
+			// The following files are simple stubs until they are implemented in
+			// netstack, most of these files are configuration related. We use the
+			// value closest to the actual netstack behavior or any empty file, all
+			// of these files will have mode 0444 (read-only for all users).
+			"ipfrag_time":      fs.newInode(ctx, root, 0444, newStaticFile("30")),
+			"ip_nonlocal_bind": fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"ip_no_pmtu_disc":  fs.newInode(ctx, root, 0444, newStaticFile("1")),
+
+			// tcp_allowed_congestion_control tell the user what they are able to
+			// do as an unprivledged process so we leave it empty.
+			"tcp_allowed_congestion_control":   fs.newInode(ctx, root, 0444, newStaticFile("")),
+			"tcp_available_congestion_control": fs.newInode(ctx, root, 0444, &tcpAvailableCongestionControlData{stack: stack}),
+			"tcp_congestion_control":           fs.newInode(ctx, root, 0644, &tcpCongestionControlData{stack: stack}),
+
+			// Many of the following stub files are features netstack doesn't
+			// support. The unsupported features return "0" to indicate they are
+			// disabled.
+			"tcp_base_mss":              fs.newInode(ctx, root, 0444, newStaticFile("1280")),
+			"tcp_dsack":                 fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_early_retrans":         fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_fack":                  fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_fastopen":              fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_fastopen_key":          fs.newInode(ctx, root, 0444, newStaticFile("")),
+			"tcp_invalid_ratelimit":     fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_keepalive_intvl":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_keepalive_probes":      fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_keepalive_time":        fs.newInode(ctx, root, 0444, newStaticFile("7200")),
+			"tcp_mtu_probing":           fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_no_metrics_save":       fs.newInode(ctx, root, 0444, newStaticFile("1")),
+			"tcp_probe_interval":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_probe_threshold":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"tcp_retries1":              fs.newInode(ctx, root, 0444, newStaticFile("3")),
+			"tcp_retries2":              fs.newInode(ctx, root, 0444, newStaticFile("15")),
+			"tcp_rfc1337":               fs.newInode(ctx, root, 0444, newStaticFile("1")),
+			"tcp_slow_start_after_idle": fs.newInode(ctx, root, 0444, newStaticFile("1")),
+			"tcp_synack_retries":        fs.newInode(ctx, root, 0444, newStaticFile("5")),
+			"tcp_syn_retries":           fs.newInode(ctx, root, 0444, newStaticFile("3")),
+			"tcp_timestamps":            fs.newInode(ctx, root, 0444, newStaticFile("1")),
+		}),
+		"core": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"default_qdisc": fs.newInode(ctx, root, 0444, newStaticFile("pfifo_fast")),
+			"message_burst": fs.newInode(ctx, root, 0444, newStaticFile("10")),
+			"message_cost":  fs.newInode(ctx, root, 0444, newStaticFile("5")),
+			"optmem_max":    fs.newInode(ctx, root, 0444, newStaticFile("0")),
+			"rmem_default":  fs.newInode(ctx, root, 0644, &socketBufferData{stack: stack, dir: tcpRMem}),
+			"rmem_max":      fs.newInode(ctx, root, 0644, &socketBufferData{stack: stack, dir: tcpRMem, max: true}),
+			"somaxconn":     fs.newInode(ctx, root, 0644, &soMaxConnData{stack: stack}),
+			"wmem_default":  fs.newInode(ctx, root, 0644, &socketBufferData{stack: stack, dir: tcpWMem}),
+			"wmem_max":      fs.newInode(ctx, root, 0644, &socketBufferData{stack: stack, dir: tcpWMem, max: true}),
+		}),
+	}
+	if stack.SupportsIPv6() {
+		contents["ipv6"] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"conf": fs.newSysNetIPv6ConfDir(ctx, root, stack),
+		})
+	}
+	return contents
 }
 
-// newSysNetDir returns the dentry corresponding to /proc/sys/net directory.
-func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
-	var contents map[string]kernfs.Inode
-
-	// TODO(gvisor.dev/issue/1833): Support for using the network stack in the
-	// network namespace of the calling process.
-	if stack := k.RootNetworkNamespace().Stack(); stack != nil {
-		contents = map[string]kernfs.Inode{
-			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"tcp_recovery": fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
-				"tcp_rmem":     fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
-				"tcp_sack":     fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
-				"tcp_wmem":     fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
-				"ip_forward":   fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
-
-				// The following files are simple stubs until they are implemented in
-				// netstack, most of these files are configuration related. We use the
-				// value closest to the actual netstack behavior or any empty file, all
-				// of these files will have mode 0444 (read-only for all users).
-				"ip_local_port_range":     fs.newInode(ctx, root, 0444, newStaticFile("16000   65535")),
-				"ip_local_reserved_ports": fs.newInode(ctx, root, 0444, newStaticFile("")),
-				"ipfrag_time":             fs.newInode(ctx, root, 0444, newStaticFile("30")),
-				"ip_nonlocal_bind":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"ip_no_pmtu_disc":         fs.newInode(ctx, root, 0444, newStaticFile("1")),
-
-				// tcp_allowed_congestion_control tell the user what they are able to
-				// do as an unprivledged process so we leave it empty.
-				"tcp_allowed_congestion_control":   fs.newInode(ctx, root, 0444, newStaticFile("")),
-				"tcp_available_congestion_control": fs.newInode(ctx, root, 0444, newStaticFile("reno")),
-				"tcp_congestion_control":           fs.newInode(ctx, root, 0444, newStaticFile("reno")),
-
-				// Many of the following stub files are features netstack doesn't
-				// support. The unsupported features return "0" to indicate they are
-				// disabled.
-				"tcp_base_mss":              fs.newInode(ctx, root, 0444, newStaticFile("1280")),
-				"tcp_dsack":                 fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_early_retrans":         fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_fack":                  fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_fastopen":              fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_fastopen_key":          fs.newInode(ctx, root, 0444, newStaticFile("")),
-				"tcp_invalid_ratelimit":     fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_keepalive_intvl":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_keepalive_probes":      fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_keepalive_time":        fs.newInode(ctx, root, 0444, newStaticFile("7200")),
-				"tcp_mtu_probing":           fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_no_metrics_save":       fs.newInode(ctx, root, 0444, newStaticFile("1")),
-				"tcp_probe_interval":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_probe_threshold":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_retries1":              fs.newInode(ctx, root, 0444, newStaticFile("3")),
-				"tcp_retries2":              fs.newInode(ctx, root, 0444, newStaticFile("15")),
-				"tcp_rfc1337":               fs.newInode(ctx, root, 0444, newStaticFile("1")),
-				"tcp_slow_start_after_idle": fs.newInode(ctx, root, 0444, newStaticFile("1")),
-				"tcp_synack_retries":        fs.newInode(ctx, root, 0444, newStaticFile("5")),
-				"tcp_syn_retries":           fs.newInode(ctx, root, 0444, newStaticFile("3")),
-				"tcp_timestamps":            fs.newInode(ctx, root, 0444, newStaticFile("1")),
-			}),
-			"core": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"default_qdisc": fs.newInode(ctx, root, 0444, newStaticFile("pfifo_fast")),
-				"message_burst": fs.newInode(ctx, root, 0444, newStaticFile("10")),
-				"message_cost":  fs.newInode(ctx, root, 0444, newStaticFile("5")),
-				"optmem_max":    fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"rmem_default":  fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"rmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"somaxconn":     fs.newInode(ctx, root, 0444, newStaticFile("128")),
-				"wmem_default":  fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-				"wmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
-			}),
+// newSysNetIPv4ConfDir returns the dentry corresponding to
+// /proc/sys/net/ipv4/conf, which holds the ARP and martian logging settings of
+// each interface.
+func (fs *filesystem) newSysNetIPv4ConfDir(ctx context.Context, root *auth.Credentials, stack inet.Stack) kernfs.Inode {
+	contents := map[string]kernfs.Inode{}
+	for idx, iface := range stack.Interfaces() {
+		if _, ok := contents[iface.Name]; ok || iface.Name == "" {
+			continue
 		}
+		contents[iface.Name] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"arp_announce": fs.newInode(ctx, root, 0644, &ipv4ConfData{stack: stack, idx: idx, setting: ipv4ARPAnnounce}),
+			"arp_filter":   fs.newInode(ctx, root, 0644, &ipv4ConfData{stack: stack, idx: idx, setting: ipv4ARPFilter}),
+			"arp_ignore":   fs.newInode(ctx, root, 0644, &ipv4ConfData{stack: stack, idx: idx, setting: ipv4ARPIgnore}),
+			"log_martians": fs.newInode(ctx, root, 0644, &ipv4ConfData{stack: stack, idx: idx, setting: ipv4LogMartians}),
+		})
 	}
+	return fs.newStaticDir(ctx, root, contents)
+}
 
+// newSysNetIPv6ConfDir returns the dentry corresponding to
+// /proc/sys/net/ipv6/conf. Netstack doesn't support per interface forwarding
+// or hop limits, so these files of each interface are read-only views of the
+// global settings.
+func (fs *filesystem) newSysNetIPv6ConfDir(ctx context.Context, root *auth.Credentials, stack inet.Stack) kernfs.Inode {
+	contents := map[string]kernfs.Inode{
+		"all": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"forwarding": fs.newInode(ctx, root, 0644, &ipv6ForwardingData{stack: stack}),
+			"hop_limit":  fs.newInode(ctx, root, 0644, &ipv6HopLimitData{stack: stack}),
+		}),
+		"default": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"forwarding": fs.newInode(ctx, root, 0644, &ipv6ForwardingData{stack: stack}),
+			"hop_limit":  fs.newInode(ctx, root, 0644, &ipv6HopLimitData{stack: stack}),
+		}),
+	}
+	for idx, iface := range stack.Interfaces() {
+		if _, ok := contents[iface.Name]; ok || iface.Name == "" {
+			continue
+		}
+		contents[iface.Name] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"accept_ra":     fs.newInode(ctx, root, 0644, &ipv6ConfData{stack: stack, idx: idx, setting: ipv6AcceptRA}),
+			"autoconf":      fs.newInode(ctx, root, 0644, &ipv6ConfData{stack: stack, idx: idx, setting: ipv6Autoconf}),
+			"dad_transmits": fs.newInode(ctx, root, 0644, &ipv6ConfData{stack: stack, idx: idx, setting: ipv6DADTransmits}),
+			"forwarding":    fs.newInode(ctx, root, 0444, &ipv6ForwardingData{stack: stack, readOnly: true}),
+			"hop_limit":     fs.newInode(ctx, root, 0444, &ipv6HopLimitData{stack: stack, readOnly: true}),
+			"mtu":           fs.newInode(ctx, root, 0644, &ipv6ConfData{stack: stack, idx: idx, setting: ipv6MTU}),
+			"use_tempaddr":  fs.newInode(ctx, root, 0644, &ipv6ConfData{stack: stack, idx: idx, setting: ipv6UseTempAddr}),
+		})
+	}
 	return fs.newStaticDir(ctx, root, contents)
 }
 
@@ -224,6 +429,106 @@ func (d *tcpSackData) Write(ctx context.Context, src usermem.IOSequence, offset
 	return n, d.stack.SetTCPSACKEnabled(*d.enabled)
 }
 
+// tcpAbortOnOverflowData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_abort_on_overflow.
+//
+// +stateify savable
+type tcpAbortOnOverflowData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpAbortOnOverflowData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpAbortOnOverflowData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	abort, err := d.stack.TCPAbortOnOverflow()
+	if err != nil {
+		return err
+	}
+	val := "0\n"
+	if abort {
+		val = "1\n"
+	}
+	_, err = buf.WriteString(val)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpAbortOnOverflowData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetTCPAbortOnOverflow(v != 0); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// icmpEchoEnableProbeData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/icmp_echo_enable_probe.
+//
+// +stateify savable
+type icmpEchoEnableProbeData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*icmpEchoEnableProbeData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *icmpEchoEnableProbeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	enabled, err := d.stack.ICMPEchoEnableProbe()
+	if err != nil {
+		return err
+	}
+	val := "0\n"
+	if enabled {
+		val = "1\n"
+	}
+	_, err = buf.WriteString(val)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *icmpEchoEnableProbeData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetICMPEchoEnableProbe(v != 0); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // tcpRecoveryData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/tcp_recovery.
 //
@@ -418,3 +723,747 @@ func (ipf *ipForwarding) Write(ctx context.Context, src usermem.IOSequence, offs
 	}
 	return n, nil
 }
+
+// portRangeData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/ip_local_port_range.
+//
+// +stateify savable
+type portRangeData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*portRangeData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *portRangeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	start, end := d.stack.PortRange()
+	_, err := fmt.Fprintf(buf, "%d\t%d\n", start, end)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *portRangeData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	start, end := d.stack.PortRange()
+	buf := []int32{int32(start), int32(end)}
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	// Linux rejects ranges that are empty or contain port 0.
+	if buf[0] <= 0 || buf[1] > math.MaxUint16 || buf[0] > buf[1] {
+		return 0, syserror.EINVAL
+	}
+	if err := d.stack.SetPortRange(uint16(buf[0]), uint16(buf[1])); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// pingGroupRangeData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/ping_group_range.
+//
+// +stateify savable
+type pingGroupRangeData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*pingGroupRangeData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *pingGroupRangeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ns := auth.CredentialsFromContext(ctx).UserNamespace
+	low, high := d.stack.PingGroupRange()
+	_, err := fmt.Fprintf(buf, "%d\t%d\n", low.In(ns).OrOverflow(), high.In(ns).OrOverflow())
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *pingGroupRangeData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]int32, 2)
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] < 0 || buf[1] < 0 {
+		return 0, syserror.EINVAL
+	}
+
+	// As in Linux, the groups are in the writer's user namespace, and a
+	// range with high < low disables ICMP echo sockets for all groups.
+	ns := auth.CredentialsFromContext(ctx).UserNamespace
+	low := ns.MapToKGID(auth.GID(buf[0]))
+	high := ns.MapToKGID(auth.GID(buf[1]))
+	if !low.Ok() || !high.Ok() {
+		return 0, syserror.EINVAL
+	}
+	if high < low {
+		low, high = 1, 0
+	}
+	if err := d.stack.SetPingGroupRange(low, high); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// reservedPortsData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/ip_local_reserved_ports.
+//
+// +stateify savable
+type reservedPortsData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*reservedPortsData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *reservedPortsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	buf.WriteString(inet.FormatPortList(d.stack.LocalReservedPorts()))
+	buf.WriteString("\n")
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *reservedPortsData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	ports, err := inet.ParsePortList(string(buf[:n]))
+	if err != nil {
+		return 0, syserror.EINVAL
+	}
+	if err := d.stack.SetLocalReservedPorts(ports); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// transportMemData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_mem and /proc/sys/net/ipv4/udp_mem.
+//
+// +stateify savable
+type transportMemData struct {
+	kernfs.DynamicBytesFile
+
+	protocol tcpip.TransportProtocolNumber
+	stack    inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*transportMemData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *transportMemData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	limits, err := d.stack.TransportMemoryLimits(d.protocol)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\t%d\t%d\n", limits.Min, limits.Pressure, limits.Max)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *transportMemData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	limits, err := d.stack.TransportMemoryLimits(d.protocol)
+	if err != nil {
+		return 0, err
+	}
+	buf := []int32{int32(limits.Min), int32(limits.Pressure), int32(limits.Max)}
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, buf, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	newLimits := inet.TransportMemoryLimits{
+		Min:      int(buf[0]),
+		Pressure: int(buf[1]),
+		Max:      int(buf[2]),
+	}
+	if err := d.stack.SetTransportMemoryLimits(d.protocol, newLimits); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// tcpCongestionControlData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_congestion_control.
+//
+// +stateify savable
+type tcpCongestionControlData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpCongestionControlData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpCongestionControlData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	cc, err := d.stack.TCPCongestionControl()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%s\n", cc)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpCongestionControlData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	cc := strings.TrimSpace(string(buf[:n]))
+	if cc == "" {
+		return 0, syserror.EINVAL
+	}
+	if err := d.stack.SetTCPCongestionControl(cc); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// tcpAvailableCongestionControlData implements vfs.DynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_available_congestion_control.
+//
+// +stateify savable
+type tcpAvailableCongestionControlData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ dynamicInode = (*tcpAvailableCongestionControlData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpAvailableCongestionControlData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	available, err := d.stack.TCPAvailableCongestionControl()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%s\n", strings.Join(available, " "))
+	return err
+}
+
+// socketBufferData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/core/{r,w}mem_{default,max}.
+//
+// +stateify savable
+type socketBufferData struct {
+	kernfs.DynamicBytesFile
+
+	dir   tcpMemDir
+	max   bool
+	stack inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*socketBufferData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *socketBufferData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	size, err := d.readSizeLocked()
+	if err != nil {
+		return err
+	}
+	v := size.Default
+	if d.max {
+		v = size.Max
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", v)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *socketBufferData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, syserror.EINVAL
+	}
+	size, err := d.readSizeLocked()
+	if err != nil {
+		return 0, err
+	}
+	if d.max {
+		size.Max = int(v)
+	} else {
+		size.Default = int(v)
+	}
+	if err := d.writeSizeLocked(size); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Precondition: d.mu must be locked.
+func (d *socketBufferData) readSizeLocked() (inet.SocketBufferSize, error) {
+	switch d.dir {
+	case tcpRMem:
+		return d.stack.SocketReceiveBufferSize()
+	case tcpWMem:
+		return d.stack.SocketSendBufferSize()
+	default:
+		panic(fmt.Sprintf("unknown socketBufferData type: %v", d.dir))
+	}
+}
+
+// Precondition: d.mu must be locked.
+func (d *socketBufferData) writeSizeLocked(size inet.SocketBufferSize) error {
+	switch d.dir {
+	case tcpRMem:
+		return d.stack.SetSocketReceiveBufferSize(size)
+	case tcpWMem:
+		return d.stack.SetSocketSendBufferSize(size)
+	default:
+		panic(fmt.Sprintf("unknown socketBufferData type: %v", d.dir))
+	}
+}
+
+// soMaxConnData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/core/somaxconn.
+//
+// +stateify savable
+type soMaxConnData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*soMaxConnData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *soMaxConnData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	_, err := fmt.Fprintf(buf, "%d\n", d.stack.SoMaxConn())
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *soMaxConnData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetSoMaxConn(int(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipv6ForwardingData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv6/conf/*/forwarding.
+//
+// +stateify savable
+type ipv6ForwardingData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+
+	// readOnly is true for the files of individual interfaces.
+	readOnly bool
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipv6ForwardingData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipv6ForwardingData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	val := "0\n"
+	if d.stack.Forwarding(ipv6.ProtocolNumber) {
+		val = "1\n"
+	}
+	_, err := buf.WriteString(val)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipv6ForwardingData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if d.readOnly {
+		return 0, syserror.EPERM
+	}
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetForwarding(ipv6.ProtocolNumber, v != 0); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipv4ConfData implements vfs.WritableDynamicBytesSource for the ARP and martian
+// logging settings in /proc/sys/net/ipv4/conf/<interface>.
+//
+// +stateify savable
+type ipv4ConfData struct {
+	kernfs.DynamicBytesFile
+
+	stack   inet.Stack `state:"wait"`
+	idx     int32
+	setting ipv4ConfSetting
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipv4ConfData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipv4ConfData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	conf, err := d.stack.IPv4Conf(d.idx)
+	if err != nil {
+		return err
+	}
+	var v int
+	switch d.setting {
+	case ipv4ARPIgnore:
+		v = conf.ARPIgnore
+	case ipv4ARPAnnounce:
+		v = conf.ARPAnnounce
+	case ipv4ARPFilter:
+		v = boolToInt(conf.ARPFilter)
+	case ipv4LogMartians:
+		v = boolToInt(conf.LogMartians)
+	default:
+		panic(fmt.Sprintf("unknown ipv4ConfSetting: %v", d.setting))
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", v)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipv4ConfData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	conf, err := d.stack.IPv4Conf(d.idx)
+	if err != nil {
+		return 0, err
+	}
+	// The stack rejects unsupported modes.
+	switch d.setting {
+	case ipv4ARPIgnore:
+		conf.ARPIgnore = int(v)
+	case ipv4ARPAnnounce:
+		conf.ARPAnnounce = int(v)
+	case ipv4ARPFilter:
+		conf.ARPFilter = v > 0
+	case ipv4LogMartians:
+		conf.LogMartians = v > 0
+	default:
+		panic(fmt.Sprintf("unknown ipv4ConfSetting: %v", d.setting))
+	}
+	if err := d.stack.SetIPv4Conf(d.idx, conf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipv6ConfData implements vfs.WritableDynamicBytesSource for the neighbor
+// discovery settings and the MTU in /proc/sys/net/ipv6/conf/<interface>.
+//
+// +stateify savable
+type ipv6ConfData struct {
+	kernfs.DynamicBytesFile
+
+	stack   inet.Stack `state:"wait"`
+	idx     int32
+	setting ipv6ConfSetting
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipv6ConfData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipv6ConfData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	conf, err := d.stack.IPv6Conf(d.idx)
+	if err != nil {
+		return err
+	}
+	var v int
+	switch d.setting {
+	case ipv6AcceptRA:
+		v = boolToInt(conf.AcceptRA)
+	case ipv6Autoconf:
+		v = boolToInt(conf.Autoconf)
+	case ipv6DADTransmits:
+		v = conf.DADTransmits
+	case ipv6UseTempAddr:
+		v = boolToInt(conf.UseTempAddr)
+	case ipv6MTU:
+		v = int(conf.MTU)
+	default:
+		panic(fmt.Sprintf("unknown ipv6ConfSetting: %v", d.setting))
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", v)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipv6ConfData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	conf, err := d.stack.IPv6Conf(d.idx)
+	if err != nil {
+		return 0, err
+	}
+	// Like other boolean settings, values other than 0 and 1 read back as 1.
+	switch d.setting {
+	case ipv6AcceptRA:
+		conf.AcceptRA = v > 0
+	case ipv6Autoconf:
+		conf.Autoconf = v > 0
+	case ipv6DADTransmits:
+		if v < 0 {
+			return 0, syserror.EINVAL
+		}
+		conf.DADTransmits = int(v)
+	case ipv6UseTempAddr:
+		conf.UseTempAddr = v > 0
+	case ipv6MTU:
+		// As on Linux, the MTU can neither be below the minimum MTU of
+		// IPv6 nor above the MTU of the interface.
+		iface, ok := d.stack.Interfaces()[d.idx]
+		if !ok {
+			return 0, syserror.ENODEV
+		}
+		if v < header.IPv6MinimumMTU || uint32(v) > iface.MTU {
+			return 0, syserror.EINVAL
+		}
+		conf.MTU = uint32(v)
+	default:
+		panic(fmt.Sprintf("unknown ipv6ConfSetting: %v", d.setting))
+	}
+	if err := d.stack.SetIPv6Conf(d.idx, conf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ipv6HopLimitData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv6/conf/*/hop_limit.
+//
+// +stateify savable
+type ipv6HopLimitData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+
+	// readOnly is true for the files of individual interfaces.
+	readOnly bool
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipv6HopLimitData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipv6HopLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	hopLimit, err := d.stack.IPv6HopLimit()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", hopLimit)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipv6HopLimitData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if d.readOnly {
+		return 0, syserror.EPERM
+	}
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetIPv6HopLimit(int(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
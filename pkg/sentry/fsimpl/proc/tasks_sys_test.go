@@ -16,6 +16,7 @@ package proc
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -23,6 +24,8 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -147,3 +150,437 @@ func TestConfigureIPForwarding(t *testing.T) {
 		})
 	}
 }
+
+// TestConfigurePortRange tests the implementation of
+// /proc/sys/net/ipv4/ip_local_port_range.
+func TestConfigurePortRange(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		str       string
+		wantErr   error
+		wantStart uint16
+		wantEnd   uint16
+	}{
+		{str: "1024 2048", wantStart: 1024, wantEnd: 2048},
+		{str: "32768\t60999\n", wantStart: 32768, wantEnd: 60999},
+		{str: "5000 5000", wantStart: 5000, wantEnd: 5000},
+		{str: "0 2048", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+		{str: "2048 1024", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+		{str: "1024 65536", wantErr: syserror.EINVAL, wantStart: 16000, wantEnd: 65535},
+	} {
+		t.Run(c.str, func(t *testing.T) {
+			s := inet.NewTestStack()
+			s.PortRangeStart, s.PortRangeEnd = 16000, 65535
+			d := &portRangeData{stack: s}
+
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if _, err := d.Write(ctx, src, 0); err != c.wantErr {
+				t.Errorf("d.Write(ctx, %q, 0) = (_, %v), want (_, %v)", c.str, err, c.wantErr)
+			}
+			if s.PortRangeStart != c.wantStart || s.PortRangeEnd != c.wantEnd {
+				t.Errorf("got port range [%d, %d], want [%d, %d]", s.PortRangeStart, s.PortRangeEnd, c.wantStart, c.wantEnd)
+			}
+
+			var buf bytes.Buffer
+			if err := d.Generate(ctx, &buf); err != nil {
+				t.Fatalf("d.Generate(ctx, _) = %v", err)
+			}
+			if got, want := buf.String(), fmt.Sprintf("%d\t%d\n", c.wantStart, c.wantEnd); got != want {
+				t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestLocalReservedPorts tests the implementation of
+// /proc/sys/net/ipv4/ip_local_reserved_ports.
+func TestLocalReservedPorts(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	d := &reservedPortsData{stack: s}
+
+	const str = "8080,9000-9002\n"
+	if n, err := d.Write(ctx, usermem.BytesIOSequence([]byte(str)), 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("d.Write(ctx, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	if got, want := s.ReservedPorts, []uint16{8080, 9000, 9001, 9002}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got s.ReservedPorts = %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Generate(ctx, &buf); err != nil {
+		t.Fatalf("d.Generate(ctx, _) = %v", err)
+	}
+	if got := buf.String(); got != str {
+		t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, str)
+	}
+
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("9002-9000")), 0); err != syserror.EINVAL {
+		t.Errorf("d.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "9002-9000", err, syserror.EINVAL)
+	}
+}
+
+func TestTransportMemoryLimits(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.MemoryLimits[header.TCPProtocolNumber] = inet.TransportMemoryLimits{Min: 1, Pressure: 2, Max: 3}
+	d := &transportMemData{stack: s, protocol: header.TCPProtocolNumber}
+
+	var buf bytes.Buffer
+	if err := d.Generate(ctx, &buf); err != nil {
+		t.Fatalf("d.Generate(ctx, _) = %v", err)
+	}
+	if got, want := buf.String(), "1\t2\t3\n"; got != want {
+		t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, want)
+	}
+
+	const str = "4096 8192 16384"
+	if n, err := d.Write(ctx, usermem.BytesIOSequence([]byte(str)), 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("d.Write(ctx, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	want := inet.TransportMemoryLimits{Min: 4096, Pressure: 8192, Max: 16384}
+	if got := s.MemoryLimits[header.TCPProtocolNumber]; got != want {
+		t.Errorf("got s.MemoryLimits[TCP] = %+v, want %+v", got, want)
+	}
+	if _, ok := s.MemoryLimits[header.UDPProtocolNumber]; ok {
+		t.Errorf("writing tcp_mem changed the UDP limits")
+	}
+}
+
+// TestTCPCongestionControl tests the implementation of
+// /proc/sys/net/ipv4/tcp_congestion_control.
+func TestTCPCongestionControl(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.CongestionControl = "reno"
+	s.AvailableCC = []string{"reno", "cubic"}
+	d := &tcpCongestionControlData{stack: s}
+
+	const str = "cubic\n"
+	if n, err := d.Write(ctx, usermem.BytesIOSequence([]byte(str)), 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("d.Write(ctx, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	if got, want := s.CongestionControl, "cubic"; got != want {
+		t.Errorf("got s.CongestionControl = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Generate(ctx, &buf); err != nil {
+		t.Fatalf("d.Generate(ctx, _) = %v", err)
+	}
+	if got := buf.String(); got != str {
+		t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, str)
+	}
+
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("bbr")), 0); err != syserror.ENOENT {
+		t.Errorf("d.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "bbr", err, syserror.ENOENT)
+	}
+
+	buf.Reset()
+	available := &tcpAvailableCongestionControlData{stack: s}
+	if err := available.Generate(ctx, &buf); err != nil {
+		t.Fatalf("available.Generate(ctx, _) = %v", err)
+	}
+	if got, want := buf.String(), "reno cubic\n"; got != want {
+		t.Errorf("got available.Generate(ctx, _) = %q, want %q", got, want)
+	}
+}
+
+// TestSocketBufferSize tests the implementation of
+// /proc/sys/net/core/{r,w}mem_{default,max}.
+func TestSocketBufferSize(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.RecvBufSize = inet.SocketBufferSize{Default: 1000, Max: 2000}
+	s.SendBufSize = inet.SocketBufferSize{Default: 3000, Max: 4000}
+
+	for _, c := range []struct {
+		name     string
+		d        *socketBufferData
+		wantRecv inet.SocketBufferSize
+		wantSend inet.SocketBufferSize
+	}{
+		{
+			name:     "rmem_default",
+			d:        &socketBufferData{stack: s, dir: tcpRMem},
+			wantRecv: inet.SocketBufferSize{Default: 5000, Max: 2000},
+			wantSend: inet.SocketBufferSize{Default: 3000, Max: 4000},
+		},
+		{
+			name:     "rmem_max",
+			d:        &socketBufferData{stack: s, dir: tcpRMem, max: true},
+			wantRecv: inet.SocketBufferSize{Default: 5000, Max: 5000},
+			wantSend: inet.SocketBufferSize{Default: 3000, Max: 4000},
+		},
+		{
+			name:     "wmem_default",
+			d:        &socketBufferData{stack: s, dir: tcpWMem},
+			wantRecv: inet.SocketBufferSize{Default: 5000, Max: 5000},
+			wantSend: inet.SocketBufferSize{Default: 5000, Max: 4000},
+		},
+		{
+			name:     "wmem_max",
+			d:        &socketBufferData{stack: s, dir: tcpWMem, max: true},
+			wantRecv: inet.SocketBufferSize{Default: 5000, Max: 5000},
+			wantSend: inet.SocketBufferSize{Default: 5000, Max: 5000},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			const str = "5000"
+			if n, err := c.d.Write(ctx, usermem.BytesIOSequence([]byte(str)), 0); n != int64(len(str)) || err != nil {
+				t.Fatalf("d.Write(ctx, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+			}
+			if s.RecvBufSize != c.wantRecv || s.SendBufSize != c.wantSend {
+				t.Errorf("got sizes (%+v, %+v), want (%+v, %+v)", s.RecvBufSize, s.SendBufSize, c.wantRecv, c.wantSend)
+			}
+
+			var buf bytes.Buffer
+			if err := c.d.Generate(ctx, &buf); err != nil {
+				t.Fatalf("d.Generate(ctx, _) = %v", err)
+			}
+			if got, want := buf.String(), str+"\n"; got != want {
+				t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestSoMaxConn tests the implementation of /proc/sys/net/core/somaxconn.
+func TestSoMaxConn(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.MaxConn = 128
+	d := &soMaxConnData{stack: s}
+
+	const str = "4096\n"
+	if n, err := d.Write(ctx, usermem.BytesIOSequence([]byte(str)), 0); n != int64(len(str)) || err != nil {
+		t.Fatalf("d.Write(ctx, %q, 0) = (%d, %v), want (%d, nil)", str, n, err, len(str))
+	}
+	if got, want := s.MaxConn, 4096; got != want {
+		t.Errorf("got s.MaxConn = %d, want %d", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Generate(ctx, &buf); err != nil {
+		t.Fatalf("d.Generate(ctx, _) = %v", err)
+	}
+	if got := buf.String(); got != str {
+		t.Errorf("got d.Generate(ctx, _) = %q, want %q", got, str)
+	}
+}
+
+// TestIPv6Forwarding tests the implementation of
+// /proc/sys/net/ipv6/conf/*/forwarding.
+func TestIPv6Forwarding(t *testing.T) {
+	ctx := context.Background()
+	s := newIPv6TestStack()
+	all := &ipv6ForwardingData{stack: s}
+	iface := &ipv6ForwardingData{stack: s, readOnly: true}
+
+	if n, err := all.Write(ctx, usermem.BytesIOSequence([]byte("1")), 0); n != 1 || err != nil {
+		t.Fatalf("all.Write(ctx, %q, 0) = (%d, %v), want (1, nil)", "1", n, err)
+	}
+	if !s.IPForwarding {
+		t.Errorf("got s.IPForwarding = false, want true")
+	}
+
+	var buf bytes.Buffer
+	if err := iface.Generate(ctx, &buf); err != nil {
+		t.Fatalf("iface.Generate(ctx, _) = %v", err)
+	}
+	if got, want := buf.String(), "1\n"; got != want {
+		t.Errorf("got iface.Generate(ctx, _) = %q, want %q", got, want)
+	}
+
+	if _, err := iface.Write(ctx, usermem.BytesIOSequence([]byte("0")), 0); err != syserror.EPERM {
+		t.Errorf("iface.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "0", err, syserror.EPERM)
+	}
+	if !s.IPForwarding {
+		t.Errorf("writing the forwarding file of an interface changed s.IPForwarding")
+	}
+}
+
+// TestIPv4Conf tests the implementation of the ARP and martian logging settings
+// in /proc/sys/net/ipv4/conf/<interface>.
+func TestIPv4Conf(t *testing.T) {
+	ctx := context.Background()
+	s := inet.NewTestStack()
+	s.IPv4Confs[1] = inet.IPv4Conf{ARPIgnore: 1}
+
+	for _, tc := range []struct {
+		setting ipv4ConfSetting
+		initial string
+		write   string
+		want    inet.IPv4Conf
+	}{
+		{
+			setting: ipv4ARPIgnore,
+			initial: "1\n",
+			write:   "2",
+			want:    inet.IPv4Conf{ARPIgnore: 2},
+		},
+		{
+			setting: ipv4ARPAnnounce,
+			initial: "0\n",
+			write:   "2",
+			want:    inet.IPv4Conf{ARPIgnore: 2, ARPAnnounce: 2},
+		},
+		{
+			setting: ipv4ARPFilter,
+			initial: "0\n",
+			write:   "1",
+			want:    inet.IPv4Conf{ARPIgnore: 2, ARPAnnounce: 2, ARPFilter: true},
+		},
+		{
+			setting: ipv4LogMartians,
+			initial: "0\n",
+			write:   "1",
+			want:    inet.IPv4Conf{ARPIgnore: 2, ARPAnnounce: 2, ARPFilter: true, LogMartians: true},
+		},
+	} {
+		file := &ipv4ConfData{stack: s, idx: 1, setting: tc.setting}
+		var buf bytes.Buffer
+		if err := file.Generate(ctx, &buf); err != nil {
+			t.Fatalf("file.Generate(ctx, _) for setting %d = %v", tc.setting, err)
+		}
+		if got := buf.String(); got != tc.initial {
+			t.Errorf("got file.Generate(ctx, _) for setting %d = %q, want %q", tc.setting, got, tc.initial)
+		}
+		if n, err := file.Write(ctx, usermem.BytesIOSequence([]byte(tc.write)), 0); n != int64(len(tc.write)) || err != nil {
+			t.Fatalf("file.Write(ctx, %q, 0) for setting %d = (%d, %v), want (%d, nil)", tc.write, tc.setting, n, err, len(tc.write))
+		}
+		if got := s.IPv4Confs[1]; got != tc.want {
+			t.Errorf("got s.IPv4Confs[1] = %+v after setting %d, want %+v", got, tc.setting, tc.want)
+		}
+	}
+
+	missing := &ipv4ConfData{stack: s, idx: 2, setting: ipv4ARPIgnore}
+	if _, err := missing.Write(ctx, usermem.BytesIOSequence([]byte("1")), 0); err != syserror.ENODEV {
+		t.Errorf("missing.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "1", err, syserror.ENODEV)
+	}
+}
+
+// TestIPv6Conf tests the implementation of the neighbor discovery settings in
+// /proc/sys/net/ipv6/conf/<interface>.
+func TestIPv6Conf(t *testing.T) {
+	ctx := context.Background()
+	s := newIPv6TestStack()
+	s.IPv6Confs[1] = inet.IPv6Conf{AcceptRA: true, DADTransmits: 1}
+
+	for _, tc := range []struct {
+		setting ipv6ConfSetting
+		initial string
+		write   string
+		want    inet.IPv6Conf
+	}{
+		{
+			setting: ipv6AcceptRA,
+			initial: "1\n",
+			write:   "0",
+			want:    inet.IPv6Conf{DADTransmits: 1},
+		},
+		{
+			setting: ipv6Autoconf,
+			initial: "0\n",
+			write:   "1",
+			want:    inet.IPv6Conf{Autoconf: true, DADTransmits: 1},
+		},
+		{
+			setting: ipv6DADTransmits,
+			initial: "1\n",
+			write:   "3",
+			want:    inet.IPv6Conf{Autoconf: true, DADTransmits: 3},
+		},
+		{
+			setting: ipv6UseTempAddr,
+			initial: "0\n",
+			write:   "2",
+			want:    inet.IPv6Conf{Autoconf: true, DADTransmits: 3, UseTempAddr: true},
+		},
+	} {
+		file := &ipv6ConfData{stack: s, idx: 1, setting: tc.setting}
+		var buf bytes.Buffer
+		if err := file.Generate(ctx, &buf); err != nil {
+			t.Fatalf("file.Generate(ctx, _) for setting %d = %v", tc.setting, err)
+		}
+		if got := buf.String(); got != tc.initial {
+			t.Errorf("got file.Generate(ctx, _) for setting %d = %q, want %q", tc.setting, got, tc.initial)
+		}
+		if n, err := file.Write(ctx, usermem.BytesIOSequence([]byte(tc.write)), 0); n != int64(len(tc.write)) || err != nil {
+			t.Fatalf("file.Write(ctx, %q, 0) for setting %d = (%d, %v), want (%d, nil)", tc.write, tc.setting, n, err, len(tc.write))
+		}
+		if got := s.IPv6Confs[1]; got != tc.want {
+			t.Errorf("got s.IPv6Confs[1] = %+v after setting %d, want %+v", got, tc.setting, tc.want)
+		}
+	}
+
+	missing := &ipv6ConfData{stack: s, idx: 2, setting: ipv6AcceptRA}
+	if _, err := missing.Write(ctx, usermem.BytesIOSequence([]byte("1")), 0); err != syserror.ENODEV {
+		t.Errorf("missing.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "1", err, syserror.ENODEV)
+	}
+}
+
+// TestIPv6MTU tests the implementation of /proc/sys/net/ipv6/conf/<interface>/mtu.
+func TestIPv6MTU(t *testing.T) {
+	ctx := context.Background()
+	s := newIPv6TestStack()
+	s.InterfacesMap[1] = inet.Interface{Name: "eth0", MTU: 1500}
+	s.IPv6Confs[1] = inet.IPv6Conf{MTU: 1500}
+	file := &ipv6ConfData{stack: s, idx: 1, setting: ipv6MTU}
+
+	for _, tc := range []struct {
+		write   string
+		wantErr error
+		want    uint32
+	}{
+		{write: "1280", want: 1280},
+		{write: "1279", wantErr: syserror.EINVAL, want: 1280},
+		{write: "1501", wantErr: syserror.EINVAL, want: 1280},
+		{write: "1500", want: 1500},
+	} {
+		if _, err := file.Write(ctx, usermem.BytesIOSequence([]byte(tc.write)), 0); err != tc.wantErr {
+			t.Errorf("file.Write(ctx, %q, 0) = (_, %v), want (_, %v)", tc.write, err, tc.wantErr)
+		}
+		if got := s.IPv6Confs[1].MTU; got != tc.want {
+			t.Errorf("got s.IPv6Confs[1].MTU = %d after writing %q, want %d", got, tc.write, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := file.Generate(ctx, &buf); err != nil {
+		t.Fatalf("file.Generate(ctx, _) = %v", err)
+	}
+	if got, want := buf.String(), "1500\n"; got != want {
+		t.Errorf("got file.Generate(ctx, _) = %q, want %q", got, want)
+	}
+}
+
+// TestIPv6HopLimit tests the implementation of
+// /proc/sys/net/ipv6/conf/*/hop_limit.
+func TestIPv6HopLimit(t *testing.T) {
+	ctx := context.Background()
+	s := newIPv6TestStack()
+	s.HopLimit = 64
+	all := &ipv6HopLimitData{stack: s}
+	iface := &ipv6HopLimitData{stack: s, readOnly: true}
+
+	if n, err := all.Write(ctx, usermem.BytesIOSequence([]byte("32")), 0); n != 2 || err != nil {
+		t.Fatalf("all.Write(ctx, %q, 0) = (%d, %v), want (2, nil)", "32", n, err)
+	}
+	if s.HopLimit != 32 {
+		t.Errorf("got s.HopLimit = %d, want 32", s.HopLimit)
+	}
+
+	var buf bytes.Buffer
+	if err := iface.Generate(ctx, &buf); err != nil {
+		t.Fatalf("iface.Generate(ctx, _) = %v", err)
+	}
+	if got, want := buf.String(), "32\n"; got != want {
+		t.Errorf("got iface.Generate(ctx, _) = %q, want %q", got, want)
+	}
+
+	if _, err := iface.Write(ctx, usermem.BytesIOSequence([]byte("16")), 0); err != syserror.EPERM {
+		t.Errorf("iface.Write(ctx, %q, 0) = (_, %v), want (_, %v)", "16", err, syserror.EPERM)
+	}
+}
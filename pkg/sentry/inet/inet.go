@@ -16,6 +16,10 @@
 package inet
 
 import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
@@ -39,6 +43,22 @@ type Stack interface {
 	// identified by idx.
 	RemoveInterfaceAddr(idx int32, addr InterfaceAddr) error
 
+	// CreateVeth creates a virtual Ethernet pair, whose ends are the
+	// interfaces name of this stack and peerName of peer, which may be this
+	// stack. Empty names are replaced by unused ones. Both ends are down.
+	CreateVeth(name string, peer Stack, peerName string) error
+
+	// SetInterfaceUp brings the interface idx up or down.
+	SetInterfaceUp(idx int32, up bool) error
+
+	// MoveInterface moves the interface idx to the stack to, as when moving
+	// it to another network namespace. The interface is down once moved.
+	MoveInterface(idx int32, to Stack) error
+
+	// RemoveInterface removes the interface idx, along with its peer if it
+	// is an end of a virtual Ethernet pair.
+	RemoveInterface(idx int32) error
+
 	// SupportsIPv6 returns true if the stack supports IPv6 connectivity.
 	SupportsIPv6() bool
 
@@ -63,12 +83,103 @@ type Stack interface {
 	// settings.
 	SetTCPSACKEnabled(enabled bool) error
 
+	// TCPAbortOnOverflow returns true if listening sockets reset connections
+	// that complete while their accept queue is full.
+	TCPAbortOnOverflow() (bool, error)
+
+	// SetTCPAbortOnOverflow attempts to change whether listening sockets
+	// reset connections that complete while their accept queue is full.
+	SetTCPAbortOnOverflow(enabled bool) error
+
 	// TCPRecovery returns the TCP loss detection algorithm.
 	TCPRecovery() (TCPLossRecovery, error)
 
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// TCPCongestionControl returns the congestion control algorithm used by
+	// new TCP connections.
+	TCPCongestionControl() (string, error)
+
+	// SetTCPCongestionControl attempts to change the congestion control
+	// algorithm used by new TCP connections.
+	SetTCPCongestionControl(cc string) error
+
+	// TCPAvailableCongestionControl returns the supported TCP congestion
+	// control algorithms.
+	TCPAvailableCongestionControl() ([]string, error)
+
+	// SocketReceiveBufferSize returns the receive buffer size settings of
+	// non-TCP sockets.
+	SocketReceiveBufferSize() (SocketBufferSize, error)
+
+	// SetSocketReceiveBufferSize attempts to change the receive buffer size
+	// settings of non-TCP sockets.
+	SetSocketReceiveBufferSize(size SocketBufferSize) error
+
+	// SocketSendBufferSize returns the send buffer size settings of non-TCP
+	// sockets.
+	SocketSendBufferSize() (SocketBufferSize, error)
+
+	// SetSocketSendBufferSize attempts to change the send buffer size
+	// settings of non-TCP sockets.
+	SetSocketSendBufferSize(size SocketBufferSize) error
+
+	// SoMaxConn returns the maximum backlog of listening sockets.
+	SoMaxConn() int
+
+	// SetSoMaxConn attempts to change the maximum backlog of listening
+	// sockets.
+	SetSoMaxConn(n int) error
+
+	// PingGroupRange returns the inclusive range of groups whose members
+	// may create ICMP echo sockets.
+	PingGroupRange() (low, high auth.KGID)
+
+	// SetPingGroupRange attempts to change the range of groups whose
+	// members may create ICMP echo sockets. If high < low, no group may
+	// create them.
+	SetPingGroupRange(low, high auth.KGID) error
+
+	// IPv4Conf returns the IPv4 settings of the interface idx.
+	IPv4Conf(idx int32) (IPv4Conf, error)
+
+	// SetIPv4Conf attempts to change the IPv4 settings of the interface idx.
+	SetIPv4Conf(idx int32, conf IPv4Conf) error
+
+	// IPv6Conf returns the IPv6 settings of the interface idx.
+	IPv6Conf(idx int32) (IPv6Conf, error)
+
+	// SetIPv6Conf attempts to change the IPv6 settings of the interface idx.
+	SetIPv6Conf(idx int32, conf IPv6Conf) error
+
+	// IPv6HopLimit returns the default hop limit of IPv6 packets.
+	IPv6HopLimit() (int, error)
+
+	// SetIPv6HopLimit attempts to change the default hop limit of IPv6
+	// packets.
+	SetIPv6HopLimit(hopLimit int) error
+
+	// ICMPEchoEnableProbe returns true if the stack replies to ICMP Extended
+	// Echo Requests probing its interfaces (RFC 8335).
+	ICMPEchoEnableProbe() (bool, error)
+
+	// SetICMPEchoEnableProbe attempts to change whether the stack replies to
+	// ICMP Extended Echo Requests.
+	SetICMPEchoEnableProbe(enabled bool) error
+
+	// QDiscs returns the root queueing disciplines of all interfaces, keyed
+	// by interface index.
+	QDiscs() map[int32]QDisc
+
+	// SetQDisc attempts to replace the root queueing discipline of interface
+	// idx. Parameters which are zero take their default value.
+	SetQDisc(idx int32, qdisc QDisc) error
+
+	// ResetQDisc attempts to restore the default root queueing discipline of
+	// interface idx.
+	ResetQDisc(idx int32) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat interface{}, arg string) error
 
@@ -78,6 +189,13 @@ type Stack interface {
 	// Resume restarts the network stack after restore.
 	Resume()
 
+	// PauseTimers pauses the timers of the network stack, so that they
+	// don't fire while the sandbox is being saved.
+	PauseTimers()
+
+	// ResumeTimers resumes the timers paused by PauseTimers.
+	ResumeTimers()
+
 	// RegisteredEndpoints returns all endpoints which are currently registered.
 	RegisteredEndpoints() []stack.TransportEndpoint
 
@@ -93,6 +211,30 @@ type Stack interface {
 
 	// SetForwarding enables or disables packet forwarding between NICs.
 	SetForwarding(protocol tcpip.NetworkProtocolNumber, enable bool) error
+
+	// PortRange returns the UDP and TCP inclusive range of ephemeral ports
+	// used in both IPv4 and IPv6.
+	PortRange() (uint16, uint16)
+
+	// SetPortRange sets the UDP and TCP IPv4 and IPv6 ephemeral port range
+	// (inclusive).
+	SetPortRange(start uint16, end uint16) error
+
+	// LocalReservedPorts returns, in increasing order, the ports that are
+	// never picked as ephemeral ports.
+	LocalReservedPorts() []uint16
+
+	// SetLocalReservedPorts sets the ports that are never picked as
+	// ephemeral ports.
+	SetLocalReservedPorts(ports []uint16) error
+
+	// TransportMemoryLimits returns the limits on the memory held in the
+	// socket buffers of all endpoints of a transport protocol.
+	TransportMemoryLimits(protocol tcpip.TransportProtocolNumber) (TransportMemoryLimits, error)
+
+	// SetTransportMemoryLimits sets the limits on the memory held in the
+	// socket buffers of all endpoints of a transport protocol.
+	SetTransportMemoryLimits(protocol tcpip.TransportProtocolNumber, limits TransportMemoryLimits) error
 }
 
 // Interface contains information about a network interface.
@@ -143,6 +285,244 @@ type TCPBufferSize struct {
 	Max int
 }
 
+// SocketBufferSize contains settings controlling socket buffer sizing, as in
+// Linux's {r,w}mem_default and {r,w}mem_max sysctls.
+//
+// +stateify savable
+type SocketBufferSize struct {
+	// Default is the default size.
+	Default int
+
+	// Max is the maximum size that can be set with SO_RCVBUF or SO_SNDBUF.
+	Max int
+}
+
+// IPv4Conf contains the ARP and martian logging settings of an interface, as in
+// Linux's /proc/sys/net/ipv4/conf/<interface> sysctls.
+//
+// +stateify savable
+type IPv4Conf struct {
+	// ARPIgnore selects the ARP requests which are answered, as with
+	// arp_ignore.
+	ARPIgnore int
+
+	// ARPAnnounce selects the source address of ARP requests, as with
+	// arp_announce.
+	ARPAnnounce int
+
+	// ARPFilter is true if ARP requests are only answered when replies would
+	// be routed out of the interface they are received on.
+	ARPFilter bool
+
+	// LogMartians is true if packets with impossible source addresses are
+	// logged, as with log_martians.
+	LogMartians bool
+}
+
+// IPv6Conf contains the neighbor discovery settings of an interface, as in
+// Linux's /proc/sys/net/ipv6/conf/<interface> sysctls.
+//
+// +stateify savable
+type IPv6Conf struct {
+	// AcceptRA is true if router advertisements are handled.
+	AcceptRA bool
+
+	// Autoconf is true if addresses are generated from the prefixes in
+	// router advertisements (SLAAC).
+	Autoconf bool
+
+	// DADTransmits is the number of duplicate address detection probes sent
+	// for new addresses. Zero disables duplicate address detection.
+	DADTransmits int
+
+	// UseTempAddr is true if temporary addresses are generated, as per RFC
+	// 4941.
+	UseTempAddr bool
+
+	// MTU is the MTU of the IPv6 packets sent through the interface. It is
+	// at least 1280, the minimum MTU of IPv6, and at most the MTU of the
+	// interface.
+	MTU uint32
+}
+
+// QDisc describes the queueing discipline of an interface, as configured with
+// tc.
+//
+// +stateify savable
+type QDisc struct {
+	// Kind is the name of the discipline, e.g. "fq_codel" or "tbf". It is
+	// "noqueue" for interfaces which don't queue packets.
+	Kind string
+
+	// Handle is the tc handle of the discipline. It is 0 for the default
+	// discipline of an interface.
+	Handle uint32
+
+	// FQCoDel holds the parameters of fq_codel disciplines.
+	FQCoDel FQCoDelParams
+
+	// TBF holds the parameters of tbf disciplines.
+	TBF TBFParams
+
+	// PFIFO holds the parameters of pfifo disciplines.
+	PFIFO PFIFOParams
+
+	// Netem holds the parameters of netem disciplines.
+	Netem NetemParams
+
+	// Prio holds the parameters of prio disciplines.
+	Prio PrioParams
+
+	// SFQ holds the parameters of sfq disciplines.
+	SFQ SFQParams
+
+	// Stats holds the statistics of the discipline. It is ignored by
+	// SetQDisc.
+	Stats QDiscStats
+}
+
+// FQCoDelParams holds the parameters of an fq_codel queueing discipline.
+//
+// +stateify savable
+type FQCoDelParams struct {
+	// Target is the acceptable minimum standing queue delay of a flow.
+	Target time.Duration
+
+	// Interval is the width of the window over which the queue delay of a
+	// flow is measured.
+	Interval time.Duration
+
+	// Limit is the maximum number of packets queued.
+	Limit uint32
+
+	// Flows is the number of queues flows are hashed into.
+	Flows uint32
+
+	// Quantum is the number of bytes dequeued from a flow before moving on to
+	// the next one.
+	Quantum uint32
+}
+
+// TBFParams holds the parameters of a tbf queueing discipline.
+//
+// +stateify savable
+type TBFParams struct {
+	// Rate is the rate in bytes per second.
+	Rate uint64
+
+	// Burst is the size of the bucket in bytes.
+	Burst uint32
+
+	// Limit is the number of bytes which can be queued waiting for tokens.
+	Limit uint32
+}
+
+// PFIFOParams holds the parameters of a pfifo queueing discipline.
+//
+// +stateify savable
+type PFIFOParams struct {
+	// Limit is the maximum number of packets queued.
+	Limit uint32
+}
+
+// PrioParams holds the parameters of a prio queueing discipline.
+//
+// +stateify savable
+type PrioParams struct {
+	// Bands is the number of bands.
+	Bands uint32
+
+	// PrioMap maps the priority of packets to the band they are queued in.
+	PrioMap [16]uint8
+}
+
+// SFQParams holds the parameters of an sfq queueing discipline.
+//
+// +stateify savable
+type SFQParams struct {
+	// Quantum is the number of bytes dequeued from a flow before moving on to
+	// the next one.
+	Quantum uint32
+
+	// Limit is the maximum number of packets queued.
+	Limit uint32
+
+	// Divisor is the number of queues flows are hashed into.
+	Divisor uint32
+}
+
+// NetemParams holds the parameters of a netem queueing discipline.
+// Probabilities are between 0 and 1.
+//
+// +stateify savable
+type NetemParams struct {
+	// Latency is the delay added to packets, and Jitter its maximum
+	// variation.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// Loss is the probability of dropping a packet.
+	Loss float64
+
+	// Duplicate is the probability of duplicating a packet.
+	Duplicate float64
+
+	// Reorder is the probability of sending one out of Gap packets
+	// immediately, ahead of delayed packets.
+	Reorder float64
+	Gap     uint32
+
+	// Rate is the rate at which packets are sent in bytes per second, or 0
+	// for no limit.
+	Rate uint64
+
+	// Limit is the maximum number of packets queued.
+	Limit uint32
+}
+
+// QDiscStats holds the statistics of a queueing discipline.
+//
+// +stateify savable
+type QDiscStats struct {
+	// Packets and Bytes count the packets sent.
+	Packets uint64
+	Bytes   uint64
+
+	// Drops counts the packets dropped.
+	Drops uint64
+
+	// Overlimits counts the times packets were held back.
+	Overlimits uint64
+
+	// QueueLen and Backlog are the number of packets and bytes queued.
+	QueueLen uint64
+	Backlog  uint64
+}
+
+// DefaultSoMaxConn is the default maximum backlog of listening sockets.
+const DefaultSoMaxConn = 1024
+
+// MaxPingGroup is the largest group ID that may be part of ping_group_range.
+// By default, every group up to it may create ICMP echo sockets.
+const MaxPingGroup = auth.KGID(math.MaxInt32)
+
+// TransportMemoryLimits contains settings bounding the memory held in the
+// socket buffers of a transport protocol, in pages, as in Linux's tcp_mem and
+// udp_mem sysctls.
+//
+// +stateify savable
+type TransportMemoryLimits struct {
+	// Min is the usage below which the protocol leaves memory pressure.
+	Min int
+
+	// Pressure is the usage above which the protocol enters memory
+	// pressure.
+	Pressure int
+
+	// Max is the usage above which no new buffers are accepted.
+	Max int
+}
+
 // StatDev describes one line of /proc/net/dev, i.e., stats for one network
 // interface.
 type StatDev [16]uint64
@@ -189,6 +569,25 @@ type Route struct {
 	GatewayAddr []byte
 }
 
+// Neighbor is an entry of the neighbor table of an interface.
+type Neighbor struct {
+	// Family is the address family, a Linux AF_* constant.
+	Family uint8
+
+	// Ifindex is the index of the interface.
+	Ifindex int32
+
+	// State is the reachability state, a Linux NUD_* constant.
+	State uint16
+
+	// Addr is the network address of the neighbor (NDA_DST).
+	Addr []byte
+
+	// LinkAddr is the link address of the neighbor (NDA_LLADDR). It is
+	// empty if it isn't known.
+	LinkAddr []byte
+}
+
 // Below SNMP metrics are from Linux/usr/include/linux/snmp.h.
 
 // StatSNMPIP describes Ip line of /proc/net/snmp.
@@ -14,6 +14,18 @@
 
 package inet
 
+import (
+	"sync/atomic"
+)
+
+// lastNamespaceID is the last ID given to a network namespace.
+var lastNamespaceID uint64
+
+// nextNamespaceID returns a new network namespace ID.
+func nextNamespaceID() uint64 {
+	return atomic.AddUint64(&lastNamespaceID, 1)
+}
+
 // Namespace represents a network namespace. See network_namespaces(7).
 //
 // +stateify savable
@@ -30,6 +42,10 @@ type Namespace struct {
 
 	// isRoot indicates whether this is the root network namespace.
 	isRoot bool
+
+	// id uniquely identifies the namespace. It stands in for the nsfs inode
+	// number in /proc/[pid]/ns/net.
+	id uint64
 }
 
 // NewRootNamespace creates the root network namespace, with creator
@@ -40,6 +56,7 @@ func NewRootNamespace(stack Stack, creator NetworkStackCreator) *Namespace {
 		stack:   stack,
 		creator: creator,
 		isRoot:  true,
+		id:      nextNamespaceID(),
 	}
 }
 
@@ -47,6 +64,7 @@ func NewRootNamespace(stack Stack, creator NetworkStackCreator) *Namespace {
 func NewNamespace(root *Namespace) *Namespace {
 	n := &Namespace{
 		creator: root.creator,
+		id:      nextNamespaceID(),
 	}
 	n.init()
 	return n
@@ -63,6 +81,11 @@ func (n *Namespace) IsRoot() bool {
 	return n.isRoot
 }
 
+// ID returns the unique ID of n.
+func (n *Namespace) ID() uint64 {
+	return n.id
+}
+
 // RestoreRootStack restores the root network namespace with stack. This should
 // only be called when restoring kernel.
 func (n *Namespace) RestoreRootStack(stack Stack) {
@@ -91,9 +114,24 @@ func (n *Namespace) init() {
 
 // afterLoad is invoked by stateify.
 func (n *Namespace) afterLoad() {
+	// Make sure namespaces created after the restore get new IDs.
+	for {
+		last := atomic.LoadUint64(&lastNamespaceID)
+		if last >= n.id || atomic.CompareAndSwapUint64(&lastNamespaceID, last, n.id) {
+			break
+		}
+	}
 	n.init()
 }
 
+// NamespaceFile is implemented by the files of /proc/[pid]/ns, which can be
+// passed to setns(2) or netlink requests to refer to namespaces.
+type NamespaceFile interface {
+	// NetworkNamespace returns the network namespace represented by the
+	// file, or nil if it represents another kind of namespace.
+	NetworkNamespace() *Namespace
+}
+
 // NetworkStackCreator allows new instances of a network stack to be created. It
 // is used by the kernel to create new network namespaces when requested.
 type NetworkStackCreator interface {
@@ -0,0 +1,74 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePortList parses a list of ports in the format used by Linux's
+// ip_local_reserved_ports sysctl: comma-separated ports and inclusive port
+// ranges, e.g. "8080,9000-9009". An empty list yields no ports.
+func ParsePortList(s string) ([]uint16, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var ports []uint16
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %v", bounds[0], err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid port %q: %v", bounds[1], err)
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid port range %q", r)
+			}
+		}
+		for p := first; p <= last; p++ {
+			ports = append(ports, uint16(p))
+		}
+	}
+	return ports, nil
+}
+
+// FormatPortList formats ports, which must be in increasing order, in the
+// format accepted by ParsePortList, collapsing consecutive ports into ranges.
+func FormatPortList(ports []uint16) string {
+	var b strings.Builder
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && uint32(ports[j+1]) == uint32(ports[j])+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if i == j {
+			fmt.Fprintf(&b, "%d", ports[i])
+		} else {
+			fmt.Fprintf(&b, "%d-%d", ports[i], ports[j])
+		}
+		i = j + 1
+	}
+	return b.String()
+}
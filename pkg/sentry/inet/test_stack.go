@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"fmt"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
@@ -31,8 +34,25 @@ type TestStack struct {
 	TCPRecvBufSize    TCPBufferSize
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
+	AbortOnOverflow   bool
 	Recovery          TCPLossRecovery
 	IPForwarding      bool
+	PortRangeStart    uint16
+	PortRangeEnd      uint16
+	ReservedPorts     []uint16
+	MemoryLimits      map[tcpip.TransportProtocolNumber]TransportMemoryLimits
+	CongestionControl string
+	AvailableCC       []string
+	RecvBufSize       SocketBufferSize
+	SendBufSize       SocketBufferSize
+	MaxConn           int
+	PingGroupLow      auth.KGID
+	PingGroupHigh     auth.KGID
+	IPv4Confs         map[int32]IPv4Conf
+	IPv6Confs         map[int32]IPv6Conf
+	HopLimit          int
+	EchoEnableProbe   bool
+	QDiscsMap         map[int32]QDisc
 }
 
 // NewTestStack returns a TestStack with no network interfaces. The value of
@@ -42,6 +62,10 @@ func NewTestStack() *TestStack {
 	return &TestStack{
 		InterfacesMap:     make(map[int32]Interface),
 		InterfaceAddrsMap: make(map[int32][]InterfaceAddr),
+		MemoryLimits:      make(map[tcpip.TransportProtocolNumber]TransportMemoryLimits),
+		IPv4Confs:         make(map[int32]IPv4Conf),
+		IPv6Confs:         make(map[int32]IPv6Conf),
+		QDiscsMap:         make(map[int32]QDisc),
 	}
 }
 
@@ -79,6 +103,52 @@ func (s *TestStack) RemoveInterfaceAddr(idx int32, addr InterfaceAddr) error {
 	return nil
 }
 
+// CreateVeth implements Stack.CreateVeth.
+func (s *TestStack) CreateVeth(string, Stack, string) error {
+	return syserror.EOPNOTSUPP
+}
+
+// SetInterfaceUp implements Stack.SetInterfaceUp.
+func (s *TestStack) SetInterfaceUp(idx int32, up bool) error {
+	iface, ok := s.InterfacesMap[idx]
+	if !ok {
+		return syserror.ENODEV
+	}
+	if up {
+		iface.Flags |= linux.IFF_UP
+	} else {
+		iface.Flags &^= linux.IFF_UP
+	}
+	s.InterfacesMap[idx] = iface
+	return nil
+}
+
+// MoveInterface implements Stack.MoveInterface.
+func (s *TestStack) MoveInterface(idx int32, to Stack) error {
+	toStack, ok := to.(*TestStack)
+	if !ok {
+		return syserror.EOPNOTSUPP
+	}
+	iface, ok := s.InterfacesMap[idx]
+	if !ok {
+		return syserror.ENODEV
+	}
+	delete(s.InterfacesMap, idx)
+	delete(s.InterfaceAddrsMap, idx)
+	toStack.InterfacesMap[idx] = iface
+	return nil
+}
+
+// RemoveInterface implements Stack.RemoveInterface.
+func (s *TestStack) RemoveInterface(idx int32) error {
+	if _, ok := s.InterfacesMap[idx]; !ok {
+		return syserror.ENODEV
+	}
+	delete(s.InterfacesMap, idx)
+	delete(s.InterfaceAddrsMap, idx)
+	return nil
+}
+
 // SupportsIPv6 implements Stack.SupportsIPv6.
 func (s *TestStack) SupportsIPv6() bool {
 	return s.SupportsIPv6Flag
@@ -117,6 +187,17 @@ func (s *TestStack) SetTCPSACKEnabled(enabled bool) error {
 	return nil
 }
 
+// TCPAbortOnOverflow implements Stack.TCPAbortOnOverflow.
+func (s *TestStack) TCPAbortOnOverflow() (bool, error) {
+	return s.AbortOnOverflow, nil
+}
+
+// SetTCPAbortOnOverflow implements Stack.SetTCPAbortOnOverflow.
+func (s *TestStack) SetTCPAbortOnOverflow(enabled bool) error {
+	s.AbortOnOverflow = enabled
+	return nil
+}
+
 // TCPRecovery implements Stack.TCPRecovery.
 func (s *TestStack) TCPRecovery() (TCPLossRecovery, error) {
 	return s.Recovery, nil
@@ -141,6 +222,12 @@ func (s *TestStack) RouteTable() []Route {
 // Resume implements Stack.Resume.
 func (s *TestStack) Resume() {}
 
+// PauseTimers implements Stack.PauseTimers.
+func (s *TestStack) PauseTimers() {}
+
+// ResumeTimers implements Stack.ResumeTimers.
+func (s *TestStack) ResumeTimers() {}
+
 // RegisteredEndpoints implements inet.Stack.RegisteredEndpoints.
 func (s *TestStack) RegisteredEndpoints() []stack.TransportEndpoint {
 	return nil
@@ -164,3 +251,186 @@ func (s *TestStack) SetForwarding(protocol tcpip.NetworkProtocolNumber, enable b
 	s.IPForwarding = enable
 	return nil
 }
+
+// PortRange implements inet.Stack.PortRange.
+func (s *TestStack) PortRange() (uint16, uint16) {
+	return s.PortRangeStart, s.PortRangeEnd
+}
+
+// SetPortRange implements inet.Stack.SetPortRange.
+func (s *TestStack) SetPortRange(start uint16, end uint16) error {
+	s.PortRangeStart = start
+	s.PortRangeEnd = end
+	return nil
+}
+
+// LocalReservedPorts implements inet.Stack.LocalReservedPorts.
+func (s *TestStack) LocalReservedPorts() []uint16 {
+	return s.ReservedPorts
+}
+
+// SetLocalReservedPorts implements inet.Stack.SetLocalReservedPorts.
+func (s *TestStack) SetLocalReservedPorts(ports []uint16) error {
+	s.ReservedPorts = ports
+	return nil
+}
+
+// TransportMemoryLimits implements inet.Stack.TransportMemoryLimits.
+func (s *TestStack) TransportMemoryLimits(protocol tcpip.TransportProtocolNumber) (TransportMemoryLimits, error) {
+	return s.MemoryLimits[protocol], nil
+}
+
+// SetTransportMemoryLimits implements inet.Stack.SetTransportMemoryLimits.
+func (s *TestStack) SetTransportMemoryLimits(protocol tcpip.TransportProtocolNumber, limits TransportMemoryLimits) error {
+	s.MemoryLimits[protocol] = limits
+	return nil
+}
+
+// TCPCongestionControl implements inet.Stack.TCPCongestionControl.
+func (s *TestStack) TCPCongestionControl() (string, error) {
+	return s.CongestionControl, nil
+}
+
+// SetTCPCongestionControl implements inet.Stack.SetTCPCongestionControl.
+func (s *TestStack) SetTCPCongestionControl(cc string) error {
+	for _, c := range s.AvailableCC {
+		if c == cc {
+			s.CongestionControl = cc
+			return nil
+		}
+	}
+	return syserror.ENOENT
+}
+
+// TCPAvailableCongestionControl implements
+// inet.Stack.TCPAvailableCongestionControl.
+func (s *TestStack) TCPAvailableCongestionControl() ([]string, error) {
+	return s.AvailableCC, nil
+}
+
+// SocketReceiveBufferSize implements inet.Stack.SocketReceiveBufferSize.
+func (s *TestStack) SocketReceiveBufferSize() (SocketBufferSize, error) {
+	return s.RecvBufSize, nil
+}
+
+// SetSocketReceiveBufferSize implements inet.Stack.SetSocketReceiveBufferSize.
+func (s *TestStack) SetSocketReceiveBufferSize(size SocketBufferSize) error {
+	s.RecvBufSize = size
+	return nil
+}
+
+// SocketSendBufferSize implements inet.Stack.SocketSendBufferSize.
+func (s *TestStack) SocketSendBufferSize() (SocketBufferSize, error) {
+	return s.SendBufSize, nil
+}
+
+// SetSocketSendBufferSize implements inet.Stack.SetSocketSendBufferSize.
+func (s *TestStack) SetSocketSendBufferSize(size SocketBufferSize) error {
+	s.SendBufSize = size
+	return nil
+}
+
+// SoMaxConn implements inet.Stack.SoMaxConn.
+func (s *TestStack) SoMaxConn() int {
+	return s.MaxConn
+}
+
+// SetSoMaxConn implements inet.Stack.SetSoMaxConn.
+func (s *TestStack) SetSoMaxConn(n int) error {
+	s.MaxConn = n
+	return nil
+}
+
+// PingGroupRange implements inet.Stack.PingGroupRange.
+func (s *TestStack) PingGroupRange() (auth.KGID, auth.KGID) {
+	return s.PingGroupLow, s.PingGroupHigh
+}
+
+// SetPingGroupRange implements inet.Stack.SetPingGroupRange.
+func (s *TestStack) SetPingGroupRange(low, high auth.KGID) error {
+	s.PingGroupLow = low
+	s.PingGroupHigh = high
+	return nil
+}
+
+// IPv4Conf implements inet.Stack.IPv4Conf.
+func (s *TestStack) IPv4Conf(idx int32) (IPv4Conf, error) {
+	conf, ok := s.IPv4Confs[idx]
+	if !ok {
+		return IPv4Conf{}, syserror.ENODEV
+	}
+	return conf, nil
+}
+
+// SetIPv4Conf implements inet.Stack.SetIPv4Conf.
+func (s *TestStack) SetIPv4Conf(idx int32, conf IPv4Conf) error {
+	if _, ok := s.IPv4Confs[idx]; !ok {
+		return syserror.ENODEV
+	}
+	s.IPv4Confs[idx] = conf
+	return nil
+}
+
+// IPv6Conf implements inet.Stack.IPv6Conf.
+func (s *TestStack) IPv6Conf(idx int32) (IPv6Conf, error) {
+	conf, ok := s.IPv6Confs[idx]
+	if !ok {
+		return IPv6Conf{}, syserror.ENODEV
+	}
+	return conf, nil
+}
+
+// SetIPv6Conf implements inet.Stack.SetIPv6Conf.
+func (s *TestStack) SetIPv6Conf(idx int32, conf IPv6Conf) error {
+	if _, ok := s.IPv6Confs[idx]; !ok {
+		return syserror.ENODEV
+	}
+	s.IPv6Confs[idx] = conf
+	return nil
+}
+
+// IPv6HopLimit implements inet.Stack.IPv6HopLimit.
+func (s *TestStack) IPv6HopLimit() (int, error) {
+	return s.HopLimit, nil
+}
+
+// SetIPv6HopLimit implements inet.Stack.SetIPv6HopLimit.
+func (s *TestStack) SetIPv6HopLimit(hopLimit int) error {
+	s.HopLimit = hopLimit
+	return nil
+}
+
+// ICMPEchoEnableProbe implements Stack.ICMPEchoEnableProbe.
+func (s *TestStack) ICMPEchoEnableProbe() (bool, error) {
+	return s.EchoEnableProbe, nil
+}
+
+// SetICMPEchoEnableProbe implements Stack.SetICMPEchoEnableProbe.
+func (s *TestStack) SetICMPEchoEnableProbe(enabled bool) error {
+	s.EchoEnableProbe = enabled
+	return nil
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+func (s *TestStack) QDiscs() map[int32]QDisc {
+	return s.QDiscsMap
+}
+
+// SetQDisc implements inet.Stack.SetQDisc.
+func (s *TestStack) SetQDisc(idx int32, qdisc QDisc) error {
+	if _, ok := s.QDiscsMap[idx]; !ok {
+		return syserror.ENODEV
+	}
+	qdisc.Stats = QDiscStats{}
+	s.QDiscsMap[idx] = qdisc
+	return nil
+}
+
+// ResetQDisc implements inet.Stack.ResetQDisc.
+func (s *TestStack) ResetQDisc(idx int32) error {
+	if _, ok := s.QDiscsMap[idx]; !ok {
+		return syserror.ENODEV
+	}
+	s.QDiscsMap[idx] = QDisc{Kind: "pfifo", PFIFO: PFIFOParams{Limit: 1000}}
+	return nil
+}
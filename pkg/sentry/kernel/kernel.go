@@ -1138,6 +1138,12 @@ func (k *Kernel) pauseTimeLocked(ctx context.Context) {
 		}
 	}
 	k.timekeeper.PauseUpdates()
+
+	// Network timers must not fire while the network stack is saved, nor
+	// expire because of the time taken to save it.
+	if net := k.rootNetworkNamespace.Stack(); net != nil {
+		net.PauseTimers()
+	}
 }
 
 // resumeTimeLocked resumes all Timers and Timekeeper updates. If
@@ -1152,6 +1158,10 @@ func (k *Kernel) resumeTimeLocked(ctx context.Context) {
 		k.cpuClockTicker.Resume()
 	}
 
+	if net := k.rootNetworkNamespace.Stack(); net != nil {
+		net.ResumeTimers()
+	}
+
 	k.timekeeper.ResumeUpdates()
 	for t := range k.tasks.Root.tids {
 		if t == t.tg.leader {
@@ -1510,6 +1520,11 @@ func (k *Kernel) NowNanoseconds() int64 {
 	return now
 }
 
+// Now implements tcpip.Clock.Now.
+func (k *Kernel) Now() time.Time {
+	return time.Unix(0, k.NowNanoseconds())
+}
+
 // NowMonotonic implements tcpip.Clock.NowMonotonic.
 func (k *Kernel) NowMonotonic() int64 {
 	now, err := k.timekeeper.GetTime(sentrytime.Monotonic)
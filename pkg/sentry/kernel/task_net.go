@@ -42,3 +42,13 @@ func (t *Task) NetworkNamespace() *inet.Namespace {
 	defer t.mu.Unlock()
 	return t.netns
 }
+
+// SetNetworkNamespace makes t observe the network namespace ns, as with
+// setns(2).
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) SetNetworkNamespace(ns *inet.Namespace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.netns = ns
+}
@@ -343,6 +343,39 @@ func PackTClass(t *kernel.Task, tClass uint32, buf []byte) []byte {
 	)
 }
 
+// PackTTL packs an IP_TTL socket control message.
+func PackTTL(t *kernel.Task, ttl uint8, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_IP,
+		linux.IP_TTL,
+		t.Arch().Width(),
+		int32(ttl),
+	)
+}
+
+// PackHopLimit packs an IPV6_HOPLIMIT socket control message.
+func PackHopLimit(t *kernel.Task, hopLimit uint8, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_IPV6,
+		linux.IPV6_HOPLIMIT,
+		t.Arch().Width(),
+		int32(hopLimit),
+	)
+}
+
+// PackIPOptions packs an IP_RECVOPTS socket control message.
+func PackIPOptions(t *kernel.Task, options []byte, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_IP,
+		linux.IP_RECVOPTS,
+		t.Arch().Width(),
+		options,
+	)
+}
+
 // PackIPPacketInfo packs an IP_PKTINFO socket control message.
 func PackIPPacketInfo(t *kernel.Task, packetInfo tcpip.IPPacketInfo, buf []byte) []byte {
 	var p linux.ControlMessageIPPacketInfo
@@ -359,6 +392,27 @@ func PackIPPacketInfo(t *kernel.Task, packetInfo tcpip.IPPacketInfo, buf []byte)
 	)
 }
 
+// NewIPv6PathMTU returns the ip6_mtuinfo struct of pathMTU.
+func NewIPv6PathMTU(pathMTU tcpip.PathMTUInfo) linux.ControlMessageIPv6PathMTU {
+	var p linux.ControlMessageIPv6PathMTU
+	p.Addr.Family = linux.AF_INET6
+	p.Addr.Scope_id = uint32(pathMTU.Addr.NIC)
+	copy(p.Addr.Addr[:], []byte(pathMTU.Addr.Addr))
+	p.MTU = pathMTU.MTU
+	return p
+}
+
+// PackIPv6PathMTU packs an IPV6_PATHMTU socket control message.
+func PackIPv6PathMTU(t *kernel.Task, pathMTU tcpip.PathMTUInfo, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_IPV6,
+		linux.IPV6_PATHMTU,
+		t.Arch().Width(),
+		NewIPv6PathMTU(pathMTU),
+	)
+}
+
 // PackControlMessages packs control messages into the given buffer.
 //
 // We skip control messages specific to Unix domain sockets.
@@ -383,10 +437,26 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackTClass(t, cmsgs.IP.TClass, buf)
 	}
 
+	if cmsgs.IP.HasTTL {
+		buf = PackTTL(t, cmsgs.IP.TTL, buf)
+	}
+
+	if cmsgs.IP.HasHopLimit {
+		buf = PackHopLimit(t, cmsgs.IP.HopLimit, buf)
+	}
+
+	if cmsgs.IP.HasIPOptions {
+		buf = PackIPOptions(t, cmsgs.IP.IPOptions, buf)
+	}
+
 	if cmsgs.IP.HasIPPacketInfo {
 		buf = PackIPPacketInfo(t, cmsgs.IP.PacketInfo, buf)
 	}
 
+	if cmsgs.IP.HasIPv6PathMTU {
+		buf = PackIPv6PathMTU(t, cmsgs.IP.IPv6PathMTU, buf)
+	}
+
 	return buf
 }
 
@@ -416,6 +486,22 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, linux.SizeOfControlMessageTClass)
 	}
 
+	if cmsgs.IP.HasTTL {
+		space += cmsgSpace(t, linux.SizeOfControlMessageTTL)
+	}
+
+	if cmsgs.IP.HasHopLimit {
+		space += cmsgSpace(t, linux.SizeOfControlMessageHopLimit)
+	}
+
+	if cmsgs.IP.HasIPOptions {
+		space += cmsgSpace(t, len(cmsgs.IP.IPOptions))
+	}
+
+	if cmsgs.IP.HasIPv6PathMTU {
+		space += cmsgSpace(t, linux.SizeOfControlMessageIPv6PathMTU)
+	}
+
 	return space
 }
 
@@ -503,6 +589,18 @@ func Parse(t *kernel.Task, socketOrEndpoint interface{}, buf []byte) (socket.Con
 				binary.Unmarshal(buf[i:i+linux.SizeOfControlMessageTOS], usermem.ByteOrder, &cmsgs.IP.TOS)
 				i += binary.AlignUp(length, width)
 
+			case linux.IP_TTL:
+				if length < linux.SizeOfControlMessageTTL {
+					return socket.ControlMessages{}, syserror.EINVAL
+				}
+				ttl := int32(usermem.ByteOrder.Uint32(buf[i : i+linux.SizeOfControlMessageTTL]))
+				if ttl < 1 || ttl > 255 {
+					return socket.ControlMessages{}, syserror.EINVAL
+				}
+				cmsgs.IP.HasTTL = true
+				cmsgs.IP.TTL = uint8(ttl)
+				i += binary.AlignUp(length, width)
+
 			case linux.IP_PKTINFO:
 				if length < linux.SizeOfControlMessageIPPacketInfo {
 					return socket.ControlMessages{}, syserror.EINVAL
@@ -524,8 +622,30 @@ func Parse(t *kernel.Task, socketOrEndpoint interface{}, buf []byte) (socket.Con
 				if length < linux.SizeOfControlMessageTClass {
 					return socket.ControlMessages{}, syserror.EINVAL
 				}
-				cmsgs.IP.HasTClass = true
-				binary.Unmarshal(buf[i:i+linux.SizeOfControlMessageTClass], usermem.ByteOrder, &cmsgs.IP.TClass)
+				tClass := int32(usermem.ByteOrder.Uint32(buf[i : i+linux.SizeOfControlMessageTClass]))
+				if tClass < -1 || tClass > 255 {
+					return socket.ControlMessages{}, syserror.EINVAL
+				}
+				// -1 stands for the traffic class of the socket.
+				if tClass != -1 {
+					cmsgs.IP.HasTClass = true
+					cmsgs.IP.TClass = uint32(tClass)
+				}
+				i += binary.AlignUp(length, width)
+
+			case linux.IPV6_HOPLIMIT:
+				if length < linux.SizeOfControlMessageHopLimit {
+					return socket.ControlMessages{}, syserror.EINVAL
+				}
+				hopLimit := int32(usermem.ByteOrder.Uint32(buf[i : i+linux.SizeOfControlMessageHopLimit]))
+				if hopLimit < -1 || hopLimit > 255 {
+					return socket.ControlMessages{}, syserror.EINVAL
+				}
+				// -1 stands for the hop limit of the socket.
+				if hopLimit != -1 {
+					cmsgs.IP.HasHopLimit = true
+					cmsgs.IP.HopLimit = uint8(hopLimit)
+				}
 				i += binary.AlignUp(length, width)
 
 			default:
@@ -0,0 +1,114 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"sync/atomic"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// LINT.IfChange
+
+// rawSocketProtocols maps the families of raw IP and packet sockets to the
+// protocols they can be created with. Unlike for TCP and UDP sockets, the
+// protocol is passed to the host since it selects the packets received, so
+// the syscall filters must allow exactly these.
+var rawSocketProtocols = map[int][]int{
+	syscall.AF_INET:   {syscall.IPPROTO_ICMP, syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_RAW},
+	syscall.AF_INET6:  {syscall.IPPROTO_ICMPV6, syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_RAW},
+	syscall.AF_PACKET: {0, int(socket.Htons(syscall.ETH_P_ALL)), int(socket.Htons(syscall.ETH_P_IP)), int(socket.Htons(syscall.ETH_P_ARP)), int(socket.Htons(syscall.ETH_P_IPV6))},
+}
+
+// LINT.ThenChange(../../../../runsc/boot/filter/config.go)
+
+// isRawSocket returns true if a socket of type stype in family is a raw IP or
+// packet socket.
+func isRawSocket(family int, stype linux.SockType) bool {
+	return family == syscall.AF_PACKET || stype == syscall.SOCK_RAW
+}
+
+// rawSocketSupported returns true if hostinet can create a raw IP or packet
+// socket of type stype in family with protocol.
+func rawSocketSupported(family int, stype linux.SockType, protocol int) bool {
+	switch family {
+	case syscall.AF_INET, syscall.AF_INET6:
+		if stype != syscall.SOCK_RAW {
+			return false
+		}
+	case syscall.AF_PACKET:
+		if stype != syscall.SOCK_RAW && stype != syscall.SOCK_DGRAM {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, p := range rawSocketProtocols[family] {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableRawSockets allows applications to have up to max raw IP and packet
+// sockets backed by host sockets open at once. It must be called before the
+// stack is used.
+func (s *Stack) EnableRawSockets(max int32) {
+	s.maxRawSockets = max
+}
+
+// rawSocket creates a host raw IP or packet socket of type stype in family on
+// behalf of t. ok is false if such sockets are disabled or unsupported, in
+// which case other providers may handle the request.
+func (s *Stack) rawSocket(t *kernel.Task, family int, stype linux.SockType, protocol int) (fd int, ok bool, err *syserr.Error) {
+	if s.maxRawSockets == 0 || !rawSocketSupported(family, stype, protocol) {
+		return -1, false, nil
+	}
+
+	// Raw and packet sockets require CAP_NET_RAW.
+	if !t.HasCapability(linux.CAP_NET_RAW) {
+		return -1, true, syserr.ErrNotPermitted
+	}
+
+	if err := s.acquireRawSocket(); err != nil {
+		return -1, true, err
+	}
+	fd, e := syscall.Socket(family, int(stype)|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, protocol)
+	if e != nil {
+		s.releaseRawSocket()
+		return -1, true, syserr.FromError(e)
+	}
+	return fd, true, nil
+}
+
+// acquireRawSocket accounts for a raw IP or packet socket being opened. It
+// returns ErrNoBufferSpace if the maximum number of such sockets are open.
+func (s *Stack) acquireRawSocket() *syserr.Error {
+	if atomic.AddInt32(&s.rawSockets, 1) > s.maxRawSockets {
+		s.releaseRawSocket()
+		return syserr.ErrNoBufferSpace
+	}
+	return nil
+}
+
+// releaseRawSocket accounts for a raw IP or packet socket being closed.
+func (s *Stack) releaseRawSocket() {
+	atomic.AddInt32(&s.rawSockets, -1)
+}
@@ -83,6 +83,10 @@ type socketOpsCommon struct {
 	// will return EWOULDBLOCK instead of blocking on the host. This allows us to
 	// handle blocking behavior independently in the sentry.
 	fd int
+
+	// rawStack is the stack the socket is accounted to if it is a raw IP or
+	// packet socket, nil otherwise.
+	rawStack *Stack `state:"nosave"`
 }
 
 var _ = socket.Socket(&socketOperations{})
@@ -108,6 +112,9 @@ func newSocketFile(ctx context.Context, family int, stype linux.SockType, protoc
 func (s *socketOpsCommon) Release(context.Context) {
 	fdnotifier.RemoveFD(int32(s.fd))
 	syscall.Close(s.fd)
+	if s.rawStack != nil {
+		s.rawStack.releaseRawSocket()
+	}
 }
 
 // Readiness implements waiter.Waitable.Readiness.
@@ -331,12 +338,12 @@ func (s *socketOpsCommon) GetSockOpt(t *kernel.Task, level int, name int, outPtr
 	switch level {
 	case linux.SOL_IP:
 		switch name {
-		case linux.IP_TOS, linux.IP_RECVTOS, linux.IP_PKTINFO:
+		case linux.IP_TOS, linux.IP_RECVTOS, linux.IP_RECVTTL, linux.IP_PKTINFO:
 			optlen = sizeofInt32
 		}
 	case linux.SOL_IPV6:
 		switch name {
-		case linux.IPV6_TCLASS, linux.IPV6_RECVTCLASS, linux.IPV6_V6ONLY:
+		case linux.IPV6_TCLASS, linux.IPV6_RECVTCLASS, linux.IPV6_RECVHOPLIMIT, linux.IPV6_V6ONLY:
 			optlen = sizeofInt32
 		}
 	case linux.SOL_SOCKET:
@@ -377,14 +384,14 @@ func (s *socketOpsCommon) SetSockOpt(t *kernel.Task, level int, name int, opt []
 	switch level {
 	case linux.SOL_IP:
 		switch name {
-		case linux.IP_TOS, linux.IP_RECVTOS:
+		case linux.IP_TOS, linux.IP_RECVTOS, linux.IP_RECVTTL:
 			optlen = sizeofInt32
 		case linux.IP_PKTINFO:
 			optlen = linux.SizeOfControlMessageIPPacketInfo
 		}
 	case linux.SOL_IPV6:
 		switch name {
-		case linux.IPV6_TCLASS, linux.IPV6_RECVTCLASS, linux.IPV6_V6ONLY:
+		case linux.IPV6_TCLASS, linux.IPV6_RECVTCLASS, linux.IPV6_RECVHOPLIMIT, linux.IPV6_V6ONLY:
 			optlen = sizeofInt32
 		}
 	case linux.SOL_SOCKET:
@@ -519,6 +526,10 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 				controlMessages.IP.HasTOS = true
 				binary.Unmarshal(unixCmsg.Data[:linux.SizeOfControlMessageTOS], usermem.ByteOrder, &controlMessages.IP.TOS)
 
+			case syscall.IP_TTL:
+				controlMessages.IP.HasTTL = true
+				controlMessages.IP.TTL = uint8(usermem.ByteOrder.Uint32(unixCmsg.Data[:linux.SizeOfControlMessageTTL]))
+
 			case syscall.IP_PKTINFO:
 				controlMessages.IP.HasIPPacketInfo = true
 				var packetInfo linux.ControlMessageIPPacketInfo
@@ -531,6 +542,10 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 			case syscall.IPV6_TCLASS:
 				controlMessages.IP.HasTClass = true
 				binary.Unmarshal(unixCmsg.Data[:linux.SizeOfControlMessageTClass], usermem.ByteOrder, &controlMessages.IP.TClass)
+
+			case syscall.IPV6_HOPLIMIT:
+				controlMessages.IP.HasHopLimit = true
+				controlMessages.IP.HopLimit = uint8(usermem.ByteOrder.Uint32(unixCmsg.Data[:linux.SizeOfControlMessageHopLimit]))
 			}
 		}
 	}
@@ -665,12 +680,27 @@ func (p *socketProvider) Socket(t *kernel.Task, stypeflags linux.SockType, proto
 	if stack == nil {
 		return nil, nil
 	}
-	if _, ok := stack.(*Stack); !ok {
+	hostStack, ok := stack.(*Stack)
+	if !ok {
 		return nil, nil
 	}
 
-	// Only accept TCP and UDP.
 	stype := stypeflags & linux.SOCK_TYPE_MASK
+	if isRawSocket(p.family, stype) {
+		fd, ok, err := hostStack.rawSocket(t, p.family, stype, protocol)
+		if !ok || err != nil {
+			return nil, err
+		}
+		f, err := newSocketFile(t, p.family, stype, protocol, fd, stypeflags&syscall.SOCK_NONBLOCK != 0)
+		if err != nil {
+			hostStack.releaseRawSocket()
+			return nil, err
+		}
+		f.FileOperations.(*socketOperations).rawStack = hostStack
+		return f, nil
+	}
+
+	// Otherwise only accept TCP and UDP.
 	switch stype {
 	case syscall.SOCK_STREAM:
 		switch protocol {
@@ -702,14 +732,14 @@ func (p *socketProvider) Socket(t *kernel.Task, stypeflags linux.SockType, proto
 
 // Pair implements socket.Provider.Pair.
 func (p *socketProvider) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*fs.File, *fs.File, *syserr.Error) {
-	// Not supported by AF_INET/AF_INET6.
+	// Not supported by AF_INET/AF_INET6/AF_PACKET.
 	return nil, nil, nil
 }
 
 // LINT.ThenChange(./socket_vfs2.go)
 
 func init() {
-	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6, syscall.AF_PACKET} {
 		socket.RegisterProvider(family, &socketProvider{family})
 		socket.RegisterProviderVFS2(family, &socketProviderVFS2{family})
 	}
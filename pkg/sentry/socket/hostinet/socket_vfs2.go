@@ -165,12 +165,27 @@ func (p *socketProviderVFS2) Socket(t *kernel.Task, stypeflags linux.SockType, p
 	if stack == nil {
 		return nil, nil
 	}
-	if _, ok := stack.(*Stack); !ok {
+	hostStack, ok := stack.(*Stack)
+	if !ok {
 		return nil, nil
 	}
 
-	// Only accept TCP and UDP.
 	stype := stypeflags & linux.SOCK_TYPE_MASK
+	if isRawSocket(p.family, stype) {
+		fd, ok, err := hostStack.rawSocket(t, p.family, stype, protocol)
+		if !ok || err != nil {
+			return nil, err
+		}
+		f, err := newVFS2Socket(t, p.family, stype, protocol, fd, uint32(stypeflags&syscall.SOCK_NONBLOCK))
+		if err != nil {
+			hostStack.releaseRawSocket()
+			return nil, err
+		}
+		f.Impl().(*socketVFS2).rawStack = hostStack
+		return f, nil
+	}
+
+	// Otherwise only accept TCP and UDP.
 	switch stype {
 	case syscall.SOCK_STREAM:
 		switch protocol {
@@ -202,6 +217,6 @@ func (p *socketProviderVFS2) Socket(t *kernel.Task, stypeflags linux.SockType, p
 
 // Pair implements socket.Provider.Pair.
 func (p *socketProviderVFS2) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.FileDescription, *vfs.FileDescription, *syserr.Error) {
-	// Not supported by AF_INET/AF_INET6.
+	// Not supported by AF_INET/AF_INET6/AF_PACKET.
 	return nil, nil, nil
 }
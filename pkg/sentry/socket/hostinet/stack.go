@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"reflect"
 	"strconv"
@@ -28,9 +29,11 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -49,21 +52,58 @@ var defaultSendBufSize = inet.TCPBufferSize{
 	Max:     4194304,
 }
 
+// Linux's default {r,w}mem_default and {r,w}mem_max, used if the host's values
+// can't be read.
+var defaultSocketBufSize = inet.SocketBufferSize{
+	Default: 212992,
+	Max:     212992,
+}
+
+// Linux's default ip_local_port_range, used if the host's value can't be read.
+const (
+	defaultPortRangeStart = 32768
+	defaultPortRangeEnd   = 60999
+)
+
 // Stack implements inet.Stack for host sockets.
 type Stack struct {
-	// Stack is immutable.
-	interfaces     map[int32]inet.Interface
-	interfaceAddrs map[int32][]inet.InterfaceAddr
-	routes         []inet.Route
-	supportsIPv6   bool
-	tcpRecovery    inet.TCPLossRecovery
-	tcpRecvBufSize inet.TCPBufferSize
-	tcpSendBufSize inet.TCPBufferSize
-	tcpSACKEnabled bool
-	netDevFile     *os.File
-	netSNMPFile    *os.File
-	ipv4Forwarding bool
-	ipv6Forwarding bool
+	// Stack is immutable, except for rawSockets.
+	interfaces         map[int32]inet.Interface
+	interfaceAddrs     map[int32][]inet.InterfaceAddr
+	routes             []inet.Route
+	supportsIPv6       bool
+	tcpRecovery        inet.TCPLossRecovery
+	tcpRecvBufSize     inet.TCPBufferSize
+	tcpSendBufSize     inet.TCPBufferSize
+	tcpSACKEnabled     bool
+	tcpAbortOnOverflow bool
+	netDevFile         *os.File
+	netSNMPFile        *os.File
+	ipv4Forwarding     bool
+	ipv6Forwarding     bool
+	portRangeStart     uint16
+	portRangeEnd       uint16
+	reservedPorts      []uint16
+	memoryLimits       map[tcpip.TransportProtocolNumber]inet.TransportMemoryLimits
+	tcpCC              string
+	tcpAvailableCC     []string
+	sockRecvBuf        inet.SocketBufferSize
+	sockSendBuf        inet.SocketBufferSize
+	soMaxConn          int
+	pingGroupLow       auth.KGID
+	pingGroupHigh      auth.KGID
+	ipv4Confs          map[int32]inet.IPv4Conf
+	ipv6Confs          map[int32]inet.IPv6Conf
+	ipv6HopLimit       int
+	echoEnableProbe    bool
+
+	// maxRawSockets is the maximum number of raw IP and packet sockets that
+	// may be open at once. Zero disables them.
+	maxRawSockets int32
+
+	// rawSockets is the number of open raw IP and packet sockets. It is
+	// accessed atomically.
+	rawSockets int32
 }
 
 // NewStack returns an empty Stack containing no configuration.
@@ -102,6 +142,57 @@ func (s *Stack) Configure() error {
 		log.Warningf("Failed to read TCP send buffer size, using default values")
 	}
 
+	s.memoryLimits = make(map[tcpip.TransportProtocolNumber]inet.TransportMemoryLimits)
+	for protocol, filename := range map[tcpip.TransportProtocolNumber]string{
+		header.TCPProtocolNumber: "/proc/sys/net/ipv4/tcp_mem",
+		header.UDPProtocolNumber: "/proc/sys/net/ipv4/udp_mem",
+	} {
+		if limits, err := readTransportMemoryLimitsFile(filename); err == nil {
+			s.memoryLimits[protocol] = limits
+		} else {
+			log.Warningf("Failed to read transport memory limits: %v", err)
+		}
+	}
+
+	s.tcpCC = "cubic"
+	if cc, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_congestion_control"); err == nil {
+		s.tcpCC = strings.TrimSpace(string(cc))
+	} else {
+		log.Warningf("Failed to read TCP congestion control, assuming %s", s.tcpCC)
+	}
+	s.tcpAvailableCC = []string{s.tcpCC}
+	if available, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control"); err == nil {
+		s.tcpAvailableCC = strings.Fields(string(available))
+	} else {
+		log.Warningf("Failed to read available TCP congestion control, assuming %v", s.tcpAvailableCC)
+	}
+
+	s.sockRecvBuf = readSocketBufferSize("/proc/sys/net/core/rmem_default", "/proc/sys/net/core/rmem_max")
+	s.sockSendBuf = readSocketBufferSize("/proc/sys/net/core/wmem_default", "/proc/sys/net/core/wmem_max")
+
+	s.soMaxConn = inet.DefaultSoMaxConn
+	somaxconn := make([]int32, 1)
+	if err := readInt32sFile("/proc/sys/net/core/somaxconn", somaxconn); err == nil {
+		// The backlog also bounds the accept queues of sentry sockets, so
+		// bound it as netstack does.
+		s.soMaxConn = int(somaxconn[0])
+		if s.soMaxConn > math.MaxUint16 {
+			s.soMaxConn = math.MaxUint16
+		}
+	} else {
+		log.Warningf("Failed to read somaxconn, using default value: %v", err)
+	}
+
+	// If ping_group_range can't be read, assume Linux's default of no
+	// groups.
+	s.pingGroupLow, s.pingGroupHigh = 1, 0
+	pingGroupRange := make([]int32, 2)
+	if err := readInt32sFile("/proc/sys/net/ipv4/ping_group_range", pingGroupRange); err == nil {
+		s.pingGroupLow, s.pingGroupHigh = auth.KGID(pingGroupRange[0]), auth.KGID(pingGroupRange[1])
+	} else {
+		log.Warningf("Failed to read ping_group_range, assuming none: %v", err)
+	}
+
 	// SACK is important for performance and even compatibility, assume it's
 	// enabled if we can't find the actual value.
 	s.tcpSACKEnabled = true
@@ -111,6 +202,12 @@ func (s *Stack) Configure() error {
 		log.Warningf("Failed to read if TCP SACK if enabled, setting to true")
 	}
 
+	if abort, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_abort_on_overflow"); err == nil {
+		s.tcpAbortOnOverflow = strings.TrimSpace(string(abort)) != "0"
+	} else {
+		log.Warningf("Failed to read tcp_abort_on_overflow, assuming disabled: %v", err)
+	}
+
 	if f, err := os.Open("/proc/net/dev"); err != nil {
 		log.Warningf("Failed to open /proc/net/dev: %v", err)
 	} else {
@@ -123,6 +220,38 @@ func (s *Stack) Configure() error {
 		s.netSNMPFile = f
 	}
 
+	s.ipv4Confs = make(map[int32]inet.IPv4Conf)
+	for idx, iface := range s.interfaces {
+		if conf, err := readIPv4Conf(iface.Name); err == nil {
+			s.ipv4Confs[idx] = conf
+		} else {
+			log.Warningf("Failed to read IPv4 settings of interface %q: %v", iface.Name, err)
+		}
+	}
+
+	s.ipv6Confs = make(map[int32]inet.IPv6Conf)
+	for idx, iface := range s.interfaces {
+		if conf, err := readIPv6Conf(iface.Name); err == nil {
+			s.ipv6Confs[idx] = conf
+		} else {
+			log.Warningf("Failed to read IPv6 settings of interface %q: %v", iface.Name, err)
+		}
+	}
+
+	s.ipv6HopLimit = 64
+	hopLimit := make([]int32, 1)
+	if err := readInt32sFile("/proc/sys/net/ipv6/conf/default/hop_limit", hopLimit); err == nil {
+		s.ipv6HopLimit = int(hopLimit[0])
+	} else {
+		log.Warningf("Failed to read IPv6 hop limit, using default value: %v", err)
+	}
+
+	if probe, err := ioutil.ReadFile("/proc/sys/net/ipv4/icmp_echo_enable_probe"); err == nil {
+		s.echoEnableProbe = strings.TrimSpace(string(probe)) != "0"
+	} else {
+		log.Warningf("Failed to read icmp_echo_enable_probe, assuming disabled: %v", err)
+	}
+
 	s.ipv6Forwarding = false
 	if ipForwarding, err := ioutil.ReadFile("/proc/sys/net/ipv6/conf/all/forwarding"); err == nil {
 		s.ipv6Forwarding = strings.TrimSpace(string(ipForwarding)) != "0"
@@ -130,9 +259,48 @@ func (s *Stack) Configure() error {
 		log.Warningf("Failed to read if ipv6 forwarding is enabled, setting to false")
 	}
 
+	s.portRangeStart, s.portRangeEnd = defaultPortRangeStart, defaultPortRangeEnd
+	if start, end, err := readPortRangeFile("/proc/sys/net/ipv4/ip_local_port_range"); err == nil {
+		s.portRangeStart, s.portRangeEnd = start, end
+	} else {
+		log.Warningf("Failed to read local port range, using default values")
+	}
+
+	if contents, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_local_reserved_ports"); err == nil {
+		if ports, err := inet.ParsePortList(string(contents)); err == nil {
+			s.reservedPorts = ports
+		} else {
+			log.Warningf("Failed to parse local reserved ports %q: %v", contents, err)
+		}
+	} else {
+		log.Warningf("Failed to read local reserved ports, assuming none are reserved")
+	}
+
 	return nil
 }
 
+// readPortRangeFile reads an ip_local_port_range file and returns its
+// inclusive bounds.
+func readPortRangeFile(filename string) (uint16, uint16, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read %s: %v", filename, err)
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected format in %s: %q", filename, contents)
+	}
+	start, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse %s field 0: %v", filename, err)
+	}
+	end, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse %s field 1: %v", filename, err)
+	}
+	return uint16(start), uint16(end), nil
+}
+
 // ExtractHostInterfaces will populate an interface map and
 // interfaceAddrs map with the results of the equivalent
 // netlink messages.
@@ -289,14 +457,9 @@ func doNetlinkRouteRequest(req int) ([]syscall.NetlinkMessage, error) {
 }
 
 func readTCPBufferSizeFile(filename string) (inet.TCPBufferSize, error) {
-	contents, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return inet.TCPBufferSize{}, fmt.Errorf("failed to read %s: %v", filename, err)
-	}
-	ioseq := usermem.BytesIOSequence(contents)
 	fields := make([]int32, 3)
-	if n, err := usermem.CopyInt32StringsInVec(context.Background(), ioseq.IO, ioseq.Addrs, fields, ioseq.Opts); n != ioseq.NumBytes() || err != nil {
-		return inet.TCPBufferSize{}, fmt.Errorf("failed to parse %s (%q): got %v after %d/%d bytes", filename, contents, err, n, ioseq.NumBytes())
+	if err := readInt32sFile(filename, fields); err != nil {
+		return inet.TCPBufferSize{}, err
 	}
 	return inet.TCPBufferSize{
 		Min:     int(fields[0]),
@@ -305,6 +468,87 @@ func readTCPBufferSizeFile(filename string) (inet.TCPBufferSize, error) {
 	}, nil
 }
 
+func readTransportMemoryLimitsFile(filename string) (inet.TransportMemoryLimits, error) {
+	fields := make([]int32, 3)
+	if err := readInt32sFile(filename, fields); err != nil {
+		return inet.TransportMemoryLimits{}, err
+	}
+	return inet.TransportMemoryLimits{
+		Min:      int(fields[0]),
+		Pressure: int(fields[1]),
+		Max:      int(fields[2]),
+	}, nil
+}
+
+// readIPv4Conf reads the IPv4 settings of the host interface name.
+func readIPv4Conf(name string) (inet.IPv4Conf, error) {
+	// The settings are, in order, arp_ignore, arp_announce, arp_filter and
+	// log_martians.
+	var fields [4]int32
+	for i, setting := range []string{"arp_ignore", "arp_announce", "arp_filter", "log_martians"} {
+		if err := readInt32sFile(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/%s", name, setting), fields[i:i+1]); err != nil {
+			return inet.IPv4Conf{}, err
+		}
+	}
+	return inet.IPv4Conf{
+		ARPIgnore:   int(fields[0]),
+		ARPAnnounce: int(fields[1]),
+		ARPFilter:   fields[2] > 0,
+		LogMartians: fields[3] > 0,
+	}, nil
+}
+
+// readIPv6Conf reads the IPv6 settings of the host interface name.
+func readIPv6Conf(name string) (inet.IPv6Conf, error) {
+	// The settings are, in order, accept_ra, autoconf, dad_transmits,
+	// use_tempaddr and mtu.
+	var fields [5]int32
+	for i, setting := range []string{"accept_ra", "autoconf", "dad_transmits", "use_tempaddr", "mtu"} {
+		if err := readInt32sFile(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/%s", name, setting), fields[i:i+1]); err != nil {
+			return inet.IPv6Conf{}, err
+		}
+	}
+	return inet.IPv6Conf{
+		AcceptRA:     fields[0] > 0,
+		Autoconf:     fields[1] > 0,
+		DADTransmits: int(fields[2]),
+		UseTempAddr:  fields[3] > 0,
+		MTU:          uint32(fields[4]),
+	}, nil
+}
+
+// readSocketBufferSize reads socket buffer size settings from the given
+// {r,w}mem_default and {r,w}mem_max files.
+func readSocketBufferSize(defaultFile, maxFile string) inet.SocketBufferSize {
+	fields := make([]int32, 2)
+	if err := readInt32sFile(defaultFile, fields[:1]); err != nil {
+		log.Warningf("Failed to read socket buffer size, using default values: %v", err)
+		return defaultSocketBufSize
+	}
+	if err := readInt32sFile(maxFile, fields[1:]); err != nil {
+		log.Warningf("Failed to read socket buffer size, using default values: %v", err)
+		return defaultSocketBufSize
+	}
+	return inet.SocketBufferSize{
+		Default: int(fields[0]),
+		Max:     int(fields[1]),
+	}
+}
+
+// readInt32sFile reads len(fields) whitespace separated integers from
+// filename into fields.
+func readInt32sFile(filename string, fields []int32) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", filename, err)
+	}
+	ioseq := usermem.BytesIOSequence(contents)
+	if n, err := usermem.CopyInt32StringsInVec(context.Background(), ioseq.IO, ioseq.Addrs, fields, ioseq.Opts); n != ioseq.NumBytes() || err != nil {
+		return fmt.Errorf("failed to parse %s (%q): got %v after %d/%d bytes", filename, contents, err, n, ioseq.NumBytes())
+	}
+	return nil
+}
+
 // Interfaces implements inet.Stack.Interfaces.
 func (s *Stack) Interfaces() map[int32]inet.Interface {
 	interfaces := make(map[int32]inet.Interface)
@@ -333,6 +577,26 @@ func (s *Stack) RemoveInterfaceAddr(int32, inet.InterfaceAddr) error {
 	return syserror.EACCES
 }
 
+// CreateVeth implements inet.Stack.CreateVeth.
+func (s *Stack) CreateVeth(string, inet.Stack, string) error {
+	return syserror.EOPNOTSUPP
+}
+
+// SetInterfaceUp implements inet.Stack.SetInterfaceUp.
+func (s *Stack) SetInterfaceUp(int32, bool) error {
+	return syserror.EACCES
+}
+
+// MoveInterface implements inet.Stack.MoveInterface.
+func (s *Stack) MoveInterface(int32, inet.Stack) error {
+	return syserror.EACCES
+}
+
+// RemoveInterface implements inet.Stack.RemoveInterface.
+func (s *Stack) RemoveInterface(int32) error {
+	return syserror.EACCES
+}
+
 // SupportsIPv6 implements inet.Stack.SupportsIPv6.
 func (s *Stack) SupportsIPv6() bool {
 	return s.supportsIPv6
@@ -368,6 +632,16 @@ func (s *Stack) SetTCPSACKEnabled(bool) error {
 	return syserror.EACCES
 }
 
+// TCPAbortOnOverflow implements inet.Stack.TCPAbortOnOverflow.
+func (s *Stack) TCPAbortOnOverflow() (bool, error) {
+	return s.tcpAbortOnOverflow, nil
+}
+
+// SetTCPAbortOnOverflow implements inet.Stack.SetTCPAbortOnOverflow.
+func (s *Stack) SetTCPAbortOnOverflow(bool) error {
+	return syserror.EACCES
+}
+
 // TCPRecovery implements inet.Stack.TCPRecovery.
 func (s *Stack) TCPRecovery() (inet.TCPLossRecovery, error) {
 	return s.tcpRecovery, nil
@@ -378,6 +652,126 @@ func (s *Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return syserror.EACCES
 }
 
+// TCPCongestionControl implements inet.Stack.TCPCongestionControl.
+func (s *Stack) TCPCongestionControl() (string, error) {
+	return s.tcpCC, nil
+}
+
+// SetTCPCongestionControl implements inet.Stack.SetTCPCongestionControl.
+func (s *Stack) SetTCPCongestionControl(string) error {
+	return syserror.EACCES
+}
+
+// TCPAvailableCongestionControl implements
+// inet.Stack.TCPAvailableCongestionControl.
+func (s *Stack) TCPAvailableCongestionControl() ([]string, error) {
+	return append([]string(nil), s.tcpAvailableCC...), nil
+}
+
+// SocketReceiveBufferSize implements inet.Stack.SocketReceiveBufferSize.
+func (s *Stack) SocketReceiveBufferSize() (inet.SocketBufferSize, error) {
+	return s.sockRecvBuf, nil
+}
+
+// SetSocketReceiveBufferSize implements inet.Stack.SetSocketReceiveBufferSize.
+func (s *Stack) SetSocketReceiveBufferSize(inet.SocketBufferSize) error {
+	return syserror.EACCES
+}
+
+// SocketSendBufferSize implements inet.Stack.SocketSendBufferSize.
+func (s *Stack) SocketSendBufferSize() (inet.SocketBufferSize, error) {
+	return s.sockSendBuf, nil
+}
+
+// SetSocketSendBufferSize implements inet.Stack.SetSocketSendBufferSize.
+func (s *Stack) SetSocketSendBufferSize(inet.SocketBufferSize) error {
+	return syserror.EACCES
+}
+
+// SoMaxConn implements inet.Stack.SoMaxConn.
+func (s *Stack) SoMaxConn() int {
+	return s.soMaxConn
+}
+
+// SetSoMaxConn implements inet.Stack.SetSoMaxConn.
+func (s *Stack) SetSoMaxConn(int) error {
+	return syserror.EACCES
+}
+
+// PingGroupRange implements inet.Stack.PingGroupRange.
+func (s *Stack) PingGroupRange() (auth.KGID, auth.KGID) {
+	return s.pingGroupLow, s.pingGroupHigh
+}
+
+// SetPingGroupRange implements inet.Stack.SetPingGroupRange.
+func (s *Stack) SetPingGroupRange(auth.KGID, auth.KGID) error {
+	return syserror.EACCES
+}
+
+// IPv4Conf implements inet.Stack.IPv4Conf.
+func (s *Stack) IPv4Conf(idx int32) (inet.IPv4Conf, error) {
+	conf, ok := s.ipv4Confs[idx]
+	if !ok {
+		return inet.IPv4Conf{}, syserror.ENODEV
+	}
+	return conf, nil
+}
+
+// SetIPv4Conf implements inet.Stack.SetIPv4Conf.
+func (s *Stack) SetIPv4Conf(int32, inet.IPv4Conf) error {
+	return syserror.EACCES
+}
+
+// IPv6Conf implements inet.Stack.IPv6Conf.
+func (s *Stack) IPv6Conf(idx int32) (inet.IPv6Conf, error) {
+	conf, ok := s.ipv6Confs[idx]
+	if !ok {
+		return inet.IPv6Conf{}, syserror.ENODEV
+	}
+	return conf, nil
+}
+
+// SetIPv6Conf implements inet.Stack.SetIPv6Conf.
+func (s *Stack) SetIPv6Conf(int32, inet.IPv6Conf) error {
+	return syserror.EACCES
+}
+
+// IPv6HopLimit implements inet.Stack.IPv6HopLimit.
+func (s *Stack) IPv6HopLimit() (int, error) {
+	return s.ipv6HopLimit, nil
+}
+
+// SetIPv6HopLimit implements inet.Stack.SetIPv6HopLimit.
+func (s *Stack) SetIPv6HopLimit(int) error {
+	return syserror.EACCES
+}
+
+// ICMPEchoEnableProbe implements inet.Stack.ICMPEchoEnableProbe.
+func (s *Stack) ICMPEchoEnableProbe() (bool, error) {
+	return s.echoEnableProbe, nil
+}
+
+// SetICMPEchoEnableProbe implements inet.Stack.SetICMPEchoEnableProbe.
+func (s *Stack) SetICMPEchoEnableProbe(bool) error {
+	return syserror.EACCES
+}
+
+// QDiscs implements inet.Stack.QDiscs. The queueing disciplines of the host
+// are not reported.
+func (s *Stack) QDiscs() map[int32]inet.QDisc {
+	return map[int32]inet.QDisc{}
+}
+
+// SetQDisc implements inet.Stack.SetQDisc.
+func (s *Stack) SetQDisc(int32, inet.QDisc) error {
+	return syserror.EACCES
+}
+
+// ResetQDisc implements inet.Stack.ResetQDisc.
+func (s *Stack) ResetQDisc(int32) error {
+	return syserror.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -477,6 +871,12 @@ func (s *Stack) RouteTable() []inet.Route {
 // Resume implements inet.Stack.Resume.
 func (s *Stack) Resume() {}
 
+// PauseTimers implements inet.Stack.PauseTimers.
+func (s *Stack) PauseTimers() {}
+
+// ResumeTimers implements inet.Stack.ResumeTimers.
+func (s *Stack) ResumeTimers() {}
+
 // RegisteredEndpoints implements inet.Stack.RegisteredEndpoints.
 func (s *Stack) RegisteredEndpoints() []stack.TransportEndpoint { return nil }
 
@@ -503,3 +903,37 @@ func (s *Stack) Forwarding(protocol tcpip.NetworkProtocolNumber) bool {
 func (s *Stack) SetForwarding(tcpip.NetworkProtocolNumber, bool) error {
 	return syserror.EACCES
 }
+
+// PortRange implements inet.Stack.PortRange.
+func (s *Stack) PortRange() (uint16, uint16) {
+	return s.portRangeStart, s.portRangeEnd
+}
+
+// SetPortRange implements inet.Stack.SetPortRange.
+func (s *Stack) SetPortRange(uint16, uint16) error {
+	return syserror.EACCES
+}
+
+// LocalReservedPorts implements inet.Stack.LocalReservedPorts.
+func (s *Stack) LocalReservedPorts() []uint16 {
+	return s.reservedPorts
+}
+
+// SetLocalReservedPorts implements inet.Stack.SetLocalReservedPorts.
+func (s *Stack) SetLocalReservedPorts([]uint16) error {
+	return syserror.EACCES
+}
+
+// TransportMemoryLimits implements inet.Stack.TransportMemoryLimits.
+func (s *Stack) TransportMemoryLimits(protocol tcpip.TransportProtocolNumber) (inet.TransportMemoryLimits, error) {
+	limits, ok := s.memoryLimits[protocol]
+	if !ok {
+		return inet.TransportMemoryLimits{}, syserror.EINVAL
+	}
+	return limits, nil
+}
+
+// SetTransportMemoryLimits implements inet.Stack.SetTransportMemoryLimits.
+func (s *Stack) SetTransportMemoryLimits(tcpip.TransportProtocolNumber, inet.TransportMemoryLimits) error {
+	return syserror.EACCES
+}
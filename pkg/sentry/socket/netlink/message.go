@@ -187,6 +187,31 @@ func (m *Message) PutAttrString(atype uint16, s string) {
 	m.putZeros(aligned - l)
 }
 
+// NestedAttrs is the value of a netlink attribute which contains other
+// attributes. It is added to a message with Message.PutAttr.
+type NestedAttrs []byte
+
+// PutAttr adds v to the nested attributes as a netlink attribute.
+//
+// Preconditions: Same as Message.PutAttr.
+func (a *NestedAttrs) PutAttr(atype uint16, v interface{}) {
+	l := linux.NetlinkAttrHeaderSize + int(binary.Size(v))
+	if l > math.MaxUint16 {
+		panic(fmt.Sprintf("attribute too large: %d", l))
+	}
+
+	b := binary.Marshal([]byte(*a), usermem.ByteOrder, linux.NetlinkAttrHeader{
+		Type:   atype,
+		Length: uint16(l),
+	})
+	b = binary.Marshal(b, usermem.ByteOrder, v)
+
+	// Align the attribute.
+	aligned := binary.AlignUp(l, linux.NLA_ALIGNTO)
+	b = append(b, make([]byte, aligned-l)...)
+	*a = NestedAttrs(b)
+}
+
 // MessageSet contains a series of netlink messages.
 type MessageSet struct {
 	// Multi indicates that this a multi-part message, to be terminated by
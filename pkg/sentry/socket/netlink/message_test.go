@@ -310,3 +310,34 @@ func TestAttrView(t *testing.T) {
 		}
 	}
 }
+
+func TestNestedAttrs(t *testing.T) {
+	var attrs netlink.NestedAttrs
+	attrs.PutAttr(1, []byte{0x30, 0x31})
+	attrs.PutAttr(2, uint32(0x33323130))
+
+	want := []byte{
+		0x06, 0x00, // Length
+		0x01, 0x00, // Type
+		0x30, 0x31, 0x00, 0x00, // Data with 2 bytes padding
+		0x08, 0x00, // Length
+		0x02, 0x00, // Type
+		0x30, 0x31, 0x32, 0x33, // Data
+	}
+	if !bytes.Equal([]byte(attrs), want) {
+		t.Fatalf("got attrs = %v, want %v", []byte(attrs), want)
+	}
+
+	// The nested attributes can be parsed back.
+	view := netlink.AttrsView(attrs)
+	for _, wantType := range []uint16{1, 2} {
+		hdr, _, rest, ok := view.ParseFirst()
+		if !ok || hdr.Type != wantType {
+			t.Fatalf("got view.ParseFirst() = (%+v, _, _, %t), want type %d", hdr, ok, wantType)
+		}
+		view = rest
+	}
+	if !view.Empty() {
+		t.Errorf("got %d bytes left after parsing all the attributes, want 0", len(view))
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// MulticastProtocol is implemented by protocols whose sockets can join
+// multicast groups, to receive the notifications sent with Broadcast.
+type MulticastProtocol interface {
+	Protocol
+
+	// MaxGroup returns the highest multicast group of the protocol. Groups
+	// are numbered from 1.
+	MaxGroup() uint32
+}
+
+// maxGroups is the number of multicast groups a socket can join.
+const maxGroups = 64
+
+// groupMask returns the mask of the multicast groups of protocol p, where
+// group n is bit n-1. It is 0 if p has no multicast groups.
+func groupMask(p Protocol) uint64 {
+	mp, ok := p.(MulticastProtocol)
+	if !ok {
+		return 0
+	}
+	if n := mp.MaxGroup(); n < maxGroups {
+		return 1<<n - 1
+	}
+	return ^uint64(0)
+}
+
+// multicast holds the sockets which joined multicast groups.
+var multicast struct {
+	// mu protects members, and the groups field of all sockets. It is
+	// ordered after socketOpsCommon.mu.
+	mu sync.Mutex
+
+	// members maps netlink protocols to the sockets which joined at least
+	// one of their groups.
+	members map[int]map[*socketOpsCommon]struct{}
+}
+
+// setGroupsLocked sets the multicast groups s is a member of.
+//
+// Preconditions: s.mu is held.
+func (s *socketOpsCommon) setGroupsLocked(groups uint64) {
+	multicast.mu.Lock()
+	defer multicast.mu.Unlock()
+
+	s.groups = groups
+	s.updateMembershipLocked()
+}
+
+// updateMembershipLocked adds s to or removes it from multicast.members,
+// depending on whether it joined any group.
+//
+// Preconditions: multicast.mu is held.
+func (s *socketOpsCommon) updateMembershipLocked() {
+	protocol := s.protocol.Protocol()
+	members := multicast.members[protocol]
+	if s.groups == 0 {
+		delete(members, s)
+		return
+	}
+	if members == nil {
+		if multicast.members == nil {
+			multicast.members = make(map[int]map[*socketOpsCommon]struct{})
+		}
+		members = make(map[*socketOpsCommon]struct{})
+		multicast.members[protocol] = members
+	}
+	members[s] = struct{}{}
+}
+
+// afterLoad is invoked by stateify.
+func (s *socketOpsCommon) afterLoad() {
+	multicast.mu.Lock()
+	defer multicast.mu.Unlock()
+	s.updateMembershipLocked()
+}
+
+// Broadcast sends the messages in ms to all sockets of the given netlink
+// protocol which joined group, and were created in network namespace ns. ms
+// should have a zero PortID and Seq, as notifications aren't sent in reply to
+// a request.
+//
+// Like in Linux, messages are dropped for sockets whose receive buffer is
+// full.
+func Broadcast(ctx context.Context, ns *inet.Namespace, protocol int, group uint32, ms *MessageSet) {
+	if group == 0 || group > maxGroups || len(ms.Messages) == 0 {
+		return
+	}
+	bufs := make([][]byte, 0, len(ms.Messages))
+	for _, m := range ms.Messages {
+		bufs = append(bufs, m.Finalize())
+	}
+
+	multicast.mu.Lock()
+	defer multicast.mu.Unlock()
+	for s := range multicast.members[protocol] {
+		if s.netns != ns || s.groups&(1<<(group-1)) == 0 {
+			continue
+		}
+		s.deliver(ctx, bufs)
+	}
+}
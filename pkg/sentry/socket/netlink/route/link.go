@@ -0,0 +1,345 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// linkRequest holds the attributes of an RTM_NEWLINK or RTM_DELLINK request.
+type linkRequest struct {
+	// name is the name of the interface, or empty if not given.
+	name string
+
+	// kind is the kind of the interface to create, e.g. "veth".
+	kind string
+
+	// netns is the network namespace the interface is to be in, or nil if
+	// not given.
+	netns *inet.Namespace
+
+	// peer holds the attributes of the peer of a veth interface, or is nil
+	// if not given.
+	peer *linkRequest
+}
+
+// parseLinkRequest parses the attributes following the ifinfomsg of an
+// RTM_NEWLINK or RTM_DELLINK request.
+func parseLinkRequest(ctx context.Context, attrs netlink.AttrsView) (*linkRequest, *syserr.Error) {
+	var req linkRequest
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		// TODO(gvisor.dev/issue/578): Support the other attributes.
+		switch ahdr.Type & linux.NLA_TYPE_MASK {
+		case linux.IFLA_ADDRESS, linux.IFLA_MTU:
+			return nil, syserr.ErrNotSupported
+		case linux.IFLA_IFNAME:
+			req.name = strings.TrimRight(string(value), "\x00")
+		case linux.IFLA_NET_NS_PID:
+			pid, err := parseUint32(value)
+			if err != nil {
+				return nil, err
+			}
+			if req.netns, err = namespaceOfPID(ctx, pid); err != nil {
+				return nil, err
+			}
+		case linux.IFLA_NET_NS_FD:
+			fd, err := parseUint32(value)
+			if err != nil {
+				return nil, err
+			}
+			if req.netns, err = namespaceOfFD(ctx, int32(fd)); err != nil {
+				return nil, err
+			}
+		case linux.IFLA_LINKINFO:
+			if err := parseLinkInfo(ctx, &req, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &req, nil
+}
+
+// parseLinkInfo updates req with the IFLA_LINKINFO attribute of a request.
+func parseLinkInfo(ctx context.Context, req *linkRequest, linkInfo []byte) *syserr.Error {
+	var data []byte
+	attrs := netlink.AttrsView(linkInfo)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type & linux.NLA_TYPE_MASK {
+		case linux.IFLA_INFO_KIND:
+			req.kind = strings.TrimRight(string(value), "\x00")
+		case linux.IFLA_INFO_DATA:
+			data = value
+		}
+	}
+	if req.kind != "veth" {
+		return nil
+	}
+
+	// The VETH_INFO_PEER attribute holds an ifinfomsg, followed by the
+	// attributes of the peer.
+	attrs = netlink.AttrsView(data)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		if ahdr.Type&linux.NLA_TYPE_MASK != linux.VETH_INFO_PEER {
+			continue
+		}
+		size := int(binary.Size(linux.InterfaceInfoMessage{}))
+		if len(value) < size {
+			return syserr.ErrInvalidArgument
+		}
+		peer, err := parseLinkRequest(ctx, netlink.AttrsView(value[binary.AlignUp(size, linux.NLA_ALIGNTO):]))
+		if err != nil {
+			return err
+		}
+		req.peer = peer
+	}
+	return nil
+}
+
+// namespaceOfPID returns the network namespace of the thread pid, as seen from
+// the PID namespace of the task in ctx.
+func namespaceOfPID(ctx context.Context, pid uint32) (*inet.Namespace, *syserr.Error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+	target := t.PIDNamespace().TaskWithID(kernel.ThreadID(pid))
+	if target == nil {
+		return nil, syserr.ErrNoProcess
+	}
+	return target.NetworkNamespace(), nil
+}
+
+// namespaceOfFD returns the network namespace of fd, which must be a file of
+// /proc/[pid]/ns, in the task in ctx.
+func namespaceOfFD(ctx context.Context, fd int32) (*inet.Namespace, *syserr.Error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var (
+		nsFile inet.NamespaceFile
+		ok     bool
+	)
+	if kernel.VFS2Enabled {
+		file := t.GetFileVFS2(fd)
+		if file == nil {
+			return nil, syserr.ErrBadFD
+		}
+		defer file.DecRef(t)
+		nsFile, ok = file.Impl().(inet.NamespaceFile)
+	} else {
+		file := t.GetFile(fd)
+		if file == nil {
+			return nil, syserr.ErrBadFD
+		}
+		defer file.DecRef(t)
+		nsFile, ok = file.FileOperations.(inet.NamespaceFile)
+	}
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	ns := nsFile.NetworkNamespace()
+	if ns == nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return ns, nil
+}
+
+// findLink returns the index of the interface of stack identified by idx if
+// positive, or by name otherwise.
+func findLink(stack inet.Stack, idx int32, name string) (int32, bool) {
+	for i, iface := range stack.Interfaces() {
+		if idx > 0 && i == idx || idx <= 0 && name != "" && iface.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// linkState returns the interface idx of stack, along with its addresses and
+// routes, as reported once it is removed.
+func linkState(stack inet.Stack, idx int32) (inet.Interface, []inet.InterfaceAddr, []inet.Route) {
+	var routes []inet.Route
+	for _, rt := range stack.RouteTable() {
+		if rt.OutputInterface == idx {
+			routes = append(routes, rt)
+		}
+	}
+	return stack.Interfaces()[idx], stack.InterfaceAddrs()[idx], routes
+}
+
+// newLink handles RTM_NEWLINK requests.
+func (p *Protocol) newLink(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	var ifi linux.InterfaceInfoMessage
+	attrs, ok := msg.GetData(&ifi)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	req, err := parseLinkRequest(ctx, attrs)
+	if err != nil {
+		return err
+	}
+
+	flags := msg.Header().Flags
+	idx, ok := findLink(stack, ifi.Index, req.name)
+	if !ok {
+		if flags&linux.NLM_F_CREATE == 0 {
+			return syserr.ErrNoDevice
+		}
+		if ifi.Index > 0 {
+			// The index of new interfaces can't be chosen.
+			return syserr.ErrNotSupported
+		}
+		return createLink(ctx, req)
+	}
+	if flags&linux.NLM_F_EXCL != 0 {
+		return syserr.ErrExists
+	}
+	return changeLink(ctx, stack, idx, &ifi, req)
+}
+
+// createLink creates the interface described by req.
+func createLink(ctx context.Context, req *linkRequest) *syserr.Error {
+	if req.kind != "veth" {
+		// Only virtual Ethernet pairs can be created.
+		return syserr.ErrNotSupported
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrInvalidArgument
+	}
+
+	// Like in Linux, the interface is created in the namespace given by the
+	// request, and its peer in the namespace given by its own attributes,
+	// both defaulting to the namespace of the caller.
+	ns, peerNS := t.NetworkNamespace(), t.NetworkNamespace()
+	if req.netns != nil {
+		ns = req.netns
+	}
+	var peerName string
+	if req.peer != nil {
+		peerName = req.peer.name
+		if req.peer.netns != nil {
+			peerNS = req.peer.netns
+		}
+	}
+	if err := ns.Stack().CreateVeth(req.name, peerNS.Stack(), peerName); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// changeLink applies the changes requested by an RTM_NEWLINK request to the
+// interface idx of stack.
+func changeLink(ctx context.Context, stack inet.Stack, idx int32, ifi *linux.InterfaceInfoMessage, req *linkRequest) *syserr.Error {
+	// Like in Linux, the interface is moved to its new namespace before its
+	// flags are changed.
+	if req.netns != nil && req.netns.Stack() != stack {
+		iface, addrs, routes := linkState(stack, idx)
+		if err := stack.MoveInterface(idx, req.netns.Stack()); err != nil {
+			return syserr.FromError(err)
+		}
+		if t := kernel.TaskFromContext(ctx); t != nil {
+			NotifyLinkRemoved(ctx, t.NetworkNamespace(), idx, iface, addrs, routes)
+		}
+
+		stack = req.netns.Stack()
+		var ok bool
+		if idx, ok = findLink(stack, 0, iface.Name); !ok {
+			return syserr.ErrNoDevice
+		}
+	}
+
+	// ifi_change is the mask of the flags to change, all of them if zero.
+	// See net/core/rtnetlink.c:rtnl_dev_combine_flags.
+	if ifi.Flags == 0 && ifi.Change == 0 {
+		return nil
+	}
+	if ifi.Change == 0 || ifi.Change&linux.IFF_UP != 0 {
+		if err := stack.SetInterfaceUp(idx, ifi.Flags&linux.IFF_UP != 0); err != nil {
+			return syserr.FromError(err)
+		}
+	}
+	return nil
+}
+
+// delLink handles RTM_DELLINK requests.
+func (p *Protocol) delLink(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	var ifi linux.InterfaceInfoMessage
+	attrs, ok := msg.GetData(&ifi)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	req, err := parseLinkRequest(ctx, attrs)
+	if err != nil {
+		return err
+	}
+	if ifi.Index <= 0 && req.name == "" {
+		// Criteria not specified.
+		return syserr.ErrInvalidArgument
+	}
+	idx, ok := findLink(stack, ifi.Index, req.name)
+	if !ok {
+		return syserr.ErrNoDevice
+	}
+
+	iface, addrs, routes := linkState(stack, idx)
+	if err := stack.RemoveInterface(idx); err != nil {
+		return syserr.FromError(err)
+	}
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		NotifyLinkRemoved(ctx, t.NetworkNamespace(), idx, iface, addrs, routes)
+	}
+	return nil
+}
@@ -50,7 +50,7 @@ func typeKind(typ uint16) commandKind {
 // +stateify savable
 type Protocol struct{}
 
-var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
 
 // NewProtocol creates a NETLINK_ROUTE netlink.Protocol.
 func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
@@ -67,6 +67,11 @@ func (p *Protocol) CanSend() bool {
 	return true
 }
 
+// MaxGroup implements netlink.MulticastProtocol.MaxGroup.
+func (p *Protocol) MaxGroup() uint32 {
+	return linux.RTNLGRP_MAX
+}
+
 // dumpLinks handles RTM_GETLINK dump requests.
 func (p *Protocol) dumpLinks(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	// NLM_F_DUMP + RTM_GETLINK messages are supposed to include an
@@ -93,7 +98,7 @@ func (p *Protocol) dumpLinks(ctx context.Context, msg *netlink.Message, ms *netl
 	}
 
 	for idx, i := range stack.Interfaces() {
-		addNewLinkMessage(ms, idx, i)
+		addLinkMessage(ms, linux.RTM_NEWLINK, idx, i)
 	}
 
 	return nil
@@ -150,7 +155,7 @@ func (p *Protocol) getLink(ctx context.Context, msg *netlink.Message, ms *netlin
 			return syserr.ErrInvalidArgument
 		}
 
-		addNewLinkMessage(ms, idx, i)
+		addLinkMessage(ms, linux.RTM_NEWLINK, idx, i)
 		found = true
 		break
 	}
@@ -160,11 +165,11 @@ func (p *Protocol) getLink(ctx context.Context, msg *netlink.Message, ms *netlin
 	return nil
 }
 
-// addNewLinkMessage appends RTM_NEWLINK message for the given interface into
-// the message set.
-func addNewLinkMessage(ms *netlink.MessageSet, idx int32, i inet.Interface) {
+// addLinkMessage appends a RTM_NEWLINK or RTM_DELLINK message for the given
+// interface into the message set.
+func addLinkMessage(ms *netlink.MessageSet, typ uint16, idx int32, i inet.Interface) {
 	m := ms.AddMessage(linux.NetlinkMessageHeader{
-		Type: linux.RTM_NEWLINK,
+		Type: typ,
 	})
 
 	m.Put(linux.InterfaceInfoMessage{
@@ -212,26 +217,32 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 
 	for id, as := range stack.InterfaceAddrs() {
 		for _, a := range as {
-			m := ms.AddMessage(linux.NetlinkMessageHeader{
-				Type: linux.RTM_NEWADDR,
-			})
-
-			m.Put(linux.InterfaceAddrMessage{
-				Family:    a.Family,
-				PrefixLen: a.PrefixLen,
-				Index:     uint32(id),
-			})
-
-			m.PutAttr(linux.IFA_LOCAL, []byte(a.Addr))
-			m.PutAttr(linux.IFA_ADDRESS, []byte(a.Addr))
-
-			// TODO(gvisor.dev/issue/578): There are many more attributes.
+			addAddrMessage(ms, linux.RTM_NEWADDR, id, a)
 		}
 	}
 
 	return nil
 }
 
+// addAddrMessage appends a RTM_NEWADDR or RTM_DELADDR message for the given
+// address of interface idx into the message set.
+func addAddrMessage(ms *netlink.MessageSet, typ uint16, idx int32, a inet.InterfaceAddr) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+
+	m.Put(linux.InterfaceAddrMessage{
+		Family:    a.Family,
+		PrefixLen: a.PrefixLen,
+		Index:     uint32(idx),
+	})
+
+	m.PutAttr(linux.IFA_LOCAL, []byte(a.Addr))
+	m.PutAttr(linux.IFA_ADDRESS, []byte(a.Addr))
+
+	// TODO(gvisor.dev/issue/578): There are many more attributes.
+}
+
 // commonPrefixLen reports the length of the longest IP address prefix.
 // This is a simplied version from Golang's src/net/addrselect.go.
 func commonPrefixLen(a, b []byte) (cpl int) {
@@ -362,46 +373,52 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 	}
 
 	for _, rt := range routeTables {
-		m := ms.AddMessage(linux.NetlinkMessageHeader{
-			Type: linux.RTM_NEWROUTE,
-		})
-
-		m.Put(linux.RouteMessage{
-			Family: rt.Family,
-			DstLen: rt.DstLen,
-			SrcLen: rt.SrcLen,
-			TOS:    rt.TOS,
-
-			// Always return the main table since we don't have multiple
-			// routing tables.
-			Table:    linux.RT_TABLE_MAIN,
-			Protocol: rt.Protocol,
-			Scope:    rt.Scope,
-			Type:     rt.Type,
-
-			Flags: rt.Flags,
-		})
-
-		m.PutAttr(254, []byte{123})
-		if rt.DstLen > 0 {
-			m.PutAttr(linux.RTA_DST, rt.DstAddr)
-		}
-		if rt.SrcLen > 0 {
-			m.PutAttr(linux.RTA_SRC, rt.SrcAddr)
-		}
-		if rt.OutputInterface != 0 {
-			m.PutAttr(linux.RTA_OIF, rt.OutputInterface)
-		}
-		if len(rt.GatewayAddr) > 0 {
-			m.PutAttr(linux.RTA_GATEWAY, rt.GatewayAddr)
-		}
-
-		// TODO(gvisor.dev/issue/578): There are many more attributes.
+		addRouteMessage(ms, linux.RTM_NEWROUTE, rt)
 	}
 
 	return nil
 }
 
+// addRouteMessage appends a RTM_NEWROUTE or RTM_DELROUTE message for the
+// given route into the message set.
+func addRouteMessage(ms *netlink.MessageSet, typ uint16, rt inet.Route) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+
+	m.Put(linux.RouteMessage{
+		Family: rt.Family,
+		DstLen: rt.DstLen,
+		SrcLen: rt.SrcLen,
+		TOS:    rt.TOS,
+
+		// Always return the main table since we don't have multiple
+		// routing tables.
+		Table:    linux.RT_TABLE_MAIN,
+		Protocol: rt.Protocol,
+		Scope:    rt.Scope,
+		Type:     rt.Type,
+
+		Flags: rt.Flags,
+	})
+
+	m.PutAttr(254, []byte{123})
+	if rt.DstLen > 0 {
+		m.PutAttr(linux.RTA_DST, rt.DstAddr)
+	}
+	if rt.SrcLen > 0 {
+		m.PutAttr(linux.RTA_SRC, rt.SrcAddr)
+	}
+	if rt.OutputInterface != 0 {
+		m.PutAttr(linux.RTA_OIF, rt.OutputInterface)
+	}
+	if len(rt.GatewayAddr) > 0 {
+		m.PutAttr(linux.RTA_GATEWAY, rt.GatewayAddr)
+	}
+
+	// TODO(gvisor.dev/issue/578): There are many more attributes.
+}
+
 // newAddr handles RTM_NEWADDR requests.
 func (p *Protocol) newAddr(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	stack := inet.StackFromContext(ctx)
@@ -528,6 +545,8 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 			return p.dumpAddrs(ctx, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, msg, ms)
+		case linux.RTM_GETQDISC:
+			return p.dumpQDiscs(ctx, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -535,12 +554,20 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 		switch hdr.Type {
 		case linux.RTM_GETLINK:
 			return p.getLink(ctx, msg, ms)
+		case linux.RTM_NEWLINK:
+			return p.newLink(ctx, msg, ms)
+		case linux.RTM_DELLINK:
+			return p.delLink(ctx, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, msg, ms)
 		case linux.RTM_NEWADDR:
 			return p.newAddr(ctx, msg, ms)
 		case linux.RTM_DELADDR:
 			return p.delAddr(ctx, msg, ms)
+		case linux.RTM_NEWQDISC:
+			return p.newQDisc(ctx, msg, ms)
+		case linux.RTM_DELQDISC:
+			return p.delQDisc(ctx, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -548,6 +575,62 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 	return syserr.ErrNotSupported
 }
 
+// NotifyLinkRemoved notifies the NETLINK_ROUTE sockets of network namespace
+// ns that interface idx was removed, along with its addresses and routes. Like
+// in Linux, the routes and addresses are deleted first, each message being
+// sent to the multicast group of its kind and family.
+func NotifyLinkRemoved(ctx context.Context, ns *inet.Namespace, idx int32, iface inet.Interface, addrs []inet.InterfaceAddr, routes []inet.Route) {
+	for _, rt := range routes {
+		group := uint32(linux.RTNLGRP_IPV4_ROUTE)
+		if rt.Family == linux.AF_INET6 {
+			group = linux.RTNLGRP_IPV6_ROUTE
+		}
+		ms := netlink.NewMessageSet(0, 0)
+		addRouteMessage(ms, linux.RTM_DELROUTE, rt)
+		netlink.Broadcast(ctx, ns, linux.NETLINK_ROUTE, group, ms)
+	}
+	for _, a := range addrs {
+		group := uint32(linux.RTNLGRP_IPV4_IFADDR)
+		if a.Family == linux.AF_INET6 {
+			group = linux.RTNLGRP_IPV6_IFADDR
+		}
+		ms := netlink.NewMessageSet(0, 0)
+		addAddrMessage(ms, linux.RTM_DELADDR, idx, a)
+		netlink.Broadcast(ctx, ns, linux.NETLINK_ROUTE, group, ms)
+	}
+	ms := netlink.NewMessageSet(0, 0)
+	addLinkMessage(ms, linux.RTM_DELLINK, idx, iface)
+	netlink.Broadcast(ctx, ns, linux.NETLINK_ROUTE, linux.RTNLGRP_LINK, ms)
+}
+
+// addNeighborMessage adds a neighbor message of type typ for n to ms.
+func addNeighborMessage(ms *netlink.MessageSet, typ uint16, n inet.Neighbor) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+
+	m.Put(linux.NeighborMessage{
+		Family:  n.Family,
+		Ifindex: n.Ifindex,
+		State:   n.State,
+		Type:    linux.RTN_UNICAST,
+	})
+
+	m.PutAttr(linux.NDA_DST, n.Addr)
+	if len(n.LinkAddr) > 0 {
+		m.PutAttr(linux.NDA_LLADDR, n.LinkAddr)
+	}
+}
+
+// NotifyNeighbor notifies the NETLINK_ROUTE sockets of network namespace ns
+// listening to RTNLGRP_NEIGH that neighbor n changed state, or was removed if
+// typ is RTM_DELNEIGH.
+func NotifyNeighbor(ctx context.Context, ns *inet.Namespace, typ uint16, n inet.Neighbor) {
+	ms := netlink.NewMessageSet(0, 0)
+	addNeighborMessage(ms, typ, n)
+	netlink.Broadcast(ctx, ns, linux.NETLINK_ROUTE, linux.RTNLGRP_NEIGH, ms)
+}
+
 // init registers the NETLINK_ROUTE provider.
 func init() {
 	netlink.RegisterProvider(linux.NETLINK_ROUTE, NewProtocol)
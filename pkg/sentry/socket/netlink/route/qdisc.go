@@ -0,0 +1,582 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// dumpQDiscs handles RTM_GETQDISC dump requests.
+func (p *Protocol) dumpQDiscs(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// RTM_GETQDISC dump requests may contain a tcmsg, but Linux dumps the
+	// disciplines of all interfaces regardless, and so do we.
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network devices.
+		return nil
+	}
+
+	for idx, q := range stack.QDiscs() {
+		addNewQDiscMessage(ms, idx, q)
+	}
+	return nil
+}
+
+// addNewQDiscMessage appends an RTM_NEWQDISC message for the root queueing
+// discipline of interface idx into the message set.
+func addNewQDiscMessage(ms *netlink.MessageSet, idx int32, q inet.QDisc) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.RTM_NEWQDISC,
+	})
+
+	m.Put(linux.TrafficControlMessage{
+		Family:  linux.AF_UNSPEC,
+		Ifindex: idx,
+		Handle:  q.Handle,
+		Parent:  linux.TC_H_ROOT,
+		// Info is the reference count of the discipline.
+		Info: 1,
+	})
+
+	m.PutAttrString(linux.TCA_KIND, q.Kind)
+
+	switch q.Kind {
+	case "fq_codel":
+		var opts netlink.NestedAttrs
+		opts.PutAttr(linux.TCA_FQ_CODEL_TARGET, durationToMicroseconds(q.FQCoDel.Target))
+		opts.PutAttr(linux.TCA_FQ_CODEL_LIMIT, q.FQCoDel.Limit)
+		opts.PutAttr(linux.TCA_FQ_CODEL_INTERVAL, durationToMicroseconds(q.FQCoDel.Interval))
+		opts.PutAttr(linux.TCA_FQ_CODEL_ECN, uint32(0))
+		opts.PutAttr(linux.TCA_FQ_CODEL_FLOWS, q.FQCoDel.Flows)
+		opts.PutAttr(linux.TCA_FQ_CODEL_QUANTUM, q.FQCoDel.Quantum)
+		m.PutAttr(linux.TCA_OPTIONS, []byte(opts))
+	case "tbf":
+		rate := q.TBF.Rate
+		if rate > math.MaxUint32 {
+			rate = math.MaxUint32
+		}
+		var opts netlink.NestedAttrs
+		opts.PutAttr(linux.TCA_TBF_PARMS, linux.TCTBFQopt{
+			Rate:   linux.TCRateSpec{Rate: uint32(rate)},
+			Limit:  q.TBF.Limit,
+			Buffer: burstToTicks(q.TBF.Burst, q.TBF.Rate),
+		})
+		if q.TBF.Rate > math.MaxUint32 {
+			opts.PutAttr(linux.TCA_TBF_RATE64, q.TBF.Rate)
+		}
+		m.PutAttr(linux.TCA_OPTIONS, []byte(opts))
+	case "pfifo":
+		m.PutAttr(linux.TCA_OPTIONS, linux.TCFifoQopt{Limit: q.PFIFO.Limit})
+	case "netem":
+		// The options of netem start with a struct tc_netem_qopt rather
+		// than an attribute, followed by the other attributes.
+		qopt := binary.Marshal(nil, usermem.ByteOrder, linux.TCNetemQopt{
+			Latency:   durationToTicks(q.Netem.Latency),
+			Limit:     q.Netem.Limit,
+			Loss:      probabilityToUint32(q.Netem.Loss),
+			Gap:       q.Netem.Gap,
+			Duplicate: probabilityToUint32(q.Netem.Duplicate),
+			Jitter:    durationToTicks(q.Netem.Jitter),
+		})
+		var opts netlink.NestedAttrs
+		opts.PutAttr(linux.TCA_NETEM_LATENCY64, q.Netem.Latency.Nanoseconds())
+		opts.PutAttr(linux.TCA_NETEM_JITTER64, q.Netem.Jitter.Nanoseconds())
+		if q.Netem.Reorder != 0 {
+			opts.PutAttr(linux.TCA_NETEM_REORDER, linux.TCNetemReorder{
+				Probability: probabilityToUint32(q.Netem.Reorder),
+			})
+		}
+		if q.Netem.Rate != 0 {
+			rate := q.Netem.Rate
+			if rate > math.MaxUint32 {
+				opts.PutAttr(linux.TCA_NETEM_RATE64, rate)
+				rate = math.MaxUint32
+			}
+			opts.PutAttr(linux.TCA_NETEM_RATE, linux.TCNetemRate{Rate: uint32(rate)})
+		}
+		m.PutAttr(linux.TCA_OPTIONS, append(qopt, opts...))
+	case "prio":
+		m.PutAttr(linux.TCA_OPTIONS, linux.TCPrioQopt{
+			Bands:   int32(q.Prio.Bands),
+			PrioMap: q.Prio.PrioMap,
+		})
+	case "sfq":
+		m.PutAttr(linux.TCA_OPTIONS, linux.TCSFQQopt{
+			Quantum: q.SFQ.Quantum,
+			Limit:   q.SFQ.Limit,
+			Divisor: q.SFQ.Divisor,
+			Flows:   q.SFQ.Divisor,
+		})
+	}
+
+	var stats netlink.NestedAttrs
+	stats.PutAttr(linux.TCA_STATS_BASIC, linux.GnetStatsBasic{
+		Bytes:   q.Stats.Bytes,
+		Packets: uint32(q.Stats.Packets),
+	})
+	stats.PutAttr(linux.TCA_STATS_QUEUE, linux.GnetStatsQueue{
+		QLen:       uint32(q.Stats.QueueLen),
+		Backlog:    uint32(q.Stats.Backlog),
+		Drops:      uint32(q.Stats.Drops),
+		Overlimits: uint32(q.Stats.Overlimits),
+	})
+	m.PutAttr(linux.TCA_STATS2, []byte(stats))
+}
+
+// durationToMicroseconds converts d to the microseconds used by tc.
+func durationToMicroseconds(d time.Duration) uint32 {
+	us := d.Microseconds()
+	if us > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(us)
+}
+
+// burstToTicks returns the packet scheduler ticks needed to send burst bytes
+// at rate bytes per second.
+func burstToTicks(burst uint32, rate uint64) uint32 {
+	if rate == 0 {
+		return 0
+	}
+	ns := uint64(burst) * uint64(time.Second) / rate
+	ticks := ns >> linux.PSCHED_SHIFT
+	if ticks > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ticks)
+}
+
+// ticksToBurst returns the bytes sent in ticks packet scheduler ticks at rate
+// bytes per second.
+func ticksToBurst(ticks uint32, rate uint64) uint32 {
+	ns := uint64(ticks) << linux.PSCHED_SHIFT
+	burst := rate * ns / uint64(time.Second)
+	if burst > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(burst)
+}
+
+// durationToTicks converts d to packet scheduler ticks.
+func durationToTicks(d time.Duration) uint32 {
+	ticks := d.Nanoseconds() >> linux.PSCHED_SHIFT
+	if ticks > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ticks)
+}
+
+// ticksToDuration converts packet scheduler ticks to a duration.
+func ticksToDuration(ticks uint32) time.Duration {
+	return time.Duration(uint64(ticks) << linux.PSCHED_SHIFT)
+}
+
+// probabilityToUint32 converts p to the fraction of math.MaxUint32 used by
+// netem.
+func probabilityToUint32(p float64) uint32 {
+	return uint32(p * math.MaxUint32)
+}
+
+// uint32ToProbability converts the fraction of math.MaxUint32 used by netem to
+// a probability.
+func uint32ToProbability(v uint32) float64 {
+	return float64(v) / math.MaxUint32
+}
+
+// parseUint32 parses the value of an attribute of type u32.
+func parseUint32(value []byte) (uint32, *syserr.Error) {
+	if len(value) < 4 {
+		return 0, syserr.ErrInvalidArgument
+	}
+	return usermem.ByteOrder.Uint32(value), nil
+}
+
+// parseFQCoDelOptions updates params with the TCA_OPTIONS attribute of an
+// fq_codel discipline.
+func parseFQCoDelOptions(params *inet.FQCoDelParams, options []byte) *syserr.Error {
+	attrs := netlink.AttrsView(options)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		v, err := parseUint32(value)
+		if err != nil {
+			return err
+		}
+		switch ahdr.Type {
+		case linux.TCA_FQ_CODEL_TARGET:
+			params.Target = time.Duration(v) * time.Microsecond
+		case linux.TCA_FQ_CODEL_LIMIT:
+			params.Limit = v
+		case linux.TCA_FQ_CODEL_INTERVAL:
+			params.Interval = time.Duration(v) * time.Microsecond
+		case linux.TCA_FQ_CODEL_ECN:
+			// Packets are dropped rather than marked.
+			if v != 0 {
+				return syserr.ErrNotSupported
+			}
+		case linux.TCA_FQ_CODEL_FLOWS:
+			params.Flows = v
+		case linux.TCA_FQ_CODEL_QUANTUM:
+			params.Quantum = v
+		case linux.TCA_FQ_CODEL_DROP_BATCH_SIZE, linux.TCA_FQ_CODEL_MEMORY_LIMIT:
+			// Packets are dropped one at a time, and the memory used is
+			// bounded by the limit of packets.
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+	return nil
+}
+
+// parseTBFOptions updates params with the TCA_OPTIONS attribute of a tbf
+// discipline.
+func parseTBFOptions(params *inet.TBFParams, options []byte) *syserr.Error {
+	var (
+		qopt      linux.TCTBFQopt
+		haveQopt  bool
+		burst     uint32
+		haveBurst bool
+	)
+	attrs := netlink.AttrsView(options)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.TCA_TBF_PARMS:
+			if len(value) < int(binary.Size(qopt)) {
+				return syserr.ErrInvalidArgument
+			}
+			binary.Unmarshal(value[:binary.Size(qopt)], usermem.ByteOrder, &qopt)
+			if qopt.PeakRate.Rate != 0 {
+				// Peak rates are not supported.
+				return syserr.ErrNotSupported
+			}
+			params.Rate = uint64(qopt.Rate.Rate)
+			params.Limit = qopt.Limit
+			haveQopt = true
+		case linux.TCA_TBF_RATE64:
+			if len(value) < 8 {
+				return syserr.ErrInvalidArgument
+			}
+			params.Rate = usermem.ByteOrder.Uint64(value)
+		case linux.TCA_TBF_BURST:
+			v, err := parseUint32(value)
+			if err != nil {
+				return err
+			}
+			burst = v
+			haveBurst = true
+		case linux.TCA_TBF_PRATE64, linux.TCA_TBF_PBURST:
+			return syserr.ErrNotSupported
+		case linux.TCA_TBF_RTAB, linux.TCA_TBF_PTAB, linux.TCA_TBF_PAD:
+			// Transmit times are computed from the rate rather than looked
+			// up in rate tables.
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+	switch {
+	case haveBurst:
+		params.Burst = burst
+	case haveQopt:
+		// Older versions of tc only pass the burst as the time needed to send
+		// it.
+		params.Burst = ticksToBurst(qopt.Buffer, params.Rate)
+	}
+	return nil
+}
+
+// parseNetemOptions updates params with the TCA_OPTIONS attribute of a netem
+// discipline.
+func parseNetemOptions(params *inet.NetemParams, options []byte) *syserr.Error {
+	var qopt linux.TCNetemQopt
+	size := int(binary.Size(qopt))
+	if len(options) < size {
+		return syserr.ErrInvalidArgument
+	}
+	binary.Unmarshal(options[:size], usermem.ByteOrder, &qopt)
+	params.Latency = ticksToDuration(qopt.Latency)
+	params.Jitter = ticksToDuration(qopt.Jitter)
+	params.Limit = qopt.Limit
+	params.Loss = uint32ToProbability(qopt.Loss)
+	params.Duplicate = uint32ToProbability(qopt.Duplicate)
+	params.Gap = qopt.Gap
+	// As in Linux, settings without an attribute are disabled.
+	params.Reorder = 0
+	params.Rate = 0
+
+	var (
+		rate64     uint64
+		haveRate64 bool
+	)
+	attrs := netlink.AttrsView(options[binary.AlignUp(size, linux.NLA_ALIGNTO):])
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.TCA_NETEM_LATENCY64, linux.TCA_NETEM_JITTER64:
+			if len(value) < 8 {
+				return syserr.ErrInvalidArgument
+			}
+			d := time.Duration(usermem.ByteOrder.Uint64(value))
+			if ahdr.Type == linux.TCA_NETEM_LATENCY64 {
+				params.Latency = d
+			} else {
+				params.Jitter = d
+			}
+		case linux.TCA_NETEM_CORR:
+			var corr linux.TCNetemCorr
+			if len(value) < int(binary.Size(corr)) {
+				return syserr.ErrInvalidArgument
+			}
+			binary.Unmarshal(value[:binary.Size(corr)], usermem.ByteOrder, &corr)
+			if corr != (linux.TCNetemCorr{}) {
+				// Correlated random numbers are not supported.
+				return syserr.ErrNotSupported
+			}
+		case linux.TCA_NETEM_REORDER:
+			var reorder linux.TCNetemReorder
+			if len(value) < int(binary.Size(reorder)) {
+				return syserr.ErrInvalidArgument
+			}
+			binary.Unmarshal(value[:binary.Size(reorder)], usermem.ByteOrder, &reorder)
+			if reorder.Correlation != 0 {
+				return syserr.ErrNotSupported
+			}
+			params.Reorder = uint32ToProbability(reorder.Probability)
+		case linux.TCA_NETEM_CORRUPT:
+			var corrupt linux.TCNetemCorrupt
+			if len(value) < int(binary.Size(corrupt)) {
+				return syserr.ErrInvalidArgument
+			}
+			binary.Unmarshal(value[:binary.Size(corrupt)], usermem.ByteOrder, &corrupt)
+			if corrupt.Probability != 0 {
+				return syserr.ErrNotSupported
+			}
+		case linux.TCA_NETEM_RATE:
+			var rate linux.TCNetemRate
+			if len(value) < int(binary.Size(rate)) {
+				return syserr.ErrInvalidArgument
+			}
+			binary.Unmarshal(value[:binary.Size(rate)], usermem.ByteOrder, &rate)
+			if rate.PacketOverhead != 0 || rate.CellSize != 0 || rate.CellOverhead != 0 {
+				// Link layer overheads are not emulated.
+				return syserr.ErrNotSupported
+			}
+			params.Rate = uint64(rate.Rate)
+		case linux.TCA_NETEM_RATE64:
+			if len(value) < 8 {
+				return syserr.ErrInvalidArgument
+			}
+			rate64 = usermem.ByteOrder.Uint64(value)
+			haveRate64 = true
+		case linux.TCA_NETEM_ECN:
+			v, err := parseUint32(value)
+			if err != nil {
+				return err
+			}
+			if v != 0 {
+				return syserr.ErrNotSupported
+			}
+		case linux.TCA_NETEM_PAD:
+		default:
+			// Delay distributions, loss models and slots are not supported.
+			return syserr.ErrNotSupported
+		}
+	}
+	if haveRate64 {
+		// TCA_NETEM_RATE then only holds the rate capped to 32 bits.
+		params.Rate = rate64
+	}
+	return nil
+}
+
+// parseQDiscOptions updates q with the TCA_OPTIONS attribute of its
+// discipline.
+func parseQDiscOptions(q *inet.QDisc, options []byte) *syserr.Error {
+	switch q.Kind {
+	case "fq_codel":
+		return parseFQCoDelOptions(&q.FQCoDel, options)
+	case "tbf":
+		return parseTBFOptions(&q.TBF, options)
+	case "pfifo":
+		var qopt linux.TCFifoQopt
+		if len(options) < int(binary.Size(qopt)) {
+			return syserr.ErrInvalidArgument
+		}
+		binary.Unmarshal(options[:binary.Size(qopt)], usermem.ByteOrder, &qopt)
+		q.PFIFO.Limit = qopt.Limit
+	case "netem":
+		return parseNetemOptions(&q.Netem, options)
+	case "prio":
+		var qopt linux.TCPrioQopt
+		if len(options) < int(binary.Size(qopt)) {
+			return syserr.ErrInvalidArgument
+		}
+		binary.Unmarshal(options[:binary.Size(qopt)], usermem.ByteOrder, &qopt)
+		if qopt.Bands < 2 || qopt.Bands > linux.TCQ_PRIO_BANDS {
+			return syserr.ErrInvalidArgument
+		}
+		q.Prio.Bands = uint32(qopt.Bands)
+		q.Prio.PrioMap = qopt.PrioMap
+	case "sfq":
+		// Newer versions of tc pass a struct tc_sfq_qopt_v1, which starts
+		// with a struct tc_sfq_qopt.
+		var qopt linux.TCSFQQopt
+		if len(options) < int(binary.Size(qopt)) {
+			return syserr.ErrInvalidArgument
+		}
+		binary.Unmarshal(options[:binary.Size(qopt)], usermem.ByteOrder, &qopt)
+		if qopt.PerturbPeriod != 0 {
+			// The hash of flows is that of their transport endpoint, it is
+			// not perturbed.
+			return syserr.ErrNotSupported
+		}
+		q.SFQ.Quantum = qopt.Quantum
+		q.SFQ.Limit = qopt.Limit
+		q.SFQ.Divisor = qopt.Divisor
+	}
+	// Unknown disciplines are rejected by the stack.
+	return nil
+}
+
+// newQDisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQDisc(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	var tcm linux.TrafficControlMessage
+	attrs, ok := msg.GetData(&tcm)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if tcm.Parent != linux.TC_H_ROOT {
+		// There are no classful disciplines, only root disciplines can be
+		// configured.
+		return syserr.ErrNotSupported
+	}
+	current, ok := stack.QDiscs()[tcm.Ifindex]
+	if !ok {
+		return syserr.ErrNoDevice
+	}
+
+	var (
+		kind    string
+		options []byte
+	)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.TCA_KIND:
+			kind = strings.TrimRight(string(value), "\x00")
+		case linux.TCA_OPTIONS:
+			options = value
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+
+	// The current discipline is changed in place unless a new one is
+	// created, as in Linux.
+	flags := msg.Header().Flags
+	q := inet.QDisc{Kind: kind, Handle: tcm.Handle}
+	if current.Handle != 0 && (tcm.Handle == 0 || tcm.Handle == current.Handle) {
+		switch {
+		case flags&linux.NLM_F_EXCL != 0:
+			return syserr.ErrExists
+		case flags&linux.NLM_F_REPLACE == 0:
+			if kind != "" && kind != current.Kind {
+				return syserr.ErrInvalidArgument
+			}
+			q = current
+		}
+		q.Handle = current.Handle
+	} else if flags&linux.NLM_F_CREATE == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	if q.Kind == "" {
+		return syserr.ErrInvalidArgument
+	}
+	if err := parseQDiscOptions(&q, options); err != nil {
+		return err
+	}
+	if err := stack.SetQDisc(tcm.Ifindex, q); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// delQDisc handles RTM_DELQDISC requests.
+func (p *Protocol) delQDisc(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	var tcm linux.TrafficControlMessage
+	if _, ok := msg.GetData(&tcm); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if tcm.Parent != linux.TC_H_ROOT {
+		return syserr.ErrNotSupported
+	}
+	current, ok := stack.QDiscs()[tcm.Ifindex]
+	if !ok {
+		return syserr.ErrNoDevice
+	}
+	// The default discipline can't be deleted.
+	if current.Handle == 0 || (tcm.Handle != 0 && tcm.Handle != current.Handle) {
+		return syserr.ErrNoFileOrDir
+	}
+	if err := stack.ResetQDisc(tcm.Ifindex); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
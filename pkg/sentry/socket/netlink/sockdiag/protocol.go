@@ -0,0 +1,258 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// Only dumps of TCP and UDP sockets with SOCK_DIAG_BY_FAMILY are supported,
+// and INET_DIAG_INFO is the only extension reported.
+package sockdiag
+
+import (
+	"fmt"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// sockTypeForProtocol returns the socket type of sockets reported for the
+// inet_diag protocol, or false if the protocol isn't supported.
+func sockTypeForProtocol(protocol uint8) (linux.SockType, bool) {
+	switch protocol {
+	case syscall.IPPROTO_TCP:
+		return linux.SOCK_STREAM, true
+	case syscall.IPPROTO_UDP:
+		return linux.SOCK_DGRAM, true
+	default:
+		return 0, false
+	}
+}
+
+// dumpInet handles SOCK_DIAG_BY_FAMILY dump requests for AF_INET and AF_INET6.
+func (p *Protocol) dumpInet(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	var req linux.InetDiagReqV2
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if req.Family != linux.AF_INET && req.Family != linux.AF_INET6 {
+		return syserr.ErrInvalidArgument
+	}
+	stype, ok := sockTypeForProtocol(req.Protocol)
+	if !ok {
+		return syserr.ErrNoFileOrDir
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil
+	}
+	for _, se := range t.Kernel().ListSockets() {
+		if se.SockVFS2 != nil {
+			s := se.SockVFS2
+			if !s.TryIncRef() {
+				// Racing with socket destruction, this is ok.
+				continue
+			}
+			sops, ok := s.Impl().(socket.SocketVFS2)
+			if !ok {
+				panic(fmt.Sprintf("Found non-socket file in socket table: %+v", s))
+			}
+			if diag, info, ok := inetDiagMsg(t, sops, &req, stype); ok {
+				stat, err := s.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+				if err == nil {
+					diag.UID = uint32(auth.KUID(stat.UID).In(t.UserNamespace()).OrOverflow())
+					diag.Inode = uint32(stat.Ino)
+				} else {
+					log.Warningf("Failed to stat socket file: %v", err)
+				}
+				addInetDiagMessage(ms, diag, info)
+			}
+			s.DecRef(ctx)
+			continue
+		}
+
+		s := se.Sock.Get()
+		if s == nil {
+			// Racing with socket destruction, this is ok.
+			continue
+		}
+		sfile := s.(*fs.File)
+		sops, ok := sfile.FileOperations.(socket.Socket)
+		if !ok {
+			panic(fmt.Sprintf("Found non-socket file in socket table: %+v", sfile))
+		}
+		if diag, info, ok := inetDiagMsg(t, sops, &req, stype); ok {
+			if uattr, err := sfile.Dirent.Inode.UnstableAttr(ctx); err == nil {
+				diag.UID = uint32(uattr.Owner.UID.In(t.UserNamespace()).OrOverflow())
+			} else {
+				log.Warningf("Failed to retrieve unstable attr for socket file: %v", err)
+			}
+			diag.Inode = uint32(sfile.InodeID())
+			addInetDiagMessage(ms, diag, info)
+		}
+		s.DecRef(ctx)
+	}
+	return nil
+}
+
+// inetDiagMsg returns the inet_diag_msg describing sops, or false if sops
+// doesn't match req. The UID and inode are left for the caller to fill in. It
+// also returns the tcp_info of TCP sockets if req asked for INET_DIAG_INFO, or
+// nil.
+func inetDiagMsg(t *kernel.Task, sops socket.SocketOps, req *linux.InetDiagReqV2, stype linux.SockType) (*linux.InetDiagMsg, *linux.TCPInfo, bool) {
+	family, skType, protocol := sops.Type()
+	if family != int(req.Family) || skType != stype || (protocol != 0 && protocol != int(req.Protocol)) {
+		return nil, nil, false
+	}
+	state := sops.State()
+	if state >= 32 || req.States&(1<<state) == 0 {
+		return nil, nil, false
+	}
+
+	diag := &linux.InetDiagMsg{
+		Family: req.Family,
+		State:  uint8(state),
+	}
+	if local, _, err := sops.GetSockName(t); err == nil {
+		diag.ID.SPort = putInetAddr(diag.ID.Src[:], local)
+	}
+	if remote, _, err := sops.GetPeerName(t); err == nil {
+		diag.ID.DPort = putInetAddr(diag.ID.Dst[:], remote)
+	}
+
+	if stype != linux.SOCK_STREAM {
+		return diag, nil, true
+	}
+	wantInfo := req.Ext&(1<<(linux.INET_DIAG_INFO-1)) != 0
+	if state != linux.TCP_LISTEN && !wantInfo {
+		return diag, nil, true
+	}
+	v, err := sops.GetSockOpt(t, linux.SOL_TCP, linux.TCP_INFO, 0, linux.SizeOfTCPInfo)
+	if err != nil {
+		return diag, nil, true
+	}
+	var info linux.TCPInfo
+	unmarshalTCPInfo(v, &info)
+	if state == linux.TCP_LISTEN {
+		// As in Linux, report the accept queue's length and capacity for
+		// listening sockets.
+		diag.RQueue = info.Unacked
+		diag.WQueue = info.Sacked
+	}
+	if !wantInfo {
+		return diag, nil, true
+	}
+	return diag, &info, true
+}
+
+// putInetAddr copies the address in addr into dst and returns its port in
+// network byte order.
+func putInetAddr(dst []byte, addr linux.SockAddr) uint16 {
+	switch a := addr.(type) {
+	case *linux.SockAddrInet:
+		copy(dst, a.Addr[:])
+		return a.Port
+	case *linux.SockAddrInet6:
+		copy(dst, a.Addr[:])
+		return a.Port
+	default:
+		return 0
+	}
+}
+
+// unmarshalTCPInfo unmarshals the TCP_INFO value v, which may be truncated,
+// into info.
+func unmarshalTCPInfo(v marshal.Marshallable, info *linux.TCPInfo) {
+	buf := make([]byte, info.SizeBytes())
+	v.MarshalBytes(buf[:v.SizeBytes()])
+	info.UnmarshalBytes(buf)
+}
+
+// addInetDiagMessage adds a SOCK_DIAG_BY_FAMILY message containing diag to ms,
+// followed by an INET_DIAG_INFO attribute if info isn't nil.
+func addInetDiagMessage(ms *netlink.MessageSet, diag *linux.InetDiagMsg, info *linux.TCPInfo) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.SOCK_DIAG_BY_FAMILY,
+	})
+	m.Put(*diag)
+	if info != nil {
+		m.PutAttr(linux.INET_DIAG_INFO, *info)
+	}
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	hdr := msg.Header()
+
+	// All messages start with a 1 byte protocol family.
+	var family uint8
+	if _, ok := msg.GetData(&family); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	switch hdr.Type {
+	case linux.SOCK_DIAG_BY_FAMILY:
+		if hdr.Flags&linux.NLM_F_DUMP != linux.NLM_F_DUMP {
+			// Lookups of a single socket aren't supported.
+			return syserr.ErrNotSupported
+		}
+		switch family {
+		case linux.AF_INET, linux.AF_INET6:
+			return p.dumpInet(ctx, msg, ms)
+		default:
+			return syserr.ErrNoFileOrDir
+		}
+	default:
+		return syserr.ErrInvalidArgument
+	}
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
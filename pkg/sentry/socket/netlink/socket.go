@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/device"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -125,6 +126,15 @@ type socketOpsCommon struct {
 	// TODO(gvisor.dev/issue/1119): We don't actually support filtering,
 	// this is just bookkeeping for tracking add/remove.
 	filter bool
+
+	// groups is the set of multicast groups joined by the socket, where
+	// group n is bit n-1. It is also protected by multicast.mu.
+	groups uint64
+
+	// netns is the network namespace the socket was created in. Multicast
+	// notifications are only received from this namespace. It is
+	// immutable.
+	netns *inet.Namespace
 }
 
 var _ socket.Socket = (*Socket)(nil)
@@ -157,12 +167,18 @@ func NewSocket(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socke
 			ep:             ep,
 			connection:     connection,
 			sendBufferSize: defaultSendBufferSize,
+			netns:          t.NetworkNamespace(),
 		},
 	}, nil
 }
 
 // Release implements fs.FileOperations.Release.
 func (s *socketOpsCommon) Release(ctx context.Context) {
+	// Stop receiving notifications before the connection is released.
+	s.mu.Lock()
+	s.setGroupsLocked(0)
+	s.mu.Unlock()
+
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
@@ -266,15 +282,25 @@ func (s *socketOpsCommon) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
+	mask := groupMask(s.protocol)
+	if a.Groups != 0 && mask == 0 {
+		// No support for multicast groups in this protocol.
 		return syserr.ErrPermissionDenied
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+
+	// nl_groups only holds the first 32 groups. As in Linux, groups the
+	// protocol doesn't have are ignored.
+	if groups := s.groups&^math.MaxUint32 | uint64(a.Groups)&mask; groups != s.groups {
+		s.setGroupsLocked(groups)
+	}
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -456,10 +482,37 @@ func (s *socketOpsCommon) SetSockOpt(t *kernel.Task, level int, name int, opt []
 
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			mask := groupMask(s.protocol)
+			if mask == 0 {
+				t.Kernel().EmitUnimplementedEvent(t)
+				break
+			}
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			group := usermem.ByteOrder.Uint32(opt)
+			if group == 0 || group > maxGroups || mask&(1<<(group-1)) == 0 {
+				return syserr.ErrInvalidArgument
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			groups := s.groups
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				// Joining a group binds the socket, as in Linux.
+				if err := s.bindPort(t, 0); err != nil {
+					return err
+				}
+				groups |= 1 << (group - 1)
+			} else {
+				groups &^= 1 << (group - 1)
+			}
+			s.setGroupsLocked(groups)
+			return nil
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -482,6 +535,7 @@ func (s *socketOpsCommon) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: uint32(s.groups),
 	}
 	return sa, uint32(binary.Size(sa)), nil
 }
@@ -606,23 +660,10 @@ func (s *socketOpsCommon) sendResponse(ctx context.Context, ms *MessageSet) *sys
 		bufs = append(bufs, m.Finalize())
 	}
 
-	// All messages are from the kernel.
-	cms := transport.ControlMessages{
-		Credentials: kernelCreds,
-	}
-
 	if len(bufs) > 0 {
-		// RecvMsg never receives the address, so we don't need to send
-		// one.
-		_, notify, err := s.connection.Send(ctx, bufs, cms, tcpip.FullAddress{})
-		// If the buffer is full, we simply drop messages, just like
-		// Linux.
-		if err != nil && err != syserr.ErrWouldBlock {
+		if err := s.deliver(ctx, bufs); err != nil {
 			return err
 		}
-		if notify {
-			s.connection.SendNotify()
-		}
 	}
 
 	// N.B. multi-part messages should still send NLMSG_DONE even if
@@ -641,18 +682,34 @@ func (s *socketOpsCommon) sendResponse(ctx context.Context, ms *MessageSet) *sys
 		// Add the dump_done_errno payload.
 		m.Put(int64(0))
 
-		_, notify, err := s.connection.Send(ctx, [][]byte{m.Finalize()}, cms, tcpip.FullAddress{})
-		if err != nil && err != syserr.ErrWouldBlock {
+		if err := s.deliver(ctx, [][]byte{m.Finalize()}); err != nil {
 			return err
 		}
-		if notify {
-			s.connection.SendNotify()
-		}
 	}
 
 	return nil
 }
 
+// deliver queues the messages in bufs to be read from the socket, as a single
+// datagram.
+func (s *socketOpsCommon) deliver(ctx context.Context, bufs [][]byte) *syserr.Error {
+	// All messages are from the kernel.
+	cms := transport.ControlMessages{
+		Credentials: kernelCreds,
+	}
+
+	// RecvMsg never receives the address, so we don't need to send one.
+	_, notify, err := s.connection.Send(ctx, bufs, cms, tcpip.FullAddress{})
+	// If the buffer is full, we simply drop messages, just like Linux.
+	if err != nil && err != syserr.ErrWouldBlock {
+		return err
+	}
+	if notify {
+		s.connection.SendNotify()
+	}
+	return nil
+}
+
 func dumpErrorMesage(hdr linux.NetlinkMessageHeader, ms *MessageSet, err *syserr.Error) {
 	m := ms.AddMessage(linux.NetlinkMessageHeader{
 		Type: linux.NLMSG_ERROR,
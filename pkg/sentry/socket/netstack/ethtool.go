@@ -0,0 +1,152 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// ethtoolDriver is the driver name reported by ETHTOOL_GDRVINFO.
+const ethtoolDriver = "netstack"
+
+// ethtoolStats are the statistics of a NIC reported by ETHTOOL_GSTATS, in the
+// order of their names in the ETH_SS_STATS string set.
+var ethtoolStats = []struct {
+	name  string
+	value func(*stack.NICStats) *tcpip.StatCounter
+}{
+	{"rx_packets", func(s *stack.NICStats) *tcpip.StatCounter { return s.Rx.Packets }},
+	{"rx_bytes", func(s *stack.NICStats) *tcpip.StatCounter { return s.Rx.Bytes }},
+	{"rx_dropped", func(s *stack.NICStats) *tcpip.StatCounter { return s.RxDropped }},
+	{"rx_multicast", func(s *stack.NICStats) *tcpip.StatCounter { return s.RxMulticast }},
+	{"tx_packets", func(s *stack.NICStats) *tcpip.StatCounter { return s.Tx.Packets }},
+	{"tx_bytes", func(s *stack.NICStats) *tcpip.StatCounter { return s.Tx.Bytes }},
+	{"tx_errors", func(s *stack.NICStats) *tcpip.StatCounter { return s.TxErrors }},
+	{"tx_dropped", func(s *stack.NICStats) *tcpip.StatCounter { return s.TxDropped }},
+	{"neigh_failed_lookups", func(s *stack.NICStats) *tcpip.StatCounter { return s.Neighbor.FailedEntryLookups }},
+	{"rx_martian_loopback_src", func(s *stack.NICStats) *tcpip.StatCounter { return s.Martians.LoopbackSource }},
+	{"rx_martian_multicast_src", func(s *stack.NICStats) *tcpip.StatCounter { return s.Martians.MulticastSource }},
+	{"rx_martian_local_src", func(s *stack.NICStats) *tcpip.StatCounter { return s.Martians.LocalSource }},
+	{"rx_martian_reverse_path", func(s *stack.NICStats) *tcpip.StatCounter { return s.Martians.ReversePath }},
+}
+
+// ethtoolIoctl implements SIOCETHTOOL for the interface named name. ifr_data
+// points to the structure of the ethtool command, which starts with the
+// command word.
+//
+// Only the commands needed by `ethtool -i` and `ethtool -S` are supported.
+func ethtoolIoctl(ctx context.Context, io usermem.IO, s inet.Stack, name string, ifr *linux.IFReq) *syserr.Error {
+	// We should only ever be passed a netstack.Stack.
+	epstack, ok := s.(*Stack)
+	if !ok {
+		return errStackType
+	}
+	var (
+		stats stack.NICStats
+		found bool
+	)
+	for _, info := range epstack.Stack.NICInfo() {
+		if info.Name == name {
+			stats, found = info.Stats, true
+			break
+		}
+	}
+	if !found {
+		return syserr.ErrNoDevice
+	}
+
+	addr := usermem.Addr(usermem.ByteOrder.Uint64(ifr.Data[:8]))
+	var cmd linux.EthtoolCmd
+	if err := copyInEthtool(ctx, io, addr, &cmd); err != nil {
+		return err
+	}
+
+	var buf []byte
+	switch cmd.Cmd {
+	case linux.ETHTOOL_GDRVINFO:
+		info := linux.EthtoolDrvInfo{
+			Cmd:    cmd.Cmd,
+			NStats: uint32(len(ethtoolStats)),
+		}
+		copy(info.Driver[:], ethtoolDriver)
+		buf = binary.Marshal(nil, usermem.ByteOrder, &info)
+
+	case linux.ETHTOOL_GSSET_INFO:
+		var info linux.EthtoolSsetInfo
+		if err := copyInEthtool(ctx, io, addr, &info); err != nil {
+			return err
+		}
+		// Like in Linux, clear the string sets which don't exist from the
+		// mask. Only the length of the others follows.
+		info.SsetMask &= 1 << linux.ETH_SS_STATS
+		buf = binary.Marshal(nil, usermem.ByteOrder, &info)
+		if info.SsetMask != 0 {
+			buf = binary.AppendUint32(buf, usermem.ByteOrder, uint32(len(ethtoolStats)))
+		}
+
+	case linux.ETHTOOL_GSTRINGS:
+		var gs linux.EthtoolGStrings
+		if err := copyInEthtool(ctx, io, addr, &gs); err != nil {
+			return err
+		}
+		if gs.StringSet != linux.ETH_SS_STATS {
+			return syserr.ErrNotSupported
+		}
+		gs.Len = uint32(len(ethtoolStats))
+		buf = binary.Marshal(nil, usermem.ByteOrder, &gs)
+		for _, stat := range ethtoolStats {
+			var str [linux.ETH_GSTRING_LEN]byte
+			copy(str[:], stat.name)
+			buf = append(buf, str[:]...)
+		}
+
+	case linux.ETHTOOL_GSTATS:
+		es := linux.EthtoolStats{
+			Cmd:    cmd.Cmd,
+			NStats: uint32(len(ethtoolStats)),
+		}
+		buf = binary.Marshal(nil, usermem.ByteOrder, &es)
+		for _, stat := range ethtoolStats {
+			buf = binary.AppendUint64(buf, usermem.ByteOrder, stat.value(&stats).Value())
+		}
+
+	default:
+		// See:
+		// https://github.com/torvalds/linux/blob/aa0c9086b40c17a7ad94425b3b70dd1fdd7497bf/net/core/dev_ioctl.c
+		return syserr.ErrEndpointOperation
+	}
+
+	if _, err := io.CopyOut(ctx, addr, buf, usermem.IOOpts{AddressSpaceActive: true}); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// copyInEthtool copies the ethtool structure at addr into v.
+func copyInEthtool(ctx context.Context, io usermem.IO, addr usermem.Addr, v interface{}) *syserr.Error {
+	buf := make([]byte, binary.Size(v))
+	if _, err := io.CopyIn(ctx, addr, buf, usermem.IOOpts{AddressSpaceActive: true}); err != nil {
+		return syserr.FromError(err)
+	}
+	binary.Unmarshal(buf, usermem.ByteOrder, v)
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"runtime"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -51,6 +52,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/control"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
 	"gvisor.dev/gvisor/pkg/sentry/unimpl"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -87,33 +89,37 @@ var Metrics = tcpip.Stats{
 		V4: tcpip.ICMPv4Stats{
 			PacketsSent: tcpip.ICMPv4SentPacketStats{
 				ICMPv4PacketStats: tcpip.ICMPv4PacketStats{
-					Echo:           mustCreateMetric("/netstack/icmp/v4/packets_sent/echo", "Total number of ICMPv4 echo packets sent by netstack."),
-					EchoReply:      mustCreateMetric("/netstack/icmp/v4/packets_sent/echo_reply", "Total number of ICMPv4 echo reply packets sent by netstack."),
-					DstUnreachable: mustCreateMetric("/netstack/icmp/v4/packets_sent/dst_unreachable", "Total number of ICMPv4 destination unreachable packets sent by netstack."),
-					SrcQuench:      mustCreateMetric("/netstack/icmp/v4/packets_sent/src_quench", "Total number of ICMPv4 source quench packets sent by netstack."),
-					Redirect:       mustCreateMetric("/netstack/icmp/v4/packets_sent/redirect", "Total number of ICMPv4 redirect packets sent by netstack."),
-					TimeExceeded:   mustCreateMetric("/netstack/icmp/v4/packets_sent/time_exceeded", "Total number of ICMPv4 time exceeded packets sent by netstack."),
-					ParamProblem:   mustCreateMetric("/netstack/icmp/v4/packets_sent/param_problem", "Total number of ICMPv4 parameter problem packets sent by netstack."),
-					Timestamp:      mustCreateMetric("/netstack/icmp/v4/packets_sent/timestamp", "Total number of ICMPv4 timestamp packets sent by netstack."),
-					TimestampReply: mustCreateMetric("/netstack/icmp/v4/packets_sent/timestamp_reply", "Total number of ICMPv4 timestamp reply packets sent by netstack."),
-					InfoRequest:    mustCreateMetric("/netstack/icmp/v4/packets_sent/info_request", "Total number of ICMPv4 information request packets sent by netstack."),
-					InfoReply:      mustCreateMetric("/netstack/icmp/v4/packets_sent/info_reply", "Total number of ICMPv4 information reply packets sent by netstack."),
+					Echo:                mustCreateMetric("/netstack/icmp/v4/packets_sent/echo", "Total number of ICMPv4 echo packets sent by netstack."),
+					EchoReply:           mustCreateMetric("/netstack/icmp/v4/packets_sent/echo_reply", "Total number of ICMPv4 echo reply packets sent by netstack."),
+					DstUnreachable:      mustCreateMetric("/netstack/icmp/v4/packets_sent/dst_unreachable", "Total number of ICMPv4 destination unreachable packets sent by netstack."),
+					SrcQuench:           mustCreateMetric("/netstack/icmp/v4/packets_sent/src_quench", "Total number of ICMPv4 source quench packets sent by netstack."),
+					Redirect:            mustCreateMetric("/netstack/icmp/v4/packets_sent/redirect", "Total number of ICMPv4 redirect packets sent by netstack."),
+					TimeExceeded:        mustCreateMetric("/netstack/icmp/v4/packets_sent/time_exceeded", "Total number of ICMPv4 time exceeded packets sent by netstack."),
+					ParamProblem:        mustCreateMetric("/netstack/icmp/v4/packets_sent/param_problem", "Total number of ICMPv4 parameter problem packets sent by netstack."),
+					Timestamp:           mustCreateMetric("/netstack/icmp/v4/packets_sent/timestamp", "Total number of ICMPv4 timestamp packets sent by netstack."),
+					TimestampReply:      mustCreateMetric("/netstack/icmp/v4/packets_sent/timestamp_reply", "Total number of ICMPv4 timestamp reply packets sent by netstack."),
+					InfoRequest:         mustCreateMetric("/netstack/icmp/v4/packets_sent/info_request", "Total number of ICMPv4 information request packets sent by netstack."),
+					InfoReply:           mustCreateMetric("/netstack/icmp/v4/packets_sent/info_reply", "Total number of ICMPv4 information reply packets sent by netstack."),
+					ExtendedEchoRequest: mustCreateMetric("/netstack/icmp/v4/packets_sent/extended_echo_request", "Total number of ICMPv4 extended echo request packets sent by netstack."),
+					ExtendedEchoReply:   mustCreateMetric("/netstack/icmp/v4/packets_sent/extended_echo_reply", "Total number of ICMPv4 extended echo reply packets sent by netstack."),
 				},
 				Dropped: mustCreateMetric("/netstack/icmp/v4/packets_sent/dropped", "Total number of ICMPv4 packets dropped by netstack due to link layer errors."),
 			},
 			PacketsReceived: tcpip.ICMPv4ReceivedPacketStats{
 				ICMPv4PacketStats: tcpip.ICMPv4PacketStats{
-					Echo:           mustCreateMetric("/netstack/icmp/v4/packets_received/echo", "Total number of ICMPv4 echo packets received by netstack."),
-					EchoReply:      mustCreateMetric("/netstack/icmp/v4/packets_received/echo_reply", "Total number of ICMPv4 echo reply packets received by netstack."),
-					DstUnreachable: mustCreateMetric("/netstack/icmp/v4/packets_received/dst_unreachable", "Total number of ICMPv4 destination unreachable packets received by netstack."),
-					SrcQuench:      mustCreateMetric("/netstack/icmp/v4/packets_received/src_quench", "Total number of ICMPv4 source quench packets received by netstack."),
-					Redirect:       mustCreateMetric("/netstack/icmp/v4/packets_received/redirect", "Total number of ICMPv4 redirect packets received by netstack."),
-					TimeExceeded:   mustCreateMetric("/netstack/icmp/v4/packets_received/time_exceeded", "Total number of ICMPv4 time exceeded packets received by netstack."),
-					ParamProblem:   mustCreateMetric("/netstack/icmp/v4/packets_received/param_problem", "Total number of ICMPv4 parameter problem packets received by netstack."),
-					Timestamp:      mustCreateMetric("/netstack/icmp/v4/packets_received/timestamp", "Total number of ICMPv4 timestamp packets received by netstack."),
-					TimestampReply: mustCreateMetric("/netstack/icmp/v4/packets_received/timestamp_reply", "Total number of ICMPv4 timestamp reply packets received by netstack."),
-					InfoRequest:    mustCreateMetric("/netstack/icmp/v4/packets_received/info_request", "Total number of ICMPv4 information request packets received by netstack."),
-					InfoReply:      mustCreateMetric("/netstack/icmp/v4/packets_received/info_reply", "Total number of ICMPv4 information reply packets received by netstack."),
+					Echo:                mustCreateMetric("/netstack/icmp/v4/packets_received/echo", "Total number of ICMPv4 echo packets received by netstack."),
+					EchoReply:           mustCreateMetric("/netstack/icmp/v4/packets_received/echo_reply", "Total number of ICMPv4 echo reply packets received by netstack."),
+					DstUnreachable:      mustCreateMetric("/netstack/icmp/v4/packets_received/dst_unreachable", "Total number of ICMPv4 destination unreachable packets received by netstack."),
+					SrcQuench:           mustCreateMetric("/netstack/icmp/v4/packets_received/src_quench", "Total number of ICMPv4 source quench packets received by netstack."),
+					Redirect:            mustCreateMetric("/netstack/icmp/v4/packets_received/redirect", "Total number of ICMPv4 redirect packets received by netstack."),
+					TimeExceeded:        mustCreateMetric("/netstack/icmp/v4/packets_received/time_exceeded", "Total number of ICMPv4 time exceeded packets received by netstack."),
+					ParamProblem:        mustCreateMetric("/netstack/icmp/v4/packets_received/param_problem", "Total number of ICMPv4 parameter problem packets received by netstack."),
+					Timestamp:           mustCreateMetric("/netstack/icmp/v4/packets_received/timestamp", "Total number of ICMPv4 timestamp packets received by netstack."),
+					TimestampReply:      mustCreateMetric("/netstack/icmp/v4/packets_received/timestamp_reply", "Total number of ICMPv4 timestamp reply packets received by netstack."),
+					InfoRequest:         mustCreateMetric("/netstack/icmp/v4/packets_received/info_request", "Total number of ICMPv4 information request packets received by netstack."),
+					InfoReply:           mustCreateMetric("/netstack/icmp/v4/packets_received/info_reply", "Total number of ICMPv4 information reply packets received by netstack."),
+					ExtendedEchoRequest: mustCreateMetric("/netstack/icmp/v4/packets_received/extended_echo_request", "Total number of ICMPv4 extended echo request packets received by netstack."),
+					ExtendedEchoReply:   mustCreateMetric("/netstack/icmp/v4/packets_received/extended_echo_reply", "Total number of ICMPv4 extended echo reply packets received by netstack."),
 				},
 				Invalid: mustCreateMetric("/netstack/icmp/v4/packets_received/invalid", "Total number of ICMPv4 packets received that the transport layer could not parse."),
 			},
@@ -121,33 +127,37 @@ var Metrics = tcpip.Stats{
 		V6: tcpip.ICMPv6Stats{
 			PacketsSent: tcpip.ICMPv6SentPacketStats{
 				ICMPv6PacketStats: tcpip.ICMPv6PacketStats{
-					EchoRequest:     mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_request", "Total number of ICMPv6 echo request packets sent by netstack."),
-					EchoReply:       mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_reply", "Total number of ICMPv6 echo reply packets sent by netstack."),
-					DstUnreachable:  mustCreateMetric("/netstack/icmp/v6/packets_sent/dst_unreachable", "Total number of ICMPv6 destination unreachable packets sent by netstack."),
-					PacketTooBig:    mustCreateMetric("/netstack/icmp/v6/packets_sent/packet_too_big", "Total number of ICMPv6 packet too big packets sent by netstack."),
-					TimeExceeded:    mustCreateMetric("/netstack/icmp/v6/packets_sent/time_exceeded", "Total number of ICMPv6 time exceeded packets sent by netstack."),
-					ParamProblem:    mustCreateMetric("/netstack/icmp/v6/packets_sent/param_problem", "Total number of ICMPv6 parameter problem packets sent by netstack."),
-					RouterSolicit:   mustCreateMetric("/netstack/icmp/v6/packets_sent/router_solicit", "Total number of ICMPv6 router solicit packets sent by netstack."),
-					RouterAdvert:    mustCreateMetric("/netstack/icmp/v6/packets_sent/router_advert", "Total number of ICMPv6 router advert packets sent by netstack."),
-					NeighborSolicit: mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets sent by netstack."),
-					NeighborAdvert:  mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_advert", "Total number of ICMPv6 neighbor advert packets sent by netstack."),
-					RedirectMsg:     mustCreateMetric("/netstack/icmp/v6/packets_sent/redirect_msg", "Total number of ICMPv6 redirect message packets sent by netstack."),
+					EchoRequest:         mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_request", "Total number of ICMPv6 echo request packets sent by netstack."),
+					EchoReply:           mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_reply", "Total number of ICMPv6 echo reply packets sent by netstack."),
+					DstUnreachable:      mustCreateMetric("/netstack/icmp/v6/packets_sent/dst_unreachable", "Total number of ICMPv6 destination unreachable packets sent by netstack."),
+					PacketTooBig:        mustCreateMetric("/netstack/icmp/v6/packets_sent/packet_too_big", "Total number of ICMPv6 packet too big packets sent by netstack."),
+					TimeExceeded:        mustCreateMetric("/netstack/icmp/v6/packets_sent/time_exceeded", "Total number of ICMPv6 time exceeded packets sent by netstack."),
+					ParamProblem:        mustCreateMetric("/netstack/icmp/v6/packets_sent/param_problem", "Total number of ICMPv6 parameter problem packets sent by netstack."),
+					RouterSolicit:       mustCreateMetric("/netstack/icmp/v6/packets_sent/router_solicit", "Total number of ICMPv6 router solicit packets sent by netstack."),
+					RouterAdvert:        mustCreateMetric("/netstack/icmp/v6/packets_sent/router_advert", "Total number of ICMPv6 router advert packets sent by netstack."),
+					NeighborSolicit:     mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets sent by netstack."),
+					NeighborAdvert:      mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_advert", "Total number of ICMPv6 neighbor advert packets sent by netstack."),
+					RedirectMsg:         mustCreateMetric("/netstack/icmp/v6/packets_sent/redirect_msg", "Total number of ICMPv6 redirect message packets sent by netstack."),
+					ExtendedEchoRequest: mustCreateMetric("/netstack/icmp/v6/packets_sent/extended_echo_request", "Total number of ICMPv6 extended echo request packets sent by netstack."),
+					ExtendedEchoReply:   mustCreateMetric("/netstack/icmp/v6/packets_sent/extended_echo_reply", "Total number of ICMPv6 extended echo reply packets sent by netstack."),
 				},
 				Dropped: mustCreateMetric("/netstack/icmp/v6/packets_sent/dropped", "Total number of ICMPv6 packets dropped by netstack due to link layer errors."),
 			},
 			PacketsReceived: tcpip.ICMPv6ReceivedPacketStats{
 				ICMPv6PacketStats: tcpip.ICMPv6PacketStats{
-					EchoRequest:     mustCreateMetric("/netstack/icmp/v6/packets_received/echo_request", "Total number of ICMPv6 echo request packets received by netstack."),
-					EchoReply:       mustCreateMetric("/netstack/icmp/v6/packets_received/echo_reply", "Total number of ICMPv6 echo reply packets received by netstack."),
-					DstUnreachable:  mustCreateMetric("/netstack/icmp/v6/packets_received/dst_unreachable", "Total number of ICMPv6 destination unreachable packets received by netstack."),
-					PacketTooBig:    mustCreateMetric("/netstack/icmp/v6/packets_received/packet_too_big", "Total number of ICMPv6 packet too big packets received by netstack."),
-					TimeExceeded:    mustCreateMetric("/netstack/icmp/v6/packets_received/time_exceeded", "Total number of ICMPv6 time exceeded packets received by netstack."),
-					ParamProblem:    mustCreateMetric("/netstack/icmp/v6/packets_received/param_problem", "Total number of ICMPv6 parameter problem packets received by netstack."),
-					RouterSolicit:   mustCreateMetric("/netstack/icmp/v6/packets_received/router_solicit", "Total number of ICMPv6 router solicit packets received by netstack."),
-					RouterAdvert:    mustCreateMetric("/netstack/icmp/v6/packets_received/router_advert", "Total number of ICMPv6 router advert packets received by netstack."),
-					NeighborSolicit: mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets received by netstack."),
-					NeighborAdvert:  mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_advert", "Total number of ICMPv6 neighbor advert packets received by netstack."),
-					RedirectMsg:     mustCreateMetric("/netstack/icmp/v6/packets_received/redirect_msg", "Total number of ICMPv6 redirect message packets received by netstack."),
+					EchoRequest:         mustCreateMetric("/netstack/icmp/v6/packets_received/echo_request", "Total number of ICMPv6 echo request packets received by netstack."),
+					EchoReply:           mustCreateMetric("/netstack/icmp/v6/packets_received/echo_reply", "Total number of ICMPv6 echo reply packets received by netstack."),
+					DstUnreachable:      mustCreateMetric("/netstack/icmp/v6/packets_received/dst_unreachable", "Total number of ICMPv6 destination unreachable packets received by netstack."),
+					PacketTooBig:        mustCreateMetric("/netstack/icmp/v6/packets_received/packet_too_big", "Total number of ICMPv6 packet too big packets received by netstack."),
+					TimeExceeded:        mustCreateMetric("/netstack/icmp/v6/packets_received/time_exceeded", "Total number of ICMPv6 time exceeded packets received by netstack."),
+					ParamProblem:        mustCreateMetric("/netstack/icmp/v6/packets_received/param_problem", "Total number of ICMPv6 parameter problem packets received by netstack."),
+					RouterSolicit:       mustCreateMetric("/netstack/icmp/v6/packets_received/router_solicit", "Total number of ICMPv6 router solicit packets received by netstack."),
+					RouterAdvert:        mustCreateMetric("/netstack/icmp/v6/packets_received/router_advert", "Total number of ICMPv6 router advert packets received by netstack."),
+					NeighborSolicit:     mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets received by netstack."),
+					NeighborAdvert:      mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_advert", "Total number of ICMPv6 neighbor advert packets received by netstack."),
+					RedirectMsg:         mustCreateMetric("/netstack/icmp/v6/packets_received/redirect_msg", "Total number of ICMPv6 redirect message packets received by netstack."),
+					ExtendedEchoRequest: mustCreateMetric("/netstack/icmp/v6/packets_received/extended_echo_request", "Total number of ICMPv6 extended echo request packets received by netstack."),
+					ExtendedEchoReply:   mustCreateMetric("/netstack/icmp/v6/packets_received/extended_echo_reply", "Total number of ICMPv6 extended echo reply packets received by netstack."),
 				},
 				Invalid: mustCreateMetric("/netstack/icmp/v6/packets_received/invalid", "Total number of ICMPv6 packets received that the transport layer could not parse."),
 			},
@@ -157,11 +167,19 @@ var Metrics = tcpip.Stats{
 		PacketsReceived:                     mustCreateMetric("/netstack/ip/packets_received", "Total number of IP packets received from the link layer in nic.DeliverNetworkPacket."),
 		InvalidDestinationAddressesReceived: mustCreateMetric("/netstack/ip/invalid_addresses_received", "Total number of IP packets received with an unknown or invalid destination address."),
 		InvalidSourceAddressesReceived:      mustCreateMetric("/netstack/ip/invalid_source_addresses_received", "Total number of IP packets received with an unknown or invalid source address."),
+		ReversePathFilterDropped:            mustCreateMetric("/netstack/ip/reverse_path_filter_dropped", "Total number of IP packets dropped by reverse path filtering."),
+		PacketsForwarded:                    mustCreateMetric("/netstack/ip/packets_forwarded", "Total number of IP packets forwarded to their next hop."),
+		HopLimitExceeded:                    mustCreateMetric("/netstack/ip/hop_limit_exceeded", "Total number of IP packets not forwarded because their TTL or hop limit expired."),
+		ForwardingFlowCacheHits:             mustCreateMetric("/netstack/ip/forwarding_flow_cache_hits", "Total number of IP packets forwarded through a route found in the forwarding flow cache."),
+		ForwardingFlowCacheMisses:           mustCreateMetric("/netstack/ip/forwarding_flow_cache_misses", "Total number of IP packets to forward whose flow was not found in the forwarding flow cache."),
 		PacketsDelivered:                    mustCreateMetric("/netstack/ip/packets_delivered", "Total number of incoming IP packets that are successfully delivered to the transport layer via HandlePacket."),
 		PacketsSent:                         mustCreateMetric("/netstack/ip/packets_sent", "Total number of IP packets sent via WritePacket."),
 		OutgoingPacketErrors:                mustCreateMetric("/netstack/ip/outgoing_packet_errors", "Total number of IP packets which failed to write to a link-layer endpoint."),
 		MalformedPacketsReceived:            mustCreateMetric("/netstack/ip/malformed_packets_received", "Total number of IP packets which failed IP header validation checks."),
 		MalformedFragmentsReceived:          mustCreateMetric("/netstack/ip/malformed_fragments_received", "Total number of IP fragments which failed IP fragment validation checks."),
+		AtomicFragmentsDropped:              mustCreateMetric("/netstack/ip/atomic_fragments_dropped", "Total number of IPv6 atomic fragments dropped by policy."),
+		OverlappingFragmentsReceived:        mustCreateMetric("/netstack/ip/overlapping_fragments_received", "Total number of IP fragments which overlapped with previously received fragments."),
+		TinyFragmentsDropped:                mustCreateMetric("/netstack/ip/tiny_fragments_dropped", "Total number of non-final IPv6 fragments dropped by policy for being too small."),
 		IPTablesPreroutingDropped:           mustCreateMetric("/netstack/ip/iptables/prerouting_dropped", "Total number of IP packets dropped in the Prerouting chain."),
 		IPTablesInputDropped:                mustCreateMetric("/netstack/ip/iptables/input_dropped", "Total number of IP packets dropped in the Input chain."),
 		IPTablesOutputDropped:               mustCreateMetric("/netstack/ip/iptables/output_dropped", "Total number of IP packets dropped in the Output chain."),
@@ -179,6 +197,8 @@ var Metrics = tcpip.Stats{
 		ListenOverflowSynCookieSent:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_sent", "Number of times a SYN cookie was sent."),
 		ListenOverflowSynCookieRcvd:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_rcvd", "Number of times a SYN cookie was received."),
 		ListenOverflowInvalidSynCookieRcvd: mustCreateMetric("/netstack/tcp/listen_overflow_invalid_syn_cookie_rcvd", "Number of times an invalid SYN cookie was received."),
+		ListenOverflows:                    mustCreateMetric("/netstack/tcp/listen_overflows", "Number of times a connection request was dropped or reset because the accept queue was full."),
+		ListenDrops:                        mustCreateMetric("/netstack/tcp/listen_drops", "Number of connection requests dropped or reset by listening sockets."),
 		FailedConnectionAttempts:           mustCreateMetric("/netstack/tcp/failed_connection_attempts", "Number of calls to Connect or Listen (active and passive openings, respectively) that end in an error."),
 		ValidSegmentsReceived:              mustCreateMetric("/netstack/tcp/valid_segments_received", "Number of TCP segments received that the transport layer successfully parsed."),
 		InvalidSegmentsReceived:            mustCreateMetric("/netstack/tcp/invalid_segments_received", "Number of TCP segments received that the transport layer could not parse."),
@@ -193,11 +213,44 @@ var Metrics = tcpip.Stats{
 		FastRetransmit:                     mustCreateMetric("/netstack/tcp/fast_retransmit", "Number of TCP segments which were fast retransmitted."),
 		Timeouts:                           mustCreateMetric("/netstack/tcp/timeouts", "Number of times RTO expired."),
 		ChecksumErrors:                     mustCreateMetric("/netstack/tcp/checksum_errors", "Number of segments dropped due to bad checksums."),
+		MinTTLDrops:                        mustCreateMetric("/netstack/tcp/min_ttl_drops", "Number of segments dropped due to a TTL lower than the minimum TTL of their endpoint."),
+		AutoCorking:                        mustCreateMetric("/netstack/tcp/autocorking", "Number of times a partial segment was held back to coalesce subsequent small writes."),
+		MTUProbeSuccesses:                  mustCreateMetric("/netstack/tcp/mtu_probe_successes", "Number of path MTU probes that were acknowledged."),
+		MTUProbeFailures:                   mustCreateMetric("/netstack/tcp/mtu_probe_failures", "Number of path MTU probes that were lost."),
+		MTUBlackHoles:                      mustCreateMetric("/netstack/tcp/mtu_black_holes", "Number of times the MSS was lowered after repeated losses of full-sized segments."),
+		OutOfOrderQueued:                   mustCreateMetric("/netstack/tcp/ofo_queued", "Number of segments queued in the out-of-order queue."),
+		OutOfOrderDropped:                  mustCreateMetric("/netstack/tcp/ofo_dropped", "Number of segments dropped because the out-of-order queue was full."),
+		OutOfOrderPruned:                   mustCreateMetric("/netstack/tcp/ofo_pruned", "Number of segments dropped from the out-of-order queue to make room for earlier segments."),
+		OutOfOrderMerged:                   mustCreateMetric("/netstack/tcp/ofo_merged", "Number of segments of the out-of-order queue merged into other segments."),
+		HandshakeLatency: tcpip.TCPHandshakeLatencyStats{
+			LessThan1ms:   mustCreateMetric("/netstack/tcp/handshake_latency/less_than_1ms", "Number of active connections established in less than 1ms."),
+			LessThan10ms:  mustCreateMetric("/netstack/tcp/handshake_latency/less_than_10ms", "Number of active connections established in 1ms to 10ms."),
+			LessThan100ms: mustCreateMetric("/netstack/tcp/handshake_latency/less_than_100ms", "Number of active connections established in 10ms to 100ms."),
+			LessThan1s:    mustCreateMetric("/netstack/tcp/handshake_latency/less_than_1s", "Number of active connections established in 100ms to 1s."),
+			LessThan3s:    mustCreateMetric("/netstack/tcp/handshake_latency/less_than_3s", "Number of active connections established in 1s to 3s."),
+			LessThan10s:   mustCreateMetric("/netstack/tcp/handshake_latency/less_than_10s", "Number of active connections established in 3s to 10s."),
+			AtLeast10s:    mustCreateMetric("/netstack/tcp/handshake_latency/at_least_10s", "Number of active connections established in 10s or more."),
+		},
+		HandshakeSYNRetransmits: tcpip.TCPHandshakeRetransmitStats{
+			None:        mustCreateMetric("/netstack/tcp/handshake_syn_retransmits/none", "Number of active connection attempts which did not retransmit their SYN."),
+			One:         mustCreateMetric("/netstack/tcp/handshake_syn_retransmits/one", "Number of active connection attempts which retransmitted their SYN once."),
+			Two:         mustCreateMetric("/netstack/tcp/handshake_syn_retransmits/two", "Number of active connection attempts which retransmitted their SYN twice."),
+			ThreeOrMore: mustCreateMetric("/netstack/tcp/handshake_syn_retransmits/three_or_more", "Number of active connection attempts which retransmitted their SYN three times or more."),
+		},
+		HandshakeFailures: tcpip.TCPHandshakeFailureStats{
+			Timeout:     mustCreateMetric("/netstack/tcp/handshake_failures/timeout", "Number of active connection attempts abandoned because the peer did not answer."),
+			Refused:     mustCreateMetric("/netstack/tcp/handshake_failures/refused", "Number of active connection attempts reset by the peer."),
+			Unreachable: mustCreateMetric("/netstack/tcp/handshake_failures/unreachable", "Number of active connection attempts which failed because the peer could not be reached."),
+			Aborted:     mustCreateMetric("/netstack/tcp/handshake_failures/aborted", "Number of active connection attempts aborted locally."),
+			Other:       mustCreateMetric("/netstack/tcp/handshake_failures/other", "Number of active connection attempts which failed for any other reason."),
+		},
 	},
 	UDP: tcpip.UDPStats{
 		PacketsReceived:          mustCreateMetric("/netstack/udp/packets_received", "Number of UDP datagrams received via HandlePacket."),
 		UnknownPortErrors:        mustCreateMetric("/netstack/udp/unknown_port_errors", "Number of incoming UDP datagrams dropped because they did not have a known destination port."),
 		ReceiveBufferErrors:      mustCreateMetric("/netstack/udp/receive_buffer_errors", "Number of incoming UDP datagrams dropped due to the receiving buffer being in an invalid state."),
+		ReceiveBufferOverflows:   mustCreateMetric("/netstack/udp/receive_buffer_overflows", "Number of incoming UDP datagrams dropped due to the receive buffer being full."),
+		ReceiveMemoryErrors:      mustCreateMetric("/netstack/udp/receive_memory_errors", "Number of incoming UDP datagrams dropped due to the UDP memory limit being reached."),
 		MalformedPacketsReceived: mustCreateMetric("/netstack/udp/malformed_packets_received", "Number of incoming UDP datagrams dropped due to the UDP header being in a malformed state."),
 		PacketsSent:              mustCreateMetric("/netstack/udp/packets_sent", "Number of UDP datagrams sent."),
 		PacketSendErrors:         mustCreateMetric("/netstack/udp/packet_send_errors", "Number of UDP datagrams failed to be sent."),
@@ -317,6 +370,11 @@ type socketOpsCommon struct {
 	// sockOptInq corresponds to TCP_INQ. It is implemented at this level
 	// because it takes into account data from readView.
 	sockOptInq bool
+
+	// sockOptPeekOff corresponds to SO_PEEK_OFF, which is disabled when it
+	// is negative. It is implemented at this level because it takes into
+	// account data from readView. It is protected by readMu.
+	sockOptPeekOff int32
 }
 
 // New creates a new endpoint socket.
@@ -329,11 +387,12 @@ func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue
 	defer dirent.DecRef(t)
 	return fs.NewFile(t, dirent, fs.FileFlags{Read: true, Write: true, NonSeekable: true}, &SocketOperations{
 		socketOpsCommon: socketOpsCommon{
-			Queue:    queue,
-			family:   family,
-			Endpoint: endpoint,
-			skType:   skType,
-			protocol: protocol,
+			Queue:          queue,
+			family:         family,
+			Endpoint:       endpoint,
+			skType:         skType,
+			protocol:       protocol,
+			sockOptPeekOff: -1,
 		},
 	}), nil
 }
@@ -355,6 +414,19 @@ func (s *socketOpsCommon) isPacketBased() bool {
 	return s.skType == linux.SOCK_DGRAM || s.skType == linux.SOCK_SEQPACKET || s.skType == linux.SOCK_RDM || s.skType == linux.SOCK_RAW
 }
 
+// supportsPeekOff returns true if the socket supports SO_PEEK_OFF, which is
+// the case of stream and UDP sockets.
+func (s *socketOpsCommon) supportsPeekOff() bool {
+	switch s.skType {
+	case linux.SOCK_STREAM:
+		return true
+	case linux.SOCK_DGRAM:
+		return (s.family == linux.AF_INET || s.family == linux.AF_INET6) && (s.protocol == 0 || s.protocol == linux.IPPROTO_UDP)
+	default:
+		return false
+	}
+}
+
 // fetchReadView updates the readView field of the socket if it's currently
 // empty. It assumes that the socket is locked.
 //
@@ -466,6 +538,7 @@ func (s *SocketOperations) WriteTo(ctx context.Context, _ *fs.File, dst io.Write
 
 		// Drop that part of the view.
 		s.readView.TrimFront(n)
+		s.consumePeekOff(n)
 		if err != nil {
 			s.readMu.Unlock()
 			return done, err
@@ -895,6 +968,18 @@ func (s *SocketOperations) GetSockOpt(t *kernel.Task, level, name int, outPtr us
 		}
 		return &val, nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_PEEK_OFF {
+		if !s.supportsPeekOff() {
+			return nil, syserr.ErrNotSupported
+		}
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		val := primitive.Int32(s.sockOptPeekOff)
+		return &val, nil
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -915,9 +1000,13 @@ func GetSockOpt(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, family in
 	case linux.SOL_IP:
 		return getSockOptIP(t, s, ep, name, outPtr, outLen, family)
 
+	case linux.SOL_RAW:
+		return getSockOptRaw(t, ep, name, outLen)
+
+	case linux.SOL_ICMPV6:
+		return getSockOptICMPv6(t, ep, name, outLen)
+
 	case linux.SOL_UDP,
-		linux.SOL_ICMPV6,
-		linux.SOL_RAW,
 		linux.SOL_PACKET:
 
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -926,6 +1015,60 @@ func GetSockOpt(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, family in
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// getSockOptRaw implements GetSockOpt when level is SOL_RAW.
+func getSockOptRaw(t *kernel.Task, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if name != linux.ICMP_FILTER {
+		t.Kernel().EmitUnimplementedEvent(t)
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+
+	var v tcpip.ICMPv4FilterOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		return nil, translateICMPFilterError(err)
+	}
+	b := make([]byte, linux.SizeOfICMPFilter)
+	usermem.ByteOrder.PutUint32(b, v.DenyType)
+	// Linux truncates the filter to outLen.
+	if len(b) > outLen {
+		b = b[:outLen]
+	}
+	vP := primitive.ByteSlice(b)
+	return &vP, nil
+}
+
+// getSockOptICMPv6 implements GetSockOpt when level is SOL_ICMPV6.
+func getSockOptICMPv6(t *kernel.Task, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if name != linux.ICMPV6_FILTER {
+		t.Kernel().EmitUnimplementedEvent(t)
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+
+	var v tcpip.ICMPv6FilterOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		return nil, translateICMPFilterError(err)
+	}
+	b := make([]byte, linux.SizeOfICMPv6Filter)
+	for i, w := range v.DenyType {
+		usermem.ByteOrder.PutUint32(b[i*4:], w)
+	}
+	// Linux truncates the filter to outLen.
+	if len(b) > outLen {
+		b = b[:outLen]
+	}
+	vP := primitive.ByteSlice(b)
+	return &vP, nil
+}
+
+// translateICMPFilterError translates the errors of endpoints which do not
+// support ICMP filters as Linux reports them.
+func translateICMPFilterError(err *tcpip.Error) *syserr.Error {
+	if err == tcpip.ErrUnknownProtocolOption {
+		// Only raw sockets know about ICMP filters.
+		return syserr.ErrProtocolNotAvailable
+	}
+	return syserr.TranslateNetstackError(err)
+}
+
 func boolToInt32(v bool) int32 {
 	if v {
 		return 1
@@ -1049,6 +1192,19 @@ func getSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, fam
 		name := primitive.ByteSlice(append([]byte(nic.Name), 0))
 		return &name, nil
 
+	case linux.SO_BINDTOIFINDEX:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.BindToDeviceOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		vP := primitive.Int32(v)
+		return &vP, nil
+
 	case linux.SO_BROADCAST:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1121,6 +1277,22 @@ func getSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, fam
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetNoChecksum()))
 		return &v, nil
 
+	case linux.SO_PRIORITY:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetPriority())
+		return &v, nil
+
+	case linux.SO_BUSY_POLL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetBusyPoll())
+		return &v, nil
+
 	case linux.SO_ACCEPTCONN:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1240,7 +1412,22 @@ func getSockOptTCP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name,
 
 		// TODO(b/64800844): Translate fields once they are added to
 		// tcpip.TCPInfoOption.
-		info := linux.TCPInfo{}
+		info := linux.TCPInfo{
+			State:        uint8(s.State()),
+			RTT:          uint32(v.RTT / time.Microsecond),
+			RTTVar:       uint32(v.RTTVar / time.Microsecond),
+			TotalRetrans: uint32(v.Retransmits),
+			SegsOut:      uint32(v.SegmentsSent),
+			SegsIn:       uint32(v.SegmentsReceived),
+			Probes:       uint8(v.Probes),
+			LastAckRecv:  uint32(v.LastAckRecv / time.Millisecond),
+		}
+		if info.State == linux.TCP_LISTEN {
+			// As in Linux, report the accept queue's length and
+			// capacity for listening sockets.
+			info.Unacked = uint32(v.AcceptQueueLen)
+			info.Sacked = uint32(v.Backlog)
+		}
 
 		// Linux truncates the output binary to outLen.
 		buf := t.CopyScratchBuffer(info.SizeBytes())
@@ -1363,8 +1550,81 @@ func getSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetV6Only()))
 		return &v, nil
 
+	case linux.IPV6_MULTICAST_HOPS:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.MulticastTTLOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.IPV6_MULTICAST_ALL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetMulticastAll()))
+		return &v, nil
+
+	case linux.IPV6_MULTICAST_IF:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.MulticastInterfaceOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		vP := primitive.Int32(v.NIC)
+		return &vP, nil
+
+	case linux.IPV6_MTU:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.MTUOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		vP := primitive.Int32(v)
+		return &vP, nil
+
 	case linux.IPV6_PATHMTU:
-		t.Kernel().EmitUnimplementedEvent(t)
+		if outLen < linux.SizeOfControlMessageIPv6PathMTU {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.MTUOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		addr, err := ep.GetRemoteAddress()
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		// As on Linux, the port of the destination is not reported.
+		info := control.NewIPv6PathMTU(tcpip.PathMTUInfo{
+			Addr: tcpip.FullAddress{NIC: addr.NIC, Addr: addr.Addr},
+			MTU:  uint32(v),
+		})
+		return &info, nil
+
+	case linux.IPV6_RECVPATHMTU:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceivePathMTU()))
+		return &v, nil
 
 	case linux.IPV6_TCLASS:
 		// Length handling for parity with Linux.
@@ -1396,6 +1656,30 @@ func getSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveTClass()))
 		return &v, nil
 
+	case linux.IPV6_RECVHOPLIMIT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveHopLimit()))
+		return &v, nil
+
+	case linux.IPV6_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IPV6_MINHOPCOUNT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetMinHopCount())
+		return &v, nil
+
 	case linux.IP6T_ORIGINAL_DST:
 		if outLen < int(binary.Size(linux.SockAddrInet6{})) {
 			return nil, syserr.ErrInvalidArgument
@@ -1483,6 +1767,19 @@ func getSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 	}
 
 	switch name {
+	case linux.IP_MTU:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.MTUOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		vP := primitive.Int32(v)
+		return &vP, nil
+
 	case linux.IP_TTL:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1536,6 +1833,14 @@ func getSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetMulticastLoop()))
 		return &v, nil
 
+	case linux.IP_MULTICAST_ALL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetMulticastAll()))
+		return &v, nil
+
 	case linux.IP_TOS:
 		// Length handling for parity with Linux.
 		if outLen == 0 {
@@ -1561,6 +1866,55 @@ func getSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveTOS()))
 		return &v, nil
 
+	case linux.IP_RECVTTL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveTTL()))
+		return &v, nil
+
+	case linux.IP_RECVOPTS:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveIPOptions()))
+		return &v, nil
+
+	case linux.IP_OPTIONS:
+		opts := ep.SocketOptions().GetIPv4Options()
+		// Linux truncates the options to outLen.
+		if len(opts) > outLen {
+			opts = opts[:outLen]
+		}
+		v := primitive.ByteSlice(append([]byte(nil), opts...))
+		return &v, nil
+
+	case linux.IP_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IP_MINTTL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetMinTTL())
+		return &v, nil
+
+	case linux.IP_BIND_ADDRESS_NO_PORT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetBindAddressNoPort()))
+		return &v, nil
+
 	case linux.IP_PKTINFO:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1682,6 +2036,18 @@ func (s *SocketOperations) SetSockOpt(t *kernel.Task, level int, name int, optVa
 		s.sockOptInq = usermem.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_PEEK_OFF {
+		if !s.supportsPeekOff() {
+			return syserr.ErrNotSupported
+		}
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		s.sockOptPeekOff = int32(usermem.ByteOrder.Uint32(optVal))
+		return nil
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
@@ -1709,16 +2075,61 @@ func SetSockOpt(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, level int
 		t.Kernel().EmitUnimplementedEvent(t)
 		return syserr.ErrProtocolNotAvailable
 
-	case linux.SOL_UDP,
-		linux.SOL_ICMPV6,
-		linux.SOL_RAW:
+	case linux.SOL_RAW:
+		return setSockOptRaw(t, ep, name, optVal)
+
+	case linux.SOL_ICMPV6:
+		return setSockOptICMPv6(t, ep, name, optVal)
 
+	case linux.SOL_UDP:
 		t.Kernel().EmitUnimplementedEvent(t)
 	}
 
 	return nil
 }
 
+// setSockOptRaw implements SetSockOpt when level is SOL_RAW.
+func setSockOptRaw(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	if name != linux.ICMP_FILTER {
+		t.Kernel().EmitUnimplementedEvent(t)
+		return syserr.ErrProtocolNotAvailable
+	}
+
+	// As in Linux, shorter values only replace the start of the filter.
+	var v tcpip.ICMPv4FilterOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		return translateICMPFilterError(err)
+	}
+	b := make([]byte, linux.SizeOfICMPFilter)
+	usermem.ByteOrder.PutUint32(b, v.DenyType)
+	copy(b, optVal)
+	v.DenyType = usermem.ByteOrder.Uint32(b)
+	return translateICMPFilterError(ep.SetSockOpt(&v))
+}
+
+// setSockOptICMPv6 implements SetSockOpt when level is SOL_ICMPV6.
+func setSockOptICMPv6(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	if name != linux.ICMPV6_FILTER {
+		t.Kernel().EmitUnimplementedEvent(t)
+		return syserr.ErrProtocolNotAvailable
+	}
+
+	// As in Linux, shorter values only replace the start of the filter.
+	var v tcpip.ICMPv6FilterOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		return translateICMPFilterError(err)
+	}
+	b := make([]byte, linux.SizeOfICMPv6Filter)
+	for i, w := range v.DenyType {
+		usermem.ByteOrder.PutUint32(b[i*4:], w)
+	}
+	copy(b, optVal)
+	for i := range v.DenyType {
+		v.DenyType[i] = usermem.ByteOrder.Uint32(b[i*4:])
+	}
+	return translateICMPFilterError(ep.SetSockOpt(&v))
+}
+
 // setSockOptSocket implements SetSockOpt when level is SOL_SOCKET.
 func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	switch name {
@@ -1738,6 +2149,22 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		v := usermem.ByteOrder.Uint32(optVal)
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.ReceiveBufferSizeOption, int(v)))
 
+	case linux.SO_RCVBUFFORCE:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		if !t.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+
+		// As on Linux, negative sizes are treated as zero.
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if v < 0 {
+			v = 0
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.ReceiveBufferSizeForceOption, int(v)))
+
 	case linux.SO_REUSEADDR:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -1778,6 +2205,20 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		}
 		return syserr.ErrUnknownDevice
 
+	case linux.SO_BINDTOIFINDEX:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		ifindex := int32(usermem.ByteOrder.Uint32(optVal))
+		if ifindex < 0 {
+			return syserr.ErrInvalidArgument
+		}
+		// Index 0 removes the binding. The endpoint checks that the others
+		// refer to an existing interface.
+		v := tcpip.BindToDeviceOption(ifindex)
+		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
+
 	case linux.SO_BROADCAST:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -1854,6 +2295,37 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		ep.SocketOptions().SetNoChecksum(v != 0)
 		return nil
 
+	case linux.SO_PRIORITY:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// As in Linux, priorities above those of interactive traffic
+		// require CAP_NET_RAW or CAP_NET_ADMIN.
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if (v < 0 || v > linux.TC_PRIO_INTERACTIVE) && !t.HasCapability(linux.CAP_NET_RAW) && !t.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+		ep.SocketOptions().SetPriority(uint32(v))
+		return nil
+
+	case linux.SO_BUSY_POLL:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// As in Linux, increasing the busy polling time requires
+		// CAP_NET_ADMIN.
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if v > int32(ep.SocketOptions().GetBusyPoll()) && !t.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+		if v < 0 {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetBusyPoll(uint32(v))
+		return nil
+
 	case linux.SO_LINGER:
 		if len(optVal) < linux.SizeOfLinger {
 			return syserr.ErrInvalidArgument
@@ -2054,6 +2526,40 @@ func setSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		ep.SocketOptions().SetV6Only(v != 0)
 		return nil
 
+	case linux.IPV6_MULTICAST_HOPS:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// -1 restores the default, as for IP_MULTICAST_TTL.
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if v < -1 || v > 255 {
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.MulticastTTLOption, int(v)))
+
+	case linux.IPV6_MULTICAST_ALL:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := usermem.ByteOrder.Uint32(optVal)
+		ep.SocketOptions().SetMulticastAll(v != 0)
+		return nil
+
+	case linux.IPV6_MULTICAST_IF:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if v < 0 {
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.MulticastInterfaceOption{
+			NIC: tcpip.NICID(v),
+		}))
+
 	case linux.IPV6_ADD_MEMBERSHIP,
 		linux.IPV6_DROP_MEMBERSHIP,
 		linux.IPV6_IPSEC_POLICY,
@@ -2094,6 +2600,44 @@ func setSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		ep.SocketOptions().SetReceiveTClass(v != 0)
 		return nil
 
+	case linux.IPV6_RECVHOPLIMIT:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetReceiveHopLimit(v != 0)
+		return nil
+
+	case linux.IPV6_RECVPATHMTU:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetReceivePathMTU(v != 0)
+		return nil
+
+	case linux.IPV6_FREEBIND:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IPV6_MINHOPCOUNT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(usermem.ByteOrder.Uint32(optVal))
+		if v < 0 || v > 255 {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetMinHopCount(uint8(v))
+		return nil
+
 	case linux.IP6T_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIP6TReplace {
 			return syserr.ErrInvalidArgument
@@ -2173,6 +2717,27 @@ func parseIntOrChar(buf []byte) (int32, *syserr.Error) {
 	return int32(buf[0]), nil
 }
 
+// parseIPv4Options validates the IPv4 options set with IP_OPTIONS and pads them
+// to a multiple of 4 bytes with End of Option List options, as Linux does.
+func parseIPv4Options(buf []byte) ([]byte, *syserr.Error) {
+	if len(buf) > header.IPv4MaximumOptionsSize {
+		return nil, syserr.ErrInvalidArgument
+	}
+	opts := make([]byte, header.IPv4Options(buf).SizeWithPadding())
+	copy(opts, buf)
+	it := header.IPv4Options(buf).MakeIterator()
+	for {
+		_, done, err := it.Next()
+		if err != nil {
+			return nil, syserr.ErrInvalidArgument
+		}
+		if done {
+			break
+		}
+	}
+	return opts, nil
+}
+
 // setSockOptIP implements SetSockOpt when level is SOL_IP.
 func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
@@ -2187,11 +2752,9 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 			return err
 		}
 
-		if v == -1 {
-			// Linux translates -1 to 1.
-			v = 1
-		}
-		if v < 0 || v > 255 {
+		// Linux translates -1 to the default of 1, which netstack
+		// endpoints take from the stack's DefaultMulticastTTLOption.
+		if v < -1 || v > 255 {
 			return syserr.ErrInvalidArgument
 		}
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.MulticastTTLOption, int(v)))
@@ -2244,6 +2807,15 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		ep.SocketOptions().SetMulticastLoop(v != 0)
 		return nil
 
+	case linux.IP_MULTICAST_ALL:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetMulticastAll(v != 0)
+		return nil
+
 	case linux.MCAST_JOIN_GROUP:
 		// FIXME(b/124219304): Implement MCAST_JOIN_GROUP.
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -2281,6 +2853,57 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		ep.SocketOptions().SetReceiveTOS(v != 0)
 		return nil
 
+	case linux.IP_RECVTTL:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetReceiveTTL(v != 0)
+		return nil
+
+	case linux.IP_RECVOPTS:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetReceiveIPOptions(v != 0)
+		return nil
+
+	case linux.IP_OPTIONS:
+		opts, err := parseIPv4Options(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetIPv4Options(opts)
+		return nil
+
+	case linux.IP_FREEBIND:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IP_MINTTL:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		if v < 0 || v > 255 {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetMinTTL(uint8(v))
+		return nil
+
+	case linux.IP_BIND_ADDRESS_NO_PORT:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetBindAddressNoPort(v != 0)
+		return nil
+
 	case linux.IP_PKTINFO:
 		if len(optVal) == 0 {
 			return nil
@@ -2325,24 +2948,17 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		return nil
 
 	case linux.IP_ADD_SOURCE_MEMBERSHIP,
-		linux.IP_BIND_ADDRESS_NO_PORT,
 		linux.IP_BLOCK_SOURCE,
 		linux.IP_CHECKSUM,
 		linux.IP_DROP_SOURCE_MEMBERSHIP,
-		linux.IP_FREEBIND,
 		linux.IP_IPSEC_POLICY,
-		linux.IP_MINTTL,
 		linux.IP_MSFILTER,
 		linux.IP_MTU_DISCOVER,
-		linux.IP_MULTICAST_ALL,
 		linux.IP_NODEFRAG,
-		linux.IP_OPTIONS,
 		linux.IP_PASSSEC,
 		linux.IP_RECVERR,
 		linux.IP_RECVFRAGSIZE,
-		linux.IP_RECVOPTS,
 		linux.IP_RECVORIGDSTADDR,
-		linux.IP_RECVTTL,
 		linux.IP_RETOPTS,
 		linux.IP_TRANSPARENT,
 		linux.IP_UNBLOCK_SOURCE,
@@ -2405,19 +3021,13 @@ func emitUnimplementedEventIPv6(t *kernel.Task, name int) {
 		linux.IPV6_FLOWINFO,
 		linux.IPV6_FLOWINFO_SEND,
 		linux.IPV6_FLOWLABEL_MGR,
-		linux.IPV6_FREEBIND,
 		linux.IPV6_HOPOPTS,
-		linux.IPV6_MINHOPCOUNT,
 		linux.IPV6_MTU,
 		linux.IPV6_MTU_DISCOVER,
-		linux.IPV6_MULTICAST_ALL,
-		linux.IPV6_MULTICAST_HOPS,
-		linux.IPV6_MULTICAST_IF,
 		linux.IPV6_MULTICAST_LOOP,
 		linux.IPV6_RECVDSTOPTS,
 		linux.IPV6_RECVERR,
 		linux.IPV6_RECVFRAGSIZE,
-		linux.IPV6_RECVHOPLIMIT,
 		linux.IPV6_RECVHOPOPTS,
 		linux.IPV6_RECVORIGDSTADDR,
 		linux.IPV6_RECVPATHMTU,
@@ -2443,27 +3053,21 @@ func emitUnimplementedEventIP(t *kernel.Task, name int) {
 	switch name {
 	case linux.IP_TOS,
 		linux.IP_TTL,
-		linux.IP_OPTIONS,
 		linux.IP_ROUTER_ALERT,
-		linux.IP_RECVOPTS,
 		linux.IP_RETOPTS,
 		linux.IP_PKTINFO,
 		linux.IP_PKTOPTIONS,
 		linux.IP_MTU_DISCOVER,
 		linux.IP_RECVERR,
-		linux.IP_RECVTTL,
 		linux.IP_RECVTOS,
 		linux.IP_MTU,
-		linux.IP_FREEBIND,
 		linux.IP_IPSEC_POLICY,
 		linux.IP_XFRM_POLICY,
 		linux.IP_PASSSEC,
 		linux.IP_TRANSPARENT,
 		linux.IP_ORIGDSTADDR,
-		linux.IP_MINTTL,
 		linux.IP_NODEFRAG,
 		linux.IP_CHECKSUM,
-		linux.IP_BIND_ADDRESS_NO_PORT,
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_MULTICAST_IF,
 		linux.IP_MULTICAST_TTL,
@@ -2482,7 +3086,6 @@ func emitUnimplementedEventIP(t *kernel.Task, name int) {
 		linux.MCAST_JOIN_SOURCE_GROUP,
 		linux.MCAST_LEAVE_SOURCE_GROUP,
 		linux.MCAST_MSFILTER,
-		linux.IP_MULTICAST_ALL,
 		linux.IP_UNICAST_IF:
 
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -2568,6 +3171,7 @@ func (s *socketOpsCommon) coalescingRead(ctx context.Context, dst usermem.IOSequ
 
 	// If we managed to copy something, we must deliver it.
 	if copied > 0 {
+		s.consumePeekOff(copied)
 		s.Endpoint.ModerateRecvBuf(copied)
 		return copied, nil
 	}
@@ -2575,6 +3179,136 @@ func (s *socketOpsCommon) coalescingRead(ctx context.Context, dst usermem.IOSequ
 	return 0, err
 }
 
+// consumePeekOff moves the SO_PEEK_OFF offset back by n bytes which were
+// consumed from the start of the receive queue.
+//
+// Precondition: s.readMu must be held.
+func (s *socketOpsCommon) consumePeekOff(n int) {
+	if s.sockOptPeekOff < 0 {
+		return
+	}
+	if int64(n) >= int64(s.sockOptPeekOff) {
+		s.sockOptPeekOff = 0
+		return
+	}
+	s.sockOptPeekOff -= int32(n)
+}
+
+// peekAtOffset peeks at the data of a stream socket from the SO_PEEK_OFF
+// offset onwards, and moves the offset past the data peeked at.
+//
+// Precondition: s.readMu must be held and s.sockOptPeekOff must not be
+// negative.
+func (s *socketOpsCommon) peekAtOffset(ctx context.Context, dst usermem.IOSequence) (int, *syserr.Error) {
+	off := int(s.sockOptPeekOff)
+	var n int
+	if off < len(s.readView) {
+		var err error
+		n, err = dst.CopyOut(ctx, s.readView[off:])
+		if err != nil {
+			return n, syserr.FromError(err)
+		}
+		dst = dst.DropFirst(n)
+	}
+
+	var err error
+	if dst.NumBytes() > 0 {
+		// The rest of the data is peeked at from the endpoint, whose data
+		// starts after the read view.
+		epOff := int64(off + n - len(s.readView))
+		var num int64
+		num, err = dst.CopyOutFrom(ctx, safemem.FromVecReaderFunc{func(dsts [][]byte) (int64, error) {
+			n, _, err := s.Endpoint.Peek(dsts, epOff, nil /* addr */)
+			if err != nil {
+				return n, syserr.TranslateNetstackError(err).ToError()
+			}
+			return n, nil
+		}})
+		n += int(num)
+		if err == syserror.ErrWouldBlock && n > 0 {
+			// We got some data, so no need to return an error.
+			err = nil
+		}
+	}
+
+	s.sockOptPeekOff += int32(n)
+	return n, syserr.FromError(err)
+}
+
+// peekDatagramAtOffset peeks at the datagram of a UDP socket found at the
+// SO_PEEK_OFF offset, from the rest of the offset onwards, and moves the
+// offset past the data peeked at.
+//
+// Precondition: s.readMu must be held, s.readView must hold the first
+// datagram and s.sockOptPeekOff must not be negative.
+func (s *socketOpsCommon) peekDatagramAtOffset(ctx context.Context, dst usermem.IOSequence, trunc, senderRequested bool) (int, int, linux.SockAddr, uint32, socket.ControlMessages, *syserr.Error) {
+	off := int(s.sockOptPeekOff)
+	var (
+		n         int
+		msgLen    int
+		truncated bool
+		sender    tcpip.FullAddress
+		cmsg      socket.ControlMessages
+		err       error
+	)
+	if off == 0 || off < len(s.readView) {
+		// The offset is within the first datagram.
+		n, err = dst.CopyOut(ctx, s.readView[off:])
+		msgLen = len(s.readView) - off
+		truncated = msgLen > n
+		sender = s.sender
+		cmsg = s.controlMessages()
+	} else {
+		// The datagram is peeked at from the endpoint, whose datagrams
+		// follow the first one. Its length isn't known, so a byte is
+		// peeked at past dst to tell whether it is truncated.
+		epOff := int64(off - len(s.readView))
+		var cm tcpip.ControlMessages
+		var num int64
+		num, err = dst.CopyOutFrom(ctx, safemem.FromVecReaderFunc{func(dsts [][]byte) (int64, error) {
+			var extra [1]byte
+			n, c, err := s.Endpoint.Peek(append(dsts, extra[:]), epOff, &sender)
+			if err != nil {
+				return 0, syserr.TranslateNetstackError(err).ToError()
+			}
+			cm = c
+			var size int64
+			for _, dst := range dsts {
+				size += int64(len(dst))
+			}
+			if n > size {
+				truncated = true
+				n = size
+			}
+			return n, nil
+		}})
+		n = int(num)
+		msgLen = n
+		cmsg = socket.ControlMessages{IP: cm}
+		cmsg.IP.HasTimestamp = cm.HasTimestamp && s.sockOptTimestamp
+	}
+	if err != nil {
+		return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+	}
+	s.sockOptPeekOff += int32(n)
+
+	var flags int
+	if truncated {
+		flags |= linux.MSG_TRUNC
+	}
+	if trunc {
+		// Like in Linux, the length of what is left of the datagram is
+		// returned. It is only known for the first datagram.
+		n = msgLen
+	}
+	var addr linux.SockAddr
+	var addrLen uint32
+	if senderRequested {
+		addr, addrLen = socket.ConvertAddress(s.family, sender)
+	}
+	return n, flags, addr, addrLen, cmsg, nil
+}
+
 func (s *socketOpsCommon) fillCmsgInq(cmsg *socket.ControlMessages) {
 	if !s.sockOptInq {
 		return
@@ -2643,6 +3377,12 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 			return 0, 0, nil, 0, socket.ControlMessages{}, syserr.TranslateNetstackError(err)
 		}
 		available := len(s.readView) + int(rql)
+		if s.sockOptPeekOff >= 0 {
+			available -= int(s.sockOptPeekOff)
+			if available < 0 {
+				available = 0
+			}
+		}
 		bufLen := int(dst.NumBytes())
 		if available < bufLen {
 			return available, 0, nil, 0, socket.ControlMessages{}, nil
@@ -2650,6 +3390,14 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 		return bufLen, 0, nil, 0, socket.ControlMessages{}, nil
 	}
 
+	if peek && s.sockOptPeekOff >= 0 {
+		if isPacket {
+			return s.peekDatagramAtOffset(ctx, dst, trunc, senderRequested)
+		}
+		n, err := s.peekAtOffset(ctx, dst)
+		return n, 0, nil, 0, s.controlMessages(), err
+	}
+
 	n, err := dst.CopyOut(ctx, s.readView)
 	// Set the control message, even if 0 bytes were read.
 	if err == nil {
@@ -2679,7 +3427,7 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 		// We need to peek beyond the first message.
 		dst = dst.DropFirst(n)
 		num, err := dst.CopyOutFrom(ctx, safemem.FromVecReaderFunc{func(dsts [][]byte) (int64, error) {
-			n, _, err := s.Endpoint.Peek(dsts)
+			n, _, err := s.Endpoint.Peek(dsts, 0 /* off */, nil /* addr */)
 			// TODO(b/78348848): Handle peek timestamp.
 			if err != nil {
 				return int64(n), syserr.TranslateNetstackError(err).ToError()
@@ -2715,6 +3463,7 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 	if trunc {
 		n = msgLen
 	}
+	s.consumePeekOff(n)
 
 	cmsg := s.controlMessages()
 	s.fillCmsgInq(&cmsg)
@@ -2730,8 +3479,16 @@ func (s *socketOpsCommon) controlMessages() socket.ControlMessages {
 			TOS:             s.readCM.TOS,
 			HasTClass:       s.readCM.HasTClass,
 			TClass:          s.readCM.TClass,
+			HasTTL:          s.readCM.HasTTL,
+			TTL:             s.readCM.TTL,
+			HasHopLimit:     s.readCM.HasHopLimit,
+			HopLimit:        s.readCM.HopLimit,
+			HasIPOptions:    s.readCM.HasIPOptions,
+			IPOptions:       s.readCM.IPOptions,
 			HasIPPacketInfo: s.readCM.HasIPPacketInfo,
 			PacketInfo:      s.readCM.PacketInfo,
+			HasIPv6PathMTU:  s.readCM.HasIPv6PathMTU,
+			IPv6PathMTU:     s.readCM.IPv6PathMTU,
 		},
 	}
 }
@@ -2785,6 +3542,13 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 	s.EventRegister(&e, waiter.EventIn)
 	defer s.EventUnregister(&e)
 
+	// With SO_BUSY_POLL, the endpoint is polled for a while before
+	// blocking.
+	var busyPollDeadline ktime.Time
+	if us := s.Endpoint.SocketOptions().GetBusyPoll(); us != 0 {
+		busyPollDeadline = t.Kernel().MonotonicClock().Now().Add(time.Duration(us) * time.Microsecond)
+	}
+
 	for {
 		var rn int
 		rn, msgFlags, senderAddr, senderAddrLen, controlMessages, err = s.nonBlockingRead(t, dst, peek, trunc, senderRequested)
@@ -2804,6 +3568,13 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 		}
 		dst = dst.DropFirst(rn)
 
+		if now := t.Kernel().MonotonicClock().Now(); now.Before(busyPollDeadline) && (!haveDeadline || now.Before(deadline)) && !t.Interrupted() {
+			// Let the goroutines delivering packets run before polling
+			// again.
+			runtime.Gosched()
+			continue
+		}
+
 		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
 			if n > 0 {
 				return n, msgFlags, senderAddr, senderAddrLen, controlMessages, nil
@@ -2839,9 +3610,10 @@ func (s *socketOpsCommon) SendMsg(t *kernel.Task, src usermem.IOSequence, to []b
 	}
 
 	opts := tcpip.WriteOptions{
-		To:          addr,
-		More:        flags&linux.MSG_MORE != 0,
-		EndOfRecord: flags&linux.MSG_EOR != 0,
+		To:              addr,
+		More:            flags&linux.MSG_MORE != 0,
+		EndOfRecord:     flags&linux.MSG_EOR != 0,
+		ControlMessages: controlMessages.IP,
 	}
 
 	v := &ioSequencePayload{t, src}
@@ -3018,6 +3790,25 @@ func Ioctl(ctx context.Context, ep commonEndpoint, io usermem.IO, args arch.Sysc
 		_, err := vP.CopyOut(t, args[2].Pointer())
 		return 0, err
 
+	case linux.SIOCOUTQNSD:
+		v, terr := ep.GetSockOptInt(tcpip.SendQueueUnsentSizeOption)
+		if terr == tcpip.ErrUnknownProtocolOption {
+			// Only stream sockets track unsent data.
+			return 0, syserror.ENOTTY
+		}
+		if terr != nil {
+			return 0, syserr.TranslateNetstackError(terr).ToError()
+		}
+
+		if v > math.MaxInt32 {
+			v = math.MaxInt32
+		}
+
+		// Copy result to userspace.
+		vP := primitive.Int32(v)
+		_, err := vP.CopyOut(t, args[2].Pointer())
+		return 0, err
+
 	case linux.SIOCGIFMEM, linux.SIOCGIFPFLAGS, linux.SIOCGMIIPHY, linux.SIOCGMIIREG:
 		unimpl.EmitUnimplementedEvent(ctx)
 	}
@@ -3148,12 +3939,7 @@ func interfaceIoctl(ctx context.Context, io usermem.IO, arg int, ifr *linux.IFRe
 		}
 
 	case linux.SIOCETHTOOL:
-		// Stubbed out for now, Ideally we should implement the required
-		// sub-commands for ETHTOOL
-		//
-		// See:
-		// https://github.com/torvalds/linux/blob/aa0c9086b40c17a7ad94425b3b70dd1fdd7497bf/net/core/dev_ioctl.c
-		return syserr.ErrEndpointOperation
+		return ethtoolIoctl(ctx, io, stack, iface.Name, ifr)
 
 	default:
 		// Not a valid call.
@@ -60,11 +60,12 @@ func NewVFS2(t *kernel.Task, family int, skType linux.SockType, protocol int, qu
 
 	s := &SocketVFS2{
 		socketOpsCommon: socketOpsCommon{
-			Queue:    queue,
-			family:   family,
-			Endpoint: endpoint,
-			skType:   skType,
-			protocol: protocol,
+			Queue:          queue,
+			family:         family,
+			Endpoint:       endpoint,
+			skType:         skType,
+			protocol:       protocol,
+			sockOptPeekOff: -1,
 		},
 	}
 	s.LockFD.Init(&vfs.FileLocks{})
@@ -238,6 +239,18 @@ func (s *SocketVFS2) GetSockOpt(t *kernel.Task, level, name int, outPtr usermem.
 		}
 		return &val, nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_PEEK_OFF {
+		if !s.supportsPeekOff() {
+			return nil, syserr.ErrNotSupported
+		}
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		val := primitive.Int32(s.sockOptPeekOff)
+		return &val, nil
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -268,6 +281,18 @@ func (s *SocketVFS2) SetSockOpt(t *kernel.Task, level int, name int, optVal []by
 		s.sockOptInq = usermem.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_PEEK_OFF {
+		if !s.supportsPeekOff() {
+			return syserr.ErrNotSupported
+		}
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		s.sockOptPeekOff = int32(usermem.ByteOrder.Uint32(optVal))
+		return nil
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
@@ -89,6 +89,31 @@ func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol in
 	return 0, true, syserr.ErrProtocolNotSupported
 }
 
+// checkPingSocket returns an error if the caller may not create an ICMP echo
+// socket for transProto over netProto. As in Linux, only members of a group in
+// ping_group_range may create them, regardless of their capabilities. Compare
+// Linux's net/ipv4/ping.c:ping_init_sock().
+func checkPingSocket(ctx context.Context, s *Stack, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber) *syserr.Error {
+	switch {
+	case netProto == ipv4.ProtocolNumber && transProto == header.ICMPv4ProtocolNumber:
+	case netProto == ipv6.ProtocolNumber && transProto == header.ICMPv6ProtocolNumber:
+	default:
+		return syserr.ErrProtocolNotSupported
+	}
+
+	creds := auth.CredentialsFromContext(ctx)
+	low, high := s.PingGroupRange()
+	if low <= creds.EffectiveKGID && creds.EffectiveKGID <= high {
+		return nil
+	}
+	for _, kgid := range creds.ExtraKGIDs {
+		if low <= kgid && kgid <= high {
+			return nil
+		}
+	}
+	return syserr.ErrPermissionDenied
+}
+
 // Socket creates a new socket object for the AF_INET, AF_INET6, or AF_PACKET
 // family.
 func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*fs.File, *syserr.Error) {
@@ -115,6 +140,11 @@ func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*
 	if err != nil {
 		return nil, err
 	}
+	if stype == linux.SOCK_DGRAM && transProto != udp.ProtocolNumber {
+		if err := checkPingSocket(t, eps, p.netProto, transProto); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create the endpoint.
 	var ep tcpip.Endpoint
@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
@@ -59,6 +60,11 @@ func (p *providerVFS2) Socket(t *kernel.Task, stype linux.SockType, protocol int
 	if err != nil {
 		return nil, err
 	}
+	if stype == linux.SOCK_DGRAM && transProto != udp.ProtocolNumber {
+		if err := checkPingSocket(t, eps, p.netProto, transProto); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create the endpoint.
 	var ep tcpip.Endpoint
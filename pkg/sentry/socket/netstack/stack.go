@@ -16,18 +16,28 @@ package netstack
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc"
+	"gvisor.dev/gvisor/pkg/tcpip/link/veth"
+	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // Stack implements inet.Stack for netstack/tcpip/stack.Stack.
@@ -35,6 +45,20 @@ import (
 // +stateify savable
 type Stack struct {
 	Stack *stack.Stack `state:"manual"`
+
+	// soMaxConn is the maximum backlog of listening sockets, or zero for
+	// inet.DefaultSoMaxConn. It is accessed atomically.
+	soMaxConn int32
+
+	// pingGroupMu protects the ping group range below.
+	pingGroupMu sync.Mutex `state:"nosave"`
+
+	// pingGroupRangeSet is true if the ping group range has been set. If it
+	// is false, all groups up to inet.MaxPingGroup may create ICMP echo
+	// sockets.
+	pingGroupRangeSet bool
+	pingGroupLow      auth.KGID
+	pingGroupHigh     auth.KGID
 }
 
 // SupportsIPv6 implements Stack.SupportsIPv6.
@@ -71,6 +95,50 @@ func (s *Stack) Interfaces() map[int32]inet.Interface {
 	return is
 }
 
+// toLinuxNUDState converts a neighbor state to the equivalent Linux NUD_*
+// constant.
+func toLinuxNUDState(s stack.NeighborState) uint16 {
+	switch s {
+	case stack.Incomplete:
+		return linux.NUD_INCOMPLETE
+	case stack.Reachable:
+		return linux.NUD_REACHABLE
+	case stack.Stale:
+		return linux.NUD_STALE
+	case stack.Delay:
+		return linux.NUD_DELAY
+	case stack.Probe:
+		return linux.NUD_PROBE
+	case stack.Static:
+		return linux.NUD_PERMANENT
+	case stack.Failed:
+		return linux.NUD_FAILED
+	default:
+		return linux.NUD_NONE
+	}
+}
+
+// NeighborFromEvent converts a neighbor event of the stack to the neighbor
+// reported in netlink notifications, along with the type of the notification:
+// RTM_DELNEIGH if the entry was removed, RTM_NEWNEIGH otherwise.
+func NeighborFromEvent(ev stack.NeighborEvent) (uint16, inet.Neighbor) {
+	family := uint8(linux.AF_INET)
+	if len(ev.Entry.Addr) == header.IPv6AddressSize {
+		family = linux.AF_INET6
+	}
+	typ := uint16(linux.RTM_NEWNEIGH)
+	if ev.Entry.State == stack.Unknown {
+		typ = linux.RTM_DELNEIGH
+	}
+	return typ, inet.Neighbor{
+		Family:   family,
+		Ifindex:  int32(ev.NICID),
+		State:    toLinuxNUDState(ev.Entry.State),
+		Addr:     []byte(ev.Entry.Addr),
+		LinkAddr: []byte(ev.Entry.LinkAddr),
+	}
+}
+
 // InterfaceAddrs implements inet.Stack.InterfaceAddrs.
 func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 	nicAddrs := make(map[int32][]inet.InterfaceAddr)
@@ -198,6 +266,194 @@ func (s *Stack) RemoveInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
 	return nil
 }
 
+// vethMTU is the MTU of the virtual Ethernet interfaces, the default of Linux.
+const vethMTU = 1500
+
+var (
+	// linksMu serializes the changes made to the interfaces of all stacks,
+	// which involve two stacks when veth pairs span network namespaces.
+	linksMu sync.Mutex
+
+	// vethStacks maps the ends of the veth pairs to the stacks they are in.
+	//
+	// vethStacks is protected by linksMu.
+	vethStacks = make(map[*veth.Endpoint]*Stack)
+)
+
+// nextNICIDLocked returns an unused NIC ID.
+//
+// Preconditions: linksMu must be locked.
+func (s *Stack) nextNICIDLocked() tcpip.NICID {
+	var last tcpip.NICID
+	for id := range s.Stack.NICInfo() {
+		if id > last {
+			last = id
+		}
+	}
+	return last + 1
+}
+
+// unusedNICNameLocked returns the first unused interface name made of prefix
+// and a number, as Linux does for names like "veth%d".
+//
+// Preconditions: linksMu must be locked.
+func (s *Stack) unusedNICNameLocked(prefix string) string {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if s.Stack.GetLinkEndpointByName(name) == nil {
+			return name
+		}
+	}
+}
+
+// randomLinkAddress returns a random unicast and locally administered
+// Ethernet address, like Linux's eth_random_addr().
+func randomLinkAddress() tcpip.LinkAddress {
+	addr := make([]byte, header.EthernetAddressSize)
+	if _, err := rand.Read(addr); err != nil {
+		panic(fmt.Sprintf("rand.Read(_): %s", err))
+	}
+	addr[0] &^= 0x01 // Clear the multicast bit.
+	addr[0] |= 0x02  // Set the locally administered bit.
+	return tcpip.LinkAddress(addr)
+}
+
+// CreateVeth implements inet.Stack.CreateVeth.
+func (s *Stack) CreateVeth(name string, peer inet.Stack, peerName string) error {
+	peerStack, ok := peer.(*Stack)
+	if !ok {
+		return syserror.EOPNOTSUPP
+	}
+
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	ep, peerEP := veth.NewPair(randomLinkAddress(), randomLinkAddress(), vethMTU)
+	if name == "" {
+		name = s.unusedNICNameLocked("veth")
+	} else if s.Stack.GetLinkEndpointByName(name) != nil {
+		return syserror.EEXIST
+	}
+	// Like in Linux, new interfaces are down.
+	id := s.nextNICIDLocked()
+	if err := s.Stack.CreateNICWithOptions(id, ep, stack.NICOptions{Name: name, Disabled: true}); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+
+	if peerName == "" {
+		peerName = peerStack.unusedNICNameLocked("veth")
+	} else if peerStack.Stack.GetLinkEndpointByName(peerName) != nil {
+		s.Stack.RemoveNIC(id)
+		return syserror.EEXIST
+	}
+	if err := peerStack.Stack.CreateNICWithOptions(peerStack.nextNICIDLocked(), peerEP, stack.NICOptions{Name: peerName, Disabled: true}); err != nil {
+		s.Stack.RemoveNIC(id)
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	vethStacks[ep] = s
+	vethStacks[peerEP] = peerStack
+	return nil
+}
+
+// vethEndpoint returns the link endpoint of interface idx, which must be one
+// end of a veth pair.
+func (s *Stack) vethEndpoint(idx int32) (*veth.Endpoint, error) {
+	nic, ok := s.Stack.NICInfo()[tcpip.NICID(idx)]
+	if !ok {
+		return nil, syserror.ENODEV
+	}
+	ep, ok := s.Stack.GetLinkEndpointByName(nic.Name).(*veth.Endpoint)
+	if !ok {
+		// Only the interfaces created through netlink can be moved or
+		// removed, as the others are backed by the host.
+		return nil, syserror.EINVAL
+	}
+	return ep, nil
+}
+
+// SetInterfaceUp implements inet.Stack.SetInterfaceUp.
+func (s *Stack) SetInterfaceUp(idx int32, up bool) error {
+	id := tcpip.NICID(idx)
+	if !s.Stack.HasNIC(id) {
+		return syserror.ENODEV
+	}
+	if up {
+		return syserr.TranslateNetstackError(s.Stack.EnableNIC(id)).ToError()
+	}
+	return syserr.TranslateNetstackError(s.Stack.DisableNIC(id)).ToError()
+}
+
+// MoveInterface implements inet.Stack.MoveInterface.
+func (s *Stack) MoveInterface(idx int32, to inet.Stack) error {
+	toStack, ok := to.(*Stack)
+	if !ok {
+		return syserror.EOPNOTSUPP
+	}
+	if toStack == s {
+		return nil
+	}
+
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	ep, err := s.vethEndpoint(idx)
+	if err != nil {
+		return err
+	}
+	name := s.Stack.FindNICNameFromID(tcpip.NICID(idx))
+	if toStack.Stack.GetLinkEndpointByName(name) != nil {
+		return syserror.EEXIST
+	}
+	// The interface loses its addresses and routes, and is down in its new
+	// namespace, as in Linux.
+	if err := s.Stack.RemoveNIC(tcpip.NICID(idx)); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	if err := toStack.Stack.CreateNICWithOptions(toStack.nextNICIDLocked(), ep, stack.NICOptions{Name: name, Disabled: true}); err != nil {
+		delete(vethStacks, ep)
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	vethStacks[ep] = toStack
+	return nil
+}
+
+// RemoveInterface implements inet.Stack.RemoveInterface.
+func (s *Stack) RemoveInterface(idx int32) error {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	ep, err := s.vethEndpoint(idx)
+	if err != nil {
+		return err
+	}
+	if err := s.Stack.RemoveNIC(tcpip.NICID(idx)); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	delete(vethStacks, ep)
+
+	// Removing either end of a veth pair removes the other, wherever it is.
+	peer := ep.Peer()
+	if peerStack, ok := vethStacks[peer]; ok {
+		if id, ok := peerStack.nicIDLocked(peer); ok {
+			peerStack.Stack.RemoveNIC(id)
+		}
+		delete(vethStacks, peer)
+	}
+	return nil
+}
+
+// nicIDLocked returns the ID of the NIC of ep.
+//
+// Preconditions: linksMu must be locked.
+func (s *Stack) nicIDLocked(ep stack.LinkEndpoint) (tcpip.NICID, bool) {
+	for id, nic := range s.Stack.NICInfo() {
+		if s.Stack.GetLinkEndpointByName(nic.Name) == ep {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
 // TCPReceiveBufferSize implements inet.Stack.TCPReceiveBufferSize.
 func (s *Stack) TCPReceiveBufferSize() (inet.TCPBufferSize, error) {
 	var rs tcpip.TCPReceiveBufferSizeRangeOption
@@ -253,6 +509,19 @@ func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPAbortOnOverflow implements inet.Stack.TCPAbortOnOverflow.
+func (s *Stack) TCPAbortOnOverflow() (bool, error) {
+	var abort tcpip.TCPAbortOnOverflowOption
+	err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &abort)
+	return bool(abort), syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetTCPAbortOnOverflow implements inet.Stack.SetTCPAbortOnOverflow.
+func (s *Stack) SetTCPAbortOnOverflow(enabled bool) error {
+	opt := tcpip.TCPAbortOnOverflowOption(enabled)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
 // TCPRecovery implements inet.Stack.TCPRecovery.
 func (s *Stack) TCPRecovery() (inet.TCPLossRecovery, error) {
 	var recovery tcpip.TCPRecovery
@@ -268,6 +537,486 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPCongestionControl implements inet.Stack.TCPCongestionControl.
+func (s *Stack) TCPCongestionControl() (string, error) {
+	var cc tcpip.CongestionControlOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &cc); err != nil {
+		return "", syserr.TranslateNetstackError(err).ToError()
+	}
+	return string(cc), nil
+}
+
+// SetTCPCongestionControl implements inet.Stack.SetTCPCongestionControl.
+func (s *Stack) SetTCPCongestionControl(cc string) error {
+	opt := tcpip.CongestionControlOption(cc)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
+// TCPAvailableCongestionControl implements
+// inet.Stack.TCPAvailableCongestionControl.
+func (s *Stack) TCPAvailableCongestionControl() ([]string, error) {
+	var available tcpip.TCPAvailableCongestionControlOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &available); err != nil {
+		return nil, syserr.TranslateNetstackError(err).ToError()
+	}
+	return strings.Fields(string(available)), nil
+}
+
+// SocketReceiveBufferSize implements inet.Stack.SocketReceiveBufferSize.
+func (s *Stack) SocketReceiveBufferSize() (inet.SocketBufferSize, error) {
+	var rs stack.ReceiveBufferSizeOption
+	err := s.Stack.Option(&rs)
+	return inet.SocketBufferSize{
+		Default: rs.Default,
+		Max:     rs.Max,
+	}, syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetSocketReceiveBufferSize implements inet.Stack.SetSocketReceiveBufferSize.
+func (s *Stack) SetSocketReceiveBufferSize(size inet.SocketBufferSize) error {
+	var rs stack.ReceiveBufferSizeOption
+	if err := s.Stack.Option(&rs); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	rs.Default, rs.Max = clampBufferSize(rs.Min, size)
+	return syserr.TranslateNetstackError(s.Stack.SetOption(rs)).ToError()
+}
+
+// SocketSendBufferSize implements inet.Stack.SocketSendBufferSize.
+func (s *Stack) SocketSendBufferSize() (inet.SocketBufferSize, error) {
+	var ss stack.SendBufferSizeOption
+	err := s.Stack.Option(&ss)
+	return inet.SocketBufferSize{
+		Default: ss.Default,
+		Max:     ss.Max,
+	}, syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetSocketSendBufferSize implements inet.Stack.SetSocketSendBufferSize.
+func (s *Stack) SetSocketSendBufferSize(size inet.SocketBufferSize) error {
+	var ss stack.SendBufferSizeOption
+	if err := s.Stack.Option(&ss); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	ss.Default, ss.Max = clampBufferSize(ss.Min, size)
+	return syserr.TranslateNetstackError(s.Stack.SetOption(ss)).ToError()
+}
+
+// clampBufferSize returns the default and maximum buffer sizes netstack
+// accepts for size, given the minimum buffer size min. Unlike Linux, netstack
+// requires min <= default <= max.
+func clampBufferSize(min int, size inet.SocketBufferSize) (int, int) {
+	if size.Max < min {
+		size.Max = min
+	}
+	if size.Default < min {
+		size.Default = min
+	}
+	if size.Default > size.Max {
+		size.Default = size.Max
+	}
+	return size.Default, size.Max
+}
+
+// SoMaxConn implements inet.Stack.SoMaxConn.
+func (s *Stack) SoMaxConn() int {
+	if n := atomic.LoadInt32(&s.soMaxConn); n != 0 {
+		return int(n)
+	}
+	return inet.DefaultSoMaxConn
+}
+
+// SetSoMaxConn implements inet.Stack.SetSoMaxConn.
+func (s *Stack) SetSoMaxConn(n int) error {
+	// As in Linux before 5.4, the backlog is at most 65535. This also bounds
+	// the size of the accept queues netstack allocates.
+	if n <= 0 || n > math.MaxUint16 {
+		return syserror.EINVAL
+	}
+	atomic.StoreInt32(&s.soMaxConn, int32(n))
+	return nil
+}
+
+// PingGroupRange implements inet.Stack.PingGroupRange.
+func (s *Stack) PingGroupRange() (auth.KGID, auth.KGID) {
+	s.pingGroupMu.Lock()
+	defer s.pingGroupMu.Unlock()
+	if !s.pingGroupRangeSet {
+		return 0, inet.MaxPingGroup
+	}
+	return s.pingGroupLow, s.pingGroupHigh
+}
+
+// SetPingGroupRange implements inet.Stack.SetPingGroupRange.
+func (s *Stack) SetPingGroupRange(low, high auth.KGID) error {
+	if low > inet.MaxPingGroup || high > inet.MaxPingGroup {
+		return syserror.EINVAL
+	}
+	s.pingGroupMu.Lock()
+	defer s.pingGroupMu.Unlock()
+	s.pingGroupRangeSet = true
+	s.pingGroupLow = low
+	s.pingGroupHigh = high
+	return nil
+}
+
+// arpEndpoint returns the ARP endpoint of the interface idx.
+func (s *Stack) arpEndpoint(idx int32) (arp.PolicyEndpoint, error) {
+	ep, err := s.Stack.GetNetworkEndpoint(tcpip.NICID(idx), arp.ProtocolNumber)
+	if err != nil {
+		return nil, syserr.TranslateNetstackError(err).ToError()
+	}
+	arpEP, ok := ep.(arp.PolicyEndpoint)
+	if !ok {
+		return nil, syserror.EOPNOTSUPP
+	}
+	return arpEP, nil
+}
+
+// IPv4Conf implements inet.Stack.IPv4Conf.
+func (s *Stack) IPv4Conf(idx int32) (inet.IPv4Conf, error) {
+	ep, err := s.arpEndpoint(idx)
+	if err != nil {
+		return inet.IPv4Conf{}, err
+	}
+	p := ep.Policy()
+	logMartians, tcpipErr := s.Stack.LogMartians(tcpip.NICID(idx))
+	if tcpipErr != nil {
+		return inet.IPv4Conf{}, syserr.TranslateNetstackError(tcpipErr).ToError()
+	}
+	return inet.IPv4Conf{
+		ARPIgnore:   int(p.Ignore),
+		ARPAnnounce: int(p.Announce),
+		ARPFilter:   p.Filter,
+		LogMartians: logMartians,
+	}, nil
+}
+
+// SetIPv4Conf implements inet.Stack.SetIPv4Conf.
+func (s *Stack) SetIPv4Conf(idx int32, conf inet.IPv4Conf) error {
+	ep, err := s.arpEndpoint(idx)
+	if err != nil {
+		return err
+	}
+	if err := ep.SetPolicy(arp.Policy{
+		Ignore:   arp.IgnoreMode(conf.ARPIgnore),
+		Announce: arp.AnnounceMode(conf.ARPAnnounce),
+		Filter:   conf.ARPFilter,
+	}); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	if err := s.Stack.SetLogMartians(tcpip.NICID(idx), conf.LogMartians); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	return nil
+}
+
+// ipv6Endpoint is the IPv6 endpoint of an interface.
+type ipv6Endpoint interface {
+	ipv6.NDPEndpoint
+	ipv6.MTUEndpoint
+}
+
+// ipv6Endpoint returns the IPv6 endpoint of the interface idx.
+func (s *Stack) ipv6Endpoint(idx int32) (ipv6Endpoint, error) {
+	ep, err := s.Stack.GetNetworkEndpoint(tcpip.NICID(idx), ipv6.ProtocolNumber)
+	if err != nil {
+		return nil, syserr.TranslateNetstackError(err).ToError()
+	}
+	ipv6EP, ok := ep.(ipv6Endpoint)
+	if !ok {
+		return nil, syserror.EOPNOTSUPP
+	}
+	return ipv6EP, nil
+}
+
+// IPv6Conf implements inet.Stack.IPv6Conf.
+func (s *Stack) IPv6Conf(idx int32) (inet.IPv6Conf, error) {
+	ep, err := s.ipv6Endpoint(idx)
+	if err != nil {
+		return inet.IPv6Conf{}, err
+	}
+	c := ep.NDPConfigurations()
+	return inet.IPv6Conf{
+		AcceptRA:     c.HandleRAs,
+		Autoconf:     c.AutoGenGlobalAddresses,
+		DADTransmits: int(c.DupAddrDetectTransmits),
+		UseTempAddr:  c.AutoGenTempGlobalAddresses,
+		MTU:          ep.IPv6MTU(),
+	}, nil
+}
+
+// SetIPv6Conf implements inet.Stack.SetIPv6Conf.
+func (s *Stack) SetIPv6Conf(idx int32, conf inet.IPv6Conf) error {
+	if conf.DADTransmits < 0 || conf.DADTransmits > math.MaxUint8 {
+		return syserror.EINVAL
+	}
+	ep, err := s.ipv6Endpoint(idx)
+	if err != nil {
+		return err
+	}
+	// Only set the MTU when it changes, so that it keeps following the MTU
+	// of the link otherwise.
+	if conf.MTU != ep.IPv6MTU() {
+		if err := ep.SetIPv6MTU(conf.MTU); err != nil {
+			return syserr.TranslateNetstackError(err).ToError()
+		}
+	}
+	// The new configurations apply to the next NDP events, e.g. the next
+	// router advertisement or the next address added to the interface.
+	c := ep.NDPConfigurations()
+	c.HandleRAs = conf.AcceptRA
+	c.AutoGenGlobalAddresses = conf.Autoconf
+	c.DupAddrDetectTransmits = uint8(conf.DADTransmits)
+	c.AutoGenTempGlobalAddresses = conf.UseTempAddr
+	ep.SetNDPConfigurations(c)
+	return nil
+}
+
+// IPv6HopLimit implements inet.Stack.IPv6HopLimit.
+func (s *Stack) IPv6HopLimit() (int, error) {
+	var ttl tcpip.DefaultTTLOption
+	if err := s.Stack.NetworkProtocolOption(ipv6.ProtocolNumber, &ttl); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return int(ttl), nil
+}
+
+// SetIPv6HopLimit implements inet.Stack.SetIPv6HopLimit.
+func (s *Stack) SetIPv6HopLimit(hopLimit int) error {
+	if hopLimit < 1 || hopLimit > math.MaxUint8 {
+		return syserror.EINVAL
+	}
+	ttl := tcpip.DefaultTTLOption(hopLimit)
+	return syserr.TranslateNetstackError(s.Stack.SetNetworkProtocolOption(ipv6.ProtocolNumber, &ttl)).ToError()
+}
+
+// ICMPEchoEnableProbe implements inet.Stack.ICMPEchoEnableProbe.
+func (s *Stack) ICMPEchoEnableProbe() (bool, error) {
+	var enabled tcpip.ICMPEchoEnableProbeOption
+	err := s.Stack.NetworkProtocolOption(ipv4.ProtocolNumber, &enabled)
+	return bool(enabled), syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetICMPEchoEnableProbe implements inet.Stack.SetICMPEchoEnableProbe. As in
+// Linux, the setting applies to both ICMPv4 and ICMPv6.
+func (s *Stack) SetICMPEchoEnableProbe(enabled bool) error {
+	opt := tcpip.ICMPEchoEnableProbeOption(enabled)
+	for _, proto := range []tcpip.NetworkProtocolNumber{ipv4.ProtocolNumber, ipv6.ProtocolNumber} {
+		if err := s.Stack.SetNetworkProtocolOption(proto, &opt); err != nil {
+			return syserr.TranslateNetstackError(err).ToError()
+		}
+	}
+	return nil
+}
+
+// autoQDiscHandle is the handle given to queueing disciplines configured
+// without one, as in Linux.
+const autoQDiscHandle = 0x8001 << 16
+
+// qdiscEndpoint returns the link endpoint applying the queueing discipline of
+// interface idx.
+func (s *Stack) qdiscEndpoint(idx int32) (*qdisc.Endpoint, error) {
+	nic, ok := s.Stack.NICInfo()[tcpip.NICID(idx)]
+	if !ok {
+		return nil, syserror.ENODEV
+	}
+	ep, ok := s.Stack.GetLinkEndpointByName(nic.Name).(*qdisc.Endpoint)
+	if !ok {
+		// The interface doesn't queue packets.
+		return nil, syserror.EOPNOTSUPP
+	}
+	return ep, nil
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+func (s *Stack) QDiscs() map[int32]inet.QDisc {
+	qdiscs := make(map[int32]inet.QDisc)
+	for id, nic := range s.Stack.NICInfo() {
+		ep, ok := s.Stack.GetLinkEndpointByName(nic.Name).(*qdisc.Endpoint)
+		if !ok {
+			qdiscs[int32(id)] = inet.QDisc{Kind: "noqueue"}
+			continue
+		}
+		d, handle, stats := ep.Discipline()
+		q := inet.QDisc{
+			Kind:   d.Kind(),
+			Handle: handle,
+			Stats: inet.QDiscStats{
+				Packets:    stats.Packets,
+				Bytes:      stats.Bytes,
+				Drops:      stats.Drops,
+				Overlimits: stats.Overlimits,
+				QueueLen:   stats.QueueLen,
+				Backlog:    stats.Backlog,
+			},
+		}
+		switch d := d.(type) {
+		case *qdisc.FQCoDel:
+			opts := d.Options()
+			q.FQCoDel = inet.FQCoDelParams{
+				Target:   opts.Target,
+				Interval: opts.Interval,
+				Limit:    uint32(opts.Limit),
+				Flows:    uint32(opts.Flows),
+				Quantum:  uint32(opts.Quantum),
+			}
+		case *qdisc.TBF:
+			opts := d.Options()
+			q.TBF = inet.TBFParams{
+				Rate:  opts.Rate,
+				Burst: opts.Burst,
+				Limit: opts.Limit,
+			}
+		case *qdisc.PFIFO:
+			q.PFIFO = inet.PFIFOParams{Limit: uint32(d.Limit())}
+		case *qdisc.Netem:
+			opts := d.Options()
+			q.Netem = inet.NetemParams{
+				Latency:   opts.Latency,
+				Jitter:    opts.Jitter,
+				Loss:      opts.Loss,
+				Duplicate: opts.Duplicate,
+				Reorder:   opts.Reorder,
+				Gap:       opts.Gap,
+				Rate:      opts.Rate,
+				Limit:     uint32(opts.Limit),
+			}
+		case *qdisc.Prio:
+			opts := d.Options()
+			q.Prio = inet.PrioParams{
+				Bands:   uint32(opts.Bands),
+				PrioMap: opts.PrioMap,
+			}
+		case *qdisc.SFQ:
+			opts := d.Options()
+			q.SFQ = inet.SFQParams{
+				Quantum: uint32(opts.Quantum),
+				Limit:   uint32(opts.Limit),
+				Divisor: uint32(opts.Divisor),
+			}
+		}
+		qdiscs[int32(id)] = q
+	}
+	return qdiscs
+}
+
+// SetQDisc implements inet.Stack.SetQDisc.
+func (s *Stack) SetQDisc(idx int32, q inet.QDisc) error {
+	ep, err := s.qdiscEndpoint(idx)
+	if err != nil {
+		return err
+	}
+	var d qdisc.Discipline
+	switch q.Kind {
+	case "fq_codel":
+		opts := qdisc.DefaultFQCoDelOptions()
+		if q.FQCoDel.Target != 0 {
+			opts.Target = q.FQCoDel.Target
+		}
+		if q.FQCoDel.Interval != 0 {
+			opts.Interval = q.FQCoDel.Interval
+		}
+		if q.FQCoDel.Limit != 0 {
+			opts.Limit = int(q.FQCoDel.Limit)
+		}
+		if q.FQCoDel.Flows != 0 {
+			opts.Flows = int(q.FQCoDel.Flows)
+		}
+		if q.FQCoDel.Quantum != 0 {
+			opts.Quantum = int(q.FQCoDel.Quantum)
+		}
+		fq, err := qdisc.NewFQCoDel(opts)
+		if err != nil {
+			return syserror.EINVAL
+		}
+		d = fq
+	case "tbf":
+		tbf, err := qdisc.NewTBF(qdisc.TBFOptions{
+			Rate:  q.TBF.Rate,
+			Burst: q.TBF.Burst,
+			Limit: q.TBF.Limit,
+		})
+		if err != nil {
+			return syserror.EINVAL
+		}
+		d = tbf
+	case "pfifo":
+		limit := qdisc.DefaultPFIFOLimit
+		if q.PFIFO.Limit != 0 {
+			limit = int(q.PFIFO.Limit)
+		}
+		d = qdisc.NewPFIFO(limit)
+	case "netem":
+		limit := qdisc.DefaultPFIFOLimit
+		if q.Netem.Limit != 0 {
+			limit = int(q.Netem.Limit)
+		}
+		netem, err := qdisc.NewNetem(qdisc.NetemOptions{
+			Latency:   q.Netem.Latency,
+			Jitter:    q.Netem.Jitter,
+			Loss:      q.Netem.Loss,
+			Duplicate: q.Netem.Duplicate,
+			Reorder:   q.Netem.Reorder,
+			Gap:       q.Netem.Gap,
+			Rate:      q.Netem.Rate,
+			Limit:     limit,
+		}, s.Stack.Rand())
+		if err != nil {
+			return syserror.EINVAL
+		}
+		d = netem
+	case "prio":
+		opts := qdisc.DefaultPrioOptions
+		if q.Prio.Bands != 0 {
+			opts = qdisc.PrioOptions{
+				Bands:   int(q.Prio.Bands),
+				PrioMap: q.Prio.PrioMap,
+			}
+		}
+		prio, err := qdisc.NewPrio(opts)
+		if err != nil {
+			return syserror.EINVAL
+		}
+		d = prio
+	case "sfq":
+		opts := qdisc.DefaultSFQOptions()
+		if q.SFQ.Quantum != 0 {
+			opts.Quantum = int(q.SFQ.Quantum)
+		}
+		if q.SFQ.Limit != 0 {
+			opts.Limit = int(q.SFQ.Limit)
+		}
+		if q.SFQ.Divisor != 0 {
+			opts.Divisor = int(q.SFQ.Divisor)
+		}
+		sfq, err := qdisc.NewSFQ(opts)
+		if err != nil {
+			return syserror.EINVAL
+		}
+		d = sfq
+	default:
+		// Like Linux, report unknown disciplines as not found.
+		return syserror.ENOENT
+	}
+	handle := q.Handle
+	if handle == 0 {
+		handle = autoQDiscHandle
+	}
+	ep.SetDiscipline(d, handle)
+	return nil
+}
+
+// ResetQDisc implements inet.Stack.ResetQDisc.
+func (s *Stack) ResetQDisc(idx int32) error {
+	ep, err := s.qdiscEndpoint(idx)
+	if err != nil {
+		return err
+	}
+	ep.ResetDiscipline()
+	return nil
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat interface{}, arg string) error {
 	switch stats := stat.(type) {
@@ -279,19 +1028,19 @@ func (s *Stack) Statistics(stat interface{}, arg string) error {
 			// TODO(gvisor.dev/issue/2103) Support stubbed stats.
 			*stats = inet.StatDev{
 				// Receive section.
-				ni.Stats.Rx.Bytes.Value(),   // bytes.
-				ni.Stats.Rx.Packets.Value(), // packets.
-				0,                           // errs.
-				0,                           // drop.
-				0,                           // fifo.
-				0,                           // frame.
-				0,                           // compressed.
-				0,                           // multicast.
+				ni.Stats.Rx.Bytes.Value(),    // bytes.
+				ni.Stats.Rx.Packets.Value(),  // packets.
+				0,                            // errs.
+				ni.Stats.RxDropped.Value(),   // drop.
+				0,                            // fifo.
+				0,                            // frame.
+				0,                            // compressed.
+				ni.Stats.RxMulticast.Value(), // multicast.
 				// Transmit section.
 				ni.Stats.Tx.Bytes.Value(),   // bytes.
 				ni.Stats.Tx.Packets.Value(), // packets.
-				0,                           // errs.
-				0,                           // drop.
+				ni.Stats.TxErrors.Value(),   // errs.
+				ni.Stats.TxDropped.Value(),  // drop.
 				0,                           // fifo.
 				0,                           // colls.
 				0,                           // carrier.
@@ -399,7 +1148,17 @@ func (s *Stack) Statistics(stat interface{}, arg string) error {
 func (s *Stack) RouteTable() []inet.Route {
 	var routeTable []inet.Route
 
-	for _, rt := range s.Stack.GetRouteTable() {
+	// Always return unspecified protocol for the routes of the route table
+	// since we have no notion of protocol for them. Learned routes are
+	// learned from Router Advertisements.
+	routes := s.Stack.GetRouteTable()
+	learnedRoutes := s.Stack.GetLearnedRoutes()
+	for i, rt := range append(routes, learnedRoutes...) {
+		protocol := uint8(linux.RTPROT_UNSPEC)
+		if i >= len(routes) {
+			protocol = linux.RTPROT_RA
+		}
+
 		var family uint8
 		switch len(rt.Destination.ID()) {
 		case header.IPv4AddressSize:
@@ -414,10 +1173,9 @@ func (s *Stack) RouteTable() []inet.Route {
 		routeTable = append(routeTable, inet.Route{
 			Family: family,
 			DstLen: uint8(rt.Destination.Prefix()), // The CIDR prefix for the destination.
+			SrcLen: uint8(rt.Source.Prefix()),
 
-			// Always return unspecified protocol since we have no notion of
-			// protocol for routes.
-			Protocol: linux.RTPROT_UNSPEC,
+			Protocol: protocol,
 			// Set statically to LINK scope for now.
 			//
 			// TODO(gvisor.dev/issue/595): Set scope for routes.
@@ -425,6 +1183,7 @@ func (s *Stack) RouteTable() []inet.Route {
 			Type:  linux.RTN_UNICAST,
 
 			DstAddr:         []byte(rt.Destination.ID()),
+			SrcAddr:         []byte(rt.Source.ID()),
 			OutputInterface: int32(rt.NIC),
 			GatewayAddr:     []byte(rt.Gateway),
 		})
@@ -443,6 +1202,16 @@ func (s *Stack) Resume() {
 	s.Stack.Resume()
 }
 
+// PauseTimers implements inet.Stack.PauseTimers.
+func (s *Stack) PauseTimers() {
+	s.Stack.PauseTimers()
+}
+
+// ResumeTimers implements inet.Stack.ResumeTimers.
+func (s *Stack) ResumeTimers() {
+	s.Stack.ResumeTimers()
+}
+
 // RegisteredEndpoints implements inet.Stack.RegisteredEndpoints.
 func (s *Stack) RegisteredEndpoints() []stack.TransportEndpoint {
 	return s.Stack.RegisteredEndpoints()
@@ -478,3 +1247,45 @@ func (s *Stack) SetForwarding(protocol tcpip.NetworkProtocolNumber, enable bool)
 	}
 	return nil
 }
+
+// PortRange implements inet.Stack.PortRange.
+func (s *Stack) PortRange() (uint16, uint16) {
+	return s.Stack.PortRange()
+}
+
+// SetPortRange implements inet.Stack.SetPortRange.
+func (s *Stack) SetPortRange(start uint16, end uint16) error {
+	return syserr.TranslateNetstackError(s.Stack.SetPortRange(start, end)).ToError()
+}
+
+// LocalReservedPorts implements inet.Stack.LocalReservedPorts.
+func (s *Stack) LocalReservedPorts() []uint16 {
+	return s.Stack.LocalReservedPorts()
+}
+
+// SetLocalReservedPorts implements inet.Stack.SetLocalReservedPorts.
+func (s *Stack) SetLocalReservedPorts(ports []uint16) error {
+	s.Stack.SetLocalReservedPorts(ports)
+	return nil
+}
+
+// TransportMemoryLimits implements inet.Stack.TransportMemoryLimits.
+func (s *Stack) TransportMemoryLimits(protocol tcpip.TransportProtocolNumber) (inet.TransportMemoryLimits, error) {
+	var l tcpip.TransportMemoryLimitsOption
+	err := s.Stack.TransportProtocolOption(protocol, &l)
+	return inet.TransportMemoryLimits{
+		Min:      l.Min / usermem.PageSize,
+		Pressure: l.Pressure / usermem.PageSize,
+		Max:      l.Max / usermem.PageSize,
+	}, syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetTransportMemoryLimits implements inet.Stack.SetTransportMemoryLimits.
+func (s *Stack) SetTransportMemoryLimits(protocol tcpip.TransportProtocolNumber, limits inet.TransportMemoryLimits) error {
+	l := tcpip.TransportMemoryLimitsOption{
+		Min:      limits.Min * usermem.PageSize,
+		Pressure: limits.Pressure * usermem.PageSize,
+		Max:      limits.Max * usermem.PageSize,
+	}
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(protocol, &l)).ToError()
+}
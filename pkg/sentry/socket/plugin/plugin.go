@@ -0,0 +1,196 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin defines the interface between the sentry and third-party
+// network stacks, e.g. user-space stacks built on DPDK or VPP, which replace
+// netstack.
+//
+// A plugin stack is linked into the sentry and registered with Register from
+// an init function. When runsc is started with --network=plugin, the
+// registered stack becomes the stack of the root network namespace, and the
+// sockets of the families and types it supports are created by it. The socket
+// layer is unchanged: plugin sockets implement socket.Socket and
+// socket.SocketVFS2 like netstack and hostinet sockets do.
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/seccomp"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Capabilities is the set of features supported by a plugin stack.
+type Capabilities uint32
+
+// The following are the capabilities a plugin stack may have.
+const (
+	// CapabilityIPv6 indicates that AF_INET6 sockets are supported.
+	CapabilityIPv6 Capabilities = 1 << iota
+
+	// CapabilityTCP indicates that SOCK_STREAM sockets are supported.
+	CapabilityTCP
+
+	// CapabilityUDP indicates that SOCK_DGRAM sockets are supported.
+	CapabilityUDP
+
+	// CapabilityICMP indicates that unprivileged ICMP echo sockets are
+	// supported.
+	CapabilityICMP
+
+	// CapabilityRaw indicates that SOCK_RAW sockets are supported.
+	CapabilityRaw
+
+	// CapabilityPacket indicates that AF_PACKET sockets are supported.
+	CapabilityPacket
+
+	// CapabilitySaveRestore indicates that the stack and its sockets can be
+	// saved and restored.
+	CapabilitySaveRestore
+)
+
+var capabilityNames = []string{
+	"IPv6",
+	"TCP",
+	"UDP",
+	"ICMP",
+	"Raw",
+	"Packet",
+	"SaveRestore",
+}
+
+// String implements fmt.Stringer.
+func (c Capabilities) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+			c &^= 1 << uint(i)
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(c)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// InitStackArgs holds the arguments passed to Stack.Init.
+type InitStackArgs struct {
+	// Config is the configuration of the stack, as given to runsc with
+	// --network-plugin-config. Its format is defined by the stack.
+	Config string
+}
+
+// Stack is implemented by plugin network stacks.
+//
+// Interface and route configuration, sysctls and statistics are accessed
+// through the embedded inet.Stack, so /proc/net, /proc/sys/net and netlink
+// work as they do with netstack. In particular, Statistics must support the
+// same stat types as netstack's to populate /proc/net/snmp and
+// /proc/net/netstat.
+type Stack interface {
+	inet.Stack
+
+	// Name returns the name of the stack, used in logs.
+	Name() string
+
+	// Capabilities returns the features supported by the stack. Sockets which
+	// need a feature the stack doesn't have are not passed to it, and fail as
+	// if their family or protocol was unknown.
+	Capabilities() Capabilities
+
+	// Init initializes the stack. It is called once, when the root network
+	// namespace is created and before any host filters are installed.
+	Init(args *InitStackArgs) error
+
+	// PreStart is called before the first task of the sandbox is started,
+	// once the sandbox joined its network namespace.
+	PreStart() error
+
+	// SeccompRules returns the host syscalls the stack needs in addition to
+	// those of the sentry.
+	SeccompRules() seccomp.SyscallRules
+
+	// Socket creates a socket. Family, type and protocol are as passed to
+	// socket(2), with the type flags removed; Capabilities has been checked
+	// to support them. If the protocol isn't supported, Socket returns nil
+	// and a nil error.
+	Socket(t *kernel.Task, family int, stype linux.SockType, protocol int, nonblocking bool) (*fs.File, *syserr.Error)
+
+	// SocketVFS2 is the VFS2 equivalent of Socket.
+	SocketVFS2(t *kernel.Task, family int, stype linux.SockType, protocol int, nonblocking bool) (*vfs.FileDescription, *syserr.Error)
+}
+
+// registered is the registered plugin stack.
+var registered Stack
+
+// Register registers the plugin stack s. It must be called at most once, from
+// an init function.
+func Register(s Stack) {
+	if registered != nil {
+		panic(fmt.Sprintf("plugin stack %q registered after %q", s.Name(), registered.Name()))
+	}
+	registered = s
+}
+
+// Registered returns the registered plugin stack, or nil if none was
+// registered.
+func Registered() Stack {
+	return registered
+}
+
+// Supports returns true if a stack with capabilities caps can create sockets
+// of the given family, type and protocol.
+func (c Capabilities) Supports(family int, stype linux.SockType, protocol int) bool {
+	switch family {
+	case linux.AF_INET:
+	case linux.AF_INET6:
+		if c&CapabilityIPv6 == 0 {
+			return false
+		}
+	case linux.AF_PACKET:
+		return c&CapabilityPacket != 0
+	default:
+		return false
+	}
+
+	switch stype {
+	case linux.SOCK_STREAM:
+		return c&CapabilityTCP != 0 && (protocol == 0 || protocol == syscall.IPPROTO_TCP)
+	case linux.SOCK_DGRAM:
+		switch protocol {
+		case 0, syscall.IPPROTO_UDP:
+			return c&CapabilityUDP != 0
+		case syscall.IPPROTO_ICMP:
+			return family == linux.AF_INET && c&CapabilityICMP != 0
+		case syscall.IPPROTO_ICMPV6:
+			return family == linux.AF_INET6 && c&CapabilityICMP != 0
+		}
+		return false
+	case linux.SOCK_RAW:
+		return c&CapabilityRaw != 0
+	default:
+		return false
+	}
+}
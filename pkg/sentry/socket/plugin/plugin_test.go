@@ -0,0 +1,73 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"syscall"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+func TestCapabilitiesSupports(t *testing.T) {
+	const tcpUDP = CapabilityTCP | CapabilityUDP
+	for _, tc := range []struct {
+		name     string
+		caps     Capabilities
+		family   int
+		stype    linux.SockType
+		protocol int
+		want     bool
+	}{
+		{"TCPv4", tcpUDP, linux.AF_INET, linux.SOCK_STREAM, 0, true},
+		{"TCPv4 explicit protocol", tcpUDP, linux.AF_INET, linux.SOCK_STREAM, syscall.IPPROTO_TCP, true},
+		{"SCTP", tcpUDP, linux.AF_INET, linux.SOCK_STREAM, syscall.IPPROTO_SCTP, false},
+		{"TCPv4 without TCP", CapabilityUDP, linux.AF_INET, linux.SOCK_STREAM, 0, false},
+		{"UDPv4", tcpUDP, linux.AF_INET, linux.SOCK_DGRAM, syscall.IPPROTO_UDP, true},
+		{"TCPv6 without IPv6", tcpUDP, linux.AF_INET6, linux.SOCK_STREAM, 0, false},
+		{"TCPv6", tcpUDP | CapabilityIPv6, linux.AF_INET6, linux.SOCK_STREAM, 0, true},
+		{"ICMPv4 without ICMP", tcpUDP, linux.AF_INET, linux.SOCK_DGRAM, syscall.IPPROTO_ICMP, false},
+		{"ICMPv4", CapabilityICMP, linux.AF_INET, linux.SOCK_DGRAM, syscall.IPPROTO_ICMP, true},
+		{"ICMPv6 over IPv4", CapabilityICMP, linux.AF_INET, linux.SOCK_DGRAM, syscall.IPPROTO_ICMPV6, false},
+		{"ICMPv6", CapabilityICMP | CapabilityIPv6, linux.AF_INET6, linux.SOCK_DGRAM, syscall.IPPROTO_ICMPV6, true},
+		{"raw without Raw", tcpUDP, linux.AF_INET, linux.SOCK_RAW, syscall.IPPROTO_UDP, false},
+		{"raw", CapabilityRaw, linux.AF_INET, linux.SOCK_RAW, syscall.IPPROTO_UDP, true},
+		{"packet without Packet", tcpUDP | CapabilityRaw, linux.AF_PACKET, linux.SOCK_RAW, 0, false},
+		{"packet", CapabilityPacket, linux.AF_PACKET, linux.SOCK_DGRAM, 0, true},
+		{"seqpacket", ^Capabilities(0), linux.AF_INET, linux.SOCK_SEQPACKET, 0, false},
+		{"unix", ^Capabilities(0), linux.AF_UNIX, linux.SOCK_STREAM, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.caps.Supports(tc.family, tc.stype, tc.protocol); got != tc.want {
+				t.Errorf("%s.Supports(%d, %d, %d) = %t, want = %t", tc.caps, tc.family, tc.stype, tc.protocol, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesString(t *testing.T) {
+	for _, tc := range []struct {
+		caps Capabilities
+		want string
+	}{
+		{0, "none"},
+		{CapabilityTCP | CapabilityUDP, "TCP|UDP"},
+		{CapabilityIPv6 | 1<<31, "IPv6|0x80000000"},
+	} {
+		if got := tc.caps.String(); got != tc.want {
+			t.Errorf("Capabilities(%#x).String() = %q, want = %q", uint32(tc.caps), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// stackFor returns the plugin stack of t's network namespace if it is able to
+// create sockets of the given family, type and protocol.
+func stackFor(t *kernel.Task, family int, stype linux.SockType, protocol int) Stack {
+	s, ok := t.NetworkContext().(Stack)
+	if !ok || !s.Capabilities().Supports(family, stype, protocol) {
+		return nil
+	}
+	return s
+}
+
+// provider is an inet socket provider backed by a plugin stack.
+type provider struct {
+	family int
+}
+
+// Socket implements socket.Provider.Socket.
+func (p *provider) Socket(t *kernel.Task, stypeflags linux.SockType, protocol int) (*fs.File, *syserr.Error) {
+	stype := stypeflags & linux.SOCK_TYPE_MASK
+	s := stackFor(t, p.family, stype, protocol)
+	if s == nil {
+		return nil, nil
+	}
+	return s.Socket(t, p.family, stype, protocol, stypeflags&linux.SOCK_NONBLOCK != 0)
+}
+
+// Pair implements socket.Provider.Pair.
+func (*provider) Pair(*kernel.Task, linux.SockType, int) (*fs.File, *fs.File, *syserr.Error) {
+	// Not supported by AF_INET/AF_INET6/AF_PACKET.
+	return nil, nil, nil
+}
+
+// providerVFS2 is the VFS2 equivalent of provider.
+type providerVFS2 struct {
+	family int
+}
+
+// Socket implements socket.ProviderVFS2.Socket.
+func (p *providerVFS2) Socket(t *kernel.Task, stypeflags linux.SockType, protocol int) (*vfs.FileDescription, *syserr.Error) {
+	stype := stypeflags & linux.SOCK_TYPE_MASK
+	s := stackFor(t, p.family, stype, protocol)
+	if s == nil {
+		return nil, nil
+	}
+	return s.SocketVFS2(t, p.family, stype, protocol, stypeflags&linux.SOCK_NONBLOCK != 0)
+}
+
+// Pair implements socket.ProviderVFS2.Pair.
+func (*providerVFS2) Pair(*kernel.Task, linux.SockType, int) (*vfs.FileDescription, *vfs.FileDescription, *syserr.Error) {
+	// Not supported by AF_INET/AF_INET6/AF_PACKET.
+	return nil, nil, nil
+}
+
+func init() {
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6, syscall.AF_PACKET} {
+		socket.RegisterProvider(family, &provider{family})
+		socket.RegisterProviderVFS2(family, &providerVFS2{family})
+	}
+}
@@ -382,7 +382,6 @@ func SetSockOptEmitUnimplementedEvent(t *kernel.Task, name int) {
 		linux.SO_ATTACH_REUSEPORT_EBPF,
 		linux.SO_CNX_ADVICE,
 		linux.SO_DETACH_FILTER,
-		linux.SO_RCVBUFFORCE,
 		linux.SO_SNDBUFFORCE:
 
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -400,7 +399,6 @@ func emitUnimplementedEvent(t *kernel.Task, name int) {
 	case linux.SO_BINDTODEVICE,
 		linux.SO_BROADCAST,
 		linux.SO_BSDCOMPAT,
-		linux.SO_BUSY_POLL,
 		linux.SO_DEBUG,
 		linux.SO_DONTROUTE,
 		linux.SO_INCOMING_CPU,
@@ -458,6 +456,10 @@ func UnmarshalSockAddr(family int, data []byte) linux.SockAddr {
 		var addr linux.SockAddrNetlink
 		binary.Unmarshal(data[:syscall.SizeofSockaddrNetlink], usermem.ByteOrder, &addr)
 		return &addr
+	case syscall.AF_PACKET:
+		var addr linux.SockAddrLink
+		binary.Unmarshal(data[:syscall.SizeofSockaddrLinklayer], usermem.ByteOrder, &addr)
+		return &addr
 	default:
 		panic(fmt.Sprintf("Unsupported socket family %v", family))
 	}
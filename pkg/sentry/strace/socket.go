@@ -525,21 +525,22 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.SO_ORIGINAL_DST:           "SO_ORIGINAL_DST",
 	},
 	linux.SOL_SOCKET: {
-		linux.SO_ERROR:        "SO_ERROR",
-		linux.SO_PEERCRED:     "SO_PEERCRED",
-		linux.SO_PASSCRED:     "SO_PASSCRED",
-		linux.SO_SNDBUF:       "SO_SNDBUF",
-		linux.SO_RCVBUF:       "SO_RCVBUF",
-		linux.SO_REUSEADDR:    "SO_REUSEADDR",
-		linux.SO_REUSEPORT:    "SO_REUSEPORT",
-		linux.SO_BINDTODEVICE: "SO_BINDTODEVICE",
-		linux.SO_BROADCAST:    "SO_BROADCAST",
-		linux.SO_KEEPALIVE:    "SO_KEEPALIVE",
-		linux.SO_LINGER:       "SO_LINGER",
-		linux.SO_SNDTIMEO:     "SO_SNDTIMEO",
-		linux.SO_RCVTIMEO:     "SO_RCVTIMEO",
-		linux.SO_OOBINLINE:    "SO_OOBINLINE",
-		linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
+		linux.SO_ERROR:         "SO_ERROR",
+		linux.SO_PEERCRED:      "SO_PEERCRED",
+		linux.SO_PASSCRED:      "SO_PASSCRED",
+		linux.SO_SNDBUF:        "SO_SNDBUF",
+		linux.SO_RCVBUF:        "SO_RCVBUF",
+		linux.SO_REUSEADDR:     "SO_REUSEADDR",
+		linux.SO_REUSEPORT:     "SO_REUSEPORT",
+		linux.SO_BINDTODEVICE:  "SO_BINDTODEVICE",
+		linux.SO_BINDTOIFINDEX: "SO_BINDTOIFINDEX",
+		linux.SO_BROADCAST:     "SO_BROADCAST",
+		linux.SO_KEEPALIVE:     "SO_KEEPALIVE",
+		linux.SO_LINGER:        "SO_LINGER",
+		linux.SO_SNDTIMEO:      "SO_SNDTIMEO",
+		linux.SO_RCVTIMEO:      "SO_RCVTIMEO",
+		linux.SO_OOBINLINE:     "SO_OOBINLINE",
+		linux.SO_TIMESTAMP:     "SO_TIMESTAMP",
 	},
 	linux.SOL_TCP: {
 		linux.TCP_NODELAY:              "TCP_NODELAY",
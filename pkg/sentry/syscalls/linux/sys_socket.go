@@ -38,7 +38,8 @@ import (
 // minListenBacklog is the minimum reasonable backlog for listening sockets.
 const minListenBacklog = 8
 
-// maxListenBacklog is the maximum allowed backlog for listening sockets.
+// maxListenBacklog is the maximum allowed backlog for listening sockets,
+// unless the network stack sets another one.
 const maxListenBacklog = 1024
 
 // maxAddrLen is the maximum socket address length we're willing to accept.
@@ -383,11 +384,15 @@ func Listen(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	}
 
 	// Per Linux, the backlog is silently capped to reasonable values.
+	maxBacklog := int32(maxListenBacklog)
+	if stack := t.NetworkContext(); stack != nil {
+		maxBacklog = int32(stack.SoMaxConn())
+	}
 	if backlog <= 0 {
 		backlog = minListenBacklog
 	}
-	if backlog > maxListenBacklog {
-		backlog = maxListenBacklog
+	if backlog > maxBacklog {
+		backlog = maxBacklog
 	}
 
 	return 0, nil, s.Listen(t, int(backlog)).ToError()
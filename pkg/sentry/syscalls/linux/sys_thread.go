@@ -23,6 +23,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fsbridge"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
@@ -483,6 +484,40 @@ func Unshare(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	return 0, nil, t.Unshare(&opts)
 }
 
+// Setns implements Linux syscall setns(2). Only network namespaces are
+// supported.
+func Setns(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	nstype := args[1].Int()
+
+	if nstype != 0 && nstype != linux.CLONE_NEWNET {
+		return 0, nil, syserror.EINVAL
+	}
+
+	file := t.GetFile(fd)
+	if file == nil {
+		return 0, nil, syserror.EBADF
+	}
+	defer file.DecRef(t)
+
+	nsFile, ok := file.FileOperations.(inet.NamespaceFile)
+	if !ok {
+		return 0, nil, syserror.EINVAL
+	}
+	ns := nsFile.NetworkNamespace()
+	if ns == nil {
+		return 0, nil, syserror.EINVAL
+	}
+
+	// "Reassociating the calling thread with a network namespace requires
+	// that the caller have the CAP_SYS_ADMIN capability" - setns(2)
+	if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+		return 0, nil, syserror.EPERM
+	}
+	t.SetNetworkNamespace(ns)
+	return 0, nil, nil
+}
+
 // SchedYield implements linux syscall sched_yield(2).
 func SchedYield(t *kernel.Task, _ arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	t.Yield()
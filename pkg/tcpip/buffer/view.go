@@ -216,6 +216,17 @@ func (vv *VectorisedView) Size() int {
 	return vv.size
 }
 
+// MemSize returns the size in bytes of the memory backing the views of the
+// vectorised view, which may exceed Size when the views are larger than the
+// content they hold.
+func (vv *VectorisedView) MemSize() int {
+	var size int
+	for _, v := range vv.views {
+		size += cap(v)
+	}
+	return size
+}
+
 // ToView returns a single view containing the content of the vectorised view.
 //
 // If the vectorised view contains a single view, that view will be returned
@@ -237,6 +248,15 @@ func (vv *VectorisedView) ToOwnedView() View {
 	return u
 }
 
+// First returns the first view of the vectorised view, or nil if it is empty.
+// The returned view shares its backing storage with vv.
+func (vv *VectorisedView) First() View {
+	if len(vv.views) == 0 {
+		return nil
+	}
+	return vv.views[0]
+}
+
 // Views returns the slice containing the all views.
 func (vv *VectorisedView) Views() []View {
 	return vv.views
@@ -191,6 +191,46 @@ func TestToView(t *testing.T) {
 	}
 }
 
+func TestMemSize(t *testing.T) {
+	v := NewView(10)
+	vv := NewVectorisedView(14, []View{v[:6], make(View, 4, 8), NewView(4)})
+	if got, want := vv.MemSize(), 10+8+4; got != want {
+		t.Errorf("got vv.MemSize() = %d, want = %d", got, want)
+	}
+	vv.TrimFront(6)
+	if got, want := vv.MemSize(), 8+4; got != want {
+		t.Errorf("got vv.MemSize() = %d after TrimFront, want = %d", got, want)
+	}
+}
+
+func TestFirst(t *testing.T) {
+	for _, c := range []struct {
+		comment string
+		in      VectorisedView
+		want    View
+	}{
+		{
+			comment: "Empty",
+			in:      vv(0),
+			want:    nil,
+		},
+		{
+			comment: "Single view",
+			in:      vv(2, "12"),
+			want:    View("12"),
+		},
+		{
+			comment: "Multiple views",
+			in:      vv(3, "12", "3"),
+			want:    View("12"),
+		},
+	} {
+		if got := c.in.First(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Test %q failed when calling First() on %v. Got %v. Want %v", c.comment, c.in, got, c.want)
+		}
+	}
+}
+
 var toCloneCases = []struct {
 	comment  string
 	inView   VectorisedView
@@ -0,0 +1,215 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clsbpf classifies the packets of NICs with eBPF programs, like the
+// bpf classifier of tc in direct action mode on Linux.
+package clsbpf
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf/ebpf"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Classifier is a stack.PacketClassifier running an eBPF program for each
+// packet, with a struct __sk_buff context. Packets start at their network
+// header, like on Linux devices without a link layer, and can't be modified.
+//
+// The program returns a TC_ACT_* action. Packets are dropped with TC_ACT_SHOT
+// and redirected with the bpf_redirect helper. Programs which fail let packets
+// through.
+type Classifier struct {
+	p *ebpf.Program
+
+	// errors is the number of failed runs. It is accessed atomically.
+	errors uint64
+}
+
+var _ stack.PacketClassifier = (*Classifier)(nil)
+
+// New creates a new Classifier running p.
+func New(p *ebpf.Program) *Classifier {
+	return &Classifier{p: p}
+}
+
+// Program returns the program run by c.
+func (c *Classifier) Program() *ebpf.Program {
+	return c.p
+}
+
+// Errors returns the number of runs of the program which failed.
+func (c *Classifier) Errors() uint64 {
+	return atomic.LoadUint64(&c.errors)
+}
+
+// skbContext is the context of a run, struct __sk_buff.
+type skbContext struct {
+	id       tcpip.NICID
+	at       stack.TCAttachPoint
+	protocol tcpip.NetworkProtocolNumber
+	len      int
+	mark     uint32
+	priority uint32
+	cb       [linux.SKBuffCBSize / 4]uint32
+
+	// redirect, if not nil, is the verdict set by bpf_redirect.
+	redirect *stack.TCVerdict
+}
+
+// field returns a pointer to the writable field at off, or the value of the
+// read-only field at off.
+func (ctx *skbContext) field(off int) (*uint32, uint64, bool) {
+	switch {
+	case off == linux.SKBuffLen:
+		return nil, uint64(ctx.len), true
+	case off == linux.SKBuffPktType:
+		if ctx.at == stack.TCEgress {
+			return nil, uint64(tcpip.PacketOutgoing), true
+		}
+		return nil, uint64(tcpip.PacketHost), true
+	case off == linux.SKBuffMark:
+		return &ctx.mark, 0, true
+	case off == linux.SKBuffProtocol:
+		// The protocol is in network byte order.
+		return nil, uint64(bits.ReverseBytes16(uint16(ctx.protocol))), true
+	case off == linux.SKBuffPriority:
+		return &ctx.priority, 0, true
+	case off == linux.SKBuffIngressIfindex:
+		if ctx.at == stack.TCIngress {
+			return nil, uint64(ctx.id), true
+		}
+		return nil, 0, true
+	case off == linux.SKBuffIfindex:
+		return nil, uint64(ctx.id), true
+	case off >= linux.SKBuffCB && off < linux.SKBuffCB+linux.SKBuffCBSize:
+		return &ctx.cb[(off-linux.SKBuffCB)/4], 0, true
+	case off == linux.SKBuffQueueMapping, off == linux.SKBuffVlanPresent, off == linux.SKBuffVlanTCI, off == linux.SKBuffVlanProto, off == linux.SKBuffTCIndex, off == linux.SKBuffHash, off == linux.SKBuffTCClassID:
+		return nil, 0, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// Load implements ebpf.Context.Load.
+func (ctx *skbContext) Load(off, size int) (uint64, bool) {
+	switch off {
+	case linux.SKBuffData:
+		return ebpf.PacketAddress(0), size == 4
+	case linux.SKBuffDataEnd:
+		return ebpf.PacketAddress(ctx.len), size == 4
+	}
+	// Fields can be partially loaded.
+	if size > 4 || off%size != 0 {
+		return 0, false
+	}
+	p, v, ok := ctx.field(off &^ 3)
+	if !ok {
+		return 0, false
+	}
+	if p != nil {
+		v = uint64(*p)
+	}
+	v >>= uint(off&3) * 8
+	return v & (1<<(uint(size)*8) - 1), true
+}
+
+// Store implements ebpf.Context.Store.
+func (ctx *skbContext) Store(off, size int, v uint64) bool {
+	if size != 4 || off%4 != 0 {
+		return false
+	}
+	p, _, ok := ctx.field(off)
+	if !ok || p == nil {
+		return false
+	}
+	*p = uint32(v)
+	return true
+}
+
+// helpers are the helpers available to classifiers.
+var helpers = map[int32]ebpf.Helper{
+	linux.BPF_FUNC_redirect:       redirect,
+	linux.BPF_FUNC_skb_load_bytes: skbLoadBytes,
+}
+
+// redirect implements bpf_redirect(ifindex, flags).
+func redirect(m *ebpf.Machine, args [5]uint64) (uint64, error) {
+	ctx := m.Env().Context.(*skbContext)
+	if args[1]&^linux.BPF_F_INGRESS != 0 {
+		return uint64(linux.TC_ACT_SHOT), nil
+	}
+	ctx.redirect = &stack.TCVerdict{
+		Action:          stack.TCRedirect,
+		RedirectNIC:     tcpip.NICID(uint32(args[0])),
+		RedirectIngress: args[1]&linux.BPF_F_INGRESS != 0,
+	}
+	return uint64(linux.TC_ACT_REDIRECT), nil
+}
+
+// skbLoadBytes implements bpf_skb_load_bytes(skb, offset, to, len).
+func skbLoadBytes(m *ebpf.Machine, args [5]uint64) (uint64, error) {
+	off, n := uint64(uint32(args[1])), int(uint32(args[3]))
+	to, ok := m.Memory(args[2], n, true)
+	if !ok {
+		return 0, fmt.Errorf("bpf_skb_load_bytes to invalid memory")
+	}
+	pkt := m.Env().Packet
+	if off+uint64(n) > uint64(len(pkt)) {
+		return uint64(-int64(syscall.EFAULT)), nil
+	}
+	copy(to, pkt[off:])
+	return 0, nil
+}
+
+// Classify implements stack.PacketClassifier.Classify.
+func (c *Classifier) Classify(id tcpip.NICID, at stack.TCAttachPoint, pkt *stack.PacketBuffer) stack.TCVerdict {
+	data := stack.PayloadSince(pkt.NetworkHeader())
+	ctx := skbContext{
+		id:       id,
+		at:       at,
+		protocol: pkt.NetworkProtocolNumber,
+		len:      len(data),
+		priority: pkt.Priority,
+	}
+	ret, err := c.p.Run(&ebpf.Env{
+		Context: &ctx,
+		Packet:  data,
+		Helpers: helpers,
+	})
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		return stack.TCVerdict{Action: stack.TCPass}
+	}
+	pkt.Priority = ctx.priority
+
+	switch int32(ret) {
+	case linux.TC_ACT_SHOT, linux.TC_ACT_STOLEN, linux.TC_ACT_QUEUED, linux.TC_ACT_TRAP:
+		return stack.TCVerdict{Action: stack.TCDrop}
+	case linux.TC_ACT_REDIRECT:
+		// Like on Linux, packets are dropped if the program didn't
+		// call bpf_redirect.
+		if ctx.redirect == nil {
+			return stack.TCVerdict{Action: stack.TCDrop}
+		}
+		return *ctx.redirect
+	default:
+		return stack.TCVerdict{Action: stack.TCPass}
+	}
+}
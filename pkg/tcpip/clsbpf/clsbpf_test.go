@@ -0,0 +1,135 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clsbpf_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf/ebpf"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/clsbpf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func insn(op uint8, dst, src uint8, off int16, imm int32) linux.BPFInsn {
+	return linux.BPFInsn{OpCode: op, Regs: dst | src<<4, Off: off, Imm: imm}
+}
+
+func udpPacket(dstPort uint16) *stack.PacketBuffer {
+	v := buffer.NewView(header.IPv4MinimumSize + header.UDPMinimumSize)
+	header.IPv4(v).Encode(&header.IPv4Fields{
+		TotalLength: uint16(len(v)),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     tcpip.Address("\x0a\x00\x00\x01"),
+		DstAddr:     tcpip.Address("\x0a\x00\x00\x02"),
+	})
+	header.UDP(v[header.IPv4MinimumSize:]).Encode(&header.UDPFields{
+		SrcPort: 1000,
+		DstPort: dstPort,
+		Length:  header.UDPMinimumSize,
+	})
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: v.ToVectorisedView(),
+	})
+	pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+	return pkt
+}
+
+func TestDropDNS(t *testing.T) {
+	// Drop UDP packets to port 53, with direct packet access.
+	p, err := ebpf.Compile([]linux.BPFInsn{
+		insn(ebpf.Ldx|ebpf.Mem|ebpf.W, ebpf.R2, ebpf.R1, linux.SKBuffData, 0),
+		insn(ebpf.Ldx|ebpf.Mem|ebpf.W, ebpf.R3, ebpf.R1, linux.SKBuffDataEnd, 0),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.X, ebpf.R4, ebpf.R2, 0, 0),
+		insn(ebpf.Alu64|ebpf.Add|ebpf.K, ebpf.R4, 0, 0, header.IPv4MinimumSize+4),
+		insn(ebpf.Jmp|ebpf.Jgt|ebpf.X, ebpf.R4, ebpf.R3, 6, 0),
+		insn(ebpf.Ldx|ebpf.Mem|ebpf.B, ebpf.R5, ebpf.R2, 9, 0),
+		insn(ebpf.Jmp|ebpf.Jne|ebpf.K, ebpf.R5, 0, 4, int32(header.UDPProtocolNumber)),
+		insn(ebpf.Ldx|ebpf.Mem|ebpf.H, ebpf.R5, ebpf.R2, header.IPv4MinimumSize+2, 0),
+		insn(ebpf.Jmp|ebpf.Jne|ebpf.K, ebpf.R5, 0, 2, 0x3500),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.K, ebpf.R0, 0, 0, linux.TC_ACT_SHOT),
+		insn(ebpf.Jmp|ebpf.Exit, 0, 0, 0, 0),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.K, ebpf.R0, 0, 0, linux.TC_ACT_OK),
+		insn(ebpf.Jmp|ebpf.Exit, 0, 0, 0, 0),
+	}, nil)
+	if err != nil {
+		t.Fatalf("ebpf.Compile(_, nil): %s", err)
+	}
+	c := clsbpf.New(p)
+
+	for _, test := range []struct {
+		port uint16
+		want stack.TCAction
+	}{
+		{port: 53, want: stack.TCDrop},
+		{port: 80, want: stack.TCPass},
+	} {
+		if got := c.Classify(1, stack.TCIngress, udpPacket(test.port)); got.Action != test.want {
+			t.Errorf("got Classify(1, TCIngress, _) = %+v for port %d, want action %d", got, test.port, test.want)
+		}
+	}
+	if got := c.Errors(); got != 0 {
+		t.Errorf("got %d errors, want 0", got)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	// Set the priority of packets, and redirect them to the ingress of NIC
+	// 2.
+	p, err := ebpf.Compile([]linux.BPFInsn{
+		insn(ebpf.St|ebpf.Mem|ebpf.W, ebpf.R1, 0, linux.SKBuffPriority, 6),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.K, ebpf.R1, 0, 0, 2),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.K, ebpf.R2, 0, 0, linux.BPF_F_INGRESS),
+		insn(ebpf.Jmp|ebpf.Call, 0, 0, 0, linux.BPF_FUNC_redirect),
+		insn(ebpf.Jmp|ebpf.Exit, 0, 0, 0, 0),
+	}, nil)
+	if err != nil {
+		t.Fatalf("ebpf.Compile(_, nil): %s", err)
+	}
+
+	pkt := udpPacket(80)
+	got := clsbpf.New(p).Classify(1, stack.TCEgress, pkt)
+	want := stack.TCVerdict{Action: stack.TCRedirect, RedirectNIC: 2, RedirectIngress: true}
+	if got != want {
+		t.Errorf("got Classify(1, TCEgress, _) = %+v, want = %+v", got, want)
+	}
+	if pkt.Priority != 6 {
+		t.Errorf("got packet priority = %d, want = 6", pkt.Priority)
+	}
+}
+
+func TestFailedProgramPasses(t *testing.T) {
+	// Write to the read-only packet.
+	p, err := ebpf.Compile([]linux.BPFInsn{
+		insn(ebpf.Ldx|ebpf.Mem|ebpf.W, ebpf.R2, ebpf.R1, linux.SKBuffData, 0),
+		insn(ebpf.St|ebpf.Mem|ebpf.B, ebpf.R2, 0, 0, 0),
+		insn(ebpf.Alu64|ebpf.Mov|ebpf.K, ebpf.R0, 0, 0, linux.TC_ACT_SHOT),
+		insn(ebpf.Jmp|ebpf.Exit, 0, 0, 0, 0),
+	}, nil)
+	if err != nil {
+		t.Fatalf("ebpf.Compile(_, nil): %s", err)
+	}
+	c := clsbpf.New(p)
+	if got := c.Classify(1, stack.TCIngress, udpPacket(80)); got.Action != stack.TCPass {
+		t.Errorf("got Classify(1, TCIngress, _) = %+v, want action %d", got, stack.TCPass)
+	}
+	if got := c.Errors(); got != 1 {
+		t.Errorf("got %d errors, want 1", got)
+	}
+}
@@ -0,0 +1,497 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dhcp implements a DHCPv4 client and server, as per RFC 2131, on top
+// of a netstack stack.
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// maxRetransmission is the upper bound of the exponential backoff applied to
+// retransmissions, as per RFC 2131 section 4.1.
+const maxRetransmission = 64 * time.Second
+
+// errTimeout is returned when no acceptable reply arrives before a deadline.
+var errTimeout = errors.New("timed out waiting for a DHCP reply")
+
+// parameterRequestList is the list of options requested from servers.
+var parameterRequestList = []byte{
+	byte(header.DHCPv4OptionSubnetMask),
+	byte(header.DHCPv4OptionRouter),
+	byte(header.DHCPv4OptionDomainNameServer),
+	byte(header.DHCPv4OptionIPAddressLeaseTime),
+	byte(header.DHCPv4OptionRenewalTime),
+	byte(header.DHCPv4OptionRebindingTime),
+}
+
+// Config is the configuration handed out by a DHCP server with a lease.
+type Config struct {
+	// ServerAddress is the identifier of the server that granted the lease.
+	ServerAddress tcpip.Address
+
+	// SubnetMask is the mask of the subnet the leased address belongs to.
+	SubnetMask tcpip.AddressMask
+
+	// Routers are the default gateways, in order of preference.
+	Routers []tcpip.Address
+
+	// DNS are the DNS servers, in order of preference.
+	DNS []tcpip.Address
+
+	// LeaseLength is the length of the lease.
+	LeaseLength time.Duration
+
+	// RenewalTime is the time after which the client asks the server that
+	// granted the lease to extend it (T1).
+	RenewalTime time.Duration
+
+	// RebindingTime is the time after which the client asks any server to
+	// extend the lease (T2).
+	RebindingTime time.Duration
+}
+
+// decode fills c from the options of a DHCPOFFER or DHCPACK. It returns false
+// if a mandatory option is missing.
+func (c *Config) decode(opts header.DHCPv4Options) bool {
+	var ok bool
+	if c.ServerAddress, ok = opts.Address(header.DHCPv4OptionServerIdentifier); !ok {
+		return false
+	}
+	if c.LeaseLength, ok = opts.Duration(header.DHCPv4OptionIPAddressLeaseTime); !ok {
+		return false
+	}
+	if mask, ok := opts.Address(header.DHCPv4OptionSubnetMask); ok {
+		c.SubnetMask = tcpip.AddressMask(mask)
+	}
+	c.Routers, _ = opts.Addresses(header.DHCPv4OptionRouter)
+	c.DNS, _ = opts.Addresses(header.DHCPv4OptionDomainNameServer)
+	if c.RenewalTime, ok = opts.Duration(header.DHCPv4OptionRenewalTime); !ok {
+		c.RenewalTime = c.LeaseLength / 2
+	}
+	if c.RebindingTime, ok = opts.Duration(header.DHCPv4OptionRebindingTime); !ok {
+		c.RebindingTime = c.LeaseLength * 7 / 8
+	}
+	return true
+}
+
+// prefixLen returns the prefix length of the leased subnet, which is the
+// address itself when the server did not hand out a mask.
+func (c *Config) prefixLen() int {
+	if len(c.SubnetMask) != header.IPv4AddressSize {
+		return header.IPv4AddressSize * 8
+	}
+	return c.SubnetMask.Prefix()
+}
+
+// AcquiredFunc is called when the client acquires, renews or loses a lease.
+// oldAddr is the previously leased address, if any, and newAddr is the newly
+// leased address, which is empty when the lease is lost.
+type AcquiredFunc func(oldAddr, newAddr tcpip.AddressWithPrefix, cfg Config)
+
+// clientState is the state of a client, as per RFC 2131 figure 5.
+type clientState int
+
+const (
+	initSelecting clientState = iota
+	bound
+	renewing
+	rebinding
+)
+
+// Client is a DHCPv4 client of a single NIC.
+//
+// The client installs the leased address on the NIC together with a route to
+// the leased subnet and default routes through the routers handed out by the
+// server. They are removed when the lease is lost or the client stops.
+type Client struct {
+	stack          *stack.Stack
+	nicID          tcpip.NICID
+	linkAddr       tcpip.LinkAddress
+	retransmission time.Duration
+	acquiredFunc   AcquiredFunc
+
+	mu     sync.Mutex
+	addr   tcpip.AddressWithPrefix
+	config Config
+	routes []tcpip.Route
+}
+
+// NewClient creates a DHCP client for the NIC nicID of s, whose link address
+// is linkAddr. Messages are first retransmitted after retransmission, then
+// with an exponential backoff. acquiredFunc, if not nil, is called whenever the
+// leased address changes or is renewed.
+func NewClient(s *stack.Stack, nicID tcpip.NICID, linkAddr tcpip.LinkAddress, retransmission time.Duration, acquiredFunc AcquiredFunc) *Client {
+	return &Client{
+		stack:          s,
+		nicID:          nicID,
+		linkAddr:       linkAddr,
+		retransmission: retransmission,
+		acquiredFunc:   acquiredFunc,
+	}
+}
+
+// Info returns the leased address and the configuration that came with it.
+// The address is empty if the client holds no lease.
+func (c *Client) Info() (tcpip.AddressWithPrefix, Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addr, c.config
+}
+
+// Run acquires a lease and keeps it until ctx is done, at which point the lease
+// is released. It only returns an error if the client could not listen for
+// replies.
+func (c *Client) Run(ctx context.Context) *tcpip.Error {
+	var wq waiter.Queue
+	ep, err := c.stack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		return err
+	}
+	defer ep.Close()
+	ep.SocketOptions().SetBroadcast(true)
+	bindToDevice := tcpip.BindToDeviceOption(c.nicID)
+	if err := ep.SetSockOpt(&bindToDevice); err != nil {
+		return err
+	}
+	if err := ep.Bind(tcpip.FullAddress{Port: header.DHCPv4ClientPort}); err != nil {
+		return err
+	}
+	waitEntry, inCh := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&waitEntry, waiter.EventIn)
+	defer wq.EventUnregister(&waitEntry)
+
+	clock := c.stack.Clock()
+	state := initSelecting
+	// acquired is the monotonic time at which the current lease was granted.
+	var acquired int64
+	for {
+		addr, cfg := c.Info()
+		var err error
+		switch state {
+		case initSelecting:
+			var start int64
+			start, addr, cfg, err = c.acquire(ctx, ep, inCh)
+			if err != nil {
+				// Only a cancellation ends the acquisition.
+				return nil
+			}
+			acquired = start
+			c.install(addr, cfg)
+			state = bound
+
+		case bound:
+			if err := c.sleep(ctx, c.until(acquired, cfg.RenewalTime)); err != nil {
+				c.release(ep, addr, cfg)
+				return nil
+			}
+			state = renewing
+
+		case renewing, rebinding:
+			dst, timeout := cfg.ServerAddress, cfg.RebindingTime
+			if state == rebinding {
+				dst, timeout = header.IPv4Broadcast, cfg.LeaseLength
+			}
+			start := clock.NowMonotonic()
+			var reply header.DHCPv4
+			var opts header.DHCPv4Options
+			reply, opts, err = c.exchange(ctx, ep, inCh, addr.Address, dst, c.request(c.xid(), addr.Address, "", ""), c.until(acquired, timeout))
+			switch {
+			case err == errTimeout && state == renewing:
+				state = rebinding
+			case err == errTimeout:
+				// The lease expired.
+				c.install(tcpip.AddressWithPrefix{}, Config{})
+				state = initSelecting
+			case err != nil:
+				c.release(ep, addr, cfg)
+				return nil
+			default:
+				var newCfg Config
+				if typ, _ := opts.MessageType(); typ == header.DHCPv4Nak || !newCfg.decode(opts) {
+					c.install(tcpip.AddressWithPrefix{}, Config{})
+					state = initSelecting
+					break
+				}
+				acquired = start
+				c.install(tcpip.AddressWithPrefix{Address: reply.YourAddress(), PrefixLen: newCfg.prefixLen()}, newCfg)
+				state = bound
+			}
+		}
+	}
+}
+
+// until returns the time left until d after the monotonic time start.
+func (c *Client) until(start int64, d time.Duration) time.Duration {
+	return time.Duration(start-c.stack.Clock().NowMonotonic()) + d
+}
+
+// xid returns a new transaction ID.
+func (c *Client) xid() uint32 {
+	return c.stack.Rand().Uint32()
+}
+
+// acquire runs the DISCOVER/OFFER/REQUEST/ACK exchange until a lease is
+// granted or ctx is done. It returns the monotonic time at which the lease
+// was requested.
+func (c *Client) acquire(ctx context.Context, ep tcpip.Endpoint, inCh <-chan struct{}) (int64, tcpip.AddressWithPrefix, Config, error) {
+	for {
+		xid := c.xid()
+		discover := c.message(header.DHCPv4Discover, xid, "",
+			header.DHCPv4Option{Code: header.DHCPv4OptionParameterRequestList, Data: parameterRequestList},
+		)
+		// There is no deadline for an offer, the client keeps asking.
+		offer, offerOpts, err := c.exchange(ctx, ep, inCh, header.IPv4Any, header.IPv4Broadcast, discover, math.MaxInt64)
+		if err != nil {
+			return 0, tcpip.AddressWithPrefix{}, Config{}, err
+		}
+		var offerCfg Config
+		if typ, _ := offerOpts.MessageType(); typ != header.DHCPv4Offer || !offerCfg.decode(offerOpts) {
+			continue
+		}
+
+		start := c.stack.Clock().NowMonotonic()
+		request := c.request(xid, "", offer.YourAddress(), offerCfg.ServerAddress)
+		ack, ackOpts, err := c.exchange(ctx, ep, inCh, header.IPv4Any, header.IPv4Broadcast, request, maxRetransmission)
+		switch err {
+		case nil:
+		case errTimeout:
+			continue
+		default:
+			return 0, tcpip.AddressWithPrefix{}, Config{}, err
+		}
+		var cfg Config
+		if typ, _ := ackOpts.MessageType(); typ != header.DHCPv4Ack || !cfg.decode(ackOpts) {
+			continue
+		}
+		return start, tcpip.AddressWithPrefix{Address: ack.YourAddress(), PrefixLen: cfg.prefixLen()}, cfg, nil
+	}
+}
+
+// message builds a client message.
+func (c *Client) message(typ header.DHCPv4MessageType, xid uint32, clientAddr tcpip.Address, opts ...header.DHCPv4Option) header.DHCPv4 {
+	fields := header.DHCPv4Fields{
+		Op:                    header.DHCPv4BootRequest,
+		XID:                   xid,
+		ClientAddress:         clientAddr,
+		ClientHardwareAddress: c.linkAddr,
+		// Until an address is configured, replies can't be unicast to the
+		// client.
+		Broadcast: len(clientAddr) == 0,
+		Options:   append(header.DHCPv4Options{header.DHCPv4MessageTypeOption(typ)}, opts...),
+	}
+	msg := header.DHCPv4(make([]byte, header.DHCPv4Size(fields.Options)))
+	msg.Encode(&fields)
+	return msg
+}
+
+// request builds a DHCPREQUEST. A client selecting an offer sets
+// requestedAddr and serverAddr, a client extending its lease sets clientAddr.
+func (c *Client) request(xid uint32, clientAddr, requestedAddr, serverAddr tcpip.Address) header.DHCPv4 {
+	opts := []header.DHCPv4Option{
+		{Code: header.DHCPv4OptionParameterRequestList, Data: parameterRequestList},
+	}
+	if len(requestedAddr) != 0 {
+		opts = append(opts,
+			header.DHCPv4AddressesOption(header.DHCPv4OptionRequestedIPAddress, requestedAddr),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionServerIdentifier, serverAddr),
+		)
+	}
+	return c.message(header.DHCPv4Request, xid, clientAddr, opts...)
+}
+
+// exchange sends msg from src to dst until a reply to it arrives, ctx is done
+// or timeout elapses. Retransmissions back off exponentially.
+func (c *Client) exchange(ctx context.Context, ep tcpip.Endpoint, inCh <-chan struct{}, src, dst tcpip.Address, msg header.DHCPv4, timeout time.Duration) (header.DHCPv4, header.DHCPv4Options, error) {
+	if timeout <= 0 {
+		return nil, nil, errTimeout
+	}
+	timeoutCh, timeoutTimer := c.after(timeout)
+	defer timeoutTimer.Stop()
+
+	retransmission := c.retransmission
+	for {
+		// A message that could not be sent is handled like a lost one.
+		_ = c.send(ep, src, dst, msg)
+
+		retransmitCh, retransmitTimer := c.after(retransmission)
+		for retransmitCh != nil {
+			select {
+			case <-ctx.Done():
+				retransmitTimer.Stop()
+				return nil, nil, ctx.Err()
+			case <-timeoutCh:
+				retransmitTimer.Stop()
+				return nil, nil, errTimeout
+			case <-retransmitCh:
+				retransmitCh = nil
+			case <-inCh:
+				if reply, opts, ok := c.read(ep, msg.XID()); ok {
+					retransmitTimer.Stop()
+					return reply, opts, nil
+				}
+			}
+		}
+		if retransmission *= 2; retransmission > maxRetransmission {
+			retransmission = maxRetransmission
+		}
+	}
+}
+
+// read reads the queued messages until it finds a reply to the transaction
+// xid of this client.
+func (c *Client) read(ep tcpip.Endpoint, xid uint32) (header.DHCPv4, header.DHCPv4Options, bool) {
+	for {
+		v, _, err := ep.Read(nil)
+		if err != nil {
+			return nil, nil, false
+		}
+		reply := header.DHCPv4(v)
+		if !reply.IsValid() || reply.Op() != header.DHCPv4BootReply || reply.XID() != xid || reply.ClientHardwareAddress() != c.linkAddr {
+			continue
+		}
+		opts, ok := reply.Options()
+		if !ok {
+			continue
+		}
+		if _, ok := opts.MessageType(); !ok {
+			continue
+		}
+		return reply, opts, true
+	}
+}
+
+// send sends msg from src to dst. Broadcasts are written directly to the link
+// as the client may not have an address to send them from yet.
+func (c *Client) send(ep tcpip.Endpoint, src, dst tcpip.Address, msg header.DHCPv4) *tcpip.Error {
+	if dst != header.IPv4Broadcast {
+		_, _, err := ep.Write(tcpip.SlicePayload(msg), tcpip.WriteOptions{
+			To: &tcpip.FullAddress{NIC: c.nicID, Addr: dst, Port: header.DHCPv4ServerPort},
+		})
+		return err
+	}
+
+	hdr := buffer.NewView(header.IPv4MinimumSize + header.UDPMinimumSize)
+	length := uint16(len(hdr) + len(msg))
+	ip := header.IPv4(hdr)
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: length,
+		TTL:         ipv4.DefaultTTL,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	udpLength := length - header.IPv4MinimumSize
+	u := header.UDP(hdr[header.IPv4MinimumSize:])
+	u.Encode(&header.UDPFields{
+		SrcPort: header.DHCPv4ClientPort,
+		DstPort: header.DHCPv4ServerPort,
+		Length:  udpLength,
+	})
+	xsum := header.PseudoHeaderChecksum(header.UDPProtocolNumber, src, dst, udpLength)
+	u.SetChecksum(^u.CalculateChecksum(header.Checksum(msg, xsum)))
+	vv := buffer.NewVectorisedView(int(length), []buffer.View{hdr, buffer.View(msg)})
+	return c.stack.WritePacketToRemote(c.nicID, header.EthernetBroadcastAddress, ipv4.ProtocolNumber, vv)
+}
+
+// after returns a channel that is closed after d.
+func (c *Client) after(d time.Duration) (<-chan struct{}, tcpip.Timer) {
+	ch := make(chan struct{})
+	return ch, c.stack.Clock().AfterFunc(d, func() { close(ch) })
+}
+
+// sleep waits for d to elapse or ctx to be done, in which case it returns
+// ctx.Err().
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	ch, timer := c.after(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ch:
+		return nil
+	}
+}
+
+// release gives the lease back to the server and removes the leased address.
+func (c *Client) release(ep tcpip.Endpoint, addr tcpip.AddressWithPrefix, cfg Config) {
+	if len(addr.Address) == 0 {
+		return
+	}
+	msg := c.message(header.DHCPv4Release, c.xid(), addr.Address,
+		header.DHCPv4AddressesOption(header.DHCPv4OptionServerIdentifier, cfg.ServerAddress),
+	)
+	_ = c.send(ep, addr.Address, cfg.ServerAddress, msg)
+	c.install(tcpip.AddressWithPrefix{}, Config{})
+}
+
+// install replaces the leased address and the routes that came with it, and
+// reports the change. An empty addr removes the lease.
+func (c *Client) install(addr tcpip.AddressWithPrefix, cfg Config) {
+	c.mu.Lock()
+	oldAddr, oldRoutes := c.addr, c.routes
+	c.addr, c.config, c.routes = addr, cfg, nil
+	if len(addr.Address) != 0 {
+		c.routes = append(c.routes, tcpip.Route{Destination: addr.Subnet(), NIC: c.nicID})
+		for _, router := range cfg.Routers {
+			c.routes = append(c.routes, tcpip.Route{Destination: header.IPv4EmptySubnet, Gateway: router, NIC: c.nicID})
+		}
+	}
+	routes := c.routes
+	c.mu.Unlock()
+
+	c.stack.RemoveRoutes(func(r tcpip.Route) bool {
+		for _, old := range oldRoutes {
+			if r == old {
+				return true
+			}
+		}
+		return false
+	})
+	if oldAddr != addr {
+		if len(oldAddr.Address) != 0 {
+			_ = c.stack.RemoveAddress(c.nicID, oldAddr.Address)
+		}
+		if len(addr.Address) != 0 {
+			_ = c.stack.AddProtocolAddress(c.nicID, tcpip.ProtocolAddress{
+				Protocol:          ipv4.ProtocolNumber,
+				AddressWithPrefix: addr,
+			})
+		}
+	}
+	for _, r := range routes {
+		c.stack.AddRoute(r)
+	}
+
+	if c.acquiredFunc != nil {
+		c.acquiredFunc(oldAddr, addr, cfg)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/dhcp"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// leaseLength is the length of the leases handed out to the client, which
+// renews them after half of it and rebinds them after seven eighths of it.
+const leaseLength = 100 * time.Second
+
+var (
+	leasedAddr = tcpip.AddressWithPrefix{Address: poolAddr, PrefixLen: subnetMask.Prefix()}
+	leasedCfg  = dhcp.Config{
+		ServerAddress: serverAddr,
+		SubnetMask:    subnetMask,
+		LeaseLength:   leaseLength,
+		RenewalTime:   leaseLength / 2,
+		RebindingTime: leaseLength * 7 / 8,
+	}
+)
+
+// timerClock is a manual clock which reports the duration of the timers set on
+// it, so that tests only advance it once the client waits for it.
+type timerClock struct {
+	*faketime.ManualClock
+	timers chan time.Duration
+}
+
+// AfterFunc implements tcpip.Clock.AfterFunc.
+func (c *timerClock) AfterFunc(d time.Duration, f func()) tcpip.Timer {
+	timer := c.ManualClock.AfterFunc(d, f)
+	c.timers <- d
+	return timer
+}
+
+// clientTest runs a client against a server scripted by the test.
+type clientTest struct {
+	t        *testing.T
+	clock    *timerClock
+	acquired chan acquisition
+
+	ep   tcpip.Endpoint
+	inCh <-chan struct{}
+}
+
+// newClientTest starts a client which first retransmits its messages after
+// retransmission.
+func newClientTest(t *testing.T, retransmission time.Duration) *clientTest {
+	t.Helper()
+
+	clock := &timerClock{
+		ManualClock: faketime.NewManualClock(),
+		timers:      make(chan time.Duration, 100),
+	}
+	clientStack, serverStack := newStacks(t, clock)
+
+	var wq waiter.Queue
+	ep, err := serverStack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("serverStack.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	t.Cleanup(ep.Close)
+	ep.SocketOptions().SetBroadcast(true)
+	ep.SocketOptions().SetReceivePacketInfo(true)
+	if err := ep.Bind(tcpip.FullAddress{Port: header.DHCPv4ServerPort}); err != nil {
+		t.Fatalf("ep.Bind(_): %s", err)
+	}
+	waitEntry, inCh := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&waitEntry, waiter.EventIn)
+	t.Cleanup(func() { wq.EventUnregister(&waitEntry) })
+
+	c := &clientTest{
+		t:        t,
+		clock:    clock,
+		acquired: make(chan acquisition, 10),
+		ep:       ep,
+		inCh:     inCh,
+	}
+	client := dhcp.NewClient(clientStack, nicID, clientLinkAddr, retransmission, func(oldAddr, newAddr tcpip.AddressWithPrefix, cfg dhcp.Config) {
+		c.acquired <- acquisition{oldAddr: oldAddr, newAddr: newAddr, cfg: cfg}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := client.Run(ctx); err != nil {
+			t.Errorf("client.Run(_): %s", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return c
+}
+
+// recv returns the next message of the client, which must be of type typ, and
+// the address it was sent to.
+func (c *clientTest) recv(typ header.DHCPv4MessageType) (header.DHCPv4, tcpip.Address) {
+	c.t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		v, cm, err := c.ep.Read(nil)
+		if err == tcpip.ErrWouldBlock {
+			select {
+			case <-c.inCh:
+				continue
+			case <-deadline:
+				c.t.Fatalf("timed out waiting for a %s", typ)
+			}
+		}
+		if err != nil {
+			c.t.Fatalf("ep.Read(nil): %s", err)
+		}
+		msg := header.DHCPv4(v)
+		opts, ok := msg.Options()
+		if !msg.IsValid() || !ok {
+			c.t.Fatalf("got invalid message %x", v)
+		}
+		if got, _ := opts.MessageType(); got != typ {
+			c.t.Fatalf("got %s, want %s", got, typ)
+		}
+		return msg, cm.PacketInfo.DestinationAddr
+	}
+}
+
+// reply sends a reply of type typ to msg, leasing addr for leaseLength.
+func (c *clientTest) reply(msg header.DHCPv4, typ header.DHCPv4MessageType, addr tcpip.Address) {
+	c.t.Helper()
+
+	opts := header.DHCPv4Options{
+		header.DHCPv4MessageTypeOption(typ),
+		header.DHCPv4AddressesOption(header.DHCPv4OptionServerIdentifier, serverAddr),
+	}
+	if typ != header.DHCPv4Nak {
+		opts = append(opts,
+			header.DHCPv4DurationOption(header.DHCPv4OptionIPAddressLeaseTime, leaseLength),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionSubnetMask, tcpip.Address(subnetMask)),
+		)
+	}
+	fields := header.DHCPv4Fields{
+		Op:                    header.DHCPv4BootReply,
+		XID:                   msg.XID(),
+		YourAddress:           addr,
+		ClientHardwareAddress: msg.ClientHardwareAddress(),
+		Options:               opts,
+	}
+	reply := header.DHCPv4(make([]byte, header.DHCPv4Size(fields.Options)))
+	reply.Encode(&fields)
+	to := tcpip.FullAddress{NIC: nicID, Addr: header.IPv4Broadcast, Port: header.DHCPv4ClientPort}
+	if _, _, err := c.ep.Write(tcpip.SlicePayload(reply), tcpip.WriteOptions{To: &to}); err != nil {
+		c.t.Fatalf("ep.Write(_, %#v): %s", to, err)
+	}
+}
+
+// waitTimer waits for the client to set a timer of duration d.
+func (c *clientTest) waitTimer(d time.Duration) {
+	c.t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case got := <-c.clock.timers:
+			if got == d {
+				return
+			}
+		case <-deadline:
+			c.t.Fatalf("timed out waiting for a %s timer", d)
+		}
+	}
+}
+
+// waitAcquisition waits for the client to report want.
+func (c *clientTest) waitAcquisition(want acquisition) {
+	c.t.Helper()
+
+	select {
+	case got := <-c.acquired:
+		if diff := cmp.Diff(want, got, cmp.AllowUnexported(got)); diff != "" {
+			c.t.Fatalf("acquisition mismatch (-want +got):\n%s", diff)
+		}
+	case <-time.After(timeout):
+		c.t.Fatalf("timed out waiting for %#v", want)
+	}
+}
+
+// acquire leases leasedAddr to the client, and waits for it to sleep until
+// the renewal time.
+func (c *clientTest) acquire() {
+	c.t.Helper()
+
+	discover, _ := c.recv(header.DHCPv4Discover)
+	c.reply(discover, header.DHCPv4Offer, poolAddr)
+	request, _ := c.recv(header.DHCPv4Request)
+	c.reply(request, header.DHCPv4Ack, poolAddr)
+	c.waitAcquisition(acquisition{newAddr: leasedAddr, cfg: leasedCfg})
+	c.waitTimer(leasedCfg.RenewalTime)
+}
+
+func TestClientRetransmissionBackoff(t *testing.T) {
+	c := newClientTest(t, time.Second)
+
+	discover, _ := c.recv(header.DHCPv4Discover)
+	for _, d := range []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		16 * time.Second,
+		32 * time.Second,
+		// The backoff is capped.
+		64 * time.Second,
+		64 * time.Second,
+	} {
+		c.waitTimer(d)
+		c.clock.Advance(d)
+		msg, dst := c.recv(header.DHCPv4Discover)
+		if msg.XID() != discover.XID() {
+			t.Fatalf("got retransmission with XID %d, want = %d", msg.XID(), discover.XID())
+		}
+		if dst != header.IPv4Broadcast {
+			t.Fatalf("got retransmission sent to %s, want = %s", dst, header.IPv4Broadcast)
+		}
+	}
+}
+
+func TestClientNak(t *testing.T) {
+	// Messages are only sent once during the test.
+	c := newClientTest(t, time.Hour)
+	c.acquire()
+
+	c.clock.Advance(leasedCfg.RenewalTime)
+	request, dst := c.recv(header.DHCPv4Request)
+	if got := request.ClientAddress(); got != poolAddr {
+		t.Errorf("got renewal for %s, want = %s", got, poolAddr)
+	}
+	if dst != serverAddr {
+		t.Errorf("got renewal sent to %s, want = %s", dst, serverAddr)
+	}
+
+	// The address is given up at once, and a new one is asked for.
+	c.reply(request, header.DHCPv4Nak, "")
+	c.waitAcquisition(acquisition{oldAddr: leasedAddr})
+	c.recv(header.DHCPv4Discover)
+}
+
+func TestClientRebinding(t *testing.T) {
+	c := newClientTest(t, time.Hour)
+	c.acquire()
+
+	// The server that granted the lease doesn't answer the renewal, so any
+	// server is asked to extend it at the rebinding time.
+	c.clock.Advance(leasedCfg.RenewalTime)
+	if _, dst := c.recv(header.DHCPv4Request); dst != serverAddr {
+		t.Errorf("got renewal sent to %s, want = %s", dst, serverAddr)
+	}
+	c.waitTimer(time.Hour)
+	c.clock.Advance(leasedCfg.RebindingTime - leasedCfg.RenewalTime)
+	request, dst := c.recv(header.DHCPv4Request)
+	if got := request.ClientAddress(); got != poolAddr {
+		t.Errorf("got rebinding for %s, want = %s", got, poolAddr)
+	}
+	if dst != header.IPv4Broadcast {
+		t.Errorf("got rebinding sent to %s, want = %s", dst, header.IPv4Broadcast)
+	}
+
+	c.reply(request, header.DHCPv4Ack, poolAddr)
+	c.waitAcquisition(acquisition{oldAddr: leasedAddr, newAddr: leasedAddr, cfg: leasedCfg})
+	// The lease was extended from the time the rebinding started.
+	c.waitTimer(leasedCfg.RenewalTime)
+}
+
+func TestClientLeaseExpiry(t *testing.T) {
+	c := newClientTest(t, time.Hour)
+	c.acquire()
+
+	c.clock.Advance(leasedCfg.RenewalTime)
+	c.recv(header.DHCPv4Request)
+	c.waitTimer(time.Hour)
+	c.clock.Advance(leasedCfg.RebindingTime - leasedCfg.RenewalTime)
+	c.recv(header.DHCPv4Request)
+	c.waitTimer(time.Hour)
+
+	// Without an answer, the lease expires and the client starts over.
+	c.clock.Advance(leasedCfg.LeaseLength - leasedCfg.RebindingTime)
+	c.waitAcquisition(acquisition{oldAddr: leasedAddr})
+	c.recv(header.DHCPv4Discover)
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/dhcp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/pipe"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	nicID = 1
+
+	clientLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x01")
+	serverLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x02")
+
+	serverAddr = tcpip.Address("\xc0\xa8\x00\x01")
+	poolAddr   = tcpip.Address("\xc0\xa8\x00\x0a")
+	staticAddr = tcpip.Address("\xc0\xa8\x00\x14")
+	dnsAddr    = tcpip.Address("\x08\x08\x08\x08")
+	subnetMask = tcpip.AddressMask("\xff\xff\xff\x00")
+
+	timeout = 5 * time.Second
+)
+
+type acquisition struct {
+	oldAddr, newAddr tcpip.AddressWithPrefix
+	cfg              dhcp.Config
+}
+
+// newStacks returns a client and a server stack linked together. The client
+// stack uses clientClock, or the system clock if it is nil.
+func newStacks(t *testing.T, clientClock tcpip.Clock) (*stack.Stack, *stack.Stack) {
+	t.Helper()
+
+	opts := stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	}
+	serverStack := stack.New(opts)
+	opts.Clock = clientClock
+	clientStack := stack.New(opts)
+	clientNIC, serverNIC := pipe.New(clientLinkAddr, serverLinkAddr)
+	if err := clientStack.CreateNIC(nicID, clientNIC); err != nil {
+		t.Fatalf("clientStack.CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := serverStack.CreateNIC(nicID, serverNIC); err != nil {
+		t.Fatalf("serverStack.CreateNIC(%d, _): %s", nicID, err)
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{Address: serverAddr, PrefixLen: subnetMask.Prefix()},
+	}
+	if err := serverStack.AddProtocolAddress(nicID, protocolAddr); err != nil {
+		t.Fatalf("serverStack.AddProtocolAddress(%d, %#v): %s", nicID, protocolAddr, err)
+	}
+	serverStack.SetRouteTable([]tcpip.Route{{Destination: protocolAddr.AddressWithPrefix.Subnet(), NIC: nicID}})
+	return clientStack, serverStack
+}
+
+func TestClientServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		static   bool
+		wantAddr tcpip.Address
+	}{
+		{
+			name:     "pool",
+			wantAddr: poolAddr,
+		},
+		{
+			name:     "reservation",
+			static:   true,
+			wantAddr: staticAddr,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientStack, serverStack := newStacks(t, nil /* clientClock */)
+
+			config := dhcp.ServerConfig{
+				ServerAddress: serverAddr,
+				SubnetMask:    subnetMask,
+				Pool:          []tcpip.Address{poolAddr},
+				// T1 is one second in, so the lease is renewed during the
+				// test.
+				LeaseLength: 2 * time.Second,
+				Options: header.DHCPv4Options{
+					header.DHCPv4AddressesOption(header.DHCPv4OptionRouter, serverAddr),
+					header.DHCPv4AddressesOption(header.DHCPv4OptionDomainNameServer, dnsAddr),
+				},
+			}
+			if test.static {
+				config.Reservations = map[tcpip.LinkAddress]tcpip.Address{clientLinkAddr: staticAddr}
+			}
+			server, err := dhcp.NewServer(serverStack, nicID, config)
+			if err != nil {
+				t.Fatalf("dhcp.NewServer(_, %d, %#v): %s", nicID, config, err)
+			}
+			serverCtx, serverCancel := context.WithCancel(context.Background())
+			defer serverCancel()
+			go server.Run(serverCtx)
+
+			acquired := make(chan acquisition, 10)
+			client := dhcp.NewClient(clientStack, nicID, clientLinkAddr, 100*time.Millisecond, func(oldAddr, newAddr tcpip.AddressWithPrefix, cfg dhcp.Config) {
+				acquired <- acquisition{oldAddr: oldAddr, newAddr: newAddr, cfg: cfg}
+			})
+			clientCtx, clientCancel := context.WithCancel(context.Background())
+			clientDone := make(chan *tcpip.Error, 1)
+			go func() {
+				clientDone <- client.Run(clientCtx)
+			}()
+			defer func() {
+				clientCancel()
+				<-clientDone
+			}()
+
+			wantAddr := tcpip.AddressWithPrefix{Address: test.wantAddr, PrefixLen: subnetMask.Prefix()}
+			wantCfg := dhcp.Config{
+				ServerAddress: serverAddr,
+				SubnetMask:    subnetMask,
+				Routers:       []tcpip.Address{serverAddr},
+				DNS:           []tcpip.Address{dnsAddr},
+				LeaseLength:   config.LeaseLength,
+				RenewalTime:   config.LeaseLength / 2,
+				RebindingTime: config.LeaseLength * 7 / 8,
+			}
+			for _, want := range []acquisition{
+				{newAddr: wantAddr, cfg: wantCfg},
+				// Renewing the lease keeps the address.
+				{oldAddr: wantAddr, newAddr: wantAddr, cfg: wantCfg},
+			} {
+				select {
+				case got := <-acquired:
+					if diff := cmp.Diff(want, got, cmp.AllowUnexported(got)); diff != "" {
+						t.Fatalf("acquisition mismatch (-want +got):\n%s", diff)
+					}
+				case <-time.After(timeout):
+					t.Fatalf("timed out waiting for %#v", want)
+				}
+				if got, err := clientStack.GetMainNICAddress(nicID, ipv4.ProtocolNumber); err != nil || got != wantAddr {
+					t.Errorf("got clientStack.GetMainNICAddress(%d, %d) = (%s, %v), want = (%s, nil)", nicID, ipv4.ProtocolNumber, got, err, wantAddr)
+				}
+			}
+			if diff := cmp.Diff(map[tcpip.LinkAddress]tcpip.Address{clientLinkAddr: test.wantAddr}, server.Leases()); diff != "" {
+				t.Errorf("server.Leases() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]tcpip.Route{
+				{Destination: wantAddr.Subnet(), NIC: nicID},
+				{Destination: header.IPv4EmptySubnet, Gateway: serverAddr, NIC: nicID},
+			}, clientStack.GetRouteTable()); diff != "" {
+				t.Errorf("clientStack.GetRouteTable() mismatch (-want +got):\n%s", diff)
+			}
+
+			// Stopping the client releases the lease.
+			clientCancel()
+			if err := <-clientDone; err != nil {
+				t.Fatalf("client.Run(_): %s", err)
+			}
+			clientDone <- nil
+			if got := <-acquired; got.newAddr != (tcpip.AddressWithPrefix{}) {
+				t.Errorf("got new address %s after release, want none", got.newAddr)
+			}
+			if got, err := clientStack.GetMainNICAddress(nicID, ipv4.ProtocolNumber); err != nil || got != (tcpip.AddressWithPrefix{}) {
+				t.Errorf("got clientStack.GetMainNICAddress(%d, %d) = (%s, %v), want = (%s, nil)", nicID, ipv4.ProtocolNumber, got, err, tcpip.AddressWithPrefix{})
+			}
+			if got := clientStack.GetRouteTable(); len(got) != 0 {
+				t.Errorf("got clientStack.GetRouteTable() = %s, want = []", got)
+			}
+			for deadline := time.Now().Add(timeout); len(server.Leases()) != 0; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatalf("got server.Leases() = %s after release, want = {}", server.Leases())
+				}
+			}
+		})
+	}
+}
+
+func TestNewServerInvalidPool(t *testing.T) {
+	_, serverStack := newStacks(t, nil /* clientClock */)
+	for _, addr := range []tcpip.Address{
+		serverAddr,
+		"\xc0\xa8\x00\x00",
+		"\xc0\xa8\x00\xff",
+		"\xc0\xa8\x01\x0a",
+	} {
+		config := dhcp.ServerConfig{
+			ServerAddress: serverAddr,
+			SubnetMask:    subnetMask,
+			Pool:          []tcpip.Address{addr},
+			LeaseLength:   time.Hour,
+		}
+		if _, err := dhcp.NewServer(serverStack, nicID, config); err == nil {
+			t.Errorf("got dhcp.NewServer(_, %d, _) = (_, nil) with pool address %s, want error", nicID, addr)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// offerHoldTime is how long an offered address is held for the client it was
+// offered to.
+const offerHoldTime = time.Minute
+
+// ServerConfig is the configuration of a Server.
+type ServerConfig struct {
+	// ServerAddress is the address of the server. It must be assigned to the
+	// NIC the server runs on.
+	ServerAddress tcpip.Address
+
+	// SubnetMask is the mask of the subnet addresses are leased in.
+	SubnetMask tcpip.AddressMask
+
+	// Pool is the set of addresses leased to clients without a reservation.
+	Pool []tcpip.Address
+
+	// Reservations maps the link address of clients to the address always
+	// leased to them. Reserved addresses need not be in Pool.
+	Reservations map[tcpip.LinkAddress]tcpip.Address
+
+	// LeaseLength is the length of the leases.
+	LeaseLength time.Duration
+
+	// Options are handed out with leases, e.g. routers and DNS servers.
+	// Options managed by the server, such as the lease time, are ignored.
+	Options header.DHCPv4Options
+}
+
+// lease is an address leased, or offered, to a client.
+type lease struct {
+	addr tcpip.Address
+
+	// expiry is the monotonic time at which the lease expires.
+	expiry int64
+
+	// bound is true once the client acknowledged the lease.
+	bound bool
+}
+
+// Server is a DHCPv4 server on a single NIC.
+type Server struct {
+	stack  *stack.Stack
+	nicID  tcpip.NICID
+	config ServerConfig
+
+	mu sync.Mutex
+	// leases maps the link address of clients to their lease.
+	leases map[tcpip.LinkAddress]lease
+}
+
+// NewServer creates a DHCP server for the NIC nicID of s.
+func NewServer(s *stack.Stack, nicID tcpip.NICID, config ServerConfig) (*Server, error) {
+	if len(config.ServerAddress) != header.IPv4AddressSize {
+		return nil, fmt.Errorf("got server address %s, expected an IPv4 address", config.ServerAddress)
+	}
+	if len(config.SubnetMask) != header.IPv4AddressSize {
+		return nil, fmt.Errorf("got subnet mask %s, expected an IPv4 mask", config.SubnetMask)
+	}
+	if config.LeaseLength < time.Second {
+		return nil, fmt.Errorf("got lease length %s, expected at least 1s", config.LeaseLength)
+	}
+	subnet := tcpip.AddressWithPrefix{Address: config.ServerAddress, PrefixLen: config.SubnetMask.Prefix()}.Subnet()
+	check := func(addr tcpip.Address) error {
+		if !subnet.Contains(addr) || subnet.IsBroadcast(addr) || addr == subnet.ID() || addr == config.ServerAddress {
+			return fmt.Errorf("address %s can't be leased in subnet %s", addr, subnet)
+		}
+		return nil
+	}
+	for _, addr := range config.Pool {
+		if err := check(addr); err != nil {
+			return nil, err
+		}
+	}
+	for _, addr := range config.Reservations {
+		if err := check(addr); err != nil {
+			return nil, err
+		}
+	}
+	return &Server{
+		stack:  s,
+		nicID:  nicID,
+		config: config,
+		leases: make(map[tcpip.LinkAddress]lease),
+	}, nil
+}
+
+// Leases returns the addresses currently leased to clients, keyed by the link
+// address of the clients. Pending offers are not included.
+func (s *Server) Leases() map[tcpip.LinkAddress]tcpip.Address {
+	now := s.stack.Clock().NowMonotonic()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := make(map[tcpip.LinkAddress]tcpip.Address)
+	for linkAddr, l := range s.leases {
+		if l.bound && l.expiry > now {
+			leases[linkAddr] = l.addr
+		}
+	}
+	return leases
+}
+
+// Run serves clients until ctx is done. It only returns an error if the
+// server could not listen for requests.
+func (s *Server) Run(ctx context.Context) *tcpip.Error {
+	var wq waiter.Queue
+	ep, err := s.stack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		return err
+	}
+	defer ep.Close()
+	ep.SocketOptions().SetBroadcast(true)
+	bindToDevice := tcpip.BindToDeviceOption(s.nicID)
+	if err := ep.SetSockOpt(&bindToDevice); err != nil {
+		return err
+	}
+	if err := ep.Bind(tcpip.FullAddress{Port: header.DHCPv4ServerPort}); err != nil {
+		return err
+	}
+	waitEntry, inCh := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&waitEntry, waiter.EventIn)
+	defer wq.EventUnregister(&waitEntry)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-inCh:
+		}
+		for {
+			v, _, err := ep.Read(nil)
+			if err != nil {
+				break
+			}
+			msg := header.DHCPv4(v)
+			if !msg.IsValid() || msg.Op() != header.DHCPv4BootRequest {
+				continue
+			}
+			opts, ok := msg.Options()
+			if !ok {
+				continue
+			}
+			if reply := s.handle(msg, opts); reply != nil {
+				_, _, _ = ep.Write(tcpip.SlicePayload(reply), tcpip.WriteOptions{To: s.replyTo(msg)})
+			}
+		}
+	}
+}
+
+// replyTo returns where a reply to msg is sent, as per RFC 2131 section 4.1.
+func (s *Server) replyTo(msg header.DHCPv4) *tcpip.FullAddress {
+	switch {
+	case msg.GatewayAddress() != header.IPv4Any:
+		return &tcpip.FullAddress{NIC: s.nicID, Addr: msg.GatewayAddress(), Port: header.DHCPv4ServerPort}
+	case msg.ClientAddress() != header.IPv4Any:
+		return &tcpip.FullAddress{NIC: s.nicID, Addr: msg.ClientAddress(), Port: header.DHCPv4ClientPort}
+	default:
+		// The client can't be reached by unicast without an address, and link
+		// address resolution of the offered address would fail.
+		return &tcpip.FullAddress{NIC: s.nicID, Addr: header.IPv4Broadcast, Port: header.DHCPv4ClientPort}
+	}
+}
+
+// handle handles msg and returns the reply to it, if any.
+func (s *Server) handle(msg header.DHCPv4, opts header.DHCPv4Options) header.DHCPv4 {
+	typ, ok := opts.MessageType()
+	if !ok {
+		return nil
+	}
+	linkAddr := msg.ClientHardwareAddress()
+	now := s.stack.Clock().NowMonotonic()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch typ {
+	case header.DHCPv4Discover:
+		requested, _ := opts.Address(header.DHCPv4OptionRequestedIPAddress)
+		addr, ok := s.allocateLocked(linkAddr, requested, now)
+		if !ok {
+			return nil
+		}
+		l := s.leases[linkAddr]
+		if !l.bound || l.addr != addr {
+			l = lease{addr: addr, expiry: now + offerHoldTime.Nanoseconds()}
+		}
+		s.leases[linkAddr] = l
+		return s.reply(msg, header.DHCPv4Offer, addr)
+
+	case header.DHCPv4Request:
+		serverAddr, selecting := opts.Address(header.DHCPv4OptionServerIdentifier)
+		if selecting && serverAddr != s.config.ServerAddress {
+			// The client accepted the offer of another server.
+			if l, ok := s.leases[linkAddr]; ok && !l.bound {
+				delete(s.leases, linkAddr)
+			}
+			return nil
+		}
+		addr := msg.ClientAddress()
+		if requested, ok := opts.Address(header.DHCPv4OptionRequestedIPAddress); ok {
+			addr = requested
+		}
+		if got, ok := s.allocateLocked(linkAddr, addr, now); !ok || got != addr {
+			if !selecting && !s.ownsLocked(addr) {
+				// The client may be talking to another server about an address
+				// this server knows nothing about.
+				return nil
+			}
+			return s.reply(msg, header.DHCPv4Nak, "")
+		}
+		s.leases[linkAddr] = lease{addr: addr, expiry: now + s.config.LeaseLength.Nanoseconds(), bound: true}
+		return s.reply(msg, header.DHCPv4Ack, addr)
+
+	case header.DHCPv4Release:
+		if l, ok := s.leases[linkAddr]; ok && l.addr == msg.ClientAddress() {
+			delete(s.leases, linkAddr)
+		}
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// ownsLocked returns true if addr is in the pool or reserved.
+//
+// Precondition: s.mu must be locked.
+func (s *Server) ownsLocked(addr tcpip.Address) bool {
+	for _, a := range s.config.Pool {
+		if a == addr {
+			return true
+		}
+	}
+	for _, a := range s.config.Reservations {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateLocked returns the address leased to linkAddr, preferring its
+// reservation, then its current lease, then requested and finally the first
+// free address of the pool.
+//
+// Precondition: s.mu must be locked.
+func (s *Server) allocateLocked(linkAddr tcpip.LinkAddress, requested tcpip.Address, now int64) (tcpip.Address, bool) {
+	if addr, ok := s.config.Reservations[linkAddr]; ok {
+		return addr, true
+	}
+	if l, ok := s.leases[linkAddr]; ok {
+		return l.addr, true
+	}
+	free := func(addr tcpip.Address) bool {
+		for _, reserved := range s.config.Reservations {
+			if reserved == addr {
+				return false
+			}
+		}
+		for other, l := range s.leases {
+			if l.addr != addr {
+				continue
+			}
+			if l.expiry > now {
+				return false
+			}
+			// The lease expired, the address can be reused.
+			delete(s.leases, other)
+		}
+		return true
+	}
+	if len(requested) != 0 {
+		for _, addr := range s.config.Pool {
+			if addr == requested && free(addr) {
+				return addr, true
+			}
+		}
+	}
+	for _, addr := range s.config.Pool {
+		if free(addr) {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// reply builds a reply of type typ to msg, leasing addr.
+func (s *Server) reply(msg header.DHCPv4, typ header.DHCPv4MessageType, addr tcpip.Address) header.DHCPv4 {
+	opts := header.DHCPv4Options{
+		header.DHCPv4MessageTypeOption(typ),
+		header.DHCPv4AddressesOption(header.DHCPv4OptionServerIdentifier, s.config.ServerAddress),
+	}
+	if typ != header.DHCPv4Nak {
+		opts = append(opts,
+			header.DHCPv4DurationOption(header.DHCPv4OptionIPAddressLeaseTime, s.config.LeaseLength),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionSubnetMask, tcpip.Address(s.config.SubnetMask)),
+		)
+		for _, opt := range s.config.Options {
+			switch opt.Code {
+			case header.DHCPv4OptionMessageType, header.DHCPv4OptionServerIdentifier, header.DHCPv4OptionIPAddressLeaseTime, header.DHCPv4OptionSubnetMask:
+			default:
+				opts = append(opts, opt)
+			}
+		}
+	}
+	fields := header.DHCPv4Fields{
+		Op:                    header.DHCPv4BootReply,
+		XID:                   msg.XID(),
+		Broadcast:             msg.Broadcast(),
+		ClientAddress:         msg.ClientAddress(),
+		YourAddress:           addr,
+		GatewayAddress:        msg.GatewayAddress(),
+		ClientHardwareAddress: msg.ClientHardwareAddress(),
+		Options:               opts,
+	}
+	reply := header.DHCPv4(make([]byte, header.DHCPv4Size(fields.Options)))
+	reply.Encode(&fields)
+	return reply
+}
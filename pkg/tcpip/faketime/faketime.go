@@ -34,6 +34,11 @@ func (*NullClock) NowNanoseconds() int64 {
 	return 0
 }
 
+// Now implements tcpip.Clock.Now.
+func (*NullClock) Now() time.Time {
+	return time.Unix(0, 0)
+}
+
 // NowMonotonic implements tcpip.Clock.NowMonotonic.
 func (*NullClock) NowMonotonic() int64 {
 	return 0
@@ -78,6 +83,11 @@ func (mc *ManualClock) NowNanoseconds() int64 {
 	return mc.clock.Now().UnixNano()
 }
 
+// Now implements tcpip.Clock.Now.
+func (mc *ManualClock) Now() time.Time {
+	return mc.clock.Now()
+}
+
 // NowMonotonic implements tcpip.Clock.NowMonotonic.
 func (mc *ManualClock) NowMonotonic() int64 {
 	return mc.NowNanoseconds()
@@ -18,6 +18,7 @@ package header
 
 import (
 	"encoding/binary"
+	"math/bits"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
@@ -45,7 +46,9 @@ func calculateChecksum(buf []byte, odd bool, initial uint32) (uint16, bool) {
 	return ChecksumCombine(uint16(v), uint16(v>>16)), odd
 }
 
-func unrolledCalculateChecksum(buf []byte, odd bool, initial uint32) (uint16, bool) {
+// fastCalculateChecksum is like calculateChecksum, but adds up the bulk of buf
+// 64 bits at a time using sum64, which is optimized for the host architecture.
+func fastCalculateChecksum(buf []byte, odd bool, initial uint32) (uint16, bool) {
 	v := initial
 
 	if odd {
@@ -59,103 +62,24 @@ func unrolledCalculateChecksum(buf []byte, odd bool, initial uint32) (uint16, bo
 		l--
 		v += uint32(buf[l]) << 8
 	}
-	for (l - 64) >= 0 {
-		i := 0
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		i += 16
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		i += 16
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		i += 16
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		buf = buf[64:]
-		l = l - 64
-	}
-	if (l - 32) >= 0 {
-		i := 0
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		i += 16
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		buf = buf[32:]
-		l = l - 32
-	}
-	if (l - 16) >= 0 {
-		i := 0
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		v += (uint32(buf[i+8]) << 8) + uint32(buf[i+9])
-		v += (uint32(buf[i+10]) << 8) + uint32(buf[i+11])
-		v += (uint32(buf[i+12]) << 8) + uint32(buf[i+13])
-		v += (uint32(buf[i+14]) << 8) + uint32(buf[i+15])
-		buf = buf[16:]
-		l = l - 16
-	}
-	if (l - 8) >= 0 {
-		i := 0
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		v += (uint32(buf[i+4]) << 8) + uint32(buf[i+5])
-		v += (uint32(buf[i+6]) << 8) + uint32(buf[i+7])
-		buf = buf[8:]
-		l = l - 8
-	}
-	if (l - 4) >= 0 {
-		i := 0
-		v += (uint32(buf[i]) << 8) + uint32(buf[i+1])
-		v += (uint32(buf[i+2]) << 8) + uint32(buf[i+3])
-		buf = buf[4:]
-		l = l - 4
-	}
 
-	// At this point since l was even before we started unrolling
-	// there can be only two bytes left to add.
-	if l != 0 {
-		v += (uint32(buf[0]) << 8) + uint32(buf[1])
+	// sum64 adds up little-endian words. As the one's complement sum is
+	// independent of byte order (RFC 1071 section 2(B)), it only needs to be
+	// byte-swapped once folded.
+	words := l &^ 7
+	s := sum64(buf[:words])
+	for i := words; i < l; i += 2 {
+		s2 := s + (uint64(buf[i+1])<<8 + uint64(buf[i]))
+		if s2 < s {
+			s2++
+		}
+		s = s2
 	}
+	s = (s & 0xffffffff) + (s >> 32)
+	s = (s & 0xffffffff) + (s >> 32)
+	s = (s & 0xffff) + (s >> 16)
+	s = (s & 0xffff) + (s >> 16)
+	v += uint32(bits.ReverseBytes16(uint16(s)))
 
 	return ChecksumCombine(uint16(v), uint16(v>>16)), odd
 }
@@ -172,12 +96,12 @@ func ChecksumOld(buf []byte, initial uint16) uint16 {
 }
 
 // Checksum calculates the checksum (as defined in RFC 1071) of the bytes in the
-// given byte array. This function uses an optimized unrolled version of the
-// checksum algorithm.
+// given byte array. This function uses an optimized version of the checksum
+// algorithm.
 //
 // The initial checksum must have been computed on an even number of bytes.
 func Checksum(buf []byte, initial uint16) uint16 {
-	s, _ := unrolledCalculateChecksum(buf, false, uint32(initial))
+	s, _ := fastCalculateChecksum(buf, false, uint32(initial))
 	return s
 }
 
@@ -213,7 +137,7 @@ func ChecksumVVWithOffset(vv buffer.VectorisedView, initial uint16, off int, siz
 		}
 		v = v[:l]
 
-		sum, odd = unrolledCalculateChecksum(v, odd, uint32(sum))
+		sum, odd = fastCalculateChecksum(v, odd, uint32(sum))
 
 		size -= len(v)
 		if size == 0 {
@@ -233,6 +157,28 @@ func ChecksumCombine(a, b uint16) uint16 {
 	return uint16(v + v>>16)
 }
 
+// ChecksumUpdate updates a running checksum xsum after the 16-bit word old, at
+// an even offset of the checksummed bytes, was replaced with new. It
+// implements the incremental update of RFC 1624 section 3:
+//
+//	HC' = ~(~HC + ~m + m')
+//
+// xsum is the one's complement sum (not its complement, as stored in most
+// checksum fields) and so is the returned value.
+func ChecksumUpdate(xsum, old, new uint16) uint16 {
+	return ChecksumCombine(ChecksumCombine(xsum, ^old), new)
+}
+
+// ChecksumUpdateAddress is like ChecksumUpdate, but for an address at an even
+// offset of the checksummed bytes. old and new must be of the same length,
+// which must be even.
+func ChecksumUpdateAddress(xsum uint16, old, new tcpip.Address) uint16 {
+	for i := 0; i < len(old); i += 2 {
+		xsum = ChecksumUpdate(xsum, uint16(old[i])<<8|uint16(old[i+1]), uint16(new[i])<<8|uint16(new[i+1]))
+	}
+	return xsum
+}
+
 // PseudoHeaderChecksum calculates the pseudo-header checksum for the given
 // destination protocol and network address. Pseudo-headers are needed by
 // transport layers when calculating their own checksum.
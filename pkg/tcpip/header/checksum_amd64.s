@@ -0,0 +1,52 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "textflag.h"
+
+// sum64 returns the one's complement sum of the 64-bit words of buf. Carries
+// out of the accumulator are counted separately so that the inner loop is a
+// single chain of add-with-carry instructions.
+//
+// func sum64(buf []byte) uint64
+TEXT ·sum64(SB),NOSPLIT,$0-32
+	MOVQ	buf_base+0(FP), SI
+	MOVQ	buf_len+8(FP), CX
+	XORQ	AX, AX // accumulator
+	XORQ	DX, DX // carries
+	CMPQ	CX, $32
+	JB	loop8
+loop32:
+	ADDQ	0(SI), AX
+	ADCQ	8(SI), AX
+	ADCQ	16(SI), AX
+	ADCQ	24(SI), AX
+	ADCQ	$0, DX
+	ADDQ	$32, SI
+	SUBQ	$32, CX
+	CMPQ	CX, $32
+	JAE	loop32
+loop8:
+	CMPQ	CX, $8
+	JB	done
+	ADDQ	0(SI), AX
+	ADCQ	$0, DX
+	ADDQ	$8, SI
+	SUBQ	$8, CX
+	JMP	loop8
+done:
+	// DX is small, so folding in the final carry cannot overflow again.
+	ADDQ	DX, AX
+	ADCQ	$0, AX
+	MOVQ	AX, ret+24(FP)
+	RET
@@ -0,0 +1,43 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !amd64
+
+package header
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// sum64 returns the one's complement sum of the 64-bit little-endian words of
+// buf. Trailing bytes that don't form a whole word are ignored.
+func sum64(buf []byte) uint64 {
+	var sum, carries uint64
+	for ; len(buf) >= 32; buf = buf[32:] {
+		var c uint64
+		sum, c = bits.Add64(sum, binary.LittleEndian.Uint64(buf), 0)
+		sum, c = bits.Add64(sum, binary.LittleEndian.Uint64(buf[8:]), c)
+		sum, c = bits.Add64(sum, binary.LittleEndian.Uint64(buf[16:]), c)
+		sum, c = bits.Add64(sum, binary.LittleEndian.Uint64(buf[24:]), c)
+		carries += c
+	}
+	for ; len(buf) >= 8; buf = buf[8:] {
+		var c uint64
+		sum, c = bits.Add64(sum, binary.LittleEndian.Uint64(buf), 0)
+		carries += c
+	}
+	sum, c := bits.Add64(sum, carries, 0)
+	return sum + c
+}
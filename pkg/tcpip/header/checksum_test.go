@@ -17,10 +17,12 @@
 package header_test
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -136,6 +138,124 @@ func TestChecksum(t *testing.T) {
 	}
 }
 
+func TestChecksumAllOnes(t *testing.T) {
+	// Buffers of all ones stress the handling of carries.
+	for _, size := range []int{8, 16, 24, 32, 40, 64, 1500, 65536} {
+		buf := bytes.Repeat([]byte{0xff}, size)
+		for _, initial := range []uint16{0, 1, 0xfffe, 0xffff} {
+			if got, want := header.Checksum(buf, initial), header.ChecksumOld(buf, initial); got != want {
+				t.Errorf("header.Checksum(<%d bytes of 0xff>, %#x) = %#x, want %#x", size, initial, got, want)
+			}
+		}
+	}
+}
+
+func TestChecksumUpdate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	buf := make([]byte, 64)
+	for i := 0; i < 10000; i++ {
+		rnd.Read(buf)
+		xsum := header.Checksum(buf, 0)
+		off := 2 * rnd.Intn(len(buf)/2-1)
+		old := uint16(buf[off])<<8 | uint16(buf[off+1])
+		new := uint16(rnd.Intn(1 << 16))
+		buf[off], buf[off+1] = byte(new>>8), byte(new)
+		got := header.ChecksumUpdate(xsum, old, new)
+		// The incremental update may produce either representation of
+		// zero, which are equivalent.
+		if want := header.Checksum(buf, 0); got != want && got^want != 0xffff {
+			t.Fatalf("header.ChecksumUpdate(%#x, %#x, %#x) = %#x, want %#x", xsum, old, new, got, want)
+		}
+	}
+}
+
+func TestIPv4SetWithChecksumUpdate(t *testing.T) {
+	ip := header.IPv4(make([]byte, header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: header.IPv4MinimumSize,
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     tcpip.Address("\x0a\x00\x00\x01"),
+		DstAddr:     tcpip.Address("\x0a\x00\x00\x02"),
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+
+	ip.SetTTLWithChecksumUpdate(63)
+	ip.SetSourceAddressWithChecksumUpdate(tcpip.Address("\xc0\xa8\x01\x01"))
+	ip.SetDestinationAddressWithChecksumUpdate(tcpip.Address("\x7f\x00\x00\x01"))
+	if got := ip.TTL(); got != 63 {
+		t.Errorf("got ip.TTL() = %d, want = 63", got)
+	}
+	if got := ip.CalculateChecksum(); got != 0xffff {
+		t.Errorf("got ip.CalculateChecksum() = %#x, want = 0xffff", got)
+	}
+}
+
+func TestTransportSetWithChecksumUpdate(t *testing.T) {
+	src := tcpip.Address("\x0a\x00\x00\x01")
+	dst := tcpip.Address("\x0a\x00\x00\x02")
+	newDst := tcpip.Address("\x7f\x00\x00\x01")
+	payload := []byte{1, 2, 3, 4, 5}
+
+	t.Run("TCP", func(t *testing.T) {
+		tcp := header.TCP(make([]byte, header.TCPMinimumSize))
+		tcp.Encode(&header.TCPFields{
+			SrcPort:    1234,
+			DstPort:    80,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      header.TCPFlagAck,
+			WindowSize: 1000,
+		})
+		length := uint16(len(tcp) + len(payload))
+		xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, src, dst, length)
+		tcp.SetChecksum(^tcp.CalculateChecksum(header.Checksum(payload, xsum)))
+
+		tcp.SetSourcePortWithChecksumUpdate(4321)
+		tcp.SetDestinationPortWithChecksumUpdate(8080)
+		tcp.UpdateChecksumPseudoHeaderAddress(dst, newDst, true /* fullChecksum */)
+
+		xsum = header.PseudoHeaderChecksum(header.TCPProtocolNumber, src, newDst, length)
+		if got := tcp.CalculateChecksum(header.Checksum(payload, xsum)); got != 0xffff {
+			t.Errorf("got tcp.CalculateChecksum(...) = %#x, want = 0xffff", got)
+		}
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		udp := header.UDP(make([]byte, header.UDPMinimumSize))
+		length := uint16(len(udp) + len(payload))
+		udp.Encode(&header.UDPFields{
+			SrcPort: 1234,
+			DstPort: 53,
+			Length:  length,
+		})
+		xsum := header.PseudoHeaderChecksum(header.UDPProtocolNumber, src, dst, length)
+		udp.SetChecksum(^udp.CalculateChecksum(header.Checksum(payload, xsum)))
+
+		udp.SetSourcePortWithChecksumUpdate(4321)
+		udp.SetDestinationPortWithChecksumUpdate(5353)
+		udp.UpdateChecksumPseudoHeaderAddress(dst, newDst)
+
+		xsum = header.PseudoHeaderChecksum(header.UDPProtocolNumber, src, newDst, length)
+		if got := udp.CalculateChecksum(header.Checksum(payload, xsum)); got != 0xffff {
+			t.Errorf("got udp.CalculateChecksum(...) = %#x, want = 0xffff", got)
+		}
+	})
+
+	t.Run("UDPNoChecksum", func(t *testing.T) {
+		udp := header.UDP(make([]byte, header.UDPMinimumSize))
+		udp.Encode(&header.UDPFields{
+			SrcPort: 1234,
+			DstPort: 53,
+			Length:  header.UDPMinimumSize,
+		})
+		udp.SetDestinationPortWithChecksumUpdate(5353)
+		udp.UpdateChecksumPseudoHeaderAddress(dst, newDst)
+		if got := udp.Checksum(); got != 0 {
+			t.Errorf("got udp.Checksum() = %#x, want = 0", got)
+		}
+	})
+}
+
 func BenchmarkChecksum(b *testing.B) {
 	var bufSizes = []int{64, 128, 256, 512, 1024, 1500, 2048, 4096, 8192, 16384, 32767, 32768, 65535, 65536}
 
@@ -0,0 +1,410 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	dhcpv4OpOffset          = 0
+	dhcpv4HTypeOffset       = 1
+	dhcpv4HLenOffset        = 2
+	dhcpv4XIDOffset         = 4
+	dhcpv4SecsOffset        = 8
+	dhcpv4FlagsOffset       = 10
+	dhcpv4CIAddrOffset      = 12
+	dhcpv4YIAddrOffset      = 16
+	dhcpv4SIAddrOffset      = 20
+	dhcpv4GIAddrOffset      = 24
+	dhcpv4CHAddrOffset      = 28
+	dhcpv4MagicCookieOffset = 236
+	dhcpv4OptionsOffset     = 240
+
+	dhcpv4CHAddrSize = 16
+
+	// dhcpv4BroadcastFlag is the B flag of the flags field.
+	dhcpv4BroadcastFlag = 1 << 15
+)
+
+const (
+	// DHCPv4MinimumSize is the size of a DHCP message without options, the
+	// magic cookie included.
+	DHCPv4MinimumSize = dhcpv4OptionsOffset
+
+	// DHCPv4ServerPort is the UDP port DHCP servers listen on.
+	DHCPv4ServerPort = 67
+
+	// DHCPv4ClientPort is the UDP port DHCP clients listen on.
+	DHCPv4ClientPort = 68
+
+	// DHCPv4MagicCookie is the value of the first four bytes of the options
+	// field, as per RFC 2131 section 3.
+	DHCPv4MagicCookie = 0x63825363
+)
+
+// DHCPv4Op is the op field of a DHCP message.
+type DHCPv4Op uint8
+
+// Values of DHCPv4Op, as per RFC 951.
+const (
+	DHCPv4BootRequest DHCPv4Op = 1
+	DHCPv4BootReply   DHCPv4Op = 2
+)
+
+// DHCPv4MessageType is the value of the DHCP Message Type option, as per RFC
+// 2132 section 9.6.
+type DHCPv4MessageType uint8
+
+// Values of DHCPv4MessageType.
+const (
+	DHCPv4Discover DHCPv4MessageType = 1
+	DHCPv4Offer    DHCPv4MessageType = 2
+	DHCPv4Request  DHCPv4MessageType = 3
+	DHCPv4Decline  DHCPv4MessageType = 4
+	DHCPv4Ack      DHCPv4MessageType = 5
+	DHCPv4Nak      DHCPv4MessageType = 6
+	DHCPv4Release  DHCPv4MessageType = 7
+	DHCPv4Inform   DHCPv4MessageType = 8
+)
+
+// String implements fmt.Stringer.
+func (t DHCPv4MessageType) String() string {
+	switch t {
+	case DHCPv4Discover:
+		return "DHCPDISCOVER"
+	case DHCPv4Offer:
+		return "DHCPOFFER"
+	case DHCPv4Request:
+		return "DHCPREQUEST"
+	case DHCPv4Decline:
+		return "DHCPDECLINE"
+	case DHCPv4Ack:
+		return "DHCPACK"
+	case DHCPv4Nak:
+		return "DHCPNAK"
+	case DHCPv4Release:
+		return "DHCPRELEASE"
+	case DHCPv4Inform:
+		return "DHCPINFORM"
+	default:
+		return fmt.Sprintf("DHCPv4MessageType(%d)", uint8(t))
+	}
+}
+
+// DHCPv4OptionCode is the code of a DHCP option.
+type DHCPv4OptionCode uint8
+
+// Common DHCP option codes, as per RFC 2132.
+const (
+	DHCPv4OptionPad                  DHCPv4OptionCode = 0
+	DHCPv4OptionSubnetMask           DHCPv4OptionCode = 1
+	DHCPv4OptionRouter               DHCPv4OptionCode = 3
+	DHCPv4OptionDomainNameServer     DHCPv4OptionCode = 6
+	DHCPv4OptionHostName             DHCPv4OptionCode = 12
+	DHCPv4OptionDomainName           DHCPv4OptionCode = 15
+	DHCPv4OptionBroadcastAddress     DHCPv4OptionCode = 28
+	DHCPv4OptionRequestedIPAddress   DHCPv4OptionCode = 50
+	DHCPv4OptionIPAddressLeaseTime   DHCPv4OptionCode = 51
+	DHCPv4OptionMessageType          DHCPv4OptionCode = 53
+	DHCPv4OptionServerIdentifier     DHCPv4OptionCode = 54
+	DHCPv4OptionParameterRequestList DHCPv4OptionCode = 55
+	DHCPv4OptionMessage              DHCPv4OptionCode = 56
+	DHCPv4OptionMaximumMessageSize   DHCPv4OptionCode = 57
+	DHCPv4OptionRenewalTime          DHCPv4OptionCode = 58
+	DHCPv4OptionRebindingTime        DHCPv4OptionCode = 59
+	DHCPv4OptionClientIdentifier     DHCPv4OptionCode = 61
+	DHCPv4OptionEnd                  DHCPv4OptionCode = 255
+)
+
+// DHCPv4Option is a DHCP option.
+type DHCPv4Option struct {
+	Code DHCPv4OptionCode
+	Data []byte
+}
+
+// DHCPv4MessageTypeOption returns a DHCP Message Type option.
+func DHCPv4MessageTypeOption(t DHCPv4MessageType) DHCPv4Option {
+	return DHCPv4Option{Code: DHCPv4OptionMessageType, Data: []byte{byte(t)}}
+}
+
+// DHCPv4AddressesOption returns an option holding a list of IPv4 addresses,
+// such as the Router or Domain Name Server options.
+func DHCPv4AddressesOption(code DHCPv4OptionCode, addrs ...tcpip.Address) DHCPv4Option {
+	data := make([]byte, 0, len(addrs)*IPv4AddressSize)
+	for _, addr := range addrs {
+		if len(addr) != IPv4AddressSize {
+			panic(fmt.Sprintf("got address %s of %d bytes, expected %d bytes", addr, len(addr), IPv4AddressSize))
+		}
+		data = append(data, addr...)
+	}
+	return DHCPv4Option{Code: code, Data: data}
+}
+
+// DHCPv4DurationOption returns an option holding a duration in seconds, such
+// as the IP Address Lease Time option.
+func DHCPv4DurationOption(code DHCPv4OptionCode, d time.Duration) DHCPv4Option {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(d/time.Second))
+	return DHCPv4Option{Code: code, Data: data}
+}
+
+// DHCPv4Options is a list of DHCP options.
+type DHCPv4Options []DHCPv4Option
+
+// Find returns the data of the first option with the given code.
+func (o DHCPv4Options) Find(code DHCPv4OptionCode) ([]byte, bool) {
+	for _, opt := range o {
+		if opt.Code == code {
+			return opt.Data, true
+		}
+	}
+	return nil, false
+}
+
+// MessageType returns the value of the DHCP Message Type option.
+func (o DHCPv4Options) MessageType() (DHCPv4MessageType, bool) {
+	data, ok := o.Find(DHCPv4OptionMessageType)
+	if !ok || len(data) != 1 {
+		return 0, false
+	}
+	return DHCPv4MessageType(data[0]), true
+}
+
+// Addresses returns the IPv4 addresses held in the option with the given
+// code. It returns false if the option is missing or malformed.
+func (o DHCPv4Options) Addresses(code DHCPv4OptionCode) ([]tcpip.Address, bool) {
+	data, ok := o.Find(code)
+	if !ok || len(data) == 0 || len(data)%IPv4AddressSize != 0 {
+		return nil, false
+	}
+	addrs := make([]tcpip.Address, 0, len(data)/IPv4AddressSize)
+	for ; len(data) != 0; data = data[IPv4AddressSize:] {
+		addrs = append(addrs, tcpip.Address(data[:IPv4AddressSize]))
+	}
+	return addrs, true
+}
+
+// Address returns the IPv4 address held in the option with the given code,
+// such as the Subnet Mask or Server Identifier options.
+func (o DHCPv4Options) Address(code DHCPv4OptionCode) (tcpip.Address, bool) {
+	addrs, ok := o.Addresses(code)
+	if !ok || len(addrs) != 1 {
+		return "", false
+	}
+	return addrs[0], true
+}
+
+// Duration returns the duration held in seconds in the option with the given
+// code.
+func (o DHCPv4Options) Duration(code DHCPv4OptionCode) (time.Duration, bool) {
+	data, ok := o.Find(code)
+	if !ok || len(data) != 4 {
+		return 0, false
+	}
+	return time.Duration(binary.BigEndian.Uint32(data)) * time.Second, true
+}
+
+// DHCPv4Fields contains the fields of a DHCP message. It is used to describe
+// the fields of a message that needs to be encoded.
+type DHCPv4Fields struct {
+	// Op is the "op" field.
+	Op DHCPv4Op
+
+	// XID is the transaction ID.
+	XID uint32
+
+	// Secs is the number of seconds elapsed since the client began address
+	// acquisition or renewal.
+	Secs uint16
+
+	// Broadcast is the B flag, set by clients that cannot receive unicast
+	// messages before their address is configured.
+	Broadcast bool
+
+	// ClientAddress is the "ciaddr" field.
+	ClientAddress tcpip.Address
+
+	// YourAddress is the "yiaddr" field.
+	YourAddress tcpip.Address
+
+	// ServerAddress is the "siaddr" field.
+	ServerAddress tcpip.Address
+
+	// GatewayAddress is the "giaddr" field.
+	GatewayAddress tcpip.Address
+
+	// ClientHardwareAddress is the "chaddr" field, an Ethernet address.
+	ClientHardwareAddress tcpip.LinkAddress
+
+	// Options are the options, which are followed by an End option when
+	// encoded.
+	Options DHCPv4Options
+}
+
+// DHCPv4Size returns the size of a DHCP message holding options.
+func DHCPv4Size(options DHCPv4Options) int {
+	size := DHCPv4MinimumSize
+	for _, opt := range options {
+		size += 2 + len(opt.Data)
+	}
+	// The End option.
+	return size + 1
+}
+
+// DHCPv4 represents a DHCP message stored in a byte array, as per RFC 2131
+// section 2.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//    +---------------+---------------+---------------+---------------+
+//    |     op (1)    |   htype (1)   |   hlen (1)    |   hops (1)    |
+//    +---------------+---------------+---------------+---------------+
+//    |                            xid (4)                            |
+//    +-------------------------------+-------------------------------+
+//    |           secs (2)            |           flags (2)           |
+//    +-------------------------------+-------------------------------+
+//    |                          ciaddr  (4)                          |
+//    +---------------------------------------------------------------+
+//    |                          yiaddr  (4)                          |
+//    +---------------------------------------------------------------+
+//    |                          siaddr  (4)                          |
+//    +---------------------------------------------------------------+
+//    |                          giaddr  (4)                          |
+//    +---------------------------------------------------------------+
+//    |                          chaddr  (16)                         |
+//    +---------------------------------------------------------------+
+//    |                          sname   (64)                         |
+//    +---------------------------------------------------------------+
+//    |                          file    (128)                        |
+//    +---------------------------------------------------------------+
+//    |                          options (variable)                   |
+//    +---------------------------------------------------------------+
+//
+// Options held in the sname and file fields through option overloading are not
+// supported.
+type DHCPv4 []byte
+
+// Op returns the "op" field.
+func (b DHCPv4) Op() DHCPv4Op {
+	return DHCPv4Op(b[dhcpv4OpOffset])
+}
+
+// XID returns the transaction ID.
+func (b DHCPv4) XID() uint32 {
+	return binary.BigEndian.Uint32(b[dhcpv4XIDOffset:])
+}
+
+// Secs returns the "secs" field.
+func (b DHCPv4) Secs() uint16 {
+	return binary.BigEndian.Uint16(b[dhcpv4SecsOffset:])
+}
+
+// Broadcast returns true if the B flag is set.
+func (b DHCPv4) Broadcast() bool {
+	return binary.BigEndian.Uint16(b[dhcpv4FlagsOffset:])&dhcpv4BroadcastFlag != 0
+}
+
+// ClientAddress returns the "ciaddr" field.
+func (b DHCPv4) ClientAddress() tcpip.Address {
+	return tcpip.Address(b[dhcpv4CIAddrOffset:][:IPv4AddressSize])
+}
+
+// YourAddress returns the "yiaddr" field.
+func (b DHCPv4) YourAddress() tcpip.Address {
+	return tcpip.Address(b[dhcpv4YIAddrOffset:][:IPv4AddressSize])
+}
+
+// ServerAddress returns the "siaddr" field.
+func (b DHCPv4) ServerAddress() tcpip.Address {
+	return tcpip.Address(b[dhcpv4SIAddrOffset:][:IPv4AddressSize])
+}
+
+// GatewayAddress returns the "giaddr" field.
+func (b DHCPv4) GatewayAddress() tcpip.Address {
+	return tcpip.Address(b[dhcpv4GIAddrOffset:][:IPv4AddressSize])
+}
+
+// ClientHardwareAddress returns the "chaddr" field.
+func (b DHCPv4) ClientHardwareAddress() tcpip.LinkAddress {
+	return tcpip.LinkAddress(b[dhcpv4CHAddrOffset:][:b[dhcpv4HLenOffset]])
+}
+
+// IsValid returns true if b is long enough to hold a DHCP message of an
+// Ethernet client and starts its options with the magic cookie.
+func (b DHCPv4) IsValid() bool {
+	return len(b) >= DHCPv4MinimumSize &&
+		ARPHardwareType(b[dhcpv4HTypeOffset]) == ARPHardwareEther &&
+		b[dhcpv4HLenOffset] == EthernetAddressSize &&
+		binary.BigEndian.Uint32(b[dhcpv4MagicCookieOffset:]) == DHCPv4MagicCookie
+}
+
+// Options returns the options of the message, Pad and End options excluded.
+// It returns false if an option is truncated.
+func (b DHCPv4) Options() (DHCPv4Options, bool) {
+	var opts DHCPv4Options
+	for o := b[dhcpv4OptionsOffset:]; len(o) != 0; {
+		code := DHCPv4OptionCode(o[0])
+		switch code {
+		case DHCPv4OptionPad:
+			o = o[1:]
+			continue
+		case DHCPv4OptionEnd:
+			return opts, true
+		}
+		if len(o) < 2 || len(o) < 2+int(o[1]) {
+			return nil, false
+		}
+		opts = append(opts, DHCPv4Option{Code: code, Data: o[2:][:o[1]]})
+		o = o[2+int(o[1]):]
+	}
+	return opts, true
+}
+
+// Encode encodes all the fields of the DHCP message into b, which must be
+// DHCPv4Size(f.Options) bytes long.
+func (b DHCPv4) Encode(f *DHCPv4Fields) {
+	for i := range b[:DHCPv4MinimumSize] {
+		b[i] = 0
+	}
+	b[dhcpv4OpOffset] = byte(f.Op)
+	b[dhcpv4HTypeOffset] = byte(ARPHardwareEther)
+	b[dhcpv4HLenOffset] = EthernetAddressSize
+	binary.BigEndian.PutUint32(b[dhcpv4XIDOffset:], f.XID)
+	binary.BigEndian.PutUint16(b[dhcpv4SecsOffset:], f.Secs)
+	if f.Broadcast {
+		binary.BigEndian.PutUint16(b[dhcpv4FlagsOffset:], dhcpv4BroadcastFlag)
+	}
+	copy(b[dhcpv4CIAddrOffset:][:IPv4AddressSize], f.ClientAddress)
+	copy(b[dhcpv4YIAddrOffset:][:IPv4AddressSize], f.YourAddress)
+	copy(b[dhcpv4SIAddrOffset:][:IPv4AddressSize], f.ServerAddress)
+	copy(b[dhcpv4GIAddrOffset:][:IPv4AddressSize], f.GatewayAddress)
+	copy(b[dhcpv4CHAddrOffset:][:dhcpv4CHAddrSize], f.ClientHardwareAddress)
+	binary.BigEndian.PutUint32(b[dhcpv4MagicCookieOffset:], DHCPv4MagicCookie)
+	o := b[dhcpv4OptionsOffset:]
+	for _, opt := range f.Options {
+		if len(opt.Data) > 0xff {
+			panic(fmt.Sprintf("got DHCP option %d with %d bytes of data, expected at most 255 bytes", opt.Code, len(opt.Data)))
+		}
+		o[0], o[1] = byte(opt.Code), byte(len(opt.Data))
+		copy(o[2:], opt.Data)
+		o = o[2+len(opt.Data):]
+	}
+	o[0] = byte(DHCPv4OptionEnd)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestDHCPv4(t *testing.T) {
+	const (
+		clientAddr = tcpip.Address("\x0a\x00\x00\x02")
+		serverAddr = tcpip.Address("\x0a\x00\x00\x01")
+		dnsAddr1   = tcpip.Address("\x08\x08\x08\x08")
+		dnsAddr2   = tcpip.Address("\x08\x08\x04\x04")
+		linkAddr   = tcpip.LinkAddress("\x02\x03\x04\x05\x06\x07")
+	)
+	fields := header.DHCPv4Fields{
+		Op:                    header.DHCPv4BootReply,
+		XID:                   0x01020304,
+		Secs:                  5,
+		Broadcast:             true,
+		YourAddress:           clientAddr,
+		ServerAddress:         serverAddr,
+		ClientHardwareAddress: linkAddr,
+		Options: header.DHCPv4Options{
+			header.DHCPv4MessageTypeOption(header.DHCPv4Offer),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionServerIdentifier, serverAddr),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionSubnetMask, "\xff\xff\xff\x00"),
+			header.DHCPv4AddressesOption(header.DHCPv4OptionDomainNameServer, dnsAddr1, dnsAddr2),
+			header.DHCPv4DurationOption(header.DHCPv4OptionIPAddressLeaseTime, time.Hour),
+		},
+	}
+
+	b := make([]byte, header.DHCPv4Size(fields.Options))
+	msg := header.DHCPv4(b)
+	msg.Encode(&fields)
+	if !msg.IsValid() {
+		t.Fatalf("got msg.IsValid() = false, want = true")
+	}
+	if got := b[len(b)-1]; got != byte(header.DHCPv4OptionEnd) {
+		t.Errorf("got last byte = %d, want = %d", got, header.DHCPv4OptionEnd)
+	}
+	if got := msg.Op(); got != fields.Op {
+		t.Errorf("got msg.Op() = %d, want = %d", got, fields.Op)
+	}
+	if got := msg.XID(); got != fields.XID {
+		t.Errorf("got msg.XID() = %#x, want = %#x", got, fields.XID)
+	}
+	if got := msg.Secs(); got != fields.Secs {
+		t.Errorf("got msg.Secs() = %d, want = %d", got, fields.Secs)
+	}
+	if !msg.Broadcast() {
+		t.Errorf("got msg.Broadcast() = false, want = true")
+	}
+	if got := msg.ClientAddress(); got != header.IPv4Any {
+		t.Errorf("got msg.ClientAddress() = %s, want = %s", got, header.IPv4Any)
+	}
+	if got := msg.YourAddress(); got != clientAddr {
+		t.Errorf("got msg.YourAddress() = %s, want = %s", got, clientAddr)
+	}
+	if got := msg.ServerAddress(); got != serverAddr {
+		t.Errorf("got msg.ServerAddress() = %s, want = %s", got, serverAddr)
+	}
+	if got := msg.ClientHardwareAddress(); got != linkAddr {
+		t.Errorf("got msg.ClientHardwareAddress() = %s, want = %s", got, linkAddr)
+	}
+
+	opts, ok := msg.Options()
+	if !ok {
+		t.Fatalf("got msg.Options() = (_, false), want = (_, true)")
+	}
+	if diff := cmp.Diff(fields.Options, opts); diff != "" {
+		t.Errorf("msg.Options() mismatch (-want +got):\n%s", diff)
+	}
+	if got, ok := opts.MessageType(); !ok || got != header.DHCPv4Offer {
+		t.Errorf("got opts.MessageType() = (%s, %t), want = (%s, true)", got, ok, header.DHCPv4Offer)
+	}
+	if got, ok := opts.Address(header.DHCPv4OptionServerIdentifier); !ok || got != serverAddr {
+		t.Errorf("got opts.Address(ServerIdentifier) = (%s, %t), want = (%s, true)", got, ok, serverAddr)
+	}
+	if got, ok := opts.Addresses(header.DHCPv4OptionDomainNameServer); !ok {
+		t.Errorf("got opts.Addresses(DomainNameServer) = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff([]tcpip.Address{dnsAddr1, dnsAddr2}, got); diff != "" {
+		t.Errorf("opts.Addresses(DomainNameServer) mismatch (-want +got):\n%s", diff)
+	}
+	if got, ok := opts.Duration(header.DHCPv4OptionIPAddressLeaseTime); !ok || got != time.Hour {
+		t.Errorf("got opts.Duration(IPAddressLeaseTime) = (%s, %t), want = (%s, true)", got, ok, time.Hour)
+	}
+	if _, ok := opts.Find(header.DHCPv4OptionRouter); ok {
+		t.Errorf("got opts.Find(Router) = (_, true), want = (_, false)")
+	}
+
+	// A truncated option is malformed.
+	if _, ok := header.DHCPv4(b[:len(b)-2]).Options(); ok {
+		t.Errorf("got Options() = (_, true) for truncated options, want = (_, false)")
+	}
+	b[header.DHCPv4MinimumSize-1]++
+	if msg.IsValid() {
+		t.Errorf("got IsValid() = true with a bad magic cookie, want = false")
+	}
+}
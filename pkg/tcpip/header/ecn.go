@@ -0,0 +1,149 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+const (
+	// TOSECNMask is the mask of the ECN field in the IPv4 TOS and IPv6
+	// traffic class fields, as per RFC 3168 section 5.
+	TOSECNMask = 0x03
+
+	// TOSDSCPMask is the mask of the DSCP field in the IPv4 TOS and IPv6
+	// traffic class fields, as per RFC 2474 section 3.
+	TOSDSCPMask = 0xfc
+
+	// tosDSCPShift is the offset of the DSCP field in the IPv4 TOS and IPv6
+	// traffic class fields.
+	tosDSCPShift = 2
+)
+
+// ECN codepoints, as per RFC 3168 section 5.
+const (
+	ECNNotECT = 0x00
+	ECNECT1   = 0x01
+	ECNECT0   = 0x02
+	ECNCE     = 0x03
+)
+
+// TOSECN returns the ECN codepoint of an IPv4 TOS or IPv6 traffic class.
+func TOSECN(tos uint8) uint8 {
+	return tos & TOSECNMask
+}
+
+// TOSDSCP returns the DSCP of an IPv4 TOS or IPv6 traffic class.
+func TOSDSCP(tos uint8) uint8 {
+	return tos >> tosDSCPShift
+}
+
+// MakeTOS returns the IPv4 TOS or IPv6 traffic class holding dscp and the ECN
+// codepoint ecn.
+func MakeTOS(dscp, ecn uint8) uint8 {
+	return dscp<<tosDSCPShift | ecn&TOSECNMask
+}
+
+// TunnelDSCPMode is the way the DSCP of a packet is mapped to the outer header
+// when it is encapsulated, and back when it is decapsulated.
+type TunnelDSCPMode int
+
+const (
+	// TunnelDSCPInherit copies the DSCP of the inner header to the outer
+	// header on encapsulation, and leaves the inner header unchanged on
+	// decapsulation. This is what Linux does for tunnels set with "tos
+	// inherit".
+	TunnelDSCPInherit TunnelDSCPMode = iota
+
+	// TunnelDSCPUniform copies the DSCP of the inner header to the outer
+	// header on encapsulation, and the DSCP of the outer header back to the
+	// inner header on decapsulation, so that remarking by the network is
+	// preserved. This is the uniform model of RFC 2983 section 3.
+	TunnelDSCPUniform
+
+	// TunnelDSCPFixed sets the DSCP of the outer header to a fixed value on
+	// encapsulation, and leaves the inner header unchanged on
+	// decapsulation. This is the pipe model of RFC 2983 section 3.
+	TunnelDSCPFixed
+)
+
+// ECNTunnelMode is the way the ECN field of a packet is mapped to the outer
+// header when it is encapsulated, as per RFC 6040 section 4.1.
+type ECNTunnelMode int
+
+const (
+	// ECNTunnelNormal copies the ECN field of the inner header to the outer
+	// header, so that congestion experienced within the tunnel is
+	// propagated to the inner header on decapsulation.
+	ECNTunnelNormal ECNTunnelMode = iota
+
+	// ECNTunnelCompatibility sets the ECN field of the outer header to
+	// Not-ECT, for tunnels whose egress doesn't implement RFC 6040.
+	ECNTunnelCompatibility
+)
+
+// TunnelTOSOptions describes how the DSCP and ECN fields of a packet are mapped
+// between its inner and outer headers by an encapsulating endpoint. The zero
+// value copies both fields to the outer header.
+type TunnelTOSOptions struct {
+	// DSCP is the way the DSCP is mapped.
+	DSCP TunnelDSCPMode
+
+	// OuterDSCP is the DSCP of the outer header with TunnelDSCPFixed.
+	OuterDSCP uint8
+
+	// ECN is the way the ECN field is mapped on encapsulation.
+	// Decapsulation follows RFC 6040 section 4.2 in either mode.
+	ECN ECNTunnelMode
+}
+
+// EncapsulateTOS returns the TOS or traffic class of the outer header of a
+// packet whose inner header has TOS or traffic class inner.
+func (o TunnelTOSOptions) EncapsulateTOS(inner uint8) uint8 {
+	dscp := TOSDSCP(inner)
+	if o.DSCP == TunnelDSCPFixed {
+		dscp = o.OuterDSCP & (TOSDSCPMask >> tosDSCPShift)
+	}
+	ecn := uint8(ECNNotECT)
+	if o.ECN == ECNTunnelNormal {
+		ecn = TOSECN(inner)
+	}
+	return MakeTOS(dscp, ecn)
+}
+
+// DecapsulateTOS returns the TOS or traffic class of the inner header of a
+// packet once decapsulated, given the TOS or traffic class of its outer and
+// inner headers.
+//
+// The ECN field is combined as per RFC 6040 section 4.2, so that congestion
+// marked within the tunnel reaches the inner transport. drop is true if the
+// packet must be dropped, because it was marked CE within the tunnel but its
+// inner transport isn't ECN capable.
+func (o TunnelTOSOptions) DecapsulateTOS(outer, inner uint8) (tos uint8, drop bool) {
+	dscp := TOSDSCP(inner)
+	if o.DSCP == TunnelDSCPUniform {
+		dscp = TOSDSCP(outer)
+	}
+
+	innerECN, outerECN := TOSECN(inner), TOSECN(outer)
+	ecn := innerECN
+	switch {
+	case innerECN == ECNNotECT:
+		if outerECN == ECNCE {
+			return 0, true
+		}
+	case outerECN == ECNCE:
+		ecn = ECNCE
+	case outerECN == ECNECT1 && innerECN == ECNECT0:
+		ecn = ECNECT1
+	}
+	return MakeTOS(dscp, ecn), false
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestEncapsulateTOS(t *testing.T) {
+	const af41 = 34
+
+	tests := []struct {
+		name  string
+		opts  header.TunnelTOSOptions
+		inner uint8
+		want  uint8
+	}{
+		{
+			name:  "default copies DSCP and ECN",
+			inner: header.MakeTOS(af41, header.ECNECT0),
+			want:  header.MakeTOS(af41, header.ECNECT0),
+		},
+		{
+			name:  "normal mode copies CE",
+			inner: header.MakeTOS(af41, header.ECNCE),
+			want:  header.MakeTOS(af41, header.ECNCE),
+		},
+		{
+			name:  "compatibility mode",
+			opts:  header.TunnelTOSOptions{ECN: header.ECNTunnelCompatibility},
+			inner: header.MakeTOS(af41, header.ECNCE),
+			want:  header.MakeTOS(af41, header.ECNNotECT),
+		},
+		{
+			name:  "fixed DSCP",
+			opts:  header.TunnelTOSOptions{DSCP: header.TunnelDSCPFixed, OuterDSCP: 10},
+			inner: header.MakeTOS(af41, header.ECNECT1),
+			want:  header.MakeTOS(10, header.ECNECT1),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.opts.EncapsulateTOS(test.inner); got != test.want {
+				t.Errorf("got EncapsulateTOS(%#x) = %#x, want = %#x", test.inner, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecapsulateTOS(t *testing.T) {
+	// The table of RFC 6040 section 4.2, indexed by the inner then outer
+	// ECN codepoints. -1 means the packet is dropped.
+	codepoints := []uint8{header.ECNNotECT, header.ECNECT0, header.ECNECT1, header.ECNCE}
+	want := [][]int{
+		{header.ECNNotECT, header.ECNNotECT, header.ECNNotECT, -1},
+		{header.ECNECT0, header.ECNECT0, header.ECNECT1, header.ECNCE},
+		{header.ECNECT1, header.ECNECT1, header.ECNECT1, header.ECNCE},
+		{header.ECNCE, header.ECNCE, header.ECNCE, header.ECNCE},
+	}
+
+	var opts header.TunnelTOSOptions
+	for i, inner := range codepoints {
+		for j, outer := range codepoints {
+			tos, drop := opts.DecapsulateTOS(header.MakeTOS(0, outer), header.MakeTOS(0, inner))
+			if w := want[i][j]; w < 0 {
+				if !drop {
+					t.Errorf("got DecapsulateTOS(outer ECN %d, inner ECN %d) = (%#x, false), want drop", outer, inner, tos)
+				}
+			} else if drop || header.TOSECN(tos) != uint8(w) {
+				t.Errorf("got DecapsulateTOS(outer ECN %d, inner ECN %d) = (%#x, %t), want ECN %d", outer, inner, tos, drop, w)
+			}
+		}
+	}
+}
+
+func TestDecapsulateTOSDSCP(t *testing.T) {
+	outer := header.MakeTOS(10, header.ECNECT0)
+	inner := header.MakeTOS(34, header.ECNECT0)
+	for _, test := range []struct {
+		mode header.TunnelDSCPMode
+		want uint8
+	}{
+		{mode: header.TunnelDSCPInherit, want: 34},
+		{mode: header.TunnelDSCPUniform, want: 10},
+		{mode: header.TunnelDSCPFixed, want: 34},
+	} {
+		opts := header.TunnelTOSOptions{DSCP: test.mode}
+		tos, drop := opts.DecapsulateTOS(outer, inner)
+		if drop {
+			t.Fatalf("got DecapsulateTOS(%#x, %#x) dropped with DSCP mode %d", outer, inner, test.mode)
+		}
+		if got := header.TOSDSCP(tos); got != test.want {
+			t.Errorf("got DSCP %d with DSCP mode %d, want = %d", got, test.mode, test.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	geneveVersionOptLenOffset = 0
+	geneveFlagsOffset         = 1
+	geneveProtocolTypeOffset  = 2
+	geneveVNIOffset           = 4
+
+	geneveOAM         = 1 << 7
+	geneveCritical    = 1 << 6
+	geneveOptLenMask  = 0x3f
+	geneveVersionBits = 6
+
+	// geneveOptionHeaderSize is the size of the Option Class, Type and Length
+	// fields of an option.
+	geneveOptionHeaderSize = 4
+	// geneveOptionLengthMask is the mask of the Length field of an option.
+	geneveOptionLengthMask = 0x1f
+)
+
+const (
+	// GeneveMinimumSize is the size of a Geneve header without options.
+	GeneveMinimumSize = 8
+
+	// GenevePort is the UDP port assigned to Geneve by IANA.
+	GenevePort = 6081
+
+	// GeneveMaximumVNI is the largest Virtual Network Identifier, which is 24
+	// bits long.
+	GeneveMaximumVNI = 1<<24 - 1
+)
+
+// GeneveOption is a variable length option of a Geneve header, as per RFC 8926
+// section 3.5.
+type GeneveOption struct {
+	// Class is the "option class" field.
+	Class uint16
+
+	// Type is the "type" field. Its high bit is the critical bit.
+	Type uint8
+
+	// Data is the option data, which must be a multiple of 4 bytes long and
+	// at most 124 bytes long.
+	Data []byte
+}
+
+// GeneveFields contains the fields of a Geneve header. It is used to describe
+// the fields of a header that needs to be encoded.
+type GeneveFields struct {
+	// OAM is the O bit, set on control packets.
+	OAM bool
+
+	// Critical is the C bit, set if an option has its critical bit set.
+	Critical bool
+
+	// ProtocolType is the "protocol type" field, the EtherType of the
+	// payload.
+	ProtocolType tcpip.NetworkProtocolNumber
+
+	// VNI is the Virtual Network Identifier, which must fit in 24 bits.
+	VNI uint32
+
+	// Options are the variable length options.
+	Options []GeneveOption
+}
+
+// HeaderLength returns the length of a Geneve header holding f.Options.
+func (f *GeneveFields) HeaderLength() int {
+	length := GeneveMinimumSize
+	for _, o := range f.Options {
+		length += geneveOptionHeaderSize + len(o.Data)
+	}
+	return length
+}
+
+// Geneve represents a Generic Network Virtualization Encapsulation header
+// stored in a byte array, as per RFC 8926 section 3.4.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |Ver|  Opt Len  |O|C|    Rsvd.  |          Protocol Type        |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |        Virtual Network Identifier (VNI)       |    Reserved   |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                                                               |
+//   ~                    Variable-Length Options                    ~
+//   |                                                               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type Geneve []byte
+
+// Version returns the "version" field.
+func (b Geneve) Version() uint8 {
+	return b[geneveVersionOptLenOffset] >> geneveVersionBits
+}
+
+// OptionsLength returns the length in bytes of the options.
+func (b Geneve) OptionsLength() int {
+	// The Opt Len field is in units of 4 bytes.
+	return int(b[geneveVersionOptLenOffset]&geneveOptLenMask) * 4
+}
+
+// HeaderLength returns the length of the header, including the options.
+func (b Geneve) HeaderLength() int {
+	return GeneveMinimumSize + b.OptionsLength()
+}
+
+// OAM returns true if the O bit is set.
+func (b Geneve) OAM() bool {
+	return b[geneveFlagsOffset]&geneveOAM != 0
+}
+
+// Critical returns true if the C bit is set.
+func (b Geneve) Critical() bool {
+	return b[geneveFlagsOffset]&geneveCritical != 0
+}
+
+// ProtocolType returns the "protocol type" field.
+func (b Geneve) ProtocolType() tcpip.NetworkProtocolNumber {
+	return tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[geneveProtocolTypeOffset:]))
+}
+
+// VNI returns the Virtual Network Identifier.
+func (b Geneve) VNI() uint32 {
+	return binary.BigEndian.Uint32(b[geneveVNIOffset:]) >> 8
+}
+
+// Options returns the variable length options. It returns false if an option
+// doesn't fit in the length of the options.
+func (b Geneve) Options() ([]GeneveOption, bool) {
+	if len(b) < b.HeaderLength() {
+		return nil, false
+	}
+	var opts []GeneveOption
+	for o := b[GeneveMinimumSize:b.HeaderLength()]; len(o) != 0; {
+		if len(o) < geneveOptionHeaderSize {
+			return nil, false
+		}
+		// The Length field is in units of 4 bytes and excludes the option
+		// header.
+		dataLen := int(o[3]&geneveOptionLengthMask) * 4
+		if len(o) < geneveOptionHeaderSize+dataLen {
+			return nil, false
+		}
+		opt := GeneveOption{
+			Class: binary.BigEndian.Uint16(o),
+			Type:  o[2],
+		}
+		if dataLen != 0 {
+			opt.Data = o[geneveOptionHeaderSize:][:dataLen]
+		}
+		opts = append(opts, opt)
+		o = o[geneveOptionHeaderSize+dataLen:]
+	}
+	return opts, true
+}
+
+// Payload returns the data following the header.
+func (b Geneve) Payload() []byte {
+	return b[b.HeaderLength():]
+}
+
+// IsValid returns true if b is long enough to hold the options it claims to
+// hold, which are well formed, and is of version 0.
+func (b Geneve) IsValid() bool {
+	if len(b) < GeneveMinimumSize || b.Version() != 0 {
+		return false
+	}
+	_, ok := b.Options()
+	return ok
+}
+
+// Encode encodes all the fields of the Geneve header into b, which must be
+// f.HeaderLength() bytes long.
+func (b Geneve) Encode(f *GeneveFields) {
+	optsLen := f.HeaderLength() - GeneveMinimumSize
+	if optsLen/4 > geneveOptLenMask {
+		panic(fmt.Sprintf("got %d bytes of Geneve options, expected at most %d bytes", optsLen, geneveOptLenMask*4))
+	}
+	b[geneveVersionOptLenOffset] = uint8(optsLen / 4)
+	var flags uint8
+	if f.OAM {
+		flags |= geneveOAM
+	}
+	if f.Critical {
+		flags |= geneveCritical
+	}
+	b[geneveFlagsOffset] = flags
+	binary.BigEndian.PutUint16(b[geneveProtocolTypeOffset:], uint16(f.ProtocolType))
+	binary.BigEndian.PutUint32(b[geneveVNIOffset:], (f.VNI&GeneveMaximumVNI)<<8)
+	o := b[GeneveMinimumSize:]
+	for _, opt := range f.Options {
+		if len(opt.Data)%4 != 0 || len(opt.Data)/4 > geneveOptionLengthMask {
+			panic(fmt.Sprintf("got Geneve option data of %d bytes, expected a multiple of 4 bytes of at most %d bytes", len(opt.Data), geneveOptionLengthMask*4))
+		}
+		binary.BigEndian.PutUint16(o, opt.Class)
+		o[2] = opt.Type
+		o[3] = uint8(len(opt.Data) / 4)
+		copy(o[geneveOptionHeaderSize:], opt.Data)
+		o = o[geneveOptionHeaderSize+len(opt.Data):]
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestGeneve(t *testing.T) {
+	fields := header.GeneveFields{
+		Critical:     true,
+		ProtocolType: header.IPv4ProtocolNumber,
+		VNI:          0x123456,
+		Options: []header.GeneveOption{
+			{Class: 0x0102, Type: 0x83, Data: []byte{1, 2, 3, 4}},
+			{Class: 0x0304, Type: 0x05, Data: nil},
+		},
+	}
+	want := []byte{
+		0x03,       // Ver and Opt Len
+		0x40,       // O, C and Rsvd.
+		0x08, 0x00, // Protocol Type
+		0x12, 0x34, 0x56, 0x00, // VNI and Reserved
+		// Option [1]
+		0x01, 0x02, 0x83, 0x01,
+		0x01, 0x02, 0x03, 0x04,
+		// Option [2]
+		0x03, 0x04, 0x05, 0x00,
+	}
+
+	if got := fields.HeaderLength(); got != len(want) {
+		t.Fatalf("got fields.HeaderLength() = %d, want = %d", got, len(want))
+	}
+	b := make([]byte, fields.HeaderLength())
+	geneve := header.Geneve(b)
+	geneve.Encode(&fields)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got encoded header = %x, want = %x", b, want)
+	}
+	if !geneve.IsValid() {
+		t.Fatalf("got geneve.IsValid() = false, want = true")
+	}
+	if got := geneve.HeaderLength(); got != len(want) {
+		t.Errorf("got geneve.HeaderLength() = %d, want = %d", got, len(want))
+	}
+	if geneve.OAM() {
+		t.Errorf("got geneve.OAM() = true, want = false")
+	}
+	if !geneve.Critical() {
+		t.Errorf("got geneve.Critical() = false, want = true")
+	}
+	if got, want := geneve.VNI(), fields.VNI; got != want {
+		t.Errorf("got geneve.VNI() = %#x, want = %#x", got, want)
+	}
+	if opts, ok := geneve.Options(); !ok {
+		t.Errorf("got geneve.Options() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(fields.Options, opts); diff != "" {
+		t.Errorf("geneve.Options() mismatch (-want +got):\n%s", diff)
+	}
+	if header.Geneve(b[:len(b)-1]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated header, want = false")
+	}
+
+	// An option whose data overruns the options is malformed.
+	b[header.GeneveMinimumSize+3] = 3
+	if geneve.IsValid() {
+		t.Errorf("got IsValid() = true for an overrunning option, want = false")
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	greFlagsOffset        = 0
+	greVersionOffset      = 1
+	greProtocolTypeOffset = 2
+
+	greChecksumPresent = 1 << 7
+	greKeyPresent      = 1 << 5
+	greSequencePresent = 1 << 4
+	greVersionMask     = 0x7
+
+	// greOptionalFieldSize is the size of each of the optional fields: the
+	// Checksum with the Reserved1 field that follows it, the Key and the
+	// Sequence Number.
+	greOptionalFieldSize = 4
+)
+
+const (
+	// GREMinimumSize is the size of a GRE header without optional fields.
+	GREMinimumSize = 4
+
+	// GREMaximumSize is the size of a GRE header with all the optional
+	// fields.
+	GREMaximumSize = GREMinimumSize + 3*greOptionalFieldSize
+
+	// GREProtocolNumber is GRE's transport protocol number.
+	GREProtocolNumber tcpip.TransportProtocolNumber = 47
+)
+
+// GREFields contains the fields of a GRE header. It is used to describe the
+// fields of a header that needs to be encoded.
+type GREFields struct {
+	// ChecksumPresent is the C bit. If it is set, the header holds a Checksum
+	// field, which is left zero by Encode.
+	ChecksumPresent bool
+
+	// KeyPresent is the K bit. If it is set, the header holds Key.
+	KeyPresent bool
+
+	// SequencePresent is the S bit. If it is set, the header holds
+	// SequenceNumber.
+	SequencePresent bool
+
+	// Version is the "version" field, which is 0 for GRE.
+	Version uint8
+
+	// ProtocolType is the "protocol type" field, the EtherType of the payload.
+	ProtocolType tcpip.NetworkProtocolNumber
+
+	// Key is the "key" field.
+	Key uint32
+
+	// SequenceNumber is the "sequence number" field.
+	SequenceNumber uint32
+}
+
+// HeaderLength returns the length of a GRE header holding the optional fields
+// that are present in f.
+func (f *GREFields) HeaderLength() int {
+	length := GREMinimumSize
+	for _, present := range []bool{f.ChecksumPresent, f.KeyPresent, f.SequencePresent} {
+		if present {
+			length += greOptionalFieldSize
+		}
+	}
+	return length
+}
+
+// GRE represents a Generic Routing Encapsulation header stored in a byte
+// array, as per RFC 2784 with the Key and Sequence Number extensions of RFC
+// 2890.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |C| |K|S| Reserved0       | Ver |         Protocol Type         |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |      Checksum (optional)      |       Reserved1 (Optional)    |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                         Key (optional)                        |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                 Sequence Number (Optional)                    |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type GRE []byte
+
+// ChecksumPresent returns true if the C bit is set.
+func (b GRE) ChecksumPresent() bool {
+	return b[greFlagsOffset]&greChecksumPresent != 0
+}
+
+// KeyPresent returns true if the K bit is set.
+func (b GRE) KeyPresent() bool {
+	return b[greFlagsOffset]&greKeyPresent != 0
+}
+
+// SequencePresent returns true if the S bit is set.
+func (b GRE) SequencePresent() bool {
+	return b[greFlagsOffset]&greSequencePresent != 0
+}
+
+// Version returns the "version" field.
+func (b GRE) Version() uint8 {
+	return b[greVersionOffset] & greVersionMask
+}
+
+// ProtocolType returns the "protocol type" field.
+func (b GRE) ProtocolType() tcpip.NetworkProtocolNumber {
+	return tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[greProtocolTypeOffset:]))
+}
+
+// HeaderLength returns the length of the header, including the optional
+// fields that are present.
+func (b GRE) HeaderLength() int {
+	f := GREFields{
+		ChecksumPresent: b.ChecksumPresent(),
+		KeyPresent:      b.KeyPresent(),
+		SequencePresent: b.SequencePresent(),
+	}
+	return f.HeaderLength()
+}
+
+// checksumOffset returns the offset of the Checksum field.
+func (GRE) checksumOffset() int {
+	return GREMinimumSize
+}
+
+// keyOffset returns the offset of the Key field.
+func (b GRE) keyOffset() int {
+	if b.ChecksumPresent() {
+		return GREMinimumSize + greOptionalFieldSize
+	}
+	return GREMinimumSize
+}
+
+// sequenceNumberOffset returns the offset of the Sequence Number field.
+func (b GRE) sequenceNumberOffset() int {
+	if b.KeyPresent() {
+		return b.keyOffset() + greOptionalFieldSize
+	}
+	return b.keyOffset()
+}
+
+// Checksum returns the "checksum" field. It is only meaningful if
+// ChecksumPresent returns true.
+func (b GRE) Checksum() uint16 {
+	return binary.BigEndian.Uint16(b[b.checksumOffset():])
+}
+
+// SetChecksum sets the "checksum" field, which must be present.
+func (b GRE) SetChecksum(checksum uint16) {
+	binary.BigEndian.PutUint16(b[b.checksumOffset():], checksum)
+}
+
+// CalculateChecksum calculates the checksum of the GRE header, which covers
+// the header and its payload, given the checksum of the payload. The Checksum
+// field is expected to be zero.
+func (b GRE) CalculateChecksum(partialChecksum uint16) uint16 {
+	return Checksum(b[:b.HeaderLength()], partialChecksum)
+}
+
+// Key returns the "key" field. It is only meaningful if KeyPresent returns
+// true.
+func (b GRE) Key() uint32 {
+	return binary.BigEndian.Uint32(b[b.keyOffset():])
+}
+
+// SequenceNumber returns the "sequence number" field. It is only meaningful
+// if SequencePresent returns true.
+func (b GRE) SequenceNumber() uint32 {
+	return binary.BigEndian.Uint32(b[b.sequenceNumberOffset():])
+}
+
+// Payload returns the data following the header.
+func (b GRE) Payload() []byte {
+	return b[b.HeaderLength():]
+}
+
+// IsValid returns true if b is long enough to hold the optional fields it
+// claims to hold and is of version 0.
+func (b GRE) IsValid() bool {
+	return len(b) >= GREMinimumSize && len(b) >= b.HeaderLength() && b.Version() == 0
+}
+
+// Encode encodes all the fields of the GRE header into b, which must be
+// f.HeaderLength() bytes long.
+func (b GRE) Encode(f *GREFields) {
+	var flags uint8
+	if f.ChecksumPresent {
+		flags |= greChecksumPresent
+	}
+	if f.KeyPresent {
+		flags |= greKeyPresent
+	}
+	if f.SequencePresent {
+		flags |= greSequencePresent
+	}
+	b[greFlagsOffset] = flags
+	b[greVersionOffset] = f.Version & greVersionMask
+	binary.BigEndian.PutUint16(b[greProtocolTypeOffset:], uint16(f.ProtocolType))
+	if f.ChecksumPresent {
+		binary.BigEndian.PutUint32(b[b.checksumOffset():], 0)
+	}
+	if f.KeyPresent {
+		binary.BigEndian.PutUint32(b[b.keyOffset():], f.Key)
+	}
+	if f.SequencePresent {
+		binary.BigEndian.PutUint32(b[b.sequenceNumberOffset():], f.SequenceNumber)
+	}
+}
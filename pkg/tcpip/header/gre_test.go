@@ -0,0 +1,122 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestGRE(t *testing.T) {
+	payload := []byte{0x45, 0x00, 0x00, 0x14}
+	tests := []struct {
+		name   string
+		fields header.GREFields
+		want   []byte
+	}{
+		{
+			name:   "no optional fields",
+			fields: header.GREFields{ProtocolType: header.IPv4ProtocolNumber},
+			want: []byte{
+				0x00, 0x00, // Flags and Version
+				0x08, 0x00, // Protocol Type
+			},
+		},
+		{
+			name: "key",
+			fields: header.GREFields{
+				KeyPresent:   true,
+				ProtocolType: header.IPv6ProtocolNumber,
+				Key:          0x01020304,
+			},
+			want: []byte{
+				0x20, 0x00, // Flags and Version
+				0x86, 0xdd, // Protocol Type
+				0x01, 0x02, 0x03, 0x04, // Key
+			},
+		},
+		{
+			name: "all optional fields",
+			fields: header.GREFields{
+				ChecksumPresent: true,
+				KeyPresent:      true,
+				SequencePresent: true,
+				ProtocolType:    header.IPv4ProtocolNumber,
+				Key:             0x01020304,
+				SequenceNumber:  0x05060708,
+			},
+			want: []byte{
+				0xb0, 0x00, // Flags and Version
+				0x08, 0x00, // Protocol Type
+				0x00, 0x00, 0x00, 0x00, // Checksum and Reserved1
+				0x01, 0x02, 0x03, 0x04, // Key
+				0x05, 0x06, 0x07, 0x08, // Sequence Number
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.fields.HeaderLength(); got != len(test.want) {
+				t.Fatalf("got fields.HeaderLength() = %d, want = %d", got, len(test.want))
+			}
+			b := make([]byte, test.fields.HeaderLength()+len(payload))
+			gre := header.GRE(b)
+			gre.Encode(&test.fields)
+			copy(gre.Payload(), payload)
+			if got := b[:len(test.want)]; !bytes.Equal(got, test.want) {
+				t.Fatalf("got encoded header = %x, want = %x", got, test.want)
+			}
+			if !gre.IsValid() {
+				t.Fatalf("got gre.IsValid() = false, want = true")
+			}
+			if got, want := gre.HeaderLength(), len(test.want); got != want {
+				t.Errorf("got gre.HeaderLength() = %d, want = %d", got, want)
+			}
+			if got, want := gre.ProtocolType(), test.fields.ProtocolType; got != want {
+				t.Errorf("got gre.ProtocolType() = %d, want = %d", got, want)
+			}
+			if got, want := gre.KeyPresent(), test.fields.KeyPresent; got != want {
+				t.Errorf("got gre.KeyPresent() = %t, want = %t", got, want)
+			} else if want {
+				if got, want := gre.Key(), test.fields.Key; got != want {
+					t.Errorf("got gre.Key() = %#x, want = %#x", got, want)
+				}
+			}
+			if got, want := gre.SequencePresent(), test.fields.SequencePresent; got != want {
+				t.Errorf("got gre.SequencePresent() = %t, want = %t", got, want)
+			} else if want {
+				if got, want := gre.SequenceNumber(), test.fields.SequenceNumber; got != want {
+					t.Errorf("got gre.SequenceNumber() = %#x, want = %#x", got, want)
+				}
+			}
+			if got, want := gre.ChecksumPresent(), test.fields.ChecksumPresent; got != want {
+				t.Errorf("got gre.ChecksumPresent() = %t, want = %t", got, want)
+			} else if want {
+				gre.SetChecksum(^gre.CalculateChecksum(header.Checksum(payload, 0)))
+				if got := gre.CalculateChecksum(header.Checksum(gre.Payload(), 0)); got != 0xffff {
+					t.Errorf("got checksum over header and payload = %#x, want = 0xffff", got)
+				}
+			}
+			if !bytes.Equal(gre.Payload(), payload) {
+				t.Errorf("got gre.Payload() = %x, want = %x", gre.Payload(), payload)
+			}
+			if header.GRE(b[:len(test.want)-1]).IsValid() {
+				t.Errorf("got IsValid() = true for a truncated header, want = false")
+			}
+		})
+	}
+}
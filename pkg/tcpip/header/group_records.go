@@ -0,0 +1,186 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// GroupRecordType is the type of a Group Record of an IGMPv3 Membership Report
+// or of a Multicast Address Record of an MLDv2 Report.
+type GroupRecordType uint8
+
+// Values for the record types described in RFC 3376 section 4.2.12 and RFC
+// 3810 section 5.2.12.
+const (
+	GroupRecordModeIsInclude       GroupRecordType = 1
+	GroupRecordModeIsExclude       GroupRecordType = 2
+	GroupRecordChangeToIncludeMode GroupRecordType = 3
+	GroupRecordChangeToExcludeMode GroupRecordType = 4
+	GroupRecordAllowNewSources     GroupRecordType = 5
+	GroupRecordBlockOldSources     GroupRecordType = 6
+)
+
+// groupRecordMinimumSizeNoAddress is the size of a record without its
+// addresses and auxiliary data.
+const groupRecordMinimumSizeNoAddress = 4
+
+// GroupRecord is a Group Record of an IGMPv3 Membership Report or a Multicast
+// Address Record of an MLDv2 Report, which have the same format apart from the
+// size of their addresses.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |  Record Type  |  Aux Data Len |     Number of Sources (N)     |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                       Multicast Address                       |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                       Source Address [1]                      |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                               .                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                       Source Address [N]                      |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                         Auxiliary Data                        |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type GroupRecord struct {
+	Type             GroupRecordType
+	MulticastAddress tcpip.Address
+	Sources          []tcpip.Address
+	// AuxData must be a multiple of 4 bytes long.
+	AuxData []byte
+}
+
+// groupRecordsSize returns the size in bytes of records holding addresses of
+// addrSize bytes.
+func groupRecordsSize(records []GroupRecord, addrSize int) int {
+	var size int
+	for _, r := range records {
+		size += groupRecordMinimumSizeNoAddress + addrSize*(1+len(r.Sources)) + len(r.AuxData)
+	}
+	return size
+}
+
+// putAddresses serializes addrs of addrSize bytes each into b, which must be
+// large enough to hold them.
+func putAddresses(b []byte, addrs []tcpip.Address, addrSize int) {
+	for _, addr := range addrs {
+		if len(addr) != addrSize {
+			panic(fmt.Sprintf("got address %s of %d bytes, expected %d bytes", addr, len(addr), addrSize))
+		}
+		b = b[copy(b, addr):]
+	}
+}
+
+// putGroupRecords serializes records holding addresses of addrSize bytes into
+// b, which must be groupRecordsSize(records, addrSize) bytes long.
+func putGroupRecords(b []byte, records []GroupRecord, addrSize int) {
+	for _, r := range records {
+		if len(r.AuxData)%4 != 0 {
+			panic(fmt.Sprintf("got auxiliary data of %d bytes, expected a multiple of 4 bytes", len(r.AuxData)))
+		}
+		b[0] = byte(r.Type)
+		b[1] = uint8(len(r.AuxData) / 4)
+		binary.BigEndian.PutUint16(b[2:], uint16(len(r.Sources)))
+		b = b[groupRecordMinimumSizeNoAddress:]
+		putAddresses(b, []tcpip.Address{r.MulticastAddress}, addrSize)
+		b = b[addrSize:]
+		putAddresses(b, r.Sources, addrSize)
+		b = b[addrSize*len(r.Sources):]
+		b = b[copy(b, r.AuxData):]
+	}
+}
+
+// parseAddresses parses n addresses of addrSize bytes from b, returning nil if
+// n is 0. It returns false if b is too short to hold them.
+func parseAddresses(b []byte, n uint16, addrSize int) ([]tcpip.Address, bool) {
+	if len(b) < int(n)*addrSize {
+		return nil, false
+	}
+	if n == 0 {
+		return nil, true
+	}
+	addrs := make([]tcpip.Address, 0, n)
+	for i := 0; i < int(n); i++ {
+		addrs = append(addrs, tcpip.Address(b[:addrSize]))
+		b = b[addrSize:]
+	}
+	return addrs, true
+}
+
+// parseGroupRecords parses n records holding addresses of addrSize bytes from
+// b. It returns false if b is too short to hold them.
+func parseGroupRecords(b []byte, n uint16, addrSize int) ([]GroupRecord, bool) {
+	records := make([]GroupRecord, 0, n)
+	for i := 0; i < int(n); i++ {
+		if len(b) < groupRecordMinimumSizeNoAddress+addrSize {
+			return nil, false
+		}
+		auxDataLen := int(b[1]) * 4
+		numSources := binary.BigEndian.Uint16(b[2:])
+		r := GroupRecord{
+			Type:             GroupRecordType(b[0]),
+			MulticastAddress: tcpip.Address(b[groupRecordMinimumSizeNoAddress:][:addrSize]),
+		}
+		b = b[groupRecordMinimumSizeNoAddress+addrSize:]
+		sources, ok := parseAddresses(b, numSources, addrSize)
+		if !ok {
+			return nil, false
+		}
+		r.Sources = sources
+		b = b[int(numSources)*addrSize:]
+		if len(b) < auxDataLen {
+			return nil, false
+		}
+		if auxDataLen != 0 {
+			r.AuxData = b[:auxDataLen]
+			b = b[auxDataLen:]
+		}
+		records = append(records, r)
+	}
+	return records, true
+}
+
+// decodeExpMant decodes a code that holds either its value exactly or, if it
+// has the highest of mantBits+4 bits set, a floating point value with a 3-bit
+// exponent and a mantissa of mantBits, as per RFC 3376 section 4.1.1 and RFC
+// 3810 section 5.1.3.
+func decodeExpMant(code uint16, mantBits uint) uint32 {
+	if code < 1<<(mantBits+3) {
+		return uint32(code)
+	}
+	exp := uint(code>>mantBits) & 7
+	mant := uint32(code) & (1<<mantBits - 1)
+	return (mant | 1<<mantBits) << (exp + 3)
+}
+
+// encodeExpMant is the inverse of decodeExpMant. Values that can't be
+// represented exactly are rounded down, and values that are too large are
+// encoded as the largest value.
+func encodeExpMant(v uint32, mantBits uint) uint16 {
+	if v < 1<<(mantBits+3) {
+		return uint16(v)
+	}
+	for exp := uint(0); exp < 8; exp++ {
+		if mant := v >> (exp + 3); mant < 1<<(mantBits+1) {
+			return uint16(1<<(mantBits+3) | exp<<mantBits | uint(mant)&(1<<mantBits-1))
+		}
+	}
+	return uint16(uint32(1)<<(mantBits+4) - 1)
+}
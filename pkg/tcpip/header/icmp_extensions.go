@@ -0,0 +1,618 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	icmpExtensionVersionOffset  = 0
+	icmpExtensionChecksumOffset = 2
+	icmpExtensionVersionShift   = 4
+
+	icmpExtensionObjectLengthOffset   = 0
+	icmpExtensionObjectClassNumOffset = 2
+	icmpExtensionObjectCTypeOffset    = 3
+)
+
+const (
+	// ICMPExtensionHeaderSize is the size of the ICMP extension header.
+	ICMPExtensionHeaderSize = 4
+
+	// ICMPExtensionVersion is the version of the ICMP extension structure,
+	// as per RFC 4884 section 7.
+	ICMPExtensionVersion = 2
+
+	// ICMPExtensionObjectHeaderSize is the size of the header of an ICMP
+	// extension object.
+	ICMPExtensionObjectHeaderSize = 4
+
+	// ICMPExtensionMinimumOriginalDatagramSize is the size the original
+	// datagram of an ICMP message must be padded to when the message carries
+	// an extension structure, as per RFC 4884 section 5.1:
+	//
+	//   When the ICMP Extension Structure is appended to an ICMP message and
+	//   that ICMP message contains an "original datagram" field, the "original
+	//   datagram" field MUST contain at least 128 octets.
+	ICMPExtensionMinimumOriginalDatagramSize = 128
+)
+
+// ICMPExtensionClass is the Class-Num field of an ICMP extension object.
+type ICMPExtensionClass uint8
+
+// Values of ICMPExtensionClass.
+const (
+	// ICMPExtensionClassMPLSLabelStack is the MPLS Label Stack class, as per
+	// RFC 4950 section 7.
+	ICMPExtensionClassMPLSLabelStack ICMPExtensionClass = 1
+
+	// ICMPExtensionClassInterfaceInformation is the Interface Information
+	// class, as per RFC 5837 section 4.
+	ICMPExtensionClassInterfaceInformation ICMPExtensionClass = 2
+
+	// ICMPExtensionClassInterfaceIdentification is the Interface
+	// Identification class of ICMP Extended Echo Requests, as per RFC 8335
+	// section 2.1.
+	ICMPExtensionClassInterfaceIdentification ICMPExtensionClass = 3
+)
+
+// ICMPExtensionObject is an object of an ICMP extension structure.
+type ICMPExtensionObject struct {
+	// ClassNum is the "class-num" field.
+	ClassNum ICMPExtensionClass
+
+	// CType is the "c-type" field, whose meaning depends on ClassNum.
+	CType uint8
+
+	// Payload is the object payload, which must be a multiple of 4 bytes
+	// long.
+	Payload []byte
+}
+
+// ICMPExtensionSize returns the size of an ICMP extension structure holding
+// objects.
+func ICMPExtensionSize(objects []ICMPExtensionObject) int {
+	size := ICMPExtensionHeaderSize
+	for _, o := range objects {
+		size += ICMPExtensionObjectHeaderSize + len(o.Payload)
+	}
+	return size
+}
+
+// ICMPExtension represents an ICMP extension structure stored in a byte array,
+// as per RFC 4884 section 7. It is appended to the original datagram of ICMP
+// Destination Unreachable, Time Exceeded and Parameter Problem messages.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |Version|      (Reserved)       |           Checksum            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |             Length            |   Class-Num   |   C-Type      |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                                                               |
+//   |               // (Object payload) //                          |
+//   |                                                               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type ICMPExtension []byte
+
+// Version returns the "version" field.
+func (b ICMPExtension) Version() uint8 {
+	return b[icmpExtensionVersionOffset] >> icmpExtensionVersionShift
+}
+
+// Checksum returns the "checksum" field.
+func (b ICMPExtension) Checksum() uint16 {
+	return binary.BigEndian.Uint16(b[icmpExtensionChecksumOffset:])
+}
+
+// SetChecksum sets the "checksum" field.
+func (b ICMPExtension) SetChecksum(checksum uint16) {
+	binary.BigEndian.PutUint16(b[icmpExtensionChecksumOffset:], checksum)
+}
+
+// CalculateChecksum calculates the checksum of the extension structure. The
+// checksum covers the whole structure, with the Checksum field excluded.
+func (b ICMPExtension) CalculateChecksum() uint16 {
+	// b[2:4] is the checksum itself, set it aside to avoid checksumming the
+	// checksum.
+	h2, h3 := b[2], b[3]
+	b[2], b[3] = 0, 0
+	xsum := ^Checksum(b, 0)
+	b[2], b[3] = h2, h3
+	return xsum
+}
+
+// Objects returns the objects of the extension structure. It returns false if
+// an object has a malformed length.
+func (b ICMPExtension) Objects() ([]ICMPExtensionObject, bool) {
+	var objects []ICMPExtensionObject
+	for o := b[ICMPExtensionHeaderSize:]; len(o) != 0; {
+		if len(o) < ICMPExtensionObjectHeaderSize {
+			return nil, false
+		}
+		// The Length field includes the object header.
+		length := int(binary.BigEndian.Uint16(o[icmpExtensionObjectLengthOffset:]))
+		if length < ICMPExtensionObjectHeaderSize || length%4 != 0 || length > len(o) {
+			return nil, false
+		}
+		object := ICMPExtensionObject{
+			ClassNum: ICMPExtensionClass(o[icmpExtensionObjectClassNumOffset]),
+			CType:    o[icmpExtensionObjectCTypeOffset],
+		}
+		if length > ICMPExtensionObjectHeaderSize {
+			object.Payload = o[ICMPExtensionObjectHeaderSize:length]
+		}
+		objects = append(objects, object)
+		o = o[length:]
+	}
+	return objects, true
+}
+
+// IsValid returns true if b holds a version 2 extension structure with a
+// correct checksum and well formed objects.
+func (b ICMPExtension) IsValid() bool {
+	if len(b) < ICMPExtensionHeaderSize || b.Version() != ICMPExtensionVersion {
+		return false
+	}
+	if b.CalculateChecksum() != b.Checksum() {
+		return false
+	}
+	_, ok := b.Objects()
+	return ok
+}
+
+// Encode encodes the extension header and objects into b, which must be
+// ICMPExtensionSize(objects) bytes long, and sets its checksum.
+func (b ICMPExtension) Encode(objects []ICMPExtensionObject) {
+	b[icmpExtensionVersionOffset] = ICMPExtensionVersion << icmpExtensionVersionShift
+	b[icmpExtensionVersionOffset+1] = 0
+	b.SetChecksum(0)
+	o := b[ICMPExtensionHeaderSize:]
+	for _, object := range objects {
+		length := ICMPExtensionObjectHeaderSize + len(object.Payload)
+		if len(object.Payload)%4 != 0 || length > 0xffff {
+			panic(fmt.Sprintf("got ICMP extension object payload of %d bytes, expected a multiple of 4 bytes", len(object.Payload)))
+		}
+		binary.BigEndian.PutUint16(o[icmpExtensionObjectLengthOffset:], uint16(length))
+		o[icmpExtensionObjectClassNumOffset] = uint8(object.ClassNum)
+		o[icmpExtensionObjectCTypeOffset] = object.CType
+		copy(o[ICMPExtensionObjectHeaderSize:], object.Payload)
+		o = o[length:]
+	}
+	b.SetChecksum(b.CalculateChecksum())
+}
+
+// icmpExtension returns the extension structure following an original
+// datagram of length bytes in payload.
+func icmpExtension(payload []byte, length int) (ICMPExtension, bool) {
+	// As per RFC 4884 section 5.2, a zero length means that there is no
+	// extension structure, and so does a length shorter than the padding
+	// the original datagram must have when followed by one.
+	if length < ICMPExtensionMinimumOriginalDatagramSize || len(payload) < length+ICMPExtensionHeaderSize {
+		return nil, false
+	}
+	return ICMPExtension(payload[length:]), true
+}
+
+const (
+	// mplsLabelStackCType is the C-Type of an MPLS Label Stack object
+	// holding incoming MPLS label stack entries, as per RFC 4950 section 7.
+	mplsLabelStackCType = 1
+
+	// MPLSLabelStackEntrySize is the size of an MPLS label stack entry.
+	MPLSLabelStackEntrySize = 4
+
+	mplsLabelShift        = 12
+	mplsTrafficClassShift = 9
+	mplsTrafficClassMask  = 0x7
+	mplsBottomOfStack     = 1 << 8
+	mplsTTLMask           = 0xff
+	mplsMaximumLabelValue = 1<<20 - 1
+)
+
+// MPLSLabelStackEntry is an entry of an MPLS label stack, as per RFC 3032
+// section 2.1.
+type MPLSLabelStackEntry struct {
+	// Label is the 20 bit label value.
+	Label uint32
+
+	// TrafficClass is the 3 bit traffic class field, formerly known as EXP.
+	TrafficClass uint8
+
+	// BottomOfStack is the S bit, set on the last entry of the stack.
+	BottomOfStack bool
+
+	// TTL is the time to live.
+	TTL uint8
+}
+
+// MPLSLabelStackObject returns an MPLS Label Stack extension object holding
+// entries, as per RFC 4950 section 7.
+func MPLSLabelStackObject(entries []MPLSLabelStackEntry) ICMPExtensionObject {
+	payload := make([]byte, len(entries)*MPLSLabelStackEntrySize)
+	for i, e := range entries {
+		if e.Label > mplsMaximumLabelValue {
+			panic(fmt.Sprintf("got MPLS label %d, expected at most %d", e.Label, mplsMaximumLabelValue))
+		}
+		v := e.Label<<mplsLabelShift | uint32(e.TrafficClass&mplsTrafficClassMask)<<mplsTrafficClassShift | uint32(e.TTL)
+		if e.BottomOfStack {
+			v |= mplsBottomOfStack
+		}
+		binary.BigEndian.PutUint32(payload[i*MPLSLabelStackEntrySize:], v)
+	}
+	return ICMPExtensionObject{
+		ClassNum: ICMPExtensionClassMPLSLabelStack,
+		CType:    mplsLabelStackCType,
+		Payload:  payload,
+	}
+}
+
+// MPLSLabelStack returns the entries of an MPLS Label Stack object. It returns
+// false if o is not an MPLS Label Stack object.
+func (o ICMPExtensionObject) MPLSLabelStack() ([]MPLSLabelStackEntry, bool) {
+	if o.ClassNum != ICMPExtensionClassMPLSLabelStack || o.CType != mplsLabelStackCType || len(o.Payload)%MPLSLabelStackEntrySize != 0 {
+		return nil, false
+	}
+	var entries []MPLSLabelStackEntry
+	for p := o.Payload; len(p) != 0; p = p[MPLSLabelStackEntrySize:] {
+		v := binary.BigEndian.Uint32(p)
+		entries = append(entries, MPLSLabelStackEntry{
+			Label:         v >> mplsLabelShift,
+			TrafficClass:  uint8(v>>mplsTrafficClassShift) & mplsTrafficClassMask,
+			BottomOfStack: v&mplsBottomOfStack != 0,
+			TTL:           uint8(v & mplsTTLMask),
+		})
+	}
+	return entries, true
+}
+
+// ICMPExtensionInterfaceRole is the role of the interface described by an
+// Interface Information object, as per RFC 5837 section 4.1.
+type ICMPExtensionInterfaceRole uint8
+
+// Values of ICMPExtensionInterfaceRole.
+const (
+	ICMPExtensionInterfaceRoleIncoming      ICMPExtensionInterfaceRole = 0
+	ICMPExtensionInterfaceRoleSubIPIncoming ICMPExtensionInterfaceRole = 1
+	ICMPExtensionInterfaceRoleOutgoing      ICMPExtensionInterfaceRole = 2
+	ICMPExtensionInterfaceRoleNextHop       ICMPExtensionInterfaceRole = 3
+)
+
+const (
+	interfaceInfoRoleShift = 6
+	interfaceInfoRoleMask  = 0x3
+	interfaceInfoIfIndex   = 1 << 3
+	interfaceInfoIPAddr    = 1 << 2
+	interfaceInfoName      = 1 << 1
+	interfaceInfoMTU       = 1 << 0
+
+	// interfaceInfoAFIIPv4 and interfaceInfoAFIIPv6 are the Address Family
+	// Identifiers of the IP Address Sub-Object.
+	interfaceInfoAFIIPv4 = 1
+	interfaceInfoAFIIPv6 = 2
+
+	// interfaceInfoAddressHeaderSize is the size of the AFI and Reserved
+	// fields of the IP Address Sub-Object.
+	interfaceInfoAddressHeaderSize = 4
+
+	// interfaceInfoMaximumNameSize is the largest value of the Length field
+	// of the Interface Name Sub-Object, which includes the Length field
+	// itself.
+	interfaceInfoMaximumNameSize = 64
+)
+
+// ICMPExtensionInterfaceInfo describes the contents of an Interface
+// Information object, as per RFC 5837 section 4. Fields holding their zero
+// value are left out of the object.
+type ICMPExtensionInterfaceInfo struct {
+	// Role is the role of the interface.
+	Role ICMPExtensionInterfaceRole
+
+	// IfIndex is the interface index.
+	IfIndex uint32
+
+	// Address is an IPv4 or IPv6 address of the interface.
+	Address tcpip.Address
+
+	// Name is the name of the interface, at most 63 bytes long.
+	Name string
+
+	// MTU is the MTU of the interface.
+	MTU uint32
+}
+
+// Object returns an Interface Information extension object describing i.
+func (i *ICMPExtensionInterfaceInfo) Object() ICMPExtensionObject {
+	cType := uint8(i.Role&interfaceInfoRoleMask) << interfaceInfoRoleShift
+	var payload []byte
+	if i.IfIndex != 0 {
+		cType |= interfaceInfoIfIndex
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], i.IfIndex)
+		payload = append(payload, b[:]...)
+	}
+	if len(i.Address) != 0 {
+		cType |= interfaceInfoIPAddr
+		var afi uint16
+		switch len(i.Address) {
+		case IPv4AddressSize:
+			afi = interfaceInfoAFIIPv4
+		case IPv6AddressSize:
+			afi = interfaceInfoAFIIPv6
+		default:
+			panic(fmt.Sprintf("got address %s of %d bytes, expected an IPv4 or IPv6 address", i.Address, len(i.Address)))
+		}
+		payload = append(payload, byte(afi>>8), byte(afi), 0, 0)
+		payload = append(payload, i.Address...)
+	}
+	if len(i.Name) != 0 {
+		cType |= interfaceInfoName
+		// The Length field includes itself and the sub-object is padded to a
+		// multiple of 4 bytes.
+		length := (1 + len(i.Name) + 3) &^ 3
+		if length > interfaceInfoMaximumNameSize {
+			panic(fmt.Sprintf("got interface name of %d bytes, expected at most %d bytes", len(i.Name), interfaceInfoMaximumNameSize-1))
+		}
+		name := make([]byte, length)
+		name[0] = uint8(length)
+		copy(name[1:], i.Name)
+		payload = append(payload, name...)
+	}
+	if i.MTU != 0 {
+		cType |= interfaceInfoMTU
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], i.MTU)
+		payload = append(payload, b[:]...)
+	}
+	return ICMPExtensionObject{
+		ClassNum: ICMPExtensionClassInterfaceInformation,
+		CType:    cType,
+		Payload:  payload,
+	}
+}
+
+// InterfaceInfo returns the contents of an Interface Information object. It
+// returns false if o is not a well formed Interface Information object.
+func (o ICMPExtensionObject) InterfaceInfo() (ICMPExtensionInterfaceInfo, bool) {
+	if o.ClassNum != ICMPExtensionClassInterfaceInformation {
+		return ICMPExtensionInterfaceInfo{}, false
+	}
+	info := ICMPExtensionInterfaceInfo{
+		Role: ICMPExtensionInterfaceRole(o.CType>>interfaceInfoRoleShift) & interfaceInfoRoleMask,
+	}
+	p := o.Payload
+	if o.CType&interfaceInfoIfIndex != 0 {
+		if len(p) < 4 {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		info.IfIndex = binary.BigEndian.Uint32(p)
+		p = p[4:]
+	}
+	if o.CType&interfaceInfoIPAddr != 0 {
+		if len(p) < interfaceInfoAddressHeaderSize {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		var size int
+		switch binary.BigEndian.Uint16(p) {
+		case interfaceInfoAFIIPv4:
+			size = IPv4AddressSize
+		case interfaceInfoAFIIPv6:
+			size = IPv6AddressSize
+		default:
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		p = p[interfaceInfoAddressHeaderSize:]
+		if len(p) < size {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		info.Address = tcpip.Address(p[:size])
+		p = p[size:]
+	}
+	if o.CType&interfaceInfoName != 0 {
+		if len(p) < 1 {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		length := int(p[0])
+		if length == 0 || length%4 != 0 || length > interfaceInfoMaximumNameSize || length > len(p) {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		name := p[1:length]
+		// The name is padded with NUL bytes.
+		for len(name) != 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		info.Name = string(name)
+		p = p[length:]
+	}
+	if o.CType&interfaceInfoMTU != 0 {
+		if len(p) < 4 {
+			return ICMPExtensionInterfaceInfo{}, false
+		}
+		info.MTU = binary.BigEndian.Uint32(p)
+		p = p[4:]
+	}
+	return info, len(p) == 0
+}
+
+// Values of the C-Type field of Interface Identification objects, as per RFC
+// 8335 section 2.1.
+const (
+	interfaceIdentByName    = 1
+	interfaceIdentByIndex   = 2
+	interfaceIdentByAddress = 3
+
+	// interfaceIdentAddressHeaderSize is the size of the AFI, Address Length
+	// and Reserved fields of an Interface Identification object identifying
+	// an interface by address.
+	interfaceIdentAddressHeaderSize = 4
+)
+
+// ICMPExtensionInterfaceIdent describes the contents of an Interface
+// Identification object, as per RFC 8335 section 2.1. Exactly one of its
+// fields identifies the probed interface.
+type ICMPExtensionInterfaceIdent struct {
+	// Name is the name of the interface.
+	Name string
+
+	// Index is the index of the interface.
+	Index uint32
+
+	// Address is an IPv4 or IPv6 address of the interface.
+	Address tcpip.Address
+}
+
+// Object returns an Interface Identification extension object describing i.
+func (i *ICMPExtensionInterfaceIdent) Object() ICMPExtensionObject {
+	switch {
+	case len(i.Name) != 0:
+		// The name is padded with NUL bytes to a multiple of 4 bytes.
+		payload := make([]byte, (len(i.Name)+3)&^3)
+		copy(payload, i.Name)
+		return ICMPExtensionObject{
+			ClassNum: ICMPExtensionClassInterfaceIdentification,
+			CType:    interfaceIdentByName,
+			Payload:  payload,
+		}
+	case len(i.Address) != 0:
+		var afi uint16
+		switch len(i.Address) {
+		case IPv4AddressSize:
+			afi = interfaceInfoAFIIPv4
+		case IPv6AddressSize:
+			afi = interfaceInfoAFIIPv6
+		default:
+			panic(fmt.Sprintf("got address %s of %d bytes, expected an IPv4 or IPv6 address", i.Address, len(i.Address)))
+		}
+		payload := make([]byte, interfaceIdentAddressHeaderSize+len(i.Address))
+		binary.BigEndian.PutUint16(payload, afi)
+		payload[2] = uint8(len(i.Address))
+		copy(payload[interfaceIdentAddressHeaderSize:], i.Address)
+		return ICMPExtensionObject{
+			ClassNum: ICMPExtensionClassInterfaceIdentification,
+			CType:    interfaceIdentByAddress,
+			Payload:  payload,
+		}
+	default:
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], i.Index)
+		return ICMPExtensionObject{
+			ClassNum: ICMPExtensionClassInterfaceIdentification,
+			CType:    interfaceIdentByIndex,
+			Payload:  payload[:],
+		}
+	}
+}
+
+// InterfaceIdent returns the contents of an Interface Identification object.
+// It returns false if o is not a well formed Interface Identification object.
+func (o ICMPExtensionObject) InterfaceIdent() (ICMPExtensionInterfaceIdent, bool) {
+	if o.ClassNum != ICMPExtensionClassInterfaceIdentification {
+		return ICMPExtensionInterfaceIdent{}, false
+	}
+	p := o.Payload
+	switch o.CType {
+	case interfaceIdentByName:
+		// The name is padded with NUL bytes.
+		for len(p) != 0 && p[len(p)-1] == 0 {
+			p = p[:len(p)-1]
+		}
+		if len(p) == 0 {
+			return ICMPExtensionInterfaceIdent{}, false
+		}
+		return ICMPExtensionInterfaceIdent{Name: string(p)}, true
+	case interfaceIdentByIndex:
+		if len(p) != 4 {
+			return ICMPExtensionInterfaceIdent{}, false
+		}
+		return ICMPExtensionInterfaceIdent{Index: binary.BigEndian.Uint32(p)}, true
+	case interfaceIdentByAddress:
+		if len(p) < interfaceIdentAddressHeaderSize {
+			return ICMPExtensionInterfaceIdent{}, false
+		}
+		var size int
+		switch binary.BigEndian.Uint16(p) {
+		case interfaceInfoAFIIPv4:
+			size = IPv4AddressSize
+		case interfaceInfoAFIIPv6:
+			size = IPv6AddressSize
+		default:
+			return ICMPExtensionInterfaceIdent{}, false
+		}
+		if int(p[2]) != size || len(p) < interfaceIdentAddressHeaderSize+size {
+			return ICMPExtensionInterfaceIdent{}, false
+		}
+		return ICMPExtensionInterfaceIdent{Address: tcpip.Address(p[interfaceIdentAddressHeaderSize:][:size])}, true
+	default:
+		return ICMPExtensionInterfaceIdent{}, false
+	}
+}
+
+// ICMPExtendedEchoStatus is the status of a probed interface carried in an
+// ICMP Extended Echo Reply, as per RFC 8335 section 3.
+type ICMPExtendedEchoStatus struct {
+	// State is the state of the neighbor entry of a probed proxy interface.
+	// It is zero when the probed interface is local.
+	State uint8
+
+	// Active is true if the interface is active.
+	Active bool
+
+	// IPv4 is true if IPv4 is running on the interface.
+	IPv4 bool
+
+	// IPv6 is true if IPv6 is running on the interface.
+	IPv6 bool
+}
+
+const (
+	extendedEchoLocalFlag    = 1 << 0
+	extendedEchoStateShift   = 5
+	extendedEchoStateMask    = 0x7
+	extendedEchoActiveFlag   = 1 << 2
+	extendedEchoIPv4Flag     = 1 << 1
+	extendedEchoIPv6Flag     = 1 << 0
+)
+
+// encode returns the byte following the sequence number of an Extended Echo
+// Reply holding s.
+func (s ICMPExtendedEchoStatus) encode() byte {
+	b := (s.State & extendedEchoStateMask) << extendedEchoStateShift
+	if s.Active {
+		b |= extendedEchoActiveFlag
+	}
+	if s.IPv4 {
+		b |= extendedEchoIPv4Flag
+	}
+	if s.IPv6 {
+		b |= extendedEchoIPv6Flag
+	}
+	return b
+}
+
+// decodeExtendedEchoStatus returns the status held in the byte following the
+// sequence number of an Extended Echo Reply.
+func decodeExtendedEchoStatus(b byte) ICMPExtendedEchoStatus {
+	return ICMPExtendedEchoStatus{
+		State:  (b >> extendedEchoStateShift) & extendedEchoStateMask,
+		Active: b&extendedEchoActiveFlag != 0,
+		IPv4:   b&extendedEchoIPv4Flag != 0,
+		IPv6:   b&extendedEchoIPv6Flag != 0,
+	}
+}
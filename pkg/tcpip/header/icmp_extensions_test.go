@@ -0,0 +1,229 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestICMPExtension(t *testing.T) {
+	entries := []header.MPLSLabelStackEntry{
+		{Label: 16, TrafficClass: 1, TTL: 1},
+		{Label: 0xfffff, BottomOfStack: true, TTL: 255},
+	}
+	info := header.ICMPExtensionInterfaceInfo{
+		Role:    header.ICMPExtensionInterfaceRoleIncoming,
+		IfIndex: 2,
+		Address: tcpip.Address("\xc0\xa8\x00\x01"),
+		Name:    "eth0",
+		MTU:     1500,
+	}
+	objects := []header.ICMPExtensionObject{
+		header.MPLSLabelStackObject(entries),
+		info.Object(),
+	}
+	want := []byte{
+		0x20, 0x00, 0x00, 0x00, // Version, Reserved and Checksum
+		// MPLS Label Stack object
+		0x00, 0x0c, 0x01, 0x01,
+		0x00, 0x01, 0x02, 0x01,
+		0xff, 0xff, 0xf1, 0xff,
+		// Interface Information object
+		0x00, 0x1c, 0x02, 0x0f,
+		0x00, 0x00, 0x00, 0x02, // ifIndex
+		0x00, 0x01, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, // IP Address
+		0x08, 'e', 't', 'h', '0', 0x00, 0x00, 0x00, // Interface Name
+		0x00, 0x00, 0x05, 0xdc, // MTU
+	}
+
+	ext := header.ICMPExtension(make([]byte, header.ICMPExtensionSize(objects)))
+	ext.Encode(objects)
+	if got := ext[4:]; !bytes.Equal(got, want[4:]) {
+		t.Fatalf("got encoded objects = %x, want = %x", got, want[4:])
+	}
+	if !ext.IsValid() {
+		t.Fatalf("got ext.IsValid() = false, want = true")
+	}
+	if got, ok := ext.Objects(); !ok {
+		t.Fatalf("got ext.Objects() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(objects, got); diff != "" {
+		t.Fatalf("ext.Objects() mismatch (-want +got):\n%s", diff)
+	}
+	if got, ok := objects[0].MPLSLabelStack(); !ok {
+		t.Errorf("got MPLSLabelStack() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(entries, got); diff != "" {
+		t.Errorf("MPLSLabelStack() mismatch (-want +got):\n%s", diff)
+	}
+	if got, ok := objects[1].InterfaceInfo(); !ok {
+		t.Errorf("got InterfaceInfo() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(info, got); diff != "" {
+		t.Errorf("InterfaceInfo() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := objects[0].InterfaceInfo(); ok {
+		t.Errorf("got InterfaceInfo() = (_, true) for an MPLS Label Stack object, want = (_, false)")
+	}
+
+	ext[len(ext)-1]++
+	if ext.IsValid() {
+		t.Errorf("got IsValid() = true with a bad checksum, want = false")
+	}
+	ext[len(ext)-1]--
+	if header.ICMPExtension(ext[:len(ext)-4]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated extension, want = false")
+	}
+}
+
+func TestICMPv4Extension(t *testing.T) {
+	objects := []header.ICMPExtensionObject{
+		header.MPLSLabelStackObject([]header.MPLSLabelStackEntry{{Label: 16, BottomOfStack: true, TTL: 1}}),
+	}
+	const datagramLength = header.ICMPExtensionMinimumOriginalDatagramSize
+	b := make([]byte, header.ICMPv4MinimumSize+datagramLength+header.ICMPExtensionSize(objects))
+	icmp := header.ICMPv4(b)
+	icmp.SetType(header.ICMPv4TimeExceeded)
+	if _, ok := icmp.Extension(); ok {
+		t.Errorf("got icmp.Extension() = (_, true) without a length, want = (_, false)")
+	}
+	icmp.SetOriginalDatagramLength(datagramLength)
+	header.ICMPExtension(icmp.Payload()[datagramLength:]).Encode(objects)
+	if got := icmp.OriginalDatagramLength(); got != datagramLength {
+		t.Errorf("got icmp.OriginalDatagramLength() = %d, want = %d", got, datagramLength)
+	}
+	if got, want := b[5], uint8(datagramLength/4); got != want {
+		t.Errorf("got length field = %d, want = %d", got, want)
+	}
+	ext, ok := icmp.Extension()
+	if !ok {
+		t.Fatalf("got icmp.Extension() = (_, false), want = (_, true)")
+	}
+	if !ext.IsValid() {
+		t.Errorf("got ext.IsValid() = false, want = true")
+	}
+}
+
+func TestICMPv6Extension(t *testing.T) {
+	objects := []header.ICMPExtensionObject{
+		header.MPLSLabelStackObject([]header.MPLSLabelStackEntry{{Label: 16, BottomOfStack: true, TTL: 1}}),
+	}
+	const datagramLength = header.ICMPExtensionMinimumOriginalDatagramSize
+	b := make([]byte, header.ICMPv6MinimumSize+datagramLength+header.ICMPExtensionSize(objects))
+	icmp := header.ICMPv6(b)
+	icmp.SetType(header.ICMPv6TimeExceeded)
+	icmp.SetOriginalDatagramLength(datagramLength)
+	header.ICMPExtension(icmp.Payload()[datagramLength:]).Encode(objects)
+	if got, want := b[4], uint8(datagramLength/8); got != want {
+		t.Errorf("got length field = %d, want = %d", got, want)
+	}
+	ext, ok := icmp.Extension()
+	if !ok {
+		t.Fatalf("got icmp.Extension() = (_, false), want = (_, true)")
+	}
+	if got, ok := ext.Objects(); !ok {
+		t.Errorf("got ext.Objects() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(objects, got); diff != "" {
+		t.Errorf("ext.Objects() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestICMPExtensionInterfaceIdent(t *testing.T) {
+	tests := []struct {
+		name  string
+		ident header.ICMPExtensionInterfaceIdent
+		want  []byte
+	}{
+		{
+			name:  "Name",
+			ident: header.ICMPExtensionInterfaceIdent{Name: "eth0"},
+			want:  []byte{0x00, 0x08, 0x03, 0x01, 'e', 't', 'h', '0'},
+		},
+		{
+			name:  "Padded name",
+			ident: header.ICMPExtensionInterfaceIdent{Name: "lo"},
+			want:  []byte{0x00, 0x08, 0x03, 0x01, 'l', 'o', 0x00, 0x00},
+		},
+		{
+			name:  "Index",
+			ident: header.ICMPExtensionInterfaceIdent{Index: 2},
+			want:  []byte{0x00, 0x08, 0x03, 0x02, 0x00, 0x00, 0x00, 0x02},
+		},
+		{
+			name:  "IPv4 address",
+			ident: header.ICMPExtensionInterfaceIdent{Address: tcpip.Address("\xc0\xa8\x00\x01")},
+			want:  []byte{0x00, 0x0c, 0x03, 0x03, 0x00, 0x01, 0x04, 0x00, 0xc0, 0xa8, 0x00, 0x01},
+		},
+		{
+			name:  "IPv6 address",
+			ident: header.ICMPExtensionInterfaceIdent{Address: tcpip.Address("\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")},
+			want: []byte{
+				0x00, 0x18, 0x03, 0x03, 0x00, 0x02, 0x10, 0x00,
+				0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects := []header.ICMPExtensionObject{test.ident.Object()}
+			ext := header.ICMPExtension(make([]byte, header.ICMPExtensionSize(objects)))
+			ext.Encode(objects)
+			if got := ext[header.ICMPExtensionHeaderSize:]; !bytes.Equal(got, test.want) {
+				t.Fatalf("got encoded object = %x, want = %x", got, test.want)
+			}
+			got, ok := ext.Objects()
+			if !ok || len(got) != 1 {
+				t.Fatalf("got ext.Objects() = (%#v, %t), want a single object", got, ok)
+			}
+			if ident, ok := got[0].InterfaceIdent(); !ok {
+				t.Errorf("got InterfaceIdent() = (_, false), want = (_, true)")
+			} else if diff := cmp.Diff(test.ident, ident); diff != "" {
+				t.Errorf("InterfaceIdent() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestICMPExtendedEcho(t *testing.T) {
+	b := make([]byte, header.ICMPv4MinimumSize)
+	icmp := header.ICMPv4(b)
+	icmp.SetType(header.ICMPv4ExtendedEchoRequest)
+	icmp.SetIdent(0x1234)
+	icmp.SetExtendedEchoSequence(5)
+	icmp.SetExtendedEchoLocal(true)
+	if want := []byte{42, 0, 0, 0, 0x12, 0x34, 5, 1}; !bytes.Equal(b, want) {
+		t.Fatalf("got request = %x, want = %x", b, want)
+	}
+	if !icmp.ExtendedEchoLocal() {
+		t.Errorf("got icmp.ExtendedEchoLocal() = false, want = true")
+	}
+
+	icmp6 := header.ICMPv6(b)
+	status := header.ICMPExtendedEchoStatus{Active: true, IPv6: true}
+	icmp6.SetExtendedEchoStatus(status)
+	if got, want := b[7], uint8(0x05); got != want {
+		t.Errorf("got status byte = %#x, want = %#x", got, want)
+	}
+	if got := icmp6.ExtendedEchoStatus(); got != status {
+		t.Errorf("got icmp6.ExtendedEchoStatus() = %#v, want = %#v", got, status)
+	}
+	if got := icmp6.ExtendedEchoSequence(); got != 5 {
+		t.Errorf("got icmp6.ExtendedEchoSequence() = %d, want = 5", got)
+	}
+}
@@ -74,6 +74,19 @@ const (
 	// icmpv4SequenceOffset is the offset of the sequence field
 	// in an ICMPv4EchoRequest/Reply message.
 	icmpv4SequenceOffset = 6
+
+	// icmpv4LengthOffset is the offset of the length field of the original
+	// datagram in an ICMPv4 error message, as per RFC 4884 section 4.1.
+	icmpv4LengthOffset = 5
+
+	// icmpv4ExtendedEchoSequenceOffset is the offset of the sequence field
+	// in an ICMPv4ExtendedEchoRequest/Reply message.
+	icmpv4ExtendedEchoSequenceOffset = 6
+
+	// icmpv4ExtendedEchoFlagsOffset is the offset of the byte holding the L
+	// bit of an ICMPv4ExtendedEchoRequest message and the interface status of
+	// an ICMPv4ExtendedEchoReply message.
+	icmpv4ExtendedEchoFlagsOffset = 7
 )
 
 // ICMPv4Type is the ICMP type field described in RFC 792.
@@ -95,6 +108,11 @@ const (
 	ICMPv4TimestampReply ICMPv4Type = 14
 	ICMPv4InfoRequest    ICMPv4Type = 15
 	ICMPv4InfoReply      ICMPv4Type = 16
+
+	// Extended Echo messages, see RFC 8335.
+
+	ICMPv4ExtendedEchoRequest ICMPv4Type = 42
+	ICMPv4ExtendedEchoReply   ICMPv4Type = 43
 )
 
 // ICMP codes for ICMPv4 Time Exceeded messages as defined in RFC 792.
@@ -112,6 +130,15 @@ const (
 	ICMPv4FragmentationNeeded ICMPv4Code = 4
 )
 
+// ICMP codes for ICMPv4 Extended Echo Reply messages as defined in RFC 8335.
+const (
+	ICMPv4ExtendedEchoNoError            ICMPv4Code = 0
+	ICMPv4ExtendedEchoMalformedQuery     ICMPv4Code = 1
+	ICMPv4ExtendedEchoNoSuchInterface    ICMPv4Code = 2
+	ICMPv4ExtendedEchoNoSuchTableEntry   ICMPv4Code = 3
+	ICMPv4ExtendedEchoMultipleInterfaces ICMPv4Code = 4
+)
+
 // ICMPv4UnusedCode is a code to use in ICMP messages where no code is needed.
 const ICMPv4UnusedCode ICMPv4Code = 0
 
@@ -196,6 +223,66 @@ func (b ICMPv4) SetSequence(sequence uint16) {
 	binary.BigEndian.PutUint16(b[icmpv4SequenceOffset:], sequence)
 }
 
+// ExtendedEchoSequence retrieves the Sequence field from an ICMPv4 Extended
+// Echo message.
+func (b ICMPv4) ExtendedEchoSequence() uint8 {
+	return b[icmpv4ExtendedEchoSequenceOffset]
+}
+
+// SetExtendedEchoSequence sets the Sequence field from an ICMPv4 Extended Echo
+// message.
+func (b ICMPv4) SetExtendedEchoSequence(sequence uint8) {
+	b[icmpv4ExtendedEchoSequenceOffset] = sequence
+}
+
+// ExtendedEchoLocal returns the L bit of an ICMPv4 Extended Echo Request,
+// which is set when the probed interface is on the node receiving the request.
+func (b ICMPv4) ExtendedEchoLocal() bool {
+	return b[icmpv4ExtendedEchoFlagsOffset]&extendedEchoLocalFlag != 0
+}
+
+// SetExtendedEchoLocal sets the L bit of an ICMPv4 Extended Echo Request.
+func (b ICMPv4) SetExtendedEchoLocal(local bool) {
+	if local {
+		b[icmpv4ExtendedEchoFlagsOffset] = extendedEchoLocalFlag
+	} else {
+		b[icmpv4ExtendedEchoFlagsOffset] = 0
+	}
+}
+
+// ExtendedEchoStatus returns the status of the probed interface carried in an
+// ICMPv4 Extended Echo Reply.
+func (b ICMPv4) ExtendedEchoStatus() ICMPExtendedEchoStatus {
+	return decodeExtendedEchoStatus(b[icmpv4ExtendedEchoFlagsOffset])
+}
+
+// SetExtendedEchoStatus sets the status of the probed interface carried in an
+// ICMPv4 Extended Echo Reply.
+func (b ICMPv4) SetExtendedEchoStatus(status ICMPExtendedEchoStatus) {
+	b[icmpv4ExtendedEchoFlagsOffset] = status.encode()
+}
+
+// OriginalDatagramLength returns the length in bytes of the original datagram
+// of an error message, as per RFC 4884 section 4.1. It returns 0 if the
+// message carries no extension structure.
+func (b ICMPv4) OriginalDatagramLength() int {
+	// The length field is in units of 32 bits.
+	return int(b[icmpv4LengthOffset]) * 4
+}
+
+// SetOriginalDatagramLength sets the length field of the original datagram of
+// an error message. length must be a multiple of 4 bytes.
+func (b ICMPv4) SetOriginalDatagramLength(length int) {
+	b[icmpv4LengthOffset] = uint8(length / 4)
+}
+
+// Extension returns the ICMP extension structure following the original
+// datagram of an error message, as per RFC 4884 section 5. It returns false
+// if the message carries no extension structure.
+func (b ICMPv4) Extension() (ICMPExtension, bool) {
+	return icmpExtension(b.Payload(), b.OriginalDatagramLength())
+}
+
 // ICMPv4Checksum calculates the ICMP checksum over the provided ICMP header,
 // and payload.
 func ICMPv4Checksum(h ICMPv4, vv buffer.VectorisedView) uint16 {
@@ -88,6 +88,19 @@ const (
 	// in a ICMPv6 Echo Request/Reply message.
 	icmpv6SequenceOffset = 6
 
+	// icmpv6LengthOffset is the offset of the length field of the original
+	// datagram in an ICMPv6 error message, as per RFC 4884 section 4.2.
+	icmpv6LengthOffset = 4
+
+	// icmpv6ExtendedEchoSequenceOffset is the offset of the sequence field
+	// in an ICMPv6 Extended Echo Request/Reply message.
+	icmpv6ExtendedEchoSequenceOffset = 6
+
+	// icmpv6ExtendedEchoFlagsOffset is the offset of the byte holding the L
+	// bit of an ICMPv6 Extended Echo Request message and the interface status
+	// of an ICMPv6 Extended Echo Reply message.
+	icmpv6ExtendedEchoFlagsOffset = 7
+
 	// NDPHopLimit is the expected IP hop limit value of 255 for received
 	// NDP packets, as per RFC 4861 sections 4.1 - 4.5, 6.1.1, 6.1.2, 7.1.1,
 	// 7.1.2 and 8.1. If the hop limit value is not 255, nodes MUST silently
@@ -121,6 +134,15 @@ const (
 	ICMPv6MulticastListenerQuery  ICMPv6Type = 130
 	ICMPv6MulticastListenerReport ICMPv6Type = 131
 	ICMPv6MulticastListenerDone   ICMPv6Type = 132
+
+	// Version 2 Multicast Listener Report, see RFC 3810.
+
+	ICMPv6MulticastListenerV2Report ICMPv6Type = 143
+
+	// Extended Echo messages, see RFC 8335.
+
+	ICMPv6ExtendedEchoRequest ICMPv6Type = 160
+	ICMPv6ExtendedEchoReply   ICMPv6Type = 161
 )
 
 // IsErrorType returns true if the receiver is an ICMP error type.
@@ -167,6 +189,16 @@ const (
 	ICMPv6UnknownOption ICMPv6Code = 2
 )
 
+// ICMP codes used with Extended Echo Reply (Type 161). As per RFC 8335
+// section 3.
+const (
+	ICMPv6ExtendedEchoNoError            ICMPv6Code = 0
+	ICMPv6ExtendedEchoMalformedQuery     ICMPv6Code = 1
+	ICMPv6ExtendedEchoNoSuchInterface    ICMPv6Code = 2
+	ICMPv6ExtendedEchoNoSuchTableEntry   ICMPv6Code = 3
+	ICMPv6ExtendedEchoMultipleInterfaces ICMPv6Code = 4
+)
+
 // ICMPv6UnusedCode is the code value used with ICMPv6 messages which don't use
 // the code field. (Types not mentioned above.)
 const ICMPv6UnusedCode ICMPv6Code = 0
@@ -251,6 +283,45 @@ func (b ICMPv6) SetSequence(sequence uint16) {
 	binary.BigEndian.PutUint16(b[icmpv6SequenceOffset:], sequence)
 }
 
+// ExtendedEchoSequence retrieves the Sequence field from an ICMPv6 Extended
+// Echo message.
+func (b ICMPv6) ExtendedEchoSequence() uint8 {
+	return b[icmpv6ExtendedEchoSequenceOffset]
+}
+
+// SetExtendedEchoSequence sets the Sequence field from an ICMPv6 Extended Echo
+// message.
+func (b ICMPv6) SetExtendedEchoSequence(sequence uint8) {
+	b[icmpv6ExtendedEchoSequenceOffset] = sequence
+}
+
+// ExtendedEchoLocal returns the L bit of an ICMPv6 Extended Echo Request,
+// which is set when the probed interface is on the node receiving the request.
+func (b ICMPv6) ExtendedEchoLocal() bool {
+	return b[icmpv6ExtendedEchoFlagsOffset]&extendedEchoLocalFlag != 0
+}
+
+// SetExtendedEchoLocal sets the L bit of an ICMPv6 Extended Echo Request.
+func (b ICMPv6) SetExtendedEchoLocal(local bool) {
+	if local {
+		b[icmpv6ExtendedEchoFlagsOffset] = extendedEchoLocalFlag
+	} else {
+		b[icmpv6ExtendedEchoFlagsOffset] = 0
+	}
+}
+
+// ExtendedEchoStatus returns the status of the probed interface carried in an
+// ICMPv6 Extended Echo Reply.
+func (b ICMPv6) ExtendedEchoStatus() ICMPExtendedEchoStatus {
+	return decodeExtendedEchoStatus(b[icmpv6ExtendedEchoFlagsOffset])
+}
+
+// SetExtendedEchoStatus sets the status of the probed interface carried in an
+// ICMPv6 Extended Echo Reply.
+func (b ICMPv6) SetExtendedEchoStatus(status ICMPExtendedEchoStatus) {
+	b[icmpv6ExtendedEchoFlagsOffset] = status.encode()
+}
+
 // MessageBody returns the message body as defined by RFC 4443 section 2.1; the
 // portion of the ICMPv6 buffer after the first ICMPv6HeaderSize bytes.
 func (b ICMPv6) MessageBody() []byte {
@@ -262,6 +333,27 @@ func (b ICMPv6) Payload() []byte {
 	return b[ICMPv6PayloadOffset:]
 }
 
+// OriginalDatagramLength returns the length in bytes of the original datagram
+// of an error message, as per RFC 4884 section 4.2. It returns 0 if the
+// message carries no extension structure.
+func (b ICMPv6) OriginalDatagramLength() int {
+	// The length field is in units of 64 bits.
+	return int(b[icmpv6LengthOffset]) * 8
+}
+
+// SetOriginalDatagramLength sets the length field of the original datagram of
+// an error message. length must be a multiple of 8 bytes.
+func (b ICMPv6) SetOriginalDatagramLength(length int) {
+	b[icmpv6LengthOffset] = uint8(length / 8)
+}
+
+// Extension returns the ICMP extension structure following the original
+// datagram of an error message, as per RFC 4884 section 5. It returns false
+// if the message carries no extension structure.
+func (b ICMPv6) Extension() (ICMPExtension, bool) {
+	return icmpExtension(b.Payload(), b.OriginalDatagramLength())
+}
+
 // ICMPv6Checksum calculates the ICMP checksum over the provided ICMPv6 header,
 // IPv6 src/dst addresses and the payload.
 func ICMPv6Checksum(h ICMPv6, src, dst tcpip.Address, vv buffer.VectorisedView) uint16 {
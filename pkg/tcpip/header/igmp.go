@@ -93,6 +93,10 @@ const (
 	// IGMPLeaveGroup indicates that the message type is a Leave Group
 	// notification message.
 	IGMPLeaveGroup IGMPType = 0x17
+	// IGMPv3MembershipReport indicates that the message type is a Membership
+	// Report generated by a host using the IGMPv3 protocol, as per RFC 3376
+	// Section 4.
+	IGMPv3MembershipReport IGMPType = 0x22
 )
 
 // Type is the IGMP type field.
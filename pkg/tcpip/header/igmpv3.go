@@ -0,0 +1,287 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// IGMPv3QueryMinimumSize is the size of an IGMPv3 Membership Query
+	// without sources, as per RFC 3376 section 4.1.
+	IGMPv3QueryMinimumSize = 12
+
+	// IGMPv3ReportMinimumSize is the size of an IGMPv3 Membership Report
+	// without group records, as per RFC 3376 section 4.2.
+	IGMPv3ReportMinimumSize = 8
+
+	// IGMPv3RoutersAddress is the multicast address IGMPv3 Membership Reports
+	// are sent to, as per RFC 3376 section 4.2.14.
+	//
+	// The address is 224.0.0.22.
+	IGMPv3RoutersAddress tcpip.Address = "\xe0\x00\x00\x16"
+
+	// igmpv3QueryFlagsOffset is the offset of the Resv, S and QRV fields in
+	// an IGMPv3 Membership Query.
+	igmpv3QueryFlagsOffset = 8
+
+	// igmpv3QueryQQICOffset is the offset of the QQIC field in an IGMPv3
+	// Membership Query.
+	igmpv3QueryQQICOffset = 9
+
+	// igmpv3QueryNumberOfSourcesOffset is the offset of the Number of Sources
+	// field in an IGMPv3 Membership Query.
+	igmpv3QueryNumberOfSourcesOffset = 10
+
+	// igmpv3ReportNumberOfGroupRecordsOffset is the offset of the Number of
+	// Group Records field in an IGMPv3 Membership Report.
+	igmpv3ReportNumberOfGroupRecordsOffset = 6
+
+	// igmpv3SFlagMask is the mask of the Suppress Router-Side Processing flag
+	// of IGMPv3 and MLDv2 queries.
+	igmpv3SFlagMask = 1 << 3
+
+	// igmpv3QRVMask is the mask of the Querier's Robustness Variable of IGMPv3
+	// and MLDv2 queries.
+	igmpv3QRVMask = 0x7
+
+	// igmpv3CodeMantissaBits is the number of bits of the mantissa of the Max
+	// Resp Code and QQIC fields of IGMPv3 and of the QQIC field of MLDv2.
+	igmpv3CodeMantissaBits = 4
+)
+
+// IGMPv3Query is an IGMPv3 Membership Query, as per RFC 3376 section 4.1.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |  Type = 0x11  | Max Resp Code |           Checksum            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                         Group Address                         |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   | Resv  |S| QRV |     QQIC      |     Number of Sources (N)     |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                       Source Address [1]                      |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                               .                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                       Source Address [N]                      |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// An IGMPv3 query is told apart from IGMPv1 and IGMPv2 queries by its length
+// of at least IGMPv3QueryMinimumSize bytes, as per RFC 3376 section 7.1.
+type IGMPv3Query IGMP
+
+// IGMPv3QueryFields contains the fields of an IGMPv3 Membership Query. It is
+// used to describe a query that needs to be encoded.
+type IGMPv3QueryFields struct {
+	// MaxRespCode is the Max Resp Code field, which can be computed from a
+	// duration with IGMPv3MaximumResponseCode.
+	MaxRespCode uint8
+
+	// GroupAddress is the Group Address field, which is unspecified in a
+	// General Query.
+	GroupAddress tcpip.Address
+
+	// SuppressRouterProcessing is the S flag.
+	SuppressRouterProcessing bool
+
+	// QRV is the Querier's Robustness Variable, which must fit in 3 bits.
+	QRV uint8
+
+	// QQIC is the Querier's Query Interval Code, which can be computed from a
+	// duration with IGMPv3QuerierQueryIntervalCode.
+	QQIC uint8
+
+	// Sources are the Source Addresses.
+	Sources []tcpip.Address
+}
+
+// IGMPv3QuerySize returns the size of an IGMPv3 Membership Query holding
+// numSources sources.
+func IGMPv3QuerySize(numSources int) int {
+	return IGMPv3QueryMinimumSize + numSources*IPv4AddressSize
+}
+
+// Encode encodes all the fields of the query, apart from the checksum, into b,
+// which must be IGMPv3QuerySize(len(f.Sources)) bytes long.
+func (b IGMPv3Query) Encode(f *IGMPv3QueryFields) {
+	IGMP(b).SetType(IGMPMembershipQuery)
+	IGMP(b).SetMaxRespTime(f.MaxRespCode)
+	IGMP(b).SetChecksum(0)
+	if f.GroupAddress == "" {
+		putAddresses(b[igmpGroupAddressOffset:], []tcpip.Address{IPv4Any}, IPv4AddressSize)
+	} else {
+		IGMP(b).SetGroupAddress(f.GroupAddress)
+	}
+	flags := f.QRV & igmpv3QRVMask
+	if f.SuppressRouterProcessing {
+		flags |= igmpv3SFlagMask
+	}
+	b[igmpv3QueryFlagsOffset] = flags
+	b[igmpv3QueryQQICOffset] = f.QQIC
+	binary.BigEndian.PutUint16(b[igmpv3QueryNumberOfSourcesOffset:], uint16(len(f.Sources)))
+	putAddresses(b[IGMPv3QueryMinimumSize:], f.Sources, IPv4AddressSize)
+}
+
+// IsValid returns true if b is long enough to hold the sources it claims to
+// hold.
+func (b IGMPv3Query) IsValid() bool {
+	return len(b) >= IGMPv3QueryMinimumSize && len(b) >= IGMPv3QuerySize(int(b.NumberOfSources()))
+}
+
+// MaximumResponseCode returns the Max Resp Code field.
+func (b IGMPv3Query) MaximumResponseCode() uint8 {
+	return b[igmpMaxRespTimeOffset]
+}
+
+// MaximumResponseTime returns the Maximum Response Time represented by the Max
+// Resp Code field.
+func (b IGMPv3Query) MaximumResponseTime() time.Duration {
+	// As per RFC 3376 section 4.1.1, the Max Resp Code is in units of 1/10
+	// second.
+	return time.Duration(decodeExpMant(uint16(b.MaximumResponseCode()), igmpv3CodeMantissaBits)) * time.Second / 10
+}
+
+// GroupAddress returns the Group Address field.
+func (b IGMPv3Query) GroupAddress() tcpip.Address {
+	return IGMP(b).GroupAddress()
+}
+
+// SuppressRouterProcessing returns the S flag.
+func (b IGMPv3Query) SuppressRouterProcessing() bool {
+	return b[igmpv3QueryFlagsOffset]&igmpv3SFlagMask != 0
+}
+
+// QuerierRobustnessVariable returns the QRV field.
+func (b IGMPv3Query) QuerierRobustnessVariable() uint8 {
+	return b[igmpv3QueryFlagsOffset] & igmpv3QRVMask
+}
+
+// QuerierQueryIntervalCode returns the QQIC field.
+func (b IGMPv3Query) QuerierQueryIntervalCode() uint8 {
+	return b[igmpv3QueryQQICOffset]
+}
+
+// QuerierQueryInterval returns the Querier's Query Interval represented by the
+// QQIC field.
+func (b IGMPv3Query) QuerierQueryInterval() time.Duration {
+	return querierQueryInterval(b.QuerierQueryIntervalCode())
+}
+
+// NumberOfSources returns the Number of Sources field.
+func (b IGMPv3Query) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(b[igmpv3QueryNumberOfSourcesOffset:])
+}
+
+// Sources returns the Source Addresses. It returns false if b is too short to
+// hold them.
+func (b IGMPv3Query) Sources() ([]tcpip.Address, bool) {
+	return parseAddresses(b[IGMPv3QueryMinimumSize:], b.NumberOfSources(), IPv4AddressSize)
+}
+
+// IGMPv3Report is an IGMPv3 Membership Report, as per RFC 3376 section 4.2.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |  Type = 0x22  |    Reserved   |           Checksum            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |           Reserved            |  Number of Group Records (M)  |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                                                               .
+//   .                        Group Record [1]                       .
+//   .                                                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                               .                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                                                               .
+//   .                        Group Record [M]                       .
+//   .                                                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type IGMPv3Report IGMP
+
+// IGMPv3ReportSize returns the size of an IGMPv3 Membership Report holding
+// records.
+func IGMPv3ReportSize(records []GroupRecord) int {
+	return IGMPv3ReportMinimumSize + groupRecordsSize(records, IPv4AddressSize)
+}
+
+// Encode encodes the report holding records, apart from its checksum, into b,
+// which must be IGMPv3ReportSize(records) bytes long.
+func (b IGMPv3Report) Encode(records []GroupRecord) {
+	for i := range b[:IGMPv3ReportMinimumSize] {
+		b[i] = 0
+	}
+	IGMP(b).SetType(IGMPv3MembershipReport)
+	binary.BigEndian.PutUint16(b[igmpv3ReportNumberOfGroupRecordsOffset:], uint16(len(records)))
+	putGroupRecords(b[IGMPv3ReportMinimumSize:], records, IPv4AddressSize)
+}
+
+// IsValid returns true if b is long enough to hold the group records it
+// claims to hold.
+func (b IGMPv3Report) IsValid() bool {
+	if len(b) < IGMPv3ReportMinimumSize {
+		return false
+	}
+	_, ok := b.GroupRecords()
+	return ok
+}
+
+// NumberOfGroupRecords returns the Number of Group Records field.
+func (b IGMPv3Report) NumberOfGroupRecords() uint16 {
+	return binary.BigEndian.Uint16(b[igmpv3ReportNumberOfGroupRecordsOffset:])
+}
+
+// GroupRecords returns the Group Records. It returns false if b is too short
+// to hold them.
+func (b IGMPv3Report) GroupRecords() ([]GroupRecord, bool) {
+	return parseGroupRecords(b[IGMPv3ReportMinimumSize:], b.NumberOfGroupRecords(), IPv4AddressSize)
+}
+
+// IGMPv3MaximumResponseCode returns the Max Resp Code representing the
+// largest Maximum Response Time that doesn't exceed d.
+func IGMPv3MaximumResponseCode(d time.Duration) uint8 {
+	return uint8(encodeExpMant(durationToUint32(d, time.Second/10), igmpv3CodeMantissaBits))
+}
+
+// IGMPv3QuerierQueryIntervalCode returns the QQIC representing the largest
+// Querier's Query Interval that doesn't exceed d. The QQIC of MLDv2 queries is
+// encoded the same way.
+func IGMPv3QuerierQueryIntervalCode(d time.Duration) uint8 {
+	return uint8(encodeExpMant(durationToUint32(d, time.Second), igmpv3CodeMantissaBits))
+}
+
+// querierQueryInterval returns the Querier's Query Interval represented by
+// the QQIC field of an IGMPv3 or MLDv2 query, in units of seconds as per RFC
+// 3376 section 4.1.7 and RFC 3810 section 5.1.9.
+func querierQueryInterval(qqic uint8) time.Duration {
+	return time.Duration(decodeExpMant(uint16(qqic), igmpv3CodeMantissaBits)) * time.Second
+}
+
+// durationToUint32 returns d in the given unit, rounded down and capped to
+// the largest uint32.
+func durationToUint32(d, unit time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	if v := d / unit; v < 1<<32 {
+		return uint32(v)
+	}
+	return 1<<32 - 1
+}
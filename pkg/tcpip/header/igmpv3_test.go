@@ -0,0 +1,184 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestIGMPv3Query(t *testing.T) {
+	b := []byte{
+		0x11,       // IGMP Type, Membership Query
+		0x8a,       // Max Resp Code, exp 0 and mant 0xa
+		0x00, 0x00, // Checksum
+		0xe0, 0x00, 0x00, 0x01, // Group Address
+		0x0a,       // Resv, S and QRV
+		0x7d,       // QQIC
+		0x00, 0x02, // Number of Sources
+		0x0a, 0x00, 0x00, 0x01, // Source Address [1]
+		0x0a, 0x00, 0x00, 0x02, // Source Address [2]
+	}
+	query := header.IGMPv3Query(b)
+	if !query.IsValid() {
+		t.Fatalf("got query.IsValid() = false, want = true")
+	}
+	if got, want := query.MaximumResponseTime(), 20800*time.Millisecond; got != want {
+		t.Errorf("got query.MaximumResponseTime() = %s, want = %s", got, want)
+	}
+	if got, want := query.GroupAddress(), tcpip.Address("\xe0\x00\x00\x01"); got != want {
+		t.Errorf("got query.GroupAddress() = %s, want = %s", got, want)
+	}
+	if !query.SuppressRouterProcessing() {
+		t.Errorf("got query.SuppressRouterProcessing() = false, want = true")
+	}
+	if got, want := query.QuerierRobustnessVariable(), uint8(2); got != want {
+		t.Errorf("got query.QuerierRobustnessVariable() = %d, want = %d", got, want)
+	}
+	if got, want := query.QuerierQueryInterval(), 125*time.Second; got != want {
+		t.Errorf("got query.QuerierQueryInterval() = %s, want = %s", got, want)
+	}
+	wantSources := []tcpip.Address{"\x0a\x00\x00\x01", "\x0a\x00\x00\x02"}
+	if sources, ok := query.Sources(); !ok {
+		t.Errorf("got query.Sources() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(wantSources, sources); diff != "" {
+		t.Errorf("query.Sources() mismatch (-want +got):\n%s", diff)
+	}
+	if header.IGMPv3Query(b[:len(b)-1]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated query, want = false")
+	}
+
+	encoded := header.IGMPv3Query(make([]byte, header.IGMPv3QuerySize(len(wantSources))))
+	encoded.Encode(&header.IGMPv3QueryFields{
+		MaxRespCode:              header.IGMPv3MaximumResponseCode(20800 * time.Millisecond),
+		GroupAddress:             "\xe0\x00\x00\x01",
+		SuppressRouterProcessing: true,
+		QRV:                      2,
+		QQIC:                     header.IGMPv3QuerierQueryIntervalCode(125 * time.Second),
+		Sources:                  wantSources,
+	})
+	if !bytes.Equal(encoded, b) {
+		t.Errorf("got encoded query = %x, want = %x", []byte(encoded), b)
+	}
+}
+
+func TestIGMPv3Report(t *testing.T) {
+	records := []header.GroupRecord{
+		{
+			Type:             header.GroupRecordModeIsExclude,
+			MulticastAddress: "\xe0\x00\x00\x01",
+		},
+		{
+			Type:             header.GroupRecordAllowNewSources,
+			MulticastAddress: "\xe0\x00\x00\x02",
+			Sources:          []tcpip.Address{"\x0a\x00\x00\x01"},
+			AuxData:          []byte{1, 2, 3, 4},
+		},
+	}
+	want := []byte{
+		0x22,       // IGMP Type, IGMPv3 Membership Report
+		0x00,       // Reserved
+		0x00, 0x00, // Checksum
+		0x00, 0x00, // Reserved
+		0x00, 0x02, // Number of Group Records
+		// Group Record [1]
+		0x02, 0x00, 0x00, 0x00,
+		0xe0, 0x00, 0x00, 0x01,
+		// Group Record [2]
+		0x05, 0x01, 0x00, 0x01,
+		0xe0, 0x00, 0x00, 0x02,
+		0x0a, 0x00, 0x00, 0x01,
+		0x01, 0x02, 0x03, 0x04,
+	}
+	report := header.IGMPv3Report(make([]byte, header.IGMPv3ReportSize(records)))
+	report.Encode(records)
+	if !bytes.Equal(report, want) {
+		t.Fatalf("got encoded report = %x, want = %x", []byte(report), want)
+	}
+	if !report.IsValid() {
+		t.Fatalf("got report.IsValid() = false, want = true")
+	}
+	if got, want := report.NumberOfGroupRecords(), uint16(len(records)); got != want {
+		t.Errorf("got report.NumberOfGroupRecords() = %d, want = %d", got, want)
+	}
+	if got, ok := report.GroupRecords(); !ok {
+		t.Errorf("got report.GroupRecords() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(records, got); diff != "" {
+		t.Errorf("report.GroupRecords() mismatch (-want +got):\n%s", diff)
+	}
+	if header.IGMPv3Report(report[:len(report)-4]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated report, want = false")
+	}
+}
+
+func TestIGMPv3Codes(t *testing.T) {
+	for _, tt := range []struct {
+		description   string
+		code          uint8
+		respTime      time.Duration
+		queryInterval time.Duration
+	}{
+		{
+			description:   "exact",
+			code:          0x7f,
+			respTime:      12700 * time.Millisecond,
+			queryInterval: 127 * time.Second,
+		},
+		{
+			description:   "smallest floating point",
+			code:          0x80,
+			respTime:      12800 * time.Millisecond,
+			queryInterval: 128 * time.Second,
+		},
+		{
+			description:   "largest floating point",
+			code:          0xff,
+			respTime:      3174400 * time.Millisecond,
+			queryInterval: 31744 * time.Second,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			b := make([]byte, header.IGMPv3QueryMinimumSize)
+			b[1] = tt.code
+			b[9] = tt.code
+			query := header.IGMPv3Query(b)
+			if got := query.MaximumResponseTime(); got != tt.respTime {
+				t.Errorf("got query.MaximumResponseTime() = %s, want = %s", got, tt.respTime)
+			}
+			if got := query.QuerierQueryInterval(); got != tt.queryInterval {
+				t.Errorf("got query.QuerierQueryInterval() = %s, want = %s", got, tt.queryInterval)
+			}
+			if got := header.IGMPv3MaximumResponseCode(tt.respTime); got != tt.code {
+				t.Errorf("got header.IGMPv3MaximumResponseCode(%s) = %#x, want = %#x", tt.respTime, got, tt.code)
+			}
+			if got := header.IGMPv3QuerierQueryIntervalCode(tt.queryInterval); got != tt.code {
+				t.Errorf("got header.IGMPv3QuerierQueryIntervalCode(%s) = %#x, want = %#x", tt.queryInterval, got, tt.code)
+			}
+		})
+	}
+
+	// Durations that can't be represented are rounded down, or capped.
+	if got, want := header.IGMPv3MaximumResponseCode(12900*time.Millisecond), uint8(0x80); got != want {
+		t.Errorf("got header.IGMPv3MaximumResponseCode(12.9s) = %#x, want = %#x", got, want)
+	}
+	if got, want := header.IGMPv3QuerierQueryIntervalCode(time.Hour*24), uint8(0xff); got != want {
+		t.Errorf("got header.IGMPv3QuerierQueryIntervalCode(24h) = %#x, want = %#x", got, want)
+	}
+}
@@ -90,3 +90,20 @@ type Network interface {
 	// SetTOS sets the values of the "type of service" and "flow label" fields.
 	SetTOS(t uint8, l uint32)
 }
+
+// ChecksummableNetwork is a Network whose addresses can be rewritten while
+// keeping its checksum, if it has one, valid. It is implemented by the IPv4
+// and IPv6 headers, but not by extension headers such as IPv6Fragment.
+type ChecksummableNetwork interface {
+	Network
+
+	// SetSourceAddressWithChecksumUpdate sets the value of the "source
+	// address" field and incrementally updates the header checksum, if the
+	// header has one, to reflect the change.
+	SetSourceAddressWithChecksumUpdate(tcpip.Address)
+
+	// SetDestinationAddressWithChecksumUpdate sets the value of the
+	// "destination address" field and incrementally updates the header
+	// checksum, if the header has one, to reflect the change.
+	SetDestinationAddressWithChecksumUpdate(tcpip.Address)
+}
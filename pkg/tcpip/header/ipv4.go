@@ -366,6 +366,27 @@ func (b IPv4) SetDestinationAddress(addr tcpip.Address) {
 	copy(b[dstAddr:dstAddr+IPv4AddressSize], addr)
 }
 
+// SetTTLWithChecksumUpdate sets the "Time to Live" field of the IPv4 header and
+// incrementally updates the header checksum to reflect the change.
+func (b IPv4) SetTTLWithChecksumUpdate(v uint8) {
+	// The TTL shares a 16-bit word with the protocol field.
+	old := binary.BigEndian.Uint16(b[ttl:])
+	b.SetTTL(v)
+	b.SetChecksum(^ChecksumUpdate(^b.Checksum(), old, binary.BigEndian.Uint16(b[ttl:])))
+}
+
+// SetSourceAddressWithChecksumUpdate implements ChecksummableNetwork.
+func (b IPv4) SetSourceAddressWithChecksumUpdate(addr tcpip.Address) {
+	b.SetChecksum(^ChecksumUpdateAddress(^b.Checksum(), b.SourceAddress(), addr))
+	b.SetSourceAddress(addr)
+}
+
+// SetDestinationAddressWithChecksumUpdate implements ChecksummableNetwork.
+func (b IPv4) SetDestinationAddressWithChecksumUpdate(addr tcpip.Address) {
+	b.SetChecksum(^ChecksumUpdateAddress(^b.Checksum(), b.DestinationAddress(), addr))
+	b.SetDestinationAddress(addr)
+}
+
 // CalculateChecksum calculates the checksum of the IPv4 header.
 func (b IPv4) CalculateChecksum() uint16 {
 	return Checksum(b[:b.HeaderLength()], 0)
@@ -481,6 +502,10 @@ const (
 	// IPv4OptionTimestampType is the option type for the Timestamp option.
 	IPv4OptionTimestampType IPv4OptionType = 68
 
+	// IPv4OptionRouterAlertType is the option type for the Router Alert option
+	// defined in RFC 2113.
+	IPv4OptionRouterAlertType IPv4OptionType = 148
+
 	// ipv4OptionTypeOffset is the offset in an option of its type field.
 	ipv4OptionTypeOffset = 0
 
@@ -654,6 +679,14 @@ func (i *IPv4OptionIterator) Next() (IPv4Option, bool, error) {
 		}
 		retval := IPv4OptionRecordRoute(optionBody)
 		return &retval, false, nil
+
+	case IPv4OptionRouterAlertType:
+		if optLen != IPv4OptionRouterAlertLength {
+			i.ErrCursor++
+			return nil, true, ErrIPv4OptMalformed
+		}
+		retval := IPv4OptionRouterAlert(optionBody)
+		return &retval, false, nil
 	}
 	retval := IPv4OptionGeneric(optionBody)
 	return &retval, false, nil
@@ -874,3 +907,270 @@ func (rr *IPv4OptionRecordRoute) Size() uint8 { return uint8(len(*rr)) }
 
 // Contents implements IPv4Option.
 func (rr *IPv4OptionRecordRoute) Contents() []byte { return []byte(*rr) }
+
+// Router Alert option specific related constants.
+//
+// from RFC 2113 section 2:
+//   Router Alert
+//
+//         +--------+--------+--------+--------+
+//         |10010100|00000100|  2 octet value  |
+//         +--------+--------+--------+--------+
+//           Type=148
+//
+//   Value:  A two octet code with the following values:
+//           0 - Router shall examine packet
+//           1-65535 - Reserved
+const (
+	// IPv4OptionRouterAlertLength is the length of a Router Alert option.
+	IPv4OptionRouterAlertLength = 4
+
+	// IPv4OptionRouterAlertValue is the only value of the Router Alert option
+	// defined by RFC 2113, asking every router to examine the packet.
+	IPv4OptionRouterAlertValue = 0
+
+	// IPv4OptionRouterAlertValueOffset is the offset of the Value field in a
+	// Router Alert option.
+	IPv4OptionRouterAlertValueOffset = 2
+)
+
+var _ IPv4Option = (*IPv4OptionRouterAlert)(nil)
+
+// IPv4OptionRouterAlert is an IPv4 Router Alert option defined by RFC 2113.
+type IPv4OptionRouterAlert []byte
+
+// Value returns the value of the Router Alert option.
+func (ra *IPv4OptionRouterAlert) Value() uint16 {
+	return binary.BigEndian.Uint16((*ra)[IPv4OptionRouterAlertValueOffset:])
+}
+
+// Type implements IPv4Option.
+func (ra *IPv4OptionRouterAlert) Type() IPv4OptionType { return IPv4OptionRouterAlertType }
+
+// Size implements IPv4Option.
+func (ra *IPv4OptionRouterAlert) Size() uint8 { return uint8(len(*ra)) }
+
+// Contents implements IPv4Option.
+func (ra *IPv4OptionRouterAlert) Contents() []byte { return []byte(*ra) }
+
+// IPv4SerializableOption is an interface to represent serializable IPv4 option
+// types.
+type IPv4SerializableOption interface {
+	// optionType returns the type identifier of the option.
+	optionType() IPv4OptionType
+}
+
+// IPv4SerializableOptionPayload is an interface providing serialization of the
+// payload of an IPv4 option.
+type IPv4SerializableOptionPayload interface {
+	// length returns the size of the payload, which excludes the type and
+	// length fields of the option.
+	length() uint8
+
+	// serializeInto serializes the payload into the provided byte buffer.
+	//
+	// Note, the caller MUST provide a byte buffer with size of at least
+	// length. Implementers of this function may assume that the byte buffer
+	// is of sufficient size. serializeInto MUST panic if the provided byte
+	// buffer is not of sufficient size.
+	//
+	// serializeInto returns the number of bytes that were used to serialize
+	// the receiver.
+	serializeInto(buffer []byte) uint8
+}
+
+// IPv4OptionsSerializer is a serializer for IPv4 options.
+type IPv4OptionsSerializer []IPv4SerializableOption
+
+// Length returns the total number of bytes required to serialize the options,
+// including the padding to a 32 bit boundary.
+func (s IPv4OptionsSerializer) Length() int {
+	var total int
+	for _, opt := range s {
+		total++
+		if withPayload, ok := opt.(IPv4SerializableOptionPayload); ok {
+			// Add 1 to account for the length field.
+			total += 1 + int(withPayload.length())
+		}
+	}
+	return (total + IPv4IHLStride - 1) & ^(IPv4IHLStride - 1)
+}
+
+// Serialize serializes the options in s into b, which must be at least
+// s.Length() bytes long, and returns the serialized options.
+func (s IPv4OptionsSerializer) Serialize(b []byte) IPv4Options {
+	total := s.Length()
+	if total > IPv4MaximumOptionsSize {
+		panic(fmt.Sprintf("got %d bytes of IPv4 options, expected at most %d bytes", total, IPv4MaximumOptionsSize))
+	}
+	b = b[:total]
+	n := 0
+	for _, opt := range s {
+		if withPayload, ok := opt.(IPv4SerializableOptionPayload); ok {
+			l := 2 + withPayload.serializeInto(b[n+2:])
+			b[n+ipv4OptionTypeOffset] = byte(opt.optionType())
+			b[n+IPv4OptionLengthOffset] = l
+			n += int(l)
+			continue
+		}
+		// Options without payload consist only of the type field.
+		b[n+ipv4OptionTypeOffset] = byte(opt.optionType())
+		n++
+	}
+	// The padding is zero, which makes its first byte an End Of Option List
+	// option as per RFC 791 page 31.
+	padding := b[n:]
+	for i := range padding {
+		padding[i] = 0
+	}
+	return IPv4Options(b)
+}
+
+var _ IPv4SerializableOption = (*IPv4SerializableNOPOption)(nil)
+
+// IPv4SerializableNOPOption is a serializable No-Operation option.
+type IPv4SerializableNOPOption struct{}
+
+// optionType implements IPv4SerializableOption.
+func (*IPv4SerializableNOPOption) optionType() IPv4OptionType {
+	return IPv4OptionNOPType
+}
+
+var _ IPv4SerializableOption = (*IPv4SerializableListEndOption)(nil)
+
+// IPv4SerializableListEndOption is a serializable End Of Option List option.
+type IPv4SerializableListEndOption struct{}
+
+// optionType implements IPv4SerializableOption.
+func (*IPv4SerializableListEndOption) optionType() IPv4OptionType {
+	return IPv4OptionListEndType
+}
+
+var _ IPv4SerializableOption = (*IPv4SerializableRecordRouteOption)(nil)
+var _ IPv4SerializableOptionPayload = (*IPv4SerializableRecordRouteOption)(nil)
+
+// IPv4SerializableRecordRouteOption is a serializable Record Route option.
+type IPv4SerializableRecordRouteOption struct {
+	// Slots holds the route data, one IPv4 address per slot. Slots that are
+	// yet to be recorded may hold an empty address, which is serialized as
+	// zeroes.
+	Slots []tcpip.Address
+
+	// Recorded is the number of slots already recorded. The pointer field
+	// points to the slot following them, and is past the end of the option
+	// when all the slots are recorded.
+	Recorded int
+}
+
+// optionType implements IPv4SerializableOption.
+func (*IPv4SerializableRecordRouteOption) optionType() IPv4OptionType {
+	return IPv4OptionRecordRouteType
+}
+
+// length implements IPv4SerializableOptionPayload.
+func (o *IPv4SerializableRecordRouteOption) length() uint8 {
+	// The pointer field followed by the slots.
+	return uint8(1 + len(o.Slots)*IPv4AddressSize)
+}
+
+// serializeInto implements IPv4SerializableOptionPayload.
+func (o *IPv4SerializableRecordRouteOption) serializeInto(buffer []byte) uint8 {
+	if o.Recorded < 0 || o.Recorded > len(o.Slots) {
+		panic(fmt.Sprintf("got %d recorded slots, expected between 0 and %d", o.Recorded, len(o.Slots)))
+	}
+	// The pointer is one based and relative to the start of the option.
+	buffer[0] = uint8(IPv4OptionRecordRouteHdrLength + 1 + o.Recorded*IPv4AddressSize)
+	putIPv4OptionAddresses(buffer[1:], o.Slots)
+	return o.length()
+}
+
+var _ IPv4SerializableOption = (*IPv4SerializableTimestampOption)(nil)
+var _ IPv4SerializableOptionPayload = (*IPv4SerializableTimestampOption)(nil)
+
+// IPv4OptionTimestampSlot is a slot of the Timestamp option.
+type IPv4OptionTimestampSlot struct {
+	// Address is the address of the registering entity. It is left out of
+	// the option when the flag is IPv4OptionTimestampOnlyFlag, and may be
+	// empty for a slot that is yet to be recorded.
+	Address tcpip.Address
+
+	// Timestamp is the timestamp in milliseconds since midnight UTC.
+	Timestamp uint32
+}
+
+// IPv4SerializableTimestampOption is a serializable Timestamp option.
+type IPv4SerializableTimestampOption struct {
+	// Flags is the flag field, which defines the layout of the slots.
+	Flags IPv4OptTSFlags
+
+	// Overflow is the 4 bit overflow field, the number of IP modules that
+	// could not register timestamps due to lack of space.
+	Overflow uint8
+
+	// Slots holds the timestamp data.
+	Slots []IPv4OptionTimestampSlot
+
+	// Recorded is the number of slots already recorded. The pointer field
+	// points to the slot following them, and is past the end of the option
+	// when all the slots are recorded.
+	Recorded int
+}
+
+// optionType implements IPv4SerializableOption.
+func (*IPv4SerializableTimestampOption) optionType() IPv4OptionType {
+	return IPv4OptionTimestampType
+}
+
+// slotSize returns the size of a slot of the option.
+func (o *IPv4SerializableTimestampOption) slotSize() int {
+	if o.Flags == IPv4OptionTimestampOnlyFlag {
+		return IPv4OptionTimestampSize
+	}
+	return IPv4OptionTimestampWithAddrSize
+}
+
+// length implements IPv4SerializableOptionPayload.
+func (o *IPv4SerializableTimestampOption) length() uint8 {
+	// The pointer and overflow/flag fields followed by the slots.
+	return uint8(2 + len(o.Slots)*o.slotSize())
+}
+
+// serializeInto implements IPv4SerializableOptionPayload.
+func (o *IPv4SerializableTimestampOption) serializeInto(buffer []byte) uint8 {
+	if o.Recorded < 0 || o.Recorded > len(o.Slots) {
+		panic(fmt.Sprintf("got %d recorded slots, expected between 0 and %d", o.Recorded, len(o.Slots)))
+	}
+	if o.Overflow > 0xf {
+		panic(fmt.Sprintf("got overflow %d, expected at most %d", o.Overflow, 0xf))
+	}
+	slotSize := o.slotSize()
+	// The pointer is one based and relative to the start of the option.
+	buffer[0] = uint8(IPv4OptionTimestampHdrLength + 1 + o.Recorded*slotSize)
+	buffer[1] = o.Overflow<<ipv4OptionTimestampOverflowshift | byte(o.Flags)&ipv4OptionTimestampFlagsMask
+	slots := buffer[2:]
+	for _, slot := range o.Slots {
+		if slotSize == IPv4OptionTimestampWithAddrSize {
+			putIPv4OptionAddresses(slots, []tcpip.Address{slot.Address})
+			slots = slots[IPv4AddressSize:]
+		}
+		binary.BigEndian.PutUint32(slots, slot.Timestamp)
+		slots = slots[IPv4OptionTimestampSize:]
+	}
+	return o.length()
+}
+
+// putIPv4OptionAddresses puts addrs into b, writing zeroes for empty
+// addresses.
+func putIPv4OptionAddresses(b []byte, addrs []tcpip.Address) {
+	for _, addr := range addrs {
+		switch len(addr) {
+		case 0:
+			copy(b, "\x00\x00\x00\x00")
+		case IPv4AddressSize:
+			copy(b, addr)
+		default:
+			panic(fmt.Sprintf("got address %s of %d bytes, expected %d bytes", addr, len(addr), IPv4AddressSize))
+		}
+		b = b[IPv4AddressSize:]
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestIPv4OptionsSerializer(t *testing.T) {
+	const (
+		addr1 = tcpip.Address("\x0a\x00\x00\x01")
+		addr2 = tcpip.Address("\x0a\x00\x00\x02")
+	)
+	tests := []struct {
+		name    string
+		options header.IPv4OptionsSerializer
+		want    []byte
+	}{
+		{
+			name:    "empty",
+			options: nil,
+			want:    nil,
+		},
+		{
+			name:    "NOP padded",
+			options: header.IPv4OptionsSerializer{&header.IPv4SerializableNOPOption{}},
+			want:    []byte{1, 0, 0, 0},
+		},
+		{
+			name: "record route",
+			options: header.IPv4OptionsSerializer{
+				&header.IPv4SerializableNOPOption{},
+				&header.IPv4SerializableRecordRouteOption{
+					Slots:    []tcpip.Address{addr1, ""},
+					Recorded: 1,
+				},
+			},
+			want: []byte{
+				1,        // NOP
+				7, 11, 8, // Type, Length and Pointer
+				10, 0, 0, 1, // Slot [1]
+				0, 0, 0, 0, // Slot [2]
+			},
+		},
+		{
+			name: "full record route",
+			options: header.IPv4OptionsSerializer{
+				&header.IPv4SerializableRecordRouteOption{
+					Slots:    []tcpip.Address{addr1},
+					Recorded: 1,
+				},
+			},
+			want: []byte{
+				7, 7, 8, // Type, Length and Pointer
+				10, 0, 0, 1, // Slot [1]
+				0, // Padding
+			},
+		},
+		{
+			name: "timestamp only",
+			options: header.IPv4OptionsSerializer{
+				&header.IPv4SerializableTimestampOption{
+					Flags:    header.IPv4OptionTimestampOnlyFlag,
+					Slots:    []header.IPv4OptionTimestampSlot{{Timestamp: 0x01020304}, {}},
+					Recorded: 1,
+				},
+			},
+			want: []byte{
+				68, 12, 9, 0x00, // Type, Length, Pointer and Overflow/Flag
+				1, 2, 3, 4, // Slot [1]
+				0, 0, 0, 0, // Slot [2]
+			},
+		},
+		{
+			name: "timestamp with predefined addresses and overflow",
+			options: header.IPv4OptionsSerializer{
+				&header.IPv4SerializableTimestampOption{
+					Flags:    header.IPv4OptionTimestampWithPredefinedIPFlag,
+					Overflow: 2,
+					Slots: []header.IPv4OptionTimestampSlot{
+						{Address: addr1, Timestamp: 0x01020304},
+						{Address: addr2},
+					},
+				},
+				&header.IPv4SerializableListEndOption{},
+			},
+			want: []byte{
+				68, 20, 5, 0x23, // Type, Length, Pointer and Overflow/Flag
+				10, 0, 0, 1, 1, 2, 3, 4, // Slot [1]
+				10, 0, 0, 2, 0, 0, 0, 0, // Slot [2]
+				0, 0, 0, 0, // List End and padding
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.options.Length(); got != len(test.want) {
+				t.Fatalf("got options.Length() = %d, want = %d", got, len(test.want))
+			}
+			b := make([]byte, test.options.Length())
+			// Make sure the padding is cleared.
+			for i := range b {
+				b[i] = 0xff
+			}
+			if got := test.options.Serialize(b); !bytes.Equal(got, test.want) {
+				t.Fatalf("got options.Serialize(_) = %x, want = %x", []byte(got), test.want)
+			}
+
+			// The serialized options must be understood by the parser.
+			iter := header.IPv4Options(b).MakeIterator()
+			for {
+				opt, done, err := iter.Next()
+				if err != nil {
+					t.Fatalf("got iter.Next() = (_, _, %s), want = (_, _, nil)", err)
+				}
+				if done {
+					break
+				}
+				switch opt := opt.(type) {
+				case *header.IPv4OptionRecordRoute:
+					rr := test.options[len(test.options)-1].(*header.IPv4SerializableRecordRouteOption)
+					if got, want := opt.Pointer(), uint8(header.IPv4OptionRecordRouteHdrLength+1+rr.Recorded*header.IPv4AddressSize); got != want {
+						t.Errorf("got rr.Pointer() = %d, want = %d", got, want)
+					}
+				case *header.IPv4OptionTimestamp:
+					ts := test.options[0].(*header.IPv4SerializableTimestampOption)
+					if got := opt.Flags(); got != ts.Flags {
+						t.Errorf("got ts.Flags() = %d, want = %d", got, ts.Flags)
+					}
+					if got := opt.Overflow(); got != ts.Overflow {
+						t.Errorf("got ts.Overflow() = %d, want = %d", got, ts.Overflow)
+					}
+				}
+			}
+		})
+	}
+}
@@ -236,6 +236,19 @@ func (b IPv6) SetDestinationAddress(addr tcpip.Address) {
 	copy(b[v6DstAddr:][:IPv6AddressSize], addr)
 }
 
+// SetSourceAddressWithChecksumUpdate implements ChecksummableNetwork. IPv6
+// headers have no checksum, so it is equivalent to SetSourceAddress.
+func (b IPv6) SetSourceAddressWithChecksumUpdate(addr tcpip.Address) {
+	b.SetSourceAddress(addr)
+}
+
+// SetDestinationAddressWithChecksumUpdate implements ChecksummableNetwork.
+// IPv6 headers have no checksum, so it is equivalent to
+// SetDestinationAddress.
+func (b IPv6) SetDestinationAddressWithChecksumUpdate(addr tcpip.Address) {
+	b.SetDestinationAddress(addr)
+}
+
 // SetHopLimit sets the value of the "Hop Limit" field.
 func (b IPv6) SetHopLimit(v uint8) {
 	b[hopLimit] = v
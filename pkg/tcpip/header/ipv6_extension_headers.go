@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -217,8 +218,51 @@ const (
 	// ipv6PadBExtHdrOptionIdentifier is the identifier for a padding option that
 	// provides variable length byte padding, as outlined in RFC 8200 section 4.2.
 	ipv6PadNExtHdrOptionIdentifier IPv6ExtHdrOptionIndentifier = 1
+
+	// ipv6RouterAlertHopByHopOptionIdentifier is the identifier for the Router
+	// Alert Hop by Hop option, as outlined in RFC 2711 section 2.1.
+	ipv6RouterAlertHopByHopOptionIdentifier IPv6ExtHdrOptionIndentifier = 5
+
+	// ipv6RouterAlertHopByHopOptionLength is the length of the data of the
+	// Router Alert Hop by Hop option, as outlined in RFC 2711 section 2.1.
+	ipv6RouterAlertHopByHopOptionLength = 2
+)
+
+// ErrMalformedIPv6ExtHdrOption indicates that an IPv6 extension header option
+// is malformed.
+var ErrMalformedIPv6ExtHdrOption = errors.New("malformed IPv6 extension header option")
+
+// IPv6RouterAlertValue is the value of a Router Alert option, as outlined in
+// RFC 2711 section 2.1.
+type IPv6RouterAlertValue uint16
+
+const (
+	// IPv6RouterAlertMLD indicates that the datagram contains a Multicast
+	// Listener Discovery message.
+	IPv6RouterAlertMLD IPv6RouterAlertValue = 0
+
+	// IPv6RouterAlertRSVP indicates that the datagram contains an RSVP message.
+	IPv6RouterAlertRSVP IPv6RouterAlertValue = 1
+
+	// IPv6RouterAlertActiveNetworks indicates that the datagram contains an
+	// Active Networks message.
+	IPv6RouterAlertActiveNetworks IPv6RouterAlertValue = 2
 )
 
+// IPv6RouterAlertOption is the IPv6 Router Alert Hop by Hop option defined in
+// RFC 2711 section 2.1.
+type IPv6RouterAlertOption struct {
+	Value IPv6RouterAlertValue
+}
+
+// UnknownAction implements IPv6ExtHdrOption.UnknownAction.
+func (*IPv6RouterAlertOption) UnknownAction() IPv6OptionUnknownAction {
+	return IPv6OptionUnknownAction((ipv6RouterAlertHopByHopOptionIdentifier & ipv6UnknownExtHdrOptionActionMask) >> ipv6UnknownExtHdrOptionActionShift)
+}
+
+// isIPv6ExtHdrOption implements IPv6ExtHdrOption.isIPv6ExtHdrOption.
+func (*IPv6RouterAlertOption) isIPv6ExtHdrOption() {}
+
 // IPv6UnknownExtHdrOption holds the identifier and data for an IPv6 extension
 // header option that is unknown by the parsing utilities.
 type IPv6UnknownExtHdrOption struct {
@@ -294,6 +338,15 @@ func (i *IPv6OptionsExtHdrOptionsIterator) Next() (IPv6ExtHdrOption, bool, error
 				panic(fmt.Sprintf("error when skipping PadN (N = %d) option's data bytes: %s", length, err))
 			}
 			continue
+		case ipv6RouterAlertHopByHopOptionIdentifier:
+			if length != ipv6RouterAlertHopByHopOptionLength {
+				return nil, true, fmt.Errorf("got invalid length (%d) for router alert option (want = %d): %w", length, ipv6RouterAlertHopByHopOptionLength, ErrMalformedIPv6ExtHdrOption)
+			}
+			var routerAlertValue [ipv6RouterAlertHopByHopOptionLength]byte
+			if n, err := io.ReadFull(&i.reader, routerAlertValue[:]); err != nil {
+				panic(fmt.Sprintf("read %d out of %d option data bytes for router alert option: %s", n, ipv6RouterAlertHopByHopOptionLength, err))
+			}
+			return &IPv6RouterAlertOption{Value: IPv6RouterAlertValue(binary.BigEndian.Uint16(routerAlertValue[:]))}, false, nil
 		default:
 			bytes := make([]byte, length)
 			if n, err := io.ReadFull(&i.reader, bytes); err != nil {
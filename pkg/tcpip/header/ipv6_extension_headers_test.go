@@ -211,6 +211,20 @@ func TestIPv6OptionsExtHdrIterErr(t *testing.T) {
 			bytes: []byte{1, 3},
 			err:   io.ErrUnexpectedEOF,
 		},
+		{
+			name:  "Router Alert",
+			bytes: []byte{5, 2, 0, 1},
+		},
+		{
+			name:  "Router Alert with invalid length",
+			bytes: []byte{5, 1, 0},
+			err:   ErrMalformedIPv6ExtHdrOption,
+		},
+		{
+			name:  "Router Alert too small",
+			bytes: []byte{5, 2, 0},
+			err:   io.ErrUnexpectedEOF,
+		},
 	}
 
 	check := func(t *testing.T, it IPv6OptionsExtHdrOptionsIterator, expectedErr error) {
@@ -276,6 +290,13 @@ func TestIPv6OptionsExtHdrIter(t *testing.T) {
 			name:  "Single Pad1",
 			bytes: []byte{0},
 		},
+		{
+			name:  "Router Alert",
+			bytes: []byte{5, 2, 0, 1},
+			expected: []IPv6ExtHdrOption{
+				&IPv6RouterAlertOption{Value: IPv6RouterAlertRSVP},
+			},
+		},
 		{
 			name:  "Two Pad1",
 			bytes: []byte{0, 0},
@@ -0,0 +1,278 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// MLDv2QueryMinimumSize is the size of an MLDv2 Query without sources, as
+	// per RFC 3810 section 5.1, excluding the first four bytes of the ICMPv6
+	// packet holding it.
+	MLDv2QueryMinimumSize = 24
+
+	// MLDv2ReportMinimumSize is the size of an MLDv2 Report without multicast
+	// address records, as per RFC 3810 section 5.2, excluding the first four
+	// bytes of the ICMPv6 packet holding it.
+	MLDv2ReportMinimumSize = 4
+
+	// MLDv2RoutersMulticastAddress is the multicast address MLDv2 Reports are
+	// sent to, as per RFC 3810 section 5.2.14.
+	//
+	// The address is ff02::16.
+	MLDv2RoutersMulticastAddress tcpip.Address = "\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x16"
+
+	// mldv2QueryMaximumResponseCodeOffset is the offset of the Maximum
+	// Response Code field within MLDv2Query.
+	mldv2QueryMaximumResponseCodeOffset = 0
+
+	// mldv2QueryMulticastAddressOffset is the offset of the Multicast Address
+	// field within MLDv2Query.
+	mldv2QueryMulticastAddressOffset = 4
+
+	// mldv2QueryFlagsOffset is the offset of the Resv, S and QRV fields within
+	// MLDv2Query.
+	mldv2QueryFlagsOffset = 20
+
+	// mldv2QueryQQICOffset is the offset of the QQIC field within MLDv2Query.
+	mldv2QueryQQICOffset = 21
+
+	// mldv2QueryNumberOfSourcesOffset is the offset of the Number of Sources
+	// field within MLDv2Query.
+	mldv2QueryNumberOfSourcesOffset = 22
+
+	// mldv2ReportNumberOfRecordsOffset is the offset of the Nr of Mcast
+	// Address Records field within MLDv2Report.
+	mldv2ReportNumberOfRecordsOffset = 2
+
+	// mldv2MaximumResponseCodeMantissaBits is the number of bits of the
+	// mantissa of the Maximum Response Code of MLDv2 queries.
+	mldv2MaximumResponseCodeMantissaBits = 12
+)
+
+// MLDv2Query is an MLDv2 Query message in an ICMPv6 packet, as per RFC 3810
+// section 5.1.
+//
+// Like MLD, MLDv2Query only holds the bytes after the first four bytes of the
+// ICMPv6 packet in the diagram below:
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |  Type = 130   |      Code     |           Checksum            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |    Maximum Response Code      |           Reserved            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                                                               |
+//   *                                                               *
+//   |                                                               |
+//   *                       Multicast Address                       *
+//   |                                                               |
+//   *                                                               *
+//   |                                                               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   | Resv  |S| QRV |     QQIC      |     Number of Sources (N)     |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                                                               |
+//   *                       Source Address [1]                      *
+//   |                                                               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                               .                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                                                               |
+//   *                       Source Address [N]                      *
+//   |                                                               |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// An MLDv2 query is told apart from an MLDv1 query by its length of at least
+// MLDv2QueryMinimumSize bytes, as per RFC 3810 section 8.1.
+type MLDv2Query MLD
+
+// MLDv2QueryFields contains the fields of an MLDv2 Query. It is used to
+// describe a query that needs to be encoded.
+type MLDv2QueryFields struct {
+	// MaxRespCode is the Maximum Response Code field, which can be computed
+	// from a duration with MLDv2MaximumResponseCode.
+	MaxRespCode uint16
+
+	// MulticastAddress is the Multicast Address field, which is unspecified
+	// in a General Query.
+	MulticastAddress tcpip.Address
+
+	// SuppressRouterProcessing is the S flag.
+	SuppressRouterProcessing bool
+
+	// QRV is the Querier's Robustness Variable, which must fit in 3 bits.
+	QRV uint8
+
+	// QQIC is the Querier's Query Interval Code, which can be computed from a
+	// duration with IGMPv3QuerierQueryIntervalCode.
+	QQIC uint8
+
+	// Sources are the Source Addresses.
+	Sources []tcpip.Address
+}
+
+// MLDv2QuerySize returns the size of an MLDv2 Query holding numSources
+// sources.
+func MLDv2QuerySize(numSources int) int {
+	return MLDv2QueryMinimumSize + numSources*IPv6AddressSize
+}
+
+// Encode encodes all the fields of the query into m, which must be
+// MLDv2QuerySize(len(f.Sources)) bytes long.
+func (m MLDv2Query) Encode(f *MLDv2QueryFields) {
+	binary.BigEndian.PutUint16(m[mldv2QueryMaximumResponseCodeOffset:], f.MaxRespCode)
+	binary.BigEndian.PutUint16(m[mldv2QueryMaximumResponseCodeOffset+2:], 0)
+	if f.MulticastAddress == "" {
+		putAddresses(m[mldv2QueryMulticastAddressOffset:], []tcpip.Address{IPv6Any}, IPv6AddressSize)
+	} else {
+		putAddresses(m[mldv2QueryMulticastAddressOffset:], []tcpip.Address{f.MulticastAddress}, IPv6AddressSize)
+	}
+	flags := f.QRV & igmpv3QRVMask
+	if f.SuppressRouterProcessing {
+		flags |= igmpv3SFlagMask
+	}
+	m[mldv2QueryFlagsOffset] = flags
+	m[mldv2QueryQQICOffset] = f.QQIC
+	binary.BigEndian.PutUint16(m[mldv2QueryNumberOfSourcesOffset:], uint16(len(f.Sources)))
+	putAddresses(m[MLDv2QueryMinimumSize:], f.Sources, IPv6AddressSize)
+}
+
+// IsValid returns true if m is long enough to hold the sources it claims to
+// hold.
+func (m MLDv2Query) IsValid() bool {
+	return len(m) >= MLDv2QueryMinimumSize && len(m) >= MLDv2QuerySize(int(m.NumberOfSources()))
+}
+
+// MaximumResponseCode returns the Maximum Response Code field.
+func (m MLDv2Query) MaximumResponseCode() uint16 {
+	return binary.BigEndian.Uint16(m[mldv2QueryMaximumResponseCodeOffset:])
+}
+
+// MaximumResponseDelay returns the Maximum Response Delay represented by the
+// Maximum Response Code field.
+func (m MLDv2Query) MaximumResponseDelay() time.Duration {
+	// As per RFC 3810 section 5.1.3, the Maximum Response Code is in units of
+	// milliseconds.
+	return time.Duration(decodeExpMant(m.MaximumResponseCode(), mldv2MaximumResponseCodeMantissaBits)) * time.Millisecond
+}
+
+// MulticastAddress returns the Multicast Address field.
+func (m MLDv2Query) MulticastAddress() tcpip.Address {
+	return tcpip.Address(m[mldv2QueryMulticastAddressOffset:][:IPv6AddressSize])
+}
+
+// SuppressRouterProcessing returns the S flag.
+func (m MLDv2Query) SuppressRouterProcessing() bool {
+	return m[mldv2QueryFlagsOffset]&igmpv3SFlagMask != 0
+}
+
+// QuerierRobustnessVariable returns the QRV field.
+func (m MLDv2Query) QuerierRobustnessVariable() uint8 {
+	return m[mldv2QueryFlagsOffset] & igmpv3QRVMask
+}
+
+// QuerierQueryIntervalCode returns the QQIC field.
+func (m MLDv2Query) QuerierQueryIntervalCode() uint8 {
+	return m[mldv2QueryQQICOffset]
+}
+
+// QuerierQueryInterval returns the Querier's Query Interval represented by the
+// QQIC field.
+func (m MLDv2Query) QuerierQueryInterval() time.Duration {
+	return querierQueryInterval(m.QuerierQueryIntervalCode())
+}
+
+// NumberOfSources returns the Number of Sources field.
+func (m MLDv2Query) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(m[mldv2QueryNumberOfSourcesOffset:])
+}
+
+// Sources returns the Source Addresses. It returns false if m is too short to
+// hold them.
+func (m MLDv2Query) Sources() ([]tcpip.Address, bool) {
+	return parseAddresses(m[MLDv2QueryMinimumSize:], m.NumberOfSources(), IPv6AddressSize)
+}
+
+// MLDv2Report is an MLDv2 Report message in an ICMPv6 packet, as per RFC 3810
+// section 5.2.
+//
+// Like MLD, MLDv2Report only holds the bytes after the first four bytes of the
+// ICMPv6 packet in the diagram below:
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |  Type = 143   |    Reserved   |           Checksum            |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |           Reserved            |Nr of Mcast Address Records (M)|
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                                                               .
+//   .                  Multicast Address Record [1]                 .
+//   .                                                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                               .                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   .                                                               .
+//   .                  Multicast Address Record [M]                 .
+//   .                                                               .
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type MLDv2Report []byte
+
+// MLDv2ReportSize returns the size of an MLDv2 Report holding records.
+func MLDv2ReportSize(records []GroupRecord) int {
+	return MLDv2ReportMinimumSize + groupRecordsSize(records, IPv6AddressSize)
+}
+
+// Encode encodes the report holding records into m, which must be
+// MLDv2ReportSize(records) bytes long.
+func (m MLDv2Report) Encode(records []GroupRecord) {
+	binary.BigEndian.PutUint16(m, 0)
+	binary.BigEndian.PutUint16(m[mldv2ReportNumberOfRecordsOffset:], uint16(len(records)))
+	putGroupRecords(m[MLDv2ReportMinimumSize:], records, IPv6AddressSize)
+}
+
+// IsValid returns true if m is long enough to hold the multicast address
+// records it claims to hold.
+func (m MLDv2Report) IsValid() bool {
+	if len(m) < MLDv2ReportMinimumSize {
+		return false
+	}
+	_, ok := m.MulticastAddressRecords()
+	return ok
+}
+
+// NumberOfMulticastAddressRecords returns the Nr of Mcast Address Records
+// field.
+func (m MLDv2Report) NumberOfMulticastAddressRecords() uint16 {
+	return binary.BigEndian.Uint16(m[mldv2ReportNumberOfRecordsOffset:])
+}
+
+// MulticastAddressRecords returns the Multicast Address Records. It returns
+// false if m is too short to hold them.
+func (m MLDv2Report) MulticastAddressRecords() ([]GroupRecord, bool) {
+	return parseGroupRecords(m[MLDv2ReportMinimumSize:], m.NumberOfMulticastAddressRecords(), IPv6AddressSize)
+}
+
+// MLDv2MaximumResponseCode returns the Maximum Response Code representing the
+// largest Maximum Response Delay that doesn't exceed d.
+func MLDv2MaximumResponseCode(d time.Duration) uint16 {
+	return encodeExpMant(durationToUint32(d, time.Millisecond), mldv2MaximumResponseCodeMantissaBits)
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestMLDv2Query(t *testing.T) {
+	const (
+		multicastAddress = tcpip.Address("\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+		sourceAddress    = tcpip.Address("\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+	)
+	b := []byte{
+		0x80, 0x01, // Maximum Response Code, exp 0 and mant 1
+		0x00, 0x00, // Reserved
+	}
+	b = append(b, multicastAddress...)
+	b = append(b,
+		0x03,       // Resv, S and QRV
+		0x7d,       // QQIC
+		0x00, 0x01, // Number of Sources
+	)
+	b = append(b, sourceAddress...)
+
+	query := header.MLDv2Query(b)
+	if !query.IsValid() {
+		t.Fatalf("got query.IsValid() = false, want = true")
+	}
+	if got, want := query.MaximumResponseDelay(), 32776*time.Millisecond; got != want {
+		t.Errorf("got query.MaximumResponseDelay() = %s, want = %s", got, want)
+	}
+	if got := query.MulticastAddress(); got != multicastAddress {
+		t.Errorf("got query.MulticastAddress() = %s, want = %s", got, multicastAddress)
+	}
+	if query.SuppressRouterProcessing() {
+		t.Errorf("got query.SuppressRouterProcessing() = true, want = false")
+	}
+	if got, want := query.QuerierRobustnessVariable(), uint8(3); got != want {
+		t.Errorf("got query.QuerierRobustnessVariable() = %d, want = %d", got, want)
+	}
+	if got, want := query.QuerierQueryInterval(), 125*time.Second; got != want {
+		t.Errorf("got query.QuerierQueryInterval() = %s, want = %s", got, want)
+	}
+	if sources, ok := query.Sources(); !ok {
+		t.Errorf("got query.Sources() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff([]tcpip.Address{sourceAddress}, sources); diff != "" {
+		t.Errorf("query.Sources() mismatch (-want +got):\n%s", diff)
+	}
+	if header.MLDv2Query(b[:len(b)-1]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated query, want = false")
+	}
+
+	encoded := header.MLDv2Query(make([]byte, header.MLDv2QuerySize(1)))
+	encoded.Encode(&header.MLDv2QueryFields{
+		MaxRespCode:      header.MLDv2MaximumResponseCode(32776 * time.Millisecond),
+		MulticastAddress: multicastAddress,
+		QRV:              3,
+		QQIC:             header.IGMPv3QuerierQueryIntervalCode(125 * time.Second),
+		Sources:          []tcpip.Address{sourceAddress},
+	})
+	if !bytes.Equal(encoded, b) {
+		t.Errorf("got encoded query = %x, want = %x", []byte(encoded), b)
+	}
+
+	for _, tt := range []struct {
+		code  uint16
+		delay time.Duration
+	}{
+		{code: 0x7fff, delay: 32767 * time.Millisecond},
+		{code: 0x8000, delay: 32768 * time.Millisecond},
+		{code: 0xffff, delay: 8387584 * time.Millisecond},
+	} {
+		if got := header.MLDv2MaximumResponseCode(tt.delay); got != tt.code {
+			t.Errorf("got header.MLDv2MaximumResponseCode(%s) = %#x, want = %#x", tt.delay, got, tt.code)
+		}
+	}
+}
+
+func TestMLDv2Report(t *testing.T) {
+	const (
+		multicastAddress = tcpip.Address("\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+		sourceAddress    = tcpip.Address("\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+	)
+	records := []header.GroupRecord{
+		{
+			Type:             header.GroupRecordChangeToIncludeMode,
+			MulticastAddress: multicastAddress,
+			Sources:          []tcpip.Address{sourceAddress},
+		},
+	}
+	want := []byte{
+		0x00, 0x00, // Reserved
+		0x00, 0x01, // Nr of Mcast Address Records
+		// Multicast Address Record [1]
+		0x03, 0x00, 0x00, 0x01,
+	}
+	want = append(want, multicastAddress...)
+	want = append(want, sourceAddress...)
+
+	report := header.MLDv2Report(make([]byte, header.MLDv2ReportSize(records)))
+	report.Encode(records)
+	if !bytes.Equal(report, want) {
+		t.Fatalf("got encoded report = %x, want = %x", []byte(report), want)
+	}
+	if !report.IsValid() {
+		t.Fatalf("got report.IsValid() = false, want = true")
+	}
+	if got, ok := report.MulticastAddressRecords(); !ok {
+		t.Errorf("got report.MulticastAddressRecords() = (_, false), want = (_, true)")
+	} else if diff := cmp.Diff(records, got); diff != "" {
+		t.Errorf("report.MulticastAddressRecords() mismatch (-want +got):\n%s", diff)
+	}
+	if header.MLDv2Report(report[:len(report)-1]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated report, want = false")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// MulticastScope is the scope of a multicast address, with the values of the
+// scop field of IPv6 multicast addresses as per RFC 7346 section 2. Larger
+// values indicate wider scopes.
+type MulticastScope uint8
+
+// Multicast scopes, as per RFC 7346 section 2.
+const (
+	InterfaceLocalMulticastScope    MulticastScope = 0x1
+	LinkLocalMulticastScope         MulticastScope = 0x2
+	RealmLocalMulticastScope        MulticastScope = 0x3
+	AdminLocalMulticastScope        MulticastScope = 0x4
+	SiteLocalMulticastScope         MulticastScope = 0x5
+	OrganizationLocalMulticastScope MulticastScope = 0x8
+	GlobalMulticastScope            MulticastScope = 0xe
+)
+
+// V6MulticastScope returns the scope of the IPv6 multicast address addr.
+//
+// Precondition: IsV6MulticastAddress(addr) must be true.
+func V6MulticastScope(addr tcpip.Address) MulticastScope {
+	return MulticastScope(addr[ipv6MulticastAddressScopeByteIdx] & ipv6MulticastAddressScopeMask)
+}
+
+// V4MulticastScope returns the scope of the IPv4 multicast address addr.
+// Addresses in the Local Network Control Block (224.0.0.0/24) are link-local
+// as per RFC 5771 section 4. Administratively scoped addresses (239.0.0.0/8)
+// are given the scope of their range as per RFC 2365 section 6. Other
+// addresses are global.
+//
+// Precondition: IsV4MulticastAddress(addr) must be true.
+func V4MulticastScope(addr tcpip.Address) MulticastScope {
+	switch {
+	case addr[0] == 224 && addr[1] == 0 && addr[2] == 0:
+		return LinkLocalMulticastScope
+	case addr[0] != 239:
+		return GlobalMulticastScope
+	case addr[1] == 255:
+		// IPv4 Local Scope, 239.255.0.0/16.
+		return SiteLocalMulticastScope
+	case addr[1]&0xfc == 192:
+		// IPv4 Organization Local Scope, 239.192.0.0/14.
+		return OrganizationLocalMulticastScope
+	default:
+		return AdminLocalMulticastScope
+	}
+}
@@ -16,6 +16,7 @@ package header
 
 import (
 	"encoding/binary"
+	"fmt"
 	"time"
 )
 
@@ -47,6 +48,16 @@ const (
 	// within the bit-field/flags byte of an NDPRouterAdvert.
 	ndpRAOtherConfFlagMask = (1 << 6)
 
+	// ndpRADefaultRouterPreferenceShift is the shift of the Default Router
+	// Preference field within the bit-field/flags byte of an
+	// NDPRouterAdvert.
+	ndpRADefaultRouterPreferenceShift = 3
+
+	// ndpRADefaultRouterPreferenceMask is the mask of the Default Router
+	// Preference field within the bit-field/flags byte of an
+	// NDPRouterAdvert, once shifted.
+	ndpRADefaultRouterPreferenceMask = 3
+
 	// ndpRARouterLifetimeOffset is the start of the 2-byte Router Lifetime
 	// field within an NDPRouterAdvert.
 	ndpRARouterLifetimeOffset = 2
@@ -80,6 +91,61 @@ func (b NDPRouterAdvert) OtherConfFlag() bool {
 	return b[ndpRAFlagsOffset]&ndpRAOtherConfFlagMask != 0
 }
 
+// NDPRoutePreference is the preference of a router or of a route, as per RFC
+// 4191 section 2.1.
+type NDPRoutePreference uint8
+
+const (
+	// HighRoutePreference indicates a high preference.
+	HighRoutePreference NDPRoutePreference = 1
+
+	// MediumRoutePreference indicates a medium preference, the default.
+	MediumRoutePreference NDPRoutePreference = 0
+
+	// LowRoutePreference indicates a low preference.
+	LowRoutePreference NDPRoutePreference = 3
+
+	// ReservedRoutePreference is a reserved value, which receivers must
+	// treat as MediumRoutePreference.
+	ReservedRoutePreference NDPRoutePreference = 2
+)
+
+// String implements fmt.Stringer.
+func (p NDPRoutePreference) String() string {
+	switch p {
+	case HighRoutePreference:
+		return "HighRoutePreference"
+	case MediumRoutePreference:
+		return "MediumRoutePreference"
+	case LowRoutePreference:
+		return "LowRoutePreference"
+	case ReservedRoutePreference:
+		return "ReservedRoutePreference"
+	default:
+		return fmt.Sprintf("NDPRoutePreference(%d)", uint8(p))
+	}
+}
+
+// Rank returns the rank of p: routers and routes with a higher rank are
+// preferred. ReservedRoutePreference ranks as MediumRoutePreference.
+func (p NDPRoutePreference) Rank() int {
+	switch p {
+	case HighRoutePreference:
+		return 1
+	case LowRoutePreference:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// DefaultRouterPreference returns the value of the Default Router Preference
+// field, as per RFC 4191 section 2.2. It must be ignored when the Router
+// Lifetime is 0.
+func (b NDPRouterAdvert) DefaultRouterPreference() NDPRoutePreference {
+	return NDPRoutePreference((b[ndpRAFlagsOffset] >> ndpRADefaultRouterPreferenceShift) & ndpRADefaultRouterPreferenceMask)
+}
+
 // RouterLifetime returns the lifetime associated with the default router. A
 // value of 0 means the source of the Router Advertisement is not a default
 // router and SHOULD NOT appear on the default router list. Note, a value of 0
@@ -144,6 +144,10 @@ func TestNDPRouterAdvert(t *testing.T) {
 		t.Errorf("got OtherConfFlag = true, want = false")
 	}
 
+	if got, want := ra.DefaultRouterPreference(), MediumRoutePreference; got != want {
+		t.Errorf("got ra.DefaultRouterPreference = %s, want = %s", got, want)
+	}
+
 	if got, want := ra.RouterLifetime(), time.Second*258; got != want {
 		t.Errorf("got ra.RouterLifetime = %d, want = %d", got, want)
 	}
@@ -157,6 +161,34 @@ func TestNDPRouterAdvert(t *testing.T) {
 	}
 }
 
+func TestNDPRouterAdvertDefaultRouterPreference(t *testing.T) {
+	tests := []struct {
+		flags uint8
+		want  NDPRoutePreference
+	}{
+		{flags: 0x00, want: MediumRoutePreference},
+		{flags: 0x08, want: HighRoutePreference},
+		{flags: 0xd8, want: LowRoutePreference},
+		{flags: 0x10, want: ReservedRoutePreference},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want.String(), func(t *testing.T) {
+			ra := NDPRouterAdvert([]byte{64, test.flags, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+			if got := ra.DefaultRouterPreference(); got != test.want {
+				t.Errorf("got ra.DefaultRouterPreference() = %s, want = %s", got, test.want)
+			}
+		})
+	}
+
+	if got, want := ReservedRoutePreference.Rank(), MediumRoutePreference.Rank(); got != want {
+		t.Errorf("got ReservedRoutePreference.Rank() = %d, want = %d", got, want)
+	}
+	if HighRoutePreference.Rank() <= MediumRoutePreference.Rank() || MediumRoutePreference.Rank() <= LowRoutePreference.Rank() {
+		t.Errorf("got ranks (high, medium, low) = (%d, %d, %d), want decreasing", HighRoutePreference.Rank(), MediumRoutePreference.Rank(), LowRoutePreference.Rank())
+	}
+}
+
 // TestNDPSourceLinkLayerAddressOptionEthernetAddress tests getting the
 // Ethernet address from an NDPSourceLinkLayerAddressOption.
 func TestNDPSourceLinkLayerAddressOptionEthernetAddress(t *testing.T) {
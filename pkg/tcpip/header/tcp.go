@@ -53,6 +53,8 @@ const (
 	TCPFlagPsh
 	TCPFlagAck
 	TCPFlagUrg
+	TCPFlagEce
+	TCPFlagCwr
 )
 
 // Options that may be present in a TCP segment.
@@ -268,6 +270,37 @@ func (b TCP) SetChecksum(checksum uint16) {
 	binary.BigEndian.PutUint16(b[TCPChecksumOffset:], checksum)
 }
 
+// SetSourcePortWithChecksumUpdate sets the "source port" field of the tcp
+// header and incrementally updates the checksum to reflect the change.
+func (b TCP) SetSourcePortWithChecksumUpdate(port uint16) {
+	b.SetChecksum(^ChecksumUpdate(^b.Checksum(), b.SourcePort(), port))
+	b.SetSourcePort(port)
+}
+
+// SetDestinationPortWithChecksumUpdate sets the "destination port" field of
+// the tcp header and incrementally updates the checksum to reflect the change.
+func (b TCP) SetDestinationPortWithChecksumUpdate(port uint16) {
+	b.SetChecksum(^ChecksumUpdate(^b.Checksum(), b.DestinationPort(), port))
+	b.SetDestinationPort(port)
+}
+
+// UpdateChecksumPseudoHeaderAddress incrementally updates the checksum to
+// reflect an address change in the network-layer pseudo-header. fullChecksum
+// indicates whether the checksum field holds the full checksum or, as is the
+// case when checksumming is offloaded, only the (uncomplemented) pseudo-header
+// checksum.
+func (b TCP) UpdateChecksumPseudoHeaderAddress(old, new tcpip.Address, fullChecksum bool) {
+	xsum := b.Checksum()
+	if fullChecksum {
+		xsum = ^xsum
+	}
+	xsum = ChecksumUpdateAddress(xsum, old, new)
+	if fullChecksum {
+		xsum = ^xsum
+	}
+	b.SetChecksum(xsum)
+}
+
 // SetDataOffset sets the data offset field of the tcp header. headerLen should
 // be the length of the TCP header in bytes.
 func (b TCP) SetDataOffset(headerLen uint8) {
@@ -0,0 +1,291 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// TCP options that are only produced by the serializer.
+const (
+	// TCPOptionMD5 is the TCP MD5 Signature option, as per RFC 2385.
+	TCPOptionMD5 = 19
+
+	// TCPOptionAO is the TCP Authentication Option, as per RFC 5925.
+	TCPOptionAO = 29
+
+	// TCPOptionExperimental1 and TCPOptionExperimental2 are the option kinds
+	// reserved for experiments, as per RFC 4727 and RFC 6994.
+	TCPOptionExperimental1 = 253
+	TCPOptionExperimental2 = 254
+)
+
+// Lengths of the options only produced by the serializer.
+const (
+	// TCPOptionMD5Length is the length of the MD5 Signature option.
+	TCPOptionMD5Length = 2 + TCPOptionMD5DigestSize
+
+	// TCPOptionMD5DigestSize is the size of the digest of the MD5 Signature
+	// option.
+	TCPOptionMD5DigestSize = 16
+
+	// TCPOptionAOHeaderLength is the length of the Authentication Option
+	// without its MAC.
+	TCPOptionAOHeaderLength = 4
+
+	// TCPOptionExperimentalHeaderLength is the length of an experimental
+	// option without its data, the ExID included.
+	TCPOptionExperimentalHeaderLength = 4
+)
+
+// TCPSerializableOption is an interface to represent serializable TCP option
+// types.
+type TCPSerializableOption interface {
+	// length returns the size of the option when fully serialized.
+	length() int
+
+	// serializeInto serializes the option into b and returns the number of
+	// bytes written. Like the Encode*Option functions, options write nothing
+	// if b is too small to hold them, except SACK blocks which are trimmed
+	// to the blocks that fit.
+	serializeInto(b []byte) int
+}
+
+// TCPOptionsSerializer is a serializer for TCP options. The options are
+// serialized in order, so callers control where NOPs go.
+type TCPOptionsSerializer []TCPSerializableOption
+
+// Length returns the number of bytes required to serialize the options,
+// including the padding to a 32 bit boundary.
+func (s TCPOptionsSerializer) Length() int {
+	var total int
+	for _, opt := range s {
+		total += opt.length()
+	}
+	return (total + 3) &^ 3
+}
+
+// Serialize serializes the options in s into b, pads them with NOPs to a 32
+// bit boundary and returns the number of bytes written. b must have room for
+// the padding of what fits in it.
+func (s TCPOptionsSerializer) Serialize(b []byte) int {
+	offset := 0
+	for _, opt := range s {
+		offset += opt.serializeInto(b[offset:])
+	}
+	return offset + AddTCPOptionPadding(b, offset)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableNOPOption)(nil)
+
+// TCPSerializableNOPOption is a serializable No-Operation option.
+type TCPSerializableNOPOption struct{}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableNOPOption) length() int { return 1 }
+
+// serializeInto implements TCPSerializableOption.
+func (*TCPSerializableNOPOption) serializeInto(b []byte) int {
+	return EncodeNOP(b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableEOLOption)(nil)
+
+// TCPSerializableEOLOption is a serializable End of Option List option.
+type TCPSerializableEOLOption struct{}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableEOLOption) length() int { return 1 }
+
+// serializeInto implements TCPSerializableOption.
+func (*TCPSerializableEOLOption) serializeInto(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	b[0] = TCPOptionEOL
+	return 1
+}
+
+var _ TCPSerializableOption = (*TCPSerializableMSSOption)(nil)
+
+// TCPSerializableMSSOption is a serializable Maximum Segment Size option.
+type TCPSerializableMSSOption struct {
+	MSS uint16
+}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableMSSOption) length() int { return TCPOptionMSSLength }
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableMSSOption) serializeInto(b []byte) int {
+	return EncodeMSSOption(uint32(o.MSS), b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableWSOption)(nil)
+
+// TCPSerializableWSOption is a serializable Window Scale option.
+type TCPSerializableWSOption struct {
+	// Shift is the window scale shift count.
+	Shift int
+}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableWSOption) length() int { return TCPOptionWSLength }
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableWSOption) serializeInto(b []byte) int {
+	return EncodeWSOption(o.Shift, b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableSACKPermittedOption)(nil)
+
+// TCPSerializableSACKPermittedOption is a serializable SACK Permitted option.
+type TCPSerializableSACKPermittedOption struct{}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableSACKPermittedOption) length() int { return TCPOptionSackPermittedLength }
+
+// serializeInto implements TCPSerializableOption.
+func (*TCPSerializableSACKPermittedOption) serializeInto(b []byte) int {
+	return EncodeSACKPermittedOption(b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableSACKBlocksOption)(nil)
+
+// TCPSerializableSACKBlocksOption is a serializable SACK option. At most
+// TCPMaxSACKBlocks blocks are serialized, fewer if they don't fit.
+type TCPSerializableSACKBlocksOption struct {
+	Blocks []SACKBlock
+}
+
+// length implements TCPSerializableOption.
+func (o *TCPSerializableSACKBlocksOption) length() int {
+	n := len(o.Blocks)
+	if n == 0 {
+		return 0
+	}
+	if n > TCPMaxSACKBlocks {
+		n = TCPMaxSACKBlocks
+	}
+	return 2 + n*8
+}
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableSACKBlocksOption) serializeInto(b []byte) int {
+	return EncodeSACKBlocks(o.Blocks, b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableTimestampOption)(nil)
+
+// TCPSerializableTimestampOption is a serializable Timestamps option.
+type TCPSerializableTimestampOption struct {
+	TSVal uint32
+	TSEcr uint32
+}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableTimestampOption) length() int { return TCPOptionTSLength }
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableTimestampOption) serializeInto(b []byte) int {
+	return EncodeTSOption(o.TSVal, o.TSEcr, b)
+}
+
+var _ TCPSerializableOption = (*TCPSerializableMD5Option)(nil)
+
+// TCPSerializableMD5Option is a serializable MD5 Signature option.
+type TCPSerializableMD5Option struct {
+	Digest [TCPOptionMD5DigestSize]byte
+}
+
+// length implements TCPSerializableOption.
+func (*TCPSerializableMD5Option) length() int { return TCPOptionMD5Length }
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableMD5Option) serializeInto(b []byte) int {
+	if len(b) < TCPOptionMD5Length {
+		return 0
+	}
+	b[0], b[1] = TCPOptionMD5, TCPOptionMD5Length
+	copy(b[2:], o.Digest[:])
+	return TCPOptionMD5Length
+}
+
+var _ TCPSerializableOption = (*TCPSerializableAOOption)(nil)
+
+// TCPSerializableAOOption is a serializable Authentication Option.
+type TCPSerializableAOOption struct {
+	KeyID      uint8
+	RNextKeyID uint8
+	MAC        []byte
+}
+
+// length implements TCPSerializableOption.
+func (o *TCPSerializableAOOption) length() int {
+	return TCPOptionAOHeaderLength + len(o.MAC)
+}
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableAOOption) serializeInto(b []byte) int {
+	l := o.length()
+	if l > TCPOptionsMaximumSize {
+		panic(fmt.Sprintf("got TCP-AO option of %d bytes, expected at most %d bytes", l, TCPOptionsMaximumSize))
+	}
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1], b[2], b[3] = TCPOptionAO, uint8(l), o.KeyID, o.RNextKeyID
+	copy(b[TCPOptionAOHeaderLength:], o.MAC)
+	return l
+}
+
+var _ TCPSerializableOption = (*TCPSerializableExperimentalOption)(nil)
+
+// TCPSerializableExperimentalOption is a serializable experimental option
+// using the shared experimental option format of RFC 6994.
+type TCPSerializableExperimentalOption struct {
+	// Kind is TCPOptionExperimental1 or TCPOptionExperimental2.
+	Kind uint8
+
+	// ExID is the experiment identifier.
+	ExID uint16
+
+	// Data is the option data following ExID.
+	Data []byte
+}
+
+// length implements TCPSerializableOption.
+func (o *TCPSerializableExperimentalOption) length() int {
+	return TCPOptionExperimentalHeaderLength + len(o.Data)
+}
+
+// serializeInto implements TCPSerializableOption.
+func (o *TCPSerializableExperimentalOption) serializeInto(b []byte) int {
+	if o.Kind != TCPOptionExperimental1 && o.Kind != TCPOptionExperimental2 {
+		panic(fmt.Sprintf("got experimental TCP option kind %d, expected %d or %d", o.Kind, TCPOptionExperimental1, TCPOptionExperimental2))
+	}
+	l := o.length()
+	if l > TCPOptionsMaximumSize {
+		panic(fmt.Sprintf("got experimental TCP option of %d bytes, expected at most %d bytes", l, TCPOptionsMaximumSize))
+	}
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1] = o.Kind, uint8(l)
+	binary.BigEndian.PutUint16(b[2:], o.ExID)
+	copy(b[TCPOptionExperimentalHeaderLength:], o.Data)
+	return l
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestTCPOptionsSerializer(t *testing.T) {
+	tests := []struct {
+		name    string
+		options header.TCPOptionsSerializer
+		want    []byte
+	}{
+		{
+			name: "syn options",
+			options: header.TCPOptionsSerializer{
+				&header.TCPSerializableMSSOption{MSS: 1460},
+				&header.TCPSerializableSACKPermittedOption{},
+				&header.TCPSerializableTimestampOption{TSVal: 1, TSEcr: 2},
+				&header.TCPSerializableNOPOption{},
+				&header.TCPSerializableWSOption{Shift: 7},
+			},
+			want: []byte{
+				2, 4, 0x05, 0xb4, // MSS
+				4, 2, // SACK Permitted
+				8, 10, 0, 0, 0, 1, 0, 0, 0, 2, // Timestamps
+				1,       // NOP
+				3, 3, 7, // Window Scale
+			},
+		},
+		{
+			name: "padded",
+			options: header.TCPOptionsSerializer{
+				&header.TCPSerializableWSOption{Shift: 14},
+			},
+			want: []byte{3, 3, 14, 1},
+		},
+		{
+			name: "sack blocks",
+			options: header.TCPOptionsSerializer{
+				&header.TCPSerializableNOPOption{},
+				&header.TCPSerializableNOPOption{},
+				&header.TCPSerializableSACKBlocksOption{Blocks: []header.SACKBlock{{Start: 1, End: 2}}},
+			},
+			want: []byte{
+				1, 1, // NOPs
+				5, 10, 0, 0, 0, 1, 0, 0, 0, 2, // SACK
+			},
+		},
+		{
+			name: "md5",
+			options: header.TCPOptionsSerializer{
+				&header.TCPSerializableNOPOption{},
+				&header.TCPSerializableNOPOption{},
+				&header.TCPSerializableMD5Option{Digest: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+			},
+			want: []byte{
+				1, 1, // NOPs
+				19, 18, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, // MD5
+			},
+		},
+		{
+			name: "ao and experimental",
+			options: header.TCPOptionsSerializer{
+				&header.TCPSerializableAOOption{KeyID: 1, RNextKeyID: 2, MAC: []byte{3, 4, 5, 6}},
+				&header.TCPSerializableExperimentalOption{Kind: header.TCPOptionExperimental2, ExID: 0xf989, Data: []byte{7}},
+				&header.TCPSerializableEOLOption{},
+			},
+			want: []byte{
+				29, 8, 1, 2, 3, 4, 5, 6, // TCP-AO
+				254, 5, 0xf9, 0x89, 7, // Experimental
+				0,    // EOL
+				1, 1, // Padding
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.options.Length(); got != len(test.want) {
+				t.Fatalf("got options.Length() = %d, want = %d", got, len(test.want))
+			}
+			b := make([]byte, header.TCPOptionsMaximumSize)
+			n := test.options.Serialize(b)
+			if got := b[:n]; !bytes.Equal(got, test.want) {
+				t.Fatalf("got options.Serialize(_) = %x, want = %x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTCPOptionsSerializerSACKBlocksTrimmed(t *testing.T) {
+	blocks := make([]header.SACKBlock, header.TCPMaxSACKBlocks+1)
+	options := header.TCPOptionsSerializer{
+		&header.TCPSerializableNOPOption{},
+		&header.TCPSerializableNOPOption{},
+		&header.TCPSerializableTimestampOption{},
+		&header.TCPSerializableNOPOption{},
+		&header.TCPSerializableNOPOption{},
+		&header.TCPSerializableSACKBlocksOption{Blocks: blocks},
+	}
+	b := make([]byte, header.TCPOptionsMaximumSize)
+	n := options.Serialize(b)
+	// Only 3 SACK blocks fit after the timestamps.
+	if want := 12 + 2 + 2 + 3*8; n != want {
+		t.Fatalf("got options.Serialize(_) = %d bytes, want = %d bytes", n, want)
+	}
+	opts := header.ParseTCPOptions(b[:n])
+	if got, want := len(opts.SACKBlocks), 3; got != want {
+		t.Errorf("got len(ParseTCPOptions(_).SACKBlocks) = %d, want = %d", got, want)
+	}
+}
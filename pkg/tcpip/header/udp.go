@@ -104,6 +104,48 @@ func (b UDP) SetChecksum(checksum uint16) {
 	binary.BigEndian.PutUint16(b[udpChecksum:], checksum)
 }
 
+// SetSourcePortWithChecksumUpdate sets the "source port" field of the udp
+// header and incrementally updates the checksum, if present, to reflect the
+// change.
+func (b UDP) SetSourcePortWithChecksumUpdate(port uint16) {
+	b.updateChecksum(b.SourcePort(), port)
+	b.SetSourcePort(port)
+}
+
+// SetDestinationPortWithChecksumUpdate sets the "destination port" field of
+// the udp header and incrementally updates the checksum, if present, to
+// reflect the change.
+func (b UDP) SetDestinationPortWithChecksumUpdate(port uint16) {
+	b.updateChecksum(b.DestinationPort(), port)
+	b.SetDestinationPort(port)
+}
+
+// UpdateChecksumPseudoHeaderAddress incrementally updates the checksum, if
+// present, to reflect an address change in the network-layer pseudo-header.
+func (b UDP) UpdateChecksumPseudoHeaderAddress(old, new tcpip.Address) {
+	if xsum := b.Checksum(); xsum != 0 {
+		b.setUpdatedChecksum(ChecksumUpdateAddress(^xsum, old, new))
+	}
+}
+
+// updateChecksum incrementally updates the checksum, if present, after the
+// 16-bit word old was replaced with new.
+func (b UDP) updateChecksum(old, new uint16) {
+	if xsum := b.Checksum(); xsum != 0 {
+		b.setUpdatedChecksum(ChecksumUpdate(^xsum, old, new))
+	}
+}
+
+// setUpdatedChecksum sets the checksum field given the updated one's
+// complement sum. A zero checksum means that the datagram carries no checksum,
+// so it is transmitted as all ones instead, as per RFC 768.
+func (b UDP) setUpdatedChecksum(xsum uint16) {
+	if xsum = ^xsum; xsum == 0 {
+		xsum = 0xffff
+	}
+	b.SetChecksum(xsum)
+}
+
 // SetLength sets the "length" field of the udp header.
 func (b UDP) SetLength(length uint16) {
 	binary.BigEndian.PutUint16(b[udpLength:], length)
@@ -0,0 +1,87 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import "encoding/binary"
+
+const (
+	vxlanFlagsOffset = 0
+	vxlanVNIOffset   = 4
+
+	// vxlanVNIValid is the I flag, which is set if the VNI is valid.
+	vxlanVNIValid = 1 << 3
+)
+
+const (
+	// VXLANSize is the size of a VXLAN header.
+	VXLANSize = 8
+
+	// VXLANPort is the UDP port assigned to VXLAN by IANA.
+	VXLANPort = 4789
+
+	// VXLANMaximumVNI is the largest VXLAN Network Identifier, which is 24
+	// bits long.
+	VXLANMaximumVNI = 1<<24 - 1
+)
+
+// VXLANFields contains the fields of a VXLAN header. It is used to describe
+// the fields of a header that needs to be encoded.
+type VXLANFields struct {
+	// VNI is the VXLAN Network Identifier, which must fit in 24 bits. The I
+	// flag is always set by Encode.
+	VNI uint32
+}
+
+// VXLAN represents a Virtual eXtensible Local Area Network header stored in a
+// byte array, as per RFC 7348 section 5. The payload is an Ethernet frame.
+//
+//    0                   1                   2                   3
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |R|R|R|R|I|R|R|R|            Reserved                           |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |                VXLAN Network Identifier (VNI) |   Reserved    |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type VXLAN []byte
+
+// VNIValid returns true if the I flag is set.
+func (b VXLAN) VNIValid() bool {
+	return b[vxlanFlagsOffset]&vxlanVNIValid != 0
+}
+
+// VNI returns the VXLAN Network Identifier.
+func (b VXLAN) VNI() uint32 {
+	return binary.BigEndian.Uint32(b[vxlanVNIOffset:]) >> 8
+}
+
+// Payload returns the Ethernet frame following the header.
+func (b VXLAN) Payload() []byte {
+	return b[VXLANSize:]
+}
+
+// IsValid returns true if b is long enough to hold a VXLAN header and has the
+// I flag set, as receivers must check as per RFC 7348 section 5.
+func (b VXLAN) IsValid() bool {
+	return len(b) >= VXLANSize && b.VNIValid()
+}
+
+// Encode encodes all the fields of the VXLAN header into b.
+func (b VXLAN) Encode(f *VXLANFields) {
+	for i := range b[:VXLANSize] {
+		b[i] = 0
+	}
+	b[vxlanFlagsOffset] = vxlanVNIValid
+	binary.BigEndian.PutUint32(b[vxlanVNIOffset:], (f.VNI&VXLANMaximumVNI)<<8)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestVXLAN(t *testing.T) {
+	want := []byte{
+		0x08, 0x00, 0x00, 0x00, // Flags and Reserved
+		0x12, 0x34, 0x56, 0x00, // VNI and Reserved
+	}
+
+	b := make([]byte, header.VXLANSize)
+	vxlan := header.VXLAN(b)
+	vxlan.Encode(&header.VXLANFields{VNI: 0x123456})
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got encoded header = %x, want = %x", b, want)
+	}
+	if !vxlan.IsValid() {
+		t.Fatalf("got vxlan.IsValid() = false, want = true")
+	}
+	if got, want := vxlan.VNI(), uint32(0x123456); got != want {
+		t.Errorf("got vxlan.VNI() = %#x, want = %#x", got, want)
+	}
+	if header.VXLAN(b[:header.VXLANSize-1]).IsValid() {
+		t.Errorf("got IsValid() = true for a truncated header, want = false")
+	}
+
+	b[0] = 0
+	if vxlan.IsValid() {
+		t.Errorf("got IsValid() = true without the I flag, want = false")
+	}
+}
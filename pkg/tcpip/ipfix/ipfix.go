@@ -0,0 +1,363 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ipfix exports the accounting of connections tracked by a stack as
+// IPFIX (RFC 7011) messages, to a collector such as a NetFlow analyzer.
+package ipfix
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// Version is the version of the IPFIX protocol.
+	Version = 10
+
+	// DefaultPort is the port collectors listen on by default.
+	DefaultPort = 4739
+
+	// DefaultMaxMessageSize is the default maximum size of messages, which
+	// fits in the MTU of most paths when sent over UDP.
+	DefaultMaxMessageSize = 1400
+
+	// MaxPendingRecords is the maximum number of records of expired flows
+	// held until the next export. Further expired flows are not exported.
+	MaxPendingRecords = 4096
+)
+
+// Template IDs of the records sent by an Exporter.
+const (
+	IPv4TemplateID = 256
+	IPv6TemplateID = 257
+)
+
+// Flow end reasons, as defined by the flowEndReason information element.
+const (
+	EndReasonIdleTimeout   = 1
+	EndReasonActiveTimeout = 2
+)
+
+const (
+	messageHeaderSize = 16
+	setHeaderSize     = 4
+	templateSetID     = 2
+)
+
+// field is an information element of a template.
+type field struct {
+	id     uint16
+	length uint16
+}
+
+// Information elements, as assigned by IANA.
+const (
+	octetDeltaCount          = 1
+	packetDeltaCount         = 2
+	protocolIdentifier       = 4
+	sourceTransportPort      = 7
+	sourceIPv4Address        = 8
+	destinationTransportPort = 11
+	destinationIPv4Address   = 12
+	sourceIPv6Address        = 27
+	destinationIPv6Address   = 28
+	flowEndReason            = 136
+	flowStartMilliseconds    = 152
+	flowEndMilliseconds      = 153
+)
+
+// templateFields returns the fields of the records of flows whose addresses
+// are addrLen bytes long. Records are encoded in this order by appendRecord.
+func templateFields(srcAddrID, dstAddrID, addrLen uint16) []field {
+	return []field{
+		{srcAddrID, addrLen},
+		{dstAddrID, addrLen},
+		{sourceTransportPort, 2},
+		{destinationTransportPort, 2},
+		{protocolIdentifier, 1},
+		{octetDeltaCount, 8},
+		{packetDeltaCount, 8},
+		{flowStartMilliseconds, 8},
+		{flowEndMilliseconds, 8},
+		{flowEndReason, 1},
+	}
+}
+
+var (
+	ipv4Fields = templateFields(sourceIPv4Address, destinationIPv4Address, header.IPv4AddressSize)
+	ipv6Fields = templateFields(sourceIPv6Address, destinationIPv6Address, header.IPv6AddressSize)
+)
+
+// recordSize returns the size of records with the given fields.
+func recordSize(fields []field) int {
+	size := 0
+	for _, f := range fields {
+		size += int(f.length)
+	}
+	return size
+}
+
+// templateSetSize is the size of the set holding the templates of an Exporter.
+var templateSetSize = setHeaderSize + 2*4 + 4*(len(ipv4Fields)+len(ipv6Fields))
+
+// Options are the parameters of an Exporter.
+type Options struct {
+	// ObservationDomainID identifies the stack to the collector.
+	ObservationDomainID uint32
+
+	// MaxMessageSize is the maximum size of the messages. It defaults to
+	// DefaultMaxMessageSize if zero.
+	MaxMessageSize int
+}
+
+// record is a data record, accounting the packets of a flow sent in one
+// direction since the previous export.
+type record struct {
+	transProto tcpip.TransportProtocolNumber
+	tuple      stack.FlowTuple
+	start      time.Time
+	end        time.Time
+	reason     uint8
+}
+
+// flowKey identifies a flow across exports.
+type flowKey struct {
+	netProto   tcpip.NetworkProtocolNumber
+	transProto tcpip.TransportProtocolNumber
+	srcAddr    tcpip.Address
+	srcPort    uint16
+	dstAddr    tcpip.Address
+	dstPort    uint16
+	start      int64
+}
+
+// counters are the exported counters of a flow, in the original and reply
+// directions.
+type counters struct {
+	packets [2]uint64
+	bytes   [2]uint64
+}
+
+// An Exporter sends IPFIX messages to a collector, each with a single write.
+// Flows are exported as one record per direction, with the packets and bytes
+// seen since their previous export.
+type Exporter struct {
+	w    io.Writer
+	opts Options
+
+	mu sync.Mutex
+
+	// sequence is the number of data records sent. It is protected by mu.
+	sequence uint32
+
+	// exported holds the counters of the active flows at the time of their
+	// previous export. It is protected by mu.
+	exported map[flowKey]counters
+
+	// pending holds the records of the flows which expired since the
+	// previous export. It is protected by mu.
+	pending []record
+}
+
+// NewExporter creates a new Exporter writing messages to w, typically a UDP
+// socket connected to a collector.
+func NewExporter(w io.Writer, opts Options) (*Exporter, error) {
+	if opts.MaxMessageSize == 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	// Messages must fit the templates and a record of each kind.
+	if minSize := messageHeaderSize + templateSetSize + 2*setHeaderSize + recordSize(ipv4Fields) + recordSize(ipv6Fields); opts.MaxMessageSize < minSize {
+		return nil, fmt.Errorf("maximum message size %d is less than %d", opts.MaxMessageSize, minSize)
+	}
+	return &Exporter{
+		w:        w,
+		opts:     opts,
+		exported: make(map[flowKey]counters),
+	}, nil
+}
+
+// key returns the flowKey of f.
+func key(f *stack.Flow) flowKey {
+	return flowKey{
+		netProto:   f.NetworkProtocol,
+		transProto: f.TransportProtocol,
+		srcAddr:    f.Original.SrcAddr,
+		srcPort:    f.Original.SrcPort,
+		dstAddr:    f.Original.DstAddr,
+		dstPort:    f.Original.DstPort,
+		start:      f.Start.UnixNano(),
+	}
+}
+
+// appendRecordsLocked appends the records of the packets of f seen since its
+// previous export to records.
+//
+// Precondition: e.mu must be locked.
+func (e *Exporter) appendRecordsLocked(records []record, f *stack.Flow, reason uint8) []record {
+	if f.NetworkProtocol != header.IPv4ProtocolNumber && f.NetworkProtocol != header.IPv6ProtocolNumber {
+		return records
+	}
+	k := key(f)
+	prev := e.exported[k]
+	cur := counters{
+		packets: [2]uint64{f.Original.Packets, f.Reply.Packets},
+		bytes:   [2]uint64{f.Original.Bytes, f.Reply.Bytes},
+	}
+	if reason == EndReasonActiveTimeout {
+		e.exported[k] = cur
+	} else {
+		delete(e.exported, k)
+	}
+	for i, tuple := range []stack.FlowTuple{f.Original, f.Reply} {
+		if cur.packets[i] <= prev.packets[i] {
+			continue
+		}
+		tuple.Packets = cur.packets[i] - prev.packets[i]
+		tuple.Bytes = cur.bytes[i] - prev.bytes[i]
+		records = append(records, record{
+			transProto: f.TransportProtocol,
+			tuple:      tuple,
+			start:      f.Start,
+			end:        f.LastUsed,
+			reason:     reason,
+		})
+	}
+	return records
+}
+
+// FlowExpired queues the final records of f, which is no longer tracked, until
+// the next export. It can be passed to IPTables.EnableFlowAccounting.
+func (e *Exporter) FlowExpired(f stack.Flow) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.pending) >= MaxPendingRecords {
+		delete(e.exported, key(&f))
+		return
+	}
+	e.pending = e.appendRecordsLocked(e.pending, &f, EndReasonIdleTimeout)
+}
+
+// Export sends the records of the flows which expired since the previous
+// export, and of the active flows which saw packets since then. Templates are
+// sent on each export, as collectors may have missed them.
+func (e *Exporter) Export(flows []stack.Flow, now time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	records := e.pending
+	e.pending = nil
+	for i := range flows {
+		records = e.appendRecordsLocked(records, &flows[i], EndReasonActiveTimeout)
+	}
+
+	var v4, v6 []record
+	for _, r := range records {
+		if len(r.tuple.SrcAddr) == header.IPv4AddressSize {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	templates := true
+	for templates || len(v4) != 0 || len(v6) != 0 {
+		msg := make([]byte, messageHeaderSize, e.opts.MaxMessageSize)
+		if templates {
+			msg = appendTemplateSet(msg)
+			templates = false
+		}
+		var n4, n6 int
+		msg, n4 = e.appendDataSet(msg, IPv4TemplateID, ipv4Fields, v4)
+		v4 = v4[n4:]
+		msg, n6 = e.appendDataSet(msg, IPv6TemplateID, ipv6Fields, v6)
+		v6 = v6[n6:]
+
+		binary.BigEndian.PutUint16(msg[0:], Version)
+		binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)))
+		binary.BigEndian.PutUint32(msg[4:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(msg[8:], e.sequence)
+		binary.BigEndian.PutUint32(msg[12:], e.opts.ObservationDomainID)
+		e.sequence += uint32(n4 + n6)
+		if _, err := e.w.Write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendTemplateSet appends the set of the templates of the records to msg.
+func appendTemplateSet(msg []byte) []byte {
+	msg = appendUint16(msg, templateSetID)
+	msg = appendUint16(msg, uint16(templateSetSize))
+	for _, t := range []struct {
+		id     uint16
+		fields []field
+	}{
+		{IPv4TemplateID, ipv4Fields},
+		{IPv6TemplateID, ipv6Fields},
+	} {
+		msg = appendUint16(msg, t.id)
+		msg = appendUint16(msg, uint16(len(t.fields)))
+		for _, f := range t.fields {
+			msg = appendUint16(msg, f.id)
+			msg = appendUint16(msg, f.length)
+		}
+	}
+	return msg
+}
+
+// appendDataSet appends a set with as many of records as fit in a message to
+// msg, and returns the number of records appended.
+func (e *Exporter) appendDataSet(msg []byte, id uint16, fields []field, records []record) ([]byte, int) {
+	size := recordSize(fields)
+	n := (e.opts.MaxMessageSize - len(msg) - setHeaderSize) / size
+	if n > len(records) {
+		n = len(records)
+	}
+	if n <= 0 {
+		return msg, 0
+	}
+	msg = appendUint16(msg, id)
+	msg = appendUint16(msg, uint16(setHeaderSize+n*size))
+	for _, r := range records[:n] {
+		msg = append(msg, r.tuple.SrcAddr...)
+		msg = append(msg, r.tuple.DstAddr...)
+		msg = appendUint16(msg, r.tuple.SrcPort)
+		msg = appendUint16(msg, r.tuple.DstPort)
+		msg = append(msg, uint8(r.transProto))
+		msg = appendUint64(msg, r.tuple.Bytes)
+		msg = appendUint64(msg, r.tuple.Packets)
+		msg = appendUint64(msg, uint64(r.start.UnixNano()/int64(time.Millisecond)))
+		msg = appendUint64(msg, uint64(r.end.UnixNano()/int64(time.Millisecond)))
+		msg = append(msg, r.reason)
+	}
+	return msg, n
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
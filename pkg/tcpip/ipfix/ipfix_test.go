@@ -0,0 +1,199 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// messageWriter records the messages written to it.
+type messageWriter struct {
+	msgs [][]byte
+}
+
+func (w *messageWriter) Write(b []byte) (int, error) {
+	w.msgs = append(w.msgs, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// dataRecords returns the data records of msg, keyed by their source port,
+// after checking its header.
+func dataRecords(t *testing.T, msg []byte, wantSequence uint32) map[uint16][]byte {
+	t.Helper()
+	if got := binary.BigEndian.Uint16(msg[0:]); got != Version {
+		t.Errorf("got version = %d, want = %d", got, Version)
+	}
+	if got := int(binary.BigEndian.Uint16(msg[2:])); got != len(msg) {
+		t.Errorf("got length = %d, want = %d", got, len(msg))
+	}
+	if got := binary.BigEndian.Uint32(msg[8:]); got != wantSequence {
+		t.Errorf("got sequence number = %d, want = %d", got, wantSequence)
+	}
+	if got := binary.BigEndian.Uint32(msg[12:]); got != 7 {
+		t.Errorf("got observation domain = %d, want = 7", got)
+	}
+	records := make(map[uint16][]byte)
+	for b := msg[messageHeaderSize:]; len(b) != 0; {
+		id := binary.BigEndian.Uint16(b)
+		length := int(binary.BigEndian.Uint16(b[2:]))
+		set := b[setHeaderSize:length]
+		b = b[length:]
+		var size, addrLen int
+		switch id {
+		case templateSetID:
+			continue
+		case IPv4TemplateID:
+			size, addrLen = recordSize(ipv4Fields), header.IPv4AddressSize
+		case IPv6TemplateID:
+			size, addrLen = recordSize(ipv6Fields), header.IPv6AddressSize
+		default:
+			t.Fatalf("unexpected set ID %d", id)
+		}
+		for ; len(set) != 0; set = set[size:] {
+			records[binary.BigEndian.Uint16(set[2*addrLen:])] = set[:size]
+		}
+	}
+	return records
+}
+
+// checkRecord checks the counters and the end reason of an IPv4 record.
+func checkRecord(t *testing.T, r []byte, packets, bytes uint64, reason uint8) {
+	t.Helper()
+	const countersOff = 2*header.IPv4AddressSize + 5
+	if got := binary.BigEndian.Uint64(r[countersOff:]); got != bytes {
+		t.Errorf("got octetDeltaCount = %d, want = %d", got, bytes)
+	}
+	if got := binary.BigEndian.Uint64(r[countersOff+8:]); got != packets {
+		t.Errorf("got packetDeltaCount = %d, want = %d", got, packets)
+	}
+	if got := r[len(r)-1]; got != reason {
+		t.Errorf("got flowEndReason = %d, want = %d", got, reason)
+	}
+}
+
+func testFlow(packets, bytes uint64) stack.Flow {
+	return stack.Flow{
+		NetworkProtocol:   header.IPv4ProtocolNumber,
+		TransportProtocol: header.TCPProtocolNumber,
+		Original: stack.FlowTuple{
+			SrcAddr: tcpip.Address("\x0a\x00\x00\x01"),
+			SrcPort: 1000,
+			DstAddr: tcpip.Address("\x0a\x00\x00\x02"),
+			DstPort: 80,
+			Packets: packets,
+			Bytes:   bytes,
+		},
+		Reply: stack.FlowTuple{
+			SrcAddr: tcpip.Address("\x0a\x00\x00\x02"),
+			SrcPort: 80,
+			DstAddr: tcpip.Address("\x0a\x00\x00\x01"),
+			DstPort: 1000,
+			Packets: packets,
+			Bytes:   2 * bytes,
+		},
+		Start:    time.Unix(1, 0),
+		LastUsed: time.Unix(2, 0),
+	}
+}
+
+func TestExport(t *testing.T) {
+	var w messageWriter
+	e, err := NewExporter(&w, Options{ObservationDomainID: 7})
+	if err != nil {
+		t.Fatalf("NewExporter(_, _): %s", err)
+	}
+	now := time.Unix(3, 0)
+
+	// Active flows are exported with their counters.
+	if err := e.Export([]stack.Flow{testFlow(2, 100)}, now); err != nil {
+		t.Fatalf("e.Export(_, _): %s", err)
+	}
+	if len(w.msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(w.msgs))
+	}
+	records := dataRecords(t, w.msgs[0], 0)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	checkRecord(t, records[1000], 2, 100, EndReasonActiveTimeout)
+	checkRecord(t, records[80], 2, 200, EndReasonActiveTimeout)
+
+	// Only packets seen since the previous export are exported.
+	e.FlowExpired(testFlow(3, 150))
+	if err := e.Export(nil, now); err != nil {
+		t.Fatalf("e.Export(_, _): %s", err)
+	}
+	if len(w.msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(w.msgs))
+	}
+	records = dataRecords(t, w.msgs[1], 2)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	checkRecord(t, records[1000], 1, 50, EndReasonIdleTimeout)
+	checkRecord(t, records[80], 1, 100, EndReasonIdleTimeout)
+
+	// Expired flows are not exported again.
+	if err := e.Export(nil, now); err != nil {
+		t.Fatalf("e.Export(_, _): %s", err)
+	}
+	if records := dataRecords(t, w.msgs[2], 4); len(records) != 0 {
+		t.Errorf("got %d records, want 0", len(records))
+	}
+}
+
+func TestExportSplitsMessages(t *testing.T) {
+	const maxMessageSize = 512
+	var w messageWriter
+	e, err := NewExporter(&w, Options{ObservationDomainID: 7, MaxMessageSize: maxMessageSize})
+	if err != nil {
+		t.Fatalf("NewExporter(_, _): %s", err)
+	}
+
+	var flows []stack.Flow
+	for i := 0; i < 20; i++ {
+		f := testFlow(1, 100)
+		f.Original.SrcPort += uint16(i)
+		f.Reply.DstPort += uint16(i)
+		f.Reply.Packets = 0
+		flows = append(flows, f)
+	}
+	if err := e.Export(flows, time.Unix(3, 0)); err != nil {
+		t.Fatalf("e.Export(_, _): %s", err)
+	}
+
+	var sequence uint32
+	for _, msg := range w.msgs {
+		if len(msg) > maxMessageSize {
+			t.Errorf("got message of %d bytes, want at most %d", len(msg), maxMessageSize)
+		}
+		sequence += uint32(len(dataRecords(t, msg, sequence)))
+	}
+	if sequence != uint32(len(flows)) {
+		t.Errorf("got %d records, want %d", sequence, len(flows))
+	}
+}
+
+func TestNewExporterInvalid(t *testing.T) {
+	if _, err := NewExporter(&messageWriter{}, Options{MaxMessageSize: 100}); err == nil {
+		t.Error("got NewExporter(_, {MaxMessageSize: 100}) = nil, want error")
+	}
+}
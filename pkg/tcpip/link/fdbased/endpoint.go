@@ -42,6 +42,7 @@ package fdbased
 import (
 	"fmt"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/binary"
@@ -131,6 +132,14 @@ type endpoint struct {
 	// disabled.
 	gsoMaxSize uint32
 
+	// vnetHdr is true if a virtio net header precedes each packet read from
+	// or written to the FDs.
+	vnetHdr bool
+
+	// busyPollBudget is the maximum time inbound dispatchers spin before
+	// blocking. It is zero if busy-polling is disabled.
+	busyPollBudget time.Duration
+
 	// wg keeps track of running goroutines.
 	wg sync.WaitGroup
 }
@@ -181,6 +190,21 @@ type Options struct {
 	// RXChecksumOffload if true, indicates that this endpoints capability
 	// set should include CapabilityRXChecksumOffload.
 	RXChecksumOffload bool
+
+	// NegotiateOffloads if true, indicates that the checksum and
+	// segmentation offloads should be negotiated with the host for each FD
+	// rather than taken from GSOMaxSize, TXChecksumOffload and
+	// RXChecksumOffload. GSOMaxSize, if non-zero, still bounds the size of
+	// GSO packets, and SoftwareGSOEnabled still enables software GSO when
+	// the host can't segment packets.
+	NegotiateOffloads bool
+
+	// BusyPollBudget, if non-zero, makes the Readv and RecvMMsg dispatchers
+	// spin on their FD for up to this long before blocking, trading CPU for
+	// lower wakeup latency. The actual budget adapts to how often spinning
+	// pays off and never exceeds BusyPollBudget. It is not supported with
+	// the PacketMMap dispatch mode.
+	BusyPollBudget time.Duration
 }
 
 // fanoutID is used for AF_PACKET based endpoints to enable PACKET_FANOUT
@@ -198,11 +222,11 @@ var fanoutID = 1
 // stopped being using and Wait returns).
 func New(opts *Options) (stack.LinkEndpoint, error) {
 	caps := stack.LinkEndpointCapabilities(0)
-	if opts.RXChecksumOffload {
+	if opts.RXChecksumOffload && !opts.NegotiateOffloads {
 		caps |= stack.CapabilityRXChecksumOffload
 	}
 
-	if opts.TXChecksumOffload {
+	if opts.TXChecksumOffload && !opts.NegotiateOffloads {
 		caps |= stack.CapabilityTXChecksumOffload
 	}
 
@@ -224,6 +248,16 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 		return nil, fmt.Errorf("opts.FD is empty, at least one FD must be specified")
 	}
 
+	if opts.BusyPollBudget != 0 && opts.PacketDispatchMode == PacketMMap {
+		return nil, fmt.Errorf("opts.BusyPollBudget is not supported with PacketMMap dispatch mode")
+	}
+
+	// Inbound frames are read into buffers shaped by BufConfig, so a frame of
+	// the full MTU must fit in them or it would be silently truncated.
+	if maxFrame := bufConfigSize(); int(opts.MTU)+hdrSize > maxFrame {
+		return nil, fmt.Errorf("opts.MTU %d is too large, frames are limited to %d bytes", opts.MTU, maxFrame)
+	}
+
 	e := &endpoint{
 		fds:                opts.FDs,
 		mtu:                opts.MTU,
@@ -232,9 +266,11 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 		addr:               opts.Address,
 		hdrSize:            hdrSize,
 		packetDispatchMode: opts.PacketDispatchMode,
+		busyPollBudget:     opts.BusyPollBudget,
 	}
 
 	// Create per channel dispatchers.
+	var negotiated offloads
 	for i := 0; i < len(e.fds); i++ {
 		fd := e.fds[i]
 		if err := syscall.SetNonblock(fd, true); err != nil {
@@ -245,12 +281,24 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 		if err != nil {
 			return nil, err
 		}
-		if isSocket {
+		if opts.NegotiateOffloads {
+			o, err := negotiateOffloads(fd, isSocket)
+			if err != nil {
+				return nil, fmt.Errorf("negotiateOffloads(%d, %t) = %v", fd, isSocket, err)
+			}
+			if i == 0 {
+				negotiated = o
+				e.applyOffloads(o, opts)
+			} else if o != negotiated {
+				return nil, fmt.Errorf("inconsistent offloads %+v and %+v negotiated for FDs of the same endpoint", negotiated, o)
+			}
+		} else if isSocket {
 			if opts.GSOMaxSize != 0 {
 				if opts.SoftwareGSOEnabled {
 					e.caps |= stack.CapabilitySoftwareGSO
 				} else {
 					e.caps |= stack.CapabilityHardwareGSO
+					e.vnetHdr = true
 				}
 				e.gsoMaxSize = opts.GSOMaxSize
 			}
@@ -269,6 +317,29 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 	return e, nil
 }
 
+// applyOffloads sets the endpoint's capabilities from the offloads o
+// negotiated with the host.
+func (e *endpoint) applyOffloads(o offloads, opts *Options) {
+	e.vnetHdr = o.vnetHdr
+	if o.csum {
+		e.caps |= stack.CapabilityTXChecksumOffload | stack.CapabilityRXChecksumOffload
+	}
+	// Hardware GSO applies to both TCP over IPv4 and IPv6, so the host must
+	// be able to segment both.
+	if o.tso4 && o.tso6 {
+		e.caps |= stack.CapabilityHardwareGSO
+		e.gsoMaxSize = opts.GSOMaxSize
+		if e.gsoMaxSize == 0 || e.gsoMaxSize > stack.SoftwareGSOMaxSize {
+			e.gsoMaxSize = stack.SoftwareGSOMaxSize
+		}
+		return
+	}
+	if opts.SoftwareGSOEnabled && opts.GSOMaxSize != 0 {
+		e.caps |= stack.CapabilitySoftwareGSO
+		e.gsoMaxSize = opts.GSOMaxSize
+	}
+}
+
 func createInboundDispatcher(e *endpoint, fd int, isSocket bool) (linkDispatcher, error) {
 	// By default use the readv() dispatcher as it works with all kinds of
 	// FDs (tap/tun/unix domain sockets and af_packet).
@@ -406,6 +477,34 @@ func (e *endpoint) AddHeader(local, remote tcpip.LinkAddress, protocol tcpip.Net
 	}
 }
 
+// virtioNetHdrFor returns the virtio net header describing pkt, which is
+// written with the GSO options gso. If the packet is encapsulated, the
+// encapsulation headers are skipped when locating the checksum.
+func virtioNetHdrFor(gso *stack.GSO, pkt *stack.PacketBuffer) virtioNetHdr {
+	vnetHdr := virtioNetHdr{}
+	if gso == nil {
+		return vnetHdr
+	}
+	vnetHdr.hdrLen = uint16(pkt.HeaderSize())
+	if gso.NeedsCsum {
+		vnetHdr.flags = _VIRTIO_NET_HDR_F_NEEDS_CSUM
+		vnetHdr.csumStart = header.EthernetMinimumSize + gso.EncapHdrLen + gso.L3HdrLen
+		vnetHdr.csumOffset = gso.CsumOffset
+	}
+	if gso.Type != stack.GSONone && pkt.Data.Size() > int(gso.MSS) {
+		switch gso.Type {
+		case stack.GSOTCPv4:
+			vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
+		case stack.GSOTCPv6:
+			vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
+		default:
+			panic(fmt.Sprintf("Unknown gso type: %v", gso.Type))
+		}
+		vnetHdr.gsoSize = gso.MSS
+	}
+	return vnetHdr
+}
+
 // WritePacket writes outbound packets to the file descriptor. If it is not
 // currently writable, the packet is dropped.
 func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
@@ -416,28 +515,8 @@ func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, protocol tcpip.Ne
 	var builder iovec.Builder
 
 	fd := e.fds[pkt.Hash%uint32(len(e.fds))]
-	if e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-		vnetHdr := virtioNetHdr{}
-		if gso != nil {
-			vnetHdr.hdrLen = uint16(pkt.HeaderSize())
-			if gso.NeedsCsum {
-				vnetHdr.flags = _VIRTIO_NET_HDR_F_NEEDS_CSUM
-				vnetHdr.csumStart = header.EthernetMinimumSize + gso.L3HdrLen
-				vnetHdr.csumOffset = gso.CsumOffset
-			}
-			if gso.Type != stack.GSONone && uint16(pkt.Data.Size()) > gso.MSS {
-				switch gso.Type {
-				case stack.GSOTCPv4:
-					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
-				case stack.GSOTCPv6:
-					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
-				default:
-					panic(fmt.Sprintf("Unknown gso type: %v", gso.Type))
-				}
-				vnetHdr.gsoSize = gso.MSS
-			}
-		}
-
+	if e.vnetHdr {
+		vnetHdr := virtioNetHdrFor(gso, pkt)
 		vnetHdrBuf := binary.Marshal(make([]byte, 0, virtioNetHdrSize), binary.LittleEndian, vnetHdr)
 		builder.Add(vnetHdrBuf)
 	}
@@ -457,27 +536,8 @@ func (e *endpoint) sendBatch(batchFD int, batch []*stack.PacketBuffer) (int, *tc
 		}
 
 		var vnetHdrBuf []byte
-		if e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-			vnetHdr := virtioNetHdr{}
-			if pkt.GSOOptions != nil {
-				vnetHdr.hdrLen = uint16(pkt.HeaderSize())
-				if pkt.GSOOptions.NeedsCsum {
-					vnetHdr.flags = _VIRTIO_NET_HDR_F_NEEDS_CSUM
-					vnetHdr.csumStart = header.EthernetMinimumSize + pkt.GSOOptions.L3HdrLen
-					vnetHdr.csumOffset = pkt.GSOOptions.CsumOffset
-				}
-				if pkt.GSOOptions.Type != stack.GSONone && uint16(pkt.Data.Size()) > pkt.GSOOptions.MSS {
-					switch pkt.GSOOptions.Type {
-					case stack.GSOTCPv4:
-						vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
-					case stack.GSOTCPv6:
-						vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
-					default:
-						panic(fmt.Sprintf("Unknown gso type: %v", pkt.GSOOptions.Type))
-					}
-					vnetHdr.gsoSize = pkt.GSOOptions.MSS
-				}
-			}
+		if e.vnetHdr {
+			vnetHdr := virtioNetHdrFor(pkt.GSOOptions, pkt)
 			vnetHdrBuf = binary.Marshal(make([]byte, 0, virtioNetHdrSize), binary.LittleEndian, vnetHdr)
 		}
 
@@ -582,6 +642,13 @@ func (e *endpoint) GSOMaxSize() uint32 {
 	return e.gsoMaxSize
 }
 
+// SupportsGSOEncap implements stack.GSOEncapEndpoint.SupportsGSOEncap. The
+// host segments VLAN tagged packets, but the virtio net header can't describe
+// tunnels, so tunneled packets must be segmented before encapsulation.
+func (e *endpoint) SupportsGSOEncap(typ stack.GSOEncapType) bool {
+	return typ == stack.GSOEncapNone || typ == stack.GSOEncapVLAN
+}
+
 // ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
 func (e *endpoint) ARPHardwareType() header.ARPHardwareType {
 	if e.hdrSize > 0 {
@@ -165,6 +165,32 @@ func TestEthernetProperties(t *testing.T) {
 	}
 }
 
+func TestNegotiateOffloadsWithoutVnetHdr(t *testing.T) {
+	for _, softwareGSO := range []bool{false, true} {
+		t.Run(fmt.Sprintf("SoftwareGSOEnabled: %t", softwareGSO), func(t *testing.T) {
+			// The FDs are unix domain sockets, which can't carry a
+			// virtio net header, so no offloads must be negotiated.
+			c := newContext(t, &Options{
+				MTU:                mtu,
+				GSOMaxSize:         stack.SoftwareGSOMaxSize,
+				SoftwareGSOEnabled: softwareGSO,
+				TXChecksumOffload:  true,
+				RXChecksumOffload:  true,
+				NegotiateOffloads:  true,
+			})
+			defer c.cleanup()
+
+			caps := c.ep.Capabilities()
+			if got := caps & (stack.CapabilityTXChecksumOffload | stack.CapabilityRXChecksumOffload | stack.CapabilityHardwareGSO); got != 0 {
+				t.Errorf("got Capabilities() = %b, want none of %b", caps, got)
+			}
+			if got := caps&stack.CapabilitySoftwareGSO != 0; got != softwareGSO {
+				t.Errorf("got Capabilities()&CapabilitySoftwareGSO != 0 = %t, want = %t", got, softwareGSO)
+			}
+		})
+	}
+}
+
 func TestAddress(t *testing.T) {
 	addrs := []tcpip.LinkAddress{"", "abc", "def"}
 	for _, a := range addrs {
@@ -423,6 +449,19 @@ func TestBufConfigMaxLength(t *testing.T) {
 	}
 }
 
+func TestMTUTooLarge(t *testing.T) {
+	for _, ethHeader := range []bool{true, false} {
+		opts := Options{
+			FDs:            []int{-1}, // fd does not matter for this test.
+			MTU:            uint32(bufConfigSize()) + 1,
+			EthernetHeader: ethHeader,
+		}
+		if _, err := New(&opts); err == nil {
+			t.Errorf("got New(%+v) = nil error, want non-nil", opts)
+		}
+	}
+}
+
 func TestBufConfigFirst(t *testing.T) {
 	// The stack assumes that the TCP/IP header is enterily contained in the first view.
 	// Therefore, the first view needs to be large enough to contain the maximum TCP/IP
@@ -475,20 +514,19 @@ func TestReadVDispatcherCapLength(t *testing.T) {
 	for _, c := range capLengthTestCases {
 		// fd does not matter for this test.
 		d := readVDispatcher{fd: -1, e: &endpoint{}}
-		d.views = make([]buffer.View, len(c.config))
-		d.iovecs = make([]syscall.Iovec, len(c.config))
-		d.allocateViews(c.config)
-
-		used := d.capViews(c.n, c.config)
-		if used != c.wantUsed {
-			t.Errorf("Test %q failed when calling capViews(%d, %v). Got %d. Want %d", c.comment, c.n, c.config, used, c.wantUsed)
-		}
-		lengths := make([]int, len(d.views))
-		for i, v := range d.views {
-			lengths[i] = len(v)
+		d.buf = newIovecBuffer(c.config, false /* skipsVnetHdr */)
+		// Hand off packets of any size by reference.
+		d.buf.copybreak = 0
+		d.buf.nextIovecs()
+
+		vv := d.buf.pullViews(c.n)
+		views := vv.Views()
+		if used := len(views); used != c.wantUsed {
+			t.Errorf("Test %q failed when calling pullViews(%d) with %v. Got %d. Want %d", c.comment, c.n, c.config, used, c.wantUsed)
 		}
+		lengths := viewLengths(views, d.buf.views[len(views):])
 		if !reflect.DeepEqual(lengths, c.wantLengths) {
-			t.Errorf("Test %q failed when calling capViews(%d, %v). Got %v. Want %v", c.comment, c.n, c.config, lengths, c.wantLengths)
+			t.Errorf("Test %q failed when calling pullViews(%d) with %v. Got %v. Want %v", c.comment, c.n, c.config, lengths, c.wantLengths)
 		}
 	}
 }
@@ -498,36 +536,85 @@ func TestRecvMMsgDispatcherCapLength(t *testing.T) {
 		d := recvMMsgDispatcher{
 			fd:      -1, // fd does not matter for this test.
 			e:       &endpoint{},
-			views:   make([][]buffer.View, 1),
-			iovecs:  make([][]syscall.Iovec, 1),
+			bufs:    []*iovecBuffer{newIovecBuffer(c.config, false /* skipsVnetHdr */)},
 			msgHdrs: make([]rawfile.MMsgHdr, 1),
 		}
 
-		for i, _ := range d.views {
-			d.views[i] = make([]buffer.View, len(c.config))
-		}
-		for i := range d.iovecs {
-			d.iovecs[i] = make([]syscall.Iovec, len(c.config))
+		for k := range d.msgHdrs {
+			// Hand off packets of any size by reference.
+			d.bufs[k].copybreak = 0
+			iovecs := d.bufs[k].nextIovecs()
+			d.msgHdrs[k].Msg.Iov = &iovecs[0]
+			d.msgHdrs[k].Msg.Iovlen = uint64(len(iovecs))
 		}
-		for k, msgHdr := range d.msgHdrs {
-			msgHdr.Msg.Iov = &d.iovecs[k][0]
-			msgHdr.Msg.Iovlen = uint64(len(c.config))
-		}
-
-		d.allocateViews(c.config)
 
-		used := d.capViews(0, c.n, c.config)
-		if used != c.wantUsed {
-			t.Errorf("Test %q failed when calling capViews(%d, %v). Got %d. Want %d", c.comment, c.n, c.config, used, c.wantUsed)
-		}
-		lengths := make([]int, len(d.views[0]))
-		for i, v := range d.views[0] {
-			lengths[i] = len(v)
+		vv := d.bufs[0].pullViews(c.n)
+		views := vv.Views()
+		if used := len(views); used != c.wantUsed {
+			t.Errorf("Test %q failed when calling pullViews(%d) with %v. Got %d. Want %d", c.comment, c.n, c.config, used, c.wantUsed)
 		}
+		lengths := viewLengths(views, d.bufs[0].views[len(views):])
 		if !reflect.DeepEqual(lengths, c.wantLengths) {
-			t.Errorf("Test %q failed when calling capViews(%d, %v). Got %v. Want %v", c.comment, c.n, c.config, lengths, c.wantLengths)
+			t.Errorf("Test %q failed when calling pullViews(%d) with %v. Got %v. Want %v", c.comment, c.n, c.config, lengths, c.wantLengths)
 		}
+	}
+}
+
+// viewLengths returns the lengths of the views handed off with a packet,
+// followed by those of the views left in the buffer.
+func viewLengths(handedOff, left []buffer.View) []int {
+	var lengths []int
+	for _, v := range handedOff {
+		lengths = append(lengths, len(v))
+	}
+	for _, v := range left {
+		lengths = append(lengths, len(v))
+	}
+	return lengths
+}
 
+func TestIovecBufferCopybreak(t *testing.T) {
+	config := []int{4, 8, 16}
+	for _, skipsVnetHdr := range []bool{false, true} {
+		for _, n := range []int{1, 4, 10, 11, 28} {
+			b := newIovecBuffer(config, skipsVnetHdr)
+			b.copybreak = 10
+			b.nextIovecs()
+			orig := append([]buffer.View(nil), b.views...)
+			for i, v := range b.views {
+				for j := range v {
+					v[j] = byte(i*16 + j)
+				}
+			}
+			var want buffer.View
+			for _, v := range orig {
+				want = append(want, v...)
+			}
+			want = want[:n]
+
+			read := n
+			if skipsVnetHdr {
+				read += virtioNetHdrSize
+			}
+			vv := b.pullViews(read)
+			if got := vv.ToView(); !bytes.Equal(got, want) {
+				t.Errorf("n=%d skipsVnetHdr=%t: got pullViews(%d) = %v, want = %v", n, skipsVnetHdr, read, got, want)
+			}
+
+			copied := n <= b.copybreak
+			if copied {
+				// The packet is copied into a single view of its size, and
+				// the buffer's views are kept for the next packet.
+				if views := vv.Views(); len(views) != 1 || cap(views[0]) != n {
+					t.Errorf("n=%d skipsVnetHdr=%t: got %d views with cap(views[0]) = %d, want a single view with cap %d", n, skipsVnetHdr, len(views), cap(views[0]), n)
+				}
+			}
+			for i, v := range b.views {
+				if kept := v != nil && &v[0] == &orig[i][0]; kept != (copied || i >= len(vv.Views())) {
+					t.Errorf("n=%d skipsVnetHdr=%t: got view %d kept = %t, want = %t", n, skipsVnetHdr, i, kept, !kept)
+				}
+			}
+		}
 	}
 }
 
@@ -546,8 +633,9 @@ func (d *fakeNetworkDispatcher) DeliverOutboundPacket(remote, local tcpip.LinkAd
 
 func TestDispatchPacketFormat(t *testing.T) {
 	for _, test := range []struct {
-		name          string
-		newDispatcher func(fd int, e *endpoint) (linkDispatcher, error)
+		name           string
+		newDispatcher  func(fd int, e *endpoint) (linkDispatcher, error)
+		busyPollBudget time.Duration
 	}{
 		{
 			name:          "readVDispatcher",
@@ -557,6 +645,16 @@ func TestDispatchPacketFormat(t *testing.T) {
 			name:          "recvMMsgDispatcher",
 			newDispatcher: newRecvMMsgDispatcher,
 		},
+		{
+			name:           "readVDispatcherBusyPoll",
+			newDispatcher:  newReadVDispatcher,
+			busyPollBudget: time.Millisecond,
+		},
+		{
+			name:           "recvMMsgDispatcherBusyPoll",
+			newDispatcher:  newRecvMMsgDispatcher,
+			busyPollBudget: time.Millisecond,
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			// Create a socket pair to send/recv.
@@ -583,8 +681,9 @@ func TestDispatchPacketFormat(t *testing.T) {
 			// Create and run dispatcher once.
 			sink := &fakeNetworkDispatcher{}
 			d, err := test.newDispatcher(fds[0], &endpoint{
-				hdrSize:    header.EthernetMinimumSize,
-				dispatcher: sink,
+				hdrSize:        header.EthernetMinimumSize,
+				dispatcher:     sink,
+				busyPollBudget: test.busyPollBudget,
 			})
 			if err != nil {
 				t.Fatal(err)
@@ -607,3 +706,131 @@ func TestDispatchPacketFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestBusyPollerBudget(t *testing.T) {
+	const max = 64 * time.Microsecond
+	p := newBusyPoller(max)
+	for i := 0; i < 10; i++ {
+		p.miss()
+	}
+	if p.budget != 0 {
+		t.Errorf("budget after misses = %s, want 0", p.budget)
+	}
+	p.hit()
+	if got, want := p.budget, busyPollMinBudget; got != want {
+		t.Errorf("budget after hit = %s, want %s", got, want)
+	}
+	p.hit()
+	if got, want := p.budget, 2*busyPollMinBudget; got != want {
+		t.Errorf("budget after second hit = %s, want %s", got, want)
+	}
+	for i := 0; i < 10; i++ {
+		p.hit()
+	}
+	if got, want := p.budget, max; got != want {
+		t.Errorf("budget after hits = %s, want %s", got, want)
+	}
+}
+
+func TestBusyPollerDisabled(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syscall.Write(fds[1], []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A disabled poller never starts spinning, even if data shows up right
+	// away.
+	p := newBusyPoller(0)
+	b := make([]byte, 16)
+	iovecs := []syscall.Iovec{{Base: &b[0]}}
+	iovecs[0].SetLen(len(b))
+	if n, err := p.readv(fds[0], iovecs); err != nil || n != 3 {
+		t.Fatalf("p.readv(...) = (%d, %v), want (3, nil)", n, err)
+	}
+	if p.budget != 0 {
+		t.Errorf("budget of disabled poller = %s, want 0", p.budget)
+	}
+}
+
+func TestBusyPollerRestartsSpinning(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syscall.Write(fds[1], []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// With a zero budget, data that shows up well within the configured
+	// budget of blocking makes the poller spin again.
+	p := newBusyPoller(time.Hour)
+	p.budget = 0
+	b := make([]byte, 16)
+	iovecs := []syscall.Iovec{{Base: &b[0]}}
+	iovecs[0].SetLen(len(b))
+	if n, err := p.readv(fds[0], iovecs); err != nil || n != 3 {
+		t.Fatalf("p.readv(...) = (%d, %v), want (3, nil)", n, err)
+	}
+	if got, want := p.budget, busyPollMinBudget; got != want {
+		t.Errorf("budget = %s, want %s", got, want)
+	}
+}
+
+func TestBusyPollPacketMMapUnsupported(t *testing.T) {
+	if _, err := New(&Options{
+		FDs:                []int{-1}, // fd does not matter for this test.
+		MTU:                1500,
+		PacketDispatchMode: PacketMMap,
+		BusyPollBudget:     time.Millisecond,
+	}); err == nil {
+		t.Errorf("got New(...) with BusyPollBudget and PacketMMap = nil error, want non-nil")
+	}
+}
+
+func TestBusyPollerFallsBackToBlocking(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Send only after the poller has given up spinning, so that the read
+	// completes in the blocking path.
+	const budget = time.Millisecond
+	go func() {
+		time.Sleep(10 * budget)
+		syscall.Write(fds[1], []byte{1, 2, 3})
+	}()
+
+	p := newBusyPoller(budget)
+	b := make([]byte, 16)
+	iovecs := []syscall.Iovec{{Base: &b[0]}}
+	iovecs[0].SetLen(len(b))
+	n, tcpErr := p.readv(fds[0], iovecs)
+	if tcpErr != nil {
+		t.Fatalf("p.readv(...) = %s", tcpErr)
+	}
+	if n != 3 {
+		t.Fatalf("p.readv(...) read %d bytes, want 3", n)
+	}
+	if got, want := p.budget, budget/2; got != want {
+		t.Errorf("budget = %s, want %s", got, want)
+	}
+}
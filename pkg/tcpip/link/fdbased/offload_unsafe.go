@@ -0,0 +1,119 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package fdbased
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants from <linux/if_tun.h> and <linux/if_packet.h>.
+const (
+	_TUNGETIFF     = 0x800454d2
+	_TUNSETOFFLOAD = 0x400454d0
+
+	_IFF_VNET_HDR = 0x4000
+
+	_TUN_F_CSUM = 0x01
+	_TUN_F_TSO4 = 0x02
+	_TUN_F_TSO6 = 0x04
+	_TUN_F_UFO  = 0x10
+
+	_PACKET_VNET_HDR = 15
+)
+
+// offloads are the virtio net header features negotiated with the host for
+// an FD.
+type offloads struct {
+	// vnetHdr is true if a virtio net header precedes each packet.
+	vnetHdr bool
+
+	// csum is true if packets may carry partial checksums, as described by
+	// the virtio net header.
+	csum bool
+
+	// tso4 and tso6 are true if TCP packets larger than the MTU may be
+	// exchanged and segmented by the host.
+	tso4 bool
+	tso6 bool
+
+	// ufo is true if UDP packets larger than the MTU may be received from
+	// the host unfragmented.
+	ufo bool
+}
+
+// tunOffloadFlags are the offloads requested from tap devices, in order of
+// preference. Linux no longer supports UFO, and may not support TSO, so
+// smaller sets are tried when the host rejects a larger one.
+var tunOffloadFlags = []uint32{
+	_TUN_F_CSUM | _TUN_F_TSO4 | _TUN_F_TSO6 | _TUN_F_UFO,
+	_TUN_F_CSUM | _TUN_F_TSO4 | _TUN_F_TSO6,
+	_TUN_F_CSUM,
+}
+
+// negotiateOffloads negotiates the offloads of fd with the host.
+//
+// AF_PACKET sockets use a virtio net header if PACKET_VNET_HDR was set on them,
+// in which case the host accepts and segments GSO packets and handles partial
+// checksums on its own. Tap devices use one if they were created with
+// IFF_VNET_HDR, and are told with TUNSETOFFLOAD which offloads the endpoint
+// accepts from them.
+func negotiateOffloads(fd int, isSocket bool) (offloads, error) {
+	if isSocket {
+		v, err := syscall.GetsockoptInt(fd, syscall.SOL_PACKET, _PACKET_VNET_HDR)
+		if err != nil {
+			// Not an AF_PACKET socket, so no offloads are possible.
+			return offloads{}, nil
+		}
+		if v == 0 {
+			return offloads{}, nil
+		}
+		return offloads{vnetHdr: true, csum: true, tso4: true, tso6: true}, nil
+	}
+
+	var ifr struct {
+		name  [unix.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), _TUNGETIFF, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		// Not a tap device, so no offloads are possible.
+		return offloads{}, nil
+	}
+	if ifr.flags&_IFF_VNET_HDR == 0 {
+		return offloads{}, nil
+	}
+	o := offloads{vnetHdr: true}
+	for _, flags := range tunOffloadFlags {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), _TUNSETOFFLOAD, uintptr(flags))
+		if errno == syscall.EINVAL {
+			continue
+		}
+		if errno != 0 {
+			return offloads{}, fmt.Errorf("TUNSETOFFLOAD(%#x) failed: %v", flags, errno)
+		}
+		o.csum = flags&_TUN_F_CSUM != 0
+		o.tso4 = flags&_TUN_F_TSO4 != 0
+		o.tso6 = flags&_TUN_F_TSO6 != 0
+		o.ufo = flags&_TUN_F_UFO != 0
+		break
+	}
+	return o, nil
+}
@@ -18,6 +18,7 @@ package fdbased
 
 import (
 	"syscall"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
@@ -29,102 +30,149 @@ import (
 // BufConfig defines the shape of the vectorised view used to read packets from the NIC.
 var BufConfig = []int{128, 256, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
 
-// readVDispatcher uses readv() system call to read inbound packets and
-// dispatches them.
-type readVDispatcher struct {
-	// fd is the file descriptor used to send and receive packets.
-	fd int
+// bufConfigSize returns the largest frame that can be read into buffers
+// shaped by BufConfig.
+func bufConfigSize() int {
+	size := 0
+	for _, s := range BufConfig {
+		size += s
+	}
+	return size
+}
 
-	// e is the endpoint this dispatcher is attached to.
-	e *endpoint
+// defaultCopybreak is the size up to which packets are copied out of an
+// iovecBuffer rather than handed off by reference.
+const defaultCopybreak = 256
 
+// iovecBuffer is a set of views, with the iovecs that point at them, that
+// packets are read into. Once a packet has been read, the views holding it are
+// handed off by reference to the packet, and only those views are replaced
+// before the next read, so received frames reach the stack without being
+// copied.
+//
+// Each view is allocated on its own, so that a handed off view only keeps its
+// own memory alive. Packets of up to copybreak bytes are copied into a view of
+// their exact size instead: this is cheap, and keeps small packets, which may
+// be queued for a long time, from pinning buffers much larger than themselves.
+type iovecBuffer struct {
 	// views are the actual buffers that hold the packet contents.
 	views []buffer.View
 
 	// iovecs are initialized with base pointers/len of the corresponding
-	// entries in the views defined above, except when GSO is enabled then
-	// the first iovec points to a buffer for the vnet header which is
-	// stripped before the views are passed up the stack for further
-	// processing.
+	// entries in the views defined above, except when skipsVnetHdr is set
+	// in which case the first iovec points to vnetHdr.
 	iovecs []syscall.Iovec
+
+	// sizes is the size of each view.
+	sizes []int
+
+	// skipsVnetHdr is true if a virtio net header precedes each packet. It
+	// is read into vnetHdr and not handed off with the packet.
+	skipsVnetHdr bool
+
+	// vnetHdr holds the virtio net header of the last packet read. Its
+	// contents are never used.
+	vnetHdr [virtioNetHdrSize]byte
+
+	// copybreak is the size up to which packets are copied out rather than
+	// handed off.
+	copybreak int
 }
 
-func newReadVDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
-	d := &readVDispatcher{fd: fd, e: e}
-	d.views = make([]buffer.View, len(BufConfig))
-	iovLen := len(BufConfig)
-	if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-		iovLen++
+func newIovecBuffer(sizes []int, skipsVnetHdr bool) *iovecBuffer {
+	b := &iovecBuffer{
+		views:        make([]buffer.View, len(sizes)),
+		sizes:        sizes,
+		skipsVnetHdr: skipsVnetHdr,
+		copybreak:    defaultCopybreak,
 	}
-	d.iovecs = make([]syscall.Iovec, iovLen)
-	return d, nil
+	niov := len(b.views)
+	if b.skipsVnetHdr {
+		niov++
+	}
+	b.iovecs = make([]syscall.Iovec, niov)
+	if b.skipsVnetHdr {
+		// The kernel adds virtioNetHdr before each packet, but we don't use
+		// it, so we read it into a buffer that isn't part of any view.
+		b.iovecs[0] = syscall.Iovec{
+			Base: &b.vnetHdr[0],
+			Len:  uint64(virtioNetHdrSize),
+		}
+	}
+	return b
 }
 
-func (d *readVDispatcher) allocateViews(bufConfig []int) {
-	var vnetHdr [virtioNetHdrSize]byte
+// nextIovecs returns the iovecs to read the next packet into, replacing any
+// views that were handed off by the last call to pullViews.
+func (b *iovecBuffer) nextIovecs() []syscall.Iovec {
 	vnetHdrOff := 0
-	if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-		// The kernel adds virtioNetHdr before each packet, but
-		// we don't use it, so so we allocate a buffer for it,
-		// add it in iovecs but don't add it in a view.
-		d.iovecs[0] = syscall.Iovec{
-			Base: &vnetHdr[0],
-			Len:  uint64(virtioNetHdrSize),
-		}
+	if b.skipsVnetHdr {
 		vnetHdrOff++
 	}
-	for i := 0; i < len(bufConfig); i++ {
-		if d.views[i] != nil {
+	for i := range b.views {
+		if b.views[i] != nil {
 			break
 		}
-		b := buffer.NewView(bufConfig[i])
-		d.views[i] = b
-		d.iovecs[i+vnetHdrOff] = syscall.Iovec{
-			Base: &b[0],
-			Len:  uint64(len(b)),
+		v := buffer.NewView(b.sizes[i])
+		b.views[i] = v
+		b.iovecs[i+vnetHdrOff] = syscall.Iovec{
+			Base: &v[0],
+			Len:  uint64(len(v)),
 		}
 	}
+	return b.iovecs
 }
 
-func (d *readVDispatcher) capViews(n int, buffers []int) int {
+// pullViews hands off the views holding a packet of n bytes, as returned by
+// the read that filled the iovecs, to the caller. The returned views are no
+// longer referenced by b.
+func (b *iovecBuffer) pullViews(n int) buffer.VectorisedView {
+	if b.skipsVnetHdr {
+		// Skip virtioNetHdr which is added before each packet, it isn't used
+		// and it isn't in a view.
+		n -= virtioNetHdrSize
+	}
+	if n <= 0 {
+		return buffer.VectorisedView{}
+	}
+	if n <= b.copybreak {
+		// Copy the packet out, leaving b.views in place for the next one.
+		v := buffer.NewView(n)
+		for i, c := 0, 0; c < n; i++ {
+			c += copy(v[c:], b.views[i])
+		}
+		return v.ToVectorisedView()
+	}
+	used := len(b.views)
 	c := 0
-	for i, s := range buffers {
-		c += s
+	for i, v := range b.views {
+		c += len(v)
 		if c >= n {
-			d.views[i].CapLength(s - (c - n))
-			return i + 1
+			b.views[i].CapLength(len(v) - (c - n))
+			used = i + 1
+			break
 		}
 	}
-	return len(buffers)
-}
-
-// dispatch reads one packet from the file descriptor and dispatches it.
-func (d *readVDispatcher) dispatch() (bool, *tcpip.Error) {
-	d.allocateViews(BufConfig)
-
-	n, err := rawfile.BlockingReadv(d.fd, d.iovecs)
-	if n == 0 || err != nil {
-		return false, err
-	}
-	if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-		// Skip virtioNetHdr which is added before each packet, it
-		// isn't used and it isn't in a view.
-		n -= virtioNetHdrSize
+	views := append([]buffer.View(nil), b.views[:used]...)
+	// Prepare b.views for another packet: release used views.
+	for i := 0; i < used; i++ {
+		b.views[i] = nil
 	}
+	return buffer.NewVectorisedView(n, views)
+}
 
-	used := d.capViews(n, BufConfig)
-	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
-		Data: buffer.NewVectorisedView(n, append([]buffer.View(nil), d.views[:used]...)),
-	})
-
+// deliverPacket parses the link header of a packet read from the file
+// descriptor and delivers it to the network-layer dispatcher. It returns
+// false if the packet is too short to contain a link header.
+func (e *endpoint) deliverPacket(pkt *stack.PacketBuffer) bool {
 	var (
 		p             tcpip.NetworkProtocolNumber
 		remote, local tcpip.LinkAddress
 	)
-	if d.e.hdrSize > 0 {
-		hdr, ok := pkt.LinkHeader().Consume(d.e.hdrSize)
+	if e.hdrSize > 0 {
+		hdr, ok := pkt.LinkHeader().Consume(e.hdrSize)
 		if !ok {
-			return false, nil
+			return false
 		}
 		eth := header.Ethernet(hdr)
 		p = eth.Type()
@@ -133,24 +181,144 @@ func (d *readVDispatcher) dispatch() (bool, *tcpip.Error) {
 	} else {
 		// We don't get any indication of what the packet is, so try to guess
 		// if it's an IPv4 or IPv6 packet.
-		switch header.IPVersion(d.views[0]) {
+		switch header.IPVersion(pkt.Data.First()) {
 		case header.IPv4Version:
 			p = header.IPv4ProtocolNumber
 		case header.IPv6Version:
 			p = header.IPv6ProtocolNumber
 		default:
-			return true, nil
+			return true
 		}
 	}
 
-	d.e.dispatcher.DeliverNetworkPacket(remote, local, p, pkt)
+	e.dispatcher.DeliverNetworkPacket(remote, local, p, pkt)
+	return true
+}
+
+// busyPollMinBudget is the smallest spin budget of a busyPoller. Budgets
+// that would fall below it are dropped to zero.
+const busyPollMinBudget = time.Microsecond
+
+// busyPoller implements adaptive busy-polling for inbound dispatchers. Before
+// blocking in poll(), it retries non-blocking reads for up to its current
+// budget. The budget doubles (up to the configured maximum) every time data
+// shows up while spinning and halves every time it doesn't, dropping to zero
+// so that idle channels stop burning CPU altogether. While the budget is zero,
+// data showing up within the configured maximum of blocking restarts
+// spinning.
+type busyPoller struct {
+	// max is the configured budget. Busy-polling is disabled if it is zero.
+	max time.Duration
+
+	// budget is the current budget.
+	budget time.Duration
+}
 
-	// Prepare e.views for another packet: release used views.
-	for i := 0; i < used; i++ {
-		d.views[i] = nil
+func newBusyPoller(max time.Duration) busyPoller {
+	return busyPoller{max: max, budget: max}
+}
+
+// hit records that data was read while spinning, or soon enough after
+// blocking that spinning would have caught it.
+func (p *busyPoller) hit() {
+	if p.budget == 0 {
+		p.budget = busyPollMinBudget
+	} else {
+		p.budget *= 2
+	}
+	if p.budget > p.max {
+		p.budget = p.max
+	}
+}
+
+// miss records that the budget elapsed without data being read.
+func (p *busyPoller) miss() {
+	if p.budget /= 2; p.budget < busyPollMinBudget {
+		p.budget = 0
 	}
+}
 
-	return true, nil
+// poll calls nonBlocking until it returns data, fails with an error other
+// than EAGAIN, or the budget elapses, and then falls back to blocking.
+func (p *busyPoller) poll(nonBlocking func() (int, syscall.Errno), blocking func() (int, *tcpip.Error)) (int, *tcpip.Error) {
+	if p.max == 0 {
+		return blocking()
+	}
+	start := time.Now()
+	if p.budget > 0 {
+		for {
+			n, e := nonBlocking()
+			if e == 0 {
+				p.hit()
+				return n, nil
+			}
+			if e != syscall.EAGAIN {
+				return 0, rawfile.TranslateErrno(e)
+			}
+			if time.Since(start) >= p.budget {
+				p.miss()
+				return blocking()
+			}
+		}
+	}
+	n, err := blocking()
+	if err == nil && time.Since(start) < p.max {
+		p.hit()
+	}
+	return n, err
+}
+
+// readv is like rawfile.BlockingReadv, but busy-polls before blocking.
+func (p *busyPoller) readv(fd int, iovecs []syscall.Iovec) (int, *tcpip.Error) {
+	return p.poll(func() (int, syscall.Errno) {
+		return rawfile.NonBlockingReadv(fd, iovecs)
+	}, func() (int, *tcpip.Error) {
+		return rawfile.BlockingReadv(fd, iovecs)
+	})
+}
+
+// recvMMsg is like rawfile.BlockingRecvMMsg, but busy-polls before blocking.
+func (p *busyPoller) recvMMsg(fd int, msgHdrs []rawfile.MMsgHdr) (int, *tcpip.Error) {
+	return p.poll(func() (int, syscall.Errno) {
+		return rawfile.NonBlockingRecvMMsg(fd, msgHdrs)
+	}, func() (int, *tcpip.Error) {
+		return rawfile.BlockingRecvMMsg(fd, msgHdrs)
+	})
+}
+
+// readVDispatcher uses readv() system call to read inbound packets and
+// dispatches them.
+type readVDispatcher struct {
+	// fd is the file descriptor used to send and receive packets.
+	fd int
+
+	// e is the endpoint this dispatcher is attached to.
+	e *endpoint
+
+	// buf is the iovec buffer that contains the packet contents.
+	buf *iovecBuffer
+
+	// poller busy-polls fd before blocking, if enabled.
+	poller busyPoller
+}
+
+func newReadVDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
+	d := &readVDispatcher{fd: fd, e: e, poller: newBusyPoller(e.busyPollBudget)}
+	d.buf = newIovecBuffer(BufConfig, d.e.vnetHdr)
+	return d, nil
+}
+
+// dispatch reads one packet from the file descriptor and dispatches it.
+func (d *readVDispatcher) dispatch() (bool, *tcpip.Error) {
+	n, err := d.poller.readv(d.fd, d.buf.nextIovecs())
+	if n == 0 || err != nil {
+		return false, err
+	}
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: d.buf.pullViews(n),
+	})
+	return d.e.deliverPacket(pkt), nil
 }
 
 // recvMMsgDispatcher uses the recvmmsg system call to read inbound packets and
@@ -162,21 +330,17 @@ type recvMMsgDispatcher struct {
 	// e is the endpoint this dispatcher is attached to.
 	e *endpoint
 
-	// views is an array of array of buffers that contain packet contents.
-	views [][]buffer.View
-
-	// iovecs is an array of array of iovec records where each iovec base
-	// pointer and length are initialzed to the corresponding view above,
-	// except when GSO is enabled then the first iovec in each array of
-	// iovecs points to a buffer for the vnet header which is stripped
-	// before the views are passed up the stack for further processing.
-	iovecs [][]syscall.Iovec
+	// bufs is an array of iovec buffers that contain packet contents.
+	bufs []*iovecBuffer
 
 	// msgHdrs is an array of MMsgHdr objects where each MMsghdr is used to
 	// reference an array of iovecs in the iovecs field defined above.  This
 	// array is passed as the parameter to recvmmsg call to retrieve
 	// potentially more than 1 packet per syscall.
 	msgHdrs []rawfile.MMsgHdr
+
+	// poller busy-polls fd before blocking, if enabled.
+	poller busyPoller
 }
 
 const (
@@ -187,128 +351,52 @@ const (
 
 func newRecvMMsgDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
 	d := &recvMMsgDispatcher{
-		fd: fd,
-		e:  e,
-	}
-	d.views = make([][]buffer.View, MaxMsgsPerRecv)
-	for i := range d.views {
-		d.views[i] = make([]buffer.View, len(BufConfig))
-	}
-	d.iovecs = make([][]syscall.Iovec, MaxMsgsPerRecv)
-	iovLen := len(BufConfig)
-	if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-		// virtioNetHdr is prepended before each packet.
-		iovLen++
-	}
-	for i := range d.iovecs {
-		d.iovecs[i] = make([]syscall.Iovec, iovLen)
+		fd:      fd,
+		e:       e,
+		bufs:    make([]*iovecBuffer, MaxMsgsPerRecv),
+		msgHdrs: make([]rawfile.MMsgHdr, MaxMsgsPerRecv),
+		poller:  newBusyPoller(e.busyPollBudget),
 	}
-	d.msgHdrs = make([]rawfile.MMsgHdr, MaxMsgsPerRecv)
-	for i := range d.msgHdrs {
-		d.msgHdrs[i].Msg.Iov = &d.iovecs[i][0]
-		d.msgHdrs[i].Msg.Iovlen = uint64(iovLen)
+	for i := range d.bufs {
+		d.bufs[i] = newIovecBuffer(BufConfig, d.e.vnetHdr)
 	}
 	return d, nil
 }
 
-func (d *recvMMsgDispatcher) capViews(k, n int, buffers []int) int {
-	c := 0
-	for i, s := range buffers {
-		c += s
-		if c >= n {
-			d.views[k][i].CapLength(s - (c - n))
-			return i + 1
-		}
-	}
-	return len(buffers)
-}
-
-func (d *recvMMsgDispatcher) allocateViews(bufConfig []int) {
-	for k := 0; k < len(d.views); k++ {
-		var vnetHdr [virtioNetHdrSize]byte
-		vnetHdrOff := 0
-		if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-			// The kernel adds virtioNetHdr before each packet, but
-			// we don't use it, so so we allocate a buffer for it,
-			// add it in iovecs but don't add it in a view.
-			d.iovecs[k][0] = syscall.Iovec{
-				Base: &vnetHdr[0],
-				Len:  uint64(virtioNetHdrSize),
-			}
-			vnetHdrOff++
-		}
-		for i := 0; i < len(bufConfig); i++ {
-			if d.views[k][i] != nil {
-				break
-			}
-			b := buffer.NewView(bufConfig[i])
-			d.views[k][i] = b
-			d.iovecs[k][i+vnetHdrOff] = syscall.Iovec{
-				Base: &b[0],
-				Len:  uint64(len(b)),
-			}
-		}
-	}
-}
-
 // recvMMsgDispatch reads more than one packet at a time from the file
 // descriptor and dispatches it.
 func (d *recvMMsgDispatcher) dispatch() (bool, *tcpip.Error) {
-	d.allocateViews(BufConfig)
+	// Fill message headers.
+	for k := range d.msgHdrs {
+		if d.msgHdrs[k].Msg.Iovlen > 0 {
+			// Not consumed by the last call.
+			continue
+		}
+		iovecs := d.bufs[k].nextIovecs()
+		iovLen := len(iovecs)
+		d.msgHdrs[k].Len = 0
+		d.msgHdrs[k].Msg.Iov = &iovecs[0]
+		d.msgHdrs[k].Msg.Iovlen = uint64(iovLen)
+	}
 
-	nMsgs, err := rawfile.BlockingRecvMMsg(d.fd, d.msgHdrs)
+	nMsgs, err := d.poller.recvMMsg(d.fd, d.msgHdrs)
 	if err != nil {
 		return false, err
 	}
 	// Process each of received packets.
 	for k := 0; k < nMsgs; k++ {
-		n := int(d.msgHdrs[k].Len)
-		if d.e.Capabilities()&stack.CapabilityHardwareGSO != 0 {
-			n -= virtioNetHdrSize
-		}
-
-		used := d.capViews(k, int(n), BufConfig)
+		msgHdr := &d.msgHdrs[k]
 		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
-			Data: buffer.NewVectorisedView(int(n), append([]buffer.View(nil), d.views[k][:used]...)),
+			Data: d.bufs[k].pullViews(int(msgHdr.Len)),
 		})
 
-		var (
-			p             tcpip.NetworkProtocolNumber
-			remote, local tcpip.LinkAddress
-		)
-		if d.e.hdrSize > 0 {
-			hdr, ok := pkt.LinkHeader().Consume(d.e.hdrSize)
-			if !ok {
-				return false, nil
-			}
-			eth := header.Ethernet(hdr)
-			p = eth.Type()
-			remote = eth.SourceAddress()
-			local = eth.DestinationAddress()
-		} else {
-			// We don't get any indication of what the packet is, so try to guess
-			// if it's an IPv4 or IPv6 packet.
-			switch header.IPVersion(d.views[k][0]) {
-			case header.IPv4Version:
-				p = header.IPv4ProtocolNumber
-			case header.IPv6Version:
-				p = header.IPv6ProtocolNumber
-			default:
-				return true, nil
-			}
-		}
-
-		d.e.dispatcher.DeliverNetworkPacket(remote, local, p, pkt)
+		// Mark that this iovec has been processed.
+		msgHdr.Msg.Iovlen = 0
 
-		// Prepare e.views for another packet: release used views.
-		for i := 0; i < used; i++ {
-			d.views[k][i] = nil
+		if !d.e.deliverPacket(pkt) {
+			return false, nil
 		}
 	}
 
-	for k := 0; k < nMsgs; k++ {
-		d.msgHdrs[k].Len = 0
-	}
-
 	return true, nil
 }
@@ -0,0 +1,75 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loopback
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+type delivered struct {
+	proto tcpip.NetworkProtocolNumber
+	data  buffer.View
+}
+
+type recordingDispatcher struct {
+	pkts []delivered
+}
+
+func (d *recordingDispatcher) DeliverNetworkPacket(_, _ tcpip.LinkAddress, proto tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	d.pkts = append(d.pkts, delivered{proto: proto, data: pkt.Data.ToView()})
+}
+
+func (*recordingDispatcher) DeliverOutboundPacket(_, _ tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, _ *stack.PacketBuffer) {
+}
+
+func TestWritePackets(t *testing.T) {
+	var d recordingDispatcher
+	ep := New()
+	ep.Attach(&d)
+
+	payloads := []buffer.View{
+		buffer.View("first"),
+		buffer.View("second"),
+		buffer.View("third"),
+	}
+	var pkts stack.PacketBufferList
+	for _, v := range payloads {
+		pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: v.ToVectorisedView(),
+		}))
+	}
+
+	n, err := ep.WritePackets(nil /* route */, nil /* gso */, pkts, header.IPv4ProtocolNumber)
+	if err != nil {
+		t.Fatalf("ep.WritePackets(...): %s", err)
+	}
+	if n != len(payloads) {
+		t.Errorf("got ep.WritePackets(...) = %d, want = %d", n, len(payloads))
+	}
+	if len(d.pkts) != len(payloads) {
+		t.Fatalf("got %d delivered packets, want = %d", len(d.pkts), len(payloads))
+	}
+	for i, want := range payloads {
+		if got := d.pkts[i]; got.proto != header.IPv4ProtocolNumber || !bytes.Equal(got.data, want) {
+			t.Errorf("packet %d: got (%d, %q), want = (%d, %q)", i, got.proto, got.data, header.IPv4ProtocolNumber, want)
+		}
+	}
+}
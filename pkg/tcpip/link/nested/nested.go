@@ -38,6 +38,7 @@ type Endpoint struct {
 }
 
 var _ stack.GSOEndpoint = (*Endpoint)(nil)
+var _ stack.GSOEncapEndpoint = (*Endpoint)(nil)
 var _ stack.LinkEndpoint = (*Endpoint)(nil)
 var _ stack.NetworkDispatcher = (*Endpoint)(nil)
 
@@ -135,6 +136,14 @@ func (e *Endpoint) GSOMaxSize() uint32 {
 	return 0
 }
 
+// SupportsGSOEncap implements stack.GSOEncapEndpoint.
+func (e *Endpoint) SupportsGSOEncap(typ stack.GSOEncapType) bool {
+	if e, ok := e.child.(stack.GSOEncapEndpoint); ok {
+		return e.SupportsGSOEncap(typ)
+	}
+	return typ == stack.GSOEncapNone
+}
+
 // ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType
 func (e *Endpoint) ARPHardwareType() header.ARPHardwareType {
 	return e.child.ARPHardwareType()
@@ -0,0 +1,107 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipe
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	linkAddr1 = tcpip.LinkAddress("\x02\x03\x03\x04\x05\x06")
+	linkAddr2 = tcpip.LinkAddress("\x02\x03\x03\x04\x05\x07")
+)
+
+type delivered struct {
+	remote, local tcpip.LinkAddress
+	data          buffer.View
+}
+
+type recordingDispatcher struct {
+	pkts []delivered
+}
+
+func (d *recordingDispatcher) DeliverNetworkPacket(remote, local tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	d.pkts = append(d.pkts, delivered{remote: remote, local: local, data: pkt.Data.ToView()})
+}
+
+func (*recordingDispatcher) DeliverOutboundPacket(_, _ tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, _ *stack.PacketBuffer) {
+}
+
+func TestWritePackets(t *testing.T) {
+	ep1, ep2 := New(linkAddr1, linkAddr2)
+	var d1, d2 recordingDispatcher
+	ep1.Attach(&d1)
+	ep2.Attach(&d2)
+
+	payloads := []buffer.View{
+		buffer.View("first"),
+		buffer.View("second"),
+		buffer.View("third"),
+	}
+	var pkts stack.PacketBufferList
+	for _, v := range payloads {
+		pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: v.ToVectorisedView(),
+		}))
+	}
+
+	r := stack.Route{
+		LocalLinkAddress:  linkAddr1,
+		RemoteLinkAddress: linkAddr2,
+	}
+	n, err := ep1.WritePackets(&r, nil /* gso */, pkts, header.IPv4ProtocolNumber)
+	if err != nil {
+		t.Fatalf("ep1.WritePackets(...): %s", err)
+	}
+	if n != len(payloads) {
+		t.Errorf("got ep1.WritePackets(...) = %d, want = %d", n, len(payloads))
+	}
+	if len(d1.pkts) != 0 {
+		t.Errorf("got %d packets delivered to the sending end, want = 0", len(d1.pkts))
+	}
+	if len(d2.pkts) != len(payloads) {
+		t.Fatalf("got %d packets delivered to the other end, want = %d", len(d2.pkts), len(payloads))
+	}
+	for i, want := range payloads {
+		got := d2.pkts[i]
+		if got.remote != linkAddr1 || got.local != linkAddr2 {
+			t.Errorf("packet %d: got (remote, local) = (%q, %q), want = (%q, %q)", i, got.remote, got.local, linkAddr1, linkAddr2)
+		}
+		if !bytes.Equal(got.data, want) {
+			t.Errorf("packet %d: got data = %q, want = %q", i, got.data, want)
+		}
+	}
+}
+
+func TestWritePacketsUnattachedPeer(t *testing.T) {
+	ep1, _ := New(linkAddr1, linkAddr2)
+	var pkts stack.PacketBufferList
+	for i := 0; i < 2; i++ {
+		pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: buffer.View("data").ToVectorisedView(),
+		}))
+	}
+	// Packets written to a pipe whose other end isn't attached are dropped
+	// silently, as if they had been sent on an unplugged wire.
+	if n, err := ep1.WritePackets(&stack.Route{}, nil /* gso */, pkts, header.IPv4ProtocolNumber); err != nil || n != 2 {
+		t.Errorf("got ep1.WritePackets(...) = (%d, %v), want = (2, nil)", n, err)
+	}
+}
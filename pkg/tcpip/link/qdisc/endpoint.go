@@ -0,0 +1,299 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qdisc provides the implementation of a data-link layer endpoint
+// that queues outbound packets in a replaceable queueing discipline, such as
+// fq_codel or tbf, and asynchronously dispatches them to the lower endpoint.
+package qdisc
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Discipline is a queueing discipline.
+//
+// Disciplines are not thread-safe, the Endpoint serializes calls to them.
+type Discipline interface {
+	// Kind returns the name of the discipline, as used by tc.
+	Kind() string
+
+	// Enqueue adds pkt to the queue at the monotonic time now. It returns
+	// false if pkt is rejected, in which case the caller retains ownership of
+	// pkt. To make room for pkt, the discipline may drop other packets by
+	// passing them to drop.
+	Enqueue(pkt *stack.PacketBuffer, now int64, drop func(*stack.PacketBuffer)) bool
+
+	// Dequeue removes the next packet to send at the monotonic time now. If
+	// no packet can be sent, it returns nil along with the monotonic time at
+	// which packets held back by the discipline can be sent, or 0 if the
+	// queue is empty. Packets discarded by the discipline are passed to drop.
+	Dequeue(now int64, drop func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64)
+
+	// Reset drops all the queued packets by passing them to drop.
+	Reset(drop func(*stack.PacketBuffer))
+
+	// Len returns the number of packets and bytes queued.
+	Len() (packets int, bytes int)
+}
+
+// Stats are the statistics of the discipline of an Endpoint. They are reset
+// when the discipline is replaced.
+type Stats struct {
+	// Packets and Bytes count the packets sent to the lower endpoint.
+	Packets uint64
+	Bytes   uint64
+
+	// Drops counts the packets dropped by the discipline.
+	Drops uint64
+
+	// Overlimits counts the times the discipline held back packets, e.g.
+	// because of rate limiting.
+	Overlimits uint64
+
+	// QueueLen and Backlog are the number of packets and bytes queued.
+	QueueLen uint64
+	Backlog  uint64
+}
+
+// Endpoint is a LinkEndpoint which queues all outgoing packets in a
+// queueing discipline and dispatches them to the lower endpoint from a single
+// goroutine.
+type Endpoint struct {
+	nested.Endpoint
+
+	clock      tcpip.Clock
+	newDefault func() Discipline
+
+	wg             sync.WaitGroup
+	newPacketWaker sleep.Waker
+	closeWaker     sleep.Waker
+
+	// timer wakes up the dispatcher when packets held back by the discipline
+	// can be sent. It is only accessed by the dispatcher.
+	timer tcpip.Timer
+
+	mu sync.Mutex
+	// discipline is the current queueing discipline, identified by handle
+	// for tc. The handle of the default discipline is 0.
+	discipline Discipline
+	handle     uint32
+	stats      Stats
+}
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+var _ stack.GSOEndpoint = (*Endpoint)(nil)
+
+// New creates a new Endpoint which queues packets written to lower in the
+// discipline returned by newDefault. newDefault is called again whenever the
+// discipline is reset.
+func New(lower stack.LinkEndpoint, clock tcpip.Clock, newDefault func() Discipline) *Endpoint {
+	e := &Endpoint{
+		clock:      clock,
+		newDefault: newDefault,
+		discipline: newDefault(),
+	}
+	e.Endpoint.Init(lower, e)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.dispatchLoop()
+	}()
+	return e
+}
+
+// Discipline returns the current discipline of e, along with its handle and
+// statistics. The discipline must not be used to queue packets.
+func (e *Endpoint) Discipline() (Discipline, uint32, Stats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	packets, bytes := e.discipline.Len()
+	stats.QueueLen = uint64(packets)
+	stats.Backlog = uint64(bytes)
+	return e.discipline, e.handle, stats
+}
+
+// SetDiscipline replaces the discipline of e with d, identified by handle.
+// Packets queued in the previous discipline are dropped.
+func (e *Endpoint) SetDiscipline(d Discipline, handle uint32) {
+	e.mu.Lock()
+	e.discipline.Reset(e.dropLocked)
+	e.discipline = d
+	e.handle = handle
+	e.stats = Stats{}
+	e.mu.Unlock()
+
+	// Packets held back by the previous discipline are gone.
+	e.newPacketWaker.Assert()
+}
+
+// ResetDiscipline restores the default discipline of e.
+func (e *Endpoint) ResetDiscipline() {
+	e.SetDiscipline(e.newDefault(), 0)
+}
+
+// dropLocked accounts for pkt being dropped by the discipline.
+//
+// Preconditions: e.mu must be locked.
+func (e *Endpoint) dropLocked(pkt *stack.PacketBuffer) {
+	e.stats.Drops++
+	pkt.EgressRoute.Release()
+}
+
+// enqueue adds pkt to the discipline.
+func (e *Endpoint) enqueue(pkt *stack.PacketBuffer) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.discipline.Enqueue(pkt, e.clock.NowMonotonic(), e.dropLocked) {
+		e.stats.Drops++
+		return false
+	}
+	return true
+}
+
+// dequeueBatch removes up to max packets from the discipline. If fewer
+// packets are returned, it also returns the monotonic time at which packets
+// held back by the discipline can be sent, or 0 if there are none.
+func (e *Endpoint) dequeueBatch(max int) (stack.PacketBufferList, int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var batch stack.PacketBufferList
+	now := e.clock.NowMonotonic()
+	for batch.Len() < max {
+		pkt, next := e.discipline.Dequeue(now, e.dropLocked)
+		if pkt == nil {
+			if next != 0 {
+				e.stats.Overlimits++
+			}
+			return batch, next
+		}
+		e.stats.Packets++
+		e.stats.Bytes += uint64(pkt.Size())
+		batch.PushBack(pkt)
+	}
+	return batch, 0
+}
+
+func (e *Endpoint) dispatchLoop() {
+	const newPacketWakerID = 1
+	const closeWakerID = 2
+	s := sleep.Sleeper{}
+	s.AddWaker(&e.newPacketWaker, newPacketWakerID)
+	s.AddWaker(&e.closeWaker, closeWakerID)
+	defer s.Done()
+
+	const batchSize = 32
+	for {
+		id, ok := s.Fetch(true)
+		if ok && id == closeWakerID {
+			if e.timer != nil {
+				e.timer.Stop()
+			}
+			return
+		}
+		for {
+			batch, next := e.dequeueBatch(batchSize)
+			n := batch.Len()
+			if n > 0 {
+				// We pass a protocol of zero here because each packet carries
+				// its NetworkProtocol.
+				e.Endpoint.WritePackets(nil /* route */, nil /* gso */, batch, 0 /* protocol */)
+				for pkt := batch.Front(); pkt != nil; pkt = pkt.Next() {
+					pkt.EgressRoute.Release()
+					batch.Remove(pkt)
+				}
+				batch.Reset()
+			}
+			if next != 0 {
+				d := time.Duration(next - e.clock.NowMonotonic())
+				if e.timer == nil {
+					e.timer = e.clock.AfterFunc(d, e.newPacketWaker.Assert)
+				} else {
+					e.timer.Reset(d)
+				}
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket.
+func (e *Endpoint) WritePacket(r *stack.Route, gso *stack.GSO, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	// WritePacket caller's do not set the following fields in PacketBuffer
+	// so we populate them here.
+	pkt.EgressRoute = r.Clone()
+	pkt.GSOOptions = gso
+	pkt.NetworkProtocolNumber = protocol
+	if !e.enqueue(pkt) {
+		pkt.EgressRoute.Release()
+		return tcpip.ErrNoBufferSpace
+	}
+	e.newPacketWaker.Assert()
+	return nil
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+//
+// Being a batch API, each packet in pkts should have the following fields
+// populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (e *Endpoint) WritePackets(_ *stack.Route, _ *stack.GSO, pkts stack.PacketBufferList, _ tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	enqueued := 0
+	for pkt := pkts.Front(); pkt != nil; {
+		nxt := pkt.Next()
+		// Since the discipline can hold onto a packet for long we should
+		// Clone the route here to ensure it doesn't get released while the
+		// packet is still in the queue.
+		route := pkt.EgressRoute
+		pkt.EgressRoute = route.Clone()
+		if !e.enqueue(pkt) {
+			pkt.EgressRoute.Release()
+			pkt.EgressRoute = route
+			if enqueued > 0 {
+				e.newPacketWaker.Assert()
+			}
+			return enqueued, tcpip.ErrNoBufferSpace
+		}
+		pkt = nxt
+		enqueued++
+	}
+	e.newPacketWaker.Assert()
+	return enqueued, nil
+}
+
+// Wait implements stack.LinkEndpoint.Wait.
+func (e *Endpoint) Wait() {
+	e.Endpoint.Wait()
+
+	// The lower endpoint is gone. Teardown the dispatcher goroutine and drop
+	// the packets left in the queue.
+	e.closeWaker.Assert()
+	e.wg.Wait()
+
+	e.mu.Lock()
+	e.discipline.Reset(e.dropLocked)
+	e.mu.Unlock()
+}
@@ -150,6 +150,14 @@ func (e *endpoint) GSOMaxSize() uint32 {
 	return 0
 }
 
+// SupportsGSOEncap implements stack.GSOEncapEndpoint.SupportsGSOEncap.
+func (e *endpoint) SupportsGSOEncap(typ stack.GSOEncapType) bool {
+	if gso, ok := e.lower.(stack.GSOEncapEndpoint); ok {
+		return gso.SupportsGSOEncap(typ)
+	}
+	return typ == stack.GSOEncapNone
+}
+
 // WritePacket implements stack.LinkEndpoint.WritePacket.
 func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
 	// WritePacket caller's do not set the following fields in PacketBuffer
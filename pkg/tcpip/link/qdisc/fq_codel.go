@@ -0,0 +1,324 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/hash/jenkins"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// FQCoDelOptions are the parameters of an FQCoDel discipline.
+type FQCoDelOptions struct {
+	// Target is the acceptable minimum standing queue delay of a flow.
+	Target time.Duration
+
+	// Interval is the width of the window over which the queue delay of a
+	// flow is measured. It should be about the worst case round trip time of
+	// the flows.
+	Interval time.Duration
+
+	// Limit is the maximum number of packets queued. When it is exceeded,
+	// packets are dropped from the flow with the largest backlog.
+	Limit int
+
+	// Flows is the number of queues flows are hashed into.
+	Flows int
+
+	// Quantum is the number of bytes dequeued from a flow before moving on to
+	// the next one.
+	Quantum int
+}
+
+// DefaultFQCoDelOptions returns the default parameters of FQCoDel
+// disciplines, which are those of Linux.
+func DefaultFQCoDelOptions() FQCoDelOptions {
+	return FQCoDelOptions{
+		Target:   5 * time.Millisecond,
+		Interval: 100 * time.Millisecond,
+		Limit:    10240,
+		Flows:    1024,
+		Quantum:  1514,
+	}
+}
+
+// codelVars is the state of the CoDel algorithm for a flow, as described in
+// RFC 8289.
+type codelVars struct {
+	// count is the number of packets dropped since entering the dropping
+	// state, and lastCount its value when last leaving it.
+	count     int
+	lastCount int
+
+	// dropping is true while the queue delay is above target.
+	dropping bool
+
+	// firstAboveTime is the monotonic time at which the queue delay will
+	// have been above target for an interval, or 0 if it is below target.
+	firstAboveTime int64
+
+	// dropNext is the monotonic time at which the next packet is dropped.
+	dropNext int64
+}
+
+// fqFlow is a flow queue of an FQCoDel discipline.
+type fqFlow struct {
+	q       packetQueue
+	deficit int
+	codel   codelVars
+
+	// active is true if the flow is in the new or old flows list.
+	active bool
+}
+
+// FQCoDel is a fair queuing discipline which controls the delay of each flow
+// with CoDel, as described in RFC 8290.
+type FQCoDel struct {
+	opts  FQCoDelOptions
+	flows []fqFlow
+
+	// newFlows and oldFlows are the lists of flows with packets to send,
+	// newFlows having priority.
+	newFlows []*fqFlow
+	oldFlows []*fqFlow
+
+	// packets and bytes are the number of packets and bytes queued.
+	packets int
+	bytes   int
+
+	// maxPacket is the size of the largest packet seen.
+	maxPacket int
+}
+
+var _ Discipline = (*FQCoDel)(nil)
+
+// NewFQCoDel creates a new FQCoDel discipline.
+func NewFQCoDel(opts FQCoDelOptions) (*FQCoDel, error) {
+	if opts.Target <= 0 || opts.Interval <= 0 || opts.Limit <= 0 || opts.Flows <= 0 || opts.Quantum <= 0 {
+		return nil, fmt.Errorf("invalid fq_codel options %+v: all options must be positive", opts)
+	}
+	return &FQCoDel{
+		opts:  opts,
+		flows: make([]fqFlow, opts.Flows),
+	}, nil
+}
+
+// Options returns the parameters of d.
+func (d *FQCoDel) Options() FQCoDelOptions {
+	return d.opts
+}
+
+// flowHash returns the hash of the flow pkt belongs to. It is the hash of the
+// transport endpoint if set, otherwise it is computed from the addresses, the
+// transport protocol and the ports of pkt.
+func flowHash(pkt *stack.PacketBuffer) uint32 {
+	if pkt.Hash != 0 {
+		return pkt.Hash
+	}
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber, header.IPv6ProtocolNumber:
+	default:
+		return 0
+	}
+	if len(pkt.NetworkHeader().View()) == 0 {
+		return 0
+	}
+	var h jenkins.Sum32
+	net := pkt.Network()
+	h.Write([]byte(net.SourceAddress()))
+	h.Write([]byte(net.DestinationAddress()))
+	h.Write([]byte{byte(pkt.TransportProtocolNumber)})
+	// The ports of TCP and UDP are in the first 4 bytes of their headers.
+	if v := pkt.TransportHeader().View(); len(v) >= 4 {
+		h.Write(v[:4])
+	}
+	return h.Sum32()
+}
+
+// Kind implements Discipline.Kind.
+func (*FQCoDel) Kind() string {
+	return "fq_codel"
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *FQCoDel) Enqueue(pkt *stack.PacketBuffer, now int64, drop func(*stack.PacketBuffer)) bool {
+	flow := &d.flows[flowHash(pkt)%uint32(len(d.flows))]
+	flow.q.push(pkt, now)
+	size := pkt.Size()
+	d.packets++
+	d.bytes += size
+	if size > d.maxPacket {
+		d.maxPacket = size
+	}
+	if !flow.active {
+		flow.active = true
+		flow.deficit = d.opts.Quantum
+		d.newFlows = append(d.newFlows, flow)
+	}
+	for d.packets > d.opts.Limit {
+		d.dropFattest(drop)
+	}
+	return true
+}
+
+// dropFattest drops the packet at the front of the flow with the largest
+// backlog.
+func (d *FQCoDel) dropFattest(drop func(*stack.PacketBuffer)) {
+	var fattest *fqFlow
+	for i := range d.flows {
+		if flow := &d.flows[i]; fattest == nil || flow.q.bytes > fattest.q.bytes {
+			fattest = flow
+		}
+	}
+	if p, ok := d.pop(fattest); ok {
+		drop(p.pkt)
+	}
+}
+
+// pop removes the packet at the front of flow.
+func (d *FQCoDel) pop(flow *fqFlow) (queuedPacket, bool) {
+	p, ok := flow.q.pop()
+	if ok {
+		d.packets--
+		d.bytes -= p.pkt.Size()
+	}
+	return p, ok
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *FQCoDel) Dequeue(now int64, drop func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	for {
+		head := &d.newFlows
+		if len(*head) == 0 {
+			head = &d.oldFlows
+			if len(*head) == 0 {
+				return nil, 0
+			}
+		}
+		flow := (*head)[0]
+		if flow.deficit <= 0 {
+			flow.deficit += d.opts.Quantum
+			*head = (*head)[1:]
+			d.oldFlows = append(d.oldFlows, flow)
+			continue
+		}
+		pkt := d.codelDequeue(flow, now, drop)
+		if pkt == nil {
+			*head = (*head)[1:]
+			// Force a pass through the old flows to prevent starvation.
+			if head == &d.newFlows && len(d.oldFlows) != 0 {
+				d.oldFlows = append(d.oldFlows, flow)
+			} else {
+				flow.active = false
+			}
+			continue
+		}
+		flow.deficit -= pkt.Size()
+		return pkt, 0
+	}
+}
+
+// codelDequeue removes the next packet to send from flow, dropping packets
+// which stayed in the queue for too long.
+func (d *FQCoDel) codelDequeue(flow *fqFlow, now int64, drop func(*stack.PacketBuffer)) *stack.PacketBuffer {
+	v := &flow.codel
+	p, ok := d.pop(flow)
+	if !ok {
+		v.dropping = false
+		return nil
+	}
+	interval := d.opts.Interval.Nanoseconds()
+	okToDrop := d.shouldDrop(flow, p, now)
+	switch {
+	case v.dropping && !okToDrop:
+		// The queue delay went below target, leave the dropping state.
+		v.dropping = false
+	case v.dropping:
+		for v.dropping && now >= v.dropNext {
+			v.count++
+			drop(p.pkt)
+			if p, ok = d.pop(flow); !ok {
+				v.dropping = false
+				return nil
+			}
+			if d.shouldDrop(flow, p, now) {
+				v.dropNext = controlLaw(v.dropNext, interval, v.count)
+			} else {
+				v.dropping = false
+			}
+		}
+	case okToDrop:
+		drop(p.pkt)
+		p, ok = d.pop(flow)
+		v.dropping = true
+		// If the dropping state was entered recently, resume at the previous
+		// drop rate.
+		delta := v.count - v.lastCount
+		if delta > 1 && now-v.dropNext < 16*interval {
+			v.count = delta
+		} else {
+			v.count = 1
+		}
+		v.lastCount = v.count
+		v.dropNext = controlLaw(now, interval, v.count)
+		if !ok {
+			return nil
+		}
+	}
+	return p.pkt
+}
+
+// shouldDrop returns true if p, just dequeued from flow, has been above the
+// target delay for at least an interval.
+func (d *FQCoDel) shouldDrop(flow *fqFlow, p queuedPacket, now int64) bool {
+	v := &flow.codel
+	if now-p.enqueued < d.opts.Target.Nanoseconds() || d.bytes <= d.maxPacket {
+		// The delay is below target, or there isn't enough queued to matter.
+		v.firstAboveTime = 0
+		return false
+	}
+	if v.firstAboveTime == 0 {
+		v.firstAboveTime = now + d.opts.Interval.Nanoseconds()
+		return false
+	}
+	return now >= v.firstAboveTime
+}
+
+// controlLaw returns the time of the next drop, after the drop at t which
+// was the count-th since entering the dropping state.
+func controlLaw(t, interval int64, count int) int64 {
+	return t + int64(float64(interval)/math.Sqrt(float64(count)))
+}
+
+// Reset implements Discipline.Reset.
+func (d *FQCoDel) Reset(drop func(*stack.PacketBuffer)) {
+	for i := range d.flows {
+		d.flows[i].q.reset(drop)
+		d.flows[i] = fqFlow{}
+	}
+	d.newFlows = nil
+	d.oldFlows = nil
+	d.packets = 0
+	d.bytes = 0
+}
+
+// Len implements Discipline.Len.
+func (d *FQCoDel) Len() (int, int) {
+	return d.packets, d.bytes
+}
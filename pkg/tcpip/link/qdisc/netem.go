@@ -0,0 +1,216 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// NetemOptions are the parameters of a Netem discipline. Probabilities are
+// between 0 and 1.
+type NetemOptions struct {
+	// Latency is the delay added to packets.
+	Latency time.Duration
+
+	// Jitter is the maximum variation of the delay, which is uniformly
+	// distributed between Latency-Jitter and Latency+Jitter. Packets are
+	// reordered when their delays differ by more than their interval.
+	Jitter time.Duration
+
+	// Loss is the probability of dropping a packet.
+	Loss float64
+
+	// Duplicate is the probability of duplicating a packet.
+	Duplicate float64
+
+	// Reorder is the probability of sending a packet immediately, ahead of
+	// delayed packets. Only one out of Gap packets may be reordered; a Gap
+	// of zero is treated as one.
+	Reorder float64
+	Gap     uint32
+
+	// Rate limits the rate at which packets are sent, in bytes per second.
+	// Zero means no limit.
+	Rate uint64
+
+	// Limit is the maximum number of packets queued.
+	Limit int
+}
+
+// netemPacket is a packet delayed by a Netem discipline.
+type netemPacket struct {
+	pkt *stack.PacketBuffer
+
+	// timeToSend is the monotonic time at which the packet is sent.
+	timeToSend int64
+}
+
+// Netem is a discipline which emulates the properties of wide area networks,
+// such as delay, loss, duplication and reordering.
+type Netem struct {
+	opts NetemOptions
+	rng  *rand.Rand
+
+	// immediate holds the reordered packets, which are sent first.
+	immediate packetQueue
+
+	// delayed holds the other packets, sorted by time to send.
+	delayed      []netemPacket
+	delayedBytes int
+
+	// counter is the number of packets delayed since the last reordered one.
+	counter uint32
+}
+
+var _ Discipline = (*Netem)(nil)
+
+// NewNetem creates a new Netem discipline which uses rng to make random
+// decisions.
+func NewNetem(opts NetemOptions, rng *rand.Rand) (*Netem, error) {
+	for _, p := range []float64{opts.Loss, opts.Duplicate, opts.Reorder} {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("invalid netem options %+v: probabilities must be between 0 and 1", opts)
+		}
+	}
+	if opts.Latency < 0 || opts.Jitter < 0 || opts.Limit <= 0 {
+		return nil, fmt.Errorf("invalid netem options %+v: delays can't be negative and the limit must be positive", opts)
+	}
+	if opts.Reorder != 0 && opts.Gap == 0 {
+		opts.Gap = 1
+	}
+	return &Netem{
+		opts: opts,
+		rng:  rng,
+	}, nil
+}
+
+// Options returns the parameters of d.
+func (d *Netem) Options() NetemOptions {
+	return d.opts
+}
+
+// Kind implements Discipline.Kind.
+func (*Netem) Kind() string {
+	return "netem"
+}
+
+// chance returns true with probability p.
+func (d *Netem) chance(p float64) bool {
+	return p != 0 && d.rng.Float64() < p
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *Netem) Enqueue(pkt *stack.PacketBuffer, now int64, drop func(*stack.PacketBuffer)) bool {
+	packets, _ := d.Len()
+	if packets >= d.opts.Limit {
+		return false
+	}
+	if d.chance(d.opts.Loss) {
+		// The packet is lost on the emulated network, which the sender can't
+		// tell.
+		drop(pkt)
+		return true
+	}
+	if d.chance(d.opts.Duplicate) && packets+1 < d.opts.Limit {
+		dup := pkt.Clone()
+		if pkt.EgressRoute != nil {
+			dup.EgressRoute = pkt.EgressRoute.Clone()
+		}
+		d.enqueue(dup, now)
+	}
+	d.enqueue(pkt, now)
+	return true
+}
+
+// enqueue delays pkt, or reorders it.
+func (d *Netem) enqueue(pkt *stack.PacketBuffer, now int64) {
+	if d.opts.Gap != 0 && d.counter >= d.opts.Gap-1 && d.chance(d.opts.Reorder) {
+		d.counter = 0
+		d.immediate.push(pkt, now)
+		return
+	}
+	d.counter++
+
+	delay := d.opts.Latency.Nanoseconds()
+	if jitter := d.opts.Jitter.Nanoseconds(); jitter != 0 {
+		delay += d.rng.Int63n(2*jitter+1) - jitter
+	}
+	if d.opts.Rate != 0 {
+		// Packets are sent back to back at the rate, the delay counting from
+		// the time the last packet is sent.
+		if n := len(d.delayed); n != 0 {
+			if last := d.delayed[n-1].timeToSend; last > now {
+				delay -= last - now
+				if delay < 0 {
+					delay = 0
+				}
+				now = last
+			}
+		}
+		delay += int64(uint64(pkt.Size()) * uint64(time.Second) / d.opts.Rate)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	p := netemPacket{pkt: pkt, timeToSend: now + delay}
+
+	// Packets with the same time to send stay in order.
+	i := sort.Search(len(d.delayed), func(i int) bool {
+		return d.delayed[i].timeToSend > p.timeToSend
+	})
+	d.delayed = append(d.delayed, netemPacket{})
+	copy(d.delayed[i+1:], d.delayed[i:])
+	d.delayed[i] = p
+	d.delayedBytes += pkt.Size()
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *Netem) Dequeue(now int64, _ func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	if p, ok := d.immediate.pop(); ok {
+		return p.pkt, 0
+	}
+	if len(d.delayed) == 0 {
+		return nil, 0
+	}
+	p := d.delayed[0]
+	if p.timeToSend > now {
+		return nil, p.timeToSend
+	}
+	d.delayed[0] = netemPacket{}
+	d.delayed = d.delayed[1:]
+	d.delayedBytes -= p.pkt.Size()
+	return p.pkt, 0
+}
+
+// Reset implements Discipline.Reset.
+func (d *Netem) Reset(drop func(*stack.PacketBuffer)) {
+	d.immediate.reset(drop)
+	for _, p := range d.delayed {
+		drop(p.pkt)
+	}
+	d.delayed = nil
+	d.delayedBytes = 0
+	d.counter = 0
+}
+
+// Len implements Discipline.Len.
+func (d *Netem) Len() (int, int) {
+	return d.immediate.len() + len(d.delayed), d.immediate.bytes + d.delayedBytes
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// queuedPacket is a packet along with the monotonic time it was enqueued at.
+type queuedPacket struct {
+	pkt      *stack.PacketBuffer
+	enqueued int64
+}
+
+// packetQueue is an unbounded FIFO queue of packets.
+type packetQueue struct {
+	pkts []queuedPacket
+
+	// bytes is the total size of pkts.
+	bytes int
+}
+
+// len returns the number of packets in the queue.
+func (q *packetQueue) len() int {
+	return len(q.pkts)
+}
+
+// push adds pkt to the back of the queue.
+func (q *packetQueue) push(pkt *stack.PacketBuffer, now int64) {
+	q.pkts = append(q.pkts, queuedPacket{pkt: pkt, enqueued: now})
+	q.bytes += pkt.Size()
+}
+
+// front returns the packet at the front of the queue without removing it.
+func (q *packetQueue) front() (queuedPacket, bool) {
+	if len(q.pkts) == 0 {
+		return queuedPacket{}, false
+	}
+	return q.pkts[0], true
+}
+
+// pop removes the packet at the front of the queue.
+func (q *packetQueue) pop() (queuedPacket, bool) {
+	if len(q.pkts) == 0 {
+		return queuedPacket{}, false
+	}
+	p := q.pkts[0]
+	q.pkts[0] = queuedPacket{}
+	q.pkts = q.pkts[1:]
+	q.bytes -= p.pkt.Size()
+	return p, true
+}
+
+// reset drops all the packets in the queue by passing them to drop.
+func (q *packetQueue) reset(drop func(*stack.PacketBuffer)) {
+	for _, p := range q.pkts {
+		drop(p.pkt)
+	}
+	q.pkts = nil
+	q.bytes = 0
+}
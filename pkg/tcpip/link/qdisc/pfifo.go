@@ -0,0 +1,72 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// DefaultPFIFOLimit is the default limit of PFIFO disciplines, which is the
+// default transmit queue length of Linux interfaces.
+const DefaultPFIFOLimit = 1000
+
+// PFIFO is a discipline which queues packets in a single FIFO queue, up to a
+// limit of packets.
+type PFIFO struct {
+	limit int
+	q     packetQueue
+}
+
+var _ Discipline = (*PFIFO)(nil)
+
+// NewPFIFO creates a new PFIFO discipline which queues up to limit packets.
+func NewPFIFO(limit int) *PFIFO {
+	return &PFIFO{limit: limit}
+}
+
+// Limit returns the maximum number of packets queued by d.
+func (d *PFIFO) Limit() int {
+	return d.limit
+}
+
+// Kind implements Discipline.Kind.
+func (*PFIFO) Kind() string {
+	return "pfifo"
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *PFIFO) Enqueue(pkt *stack.PacketBuffer, now int64, _ func(*stack.PacketBuffer)) bool {
+	if d.q.len() >= d.limit {
+		return false
+	}
+	d.q.push(pkt, now)
+	return true
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *PFIFO) Dequeue(int64, func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	p, _ := d.q.pop()
+	return p.pkt, 0
+}
+
+// Reset implements Discipline.Reset.
+func (d *PFIFO) Reset(drop func(*stack.PacketBuffer)) {
+	d.q.reset(drop)
+}
+
+// Len implements Discipline.Len.
+func (d *PFIFO) Len() (int, int) {
+	return d.q.len(), d.q.bytes
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// MaxPrioBands is the maximum number of bands of a Prio discipline.
+	MaxPrioBands = 16
+
+	// PrioMapSize is the number of priorities mapped to bands. Priorities
+	// beyond it wrap around.
+	PrioMapSize = 16
+)
+
+// Packet priorities, as set with SO_PRIORITY.
+const (
+	PriorityBestEffort      = 0
+	PriorityBulk            = 2
+	PriorityInteractiveBulk = 4
+	PriorityInteractive     = 6
+	PriorityControl         = 7
+)
+
+// PrioOptions are the parameters of a Prio discipline.
+type PrioOptions struct {
+	// Bands is the number of bands, between 2 and MaxPrioBands.
+	Bands int
+
+	// PrioMap maps the priority of packets to the band they are queued in.
+	PrioMap [PrioMapSize]uint8
+}
+
+// DefaultPrioOptions are the default parameters of Prio disciplines, as in
+// Linux. Control and interactive traffic is queued in band 0 and bulk traffic
+// in band 2.
+var DefaultPrioOptions = PrioOptions{
+	Bands:   3,
+	PrioMap: [PrioMapSize]uint8{1, 2, 2, 2, 1, 2, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1},
+}
+
+// classSelectorPriority maps the class selector of the DSCP of packets, i.e.
+// its 3 most significant bits, to a priority.
+var classSelectorPriority = [8]uint32{
+	PriorityBestEffort,      // CS0: default forwarding.
+	PriorityBulk,            // CS1: low-priority data.
+	PriorityBestEffort,      // CS2: low-latency data.
+	PriorityInteractiveBulk, // CS3: multimedia streaming and signaling.
+	PriorityInteractiveBulk, // CS4: real-time interactive.
+	PriorityInteractive,     // CS5 and EF: telephony.
+	PriorityControl,         // CS6: network control.
+	PriorityControl,         // CS7: reserved for network control.
+}
+
+// Prio is a discipline which queues packets in bands according to their
+// priority, and sends packets of a band only once all lower bands are empty.
+//
+// The priority of packets is the one set on their socket with SO_PRIORITY or,
+// failing that, derived from their DSCP.
+type Prio struct {
+	opts  PrioOptions
+	bands []packetQueue
+}
+
+var _ Discipline = (*Prio)(nil)
+
+// NewPrio creates a new Prio discipline. Each band queues up to
+// DefaultPFIFOLimit packets.
+func NewPrio(opts PrioOptions) (*Prio, error) {
+	if opts.Bands < 2 || opts.Bands > MaxPrioBands {
+		return nil, fmt.Errorf("got %d bands, want between 2 and %d", opts.Bands, MaxPrioBands)
+	}
+	for priority, band := range opts.PrioMap {
+		if int(band) >= opts.Bands {
+			return nil, fmt.Errorf("priority %d is mapped to band %d, but there are only %d bands", priority, band, opts.Bands)
+		}
+	}
+	return &Prio{
+		opts:  opts,
+		bands: make([]packetQueue, opts.Bands),
+	}, nil
+}
+
+// Options returns the parameters of d.
+func (d *Prio) Options() PrioOptions {
+	return d.opts
+}
+
+// Kind implements Discipline.Kind.
+func (*Prio) Kind() string {
+	return "prio"
+}
+
+// band returns the band pkt is queued in.
+func (d *Prio) band(pkt *stack.PacketBuffer) int {
+	priority := pkt.Priority
+	if priority == 0 {
+		priority = dscpPriority(pkt)
+	}
+	return int(d.opts.PrioMap[priority%PrioMapSize])
+}
+
+// dscpPriority returns the priority of pkt according to its DSCP.
+func dscpPriority(pkt *stack.PacketBuffer) uint32 {
+	var tos uint8
+	h := pkt.NetworkHeader().View()
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		if len(h) < header.IPv4MinimumSize {
+			return PriorityBestEffort
+		}
+		tos, _ = header.IPv4(h).TOS()
+	case header.IPv6ProtocolNumber:
+		if len(h) < header.IPv6MinimumSize {
+			return PriorityBestEffort
+		}
+		tos, _ = header.IPv6(h).TOS()
+	default:
+		return PriorityBestEffort
+	}
+	// The DSCP is the 6 most significant bits of the TOS, followed by the
+	// ECN bits.
+	return classSelectorPriority[tos>>5]
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *Prio) Enqueue(pkt *stack.PacketBuffer, now int64, _ func(*stack.PacketBuffer)) bool {
+	q := &d.bands[d.band(pkt)]
+	if q.len() >= DefaultPFIFOLimit {
+		return false
+	}
+	q.push(pkt, now)
+	return true
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *Prio) Dequeue(int64, func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	for i := range d.bands {
+		if p, ok := d.bands[i].pop(); ok {
+			return p.pkt, 0
+		}
+	}
+	return nil, 0
+}
+
+// Reset implements Discipline.Reset.
+func (d *Prio) Reset(drop func(*stack.PacketBuffer)) {
+	for i := range d.bands {
+		d.bands[i].reset(drop)
+	}
+}
+
+// Len implements Discipline.Len.
+func (d *Prio) Len() (int, int) {
+	var packets, bytes int
+	for i := range d.bands {
+		packets += d.bands[i].len()
+		bytes += d.bands[i].bytes
+	}
+	return packets, bytes
+}
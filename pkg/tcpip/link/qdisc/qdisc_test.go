@@ -0,0 +1,472 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func newPacket(hash uint32, size int) *stack.PacketBuffer {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: buffer.NewView(size).ToVectorisedView(),
+	})
+	pkt.Hash = hash
+	return pkt
+}
+
+// dropCounter counts the packets dropped by a discipline.
+type dropCounter int
+
+func (c *dropCounter) drop(*stack.PacketBuffer) {
+	*c++
+}
+
+func TestPFIFOLimit(t *testing.T) {
+	d := qdisc.NewPFIFO(2)
+	var drops dropCounter
+	for i := 0; i < 2; i++ {
+		if !d.Enqueue(newPacket(0, 100), 0, drops.drop) {
+			t.Fatalf("d.Enqueue(_, 0, _) = false for packet %d, want true", i)
+		}
+	}
+	if d.Enqueue(newPacket(0, 100), 0, drops.drop) {
+		t.Errorf("d.Enqueue(_, 0, _) = true over the limit, want false")
+	}
+	if packets, bytes := d.Len(); packets != 2 || bytes != 200 {
+		t.Errorf("got d.Len() = (%d, %d), want (2, 200)", packets, bytes)
+	}
+	d.Reset(drops.drop)
+	if drops != 2 {
+		t.Errorf("got %d packets dropped by d.Reset(_), want 2", drops)
+	}
+}
+
+func TestTBF(t *testing.T) {
+	d, err := qdisc.NewTBF(qdisc.TBFOptions{
+		Rate:  1000,
+		Burst: 200,
+		Limit: 1000,
+	})
+	if err != nil {
+		t.Fatalf("qdisc.NewTBF(_) = %s", err)
+	}
+	var drops dropCounter
+	for i := 0; i < 4; i++ {
+		if !d.Enqueue(newPacket(0, 100), 0, drops.drop) {
+			t.Fatalf("d.Enqueue(_, 0, _) = false for packet %d, want true", i)
+		}
+	}
+
+	// The bucket holds two packets.
+	for i := 0; i < 2; i++ {
+		if pkt, _ := d.Dequeue(0, drops.drop); pkt == nil {
+			t.Fatalf("d.Dequeue(0, _) = nil for packet %d within the burst", i)
+		}
+	}
+	pkt, next := d.Dequeue(0, drops.drop)
+	if pkt != nil {
+		t.Fatalf("d.Dequeue(0, _) returned a packet over the burst")
+	}
+	if want := (100 * time.Millisecond).Nanoseconds(); next != want {
+		t.Errorf("got d.Dequeue(0, _) = (nil, %d), want (nil, %d)", next, want)
+	}
+	if pkt, _ := d.Dequeue(next, drops.drop); pkt == nil {
+		t.Errorf("d.Dequeue(%d, _) = nil once tokens are available", next)
+	}
+
+	// The limit is in bytes.
+	for i := 0; i < 9; i++ {
+		d.Enqueue(newPacket(0, 100), next, drops.drop)
+	}
+	if packets, bytes := d.Len(); packets != 10 || bytes != 1000 {
+		t.Errorf("got d.Len() = (%d, %d), want (10, 1000)", packets, bytes)
+	}
+	if drops != 0 {
+		t.Errorf("got %d packets dropped, want 0", drops)
+	}
+}
+
+func TestNewTBFInvalid(t *testing.T) {
+	for _, opts := range []qdisc.TBFOptions{
+		{Burst: 100, Limit: 100},
+		{Rate: 100, Limit: 100},
+		{Rate: 100, Burst: 100},
+	} {
+		if _, err := qdisc.NewTBF(opts); err == nil {
+			t.Errorf("qdisc.NewTBF(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func newFQCoDel(t *testing.T, update func(*qdisc.FQCoDelOptions)) *qdisc.FQCoDel {
+	t.Helper()
+	opts := qdisc.DefaultFQCoDelOptions()
+	update(&opts)
+	d, err := qdisc.NewFQCoDel(opts)
+	if err != nil {
+		t.Fatalf("qdisc.NewFQCoDel(%+v) = %s", opts, err)
+	}
+	return d
+}
+
+func TestFQCoDelFairness(t *testing.T) {
+	d := newFQCoDel(t, func(opts *qdisc.FQCoDelOptions) {
+		opts.Quantum = 1500
+	})
+	var drops dropCounter
+	for i := 0; i < 6; i++ {
+		d.Enqueue(newPacket(1, 1000), 0, drops.drop)
+	}
+	d.Enqueue(newPacket(2, 1000), 0, drops.drop)
+
+	// The bulk flow runs out of quantum after two packets, and the sparse
+	// flow is served before it gets more.
+	var got []uint32
+	for pkt, _ := d.Dequeue(0, drops.drop); pkt != nil; pkt, _ = d.Dequeue(0, drops.drop) {
+		got = append(got, pkt.Hash)
+	}
+	want := []uint32{1, 1, 2, 1, 1, 1, 1}
+	if len(got) != len(want) {
+		t.Fatalf("got flows %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got flows %v, want %v", got, want)
+		}
+	}
+	if drops != 0 {
+		t.Errorf("got %d packets dropped, want 0", drops)
+	}
+}
+
+func TestFQCoDelLimit(t *testing.T) {
+	d := newFQCoDel(t, func(opts *qdisc.FQCoDelOptions) {
+		opts.Limit = 3
+	})
+	var drops dropCounter
+	d.Enqueue(newPacket(1, 100), 0, drops.drop)
+	for i := 0; i < 3; i++ {
+		d.Enqueue(newPacket(2, 1000), 0, drops.drop)
+	}
+
+	// The packet is dropped from the flow with the largest backlog.
+	if drops != 1 {
+		t.Fatalf("got %d packets dropped, want 1", drops)
+	}
+	if packets, bytes := d.Len(); packets != 3 || bytes != 2100 {
+		t.Errorf("got d.Len() = (%d, %d), want (3, 2100)", packets, bytes)
+	}
+}
+
+func TestFQCoDelDropsStandingQueue(t *testing.T) {
+	d := newFQCoDel(t, func(*qdisc.FQCoDelOptions) {})
+	opts := d.Options()
+	var drops dropCounter
+	for i := 0; i < 100; i++ {
+		d.Enqueue(newPacket(1, 1000), 0, drops.drop)
+	}
+
+	// The delay goes above target, but it must stay there for an interval
+	// before packets are dropped.
+	now := 2 * opts.Target.Nanoseconds()
+	if pkt, _ := d.Dequeue(now, drops.drop); pkt == nil {
+		t.Fatalf("d.Dequeue(%d, _) = nil, want a packet", now)
+	}
+	if drops != 0 {
+		t.Fatalf("got %d packets dropped before an interval above target, want 0", drops)
+	}
+
+	now += opts.Interval.Nanoseconds()
+	if pkt, _ := d.Dequeue(now, drops.drop); pkt == nil {
+		t.Fatalf("d.Dequeue(%d, _) = nil, want a packet", now)
+	}
+	if drops != 1 {
+		t.Errorf("got %d packets dropped after an interval above target, want 1", drops)
+	}
+}
+
+func newNetem(t *testing.T, opts qdisc.NetemOptions) *qdisc.Netem {
+	t.Helper()
+	if opts.Limit == 0 {
+		opts.Limit = qdisc.DefaultPFIFOLimit
+	}
+	d, err := qdisc.NewNetem(opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("qdisc.NewNetem(%+v, _) = %s", opts, err)
+	}
+	return d
+}
+
+func newSFQ(t *testing.T, update func(*qdisc.SFQOptions)) *qdisc.SFQ {
+	t.Helper()
+	opts := qdisc.DefaultSFQOptions()
+	update(&opts)
+	d, err := qdisc.NewSFQ(opts)
+	if err != nil {
+		t.Fatalf("qdisc.NewSFQ(%+v) = %s", opts, err)
+	}
+	return d
+}
+
+func TestSFQRoundRobin(t *testing.T) {
+	d := newSFQ(t, func(opts *qdisc.SFQOptions) {
+		opts.Quantum = 1000
+	})
+	var drops dropCounter
+	for i := 0; i < 4; i++ {
+		d.Enqueue(newPacket(1, 1000), 0, drops.drop)
+	}
+	for i := 0; i < 2; i++ {
+		d.Enqueue(newPacket(2, 1000), 0, drops.drop)
+	}
+	d.Enqueue(newPacket(3, 1000), 0, drops.drop)
+
+	// Each flow sends a quantum in turn, so the bulk flow doesn't hold back
+	// the others.
+	var got []uint32
+	for pkt, _ := d.Dequeue(0, drops.drop); pkt != nil; pkt, _ = d.Dequeue(0, drops.drop) {
+		got = append(got, pkt.Hash)
+	}
+	want := []uint32{1, 2, 3, 1, 2, 1, 1}
+	if len(got) != len(want) {
+		t.Fatalf("got flows %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got flows %v, want %v", got, want)
+		}
+	}
+	if drops != 0 {
+		t.Errorf("got %d packets dropped, want 0", drops)
+	}
+}
+
+func TestSFQLimit(t *testing.T) {
+	d := newSFQ(t, func(opts *qdisc.SFQOptions) {
+		opts.Limit = 3
+	})
+	var drops dropCounter
+	d.Enqueue(newPacket(1, 100), 0, drops.drop)
+	for i := 0; i < 3; i++ {
+		d.Enqueue(newPacket(2, 1000), 0, drops.drop)
+	}
+
+	// The packet is dropped from the flow with the largest backlog.
+	if drops != 1 {
+		t.Fatalf("got %d packets dropped, want 1", drops)
+	}
+	if packets, bytes := d.Len(); packets != 3 || bytes != 2100 {
+		t.Errorf("got d.Len() = (%d, %d), want (3, 2100)", packets, bytes)
+	}
+	d.Reset(drops.drop)
+	if drops != 4 {
+		t.Errorf("got %d packets dropped after d.Reset(_), want 4", drops)
+	}
+	if pkt, _ := d.Dequeue(0, drops.drop); pkt != nil {
+		t.Errorf("d.Dequeue(0, _) returned a packet after d.Reset(_)")
+	}
+}
+
+func TestNewSFQInvalid(t *testing.T) {
+	for _, opts := range []qdisc.SFQOptions{
+		{Limit: 100, Divisor: 100},
+		{Quantum: 100, Divisor: 100},
+		{Quantum: 100, Limit: 100},
+	} {
+		if _, err := qdisc.NewSFQ(opts); err == nil {
+			t.Errorf("qdisc.NewSFQ(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestNetemDelay(t *testing.T) {
+	d := newNetem(t, qdisc.NetemOptions{Latency: 10 * time.Millisecond})
+	var drops dropCounter
+	d.Enqueue(newPacket(0, 100), 0, drops.drop)
+
+	want := (10 * time.Millisecond).Nanoseconds()
+	if pkt, next := d.Dequeue(0, drops.drop); pkt != nil || next != want {
+		t.Fatalf("got d.Dequeue(0, _) = (%v, %d), want (nil, %d)", pkt, next, want)
+	}
+	if pkt, _ := d.Dequeue(want, drops.drop); pkt == nil {
+		t.Fatalf("d.Dequeue(%d, _) = nil after the latency", want)
+	}
+}
+
+func TestNetemJitter(t *testing.T) {
+	latency := 10 * time.Millisecond
+	jitter := 5 * time.Millisecond
+	d := newNetem(t, qdisc.NetemOptions{Latency: latency, Jitter: jitter})
+	var drops dropCounter
+	for i := 0; i < 100; i++ {
+		d.Enqueue(newPacket(0, 100), 0, drops.drop)
+	}
+
+	// Packets are sent in the order of their delays, which stay within the
+	// jitter.
+	last := int64(0)
+	for i := 0; i < 100; i++ {
+		_, next := d.Dequeue(0, drops.drop)
+		if next < last || next < (latency-jitter).Nanoseconds() || next > (latency+jitter).Nanoseconds() {
+			t.Fatalf("got packet %d delayed by %d, want a delay in [%d, %d] after %d", i, next, latency-jitter, latency+jitter, last)
+		}
+		if pkt, _ := d.Dequeue(next, drops.drop); pkt == nil {
+			t.Fatalf("d.Dequeue(%d, _) = nil for packet %d", next, i)
+		}
+		last = next
+	}
+}
+
+func TestNetemLoss(t *testing.T) {
+	d := newNetem(t, qdisc.NetemOptions{Loss: 1})
+	var drops dropCounter
+	for i := 0; i < 10; i++ {
+		if !d.Enqueue(newPacket(0, 100), 0, drops.drop) {
+			t.Fatalf("d.Enqueue(_, 0, _) = false, want true for packets lost on the emulated network")
+		}
+	}
+	if drops != 10 {
+		t.Errorf("got %d packets dropped, want 10", drops)
+	}
+	if packets, _ := d.Len(); packets != 0 {
+		t.Errorf("got %d packets queued, want 0", packets)
+	}
+}
+
+func TestNetemDuplicate(t *testing.T) {
+	d := newNetem(t, qdisc.NetemOptions{Duplicate: 1})
+	var drops dropCounter
+	d.Enqueue(newPacket(0, 100), 0, drops.drop)
+	if packets, bytes := d.Len(); packets != 2 || bytes != 200 {
+		t.Errorf("got d.Len() = (%d, %d), want (2, 200)", packets, bytes)
+	}
+}
+
+func TestNetemReorder(t *testing.T) {
+	d := newNetem(t, qdisc.NetemOptions{
+		Latency: 10 * time.Millisecond,
+		Reorder: 1,
+		Gap:     2,
+	})
+	var drops dropCounter
+	for i := uint32(1); i <= 3; i++ {
+		d.Enqueue(newPacket(i, 100), 0, drops.drop)
+	}
+
+	// One out of two packets is sent immediately.
+	pkt, _ := d.Dequeue(0, drops.drop)
+	if pkt == nil || pkt.Hash != 2 {
+		t.Fatalf("got d.Dequeue(0, _) = %v, want the second packet", pkt)
+	}
+	if pkt, _ := d.Dequeue(0, drops.drop); pkt != nil {
+		t.Fatalf("got d.Dequeue(0, _) = %v, want nil", pkt)
+	}
+}
+
+func TestNetemRate(t *testing.T) {
+	d := newNetem(t, qdisc.NetemOptions{Rate: 1000})
+	var drops dropCounter
+	for i := 0; i < 2; i++ {
+		d.Enqueue(newPacket(0, 100), 0, drops.drop)
+	}
+
+	// Packets are sent back to back at the rate.
+	for _, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		_, next := d.Dequeue(0, drops.drop)
+		if next != want.Nanoseconds() {
+			t.Fatalf("got next = %d, want %d", next, want.Nanoseconds())
+		}
+		if pkt, _ := d.Dequeue(next, drops.drop); pkt == nil {
+			t.Fatalf("d.Dequeue(%d, _) = nil", next)
+		}
+	}
+}
+
+func TestPrio(t *testing.T) {
+	d, err := qdisc.NewPrio(qdisc.DefaultPrioOptions)
+	if err != nil {
+		t.Fatalf("qdisc.NewPrio(_) = %s", err)
+	}
+	var drops dropCounter
+	for _, priority := range []uint32{qdisc.PriorityBulk, qdisc.PriorityBestEffort, qdisc.PriorityControl} {
+		pkt := newPacket(0, int(priority)+1)
+		pkt.Priority = priority
+		if !d.Enqueue(pkt, 0, drops.drop) {
+			t.Fatalf("d.Enqueue(_, 0, _) = false for priority %d, want true", priority)
+		}
+	}
+	for _, want := range []uint32{qdisc.PriorityControl, qdisc.PriorityBestEffort, qdisc.PriorityBulk} {
+		pkt, _ := d.Dequeue(0, drops.drop)
+		if pkt == nil {
+			t.Fatalf("d.Dequeue(0, _) = nil, want packet with priority %d", want)
+		}
+		if pkt.Priority != want {
+			t.Errorf("got packet with priority %d, want %d", pkt.Priority, want)
+		}
+	}
+}
+
+func TestPrioDSCP(t *testing.T) {
+	d, err := qdisc.NewPrio(qdisc.DefaultPrioOptions)
+	if err != nil {
+		t.Fatalf("qdisc.NewPrio(_) = %s", err)
+	}
+	var drops dropCounter
+	// The packets are queued in the bands for bulk, best-effort and
+	// expedited forwarding traffic.
+	for _, tos := range []uint8{0x20, 0x00, 0xb8} {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			ReserveHeaderBytes: header.IPv4MinimumSize,
+		})
+		header.IPv4(pkt.NetworkHeader().Push(header.IPv4MinimumSize)).Encode(&header.IPv4Fields{
+			TotalLength: header.IPv4MinimumSize,
+			TOS:         tos,
+		})
+		pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+		if !d.Enqueue(pkt, 0, drops.drop) {
+			t.Fatalf("d.Enqueue(_, 0, _) = false for TOS %#x, want true", tos)
+		}
+	}
+	for _, want := range []uint8{0xb8, 0x00, 0x20} {
+		pkt, _ := d.Dequeue(0, drops.drop)
+		if pkt == nil {
+			t.Fatalf("d.Dequeue(0, _) = nil, want packet with TOS %#x", want)
+		}
+		if got, _ := header.IPv4(pkt.NetworkHeader().View()).TOS(); got != want {
+			t.Errorf("got packet with TOS %#x, want %#x", got, want)
+		}
+	}
+}
+
+func TestNewPrioInvalid(t *testing.T) {
+	outOfRange := qdisc.DefaultPrioOptions
+	outOfRange.PrioMap[0] = 3
+	for _, opts := range []qdisc.PrioOptions{
+		{Bands: 1},
+		{Bands: qdisc.MaxPrioBands + 1},
+		outOfRange,
+	} {
+		if _, err := qdisc.NewPrio(opts); err == nil {
+			t.Errorf("qdisc.NewPrio(%+v) succeeded, want error", opts)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// SFQOptions are the parameters of an SFQ discipline.
+type SFQOptions struct {
+	// Quantum is the number of bytes dequeued from a flow before moving on to
+	// the next one.
+	Quantum int
+
+	// Limit is the maximum number of packets queued. When it is exceeded,
+	// packets are dropped from the flow with the largest backlog.
+	Limit int
+
+	// Divisor is the number of queues flows are hashed into.
+	Divisor int
+}
+
+// DefaultSFQOptions returns the default parameters of SFQ disciplines, which
+// are those of Linux on an Ethernet interface.
+func DefaultSFQOptions() SFQOptions {
+	return SFQOptions{
+		Quantum: 1514,
+		Limit:   127,
+		Divisor: 1024,
+	}
+}
+
+// sfqFlow is a flow queue of an SFQ discipline.
+type sfqFlow struct {
+	q       packetQueue
+	deficit int
+
+	// active is true if the flow is in the list of active flows.
+	active bool
+}
+
+// SFQ is a stochastic fairness queueing discipline. Flows are hashed into
+// queues which are served in a round-robin fashion, a quantum of bytes at a
+// time, so that a bulk flow can't starve the other flows of the interface
+// when the link is saturated.
+//
+// Packets of the same transport endpoint belong to the same flow.
+type SFQ struct {
+	opts  SFQOptions
+	flows []sfqFlow
+
+	// active is the list of flows with packets to send, in the order they
+	// are served.
+	active []*sfqFlow
+
+	// packets and bytes are the number of packets and bytes queued.
+	packets int
+	bytes   int
+}
+
+var _ Discipline = (*SFQ)(nil)
+
+// NewSFQ creates a new SFQ discipline.
+func NewSFQ(opts SFQOptions) (*SFQ, error) {
+	if opts.Quantum <= 0 || opts.Limit <= 0 || opts.Divisor <= 0 {
+		return nil, fmt.Errorf("invalid sfq options %+v: all options must be positive", opts)
+	}
+	return &SFQ{
+		opts:  opts,
+		flows: make([]sfqFlow, opts.Divisor),
+	}, nil
+}
+
+// Options returns the parameters of d.
+func (d *SFQ) Options() SFQOptions {
+	return d.opts
+}
+
+// Kind implements Discipline.Kind.
+func (*SFQ) Kind() string {
+	return "sfq"
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *SFQ) Enqueue(pkt *stack.PacketBuffer, now int64, drop func(*stack.PacketBuffer)) bool {
+	flow := &d.flows[flowHash(pkt)%uint32(len(d.flows))]
+	flow.q.push(pkt, now)
+	d.packets++
+	d.bytes += pkt.Size()
+	if !flow.active {
+		flow.active = true
+		flow.deficit = d.opts.Quantum
+		d.active = append(d.active, flow)
+	}
+	for d.packets > d.opts.Limit {
+		d.dropFattest(drop)
+	}
+	return true
+}
+
+// dropFattest drops the packet at the front of the flow with the largest
+// backlog.
+func (d *SFQ) dropFattest(drop func(*stack.PacketBuffer)) {
+	var fattest *sfqFlow
+	for _, flow := range d.active {
+		if fattest == nil || flow.q.bytes > fattest.q.bytes {
+			fattest = flow
+		}
+	}
+	if p, ok := d.pop(fattest); ok {
+		drop(p.pkt)
+	}
+}
+
+// pop removes the packet at the front of flow.
+func (d *SFQ) pop(flow *sfqFlow) (queuedPacket, bool) {
+	p, ok := flow.q.pop()
+	if ok {
+		d.packets--
+		d.bytes -= p.pkt.Size()
+	}
+	return p, ok
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *SFQ) Dequeue(int64, func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	for len(d.active) != 0 {
+		flow := d.active[0]
+		if flow.deficit <= 0 {
+			// The flow used up its quantum, move on to the next one.
+			flow.deficit += d.opts.Quantum
+			d.active = append(d.active[1:], flow)
+			continue
+		}
+		p, ok := d.pop(flow)
+		if !ok {
+			flow.active = false
+			d.active = d.active[1:]
+			continue
+		}
+		flow.deficit -= p.pkt.Size()
+		return p.pkt, 0
+	}
+	return nil, 0
+}
+
+// Reset implements Discipline.Reset.
+func (d *SFQ) Reset(drop func(*stack.PacketBuffer)) {
+	for i := range d.flows {
+		d.flows[i].q.reset(drop)
+		d.flows[i] = sfqFlow{}
+	}
+	d.active = nil
+	d.packets = 0
+	d.bytes = 0
+}
+
+// Len implements Discipline.Len.
+func (d *SFQ) Len() (int, int) {
+	return d.packets, d.bytes
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// TBFOptions are the parameters of a TBF discipline.
+type TBFOptions struct {
+	// Rate is the rate at which the bucket is filled, in bytes per second.
+	Rate uint64
+
+	// Burst is the size of the bucket in bytes, i.e. the number of bytes
+	// which can be sent at once.
+	Burst uint32
+
+	// Limit is the number of bytes which can be queued waiting for the
+	// bucket to fill.
+	Limit uint32
+}
+
+// TBF is a token bucket filter discipline, which shapes traffic to a rate
+// while allowing bursts.
+type TBF struct {
+	opts TBFOptions
+	q    packetQueue
+
+	// buffer is the size of the bucket, as the time needed to send it.
+	buffer int64
+
+	// tokens is the content of the bucket, as the time needed to send it. It
+	// is negative when packets larger than the bucket leave it in debt.
+	tokens int64
+
+	// checked is the monotonic time at which tokens was last updated.
+	checked int64
+}
+
+var _ Discipline = (*TBF)(nil)
+
+// NewTBF creates a new TBF discipline with a full bucket.
+func NewTBF(opts TBFOptions) (*TBF, error) {
+	if opts.Rate == 0 || opts.Burst == 0 || opts.Limit == 0 {
+		return nil, fmt.Errorf("invalid tbf options %+v: rate, burst and limit must be set", opts)
+	}
+	d := &TBF{opts: opts}
+	d.buffer = d.transmitTime(int(opts.Burst))
+	d.tokens = d.buffer
+	return d, nil
+}
+
+// Options returns the parameters of d.
+func (d *TBF) Options() TBFOptions {
+	return d.opts
+}
+
+// transmitTime returns the time needed to send size bytes at the rate of d.
+func (d *TBF) transmitTime(size int) int64 {
+	return int64(uint64(size) * uint64(time.Second) / d.opts.Rate)
+}
+
+// Kind implements Discipline.Kind.
+func (*TBF) Kind() string {
+	return "tbf"
+}
+
+// Enqueue implements Discipline.Enqueue.
+func (d *TBF) Enqueue(pkt *stack.PacketBuffer, now int64, _ func(*stack.PacketBuffer)) bool {
+	if d.q.bytes+pkt.Size() > int(d.opts.Limit) {
+		return false
+	}
+	d.q.push(pkt, now)
+	return true
+}
+
+// Dequeue implements Discipline.Dequeue.
+func (d *TBF) Dequeue(now int64, _ func(*stack.PacketBuffer)) (*stack.PacketBuffer, int64) {
+	p, ok := d.q.front()
+	if !ok {
+		return nil, 0
+	}
+	tokens := d.tokens + now - d.checked
+	if tokens > d.buffer {
+		tokens = d.buffer
+	}
+	need := d.transmitTime(p.pkt.Size())
+	// Packets larger than the bucket, such as GSO packets, are sent once the
+	// bucket is full and leave it in debt.
+	wait := need
+	if wait > d.buffer {
+		wait = d.buffer
+	}
+	if tokens < wait {
+		return nil, now + wait - tokens
+	}
+	d.tokens = tokens - need
+	d.checked = now
+	d.q.pop()
+	return p.pkt, 0
+}
+
+// Reset implements Discipline.Reset.
+func (d *TBF) Reset(drop func(*stack.PacketBuffer)) {
+	d.q.reset(drop)
+}
+
+// Len implements Discipline.Len.
+func (d *TBF) Len() (int, int) {
+	return d.q.len(), d.q.bytes
+}
@@ -138,6 +138,15 @@ func BlockingReadv(fd int, iovecs []syscall.Iovec) (int, *tcpip.Error) {
 	}
 }
 
+// NonBlockingReadv reads from a file descriptor that is set up as
+// non-blocking and stores the data in a list of iovecs buffers. Unlike
+// BlockingReadv, it returns syscall.EAGAIN instead of blocking if no data is
+// available.
+func NonBlockingReadv(fd int, iovecs []syscall.Iovec) (int, syscall.Errno) {
+	n, _, e := syscall.RawSyscall(syscall.SYS_READV, uintptr(fd), uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+	return int(n), e
+}
+
 // MMsgHdr represents the mmsg_hdr structure required by recvmmsg() on linux.
 type MMsgHdr struct {
 	Msg syscall.Msghdr
@@ -166,3 +175,12 @@ func BlockingRecvMMsg(fd int, msgHdrs []MMsgHdr) (int, *tcpip.Error) {
 		}
 	}
 }
+
+// NonBlockingRecvMMsg reads from a file descriptor that is set up as
+// non-blocking and stores the received messages in a slice of MMsgHdr
+// structures. Unlike BlockingRecvMMsg, it returns syscall.EAGAIN instead of
+// blocking if no data is available.
+func NonBlockingRecvMMsg(fd int, msgHdrs []MMsgHdr) (int, syscall.Errno) {
+	n, _, e := syscall.RawSyscall6(syscall.SYS_RECVMMSG, uintptr(fd), uintptr(unsafe.Pointer(&msgHdrs[0])), uintptr(len(msgHdrs)), syscall.MSG_DONTWAIT, 0, 0)
+	return int(n), e
+}
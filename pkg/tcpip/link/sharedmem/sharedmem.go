@@ -23,6 +23,7 @@
 package sharedmem
 
 import (
+	"fmt"
 	"sync/atomic"
 	"syscall"
 
@@ -110,6 +111,19 @@ func New(mtu, bufferSize uint32, addr tcpip.LinkAddress, tx, rx QueueConfig) (st
 		return nil, err
 	}
 
+	// A frame of the full MTU must fit in each of the data regions, otherwise
+	// it could never be sent or received.
+	if l := len(e.tx.data); uint64(l) < uint64(mtu) {
+		e.tx.cleanup()
+		e.rx.cleanup()
+		return nil, fmt.Errorf("tx data region of %d bytes can't hold a frame of %d bytes", l, mtu)
+	}
+	if l := len(e.rx.data); uint64(l) < uint64(mtu) {
+		e.tx.cleanup()
+		e.rx.cleanup()
+		return nil, fmt.Errorf("rx data region of %d bytes can't hold a frame of %d bytes", l, mtu)
+	}
+
 	return e, nil
 }
 
@@ -219,9 +233,17 @@ func (e *endpoint) WritePacket(r *stack.Route, _ *stack.GSO, protocol tcpip.Netw
 	return nil
 }
 
-// WritePackets implements stack.LinkEndpoint.WritePackets.
-func (e *endpoint) WritePackets(r *stack.Route, _ *stack.GSO, pkts stack.PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
-	panic("not implemented")
+// WritePackets implements stack.LinkEndpoint.WritePackets. Packets are
+// transmitted in order until the tx queue fills up.
+func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	n := 0
+	for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
+		if err := e.WritePacket(r, gso, protocol, pkt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
 }
 
 // dispatchLoop reads packets from the rx queue in a loop and dispatches them
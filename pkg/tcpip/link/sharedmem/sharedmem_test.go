@@ -433,6 +433,53 @@ func TestFillTxQueue(t *testing.T) {
 	}
 }
 
+// TestWritePacketsFillTxQueue checks that WritePackets transmits packets in
+// order and reports how many made it when the tx queue fills up part way.
+func TestWritePacketsFillTxQueue(t *testing.T) {
+	c := newTestContext(t, 20000, 1500, localLinkAddr)
+	defer c.cleanup()
+
+	r := stack.Route{
+		RemoteLinkAddress: remoteLinkAddr,
+	}
+
+	// Each packet uses no more than 40 bytes, so one more packet than that
+	// fits in the tx queue.
+	capacity := queuePipeSize / 40
+	var pkts stack.PacketBufferList
+	for i := 0; i <= capacity; i++ {
+		buf := buffer.NewView(100)
+		buf[0] = byte(i)
+		pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+			ReserveHeaderBytes: int(c.ep.MaxHeaderLength()),
+			Data:               buf.ToVectorisedView(),
+		}))
+	}
+
+	n, err := c.ep.WritePackets(&r, nil /* gso */, pkts, header.IPv4ProtocolNumber)
+	if err != tcpip.ErrWouldBlock {
+		t.Fatalf("got c.ep.WritePackets(...) error = %v, want = %s", err, tcpip.ErrWouldBlock)
+	}
+	if n != capacity {
+		t.Fatalf("got c.ep.WritePackets(...) = %d, want = %d", n, capacity)
+	}
+
+	// Check that the packets were queued in order.
+	for i := 0; i < capacity; i++ {
+		desc := c.txq.tx.Pull()
+		if desc == nil {
+			t.Fatalf("packet %d: tx queue is empty", i)
+		}
+		pi := queue.DecodeTxPacketHeader(desc)
+		b := queue.DecodeTxBufferHeader(desc, 0)
+		// Skip the ethernet header added by the endpoint.
+		if got := c.txq.data[b.Offset+header.EthernetMinimumSize]; got != byte(i) {
+			t.Errorf("packet %d (ID %d): got first byte = %d, want = %d", i, pi.ID, got, i)
+		}
+		c.txq.tx.Flush()
+	}
+}
+
 // TestFillTxQueueAfterBadCompletion sends a bad completion, then sends packets
 // until the queue is full.
 func TestFillTxQueueAfterBadCompletion(t *testing.T) {
@@ -815,3 +862,19 @@ func TestCloseWhileWaitingToPost(t *testing.T) {
 	cleaned = true
 	c.ep.Wait()
 }
+
+// TestMTUExceedsDataRegion checks that an endpoint can't be created with an
+// MTU larger than its data regions.
+func TestMTUExceedsDataRegion(t *testing.T) {
+	sizes := queueSizes{
+		dataSize:       queueDataSize,
+		txPipeSize:     queuePipeSize,
+		rxPipeSize:     queuePipeSize,
+		sharedDataSize: 4096,
+	}
+	txCfg := createQueueFDs(t, sizes)
+	rxCfg := createQueueFDs(t, sizes)
+	if _, err := New(queueDataSize+1, 1500, localLinkAddr, txCfg, rxCfg); err == nil {
+		t.Errorf("got New(%d, ...) = nil error, want non-nil", queueDataSize+1)
+	}
+}
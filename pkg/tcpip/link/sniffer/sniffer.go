@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -154,34 +155,81 @@ func (e *endpoint) dumpPacket(dir direction, gso *stack.GSO, protocol tcpip.Netw
 		logPacket(e.logPrefix, dir, protocol, pkt, gso)
 	}
 	if writer != nil && atomic.LoadUint32(&LogPacketsToPCAP) == 1 {
-		totalLength := pkt.Size()
-		length := totalLength
-		if max := int(e.maxPCAPLen); length > max {
-			length = max
-		}
-		if err := binary.Write(writer, binary.BigEndian, newPCAPPacketHeader(uint32(length), uint32(totalLength))); err != nil {
+		if err := writePCAPPacket(writer, e.maxPCAPLen, pkt.Size(), pkt.Views()); err != nil {
 			panic(err)
 		}
-		write := func(b []byte) {
-			if len(b) > length {
-				b = b[:length]
-			}
-			for len(b) != 0 {
-				n, err := writer.Write(b)
-				if err != nil {
-					panic(err)
-				}
-				b = b[n:]
-				length -= n
-			}
+	}
+}
+
+// writePCAPPacket writes a packet of totalLength bytes made of views to w in
+// the pcap format, truncated to maxLen bytes.
+func writePCAPPacket(w io.Writer, maxLen uint32, totalLength int, views []buffer.View) error {
+	length := totalLength
+	if max := int(maxLen); length > max {
+		length = max
+	}
+	if err := binary.Write(w, binary.BigEndian, newPCAPPacketHeader(uint32(length), uint32(totalLength))); err != nil {
+		return err
+	}
+	for _, v := range views {
+		if length == 0 {
+			break
 		}
-		for _, v := range pkt.Views() {
-			if length == 0 {
-				break
+		b := []byte(v)
+		if len(b) > length {
+			b = b[:length]
+		}
+		for len(b) != 0 {
+			n, err := w.Write(b)
+			if err != nil {
+				return err
 			}
-			write(v)
+			b = b[n:]
+			length -= n
 		}
 	}
+	return nil
+}
+
+// pcapSink is a packet endpoint which writes the packets it handles to a
+// writer in the pcap format.
+type pcapSink struct {
+	maxLen uint32
+
+	mu     sync.Mutex
+	writer io.Writer
+	err    error
+}
+
+var _ stack.PacketEndpoint = (*pcapSink)(nil)
+
+// NewPCAPSink creates a packet endpoint which writes the network packets it
+// handles to writer in the pcap format, truncated to snapLen bytes. It can be
+// used as the sink of mirrored packets.
+//
+// Writing stops at the first error.
+func NewPCAPSink(writer io.Writer, snapLen uint32) (stack.PacketEndpoint, error) {
+	if err := writePCAPHeader(writer, snapLen); err != nil {
+		return nil, err
+	}
+	return &pcapSink{
+		maxLen: snapLen,
+		writer: writer,
+	}, nil
+}
+
+// HandlePacket implements stack.PacketEndpoint.HandlePacket.
+func (s *pcapSink) HandlePacket(_ tcpip.NICID, _ tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	// The capture is of network packets, without their link header.
+	views := []buffer.View{pkt.NetworkHeader().View(), pkt.TransportHeader().View()}
+	views = append(views, pkt.Data.Views()...)
+	size := pkt.Size() - pkt.LinkHeader().View().Size()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = writePCAPPacket(s.writer, s.maxLen, size, views)
+	}
 }
 
 // WritePacket implements the stack.LinkEndpoint interface. It is called by
@@ -320,6 +368,10 @@ func logPacket(prefix string, dir direction, protocol tcpip.NetworkProtocolNumbe
 				icmpType = "info request"
 			case header.ICMPv4InfoReply:
 				icmpType = "info reply"
+			case header.ICMPv4ExtendedEchoRequest:
+				icmpType = "extended echo request"
+			case header.ICMPv4ExtendedEchoReply:
+				icmpType = "extended echo reply"
 			}
 		}
 		log.Infof("%s%s %s %s -> %s %s len:%d id:%04x code:%d", prefix, directionPrefix, transName, src, dst, icmpType, size, id, icmp.Code())
@@ -356,6 +408,10 @@ func logPacket(prefix string, dir direction, protocol tcpip.NetworkProtocolNumbe
 			icmpType = "neighbor advert"
 		case header.ICMPv6RedirectMsg:
 			icmpType = "redirect message"
+		case header.ICMPv6ExtendedEchoRequest:
+			icmpType = "extended echo request"
+		case header.ICMPv6ExtendedEchoReply:
+			icmpType = "extended echo reply"
 		}
 		log.Infof("%s%s %s %s -> %s %s len:%d id:%04x code:%d", prefix, directionPrefix, transName, src, dst, icmpType, size, id, icmp.Code())
 		return
@@ -0,0 +1,157 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package veth provides the implementation of virtual Ethernet pairs. Frames
+// written to one end of a pair are received by the other end, which may be
+// attached to a different stack, e.g. the stack of another network namespace.
+package veth
+
+import (
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+
+// NewPair returns both ends of a new virtual Ethernet pair. Each end has the
+// given MTU.
+func NewPair(linkAddr1, linkAddr2 tcpip.LinkAddress, mtu uint32) (*Endpoint, *Endpoint) {
+	ep1 := &Endpoint{
+		linkAddr: linkAddr1,
+		mtu:      mtu,
+	}
+	ep2 := &Endpoint{
+		linkAddr: linkAddr2,
+		mtu:      mtu,
+	}
+	ep1.peer = ep2
+	ep2.peer = ep1
+	return ep1, ep2
+}
+
+// Endpoint is one end of a virtual Ethernet pair.
+type Endpoint struct {
+	linkAddr tcpip.LinkAddress
+	mtu      uint32
+	peer     *Endpoint
+
+	mu sync.RWMutex
+	// dispatcher is the dispatcher of the stack the endpoint is attached to,
+	// nil if it isn't attached to any.
+	dispatcher stack.NetworkDispatcher
+}
+
+// Peer returns the other end of the pair.
+func (e *Endpoint) Peer() *Endpoint {
+	return e.peer
+}
+
+// deliver delivers a frame written to the peer of e. Frames are dropped if e
+// is not attached, like frames sent to a veth whose peer is down.
+func (e *Endpoint) deliver(pkt *stack.PacketBuffer) {
+	e.mu.RLock()
+	d := e.dispatcher
+	e.mu.RUnlock()
+	if d == nil {
+		return
+	}
+
+	// The frame is copied as the stacks on both ends may modify it.
+	vv := buffer.NewVectorisedView(pkt.Size(), pkt.Views())
+	newPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: vv.ToOwnedView().ToVectorisedView(),
+	})
+	hdr, ok := newPkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	if !ok {
+		return
+	}
+	eth := header.Ethernet(hdr)
+	if dst := eth.DestinationAddress(); dst == e.linkAddr || dst == header.EthernetBroadcastAddress || header.IsMulticastEthernetAddress(dst) {
+		d.DeliverNetworkPacket(eth.SourceAddress() /* remote */, dst /* local */, eth.Type() /* protocol */, newPkt)
+	}
+}
+
+// WritePacket implements stack.LinkEndpoint.
+func (e *Endpoint) WritePacket(r *stack.Route, _ *stack.GSO, proto tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	e.AddHeader(e.linkAddr, r.RemoteLinkAddress, proto, pkt)
+	e.peer.deliver(pkt)
+	return nil
+}
+
+// WritePackets implements stack.LinkEndpoint.
+func (e *Endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.PacketBufferList, proto tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	n := 0
+	for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
+		if err := e.WritePacket(r, gso, proto, pkt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Attach implements stack.LinkEndpoint.
+func (e *Endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.
+func (e *Endpoint) IsAttached() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.dispatcher != nil
+}
+
+// Wait implements stack.LinkEndpoint.
+func (*Endpoint) Wait() {}
+
+// MTU implements stack.LinkEndpoint.
+func (e *Endpoint) MTU() uint32 {
+	return e.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.
+func (*Endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return stack.CapabilityResolutionRequired
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.
+func (*Endpoint) MaxHeaderLength() uint16 {
+	return header.EthernetMinimumSize
+}
+
+// LinkAddress implements stack.LinkEndpoint.
+func (e *Endpoint) LinkAddress() tcpip.LinkAddress {
+	return e.linkAddr
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.
+func (*Endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
+
+// AddHeader implements stack.LinkEndpoint.
+func (*Endpoint) AddHeader(local, remote tcpip.LinkAddress, proto tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	eth.Encode(&header.EthernetFields{
+		SrcAddr: local,
+		DstAddr: remote,
+		Type:    proto,
+	})
+}
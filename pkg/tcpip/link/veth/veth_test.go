@@ -0,0 +1,127 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package veth_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/veth"
+	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	nicID = 1
+	mtu   = 1500
+	port  = 1234
+
+	linkAddr1 = tcpip.LinkAddress("\x02\x03\x03\x04\x05\x06")
+	linkAddr2 = tcpip.LinkAddress("\x02\x03\x03\x04\x05\x07")
+)
+
+var (
+	addr1 = tcpip.AddressWithPrefix{Address: "\x0a\x00\x00\x01", PrefixLen: 24}
+	addr2 = tcpip.AddressWithPrefix{Address: "\x0a\x00\x00\x02", PrefixLen: 24}
+)
+
+func newStack(t *testing.T, ep stack.LinkEndpoint, addr tcpip.AddressWithPrefix) *stack.Stack {
+	t.Helper()
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{arp.NewProtocol, ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+	protocolAddr := tcpip.ProtocolAddress{Protocol: ipv4.ProtocolNumber, AddressWithPrefix: addr}
+	if err := s.AddProtocolAddress(nicID, protocolAddr); err != nil {
+		t.Fatalf("s.AddProtocolAddress(%d, %#v): %s", nicID, protocolAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: addr.Subnet(), NIC: nicID}})
+	return s
+}
+
+func TestPair(t *testing.T) {
+	ep1, ep2 := veth.NewPair(linkAddr1, linkAddr2, mtu)
+	if ep1.Peer() != ep2 || ep2.Peer() != ep1 {
+		t.Fatalf("ends of the pair aren't peers")
+	}
+	if got := ep1.MTU(); got != mtu {
+		t.Errorf("got ep1.MTU() = %d, want = %d", got, mtu)
+	}
+	s1 := newStack(t, ep1, addr1)
+	s2 := newStack(t, ep2, addr2)
+
+	var wq waiter.Queue
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, waiter.EventIn)
+	defer wq.EventUnregister(&we)
+	rcv, err := s2.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("s2.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	defer rcv.Close()
+	if err := rcv.Bind(tcpip.FullAddress{Port: port}); err != nil {
+		t.Fatalf("rcv.Bind(_): %s", err)
+	}
+
+	snd, err := s1.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("s1.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	defer snd.Close()
+
+	// The first write triggers link resolution across the pair.
+	data := []byte{1, 2, 3, 4}
+	wOpts := tcpip.WriteOptions{To: &tcpip.FullAddress{Addr: addr2.Address, Port: port}}
+	if _, resCh, err := snd.Write(tcpip.SlicePayload(data), wOpts); err == tcpip.ErrNoLinkAddress {
+		<-resCh
+		if _, _, err := snd.Write(tcpip.SlicePayload(data), wOpts); err != nil {
+			t.Fatalf("snd.Write(_, _): %s", err)
+		}
+	} else if err != nil {
+		t.Fatalf("snd.Write(_, _): %s", err)
+	}
+
+	<-ch
+	var from tcpip.FullAddress
+	v, _, err := rcv.Read(&from)
+	if err != nil {
+		t.Fatalf("rcv.Read(_): %s", err)
+	}
+	if !bytes.Equal(v, data) {
+		t.Errorf("got rcv.Read(_) = %x, want = %x", []byte(v), data)
+	}
+	if from.Addr != addr1.Address {
+		t.Errorf("got from.Addr = %s, want = %s", from.Addr, addr1.Address)
+	}
+
+	// Frames sent to a detached end are dropped.
+	if err := s2.RemoveNIC(nicID); err != nil {
+		t.Fatalf("s2.RemoveNIC(%d): %s", nicID, err)
+	}
+	if ep2.IsAttached() {
+		t.Errorf("got ep2.IsAttached() = true after s2.RemoveNIC(%d), want = false", nicID)
+	}
+	if _, _, err := snd.Write(tcpip.SlicePayload(data), wOpts); err != nil {
+		t.Fatalf("snd.Write(_, _) to a detached peer: %s", err)
+	}
+}
@@ -0,0 +1,494 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+// Package vhost provides the implementation of data-link layer endpoints
+// backed by the host's vhost-net driver.
+//
+// Rather than reading and writing packets from and to a tap device, the
+// endpoint exchanges them with a vhost-net instance through virtqueues in
+// memory it shares with the host kernel, which moves them to and from the tap
+// device on its own. Sending or receiving a packet doesn't take a system call
+// unless the other side has to be woken up.
+//
+// Offloads aren't supported: packets carry a zeroed virtio net header.
+package vhost
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/rawfile"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// rxQueueIndex and txQueueIndex are the indices of the receive and
+	// transmit virtqueues of a vhost-net device.
+	rxQueueIndex = 0
+	txQueueIndex = 1
+
+	// virtioNetHdrSize is the size of the legacy virtio net header that
+	// precedes each packet.
+	virtioNetHdrSize = 10
+
+	// DefaultQueueSize is the number of descriptors of each virtqueue if
+	// Options.QueueSize isn't set.
+	DefaultQueueSize = 256
+
+	// maxQueueSize is the largest virtqueue size allowed by virtio.
+	maxQueueSize = 32768
+)
+
+// Options specify the details about the vhost-based endpoint to be created.
+type Options struct {
+	// VhostFD is a file descriptor for /dev/vhost-net. The endpoint becomes
+	// its owner.
+	VhostFD int
+
+	// TapFD is a file descriptor for the tap device packets are sent to and
+	// received from. It must have been created with IFF_TAP, IFF_NO_PI and
+	// IFF_VNET_HDR.
+	TapFD int
+
+	// MTU is the mtu to use for this endpoint.
+	MTU uint32
+
+	// Address is the link address for this endpoint.
+	Address tcpip.LinkAddress
+
+	// QueueSize is the number of descriptors, and so of packets in flight,
+	// of each virtqueue. It must be a power of 2. DefaultQueueSize is used
+	// if it is zero.
+	QueueSize uint16
+}
+
+// queue is a virtqueue along with the buffers its descriptors point to.
+type queue struct {
+	vq virtqueue
+
+	// bufs holds a buffer of bufferSize bytes for each descriptor.
+	bufs []byte
+
+	// kickFD is the eventfd used to notify vhost of new buffers.
+	kickFD int
+
+	// callFD is the eventfd vhost uses to notify the endpoint of used
+	// buffers. It is -1 if notifications are disabled.
+	callFD int
+}
+
+// buf returns the buffer of descriptor id.
+func (q *queue) buf(id uint16, bufferSize int) []byte {
+	return q.bufs[int(id)*bufferSize:][:bufferSize]
+}
+
+// kick publishes the buffers added to the virtqueue and notifies vhost of
+// them if it asked to be.
+func (q *queue) kick() {
+	q.vq.publish()
+	if q.vq.needsKick() {
+		syscall.Write(q.kickFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+type endpoint struct {
+	// mtu (maximum transmission unit) is the maximum size of a packet.
+	mtu uint32
+
+	// addr is the local address of this endpoint.
+	addr tcpip.LinkAddress
+
+	// vhostFD and tapFD are the file descriptors of the vhost-net device and
+	// of its backend.
+	vhostFD int
+	tapFD   int
+
+	// mem is the memory shared with vhost. It holds the virtqueues and the
+	// buffers.
+	mem []byte
+
+	// bufferSize is the size of each buffer.
+	bufferSize int
+
+	// rx is the receive queue. It is only accessed by the dispatch
+	// goroutine.
+	rx queue
+
+	// stopRequested is to be accessed atomically only, and determines if
+	// the worker goroutine should stop.
+	stopRequested uint32
+
+	// Wait group used to indicate that all workers have stopped.
+	completed sync.WaitGroup
+
+	// mu protects the following fields.
+	mu sync.Mutex
+
+	// tx is the transmit queue.
+	tx queue
+
+	// txFree holds the descriptors of the transmit queue not in use.
+	txFree []uint16
+
+	// workerStarted specifies whether the worker goroutine was started.
+	workerStarted bool
+}
+
+// New creates a new vhost-based endpoint.
+//
+// It doesn't take ownership of the file descriptors in opts, which must remain
+// open until after Wait returns.
+func New(opts *Options) (stack.LinkEndpoint, error) {
+	size := opts.QueueSize
+	if size == 0 {
+		size = DefaultQueueSize
+	}
+	if size&(size-1) != 0 || size > maxQueueSize {
+		return nil, fmt.Errorf("queue size %d isn't a power of 2 no larger than %d", size, maxQueueSize)
+	}
+
+	e := &endpoint{
+		mtu:        opts.MTU,
+		addr:       opts.Address,
+		vhostFD:    opts.VhostFD,
+		tapFD:      opts.TapFD,
+		bufferSize: align(virtioNetHdrSize+header.EthernetMinimumSize+int(opts.MTU), 64),
+		rx:         queue{kickFD: -1, callFD: -1},
+		tx:         queue{kickFD: -1, callFD: -1},
+	}
+
+	// Lay out the rx and tx virtqueues followed by their buffers.
+	pageSize := syscall.Getpagesize()
+	_, _, vringSize := vringLayout(size)
+	vringSize = align(vringSize, pageSize)
+	bufsSize := align(int(size)*e.bufferSize, pageSize)
+	mem, err := syscall.Mmap(-1, 0, 2*vringSize+2*bufsSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate virtqueues: %v", err)
+	}
+	e.mem = mem
+	e.rx.vq.init(size, mem[:vringSize], 0)
+	// Transmitted buffers are reclaimed when more are sent, so there is no
+	// need to be notified when vhost is done with them.
+	e.tx.vq.init(size, mem[vringSize:2*vringSize], vringAvailFNoInterrupt)
+	e.rx.bufs = mem[2*vringSize:][:int(size)*e.bufferSize]
+	e.tx.bufs = mem[2*vringSize+bufsSize:][:int(size)*e.bufferSize]
+
+	if err := e.setup(); err != nil {
+		e.cleanup()
+		return nil, err
+	}
+
+	// Every tx descriptor is free, and every rx descriptor is handed to
+	// vhost to receive packets into.
+	e.txFree = make([]uint16, 0, size)
+	for id := uint16(0); id < size; id++ {
+		e.txFree = append(e.txFree, id)
+		e.rx.vq.setDesc(id, addrOf(e.rx.buf(id, e.bufferSize)), uint32(e.bufferSize), vringDescFWrite)
+		e.rx.vq.push(id)
+	}
+	e.rx.kick()
+
+	return e, nil
+}
+
+// setup creates the eventfds of the virtqueues and configures vhost to use
+// them.
+func (e *endpoint) setup() error {
+	var err error
+	if e.rx.kickFD, err = unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC); err != nil {
+		return fmt.Errorf("eventfd failed: %v", err)
+	}
+	if e.rx.callFD, err = unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC); err != nil {
+		return fmt.Errorf("eventfd failed: %v", err)
+	}
+	if e.tx.kickFD, err = unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC); err != nil {
+		return fmt.Errorf("eventfd failed: %v", err)
+	}
+
+	if err := setOwner(e.vhostFD); err != nil {
+		return err
+	}
+	if err := setMemTable(e.vhostFD, e.mem); err != nil {
+		return err
+	}
+	if err := setVring(e.vhostFD, rxQueueIndex, &e.rx.vq, e.rx.kickFD, e.rx.callFD); err != nil {
+		return err
+	}
+	if err := setVring(e.vhostFD, txQueueIndex, &e.tx.vq, e.tx.kickFD, e.tx.callFD); err != nil {
+		return err
+	}
+	if err := setBackend(e.vhostFD, rxQueueIndex, e.tapFD); err != nil {
+		return err
+	}
+	if err := setBackend(e.vhostFD, txQueueIndex, e.tapFD); err != nil {
+		setBackend(e.vhostFD, rxQueueIndex, -1)
+		return err
+	}
+	return nil
+}
+
+// cleanup detaches vhost from the tap device and releases all resources
+// allocated by New. It must only be called once vhost may no longer be
+// attached to the virtqueues, or after detaching it.
+func (e *endpoint) cleanup() {
+	for _, fd := range []int{e.rx.kickFD, e.rx.callFD, e.tx.kickFD} {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+	}
+	syscall.Munmap(e.mem)
+}
+
+// detach stops vhost from processing the virtqueues.
+func (e *endpoint) detach() {
+	if err := setBackend(e.vhostFD, rxQueueIndex, -1); err != nil {
+		log.Warningf("Failed to detach vhost rx queue: %v", err)
+	}
+	if err := setBackend(e.vhostFD, txQueueIndex, -1); err != nil {
+		log.Warningf("Failed to detach vhost tx queue: %v", err)
+	}
+}
+
+// Close stops the endpoint and frees all resources associated with it.
+func (e *endpoint) Close() {
+	// Tell dispatch goroutine to stop, then signal its eventfd so that it
+	// wakes up in case it's sleeping.
+	atomic.StoreUint32(&e.stopRequested, 1)
+	syscall.Write(e.rx.callFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+
+	// Cleanup inline if the worker hasn't started yet; we also know it
+	// won't start from now on because stopRequested is set to 1.
+	e.mu.Lock()
+	workerPresent := e.workerStarted
+	e.mu.Unlock()
+
+	if !workerPresent {
+		e.detach()
+		e.cleanup()
+	}
+}
+
+// Wait implements stack.LinkEndpoint.Wait. It waits until all workers have
+// stopped after a Close() call.
+func (e *endpoint) Wait() {
+	e.completed.Wait()
+}
+
+// Attach implements stack.LinkEndpoint.Attach. It launches the goroutine that
+// reads packets from the rx queue.
+func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.mu.Lock()
+	if !e.workerStarted && atomic.LoadUint32(&e.stopRequested) == 0 {
+		e.workerStarted = true
+		e.completed.Add(1)
+		// Link endpoints are not savable. When transportation endpoints
+		// are saved, they stop sending outgoing packets and all
+		// incoming packets are rejected.
+		go e.dispatchLoop(dispatcher) // S/R-SAFE: see above.
+	}
+	e.mu.Unlock()
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *endpoint) IsAttached() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.workerStarted
+}
+
+// MTU implements stack.LinkEndpoint.MTU. It returns the value initialized
+// during construction.
+func (e *endpoint) MTU() uint32 {
+	return e.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return stack.CapabilityResolutionRequired
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. It returns the
+// ethernet frame header size.
+func (*endpoint) MaxHeaderLength() uint16 {
+	return header.EthernetMinimumSize
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress. It returns the local
+// link address.
+func (e *endpoint) LinkAddress() tcpip.LinkAddress {
+	return e.addr
+}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (e *endpoint) AddHeader(local, remote tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	ethHdr := &header.EthernetFields{
+		DstAddr: remote,
+		Type:    protocol,
+	}
+
+	// Preserve the src address if it's set in the route.
+	if local != "" {
+		ethHdr.SrcAddr = local
+	} else {
+		ethHdr.SrcAddr = e.addr
+	}
+	eth.Encode(ethHdr)
+}
+
+// reclaimTxLocked returns the tx descriptors vhost is done with to the free
+// list.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) reclaimTxLocked() {
+	for {
+		id, _, ok := e.tx.vq.pop()
+		if !ok {
+			return
+		}
+		e.txFree = append(e.txFree, id)
+	}
+}
+
+// enqueueLocked copies pkt into a free tx buffer and adds it to the tx queue.
+// vhost isn't notified of it until the queue is kicked.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) enqueueLocked(r *stack.Route, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	e.AddHeader(r.LocalLinkAddress, r.RemoteLinkAddress, protocol, pkt)
+
+	size := virtioNetHdrSize + pkt.Size()
+	if size > e.bufferSize {
+		return tcpip.ErrMessageTooLong
+	}
+	if len(e.txFree) == 0 {
+		e.reclaimTxLocked()
+		if len(e.txFree) == 0 {
+			return tcpip.ErrWouldBlock
+		}
+	}
+	id := e.txFree[len(e.txFree)-1]
+	e.txFree = e.txFree[:len(e.txFree)-1]
+
+	b := e.tx.buf(id, e.bufferSize)[:size]
+	// The virtio net header is all zeroes, as no offloads are used.
+	for i := range b[:virtioNetHdrSize] {
+		b[i] = 0
+	}
+	off := virtioNetHdrSize
+	for _, v := range pkt.Views() {
+		off += copy(b[off:], v)
+	}
+	e.tx.vq.setDesc(id, addrOf(b), uint32(size), 0)
+	e.tx.vq.push(id)
+	return nil
+}
+
+// WritePacket writes outbound packets to the tx queue. If it is full, the
+// packet is dropped.
+func (e *endpoint) WritePacket(r *stack.Route, _ *stack.GSO, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enqueueLocked(r, protocol, pkt); err != nil {
+		return err
+	}
+	e.tx.kick()
+	return nil
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets. Packets are
+// added to the tx queue in order until it fills up, and vhost is notified of
+// them at once.
+func (e *endpoint) WritePackets(r *stack.Route, _ *stack.GSO, pkts stack.PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	var err *tcpip.Error
+	for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
+		if err = e.enqueueLocked(r, protocol, pkt); err != nil {
+			break
+		}
+		n++
+	}
+	if n > 0 {
+		e.tx.kick()
+	}
+	return n, err
+}
+
+// dispatchLoop reads packets from the rx queue in a loop and dispatches them
+// to the network stack.
+func (e *endpoint) dispatchLoop(d stack.NetworkDispatcher) {
+	var event [8]byte
+	for atomic.LoadUint32(&e.stopRequested) == 0 {
+		received := false
+		for {
+			id, n, ok := e.rx.vq.pop()
+			if !ok {
+				break
+			}
+			received = true
+			if int(n) >= virtioNetHdrSize+header.EthernetMinimumSize && int(n) <= e.bufferSize {
+				e.deliver(d, e.rx.buf(id, e.bufferSize)[virtioNetHdrSize:n])
+			}
+			// Hand the buffer back to vhost.
+			e.rx.vq.push(id)
+		}
+		if received {
+			e.rx.kick()
+			continue
+		}
+
+		// Wait for vhost to signal that it used more buffers.
+		if _, err := rawfile.BlockingRead(e.rx.callFD, event[:]); err != nil {
+			log.Warningf("Failed to wait for vhost: %v", err)
+			break
+		}
+	}
+
+	// Clean state.
+	e.detach()
+	e.cleanup()
+
+	e.completed.Done()
+}
+
+// deliver copies the frame in b out of the shared memory and sends it up the
+// stack.
+func (e *endpoint) deliver(d stack.NetworkDispatcher, b []byte) {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: buffer.NewViewFromBytes(b).ToVectorisedView(),
+	})
+	hdr, ok := pkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	if !ok {
+		return
+	}
+	eth := header.Ethernet(hdr)
+	d.DeliverNetworkPacket(eth.SourceAddress(), eth.DestinationAddress(), eth.Type(), pkt)
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (*endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
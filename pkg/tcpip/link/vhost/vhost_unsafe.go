@@ -0,0 +1,155 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package vhost
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// ioctls from <linux/vhost.h>.
+const (
+	_VHOST_SET_FEATURES    = 0x4008af00
+	_VHOST_SET_OWNER       = 0xaf01
+	_VHOST_SET_MEM_TABLE   = 0x4008af03
+	_VHOST_SET_VRING_NUM   = 0x4008af10
+	_VHOST_SET_VRING_ADDR  = 0x4028af11
+	_VHOST_SET_VRING_BASE  = 0x4008af12
+	_VHOST_SET_VRING_KICK  = 0x4008af20
+	_VHOST_SET_VRING_CALL  = 0x4008af21
+	_VHOST_NET_SET_BACKEND = 0x4008af30
+)
+
+// vhostMemoryRegion is struct vhost_memory_region.
+type vhostMemoryRegion struct {
+	guestPhysAddr uint64
+	memorySize    uint64
+	userspaceAddr uint64
+	flagsPadding  uint64
+}
+
+// vhostMemory is struct vhost_memory with a single region.
+type vhostMemory struct {
+	nregions uint32
+	padding  uint32
+	regions  [1]vhostMemoryRegion
+}
+
+// vhostVringState is struct vhost_vring_state.
+type vhostVringState struct {
+	index uint32
+	num   uint32
+}
+
+// vhostVringFile is struct vhost_vring_file.
+type vhostVringFile struct {
+	index uint32
+	fd    int32
+}
+
+// vhostVringAddr is struct vhost_vring_addr.
+type vhostVringAddr struct {
+	index         uint32
+	flags         uint32
+	descUserAddr  uint64
+	usedUserAddr  uint64
+	availUserAddr uint64
+	logGuestAddr  uint64
+}
+
+func vhostIoctl(fd int, req uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setOwner makes the calling process the owner of the vhost device, and sets
+// the features it acknowledges. No features are acknowledged: buffers start
+// with a legacy virtio net header, which is passed to and from the tap
+// device as is.
+func setOwner(fd int) error {
+	if err := vhostIoctl(fd, _VHOST_SET_OWNER, 0); err != nil {
+		return fmt.Errorf("VHOST_SET_OWNER failed: %v", err)
+	}
+	var features uint64
+	if err := vhostIoctl(fd, _VHOST_SET_FEATURES, uintptr(unsafe.Pointer(&features))); err != nil {
+		return fmt.Errorf("VHOST_SET_FEATURES failed: %v", err)
+	}
+	return nil
+}
+
+// setMemTable tells vhost that descriptor addresses are addresses in mem. The
+// memory table maps them to themselves.
+func setMemTable(fd int, mem []byte) error {
+	addr := addrOf(mem)
+	m := vhostMemory{
+		nregions: 1,
+		regions: [1]vhostMemoryRegion{{
+			guestPhysAddr: addr,
+			memorySize:    uint64(len(mem)),
+			userspaceAddr: addr,
+		}},
+	}
+	if err := vhostIoctl(fd, _VHOST_SET_MEM_TABLE, uintptr(unsafe.Pointer(&m))); err != nil {
+		return fmt.Errorf("VHOST_SET_MEM_TABLE failed: %v", err)
+	}
+	return nil
+}
+
+// setVring sets up virtqueue index of the vhost device to be q, with the
+// given kick and call eventfds. callFD may be -1 if no notifications are
+// wanted.
+func setVring(fd int, index uint32, q *virtqueue, kickFD, callFD int) error {
+	num := vhostVringState{index: index, num: uint32(q.size)}
+	if err := vhostIoctl(fd, _VHOST_SET_VRING_NUM, uintptr(unsafe.Pointer(&num))); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_NUM(%d) failed: %v", index, err)
+	}
+	base := vhostVringState{index: index}
+	if err := vhostIoctl(fd, _VHOST_SET_VRING_BASE, uintptr(unsafe.Pointer(&base))); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_BASE(%d) failed: %v", index, err)
+	}
+	addr := vhostVringAddr{
+		index:         index,
+		descUserAddr:  addrOf(q.desc),
+		usedUserAddr:  addrOf(q.used),
+		availUserAddr: addrOf(q.avail),
+	}
+	if err := vhostIoctl(fd, _VHOST_SET_VRING_ADDR, uintptr(unsafe.Pointer(&addr))); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_ADDR(%d) failed: %v", index, err)
+	}
+	kick := vhostVringFile{index: index, fd: int32(kickFD)}
+	if err := vhostIoctl(fd, _VHOST_SET_VRING_KICK, uintptr(unsafe.Pointer(&kick))); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_KICK(%d) failed: %v", index, err)
+	}
+	call := vhostVringFile{index: index, fd: int32(callFD)}
+	if err := vhostIoctl(fd, _VHOST_SET_VRING_CALL, uintptr(unsafe.Pointer(&call))); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_CALL(%d) failed: %v", index, err)
+	}
+	return nil
+}
+
+// setBackend makes the tap device tapFD the backend of virtqueue index. It may
+// be called with tapFD -1 to detach the backend.
+func setBackend(fd int, index uint32, tapFD int) error {
+	b := vhostVringFile{index: index, fd: int32(tapFD)}
+	if err := vhostIoctl(fd, _VHOST_NET_SET_BACKEND, uintptr(unsafe.Pointer(&b))); err != nil {
+		return fmt.Errorf("VHOST_NET_SET_BACKEND(%d) failed: %v", index, err)
+	}
+	return nil
+}
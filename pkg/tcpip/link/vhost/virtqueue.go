@@ -0,0 +1,135 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhost
+
+import (
+	"encoding/binary"
+)
+
+// Constants from the virtio specification, section 2.6 "Split Virtqueues".
+const (
+	vringDescFWrite = 2
+
+	vringAvailFNoInterrupt = 1
+	vringUsedFNoNotify     = 1
+
+	vringDescSize     = 16
+	vringUsedElemSize = 8
+
+	// vringRingHeaderSize is the size of the flags and idx fields that
+	// precede the avail and used rings.
+	vringRingHeaderSize = 4
+
+	// vringDescAlign and vringUsedAlign are the alignments required of the
+	// descriptor table and used ring. The avail ring needs only 2 bytes.
+	vringDescAlign = 16
+	vringUsedAlign = 4
+)
+
+// vringLayout returns the offsets of the avail and used rings of a virtqueue
+// of the given size, relative to its descriptor table, and the total size of
+// the virtqueue.
+func vringLayout(size uint16) (availOff, usedOff, total int) {
+	availOff = int(size) * vringDescSize
+	availSize := vringRingHeaderSize + 2*int(size) + 2
+	usedOff = align(availOff+availSize, vringUsedAlign)
+	usedSize := vringRingHeaderSize + vringUsedElemSize*int(size) + 2
+	return availOff, usedOff, usedOff + usedSize
+}
+
+// align rounds v up to a multiple of a, which must be a power of 2.
+func align(v, a int) int {
+	return (v + a - 1) &^ (a - 1)
+}
+
+// virtqueue is the driver side of a split virtqueue. Each descriptor describes
+// a single buffer, and is identified by its index in the descriptor table.
+//
+// virtqueue isn't thread-safe.
+type virtqueue struct {
+	size uint16
+
+	// desc, avail and used are the descriptor table, the avail ring and the
+	// used ring, shared with the device.
+	desc  []byte
+	avail []byte
+	used  []byte
+
+	// availFlags are the flags published in the avail ring.
+	availFlags uint16
+
+	// availIdx is the index of the next entry of the avail ring to be
+	// written. It is published to the device by publish.
+	availIdx uint16
+
+	// usedIdx is the index of the next entry of the used ring to be read.
+	usedIdx uint16
+}
+
+// init initializes q over the virtqueue in mem, which must be laid out as
+// described by vringLayout and be zeroed.
+func (q *virtqueue) init(size uint16, mem []byte, availFlags uint16) {
+	availOff, usedOff, total := vringLayout(size)
+	mem = mem[:total]
+	q.size = size
+	q.desc = mem[:availOff]
+	q.avail = mem[availOff:usedOff]
+	q.used = mem[usedOff:]
+	q.availFlags = availFlags
+	q.availIdx = 0
+	q.usedIdx = 0
+	q.publish()
+}
+
+// setDesc sets descriptor id to describe the buffer of length bytes at addr.
+func (q *virtqueue) setDesc(id uint16, addr uint64, length uint32, flags uint16) {
+	d := q.desc[int(id)*vringDescSize:][:vringDescSize]
+	binary.LittleEndian.PutUint64(d[0:], addr)
+	binary.LittleEndian.PutUint32(d[8:], length)
+	binary.LittleEndian.PutUint16(d[12:], flags)
+	binary.LittleEndian.PutUint16(d[14:], 0)
+}
+
+// push adds descriptor id to the avail ring. It isn't visible to the device
+// until publish is called.
+func (q *virtqueue) push(id uint16) {
+	binary.LittleEndian.PutUint16(q.avail[vringRingHeaderSize+2*int(q.availIdx%q.size):], id)
+	q.availIdx++
+}
+
+// publish makes the descriptors pushed so far visible to the device.
+func (q *virtqueue) publish() {
+	storeRingHeader(q.avail, q.availFlags, q.availIdx)
+}
+
+// pop returns the next descriptor returned by the device in the used ring,
+// and the number of bytes the device wrote to it.
+func (q *virtqueue) pop() (id uint16, length uint32, ok bool) {
+	if _, idx := loadRingHeader(q.used); idx == q.usedIdx {
+		return 0, 0, false
+	}
+	e := q.used[vringRingHeaderSize+vringUsedElemSize*int(q.usedIdx%q.size):]
+	id = uint16(binary.LittleEndian.Uint32(e[0:]))
+	length = binary.LittleEndian.Uint32(e[4:])
+	q.usedIdx++
+	return id, length, true
+}
+
+// needsKick returns true if the device asked to be notified of new descriptors
+// in the avail ring.
+func (q *virtqueue) needsKick() bool {
+	flags, _ := loadRingHeader(q.used)
+	return flags&vringUsedFNoNotify == 0
+}
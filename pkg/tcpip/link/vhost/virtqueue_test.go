@@ -0,0 +1,151 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhost
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testDevice is the device side of a virtqueue, as vhost would access it.
+type testDevice struct {
+	q *virtqueue
+
+	// lastAvail is the index of the next entry of the avail ring to be
+	// consumed.
+	lastAvail uint16
+
+	// usedIdx is the index of the next entry of the used ring to be
+	// written.
+	usedIdx uint16
+
+	// usedFlags are the flags published in the used ring.
+	usedFlags uint16
+}
+
+// desc returns the buffer address, length and flags of descriptor id.
+func (d *testDevice) desc(id uint16) (uint64, uint32, uint16) {
+	b := d.q.desc[int(id)*vringDescSize:]
+	return binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint32(b[8:]), binary.LittleEndian.Uint16(b[12:])
+}
+
+// consume returns the next descriptor made available by the driver.
+func (d *testDevice) consume() (uint16, bool) {
+	if _, idx := loadRingHeader(d.q.avail); idx == d.lastAvail {
+		return 0, false
+	}
+	id := binary.LittleEndian.Uint16(d.q.avail[vringRingHeaderSize+2*int(d.lastAvail%d.q.size):])
+	d.lastAvail++
+	return id, true
+}
+
+// use returns descriptor id to the driver, with n bytes written to it.
+func (d *testDevice) use(id uint16, n uint32) {
+	e := d.q.used[vringRingHeaderSize+vringUsedElemSize*int(d.usedIdx%d.q.size):]
+	binary.LittleEndian.PutUint32(e, uint32(id))
+	binary.LittleEndian.PutUint32(e[4:], n)
+	d.usedIdx++
+	storeRingHeader(d.q.used, d.usedFlags, d.usedIdx)
+}
+
+func newTestQueue(t *testing.T, size uint16, availFlags uint16) (*virtqueue, *testDevice) {
+	t.Helper()
+	_, _, total := vringLayout(size)
+	var q virtqueue
+	q.init(size, make([]byte, total), availFlags)
+	return &q, &testDevice{q: &q}
+}
+
+func TestVringLayout(t *testing.T) {
+	for _, size := range []uint16{1, 2, 256, maxQueueSize} {
+		availOff, usedOff, total := vringLayout(size)
+		if availOff != int(size)*vringDescSize {
+			t.Errorf("vringLayout(%d): got availOff = %d, want = %d", size, availOff, int(size)*vringDescSize)
+		}
+		if usedOff%vringUsedAlign != 0 || usedOff < availOff+vringRingHeaderSize+2*int(size)+2 {
+			t.Errorf("vringLayout(%d): got usedOff = %d, overlapping the avail ring at %d or misaligned", size, usedOff, availOff)
+		}
+		if want := usedOff + vringRingHeaderSize + vringUsedElemSize*int(size) + 2; total != want {
+			t.Errorf("vringLayout(%d): got total = %d, want = %d", size, total, want)
+		}
+	}
+}
+
+func TestVirtqueueRoundTrip(t *testing.T) {
+	const size = 4
+	q, d := newTestQueue(t, size, vringAvailFNoInterrupt)
+
+	if flags, idx := loadRingHeader(q.avail); flags != vringAvailFNoInterrupt || idx != 0 {
+		t.Fatalf("got avail ring flags, idx = %d, %d, want = %d, 0", flags, idx, vringAvailFNoInterrupt)
+	}
+
+	// Go around the rings several times to check that indices wrap.
+	for round := 0; round < 5*size; round++ {
+		for id := uint16(0); id < size; id++ {
+			q.setDesc(id, uint64(1000+id), uint32(id+1), vringDescFWrite)
+			q.push(id)
+		}
+		if _, ok := d.consume(); ok {
+			t.Fatalf("round %d: device consumed a descriptor before it was published", round)
+		}
+		q.publish()
+
+		for want := uint16(0); want < size; want++ {
+			id, ok := d.consume()
+			if !ok {
+				t.Fatalf("round %d: device failed to consume descriptor %d", round, want)
+			}
+			if id != want {
+				t.Fatalf("round %d: device consumed descriptor %d, want = %d", round, id, want)
+			}
+			addr, length, flags := d.desc(id)
+			if addr != uint64(1000+id) || length != uint32(id+1) || flags != vringDescFWrite {
+				t.Fatalf("round %d: got descriptor %d = (%d, %d, %d), want = (%d, %d, %d)", round, id, addr, length, flags, 1000+id, id+1, vringDescFWrite)
+			}
+		}
+		if _, ok := d.consume(); ok {
+			t.Fatalf("round %d: device consumed more descriptors than available", round)
+		}
+
+		// Return the descriptors in reverse order.
+		for id := int(size) - 1; id >= 0; id-- {
+			d.use(uint16(id), uint32(10*id))
+		}
+		for want := int(size) - 1; want >= 0; want-- {
+			id, n, ok := q.pop()
+			if !ok {
+				t.Fatalf("round %d: failed to pop descriptor %d", round, want)
+			}
+			if int(id) != want || n != uint32(10*want) {
+				t.Fatalf("round %d: got pop() = %d, %d, want = %d, %d", round, id, n, want, 10*want)
+			}
+		}
+		if id, n, ok := q.pop(); ok {
+			t.Fatalf("round %d: got pop() = %d, %d, true on empty used ring", round, id, n)
+		}
+	}
+}
+
+func TestVirtqueueNeedsKick(t *testing.T) {
+	q, d := newTestQueue(t, 2, 0)
+	if !q.needsKick() {
+		t.Errorf("got needsKick() = false, want = true")
+	}
+	d.usedFlags = vringUsedFNoNotify
+	storeRingHeader(q.used, d.usedFlags, d.usedIdx)
+	if q.needsKick() {
+		t.Errorf("got needsKick() = true with VRING_USED_F_NO_NOTIFY, want = false")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhost
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// loadRingHeader atomically loads the flags and idx fields of the avail or used
+// ring in ring. The two little-endian 16-bit fields are loaded as one 32-bit
+// word, so that idx is read with acquire semantics.
+func loadRingHeader(ring []byte) (flags, idx uint16) {
+	w := atomic.LoadUint32((*uint32)(unsafe.Pointer(&ring[0])))
+	return uint16(w), uint16(w >> 16)
+}
+
+// storeRingHeader atomically stores the flags and idx fields of the avail or
+// used ring in ring, so that the ring entries written before are visible to
+// the other side once it observes idx.
+func storeRingHeader(ring []byte, flags, idx uint16) {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&ring[0])), uint32(flags)|uint32(idx)<<16)
+}
+
+// addrOf returns the address of b in the sentry's address space, which is
+// also how vhost addresses it given the identity memory table set up by New.
+func addrOf(b []byte) uint64 {
+	return uint64(uintptr(unsafe.Pointer(&b[0])))
+}
@@ -20,7 +20,9 @@ package arp
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -31,6 +33,10 @@ import (
 const (
 	// ProtocolNumber is the ARP protocol number.
 	ProtocolNumber = header.ARPProtocolNumber
+
+	// DefaultGratuitousARPInterval is the default interval between the
+	// gratuitous ARP requests announcing an address.
+	DefaultGratuitousARPInterval = time.Second
 )
 
 // ARP endpoints need to implement stack.NetworkEndpoint because the stack
@@ -38,6 +44,107 @@ const (
 // facility provided by the stack to deliver packets to a layer above
 // the link-layer is via stack.NetworkEndpoint.HandlePacket.
 var _ stack.NetworkEndpoint = (*endpoint)(nil)
+var _ stack.AddressAnnouncer = (*endpoint)(nil)
+var _ PolicyEndpoint = (*endpoint)(nil)
+
+// IgnoreMode selects the ARP requests an interface answers, like the
+// arp_ignore sysctl of Linux. Modes have the values of the sysctl.
+type IgnoreMode int
+
+const (
+	// IgnoreNone answers requests for any local address, assigned to any
+	// interface.
+	IgnoreNone IgnoreMode = 0
+
+	// IgnoreOtherInterfaces only answers requests for the addresses assigned
+	// to the interface the requests are received on.
+	IgnoreOtherInterfaces IgnoreMode = 1
+
+	// IgnoreOtherSubnets is like IgnoreOtherInterfaces, but also requires the
+	// sender to be in the subnet of the requested address.
+	IgnoreOtherSubnets IgnoreMode = 2
+
+	// IgnoreAll answers no request.
+	IgnoreAll IgnoreMode = 8
+)
+
+// AnnounceMode selects the source address of the ARP requests sent by an
+// interface, like the arp_announce sysctl of Linux. Modes have the values of
+// the sysctl.
+type AnnounceMode int
+
+const (
+	// AnnounceAny uses the source address of the packet the link address is
+	// resolved for, which may be assigned to any interface.
+	AnnounceAny AnnounceMode = 0
+
+	// AnnounceSameSubnet avoids source addresses outside the subnets of the
+	// interface which include the target address, if there is such a subnet.
+	AnnounceSameSubnet AnnounceMode = 1
+
+	// AnnounceBest always uses an address of the interface from a subnet
+	// which includes the target address or, failing that, the primary address
+	// of the interface.
+	AnnounceBest AnnounceMode = 2
+)
+
+// Policy is the ARP policy of an interface, which governs the requests it
+// answers and the source addresses of its requests. It avoids ARP flux on
+// hosts with several interfaces on the same link.
+type Policy struct {
+	// Ignore selects the requests which are answered, like arp_ignore.
+	Ignore IgnoreMode
+
+	// Announce selects the source address of requests, like arp_announce.
+	Announce AnnounceMode
+
+	// Filter only answers requests if replies to their sender would be
+	// routed out of the interface the requests are received on, like
+	// arp_filter.
+	Filter bool
+
+	// DropGratuitous ignores gratuitous ARP requests and replies, whose
+	// sender announces its own address, like drop_gratuitous_arp.
+	DropGratuitous bool
+
+	// ProtectGateways ignores the requests and replies advertising another
+	// link address for a gateway of the routes through the interface, once
+	// the link address of the gateway is known. Such packets are reported as
+	// stack.NeighborEventConflict events. It requires the neighbor cache.
+	ProtectGateways bool
+}
+
+// DefaultPolicy is the policy of new interfaces. Unlike Linux, interfaces only
+// answer requests for their own addresses by default.
+var DefaultPolicy = Policy{
+	Ignore:   IgnoreOtherInterfaces,
+	Announce: AnnounceAny,
+}
+
+// valid returns true if p only holds known modes.
+func (p Policy) valid() bool {
+	switch p.Ignore {
+	case IgnoreNone, IgnoreOtherInterfaces, IgnoreOtherSubnets, IgnoreAll:
+	default:
+		return false
+	}
+	switch p.Announce {
+	case AnnounceAny, AnnounceSameSubnet, AnnounceBest:
+	default:
+		return false
+	}
+	return true
+}
+
+// PolicyEndpoint is an ARP endpoint whose policy can be changed.
+type PolicyEndpoint interface {
+	// Policy returns the ARP policy of the interface.
+	Policy() Policy
+
+	// SetPolicy sets the ARP policy of the interface. It returns
+	// tcpip.ErrInvalidOptionValue if p holds unknown modes.
+	SetPolicy(p Policy) *tcpip.Error
+}
 
 type endpoint struct {
 	protocol *protocol
@@ -50,6 +157,39 @@ type endpoint struct {
 	nic           stack.NetworkInterface
 	linkAddrCache stack.LinkAddressCache
 	nud           stack.NUDHandler
+
+	mu struct {
+		sync.Mutex
+
+		// announcements holds the number of gratuitous ARP requests left to
+		// send for the addresses being announced.
+		announcements map[tcpip.Address]uint8
+
+		// announceTimer fires when the next gratuitous ARP requests are due. It
+		// is nil when no address is being announced.
+		announceTimer tcpip.Timer
+
+		// policy is the ARP policy of the interface.
+		policy Policy
+	}
+}
+
+// Policy implements PolicyEndpoint.
+func (e *endpoint) Policy() Policy {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mu.policy
+}
+
+// SetPolicy implements PolicyEndpoint.
+func (e *endpoint) SetPolicy(p Policy) *tcpip.Error {
+	if !p.valid() {
+		return tcpip.ErrInvalidOptionValue
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mu.policy = p
+	return nil
 }
 
 func (e *endpoint) Enable() *tcpip.Error {
@@ -82,6 +222,110 @@ func (e *endpoint) setEnabled(v bool) {
 
 func (e *endpoint) Disable() {
 	e.setEnabled(false)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mu.announceTimer != nil {
+		e.mu.announceTimer.Stop()
+		e.mu.announceTimer = nil
+	}
+	e.mu.announcements = nil
+}
+
+// AnnounceAddresses implements stack.AddressAnnouncer.
+//
+// Addresses are announced with gratuitous ARP requests, like with the
+// arp_notify sysctl of Linux.
+func (e *endpoint) AnnounceAddresses(addrs []tcpip.Address) {
+	count := e.protocol.options.GratuitousARPs
+	if count == 0 || !e.isEnabled() {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, addr := range addrs {
+		if len(addr) != header.IPv4AddressSize {
+			continue
+		}
+		if e.mu.announcements == nil {
+			e.mu.announcements = make(map[tcpip.Address]uint8)
+		}
+		e.mu.announcements[addr] = count
+	}
+	if len(e.mu.announcements) != 0 && e.mu.announceTimer == nil {
+		e.scheduleAnnounceLocked(0)
+	}
+}
+
+// scheduleAnnounceLocked schedules the next gratuitous ARP requests in d.
+//
+// Precondition: e.mu must be locked.
+func (e *endpoint) scheduleAnnounceLocked(d time.Duration) {
+	var timer tcpip.Timer
+	// timer is only read by the timer function once e.mu is acquired, after
+	// it is set below.
+	timer = e.protocol.stack.Clock().AfterFunc(d, func() {
+		e.announce(timer)
+	})
+	e.mu.announceTimer = timer
+}
+
+// announce sends the next gratuitous ARP requests of the addresses being
+// announced when timer fires.
+func (e *endpoint) announce(timer tcpip.Timer) {
+	e.mu.Lock()
+	if e.mu.announceTimer != timer {
+		// Announcements were stopped since timer fired.
+		e.mu.Unlock()
+		return
+	}
+	addrs := make([]tcpip.Address, 0, len(e.mu.announcements))
+	for addr, remaining := range e.mu.announcements {
+		addrs = append(addrs, addr)
+		if remaining > 1 {
+			e.mu.announcements[addr] = remaining - 1
+		} else {
+			delete(e.mu.announcements, addr)
+		}
+	}
+	if len(e.mu.announcements) != 0 {
+		e.scheduleAnnounceLocked(e.protocol.options.GratuitousARPInterval)
+	} else {
+		e.mu.announceTimer = nil
+	}
+	e.mu.Unlock()
+
+	// Requests are sent without holding e.mu, as the stack may hold the locks
+	// of the NIC while announcing addresses.
+	for _, addr := range addrs {
+		// Addresses may have been removed since they were announced.
+		if e.protocol.stack.CheckLocalAddress(e.nic.ID(), header.IPv4ProtocolNumber, addr) != 0 {
+			_ = e.sendGratuitousARP(addr)
+		}
+	}
+}
+
+// sendGratuitousARP broadcasts an ARP request for addr from addr, so that
+// neighbors update the link address they cache for it.
+func (e *endpoint) sendGratuitousARP(addr tcpip.Address) *tcpip.Error {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(e.nic.MaxHeaderLength()) + header.ARPSize,
+	})
+	h := header.ARP(pkt.NetworkHeader().Push(header.ARPSize))
+	pkt.NetworkProtocolNumber = ProtocolNumber
+	h.SetIPv4OverEthernet()
+	h.SetOp(header.ARPRequest)
+	// TODO(gvisor.dev/issue/4582): check copied length once TAP devices have a
+	// link address.
+	_ = copy(h.HardwareAddressSender(), e.nic.LinkAddress())
+	if n := copy(h.ProtocolAddressSender(), addr); n != header.IPv4AddressSize {
+		panic(fmt.Sprintf("copied %d bytes, expected %d bytes", n, header.IPv4AddressSize))
+	}
+	if n := copy(h.ProtocolAddressTarget(), addr); n != header.IPv4AddressSize {
+		panic(fmt.Sprintf("copied %d bytes, expected %d bytes", n, header.IPv4AddressSize))
+	}
+	return e.nic.WritePacketToRemote(header.EthernetBroadcastAddress, nil /* gso */, ProtocolNumber, pkt)
 }
 
 // DefaultTTL is unused for ARP. It implements stack.NetworkEndpoint.
@@ -98,7 +342,13 @@ func (e *endpoint) MaxHeaderLength() uint16 {
 	return e.nic.MaxHeaderLength() + header.ARPSize
 }
 
-func (*endpoint) Close() {}
+func (e *endpoint) Close() {
+	e.protocol.mu.Lock()
+	defer e.protocol.mu.Unlock()
+	if e.protocol.mu.eps[e.nic.ID()] == e {
+		delete(e.protocol.mu.eps, e.nic.ID())
+	}
+}
 
 func (*endpoint) WritePacket(*stack.Route, *stack.GSO, stack.NetworkHeaderParams, *stack.PacketBuffer) *tcpip.Error {
 	return tcpip.ErrNotSupported
@@ -128,23 +378,26 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 		return
 	}
 
+	sender := tcpip.Address(h.ProtocolAddressSender())
+	policy := e.Policy()
+	if policy.DropGratuitous && sender == tcpip.Address(h.ProtocolAddressTarget()) {
+		return
+	}
+	if policy.ProtectGateways && e.isGateway(sender) && e.protocol.stack.CheckNeighborConflict(e.nic.ID(), sender, tcpip.LinkAddress(h.HardwareAddressSender())) {
+		return
+	}
+
 	switch h.Op() {
 	case header.ARPRequest:
-		localAddr := tcpip.Address(h.ProtocolAddressTarget())
+		if !e.answers(tcpip.Address(h.ProtocolAddressTarget()), tcpip.Address(h.ProtocolAddressSender())) {
+			return // we have no useful answer, ignore the request
+		}
 
 		if e.nud == nil {
-			if e.linkAddrCache.CheckLocalAddress(e.nic.ID(), header.IPv4ProtocolNumber, localAddr) == 0 {
-				return // we have no useful answer, ignore the request
-			}
-
 			addr := tcpip.Address(h.ProtocolAddressSender())
 			linkAddr := tcpip.LinkAddress(h.HardwareAddressSender())
 			e.linkAddrCache.AddLinkAddress(e.nic.ID(), addr, linkAddr)
 		} else {
-			if e.protocol.stack.CheckLocalAddress(e.nic.ID(), header.IPv4ProtocolNumber, localAddr) == 0 {
-				return // we have no useful answer, ignore the request
-			}
-
 			remoteAddr := tcpip.Address(h.ProtocolAddressSender())
 			remoteLinkAddr := tcpip.LinkAddress(h.HardwareAddressSender())
 			e.nud.HandleProbe(remoteAddr, ProtocolNumber, remoteLinkAddr, e.protocol)
@@ -203,9 +456,64 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 	}
 }
 
+// isGateway returns true if addr is the gateway of a route through the
+// interface.
+func (e *endpoint) isGateway(addr tcpip.Address) bool {
+	for _, r := range e.protocol.stack.GetRouteTable() {
+		if r.NIC == e.nic.ID() && r.Gateway == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// answers returns true if the request of sender for the link address of
+// target is answered, as per the policy of e.
+func (e *endpoint) answers(target, sender tcpip.Address) bool {
+	policy := e.Policy()
+	s := e.protocol.stack
+	switch policy.Ignore {
+	case IgnoreAll:
+		return false
+	case IgnoreNone:
+		if s.CheckLocalAddress(0 /* nicID */, header.IPv4ProtocolNumber, target) == 0 {
+			return false
+		}
+	case IgnoreOtherInterfaces:
+		if s.CheckLocalAddress(e.nic.ID(), header.IPv4ProtocolNumber, target) == 0 {
+			return false
+		}
+	case IgnoreOtherSubnets:
+		subnet, ok := e.protocol.subnetOf(e.nic.ID(), target)
+		if !ok || !subnet.Contains(sender) {
+			return false
+		}
+	}
+
+	if policy.Filter && sender != header.IPv4Any {
+		r, err := s.FindRoute(0 /* id */, "" /* localAddr */, sender, header.IPv4ProtocolNumber, false /* multicastLoop */)
+		if err != nil {
+			return false
+		}
+		defer r.Release()
+		if r.NICID() != e.nic.ID() {
+			return false
+		}
+	}
+	return true
+}
+
 // protocol implements stack.NetworkProtocol and stack.LinkAddressResolver.
 type protocol struct {
-	stack *stack.Stack
+	stack   *stack.Stack
+	options Options
+
+	mu struct {
+		sync.Mutex
+
+		// eps holds the endpoints of the protocol by NIC.
+		eps map[tcpip.NICID]*endpoint
+	}
 }
 
 func (p *protocol) Number() tcpip.NetworkProtocolNumber { return ProtocolNumber }
@@ -223,9 +531,45 @@ func (p *protocol) NewEndpoint(nic stack.NetworkInterface, linkAddrCache stack.L
 		linkAddrCache: linkAddrCache,
 		nud:           nud,
 	}
+	e.mu.policy = DefaultPolicy
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mu.eps[nic.ID()] = e
 	return e
 }
 
+// policy returns the ARP policy of NIC id.
+func (p *protocol) policy(id tcpip.NICID) Policy {
+	p.mu.Lock()
+	e, ok := p.mu.eps[id]
+	p.mu.Unlock()
+	if !ok {
+		return DefaultPolicy
+	}
+	return e.Policy()
+}
+
+// subnetOf returns the subnet of addr, an address assigned to NIC id.
+func (p *protocol) subnetOf(id tcpip.NICID, addr tcpip.Address) (tcpip.Subnet, bool) {
+	for _, a := range p.stack.AllAddresses()[id] {
+		if a.Protocol == header.IPv4ProtocolNumber && a.AddressWithPrefix.Address == addr {
+			return a.AddressWithPrefix.Subnet(), true
+		}
+	}
+	return tcpip.Subnet{}, false
+}
+
+// sourceFor returns the address of NIC id from a subnet which includes target.
+func (p *protocol) sourceFor(id tcpip.NICID, target tcpip.Address) (tcpip.Address, bool) {
+	for _, a := range p.stack.AllAddresses()[id] {
+		if a.Protocol == header.IPv4ProtocolNumber && a.AddressWithPrefix.Subnet().Contains(target) {
+			return a.AddressWithPrefix.Address, true
+		}
+	}
+	return "", false
+}
+
 // LinkAddressProtocol implements stack.LinkAddressResolver.LinkAddressProtocol.
 func (*protocol) LinkAddressProtocol() tcpip.NetworkProtocolNumber {
 	return header.IPv4ProtocolNumber
@@ -238,6 +582,23 @@ func (p *protocol) LinkAddressRequest(targetAddr, localAddr tcpip.Address, remot
 	}
 
 	nicID := nic.ID()
+	switch p.policy(nicID).Announce {
+	case AnnounceSameSubnet:
+		if len(localAddr) != 0 {
+			if subnet, ok := p.subnetOf(nicID, localAddr); ok && subnet.Contains(targetAddr) {
+				break
+			}
+		}
+		if addr, ok := p.sourceFor(nicID, targetAddr); ok {
+			localAddr = addr
+		}
+	case AnnounceBest:
+		localAddr = ""
+		if addr, ok := p.sourceFor(nicID, targetAddr); ok {
+			localAddr = addr
+		}
+	}
+
 	if len(localAddr) == 0 {
 		addr, err := p.stack.GetMainNICAddress(nicID, header.IPv4ProtocolNumber)
 		if err != nil {
@@ -249,7 +610,9 @@ func (p *protocol) LinkAddressRequest(targetAddr, localAddr tcpip.Address, remot
 		}
 
 		localAddr = addr.Address
-	} else if p.stack.CheckLocalAddress(nicID, header.IPv4ProtocolNumber, localAddr) == 0 {
+	} else if p.stack.CheckLocalAddress(0 /* nicID */, header.IPv4ProtocolNumber, localAddr) == 0 {
+		// The source address may be assigned to any NIC, like with
+		// AnnounceAny.
 		return tcpip.ErrBadLocalAddress
 	}
 
@@ -304,7 +667,39 @@ func (*protocol) Parse(pkt *stack.PacketBuffer) (proto tcpip.TransportProtocolNu
 	return 0, false, parse.ARP(pkt)
 }
 
+// Options holds options of the ARP protocol.
+type Options struct {
+	// GratuitousARPs is the number of gratuitous ARP requests sent to
+	// announce an address when it is added to an enabled NIC, when its NIC is
+	// enabled, or when the link address of its NIC changes.
+	//
+	// Note, a value of zero disables gratuitous ARP, like the arp_notify
+	// sysctl of Linux.
+	GratuitousARPs uint8
+
+	// GratuitousARPInterval is the interval between the gratuitous ARP
+	// requests announcing an address. DefaultGratuitousARPInterval is used if
+	// it is zero.
+	GratuitousARPInterval time.Duration
+}
+
+// NewProtocolWithOptions returns an ARP network protocol factory that will
+// return an ARP network protocol with the provided options.
+func NewProtocolWithOptions(opts Options) stack.NetworkProtocolFactory {
+	if opts.GratuitousARPInterval <= 0 {
+		opts.GratuitousARPInterval = DefaultGratuitousARPInterval
+	}
+	return func(s *stack.Stack) stack.NetworkProtocol {
+		p := &protocol{
+			stack:   s,
+			options: opts,
+		}
+		p.mu.eps = make(map[tcpip.NICID]*endpoint)
+		return p
+	}
+}
+
 // NewProtocol returns an ARP network protocol.
 func NewProtocol(s *stack.Stack) stack.NetworkProtocol {
-	return &protocol{stack: s}
+	return NewProtocolWithOptions(Options{})(s)
 }
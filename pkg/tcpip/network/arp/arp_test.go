@@ -25,6 +25,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
@@ -577,3 +578,392 @@ func TestLinkAddressRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestGratuitousARP(t *testing.T) {
+	const interval = time.Second
+
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, arp.NewProtocolWithOptions(arp.Options{
+			GratuitousARPs:        2,
+			GratuitousARPInterval: interval,
+		})},
+		Clock: clock,
+	})
+	linkEP := channel.New(defaultChannelSize, defaultMTU, stackLinkAddr)
+	if err := s.CreateNIC(nicID, linkEP); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+
+	expectAnnouncement := func() {
+		t.Helper()
+
+		pkt, ok := linkEP.Read()
+		if !ok {
+			t.Fatal("expected to send a gratuitous ARP request")
+		}
+		if pkt.Route.RemoteLinkAddress != header.EthernetBroadcastAddress {
+			t.Errorf("got pkt.Route.RemoteLinkAddress = %s, want = %s", pkt.Route.RemoteLinkAddress, header.EthernetBroadcastAddress)
+		}
+		req := header.ARP(stack.PayloadSince(pkt.Pkt.NetworkHeader()))
+		if got := req.Op(); got != header.ARPRequest {
+			t.Errorf("got Op = %d, want = %d", got, header.ARPRequest)
+		}
+		if got := tcpip.LinkAddress(req.HardwareAddressSender()); got != stackLinkAddr {
+			t.Errorf("got HardwareAddressSender = %s, want = %s", got, stackLinkAddr)
+		}
+		if got := tcpip.Address(req.ProtocolAddressSender()); got != stackAddr {
+			t.Errorf("got ProtocolAddressSender = %s, want = %s", got, stackAddr)
+		}
+		if got := tcpip.Address(req.ProtocolAddressTarget()); got != stackAddr {
+			t.Errorf("got ProtocolAddressTarget = %s, want = %s", got, stackAddr)
+		}
+	}
+	expectNoAnnouncement := func() {
+		t.Helper()
+
+		if pkt, ok := linkEP.Read(); ok {
+			t.Fatalf("got unexpected packet = %#v", pkt)
+		}
+	}
+
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, stackAddr); err != nil {
+		t.Fatalf("s.AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, stackAddr, err)
+	}
+	clock.Advance(0)
+	expectAnnouncement()
+	clock.Advance(interval - 1)
+	expectNoAnnouncement()
+	clock.Advance(1)
+	expectAnnouncement()
+	clock.Advance(interval)
+	expectNoAnnouncement()
+
+	// Addresses are announced again, e.g. after the link address changed.
+	if err := s.AnnounceNICAddresses(nicID); err != nil {
+		t.Fatalf("s.AnnounceNICAddresses(%d): %s", nicID, err)
+	}
+	clock.Advance(0)
+	expectAnnouncement()
+
+	// Removed addresses are no longer announced.
+	if err := s.RemoveAddress(nicID, stackAddr); err != nil {
+		t.Fatalf("s.RemoveAddress(%d, %s): %s", nicID, stackAddr, err)
+	}
+	clock.Advance(interval)
+	expectNoAnnouncement()
+
+	// Addresses are announced when their NIC is enabled.
+	if err := s.DisableNIC(nicID); err != nil {
+		t.Fatalf("s.DisableNIC(%d): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, stackAddr); err != nil {
+		t.Fatalf("s.AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, stackAddr, err)
+	}
+	clock.Advance(interval)
+	expectNoAnnouncement()
+	if err := s.EnableNIC(nicID); err != nil {
+		t.Fatalf("s.EnableNIC(%d): %s", nicID, err)
+	}
+	clock.Advance(0)
+	expectAnnouncement()
+}
+
+func TestPolicy(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+
+		nic1LinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x01")
+		nic2LinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x02")
+		senderMAC    = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x03")
+
+		nic1Addr     = tcpip.Address("\x0a\x00\x00\x01")
+		nic2Addr     = tcpip.Address("\x0a\x00\x01\x01")
+		onLinkAddr   = tcpip.Address("\x0a\x00\x00\x02")
+		offLinkAddr  = tcpip.Address("\x0a\x00\x05\x02")
+		unroutedAddr = tcpip.Address("\xac\x10\x00\x01")
+		prefixLen    = 24
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, arp.NewProtocol},
+	})
+	linkEP1 := channel.New(defaultChannelSize, defaultMTU, nic1LinkAddr)
+	linkEP2 := channel.New(defaultChannelSize, defaultMTU, nic2LinkAddr)
+	for id, ep := range map[tcpip.NICID]*channel.Endpoint{nicID1: linkEP1, nicID2: linkEP2} {
+		if err := s.CreateNIC(id, ep); err != nil {
+			t.Fatalf("s.CreateNIC(%d, _): %s", id, err)
+		}
+	}
+	for id, addr := range map[tcpip.NICID]tcpip.Address{nicID1: nic1Addr, nicID2: nic2Addr} {
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol:          ipv4.ProtocolNumber,
+			AddressWithPrefix: tcpip.AddressWithPrefix{Address: addr, PrefixLen: prefixLen},
+		}
+		if err := s.AddProtocolAddress(id, protocolAddr); err != nil {
+			t.Fatalf("s.AddProtocolAddress(%d, %+v): %s", id, protocolAddr, err)
+		}
+	}
+	nic1Subnet := tcpip.AddressWithPrefix{Address: nic1Addr, PrefixLen: prefixLen}.Subnet()
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: nic1Subnet, NIC: nicID1},
+		{Destination: header.IPv4EmptySubnet, NIC: nicID2},
+	})
+
+	ep, err := s.GetNetworkEndpoint(nicID1, arp.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("s.GetNetworkEndpoint(%d, %d): %s", nicID1, arp.ProtocolNumber, err)
+	}
+	policyEP, ok := ep.(arp.PolicyEndpoint)
+	if !ok {
+		t.Fatalf("expected ARP endpoint to implement arp.PolicyEndpoint")
+	}
+	if got := policyEP.Policy(); got != arp.DefaultPolicy {
+		t.Errorf("got Policy() = %+v, want = %+v", got, arp.DefaultPolicy)
+	}
+	if err := policyEP.SetPolicy(arp.Policy{Ignore: 3}); err != tcpip.ErrInvalidOptionValue {
+		t.Errorf("got SetPolicy({Ignore: 3}) = %v, want = %s", err, tcpip.ErrInvalidOptionValue)
+	}
+
+	t.Run("Requests", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			policy    arp.Policy
+			sender    tcpip.Address
+			target    tcpip.Address
+			wantReply bool
+		}{
+			{
+				name:      "IgnoreNone",
+				policy:    arp.Policy{Ignore: arp.IgnoreNone},
+				sender:    onLinkAddr,
+				target:    nic2Addr,
+				wantReply: true,
+			},
+			{
+				name:   "IgnoreNone unknown address",
+				policy: arp.Policy{Ignore: arp.IgnoreNone},
+				sender: onLinkAddr,
+				target: unroutedAddr,
+			},
+			{
+				name:   "IgnoreOtherInterfaces",
+				policy: arp.Policy{Ignore: arp.IgnoreOtherInterfaces},
+				sender: onLinkAddr,
+				target: nic2Addr,
+			},
+			{
+				name:      "IgnoreOtherSubnets",
+				policy:    arp.Policy{Ignore: arp.IgnoreOtherSubnets},
+				sender:    onLinkAddr,
+				target:    nic1Addr,
+				wantReply: true,
+			},
+			{
+				name:   "IgnoreOtherSubnets sender in another subnet",
+				policy: arp.Policy{Ignore: arp.IgnoreOtherSubnets},
+				sender: offLinkAddr,
+				target: nic1Addr,
+			},
+			{
+				name:   "IgnoreAll",
+				policy: arp.Policy{Ignore: arp.IgnoreAll},
+				sender: onLinkAddr,
+				target: nic1Addr,
+			},
+			{
+				name:      "Filter",
+				policy:    arp.Policy{Ignore: arp.IgnoreNone, Filter: true},
+				sender:    onLinkAddr,
+				target:    nic2Addr,
+				wantReply: true,
+			},
+			{
+				name:   "Filter sender routed through another interface",
+				policy: arp.Policy{Ignore: arp.IgnoreNone, Filter: true},
+				sender: offLinkAddr,
+				target: nic1Addr,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if err := policyEP.SetPolicy(test.policy); err != nil {
+					t.Fatalf("SetPolicy(%+v): %s", test.policy, err)
+				}
+
+				v := make(buffer.View, header.ARPSize)
+				h := header.ARP(v)
+				h.SetIPv4OverEthernet()
+				h.SetOp(header.ARPRequest)
+				copy(h.HardwareAddressSender(), senderMAC)
+				copy(h.ProtocolAddressSender(), test.sender)
+				copy(h.ProtocolAddressTarget(), test.target)
+				linkEP1.InjectInbound(arp.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+					Data: v.ToVectorisedView(),
+				}))
+
+				pkt, ok := linkEP1.Read()
+				if ok != test.wantReply {
+					t.Fatalf("got reply = %t, want = %t", ok, test.wantReply)
+				}
+				if !ok {
+					return
+				}
+				rep := header.ARP(stack.PayloadSince(pkt.Pkt.NetworkHeader()))
+				if got := tcpip.LinkAddress(rep.HardwareAddressSender()); got != nic1LinkAddr {
+					t.Errorf("got HardwareAddressSender = %s, want = %s", got, nic1LinkAddr)
+				}
+				if got := tcpip.Address(rep.ProtocolAddressSender()); got != test.target {
+					t.Errorf("got ProtocolAddressSender = %s, want = %s", got, test.target)
+				}
+			})
+		}
+	})
+
+	t.Run("Announce", func(t *testing.T) {
+		linkRes, ok := s.NetworkProtocolInstance(arp.ProtocolNumber).(stack.LinkAddressResolver)
+		if !ok {
+			t.Fatal("expected ARP protocol to implement stack.LinkAddressResolver")
+		}
+
+		tests := []struct {
+			name       string
+			mode       arp.AnnounceMode
+			localAddr  tcpip.Address
+			target     tcpip.Address
+			wantSource tcpip.Address
+		}{
+			{
+				name:       "AnnounceAny",
+				mode:       arp.AnnounceAny,
+				localAddr:  nic2Addr,
+				target:     onLinkAddr,
+				wantSource: nic2Addr,
+			},
+			{
+				name:       "AnnounceSameSubnet",
+				mode:       arp.AnnounceSameSubnet,
+				localAddr:  nic2Addr,
+				target:     onLinkAddr,
+				wantSource: nic1Addr,
+			},
+			{
+				name:       "AnnounceSameSubnet target in no subnet",
+				mode:       arp.AnnounceSameSubnet,
+				localAddr:  nic2Addr,
+				target:     unroutedAddr,
+				wantSource: nic2Addr,
+			},
+			{
+				name:       "AnnounceBest",
+				mode:       arp.AnnounceBest,
+				localAddr:  nic2Addr,
+				target:     unroutedAddr,
+				wantSource: nic1Addr,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				policy := arp.Policy{Announce: test.mode}
+				if err := policyEP.SetPolicy(policy); err != nil {
+					t.Fatalf("SetPolicy(%+v): %s", policy, err)
+				}
+				if err := linkRes.LinkAddressRequest(test.target, test.localAddr, "", &testInterface{LinkEndpoint: linkEP1, nicID: nicID1}); err != nil {
+					t.Fatalf("LinkAddressRequest(%s, %s, \"\", _): %s", test.target, test.localAddr, err)
+				}
+				pkt, ok := linkEP1.Read()
+				if !ok {
+					t.Fatal("expected to send a link address request")
+				}
+				req := header.ARP(stack.PayloadSince(pkt.Pkt.NetworkHeader()))
+				if got := tcpip.Address(req.ProtocolAddressSender()); got != test.wantSource {
+					t.Errorf("got ProtocolAddressSender = %s, want = %s", got, test.wantSource)
+				}
+			})
+		}
+	})
+}
+
+func TestProtectGateways(t *testing.T) {
+	const (
+		gatewayAddr     = remoteAddr
+		gatewayLinkAddr = remoteLinkAddr
+		spoofedLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x66")
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, arp.NewProtocol},
+		UseNeighborCache: true,
+	})
+	linkEP := channel.New(defaultChannelSize, defaultMTU, stackLinkAddr)
+	if err := s.CreateNIC(nicID, linkEP); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, stackAddr); err != nil {
+		t.Fatalf("s.AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, stackAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, Gateway: gatewayAddr, NIC: nicID}})
+
+	ep, err := s.GetNetworkEndpoint(nicID, arp.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("s.GetNetworkEndpoint(%d, %d): %s", nicID, arp.ProtocolNumber, err)
+	}
+	policy := arp.DefaultPolicy
+	policy.DropGratuitous = true
+	policy.ProtectGateways = true
+	if err := ep.(arp.PolicyEndpoint).SetPolicy(policy); err != nil {
+		t.Fatalf("SetPolicy(%+v): %s", policy, err)
+	}
+
+	var conflicts []stack.NeighborEvent
+	defer s.SubscribeNeighborEvents(func(ev stack.NeighborEvent) {
+		if ev.Reason == stack.NeighborEventConflict {
+			conflicts = append(conflicts, ev)
+		}
+	})()
+
+	inject := func(op header.ARPOp, linkAddr tcpip.LinkAddress, target tcpip.Address) {
+		v := make(buffer.View, header.ARPSize)
+		h := header.ARP(v)
+		h.SetIPv4OverEthernet()
+		h.SetOp(op)
+		copy(h.HardwareAddressSender(), linkAddr)
+		copy(h.ProtocolAddressSender(), gatewayAddr)
+		copy(h.ProtocolAddressTarget(), target)
+		linkEP.InjectInbound(arp.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: v.ToVectorisedView(),
+		}))
+	}
+
+	// Learn the link address of the gateway from its request.
+	inject(header.ARPRequest, gatewayLinkAddr, stackAddr)
+	if _, ok := linkEP.Read(); !ok {
+		t.Fatal("expected ARP reply")
+	}
+
+	// A gratuitous reply is dropped before being checked.
+	inject(header.ARPReply, spoofedLinkAddr, gatewayAddr)
+	if len(conflicts) != 0 {
+		t.Fatalf("got conflicts = %+v after gratuitous reply, want none", conflicts)
+	}
+
+	// A reply advertising another link address is ignored and reported.
+	inject(header.ARPReply, spoofedLinkAddr, stackAddr)
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+	if got := conflicts[0]; got.NICID != nicID || got.Entry.Addr != gatewayAddr || got.Entry.LinkAddr != gatewayLinkAddr || got.ConflictingLinkAddr != spoofedLinkAddr {
+		t.Errorf("got conflict = %+v, want conflict of %s advertised for %s at %s", got, spoofedLinkAddr, gatewayAddr, gatewayLinkAddr)
+	}
+
+	neighbors, err := s.Neighbors(nicID)
+	if err != nil {
+		t.Fatalf("s.Neighbors(%d): %s", nicID, err)
+	}
+	for _, n := range neighbors {
+		if n.Addr == gatewayAddr && n.LinkAddr != gatewayLinkAddr {
+			t.Errorf("got gateway link address = %s, want = %s", n.LinkAddr, gatewayLinkAddr)
+		}
+	}
+}
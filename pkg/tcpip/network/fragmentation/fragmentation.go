@@ -41,6 +41,11 @@ const (
 	// net.ipv4.ipfrag_low_thresh for more information.
 	LowFragThreshold = 3 << 20 // 3MB
 
+	// PerSourceFragThreshold is the default amount of memory the fragments
+	// sent by a single source may use. It keeps a single peer from evicting
+	// the fragments of everyone else. Linux has no equivalent.
+	PerSourceFragThreshold = 1 << 20 // 1MB
+
 	// minBlockSize is the minimum block size for fragments.
 	minBlockSize = 1
 )
@@ -72,20 +77,47 @@ type FragmentID struct {
 	Protocol uint8
 }
 
+// source holds the reassemblers of the packets sent by a source.
+type source struct {
+	// size is the memory used by the fragments sent by the source.
+	size int
+
+	// lru holds the reassemblers of the source, the most recently updated
+	// first.
+	lru sourceLRUList
+}
+
 // Fragmentation is the main structure that other modules
 // of the stack should use to implement IP Fragmentation.
 type Fragmentation struct {
 	mu             sync.Mutex
 	highLimit      int
 	lowLimit       int
+	perSourceLimit int
 	reassemblers   map[FragmentID]*reassembler
-	rList          reassemblerList
+
+	// rList holds the reassemblers, the most recently created first.
+	rList reassemblerList
+
+	// lru holds the reassemblers, the most recently updated first. They
+	// are evicted from the back when memory runs short.
+	lru lruList
+
+	// sources holds the reassemblers of each source, so that sources using
+	// more than perSourceLimit can be made to evict their own packets.
+	sources map[tcpip.Address]*source
+
 	size           int
 	timeout        time.Duration
 	blockSize      uint16
 	clock          tcpip.Clock
 	releaseJob     *tcpip.Job
 	timeoutHandler TimeoutHandler
+
+	// rejectOverlaps is true if reassembly is abandoned when a fragment
+	// overlaps with previously received fragments, even if it is entirely
+	// covered by them.
+	rejectOverlaps bool
 }
 
 // TimeoutHandler is consulted if a packet reassembly has timed out.
@@ -107,36 +139,85 @@ type TimeoutHandler interface {
 // lowMemoryLimit specifies the limit on which we will reach by dropping
 // fragments after reaching highMemoryLimit.
 //
+// The fragments of a single source may use at most PerSourceFragThreshold
+// bytes, see SetMemoryLimits.
+//
 // reassemblingTimeout specifies the maximum time allowed to reassemble a packet.
 // Fragments are lazily evicted only when a new a packet with an
 // already existing fragmentation-id arrives after the timeout.
 func NewFragmentation(blockSize uint16, highMemoryLimit, lowMemoryLimit int, reassemblingTimeout time.Duration, clock tcpip.Clock, timeoutHandler TimeoutHandler) *Fragmentation {
-	if lowMemoryLimit >= highMemoryLimit {
-		lowMemoryLimit = highMemoryLimit
-	}
-
-	if lowMemoryLimit < 0 {
-		lowMemoryLimit = 0
-	}
-
 	if blockSize < minBlockSize {
 		blockSize = minBlockSize
 	}
 
 	f := &Fragmentation{
 		reassemblers:   make(map[FragmentID]*reassembler),
-		highLimit:      highMemoryLimit,
-		lowLimit:       lowMemoryLimit,
+		sources:        make(map[tcpip.Address]*source),
 		timeout:        reassemblingTimeout,
 		blockSize:      blockSize,
 		clock:          clock,
 		timeoutHandler: timeoutHandler,
 	}
 	f.releaseJob = tcpip.NewJob(f.clock, &f.mu, f.releaseReassemblersLocked)
+	f.highLimit, f.lowLimit, f.perSourceLimit = clampMemoryLimits(highMemoryLimit, lowMemoryLimit, PerSourceFragThreshold)
 
 	return f
 }
 
+// clampMemoryLimits returns the memory limits a Fragmentation uses when
+// configured with highLimit, lowLimit and perSourceLimit.
+func clampMemoryLimits(highLimit, lowLimit, perSourceLimit int) (int, int, int) {
+	if lowLimit >= highLimit {
+		lowLimit = highLimit
+	}
+	if lowLimit < 0 {
+		lowLimit = 0
+	}
+	if perSourceLimit < 0 {
+		perSourceLimit = 0
+	}
+	return highLimit, lowLimit, perSourceLimit
+}
+
+// SetMemoryLimits sets the memory limits of f and evicts fragments until they
+// are respected.
+//
+// When the fragments held by f use more than highLimit bytes, the packets
+// updated least recently are evicted until they use at most lowLimit bytes.
+//
+// When the fragments sent by a single source use more than perSourceLimit
+// bytes, the packets of that source updated least recently are evicted until
+// they use at most perSourceLimit bytes. A perSourceLimit of 0 means no limit.
+func (f *Fragmentation) SetMemoryLimits(highLimit, lowLimit, perSourceLimit int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.highLimit, f.lowLimit, f.perSourceLimit = clampMemoryLimits(highLimit, lowLimit, perSourceLimit)
+	if f.perSourceLimit > 0 {
+		for _, src := range f.sources {
+			f.enforceSourceLimitLocked(src)
+		}
+	}
+	f.enforceLimitsLocked()
+}
+
+// MemoryLimits returns the memory limits of f, as set by SetMemoryLimits.
+func (f *Fragmentation) MemoryLimits() (highLimit, lowLimit, perSourceLimit int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.highLimit, f.lowLimit, f.perSourceLimit
+}
+
+// SetRejectOverlaps sets whether the reassembly of a packet is abandoned when
+// one of its fragments overlaps with fragments previously received for it,
+// as per RFC 5722 section 4. Fragments entirely covered by previously
+// received fragments are otherwise ignored, and only partial overlaps
+// abandon reassembly. Exact duplicates of a fragment are always ignored.
+//
+// It must be called before any fragment is processed.
+func (f *Fragmentation) SetRejectOverlaps(reject bool) {
+	f.rejectOverlaps = reject
+}
+
 // Process processes an incoming fragment belonging to an ID and returns a
 // complete packet and its protocol number when all the packets belonging to
 // that ID have been received.
@@ -172,9 +253,23 @@ func (f *Fragmentation) Process(
 
 	f.mu.Lock()
 	r, ok := f.reassemblers[id]
-	if !ok {
+	if ok {
+		// Mark the reassembler as the most recently updated one.
+		f.lru.Remove(r)
+		f.lru.PushFront(r)
+		r.source.lru.Remove(r)
+		r.source.lru.PushFront(r)
+	} else {
 		r = newReassembler(id, f.clock)
+		src, ok := f.sources[id.Source]
+		if !ok {
+			src = &source{}
+			f.sources[id.Source] = src
+		}
+		r.source = src
 		f.reassemblers[id] = r
+		f.lru.PushFront(r)
+		src.lru.PushFront(r)
 		wasEmpty := f.rList.Empty()
 		f.rList.PushFront(r)
 		if wasEmpty {
@@ -186,7 +281,7 @@ func (f *Fragmentation) Process(
 	}
 	f.mu.Unlock()
 
-	res, firstFragmentProto, done, consumed, err := r.process(first, last, more, proto, pkt)
+	res, firstFragmentProto, done, consumed, err := r.process(first, last, more, proto, pkt, f.rejectOverlaps)
 	if err != nil {
 		// We probably got an invalid sequence of fragments. Just
 		// discard the reassembler and move on.
@@ -197,24 +292,50 @@ func (f *Fragmentation) Process(
 	}
 	f.mu.Lock()
 	f.size += consumed
+	r.source.size += consumed
 	if done {
 		f.release(r, false /* timedOut */)
 	}
-	// Evict reassemblers if we are consuming more memory than highLimit until
-	// we reach lowLimit.
-	if f.size > f.highLimit {
-		for f.size > f.lowLimit {
-			tail := f.rList.Back()
-			if tail == nil {
-				break
-			}
-			f.release(tail, false /* timedOut */)
-		}
-	}
+	f.enforceSourceLimitLocked(r.source)
+	f.enforceLimitsLocked()
 	f.mu.Unlock()
 	return res, firstFragmentProto, done, nil
 }
 
+// enforceSourceLimitLocked evicts the least recently updated packets of src
+// while its fragments use more than perSourceLimit.
+//
+// Precondition: f.mu must be locked.
+func (f *Fragmentation) enforceSourceLimitLocked(src *source) {
+	if f.perSourceLimit == 0 {
+		return
+	}
+	for src.size > f.perSourceLimit {
+		tail := src.lru.Back()
+		if tail == nil {
+			break
+		}
+		f.release(tail, false /* timedOut */)
+	}
+}
+
+// enforceLimitsLocked evicts the least recently updated packets until
+// lowLimit is reached if the fragments use more than highLimit.
+//
+// Precondition: f.mu must be locked.
+func (f *Fragmentation) enforceLimitsLocked() {
+	if f.size <= f.highLimit {
+		return
+	}
+	for f.size > f.lowLimit {
+		tail := f.lru.Back()
+		if tail == nil {
+			break
+		}
+		f.release(tail, false /* timedOut */)
+	}
+}
+
 func (f *Fragmentation) release(r *reassembler, timedOut bool) {
 	// Before releasing a fragment we need to check if r is already marked as done.
 	// Otherwise, we would delete it twice.
@@ -224,11 +345,22 @@ func (f *Fragmentation) release(r *reassembler, timedOut bool) {
 
 	delete(f.reassemblers, r.id)
 	f.rList.Remove(r)
+	f.lru.Remove(r)
 	f.size -= r.size
 	if f.size < 0 {
 		log.Printf("memory counter < 0 (%d), this is an accounting bug that requires investigation", f.size)
 		f.size = 0
 	}
+	src := r.source
+	src.lru.Remove(r)
+	src.size -= r.size
+	if src.size < 0 {
+		log.Printf("memory counter of source %s < 0 (%d), this is an accounting bug that requires investigation", r.id.Source, src.size)
+		src.size = 0
+	}
+	if src.lru.Empty() {
+		delete(f.sources, r.id.Source)
+	}
 
 	if h := f.timeoutHandler; timedOut && h != nil {
 		h.OnReassemblyTimeout(r.pkt)
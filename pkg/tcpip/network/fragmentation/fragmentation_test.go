@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/network/testutil"
@@ -301,6 +302,69 @@ func TestMemoryLimitsIgnoresDuplicates(t *testing.T) {
 	}
 }
 
+func TestMemoryLimitsEvictsLeastRecentlyUpdated(t *testing.T) {
+	f := NewFragmentation(minBlockSize, 3, 1, reassembleTimeout, &faketime.NullClock{}, nil)
+	f.Process(FragmentID{ID: 0}, 0, 0, true, 0xFF, pkt(1, "0"))
+	f.Process(FragmentID{ID: 1}, 0, 0, true, 0xFF, pkt(1, "1"))
+	// Receive another fragment of id = 0, so that id = 1 becomes the least
+	// recently updated packet.
+	f.Process(FragmentID{ID: 0}, 16, 16, true, 0xFF, pkt(1, "0"))
+
+	// This should cause id = 1 to be evicted, then id = 0.
+	f.Process(FragmentID{ID: 2}, 0, 0, true, 0xFF, pkt(1, "2"))
+
+	if _, ok := f.reassemblers[FragmentID{ID: 1}]; ok {
+		t.Errorf("id=1 has not been evicted")
+	}
+	if _, ok := f.reassemblers[FragmentID{ID: 2}]; !ok {
+		t.Errorf("id=2 is not present")
+	}
+	if got, want := f.size, 1; got != want {
+		t.Errorf("got f.size = %d, want = %d", got, want)
+	}
+}
+
+func TestPerSourceMemoryLimits(t *testing.T) {
+	const (
+		srcA = tcpip.Address("\x0a\x00\x00\x01")
+		srcB = tcpip.Address("\x0a\x00\x00\x02")
+	)
+	f := NewFragmentation(minBlockSize, 10, 5, reassembleTimeout, &faketime.NullClock{}, nil)
+	f.SetMemoryLimits(10, 5, 2)
+
+	f.Process(FragmentID{Source: srcB, ID: 0}, 0, 0, true, 0xFF, pkt(1, "0"))
+	// srcA floods the cache, it should only evict its own packets.
+	for i := uint32(0); i < 10; i++ {
+		f.Process(FragmentID{Source: srcA, ID: i}, 0, 0, true, 0xFF, pkt(1, "0"))
+	}
+
+	if _, ok := f.reassemblers[FragmentID{Source: srcB, ID: 0}]; !ok {
+		t.Errorf("the packet of srcB has been evicted")
+	}
+	for i := uint32(0); i < 8; i++ {
+		if _, ok := f.reassemblers[FragmentID{Source: srcA, ID: i}]; ok {
+			t.Errorf("packet %d of srcA has not been evicted", i)
+		}
+	}
+	for i := uint32(8); i < 10; i++ {
+		if _, ok := f.reassemblers[FragmentID{Source: srcA, ID: i}]; !ok {
+			t.Errorf("packet %d of srcA is not present", i)
+		}
+	}
+	if got, want := f.sources[srcA].size, 2; got != want {
+		t.Errorf("got f.sources[srcA].size = %d, want = %d", got, want)
+	}
+	if got, want := f.size, 3; got != want {
+		t.Errorf("got f.size = %d, want = %d", got, want)
+	}
+
+	// Releasing the last packet of a source forgets about it.
+	f.release(f.reassemblers[FragmentID{Source: srcB, ID: 0}], false /* timedOut */)
+	if _, ok := f.sources[srcB]; ok {
+		t.Errorf("srcB is still tracked after all its packets were released")
+	}
+}
+
 func TestErrors(t *testing.T) {
 	tests := []struct {
 		name      string
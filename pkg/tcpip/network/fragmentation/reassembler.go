@@ -33,6 +33,15 @@ type hole struct {
 
 type reassembler struct {
 	reassemblerEntry
+
+	// lruEntry and sourceLRUEntry link the reassembler in the LRU lists of
+	// its Fragmentation and of its source.
+	lruEntry       lruEntry
+	sourceLRUEntry sourceLRUEntry
+
+	// source is the source of the packet, it is owned by the Fragmentation.
+	source *source
+
 	id           FragmentID
 	size         int
 	proto        uint8
@@ -45,6 +54,18 @@ type reassembler struct {
 	pkt          *stack.PacketBuffer
 }
 
+// lruMapper maps reassemblers to their entry in the LRU list of their
+// Fragmentation.
+type lruMapper struct{}
+
+func (lruMapper) linkerFor(r *reassembler) *lruEntry { return &r.lruEntry }
+
+// sourceLRUMapper maps reassemblers to their entry in the LRU list of their
+// source.
+type sourceLRUMapper struct{}
+
+func (sourceLRUMapper) linkerFor(r *reassembler) *sourceLRUEntry { return &r.sourceLRUEntry }
+
 func newReassembler(id FragmentID, clock tcpip.Clock) *reassembler {
 	r := &reassembler{
 		id:           id,
@@ -62,7 +83,9 @@ func newReassembler(id FragmentID, clock tcpip.Clock) *reassembler {
 
 // updateHoles updates the list of holes for an incoming fragment. It returns
 // true if the fragment fits, it is not a duplicate and it does not overlap with
-// another fragment.
+// another fragment. If rejectOverlaps is true, fragments entirely covered by
+// previously received fragments are reported as overlaps rather than ignored,
+// unless they are exact duplicates.
 //
 // For IPv6, overlaps with an existing fragment are explicitly forbidden by
 // RFC 8200 section 4.5:
@@ -74,7 +97,20 @@ func newReassembler(id FragmentID, clock tcpip.Clock) *reassembler {
 // It is not explicitly forbidden for IPv4, but to keep parity with Linux we
 // disallow it as well:
 // https://github.com/torvalds/linux/blob/38525c6/net/ipv4/inet_fragment.c#L349
-func (r *reassembler) updateHoles(first, last uint16, more bool) (bool, error) {
+func (r *reassembler) updateHoles(first, last uint16, more, rejectOverlaps bool) (bool, error) {
+	if rejectOverlaps {
+		// Filled holes match the fragments received so far.
+		for _, h := range r.holes {
+			if !h.filled || last < h.first || h.last < first {
+				continue
+			}
+			if h.first == first && h.last == last {
+				return false, nil
+			}
+			return false, ErrFragmentOverlap
+		}
+	}
+
 	for i := range r.holes {
 		currentHole := &r.holes[i]
 
@@ -116,7 +152,7 @@ func (r *reassembler) updateHoles(first, last uint16, more bool) (bool, error) {
 	return false, nil
 }
 
-func (r *reassembler) process(first, last uint16, more bool, proto uint8, pkt *stack.PacketBuffer) (buffer.VectorisedView, uint8, bool, int, error) {
+func (r *reassembler) process(first, last uint16, more bool, proto uint8, pkt *stack.PacketBuffer, rejectOverlaps bool) (buffer.VectorisedView, uint8, bool, int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.done {
@@ -126,7 +162,7 @@ func (r *reassembler) process(first, last uint16, more bool, proto uint8, pkt *s
 		return buffer.VectorisedView{}, 0, false, 0, nil
 	}
 
-	used, err := r.updateHoles(first, last, more)
+	used, err := r.updateHoles(first, last, more, rejectOverlaps)
 	if err != nil {
 		return buffer.VectorisedView{}, 0, false, 0, fmt.Errorf("fragment reassembly failed: %w", err)
 	}
@@ -32,9 +32,10 @@ type updateHolesParams struct {
 
 func TestUpdateHoles(t *testing.T) {
 	var tests = []struct {
-		name   string
-		params []updateHolesParams
-		want   []hole
+		name           string
+		rejectOverlaps bool
+		params         []updateHolesParams
+		want           []hole
 	}{
 		{
 			name:   "No fragments",
@@ -108,6 +109,32 @@ func TestUpdateHoles(t *testing.T) {
 				{first: 11, last: 15, filled: true},
 			},
 		},
+		{
+			name: "Fragment covered by previous fragments",
+			params: []updateHolesParams{
+				{first: 0, last: 10, more: true, wantUsed: true, wantError: nil},
+				{first: 5, last: 10, more: true, wantUsed: false, wantError: nil},
+				{first: 0, last: 10, more: true, wantUsed: false, wantError: nil},
+			},
+			want: []hole{
+				{first: 0, last: 10, filled: true},
+				{first: 11, last: math.MaxUint16, filled: false},
+			},
+		},
+		{
+			name:           "Fragment covered by previous fragments with overlaps rejected",
+			rejectOverlaps: true,
+			params: []updateHolesParams{
+				{first: 0, last: 10, more: true, wantUsed: true, wantError: nil},
+				{first: 5, last: 10, more: true, wantUsed: false, wantError: ErrFragmentOverlap},
+				{first: 0, last: 10, more: true, wantUsed: false, wantError: nil},
+				{first: 11, last: 15, more: false, wantUsed: true, wantError: nil},
+			},
+			want: []hole{
+				{first: 0, last: 10, filled: true},
+				{first: 11, last: 15, filled: true},
+			},
+		},
 		{
 			name: "Out of bounds fragment",
 			params: []updateHolesParams{
@@ -126,9 +153,9 @@ func TestUpdateHoles(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			r := newReassembler(FragmentID{}, &faketime.NullClock{})
 			for _, param := range test.params {
-				used, err := r.updateHoles(param.first, param.last, param.more)
+				used, err := r.updateHoles(param.first, param.last, param.more, test.rejectOverlaps)
 				if used != param.wantUsed || err != param.wantError {
-					t.Errorf("got r.updateHoles(%d, %d, %t) = (%t, %v), want = (%t, %v)", param.first, param.last, param.more, used, err, param.wantUsed, param.wantError)
+					t.Errorf("got r.updateHoles(%d, %d, %t, %t) = (%t, %v), want = (%t, %v)", param.first, param.last, param.more, test.rejectOverlaps, used, err, param.wantUsed, param.wantError)
 				}
 			}
 			if diff := cmp.Diff(test.want, r.holes, cmp.AllowUnexported(hole{})); diff != "" {
@@ -18,6 +18,7 @@ package ip
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/sync"
@@ -56,6 +57,19 @@ const (
 	idleMember
 )
 
+const (
+	// unsolicitedReportBurst is the maximum number of unsolicited reports sent
+	// immediately, one group at a time, when groups are initialized together.
+	// The initial reports of the remaining groups are jittered over the
+	// maximum unsolicited report delay.
+	unsolicitedReportBurst = 8
+
+	// unsolicitedReportSlots is the number of slots the maximum unsolicited
+	// report delay is divided into when groups are initialized together. The
+	// reports of all groups falling in the same slot are sent together.
+	unsolicitedReportSlots = 10
+)
+
 // multicastGroupState holds the Generic Multicast Protocol state for a
 // multicast group.
 type multicastGroupState struct {
@@ -73,6 +87,10 @@ type multicastGroupState struct {
 	// 8 for MLDv1.
 	lastToSendReport bool
 
+	// batch identifies the set of groups whose delayed reports are sent
+	// together, or is 0 if the delayed report of the group is sent on its own.
+	batch uint64
+
 	// delayedReportJob is used to delay sending responses to membership report
 	// messages in order to reduce duplicate reports from multiple hosts on the
 	// interface.
@@ -118,6 +136,31 @@ type GenericMulticastProtocolOptions struct {
 	// it will be left in the non member/listener state, and packets will never
 	// be sent for it.
 	AllNodesAddress tcpip.Address
+
+	// OtherQuerierPresentInterval is the amount of time after which the
+	// querier is forgotten if no query was received from it.
+	//
+	// A value of 0 means the querier is never forgotten.
+	OtherQuerierPresentInterval time.Duration
+}
+
+// Querier holds the state of the querier on the link, as learned from the
+// queries received on the interface.
+type Querier struct {
+	// Address is the source address of the querier's queries.
+	Address tcpip.Address
+
+	// Version is the version of the multicast group protocol run by the
+	// querier, e.g. 1, 2 or 3 for IGMP and 1 or 2 for MLD.
+	Version uint8
+}
+
+// MulticastQuerierEndpoint is an endpoint which tracks the querier on its
+// link.
+type MulticastQuerierEndpoint interface {
+	// MulticastQuerier returns the querier on the link, or false if no query
+	// has been received from a querier within its present interval.
+	MulticastQuerier() (Querier, bool)
 }
 
 // MulticastGroupProtocol is a multicast group protocol whose core state machine
@@ -130,6 +173,19 @@ type MulticastGroupProtocol interface {
 	SendLeave(groupAddress tcpip.Address) *tcpip.Error
 }
 
+// MulticastGroupProtocolBatchReporter may be implemented by a
+// MulticastGroupProtocol able to report multiple groups at once, such as
+// IGMPv3 and MLDv2 which carry a record per group in their reports.
+type MulticastGroupProtocolBatchReporter interface {
+	// SendReports sends reports for all the specified group addresses, in as
+	// few messages as possible.
+	//
+	// Returns false without sending anything if the protocol can't currently
+	// report multiple groups at once, e.g. when operating in compatibility
+	// mode with an older version of the protocol.
+	SendReports(groupAddresses []tcpip.Address) (bool, *tcpip.Error)
+}
+
 // GenericMulticastProtocolState is the per interface generic multicast protocol
 // state.
 //
@@ -148,6 +204,17 @@ type GenericMulticastProtocolState struct {
 
 		// memberships holds group addresses and their associated state.
 		memberships map[tcpip.Address]multicastGroupState
+
+		// lastBatch is the last identifier given to a batch of delayed reports.
+		lastBatch uint64
+
+		// querier is the querier on the link, valid if hasQuerier is true.
+		querier    Querier
+		hasQuerier bool
+
+		// querierJob is scheduled when a query is received from the querier.
+		// Upon expiration, the querier is forgotten.
+		querierJob *tcpip.Job
 	}
 }
 
@@ -160,6 +227,11 @@ func (g *GenericMulticastProtocolState) Init(opts GenericMulticastProtocolOption
 	defer g.mu.Unlock()
 	g.opts = opts
 	g.mu.memberships = make(map[tcpip.Address]multicastGroupState)
+	g.mu.hasQuerier = false
+	g.mu.querierJob = tcpip.NewJob(opts.Clock, &g.mu, func() {
+		g.mu.querier = Querier{}
+		g.mu.hasQuerier = false
+	})
 }
 
 // MakeAllNonMember transitions all groups to the non-member state.
@@ -177,11 +249,22 @@ func (g *GenericMulticastProtocolState) MakeAllNonMember() {
 		g.transitionToNonMemberLocked(groupAddress, &info)
 		g.mu.memberships[groupAddress] = info
 	}
+
+	// The querier will be learned again from the queries received once the
+	// groups are initialized.
+	g.mu.querierJob.Cancel()
+	g.mu.querier = Querier{}
+	g.mu.hasQuerier = false
 }
 
 // InitializeGroups initializes each group, as if they were newly joined but
 // without affecting the groups' join count.
 //
+// Rather than emitting a burst of reports when many groups are initialized,
+// the reports are jittered over the maximum unsolicited report delay and sent
+// in batches. If the protocol implements MulticastGroupProtocolBatchReporter,
+// each batch is reported at once.
+//
 // Must only be called after calling MakeAllNonMember as a group should not be
 // initialized while it is not in the non-member state.
 func (g *GenericMulticastProtocolState) InitializeGroups() {
@@ -192,8 +275,58 @@ func (g *GenericMulticastProtocolState) InitializeGroups() {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	var groups []tcpip.Address
 	for groupAddress, info := range g.mu.memberships {
-		g.initializeNewMemberLocked(groupAddress, &info)
+		if info.state != nonMember {
+			panic(fmt.Sprintf("state for group %s is not non-member; state = %d", groupAddress, info.state))
+		}
+		info.state = idleMember
+		g.mu.memberships[groupAddress] = info
+		if groupAddress != g.opts.AllNodesAddress {
+			groups = append(groups, groupAddress)
+		}
+	}
+	// Sort the groups so that reports are sent in a deterministic order for a
+	// given source of random numbers.
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+
+	// Send the initial unsolicited reports. Protocols able to report multiple
+	// groups at once do so in a single batch, others report a limited number of
+	// groups immediately and defer the initial report of the others.
+	if batched, err := g.sendReports(groups); batched {
+		for _, groupAddress := range groups {
+			info := g.mu.memberships[groupAddress]
+			info.lastToSendReport = err == nil
+			g.mu.memberships[groupAddress] = info
+		}
+	} else {
+		reported := groups
+		if len(reported) > unsolicitedReportBurst {
+			reported = reported[:unsolicitedReportBurst]
+		}
+		for _, groupAddress := range reported {
+			info := g.mu.memberships[groupAddress]
+			info.lastToSendReport = g.opts.Protocol.SendReport(groupAddress) == nil
+			g.mu.memberships[groupAddress] = info
+		}
+	}
+
+	// Schedule the repeated reports of the groups reported above, and the
+	// initial reports of the deferred groups, in batches jittered over the
+	// maximum unsolicited report delay.
+	var batches [unsolicitedReportSlots]uint64
+	slot := g.opts.MaxUnsolicitedReportDelay / unsolicitedReportSlots
+	for _, groupAddress := range groups {
+		i := g.opts.Rand.Intn(unsolicitedReportSlots)
+		if batches[i] == 0 {
+			g.mu.lastBatch++
+			batches[i] = g.mu.lastBatch
+		}
+		info := g.mu.memberships[groupAddress]
+		info.state = delayingMember
+		info.batch = batches[i]
+		info.delayedReportJob.Cancel()
+		info.delayedReportJob.Schedule(time.Duration(i) * slot)
 		g.mu.memberships[groupAddress] = info
 	}
 }
@@ -226,6 +359,10 @@ func (g *GenericMulticastProtocolState) JoinGroup(groupAddress tcpip.Address, do
 				panic(fmt.Sprintf("expected to find group state for group = %s", groupAddress))
 			}
 
+			if info.batch != 0 {
+				g.sendBatchLocked(info.batch)
+				return
+			}
 			info.lastToSendReport = g.opts.Protocol.SendReport(groupAddress) == nil
 			info.state = idleMember
 			g.mu.memberships[groupAddress] = info
@@ -239,6 +376,13 @@ func (g *GenericMulticastProtocolState) JoinGroup(groupAddress tcpip.Address, do
 	g.mu.memberships[groupAddress] = info
 }
 
+// NumLocallyJoined returns the number of locally joined groups.
+func (g *GenericMulticastProtocolState) NumLocallyJoined() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.mu.memberships)
+}
+
 // IsLocallyJoined returns true if the group is locally joined.
 func (g *GenericMulticastProtocolState) IsLocallyJoined(groupAddress tcpip.Address) bool {
 	g.mu.RLock()
@@ -312,6 +456,54 @@ func (g *GenericMulticastProtocolState) HandleQuery(groupAddress tcpip.Address,
 	}
 }
 
+// HandleQuerier handles a query received from querier.
+//
+// The querier with the lowest address is tracked, as it is the one elected as
+// querier by the multicast routers on the link. Queries sent from the
+// unspecified address, e.g. by snooping switches, are only tracked while no
+// other querier is known.
+func (g *GenericMulticastProtocolState) HandleQuerier(querier Querier) {
+	if !g.opts.Enabled {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// As per RFC 2236 section 3 page 4 (for IGMPv2),
+	//
+	//   If it hears a Query from a router with a lower IP address, it MUST
+	//   become a Non-Querier on that network.
+	//
+	// As per RFC 2710 section 6 page 9 (for MLDv1),
+	//
+	//   If a router hears a Query message whose IPv6 Source Address is
+	//   numerically less than its own selected address for that link, it
+	//   MUST become a Non-Querier on that link.
+	if g.mu.hasQuerier && querier.Address != g.mu.querier.Address {
+		if querier.Address.Unspecified() {
+			return
+		}
+		if !g.mu.querier.Address.Unspecified() && querier.Address > g.mu.querier.Address {
+			return
+		}
+	}
+
+	g.mu.querier = querier
+	g.mu.hasQuerier = true
+	g.mu.querierJob.Cancel()
+	if g.opts.OtherQuerierPresentInterval != 0 {
+		g.mu.querierJob.Schedule(g.opts.OtherQuerierPresentInterval)
+	}
+}
+
+// Querier returns the querier on the link, or false if there is none.
+func (g *GenericMulticastProtocolState) Querier() (Querier, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.mu.querier, g.mu.hasQuerier
+}
+
 // HandleReport handles a report message.
 //
 // If the report is for a joined group, any active delayed report will be
@@ -340,6 +532,50 @@ func (g *GenericMulticastProtocolState) HandleReport(groupAddress tcpip.Address)
 		info.delayedReportJob.Cancel()
 		info.lastToSendReport = false
 		info.state = idleMember
+		info.batch = 0
+		g.mu.memberships[groupAddress] = info
+	}
+}
+
+// sendReports attempts to report all the groups at once. It returns false if
+// the protocol can't do so, in which case nothing was sent.
+func (g *GenericMulticastProtocolState) sendReports(groupAddresses []tcpip.Address) (bool, *tcpip.Error) {
+	if len(groupAddresses) == 0 {
+		return false, nil
+	}
+	r, ok := g.opts.Protocol.(MulticastGroupProtocolBatchReporter)
+	if !ok {
+		return false, nil
+	}
+	return r.SendReports(groupAddresses)
+}
+
+// sendBatchLocked sends the delayed reports of all the groups in batch.
+//
+// Precondition: g.mu must be locked.
+func (g *GenericMulticastProtocolState) sendBatchLocked(batch uint64) {
+	var groups []tcpip.Address
+	for groupAddress, info := range g.mu.memberships {
+		if info.batch != batch || info.state != delayingMember {
+			continue
+		}
+		// The delayed report jobs of the other groups in the batch may have
+		// fired already, cancel them as the groups are reported below.
+		info.delayedReportJob.Cancel()
+		groups = append(groups, groupAddress)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+
+	batched, err := g.sendReports(groups)
+	for _, groupAddress := range groups {
+		info := g.mu.memberships[groupAddress]
+		if batched {
+			info.lastToSendReport = err == nil
+		} else {
+			info.lastToSendReport = g.opts.Protocol.SendReport(groupAddress) == nil
+		}
+		info.state = idleMember
+		info.batch = 0
 		g.mu.memberships[groupAddress] = info
 	}
 }
@@ -478,6 +714,7 @@ func (g *GenericMulticastProtocolState) transitionToNonMemberLocked(groupAddress
 	g.maybeSendLeave(groupAddress, info.lastToSendReport)
 	info.lastToSendReport = false
 	info.state = nonMember
+	info.batch = 0
 }
 
 // setDelayTimerForAddressRLocked sets timer to send a delay report.
@@ -56,6 +56,19 @@ func (m *mockMulticastGroupProtocol) SendLeave(groupAddress tcpip.Address) *tcpi
 	return nil
 }
 
+var _ ip.MulticastGroupProtocolBatchReporter = (*mockBatchMulticastGroupProtocol)(nil)
+
+type mockBatchMulticastGroupProtocol struct {
+	mockMulticastGroupProtocol
+
+	sendReportsBatches [][]tcpip.Address
+}
+
+func (m *mockBatchMulticastGroupProtocol) SendReports(groupAddresses []tcpip.Address) (bool, *tcpip.Error) {
+	m.sendReportsBatches = append(m.sendReportsBatches, append([]tcpip.Address(nil), groupAddresses...))
+	return true, nil
+}
+
 func checkProtocol(mgp *mockMulticastGroupProtocol, sendReportGroupAddresses []tcpip.Address, sendLeaveGroupAddresses []tcpip.Address) string {
 	sendReportGroupAddressesMap := make(map[tcpip.Address]int)
 	for _, a := range sendReportGroupAddresses {
@@ -271,6 +284,73 @@ func TestHandleReport(t *testing.T) {
 	}
 }
 
+func TestHandleQuerier(t *testing.T) {
+	const otherQuerierPresentInterval = time.Minute
+
+	var g ip.GenericMulticastProtocolState
+	var mgp mockMulticastGroupProtocol
+	mgp.init()
+	clock := faketime.NewManualClock()
+	g.Init(ip.GenericMulticastProtocolOptions{
+		Enabled:                     true,
+		Rand:                        rand.New(rand.NewSource(0)),
+		Clock:                       clock,
+		Protocol:                    &mgp,
+		MaxUnsolicitedReportDelay:   maxUnsolicitedReportDelay,
+		AllNodesAddress:             addr3,
+		OtherQuerierPresentInterval: otherQuerierPresentInterval,
+	})
+
+	checkQuerier := func(want ip.Querier, wantOK bool) {
+		t.Helper()
+		got, ok := g.Querier()
+		if ok != wantOK {
+			t.Fatalf("got g.Querier() = (_, %t), want = (_, %t)", ok, wantOK)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("querier mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	checkQuerier(ip.Querier{}, false)
+
+	// Queries from the unspecified address are only tracked until a querier
+	// with an address is known.
+	g.HandleQuerier(ip.Querier{Address: "\x00", Version: 2})
+	checkQuerier(ip.Querier{Address: "\x00", Version: 2}, true)
+	g.HandleQuerier(ip.Querier{Address: addr2, Version: 2})
+	checkQuerier(ip.Querier{Address: addr2, Version: 2}, true)
+	g.HandleQuerier(ip.Querier{Address: "\x00", Version: 2})
+	checkQuerier(ip.Querier{Address: addr2, Version: 2}, true)
+
+	// The querier with the lowest address wins.
+	g.HandleQuerier(ip.Querier{Address: addr4, Version: 3})
+	checkQuerier(ip.Querier{Address: addr2, Version: 2}, true)
+	g.HandleQuerier(ip.Querier{Address: addr1, Version: 1})
+	checkQuerier(ip.Querier{Address: addr1, Version: 1}, true)
+
+	// The current querier's version is updated.
+	g.HandleQuerier(ip.Querier{Address: addr1, Version: 2})
+	checkQuerier(ip.Querier{Address: addr1, Version: 2}, true)
+
+	// Queries from the querier keep it present.
+	clock.Advance(otherQuerierPresentInterval - time.Nanosecond)
+	g.HandleQuerier(ip.Querier{Address: addr1, Version: 2})
+	clock.Advance(otherQuerierPresentInterval - time.Nanosecond)
+	checkQuerier(ip.Querier{Address: addr1, Version: 2}, true)
+
+	// The querier is forgotten once no query is received from it for the
+	// other querier present interval, letting another querier take over.
+	clock.Advance(time.Nanosecond)
+	checkQuerier(ip.Querier{}, false)
+	g.HandleQuerier(ip.Querier{Address: addr4, Version: 3})
+	checkQuerier(ip.Querier{Address: addr4, Version: 3}, true)
+
+	// The querier is forgotten when the groups are made non-members.
+	g.MakeAllNonMember()
+	checkQuerier(ip.Querier{}, false)
+}
+
 func TestHandleQuery(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -493,6 +573,121 @@ func TestMakeAllNonMemberAndInitialize(t *testing.T) {
 	}
 }
 
+// TestInitializeGroupsJitter tests that the reports sent when initializing many
+// groups at once are spread over the maximum unsolicited report delay.
+func TestInitializeGroupsJitter(t *testing.T) {
+	const numGroups = 20
+
+	var g ip.GenericMulticastProtocolState
+	var mgp mockMulticastGroupProtocol
+	mgp.init()
+	clock := faketime.NewManualClock()
+	g.Init(ip.GenericMulticastProtocolOptions{
+		Enabled:                   true,
+		Rand:                      rand.New(rand.NewSource(0)),
+		Clock:                     clock,
+		Protocol:                  &mgp,
+		MaxUnsolicitedReportDelay: maxUnsolicitedReportDelay,
+		AllNodesAddress:           addr1,
+	})
+
+	var groups []tcpip.Address
+	for i := 0; i < numGroups; i++ {
+		group := tcpip.Address([]byte{0x10, byte(i)})
+		groups = append(groups, group)
+		g.JoinGroup(group, true /* dontInitialize */)
+	}
+	if diff := checkProtocol(&mgp, nil /* sendReportGroupAddresses */, nil /* sendLeaveGroupAddresses */); diff != "" {
+		t.Fatalf("mockMulticastGroupProtocol mismatch (-want +got):\n%s", diff)
+	}
+
+	// Only a limited number of reports should be sent immediately.
+	g.InitializeGroups()
+	if got, want := len(mgp.sendReportGroupAddrCount), numGroups; got == 0 || got >= want {
+		t.Fatalf("got %d groups reported immediately, want between 1 and %d", got, want-1)
+	}
+	mgp.init()
+
+	// Every group should be reported once within the maximum unsolicited
+	// report delay, but not all at once.
+	sent := 0
+	for elapsed := time.Duration(0); elapsed < maxUnsolicitedReportDelay; elapsed += maxUnsolicitedReportDelay / 10 {
+		clock.Advance(maxUnsolicitedReportDelay / 10)
+		if n := len(mgp.sendReportGroupAddrCount); n == numGroups {
+			t.Fatalf("got all %d groups reported at once after %s", n, elapsed)
+		}
+		for group, count := range mgp.sendReportGroupAddrCount {
+			if count != 1 {
+				t.Errorf("got %d reports for group %s at once, want = 1", count, group)
+			}
+			sent++
+		}
+		mgp.init()
+	}
+	if sent != numGroups {
+		t.Errorf("got %d reports sent after the maximum unsolicited report delay, want = %d", sent, numGroups)
+	}
+
+	// Should have no more messages to send.
+	clock.Advance(time.Hour)
+	if diff := checkProtocol(&mgp, nil /* sendReportGroupAddresses */, nil /* sendLeaveGroupAddresses */); diff != "" {
+		t.Errorf("mockMulticastGroupProtocol mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestInitializeGroupsBatching tests that protocols able to report multiple
+// groups at once have their reports coalesced when initializing groups.
+func TestInitializeGroupsBatching(t *testing.T) {
+	var g ip.GenericMulticastProtocolState
+	var mgp mockBatchMulticastGroupProtocol
+	mgp.init()
+	clock := faketime.NewManualClock()
+	g.Init(ip.GenericMulticastProtocolOptions{
+		Enabled:                   true,
+		Rand:                      rand.New(rand.NewSource(0)),
+		Clock:                     clock,
+		Protocol:                  &mgp,
+		MaxUnsolicitedReportDelay: maxUnsolicitedReportDelay,
+		AllNodesAddress:           addr4,
+	})
+
+	for _, group := range []tcpip.Address{addr3, addr1, addr2, addr4} {
+		g.JoinGroup(group, true /* dontInitialize */)
+	}
+
+	// The initial reports should be sent in a single batch, excluding the
+	// all-nodes group.
+	g.InitializeGroups()
+	if diff := cmp.Diff([][]tcpip.Address{{addr1, addr2, addr3}}, mgp.sendReportsBatches); diff != "" {
+		t.Errorf("batches mismatch (-want +got):\n%s", diff)
+	}
+	mgp.sendReportsBatches = nil
+
+	// The repeated reports should be batched too, with each group reported
+	// once.
+	clock.Advance(maxUnsolicitedReportDelay)
+	reported := make(map[tcpip.Address]int)
+	for _, batch := range mgp.sendReportsBatches {
+		for _, group := range batch {
+			reported[group]++
+		}
+	}
+	if diff := cmp.Diff(map[tcpip.Address]int{addr1: 1, addr2: 1, addr3: 1}, reported); diff != "" {
+		t.Errorf("reported groups mismatch (-want +got):\n%s", diff)
+	}
+	mgp.sendReportsBatches = nil
+
+	// Individual reports should never be sent, and there should be no more
+	// messages to send.
+	clock.Advance(time.Hour)
+	if diff := checkProtocol(&mgp.mockMulticastGroupProtocol, nil /* sendReportGroupAddresses */, nil /* sendLeaveGroupAddresses */); diff != "" {
+		t.Errorf("mockMulticastGroupProtocol mismatch (-want +got):\n%s", diff)
+	}
+	if len(mgp.sendReportsBatches) != 0 {
+		t.Errorf("got unexpected batches = %v", mgp.sendReportsBatches)
+	}
+}
+
 // TestGroupStateNonMember tests that groups do not send packets when in the
 // non-member state, but are still considered locally joined.
 func TestGroupStateNonMember(t *testing.T) {
@@ -0,0 +1,107 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Codes of ICMP Extended Echo Replies, as per RFC 8335 section 3. They are the
+// same for ICMPv4 and ICMPv6.
+const (
+	ProbeNoError            = uint8(header.ICMPv4ExtendedEchoNoError)
+	ProbeMalformedQuery     = uint8(header.ICMPv4ExtendedEchoMalformedQuery)
+	ProbeNoSuchInterface    = uint8(header.ICMPv4ExtendedEchoNoSuchInterface)
+	ProbeMultipleInterfaces = uint8(header.ICMPv4ExtendedEchoMultipleInterfaces)
+)
+
+// ProbeInterface looks up the local interface identified by ext, the extension
+// structure of an ICMP Extended Echo Request, as per RFC 8335 section 4.
+//
+// Returns the code of the Extended Echo Reply and, if the interface was found,
+// its status.
+func ProbeInterface(s *stack.Stack, ext header.ICMPExtension) (uint8, header.ICMPExtendedEchoStatus) {
+	if !ext.IsValid() {
+		return ProbeMalformedQuery, header.ICMPExtendedEchoStatus{}
+	}
+	// The extension structure holds exactly one Interface Identification
+	// object.
+	objects, _ := ext.Objects()
+	if len(objects) != 1 {
+		return ProbeMalformedQuery, header.ICMPExtendedEchoStatus{}
+	}
+	ident, ok := objects[0].InterfaceIdent()
+	if !ok {
+		return ProbeMalformedQuery, header.ICMPExtendedEchoStatus{}
+	}
+
+	var (
+		found  stack.NICInfo
+		nFound int
+	)
+	for id, info := range s.NICInfo() {
+		switch {
+		case len(ident.Name) != 0:
+			if info.Name != ident.Name {
+				continue
+			}
+		case len(ident.Address) != 0:
+			if !hasAddress(info, ident.Address) {
+				continue
+			}
+		default:
+			if uint32(id) != ident.Index {
+				continue
+			}
+		}
+		found = info
+		nFound++
+	}
+	switch nFound {
+	case 0:
+		return ProbeNoSuchInterface, header.ICMPExtendedEchoStatus{}
+	case 1:
+	default:
+		return ProbeMultipleInterfaces, header.ICMPExtendedEchoStatus{}
+	}
+
+	// Netstack interfaces are always up, so report enabled interfaces as
+	// active. As per RFC 8335 section 3, the 4 and 6 bits are only set when
+	// the interface is active.
+	status := header.ICMPExtendedEchoStatus{Active: found.Flags.Running}
+	if status.Active {
+		for _, addr := range found.ProtocolAddresses {
+			switch addr.Protocol {
+			case header.IPv4ProtocolNumber:
+				status.IPv4 = true
+			case header.IPv6ProtocolNumber:
+				status.IPv6 = true
+			}
+		}
+	}
+	return ProbeNoError, status
+}
+
+// hasAddress returns true if addr is assigned to the NIC described by info.
+func hasAddress(info stack.NICInfo, addr tcpip.Address) bool {
+	for _, a := range info.ProtocolAddresses {
+		if a.AddressWithPrefix.Address == addr {
+			return true
+		}
+	}
+	return false
+}
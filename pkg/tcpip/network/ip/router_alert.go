@@ -0,0 +1,78 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ip
+
+import (
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// RouterAlertHandlers holds the stack.RouterAlertHandlers registered with a
+// network protocol, keyed by transport protocol.
+//
+// The zero value is ready to use.
+type RouterAlertHandlers struct {
+	mu struct {
+		sync.RWMutex
+
+		handlers map[tcpip.TransportProtocolNumber]stack.RouterAlertHandler
+	}
+}
+
+// Register registers h as the handler for proto.
+//
+// Returns tcpip.ErrAlreadyBound if a handler is already registered for proto.
+func (r *RouterAlertHandlers) Register(proto tcpip.TransportProtocolNumber, h stack.RouterAlertHandler) *tcpip.Error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.mu.handlers[proto]; ok {
+		return tcpip.ErrAlreadyBound
+	}
+	if r.mu.handlers == nil {
+		r.mu.handlers = make(map[tcpip.TransportProtocolNumber]stack.RouterAlertHandler)
+	}
+	r.mu.handlers[proto] = h
+	return nil
+}
+
+// Unregister removes the handler registered for proto.
+func (r *RouterAlertHandlers) Unregister(proto tcpip.TransportProtocolNumber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.mu.handlers, proto)
+}
+
+// Handle punts pkt to the handler registered for proto.
+//
+// Packets that are not destined to this host are only punted if they carry a
+// Router Alert option.
+//
+// Returns true if the packet was consumed by a handler. The handler is called
+// without holding any locks so it may call back into the network protocol.
+func (r *RouterAlertHandlers) Handle(proto tcpip.TransportProtocolNumber, info stack.RouterAlertPacketInfo, pkt *stack.PacketBuffer) bool {
+	if !info.Local && !info.RouterAlert {
+		return false
+	}
+
+	r.mu.RLock()
+	h, ok := r.mu.handlers[proto]
+	r.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	return h.HandleRouterAlert(info, pkt)
+}
@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
@@ -82,7 +83,7 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 		// we are the only handler, however other types do not cope well with
 		// packets with checksum errors.
 		switch h.Type() {
-		case header.ICMPv4Echo:
+		case header.ICMPv4Echo, header.ICMPv4ExtendedEchoRequest:
 			e.dispatcher.DeliverTransportPacket(header.ICMPv4ProtocolNumber, pkt)
 		}
 		return
@@ -101,7 +102,7 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 		//
 		// So we need to let the option processor know how it should handle them.
 		var op optionsUsage
-		if h.Type() == header.ICMPv4Echo {
+		if typ := h.Type(); typ == header.ICMPv4Echo || typ == header.ICMPv4ExtendedEchoRequest {
 			op = &optionUsageEcho{}
 		} else {
 			op = &optionUsageReceive{}
@@ -127,8 +128,20 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 
 	// TODO(b/112892170): Meaningfully handle all ICMP types.
 	switch h.Type() {
-	case header.ICMPv4Echo:
-		received.Echo.Increment()
+	case header.ICMPv4Echo, header.ICMPv4ExtendedEchoRequest:
+		if h.Type() == header.ICMPv4ExtendedEchoRequest {
+			received.ExtendedEchoRequest.Increment()
+
+			// Like Linux, silently ignore probes when they are disabled and
+			// probes of interfaces of other nodes, as we don't act as a proxy
+			// (RFC 8335 section 4).
+			if !e.protocol.echoProbeEnabled() || !h.ExtendedEchoLocal() {
+				e.dispatcher.DeliverTransportPacket(header.ICMPv4ProtocolNumber, pkt)
+				return
+			}
+		} else {
+			received.Echo.Increment()
+		}
 
 		sent := stats.ICMP.V4.PacketsSent
 		if !e.protocol.stack.AllowICMPMessage() {
@@ -200,7 +213,14 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 		replyIPHdr.SetTTL(r.DefaultTTL())
 
 		replyICMPHdr := header.ICMPv4(replyData)
-		replyICMPHdr.SetType(header.ICMPv4EchoReply)
+		if replyICMPHdr.Type() == header.ICMPv4ExtendedEchoRequest {
+			code, status := ip.ProbeInterface(e.protocol.stack, header.ICMPExtension(replyICMPHdr.Payload()))
+			replyICMPHdr.SetType(header.ICMPv4ExtendedEchoReply)
+			replyICMPHdr.SetCode(header.ICMPv4Code(code))
+			replyICMPHdr.SetExtendedEchoStatus(status)
+		} else {
+			replyICMPHdr.SetType(header.ICMPv4EchoReply)
+		}
 		replyICMPHdr.SetChecksum(0)
 		replyICMPHdr.SetChecksum(^header.Checksum(replyData, 0))
 
@@ -216,13 +236,22 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer) {
 			sent.Dropped.Increment()
 			return
 		}
-		sent.EchoReply.Increment()
+		if replyICMPHdr.Type() == header.ICMPv4ExtendedEchoReply {
+			sent.ExtendedEchoReply.Increment()
+		} else {
+			sent.EchoReply.Increment()
+		}
 
 	case header.ICMPv4EchoReply:
 		received.EchoReply.Increment()
 
 		e.dispatcher.DeliverTransportPacket(header.ICMPv4ProtocolNumber, pkt)
 
+	case header.ICMPv4ExtendedEchoReply:
+		received.ExtendedEchoReply.Increment()
+
+		e.dispatcher.DeliverTransportPacket(header.ICMPv4ProtocolNumber, pkt)
+
 	case header.ICMPv4DstUnreachable:
 		received.DstUnreachable.Increment()
 
@@ -415,7 +444,9 @@ func (p *protocol) returnError(reason icmpReason, pkt *stack.PacketBuffer) *tcpi
 			header.ICMPv4Timestamp,
 			header.ICMPv4TimestampReply,
 			header.ICMPv4InfoRequest,
-			header.ICMPv4InfoReply:
+			header.ICMPv4InfoReply,
+			header.ICMPv4ExtendedEchoRequest,
+			header.ICMPv4ExtendedEchoReply:
 		default:
 			// Assume any type we don't know about may be an error type.
 			return nil
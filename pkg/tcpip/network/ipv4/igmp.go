@@ -49,6 +49,11 @@ const (
 	//
 	// Obtained from RFC 2236 Section 8.10, Page 19.
 	UnsolicitedReportIntervalMax = 10 * time.Second
+
+	// otherQuerierPresentInterval from RFC 2236 Section 8.5, Page 18. It is
+	// the Robustness Variable times the Query Interval plus one half of the
+	// Query Response Interval, using their default values.
+	otherQuerierPresentInterval = 255 * time.Second
 )
 
 // IGMPOptions holds options for IGMP.
@@ -59,9 +64,19 @@ type IGMPOptions struct {
 	// joining and leaving multicast groups respectively, and handle incoming
 	// IGMP packets.
 	Enabled bool
+
+	// V3Reports indicates whether reports are sent as IGMPv3 Membership
+	// Reports, holding a MODE_IS_EXCLUDE record without sources for each
+	// reported group, instead of IGMPv2 Membership Reports. Reports for
+	// multiple groups are then coalesced. Leaves are sent as IGMPv3 Membership
+	// Reports with a CHANGE_TO_INCLUDE_MODE record.
+	//
+	// IGMPv1 reports are still sent when an IGMPv1 router is present.
+	V3Reports bool
 }
 
 var _ ip.MulticastGroupProtocol = (*igmpState)(nil)
+var _ ip.MulticastGroupProtocolBatchReporter = (*igmpState)(nil)
 
 // igmpState is the per-interface IGMP state.
 //
@@ -98,6 +113,9 @@ type igmpState struct {
 
 // SendReport implements ip.MulticastGroupProtocol.
 func (igmp *igmpState) SendReport(groupAddress tcpip.Address) *tcpip.Error {
+	if igmp.v3Reports() {
+		return igmp.writeV3Report(header.GroupRecordModeIsExclude, []tcpip.Address{groupAddress})
+	}
 	igmpType := header.IGMPv2MembershipReport
 	if igmp.v1Present() {
 		igmpType = header.IGMPv1MembershipReport
@@ -114,9 +132,26 @@ func (igmp *igmpState) SendLeave(groupAddress tcpip.Address) *tcpip.Error {
 	if igmp.v1Present() {
 		return nil
 	}
+	if igmp.v3Reports() {
+		return igmp.writeV3Report(header.GroupRecordChangeToIncludeMode, []tcpip.Address{groupAddress})
+	}
 	return igmp.writePacket(header.IPv4AllRoutersGroup, groupAddress, header.IGMPLeaveGroup)
 }
 
+// SendReports implements ip.MulticastGroupProtocolBatchReporter.
+func (igmp *igmpState) SendReports(groupAddresses []tcpip.Address) (bool, *tcpip.Error) {
+	if !igmp.v3Reports() {
+		return false, nil
+	}
+	return true, igmp.writeV3Report(header.GroupRecordModeIsExclude, groupAddresses)
+}
+
+// v3Reports returns true if reports should be sent as IGMPv3 Membership
+// Reports.
+func (igmp *igmpState) v3Reports() bool {
+	return igmp.opts.V3Reports && !igmp.v1Present()
+}
+
 // init sets up an igmpState struct, and is required to be called before using
 // a new igmpState.
 func (igmp *igmpState) init(ep *endpoint, opts IGMPOptions) {
@@ -131,6 +166,8 @@ func (igmp *igmpState) init(ep *endpoint, opts IGMPOptions) {
 		Protocol:                  igmp,
 		MaxUnsolicitedReportDelay: UnsolicitedReportIntervalMax,
 		AllNodesAddress:           header.IPv4AllSystems,
+
+		OtherQuerierPresentInterval: otherQuerierPresentInterval,
 	})
 	igmp.igmpV1Present = igmpV1PresentDefault
 	igmp.mu.igmpV1Job = igmp.ep.protocol.stack.NewJob(&igmp.mu, func() {
@@ -138,6 +175,24 @@ func (igmp *igmpState) init(ep *endpoint, opts IGMPOptions) {
 	})
 }
 
+var _ stack.RouterAlertHandler = (*igmpRouterAlertHandler)(nil)
+
+// igmpRouterAlertHandler delivers IGMP messages punted by IPv4 endpoints to
+// the IGMP state of the receiving endpoint.
+type igmpRouterAlertHandler struct{}
+
+// HandleRouterAlert implements stack.RouterAlertHandler.
+func (*igmpRouterAlertHandler) HandleRouterAlert(info stack.RouterAlertPacketInfo, pkt *stack.PacketBuffer) bool {
+	// IGMP messages are only of interest to the hosts they are addressed to;
+	// we do not act as a multicast router.
+	if !info.Local {
+		return false
+	}
+
+	info.Endpoint.(*endpoint).igmp.handleIGMP(pkt)
+	return true
+}
+
 func (igmp *igmpState) handleIGMP(pkt *stack.PacketBuffer) {
 	stats := igmp.ep.protocol.stack.Stats()
 	received := stats.IGMP.PacketsReceived
@@ -167,7 +222,7 @@ func (igmp *igmpState) handleIGMP(pkt *stack.PacketBuffer) {
 			received.Invalid.Increment()
 			return
 		}
-		igmp.handleMembershipQuery(h.GroupAddress(), h.MaxRespTime())
+		igmp.handleMembershipQuery(header.IPv4(pkt.NetworkHeader().View()).SourceAddress(), len(headerView) >= header.IGMPv3QueryMinimumSize, h.GroupAddress(), h.MaxRespTime())
 	case header.IGMPv1MembershipReport:
 		received.V1MembershipReport.Increment()
 		if len(headerView) < header.IGMPReportMinimumSize {
@@ -207,10 +262,22 @@ func (igmp *igmpState) setV1Present(v bool) {
 	}
 }
 
-func (igmp *igmpState) handleMembershipQuery(groupAddress tcpip.Address, maxRespTime time.Duration) {
+func (igmp *igmpState) handleMembershipQuery(srcAddress tcpip.Address, v3 bool, groupAddress tcpip.Address, maxRespTime time.Duration) {
 	igmp.mu.Lock()
 	defer igmp.mu.Unlock()
 
+	// As per RFC 3376 Section 7.1, Page 37, the version of a query is
+	// determined by its length and Max Resp Code: IGMPv3 queries are at least
+	// 12 octets long, IGMPv1 queries have a Max Resp Code of zero.
+	querier := ip.Querier{Address: srcAddress, Version: 2}
+	switch {
+	case v3:
+		querier.Version = 3
+	case maxRespTime == 0:
+		querier.Version = 1
+	}
+	igmp.mu.genericMulticastProtocol.HandleQuerier(querier)
+
 	// As per RFC 2236 Section 6, Page 10: If the maximum response time is zero
 	// then change the state to note that an IGMPv1 router is present and
 	// schedule the query received Job.
@@ -225,6 +292,12 @@ func (igmp *igmpState) handleMembershipQuery(groupAddress tcpip.Address, maxResp
 }
 
 func (igmp *igmpState) handleMembershipReport(groupAddress tcpip.Address) {
+	// As per RFC 3376 Section 5.1, Page 19, IGMPv3 hosts do not suppress their
+	// reports when hearing the reports of other members.
+	if igmp.v3Reports() {
+		return
+	}
+
 	igmp.mu.Lock()
 	defer igmp.mu.Unlock()
 	igmp.mu.genericMulticastProtocol.HandleReport(groupAddress)
@@ -237,7 +310,49 @@ func (igmp *igmpState) writePacket(destAddress tcpip.Address, groupAddress tcpip
 	igmpData.SetType(igmpType)
 	igmpData.SetGroupAddress(groupAddress)
 	igmpData.SetChecksum(header.IGMPCalculateChecksum(igmpData))
+	return igmp.writeMessage(destAddress, igmpData)
+}
+
+// writeV3Report sends IGMPv3 Membership Reports holding a record of type
+// recordType for each group, splitting the records across as many reports as
+// needed to fit in the MTU.
+func (igmp *igmpState) writeV3Report(recordType header.GroupRecordType, groupAddresses []tcpip.Address) *tcpip.Error {
+	records := make([]header.GroupRecord, 0, len(groupAddresses))
+	for _, groupAddress := range groupAddresses {
+		records = append(records, header.GroupRecord{
+			Type:             recordType,
+			MulticastAddress: groupAddress,
+		})
+	}
+
+	maxRecords := len(records)
+	if len(records) != 0 {
+		perRecord := header.IGMPv3ReportSize(records[:1]) - header.IGMPv3ReportMinimumSize
+		if n := (int(igmp.ep.MTU()) - header.IGMPv3ReportMinimumSize) / perRecord; n > 0 && n < maxRecords {
+			maxRecords = n
+		}
+	}
+
+	var firstErr *tcpip.Error
+	for len(records) != 0 {
+		n := maxRecords
+		if n > len(records) {
+			n = len(records)
+		}
+		igmpData := header.IGMP(buffer.NewView(header.IGMPv3ReportSize(records[:n])))
+		header.IGMPv3Report(igmpData).Encode(records[:n])
+		igmpData.SetChecksum(header.IGMPCalculateChecksum(igmpData))
+		if err := igmp.writeMessage(header.IGMPv3RoutersAddress, igmpData); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		records = records[n:]
+	}
+	return firstErr
+}
 
+// writeMessage sends the IGMP message igmpData to destAddress, incrementing
+// the sent stat counter for its type on success.
+func (igmp *igmpState) writeMessage(destAddress tcpip.Address, igmpData header.IGMP) *tcpip.Error {
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: int(igmp.ep.MaxHeaderLength()),
 		Data:               buffer.View(igmpData).ToVectorisedView(),
@@ -246,11 +361,13 @@ func (igmp *igmpState) writePacket(destAddress tcpip.Address, groupAddress tcpip
 	// TODO(gvisor.dev/issue/4888): We should not use the unspecified address,
 	// rather we should select an appropriate local address.
 	localAddr := header.IPv4Any
-	igmp.ep.addIPHeader(localAddr, destAddress, pkt, stack.NetworkHeaderParams{
+	if err := igmp.ep.addIPHeader(localAddr, destAddress, pkt, stack.NetworkHeaderParams{
 		Protocol: header.IGMPProtocolNumber,
 		TTL:      header.IGMPTTL,
 		TOS:      stack.DefaultTOS,
-	})
+	}); err != nil {
+		panic(fmt.Sprintf("failed to add IP header: %s", err))
+	}
 
 	// TODO(b/162198658): set the ROUTER_ALERT option when sending Host
 	// Membership Reports.
@@ -259,11 +376,13 @@ func (igmp *igmpState) writePacket(destAddress tcpip.Address, groupAddress tcpip
 		sent.Dropped.Increment()
 		return err
 	}
-	switch igmpType {
+	switch igmpType := igmpData.Type(); igmpType {
 	case header.IGMPv1MembershipReport:
 		sent.V1MembershipReport.Increment()
 	case header.IGMPv2MembershipReport:
 		sent.V2MembershipReport.Increment()
+	case header.IGMPv3MembershipReport:
+		sent.V3MembershipReport.Increment()
 	case header.IGMPLeaveGroup:
 		sent.LeaveGroup.Increment()
 	default:
@@ -284,6 +403,13 @@ func (igmp *igmpState) joinGroup(groupAddress tcpip.Address) {
 	igmp.mu.genericMulticastProtocol.JoinGroup(groupAddress, !igmp.ep.Enabled() /* dontInitialize */)
 }
 
+// querier returns the querier on the link, if any.
+func (igmp *igmpState) querier() (ip.Querier, bool) {
+	igmp.mu.RLock()
+	defer igmp.mu.RUnlock()
+	return igmp.mu.genericMulticastProtocol.Querier()
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 func (igmp *igmpState) isInGroup(groupAddress tcpip.Address) bool {
 	igmp.mu.Lock()
@@ -291,6 +417,13 @@ func (igmp *igmpState) isInGroup(groupAddress tcpip.Address) bool {
 	return igmp.mu.genericMulticastProtocol.IsLocallyJoined(groupAddress)
 }
 
+// numGroups returns the number of locally joined groups.
+func (igmp *igmpState) numGroups() int {
+	igmp.mu.Lock()
+	defer igmp.mu.Unlock()
+	return igmp.mu.genericMulticastProtocol.NumLocallyJoined()
+}
+
 // leaveGroup handles removing the group from the membership map, cancels any
 // delay timers associated with that group, and sends the Leave Group message
 // if required.
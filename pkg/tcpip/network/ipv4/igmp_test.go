@@ -151,3 +151,70 @@ func TestIgmpV1Present(t *testing.T) {
 	}
 	validateIgmpPacket(t, p, multicastAddr, header.IGMPv1MembershipReport, 0, multicastAddr)
 }
+
+// TestIGMPV3ReportsCoalesced tests that the reports for groups initialized
+// together are sent in a single IGMPv3 Membership Report.
+func TestIGMPV3ReportsCoalesced(t *testing.T) {
+	groups := []tcpip.Address{
+		"\xe0\x00\x00\x03",
+		"\xe0\x00\x00\x04",
+		"\xe0\x00\x00\x05",
+	}
+
+	e := channel.New(len(groups), 1280, linkAddr)
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocolWithOptions(ipv4.Options{
+			IGMP: ipv4.IGMPOptions{
+				Enabled:   true,
+				V3Reports: true,
+			},
+		})},
+		Clock: clock,
+	})
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+	if err := s.DisableNIC(nicID); err != nil {
+		t.Fatalf("DisableNIC(%d): %s", nicID, err)
+	}
+	for _, group := range groups {
+		if err := s.JoinGroup(ipv4.ProtocolNumber, nicID, group); err != nil {
+			t.Fatalf("JoinGroup(ipv4, %d, %s): %s", nicID, group, err)
+		}
+	}
+	if got := e.Drain(); got != 0 {
+		t.Fatalf("got e.Drain() = %d packets sent while the NIC is disabled, want = 0", got)
+	}
+
+	if err := s.EnableNIC(nicID); err != nil {
+		t.Fatalf("EnableNIC(%d): %s", nicID, err)
+	}
+	p, ok := e.Read()
+	if !ok {
+		t.Fatal("expected an IGMPv3 Membership Report")
+	}
+	if got := s.Stats().IGMP.PacketsSent.V3MembershipReport.Value(); got != 1 {
+		t.Fatalf("got V3MembershipReport messages sent = %d, want = 1", got)
+	}
+	ip := header.IPv4(stack.PayloadSince(p.Pkt.NetworkHeader()))
+	if got, want := ip.DestinationAddress(), header.IGMPv3RoutersAddress; got != want {
+		t.Errorf("got ip.DestinationAddress() = %s, want = %s", got, want)
+	}
+	report := header.IGMPv3Report(ip.Payload())
+	if !report.IsValid() {
+		t.Fatalf("got invalid IGMPv3 Membership Report = %x", []byte(report))
+	}
+	records, _ := report.GroupRecords()
+	if len(records) != len(groups) {
+		t.Fatalf("got %d group records, want = %d", len(records), len(groups))
+	}
+	for i, r := range records {
+		if r.Type != header.GroupRecordModeIsExclude || r.MulticastAddress != groups[i] || len(r.Sources) != 0 {
+			t.Errorf("got records[%d] = %+v, want MODE_IS_EXCLUDE record for %s without sources", i, r, groups[i])
+		}
+	}
+	if p, ok := e.Read(); ok {
+		t.Errorf("got unexpected packet = %#v", p)
+	}
+}
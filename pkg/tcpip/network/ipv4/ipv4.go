@@ -29,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/header/parse"
 	"gvisor.dev/gvisor/pkg/tcpip/network/fragmentation"
 	"gvisor.dev/gvisor/pkg/tcpip/network/hash"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
@@ -54,6 +55,20 @@ const (
 	// DefaultTTL is the default time-to-live value for this endpoint.
 	DefaultTTL = 64
 
+	// DefaultMulticastTTL is the default TTL of multicast packets. Linux
+	// defaults to 1, so that multicast packets don't leave the local network
+	// unless requested.
+	DefaultMulticastTTL = 1
+
+	// DefaultMaxSocketMemberships is the default maximum number of multicast
+	// groups a single socket may join. Linux defaults
+	// net.ipv4.igmp_max_memberships to 20.
+	DefaultMaxSocketMemberships = 20
+
+	// DefaultMaxNICMemberships is the default maximum number of multicast
+	// groups which may be joined on a single NIC.
+	DefaultMaxNICMemberships = 1024
+
 	// buckets is the number of identifier buckets.
 	buckets = 2048
 
@@ -215,7 +230,9 @@ func (e *endpoint) NetworkProtocolNumber() tcpip.NetworkProtocolNumber {
 	return e.protocol.Number()
 }
 
-func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.PacketBuffer, params stack.NetworkHeaderParams) {
+// addIPHeader adds an IPv4 header to pkt. It returns ErrMessageTooLong if the
+// resulting packet can't be described by the header's total length field.
+func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.PacketBuffer, params stack.NetworkHeaderParams) *tcpip.Error {
 	hdrLen := header.IPv4MinimumSize
 	var opts header.IPv4Options
 	if params.Options != nil {
@@ -231,6 +248,9 @@ func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.Packet
 			panic(fmt.Sprintf("IPv4 Options %d bytes, Max %d", params.Options.SizeWithPadding(), header.IPv4MaximumOptionsSize))
 		}
 	}
+	if pkt.Size()+hdrLen > MaxTotalSize {
+		return tcpip.ErrMessageTooLong
+	}
 	ip := header.IPv4(pkt.NetworkHeader().Push(hdrLen))
 	length := uint16(pkt.Size())
 	// RFC 6864 section 4.3 mandates uniqueness of ID values for non-atomic
@@ -249,6 +269,7 @@ func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.Packet
 	})
 	ip.SetChecksum(^ip.CalculateChecksum())
 	pkt.NetworkProtocolNumber = ProtocolNumber
+	return nil
 }
 
 // handleFragments fragments pkt and calls the handler function on each
@@ -276,7 +297,10 @@ func (e *endpoint) handleFragments(r *stack.Route, gso *stack.GSO, networkMTU ui
 
 // WritePacket writes a packet to the given destination address and protocol.
 func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, params stack.NetworkHeaderParams, pkt *stack.PacketBuffer) *tcpip.Error {
-	e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params)
+	if err := e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params); err != nil {
+		r.Stats().IP.OutgoingPacketErrors.Increment()
+		return err
+	}
 
 	// iptables filtering. All packets that reach here are locally
 	// generated.
@@ -364,7 +388,10 @@ func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.Packe
 	}
 
 	for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
-		e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params)
+		if err := e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params); err != nil {
+			r.Stats().IP.OutgoingPacketErrors.IncrementBy(uint64(pkts.Len()))
+			return 0, err
+		}
 		networkMTU, err := calculateNetworkMTU(e.nic.MTU(), uint32(pkt.NetworkHeader().View().Size()))
 		if err != nil {
 			r.Stats().IP.OutgoingPacketErrors.IncrementBy(uint64(pkts.Len()))
@@ -381,7 +408,8 @@ func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.Packe
 				pkt = fragPkt
 				return nil
 			}); err != nil {
-				panic(fmt.Sprintf("e.handleFragments(_, _, %d, _, _) = %s", networkMTU, err))
+				r.Stats().IP.OutgoingPacketErrors.IncrementBy(uint64(pkts.Len()))
+				return 0, err
 			}
 			// Remove the packet that was just fragmented and process the rest.
 			pkts.Remove(originalPkt)
@@ -509,31 +537,64 @@ func (e *endpoint) forwardPacket(pkt *stack.PacketBuffer) *tcpip.Error {
 		//  If the gateway processing a datagram finds the time to live field
 		//  is zero it must discard the datagram.  The gateway may also notify
 		//  the source host via the time exceeded message.
+		//
+		// The time exceeded message is subject to the stack's ICMP rate limit.
+		e.protocol.stack.Stats().IP.HopLimitExceeded.Increment()
+		if stats, err := e.protocol.stack.NICForwardingStats(e.nic.ID()); err == nil {
+			stats.HopLimitExceeded.Increment()
+		}
 		return e.protocol.returnError(&icmpReasonTTLExceeded{}, pkt)
 	}
 
-	dstAddr := h.DestinationAddress()
+	// The packets of a flow following the first one are forwarded through the
+	// route cached for the flow, if any.
+	flow := stack.ForwardingFlowOf(e.nic.ID(), pkt)
+	r, gen := e.protocol.stack.LookupForwardingFlow(flow)
+	if r == nil {
+		dstAddr := h.DestinationAddress()
 
-	// Check if the destination is owned by the stack.
-	networkEndpoint, err := e.protocol.stack.FindNetworkEndpoint(ProtocolNumber, dstAddr)
-	if err == nil {
-		networkEndpoint.(*endpoint).handlePacket(pkt)
-		return nil
-	}
-	if err != tcpip.ErrBadAddress {
-		return err
+		// Check if the destination is owned by the stack.
+		networkEndpoint, err := e.protocol.stack.FindNetworkEndpoint(ProtocolNumber, dstAddr)
+		if err == nil {
+			networkEndpoint.(*endpoint).handlePacket(pkt)
+			return nil
+		}
+		if err != tcpip.ErrBadAddress {
+			return err
+		}
+
+		// Packets are only forwarded within the group of the NIC they were
+		// received on.
+		group, err := e.protocol.stack.NICGroup(e.nic.ID())
+		if err != nil {
+			return err
+		}
+		r, err = e.protocol.stack.FindRouteInGroup(group, 0, "", dstAddr, ProtocolNumber, false /* multicastLoop */)
+		if err != nil {
+			return err
+		}
+
+		// Multicast packets must not be forwarded beyond their scope, as per RFC
+		// 2365 section 3 and RFC 4007 section 5.
+		if header.IsV4MulticastAddress(dstAddr) && !e.protocol.stack.CanForwardMulticast(e.nic.ID(), r.NICID(), header.V4MulticastScope(dstAddr)) {
+			r.Release()
+			e.protocol.stack.Stats().IP.MulticastScopeBoundaryDropped.Increment()
+			return nil
+		}
+
+		e.protocol.stack.CacheForwardingFlow(flow, gen, r)
 	}
+	defer r.Release()
 
-	r, err := e.protocol.stack.FindRoute(0, "", dstAddr, ProtocolNumber, false /* multicastLoop */)
+	forwardToEp, err := e.protocol.stack.GetNetworkEndpoint(r.NICID(), ProtocolNumber)
 	if err != nil {
 		return err
 	}
-	defer r.Release()
 
-	// We need to do a deep copy of the IP packet because
-	// WriteHeaderIncludedPacket takes ownership of the packet buffer, but we do
-	// not own it.
+	// We need to do a deep copy of the IP packet because writeForwardedPacket
+	// takes ownership of the packet buffer, but we do not own it.
 	newHdr := header.IPv4(stack.PayloadSince(pkt.NetworkHeader()))
+	hdrLen := len(h)
 
 	// As per RFC 791 page 30, Time to Live,
 	//
@@ -541,12 +602,47 @@ func (e *endpoint) forwardPacket(pkt *stack.PacketBuffer) *tcpip.Error {
 	//   is processed to reflect the time spent processing the datagram.
 	//   Even if no local information is available on the time actually
 	//   spent, the field must be decremented by 1.
-	newHdr.SetTTL(ttl - 1)
+	//
+	// The header checksum was verified when the packet was received, so it
+	// only needs to be updated to reflect the new TTL.
+	newHdr.SetTTLWithChecksumUpdate(ttl - 1)
 
-	return r.WriteHeaderIncludedPacket(stack.NewPacketBuffer(stack.PacketBufferOptions{
+	if err := forwardToEp.(*endpoint).writeForwardedPacket(r, hdrLen, stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: int(r.MaxHeaderLength()),
 		Data:               buffer.View(newHdr).ToVectorisedView(),
-	}))
+	})); err != nil {
+		return err
+	}
+
+	e.protocol.stack.Stats().IP.PacketsForwarded.Increment()
+	if stats, err := e.protocol.stack.NICForwardingStats(r.NICID()); err == nil {
+		stats.Forwarded.Increment()
+	}
+	return nil
+}
+
+// writeForwardedPacket writes a packet being forwarded, whose IP header is
+// made of its first hdrLen bytes. Unlike WriteHeaderIncludedPacket, it leaves
+// the header, which is already complete and was validated when the packet was
+// received, untouched and doesn't parse it again.
+func (e *endpoint) writeForwardedPacket(r *stack.Route, hdrLen int, pkt *stack.PacketBuffer) *tcpip.Error {
+	if _, ok := pkt.NetworkHeader().Consume(hdrLen); !ok {
+		return tcpip.ErrMalformedHeader
+	}
+	pkt.NetworkProtocolNumber = ProtocolNumber
+	return e.writePacket(r, nil /* gso */, pkt, true /* headerIncluded */)
+}
+
+// recordEvent records an anomaly detected in a packet from srcAddr in the event
+// log of the stack.
+func (e *endpoint) recordEvent(kind stack.EventKind, srcAddr tcpip.Address, detail string) {
+	e.protocol.stack.RecordEvent(stack.Event{
+		Kind:     kind,
+		NICID:    e.nic.ID(),
+		Protocol: uint32(ProtocolNumber),
+		Source:   tcpip.FullAddress{NIC: e.nic.ID(), Addr: srcAddr},
+		Detail:   detail,
+	})
 }
 
 // HandlePacket is called by the link layer when new ipv4 packets arrive for
@@ -560,13 +656,29 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 		return
 	}
 
-	// Loopback traffic skips the prerouting chain.
+	// Loopback traffic skips the prerouting chain and reverse path filtering.
 	if !e.nic.IsLoopback() {
 		if ok := e.protocol.stack.IPTables().Check(stack.Prerouting, pkt, nil, nil, e.MainAddress().Address, ""); !ok {
 			// iptables is telling us to drop the packet.
 			stats.IP.IPTablesPreroutingDropped.Increment()
 			return
 		}
+
+		h := header.IPv4(pkt.NetworkHeader().View())
+		if !e.protocol.stack.CheckReversePath(e.nic.ID(), h.SourceAddress()) {
+			stats.IP.ReversePathFilterDropped.Increment()
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, h.SourceAddress(), h.DestinationAddress(), stack.MartianReversePath)
+			return
+		}
+
+		// Packets from loopback or local addresses can't have been sent
+		// by another host. They are only reported, as an anti-spoofing
+		// signal.
+		if srcAddr := h.SourceAddress(); header.IsV4LoopbackAddress(srcAddr) {
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, h.DestinationAddress(), stack.MartianLoopbackSource)
+		} else if e.protocol.stack.IsLocalAddress(ProtocolNumber, srcAddr) {
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, h.DestinationAddress(), stack.MartianLocalSource)
+		}
 	}
 
 	e.handlePacket(pkt)
@@ -607,6 +719,7 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 	//        succeeds.
 	if h.CalculateChecksum() != 0xffff {
 		stats.IP.MalformedPacketsReceived.Increment()
+		e.recordEvent(stack.EventChecksumError, h.SourceAddress(), "bad header checksum")
 		return
 	}
 
@@ -619,6 +732,7 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 	//   multicast address).
 	if srcAddr == header.IPv4Broadcast || header.IsV4MulticastAddress(srcAddr) {
 		stats.IP.InvalidSourceAddressesReceived.Increment()
+		e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, dstAddr, stack.MartianMulticastSource)
 		return
 	}
 	// Make sure the source address is not a subnet-local broadcast address.
@@ -627,6 +741,7 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 		addressEndpoint.DecRef()
 		if subnet.IsBroadcast(srcAddr) {
 			stats.IP.InvalidSourceAddressesReceived.Increment()
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, dstAddr, stack.MartianMulticastSource)
 			return
 		}
 	}
@@ -638,6 +753,14 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 		addressEndpoint.DecRef()
 		pkt.NetworkPacketInfo.LocalAddressBroadcast = subnet.IsBroadcast(dstAddr) || dstAddr == header.IPv4Broadcast
 	} else if !e.IsInGroup(dstAddr) {
+		if info, ok := routerAlertInfo(h); ok && h.FragmentOffset() == 0 && !h.More() {
+			info.NICID = e.nic.ID()
+			info.Endpoint = e
+			if e.protocol.routerAlertHandlers.Handle(h.TransportProtocol(), info, pkt.Clone()) {
+				return
+			}
+		}
+
 		if !e.protocol.Forwarding() {
 			stats.IP.InvalidDestinationAddressesReceived.Increment()
 			return
@@ -720,8 +843,11 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 		e.handleICMP(pkt)
 		return
 	}
-	if p == header.IGMPProtocolNumber {
-		e.igmp.handleIGMP(pkt)
+	info, _ := routerAlertInfo(h)
+	info.NICID = e.nic.ID()
+	info.Endpoint = e
+	info.Local = true
+	if e.protocol.routerAlertHandlers.Handle(p, info, pkt) {
 		return
 	}
 	if opts := h.Options(); len(opts) != 0 {
@@ -851,6 +977,11 @@ func (e *endpoint) PermanentAddresses() []tcpip.AddressWithPrefix {
 func (e *endpoint) JoinGroup(addr tcpip.Address) *tcpip.Error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+
+	if max := int(atomic.LoadInt32(&e.protocol.maxNICMemberships)); max != 0 && !e.igmp.isInGroup(addr) && e.igmp.numGroups() >= max {
+		e.protocol.stack.Stats().IP.NICMembershipLimitExceeded.Increment()
+		return tcpip.ErrNoBufferSpace
+	}
 	return e.joinGroupLocked(addr)
 }
 
@@ -887,7 +1018,17 @@ func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	return e.igmp.isInGroup(addr)
 }
 
+var _ ip.MulticastQuerierEndpoint = (*endpoint)(nil)
+
+// MulticastQuerier implements ip.MulticastQuerierEndpoint.
+func (e *endpoint) MulticastQuerier() (ip.Querier, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.igmp.querier()
+}
+
 var _ stack.ForwardingNetworkProtocol = (*protocol)(nil)
+var _ stack.RouterAlertNetworkProtocol = (*protocol)(nil)
 var _ stack.NetworkProtocol = (*protocol)(nil)
 var _ fragmentation.TimeoutHandler = (*protocol)(nil)
 
@@ -900,6 +1041,25 @@ type protocol struct {
 	// Must be accessed using atomic operations.
 	defaultTTL uint32
 
+	// defaultMulticastTTL is the current default TTL of multicast packets
+	// for the protocol. Only the uint8 portion of it is meaningful.
+	//
+	// Must be accessed using atomic operations.
+	defaultMulticastTTL uint32
+
+	// maxSocketMemberships and maxNICMemberships hold the limits set by
+	// tcpip.MulticastMembershipLimitsOption.
+	//
+	// Must be accessed using atomic operations.
+	maxSocketMemberships int32
+	maxNICMemberships    int32
+
+	// echoEnableProbe is set to 1 when the protocol replies to ICMP Extended
+	// Echo Requests and 0 when it ignores them.
+	//
+	// Must be accessed using atomic operations.
+	echoEnableProbe uint32
+
 	// forwarding is set to 1 when the protocol has forwarding enabled and 0
 	// when it is disabled.
 	//
@@ -911,9 +1071,23 @@ type protocol struct {
 
 	fragmentation *fragmentation.Fragmentation
 
+	// routerAlertHandlers holds the in-stack consumers of packets punted by
+	// the protocol's endpoints.
+	routerAlertHandlers ip.RouterAlertHandlers
+
 	options Options
 }
 
+// RegisterRouterAlertHandler implements stack.RouterAlertNetworkProtocol.
+func (p *protocol) RegisterRouterAlertHandler(proto tcpip.TransportProtocolNumber, h stack.RouterAlertHandler) *tcpip.Error {
+	return p.routerAlertHandlers.Register(proto, h)
+}
+
+// UnregisterRouterAlertHandler implements stack.RouterAlertNetworkProtocol.
+func (p *protocol) UnregisterRouterAlertHandler(proto tcpip.TransportProtocolNumber) {
+	p.routerAlertHandlers.Unregister(proto)
+}
+
 // Number returns the ipv4 protocol number.
 func (p *protocol) Number() tcpip.NetworkProtocolNumber {
 	return ProtocolNumber
@@ -941,6 +1115,29 @@ func (p *protocol) SetOption(option tcpip.SettableNetworkProtocolOption) *tcpip.
 	case *tcpip.DefaultTTLOption:
 		p.SetDefaultTTL(uint8(*v))
 		return nil
+	case *tcpip.DefaultMulticastTTLOption:
+		atomic.StoreUint32(&p.defaultMulticastTTL, uint32(*v))
+		return nil
+	case *tcpip.MulticastMembershipLimitsOption:
+		if v.MaxSocketMemberships < 0 || v.MaxNICMemberships < 0 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		atomic.StoreInt32(&p.maxSocketMemberships, int32(v.MaxSocketMemberships))
+		atomic.StoreInt32(&p.maxNICMemberships, int32(v.MaxNICMemberships))
+		return nil
+	case *tcpip.ICMPEchoEnableProbeOption:
+		var enabled uint32
+		if *v {
+			enabled = 1
+		}
+		atomic.StoreUint32(&p.echoEnableProbe, enabled)
+		return nil
+	case *tcpip.ReassemblyMemoryLimitsOption:
+		if v.High < 0 || v.Low < 0 || v.PerSource < 0 || v.Low > v.High {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.fragmentation.SetMemoryLimits(v.High, v.Low, v.PerSource)
+		return nil
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -952,11 +1149,37 @@ func (p *protocol) Option(option tcpip.GettableNetworkProtocolOption) *tcpip.Err
 	case *tcpip.DefaultTTLOption:
 		*v = tcpip.DefaultTTLOption(p.DefaultTTL())
 		return nil
+	case *tcpip.DefaultMulticastTTLOption:
+		*v = tcpip.DefaultMulticastTTLOption(atomic.LoadUint32(&p.defaultMulticastTTL))
+		return nil
+	case *tcpip.MulticastMembershipLimitsOption:
+		*v = tcpip.MulticastMembershipLimitsOption{
+			MaxSocketMemberships: int(atomic.LoadInt32(&p.maxSocketMemberships)),
+			MaxNICMemberships:    int(atomic.LoadInt32(&p.maxNICMemberships)),
+		}
+		return nil
+	case *tcpip.ICMPEchoEnableProbeOption:
+		*v = tcpip.ICMPEchoEnableProbeOption(p.echoProbeEnabled())
+		return nil
+	case *tcpip.ReassemblyMemoryLimitsOption:
+		high, low, perSource := p.fragmentation.MemoryLimits()
+		*v = tcpip.ReassemblyMemoryLimitsOption{
+			High:      high,
+			Low:       low,
+			PerSource: perSource,
+		}
+		return nil
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
 }
 
+// echoProbeEnabled returns true if the protocol replies to ICMP Extended Echo
+// Requests.
+func (p *protocol) echoProbeEnabled() bool {
+	return atomic.LoadUint32(&p.echoEnableProbe) == 1
+}
+
 // SetDefaultTTL sets the default TTL for endpoints created with this protocol.
 func (p *protocol) SetDefaultTTL(ttl uint8) {
 	atomic.StoreUint32(&p.defaultTTL, uint32(ttl))
@@ -1070,7 +1293,13 @@ func NewProtocolWithOptions(opts Options) stack.NetworkProtocolFactory {
 			defaultTTL: DefaultTTL,
 			options:    opts,
 		}
+		p.defaultMulticastTTL = DefaultMulticastTTL
+		p.maxSocketMemberships = DefaultMaxSocketMemberships
+		p.maxNICMemberships = DefaultMaxNICMemberships
 		p.fragmentation = fragmentation.NewFragmentation(fragmentblockSize, fragmentation.HighFragThreshold, fragmentation.LowFragThreshold, ReassembleTimeout, s.Clock(), p)
+		if err := p.RegisterRouterAlertHandler(header.IGMPProtocolNumber, &igmpRouterAlertHandler{}); err != nil {
+			panic(fmt.Sprintf("p.RegisterRouterAlertHandler(%d, _): %s", header.IGMPProtocolNumber, err))
+		}
 		return p
 	}
 }
@@ -1104,6 +1333,28 @@ func buildNextFragment(pf *fragmentation.PacketFragmenter, originalIPHeader head
 	return fragPkt, more
 }
 
+// routerAlertInfo returns the Router Alert information held by the options in
+// h, and whether h carries a well formed Router Alert option.
+func routerAlertInfo(h header.IPv4) (stack.RouterAlertPacketInfo, bool) {
+	opts := h.Options()
+	if len(opts) == 0 {
+		return stack.RouterAlertPacketInfo{}, false
+	}
+	optIter := opts.MakeIterator()
+	for {
+		option, done, err := optIter.Next()
+		if done || err != nil {
+			return stack.RouterAlertPacketInfo{}, false
+		}
+		if ra, ok := option.(*header.IPv4OptionRouterAlert); ok {
+			return stack.RouterAlertPacketInfo{
+				RouterAlert: true,
+				Value:       ra.Value(),
+			}, true
+		}
+	}
+}
+
 // optionAction describes possible actions that may be taken on an option
 // while processing it.
 type optionAction uint8
@@ -1130,6 +1381,9 @@ type optionActions struct {
 	// recordroute controls what to do with a Record Route option.
 	recordRoute optionAction
 
+	// routerAlert controls what to do with a Router Alert option.
+	routerAlert optionAction
+
 	// unknown controls what to do with an unknown option.
 	unknown optionAction
 }
@@ -1148,6 +1402,7 @@ func (*optionUsageReceive) actions() optionActions {
 	return optionActions{
 		timestamp:   optionVerify,
 		recordRoute: optionVerify,
+		routerAlert: optionPass,
 		unknown:     optionPass,
 	}
 }
@@ -1164,6 +1419,7 @@ func (*optionUsageEcho) actions() optionActions {
 	return optionActions{
 		timestamp:   optionProcess,
 		recordRoute: optionProcess,
+		routerAlert: optionRemove,
 		unknown:     optionRemove,
 	}
 }
@@ -1427,6 +1683,14 @@ func (e *endpoint) processIPOptions(pkt *stack.PacketBuffer, orig header.IPv4Opt
 				optIter.ConsumeBuffer(optLen)
 			}
 
+		case *header.IPv4OptionRouterAlert:
+			stats.IP.OptionRAReceived.Increment()
+			if usage.actions().routerAlert == optionPass {
+				newBuffer := optIter.RemainingBuffer()[:optLen]
+				_ = copy(newBuffer, option.Contents())
+				optIter.ConsumeBuffer(optLen)
+			}
+
 		default:
 			stats.IP.OptionUnknownReceived.Increment()
 			if usage.actions().unknown == optionPass {
@@ -355,12 +355,899 @@ func TestForwarding(t *testing.T) {
 					t.Fatalf("got e1.Drain() = %d, want = 0", n)
 				}
 			}
+
+			var wantForwarded, wantHopLimitExceeded uint64
+			if test.expectErrorICMP {
+				wantHopLimitExceeded = 1
+			} else {
+				wantForwarded = 1
+			}
+			ipStats := s.Stats().IP
+			if got := ipStats.PacketsForwarded.Value(); got != wantForwarded {
+				t.Errorf("got ipStats.PacketsForwarded.Value() = %d, want = %d", got, wantForwarded)
+			}
+			if got := ipStats.HopLimitExceeded.Value(); got != wantHopLimitExceeded {
+				t.Errorf("got ipStats.HopLimitExceeded.Value() = %d, want = %d", got, wantHopLimitExceeded)
+			}
+			nic1Stats, err := s.NICForwardingStats(nicID1)
+			if err != nil {
+				t.Fatalf("s.NICForwardingStats(%d): %s", nicID1, err)
+			}
+			if got := nic1Stats.HopLimitExceeded.Value(); got != wantHopLimitExceeded {
+				t.Errorf("got nic1Stats.HopLimitExceeded.Value() = %d, want = %d", got, wantHopLimitExceeded)
+			}
+			nic2Stats, err := s.NICForwardingStats(nicID2)
+			if err != nil {
+				t.Fatalf("s.NICForwardingStats(%d): %s", nicID2, err)
+			}
+			if got := nic2Stats.Forwarded.Value(); got != wantForwarded {
+				t.Errorf("got nic2Stats.Forwarded.Value() = %d, want = %d", got, wantForwarded)
+			}
+		})
+	}
+}
+
+// TestForwardingFlowCache tests that the packets of a flow following the
+// first one are forwarded through the route cached for the flow, and that the
+// cache is flushed when the route table changes.
+func TestForwardingFlowCache(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	remoteIPv4Addr1 := tcpip.Address(net.ParseIP("10.0.0.2").To4())
+	remoteIPv4Addr2 := tcpip.Address(net.ParseIP("11.0.0.2").To4())
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:    []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols:  []stack.TransportProtocolFactory{icmp.NewProtocol4},
+		ForwardingFlowCache: true,
+	})
+	e1 := channel.New(1, ipv4.MaxTotalSize, "")
+	if err := s.CreateNIC(nicID1, e1); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+	}
+	ipv4ProtoAddr1 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr1}
+	if err := s.AddProtocolAddress(nicID1, ipv4ProtoAddr1); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID1, ipv4ProtoAddr1, err)
+	}
+	e2 := channel.New(1, ipv4.MaxTotalSize, "")
+	if err := s.CreateNIC(nicID2, e2); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID2, err)
+	}
+	ipv4ProtoAddr2 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr2}
+	if err := s.AddProtocolAddress(nicID2, ipv4ProtoAddr2); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID2, ipv4ProtoAddr2, err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: ipv4Addr1.Subnet(),
+			NIC:         nicID1,
+		},
+		{
+			Destination: ipv4Addr2.Subnet(),
+			NIC:         nicID2,
+		},
+	})
+	if err := s.SetForwarding(header.IPv4ProtocolNumber, true); err != nil {
+		t.Fatalf("SetForwarding(%d, true): %s", header.IPv4ProtocolNumber, err)
+	}
+
+	injectEcho := func() {
+		totalLen := uint16(header.IPv4MinimumSize + header.ICMPv4MinimumSize)
+		hdr := buffer.NewPrependable(int(totalLen))
+		icmp := header.ICMPv4(hdr.Prepend(header.ICMPv4MinimumSize))
+		icmp.SetType(header.ICMPv4Echo)
+		icmp.SetChecksum(0)
+		icmp.SetChecksum(^header.Checksum(icmp, 0))
+		ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+		ip.Encode(&header.IPv4Fields{
+			TotalLength: totalLen,
+			Protocol:    uint8(header.ICMPv4ProtocolNumber),
+			TTL:         ipv4.DefaultTTL,
+			SrcAddr:     remoteIPv4Addr1,
+			DstAddr:     remoteIPv4Addr2,
+		})
+		ip.SetChecksum(^ip.CalculateChecksum())
+		e1.InjectInbound(header.IPv4ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: hdr.View().ToVectorisedView(),
+		}))
+	}
+
+	ipStats := s.Stats().IP
+	for i := uint64(1); i <= 2; i++ {
+		injectEcho()
+		if n := e2.Drain(); n != 1 {
+			t.Fatalf("got e2.Drain() = %d, want = 1", n)
+		}
+		if got := ipStats.ForwardingFlowCacheMisses.Value(); got != 1 {
+			t.Errorf("got ipStats.ForwardingFlowCacheMisses.Value() = %d, want = 1", got)
+		}
+		if got, want := ipStats.ForwardingFlowCacheHits.Value(), i-1; got != want {
+			t.Errorf("got ipStats.ForwardingFlowCacheHits.Value() = %d, want = %d", got, want)
+		}
+	}
+
+	// The flow must no longer be forwarded once its route is removed.
+	s.RemoveRoutes(func(r tcpip.Route) bool { return r.NIC == nicID2 })
+	injectEcho()
+	if n := e2.Drain(); n != 0 {
+		t.Fatalf("got e2.Drain() = %d after removing the route, want = 0", n)
+	}
+	if got := ipStats.ForwardingFlowCacheMisses.Value(); got != 2 {
+		t.Errorf("got ipStats.ForwardingFlowCacheMisses.Value() = %d, want = 2", got)
+	}
+}
+
+// TestForwardingMulticastScope tests that multicast packets are not forwarded
+// beyond their scope.
+func TestForwardingMulticastScope(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+		ttl    = 64
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	multicastSubnet := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("224.0.0.0").To4()),
+		PrefixLen: 4,
+	}.Subnet()
+	remoteIPv4Addr1 := tcpip.Address(net.ParseIP("10.0.0.2").To4())
+
+	tests := []struct {
+		name          string
+		dstAddr       tcpip.Address
+		boundary      header.MulticastScope
+		boundaryNICID tcpip.NICID
+		forwarded     bool
+	}{
+		{
+			name:      "Link-local",
+			dstAddr:   tcpip.Address(net.ParseIP("224.0.0.5").To4()),
+			forwarded: false,
+		},
+		{
+			name:      "Local scope without boundary",
+			dstAddr:   tcpip.Address(net.ParseIP("239.255.0.1").To4()),
+			forwarded: true,
+		},
+		{
+			name:          "Local scope with outgoing boundary",
+			dstAddr:       tcpip.Address(net.ParseIP("239.255.0.1").To4()),
+			boundary:      header.SiteLocalMulticastScope,
+			boundaryNICID: nicID2,
+			forwarded:     false,
+		},
+		{
+			name:          "Organization local scope with incoming boundary",
+			dstAddr:       tcpip.Address(net.ParseIP("239.192.0.1").To4()),
+			boundary:      header.OrganizationLocalMulticastScope,
+			boundaryNICID: nicID1,
+			forwarded:     false,
+		},
+		{
+			name:          "Global scope with boundary",
+			dstAddr:       tcpip.Address(net.ParseIP("230.1.2.3").To4()),
+			boundary:      header.OrganizationLocalMulticastScope,
+			boundaryNICID: nicID2,
+			forwarded:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			})
+			e1 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID1, e1); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID1, ipv4.ProtocolNumber, ipv4Addr1); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID1, ipv4.ProtocolNumber, ipv4Addr1, err)
+			}
+			e2 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID2, e2); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID2, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID2, ipv4.ProtocolNumber, ipv4Addr2); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID2, ipv4.ProtocolNumber, ipv4Addr2, err)
+			}
+			s.SetRouteTable([]tcpip.Route{
+				{
+					Destination: ipv4Addr1.Subnet(),
+					NIC:         nicID1,
+				},
+				{
+					Destination: multicastSubnet,
+					NIC:         nicID2,
+				},
+			})
+			if err := s.SetForwarding(ipv4.ProtocolNumber, true); err != nil {
+				t.Fatalf("SetForwarding(%d, true): %s", ipv4.ProtocolNumber, err)
+			}
+			if test.boundaryNICID != 0 {
+				if err := s.SetMulticastBoundary(test.boundaryNICID, test.boundary); err != nil {
+					t.Fatalf("SetMulticastBoundary(%d, %d): %s", test.boundaryNICID, test.boundary, err)
+				}
+			}
+
+			totalLen := uint16(header.IPv4MinimumSize + header.UDPMinimumSize)
+			hdr := buffer.NewPrependable(int(totalLen))
+			u := header.UDP(hdr.Prepend(header.UDPMinimumSize))
+			u.Encode(&header.UDPFields{
+				SrcPort: 5555,
+				DstPort: 80,
+				Length:  header.UDPMinimumSize,
+			})
+			ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+			ip.Encode(&header.IPv4Fields{
+				TotalLength: totalLen,
+				Protocol:    uint8(header.UDPProtocolNumber),
+				TTL:         ttl,
+				SrcAddr:     remoteIPv4Addr1,
+				DstAddr:     test.dstAddr,
+			})
+			ip.SetChecksum(^ip.CalculateChecksum())
+			e1.InjectInbound(ipv4.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: hdr.View().ToVectorisedView(),
+			}))
+
+			if test.forwarded {
+				p, ok := e2.Read()
+				if !ok {
+					t.Fatal("expected packet to be forwarded through the outgoing NIC")
+				}
+				checker.IPv4(t, header.IPv4(stack.PayloadSince(p.Pkt.NetworkHeader())),
+					checker.SrcAddr(remoteIPv4Addr1),
+					checker.DstAddr(test.dstAddr),
+					checker.TTL(ttl-1),
+				)
+			} else if n := e2.Drain(); n != 0 {
+				t.Fatalf("got e2.Drain() = %d, want = 0", n)
+			}
+
+			wantDropped := uint64(0)
+			if !test.forwarded {
+				wantDropped = 1
+			}
+			if got := s.Stats().IP.MulticastScopeBoundaryDropped.Value(); got != wantDropped {
+				t.Errorf("got s.Stats().IP.MulticastScopeBoundaryDropped.Value() = %d, want = %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+func TestReversePathFilter(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+
+	tests := []struct {
+		name    string
+		mode    stack.RPFilterMode
+		srcAddr tcpip.Address
+		dropped bool
+	}{
+		{
+			name:    "None",
+			mode:    stack.RPFilterNone,
+			srcAddr: tcpip.Address(net.ParseIP("11.0.0.2").To4()),
+		},
+		{
+			name:    "Strict",
+			mode:    stack.RPFilterStrict,
+			srcAddr: tcpip.Address(net.ParseIP("10.0.0.2").To4()),
+		},
+		{
+			name:    "Strict source routed through another NIC",
+			mode:    stack.RPFilterStrict,
+			srcAddr: tcpip.Address(net.ParseIP("11.0.0.2").To4()),
+			dropped: true,
+		},
+		{
+			name:    "Strict unspecified source",
+			mode:    stack.RPFilterStrict,
+			srcAddr: header.IPv4Any,
+		},
+		{
+			name:    "Loose source routed through another NIC",
+			mode:    stack.RPFilterLoose,
+			srcAddr: tcpip.Address(net.ParseIP("11.0.0.2").To4()),
+		},
+		{
+			name:    "Loose unrouted source",
+			mode:    stack.RPFilterLoose,
+			srcAddr: tcpip.Address(net.ParseIP("12.0.0.2").To4()),
+			dropped: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			})
+			e1 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID1, e1); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID1, ipv4.ProtocolNumber, ipv4Addr1); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID1, ipv4.ProtocolNumber, ipv4Addr1, err)
+			}
+			if err := s.CreateNIC(nicID2, channel.New(1, ipv4.MaxTotalSize, "")); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID2, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID2, ipv4.ProtocolNumber, ipv4Addr2); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID2, ipv4.ProtocolNumber, ipv4Addr2, err)
+			}
+			s.SetRouteTable([]tcpip.Route{
+				{
+					Destination: ipv4Addr1.Subnet(),
+					NIC:         nicID1,
+				},
+				{
+					Destination: ipv4Addr2.Subnet(),
+					NIC:         nicID2,
+				},
+			})
+			if err := s.SetRPFilter(nicID1, test.mode); err != nil {
+				t.Fatalf("SetRPFilter(%d, %d): %s", nicID1, test.mode, err)
+			}
+			if got, err := s.RPFilter(nicID1); err != nil || got != test.mode {
+				t.Fatalf("got RPFilter(%d) = (%d, %v), want = (%d, nil)", nicID1, got, err, test.mode)
+			}
+
+			totalLen := uint16(header.IPv4MinimumSize + header.UDPMinimumSize)
+			hdr := buffer.NewPrependable(int(totalLen))
+			u := header.UDP(hdr.Prepend(header.UDPMinimumSize))
+			u.Encode(&header.UDPFields{
+				SrcPort: 5555,
+				DstPort: 80,
+				Length:  header.UDPMinimumSize,
+			})
+			ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+			ip.Encode(&header.IPv4Fields{
+				TotalLength: totalLen,
+				Protocol:    uint8(header.UDPProtocolNumber),
+				TTL:         64,
+				SrcAddr:     test.srcAddr,
+				DstAddr:     ipv4Addr1.Address,
+			})
+			ip.SetChecksum(^ip.CalculateChecksum())
+			e1.InjectInbound(ipv4.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: hdr.View().ToVectorisedView(),
+			}))
+
+			wantDropped := uint64(0)
+			if test.dropped {
+				wantDropped = 1
+			}
+			if got := s.Stats().IP.ReversePathFilterDropped.Value(); got != wantDropped {
+				t.Errorf("got s.Stats().IP.ReversePathFilterDropped.Value() = %d, want = %d", got, wantDropped)
+			}
+		})
+	}
+
+	s := stack.New(stack.Options{})
+	if err := s.CreateNIC(nicID1, channel.New(1, ipv4.MaxTotalSize, "")); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+	}
+	if err := s.SetRPFilter(nicID1, 3); err != tcpip.ErrInvalidOptionValue {
+		t.Errorf("got SetRPFilter(%d, 3) = %v, want = %s", nicID1, err, tcpip.ErrInvalidOptionValue)
+	}
+}
+
+func TestMartians(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+
+	tests := []struct {
+		name    string
+		srcAddr tcpip.Address
+		counter func(*stack.MartianStats) *tcpip.StatCounter
+	}{
+		{
+			name:    "Remote source",
+			srcAddr: tcpip.Address(net.ParseIP("10.0.0.2").To4()),
+		},
+		{
+			name:    "Loopback source",
+			srcAddr: tcpip.Address(net.ParseIP("127.0.0.1").To4()),
+			counter: func(s *stack.MartianStats) *tcpip.StatCounter { return s.LoopbackSource },
+		},
+		{
+			name:    "Local source of another NIC",
+			srcAddr: ipv4Addr2.Address,
+			counter: func(s *stack.MartianStats) *tcpip.StatCounter { return s.LocalSource },
+		},
+		{
+			name:    "Multicast source",
+			srcAddr: tcpip.Address(net.ParseIP("224.0.0.1").To4()),
+			counter: func(s *stack.MartianStats) *tcpip.StatCounter { return s.MulticastSource },
+		},
+		{
+			name:    "Subnet broadcast source",
+			srcAddr: tcpip.Address(net.ParseIP("10.255.255.255").To4()),
+			counter: func(s *stack.MartianStats) *tcpip.StatCounter { return s.MulticastSource },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			})
+			e1 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID1, e1); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID1, ipv4.ProtocolNumber, ipv4Addr1); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID1, ipv4.ProtocolNumber, ipv4Addr1, err)
+			}
+			if err := s.CreateNIC(nicID2, channel.New(1, ipv4.MaxTotalSize, "")); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID2, err)
+			}
+			if err := s.AddAddressWithPrefix(nicID2, ipv4.ProtocolNumber, ipv4Addr2); err != nil {
+				t.Fatalf("AddAddressWithPrefix(%d, %d, %s): %s", nicID2, ipv4.ProtocolNumber, ipv4Addr2, err)
+			}
+			if err := s.SetLogMartians(nicID1, true); err != nil {
+				t.Fatalf("SetLogMartians(%d, true): %s", nicID1, err)
+			}
+			if got, err := s.LogMartians(nicID1); err != nil || !got {
+				t.Fatalf("got LogMartians(%d) = (%t, %v), want = (true, nil)", nicID1, got, err)
+			}
+
+			totalLen := uint16(header.IPv4MinimumSize + header.UDPMinimumSize)
+			hdr := buffer.NewPrependable(int(totalLen))
+			u := header.UDP(hdr.Prepend(header.UDPMinimumSize))
+			u.Encode(&header.UDPFields{
+				SrcPort: 5555,
+				DstPort: 80,
+				Length:  header.UDPMinimumSize,
+			})
+			ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+			ip.Encode(&header.IPv4Fields{
+				TotalLength: totalLen,
+				Protocol:    uint8(header.UDPProtocolNumber),
+				TTL:         64,
+				SrcAddr:     test.srcAddr,
+				DstAddr:     ipv4Addr1.Address,
+			})
+			ip.SetChecksum(^ip.CalculateChecksum())
+			e1.InjectInbound(ipv4.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: hdr.View().ToVectorisedView(),
+			}))
+
+			stats := s.NICInfo()[nicID1].Stats.Martians
+			for name, counter := range map[string]*tcpip.StatCounter{
+				"LoopbackSource":  stats.LoopbackSource,
+				"MulticastSource": stats.MulticastSource,
+				"LocalSource":     stats.LocalSource,
+				"ReversePath":     stats.ReversePath,
+			} {
+				want := uint64(0)
+				if test.counter != nil && counter == test.counter(&stats) {
+					want = 1
+				}
+				if got := counter.Value(); got != want {
+					t.Errorf("got Martians.%s.Value() = %d, want = %d", name, got, want)
+				}
+			}
+
+			var martians []stack.Event
+			for _, e := range s.Events() {
+				if e.Kind == stack.EventMartian {
+					martians = append(martians, e)
+				}
+			}
+			if test.counter == nil {
+				if len(martians) != 0 {
+					t.Errorf("got martian events = %v, want none", martians)
+				}
+			} else if len(martians) != 1 || martians[0].Source.Addr != test.srcAddr || martians[0].NICID != nicID1 {
+				t.Errorf("got martian events = %v, want one from %s on NIC %d", martians, test.srcAddr, nicID1)
+			}
 		})
 	}
 }
 
 // TestIPv4Sanity sends IP/ICMP packets with various problems to the stack and
 // checks the response.
+var _ stack.RouterAlertHandler = (*testRouterAlertHandler)(nil)
+
+// testRouterAlertHandler is a stack.RouterAlertHandler that records the
+// packets punted to it.
+type testRouterAlertHandler struct {
+	consume  bool
+	infos    []stack.RouterAlertPacketInfo
+	payloads []buffer.View
+}
+
+// HandleRouterAlert implements stack.RouterAlertHandler.
+func (h *testRouterAlertHandler) HandleRouterAlert(info stack.RouterAlertPacketInfo, pkt *stack.PacketBuffer) bool {
+	if info.Endpoint == nil {
+		panic("punted packet without an endpoint")
+	}
+	info.Endpoint = nil
+	h.infos = append(h.infos, info)
+	h.payloads = append(h.payloads, pkt.Data.ToView())
+	return h.consume
+}
+
+// TestRouterAlert tests that packets are punted to the handler registered for
+// their transport protocol.
+func TestRouterAlert(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+
+		// rsvpProtocolNumber is the IP protocol number of RSVP, as per RFC 2205.
+		rsvpProtocolNumber tcpip.TransportProtocolNumber = 46
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	remoteIPv4Addr1 := tcpip.Address(net.ParseIP("10.0.0.2").To4())
+	remoteIPv4Addr2 := tcpip.Address(net.ParseIP("11.0.0.2").To4())
+	routerAlert := header.IPv4Options{byte(header.IPv4OptionRouterAlertType), header.IPv4OptionRouterAlertLength, 0, 0}
+	payload := buffer.View("rsvp message")
+
+	tests := []struct {
+		name          string
+		dstAddr       tcpip.Address
+		options       header.IPv4Options
+		consume       bool
+		wantInfos     []stack.RouterAlertPacketInfo
+		wantForwarded bool
+	}{
+		{
+			name:    "transit with router alert consumed",
+			dstAddr: remoteIPv4Addr2,
+			options: routerAlert,
+			consume: true,
+			wantInfos: []stack.RouterAlertPacketInfo{
+				{NICID: nicID1, RouterAlert: true, Value: header.IPv4OptionRouterAlertValue},
+			},
+			wantForwarded: false,
+		},
+		{
+			name:    "transit with router alert not consumed",
+			dstAddr: remoteIPv4Addr2,
+			options: routerAlert,
+			consume: false,
+			wantInfos: []stack.RouterAlertPacketInfo{
+				{NICID: nicID1, RouterAlert: true, Value: header.IPv4OptionRouterAlertValue},
+			},
+			wantForwarded: true,
+		},
+		{
+			name:          "transit without router alert",
+			dstAddr:       remoteIPv4Addr2,
+			consume:       true,
+			wantInfos:     nil,
+			wantForwarded: true,
+		},
+		{
+			name:    "local with router alert",
+			dstAddr: ipv4Addr1.Address,
+			options: routerAlert,
+			consume: true,
+			wantInfos: []stack.RouterAlertPacketInfo{
+				{NICID: nicID1, RouterAlert: true, Value: header.IPv4OptionRouterAlertValue, Local: true},
+			},
+			wantForwarded: false,
+		},
+		{
+			name:    "local without router alert",
+			dstAddr: ipv4Addr1.Address,
+			consume: true,
+			wantInfos: []stack.RouterAlertPacketInfo{
+				{NICID: nicID1, Local: true},
+			},
+			wantForwarded: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			})
+			e1 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID1, e1); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID1, err)
+			}
+			ipv4ProtoAddr1 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr1}
+			if err := s.AddProtocolAddress(nicID1, ipv4ProtoAddr1); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID1, ipv4ProtoAddr1, err)
+			}
+
+			e2 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNIC(nicID2, e2); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID2, err)
+			}
+			ipv4ProtoAddr2 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr2}
+			if err := s.AddProtocolAddress(nicID2, ipv4ProtoAddr2); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID2, ipv4ProtoAddr2, err)
+			}
+
+			s.SetRouteTable([]tcpip.Route{
+				{
+					Destination: ipv4Addr1.Subnet(),
+					NIC:         nicID1,
+				},
+				{
+					Destination: ipv4Addr2.Subnet(),
+					NIC:         nicID2,
+				},
+			})
+
+			if err := s.SetForwarding(header.IPv4ProtocolNumber, true); err != nil {
+				t.Fatalf("SetForwarding(%d, true): %s", header.IPv4ProtocolNumber, err)
+			}
+
+			proto, ok := s.NetworkProtocolInstance(header.IPv4ProtocolNumber).(stack.RouterAlertNetworkProtocol)
+			if !ok {
+				t.Fatalf("got s.NetworkProtocolInstance(%d) = %T, want = stack.RouterAlertNetworkProtocol", header.IPv4ProtocolNumber, s.NetworkProtocolInstance(header.IPv4ProtocolNumber))
+			}
+			handler := testRouterAlertHandler{consume: test.consume}
+			if err := proto.RegisterRouterAlertHandler(rsvpProtocolNumber, &handler); err != nil {
+				t.Fatalf("RegisterRouterAlertHandler(%d, _): %s", rsvpProtocolNumber, err)
+			}
+			if err := proto.RegisterRouterAlertHandler(rsvpProtocolNumber, &handler); err != tcpip.ErrAlreadyBound {
+				t.Fatalf("got RegisterRouterAlertHandler(%d, _) = %s, want = %s", rsvpProtocolNumber, err, tcpip.ErrAlreadyBound)
+			}
+
+			ipHeaderLength := header.IPv4MinimumSize + test.options.SizeWithPadding()
+			totalLen := uint16(ipHeaderLength + len(payload))
+			hdr := buffer.NewPrependable(int(totalLen))
+			copy(hdr.Prepend(len(payload)), payload)
+			ip := header.IPv4(hdr.Prepend(ipHeaderLength))
+			ip.Encode(&header.IPv4Fields{
+				TotalLength: totalLen,
+				Protocol:    uint8(rsvpProtocolNumber),
+				TTL:         ipv4.DefaultTTL,
+				SrcAddr:     remoteIPv4Addr1,
+				DstAddr:     test.dstAddr,
+				Options:     test.options,
+			})
+			ip.SetChecksum(0)
+			ip.SetChecksum(^ip.CalculateChecksum())
+			e1.InjectInbound(header.IPv4ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: hdr.View().ToVectorisedView(),
+			}))
+
+			if diff := cmp.Diff(test.wantInfos, handler.infos); diff != "" {
+				t.Errorf("punted packets mismatch (-want +got):\n%s", diff)
+			}
+			for i, got := range handler.payloads {
+				if diff := cmp.Diff(payload, got); diff != "" {
+					t.Errorf("punted packet #%d payload mismatch (-want +got):\n%s", i, diff)
+				}
+			}
+
+			if forwarded := e2.Drain() != 0; forwarded != test.wantForwarded {
+				t.Errorf("got forwarded = %t, want = %t", forwarded, test.wantForwarded)
+			}
+			if n := e1.Drain(); n != 0 {
+				t.Errorf("got e1.Drain() = %d, want = 0", n)
+			}
+
+			proto.UnregisterRouterAlertHandler(rsvpProtocolNumber)
+			if err := proto.RegisterRouterAlertHandler(rsvpProtocolNumber, &handler); err != nil {
+				t.Errorf("RegisterRouterAlertHandler(%d, _) after unregistering: %s", rsvpProtocolNumber, err)
+			}
+		})
+	}
+}
+
+func TestExtendedEcho(t *testing.T) {
+	const (
+		nicID1   = 1
+		nicID2   = 2
+		nicName1 = "eth0"
+		nicName2 = "eth1"
+		ident    = 1234
+		sequence = 5
+	)
+
+	ipv4Addr1 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("10.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	ipv4Addr2 := tcpip.AddressWithPrefix{
+		Address:   tcpip.Address(net.ParseIP("11.0.0.1").To4()),
+		PrefixLen: 8,
+	}
+	remoteIPv4Addr := tcpip.Address(net.ParseIP("10.0.0.2").To4())
+
+	tests := []struct {
+		name       string
+		disabled   bool
+		notLocal   bool
+		objects    []header.ICMPExtensionObject
+		wantReply  bool
+		wantCode   header.ICMPv4Code
+		wantStatus header.ICMPExtendedEchoStatus
+	}{
+		{
+			name:       "by name",
+			objects:    []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Name: nicName1}).Object()},
+			wantReply:  true,
+			wantCode:   header.ICMPv4ExtendedEchoNoError,
+			wantStatus: header.ICMPExtendedEchoStatus{Active: true, IPv4: true},
+		},
+		{
+			name:       "by index of inactive interface",
+			objects:    []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Index: nicID2}).Object()},
+			wantReply:  true,
+			wantCode:   header.ICMPv4ExtendedEchoNoError,
+			wantStatus: header.ICMPExtendedEchoStatus{},
+		},
+		{
+			name:       "by address",
+			objects:    []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Address: ipv4Addr1.Address}).Object()},
+			wantReply:  true,
+			wantCode:   header.ICMPv4ExtendedEchoNoError,
+			wantStatus: header.ICMPExtendedEchoStatus{Active: true, IPv4: true},
+		},
+		{
+			name:      "no such interface",
+			objects:   []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Name: "eth2"}).Object()},
+			wantReply: true,
+			wantCode:  header.ICMPv4ExtendedEchoNoSuchInterface,
+		},
+		{
+			name: "malformed query",
+			objects: []header.ICMPExtensionObject{
+				(&header.ICMPExtensionInterfaceIdent{Name: nicName1}).Object(),
+				(&header.ICMPExtensionInterfaceIdent{Index: nicID1}).Object(),
+			},
+			wantReply: true,
+			wantCode:  header.ICMPv4ExtendedEchoMalformedQuery,
+		},
+		{
+			name:     "probes disabled",
+			disabled: true,
+			objects:  []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Name: nicName1}).Object()},
+		},
+		{
+			name:     "proxy probe",
+			notLocal: true,
+			objects:  []header.ICMPExtensionObject{(&header.ICMPExtensionInterfaceIdent{Name: nicName1}).Object()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			})
+			e1 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNICWithOptions(nicID1, e1, stack.NICOptions{Name: nicName1}); err != nil {
+				t.Fatalf("CreateNICWithOptions(%d, _, _): %s", nicID1, err)
+			}
+			ipv4ProtoAddr1 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr1}
+			if err := s.AddProtocolAddress(nicID1, ipv4ProtoAddr1); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID1, ipv4ProtoAddr1, err)
+			}
+			e2 := channel.New(1, ipv4.MaxTotalSize, "")
+			if err := s.CreateNICWithOptions(nicID2, e2, stack.NICOptions{Name: nicName2, Disabled: true}); err != nil {
+				t.Fatalf("CreateNICWithOptions(%d, _, _): %s", nicID2, err)
+			}
+			ipv4ProtoAddr2 := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr2}
+			if err := s.AddProtocolAddress(nicID2, ipv4ProtoAddr2); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %#v): %s", nicID2, ipv4ProtoAddr2, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: ipv4Addr1.Subnet(), NIC: nicID1}})
+
+			enable := tcpip.ICMPEchoEnableProbeOption(!test.disabled)
+			if err := s.SetNetworkProtocolOption(header.IPv4ProtocolNumber, &enable); err != nil {
+				t.Fatalf("SetNetworkProtocolOption(%d, &%T(%t)): %s", header.IPv4ProtocolNumber, enable, enable, err)
+			}
+
+			extSize := header.ICMPExtensionSize(test.objects)
+			totalLen := header.IPv4MinimumSize + header.ICMPv4MinimumSize + extSize
+			hdr := buffer.NewPrependable(totalLen)
+			icmp := header.ICMPv4(hdr.Prepend(header.ICMPv4MinimumSize + extSize))
+			icmp.SetType(header.ICMPv4ExtendedEchoRequest)
+			icmp.SetIdent(ident)
+			icmp.SetExtendedEchoSequence(sequence)
+			icmp.SetExtendedEchoLocal(!test.notLocal)
+			header.ICMPExtension(icmp.Payload()).Encode(test.objects)
+			icmp.SetChecksum(^header.Checksum(icmp, 0))
+			ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+			ip.Encode(&header.IPv4Fields{
+				TotalLength: uint16(totalLen),
+				Protocol:    uint8(header.ICMPv4ProtocolNumber),
+				TTL:         ipv4.DefaultTTL,
+				SrcAddr:     remoteIPv4Addr,
+				DstAddr:     ipv4Addr1.Address,
+			})
+			ip.SetChecksum(^ip.CalculateChecksum())
+			e1.InjectInbound(header.IPv4ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: hdr.View().ToVectorisedView(),
+			}))
+
+			if got := s.Stats().ICMP.V4.PacketsReceived.ExtendedEchoRequest.Value(); got != 1 {
+				t.Errorf("got ExtendedEchoRequest received = %d, want = 1", got)
+			}
+			reply, ok := e1.Read()
+			if ok != test.wantReply {
+				t.Fatalf("got e1.Read() = (_, %t), want = (_, %t)", ok, test.wantReply)
+			}
+			if !ok {
+				return
+			}
+			checker.IPv4(t, stack.PayloadSince(reply.Pkt.NetworkHeader()),
+				checker.SrcAddr(ipv4Addr1.Address),
+				checker.DstAddr(remoteIPv4Addr),
+				checker.ICMPv4(
+					checker.ICMPv4Checksum(),
+					checker.ICMPv4Type(header.ICMPv4ExtendedEchoReply),
+					checker.ICMPv4Code(test.wantCode),
+					checker.ICMPv4Ident(ident),
+				),
+			)
+			replyICMP := header.ICMPv4(header.IPv4(stack.PayloadSince(reply.Pkt.NetworkHeader())).Payload())
+			if got := replyICMP.ExtendedEchoSequence(); got != sequence {
+				t.Errorf("got replyICMP.ExtendedEchoSequence() = %d, want = %d", got, sequence)
+			}
+			if got := replyICMP.ExtendedEchoStatus(); got != test.wantStatus {
+				t.Errorf("got replyICMP.ExtendedEchoStatus() = %#v, want = %#v", got, test.wantStatus)
+			}
+			if got := s.Stats().ICMP.V4.PacketsSent.ExtendedEchoReply.Value(); got != 1 {
+				t.Errorf("got ExtendedEchoReply sent = %d, want = 1", got)
+			}
+		})
+	}
+}
+
 func TestIPv4Sanity(t *testing.T) {
 	const (
 		ttl            = 255
@@ -1480,6 +2367,16 @@ func TestFragmentationErrors(t *testing.T) {
 			mockError:             nil,
 			wantError:             tcpip.ErrInvalidEndpointState,
 		},
+		{
+			description:           "Error when packet exceeds the maximum IPv4 total length",
+			mtu:                   65536,
+			transportHeaderLength: 0,
+			payloadSize:           ipv4.MaxTotalSize,
+			allowPackets:          0,
+			outgoingErrors:        1,
+			mockError:             nil,
+			wantError:             tcpip.ErrMessageTooLong,
+		},
 	}
 
 	for _, ft := range tests {
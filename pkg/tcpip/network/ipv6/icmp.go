@@ -20,6 +20,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
@@ -457,14 +458,34 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 			IsRouter:  na.RouterFlag(),
 		})
 
-	case header.ICMPv6EchoRequest:
-		received.EchoRequest.Increment()
+	case header.ICMPv6EchoRequest, header.ICMPv6ExtendedEchoRequest:
+		if icmpType == header.ICMPv6ExtendedEchoRequest {
+			received.ExtendedEchoRequest.Increment()
+		} else {
+			received.EchoRequest.Increment()
+		}
 		icmpHdr, ok := pkt.TransportHeader().Consume(header.ICMPv6EchoMinimumSize)
 		if !ok {
 			received.Invalid.Increment()
 			return
 		}
 
+		replyType := header.ICMPv6EchoReply
+		var (
+			probeCode   uint8
+			probeStatus header.ICMPExtendedEchoStatus
+		)
+		if icmpType == header.ICMPv6ExtendedEchoRequest {
+			// Like Linux, silently ignore probes when they are disabled and
+			// probes of interfaces of other nodes, as we don't act as a proxy
+			// (RFC 8335 section 4).
+			if !e.protocol.echoProbeEnabled() || !header.ICMPv6(icmpHdr).ExtendedEchoLocal() {
+				return
+			}
+			replyType = header.ICMPv6ExtendedEchoReply
+			probeCode, probeStatus = ip.ProbeInterface(e.protocol.stack, header.ICMPExtension(pkt.Data.ToView()))
+		}
+
 		// As per RFC 4291 section 2.7, multicast addresses must not be used as
 		// source addresses in IPv6 packets.
 		localAddr := dstAddr
@@ -486,7 +507,11 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 		packet := header.ICMPv6(replyPkt.TransportHeader().Push(header.ICMPv6EchoMinimumSize))
 		pkt.TransportProtocolNumber = header.ICMPv6ProtocolNumber
 		copy(packet, icmpHdr)
-		packet.SetType(header.ICMPv6EchoReply)
+		packet.SetType(replyType)
+		if replyType == header.ICMPv6ExtendedEchoReply {
+			packet.SetCode(header.ICMPv6Code(probeCode))
+			packet.SetExtendedEchoStatus(probeStatus)
+		}
 		packet.SetChecksum(header.ICMPv6Checksum(packet, r.LocalAddress, r.RemoteAddress, pkt.Data))
 		if err := r.WritePacket(nil /* gso */, stack.NetworkHeaderParams{
 			Protocol: header.ICMPv6ProtocolNumber,
@@ -496,7 +521,11 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 			sent.Dropped.Increment()
 			return
 		}
-		sent.EchoReply.Increment()
+		if replyType == header.ICMPv6ExtendedEchoReply {
+			sent.ExtendedEchoReply.Increment()
+		} else {
+			sent.EchoReply.Increment()
+		}
 
 	case header.ICMPv6EchoReply:
 		received.EchoReply.Increment()
@@ -506,6 +535,14 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 		}
 		e.dispatcher.DeliverTransportPacket(header.ICMPv6ProtocolNumber, pkt)
 
+	case header.ICMPv6ExtendedEchoReply:
+		received.ExtendedEchoReply.Increment()
+		if pkt.Data.Size() < header.ICMPv6EchoMinimumSize {
+			received.Invalid.Increment()
+			return
+		}
+		e.dispatcher.DeliverTransportPacket(header.ICMPv6ProtocolNumber, pkt)
+
 	case header.ICMPv6TimeExceeded:
 		received.TimeExceeded.Increment()
 
@@ -649,12 +686,24 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 		switch icmpType {
 		case header.ICMPv6MulticastListenerQuery:
 			received.MulticastListenerQuery.Increment()
-			handler = e.mld.handleMulticastListenerQuery
+			handler = func(mldHdr header.MLD) {
+				e.mld.handleMulticastListenerQuery(srcAddr, mldHdr)
+			}
 		case header.ICMPv6MulticastListenerReport:
 			received.MulticastListenerReport.Increment()
-			handler = e.mld.handleMulticastListenerReport
+			handler = func(mldHdr header.MLD) {
+				e.mld.handleMulticastListenerReport(mldHdr)
+				if header.IsV6LinkLocalAddress(srcAddr) {
+					e.protocol.mldProxy.handleReport(e.nic.ID(), mldHdr.MulticastAddress())
+				}
+			}
 		case header.ICMPv6MulticastListenerDone:
 			received.MulticastListenerDone.Increment()
+			handler = func(mldHdr header.MLD) {
+				if header.IsV6LinkLocalAddress(srcAddr) {
+					e.protocol.mldProxy.handleDone(e.nic.ID(), mldHdr.MulticastAddress())
+				}
+			}
 		default:
 			panic(fmt.Sprintf("unrecognized MLD message = %d", icmpType))
 		}
@@ -667,6 +716,22 @@ func (e *endpoint) handleICMP(pkt *stack.PacketBuffer, hasFragmentHeader bool) {
 			handler(header.MLD(payload.ToView()))
 		}
 
+	case header.ICMPv6MulticastListenerV2Report:
+		received.MulticastListenerReportV2.Increment()
+		report := header.MLDv2Report(payload.ToView())
+		if !report.IsValid() {
+			received.Invalid.Increment()
+			return
+		}
+		// MLDv2 Reports are only of interest to routers, such as the MLD
+		// proxy, which ignore those not sent from a link-local address as
+		// per RFC 3810 section 5.2.13.
+		if !header.IsV6LinkLocalAddress(srcAddr) {
+			return
+		}
+		records, _ := report.MulticastAddressRecords()
+		e.protocol.mldProxy.handleV2Report(e.nic.ID(), records)
+
 	default:
 		received.Unrecognized.Increment()
 	}
@@ -17,6 +17,7 @@ package ipv6
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"sort"
@@ -30,6 +31,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/header/parse"
 	"gvisor.dev/gvisor/pkg/tcpip/network/fragmentation"
 	"gvisor.dev/gvisor/pkg/tcpip/network/hash"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
@@ -56,6 +58,19 @@ const (
 	// Netstack.
 	DefaultTTL = 64
 
+	// DefaultMulticastTTL is the default TTL of multicast packets. Linux
+	// defaults to 1, so that multicast packets don't leave the local network
+	// unless requested.
+	DefaultMulticastTTL = 1
+
+	// DefaultMaxSocketMemberships is the default maximum number of multicast
+	// groups a single socket may join. Matches the IPv4 default.
+	DefaultMaxSocketMemberships = 20
+
+	// DefaultMaxNICMemberships is the default maximum number of multicast
+	// groups which may be joined on a single NIC.
+	DefaultMaxNICMemberships = 1024
+
 	// buckets for fragment identifiers
 	buckets = 2048
 )
@@ -64,7 +79,22 @@ var _ stack.GroupAddressableEndpoint = (*endpoint)(nil)
 var _ stack.AddressableEndpoint = (*endpoint)(nil)
 var _ stack.NetworkEndpoint = (*endpoint)(nil)
 var _ stack.NDPEndpoint = (*endpoint)(nil)
+var _ stack.AddressAnnouncer = (*endpoint)(nil)
 var _ NDPEndpoint = (*endpoint)(nil)
+var _ MTUEndpoint = (*endpoint)(nil)
+
+// MTUEndpoint is an endpoint whose IPv6 MTU can be lowered below the MTU of
+// its link, as with /proc/sys/net/ipv6/conf/<interface>/mtu on Linux.
+type MTUEndpoint interface {
+	// IPv6MTU returns the MTU of the IPv6 packets sent by the endpoint,
+	// including their IPv6 header.
+	IPv6MTU() uint32
+
+	// SetIPv6MTU sets the MTU of the IPv6 packets sent by the endpoint. It
+	// must be at least header.IPv6MinimumMTU, and at most the MTU of the
+	// link.
+	SetIPv6MTU(mtu uint32) *tcpip.Error
+}
 
 type endpoint struct {
 	nic           stack.NetworkInterface
@@ -80,6 +110,13 @@ type endpoint struct {
 	// Must be accessed using atomic operations.
 	enabled uint32
 
+	// ipv6MTU is the MTU set with SetIPv6MTU, or 0 if the MTU of the link
+	// is used. It never exceeds the MTU of the link when set, but the link
+	// MTU may be lowered afterwards.
+	//
+	// Must be accessed using atomic operations.
+	ipv6MTU uint32
+
 	mu struct {
 		sync.RWMutex
 
@@ -129,12 +166,20 @@ func (e *endpoint) InvalidateDefaultRouter(rtr tcpip.Address) {
 	e.mu.ndp.invalidateDefaultRouter(rtr)
 }
 
+// NDPConfigurations implements NDPEndpoint.
+func (e *endpoint) NDPConfigurations() NDPConfigurations {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mu.ndp.configs
+}
+
 // SetNDPConfigurations implements NDPEndpoint.
 func (e *endpoint) SetNDPConfigurations(c NDPConfigurations) {
 	c.validate()
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.mu.ndp.configs = c
+	e.mu.ndp.updateDefaultRoutes()
 }
 
 // hasTentativeAddr returns true if addr is tentative on e.
@@ -341,6 +386,9 @@ func (e *endpoint) disableLocked() {
 	e.mu.ndp.stopSolicitingRouters()
 	e.mu.ndp.cleanupState(false /* hostOnly */)
 	e.stopDADForPermanentAddressesLocked()
+	for addr := range e.mu.ndp.announcements {
+		e.mu.ndp.stopAnnouncing(addr)
+	}
 
 	// The endpoint may have already left the multicast group.
 	if err := e.leaveGroupLocked(header.IPv6AllNodesMulticastAddress); err != nil && err != tcpip.ErrBadLocalAddress {
@@ -376,10 +424,28 @@ func (e *endpoint) DefaultTTL() uint8 {
 	return e.protocol.DefaultTTL()
 }
 
-// MTU implements stack.NetworkEndpoint.MTU. It returns the link-layer MTU minus
-// the network layer max header length.
+// IPv6MTU implements MTUEndpoint.IPv6MTU.
+func (e *endpoint) IPv6MTU() uint32 {
+	linkMTU := e.nic.MTU()
+	if mtu := atomic.LoadUint32(&e.ipv6MTU); mtu != 0 && mtu < linkMTU {
+		return mtu
+	}
+	return linkMTU
+}
+
+// SetIPv6MTU implements MTUEndpoint.SetIPv6MTU.
+func (e *endpoint) SetIPv6MTU(mtu uint32) *tcpip.Error {
+	if mtu < header.IPv6MinimumMTU || mtu > e.nic.MTU() {
+		return tcpip.ErrInvalidOptionValue
+	}
+	atomic.StoreUint32(&e.ipv6MTU, mtu)
+	return nil
+}
+
+// MTU implements stack.NetworkEndpoint.MTU. It returns the IPv6 MTU minus the
+// network layer max header length.
 func (e *endpoint) MTU() uint32 {
-	networkMTU, err := calculateNetworkMTU(e.nic.MTU(), header.IPv6MinimumSize)
+	networkMTU, err := calculateNetworkMTU(e.IPv6MTU(), header.IPv6MinimumSize)
 	if err != nil {
 		return 0
 	}
@@ -392,7 +458,13 @@ func (e *endpoint) MaxHeaderLength() uint16 {
 	return e.nic.MaxHeaderLength() + header.IPv6MinimumSize
 }
 
-func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.PacketBuffer, params stack.NetworkHeaderParams) {
+// addIPHeader adds an IPv6 header to pkt. It returns ErrMessageTooLong if the
+// payload can't be described by the header's payload length field, as
+// jumbograms are not supported.
+func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.PacketBuffer, params stack.NetworkHeaderParams) *tcpip.Error {
+	if pkt.Size() > maxPayloadSize {
+		return tcpip.ErrMessageTooLong
+	}
 	length := uint16(pkt.Size())
 	ip := header.IPv6(pkt.NetworkHeader().Push(header.IPv6MinimumSize))
 	ip.Encode(&header.IPv6Fields{
@@ -404,6 +476,7 @@ func (e *endpoint) addIPHeader(srcAddr, dstAddr tcpip.Address, pkt *stack.Packet
 		DstAddr:       dstAddr,
 	})
 	pkt.NetworkProtocolNumber = ProtocolNumber
+	return nil
 }
 
 func packetMustBeFragmented(pkt *stack.PacketBuffer, networkMTU uint32, gso *stack.GSO) bool {
@@ -456,7 +529,10 @@ func (e *endpoint) handleFragments(r *stack.Route, gso *stack.GSO, networkMTU ui
 
 // WritePacket writes a packet to the given destination address and protocol.
 func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, params stack.NetworkHeaderParams, pkt *stack.PacketBuffer) *tcpip.Error {
-	e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params)
+	if err := e.addIPHeader(r.LocalAddress, r.RemoteAddress, pkt, params); err != nil {
+		r.Stats().IP.OutgoingPacketErrors.Increment()
+		return err
+	}
 
 	// iptables filtering. All packets that reach here are locally
 	// generated.
@@ -506,7 +582,7 @@ func (e *endpoint) writePacket(r *stack.Route, gso *stack.GSO, pkt *stack.Packet
 		return nil
 	}
 
-	networkMTU, err := calculateNetworkMTU(e.nic.MTU(), uint32(pkt.NetworkHeader().View().Size()))
+	networkMTU, err := calculateNetworkMTU(e.IPv6MTU(), uint32(pkt.NetworkHeader().View().Size()))
 	if err != nil {
 		r.Stats().IP.OutgoingPacketErrors.Increment()
 		return err
@@ -543,9 +619,12 @@ func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.Packe
 		return pkts.Len(), nil
 	}
 
-	linkMTU := e.nic.MTU()
+	linkMTU := e.IPv6MTU()
 	for pb := pkts.Front(); pb != nil; pb = pb.Next() {
-		e.addIPHeader(r.LocalAddress, r.RemoteAddress, pb, params)
+		if err := e.addIPHeader(r.LocalAddress, r.RemoteAddress, pb, params); err != nil {
+			r.Stats().IP.OutgoingPacketErrors.IncrementBy(uint64(pkts.Len()))
+			return 0, err
+		}
 
 		networkMTU, err := calculateNetworkMTU(linkMTU, uint32(pb.NetworkHeader().View().Size()))
 		if err != nil {
@@ -670,31 +749,64 @@ func (e *endpoint) forwardPacket(pkt *stack.PacketBuffer) *tcpip.Error {
 		//   packet and originate an ICMPv6 Time Exceeded message with Code 0 to
 		//   the source of the packet.  This indicates either a routing loop or
 		//   too small an initial Hop Limit value.
+		//
+		// The Time Exceeded message is subject to the stack's ICMP rate limit.
+		e.protocol.stack.Stats().IP.HopLimitExceeded.Increment()
+		if stats, err := e.protocol.stack.NICForwardingStats(e.nic.ID()); err == nil {
+			stats.HopLimitExceeded.Increment()
+		}
 		return e.protocol.returnError(&icmpReasonHopLimitExceeded{}, pkt)
 	}
 
-	dstAddr := h.DestinationAddress()
+	// The packets of a flow following the first one are forwarded through the
+	// route cached for the flow, if any.
+	flow := stack.ForwardingFlowOf(e.nic.ID(), pkt)
+	r, gen := e.protocol.stack.LookupForwardingFlow(flow)
+	if r == nil {
+		dstAddr := h.DestinationAddress()
 
-	// Check if the destination is owned by the stack.
-	networkEndpoint, err := e.protocol.stack.FindNetworkEndpoint(ProtocolNumber, dstAddr)
-	if err == nil {
-		networkEndpoint.(*endpoint).handlePacket(pkt)
-		return nil
-	}
-	if err != tcpip.ErrBadAddress {
-		return err
+		// Check if the destination is owned by the stack.
+		networkEndpoint, err := e.protocol.stack.FindNetworkEndpoint(ProtocolNumber, dstAddr)
+		if err == nil {
+			networkEndpoint.(*endpoint).handlePacket(pkt)
+			return nil
+		}
+		if err != tcpip.ErrBadAddress {
+			return err
+		}
+
+		// Packets are only forwarded within the group of the NIC they were
+		// received on.
+		group, err := e.protocol.stack.NICGroup(e.nic.ID())
+		if err != nil {
+			return err
+		}
+		r, err = e.protocol.stack.FindRouteInGroup(group, 0, "", dstAddr, ProtocolNumber, false /* multicastLoop */)
+		if err != nil {
+			return err
+		}
+
+		// Multicast packets must not be forwarded beyond their scope, as per RFC
+		// 2365 section 3 and RFC 4007 section 5.
+		if header.IsV6MulticastAddress(dstAddr) && !e.protocol.stack.CanForwardMulticast(e.nic.ID(), r.NICID(), header.V6MulticastScope(dstAddr)) {
+			r.Release()
+			e.protocol.stack.Stats().IP.MulticastScopeBoundaryDropped.Increment()
+			return nil
+		}
+
+		e.protocol.stack.CacheForwardingFlow(flow, gen, r)
 	}
+	defer r.Release()
 
-	r, err := e.protocol.stack.FindRoute(0, "", dstAddr, ProtocolNumber, false /* multicastLoop */)
+	forwardToEp, err := e.protocol.stack.GetNetworkEndpoint(r.NICID(), ProtocolNumber)
 	if err != nil {
 		return err
 	}
-	defer r.Release()
 
-	// We need to do a deep copy of the IP packet because
-	// WriteHeaderIncludedPacket takes ownership of the packet buffer, but we do
-	// not own it.
+	// We need to do a deep copy of the IP packet because writeForwardedPacket
+	// takes ownership of the packet buffer, but we do not own it.
 	newHdr := header.IPv6(stack.PayloadSince(pkt.NetworkHeader()))
+	hdrLen := len(h)
 
 	// As per RFC 8200 section 3,
 	//
@@ -702,12 +814,117 @@ func (e *endpoint) forwardPacket(pkt *stack.PacketBuffer) *tcpip.Error {
 	//                       each node that forwards the packet.
 	newHdr.SetHopLimit(hopLimit - 1)
 
-	return r.WriteHeaderIncludedPacket(stack.NewPacketBuffer(stack.PacketBufferOptions{
+	if err := forwardToEp.(*endpoint).writeForwardedPacket(r, hdrLen, pkt.TransportProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()),
+		Data:               buffer.View(newHdr).ToVectorisedView(),
+	})); err != nil {
+		return err
+	}
+
+	e.protocol.stack.Stats().IP.PacketsForwarded.Increment()
+	if stats, err := e.protocol.stack.NICForwardingStats(r.NICID()); err == nil {
+		stats.Forwarded.Increment()
+	}
+	return nil
+}
+
+// forwardMulticastPacket forwards a multicast packet out of the NICs given by
+// the multicast route matching it, or by the MLD proxy if none does.
+func (e *endpoint) forwardMulticastPacket(pkt *stack.PacketBuffer) {
+	stats := e.protocol.stack.Stats().IP
+	h := header.IPv6(pkt.NetworkHeader().View())
+	srcAddr, dstAddr := h.SourceAddress(), h.DestinationAddress()
+
+	// As per RFC 4007 section 5, packets of link-local scope, or from a
+	// link-local source, must not leave the link.
+	scope := header.V6MulticastScope(dstAddr)
+	if scope <= header.LinkLocalMulticastScope || header.IsV6LinkLocalAddress(srcAddr) || srcAddr == header.IPv6Any {
+		return
+	}
+
+	// As per RFC 4443 section 2.4, no ICMPv6 Time Exceeded message is sent
+	// for packets sent to a multicast address.
+	hopLimit := h.HopLimit()
+	if hopLimit <= 1 {
+		stats.HopLimitExceeded.Increment()
+		if nicStats, err := e.protocol.stack.NICForwardingStats(e.nic.ID()); err == nil {
+			nicStats.HopLimitExceeded.Increment()
+		}
+		return
+	}
+
+	outputs, res := e.protocol.stack.LookupMulticastRoute(ProtocolNumber, e.nic.ID(), srcAddr, dstAddr, pkt.Size())
+	switch res {
+	case stack.MulticastRouteFound:
+	case stack.MulticastRouteWrongInterface:
+		stats.MulticastWrongInterface.Increment()
+		return
+	case stack.MulticastRouteNotFound:
+		var ok bool
+		if outputs, ok = e.protocol.mldProxy.outputs(e.nic.ID(), dstAddr); !ok {
+			stats.MulticastNoRoute.Increment()
+			return
+		}
+	default:
+		panic(fmt.Sprintf("unknown multicast route result %d", res))
+	}
+
+	for _, out := range outputs {
+		if hopLimit <= out.HopLimitThreshold {
+			continue
+		}
+		if !e.protocol.stack.CanForwardMulticast(e.nic.ID(), out.NIC, scope) {
+			stats.MulticastScopeBoundaryDropped.Increment()
+			continue
+		}
+		if err := e.forwardMulticastPacketTo(out.NIC, pkt); err != nil {
+			continue
+		}
+		stats.PacketsForwarded.Increment()
+		if nicStats, err := e.protocol.stack.NICForwardingStats(out.NIC); err == nil {
+			nicStats.Forwarded.Increment()
+		}
+	}
+}
+
+// forwardMulticastPacketTo forwards a copy of the multicast packet pkt out of
+// the given NIC, with its hop limit decremented.
+func (e *endpoint) forwardMulticastPacketTo(nicID tcpip.NICID, pkt *stack.PacketBuffer) *tcpip.Error {
+	h := header.IPv6(pkt.NetworkHeader().View())
+	r, err := e.protocol.stack.FindRoute(nicID, "", h.DestinationAddress(), ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+
+	forwardToEp, err := e.protocol.stack.GetNetworkEndpoint(nicID, ProtocolNumber)
+	if err != nil {
+		return err
+	}
+
+	// Each NIC is given its own copy of the packet, as writeForwardedPacket
+	// takes ownership of it.
+	newHdr := header.IPv6(stack.PayloadSince(pkt.NetworkHeader()))
+	newHdr.SetHopLimit(h.HopLimit() - 1)
+	return forwardToEp.(*endpoint).writeForwardedPacket(r, len(h), pkt.TransportProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: int(r.MaxHeaderLength()),
 		Data:               buffer.View(newHdr).ToVectorisedView(),
 	}))
 }
 
+// writeForwardedPacket writes a packet being forwarded, whose IPv6 header and
+// extension headers are made of its first hdrLen bytes. Unlike
+// WriteHeaderIncludedPacket, it leaves the headers, which are already complete
+// and were validated when the packet was received, untouched and doesn't parse
+// them again.
+func (e *endpoint) writeForwardedPacket(r *stack.Route, hdrLen int, protocol tcpip.TransportProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	if _, ok := pkt.NetworkHeader().Consume(hdrLen); !ok {
+		return tcpip.ErrMalformedHeader
+	}
+	pkt.NetworkProtocolNumber = ProtocolNumber
+	return e.writePacket(r, nil /* gso */, pkt, protocol, true /* headerIncluded */)
+}
+
 // HandlePacket is called by the link layer when new ipv6 packets arrive for
 // this endpoint.
 func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
@@ -726,11 +943,83 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 			stats.IP.IPTablesPreroutingDropped.Increment()
 			return
 		}
+
+		// Packets from loopback or local addresses can't have been sent
+		// by another host. They are only reported, as an anti-spoofing
+		// signal.
+		h := header.IPv6(pkt.NetworkHeader().View())
+		if srcAddr := h.SourceAddress(); header.IsV6LoopbackAddress(srcAddr) {
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, h.DestinationAddress(), stack.MartianLoopbackSource)
+		} else if e.protocol.stack.IsLocalAddress(ProtocolNumber, srcAddr) {
+			e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, h.DestinationAddress(), stack.MartianLocalSource)
+		}
 	}
 
 	e.handlePacket(pkt)
 }
 
+// handleTransitRouterAlert punts a packet that is not destined to this host
+// to the registered stack.RouterAlertHandler if it carries a Router Alert
+// option in its Hop By Hop extension header.
+//
+// Returns true if the packet was consumed by a handler.
+func (e *endpoint) handleTransitRouterAlert(pkt *stack.PacketBuffer) bool {
+	h := header.IPv6(pkt.NetworkHeader().View())
+	// As per RFC 2711 section 2, the Router Alert option is carried in the Hop
+	// By Hop extension header which must immediately follow the IPv6 header.
+	if header.IPv6ExtensionHeaderIdentifier(h.NextHeader()) != header.IPv6HopByHopOptionsExtHdrIdentifier {
+		return false
+	}
+
+	vv := pkt.NetworkHeader().View()[header.IPv6MinimumSize:].ToVectorisedView()
+	vv.AppendView(pkt.TransportHeader().View())
+	vv.Append(pkt.Data)
+	it := header.MakeIPv6PayloadIterator(header.IPv6HopByHopOptionsExtHdrIdentifier, vv)
+
+	info := stack.RouterAlertPacketInfo{
+		NICID:    e.nic.ID(),
+		Endpoint: e,
+	}
+	for {
+		extHdr, done, err := it.Next()
+		if err != nil || done {
+			return false
+		}
+
+		switch extHdr := extHdr.(type) {
+		case header.IPv6HopByHopOptionsExtHdr:
+			optsIt := extHdr.Iter()
+			for {
+				opt, done, err := optsIt.Next()
+				if err != nil {
+					return false
+				}
+				if done {
+					break
+				}
+				if ra, ok := opt.(*header.IPv6RouterAlertOption); ok {
+					info.RouterAlert = true
+					info.Value = uint16(ra.Value)
+				}
+			}
+			if !info.RouterAlert {
+				return false
+			}
+
+		case header.IPv6FragmentExtHdr:
+			// Fragments are forwarded as is; the handler would not be able to make
+			// sense of a partial payload.
+			return false
+
+		case header.IPv6RawPayloadHeader:
+			pkt = pkt.Clone()
+			extHdr.Buf.TrimFront(pkt.TransportHeader().View().Size())
+			pkt.Data = extHdr.Buf
+			return e.protocol.routerAlertHandlers.Handle(tcpip.TransportProtocolNumber(extHdr.Identifier), info, pkt)
+		}
+	}
+}
+
 // handlePacket is like HandlePacket except it does not perform the prerouting
 // iptables hook.
 func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
@@ -750,6 +1039,7 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 	//   packets or appear in any Routing header.
 	if header.IsV6MulticastAddress(srcAddr) {
 		stats.IP.InvalidSourceAddressesReceived.Increment()
+		e.protocol.stack.HandleMartian(e.nic.ID(), ProtocolNumber, srcAddr, dstAddr, stack.MartianMulticastSource)
 		return
 	}
 
@@ -757,7 +1047,25 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 	// for us to receive the packet. Otherwise, attempt to forward the packet.
 	if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint); addressEndpoint != nil {
 		addressEndpoint.DecRef()
+	} else if header.IsV6MulticastAddress(dstAddr) && e.protocol.mldProxy.isDownstream(e.nic.ID()) && isMLDMessage(pkt) {
+		// The MLD proxy listens to the MLD messages sent on its downstream
+		// NICs, whatever group they are sent to.
+	} else if header.IsV6MulticastAddress(dstAddr) && e.protocol.Forwarding() && e.protocol.multicastRoutingEnabled() {
+		// Multicast routers forward the packets sent to a group whether or
+		// not they are also listening to it.
+		inGroup := e.IsInGroup(dstAddr)
+		if !inGroup && e.handleTransitRouterAlert(pkt) {
+			return
+		}
+		e.forwardMulticastPacket(pkt)
+		if !inGroup {
+			return
+		}
 	} else if !e.IsInGroup(dstAddr) {
+		if e.handleTransitRouterAlert(pkt) {
+			return
+		}
+
 		if !e.protocol.Forwarding() {
 			stats.IP.InvalidDestinationAddressesReceived.Increment()
 			return
@@ -776,6 +1084,7 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 	vv.Append(pkt.Data)
 	it := header.MakeIPv6PayloadIterator(header.IPv6ExtensionHeaderIdentifier(h.NextHeader()), vv)
 	hasFragmentHeader := false
+	var routerAlert *header.IPv6RouterAlertOption
 
 	// iptables filtering. All packets that reach here are intended for
 	// this machine and need not be forwarded.
@@ -822,8 +1131,13 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 					break
 				}
 
-				// We currently do not support any IPv6 Hop By Hop extension header
-				// options.
+				if ra, ok := opt.(*header.IPv6RouterAlertOption); ok {
+					routerAlert = ra
+					continue
+				}
+
+				// We currently do not support any other IPv6 Hop By Hop extension
+				// header options.
 				switch opt.UnknownAction() {
 				case header.IPv6OptionUnknownActionSkip:
 				case header.IPv6OptionUnknownActionDiscard:
@@ -878,6 +1192,10 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 			hasFragmentHeader = true
 
 			if extHdr.IsAtomic() {
+				if e.protocol.options.FragmentPolicy.DropAtomicFragments {
+					stats.IP.AtomicFragmentsDropped.Increment()
+					return
+				}
 				// This fragment extension header indicates that this packet is an
 				// atomic fragment. An atomic fragment is a fragment that contains
 				// all the data required to reassemble a full packet. As per RFC 6946,
@@ -964,6 +1282,11 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 				return
 			}
 
+			if extHdr.More() && fragmentPayloadLen < e.protocol.options.FragmentPolicy.MinimumFragmentSize {
+				stats.IP.TinyFragmentsDropped.Increment()
+				return
+			}
+
 			// The packet is a fragment, let's try to reassemble it.
 			start := extHdr.FragmentOffset() * header.IPv6FragmentExtHdrFragmentOffsetBytesPerUnit
 
@@ -1002,6 +1325,9 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 				pkt,
 			)
 			if err != nil {
+				if errors.Is(err, fragmentation.ErrFragmentOverlap) {
+					stats.IP.OverlappingFragmentsReceived.Increment()
+				}
 				stats.IP.MalformedPacketsReceived.Increment()
 				stats.IP.MalformedFragmentsReceived.Increment()
 				return
@@ -1074,7 +1400,20 @@ func (e *endpoint) handlePacket(pkt *stack.PacketBuffer) {
 			pkt.Data = extHdr.Buf
 
 			stats.IP.PacketsDelivered.Increment()
-			if p := tcpip.TransportProtocolNumber(extHdr.Identifier); p == header.ICMPv6ProtocolNumber {
+			p := tcpip.TransportProtocolNumber(extHdr.Identifier)
+			info := stack.RouterAlertPacketInfo{
+				NICID:    e.nic.ID(),
+				Endpoint: e,
+				Local:    true,
+			}
+			if routerAlert != nil {
+				info.RouterAlert = true
+				info.Value = uint16(routerAlert.Value)
+			}
+			if e.protocol.routerAlertHandlers.Handle(p, info, pkt) {
+				return
+			}
+			if p == header.ICMPv6ProtocolNumber {
 				pkt.TransportProtocolNumber = p
 				e.handleICMP(pkt, hasFragmentHeader)
 			} else {
@@ -1195,6 +1534,24 @@ func (e *endpoint) addAndAcquirePermanentAddressLocked(addr tcpip.AddressWithPre
 	return addressEndpoint, nil
 }
 
+// AnnounceAddresses implements stack.AddressAnnouncer.
+//
+// Tentative addresses are announced once Duplicate Address Detection resolves.
+func (e *endpoint) AnnounceAddresses(addrs []tcpip.Address) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.isEnabled() {
+		return
+	}
+
+	for _, addr := range addrs {
+		if addressEndpoint := e.getAddressRLocked(addr); addressEndpoint != nil && addressEndpoint.GetKind() == stack.Permanent {
+			e.mu.ndp.startAnnouncing(addr)
+		}
+	}
+}
+
 // RemovePermanentAddress implements stack.AddressableEndpoint.
 func (e *endpoint) RemovePermanentAddress(addr tcpip.Address) *tcpip.Error {
 	e.mu.Lock()
@@ -1217,6 +1574,7 @@ func (e *endpoint) removePermanentEndpointLocked(addressEndpoint stack.AddressEn
 	unicast := header.IsV6UnicastAddress(addr.Address)
 	if unicast {
 		e.mu.ndp.stopDuplicateAddressDetection(addr.Address)
+		e.mu.ndp.stopAnnouncing(addr.Address)
 
 		// If we are removing an address generated via SLAAC, cleanup
 		// its SLAAC resources and notify the integrator.
@@ -1406,6 +1764,11 @@ func (e *endpoint) PermanentAddresses() []tcpip.AddressWithPrefix {
 func (e *endpoint) JoinGroup(addr tcpip.Address) *tcpip.Error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+
+	if max := int(atomic.LoadInt32(&e.protocol.maxNICMemberships)); max != 0 && !e.mld.isInGroup(addr) && e.mld.numGroups() >= max {
+		e.protocol.stack.Stats().IP.NICMembershipLimitExceeded.Increment()
+		return tcpip.ErrNoBufferSpace
+	}
 	return e.joinGroupLocked(addr)
 }
 
@@ -1442,7 +1805,17 @@ func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	return e.mld.isInGroup(addr)
 }
 
+var _ ip.MulticastQuerierEndpoint = (*endpoint)(nil)
+
+// MulticastQuerier implements ip.MulticastQuerierEndpoint.
+func (e *endpoint) MulticastQuerier() (ip.Querier, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mld.querier()
+}
+
 var _ stack.ForwardingNetworkProtocol = (*protocol)(nil)
+var _ stack.RouterAlertNetworkProtocol = (*protocol)(nil)
 var _ stack.NetworkProtocol = (*protocol)(nil)
 var _ fragmentation.TimeoutHandler = (*protocol)(nil)
 
@@ -1465,6 +1838,25 @@ type protocol struct {
 	// Must be accessed using atomic operations.
 	defaultTTL uint32
 
+	// defaultMulticastTTL is the current default TTL of multicast packets
+	// for the protocol. Only the uint8 portion of it is meaningful.
+	//
+	// Must be accessed using atomic operations.
+	defaultMulticastTTL uint32
+
+	// maxSocketMemberships and maxNICMemberships hold the limits set by
+	// tcpip.MulticastMembershipLimitsOption.
+	//
+	// Must be accessed using atomic operations.
+	maxSocketMemberships int32
+	maxNICMemberships    int32
+
+	// echoEnableProbe is set to 1 when the protocol replies to ICMP Extended
+	// Echo Requests and 0 when it ignores them.
+	//
+	// Must be accessed using atomic operations.
+	echoEnableProbe uint32
+
 	// forwarding is set to 1 when the protocol has forwarding enabled and 0
 	// when it is disabled.
 	//
@@ -1472,6 +1864,23 @@ type protocol struct {
 	forwarding uint32
 
 	fragmentation *fragmentation.Fragmentation
+
+	// routerAlertHandlers holds the in-stack consumers of packets punted by
+	// the protocol's endpoints.
+	routerAlertHandlers ip.RouterAlertHandlers
+
+	// mldProxy is the MLD proxy set by tcpip.MulticastProxyOption.
+	mldProxy mldProxy
+}
+
+// RegisterRouterAlertHandler implements stack.RouterAlertNetworkProtocol.
+func (p *protocol) RegisterRouterAlertHandler(proto tcpip.TransportProtocolNumber, h stack.RouterAlertHandler) *tcpip.Error {
+	return p.routerAlertHandlers.Register(proto, h)
+}
+
+// UnregisterRouterAlertHandler implements stack.RouterAlertNetworkProtocol.
+func (p *protocol) UnregisterRouterAlertHandler(proto tcpip.TransportProtocolNumber) {
+	p.routerAlertHandlers.Unregister(proto)
 }
 
 // Number returns the ipv6 protocol number.
@@ -1509,6 +1918,7 @@ func (p *protocol) NewEndpoint(nic stack.NetworkInterface, linkAddrCache stack.L
 		ep:             e,
 		configs:        p.options.NDPConfigs,
 		dad:            make(map[tcpip.Address]dadState),
+		announcements:  make(map[tcpip.Address]*tcpip.Job),
 		defaultRouters: make(map[tcpip.Address]defaultRouterState),
 		onLinkPrefixes: make(map[tcpip.Subnet]onLinkPrefixState),
 		slaacPrefixes:  make(map[tcpip.Subnet]slaacPrefixState),
@@ -1534,6 +1944,31 @@ func (p *protocol) SetOption(option tcpip.SettableNetworkProtocolOption) *tcpip.
 	case *tcpip.DefaultTTLOption:
 		p.SetDefaultTTL(uint8(*v))
 		return nil
+	case *tcpip.DefaultMulticastTTLOption:
+		atomic.StoreUint32(&p.defaultMulticastTTL, uint32(*v))
+		return nil
+	case *tcpip.MulticastMembershipLimitsOption:
+		if v.MaxSocketMemberships < 0 || v.MaxNICMemberships < 0 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		atomic.StoreInt32(&p.maxSocketMemberships, int32(v.MaxSocketMemberships))
+		atomic.StoreInt32(&p.maxNICMemberships, int32(v.MaxNICMemberships))
+		return nil
+	case *tcpip.ICMPEchoEnableProbeOption:
+		var enabled uint32
+		if *v {
+			enabled = 1
+		}
+		atomic.StoreUint32(&p.echoEnableProbe, enabled)
+		return nil
+	case *tcpip.ReassemblyMemoryLimitsOption:
+		if v.High < 0 || v.Low < 0 || v.PerSource < 0 || v.Low > v.High {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.fragmentation.SetMemoryLimits(v.High, v.Low, v.PerSource)
+		return nil
+	case *tcpip.MulticastProxyOption:
+		return p.mldProxy.setOption(v)
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -1545,11 +1980,47 @@ func (p *protocol) Option(option tcpip.GettableNetworkProtocolOption) *tcpip.Err
 	case *tcpip.DefaultTTLOption:
 		*v = tcpip.DefaultTTLOption(p.DefaultTTL())
 		return nil
+	case *tcpip.DefaultMulticastTTLOption:
+		*v = tcpip.DefaultMulticastTTLOption(atomic.LoadUint32(&p.defaultMulticastTTL))
+		return nil
+	case *tcpip.MulticastMembershipLimitsOption:
+		*v = tcpip.MulticastMembershipLimitsOption{
+			MaxSocketMemberships: int(atomic.LoadInt32(&p.maxSocketMemberships)),
+			MaxNICMemberships:    int(atomic.LoadInt32(&p.maxNICMemberships)),
+		}
+		return nil
+	case *tcpip.ICMPEchoEnableProbeOption:
+		*v = tcpip.ICMPEchoEnableProbeOption(p.echoProbeEnabled())
+		return nil
+	case *tcpip.ReassemblyMemoryLimitsOption:
+		high, low, perSource := p.fragmentation.MemoryLimits()
+		*v = tcpip.ReassemblyMemoryLimitsOption{
+			High:      high,
+			Low:       low,
+			PerSource: perSource,
+		}
+		return nil
+	case *tcpip.MulticastProxyOption:
+		*v = p.mldProxy.option()
+		return nil
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
 }
 
+// multicastRoutingEnabled returns true if multicast packets are forwarded as per
+// the multicast routes of the stack or the MLD proxy, rather than the unicast
+// routes.
+func (p *protocol) multicastRoutingEnabled() bool {
+	return p.stack.MulticastRoutingEnabled(ProtocolNumber) || p.mldProxy.enabled()
+}
+
+// echoProbeEnabled returns true if the protocol replies to ICMP Extended Echo
+// Requests.
+func (p *protocol) echoProbeEnabled() bool {
+	return atomic.LoadUint32(&p.echoEnableProbe) == 1
+}
+
 // SetDefaultTTL sets the default TTL for endpoints created with this protocol.
 func (p *protocol) SetDefaultTTL(ttl uint8) {
 	atomic.StoreUint32(&p.defaultTTL, uint32(ttl))
@@ -1674,6 +2145,32 @@ type Options struct {
 
 	// MLD holds options for MLD.
 	MLD MLDOptions
+
+	// FragmentPolicy holds the policies applied to received fragments.
+	FragmentPolicy FragmentPolicy
+}
+
+// FragmentPolicy holds the policies applied to received fragments. The zero
+// value accepts all fragments allowed by RFC 8200.
+type FragmentPolicy struct {
+	// DropAtomicFragments drops atomic fragments, packets which carry a
+	// Fragment header with a zero Fragment Offset and the M flag cleared.
+	// They are otherwise processed as unfragmented packets, as per RFC 6946
+	// section 4. Their generation is deprecated by RFC 8021.
+	DropAtomicFragments bool
+
+	// DropOverlappingFragments abandons the reassembly of a packet when any
+	// of its fragments overlaps with fragments previously received for it,
+	// as per RFC 5722 section 4. Only fragments partially overlapping with
+	// previous fragments abandon reassembly otherwise, and fragments entirely
+	// covered by previous fragments are ignored. Exact duplicates of a
+	// fragment are always ignored, as allowed by RFC 8200 section 4.5.
+	DropOverlappingFragments bool
+
+	// MinimumFragmentSize is the smallest payload, in bytes, of non-final
+	// fragments. Smaller fragments are dropped. Zero accepts fragments of any
+	// size.
+	MinimumFragmentSize int
 }
 
 // NewProtocolWithOptions returns an IPv6 network protocol.
@@ -1692,8 +2189,13 @@ func NewProtocolWithOptions(opts Options) stack.NetworkProtocolFactory {
 			hashIV: hashIV,
 		}
 		p.fragmentation = fragmentation.NewFragmentation(header.IPv6FragmentExtHdrFragmentOffsetBytesPerUnit, fragmentation.HighFragThreshold, fragmentation.LowFragThreshold, ReassembleTimeout, s.Clock(), p)
+		p.fragmentation.SetRejectOverlaps(opts.FragmentPolicy.DropOverlappingFragments)
 		p.mu.eps = make(map[*endpoint]struct{})
 		p.SetDefaultTTL(DefaultTTL)
+		p.defaultMulticastTTL = DefaultMulticastTTL
+		p.maxSocketMemberships = DefaultMaxSocketMemberships
+		p.maxNICMemberships = DefaultMaxNICMemberships
+		p.mldProxy.init(p)
 		return p
 	}
 }
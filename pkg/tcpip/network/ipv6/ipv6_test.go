@@ -2141,6 +2141,151 @@ func TestInvalidIPv6Fragments(t *testing.T) {
 	}
 }
 
+func TestFragmentPolicy(t *testing.T) {
+	const (
+		addr1     = "\x0a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01"
+		addr2     = "\x0a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02"
+		linkAddr1 = tcpip.LinkAddress("\x0a\x0b\x0c\x0d\x0e\x0e")
+		nicID     = 1
+		hoplimit  = 255
+		ident     = 1
+		data      = "TEST_FRAGMENT_POLICY_PAYLOAD"
+	)
+
+	type fragment struct {
+		offset uint16
+		more   bool
+		size   int
+	}
+
+	tests := []struct {
+		name                  string
+		policy                FragmentPolicy
+		fragments             []fragment
+		wantAtomicDropped     uint64
+		wantOverlapping       uint64
+		wantTinyDropped       uint64
+		wantMalformedFragment uint64
+	}{
+		{
+			name:      "atomic fragment accepted",
+			fragments: []fragment{{offset: 0, more: false, size: 16}},
+		},
+		{
+			name:              "atomic fragment dropped",
+			policy:            FragmentPolicy{DropAtomicFragments: true},
+			fragments:         []fragment{{offset: 0, more: false, size: 16}},
+			wantAtomicDropped: 1,
+		},
+		{
+			name:            "tiny fragment dropped",
+			policy:          FragmentPolicy{MinimumFragmentSize: 16},
+			fragments:       []fragment{{offset: 0, more: true, size: 8}},
+			wantTinyDropped: 1,
+		},
+		{
+			name:   "small final fragment accepted",
+			policy: FragmentPolicy{MinimumFragmentSize: 16},
+			fragments: []fragment{
+				{offset: 0, more: true, size: 16},
+				{offset: 16, more: false, size: 8},
+			},
+		},
+		{
+			name: "partially overlapping fragment",
+			fragments: []fragment{
+				{offset: 0, more: true, size: 16},
+				{offset: 8, more: true, size: 16},
+			},
+			wantOverlapping:       1,
+			wantMalformedFragment: 1,
+		},
+		{
+			name: "covered fragment ignored",
+			fragments: []fragment{
+				{offset: 0, more: true, size: 16},
+				{offset: 8, more: true, size: 8},
+			},
+		},
+		{
+			name:   "covered fragment rejected",
+			policy: FragmentPolicy{DropOverlappingFragments: true},
+			fragments: []fragment{
+				{offset: 0, more: true, size: 16},
+				{offset: 8, more: true, size: 8},
+			},
+			wantOverlapping:       1,
+			wantMalformedFragment: 1,
+		},
+		{
+			name:   "duplicate fragment ignored",
+			policy: FragmentPolicy{DropOverlappingFragments: true},
+			fragments: []fragment{
+				{offset: 0, more: true, size: 16},
+				{offset: 0, more: true, size: 16},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{
+					NewProtocolWithOptions(Options{FragmentPolicy: test.policy}),
+				},
+			})
+			e := channel.New(1, 1500, linkAddr1)
+			if err := s.CreateNIC(nicID, e); err != nil {
+				t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+			}
+			if err := s.AddAddress(nicID, ProtocolNumber, addr2); err != nil {
+				t.Fatalf("AddAddress(%d, %d, %s) = %s", nicID, ProtocolNumber, addr2, err)
+			}
+
+			for _, f := range test.fragments {
+				hdr := buffer.NewPrependable(header.IPv6MinimumSize + header.IPv6FragmentHeaderSize)
+
+				ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize + header.IPv6FragmentHeaderSize))
+				ip.Encode(&header.IPv6Fields{
+					PayloadLength: uint16(header.IPv6FragmentHeaderSize + f.size),
+					NextHeader:    header.IPv6FragmentHeader,
+					HopLimit:      hoplimit,
+					SrcAddr:       addr1,
+					DstAddr:       addr2,
+				})
+
+				fragHDR := header.IPv6Fragment(hdr.View()[header.IPv6MinimumSize:])
+				fragHDR.Encode(&header.IPv6FragmentFields{
+					NextHeader:     uint8(header.UDPProtocolNumber),
+					FragmentOffset: f.offset >> 3,
+					M:              f.more,
+					Identification: ident,
+				})
+
+				vv := hdr.View().ToVectorisedView()
+				vv.AppendView(buffer.View(data)[f.offset:][:f.size])
+				e.InjectInbound(ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+					Data: vv,
+				}))
+			}
+
+			stats := s.Stats().IP
+			if got := stats.AtomicFragmentsDropped.Value(); got != test.wantAtomicDropped {
+				t.Errorf("got stats.AtomicFragmentsDropped.Value() = %d, want = %d", got, test.wantAtomicDropped)
+			}
+			if got := stats.OverlappingFragmentsReceived.Value(); got != test.wantOverlapping {
+				t.Errorf("got stats.OverlappingFragmentsReceived.Value() = %d, want = %d", got, test.wantOverlapping)
+			}
+			if got := stats.TinyFragmentsDropped.Value(); got != test.wantTinyDropped {
+				t.Errorf("got stats.TinyFragmentsDropped.Value() = %d, want = %d", got, test.wantTinyDropped)
+			}
+			if got := stats.MalformedFragmentsReceived.Value(); got != test.wantMalformedFragment {
+				t.Errorf("got stats.MalformedFragmentsReceived.Value() = %d, want = %d", got, test.wantMalformedFragment)
+			}
+		})
+	}
+}
+
 func TestFragmentReassemblyTimeout(t *testing.T) {
 	const (
 		addr1     = "\x0a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01"
@@ -3046,6 +3191,325 @@ func TestForwarding(t *testing.T) {
 					t.Fatalf("got e1.Drain() = %d, want = 0", n)
 				}
 			}
+
+			var wantForwarded, wantHopLimitExceeded uint64
+			if test.expectErrorICMP {
+				wantHopLimitExceeded = 1
+			} else {
+				wantForwarded = 1
+			}
+			ipStats := s.Stats().IP
+			if got := ipStats.PacketsForwarded.Value(); got != wantForwarded {
+				t.Errorf("got ipStats.PacketsForwarded.Value() = %d, want = %d", got, wantForwarded)
+			}
+			if got := ipStats.HopLimitExceeded.Value(); got != wantHopLimitExceeded {
+				t.Errorf("got ipStats.HopLimitExceeded.Value() = %d, want = %d", got, wantHopLimitExceeded)
+			}
+			nic1Stats, err := s.NICForwardingStats(nicID1)
+			if err != nil {
+				t.Fatalf("s.NICForwardingStats(%d): %s", nicID1, err)
+			}
+			if got := nic1Stats.HopLimitExceeded.Value(); got != wantHopLimitExceeded {
+				t.Errorf("got nic1Stats.HopLimitExceeded.Value() = %d, want = %d", got, wantHopLimitExceeded)
+			}
+			nic2Stats, err := s.NICForwardingStats(nicID2)
+			if err != nil {
+				t.Fatalf("s.NICForwardingStats(%d): %s", nicID2, err)
+			}
+			if got := nic2Stats.Forwarded.Value(); got != wantForwarded {
+				t.Errorf("got nic2Stats.Forwarded.Value() = %d, want = %d", got, wantForwarded)
+			}
 		})
 	}
 }
+
+// newNoPayloadPacket returns an IPv6 packet from src to dst without payload.
+func newNoPayloadPacket(src, dst tcpip.Address, hopLimit uint8) *stack.PacketBuffer {
+	hdr := buffer.NewPrependable(header.IPv6MinimumSize)
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		NextHeader: noNextHdrID,
+		HopLimit:   hopLimit,
+		SrcAddr:    src,
+		DstAddr:    dst,
+	})
+	return stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: hdr.View().ToVectorisedView(),
+	})
+}
+
+// newMLDPacket returns an MLD message of type mldType for groupAddress, sent
+// from src to dst.
+func newMLDPacket(src, dst tcpip.Address, mldType header.ICMPv6Type, groupAddress tcpip.Address) *stack.PacketBuffer {
+	const icmpSize = header.ICMPv6HeaderSize + header.MLDMinimumSize
+	hdr := buffer.NewPrependable(header.IPv6MinimumSize + icmpSize)
+	icmp := header.ICMPv6(hdr.Prepend(icmpSize))
+	icmp.SetType(mldType)
+	header.MLD(icmp.MessageBody()).SetMulticastAddress(groupAddress)
+	icmp.SetChecksum(header.ICMPv6Checksum(icmp, src, dst, buffer.VectorisedView{}))
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength: icmpSize,
+		NextHeader:    uint8(header.ICMPv6ProtocolNumber),
+		HopLimit:      header.MLDHopLimit,
+		SrcAddr:       src,
+		DstAddr:       dst,
+	})
+	return stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: hdr.View().ToVectorisedView(),
+	})
+}
+
+func TestMulticastForwarding(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+		nicID3 = 3
+	)
+	srcAddr := tcpip.Address(net.ParseIP("2001:db8:1::2").To16())
+	groupAddr := tcpip.Address(net.ParseIP("ff0e::1234").To16())
+	otherGroupAddr := tcpip.Address(net.ParseIP("ff0e::5678").To16())
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{NewProtocol},
+	})
+	if err := s.SetForwarding(ProtocolNumber, true); err != nil {
+		t.Fatalf("SetForwarding(%d, true): %s", ProtocolNumber, err)
+	}
+	eps := make(map[tcpip.NICID]*channel.Endpoint)
+	for _, nicID := range []tcpip.NICID{nicID1, nicID2, nicID3} {
+		e := channel.New(1, header.IPv6MinimumMTU, "")
+		if err := s.CreateNIC(nicID, e); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+		}
+		addr := tcpip.Address(net.ParseIP(fmt.Sprintf("2001:db8:%d::1", nicID)).To16())
+		if err := s.AddAddress(nicID, ProtocolNumber, addr); err != nil {
+			t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ProtocolNumber, addr, err)
+		}
+		eps[nicID] = e
+	}
+
+	// Packets are only forwarded out of NIC 3 if their hop limit exceeds 10.
+	for nicID, threshold := range map[tcpip.NICID]uint8{nicID1: 0, nicID2: 0, nicID3: 10} {
+		if err := s.AddMulticastInterface(ProtocolNumber, nicID, stack.MulticastInterface{HopLimitThreshold: threshold}); err != nil {
+			t.Fatalf("AddMulticastInterface(%d, %d, _): %s", ProtocolNumber, nicID, err)
+		}
+	}
+	route := stack.MulticastRoute{
+		Source:     srcAddr,
+		Group:      groupAddr,
+		InputNIC:   nicID1,
+		OutputNICs: []tcpip.NICID{nicID2, nicID3},
+	}
+	if err := s.AddMulticastRoute(ProtocolNumber, route); err != nil {
+		t.Fatalf("AddMulticastRoute(%d, %+v): %s", ProtocolNumber, route, err)
+	}
+
+	eps[nicID1].InjectInbound(ProtocolNumber, newNoPayloadPacket(srcAddr, groupAddr, 5))
+	p, ok := eps[nicID2].Read()
+	if !ok {
+		t.Fatalf("expected packet to be forwarded out of NIC %d", nicID2)
+	}
+	checker.IPv6(t, header.IPv6(stack.PayloadSince(p.Pkt.NetworkHeader())),
+		checker.SrcAddr(srcAddr),
+		checker.DstAddr(groupAddr),
+		checker.TTL(4),
+	)
+	if n := eps[nicID3].Drain(); n != 0 {
+		t.Errorf("got %d packets forwarded out of NIC %d below its hop limit threshold, want = 0", n, nicID3)
+	}
+
+	// Packets received on another NIC than the input NIC of their route, or
+	// matching no route, aren't forwarded.
+	eps[nicID2].InjectInbound(ProtocolNumber, newNoPayloadPacket(srcAddr, groupAddr, 5))
+	eps[nicID1].InjectInbound(ProtocolNumber, newNoPayloadPacket(srcAddr, otherGroupAddr, 5))
+	for _, nicID := range []tcpip.NICID{nicID1, nicID2, nicID3} {
+		if n := eps[nicID].Drain(); n != 0 {
+			t.Errorf("got %d packets sent out of NIC %d, want = 0", n, nicID)
+		}
+	}
+
+	ipStats := s.Stats().IP
+	if got := ipStats.PacketsForwarded.Value(); got != 1 {
+		t.Errorf("got ipStats.PacketsForwarded.Value() = %d, want = 1", got)
+	}
+	if got := ipStats.MulticastWrongInterface.Value(); got != 1 {
+		t.Errorf("got ipStats.MulticastWrongInterface.Value() = %d, want = 1", got)
+	}
+	if got := ipStats.MulticastNoRoute.Value(); got != 1 {
+		t.Errorf("got ipStats.MulticastNoRoute.Value() = %d, want = 1", got)
+	}
+	routes := s.MulticastRoutes(ProtocolNumber)
+	if len(routes) != 1 {
+		t.Fatalf("got len(s.MulticastRoutes(%d)) = %d, want = 1", ProtocolNumber, len(routes))
+	}
+	if got := routes[0].Stats; got.Packets != 1 || got.WrongInterface != 1 {
+		t.Errorf("got route stats = %+v, want 1 packet and 1 wrong interface", got)
+	}
+}
+
+func TestMLDProxy(t *testing.T) {
+	const (
+		upstreamNICID   = 1
+		downstreamNICID = 2
+	)
+	linkLocalAddr := tcpip.Address(net.ParseIP("fe80::1").To16())
+	listenerAddr := tcpip.Address(net.ParseIP("fe80::2").To16())
+	srcAddr := tcpip.Address(net.ParseIP("2001:db8:1::2").To16())
+	groupAddr := tcpip.Address(net.ParseIP("ff0e::1234").To16())
+
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{NewProtocolWithOptions(Options{
+			MLD: MLDOptions{Enabled: true},
+		})},
+		Clock: clock,
+	})
+	if err := s.SetForwarding(ProtocolNumber, true); err != nil {
+		t.Fatalf("SetForwarding(%d, true): %s", ProtocolNumber, err)
+	}
+	upstream := channel.New(10, header.IPv6MinimumMTU, "")
+	downstream := channel.New(10, header.IPv6MinimumMTU, "")
+	for nicID, e := range map[tcpip.NICID]*channel.Endpoint{upstreamNICID: upstream, downstreamNICID: downstream} {
+		if err := s.CreateNIC(nicID, e); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+		}
+		addr := tcpip.Address(net.ParseIP(fmt.Sprintf("2001:db8:%d::1", nicID)).To16())
+		if err := s.AddAddress(nicID, ProtocolNumber, addr); err != nil {
+			t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ProtocolNumber, addr, err)
+		}
+	}
+	if err := s.AddAddress(downstreamNICID, ProtocolNumber, linkLocalAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", downstreamNICID, ProtocolNumber, linkLocalAddr, err)
+	}
+	upstream.Drain()
+	downstream.Drain()
+
+	opt := tcpip.MulticastProxyOption{Upstream: upstreamNICID, Downstream: []tcpip.NICID{downstreamNICID}}
+	if err := s.SetNetworkProtocolOption(ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetNetworkProtocolOption(%d, %+v): %s", ProtocolNumber, opt, err)
+	}
+
+	// The proxy queries the downstream hosts for their memberships.
+	clock.Advance(0)
+	p, ok := downstream.Read()
+	if !ok {
+		t.Fatal("expected a General Query to be sent downstream")
+	}
+	checker.IPv6(t, header.IPv6(stack.PayloadSince(p.Pkt.NetworkHeader())),
+		checker.SrcAddr(linkLocalAddr),
+		checker.DstAddr(header.IPv6AllNodesMulticastAddress),
+		checker.TTL(header.MLDHopLimit),
+		checker.MLD(header.ICMPv6MulticastListenerQuery, header.MLDMinimumSize,
+			checker.MLDMaxRespDelay(mldQueryResponseInterval),
+			checker.MLDMulticastAddress(header.IPv6Any),
+		),
+	)
+
+	// A downstream membership is reported upstream, and the packets of the
+	// group are forwarded downstream.
+	downstream.InjectInbound(ProtocolNumber, newMLDPacket(listenerAddr, groupAddr, header.ICMPv6MulticastListenerReport, groupAddr))
+	p, ok = upstream.Read()
+	if !ok {
+		t.Fatal("expected a Report to be sent upstream")
+	}
+	checker.IPv6(t, header.IPv6(stack.PayloadSince(p.Pkt.NetworkHeader())),
+		checker.DstAddr(groupAddr),
+		checker.MLD(header.ICMPv6MulticastListenerReport, header.MLDMinimumSize,
+			checker.MLDMulticastAddress(groupAddr),
+		),
+	)
+	upstream.InjectInbound(ProtocolNumber, newNoPayloadPacket(srcAddr, groupAddr, 5))
+	p, ok = downstream.Read()
+	if !ok {
+		t.Fatal("expected packet to be forwarded downstream")
+	}
+	checker.IPv6(t, header.IPv6(stack.PayloadSince(p.Pkt.NetworkHeader())),
+		checker.SrcAddr(srcAddr),
+		checker.DstAddr(groupAddr),
+		checker.TTL(4),
+	)
+
+	// On Done, the group is queried Last Listener Query Count times before
+	// it is left upstream.
+	downstream.InjectInbound(ProtocolNumber, newMLDPacket(listenerAddr, header.IPv6AllRoutersMulticastAddress, header.ICMPv6MulticastListenerDone, groupAddr))
+	for i := 0; i < mldLastListenerQueryCount; i++ {
+		p, ok := downstream.Read()
+		if !ok {
+			t.Fatalf("expected Multicast-Address-Specific Query #%d to be sent downstream", i)
+		}
+		checker.IPv6(t, header.IPv6(stack.PayloadSince(p.Pkt.NetworkHeader())),
+			checker.DstAddr(groupAddr),
+			checker.MLD(header.ICMPv6MulticastListenerQuery, header.MLDMinimumSize,
+				checker.MLDMaxRespDelay(mldLastListenerQueryInterval),
+				checker.MLDMulticastAddress(groupAddr),
+			),
+		)
+		if joined, err := s.IsInGroup(upstreamNICID, groupAddr); err != nil || !joined {
+			t.Fatalf("got s.IsInGroup(%d, %s) = (%t, %v) before the last query expired, want = (true, nil)", upstreamNICID, groupAddr, joined, err)
+		}
+		clock.Advance(mldLastListenerQueryInterval)
+	}
+	if joined, err := s.IsInGroup(upstreamNICID, groupAddr); err != nil || joined {
+		t.Fatalf("got s.IsInGroup(%d, %s) = (%t, %v) after the last query expired, want = (false, nil)", upstreamNICID, groupAddr, joined, err)
+	}
+	upstream.InjectInbound(ProtocolNumber, newNoPayloadPacket(srcAddr, groupAddr, 5))
+	if n := downstream.Drain(); n != 0 {
+		t.Errorf("got %d packets sent downstream without listeners, want = 0", n)
+	}
+
+	// Disabling the proxy stops forwarding.
+	opt = tcpip.MulticastProxyOption{}
+	if err := s.SetNetworkProtocolOption(ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetNetworkProtocolOption(%d, %+v): %s", ProtocolNumber, opt, err)
+	}
+	var got tcpip.MulticastProxyOption
+	if err := s.NetworkProtocolOption(ProtocolNumber, &got); err != nil {
+		t.Fatalf("NetworkProtocolOption(%d, _): %s", ProtocolNumber, err)
+	}
+	if got.Upstream != 0 || len(got.Downstream) != 0 {
+		t.Errorf("got MulticastProxyOption = %+v after disabling the proxy, want = {}", got)
+	}
+}
+
+// TestIPv6MTU verifies that the IPv6 MTU of an endpoint can be lowered down to
+// the IPv6 minimum MTU, but not raised above the MTU of the link.
+func TestIPv6MTU(t *testing.T) {
+	const (
+		nicID   = 1
+		linkMTU = 1500
+	)
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{NewProtocol},
+	})
+	if err := s.CreateNIC(nicID, channel.New(1, linkMTU, linkAddr1)); err != nil {
+		t.Fatalf("s.CreateNIC(%d, _): %s", nicID, err)
+	}
+	ep, err := s.GetNetworkEndpoint(nicID, ProtocolNumber)
+	if err != nil {
+		t.Fatalf("s.GetNetworkEndpoint(%d, %d): %s", nicID, ProtocolNumber, err)
+	}
+	mtuEP := ep.(MTUEndpoint)
+
+	if got := mtuEP.IPv6MTU(); got != linkMTU {
+		t.Errorf("got IPv6MTU() = %d, want = %d", got, linkMTU)
+	}
+
+	for _, mtu := range []uint32{0, header.IPv6MinimumMTU - 1, linkMTU + 1} {
+		if err := mtuEP.SetIPv6MTU(mtu); err != tcpip.ErrInvalidOptionValue {
+			t.Errorf("got SetIPv6MTU(%d) = %s, want = %s", mtu, err, tcpip.ErrInvalidOptionValue)
+		}
+	}
+
+	for _, mtu := range []uint32{header.IPv6MinimumMTU, linkMTU} {
+		if err := mtuEP.SetIPv6MTU(mtu); err != nil {
+			t.Fatalf("SetIPv6MTU(%d): %s", mtu, err)
+		}
+		if got := mtuEP.IPv6MTU(); got != mtu {
+			t.Errorf("got IPv6MTU() = %d after setting it to %d", got, mtu)
+		}
+		if got, want := ep.MTU(), mtu-header.IPv6MinimumSize; got != want {
+			t.Errorf("got MTU() = %d with an IPv6 MTU of %d, want = %d", got, mtu, want)
+		}
+	}
+}
@@ -31,6 +31,13 @@ const (
 	//
 	// Obtained from RFC 2710 Section 7.10.
 	UnsolicitedReportIntervalMax = 10 * time.Second
+
+	// otherQuerierPresentInterval is the Robustness Variable times the Query
+	// Interval plus one half of the Query Response Interval, using their
+	// default values.
+	//
+	// Obtained from RFC 2710 Section 7.5.
+	otherQuerierPresentInterval = 255 * time.Second
 )
 
 // MLDOptions holds options for MLD.
@@ -41,34 +48,58 @@ type MLDOptions struct {
 	// joining and leaving multicast groups respectively, and handle incoming
 	// MLD packets.
 	Enabled bool
+
+	// V2Reports indicates whether reports are sent as MLDv2 Reports, holding a
+	// MODE_IS_EXCLUDE record without sources for each reported multicast
+	// address, instead of MLDv1 Reports. Reports for multiple addresses are
+	// then coalesced. Done messages are sent as MLDv2 Reports with a
+	// CHANGE_TO_INCLUDE_MODE record.
+	V2Reports bool
 }
 
 var _ ip.MulticastGroupProtocol = (*mldState)(nil)
+var _ ip.MulticastGroupProtocolBatchReporter = (*mldState)(nil)
 
 // mldState is the per-interface MLD state.
 //
 // mldState.init MUST be called to initialize the MLD state.
 type mldState struct {
 	// The IPv6 endpoint this mldState is for.
-	ep *endpoint
+	ep   *endpoint
+	opts MLDOptions
 
 	genericMulticastProtocol ip.GenericMulticastProtocolState
 }
 
 // SendReport implements ip.MulticastGroupProtocol.
 func (mld *mldState) SendReport(groupAddress tcpip.Address) *tcpip.Error {
+	if mld.opts.V2Reports {
+		return mld.writeV2Report(header.GroupRecordModeIsExclude, []tcpip.Address{groupAddress})
+	}
 	return mld.writePacket(groupAddress, groupAddress, header.ICMPv6MulticastListenerReport)
 }
 
 // SendLeave implements ip.MulticastGroupProtocol.
 func (mld *mldState) SendLeave(groupAddress tcpip.Address) *tcpip.Error {
+	if mld.opts.V2Reports {
+		return mld.writeV2Report(header.GroupRecordChangeToIncludeMode, []tcpip.Address{groupAddress})
+	}
 	return mld.writePacket(header.IPv6AllRoutersMulticastAddress, groupAddress, header.ICMPv6MulticastListenerDone)
 }
 
+// SendReports implements ip.MulticastGroupProtocolBatchReporter.
+func (mld *mldState) SendReports(groupAddresses []tcpip.Address) (bool, *tcpip.Error) {
+	if !mld.opts.V2Reports {
+		return false, nil
+	}
+	return true, mld.writeV2Report(header.GroupRecordModeIsExclude, groupAddresses)
+}
+
 // init sets up an mldState struct, and is required to be called before using
 // a new mldState.
 func (mld *mldState) init(ep *endpoint, opts MLDOptions) {
 	mld.ep = ep
+	mld.opts = opts
 	mld.genericMulticastProtocol.Init(ip.GenericMulticastProtocolOptions{
 		Enabled:                   opts.Enabled,
 		Rand:                      ep.protocol.stack.Rand(),
@@ -76,14 +107,28 @@ func (mld *mldState) init(ep *endpoint, opts MLDOptions) {
 		Protocol:                  mld,
 		MaxUnsolicitedReportDelay: UnsolicitedReportIntervalMax,
 		AllNodesAddress:           header.IPv6AllNodesMulticastAddress,
+
+		OtherQuerierPresentInterval: otherQuerierPresentInterval,
 	})
 }
 
-func (mld *mldState) handleMulticastListenerQuery(mldHdr header.MLD) {
+func (mld *mldState) handleMulticastListenerQuery(srcAddress tcpip.Address, mldHdr header.MLD) {
+	// As per RFC 3810 Section 8.1, the version of a query is determined by its
+	// length: MLDv2 queries are at least 28 octets long.
+	querier := ip.Querier{Address: srcAddress, Version: 1}
+	if len(mldHdr) >= header.MLDv2QueryMinimumSize {
+		querier.Version = 2
+	}
+	mld.genericMulticastProtocol.HandleQuerier(querier)
 	mld.genericMulticastProtocol.HandleQuery(mldHdr.MulticastAddress(), mldHdr.MaximumResponseDelay())
 }
 
 func (mld *mldState) handleMulticastListenerReport(mldHdr header.MLD) {
+	// As per RFC 3810 Section 6.1, MLDv2 nodes do not suppress their reports
+	// when hearing the reports of other listeners.
+	if mld.opts.V2Reports {
+		return
+	}
 	mld.genericMulticastProtocol.HandleReport(mldHdr.MulticastAddress())
 }
 
@@ -95,11 +140,21 @@ func (mld *mldState) joinGroup(groupAddress tcpip.Address) {
 	mld.genericMulticastProtocol.JoinGroup(groupAddress, !mld.ep.Enabled() /* dontInitialize */)
 }
 
+// querier returns the querier on the link, if any.
+func (mld *mldState) querier() (ip.Querier, bool) {
+	return mld.genericMulticastProtocol.Querier()
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 func (mld *mldState) isInGroup(groupAddress tcpip.Address) bool {
 	return mld.genericMulticastProtocol.IsLocallyJoined(groupAddress)
 }
 
+// numGroups returns the number of locally joined groups.
+func (mld *mldState) numGroups() int {
+	return mld.genericMulticastProtocol.NumLocallyJoined()
+}
+
 // leaveGroup handles removing the group from the membership map, cancels any
 // delay timers associated with that group, and sends the Done message, if
 // required.
@@ -125,23 +180,101 @@ func (mld *mldState) initializeAll() {
 }
 
 func (mld *mldState) writePacket(destAddress, groupAddress tcpip.Address, mldType header.ICMPv6Type) *tcpip.Error {
+	icmp := header.ICMPv6(buffer.NewView(header.ICMPv6HeaderSize + header.MLDMinimumSize))
+	icmp.SetType(mldType)
+	header.MLD(icmp.MessageBody()).SetMulticastAddress(groupAddress)
+	return mld.writeMessage(header.IPv6Any, destAddress, icmp)
+}
+
+// writeQuery sends an MLDv1 Multicast-Address-Specific Query for groupAddress,
+// or a General Query if groupAddress is the unspecified address, as the
+// querier of the link.
+//
+// Precondition: mld.ep.mu must not be locked.
+func (mld *mldState) writeQuery(groupAddress tcpip.Address, maxRespDelay time.Duration) *tcpip.Error {
+	destAddress := groupAddress
+	if groupAddress == header.IPv6Any {
+		destAddress = header.IPv6AllNodesMulticastAddress
+	}
+
+	// As per RFC 2710 section 3, queries are sent from a link-local address
+	// so that hosts can identify the querier.
+	addressEndpoint := mld.ep.AcquireOutgoingPrimaryAddress(destAddress, false /* allowExpired */)
+	if addressEndpoint == nil {
+		return tcpip.ErrBadLocalAddress
+	}
+	localAddress := addressEndpoint.AddressWithPrefix().Address
+	addressEndpoint.DecRef()
+	if !header.IsV6LinkLocalAddress(localAddress) {
+		return tcpip.ErrBadLocalAddress
+	}
+
+	icmp := header.ICMPv6(buffer.NewView(header.ICMPv6HeaderSize + header.MLDMinimumSize))
+	icmp.SetType(header.ICMPv6MulticastListenerQuery)
+	mldHdr := header.MLD(icmp.MessageBody())
+	mldHdr.SetMaximumResponseDelay(uint16(maxRespDelay / time.Millisecond))
+	mldHdr.SetMulticastAddress(groupAddress)
+	return mld.writeMessage(localAddress, destAddress, icmp)
+}
+
+// writeV2Report sends MLDv2 Reports holding a record of type recordType for
+// each multicast address, splitting the records across as many reports as
+// needed to fit in the MTU.
+func (mld *mldState) writeV2Report(recordType header.GroupRecordType, groupAddresses []tcpip.Address) *tcpip.Error {
+	records := make([]header.GroupRecord, 0, len(groupAddresses))
+	for _, groupAddress := range groupAddresses {
+		records = append(records, header.GroupRecord{
+			Type:             recordType,
+			MulticastAddress: groupAddress,
+		})
+	}
+
+	maxRecords := len(records)
+	if len(records) != 0 {
+		perRecord := header.MLDv2ReportSize(records[:1]) - header.MLDv2ReportMinimumSize
+		if n := (int(mld.ep.MTU()) - header.ICMPv6HeaderSize - header.MLDv2ReportMinimumSize) / perRecord; n > 0 && n < maxRecords {
+			maxRecords = n
+		}
+	}
+
+	var firstErr *tcpip.Error
+	for len(records) != 0 {
+		n := maxRecords
+		if n > len(records) {
+			n = len(records)
+		}
+		icmp := header.ICMPv6(buffer.NewView(header.ICMPv6HeaderSize + header.MLDv2ReportSize(records[:n])))
+		icmp.SetType(header.ICMPv6MulticastListenerV2Report)
+		header.MLDv2Report(icmp.MessageBody()).Encode(records[:n])
+		if err := mld.writeMessage(header.IPv6Any, header.MLDv2RoutersMulticastAddress, icmp); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		records = records[n:]
+	}
+	return firstErr
+}
+
+// writeMessage checksums and sends the MLD message icmp from localAddress to
+// destAddress, incrementing the sent stat counter for its type on success.
+func (mld *mldState) writeMessage(localAddress, destAddress tcpip.Address, icmp header.ICMPv6) *tcpip.Error {
 	sentStats := mld.ep.protocol.stack.Stats().ICMP.V6.PacketsSent
 	var mldStat *tcpip.StatCounter
-	switch mldType {
+	switch mldType := icmp.Type(); mldType {
+	case header.ICMPv6MulticastListenerQuery:
+		mldStat = sentStats.MulticastListenerQuery
 	case header.ICMPv6MulticastListenerReport:
 		mldStat = sentStats.MulticastListenerReport
+	case header.ICMPv6MulticastListenerV2Report:
+		mldStat = sentStats.MulticastListenerReportV2
 	case header.ICMPv6MulticastListenerDone:
 		mldStat = sentStats.MulticastListenerDone
 	default:
 		panic(fmt.Sprintf("unrecognized mld type = %d", mldType))
 	}
 
-	icmp := header.ICMPv6(buffer.NewView(header.ICMPv6HeaderSize + header.MLDMinimumSize))
-	icmp.SetType(mldType)
-	header.MLD(icmp.MessageBody()).SetMulticastAddress(groupAddress)
-	// TODO(gvisor.dev/issue/4888): We should not use the unspecified address,
-	// rather we should select an appropriate local address.
-	localAddress := header.IPv6Any
+	// TODO(gvisor.dev/issue/4888): Reports and Done messages should not be
+	// sent from the unspecified address, rather we should select an
+	// appropriate local address.
 	icmp.SetChecksum(header.ICMPv6Checksum(icmp, localAddress, destAddress, buffer.VectorisedView{}))
 
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
@@ -149,10 +282,12 @@ func (mld *mldState) writePacket(destAddress, groupAddress tcpip.Address, mldTyp
 		Data:               buffer.View(icmp).ToVectorisedView(),
 	})
 
-	mld.ep.addIPHeader(localAddress, destAddress, pkt, stack.NetworkHeaderParams{
+	if err := mld.ep.addIPHeader(localAddress, destAddress, pkt, stack.NetworkHeaderParams{
 		Protocol: header.ICMPv6ProtocolNumber,
 		TTL:      header.MLDHopLimit,
-	})
+	}); err != nil {
+		panic(fmt.Sprintf("failed to add IP header: %s", err))
+	}
 	// TODO(b/162198658): set the ROUTER_ALERT option when sending Host
 	// Membership Reports.
 	if err := mld.ep.nic.WritePacketToRemote(header.EthernetAddressFromMulticastIPv6Address(destAddress), nil /* gso */, ProtocolNumber, pkt); err != nil {
@@ -0,0 +1,410 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipv6
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// mldQueryInterval is the interval between General Queries sent by the
+	// querier.
+	//
+	// Obtained from RFC 2710 Section 7.2.
+	mldQueryInterval = 125 * time.Second
+
+	// mldQueryResponseInterval is the Maximum Response Delay of General
+	// Queries.
+	//
+	// Obtained from RFC 2710 Section 7.3.
+	mldQueryResponseInterval = 10 * time.Second
+
+	// mldListenerInterval is the time after which a listener which didn't
+	// report again is considered gone.
+	//
+	// Obtained from RFC 2710 Section 7.4.
+	mldListenerInterval = 2*mldQueryInterval + mldQueryResponseInterval
+
+	// mldStartupQueryInterval and mldStartupQueryCount are the interval
+	// between, and number of, the General Queries sent on startup.
+	//
+	// Obtained from RFC 2710 Sections 7.6 and 7.7.
+	mldStartupQueryInterval = mldQueryInterval / 4
+	mldStartupQueryCount    = 2
+
+	// mldLastListenerQueryInterval and mldLastListenerQueryCount are the
+	// interval between, and number of, the Multicast-Address-Specific
+	// Queries sent when a Done message is received.
+	//
+	// Obtained from RFC 2710 Sections 7.8 and 7.9.
+	mldLastListenerQueryInterval = time.Second
+	mldLastListenerQueryCount    = 2
+)
+
+// mldProxy is an MLD proxy, as per RFC 4605. It performs the router portion of
+// MLD on its downstream NICs to learn the groups their hosts listen to, and
+// joins these groups on its upstream NIC, where the host portion of MLD reports
+// them. Multicast packets are forwarded from the upstream NIC to the downstream
+// NICs with listeners, and from the downstream NICs to the upstream NIC.
+type mldProxy struct {
+	protocol *protocol
+
+	mu sync.Mutex
+
+	// upstream is the upstream NIC, or zero if the proxy is disabled.
+	upstream tcpip.NICID
+
+	// downstreamIDs lists the downstream NICs in the order they were
+	// configured, and downstream holds their state.
+	downstreamIDs []tcpip.NICID
+	downstream    map[tcpip.NICID]*mldProxyDownstream
+
+	// joined holds the groups joined on the upstream NIC on behalf of the
+	// downstream listeners.
+	joined map[tcpip.Address]struct{}
+}
+
+// mldProxyDownstream is the state of a downstream NIC of an mldProxy.
+type mldProxyDownstream struct {
+	nicID tcpip.NICID
+
+	// queryJob sends the General Queries.
+	queryJob *tcpip.Job
+
+	// startupQueries is the number of startup General Queries left to send.
+	startupQueries int
+
+	// listeners holds the groups with listeners on the NIC.
+	listeners map[tcpip.Address]*mldProxyListener
+}
+
+// mldProxyListener is the state of a group with listeners on a downstream NIC.
+type mldProxyListener struct {
+	// expiryJob forgets the listeners, or sends the next
+	// Multicast-Address-Specific Query after a Done message.
+	expiryJob *tcpip.Job
+
+	// lastListenerQueries is the number of Multicast-Address-Specific Queries
+	// left to send after a Done message.
+	lastListenerQueries int
+}
+
+func (p *mldProxy) init(protocol *protocol) {
+	p.protocol = protocol
+}
+
+// setOption configures the proxy as per opt, resetting its state.
+func (p *mldProxy) setOption(opt *tcpip.MulticastProxyOption) *tcpip.Error {
+	if opt.Upstream != 0 {
+		for _, id := range append([]tcpip.NICID{opt.Upstream}, opt.Downstream...) {
+			if _, err := p.protocol.stack.GetNetworkEndpoint(id, ProtocolNumber); err != nil {
+				return err
+			}
+		}
+		for _, id := range opt.Downstream {
+			if id == opt.Upstream {
+				return tcpip.ErrInvalidOptionValue
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stopLocked()
+	if opt.Upstream == 0 {
+		return nil
+	}
+
+	p.upstream = opt.Upstream
+	p.downstream = make(map[tcpip.NICID]*mldProxyDownstream)
+	p.joined = make(map[tcpip.Address]struct{})
+	for _, id := range opt.Downstream {
+		if _, ok := p.downstream[id]; ok {
+			continue
+		}
+		d := &mldProxyDownstream{
+			nicID:          id,
+			startupQueries: mldStartupQueryCount,
+			listeners:      make(map[tcpip.Address]*mldProxyListener),
+		}
+		d.queryJob = tcpip.NewJob(p.protocol.stack.Clock(), &p.mu, func() {
+			p.sendGeneralQueryLocked(d)
+		})
+		d.queryJob.Schedule(0)
+		p.downstreamIDs = append(p.downstreamIDs, id)
+		p.downstream[id] = d
+	}
+	return nil
+}
+
+// option returns the configuration of the proxy.
+func (p *mldProxy) option() tcpip.MulticastProxyOption {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return tcpip.MulticastProxyOption{
+		Upstream:   p.upstream,
+		Downstream: append([]tcpip.NICID(nil), p.downstreamIDs...),
+	}
+}
+
+// enabled returns true if the proxy is enabled.
+func (p *mldProxy) enabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.upstream != 0
+}
+
+// stopLocked stops the proxy, forgetting the downstream listeners and leaving
+// the groups joined on their behalf.
+//
+// Precondition: p.mu must be locked.
+func (p *mldProxy) stopLocked() {
+	for _, d := range p.downstream {
+		d.queryJob.Cancel()
+		for _, l := range d.listeners {
+			l.expiryJob.Cancel()
+		}
+	}
+	for groupAddress := range p.joined {
+		_ = p.protocol.stack.LeaveGroup(ProtocolNumber, p.upstream, groupAddress)
+	}
+	p.upstream = 0
+	p.downstreamIDs = nil
+	p.downstream = nil
+	p.joined = nil
+}
+
+// isDownstream returns true if nicID is a downstream NIC of the proxy.
+func (p *mldProxy) isDownstream(nicID tcpip.NICID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.downstream[nicID]
+	return ok
+}
+
+// handleReport records that a host on nicID listens to groupAddress.
+func (p *mldProxy) handleReport(nicID tcpip.NICID, groupAddress tcpip.Address) {
+	// Packets sent to groups of link-local scope are never forwarded, so
+	// there is no point in proxying their memberships.
+	if !header.IsV6MulticastAddress(groupAddress) || header.V6MulticastScope(groupAddress) <= header.LinkLocalMulticastScope {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, ok := p.downstream[nicID]
+	if !ok {
+		return
+	}
+	l, ok := d.listeners[groupAddress]
+	if !ok {
+		l = &mldProxyListener{}
+		l.expiryJob = tcpip.NewJob(p.protocol.stack.Clock(), &p.mu, func() {
+			p.expireListenerLocked(d, groupAddress, l)
+		})
+		d.listeners[groupAddress] = l
+		p.updateUpstreamLocked(groupAddress)
+	}
+	l.lastListenerQueries = 0
+	l.expiryJob.Cancel()
+	l.expiryJob.Schedule(mldListenerInterval)
+}
+
+// handleDone handles a host on nicID ceasing to listen to groupAddress. As per
+// RFC 2710 section 4, the group is queried for other listeners before it is
+// forgotten.
+func (p *mldProxy) handleDone(nicID tcpip.NICID, groupAddress tcpip.Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, ok := p.downstream[nicID]
+	if !ok {
+		return
+	}
+	l, ok := d.listeners[groupAddress]
+	if !ok || l.lastListenerQueries != 0 {
+		return
+	}
+	l.lastListenerQueries = mldLastListenerQueryCount - 1
+	l.expiryJob.Cancel()
+	l.expiryJob.Schedule(mldLastListenerQueryInterval)
+	p.sendQueryLocked(d.nicID, groupAddress, mldLastListenerQueryInterval)
+}
+
+// handleV2Report handles the records of an MLDv2 Report received on nicID.
+// Source filters aren't proxied: a group is listened to if any source of it
+// is.
+func (p *mldProxy) handleV2Report(nicID tcpip.NICID, records []header.GroupRecord) {
+	for _, r := range records {
+		switch r.Type {
+		case header.GroupRecordModeIsExclude, header.GroupRecordChangeToExcludeMode, header.GroupRecordAllowNewSources:
+			p.handleReport(nicID, r.MulticastAddress)
+		case header.GroupRecordModeIsInclude, header.GroupRecordChangeToIncludeMode:
+			if len(r.Sources) == 0 {
+				p.handleDone(nicID, r.MulticastAddress)
+			} else {
+				p.handleReport(nicID, r.MulticastAddress)
+			}
+		}
+	}
+}
+
+// expireListenerLocked sends the next Multicast-Address-Specific Query for
+// groupAddress on d, or forgets its listeners if none is left to send.
+//
+// Precondition: p.mu must be locked.
+func (p *mldProxy) expireListenerLocked(d *mldProxyDownstream, groupAddress tcpip.Address, l *mldProxyListener) {
+	if p.downstream[d.nicID] != d || d.listeners[groupAddress] != l {
+		return
+	}
+	if l.lastListenerQueries != 0 {
+		l.lastListenerQueries--
+		l.expiryJob.Schedule(mldLastListenerQueryInterval)
+		p.sendQueryLocked(d.nicID, groupAddress, mldLastListenerQueryInterval)
+		return
+	}
+	delete(d.listeners, groupAddress)
+	p.updateUpstreamLocked(groupAddress)
+}
+
+// updateUpstreamLocked joins groupAddress on the upstream NIC if it has
+// listeners on any downstream NIC, and leaves it otherwise.
+//
+// Precondition: p.mu must be locked.
+func (p *mldProxy) updateUpstreamLocked(groupAddress tcpip.Address) {
+	listened := false
+	for _, d := range p.downstream {
+		if _, ok := d.listeners[groupAddress]; ok {
+			listened = true
+			break
+		}
+	}
+
+	_, joined := p.joined[groupAddress]
+	switch {
+	case listened && !joined:
+		if err := p.protocol.stack.JoinGroup(ProtocolNumber, p.upstream, groupAddress); err != nil {
+			return
+		}
+		p.joined[groupAddress] = struct{}{}
+	case !listened && joined:
+		_ = p.protocol.stack.LeaveGroup(ProtocolNumber, p.upstream, groupAddress)
+		delete(p.joined, groupAddress)
+	}
+}
+
+// sendGeneralQueryLocked sends a General Query on d and schedules the next one.
+//
+// Precondition: p.mu must be locked.
+func (p *mldProxy) sendGeneralQueryLocked(d *mldProxyDownstream) {
+	p.sendQueryLocked(d.nicID, header.IPv6Any, mldQueryResponseInterval)
+	interval := mldQueryInterval
+	if d.startupQueries != 0 {
+		d.startupQueries--
+		if d.startupQueries != 0 {
+			interval = mldStartupQueryInterval
+		}
+	}
+	d.queryJob.Schedule(interval)
+}
+
+// sendQueryLocked sends a query for groupAddress on nicID.
+//
+// Precondition: p.mu must be locked.
+func (p *mldProxy) sendQueryLocked(nicID tcpip.NICID, groupAddress tcpip.Address, maxRespDelay time.Duration) {
+	ep, err := p.protocol.stack.GetNetworkEndpoint(nicID, ProtocolNumber)
+	if err != nil {
+		return
+	}
+	e := ep.(*endpoint)
+	if !e.Enabled() {
+		return
+	}
+	_ = e.mld.writeQuery(groupAddress, maxRespDelay)
+}
+
+// outputs returns the NICs a multicast packet sent to groupAddress and received
+// on inputNIC is forwarded out of, as per RFC 4605 section 4.2, and false if
+// inputNIC isn't a NIC of the proxy.
+func (p *mldProxy) outputs(inputNIC tcpip.NICID, groupAddress tcpip.Address) ([]stack.MulticastOutput, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.upstream == 0 {
+		return nil, false
+	}
+	_, fromDownstream := p.downstream[inputNIC]
+	if inputNIC != p.upstream && !fromDownstream {
+		return nil, false
+	}
+
+	var outputs []stack.MulticastOutput
+	if fromDownstream {
+		outputs = append(outputs, stack.MulticastOutput{NIC: p.upstream})
+	}
+	for _, id := range p.downstreamIDs {
+		if id == inputNIC {
+			continue
+		}
+		if _, ok := p.downstream[id].listeners[groupAddress]; ok {
+			outputs = append(outputs, stack.MulticastOutput{NIC: id})
+		}
+	}
+	return outputs, true
+}
+
+// isMLDMessage returns true if pkt holds an MLD message, possibly following a
+// Hop-by-Hop Options header carrying the Router Alert option.
+func isMLDMessage(pkt *stack.PacketBuffer) bool {
+	h := header.IPv6(pkt.NetworkHeader().View())
+	vv := pkt.NetworkHeader().View()[header.IPv6MinimumSize:].ToVectorisedView()
+	vv.AppendView(pkt.TransportHeader().View())
+	vv.Append(pkt.Data)
+	it := header.MakeIPv6PayloadIterator(header.IPv6ExtensionHeaderIdentifier(h.NextHeader()), vv)
+	for {
+		extHdr, done, err := it.Next()
+		if err != nil || done {
+			return false
+		}
+
+		switch extHdr := extHdr.(type) {
+		case header.IPv6HopByHopOptionsExtHdr:
+		case header.IPv6RawPayloadHeader:
+			if tcpip.TransportProtocolNumber(extHdr.Identifier) != header.ICMPv6ProtocolNumber {
+				return false
+			}
+			v := extHdr.Buf.ToView()
+			if len(v) < header.ICMPv6HeaderSize {
+				return false
+			}
+			switch header.ICMPv6(v).Type() {
+			case header.ICMPv6MulticastListenerQuery, header.ICMPv6MulticastListenerReport, header.ICMPv6MulticastListenerDone, header.ICMPv6MulticastListenerV2Report:
+				return true
+			default:
+				return false
+			}
+		default:
+			return false
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sort"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -110,6 +111,12 @@ const (
 	// SHOULD be more.
 	MaxDiscoveredDefaultRouters = 10
 
+	// sourceSpecificDefaultRouteRank is added to the rank of the
+	// source-specific default routes installed for discovered default
+	// routers, so that the packets from a prefix a router advertised are
+	// routed through that router first, as per RFC 8028 section 3.
+	sourceSpecificDefaultRouteRank = 10
+
 	// MaxDiscoveredOnLinkPrefixes is the maximum number of discovered
 	// on-link prefixes. The stack should stop discovering new on-link
 	// prefixes after discovering MaxDiscoveredOnLinkPrefixes on-link
@@ -198,6 +205,9 @@ var (
 
 // NDPEndpoint is an endpoint that supports NDP.
 type NDPEndpoint interface {
+	// NDPConfigurations returns the NDP configurations.
+	NDPConfigurations() NDPConfigurations
+
 	// SetNDPConfigurations sets the NDP configurations.
 	SetNDPConfigurations(NDPConfigurations)
 }
@@ -365,6 +375,19 @@ type NDPConfigurations struct {
 	// configuration is ignored if HandleRAs is false.
 	DiscoverDefaultRouters bool
 
+	// InstallDefaultRoutes determines whether or not routes through the
+	// discovered default routers are installed in the stack, as learned
+	// routes. This configuration is ignored if DiscoverDefaultRouters is
+	// false.
+	//
+	// Each router gets a default route scoped to the NIC it was discovered
+	// on, which is looked up by order of router preference (RFC 4191), and
+	// source-specific default routes for the SLAAC prefixes it advertised
+	// (RFC 8028), which are looked up first. The routes are removed when the
+	// router lifetime expires or when Neighbor Unreachability Detection
+	// fails for the router.
+	InstallDefaultRoutes bool
+
 	// DiscoverOnLinkPrefixes determines whether or not on-link prefixes are
 	// discovered from Router Advertisements' Prefix Information option, as per
 	// RFC 4861 section 6. This configuration is ignored if HandleRAs is false.
@@ -407,6 +430,15 @@ type NDPConfigurations struct {
 	// RegenAdvanceDuration is the duration before the deprecation of a temporary
 	// address when a new address will be generated.
 	RegenAdvanceDuration time.Duration
+
+	// The number of unsolicited Neighbor Advertisement messages to send for
+	// an address once it is assigned, after Duplicate Address Detection, or
+	// when its link address changes, as per RFC 4861 section 7.2.6. The
+	// messages are RetransmitTimer apart.
+	//
+	// Note, a value of zero disables unsolicited Neighbor Advertisements, like
+	// the ndisc_notify sysctl of Linux.
+	UnsolicitedNAs uint8
 }
 
 // DefaultNDPConfigurations returns an NDPConfigurations populated with
@@ -468,6 +500,9 @@ type ndpState struct {
 	// The DAD state to send the next NS message, or resolve the address.
 	dad map[tcpip.Address]dadState
 
+	// The jobs used to send the next unsolicited NA message for addresses.
+	announcements map[tcpip.Address]*tcpip.Job
+
 	// The default routers discovered through Router Advertisements.
 	defaultRouters map[tcpip.Address]defaultRouterState
 
@@ -514,6 +549,14 @@ type defaultRouterState struct {
 	//
 	// Must not be nil.
 	invalidationJob *tcpip.Job
+
+	// prf is the preference of the default router, as advertised by its
+	// last Router Advertisement.
+	prf header.NDPRoutePreference
+
+	// prefixes holds the SLAAC prefixes the default router advertised. Only
+	// those for which SLAAC state is still maintained are used.
+	prefixes map[tcpip.Subnet]struct{}
 }
 
 // onLinkPrefixState holds data associated with an on-link prefix discovered by
@@ -643,6 +686,7 @@ func (ndp *ndpState) startDuplicateAddressDetection(addr tcpip.Address, addressE
 			ndpDisp.OnDuplicateAddressDetectionStatus(ndp.ep.nic.ID(), addr, true, nil)
 		}
 
+		ndp.startAnnouncing(addr)
 		return nil
 	}
 
@@ -693,6 +737,10 @@ func (ndp *ndpState) startDuplicateAddressDetection(addr tcpip.Address, addressE
 				// of a new address for the SLAAC prefix.
 				ndp.regenerateTempSLAACAddr(addressEndpoint.AddressWithPrefix().Subnet(), true /* resetGenAttempts */)
 			}
+
+			if dadDone {
+				ndp.startAnnouncing(addr)
+			}
 		}),
 	}
 
@@ -725,10 +773,12 @@ func (ndp *ndpState) sendDADPacket(addr tcpip.Address, addressEndpoint stack.Add
 	})
 
 	sent := ndp.ep.protocol.stack.Stats().ICMP.V6.PacketsSent
-	ndp.ep.addIPHeader(header.IPv6Any, snmc, pkt, stack.NetworkHeaderParams{
+	if err := ndp.ep.addIPHeader(header.IPv6Any, snmc, pkt, stack.NetworkHeaderParams{
 		Protocol: header.ICMPv6ProtocolNumber,
 		TTL:      header.NDPHopLimit,
-	})
+	}); err != nil {
+		panic(fmt.Sprintf("failed to add IP header: %s", err))
+	}
 
 	if err := ndp.ep.nic.WritePacketToRemote(header.EthernetAddressFromMulticastIPv6Address(snmc), nil /* gso */, ProtocolNumber, pkt); err != nil {
 		sent.Dropped.Increment()
@@ -762,6 +812,82 @@ func (ndp *ndpState) stopDuplicateAddressDetection(addr tcpip.Address) {
 	}
 }
 
+// startAnnouncing starts sending unsolicited Neighbor Advertisements for addr,
+// an assigned address, as per RFC 4861 section 7.2.6, so that neighbors
+// promptly learn its link address. Any ongoing announcement of addr is
+// restarted.
+//
+// The IPv6 endpoint that ndp belongs to MUST be locked.
+func (ndp *ndpState) startAnnouncing(addr tcpip.Address) {
+	ndp.stopAnnouncing(addr)
+
+	remaining := ndp.configs.UnsolicitedNAs
+	if remaining == 0 || !header.IsV6UnicastAddress(addr) {
+		return
+	}
+
+	var job *tcpip.Job
+	job = ndp.ep.protocol.stack.NewJob(&ndp.ep.mu, func() {
+		remaining--
+		if err := ndp.sendUnsolicitedNA(addr); err != nil || remaining == 0 {
+			delete(ndp.announcements, addr)
+			return
+		}
+		job.Schedule(ndp.configs.RetransmitTimer)
+	})
+	ndp.announcements[addr] = job
+	job.Schedule(0)
+}
+
+// stopAnnouncing stops sending unsolicited Neighbor Advertisements for addr.
+//
+// The IPv6 endpoint that ndp belongs to MUST be locked.
+func (ndp *ndpState) stopAnnouncing(addr tcpip.Address) {
+	if job, ok := ndp.announcements[addr]; ok {
+		job.Cancel()
+		delete(ndp.announcements, addr)
+	}
+}
+
+// sendUnsolicitedNA sends an unsolicited NA message for addr to all nodes on
+// ndp's NIC's link.
+func (ndp *ndpState) sendUnsolicitedNA(addr tcpip.Address) *tcpip.Error {
+	optsSerializer := header.NDPOptionsSerializer{
+		header.NDPTargetLinkLayerAddressOption(ndp.ep.nic.LinkAddress()),
+	}
+	icmp := header.ICMPv6(buffer.NewView(header.ICMPv6NeighborAdvertMinimumSize + optsSerializer.Length()))
+	icmp.SetType(header.ICMPv6NeighborAdvert)
+	na := header.NDPNeighborAdvert(icmp.MessageBody())
+
+	// As per RFC 4861 section 7.2.6, the Solicited flag of unsolicited NAs is
+	// zero, and their Override flag is set to update the caches of neighbors.
+	na.SetRouterFlag(ndp.ep.protocol.Forwarding())
+	na.SetOverrideFlag(true)
+	na.SetTargetAddress(addr)
+	na.Options().Serialize(optsSerializer)
+	icmp.SetChecksum(header.ICMPv6Checksum(icmp, addr, header.IPv6AllNodesMulticastAddress, buffer.VectorisedView{}))
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(ndp.ep.MaxHeaderLength()),
+		Data:               buffer.View(icmp).ToVectorisedView(),
+	})
+
+	sent := ndp.ep.protocol.stack.Stats().ICMP.V6.PacketsSent
+	if err := ndp.ep.addIPHeader(addr, header.IPv6AllNodesMulticastAddress, pkt, stack.NetworkHeaderParams{
+		Protocol: header.ICMPv6ProtocolNumber,
+		TTL:      header.NDPHopLimit,
+	}); err != nil {
+		panic(fmt.Sprintf("failed to add IP header: %s", err))
+	}
+
+	if err := ndp.ep.nic.WritePacketToRemote(header.EthernetAddressFromMulticastIPv6Address(header.IPv6AllNodesMulticastAddress), nil /* gso */, ProtocolNumber, pkt); err != nil {
+		sent.Dropped.Increment()
+		return err
+	}
+	sent.NeighborAdvert.Increment()
+	return nil
+}
+
 // handleRA handles a Router Advertisement message that arrived on the NIC
 // this ndp is for. Does nothing if the NIC is configured to not handle RAs.
 //
@@ -803,21 +929,30 @@ func (ndp *ndpState) handleRA(ip tcpip.Address, ra header.NDPRouterAdvert) {
 	if ndp.configs.DiscoverDefaultRouters {
 		rtr, ok := ndp.defaultRouters[ip]
 		rl := ra.RouterLifetime()
+		prf := ra.DefaultRouterPreference()
 		switch {
 		case !ok && rl != 0:
 			// This is a new default router we are discovering.
 			//
 			// Only remember it if we currently know about less than
-			// MaxDiscoveredDefaultRouters routers.
+			// MaxDiscoveredDefaultRouters routers, or if it is preferred to
+			// the least preferred of them, which it replaces as per RFC 4191
+			// section 3.2.
+			if len(ndp.defaultRouters) >= MaxDiscoveredDefaultRouters {
+				if worst, ok := ndp.leastPreferredDefaultRouter(); ok && ndp.defaultRouters[worst].prf.Rank() < prf.Rank() {
+					ndp.invalidateDefaultRouter(worst)
+				}
+			}
 			if len(ndp.defaultRouters) < MaxDiscoveredDefaultRouters {
-				ndp.rememberDefaultRouter(ip, rl)
+				ndp.rememberDefaultRouter(ip, rl, prf)
 			}
 
 		case ok && rl != 0:
 			// This is an already discovered default router. Update
-			// the invalidation job.
+			// the invalidation job and its preference.
 			rtr.invalidationJob.Cancel()
 			rtr.invalidationJob.Schedule(rl)
+			rtr.prf = prf
 			ndp.defaultRouters[ip] = rtr
 
 		case ok && rl == 0:
@@ -875,11 +1010,91 @@ func (ndp *ndpState) handleRA(ip tcpip.Address, ra header.NDPRouterAdvert) {
 
 			if opt.AutonomousAddressConfigurationFlag() {
 				ndp.handleAutonomousPrefixInformation(opt)
+
+				if rtr, ok := ndp.defaultRouters[ip]; ok {
+					if rtr.prefixes == nil {
+						rtr.prefixes = make(map[tcpip.Subnet]struct{})
+						ndp.defaultRouters[ip] = rtr
+					}
+					rtr.prefixes[prefix] = struct{}{}
+				}
 			}
 		}
 
 		// TODO(b/141556115): Do (MTU) Parameter Discovery.
 	}
+
+	ndp.updateDefaultRoutes()
+}
+
+// leastPreferredDefaultRouter returns the discovered default router with the
+// lowest preference, if any.
+//
+// The IPv6 endpoint that ndp belongs to MUST be locked.
+func (ndp *ndpState) leastPreferredDefaultRouter() (tcpip.Address, bool) {
+	var worst tcpip.Address
+	found := false
+	for ip, rtr := range ndp.defaultRouters {
+		if found {
+			// Break ties deterministically.
+			if r, w := rtr.prf.Rank(), ndp.defaultRouters[worst].prf.Rank(); r > w || (r == w && ip < worst) {
+				continue
+			}
+		}
+		worst, found = ip, true
+	}
+	return worst, found
+}
+
+// updateDefaultRoutes sets the learned routes of the NIC to the routes through
+// the discovered default routers, if the NIC is configured to install them.
+//
+// The IPv6 endpoint that ndp belongs to MUST be locked.
+func (ndp *ndpState) updateDefaultRoutes() {
+	nicID := ndp.ep.nic.ID()
+
+	var routes []stack.LearnedRoute
+	if ndp.configs.DiscoverDefaultRouters && ndp.configs.InstallDefaultRoutes {
+		routers := make([]tcpip.Address, 0, len(ndp.defaultRouters))
+		for ip := range ndp.defaultRouters {
+			routers = append(routers, ip)
+		}
+		// Order the routers deterministically, as routes with the same rank
+		// are looked up in the order they are set.
+		sort.Slice(routers, func(i, j int) bool { return routers[i] < routers[j] })
+
+		for _, ip := range routers {
+			rtr := ndp.defaultRouters[ip]
+			prefixes := make([]tcpip.Subnet, 0, len(rtr.prefixes))
+			for prefix := range rtr.prefixes {
+				if _, ok := ndp.slaacPrefixes[prefix]; ok {
+					prefixes = append(prefixes, prefix)
+				}
+			}
+			sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].ID() < prefixes[j].ID() })
+			for _, prefix := range prefixes {
+				routes = append(routes, stack.LearnedRoute{
+					Route: tcpip.Route{
+						Destination: header.IPv6EmptySubnet,
+						Gateway:     ip,
+						NIC:         nicID,
+						Source:      prefix,
+					},
+					Rank: sourceSpecificDefaultRouteRank + rtr.prf.Rank(),
+				})
+			}
+			routes = append(routes, stack.LearnedRoute{
+				Route: tcpip.Route{
+					Destination: header.IPv6EmptySubnet,
+					Gateway:     ip,
+					NIC:         nicID,
+				},
+				Rank: rtr.prf.Rank(),
+			})
+		}
+	}
+
+	ndp.ep.protocol.stack.SetLearnedRoutes(nicID, routes)
 }
 
 // invalidateDefaultRouter invalidates a discovered default router.
@@ -896,6 +1111,7 @@ func (ndp *ndpState) invalidateDefaultRouter(ip tcpip.Address) {
 
 	rtr.invalidationJob.Cancel()
 	delete(ndp.defaultRouters, ip)
+	ndp.updateDefaultRoutes()
 
 	// Let the integrator know a discovered default router is invalidated.
 	if ndpDisp := ndp.ep.protocol.options.NDPDisp; ndpDisp != nil {
@@ -904,19 +1120,19 @@ func (ndp *ndpState) invalidateDefaultRouter(ip tcpip.Address) {
 }
 
 // rememberDefaultRouter remembers a newly discovered default router with IPv6
-// link-local address ip with lifetime rl.
+// link-local address ip with lifetime rl and preference prf.
 //
 // The router identified by ip MUST NOT already be known by the IPv6 endpoint.
 //
 // The IPv6 endpoint that ndp belongs to MUST be locked.
-func (ndp *ndpState) rememberDefaultRouter(ip tcpip.Address, rl time.Duration) {
+func (ndp *ndpState) rememberDefaultRouter(ip tcpip.Address, rl time.Duration, prf header.NDPRoutePreference) {
 	ndpDisp := ndp.ep.protocol.options.NDPDisp
-	if ndpDisp == nil {
+	if ndpDisp == nil && !ndp.configs.InstallDefaultRoutes {
 		return
 	}
 
 	// Inform the integrator when we discovered a default router.
-	if !ndpDisp.OnDefaultRouterDiscovered(ndp.ep.nic.ID(), ip) {
+	if ndpDisp != nil && !ndpDisp.OnDefaultRouterDiscovered(ndp.ep.nic.ID(), ip) {
 		// Informed by the integrator to not remember the router, do
 		// nothing further.
 		return
@@ -926,6 +1142,7 @@ func (ndp *ndpState) rememberDefaultRouter(ip tcpip.Address, rl time.Duration) {
 		invalidationJob: ndp.ep.protocol.stack.NewJob(&ndp.ep.mu, func() {
 			ndp.invalidateDefaultRouter(ip)
 		}),
+		prf: prf,
 	}
 
 	state.invalidationJob.Schedule(rl)
@@ -1118,7 +1335,7 @@ func (ndp *ndpState) doSLAAC(prefix tcpip.Subnet, pl, vl time.Duration) {
 		maxGenerationAttempts: ndp.configs.AutoGenAddressConflictRetries + 1,
 	}
 
-	now := time.Now()
+	now := ndp.ep.protocol.stack.Clock().Now()
 
 	// The time an address is preferred until is needed to properly generate the
 	// address.
@@ -1249,7 +1466,7 @@ func (ndp *ndpState) generateSLAACAddr(prefix tcpip.Subnet, state *slaacPrefixSt
 		state.stableAddr.localGenerationFailures++
 	}
 
-	if addressEndpoint := ndp.addAndAcquireSLAACAddr(generatedAddr, stack.AddressConfigSlaac, time.Since(state.preferredUntil) >= 0 /* deprecated */); addressEndpoint != nil {
+	if addressEndpoint := ndp.addAndAcquireSLAACAddr(generatedAddr, stack.AddressConfigSlaac, ndp.ep.protocol.stack.Clock().Now().Sub(state.preferredUntil) >= 0 /* deprecated */); addressEndpoint != nil {
 		state.stableAddr.addressEndpoint = addressEndpoint
 		state.generationAttempts++
 		return true
@@ -1304,7 +1521,7 @@ func (ndp *ndpState) generateTempSLAACAddr(prefix tcpip.Subnet, prefixState *sla
 	}
 
 	stableAddr := prefixState.stableAddr.addressEndpoint.AddressWithPrefix().Address
-	now := time.Now()
+	now := ndp.ep.protocol.stack.Clock().Now()
 
 	// As per RFC 4941 section 3.3 step 4, the valid lifetime of a temporary
 	// address is the lower of the valid lifetime of the stable address or the
@@ -1461,7 +1678,7 @@ func (ndp *ndpState) refreshSLAACPrefixLifetimes(prefix tcpip.Subnet, prefixStat
 	// deprecation job so it can be reset.
 	prefixState.deprecationJob.Cancel()
 
-	now := time.Now()
+	now := ndp.ep.protocol.stack.Clock().Now()
 
 	// Schedule the deprecation job if prefix has a finite preferred lifetime.
 	if pl < header.NDPInfiniteLifetime {
@@ -1498,7 +1715,7 @@ func (ndp *ndpState) refreshSLAACPrefixLifetimes(prefix tcpip.Subnet, prefixStat
 		if prefixState.validUntil == (time.Time{}) {
 			rl = header.NDPInfiniteLifetime
 		} else {
-			rl = time.Until(prefixState.validUntil)
+			rl = prefixState.validUntil.Sub(now)
 		}
 
 		if vl > MinPrefixInformationValidLifetimeForUpdate || vl > rl {
@@ -1675,6 +1892,10 @@ func (ndp *ndpState) cleanupSLAACPrefixResources(prefix tcpip.Subnet, state slaa
 	state.deprecationJob.Cancel()
 	state.invalidationJob.Cancel()
 	delete(ndp.slaacPrefixes, prefix)
+
+	// Source-specific default routes are only installed for the prefixes
+	// SLAAC state is maintained for.
+	ndp.updateDefaultRoutes()
 }
 
 // invalidateTempSLAACAddr invalidates a temporary SLAAC address.
@@ -1847,10 +2068,12 @@ func (ndp *ndpState) startSolicitingRouters() {
 		})
 
 		sent := ndp.ep.protocol.stack.Stats().ICMP.V6.PacketsSent
-		ndp.ep.addIPHeader(localAddr, header.IPv6AllRoutersMulticastAddress, pkt, stack.NetworkHeaderParams{
+		if err := ndp.ep.addIPHeader(localAddr, header.IPv6AllRoutersMulticastAddress, pkt, stack.NetworkHeaderParams{
 			Protocol: header.ICMPv6ProtocolNumber,
 			TTL:      header.NDPHopLimit,
-		})
+		}); err != nil {
+			panic(fmt.Sprintf("failed to add IP header: %s", err))
+		}
 
 		if err := ndp.ep.nic.WritePacketToRemote(header.EthernetAddressFromMulticastIPv6Address(header.IPv6AllRoutersMulticastAddress), nil /* gso */, ProtocolNumber, pkt); err != nil {
 			sent.Dropped.Increment()
@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -1391,3 +1392,87 @@ func TestRouterAdvertValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestUnsolicitedNeighborAdvertisements(t *testing.T) {
+	const (
+		nicID           = 1
+		retransmitTimer = time.Second
+	)
+
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{NewProtocolWithOptions(Options{
+			NDPConfigs: NDPConfigurations{
+				DupAddrDetectTransmits: 1,
+				RetransmitTimer:        retransmitTimer,
+				UnsolicitedNAs:         2,
+			},
+		})},
+		Clock: clock,
+	})
+	e := channel.New(1, header.IPv6MinimumMTU, linkAddr0)
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ProtocolNumber, lladdr0); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s) = %s", nicID, ProtocolNumber, lladdr0, err)
+	}
+
+	expectNA := func() {
+		t.Helper()
+
+		p, ok := e.Read()
+		if !ok {
+			t.Fatal("expected an unsolicited NA")
+		}
+		if want := header.EthernetAddressFromMulticastIPv6Address(header.IPv6AllNodesMulticastAddress); p.Route.RemoteLinkAddress != want {
+			t.Errorf("got p.Route.RemoteLinkAddress = %s, want = %s", p.Route.RemoteLinkAddress, want)
+		}
+		checker.IPv6(t, stack.PayloadSince(p.Pkt.NetworkHeader()),
+			checker.SrcAddr(lladdr0),
+			checker.DstAddr(header.IPv6AllNodesMulticastAddress),
+			checker.TTL(header.NDPHopLimit),
+			checker.NDPNA(
+				checker.NDPNATargetAddress(lladdr0),
+				checker.NDPNASolicitedFlag(false),
+				checker.NDPNAOptions([]header.NDPOption{header.NDPTargetLinkLayerAddressOption(linkAddr0)}),
+			))
+	}
+	expectNoPacket := func() {
+		t.Helper()
+
+		if p, ok := e.Read(); ok {
+			t.Fatalf("got unexpected packet = %#v", p)
+		}
+	}
+
+	// The address is only announced once DAD resolves.
+	clock.Advance(0)
+	p, ok := e.Read()
+	if !ok {
+		t.Fatal("expected a DAD NS")
+	}
+	checker.IPv6(t, stack.PayloadSince(p.Pkt.NetworkHeader()), checker.NDPNS(checker.NDPNSTargetAddress(lladdr0)))
+	clock.Advance(retransmitTimer)
+	expectNA()
+	clock.Advance(retransmitTimer - 1)
+	expectNoPacket()
+	clock.Advance(1)
+	expectNA()
+	clock.Advance(retransmitTimer)
+	expectNoPacket()
+
+	// The address is announced again, e.g. after the link address changed.
+	if err := s.AnnounceNICAddresses(nicID); err != nil {
+		t.Fatalf("AnnounceNICAddresses(%d) = %s", nicID, err)
+	}
+	clock.Advance(0)
+	expectNA()
+
+	// Removed addresses are no longer announced.
+	if err := s.RemoveAddress(nicID, lladdr0); err != nil {
+		t.Fatalf("RemoveAddress(%d, %s) = %s", nicID, lladdr0, err)
+	}
+	clock.Advance(retransmitTimer)
+	expectNoPacket()
+}
@@ -16,22 +16,29 @@
 package ports
 
 import (
+	"encoding/binary"
 	"math"
-	"math/rand"
+	mathrand "math/rand"
 	"sync/atomic"
 
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/hash/jenkins"
 )
 
 const (
-	// FirstEphemeral is the first ephemeral port.
+	// FirstEphemeral is the default first ephemeral port.
 	FirstEphemeral = 16000
 
-	// numEphemeralPorts it the mnumber of available ephemeral ports to
-	// Netstack.
+	// numEphemeralPorts it the default number of available ephemeral ports
+	// to Netstack.
 	numEphemeralPorts = math.MaxUint16 - FirstEphemeral + 1
 
+	// ephemeralHintBits is log2 of the number of hints used to pick ports
+	// in a stable order (see PickEphemeralPortStable).
+	ephemeralHintBits = 8
+
 	anyIPAddress tcpip.Address = ""
 )
 
@@ -86,12 +93,40 @@ type PortManager struct {
 	mu             sync.RWMutex
 	allocatedPorts map[portDescriptor]bindAddresses
 
-	// hint is used to pick ports ephemeral ports in a stable order for
-	// a given port offset.
+	// ephemeralRange holds the first and last ephemeral ports, packed as
+	// first<<16 | last. Ports are picked while mu may or may not be held,
+	// so the range is accessed atomically instead.
+	ephemeralRange uint32
+
+	// localReserved holds the *portSet of ports that are never picked as
+	// ephemeral ports. The set is never modified once stored.
+	localReserved atomic.Value
+
+	// hintSeed keys the hash that picks the hint used for a connection
+	// (G() in RFC 6056). It is independent of the seed of the port offset
+	// hash (F()), so that connections which share a hint don't also share
+	// an offset.
+	hintSeed uint32
+
+	// hints are used to pick ephemeral ports in a stable order for a given
+	// connection. Each hint is shared by all connections that hash to it.
 	//
-	// hint must be accessed using the portHint/incPortHint helpers.
+	// hints must be accessed atomically.
 	// TODO(gvisor.dev/issue/940): S/R this field.
-	hint uint32
+	hints [1 << ephemeralHintBits]uint32
+}
+
+// portSet is a set of ports.
+type portSet [(math.MaxUint16 + 1) / 64]uint64
+
+// contains returns true if port is in the set.
+func (s *portSet) contains(port uint16) bool {
+	return s[port/64]&(1<<(port%64)) != 0
+}
+
+// add adds port to the set.
+func (s *portSet) add(port uint16) {
+	s[port/64] |= 1 << (port % 64)
 }
 
 // BitFlags is a bitset representation of Flags.
@@ -147,6 +182,13 @@ func (c *FlagCounter) DropRef(flags BitFlags) {
 	c.refs[flags]--
 }
 
+// subtract decreases the reference counts of c by those of o.
+func (c *FlagCounter) subtract(o FlagCounter) {
+	for i, r := range o.refs {
+		c.refs[i] -= r
+	}
+}
+
 // TotalRefs calculates the total number of references for all flag
 // combinations.
 func (c FlagCounter) TotalRefs() int {
@@ -203,7 +245,53 @@ func makeDestination(a tcpip.FullAddress) destination {
 
 // portNode is never empty. When it has no elements, it is removed from the
 // map that references it.
-type portNode map[destination]FlagCounter
+//
+// Besides the reference counts of each destination, it keeps their sums, so
+// that checking whether a destination can be reserved doesn't require
+// visiting all other destinations.
+type portNode struct {
+	// dests holds the reference counts of each destination.
+	dests map[destination]FlagCounter
+
+	// all is the sum of the reference counts of all destinations.
+	all FlagCounter
+
+	// wildcard is the sum of the reference counts of destinations with the
+	// wildcard address.
+	wildcard FlagCounter
+}
+
+func newPortNode() *portNode {
+	return &portNode{dests: make(map[destination]FlagCounter)}
+}
+
+// addRef adds a reference with the given flags to dst.
+func (p *portNode) addRef(dst destination, flags BitFlags) {
+	n := p.dests[dst]
+	n.AddRef(flags)
+	p.dests[dst] = n
+	p.all.AddRef(flags)
+	if dst.addr == anyIPAddress {
+		p.wildcard.AddRef(flags)
+	}
+}
+
+// dropRef drops a reference with the given flags from dst, which must have
+// one. It returns true if p became empty.
+func (p *portNode) dropRef(dst destination, flags BitFlags) bool {
+	n := p.dests[dst]
+	n.DropRef(flags)
+	if n.TotalRefs() > 0 {
+		p.dests[dst] = n
+	} else {
+		delete(p.dests, dst)
+	}
+	p.all.DropRef(flags)
+	if dst.addr == anyIPAddress {
+		p.wildcard.DropRef(flags)
+	}
+	return len(p.dests) == 0
+}
 
 // intersectionRefs calculates the intersection of flag bit values which affect
 // the specified destination.
@@ -213,30 +301,24 @@ type portNode map[destination]FlagCounter
 //
 // In addition to the intersection, the number of intersecting refs is
 // returned.
-func (p portNode) intersectionRefs(dst destination) (BitFlags, int) {
-	intersection := FlagMask
-	var count int
-
-	for d, f := range p {
-		if d == dst {
-			intersection &= f.IntersectionRefs()
-			count++
-			continue
-		}
-		// Wildcard destinations affect all destinations for TupleOnly.
-		if d.addr == anyIPAddress || dst.addr == anyIPAddress {
-			// Only bitwise and the TupleOnlyFlag.
-			intersection &= ((^TupleOnlyFlag) | f.IntersectionRefs())
-			count++
-		}
+func (p *portNode) intersectionRefs(dst destination) (BitFlags, int) {
+	exact := p.dests[dst]
+
+	// Wildcard destinations affect all destinations for TupleOnly.
+	others := p.wildcard
+	if dst.addr == anyIPAddress {
+		others = p.all
+		others.subtract(exact)
 	}
 
-	return intersection, count
+	// Only bitwise and the TupleOnlyFlag for other destinations.
+	intersection := exact.IntersectionRefs() & ((^TupleOnlyFlag) | others.IntersectionRefs())
+	return intersection, exact.TotalRefs() + others.TotalRefs()
 }
 
 // deviceNode is never empty. When it has no elements, it is removed from the
 // map that references it.
-type deviceNode map[tcpip.NICID]portNode
+type deviceNode map[tcpip.NICID]*portNode
 
 // isAvailable checks whether binding is possible by device. If not binding to a
 // device, check against all FlagCounters. If binding to a specific device, check
@@ -322,7 +404,57 @@ func (b bindAddresses) isAvailable(addr tcpip.Address, flags Flags, bindToDevice
 
 // NewPortManager creates new PortManager.
 func NewPortManager() *PortManager {
-	return &PortManager{allocatedPorts: make(map[portDescriptor]bindAddresses)}
+	s := &PortManager{
+		allocatedPorts: make(map[portDescriptor]bindAddresses),
+		hintSeed:       generateRandUint32(),
+	}
+	s.storePortRange(FirstEphemeral, math.MaxUint16)
+	s.localReserved.Store(&portSet{})
+	return s
+}
+
+// PortRange returns the first and last ports of the ephemeral port range.
+func (s *PortManager) PortRange() (uint16, uint16) {
+	r := atomic.LoadUint32(&s.ephemeralRange)
+	return uint16(r >> 16), uint16(r)
+}
+
+// SetPortRange sets the ephemeral port range to [start, end]. It is the
+// equivalent of Linux's net.ipv4.ip_local_port_range sysctl.
+func (s *PortManager) SetPortRange(start, end uint16) *tcpip.Error {
+	if start == 0 || start > end {
+		return tcpip.ErrInvalidOptionValue
+	}
+	s.storePortRange(start, end)
+	return nil
+}
+
+func (s *PortManager) storePortRange(start, end uint16) {
+	atomic.StoreUint32(&s.ephemeralRange, uint32(start)<<16|uint32(end))
+}
+
+// LocalReservedPorts returns, in increasing order, the ports that are never
+// picked as ephemeral ports.
+func (s *PortManager) LocalReservedPorts() []uint16 {
+	set := s.localReserved.Load().(*portSet)
+	var ports []uint16
+	for p := 0; p <= math.MaxUint16; p++ {
+		if set.contains(uint16(p)) {
+			ports = append(ports, uint16(p))
+		}
+	}
+	return ports
+}
+
+// SetLocalReservedPorts sets the ports that are never picked as ephemeral
+// ports. They can still be reserved explicitly. It is the equivalent of
+// Linux's net.ipv4.ip_local_reserved_ports sysctl.
+func (s *PortManager) SetLocalReservedPorts(ports []uint16) {
+	set := &portSet{}
+	for _, p := range ports {
+		set.add(p)
+	}
+	s.localReserved.Store(set)
 }
 
 // PickEphemeralPort randomly chooses a starting point and iterates over all
@@ -330,51 +462,63 @@ func NewPortManager() *PortManager {
 // is suitable for its needs, and stopping when a port is found or an error
 // occurs.
 func (s *PortManager) PickEphemeralPort(testPort func(p uint16) (bool, *tcpip.Error)) (port uint16, err *tcpip.Error) {
-	offset := uint32(rand.Int31n(numEphemeralPorts))
-	return s.pickEphemeralPort(offset, numEphemeralPorts, testPort)
-}
-
-// portHint atomically reads and returns the s.hint value.
-func (s *PortManager) portHint() uint32 {
-	return atomic.LoadUint32(&s.hint)
+	port, _, err = s.pickEphemeralPort(mathrand.Uint32(), testPort)
+	return port, err
 }
 
-// incPortHint atomically increments s.hint by 1.
-func (s *PortManager) incPortHint() {
-	atomic.AddUint32(&s.hint, 1)
-}
-
-// PickEphemeralPortStable starts at the specified offset + s.portHint and
-// iterates over all ephemeral ports, allowing the caller to decide whether a
-// given port is suitable for its needs and stopping when a port is found or an
-// error occurs.
-func (s *PortManager) PickEphemeralPortStable(offset uint32, testPort func(p uint16) (bool, *tcpip.Error)) (port uint16, err *tcpip.Error) {
-	p, err := s.pickEphemeralPort(s.portHint()+offset, numEphemeralPorts, testPort)
+// PickEphemeralPortStable starts at the specified offset, perturbed by a hint
+// picked by hashing id, and iterates over all ephemeral ports, allowing the
+// caller to decide whether a given port is suitable for its needs and stopping
+// when a port is found or an error occurs.
+//
+// This is the Double-Hash Port Selection Algorithm of RFC 6056 section 3.3.4:
+// the offset is meant to be a keyed hash of the connection's local address and
+// remote address and port, so that connections to different destinations are
+// assigned ports independently, and id is meant to hold those same fields.
+// The hint ensures that consecutive connections to the same destination don't
+// try the same ports over again.
+func (s *PortManager) PickEphemeralPortStable(offset uint32, id []byte, testPort func(p uint16) (bool, *tcpip.Error)) (port uint16, err *tcpip.Error) {
+	hint := &s.hints[s.hintIndex(id)]
+	port, tries, err := s.pickEphemeralPort(offset+atomic.LoadUint32(hint), testPort)
 	if err == nil {
-		s.incPortHint()
+		atomic.AddUint32(hint, tries)
 	}
-	return p, err
+	return port, err
+}
 
+// hintIndex returns the index of the hint used for connections identified by
+// id.
+func (s *PortManager) hintIndex(id []byte) uint32 {
+	h := jenkins.Sum32(s.hintSeed)
+	h.Write(id)
+	return h.Sum32() >> (32 - ephemeralHintBits)
 }
 
-// pickEphemeralPort starts at the offset specified from the FirstEphemeral port
-// and iterates over the number of ports specified by count and allows the
-// caller to decide whether a given port is suitable for its needs, and stopping
-// when a port is found or an error occurs.
-func (s *PortManager) pickEphemeralPort(offset, count uint32, testPort func(p uint16) (bool, *tcpip.Error)) (port uint16, err *tcpip.Error) {
+// pickEphemeralPort starts at the offset specified from the first ephemeral
+// port and iterates over all ephemeral ports that are not reserved, allowing
+// the caller to decide whether a given port is suitable for its needs, and
+// stopping when a port is found or an error occurs. It also returns the number
+// of ports that were iterated over.
+func (s *PortManager) pickEphemeralPort(offset uint32, testPort func(p uint16) (bool, *tcpip.Error)) (port uint16, tries uint32, err *tcpip.Error) {
+	first, last := s.PortRange()
+	count := uint32(last) - uint32(first) + 1
+	reserved := s.localReserved.Load().(*portSet)
 	for i := uint32(0); i < count; i++ {
-		port = uint16(FirstEphemeral + (offset+i)%count)
+		port = uint16(uint32(first) + (offset+i)%count)
+		if reserved.contains(port) {
+			continue
+		}
 		ok, err := testPort(port)
 		if err != nil {
-			return 0, err
+			return 0, i + 1, err
 		}
 
 		if ok {
-			return port, nil
+			return port, i + 1, nil
 		}
 	}
 
-	return 0, tcpip.ErrNoPortAvailable
+	return 0, count, tcpip.ErrNoPortAvailable
 }
 
 // IsPortAvailable tests if the given port is available on all given protocols.
@@ -459,12 +603,10 @@ func (s *PortManager) reserveSpecificPort(networks []tcpip.NetworkProtocolNumber
 		}
 		p := d[bindToDevice]
 		if p == nil {
-			p = make(portNode)
+			p = newPortNode()
+			d[bindToDevice] = p
 		}
-		n := p[dst]
-		n.AddRef(flagBits)
-		p[dst] = n
-		d[bindToDevice] = p
+		p.addRef(dst, flagBits)
 	}
 
 	return true
@@ -497,17 +639,15 @@ func (s *PortManager) ReserveTuple(networks []tcpip.NetworkProtocolNumber, trans
 		}
 		p := d[bindToDevice]
 		if p == nil {
-			p = make(portNode)
+			p = newPortNode()
+			d[bindToDevice] = p
 		}
 
-		n := p[dst]
-		if n.TotalRefs() != 0 && n.IntersectionRefs()&flagBits == 0 {
+		if n := p.dests[dst]; n.TotalRefs() != 0 && n.IntersectionRefs()&flagBits == 0 {
 			// Tuple already exists.
 			undo = true
 		}
-		n.AddRef(flagBits)
-		p[dst] = n
-		d[bindToDevice] = p
+		p.addRef(dst, flagBits)
 	}
 
 	if undo {
@@ -542,17 +682,10 @@ func (s *PortManager) releasePortLocked(networks []tcpip.NetworkProtocolNumber,
 			if !ok {
 				continue
 			}
-			n, ok := p[dst]
-			if !ok {
-				continue
-			}
-			n.DropRef(flags)
-			if n.TotalRefs() > 0 {
-				p[dst] = n
+			if _, ok := p.dests[dst]; !ok {
 				continue
 			}
-			delete(p, dst)
-			if len(p) > 0 {
+			if !p.dropRef(dst, flags) {
 				continue
 			}
 			delete(d, bindToDevice)
@@ -567,3 +700,11 @@ func (s *PortManager) releasePortLocked(networks []tcpip.NetworkProtocolNumber,
 		}
 	}
 }
+
+func generateRandUint32() uint32 {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint32(b)
+}
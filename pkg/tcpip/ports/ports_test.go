@@ -15,7 +15,10 @@
 package ports
 
 import (
+	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -442,9 +445,142 @@ func TestPickEphemeralPortStable(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			pm := NewPortManager()
 			portOffset := uint32(rand.Int31n(int32(numEphemeralPorts)))
-			if port, err := pm.PickEphemeralPortStable(portOffset, test.f); port != test.wantPort || err != test.wantErr {
+			if port, err := pm.PickEphemeralPortStable(portOffset, nil /* id */, test.f); port != test.wantPort || err != test.wantErr {
 				t.Errorf("PickEphemeralPort(..) = (port %d, err %v); want (port %d, err %v)", port, err, test.wantPort, test.wantErr)
 			}
 		})
 	}
 }
+
+func TestPickEphemeralPortStableHint(t *testing.T) {
+	pm := NewPortManager()
+	accept := func(port uint16) (bool, *tcpip.Error) {
+		return true, nil
+	}
+
+	// Consecutive picks for the same connection must not return the same
+	// port over again.
+	const offset = 42
+	id := []byte("connection")
+	first, err := pm.PickEphemeralPortStable(offset, id, accept)
+	if err != nil {
+		t.Fatalf("PickEphemeralPortStable(%d, %q, _) = (_, %s)", offset, id, err)
+	}
+	second, err := pm.PickEphemeralPortStable(offset, id, accept)
+	if err != nil {
+		t.Fatalf("PickEphemeralPortStable(%d, %q, _) = (_, %s)", offset, id, err)
+	}
+	if second != first+1 {
+		t.Errorf("got second port %d, want %d", second, first+1)
+	}
+
+	// The hint is picked from id alone, so a connection that hashes to a
+	// different hint is unaffected even if it uses the same offset.
+	var otherID []byte
+	for i := 0; otherID == nil; i++ {
+		if b := []byte(fmt.Sprintf("other connection %d", i)); pm.hintIndex(b) != pm.hintIndex(id) {
+			otherID = b
+		}
+	}
+	if port, err := pm.PickEphemeralPortStable(offset, otherID, accept); err != nil || port != first {
+		t.Errorf("PickEphemeralPortStable(%d, %q, _) = (%d, %v), want (%d, nil)", offset, otherID, port, err, first)
+	}
+
+	// A port found after skipping others advances the hint past all of them.
+	skip := func(port uint16) (bool, *tcpip.Error) {
+		return port >= second+10, nil
+	}
+	if port, err := pm.PickEphemeralPortStable(offset, id, skip); err != nil || port != second+10 {
+		t.Errorf("PickEphemeralPortStable(%d, %q, _) = (%d, %v), want (%d, nil)", offset, id, port, err, second+10)
+	}
+	if port, err := pm.PickEphemeralPortStable(offset, id, accept); err != nil || port != second+11 {
+		t.Errorf("PickEphemeralPortStable(%d, %q, _) = (%d, %v), want (%d, nil)", offset, id, port, err, second+11)
+	}
+}
+
+func TestHintIndexKeyed(t *testing.T) {
+	// Port managers use independent hint seeds, so the same connection
+	// must not map to the same hint in all of them.
+	id := []byte("connection")
+	want := NewPortManager().hintIndex(id)
+	for i := 0; i < 100; i++ {
+		if NewPortManager().hintIndex(id) != want {
+			return
+		}
+	}
+	t.Errorf("hintIndex(%q) = %d for all port managers", id, want)
+}
+
+func TestPortRange(t *testing.T) {
+	pm := NewPortManager()
+	if start, end := pm.PortRange(); start != FirstEphemeral || end != math.MaxUint16 {
+		t.Errorf("got pm.PortRange() = (%d, %d), want (%d, %d)", start, end, FirstEphemeral, math.MaxUint16)
+	}
+
+	for _, test := range []struct {
+		start, end uint16
+		wantErr    *tcpip.Error
+	}{
+		{start: 0, end: 100, wantErr: tcpip.ErrInvalidOptionValue},
+		{start: 200, end: 100, wantErr: tcpip.ErrInvalidOptionValue},
+		{start: 100, end: 100},
+		{start: 1000, end: 1010},
+	} {
+		before, beforeEnd := pm.PortRange()
+		err := pm.SetPortRange(test.start, test.end)
+		if err != test.wantErr {
+			t.Errorf("pm.SetPortRange(%d, %d) = %v, want %v", test.start, test.end, err, test.wantErr)
+		}
+		wantStart, wantEnd := test.start, test.end
+		if err != nil {
+			wantStart, wantEnd = before, beforeEnd
+		}
+		if start, end := pm.PortRange(); start != wantStart || end != wantEnd {
+			t.Errorf("got pm.PortRange() = (%d, %d), want (%d, %d)", start, end, wantStart, wantEnd)
+		}
+	}
+
+	// Only ports in the range are picked.
+	seen := make(map[uint16]struct{})
+	if _, err := pm.PickEphemeralPort(func(port uint16) (bool, *tcpip.Error) {
+		seen[port] = struct{}{}
+		return false, nil
+	}); err != tcpip.ErrNoPortAvailable {
+		t.Fatalf("PickEphemeralPort(_) = (_, %v), want (_, %s)", err, tcpip.ErrNoPortAvailable)
+	}
+	if len(seen) != 11 {
+		t.Errorf("got %d ports tested, want 11", len(seen))
+	}
+	for port := range seen {
+		if port < 1000 || port > 1010 {
+			t.Errorf("port %d outside of range [1000, 1010] was tested", port)
+		}
+	}
+}
+
+func TestLocalReservedPorts(t *testing.T) {
+	pm := NewPortManager()
+	if err := pm.SetPortRange(1000, 1003); err != nil {
+		t.Fatalf("pm.SetPortRange(1000, 1003) = %s", err)
+	}
+	pm.SetLocalReservedPorts([]uint16{1002, 1000, 5000})
+	if got, want := pm.LocalReservedPorts(), []uint16{1000, 1002, 5000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got pm.LocalReservedPorts() = %v, want %v", got, want)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := pm.PickEphemeralPort(func(port uint16) (bool, *tcpip.Error) {
+			if port == 1000 || port == 1002 {
+				t.Errorf("reserved port %d was tested", port)
+			}
+			return false, nil
+		}); err != tcpip.ErrNoPortAvailable {
+			t.Fatalf("PickEphemeralPort(_) = (_, %v), want (_, %s)", err, tcpip.ErrNoPortAvailable)
+		}
+	}
+
+	// Reserved ports can still be reserved explicitly.
+	if _, err := pm.ReservePort([]tcpip.NetworkProtocolNumber{fakeNetworkNumber}, fakeTransNumber, fakeIPAddress, 1000, Flags{}, 0 /* bindToDevice */, tcpip.FullAddress{}, nil /* testPort */); err != nil {
+		t.Errorf("ReservePort(..., 1000, ...) = %s", err)
+	}
+}
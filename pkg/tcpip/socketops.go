@@ -16,6 +16,8 @@ package tcpip
 
 import (
 	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // SocketOptionsHandler holds methods that help define endpoint specific
@@ -97,6 +99,11 @@ type SocketOptions struct {
 	// non-loopback interface will be looped back. Analogous to inet->mc_loop.
 	multicastLoopEnabled uint32
 
+	// multicastAllEnabled determines whether multicast packets are delivered
+	// for groups joined by any socket on the host, or only for groups joined
+	// by this socket. Analogous to inet->mc_all.
+	multicastAllEnabled uint32
+
 	// receiveTOSEnabled is used to specify if the TOS ancillary message is
 	// passed with incoming packets.
 	receiveTOSEnabled uint32
@@ -105,6 +112,22 @@ type SocketOptions struct {
 	// message is passed with incoming packets.
 	receiveTClassEnabled uint32
 
+	// receiveIPOptionsEnabled is used to specify if the IP_RECVOPTS
+	// ancillary message is passed with incoming packets.
+	receiveIPOptionsEnabled uint32
+
+	// receiveTTLEnabled is used to specify if the IP_TTL ancillary message
+	// is passed with incoming packets.
+	receiveTTLEnabled uint32
+
+	// receiveHopLimitEnabled is used to specify if the IPV6_HOPLIMIT
+	// ancillary message is passed with incoming packets.
+	receiveHopLimitEnabled uint32
+
+	// receivePathMTUEnabled is used to specify if the IPV6_PATHMTU
+	// ancillary message is passed when the path MTU decreases.
+	receivePathMTUEnabled uint32
+
 	// receivePacketInfoEnabled is used to specify if more inforamtion is
 	// provided with incoming packets such as interface index and address.
 	receivePacketInfoEnabled uint32
@@ -130,6 +153,43 @@ type SocketOptions struct {
 	// corkOptionEnabled is used to specify if data should be held until segments
 	// are full by the TCP transport protocol.
 	corkOptionEnabled uint32
+
+	// priority is the value of the SO_PRIORITY option, which is set on the
+	// packets sent by the endpoint.
+	priority uint32
+
+	// freeBindEnabled is used to allow binding to addresses which are not
+	// (yet) assigned to any interface.
+	freeBindEnabled uint32
+
+	// bindAddressNoPortEnabled is used to defer the allocation of an
+	// ephemeral port when binding to port 0 until the endpoint connects.
+	bindAddressNoPortEnabled uint32
+
+	// minTTL is the value of the IP_MINTTL option. IPv4 packets received
+	// with a lower TTL are dropped.
+	minTTL uint32
+
+	// minHopCount is the value of the IPV6_MINHOPCOUNT option. IPv6 packets
+	// received with a lower hop limit are dropped.
+	minHopCount uint32
+
+	// busyPoll is the value of the SO_BUSY_POLL option, the number of
+	// microseconds receive operations poll the endpoint for before
+	// blocking.
+	busyPoll uint32
+
+	// nicGroup is the group of NICs the routes of the endpoint are looked up
+	// in.
+	nicGroup uint32
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// ipv4Options holds the IPv4 options set with IP_OPTIONS, which are
+	// added to the IPv4 packets sent by the endpoint. The slice is never
+	// modified, only replaced.
+	ipv4Options []byte
 }
 
 // InitHandler initializes the handler. This must be called before using the
@@ -219,6 +279,16 @@ func (so *SocketOptions) SetMulticastLoop(v bool) {
 	storeAtomicBool(&so.multicastLoopEnabled, v)
 }
 
+// GetMulticastAll gets value for IP_MULTICAST_ALL option.
+func (so *SocketOptions) GetMulticastAll() bool {
+	return atomic.LoadUint32(&so.multicastAllEnabled) != 0
+}
+
+// SetMulticastAll sets value for IP_MULTICAST_ALL option.
+func (so *SocketOptions) SetMulticastAll(v bool) {
+	storeAtomicBool(&so.multicastAllEnabled, v)
+}
+
 // GetReceiveTOS gets value for IP_RECVTOS option.
 func (so *SocketOptions) GetReceiveTOS() bool {
 	return atomic.LoadUint32(&so.receiveTOSEnabled) != 0
@@ -239,6 +309,46 @@ func (so *SocketOptions) SetReceiveTClass(v bool) {
 	storeAtomicBool(&so.receiveTClassEnabled, v)
 }
 
+// GetReceiveIPOptions gets value for IP_RECVOPTS option.
+func (so *SocketOptions) GetReceiveIPOptions() bool {
+	return atomic.LoadUint32(&so.receiveIPOptionsEnabled) != 0
+}
+
+// SetReceiveIPOptions sets value for IP_RECVOPTS option.
+func (so *SocketOptions) SetReceiveIPOptions(v bool) {
+	storeAtomicBool(&so.receiveIPOptionsEnabled, v)
+}
+
+// GetReceiveTTL gets value for IP_RECVTTL option.
+func (so *SocketOptions) GetReceiveTTL() bool {
+	return atomic.LoadUint32(&so.receiveTTLEnabled) != 0
+}
+
+// SetReceiveTTL sets value for IP_RECVTTL option.
+func (so *SocketOptions) SetReceiveTTL(v bool) {
+	storeAtomicBool(&so.receiveTTLEnabled, v)
+}
+
+// GetReceiveHopLimit gets value for IPV6_RECVHOPLIMIT option.
+func (so *SocketOptions) GetReceiveHopLimit() bool {
+	return atomic.LoadUint32(&so.receiveHopLimitEnabled) != 0
+}
+
+// SetReceiveHopLimit sets value for IPV6_RECVHOPLIMIT option.
+func (so *SocketOptions) SetReceiveHopLimit(v bool) {
+	storeAtomicBool(&so.receiveHopLimitEnabled, v)
+}
+
+// GetReceivePathMTU gets value for IPV6_RECVPATHMTU option.
+func (so *SocketOptions) GetReceivePathMTU() bool {
+	return atomic.LoadUint32(&so.receivePathMTUEnabled) != 0
+}
+
+// SetReceivePathMTU sets value for IPV6_RECVPATHMTU option.
+func (so *SocketOptions) SetReceivePathMTU(v bool) {
+	storeAtomicBool(&so.receivePathMTUEnabled, v)
+}
+
 // GetReceivePacketInfo gets value for IP_PKTINFO option.
 func (so *SocketOptions) GetReceivePacketInfo() bool {
 	return atomic.LoadUint32(&so.receivePacketInfoEnabled) != 0
@@ -302,3 +412,96 @@ func (so *SocketOptions) SetCorkOption(v bool) {
 	storeAtomicBool(&so.corkOptionEnabled, v)
 	so.handler.OnCorkOptionSet(v)
 }
+
+// GetPriority gets value for SO_PRIORITY option.
+func (so *SocketOptions) GetPriority() uint32 {
+	return atomic.LoadUint32(&so.priority)
+}
+
+// SetPriority sets value for SO_PRIORITY option.
+func (so *SocketOptions) SetPriority(v uint32) {
+	atomic.StoreUint32(&so.priority, v)
+}
+
+// GetFreeBind gets value for IP_FREEBIND and IPV6_FREEBIND options.
+func (so *SocketOptions) GetFreeBind() bool {
+	return atomic.LoadUint32(&so.freeBindEnabled) != 0
+}
+
+// SetFreeBind sets value for IP_FREEBIND and IPV6_FREEBIND options.
+func (so *SocketOptions) SetFreeBind(v bool) {
+	storeAtomicBool(&so.freeBindEnabled, v)
+}
+
+// GetBindAddressNoPort gets value for IP_BIND_ADDRESS_NO_PORT option.
+func (so *SocketOptions) GetBindAddressNoPort() bool {
+	return atomic.LoadUint32(&so.bindAddressNoPortEnabled) != 0
+}
+
+// SetBindAddressNoPort sets value for IP_BIND_ADDRESS_NO_PORT option.
+func (so *SocketOptions) SetBindAddressNoPort(v bool) {
+	storeAtomicBool(&so.bindAddressNoPortEnabled, v)
+}
+
+// GetIPv4Options gets value for IP_OPTIONS option. The returned slice must not
+// be modified.
+func (so *SocketOptions) GetIPv4Options() []byte {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return so.ipv4Options
+}
+
+// SetIPv4Options sets value for IP_OPTIONS option. The options must be valid
+// IPv4 options padded to a multiple of 4 bytes; they are cleared if v is
+// empty.
+func (so *SocketOptions) SetIPv4Options(v []byte) {
+	var opts []byte
+	if len(v) != 0 {
+		opts = append([]byte(nil), v...)
+	}
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	so.ipv4Options = opts
+}
+
+// GetMinTTL gets value for IP_MINTTL option.
+func (so *SocketOptions) GetMinTTL() uint8 {
+	return uint8(atomic.LoadUint32(&so.minTTL))
+}
+
+// SetMinTTL sets value for IP_MINTTL option.
+func (so *SocketOptions) SetMinTTL(v uint8) {
+	atomic.StoreUint32(&so.minTTL, uint32(v))
+}
+
+// GetMinHopCount gets value for IPV6_MINHOPCOUNT option.
+func (so *SocketOptions) GetMinHopCount() uint8 {
+	return uint8(atomic.LoadUint32(&so.minHopCount))
+}
+
+// SetMinHopCount sets value for IPV6_MINHOPCOUNT option.
+func (so *SocketOptions) SetMinHopCount(v uint8) {
+	atomic.StoreUint32(&so.minHopCount, uint32(v))
+}
+
+// GetBusyPoll gets value for SO_BUSY_POLL option.
+func (so *SocketOptions) GetBusyPoll() uint32 {
+	return atomic.LoadUint32(&so.busyPoll)
+}
+
+// SetBusyPoll sets value for SO_BUSY_POLL option.
+func (so *SocketOptions) SetBusyPoll(v uint32) {
+	atomic.StoreUint32(&so.busyPoll, v)
+}
+
+// GetNICGroup gets the group of NICs the routes of the endpoint are looked up
+// in.
+func (so *SocketOptions) GetNICGroup() NICGroupID {
+	return NICGroupID(atomic.LoadUint32(&so.nicGroup))
+}
+
+// SetNICGroup sets the group of NICs the routes of the endpoint are looked up
+// in. Endpoints bound to a device must be in the group of the device.
+func (so *SocketOptions) SetNICGroup(v NICGroupID) {
+	atomic.StoreUint32(&so.nicGroup, uint32(v))
+}
@@ -122,6 +122,12 @@ type conn struct {
 	// lastUsed is the last time the connection saw a relevant packet, and
 	// is updated by each packet on the connection. It is protected by mu.
 	lastUsed time.Time `state:".(unixTime)"`
+	// start is the time the connection was created. It is immutable.
+	start time.Time `state:".(unixTime)"`
+	// packets and bytes count the packets seen in each direction, and the
+	// size of their network packets. They are protected by mu.
+	packets [2]uint64
+	bytes   [2]uint64
 }
 
 // timedOut returns whether the connection timed out based on its state.
@@ -140,6 +146,29 @@ func (cn *conn) timedOut(now time.Time) bool {
 	return now.Sub(cn.lastUsed) > defaultTimeout
 }
 
+// accountLocked counts pkt, which travels in direction dir.
+//
+// Precondition: cn.mu must be held.
+func (cn *conn) accountLocked(pkt *PacketBuffer, dir direction) {
+	cn.packets[dir]++
+	// Received packets still hold their link header.
+	cn.bytes[dir] += uint64(pkt.Size() - len(pkt.LinkHeader().View()))
+}
+
+// flow returns the accounting of the connection.
+func (cn *conn) flow() Flow {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	return Flow{
+		NetworkProtocol:   cn.original.netProto,
+		TransportProtocol: cn.original.transProto,
+		Original:          cn.original.flowTuple(cn.packets[dirOriginal], cn.bytes[dirOriginal]),
+		Reply:             cn.reply.flowTuple(cn.packets[dirReply], cn.bytes[dirReply]),
+		Start:             cn.start,
+		LastUsed:          cn.lastUsed,
+	}
+}
+
 // update the connection tracking state.
 //
 // Precondition: ct.mu must be held.
@@ -179,12 +208,20 @@ type ConnTrack struct {
 	// It is immutable.
 	seed uint32
 
+	// clock is used to time connections out. It is the clock of the stack
+	// using the table, and is immutable once the table is in use.
+	clock tcpip.Clock `state:"nosave"`
+
 	// mu protects the buckets slice, but not buckets' contents. Only take
 	// the write lock if you are modifying the slice or saving for S/R.
 	mu sync.RWMutex `state:"nosave"`
 
 	// buckets is protected by mu.
 	buckets []bucket
+
+	// flowExpired, if not nil, is called with the accounting of each
+	// connection removed from the table. It is protected by mu.
+	flowExpired func(Flow) `state:"nosave"`
 }
 
 // +stateify savable
@@ -220,11 +257,12 @@ func packetToTupleID(pkt *PacketBuffer) (tupleID, *tcpip.Error) {
 }
 
 // newConn creates new connection.
-func newConn(orig, reply tupleID, manip manipType, hook Hook) *conn {
+func newConn(orig, reply tupleID, manip manipType, hook Hook, now time.Time) *conn {
 	conn := conn{
 		manip:    manip,
 		tcbHook:  hook,
-		lastUsed: time.Now(),
+		lastUsed: now,
+		start:    now,
 	}
 	conn.original = tuple{conn: &conn, tupleID: orig}
 	conn.reply = tuple{conn: &conn, tupleID: reply, direction: dirReply}
@@ -246,7 +284,7 @@ func (ct *ConnTrack) connFor(pkt *PacketBuffer) (*conn, direction) {
 
 func (ct *ConnTrack) connForTID(tid tupleID) (*conn, direction) {
 	bucket := ct.bucket(tid)
-	now := time.Now()
+	now := ct.clock.Now()
 
 	ct.mu.RLock()
 	defer ct.mu.RUnlock()
@@ -291,7 +329,7 @@ func (ct *ConnTrack) insertRedirectConn(pkt *PacketBuffer, hook Hook, port uint1
 	case Output:
 		manip = manipDstOutput
 	}
-	conn := newConn(tid, replyTID, manip, hook)
+	conn := newConn(tid, replyTID, manip, hook, ct.clock.Now())
 	ct.insertConn(conn)
 	return conn
 }
@@ -351,27 +389,21 @@ func handlePacketPrerouting(pkt *PacketBuffer, conn *conn, dir direction) {
 	// For prerouting redirection, packets going in the original direction
 	// have their destinations modified and replies have their sources
 	// modified.
+	//
+	// TCP checksums aren't usually validated on inbound packets, but we
+	// update them incrementally anyway so that they remain valid when they
+	// are, e.g. when we can't offload receive checksumming.
 	switch dir {
 	case dirOriginal:
 		port := conn.reply.srcPort
-		tcpHeader.SetDestinationPort(port)
-		netHeader.SetDestinationAddress(conn.reply.srcAddr)
+		tcpHeader.SetDestinationPortWithChecksumUpdate(port)
+		tcpHeader.UpdateChecksumPseudoHeaderAddress(netHeader.DestinationAddress(), conn.reply.srcAddr, true /* fullChecksum */)
+		netHeader.SetDestinationAddressWithChecksumUpdate(conn.reply.srcAddr)
 	case dirReply:
 		port := conn.original.dstPort
-		tcpHeader.SetSourcePort(port)
-		netHeader.SetSourceAddress(conn.original.dstAddr)
-	}
-
-	// TODO(gvisor.dev/issue/170): TCP checksums aren't usually validated
-	// on inbound packets, so we don't recalculate them. However, we should
-	// support cases when they are validated, e.g. when we can't offload
-	// receive checksumming.
-
-	// After modification, IPv4 packets need a valid checksum.
-	if pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber {
-		netHeader := header.IPv4(pkt.NetworkHeader().View())
-		netHeader.SetChecksum(0)
-		netHeader.SetChecksum(^netHeader.CalculateChecksum())
+		tcpHeader.SetSourcePortWithChecksumUpdate(port)
+		tcpHeader.UpdateChecksumPseudoHeaderAddress(netHeader.SourceAddress(), conn.original.dstAddr, true /* fullChecksum */)
+		netHeader.SetSourceAddressWithChecksumUpdate(conn.original.dstAddr)
 	}
 }
 
@@ -385,35 +417,38 @@ func handlePacketOutput(pkt *PacketBuffer, conn *conn, gso *GSO, r *Route, dir d
 	netHeader := pkt.Network()
 	tcpHeader := header.TCP(pkt.TransportHeader().View())
 
+	// The TCP checksum field holds the pseudo-header checksum if GSO is to
+	// complete it, the full checksum if it was calculated in software and
+	// nothing if checksumming is offloaded.
+	partialChecksum := gso != nil && gso.NeedsCsum
+	fullChecksum := !partialChecksum && r.RequiresTXTransportChecksum()
+
 	// For output redirection, packets going in the original direction
 	// have their destinations modified and replies have their sources
 	// modified. For prerouting redirection, we only reach this point
 	// when replying, so packet sources are modified.
 	if conn.manip == manipDstOutput && dir == dirOriginal {
 		port := conn.reply.srcPort
-		tcpHeader.SetDestinationPort(port)
-		netHeader.SetDestinationAddress(conn.reply.srcAddr)
+		if fullChecksum {
+			tcpHeader.SetDestinationPortWithChecksumUpdate(port)
+		} else {
+			tcpHeader.SetDestinationPort(port)
+		}
+		if partialChecksum || fullChecksum {
+			tcpHeader.UpdateChecksumPseudoHeaderAddress(netHeader.DestinationAddress(), conn.reply.srcAddr, fullChecksum)
+		}
+		netHeader.SetDestinationAddressWithChecksumUpdate(conn.reply.srcAddr)
 	} else {
 		port := conn.original.dstPort
-		tcpHeader.SetSourcePort(port)
-		netHeader.SetSourceAddress(conn.original.dstAddr)
-	}
-
-	// Calculate the TCP checksum and set it.
-	tcpHeader.SetChecksum(0)
-	length := uint16(len(tcpHeader) + pkt.Data.Size())
-	xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, netHeader.SourceAddress(), netHeader.DestinationAddress(), length)
-	if gso != nil && gso.NeedsCsum {
-		tcpHeader.SetChecksum(xsum)
-	} else if r.RequiresTXTransportChecksum() {
-		xsum = header.ChecksumVV(pkt.Data, xsum)
-		tcpHeader.SetChecksum(^tcpHeader.CalculateChecksum(xsum))
-	}
-
-	if pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber {
-		netHeader := header.IPv4(pkt.NetworkHeader().View())
-		netHeader.SetChecksum(0)
-		netHeader.SetChecksum(^netHeader.CalculateChecksum())
+		if fullChecksum {
+			tcpHeader.SetSourcePortWithChecksumUpdate(port)
+		} else {
+			tcpHeader.SetSourcePort(port)
+		}
+		if partialChecksum || fullChecksum {
+			tcpHeader.UpdateChecksumPseudoHeaderAddress(netHeader.SourceAddress(), conn.original.dstAddr, fullChecksum)
+		}
+		netHeader.SetSourceAddressWithChecksumUpdate(conn.original.dstAddr)
 	}
 }
 
@@ -460,7 +495,8 @@ func (ct *ConnTrack) handlePacket(pkt *PacketBuffer, hook Hook, gso *GSO, r *Rou
 	defer conn.mu.Unlock()
 
 	// Mark the connection as having been used recently so it isn't reaped.
-	conn.lastUsed = time.Now()
+	conn.lastUsed = ct.clock.Now()
+	conn.accountLocked(pkt, dir)
 	// Update connection state.
 	conn.updateLocked(header.TCP(pkt.TransportHeader().View()), hook)
 
@@ -492,7 +528,8 @@ func (ct *ConnTrack) maybeInsertNoop(pkt *PacketBuffer, hook Hook) {
 	if err != nil {
 		return
 	}
-	conn := newConn(tid, tid.reply(), manipNone, hook)
+	conn := newConn(tid, tid.reply(), manipNone, hook, ct.clock.Now())
+	conn.accountLocked(pkt, dirOriginal)
 	conn.updateLocked(header.TCP(pkt.TransportHeader().View()), hook)
 	ct.insertConn(conn)
 }
@@ -540,7 +577,7 @@ func (ct *ConnTrack) reapUnused(start int, prevInterval time.Duration) (int, tim
 	const minInterval = 10 * time.Millisecond
 	const maxInterval = maxFullTraversal / fractionPerReaping
 
-	now := time.Now()
+	now := ct.clock.Now()
 	checked := 0
 	expired := 0
 	var idx int
@@ -614,9 +651,55 @@ func (ct *ConnTrack) reapTupleLocked(tuple *tuple, bucket int, now time.Time) bo
 		ct.buckets[replyBucket].mu.Unlock()
 	}
 
+	if ct.flowExpired != nil {
+		ct.flowExpired(tuple.conn.flow())
+	}
+
 	return true
 }
 
+// flows returns the accounting of all the connections in the table.
+func (ct *ConnTrack) flows() []Flow {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	var flows []Flow
+	for i := range ct.buckets {
+		ct.buckets[i].mu.Lock()
+		for tuple := ct.buckets[i].tuples.Front(); tuple != nil; tuple = tuple.Next() {
+			// Report each connection once.
+			if tuple.direction == dirOriginal {
+				flows = append(flows, tuple.conn.flow())
+			}
+		}
+		ct.buckets[i].mu.Unlock()
+	}
+	return flows
+}
+
+// flush removes all the connections from the table and returns how many were
+// removed. Their accounting is reported as if they had expired.
+func (ct *ConnTrack) flush() int {
+	// Take the write lock so that no connection is inserted or reaped while
+	// only one of its tuples is removed. The buckets need not be locked.
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	n := 0
+	for i := range ct.buckets {
+		for tuple := ct.buckets[i].tuples.Front(); tuple != nil; {
+			next := tuple.Next()
+			ct.buckets[i].tuples.Remove(tuple)
+			if tuple.direction == dirOriginal {
+				n++
+				if ct.flowExpired != nil {
+					ct.flowExpired(tuple.conn.flow())
+				}
+			}
+			tuple = next
+		}
+	}
+	return n
+}
+
 func (ct *ConnTrack) originalDst(epID TransportEndpointID, netProto tcpip.NetworkProtocolNumber) (tcpip.Address, uint16, *tcpip.Error) {
 	// Lookup the connection. The reply's original destination
 	// describes the original address.
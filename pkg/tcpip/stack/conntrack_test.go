@@ -0,0 +1,82 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// TestFlushConnections verifies that flushing the connection table removes
+// both tuples of each connection, and reports the connections as expired.
+func TestFlushConnections(t *testing.T) {
+	it := DefaultTables()
+	it.connections.buckets = make([]bucket, numBuckets)
+	var expired []Flow
+	it.connections.flowExpired = func(f Flow) {
+		expired = append(expired, f)
+	}
+
+	now := time.Unix(1, 0)
+	orig := tupleID{
+		srcAddr:    "\x0a\x00\x00\x01",
+		srcPort:    1000,
+		dstAddr:    "\x0a\x00\x00\x02",
+		dstPort:    80,
+		transProto: header.TCPProtocolNumber,
+		netProto:   header.IPv4ProtocolNumber,
+	}
+	plain := newConn(orig, orig.reply(), manipNone, Output, now)
+
+	orig.srcPort = 1001
+	reply := orig.reply()
+	reply.srcAddr = "\x0a\x00\x00\x03"
+	reply.srcPort = 8080
+	redirected := newConn(orig, reply, manipDstOutput, Output, now)
+
+	var want []Flow
+	for _, conn := range []*conn{plain, redirected} {
+		it.connections.insertConn(conn)
+		want = append(want, conn.flow())
+	}
+
+	if got := it.FlushConnections(); got != len(want) {
+		t.Errorf("got it.FlushConnections() = %d, want = %d", got, len(want))
+	}
+	for i := range it.connections.buckets {
+		if tuple := it.connections.buckets[i].tuples.Front(); tuple != nil {
+			t.Errorf("got tuple %+v in bucket %d after flushing, want none", tuple.tupleID, i)
+		}
+	}
+	sortFlows := cmpopts.SortSlices(func(a, b Flow) bool {
+		return a.Original.SrcPort < b.Original.SrcPort
+	})
+	if diff := cmp.Diff(want, expired, sortFlows); diff != "" {
+		t.Errorf("expired flows mismatch (-want +got):\n%s", diff)
+	}
+
+	// Flushing an empty table removes nothing.
+	expired = nil
+	if got := it.FlushConnections(); got != 0 {
+		t.Errorf("got it.FlushConnections() = %d on an empty table, want = 0", got)
+	}
+	if len(expired) != 0 {
+		t.Errorf("got expired flows %+v on an empty table, want none", expired)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// EventLogSize is the number of events kept by the event log of a
+	// stack. Older events are overwritten by newer ones.
+	EventLogSize = 256
+
+	// eventLimit is the number of events of each kind which may be logged
+	// per second, once eventBurst events of that kind have been logged.
+	eventLimit = 1
+
+	// eventBurst is the number of events of each kind which may be logged
+	// in a single burst.
+	eventBurst = 10
+)
+
+// EventKind is the kind of an anomaly recorded in the event log of a stack.
+type EventKind int
+
+const (
+	// EventChecksumError is recorded when a packet with a bad checksum is
+	// received.
+	EventChecksumError EventKind = iota
+
+	// EventResetStorm is recorded when TCP resets are received at a rate
+	// suggesting an attack or a misbehaving peer.
+	EventResetStorm
+
+	// EventSynFlood is recorded when a listening TCP endpoint receives
+	// more SYNs than it can hold connections for, or SYN cookies start
+	// being used.
+	EventSynFlood
+
+	// EventMartian is recorded when a packet with a source address which
+	// can't be received on its NIC is dropped.
+	EventMartian
+
+	numEventKinds
+)
+
+// String implements fmt.Stringer.
+func (k EventKind) String() string {
+	switch k {
+	case EventChecksumError:
+		return "checksum-error"
+	case EventResetStorm:
+		return "reset-storm"
+	case EventSynFlood:
+		return "syn-flood"
+	case EventMartian:
+		return "martian"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// Event is an anomaly recorded in the event log of a stack.
+type Event struct {
+	// Time is the time at which the event was recorded, as given by the
+	// clock of the stack.
+	Time time.Time
+
+	// Kind is the kind of the event.
+	Kind EventKind
+
+	// NICID is the NIC the offending packet was received on, if known.
+	NICID tcpip.NICID
+
+	// Protocol is the number of the protocol which recorded the event, a
+	// network or transport protocol depending on the layer it was detected
+	// at.
+	Protocol uint32
+
+	// Source is the source address and port of the offending packet.
+	Source tcpip.FullAddress
+
+	// Detail describes the event.
+	Detail string
+
+	// Suppressed is the number of events of the same kind which were not
+	// logged since the previous one, because of rate limiting.
+	Suppressed uint64
+}
+
+// String implements fmt.Stringer.
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s nic=%d proto=%d src=%s", e.Time.Format(time.RFC3339Nano), e.Kind, e.NICID, e.Protocol, e.Source.Addr)
+	if e.Source.Port != 0 {
+		s += fmt.Sprintf(":%d", e.Source.Port)
+	}
+	if e.Detail != "" {
+		s += " " + e.Detail
+	}
+	if e.Suppressed != 0 {
+		s += fmt.Sprintf(" (%d suppressed)", e.Suppressed)
+	}
+	return s
+}
+
+// eventLog is a bounded log of anomalies detected by a stack, which leaves a
+// trace of transient anomalies without capturing packets. Events of each kind
+// are rate limited, so that a flood of offending packets doesn't evict the
+// events of other kinds or cost more than counting them.
+type eventLog struct {
+	mu sync.Mutex
+
+	// events is a ring buffer of the logged events. next is the index at
+	// which the next event is logged, and full is true once the buffer has
+	// wrapped around.
+	events [EventLogSize]Event
+	next   int
+	full   bool
+
+	// limiters rate limits the events of each kind, and suppressed counts
+	// the events of each kind dropped since the last one logged.
+	limiters   [numEventKinds]*rate.Limiter
+	suppressed [numEventKinds]uint64
+}
+
+func (l *eventLog) init() {
+	for i := range l.limiters {
+		l.limiters[i] = rate.NewLimiter(eventLimit, eventBurst)
+	}
+}
+
+// record logs e, unless events of its kind are rate limited.
+func (l *eventLog) record(e Event) {
+	if e.Kind < 0 || e.Kind >= numEventKinds {
+		panic(fmt.Sprintf("unknown event kind %d", e.Kind))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.limiters[e.Kind].AllowN(e.Time, 1) {
+		l.suppressed[e.Kind]++
+		return
+	}
+	e.Suppressed = l.suppressed[e.Kind]
+	l.suppressed[e.Kind] = 0
+	l.events[l.next] = e
+	l.next++
+	if l.next == len(l.events) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// list returns the logged events, from the oldest to the newest.
+func (l *eventLog) list() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Event(nil), l.events[:l.next]...)
+	}
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+// clear removes all the logged events.
+func (l *eventLog) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = [EventLogSize]Event{}
+	l.next = 0
+	l.full = false
+	l.suppressed = [numEventKinds]uint64{}
+}
+
+// RecordEvent records an anomaly in the event log of the stack. The time of the
+// event is set by the stack. Events of each kind are rate limited: those
+// exceeding the limit are only counted, and reported by the next event of the
+// same kind which is logged.
+func (s *Stack) RecordEvent(e Event) {
+	e.Time = s.clock.Now()
+	s.events.record(e)
+}
+
+// Events returns the events in the event log of the stack, from the oldest to
+// the newest. At most EventLogSize events are kept.
+func (s *Stack) Events() []Event {
+	return s.events.list()
+}
+
+// ClearEvents removes all the events from the event log of the stack.
+func (s *Stack) ClearEvents() {
+	s.events.clear()
+}
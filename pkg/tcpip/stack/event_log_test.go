@@ -0,0 +1,82 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+)
+
+func TestEventLogRateLimit(t *testing.T) {
+	clock := faketime.NewManualClock()
+	s := New(Options{Clock: clock})
+
+	// The events of a kind beyond the burst are suppressed, without
+	// affecting the events of other kinds.
+	for i := 0; i < eventBurst+5; i++ {
+		s.RecordEvent(Event{Kind: EventChecksumError, Source: tcpip.FullAddress{Addr: "\x0a\x00\x00\x01"}})
+	}
+	s.RecordEvent(Event{Kind: EventMartian})
+
+	events := s.Events()
+	if got, want := len(events), eventBurst+1; got != want {
+		t.Fatalf("got len(s.Events()) = %d, want = %d", got, want)
+	}
+	if got := events[len(events)-1].Kind; got != EventMartian {
+		t.Errorf("got last event kind = %s, want = %s", got, EventMartian)
+	}
+
+	// The next event logged reports the suppressed ones.
+	clock.Advance(time.Second)
+	s.RecordEvent(Event{Kind: EventChecksumError})
+	events = s.Events()
+	last := events[len(events)-1]
+	if last.Kind != EventChecksumError || last.Suppressed != 5 {
+		t.Errorf("got last event = %+v, want kind = %s and 5 suppressed", last, EventChecksumError)
+	}
+	if got, want := last.Time, clock.Now(); !got.Equal(want) {
+		t.Errorf("got last event time = %s, want = %s", got, want)
+	}
+
+	s.ClearEvents()
+	if got := len(s.Events()); got != 0 {
+		t.Errorf("got len(s.Events()) = %d after ClearEvents, want = 0", got)
+	}
+}
+
+func TestEventLogWrap(t *testing.T) {
+	clock := faketime.NewManualClock()
+	s := New(Options{Clock: clock})
+
+	const n = EventLogSize + 10
+	for i := 0; i < n; i++ {
+		s.RecordEvent(Event{Kind: EventSynFlood, Source: tcpip.FullAddress{Port: uint16(i)}})
+		clock.Advance(time.Second)
+	}
+
+	events := s.Events()
+	if got, want := len(events), EventLogSize; got != want {
+		t.Fatalf("got len(s.Events()) = %d, want = %d", got, want)
+	}
+	// Only the newest events are kept, from the oldest to the newest.
+	for i, e := range events {
+		if got, want := e.Source.Port, uint16(n-EventLogSize+i); got != want {
+			t.Errorf("got events[%d].Source.Port = %d, want = %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// Flow is the accounting of a connection tracked by iptables.
+type Flow struct {
+	NetworkProtocol   tcpip.NetworkProtocolNumber
+	TransportProtocol tcpip.TransportProtocolNumber
+
+	// Original describes the packets sent by the initiator of the
+	// connection, and Reply the packets sent in response. Their addresses
+	// differ when the connection is NATed.
+	Original FlowTuple
+	Reply    FlowTuple
+
+	// Start is the time the connection was first seen, and LastUsed the
+	// time its last packet was seen.
+	Start    time.Time
+	LastUsed time.Time
+}
+
+// FlowTuple describes the packets of a connection sent in one direction.
+type FlowTuple struct {
+	SrcAddr tcpip.Address
+	SrcPort uint16
+	DstAddr tcpip.Address
+	DstPort uint16
+
+	// Packets is the number of packets seen, and Bytes their total size,
+	// including their network header.
+	Packets uint64
+	Bytes   uint64
+}
+
+// flowTuple returns a FlowTuple for the tuple with the given counters.
+func (ti tupleID) flowTuple(packets, bytes uint64) FlowTuple {
+	return FlowTuple{
+		SrcAddr: ti.srcAddr,
+		SrcPort: ti.srcPort,
+		DstAddr: ti.dstAddr,
+		DstPort: ti.dstPort,
+		Packets: packets,
+		Bytes:   bytes,
+	}
+}
+
+// EnableFlowAccounting tracks and accounts connections, even when no rules are
+// set. Like connection tracking, it only supports TCP.
+//
+// If expired is not nil, it is called with the final accounting of each
+// connection when it is removed from the connection table. It must not block
+// nor call into it.
+func (it *IPTables) EnableFlowAccounting(expired func(Flow)) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.startConnTrackLocked()
+	it.accounting = true
+
+	it.connections.mu.Lock()
+	it.connections.flowExpired = expired
+	it.connections.mu.Unlock()
+}
+
+// DisableFlowAccounting stops tracking connections for their accounting only.
+// Connections tracked for NAT are still accounted, but no longer reported when
+// they expire.
+func (it *IPTables) DisableFlowAccounting() {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.accounting = false
+
+	it.connections.mu.Lock()
+	it.connections.flowExpired = nil
+	it.connections.mu.Unlock()
+}
+
+// FlowAccountingEnabled returns whether flow accounting is enabled.
+func (it *IPTables) FlowAccountingEnabled() bool {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.accounting
+}
+
+// Flows returns the accounting of all the tracked connections.
+func (it *IPTables) Flows() []Flow {
+	// The conntrack table is initialized with it.mu locked.
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.connections.flows()
+}
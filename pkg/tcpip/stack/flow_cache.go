@@ -0,0 +1,256 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/hash/jenkins"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// flowCacheShardSize is the number of flows a shard of a flow cache holds.
+const flowCacheShardSize = 256
+
+// ForwardingFlow identifies a flow of forwarded packets.
+type ForwardingFlow struct {
+	// NICID is the NIC the packets of the flow are received on.
+	NICID tcpip.NICID
+
+	NetProto   tcpip.NetworkProtocolNumber
+	TransProto tcpip.TransportProtocolNumber
+	Src        tcpip.Address
+	Dst        tcpip.Address
+
+	// SrcPort and DstPort are the ports of TCP and UDP flows, 0 otherwise.
+	SrcPort uint16
+	DstPort uint16
+}
+
+// ForwardingFlowOf returns the flow of pkt, which was received on nicID.
+//
+// Precondition: pkt.NetworkHeader is set.
+func ForwardingFlowOf(nicID tcpip.NICID, pkt *PacketBuffer) ForwardingFlow {
+	netHeader := pkt.Network()
+	flow := ForwardingFlow{
+		NICID:      nicID,
+		NetProto:   pkt.NetworkProtocolNumber,
+		TransProto: pkt.TransportProtocolNumber,
+		Src:        netHeader.SourceAddress(),
+		Dst:        netHeader.DestinationAddress(),
+	}
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		if h := header.TCP(pkt.TransportHeader().View()); len(h) >= header.TCPMinimumSize {
+			flow.SrcPort, flow.DstPort = h.SourcePort(), h.DestinationPort()
+		}
+	case header.UDPProtocolNumber:
+		if h := header.UDP(pkt.TransportHeader().View()); len(h) >= header.UDPMinimumSize {
+			flow.SrcPort, flow.DstPort = h.SourcePort(), h.DestinationPort()
+		}
+	}
+	return flow
+}
+
+// flowCacheEntry is a flow and the route its packets are forwarded through.
+type flowCacheEntry struct {
+	flow ForwardingFlow
+
+	// gen is the generation of the cache the entry was added in.
+	gen uint64
+
+	// route is nil if the entry is unused.
+	route *Route
+}
+
+// flowCacheShard is a direct-mapped table of flows.
+type flowCacheShard struct {
+	mu      sync.Mutex
+	entries [flowCacheShardSize]flowCacheEntry
+}
+
+// flowCache caches the routes forwarded flows take, along with the link
+// address of their next hop while it is known to be reachable, so that the
+// packets following the first one of a flow skip route table and neighbor
+// lookups.
+//
+// Flows are spread over one shard per CPU to keep forwarding goroutines from
+// contending on a single lock.
+type flowCache struct {
+	// seed is a one-time random value used to hash flows. It is immutable.
+	seed uint32
+
+	// gen is the generation of the cache, incremented to invalidate all its
+	// entries. Accessed atomically.
+	gen uint64
+
+	shards []flowCacheShard
+}
+
+func newFlowCache() *flowCache {
+	return &flowCache{
+		seed:   generateRandUint32(),
+		shards: make([]flowCacheShard, runtime.GOMAXPROCS(0)),
+	}
+}
+
+// entry returns the shard and the entry flow maps to.
+func (c *flowCache) entry(flow ForwardingFlow) (*flowCacheShard, *flowCacheEntry) {
+	h := jenkins.Sum32(c.seed)
+	h.Write([]byte(flow.Src))
+	h.Write([]byte(flow.Dst))
+	var buf [12]byte
+	binary.LittleEndian.PutUint32(buf[0:], uint32(flow.NICID))
+	binary.LittleEndian.PutUint16(buf[4:], uint16(flow.NetProto))
+	binary.LittleEndian.PutUint16(buf[6:], uint16(flow.TransProto))
+	binary.LittleEndian.PutUint16(buf[8:], flow.SrcPort)
+	binary.LittleEndian.PutUint16(buf[10:], flow.DstPort)
+	h.Write(buf[:])
+	sum := h.Sum32()
+	shard := &c.shards[sum%uint32(len(c.shards))]
+	return shard, &shard.entries[(sum/uint32(len(c.shards)))%flowCacheShardSize]
+}
+
+// lookup returns a clone of the route the packets of flow are forwarded
+// through, or nil if flow isn't cached. The returned generation must be
+// passed to insert when flow isn't cached.
+func (c *flowCache) lookup(flow ForwardingFlow) (*Route, uint64) {
+	gen := atomic.LoadUint64(&c.gen)
+	shard, e := c.entry(flow)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if e.route == nil || e.flow != flow {
+		return nil, gen
+	}
+	if e.gen != gen || !e.route.isValidForOutgoing() {
+		e.route.Release()
+		*e = flowCacheEntry{}
+		return nil, gen
+	}
+	return e.route.Clone(), gen
+}
+
+// insert caches r as the route the packets of flow are forwarded through,
+// unless the cache was invalidated since gen was returned by lookup.
+func (c *flowCache) insert(flow ForwardingFlow, gen uint64, r *Route) {
+	r = r.Clone()
+	if r.IsResolutionRequired() {
+		if linkAddr, ok := reachableLinkAddress(r); ok {
+			r.ResolveWith(linkAddr)
+		}
+	}
+
+	shard, e := c.entry(flow)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if atomic.LoadUint64(&c.gen) != gen {
+		r.Release()
+		return
+	}
+	if e.route != nil {
+		e.route.Release()
+	}
+	*e = flowCacheEntry{
+		flow:  flow,
+		gen:   gen,
+		route: r,
+	}
+}
+
+// invalidate invalidates all the entries of the cache. Their routes are
+// released when their entries are next used.
+//
+// It doesn't take any lock, so it may be called when handling neighbor
+// events.
+func (c *flowCache) invalidate() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.gen, 1)
+}
+
+// flush invalidates all the entries of the cache and releases their routes.
+func (c *flowCache) flush() {
+	if c == nil {
+		return
+	}
+	c.invalidate()
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for j := range shard.entries {
+			if e := &shard.entries[j]; e.route != nil {
+				e.route.Release()
+				*e = flowCacheEntry{}
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// reachableLinkAddress returns the link address of the next hop of r if the
+// neighbor cache knows it to be reachable. Neighbors in other states aren't
+// cached, so that they go through Neighbor Unreachability Detection.
+func reachableLinkAddress(r *Route) (tcpip.LinkAddress, bool) {
+	neigh := r.outgoingNIC.neigh
+	if neigh == nil {
+		return "", false
+	}
+	nextAddr := r.NextHop
+	if nextAddr == "" {
+		nextAddr = r.RemoteAddress
+	}
+	entry, ok := neigh.peek(nextAddr)
+	if !ok || (entry.State != Reachable && entry.State != Static) {
+		return "", false
+	}
+	return entry.LinkAddr, true
+}
+
+// LookupForwardingFlow returns the route the packets of flow were last
+// forwarded through, or nil if it isn't cached or the forwarding flow cache is
+// disabled. The returned route must be released.
+//
+// When nil is returned, the route should be looked up and passed to
+// CacheForwardingFlow along with the returned generation.
+func (s *Stack) LookupForwardingFlow(flow ForwardingFlow) (*Route, uint64) {
+	if s.flowCache == nil {
+		return nil, 0
+	}
+	r, gen := s.flowCache.lookup(flow)
+	if r != nil {
+		s.stats.IP.ForwardingFlowCacheHits.Increment()
+	} else {
+		s.stats.IP.ForwardingFlowCacheMisses.Increment()
+	}
+	return r, gen
+}
+
+// CacheForwardingFlow caches r as the route the packets of flow are
+// forwarded through, with the generation returned by LookupForwardingFlow.
+// It doesn't take ownership of r.
+//
+// The cached route is dropped when the route table, the addresses, the NICs
+// or the neighbors of the stack change.
+func (s *Stack) CacheForwardingFlow(flow ForwardingFlow, gen uint64, r *Route) {
+	if s.flowCache == nil {
+		return
+	}
+	s.flowCache.insert(flow, gen, r)
+}
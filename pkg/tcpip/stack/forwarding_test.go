@@ -17,9 +17,11 @@ package stack
 import (
 	"encoding/binary"
 	"math"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
@@ -892,3 +894,60 @@ func TestForwardingWithFakeResolverManyResolutions(t *testing.T) {
 		})
 	}
 }
+
+func TestForwardingWithFakeResolverPendingPacketsLimit(t *testing.T) {
+	proto := &fwdTestNetworkProtocol{
+		addrResolveDelay: 500 * time.Millisecond,
+		onLinkAddressResolved: func(cache *linkAddrCache, neigh *neighborCache, addr tcpip.Address, _ tcpip.LinkAddress) {
+			// Any packets will be resolved to the link address "c".
+			cache.add(tcpip.FullAddress{NIC: 2, Addr: addr}, "c")
+		},
+	}
+	ep1, _ := fwdTestNetFactory(t, proto, false /* useNeighborCache */)
+
+	// Fill the queues of enough neighbors to reach the total bound, then
+	// queue a packet for one more neighbor.
+	const neighbors = maxPendingPackets / maxPendingPacketsPerResolution
+	inject := func(dst byte) {
+		buf := buffer.NewView(30)
+		buf[dstAddrOffset] = dst
+		ep1.InjectInbound(fwdTestNetNumber, NewPacketBuffer(PacketBufferOptions{
+			Data: buf.ToVectorisedView(),
+		}))
+	}
+	for i := 0; i < neighbors; i++ {
+		for j := 0; j < maxPendingPacketsPerResolution; j++ {
+			inject(byte(3 + i))
+		}
+	}
+	inject(byte(3 + neighbors))
+
+	stats := proto.stack.nics[2].stats.LinkResolution
+	if got, want := stats.Queued.Value(), uint64(neighbors*maxPendingPacketsPerResolution+1); got != want {
+		t.Errorf("got Queued = %d, want = %d", got, want)
+	}
+	if got := stats.DroppedQueueFull.Value(); got != 1 {
+		t.Errorf("got DroppedQueueFull = %d, want = 1", got)
+	}
+
+	// The packet for the last neighbor was queued at the expense of one of
+	// the longest queues.
+	q := &proto.stack.linkResQueue
+	q.Lock()
+	defer q.Unlock()
+	if q.count != maxPendingPackets {
+		t.Errorf("got %d queued packets, want = %d", q.count, maxPendingPackets)
+	}
+	var lens []int
+	for _, packets := range q.packets {
+		lens = append(lens, len(packets))
+	}
+	sort.Ints(lens)
+	want := []int{1, maxPendingPacketsPerResolution - 1}
+	for i := 2; i <= neighbors; i++ {
+		want = append(want, maxPendingPacketsPerResolution)
+	}
+	if diff := cmp.Diff(want, lens); diff != "" {
+		t.Errorf("queue lengths mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// SegmentGSO splits a hardware GSO packet into segments of at most gso.MSS
+// bytes of payload, as the NIC would have. It is used by link endpoints that
+// can't pass the GSO packet on as is, e.g. because it is about to be
+// encapsulated and the lower endpoint can't segment encapsulated packets.
+//
+// pkt must hold its network and transport headers but no link header. The
+// returned segments hold the same headers, with lengths, sequence numbers and
+// checksums updated, and have no GSO options. If pkt doesn't need to be
+// segmented, it is returned as the only element of the list.
+func SegmentGSO(gso *GSO, pkt *PacketBuffer) PacketBufferList {
+	var pkts PacketBufferList
+	if gso == nil || (gso.Type != GSOTCPv4 && gso.Type != GSOTCPv6) || pkt.Data.Size() <= int(gso.MSS) {
+		pkts.PushBack(pkt)
+		return pkts
+	}
+
+	netHdr := pkt.NetworkHeader().View()
+	tcpHdr := header.TCP(pkt.TransportHeader().View())
+	var srcAddr, dstAddr tcpip.Address
+	var id uint16
+	switch gso.Type {
+	case GSOTCPv4:
+		ip := header.IPv4(netHdr)
+		srcAddr, dstAddr = ip.SourceAddress(), ip.DestinationAddress()
+		id = ip.ID()
+	case GSOTCPv6:
+		ip := header.IPv6(netHdr)
+		srcAddr, dstAddr = ip.SourceAddress(), ip.DestinationAddress()
+	}
+
+	// FIN and PSH are only carried by the last segment, and CWR by the
+	// first, as in Linux. The IP header, and so the DSCP and ECN fields, is
+	// copied to all segments.
+	flags := tcpHdr.Flags()
+	seq := tcpHdr.SequenceNumber()
+
+	data := pkt.Data.Clone(nil)
+	for data.Size() > 0 {
+		n := data.Size()
+		if n > int(gso.MSS) {
+			n = int(gso.MSS)
+		}
+		payload := data.Clone(nil)
+		payload.CapLength(n)
+		data.TrimFront(n)
+
+		seg := NewPacketBuffer(PacketBufferOptions{
+			ReserveHeaderBytes: pkt.AvailableHeaderBytes() + len(netHdr) + len(tcpHdr),
+			Data:               payload,
+		})
+		seg.NetworkProtocolNumber = pkt.NetworkProtocolNumber
+		seg.TransportProtocolNumber = pkt.TransportProtocolNumber
+		seg.Hash = pkt.Hash
+		seg.Owner = pkt.Owner
+		seg.Priority = pkt.Priority
+		seg.EgressRoute = pkt.EgressRoute
+		seg.NatDone = pkt.NatDone
+
+		segFlags := flags
+		if data.Size() > 0 {
+			segFlags &^= header.TCPFlagFin | header.TCPFlagPsh
+		}
+		tcp := header.TCP(seg.TransportHeader().Push(len(tcpHdr)))
+		copy(tcp, tcpHdr)
+		tcp.SetSequenceNumber(seq)
+		tcp.SetFlags(segFlags)
+		flags &^= header.TCPFlagCwr
+		tcp.SetChecksum(0)
+		xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, srcAddr, dstAddr, uint16(len(tcp)+n))
+		xsum = header.ChecksumVV(payload, xsum)
+		tcp.SetChecksum(^tcp.CalculateChecksum(xsum))
+		seq += uint32(n)
+
+		nh := seg.NetworkHeader().Push(len(netHdr))
+		copy(nh, netHdr)
+		switch gso.Type {
+		case GSOTCPv4:
+			ip := header.IPv4(nh)
+			ip.SetTotalLength(uint16(seg.Size()))
+			ip.SetID(id)
+			ip.SetChecksum(0)
+			ip.SetChecksum(^ip.CalculateChecksum())
+			id++
+		case GSOTCPv6:
+			header.IPv6(nh).SetPayloadLength(uint16(seg.Size() - header.IPv6MinimumSize))
+		default:
+			panic(fmt.Sprintf("unknown gso type: %v", gso.Type))
+		}
+		pkts.PushBack(seg)
+	}
+	return pkts
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	gsoSrcAddr = tcpip.Address("\x0a\x00\x00\x01")
+	gsoDstAddr = tcpip.Address("\x0a\x00\x00\x02")
+)
+
+// makeTCPv4GSOPacket returns a TCP/IPv4 packet carrying payloadSize bytes.
+func makeTCPv4GSOPacket(payloadSize int, seq uint32, flags uint8) *stack.PacketBuffer {
+	payload := buffer.NewView(payloadSize)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.IPv4MinimumSize + header.TCPMinimumSize,
+		Data:               payload.ToVectorisedView(),
+	})
+	tcp := header.TCP(pkt.TransportHeader().Push(header.TCPMinimumSize))
+	tcp.Encode(&header.TCPFields{
+		SrcPort:    1234,
+		DstPort:    80,
+		SeqNum:     seq,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      flags,
+		WindowSize: 65535,
+	})
+	ip := header.IPv4(pkt.NetworkHeader().Push(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(pkt.Size()),
+		ID:          7,
+		TTL:         64,
+		Protocol:    uint8(header.TCPProtocolNumber),
+		SrcAddr:     gsoSrcAddr,
+		DstAddr:     gsoDstAddr,
+	})
+	pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+	pkt.TransportProtocolNumber = header.TCPProtocolNumber
+	return pkt
+}
+
+func TestSegmentGSO(t *testing.T) {
+	const (
+		mss = 1000
+		seq = 5000
+	)
+	gso := &stack.GSO{
+		Type:     stack.GSOTCPv4,
+		MSS:      mss,
+		L3HdrLen: header.IPv4MinimumSize,
+	}
+	pkt := makeTCPv4GSOPacket(2500, seq, header.TCPFlagAck|header.TCPFlagPsh|header.TCPFlagFin)
+	pkts := stack.SegmentGSO(gso, pkt)
+
+	want := []struct {
+		payloadSize int
+		flags       uint8
+	}{
+		{payloadSize: mss, flags: header.TCPFlagAck},
+		{payloadSize: mss, flags: header.TCPFlagAck},
+		{payloadSize: 500, flags: header.TCPFlagAck | header.TCPFlagPsh | header.TCPFlagFin},
+	}
+	if got := pkts.Len(); got != len(want) {
+		t.Fatalf("got pkts.Len() = %d, want = %d", got, len(want))
+	}
+
+	wantSeq := uint32(seq)
+	wantID := uint16(7)
+	i := 0
+	for seg := pkts.Front(); seg != nil; seg = seg.Next() {
+		w := want[i]
+		i++
+
+		ip := header.IPv4(seg.NetworkHeader().View())
+		if got, wantLen := int(ip.TotalLength()), header.IPv4MinimumSize+header.TCPMinimumSize+w.payloadSize; got != wantLen {
+			t.Errorf("segment %d: got ip.TotalLength() = %d, want = %d", i, got, wantLen)
+		}
+		if got := ip.ID(); got != wantID {
+			t.Errorf("segment %d: got ip.ID() = %d, want = %d", i, got, wantID)
+		}
+		if got := ip.CalculateChecksum(); got != 0xffff {
+			t.Errorf("segment %d: got ip.CalculateChecksum() = %#x, want = 0xffff", i, got)
+		}
+		wantID++
+
+		tcp := header.TCP(seg.TransportHeader().View())
+		if got := tcp.SequenceNumber(); got != wantSeq {
+			t.Errorf("segment %d: got tcp.SequenceNumber() = %d, want = %d", i, got, wantSeq)
+		}
+		if got := tcp.Flags(); got != w.flags {
+			t.Errorf("segment %d: got tcp.Flags() = %#x, want = %#x", i, got, w.flags)
+		}
+		if got := seg.Data.Size(); got != w.payloadSize {
+			t.Errorf("segment %d: got seg.Data.Size() = %d, want = %d", i, got, w.payloadSize)
+		}
+		xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, gsoSrcAddr, gsoDstAddr, uint16(len(tcp)+seg.Data.Size()))
+		xsum = header.ChecksumVV(seg.Data, xsum)
+		if got := tcp.CalculateChecksum(xsum); got != 0xffff {
+			t.Errorf("segment %d: got tcp.CalculateChecksum(_) = %#x, want = 0xffff", i, got)
+		}
+		if seg.GSOOptions != nil {
+			t.Errorf("segment %d: got seg.GSOOptions = %+v, want = nil", i, seg.GSOOptions)
+		}
+		wantSeq += uint32(w.payloadSize)
+	}
+}
+
+func TestSegmentGSOECN(t *testing.T) {
+	gso := &stack.GSO{
+		Type:     stack.GSOTCPv4,
+		MSS:      1000,
+		L3HdrLen: header.IPv4MinimumSize,
+	}
+	pkt := makeTCPv4GSOPacket(2500, 1, header.TCPFlagAck|header.TCPFlagCwr)
+	tos := header.MakeTOS(34 /* AF41 */, header.ECNECT0)
+	header.IPv4(pkt.NetworkHeader().View()).SetTOS(tos, 0)
+	pkts := stack.SegmentGSO(gso, pkt)
+
+	i := 0
+	for seg := pkts.Front(); seg != nil; seg = seg.Next() {
+		// Only the first segment carries CWR, so that the peer sees a
+		// single window reduction.
+		wantFlags := uint8(header.TCPFlagAck)
+		if i == 0 {
+			wantFlags |= header.TCPFlagCwr
+		}
+		if got := header.TCP(seg.TransportHeader().View()).Flags(); got != wantFlags {
+			t.Errorf("segment %d: got tcp.Flags() = %#x, want = %#x", i, got, wantFlags)
+		}
+		if got, _ := header.IPv4(seg.NetworkHeader().View()).TOS(); got != tos {
+			t.Errorf("segment %d: got ip.TOS() = %#x, want = %#x", i, got, tos)
+		}
+		i++
+	}
+	if i != 3 {
+		t.Errorf("got %d segments, want = 3", i)
+	}
+}
+
+func TestSegmentGSONotNeeded(t *testing.T) {
+	pkt := makeTCPv4GSOPacket(500, 1, header.TCPFlagAck)
+	for _, gso := range []*stack.GSO{
+		nil,
+		{Type: stack.GSOSW, MSS: 100},
+		{Type: stack.GSOTCPv4, MSS: 1000},
+	} {
+		pkts := stack.SegmentGSO(gso, pkt)
+		if got := pkts.Len(); got != 1 {
+			t.Fatalf("got SegmentGSO(%+v, _).Len() = %d, want = 1", gso, got)
+		}
+		if got := pkts.Front(); got != pkt {
+			t.Errorf("got SegmentGSO(%+v, _).Front() = %p, want = %p", gso, got, pkt)
+		}
+	}
+}
+
+func TestGSOWithEncap(t *testing.T) {
+	gso := &stack.GSO{Type: stack.GSOTCPv4, L3HdrLen: header.IPv4MinimumSize}
+	encapped := gso.WithEncap(stack.GSOEncapVLAN, 4)
+	if encapped.Encap != stack.GSOEncapVLAN || encapped.EncapHdrLen != 4 {
+		t.Errorf("got WithEncap(GSOEncapVLAN, 4) = %+v, want Encap = GSOEncapVLAN and EncapHdrLen = 4", encapped)
+	}
+	if gso.Encap != stack.GSOEncapNone || gso.EncapHdrLen != 0 {
+		t.Errorf("WithEncap modified the original GSO: %+v", gso)
+	}
+}
@@ -180,7 +180,8 @@ func DefaultTables() *IPTables {
 			Output:     []TableID{MangleID, NATID, FilterID},
 		},
 		connections: ConnTrack{
-			seed: generateRandUint32(),
+			seed:  generateRandUint32(),
+			clock: &tcpip.StdClock{},
 		},
 		reaperDone: make(chan struct{}, 1),
 	}
@@ -234,10 +235,7 @@ func (it *IPTables) ReplaceTable(id TableID, table Table, ipv6 bool) *tcpip.Erro
 	defer it.mu.Unlock()
 	// If iptables is being enabled, initialize the conntrack table and
 	// reaper.
-	if !it.modified {
-		it.connections.buckets = make([]bucket, numBuckets)
-		it.startReaper(reaperDelay)
-	}
+	it.startConnTrackLocked()
 	it.modified = true
 	if ipv6 {
 		it.v6Tables[id] = table
@@ -280,6 +278,11 @@ func (it *IPTables) Check(hook Hook, pkt *PacketBuffer, gso *GSO, r *Route, prer
 	it.mu.RLock()
 	defer it.mu.RUnlock()
 	if !it.modified {
+		// Track connections for their accounting only. Without rules,
+		// connections are never NATed.
+		if it.accounting && it.connections.handlePacket(pkt, hook, gso, r) {
+			it.connections.maybeInsertNoop(pkt, hook)
+		}
 		return true
 	}
 
@@ -357,6 +360,19 @@ func (it *IPTables) beforeSave() {
 
 // afterLoad is invoked by stateify.
 func (it *IPTables) afterLoad() {
+	it.connections.clock = &tcpip.StdClock{}
+	it.startReaper(reaperDelay)
+}
+
+// startConnTrackLocked initializes the conntrack table and starts its reaper,
+// unless it is already done.
+//
+// Precondition: it.mu must be locked for writing.
+func (it *IPTables) startConnTrackLocked() {
+	if it.connections.buckets != nil {
+		return
+	}
+	it.connections.buckets = make([]bucket, numBuckets)
 	it.startReaper(reaperDelay)
 }
 
@@ -366,16 +382,32 @@ func (it *IPTables) startReaper(interval time.Duration) {
 	go func() { // S/R-SAFE: reaperDone is signalled when iptables is saved.
 		bucket := 0
 		for {
+			elapsed := make(chan struct{})
+			timer := it.connections.clock.AfterFunc(interval, func() {
+				close(elapsed)
+			})
 			select {
 			case <-it.reaperDone:
+				timer.Stop()
 				return
-			case <-time.After(interval):
+			case <-elapsed:
 				bucket, interval = it.connections.reapUnused(bucket, interval)
 			}
 		}
 	}()
 }
 
+// stopReaper stops the goroutine reaping timed out connections, if it was
+// started.
+func (it *IPTables) stopReaper() {
+	// reaperDone is buffered, so this doesn't block if the reaper isn't
+	// running.
+	select {
+	case it.reaperDone <- struct{}{}:
+	default:
+	}
+}
+
 // CheckPackets runs pkts through the rules for hook and returns a map of packets that
 // should not go forward.
 //
@@ -491,3 +523,12 @@ func (it *IPTables) OriginalDst(epID TransportEndpointID, netProto tcpip.Network
 	}
 	return it.connections.originalDst(epID, netProto)
 }
+
+// FlushConnections removes all the tracked connections, as conntrack -F does on
+// Linux, and returns how many were removed. Packets of NATed connections are
+// matched against the NAT rules again.
+func (it *IPTables) FlushConnections() int {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.connections.flush()
+}
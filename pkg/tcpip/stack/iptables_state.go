@@ -34,6 +34,16 @@ func (cn *conn) loadLastUsed(unix unixTime) {
 	cn.lastUsed = time.Unix(unix.second, unix.nano)
 }
 
+// saveStart is invoked by stateify.
+func (cn *conn) saveStart() unixTime {
+	return unixTime{cn.start.Unix(), cn.start.UnixNano()}
+}
+
+// loadStart is invoked by stateify.
+func (cn *conn) loadStart(unix unixTime) {
+	cn.start = time.Unix(unix.second, unix.nano)
+}
+
 // beforeSave is invoked by stateify.
 func (ct *ConnTrack) beforeSave() {
 	ct.mu.Lock()
@@ -138,31 +138,17 @@ func (rt *RedirectTarget) Action(pkt *PacketBuffer, ct *ConnTrack, hook Hook, gs
 
 	// TODO(gvisor.dev/issue/170): Check Flags in RedirectTarget if
 	// we need to change dest address (for OUTPUT chain) or ports.
-	switch protocol := pkt.TransportProtocolNumber; protocol {
+	switch pkt.TransportProtocolNumber {
 	case header.UDPProtocolNumber:
 		udpHeader := header.UDP(pkt.TransportHeader().View())
-		udpHeader.SetDestinationPort(rt.Port)
 
-		// Calculate UDP checksum and set it.
+		// The UDP checksum, if any, is updated incrementally. If
+		// checksumming is offloaded, it is zero and left as is.
+		udpHeader.SetDestinationPortWithChecksumUpdate(rt.Port)
 		if hook == Output {
-			udpHeader.SetChecksum(0)
 			netHeader := pkt.Network()
-			netHeader.SetDestinationAddress(address)
-
-			// Only calculate the checksum if offloading isn't supported.
-			if r.RequiresTXTransportChecksum() {
-				length := uint16(pkt.Size()) - uint16(len(pkt.NetworkHeader().View()))
-				xsum := header.PseudoHeaderChecksum(protocol, netHeader.SourceAddress(), netHeader.DestinationAddress(), length)
-				xsum = header.ChecksumVV(pkt.Data, xsum)
-				udpHeader.SetChecksum(^udpHeader.CalculateChecksum(xsum))
-			}
-		}
-
-		// After modification, IPv4 packets need a valid checksum.
-		if pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber {
-			netHeader := header.IPv4(pkt.NetworkHeader().View())
-			netHeader.SetChecksum(0)
-			netHeader.SetChecksum(^netHeader.CalculateChecksum())
+			udpHeader.UpdateChecksumPseudoHeaderAddress(netHeader.DestinationAddress(), address)
+			netHeader.SetDestinationAddressWithChecksumUpdate(address)
 		}
 		pkt.NatDone = true
 	case header.TCPProtocolNumber:
@@ -81,7 +81,7 @@ const (
 //
 // +stateify savable
 type IPTables struct {
-	// mu protects v4Tables, v6Tables, and modified.
+	// mu protects v4Tables, v6Tables, modified and accounting.
 	mu sync.RWMutex
 	// v4Tables and v6tables map tableIDs to tables. They hold builtin
 	// tables only, not user tables. mu must be locked for accessing.
@@ -92,6 +92,10 @@ type IPTables struct {
 	// don't utilize iptables.
 	modified bool
 
+	// accounting is whether connections are tracked for their accounting
+	// even if tables have never been modified.
+	accounting bool
+
 	// priorities maps each hook to a list of table names. The order of the
 	// list is the order in which each table should be visited for that
 	// hook. It is immutable.
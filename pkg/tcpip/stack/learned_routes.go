@@ -0,0 +1,119 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// LearnedRoute is a route a network protocol learned from the network, such as
+// a default route through a router discovered with NDP.
+type LearnedRoute struct {
+	tcpip.Route
+
+	// Rank orders the learned routes: routes with a higher rank are looked up
+	// first. Routes with the same rank are looked up in order of NIC, then in
+	// the order they were set.
+	Rank int
+}
+
+// learnedRoutes holds the learned routes of the NICs of a stack. They are
+// looked up after the routes of the route table, which take precedence.
+type learnedRoutes struct {
+	// mu is a leaf lock: network endpoints set their learned routes with
+	// their own locks held, so no other lock may be acquired with mu held.
+	mu sync.Mutex
+
+	// byNIC holds the learned routes of each NIC.
+	byNIC map[tcpip.NICID][]LearnedRoute
+
+	// routes holds the learned routes of all NICs, in lookup order. It is
+	// replaced rather than modified so that it can be used after mu is
+	// released.
+	routes []tcpip.Route
+}
+
+// set replaces the learned routes of nicID with routes. It returns false if
+// they didn't change.
+func (l *learnedRoutes) set(nicID tcpip.NICID, routes []LearnedRoute) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old := l.byNIC[nicID]; len(old) == len(routes) {
+		same := true
+		for i := range old {
+			if old[i] != routes[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false
+		}
+	}
+
+	if len(routes) == 0 {
+		delete(l.byNIC, nicID)
+	} else {
+		if l.byNIC == nil {
+			l.byNIC = make(map[tcpip.NICID][]LearnedRoute)
+		}
+		l.byNIC[nicID] = append([]LearnedRoute(nil), routes...)
+	}
+
+	var all []LearnedRoute
+	for _, nicRoutes := range l.byNIC {
+		all = append(all, nicRoutes...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Rank != all[j].Rank {
+			return all[i].Rank > all[j].Rank
+		}
+		return all[i].NIC < all[j].NIC
+	})
+	l.routes = make([]tcpip.Route, 0, len(all))
+	for _, r := range all {
+		l.routes = append(l.routes, r.Route)
+	}
+	return true
+}
+
+// get returns the learned routes of all NICs, in lookup order. The returned
+// slice must not be modified.
+func (l *learnedRoutes) get() []tcpip.Route {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.routes
+}
+
+// SetLearnedRoutes replaces the routes learned on NIC nicID with routes, which
+// must all go through nicID. Learned routes are looked up after the routes of
+// the route table.
+//
+// It may be called with the locks of network endpoints held.
+func (s *Stack) SetLearnedRoutes(nicID tcpip.NICID, routes []LearnedRoute) {
+	if s.learnedRoutes.set(nicID, routes) {
+		// Invalidating doesn't take any lock, unlike flushing.
+		s.flowCache.invalidate()
+	}
+}
+
+// GetLearnedRoutes returns the routes learned on all NICs, in lookup order.
+func (s *Stack) GetLearnedRoutes() []tcpip.Route {
+	return append([]tcpip.Route(nil), s.learnedRoutes.get()...)
+}
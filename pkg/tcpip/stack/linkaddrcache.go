@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"time"
 
+	"golang.org/x/time/rate"
 	"gvisor.dev/gvisor/pkg/sleep"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -31,6 +32,10 @@ const linkAddrCacheSize = 512 // max cache entries
 //
 // This struct is safe for concurrent use.
 type linkAddrCache struct {
+	// clock is used to expire entries and time out resolutions. It is
+	// immutable.
+	clock tcpip.Clock
+
 	// ageLimit is how long a cache entry is valid for.
 	ageLimit time.Duration
 
@@ -42,11 +47,17 @@ type linkAddrCache struct {
 	// resolved before failing.
 	resolutionAttempts int
 
+	// retryLimiter, if set, paces retransmissions of link requests.
+	retryLimiter *rate.Limiter
+
 	cache struct {
 		sync.Mutex
 		table map[tcpip.FullAddress]*linkAddrEntry
 		lru   linkAddrEntryList
 	}
+
+	// resolutions tracks the goroutines resolving addresses.
+	resolutions sync.WaitGroup
 }
 
 // entryState controls the state of a single entry in the cache.
@@ -131,7 +142,7 @@ func (c *linkAddrCache) add(k tcpip.FullAddress, v tcpip.LinkAddress) {
 	// Calculate expiration time before acquiring the lock, since expiration is
 	// relative to the time when information was learned, rather than when it
 	// happened to be inserted into the cache.
-	expiration := time.Now().Add(c.ageLimit)
+	expiration := c.clock.Now().Add(c.ageLimit)
 
 	c.cache.Lock()
 	entry := c.getOrCreateEntryLocked(k)
@@ -192,7 +203,7 @@ func (c *linkAddrCache) get(k tcpip.FullAddress, linkRes LinkAddressResolver, lo
 	entry := c.getOrCreateEntryLocked(k)
 	switch s := entry.s; s {
 	case ready, failed:
-		if !time.Now().After(entry.expiration) {
+		if !c.clock.Now().After(entry.expiration) {
 			// Not expired.
 			switch s {
 			case ready:
@@ -221,6 +232,7 @@ func (c *linkAddrCache) get(k tcpip.FullAddress, linkRes LinkAddressResolver, lo
 			}
 
 			entry.done = make(chan struct{})
+			c.resolutions.Add(1)
 			go c.startAddressResolution(k, linkRes, localAddr, nic, entry.done) // S/R-SAFE: link non-savable; wakers dropped synchronously.
 		}
 
@@ -241,17 +253,26 @@ func (c *linkAddrCache) removeWaker(k tcpip.FullAddress, waker *sleep.Waker) {
 }
 
 func (c *linkAddrCache) startAddressResolution(k tcpip.FullAddress, linkRes LinkAddressResolver, localAddr tcpip.Address, nic NetworkInterface, done <-chan struct{}) {
+	defer c.resolutions.Done()
 	for i := 0; ; i++ {
 		// Send link request, then wait for the timeout limit and check
-		// whether the request succeeded.
-		linkRes.LinkAddressRequest(k.Addr, localAddr, "" /* linkAddr */, nic)
+		// whether the request succeeded. Retransmissions skipped because
+		// of the rate limit still count as attempts.
+		if i == 0 || c.retryLimiter == nil || c.retryLimiter.AllowN(c.clock.Now(), 1) {
+			linkRes.LinkAddressRequest(k.Addr, localAddr, "" /* linkAddr */, nic)
+		}
 
+		timedOut := make(chan struct{})
+		timer := c.clock.AfterFunc(c.resolutionTimeout, func() {
+			close(timedOut)
+		})
 		select {
-		case now := <-time.After(c.resolutionTimeout):
-			if stop := c.checkLinkRequest(now, k, i); stop {
+		case <-timedOut:
+			if stop := c.checkLinkRequest(c.clock.Now(), k, i); stop {
 				return
 			}
 		case <-done:
+			timer.Stop()
 			return
 		}
 	}
@@ -284,8 +305,23 @@ func (c *linkAddrCache) checkLinkRequest(now time.Time, k tcpip.FullAddress, att
 	return true
 }
 
-func newLinkAddrCache(ageLimit, resolutionTimeout time.Duration, resolutionAttempts int) *linkAddrCache {
+// clear removes all entries from the cache. Resolutions in progress fail, and
+// clear waits for the goroutines running them to exit.
+func (c *linkAddrCache) clear() {
+	c.cache.Lock()
+	for _, entry := range c.cache.table {
+		entry.changeState(failed, time.Time{})
+	}
+	c.cache.table = make(map[tcpip.FullAddress]*linkAddrEntry, linkAddrCacheSize)
+	c.cache.lru = linkAddrEntryList{}
+	c.cache.Unlock()
+
+	c.resolutions.Wait()
+}
+
+func newLinkAddrCache(clock tcpip.Clock, ageLimit, resolutionTimeout time.Duration, resolutionAttempts int) *linkAddrCache {
 	c := &linkAddrCache{
+		clock:              clock,
 		ageLimit:           ageLimit,
 		resolutionTimeout:  resolutionTimeout,
 		resolutionAttempts: resolutionAttempts,
@@ -92,7 +92,7 @@ func getBlocking(c *linkAddrCache, addr tcpip.FullAddress, linkRes LinkAddressRe
 }
 
 func TestCacheOverflow(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, 1*time.Second, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, 1*time.Second, 3)
 	for i := len(testAddrs) - 1; i >= 0; i-- {
 		e := testAddrs[i]
 		c.add(e.addr, e.linkAddr)
@@ -125,7 +125,7 @@ func TestCacheOverflow(t *testing.T) {
 }
 
 func TestCacheConcurrent(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, 1*time.Second, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, 1*time.Second, 3)
 
 	var wg sync.WaitGroup
 	for r := 0; r < 16; r++ {
@@ -159,7 +159,7 @@ func TestCacheConcurrent(t *testing.T) {
 }
 
 func TestCacheAgeLimit(t *testing.T) {
-	c := newLinkAddrCache(1*time.Millisecond, 1*time.Second, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1*time.Millisecond, 1*time.Second, 3)
 	e := testAddrs[0]
 	c.add(e.addr, e.linkAddr)
 	time.Sleep(50 * time.Millisecond)
@@ -169,7 +169,7 @@ func TestCacheAgeLimit(t *testing.T) {
 }
 
 func TestCacheReplace(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, 1*time.Second, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, 1*time.Second, 3)
 	e := testAddrs[0]
 	l2 := e.linkAddr + "2"
 	c.add(e.addr, e.linkAddr)
@@ -198,7 +198,7 @@ func TestCacheResolution(t *testing.T) {
 	//
 	// Using a large resolution timeout decreases the probability of experiencing
 	// this race condition and does not affect how long this test takes to run.
-	c := newLinkAddrCache(1<<63-1, math.MaxInt64, 1)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, math.MaxInt64, 1)
 	linkRes := &testLinkAddressResolver{cache: c}
 	for i, ta := range testAddrs {
 		got, err := getBlocking(c, ta.addr, linkRes)
@@ -224,7 +224,7 @@ func TestCacheResolution(t *testing.T) {
 }
 
 func TestCacheResolutionFailed(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, 10*time.Millisecond, 5)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, 10*time.Millisecond, 5)
 	linkRes := &testLinkAddressResolver{cache: c}
 
 	var requestCount uint32
@@ -257,7 +257,7 @@ func TestCacheResolutionFailed(t *testing.T) {
 func TestCacheResolutionTimeout(t *testing.T) {
 	resolverDelay := 500 * time.Millisecond
 	expiration := resolverDelay / 10
-	c := newLinkAddrCache(expiration, 1*time.Millisecond, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, expiration, 1*time.Millisecond, 3)
 	linkRes := &testLinkAddressResolver{cache: c, delay: resolverDelay}
 
 	e := testAddrs[0]
@@ -266,10 +266,33 @@ func TestCacheResolutionTimeout(t *testing.T) {
 	}
 }
 
+func TestCacheClear(t *testing.T) {
+	// Resolution would only time out after an hour.
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, time.Hour, 1)
+	linkRes := &testLinkAddressResolver{cache: c, delay: time.Hour}
+
+	e := testAddrs[0]
+	_, ch, err := c.get(e.addr, linkRes, "", nil, nil)
+	if err != tcpip.ErrWouldBlock {
+		t.Fatalf("c.get(%q), got error: %v, want: error ErrWouldBlock", string(e.addr.Addr), err)
+	}
+
+	c.clear()
+
+	select {
+	case <-ch:
+	default:
+		t.Errorf("resolution of %q still pending after clear", string(e.addr.Addr))
+	}
+	if got, _, err := c.get(e.addr, nil, "", nil, nil); err != tcpip.ErrNoLinkAddress {
+		t.Errorf("c.get(%q)=%q, got error: %v, want: error ErrNoLinkAddress", string(e.addr.Addr), got, err)
+	}
+}
+
 // TestStaticResolution checks that static link addresses are resolved immediately and don't
 // send resolution requests.
 func TestStaticResolution(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, time.Millisecond, 1)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, time.Millisecond, 1)
 	linkRes := &testLinkAddressResolver{cache: c, delay: time.Minute}
 
 	addr := tcpip.Address("broadcast")
@@ -286,7 +309,7 @@ func TestStaticResolution(t *testing.T) {
 // TestCacheWaker verifies that RemoveWaker removes a waker previously added
 // through get().
 func TestCacheWaker(t *testing.T) {
-	c := newLinkAddrCache(1<<63-1, 1*time.Second, 3)
+	c := newLinkAddrCache(&tcpip.StdClock{}, 1<<63-1, 1*time.Second, 3)
 
 	// First, sanity check that wakers are working.
 	{
@@ -0,0 +1,190 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+
+	"golang.org/x/time/rate"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// martianLogLimit is the number of martian packets which may be logged
+	// per second, once martianLogBurst have been logged.
+	martianLogLimit = 2
+
+	// martianLogBurst is the number of martian packets which may be logged
+	// in a single burst.
+	martianLogBurst = 10
+)
+
+// MartianReason is the reason why a received packet is a martian: a packet
+// whose source address it can't have been sent from, as seen from the NIC it is
+// received on. Martian packets are a sign of spoofing or misconfiguration.
+type MartianReason int
+
+const (
+	// MartianLoopbackSource is a packet from a loopback address received on
+	// a NIC which isn't a loopback NIC.
+	MartianLoopbackSource MartianReason = iota
+
+	// MartianMulticastSource is a packet from a multicast or broadcast
+	// address.
+	MartianMulticastSource
+
+	// MartianLocalSource is a packet from an address of the stack received
+	// on a NIC which isn't a loopback NIC.
+	MartianLocalSource
+
+	// MartianReversePath is a packet whose source address isn't routed out
+	// of the NIC, as per its reverse path filtering mode.
+	MartianReversePath
+)
+
+// String implements fmt.Stringer.
+func (r MartianReason) String() string {
+	switch r {
+	case MartianLoopbackSource:
+		return "loopback source"
+	case MartianMulticastSource:
+		return "multicast or broadcast source"
+	case MartianLocalSource:
+		return "local source"
+	case MartianReversePath:
+		return "no reverse path"
+	default:
+		return fmt.Sprintf("MartianReason(%d)", int(r))
+	}
+}
+
+// MartianStats counts the martian packets received by a NIC.
+type MartianStats struct {
+	// LoopbackSource is the number of packets received from a loopback
+	// address.
+	LoopbackSource *tcpip.StatCounter
+
+	// MulticastSource is the number of packets received from a multicast
+	// or broadcast address.
+	MulticastSource *tcpip.StatCounter
+
+	// LocalSource is the number of packets received from an address of the
+	// stack.
+	LocalSource *tcpip.StatCounter
+
+	// ReversePath is the number of packets dropped by reverse path
+	// filtering.
+	ReversePath *tcpip.StatCounter
+}
+
+// counter returns the counter of the martian packets received for reason.
+func (s *MartianStats) counter(reason MartianReason) *tcpip.StatCounter {
+	switch reason {
+	case MartianLoopbackSource:
+		return s.LoopbackSource
+	case MartianMulticastSource:
+		return s.MulticastSource
+	case MartianLocalSource:
+		return s.LocalSource
+	case MartianReversePath:
+		return s.ReversePath
+	default:
+		panic(fmt.Sprintf("unknown martian reason %d", reason))
+	}
+}
+
+// SetLogMartians enables or disables the logging of the martian packets
+// received on the given NIC, like the log_martians sysctl of Linux. Martian
+// packets are counted in the stats of the NIC, and recorded in the event log of
+// the stack, either way.
+func (s *Stack) SetLogMartians(nicID tcpip.NICID, enable bool) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setLogMartians(enable)
+	return nil
+}
+
+// LogMartians returns true if the martian packets received on the given NIC
+// are logged, as set by SetLogMartians.
+func (s *Stack) LogMartians(nicID tcpip.NICID) (bool, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return false, tcpip.ErrUnknownNICID
+	}
+
+	return nic.logMartians(), nil
+}
+
+// IsLocalAddress returns true if addr is assigned to a NIC of the stack. Unlike
+// CheckLocalAddress, it doesn't consider the addresses that NICs may spoof, nor
+// the broadcast addresses of their subnets.
+func (s *Stack) IsLocalAddress(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, nic := range s.nics {
+		ep := nic.getAddressOrCreateTempInner(protocol, addr, false /* createTemp */, NeverPrimaryEndpoint)
+		if ep == nil {
+			continue
+		}
+		local := ep.AddressWithPrefix().Address == addr
+		ep.DecRef()
+		if local {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleMartian is called by network protocols when a martian packet from
+// srcAddr to dstAddr is received on the given NIC. The packet is counted in the
+// stats of the NIC and recorded in the event log of the stack and, if enabled
+// with SetLogMartians, logged. Logs are rate limited.
+//
+// Whether the packet is dropped is up to the protocol.
+func (s *Stack) HandleMartian(nicID tcpip.NICID, protocol tcpip.NetworkProtocolNumber, srcAddr, dstAddr tcpip.Address, reason MartianReason) {
+	s.mu.RLock()
+	nic, ok := s.nics[nicID]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	nic.stats.Martians.counter(reason).Increment()
+	s.RecordEvent(Event{
+		Kind:     EventMartian,
+		NICID:    nicID,
+		Protocol: uint32(protocol),
+		Source:   tcpip.FullAddress{NIC: nicID, Addr: srcAddr},
+		Detail:   fmt.Sprintf("%s, destination %s", reason, dstAddr),
+	})
+	if nic.logMartians() && s.martianLogLimiter.AllowN(s.clock.Now(), 1) {
+		log.Infof("netstack: martian source %s for %s on NIC %d (%s): %s", srcAddr, dstAddr, nicID, nic.name, reason)
+	}
+}
+
+func newMartianLogLimiter() *rate.Limiter {
+	return rate.NewLimiter(martianLogLimit, martianLogBurst)
+}
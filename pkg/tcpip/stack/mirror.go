@@ -0,0 +1,165 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+)
+
+// MirrorDirection is a set of directions of the traffic of a NIC.
+type MirrorDirection uint8
+
+const (
+	// MirrorIngress designates the packets received by a NIC.
+	MirrorIngress MirrorDirection = 1 << iota
+
+	// MirrorEgress designates the packets sent by a NIC.
+	MirrorEgress
+)
+
+// MirrorOptions describe where the traffic of a NIC is mirrored, like the
+// mirred action of tc.
+type MirrorOptions struct {
+	// Direction is the traffic mirrored. Mirroring is disabled if it is
+	// empty.
+	Direction MirrorDirection
+
+	// NIC, if non-zero, is the NIC mirrored packets are sent out of, with
+	// their original link addresses. The NICs should have the same link
+	// layer.
+	NIC tcpip.NICID
+
+	// Sink, if not nil, receives mirrored packets along with their link
+	// header, like packet endpoints listening for all protocols. The
+	// PktType of the packets is PacketHost for received packets and
+	// PacketOutgoing for sent packets.
+	Sink PacketEndpoint
+}
+
+// nicMirror is the mirroring configuration of a NIC.
+type nicMirror struct {
+	opts MirrorOptions
+
+	// target is the NIC identified by opts.NIC.
+	target *NIC
+}
+
+// SetNICMirror mirrors the traffic of NIC id as per opts, replacing any
+// previous configuration. Mirroring can be changed at any time without
+// interrupting traffic.
+func (s *Stack) SetNICMirror(id tcpip.NICID, opts MirrorOptions) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+	m := nicMirror{opts: opts}
+	if opts.NIC != 0 {
+		if opts.NIC == id {
+			return tcpip.ErrInvalidOptionValue
+		}
+		if m.target, ok = s.nics[opts.NIC]; !ok {
+			return tcpip.ErrUnknownNICID
+		}
+	}
+
+	nic.mu.Lock()
+	nic.mu.mirror = m
+	nic.mu.Unlock()
+	return nil
+}
+
+// NICMirror returns how the traffic of NIC id is mirrored.
+func (s *Stack) NICMirror(id tcpip.NICID) (MirrorOptions, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return MirrorOptions{}, tcpip.ErrUnknownNICID
+	}
+
+	nic.mu.RLock()
+	defer nic.mu.RUnlock()
+	return nic.mu.mirror.opts, nil
+}
+
+// stopMirroringTo stops sending mirrored packets to target.
+func (n *NIC) stopMirroringTo(target *NIC) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.mu.mirror.target == target {
+		n.mu.mirror.opts.NIC = 0
+		n.mu.mirror.target = nil
+	}
+}
+
+// mirrorPacket mirrors pkt, which is traveling in direction dir, as per m. pkt
+// is neither modified nor retained.
+func (n *NIC) mirrorPacket(m nicMirror, dir MirrorDirection, remote, local tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) {
+	if m.opts.Direction&dir == 0 {
+		return
+	}
+
+	if m.opts.Sink != nil {
+		p := pkt.Clone()
+		if dir == MirrorEgress {
+			p.PktType = tcpip.PacketOutgoing
+			// Outgoing packets are intercepted before the link layer header
+			// is created.
+			n.LinkEndpoint.AddHeader(local, remote, protocol, p)
+		} else {
+			p.PktType = tcpip.PacketHost
+		}
+		m.opts.Sink.HandlePacket(n.id, local, protocol, p)
+	}
+
+	if m.target != nil && m.target.Enabled() {
+		// Mirroring is best effort, and mirrored packets are not mirrored
+		// again.
+		_ = m.target.writeForeignPacket(dir == MirrorEgress, remote, local, protocol, pkt)
+	}
+}
+
+// networkPacket returns a new packet holding the network packet of pkt, with
+// reserved bytes for headers.
+func networkPacket(pkt *PacketBuffer, reserved int) *PacketBuffer {
+	// Received packets have not been parsed yet, so their network packet is
+	// wholly in Data.
+	var data buffer.VectorisedView
+	data.AppendView(pkt.NetworkHeader().View())
+	data.AppendView(pkt.TransportHeader().View())
+	data.Append(pkt.Data)
+	return NewPacketBuffer(PacketBufferOptions{
+		ReserveHeaderBytes: reserved,
+		Data:               data,
+	})
+}
+
+// writeForeignPacket sends the network packet of pkt, which was sent by
+// another NIC if egress is true and received by it otherwise, out of n
+// directly through its link endpoint. The packet keeps its link addresses.
+func (n *NIC) writeForeignPacket(egress bool, remote, local tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) *tcpip.Error {
+	r := Route{NetProto: protocol}
+	if egress {
+		r.LocalLinkAddress, r.RemoteLinkAddress = local, remote
+	} else {
+		r.LocalLinkAddress, r.RemoteLinkAddress = remote, local
+	}
+	return n.LinkEndpoint.WritePacket(&r, nil /* gso */, protocol, networkPacket(pkt, int(n.MaxHeaderLength())))
+}
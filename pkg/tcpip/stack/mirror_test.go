@@ -0,0 +1,191 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	mirrorSrcNICID    = 1
+	mirrorTargetNICID = 2
+
+	mirrorLocalLinkAddr  = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x01")
+	mirrorTargetLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x02")
+	mirrorRemoteLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x03")
+
+	mirrorLocalAddr  = tcpip.Address("\x0a\x00\x00\x01")
+	mirrorRemoteAddr = tcpip.Address("\x0a\x00\x00\x02")
+)
+
+// mirrorSink records the packets it handles.
+type mirrorSink struct {
+	pkts []*stack.PacketBuffer
+}
+
+func (s *mirrorSink) HandlePacket(_ tcpip.NICID, _ tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	s.pkts = append(s.pkts, pkt)
+}
+
+func newMirrorStack(t *testing.T) (*stack.Stack, *channel.Endpoint, *channel.Endpoint) {
+	t.Helper()
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+	})
+	src := channel.New(10, 1280, mirrorLocalLinkAddr)
+	target := channel.New(10, 1280, mirrorTargetLinkAddr)
+	if err := s.CreateNIC(mirrorSrcNICID, src); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", mirrorSrcNICID, err)
+	}
+	if err := s.CreateNIC(mirrorTargetNICID, target); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", mirrorTargetNICID, err)
+	}
+	if err := s.AddAddress(mirrorSrcNICID, ipv4.ProtocolNumber, mirrorLocalAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", mirrorSrcNICID, ipv4.ProtocolNumber, mirrorLocalAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: mirrorSrcNICID}})
+	return s, src, target
+}
+
+func mirrorIPv4Packet(src, dst tcpip.Address) buffer.View {
+	hdr := buffer.NewView(header.IPv4MinimumSize + 4)
+	ip := header.IPv4(hdr)
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	copy(hdr[header.IPv4MinimumSize:], "data")
+	return hdr
+}
+
+func TestMirrorIngress(t *testing.T) {
+	s, src, target := newMirrorStack(t)
+	var sink mirrorSink
+	if err := s.SetNICMirror(mirrorSrcNICID, stack.MirrorOptions{
+		Direction: stack.MirrorIngress,
+		NIC:       mirrorTargetNICID,
+		Sink:      &sink,
+	}); err != nil {
+		t.Fatalf("SetNICMirror(%d, _): %s", mirrorSrcNICID, err)
+	}
+
+	want := mirrorIPv4Packet(mirrorRemoteAddr, mirrorLocalAddr)
+	src.InjectLinkAddr(ipv4.ProtocolNumber, mirrorRemoteLinkAddr, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: want.ToVectorisedView(),
+	}))
+
+	p, ok := target.Read()
+	if !ok {
+		t.Fatalf("no packet mirrored to NIC %d", mirrorTargetNICID)
+	}
+	if got := p.Pkt.Data.ToView(); !bytes.Equal(got, want) {
+		t.Errorf("got mirrored packet = %x, want = %x", got, want)
+	}
+	if p.Route.LocalLinkAddress != mirrorRemoteLinkAddr || p.Route.RemoteLinkAddress != mirrorLocalLinkAddr {
+		t.Errorf("got mirrored packet from %s to %s, want from %s to %s", p.Route.LocalLinkAddress, p.Route.RemoteLinkAddress, mirrorRemoteLinkAddr, mirrorLocalLinkAddr)
+	}
+	if len(sink.pkts) != 1 || sink.pkts[0].PktType != tcpip.PacketHost {
+		t.Errorf("got %d packets in the sink, want 1 incoming packet", len(sink.pkts))
+	}
+
+	// Once disabled, nothing is mirrored.
+	if err := s.SetNICMirror(mirrorSrcNICID, stack.MirrorOptions{}); err != nil {
+		t.Fatalf("SetNICMirror(%d, {}): %s", mirrorSrcNICID, err)
+	}
+	src.InjectLinkAddr(ipv4.ProtocolNumber, mirrorRemoteLinkAddr, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: want.ToVectorisedView(),
+	}))
+	if n := target.Drain(); n != 0 {
+		t.Errorf("got %d packets mirrored after disabling mirroring, want 0", n)
+	}
+}
+
+func TestMirrorEgress(t *testing.T) {
+	s, src, target := newMirrorStack(t)
+	var sink mirrorSink
+	if err := s.SetNICMirror(mirrorSrcNICID, stack.MirrorOptions{
+		Direction: stack.MirrorIngress | stack.MirrorEgress,
+		NIC:       mirrorTargetNICID,
+		Sink:      &sink,
+	}); err != nil {
+		t.Fatalf("SetNICMirror(%d, _): %s", mirrorSrcNICID, err)
+	}
+
+	r, err := s.FindRoute(mirrorSrcNICID, mirrorLocalAddr, mirrorRemoteAddr, ipv4.ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(%d, %s, %s, %d, false): %s", mirrorSrcNICID, mirrorLocalAddr, mirrorRemoteAddr, ipv4.ProtocolNumber, err)
+	}
+	defer r.Release()
+	r.RemoteLinkAddress = mirrorRemoteLinkAddr
+	if err := r.WritePacket(nil /* gso */, stack.NetworkHeaderParams{Protocol: header.UDPProtocolNumber, TTL: 64}, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()),
+		Data:               buffer.View("data").ToVectorisedView(),
+	})); err != nil {
+		t.Fatalf("r.WritePacket(_, _, _): %s", err)
+	}
+
+	sent, ok := src.Read()
+	if !ok {
+		t.Fatalf("no packet sent on NIC %d", mirrorSrcNICID)
+	}
+	mirrored, ok := target.Read()
+	if !ok {
+		t.Fatalf("no packet mirrored to NIC %d", mirrorTargetNICID)
+	}
+	want := stack.PayloadSince(sent.Pkt.NetworkHeader())
+	if got := mirrored.Pkt.Data.ToView(); !bytes.Equal(got, want) {
+		t.Errorf("got mirrored packet = %x, want = %x", got, want)
+	}
+	if mirrored.Route.LocalLinkAddress != mirrorLocalLinkAddr || mirrored.Route.RemoteLinkAddress != mirrorRemoteLinkAddr {
+		t.Errorf("got mirrored packet from %s to %s, want from %s to %s", mirrored.Route.LocalLinkAddress, mirrored.Route.RemoteLinkAddress, mirrorLocalLinkAddr, mirrorRemoteLinkAddr)
+	}
+	if len(sink.pkts) != 1 || sink.pkts[0].PktType != tcpip.PacketOutgoing {
+		t.Errorf("got %d packets in the sink, want 1 outgoing packet", len(sink.pkts))
+	}
+}
+
+func TestMirrorTargetRemoved(t *testing.T) {
+	s, _, _ := newMirrorStack(t)
+	if err := s.SetNICMirror(mirrorSrcNICID, stack.MirrorOptions{NIC: mirrorSrcNICID}); err != tcpip.ErrInvalidOptionValue {
+		t.Errorf("got SetNICMirror(%d, _) = %v mirroring to itself, want = %s", mirrorSrcNICID, err, tcpip.ErrInvalidOptionValue)
+	}
+	opts := stack.MirrorOptions{Direction: stack.MirrorEgress, NIC: mirrorTargetNICID}
+	if err := s.SetNICMirror(mirrorSrcNICID, opts); err != nil {
+		t.Fatalf("SetNICMirror(%d, %+v): %s", mirrorSrcNICID, opts, err)
+	}
+	if err := s.RemoveNIC(mirrorTargetNICID); err != nil {
+		t.Fatalf("RemoveNIC(%d): %s", mirrorTargetNICID, err)
+	}
+	got, err := s.NICMirror(mirrorSrcNICID)
+	if err != nil {
+		t.Fatalf("NICMirror(%d): %s", mirrorSrcNICID, err)
+	}
+	if want := (stack.MirrorOptions{Direction: stack.MirrorEgress}); got != want {
+		t.Errorf("got NICMirror(%d) = %+v, want = %+v", mirrorSrcNICID, got, want)
+	}
+}
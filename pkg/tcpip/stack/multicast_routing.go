@@ -0,0 +1,339 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// MulticastInterface holds the multicast routing options of a NIC, like an
+// entry of the MIF table of Linux. Multicast packets are only forwarded from and
+// to NICs added with Stack.AddMulticastInterface.
+type MulticastInterface struct {
+	// HopLimitThreshold is the hop limit, or TTL, multicast packets must
+	// exceed when received to be forwarded out of the NIC. It lets scoped
+	// boundaries be set with hop limits.
+	HopLimitThreshold uint8
+}
+
+// MulticastRoute is a multicast route, like an entry of the multicast
+// forwarding cache (MFC) of Linux.
+type MulticastRoute struct {
+	// Source is the unicast source address of the packets matched by the
+	// route. The route matches packets from any source if Source is empty,
+	// i.e. it is a (*, G) route. (S, G) routes are preferred over (*, G)
+	// routes.
+	Source tcpip.Address
+
+	// Group is the multicast group of the packets matched by the route.
+	Group tcpip.Address
+
+	// InputNIC is the NIC the packets matched by the route are expected to
+	// be received on. Packets received on other NICs aren't forwarded, as
+	// they failed the reverse path forwarding check.
+	InputNIC tcpip.NICID
+
+	// OutputNICs are the NICs the packets matched by the route are
+	// forwarded out of.
+	OutputNICs []tcpip.NICID
+}
+
+// MulticastRouteStats are the statistics of a multicast route.
+type MulticastRouteStats struct {
+	// Packets and Bytes are the number of packets, and of bytes, forwarded
+	// by the route.
+	Packets uint64
+	Bytes   uint64
+
+	// WrongInterface is the number of packets matched by the route but
+	// received on another NIC than its input NIC.
+	WrongInterface uint64
+
+	// LastUsed is the last time a packet was forwarded by the route, as
+	// given by the clock of the stack.
+	LastUsed time.Time
+}
+
+// MulticastRouteState describes a multicast route of the stack.
+type MulticastRouteState struct {
+	Route MulticastRoute
+	Stats MulticastRouteStats
+}
+
+// MulticastOutput is a NIC a multicast packet is forwarded out of.
+type MulticastOutput struct {
+	NIC tcpip.NICID
+
+	// HopLimitThreshold is the hop limit the packet must exceed to be
+	// forwarded out of the NIC.
+	HopLimitThreshold uint8
+}
+
+// MulticastRouteResult is the result of the lookup of a multicast route.
+type MulticastRouteResult int
+
+const (
+	// MulticastRouteFound means a route was found for the packet.
+	MulticastRouteFound MulticastRouteResult = iota
+
+	// MulticastRouteNotFound means no route matches the packet.
+	MulticastRouteNotFound
+
+	// MulticastRouteWrongInterface means a route matches the packet, but it
+	// was received on another NIC than the input NIC of the route.
+	MulticastRouteWrongInterface
+)
+
+type multicastInterfaceKey struct {
+	protocol tcpip.NetworkProtocolNumber
+	nicID    tcpip.NICID
+}
+
+type multicastRouteKey struct {
+	protocol tcpip.NetworkProtocolNumber
+	source   tcpip.Address
+	group    tcpip.Address
+}
+
+type multicastRouteEntry struct {
+	route MulticastRoute
+	stats MulticastRouteStats
+}
+
+// multicastRoutingTable holds the multicast interfaces and routes of a stack.
+type multicastRoutingTable struct {
+	mu         sync.Mutex
+	interfaces map[multicastInterfaceKey]MulticastInterface
+	routes     map[multicastRouteKey]*multicastRouteEntry
+}
+
+func (t *multicastRoutingTable) init() {
+	t.interfaces = make(map[multicastInterfaceKey]MulticastInterface)
+	t.routes = make(map[multicastRouteKey]*multicastRouteEntry)
+}
+
+// removeNIC removes the NIC from the multicast interfaces, and from the routes
+// it is an output of. The routes it is the input of are removed.
+func (t *multicastRoutingTable) removeNIC(nicID tcpip.NICID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for k := range t.interfaces {
+		if k.nicID == nicID {
+			delete(t.interfaces, k)
+		}
+	}
+	for k, e := range t.routes {
+		if e.route.InputNIC == nicID {
+			delete(t.routes, k)
+			continue
+		}
+		outputs := e.route.OutputNICs[:0]
+		for _, id := range e.route.OutputNICs {
+			if id != nicID {
+				outputs = append(outputs, id)
+			}
+		}
+		e.route.OutputNICs = outputs
+	}
+}
+
+// AddMulticastInterface enables multicast routing for the given protocol on
+// the given NIC, or changes its options if already enabled.
+func (s *Stack) AddMulticastInterface(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID, mif MulticastInterface) *tcpip.Error {
+	s.mu.RLock()
+	_, ok := s.nics[nicID]
+	s.mu.RUnlock()
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+	s.multicastRouting.interfaces[multicastInterfaceKey{protocol: protocol, nicID: nicID}] = mif
+	return nil
+}
+
+// RemoveMulticastInterface disables multicast routing for the given protocol
+// on the given NIC. The routes referencing the NIC are kept, but don't forward
+// packets from or to it until it is added again.
+func (s *Stack) RemoveMulticastInterface(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID) *tcpip.Error {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	k := multicastInterfaceKey{protocol: protocol, nicID: nicID}
+	if _, ok := s.multicastRouting.interfaces[k]; !ok {
+		return tcpip.ErrUnknownNICID
+	}
+	delete(s.multicastRouting.interfaces, k)
+	return nil
+}
+
+// MulticastInterfaces returns the NICs on which multicast routing is enabled
+// for the given protocol.
+func (s *Stack) MulticastInterfaces(protocol tcpip.NetworkProtocolNumber) map[tcpip.NICID]MulticastInterface {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	mifs := make(map[tcpip.NICID]MulticastInterface)
+	for k, mif := range s.multicastRouting.interfaces {
+		if k.protocol == protocol {
+			mifs[k.nicID] = mif
+		}
+	}
+	return mifs
+}
+
+// MulticastRoutingEnabled returns true if multicast routing is enabled for the
+// given protocol on any NIC.
+func (s *Stack) MulticastRoutingEnabled(protocol tcpip.NetworkProtocolNumber) bool {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	for k := range s.multicastRouting.interfaces {
+		if k.protocol == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// isMulticastAddress returns true if addr is a multicast address of the given
+// protocol.
+func isMulticastAddress(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		return header.IsV4MulticastAddress(addr)
+	case header.IPv6ProtocolNumber:
+		return header.IsV6MulticastAddress(addr)
+	default:
+		return false
+	}
+}
+
+// AddMulticastRoute adds a multicast route for the given protocol, replacing
+// the route with the same source and group, if any. The statistics of a
+// replaced route are kept.
+//
+// The input and output NICs of the route must be multicast interfaces.
+func (s *Stack) AddMulticastRoute(protocol tcpip.NetworkProtocolNumber, route MulticastRoute) *tcpip.Error {
+	if !isMulticastAddress(protocol, route.Group) || isMulticastAddress(protocol, route.Source) {
+		return tcpip.ErrBadAddress
+	}
+
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	for _, id := range append([]tcpip.NICID{route.InputNIC}, route.OutputNICs...) {
+		if _, ok := s.multicastRouting.interfaces[multicastInterfaceKey{protocol: protocol, nicID: id}]; !ok {
+			return tcpip.ErrUnknownNICID
+		}
+	}
+
+	route.OutputNICs = append([]tcpip.NICID(nil), route.OutputNICs...)
+	k := multicastRouteKey{protocol: protocol, source: route.Source, group: route.Group}
+	if e, ok := s.multicastRouting.routes[k]; ok {
+		e.route = route
+		return nil
+	}
+	s.multicastRouting.routes[k] = &multicastRouteEntry{route: route}
+	return nil
+}
+
+// RemoveMulticastRoute removes the multicast route for the given protocol with
+// the given source and group.
+func (s *Stack) RemoveMulticastRoute(protocol tcpip.NetworkProtocolNumber, source, group tcpip.Address) *tcpip.Error {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	k := multicastRouteKey{protocol: protocol, source: source, group: group}
+	if _, ok := s.multicastRouting.routes[k]; !ok {
+		return tcpip.ErrNoRoute
+	}
+	delete(s.multicastRouting.routes, k)
+	return nil
+}
+
+// MulticastRoutes returns the multicast routes of the given protocol, sorted by
+// group then source.
+func (s *Stack) MulticastRoutes(protocol tcpip.NetworkProtocolNumber) []MulticastRouteState {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	var routes []MulticastRouteState
+	for k, e := range s.multicastRouting.routes {
+		if k.protocol != protocol {
+			continue
+		}
+		state := MulticastRouteState{Route: e.route, Stats: e.stats}
+		state.Route.OutputNICs = append([]tcpip.NICID(nil), e.route.OutputNICs...)
+		routes = append(routes, state)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Route.Group != routes[j].Route.Group {
+			return routes[i].Route.Group < routes[j].Route.Group
+		}
+		return routes[i].Route.Source < routes[j].Route.Source
+	})
+	return routes
+}
+
+// LookupMulticastRoute returns the NICs a multicast packet of size bytes from
+// source to group, received on inputNIC, is forwarded out of, as per the
+// multicast routes of the given protocol. The packet is accounted in the stats
+// of the matching route.
+//
+// Outputs which aren't multicast interfaces are omitted, as is inputNIC.
+func (s *Stack) LookupMulticastRoute(protocol tcpip.NetworkProtocolNumber, inputNIC tcpip.NICID, source, group tcpip.Address, size int) ([]MulticastOutput, MulticastRouteResult) {
+	s.multicastRouting.mu.Lock()
+	defer s.multicastRouting.mu.Unlock()
+
+	e, ok := s.multicastRouting.routes[multicastRouteKey{protocol: protocol, source: source, group: group}]
+	if !ok {
+		e, ok = s.multicastRouting.routes[multicastRouteKey{protocol: protocol, group: group}]
+	}
+	if !ok {
+		return nil, MulticastRouteNotFound
+	}
+	if e.route.InputNIC != inputNIC {
+		e.stats.WrongInterface++
+		return nil, MulticastRouteWrongInterface
+	}
+	if _, ok := s.multicastRouting.interfaces[multicastInterfaceKey{protocol: protocol, nicID: inputNIC}]; !ok {
+		return nil, MulticastRouteNotFound
+	}
+
+	e.stats.Packets++
+	e.stats.Bytes += uint64(size)
+	e.stats.LastUsed = s.clock.Now()
+
+	outputs := make([]MulticastOutput, 0, len(e.route.OutputNICs))
+	for _, id := range e.route.OutputNICs {
+		if id == inputNIC {
+			continue
+		}
+		mif, ok := s.multicastRouting.interfaces[multicastInterfaceKey{protocol: protocol, nicID: id}]
+		if !ok {
+			continue
+		}
+		outputs = append(outputs, MulticastOutput{NIC: id, HopLimitThreshold: mif.HopLimitThreshold})
+	}
+	return outputs, MulticastRouteFound
+}
@@ -984,6 +984,12 @@ func TestSetNDPConfigurations(t *testing.T) {
 // raBufWithOptsAndDHCPv6 returns a valid NDP Router Advertisement with options
 // and DHCPv6 configurations specified.
 func raBufWithOptsAndDHCPv6(ip tcpip.Address, rl uint16, managedAddress, otherConfigurations bool, optSer header.NDPOptionsSerializer) *stack.PacketBuffer {
+	return raBufWithOptsDHCPv6AndPrf(ip, rl, managedAddress, otherConfigurations, header.MediumRoutePreference, optSer)
+}
+
+// raBufWithOptsDHCPv6AndPrf is like raBufWithOptsAndDHCPv6 but also populates
+// the Default Router Preference field.
+func raBufWithOptsDHCPv6AndPrf(ip tcpip.Address, rl uint16, managedAddress, otherConfigurations bool, prf header.NDPRoutePreference, optSer header.NDPOptionsSerializer) *stack.PacketBuffer {
 	icmpSize := header.ICMPv6HeaderSize + header.NDPRAMinimumSize + int(optSer.Length())
 	hdr := buffer.NewPrependable(header.IPv6MinimumSize + icmpSize)
 	pkt := header.ICMPv6(hdr.Prepend(icmpSize))
@@ -1005,6 +1011,9 @@ func raBufWithOptsAndDHCPv6(ip tcpip.Address, rl uint16, managedAddress, otherCo
 		// (0-indexing) of the RA payload.
 		raPayload[1] |= (1 << 6)
 	}
+	// Populate the Default Router Preference field, bits 3 and 4 of byte #1 of
+	// the RA payload.
+	raPayload[1] |= uint8(prf) << 3
 	opts := ra.Options()
 	opts.Serialize(optSer)
 	pkt.SetChecksum(header.ICMPv6Checksum(pkt, ip, header.IPv6AllNodesMulticastAddress, buffer.VectorisedView{}))
@@ -1280,6 +1289,80 @@ func TestRouterDiscovery(t *testing.T) {
 	expectAsyncRouterInvalidationEvent(llAddr3, l3LifetimeSeconds*time.Second+defaultAsyncPositiveEventTimeout)
 }
 
+// TestRouterDiscoveryInstallsDefaultRoutes tests that routes through the
+// discovered default routers are installed in order of preference, with
+// source-specific routes for the SLAAC prefixes they advertise.
+func TestRouterDiscoveryInstallsDefaultRoutes(t *testing.T) {
+	const nicID = 1
+	const remoteAddr = tcpip.Address("\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+	prefix, subnet, addr := prefixSubnetAddr(0, linkAddr1)
+
+	e := channel.New(0, 1280, linkAddr1)
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv6.NewProtocolWithOptions(ipv6.Options{
+			NDPConfigs: ipv6.NDPConfigurations{
+				HandleRAs:              true,
+				DiscoverDefaultRouters: true,
+				InstallDefaultRoutes:   true,
+				AutoGenGlobalAddresses: true,
+			},
+		})},
+	})
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+
+	defaultRoute := func(rtr tcpip.Address) tcpip.Route {
+		return tcpip.Route{Destination: header.IPv6EmptySubnet, Gateway: rtr, NIC: nicID}
+	}
+	checkRoutes := func(want []tcpip.Route) {
+		t.Helper()
+
+		if diff := cmp.Diff(want, s.GetLearnedRoutes(), cmp.AllowUnexported(tcpip.Subnet{})); diff != "" {
+			t.Errorf("learned routes mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// Routers are looked up by order of preference.
+	e.InjectInbound(header.IPv6ProtocolNumber, raBufWithOptsDHCPv6AndPrf(llAddr2, 1000, false, false, header.LowRoutePreference, header.NDPOptionsSerializer{}))
+	checkRoutes([]tcpip.Route{defaultRoute(llAddr2)})
+	e.InjectInbound(header.IPv6ProtocolNumber, raBufWithOptsDHCPv6AndPrf(llAddr3, 1000, false, false, header.HighRoutePreference, header.NDPOptionsSerializer{}))
+	checkRoutes([]tcpip.Route{defaultRoute(llAddr3), defaultRoute(llAddr2)})
+
+	// The packets from the SLAAC prefix a router advertises are routed through
+	// it, whatever its preference.
+	e.InjectInbound(header.IPv6ProtocolNumber, raBufWithPI(llAddr2, 1000, prefix, false, true, 100, 100))
+	sourceRoute := defaultRoute(llAddr2)
+	sourceRoute.Source = subnet
+	checkRoutes([]tcpip.Route{sourceRoute, defaultRoute(llAddr3), defaultRoute(llAddr2)})
+	r, err := s.FindRoute(0, "", remoteAddr, header.IPv6ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(0, '', %s, %d, false): %s", remoteAddr, header.IPv6ProtocolNumber, err)
+	}
+	if r.LocalAddress != addr.Address || r.NextHop != llAddr2 {
+		t.Errorf("got (r.LocalAddress, r.NextHop) = (%s, %s), want = (%s, %s)", r.LocalAddress, r.NextHop, addr.Address, llAddr2)
+	}
+	r.Release()
+
+	// A router with a zero lifetime is no longer a default router.
+	e.InjectInbound(header.IPv6ProtocolNumber, raBuf(llAddr2, 0))
+	checkRoutes([]tcpip.Route{defaultRoute(llAddr3)})
+	r, err = s.FindRoute(0, "", remoteAddr, header.IPv6ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(0, '', %s, %d, false): %s", remoteAddr, header.IPv6ProtocolNumber, err)
+	}
+	if r.NextHop != llAddr3 {
+		t.Errorf("got r.NextHop = %s, want = %s", r.NextHop, llAddr3)
+	}
+	r.Release()
+
+	// The routes of a NIC are removed with it.
+	if err := s.RemoveNIC(nicID); err != nil {
+		t.Fatalf("RemoveNIC(%d): %s", nicID, err)
+	}
+	checkRoutes(nil)
+}
+
 // TestRouterDiscoveryMaxRouters tests that only
 // ipv6.MaxDiscoveredDefaultRouters discovered routers are remembered.
 func TestRouterDiscoveryMaxRouters(t *testing.T) {
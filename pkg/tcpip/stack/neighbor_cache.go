@@ -100,7 +100,7 @@ func (n *neighborCache) getOrCreateEntry(remoteAddr tcpip.Address, linkRes LinkA
 		n.dynamic.count--
 
 		e.dispatchRemoveEventLocked()
-		e.setStateLocked(Unknown)
+		e.setStateLocked(Unknown, NeighborEventRemoved)
 		e.notifyWakersLocked()
 		e.mu.Unlock()
 	}
@@ -180,6 +180,21 @@ func (n *neighborCache) removeWaker(addr tcpip.Address, waker *sleep.Waker) {
 	n.mu.Unlock()
 }
 
+// peek returns the entry for addr without refreshing it or starting address
+// resolution.
+func (n *neighborCache) peek(addr tcpip.Address) (NeighborEntry, bool) {
+	n.mu.RLock()
+	entry, ok := n.cache[addr]
+	n.mu.RUnlock()
+	if !ok {
+		return NeighborEntry{}, false
+	}
+
+	entry.mu.RLock()
+	defer entry.mu.RUnlock()
+	return entry.neigh, true
+}
+
 // entries returns all entries in the neighbor cache.
 func (n *neighborCache) entries() []NeighborEntry {
 	n.mu.RLock()
@@ -225,7 +240,7 @@ func (n *neighborCache) addStaticEntry(addr tcpip.Address, linkAddr tcpip.LinkAd
 		// Notify that resolution has been interrupted, just in case the entry was
 		// in the Incomplete or Probe state.
 		entry.dispatchRemoveEventLocked()
-		entry.setStateLocked(Unknown)
+		entry.setStateLocked(Unknown, NeighborEventRemoved)
 		entry.notifyWakersLocked()
 		entry.mu.Unlock()
 	}
@@ -244,7 +259,7 @@ func (n *neighborCache) removeEntryLocked(entry *neighborEntry) {
 	if entry.neigh.State != Failed {
 		entry.dispatchRemoveEventLocked()
 	}
-	entry.setStateLocked(Unknown)
+	entry.setStateLocked(Unknown, NeighborEventRemoved)
 	entry.notifyWakersLocked()
 
 	delete(n.cache, entry.neigh.Addr)
@@ -276,7 +291,7 @@ func (n *neighborCache) clear() {
 	for _, entry := range n.cache {
 		entry.mu.Lock()
 		entry.dispatchRemoveEventLocked()
-		entry.setStateLocked(Unknown)
+		entry.setStateLocked(Unknown, NeighborEventRemoved)
 		entry.notifyWakersLocked()
 		entry.mu.Unlock()
 	}
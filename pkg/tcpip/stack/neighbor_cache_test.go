@@ -89,7 +89,7 @@ func newTestNeighborCache(nudDisp NUDDispatcher, config NUDConfigurations, clock
 			id:    1,
 			stats: makeNICStats(),
 		},
-		state: NewNUDState(config, rng),
+		state: NewNUDState(config, clock, rng),
 		cache: make(map[tcpip.Address]*neighborEntry, neighborCacheSize),
 	}
 	neigh.nic.neigh = neigh
@@ -136,6 +136,12 @@ func newStaticNeighborEntry(nic *NIC, addr tcpip.Address, linkAddr tcpip.LinkAdd
 	if nic.stack.nudDisp != nil {
 		nic.stack.nudDisp.OnNeighborAdded(nic.id, entry)
 	}
+	nic.stack.neighborSubs.notify(NeighborEvent{
+		NICID:     nic.id,
+		Entry:     entry,
+		PrevState: Unknown,
+		Reason:    NeighborEventStatic,
+	})
 	return &neighborEntry{
 		nic:      nic,
 		nudState: state,
@@ -179,6 +185,7 @@ func (e *neighborEntry) dispatchAddEventLocked() {
 // dispatchChangeEventLocked signals to stack's NUD Dispatcher that the entry
 // has changed state or link-layer address.
 func (e *neighborEntry) dispatchChangeEventLocked() {
+	e.nic.stack.flowCache.invalidate()
 	if nudDisp := e.nic.stack.nudDisp; nudDisp != nil {
 		nudDisp.OnNeighborChanged(e.nic.id, e.neigh)
 	}
@@ -187,17 +194,32 @@ func (e *neighborEntry) dispatchChangeEventLocked() {
 // dispatchRemoveEventLocked signals to stack's NUD Dispatcher that the entry
 // has been removed.
 func (e *neighborEntry) dispatchRemoveEventLocked() {
+	e.nic.stack.flowCache.invalidate()
 	if nudDisp := e.nic.stack.nudDisp; nudDisp != nil {
 		nudDisp.OnNeighborRemoved(e.nic.id, e.neigh)
 	}
 }
 
-// setStateLocked transitions the entry to the specified state immediately.
+// notifySubscribersLocked signals to the stack's neighbor event subscribers
+// that the entry transitioned from prev to its current state.
+//
+// e.mu MUST be locked.
+func (e *neighborEntry) notifySubscribersLocked(prev NeighborState, reason NeighborEventReason) {
+	e.nic.stack.neighborSubs.notify(NeighborEvent{
+		NICID:     e.nic.id,
+		Entry:     e.neigh,
+		PrevState: prev,
+		Reason:    reason,
+	})
+}
+
+// setStateLocked transitions the entry to the specified state immediately,
+// because of reason.
 //
 // Follows the logic defined in RFC 4861 section 7.3.3.
 //
 // e.mu MUST be locked.
-func (e *neighborEntry) setStateLocked(next NeighborState) {
+func (e *neighborEntry) setStateLocked(next NeighborState, reason NeighborEventReason) {
 	// Cancel the previously scheduled action, if there is one. Entries in
 	// Unknown, Stale, or Static state do not have scheduled actions.
 	if timer := e.job; timer != nil {
@@ -209,20 +231,24 @@ func (e *neighborEntry) setStateLocked(next NeighborState) {
 	e.neigh.UpdatedAtNanos = e.nic.stack.clock.NowNanoseconds()
 	config := e.nudState.Config()
 
+	if prev != next {
+		e.notifySubscribersLocked(prev, reason)
+	}
+
 	switch next {
 	case Incomplete:
 		panic(fmt.Sprintf("should never transition to Incomplete with setStateLocked; neigh = %#v, prev state = %s", e.neigh, prev))
 
 	case Reachable:
 		e.job = e.nic.stack.newJob(&e.mu, func() {
-			e.setStateLocked(Stale)
+			e.setStateLocked(Stale, NeighborEventTimeout)
 			e.dispatchChangeEventLocked()
 		})
 		e.job.Schedule(e.nudState.ReachableTime())
 
 	case Delay:
 		e.job = e.nic.stack.newJob(&e.mu, func() {
-			e.setStateLocked(Probe)
+			e.setStateLocked(Probe, NeighborEventTimeout)
 			e.dispatchChangeEventLocked()
 		})
 		e.job.Schedule(config.DelayFirstProbeTime)
@@ -234,13 +260,13 @@ func (e *neighborEntry) setStateLocked(next NeighborState) {
 		sendUnicastProbe = func() {
 			if retryCounter == config.MaxUnicastProbes {
 				e.dispatchRemoveEventLocked()
-				e.setStateLocked(Failed)
+				e.setStateLocked(Failed, NeighborEventResolutionFailed)
 				return
 			}
 
 			if err := e.linkRes.LinkAddressRequest(e.neigh.Addr, "" /* localAddr */, e.neigh.LinkAddr, e.nic); err != nil {
 				e.dispatchRemoveEventLocked()
-				e.setStateLocked(Failed)
+				e.setStateLocked(Failed, NeighborEventResolutionFailed)
 				return
 			}
 
@@ -257,6 +283,12 @@ func (e *neighborEntry) setStateLocked(next NeighborState) {
 		e.job.Schedule(immediateDuration)
 
 	case Failed:
+		// Neighbor Unreachability Detection declared the neighbor
+		// unreachable, so it must not be used as a default router until it
+		// advertises itself again.
+		if header.IsV6UnicastAddress(e.neigh.Addr) {
+			e.invalidateDefaultRouterLocked()
+		}
 		e.notifyWakersLocked()
 		e.job = e.nic.stack.newJob(&doubleLock{first: &e.nic.neigh.mu, second: &e.mu}, func() {
 			e.nic.neigh.removeEntryLocked(e)
@@ -271,6 +303,23 @@ func (e *neighborEntry) setStateLocked(next NeighborState) {
 	}
 }
 
+// invalidateDefaultRouterLocked lets the IPv6 endpoint of the NIC know that the
+// neighbor must no longer be used as a default router.
+//
+// TODO(gvisor.dev/issue/4085): Remove the special casing we do for IPv6 here.
+//
+// e.mu MUST be locked.
+func (e *neighborEntry) invalidateDefaultRouterLocked() {
+	ep, ok := e.nic.networkEndpoints[header.IPv6ProtocolNumber]
+	if !ok {
+		panic(fmt.Sprintf("have a neighbor entry for an IPv6 router but no IPv6 network endpoint"))
+	}
+
+	if ndpEP, ok := ep.(NDPEndpoint); ok {
+		ndpEP.InvalidateDefaultRouter(e.neigh.Addr)
+	}
+}
+
 // handlePacketQueuedLocked advances the state machine according to a packet
 // being queued for outgoing transmission.
 //
@@ -282,6 +331,7 @@ func (e *neighborEntry) handlePacketQueuedLocked(localAddr tcpip.Address) {
 		e.neigh.UpdatedAtNanos = e.nic.stack.clock.NowNanoseconds()
 
 		e.dispatchAddEventLocked()
+		e.notifySubscribersLocked(Unknown, NeighborEventPacketQueued)
 
 		config := e.nudState.Config()
 
@@ -311,7 +361,7 @@ func (e *neighborEntry) handlePacketQueuedLocked(localAddr tcpip.Address) {
 				// error message, and then delivering it (locally) through the generic
 				// error-handling routines.' - RFC 4861 section 2.1
 				e.dispatchRemoveEventLocked()
-				e.setStateLocked(Failed)
+				e.setStateLocked(Failed, NeighborEventResolutionFailed)
 				return
 			}
 
@@ -322,12 +372,21 @@ func (e *neighborEntry) handlePacketQueuedLocked(localAddr tcpip.Address) {
 			//  address SHOULD be placed in the IP Source Address of the outgoing
 			//  solicitation.
 			//
+			// Retransmissions are paced across all neighbors. One skipped
+			// because of the rate limit still counts as a probe.
+			if retryCounter != 0 && !e.nic.stack.allowLinkResRetry() {
+				retryCounter++
+				e.job = e.nic.stack.newJob(&e.mu, sendMulticastProbe)
+				e.job.Schedule(config.RetransmitTimer)
+				return
+			}
+
 			if err := e.linkRes.LinkAddressRequest(e.neigh.Addr, localAddr, "", e.nic); err != nil {
 				// There is no need to log the error here; the NUD implementation may
 				// assume a working link. A valid link should be the responsibility of
 				// the NIC/stack.LinkEndpoint.
 				e.dispatchRemoveEventLocked()
-				e.setStateLocked(Failed)
+				e.setStateLocked(Failed, NeighborEventResolutionFailed)
 				return
 			}
 
@@ -344,7 +403,7 @@ func (e *neighborEntry) handlePacketQueuedLocked(localAddr tcpip.Address) {
 		e.job.Schedule(immediateDuration)
 
 	case Stale:
-		e.setStateLocked(Delay)
+		e.setStateLocked(Delay, NeighborEventPacketQueued)
 		e.dispatchChangeEventLocked()
 
 	case Incomplete, Reachable, Delay, Probe, Static:
@@ -368,14 +427,14 @@ func (e *neighborEntry) handleProbeLocked(remoteLinkAddr tcpip.LinkAddress) {
 	switch e.neigh.State {
 	case Unknown, Incomplete, Failed:
 		e.neigh.LinkAddr = remoteLinkAddr
-		e.setStateLocked(Stale)
+		e.setStateLocked(Stale, NeighborEventProbeReceived)
 		e.notifyWakersLocked()
 		e.dispatchAddEventLocked()
 
 	case Reachable, Delay, Probe:
 		if e.neigh.LinkAddr != remoteLinkAddr {
 			e.neigh.LinkAddr = remoteLinkAddr
-			e.setStateLocked(Stale)
+			e.setStateLocked(Stale, NeighborEventProbeReceived)
 			e.dispatchChangeEventLocked()
 		}
 
@@ -416,9 +475,9 @@ func (e *neighborEntry) handleConfirmationLocked(linkAddr tcpip.LinkAddress, fla
 
 		e.neigh.LinkAddr = linkAddr
 		if flags.Solicited {
-			e.setStateLocked(Reachable)
+			e.setStateLocked(Reachable, NeighborEventConfirmed)
 		} else {
-			e.setStateLocked(Stale)
+			e.setStateLocked(Stale, NeighborEventUnsolicited)
 		}
 		e.dispatchChangeEventLocked()
 		e.isRouter = flags.IsRouter
@@ -433,7 +492,7 @@ func (e *neighborEntry) handleConfirmationLocked(linkAddr tcpip.LinkAddress, fla
 		if isLinkAddrDifferent {
 			if !flags.Override {
 				if e.neigh.State == Reachable {
-					e.setStateLocked(Stale)
+					e.setStateLocked(Stale, NeighborEventUnsolicited)
 					e.dispatchChangeEventLocked()
 				}
 				break
@@ -443,7 +502,7 @@ func (e *neighborEntry) handleConfirmationLocked(linkAddr tcpip.LinkAddress, fla
 
 			if !flags.Solicited {
 				if e.neigh.State != Stale {
-					e.setStateLocked(Stale)
+					e.setStateLocked(Stale, NeighborEventUnsolicited)
 					e.dispatchChangeEventLocked()
 				} else {
 					// Notify the LinkAddr change, even though NUD state hasn't changed.
@@ -456,7 +515,7 @@ func (e *neighborEntry) handleConfirmationLocked(linkAddr tcpip.LinkAddress, fla
 		if flags.Solicited && (flags.Override || !isLinkAddrDifferent) {
 			wasReachable := e.neigh.State == Reachable
 			// Set state to Reachable again to refresh timers.
-			e.setStateLocked(Reachable)
+			e.setStateLocked(Reachable, NeighborEventConfirmed)
 			e.notifyWakersLocked()
 			if !wasReachable {
 				e.dispatchChangeEventLocked()
@@ -471,17 +530,7 @@ func (e *neighborEntry) handleConfirmationLocked(linkAddr tcpip.LinkAddress, fla
 			// 7.3.3.  This is needed to detect when a node that is used as a router
 			// stops forwarding packets due to being configured as a host."
 			//  - RFC 4861 section 7.2.5
-			//
-			// TODO(gvisor.dev/issue/4085): Remove the special casing we do for IPv6
-			// here.
-			ep, ok := e.nic.networkEndpoints[header.IPv6ProtocolNumber]
-			if !ok {
-				panic(fmt.Sprintf("have a neighbor entry for an IPv6 router but no IPv6 network endpoint"))
-			}
-
-			if ndpEP, ok := ep.(NDPEndpoint); ok {
-				ndpEP.InvalidateDefaultRouter(e.neigh.Addr)
-			}
+			e.invalidateDefaultRouterLocked()
 		}
 		e.isRouter = flags.IsRouter
 
@@ -500,7 +549,7 @@ func (e *neighborEntry) handleUpperLevelConfirmationLocked() {
 	case Reachable, Stale, Delay, Probe:
 		wasReachable := e.neigh.State == Reachable
 		// Set state to Reachable again to refresh timers.
-		e.setStateLocked(Reachable)
+		e.setStateLocked(Reachable, NeighborEventUpperLevelConfirmed)
 		if !wasReachable {
 			e.dispatchChangeEventLocked()
 		}
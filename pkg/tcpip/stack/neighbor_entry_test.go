@@ -236,7 +236,7 @@ func entryTestSetup(c NUDConfigurations) (*neighborEntry, *testNUDDispatcher, *e
 	}
 
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	nudState := NewNUDState(c, rng)
+	nudState := NewNUDState(c, clock, rng)
 	linkRes := entryTestLinkResolver{}
 	entry := newNeighborEntry(&nic, entryTestAddr1 /* remoteAddr */, nudState, &linkRes)
 
@@ -1089,6 +1089,87 @@ func TestEntryReachableToStaleWhenTimeout(t *testing.T) {
 	e.mu.Unlock()
 }
 
+func TestEntryNeighborEvents(t *testing.T) {
+	c := DefaultNUDConfigurations()
+	c.MinRandomFactor = 1
+	c.MaxRandomFactor = 1
+
+	e, _, _, clock := entryTestSetup(c)
+
+	var (
+		mu     sync.Mutex
+		events []NeighborEvent
+	)
+	unsubscribe := e.nic.stack.SubscribeNeighborEvents(func(ev NeighborEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+	})
+
+	e.mu.Lock()
+	e.handlePacketQueuedLocked(entryTestAddr2)
+	e.mu.Unlock()
+	runImmediatelyScheduledJobs(clock)
+
+	e.mu.Lock()
+	e.handleConfirmationLocked(entryTestLinkAddr1, ReachabilityConfirmationFlags{
+		Solicited: true,
+		Override:  false,
+		IsRouter:  false,
+	})
+	// Confirming a reachable entry again doesn't change its state.
+	e.handleUpperLevelConfirmationLocked()
+	e.mu.Unlock()
+
+	clock.Advance(c.BaseReachableTime)
+
+	// Transitions after unsubscribing aren't reported.
+	unsubscribe()
+	e.mu.Lock()
+	e.handlePacketQueuedLocked(entryTestAddr2)
+	if got, want := e.neigh.State, Delay; got != want {
+		t.Errorf("got e.neigh.State = %q, want = %q", got, want)
+	}
+	e.mu.Unlock()
+
+	wantEvents := []NeighborEvent{
+		{
+			NICID: entryTestNICID,
+			Entry: NeighborEntry{
+				Addr:  entryTestAddr1,
+				State: Incomplete,
+			},
+			PrevState: Unknown,
+			Reason:    NeighborEventPacketQueued,
+		},
+		{
+			NICID: entryTestNICID,
+			Entry: NeighborEntry{
+				Addr:     entryTestAddr1,
+				LinkAddr: entryTestLinkAddr1,
+				State:    Reachable,
+			},
+			PrevState: Incomplete,
+			Reason:    NeighborEventConfirmed,
+		},
+		{
+			NICID: entryTestNICID,
+			Entry: NeighborEntry{
+				Addr:     entryTestAddr1,
+				LinkAddr: entryTestLinkAddr1,
+				State:    Stale,
+			},
+			PrevState: Reachable,
+			Reason:    NeighborEventTimeout,
+		},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := cmp.Diff(wantEvents, events, eventDiffOpts()...); diff != "" {
+		t.Errorf("neighbor events mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestEntryReachableToStaleWhenProbeWithDifferentAddress(t *testing.T) {
 	c := DefaultNUDConfigurations()
 	e, nudDisp, linkRes, clock := entryTestSetup(c)
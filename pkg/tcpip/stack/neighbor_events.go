@@ -0,0 +1,192 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// NeighborEventReason is the cause of a neighbor state transition.
+type NeighborEventReason int
+
+const (
+	// NeighborEventPacketQueued means that a packet was sent to the neighbor,
+	// starting address resolution (Unknown to Incomplete) or reachability
+	// confirmation (Stale to Delay).
+	NeighborEventPacketQueued NeighborEventReason = iota
+
+	// NeighborEventConfirmed means that a reachability confirmation was
+	// received, e.g. a solicited ARP reply or Neighbor Advertisement.
+	NeighborEventConfirmed
+
+	// NeighborEventUnsolicited means that an unsolicited or conflicting
+	// advertisement was received for the neighbor.
+	NeighborEventUnsolicited
+
+	// NeighborEventProbeReceived means that a probe was received from the
+	// neighbor, e.g. an ARP request or Neighbor Solicitation.
+	NeighborEventProbeReceived
+
+	// NeighborEventUpperLevelConfirmed means that an upper-level protocol,
+	// like TCP, confirmed reachability of the neighbor.
+	NeighborEventUpperLevelConfirmed
+
+	// NeighborEventTimeout means that a NUD timer expired, e.g. the
+	// reachable time of the entry or the delay before probing.
+	NeighborEventTimeout
+
+	// NeighborEventResolutionFailed means that the neighbor didn't answer
+	// any of the probes sent to it.
+	NeighborEventResolutionFailed
+
+	// NeighborEventStatic means that the entry was added by the user.
+	NeighborEventStatic
+
+	// NeighborEventRemoved means that the entry was removed from the cache,
+	// either by the user, to make room for another entry, or once a failed
+	// entry expired.
+	NeighborEventRemoved
+
+	// NeighborEventConflict means that another link address was advertised
+	// for a protected neighbor and ignored. The entry is unchanged.
+	NeighborEventConflict
+)
+
+// String implements fmt.Stringer.
+func (r NeighborEventReason) String() string {
+	switch r {
+	case NeighborEventPacketQueued:
+		return "packet-queued"
+	case NeighborEventConfirmed:
+		return "confirmed"
+	case NeighborEventUnsolicited:
+		return "unsolicited"
+	case NeighborEventProbeReceived:
+		return "probe-received"
+	case NeighborEventUpperLevelConfirmed:
+		return "upper-level-confirmed"
+	case NeighborEventTimeout:
+		return "timeout"
+	case NeighborEventResolutionFailed:
+		return "resolution-failed"
+	case NeighborEventStatic:
+		return "static"
+	case NeighborEventRemoved:
+		return "removed"
+	case NeighborEventConflict:
+		return "conflict"
+	default:
+		return fmt.Sprintf("NeighborEventReason(%d)", int(r))
+	}
+}
+
+// NeighborEvent describes a transition of a neighbor entry between the states
+// of the Neighbor Unreachability Detection state machine.
+type NeighborEvent struct {
+	// NICID is the NIC whose neighbor table holds the entry.
+	NICID tcpip.NICID
+
+	// Entry is the entry after the transition. Its state is Unknown if the
+	// entry was removed.
+	Entry NeighborEntry
+
+	// PrevState is the state of the entry before the transition.
+	PrevState NeighborState
+
+	// Reason is the cause of the transition.
+	Reason NeighborEventReason
+
+	// ConflictingLinkAddr is the link address advertised for the neighbor,
+	// if Reason is NeighborEventConflict.
+	ConflictingLinkAddr tcpip.LinkAddress
+}
+
+// neighborSubscriber is a callback registered with SubscribeNeighborEvents.
+type neighborSubscriber struct {
+	fn func(NeighborEvent)
+}
+
+// neighborSubscribers holds the subscribers to neighbor events of a stack.
+type neighborSubscribers struct {
+	mu   sync.RWMutex
+	subs map[*neighborSubscriber]struct{}
+}
+
+// SubscribeNeighborEvents registers fn to be called on every state transition
+// of an entry in the neighbor table of any NIC. It returns a function that
+// cancels the subscription.
+//
+// Unlike a NUDDispatcher, which is fixed when the stack is created,
+// subscribers may come and go at any time. Neighbor tables are only maintained
+// when the stack is created with Options.UseNeighborCache.
+//
+// fn is called synchronously with the neighbor entry locked, so it must not
+// block nor call back into the stack. May be called concurrently.
+func (s *Stack) SubscribeNeighborEvents(fn func(NeighborEvent)) (unsubscribe func()) {
+	sub := &neighborSubscriber{fn: fn}
+	n := &s.neighborSubs
+	n.mu.Lock()
+	if n.subs == nil {
+		n.subs = make(map[*neighborSubscriber]struct{})
+	}
+	n.subs[sub] = struct{}{}
+	n.mu.Unlock()
+
+	return func() {
+		n.mu.Lock()
+		delete(n.subs, sub)
+		n.mu.Unlock()
+	}
+}
+
+// CheckNeighborConflict returns true if the neighbor entry of addr in the
+// neighbor table of NIC nicID holds a link address other than linkAddr. The
+// conflict is then reported to the subscribers of neighbor events with a
+// NeighborEventConflict event.
+func (s *Stack) CheckNeighborConflict(nicID tcpip.NICID, addr tcpip.Address, linkAddr tcpip.LinkAddress) bool {
+	entries, err := s.Neighbors(nicID)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Addr != addr {
+			continue
+		}
+		if len(entry.LinkAddr) == 0 || entry.LinkAddr == linkAddr {
+			return false
+		}
+		s.neighborSubs.notify(NeighborEvent{
+			NICID:               nicID,
+			Entry:               entry,
+			PrevState:           entry.State,
+			Reason:              NeighborEventConflict,
+			ConflictingLinkAddr: linkAddr,
+		})
+		return true
+	}
+	return false
+}
+
+// notify calls all subscribers with ev.
+func (n *neighborSubscribers) notify(ev NeighborEvent) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for sub := range n.subs {
+		sub.fn(ev)
+	}
+}
@@ -38,6 +38,9 @@ type NIC struct {
 	name    string
 	context NICContext
 
+	// group is the group of the NIC. It is protected by stack.mu.
+	group tcpip.NICGroupID
+
 	stats NICStats
 	neigh *neighborCache
 
@@ -56,18 +59,80 @@ type NIC struct {
 		promiscuous bool
 		// packetEPs is protected by mu, but the contained PacketEndpoint
 		// values are not.
-		packetEPs map[tcpip.NetworkProtocolNumber][]PacketEndpoint
+		packetEPs   map[tcpip.NetworkProtocolNumber][]PacketEndpoint
+		mirror      nicMirror
+		classifiers [numTCAttachPoints]PacketClassifier
+
+		// multicastBoundary is the widest multicast scope not forwarded to or
+		// from the NIC, or 0 if the NIC isn't a scope boundary.
+		multicastBoundary header.MulticastScope
+
+		// rpFilter is the reverse path filtering mode of the NIC.
+		rpFilter RPFilterMode
+
+		// logMartians is true if the martian packets received on the NIC
+		// are logged.
+		logMartians bool
 	}
 }
 
 // NICStats hold statistics for a NIC.
 type NICStats struct {
 	Tx DirectionStats
+
+	// TxErrors is the number of packets the link endpoint failed to write.
+	TxErrors *tcpip.StatCounter
+
+	// TxDropped is the number of outgoing packets dropped before reaching
+	// the link endpoint, because the link address of their next hop
+	// couldn't be resolved.
+	TxDropped *tcpip.StatCounter
+
 	Rx DirectionStats
 
+	// RxDropped is the number of received packets dropped because the NIC
+	// was disabled or had no endpoint for their network protocol.
+	RxDropped *tcpip.StatCounter
+
+	// RxMulticast is the number of received packets sent to a multicast
+	// link address.
+	RxMulticast *tcpip.StatCounter
+
 	DisabledRx DirectionStats
 
 	Neighbor NeighborStats
+
+	LinkResolution LinkResolutionStats
+
+	Forwarding ForwardingStats
+
+	Martians MartianStats
+}
+
+// ForwardingStats holds statistics about the packets a NIC forwards.
+type ForwardingStats struct {
+	// Forwarded is the number of packets forwarded out of the NIC.
+	Forwarded *tcpip.StatCounter
+
+	// HopLimitExceeded is the number of packets received by the NIC that were
+	// not forwarded because their TTL or hop limit expired.
+	HopLimitExceeded *tcpip.StatCounter
+}
+
+// LinkResolutionStats holds statistics about outgoing packets queued while
+// waiting for the link address of their next hop to be resolved.
+type LinkResolutionStats struct {
+	// Queued is the number of packets queued while waiting for link
+	// resolution.
+	Queued *tcpip.StatCounter
+
+	// DroppedQueueFull is the number of queued packets dropped to keep the
+	// queue of a neighbor, or all queues, within their bounds.
+	DroppedQueueFull *tcpip.StatCounter
+
+	// DroppedResolutionFailed is the number of queued packets dropped
+	// because link resolution failed or was cancelled.
+	DroppedResolutionFailed *tcpip.StatCounter
 }
 
 func makeNICStats() NICStats {
@@ -110,7 +175,7 @@ func newNIC(stack *Stack, id tcpip.NICID, name string, ep LinkEndpoint, ctx NICC
 		rng := rand.New(rand.NewSource(stack.clock.NowNanoseconds()))
 		nic.neigh = &neighborCache{
 			nic:   nic,
-			state: NewNUDState(stack.nudConfigs, rng),
+			state: NewNUDState(stack.nudConfigs, stack.clock, rng),
 			cache: make(map[tcpip.Address]*neighborEntry, neighborCacheSize),
 		}
 
@@ -206,6 +271,7 @@ func (n *NIC) enable() *tcpip.Error {
 		}
 	}
 
+	n.announceAllAddresses()
 	return nil
 }
 
@@ -222,6 +288,11 @@ func (n *NIC) remove() *tcpip.Error {
 		ep.Close()
 	}
 
+	// Stop the neighbor unreachability detection timers of all entries.
+	if n.neigh != nil {
+		n.neigh.clear()
+	}
+
 	// Detach from link endpoint, so no packet comes in.
 	n.LinkEndpoint.Attach(nil)
 	return nil
@@ -286,10 +357,19 @@ func (n *NIC) WritePacketToRemote(remoteLinkAddr tcpip.LinkAddress, gso *GSO, pr
 }
 
 func (n *NIC) writePacket(r *Route, gso *GSO, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) *tcpip.Error {
+	if c := n.classifier(TCEgress); c != nil && !n.classify(c, TCEgress, r.RemoteLinkAddress, n.localLinkAddress(r), protocol, pkt) {
+		return nil
+	}
+
 	// WritePacket takes ownership of pkt, calculate numBytes first.
 	numBytes := pkt.Size()
 
+	if m := n.mirror(); m.opts.Direction&MirrorEgress != 0 {
+		n.mirrorPacket(m, MirrorEgress, r.RemoteLinkAddress, n.localLinkAddress(r), protocol, pkt)
+	}
+
 	if err := n.LinkEndpoint.WritePacket(r, gso, protocol, pkt); err != nil {
+		n.stats.TxErrors.Increment()
 		return err
 	}
 
@@ -302,7 +382,30 @@ func (n *NIC) writePacket(r *Route, gso *GSO, protocol tcpip.NetworkProtocolNumb
 func (n *NIC) WritePackets(r *Route, gso *GSO, pkts PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
 	// TODO(gvisor.dev/issue/4458): Queue packets whie link address resolution
 	// is being peformed like WritePacket.
+	classified := 0
+	if c := n.classifier(TCEgress); c != nil {
+		for pkt := pkts.Front(); pkt != nil; {
+			next := pkt.Next()
+			if !n.classify(c, TCEgress, r.RemoteLinkAddress, n.localLinkAddress(r), protocol, pkt) {
+				pkts.Remove(pkt)
+				classified++
+			}
+			pkt = next
+		}
+		// Packets which didn't go through are handled.
+		if pkts.Front() == nil {
+			return classified, nil
+		}
+	}
+	if m := n.mirror(); m.opts.Direction&MirrorEgress != 0 {
+		for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
+			n.mirrorPacket(m, MirrorEgress, r.RemoteLinkAddress, n.localLinkAddress(r), protocol, pkt)
+		}
+	}
 	writtenPackets, err := n.LinkEndpoint.WritePackets(r, gso, pkts, protocol)
+	if err != nil {
+		n.stats.TxErrors.Increment()
+	}
 	n.stats.Tx.Packets.IncrementBy(uint64(writtenPackets))
 	writtenBytes := 0
 	for i, pb := 0, pkts.Front(); i < writtenPackets && pb != nil; i, pb = i+1, pb.Next() {
@@ -310,7 +413,23 @@ func (n *NIC) WritePackets(r *Route, gso *GSO, pkts PacketBufferList, protocol t
 	}
 
 	n.stats.Tx.Bytes.IncrementBy(uint64(writtenBytes))
-	return writtenPackets, err
+	return classified + writtenPackets, err
+}
+
+// mirror returns the mirroring configuration of n.
+func (n *NIC) mirror() nicMirror {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mu.mirror
+}
+
+// localLinkAddress returns the source link address of packets sent by n
+// through r.
+func (n *NIC) localLinkAddress(r *Route) tcpip.LinkAddress {
+	if r.LocalLinkAddress != "" {
+		return r.LocalLinkAddress
+	}
+	return n.LinkEndpoint.LinkAddress()
 }
 
 // setSpoofing enables or disables address spoofing.
@@ -320,6 +439,42 @@ func (n *NIC) setSpoofing(enable bool) {
 	n.mu.Unlock()
 }
 
+func (n *NIC) setMulticastBoundary(scope header.MulticastScope) {
+	n.mu.Lock()
+	n.mu.multicastBoundary = scope
+	n.mu.Unlock()
+}
+
+func (n *NIC) multicastBoundary() header.MulticastScope {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mu.multicastBoundary
+}
+
+func (n *NIC) setRPFilter(mode RPFilterMode) {
+	n.mu.Lock()
+	n.mu.rpFilter = mode
+	n.mu.Unlock()
+}
+
+func (n *NIC) rpFilter() RPFilterMode {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mu.rpFilter
+}
+
+func (n *NIC) setLogMartians(enable bool) {
+	n.mu.Lock()
+	n.mu.logMartians = enable
+	n.mu.Unlock()
+}
+
+func (n *NIC) logMartians() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mu.logMartians
+}
+
 // primaryAddress returns an address that can be used to communicate with
 // remoteAddr.
 func (n *NIC) primaryEndpoint(protocol tcpip.NetworkProtocolNumber, remoteAddr tcpip.Address) AssignableAddressEndpoint {
@@ -423,11 +578,37 @@ func (n *NIC) addAddress(protocolAddress tcpip.ProtocolAddress, peb PrimaryEndpo
 	}
 
 	addressEndpoint, err := addressableEndpoint.AddAndAcquirePermanentAddress(protocolAddress.AddressWithPrefix, peb, AddressConfigStatic, false /* deprecated */)
-	if err == nil {
-		// We have no need for the address endpoint.
-		addressEndpoint.DecRef()
+	if err != nil {
+		return err
+	}
+	// We have no need for the address endpoint.
+	addressEndpoint.DecRef()
+
+	n.announceAddresses([]tcpip.Address{protocolAddress.AddressWithPrefix.Address})
+	return nil
+}
+
+// announceAddresses announces addrs to the neighbors of n, through the network
+// endpoints which support it.
+func (n *NIC) announceAddresses(addrs []tcpip.Address) {
+	if len(addrs) == 0 || !n.Enabled() {
+		return
+	}
+	for _, ep := range n.networkEndpoints {
+		if announcer, ok := ep.(AddressAnnouncer); ok {
+			announcer.AnnounceAddresses(addrs)
+		}
 	}
-	return err
+}
+
+// announceAllAddresses announces all permanent addresses of n to its
+// neighbors.
+func (n *NIC) announceAllAddresses() {
+	var addrs []tcpip.Address
+	for _, a := range n.allPermanentAddresses() {
+		addrs = append(addrs, a.AddressWithPrefix.Address)
+	}
+	n.announceAddresses(addrs)
 }
 
 // allPermanentAddresses returns all permanent addresses associated with
@@ -605,6 +786,12 @@ func (n *NIC) isInGroup(addr tcpip.Address) bool {
 // This rule applies only to the slice itself, not to the items of the slice;
 // the ownership of the items is not retained by the caller.
 func (n *NIC) DeliverNetworkPacket(remote, local tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) {
+	n.deliverNetworkPacket(remote, local, protocol, pkt, true /* classify */)
+}
+
+// deliverNetworkPacket implements DeliverNetworkPacket. The packet is
+// classified at the ingress attach point only if classify is true.
+func (n *NIC) deliverNetworkPacket(remote, local tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer, classify bool) {
 	n.mu.RLock()
 	enabled := n.Enabled()
 	// If the NIC is not yet enabled, don't receive any packets.
@@ -613,16 +800,21 @@ func (n *NIC) DeliverNetworkPacket(remote, local tcpip.LinkAddress, protocol tcp
 
 		n.stats.DisabledRx.Packets.Increment()
 		n.stats.DisabledRx.Bytes.IncrementBy(uint64(pkt.Data.Size()))
+		n.stats.RxDropped.Increment()
 		return
 	}
 
 	n.stats.Rx.Packets.Increment()
 	n.stats.Rx.Bytes.IncrementBy(uint64(pkt.Data.Size()))
+	if header.IsMulticastEthernetAddress(local) {
+		n.stats.RxMulticast.Increment()
+	}
 
 	networkEndpoint, ok := n.networkEndpoints[protocol]
 	if !ok {
 		n.mu.RUnlock()
 		n.stack.stats.UnknownProtocolRcvdPackets.Increment()
+		n.stats.RxDropped.Increment()
 		return
 	}
 
@@ -637,13 +829,21 @@ func (n *NIC) DeliverNetworkPacket(remote, local tcpip.LinkAddress, protocol tcp
 	packetEPs := n.mu.packetEPs[protocol]
 	// Add any other packet type sockets that may be listening for all protocols.
 	packetEPs = append(packetEPs, n.mu.packetEPs[header.EthernetProtocolAll]...)
+	m := n.mu.mirror
+	c := n.mu.classifiers[TCIngress]
 	n.mu.RUnlock()
+	n.mirrorPacket(m, MirrorIngress, remote, local, protocol, pkt)
 	for _, ep := range packetEPs {
 		p := pkt.Clone()
 		p.PktType = tcpip.PacketHost
 		ep.HandlePacket(n.id, local, protocol, p)
 	}
 
+	// Like on Linux, packets are classified once packet sockets got them.
+	if classify && c != nil && !n.classify(c, TCIngress, remote, local, protocol, pkt) {
+		return
+	}
+
 	// Parse headers.
 	netProto := n.stack.NetworkProtocolInstance(protocol)
 	transProtoNum, hasTransportHdr, ok := netProto.Parse(pkt)
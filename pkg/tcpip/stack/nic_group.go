@@ -0,0 +1,53 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// SetNICGroup moves the NICs ids to group. The NICs are moved atomically: route
+// lookups see either all of them or none of them in group, and none is moved
+// if one of them doesn't exist.
+//
+// Routes already held by endpoints are not affected; only the routes looked up
+// afterwards are.
+func (s *Stack) SetNICGroup(group tcpip.NICGroupID, ids ...tcpip.NICID) *tcpip.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := s.nics[id]; !ok {
+			return tcpip.ErrUnknownNICID
+		}
+	}
+	for _, id := range ids {
+		s.nics[id].group = group
+	}
+	s.flowCache.flush()
+	return nil
+}
+
+// NICGroup returns the group of NIC id.
+func (s *Stack) NICGroup(id tcpip.NICID) (tcpip.NICGroupID, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return 0, tcpip.ErrUnknownNICID
+	}
+	return nic.group, nil
+}
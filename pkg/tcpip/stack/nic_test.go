@@ -214,6 +214,9 @@ func TestDisabledRxStatsWhenNICDisabled(t *testing.T) {
 	if got := nic.stats.DisabledRx.Bytes.Value(); got != 4 {
 		t.Errorf("got DisabledRx.Bytes = %d, want = 4", got)
 	}
+	if got := nic.stats.RxDropped.Value(); got != 1 {
+		t.Errorf("got RxDropped = %d, want = 1", got)
+	}
 	if got := nic.stats.Rx.Packets.Value(); got != 0 {
 		t.Errorf("got Rx.Packets = %d, want = 0", got)
 	}
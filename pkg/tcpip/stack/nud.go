@@ -356,7 +356,8 @@ type Rand interface {
 
 // NUDState stores states needed for calculating reachable time.
 type NUDState struct {
-	rng Rand
+	clock tcpip.Clock
+	rng   Rand
 
 	// mu protects the fields below.
 	//
@@ -380,11 +381,12 @@ type NUDState struct {
 	prevMaxRandomFactor   float32
 }
 
-// NewNUDState returns new NUDState using c as configuration and the specified
-// random number generator for use in recomputing ReachableTime.
-func NewNUDState(c NUDConfigurations, rng Rand) *NUDState {
+// NewNUDState returns new NUDState using c as configuration, and the specified
+// clock and random number generator for use in recomputing ReachableTime.
+func NewNUDState(c NUDConfigurations, clock tcpip.Clock, rng Rand) *NUDState {
 	s := &NUDState{
-		rng: rng,
+		clock: clock,
+		rng:   rng,
 	}
 	s.config = c
 	return s
@@ -412,7 +414,7 @@ func (s *NUDState) ReachableTime() time.Duration {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if time.Now().After(s.expiration) ||
+	if s.clock.Now().After(s.expiration) ||
 		s.config.BaseReachableTime != s.prevBaseReachableTime ||
 		s.config.MinRandomFactor != s.prevMinRandomFactor ||
 		s.config.MaxRandomFactor != s.prevMaxRandomFactor {
@@ -461,6 +463,6 @@ func (s *NUDState) recomputeReachableTimeLocked() time.Duration {
 		s.reachableTime = time.Duration(reachableTime)
 	}
 
-	s.expiration = time.Now().Add(2 * time.Hour)
+	s.expiration = s.clock.Now().Add(2 * time.Hour)
 	return s.reachableTime
 }
@@ -704,7 +704,7 @@ func TestNUDStateReachableTime(t *testing.T) {
 			rng := fakeRand{
 				num: defaultFakeRandomNum,
 			}
-			s := stack.NewNUDState(c, &rng)
+			s := stack.NewNUDState(c, &tcpip.StdClock{}, &rng)
 			if got, want := s.ReachableTime(), test.want; got != want {
 				t.Errorf("got ReachableTime = %q, want = %q", got, want)
 			}
@@ -776,7 +776,7 @@ func TestNUDStateRecomputeReachableTime(t *testing.T) {
 			rng := fakeRand{
 				num: defaultFakeRandomNum,
 			}
-			s := stack.NewNUDState(c, &rng)
+			s := stack.NewNUDState(c, &tcpip.StdClock{}, &rng)
 			old := s.ReachableTime()
 
 			if got, want := s.ReachableTime(), old; got != want {
@@ -100,6 +100,11 @@ type PacketBuffer struct {
 	// Only set for locally generated packets.
 	Owner tcpip.PacketOwner
 
+	// Priority is the priority of the packet, as set with SO_PRIORITY on the
+	// socket it is sent from. It is used by queueing disciplines to classify
+	// outbound packets.
+	Priority uint32
+
 	// The following fields are only set by the qdisc layer when the packet
 	// is added to a queue.
 	EgressRoute *Route
@@ -257,6 +262,7 @@ func (pk *PacketBuffer) Clone() *PacketBuffer {
 		header:                       pk.header,
 		Hash:                         pk.Hash,
 		Owner:                        pk.Owner,
+		Priority:                     pk.Priority,
 		GSOOptions:                   pk.GSOOptions,
 		NetworkProtocolNumber:        pk.NetworkProtocolNumber,
 		NatDone:                      pk.NatDone,
@@ -279,10 +285,10 @@ func (pk *PacketBuffer) SourceLinkAddress() tcpip.LinkAddress {
 	return header.Ethernet(link).SourceAddress()
 }
 
-// Network returns the network header as a header.Network.
+// Network returns the network header as a header.ChecksummableNetwork.
 //
 // Network should only be called when NetworkHeader has been set.
-func (pk *PacketBuffer) Network() header.Network {
+func (pk *PacketBuffer) Network() header.ChecksummableNetwork {
 	switch netProto := pk.NetworkProtocolNumber; netProto {
 	case header.IPv4ProtocolNumber:
 		return header.IPv4(pk.NetworkHeader().View())
@@ -293,6 +299,18 @@ func (pk *PacketBuffer) Network() header.Network {
 	}
 }
 
+// TTL returns the TTL of the network packet, which is its hop limit for IPv6.
+func (pk *PacketBuffer) TTL() uint8 {
+	switch netProto := pk.NetworkProtocolNumber; netProto {
+	case header.IPv4ProtocolNumber:
+		return header.IPv4(pk.NetworkHeader().View()).TTL()
+	case header.IPv6ProtocolNumber:
+		return header.IPv6(pk.NetworkHeader().View()).HopLimit()
+	default:
+		panic(fmt.Sprintf("unknown network protocol number %d", netProto))
+	}
+}
+
 // CloneToInbound makes a shallow copy of the packet buffer to be used as an
 // inbound packet.
 //
@@ -0,0 +1,280 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// TimersResumedEndpoint is an endpoint which measures the time elapsed since
+// past events, e.g. to detect an unresponsive peer, and must therefore discount
+// the time during which the timers of the stack were paused.
+type TimersResumedEndpoint interface {
+	// TimersResumed is called once the timers of the stack are resumed,
+	// after having been paused for the given duration.
+	TimersResumed(paused time.Duration)
+}
+
+// PauseTimers pauses all the timers of the stack, which are those scheduled on
+// its clock: TCP retransmission and keepalive timers, IGMP and MLD reports,
+// NDP and neighbor cache jobs, etc. The monotonic time of the clock stops
+// advancing, and timers expiring while paused are held until ResumeTimers is
+// called. PauseTimers returns once the timers that already fired have
+// completed.
+//
+// It is meant to quiesce the stack around a save, so that no timer modifies
+// the state being saved, and so that the time spent saving doesn't expire
+// timers or make peers look unresponsive.
+func (s *Stack) PauseTimers() {
+	s.timers.pause()
+}
+
+// ResumeTimers resumes the timers paused by PauseTimers. The timers fire after
+// the time they had left when they were paused, so that they don't all expire
+// at once. It is a no-op if the timers aren't paused.
+func (s *Stack) ResumeTimers() {
+	paused := s.timers.resume()
+	if paused == 0 {
+		return
+	}
+	for _, e := range s.RegisteredEndpoints() {
+		if e, ok := e.(TimersResumedEndpoint); ok {
+			e.TimersResumed(paused)
+		}
+	}
+}
+
+// pausableClock is a tcpip.Clock whose monotonic time and timers can be
+// paused. Its monotonic time is the one of the underlying clock, minus the time
+// spent paused; timers expire according to it.
+type pausableClock struct {
+	// clock is the underlying clock. It is immutable.
+	clock tcpip.Clock
+
+	mu sync.RWMutex
+
+	// paused is true while the clock is paused. pausedAt is the monotonic
+	// time of the underlying clock at which it was paused.
+	paused   bool
+	pausedAt int64
+
+	// offset is the total duration for which the clock was paused.
+	offset int64
+
+	// held holds the timers which fired while the clock was paused.
+	held []heldTimer
+
+	// running counts the timer functions being run.
+	running sync.WaitGroup
+}
+
+var _ tcpip.Clock = (*pausableClock)(nil)
+
+// heldTimer is a timer held by a paused clock.
+type heldTimer struct {
+	timer *pausableTimer
+	gen   uint64
+}
+
+func newPausableClock(clock tcpip.Clock) *pausableClock {
+	return &pausableClock{clock: clock}
+}
+
+// NowNanoseconds implements tcpip.Clock.NowNanoseconds. The real time is never
+// paused.
+func (c *pausableClock) NowNanoseconds() int64 {
+	return c.clock.NowNanoseconds()
+}
+
+// Now implements tcpip.Clock.Now. Like the real time, it is never paused: the
+// endpoints measuring durations with it discount the time spent paused once
+// resumed (see TimersResumedEndpoint).
+func (c *pausableClock) Now() time.Time {
+	return c.clock.Now()
+}
+
+// NowMonotonic implements tcpip.Clock.NowMonotonic.
+func (c *pausableClock) NowMonotonic() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nowLocked()
+}
+
+// nowLocked returns the monotonic time of c.
+//
+// Preconditions: c.mu must be locked.
+func (c *pausableClock) nowLocked() int64 {
+	if c.paused {
+		return c.pausedAt - c.offset
+	}
+	return c.clock.NowMonotonic() - c.offset
+}
+
+// AfterFunc implements tcpip.Clock.AfterFunc.
+func (c *pausableClock) AfterFunc(d time.Duration, f func()) tcpip.Timer {
+	t := &pausableTimer{
+		clock: c,
+		f:     f,
+	}
+	t.Reset(d)
+	return t
+}
+
+// pause pauses c, and waits for the timer functions being run to complete.
+func (c *pausableClock) pause() {
+	c.mu.Lock()
+	if c.paused {
+		c.mu.Unlock()
+		return
+	}
+	c.paused = true
+	c.pausedAt = c.clock.NowMonotonic()
+	c.mu.Unlock()
+
+	c.running.Wait()
+}
+
+// resume resumes c and the timers it held, and returns the duration for which
+// c was paused.
+func (c *pausableClock) resume() time.Duration {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return 0
+	}
+	paused := c.clock.NowMonotonic() - c.pausedAt
+	c.offset += paused
+	c.paused = false
+	held := c.held
+	c.held = nil
+	c.mu.Unlock()
+
+	for _, h := range held {
+		h.timer.rearm(h.gen)
+	}
+	return time.Duration(paused)
+}
+
+// pausableTimer is a timer of a pausableClock. It is backed by a timer of the
+// underlying clock, which is rearmed when it fires before the timer expires,
+// as happens once the clock has been paused.
+type pausableTimer struct {
+	// clock and f are immutable.
+	clock *pausableClock
+	f     func()
+
+	mu sync.Mutex
+
+	// timer is the timer of the underlying clock.
+	timer tcpip.Timer
+
+	// deadline is the monotonic time of the clock at which the timer
+	// expires.
+	deadline int64
+
+	// gen is incremented whenever the timer is stopped, reset or expires,
+	// so that stale firings of the underlying timer are ignored.
+	gen uint64
+
+	// active is true if the timer hasn't been stopped and hasn't expired.
+	active bool
+}
+
+var _ tcpip.Timer = (*pausableTimer)(nil)
+
+// Stop implements tcpip.Timer.Stop.
+func (t *pausableTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active {
+		return false
+	}
+	t.active = false
+	t.gen++
+	t.timer.Stop()
+	return true
+}
+
+// Reset implements tcpip.Timer.Reset.
+func (t *pausableTimer) Reset(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.active = true
+	t.gen++
+	t.deadline = t.clock.NowMonotonic() + int64(d)
+	t.armLocked(d)
+}
+
+// armLocked arms the underlying timer to fire after d.
+//
+// Preconditions: t.mu must be locked.
+func (t *pausableTimer) armLocked(d time.Duration) {
+	gen := t.gen
+	t.timer = t.clock.clock.AfterFunc(d, func() {
+		t.fire(gen)
+	})
+}
+
+// rearm rearms a timer held by the clock for the time it has left.
+func (t *pausableTimer) rearm(gen uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if gen != t.gen {
+		return
+	}
+	d := time.Duration(t.deadline - t.clock.NowMonotonic())
+	if d < 0 {
+		d = 0
+	}
+	t.armLocked(d)
+}
+
+// fire is called when the underlying timer fires.
+func (t *pausableTimer) fire(gen uint64) {
+	c := t.clock
+	t.mu.Lock()
+	if gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+	c.mu.Lock()
+	if c.paused {
+		c.held = append(c.held, heldTimer{timer: t, gen: gen})
+		c.mu.Unlock()
+		t.mu.Unlock()
+		return
+	}
+	if d := time.Duration(t.deadline - c.nowLocked()); d > 0 {
+		c.mu.Unlock()
+		t.armLocked(d)
+		t.mu.Unlock()
+		return
+	}
+	// Added while c.mu is locked, so that pause waits for f.
+	c.running.Add(1)
+	c.mu.Unlock()
+	t.active = false
+	t.gen++
+	t.mu.Unlock()
+
+	defer c.running.Done()
+	t.f()
+}
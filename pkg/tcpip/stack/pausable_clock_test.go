@@ -0,0 +1,72 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+)
+
+func TestPausableClock(t *testing.T) {
+	clock := faketime.NewManualClock()
+	c := newPausableClock(clock)
+
+	var fired [3]int32
+	c.AfterFunc(time.Second, func() { atomic.AddInt32(&fired[0], 1) })
+	c.AfterFunc(3*time.Second, func() { atomic.AddInt32(&fired[1], 1) })
+	stopped := c.AfterFunc(2*time.Second, func() { atomic.AddInt32(&fired[2], 1) })
+
+	check := func(want [3]int32) {
+		t.Helper()
+		for i := range fired {
+			if got := atomic.LoadInt32(&fired[i]); got != want[i] {
+				t.Errorf("got fired[%d] = %d, want = %d", i, got, want[i])
+			}
+		}
+	}
+
+	start := c.NowMonotonic()
+	c.pause()
+	clock.Advance(10 * time.Second)
+	check([3]int32{0, 0, 0})
+	if got := time.Duration(c.NowMonotonic() - start); got != 0 {
+		t.Errorf("got monotonic time elapsed while paused = %s, want = 0", got)
+	}
+	if !stopped.Stop() {
+		t.Error("got stopped.Stop() = false, want = true")
+	}
+
+	if got, want := c.resume(), 10*time.Second; got != want {
+		t.Errorf("got c.resume() = %s, want = %s", got, want)
+	}
+	// The timers fire after the time they had left when paused.
+	clock.Advance(time.Second - time.Nanosecond)
+	check([3]int32{0, 0, 0})
+	clock.Advance(time.Nanosecond)
+	check([3]int32{1, 0, 0})
+	clock.Advance(2 * time.Second)
+	check([3]int32{1, 1, 0})
+	if got, want := time.Duration(c.NowMonotonic()-start), 3*time.Second; got != want {
+		t.Errorf("got monotonic time elapsed = %s, want = %s", got, want)
+	}
+
+	// Resuming a running clock is a no-op.
+	if got := c.resume(); got != 0 {
+		t.Errorf("got c.resume() = %s, want = 0", got)
+	}
+}
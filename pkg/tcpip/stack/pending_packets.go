@@ -17,6 +17,7 @@ package stack
 import (
 	"fmt"
 
+	"golang.org/x/time/rate"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 )
@@ -24,10 +25,39 @@ import (
 const (
 	// maxPendingResolutions is the maximum number of pending link-address
 	// resolutions.
-	maxPendingResolutions          = 64
+	maxPendingResolutions = 64
+
+	// maxPendingPacketsPerResolution is the maximum number of packets
+	// queued for a single neighbor.
 	maxPendingPacketsPerResolution = 256
+
+	// maxPendingPackets is the maximum number of packets queued across all
+	// pending link-address resolutions.
+	maxPendingPackets = 1024
+
+	// linkResRetryLimit is the maximum number of link-address request
+	// retransmissions permitted per second, across all neighbors.
+	linkResRetryLimit = 100
+
+	// linkResRetryBurst is the number of link-address request
+	// retransmissions that can be sent in a single burst.
+	linkResRetryBurst = 50
 )
 
+// newLinkResRetryLimiter returns a rate limiter pacing retransmissions of
+// link-address requests, so that bursts of packets to many unresolved
+// destinations don't flood the link with ARP requests or Neighbor
+// Solicitations. The first request for a neighbor is never rate limited.
+func newLinkResRetryLimiter() *rate.Limiter {
+	return rate.NewLimiter(linkResRetryLimit, linkResRetryBurst)
+}
+
+// allowLinkResRetry returns true if a link-address request may be retransmitted
+// at this instant.
+func (s *Stack) allowLinkResRetry() bool {
+	return s.linkResRetryLimiter == nil || s.linkResRetryLimiter.AllowN(s.clock.Now(), 1)
+}
+
 type pendingPacket struct {
 	route *Route
 	proto tcpip.NetworkProtocolNumber
@@ -37,15 +67,26 @@ type pendingPacket struct {
 // packetsPendingLinkResolution is a queue of packets pending link resolution.
 //
 // Once link resolution completes successfully, the packets will be written.
+//
+// The queue of each neighbor is bounded, as is the total number of queued
+// packets. When the total bound is reached, the oldest packet of the longest
+// queue is dropped, so that a burst of packets to one unresolved neighbor
+// doesn't cause packets to other neighbors to be dropped.
 type packetsPendingLinkResolution struct {
 	sync.Mutex
 
 	// The packets to send once the resolver completes.
 	packets map[<-chan struct{}][]pendingPacket
 
+	// count is the total number of packets in packets.
+	count int
+
 	// FIFO of channels used to cancel the oldest goroutine waiting for
 	// link-address resolution.
 	cancelChans []chan struct{}
+
+	// waiters tracks the goroutines waiting for link-address resolution.
+	waiters sync.WaitGroup
 }
 
 func (f *packetsPendingLinkResolution) init() {
@@ -58,24 +99,28 @@ func (f *packetsPendingLinkResolution) enqueue(ch <-chan struct{}, r *Route, pro
 	f.Lock()
 	defer f.Unlock()
 
-	packets, ok := f.packets[ch]
-	if len(packets) == maxPendingPacketsPerResolution {
-		p := packets[0]
-		packets[0] = pendingPacket{}
-		packets = packets[1:]
-		p.route.Stats().IP.OutgoingPacketErrors.Increment()
-		p.route.Release()
+	_, ok := f.packets[ch]
+	if len(f.packets[ch]) == maxPendingPacketsPerResolution {
+		f.dropOldestLocked(ch)
+	} else if f.count == maxPendingPackets {
+		f.dropOldestLocked(f.longestQueueLocked())
 	}
 
+	packets := f.packets[ch]
 	if l := len(packets); l >= maxPendingPacketsPerResolution {
 		panic(fmt.Sprintf("max pending packets for resolution reached; got %d packets, max = %d", l, maxPendingPacketsPerResolution))
 	}
+	if f.count >= maxPendingPackets {
+		panic(fmt.Sprintf("max pending packets reached; got %d packets, max = %d", f.count, maxPendingPackets))
+	}
 
 	f.packets[ch] = append(packets, pendingPacket{
 		route: r,
 		proto: proto,
 		pkt:   pkt,
 	})
+	f.count++
+	r.outgoingNIC.stats.LinkResolution.Queued.Increment()
 
 	if ok {
 		return
@@ -83,7 +128,9 @@ func (f *packetsPendingLinkResolution) enqueue(ch <-chan struct{}, r *Route, pro
 
 	// Wait for the link-address resolution to complete.
 	cancel := f.newCancelChannelLocked()
+	f.waiters.Add(1)
 	go func() {
+		defer f.waiters.Done()
 		cancelled := false
 		select {
 		case <-ch:
@@ -94,6 +141,7 @@ func (f *packetsPendingLinkResolution) enqueue(ch <-chan struct{}, r *Route, pro
 		f.Lock()
 		packets, ok := f.packets[ch]
 		delete(f.packets, ch)
+		f.count -= len(packets)
 		f.Unlock()
 
 		if !ok {
@@ -103,8 +151,12 @@ func (f *packetsPendingLinkResolution) enqueue(ch <-chan struct{}, r *Route, pro
 		for _, p := range packets {
 			if cancelled {
 				p.route.Stats().IP.OutgoingPacketErrors.Increment()
+				p.route.outgoingNIC.stats.TxDropped.Increment()
+				p.route.outgoingNIC.stats.LinkResolution.DroppedResolutionFailed.Increment()
 			} else if _, err := p.route.Resolve(nil); err != nil {
 				p.route.Stats().IP.OutgoingPacketErrors.Increment()
+				p.route.outgoingNIC.stats.TxDropped.Increment()
+				p.route.outgoingNIC.stats.LinkResolution.DroppedResolutionFailed.Increment()
 			} else {
 				p.route.outgoingNIC.writePacket(p.route, nil /* gso */, p.proto, p.pkt)
 			}
@@ -113,6 +165,52 @@ func (f *packetsPendingLinkResolution) enqueue(ch <-chan struct{}, r *Route, pro
 	}()
 }
 
+// dropOldestLocked drops the oldest packet queued for the resolution ch.
+//
+// Precondition: f must be locked and the queue of ch must not be empty.
+func (f *packetsPendingLinkResolution) dropOldestLocked(ch <-chan struct{}) {
+	packets := f.packets[ch]
+	p := packets[0]
+	packets[0] = pendingPacket{}
+	// The entry is kept even if it becomes empty, as the goroutine waiting
+	// for the resolution expects to find it.
+	f.packets[ch] = packets[1:]
+	f.count--
+
+	p.route.Stats().IP.OutgoingPacketErrors.Increment()
+	p.route.outgoingNIC.stats.TxDropped.Increment()
+	p.route.outgoingNIC.stats.LinkResolution.DroppedQueueFull.Increment()
+	p.route.Release()
+}
+
+// longestQueueLocked returns the resolution with the most queued packets.
+//
+// Precondition: f must be locked.
+func (f *packetsPendingLinkResolution) longestQueueLocked() <-chan struct{} {
+	var longest <-chan struct{}
+	maxLen := -1
+	for ch, packets := range f.packets {
+		if len(packets) > maxLen {
+			longest = ch
+			maxLen = len(packets)
+		}
+	}
+	return longest
+}
+
+// cancelAll cancels all pending link-address resolutions, and waits for the
+// packets waiting for them to be dropped.
+func (f *packetsPendingLinkResolution) cancelAll() {
+	f.Lock()
+	for _, ch := range f.cancelChans {
+		close(ch)
+	}
+	f.cancelChans = nil
+	f.Unlock()
+
+	f.waiters.Wait()
+}
+
 // newCancelChannel creates a channel that can cancel a pending forwarding
 // activity. The oldest channel is closed if the number of open channels would
 // exceed maxPendingResolutions.
@@ -60,6 +60,11 @@ const (
 	ControlNoRoute
 	ControlPacketTooBig
 	ControlPortUnreachable
+
+	// ControlNICRemoved is delivered to the endpoints bound to a NIC, or to
+	// one of its addresses, when the NIC is removed. It isn't caused by a
+	// packet, so HandleControlPacket is called with a nil packet.
+	ControlNICRemoved
 	ControlUnknown
 )
 
@@ -492,6 +497,18 @@ type NDPEndpoint interface {
 	InvalidateDefaultRouter(tcpip.Address)
 }
 
+// AddressAnnouncer is a network endpoint which announces the addresses of its
+// NIC to neighbors, like with gratuitous ARP, so they promptly update their
+// caches when addresses are added or the link address of the NIC changes.
+type AddressAnnouncer interface {
+	NetworkEndpoint
+
+	// AnnounceAddresses announces that addrs, addresses of the NIC, are
+	// reachable at the link address of the NIC. Addresses the endpoint is not
+	// responsible for are ignored.
+	AnnounceAddresses(addrs []tcpip.Address)
+}
+
 // NetworkInterface is a network interface.
 type NetworkInterface interface {
 	NetworkLinkEndpoint
@@ -588,6 +605,54 @@ type ForwardingNetworkProtocol interface {
 	SetForwarding(bool)
 }
 
+// RouterAlertPacketInfo holds information about a packet punted to a
+// RouterAlertHandler.
+type RouterAlertPacketInfo struct {
+	// NICID is the ID of the NIC the packet was received on.
+	NICID tcpip.NICID
+
+	// Endpoint is the network endpoint that received the packet.
+	Endpoint NetworkEndpoint
+
+	// RouterAlert is true if the packet carried a Router Alert option.
+	RouterAlert bool
+
+	// Value is the value of the Router Alert option. Only meaningful if
+	// RouterAlert is true.
+	Value uint16
+
+	// Local is true if the packet is destined to this host. Packets that are
+	// not destined to this host are only punted if they carry a Router Alert
+	// option.
+	Local bool
+}
+
+// RouterAlertHandler is an in-stack consumer of packets punted by a network
+// endpoint, such as the handler for IGMP or RSVP messages.
+type RouterAlertHandler interface {
+	// HandleRouterAlert handles a punted packet. The packet's Data holds the
+	// transport payload.
+	//
+	// Returns true if the packet was consumed and must not be processed
+	// further by the network endpoint.
+	HandleRouterAlert(RouterAlertPacketInfo, *PacketBuffer) bool
+}
+
+// RouterAlertNetworkProtocol is a NetworkProtocol that punts packets to
+// registered RouterAlertHandlers.
+type RouterAlertNetworkProtocol interface {
+	NetworkProtocol
+
+	// RegisterRouterAlertHandler registers h as the handler for packets
+	// carrying the transport protocol proto.
+	//
+	// Returns tcpip.ErrAlreadyBound if a handler is already registered for proto.
+	RegisterRouterAlertHandler(proto tcpip.TransportProtocolNumber, h RouterAlertHandler) *tcpip.Error
+
+	// UnregisterRouterAlertHandler removes the handler registered for proto.
+	UnregisterRouterAlertHandler(proto tcpip.TransportProtocolNumber)
+}
+
 // NetworkProtocol is the interface that needs to be implemented by network
 // protocols (e.g., ipv4, ipv6) that want to be part of the networking stack.
 type NetworkProtocol interface {
@@ -875,14 +940,72 @@ type GSO struct {
 
 	// MaxSize is maximum GSO packet size.
 	MaxSize uint32
+
+	// Encap is the encapsulation, if any, wrapped around the packet by an
+	// encapsulating link endpoint.
+	Encap GSOEncapType
+	// EncapHdrLen is the length of the encapsulation headers placed between
+	// the link header and the L3 header.
+	EncapHdrLen uint16
+}
+
+// WithEncap returns a copy of g that describes the packet once wrapped in an
+// encapsulation of type typ with hdrLen bytes of headers. g isn't modified, as
+// it may be shared by all packets of a transport endpoint.
+func (g *GSO) WithEncap(typ GSOEncapType, hdrLen uint16) *GSO {
+	encapped := *g
+	encapped.Encap = typ
+	encapped.EncapHdrLen += hdrLen
+	return &encapped
 }
 
+// GSOEncapType is the type of encapsulation wrapped around a GSO packet.
+//
+// +stateify savable
+type GSOEncapType int
+
+// Types of GSO encapsulation.
+const (
+	GSOEncapNone GSOEncapType = iota
+	GSOEncapVLAN
+	GSOEncapVXLAN
+	GSOEncapGRE
+	GSOEncapGeneve
+)
+
 // GSOEndpoint provides access to GSO properties.
 type GSOEndpoint interface {
 	// GSOMaxSize returns the maximum GSO packet size.
 	GSOMaxSize() uint32
 }
 
+// GSOEncapEndpoint is implemented by link endpoints which can segment hardware
+// GSO packets carried inside an encapsulation.
+//
+// An encapsulating link endpoint writing to a lower endpoint should record its
+// encapsulation with GSO.WithEncap if the lower endpoint supports it, and
+// otherwise segment the packet with SegmentGSO before encapsulating it.
+type GSOEncapEndpoint interface {
+	// SupportsGSOEncap returns true if hardware GSO packets encapsulated with
+	// typ can be written to the endpoint.
+	SupportsGSOEncap(typ GSOEncapType) bool
+}
+
+// SupportsGSOEncap returns true if ep can segment hardware GSO packets
+// encapsulated with typ.
+func SupportsGSOEncap(ep LinkEndpoint, typ GSOEncapType) bool {
+	if ep.Capabilities()&CapabilityHardwareGSO == 0 {
+		return false
+	}
+	if typ == GSOEncapNone {
+		return true
+	}
+	if e, ok := ep.(GSOEncapEndpoint); ok {
+		return e.SupportsGSOEncap(typ)
+	}
+	return false
+}
+
 // SoftwareGSOMaxSize is a maximum allowed size of a software GSO segment.
 // This isn't a hard limit, because it is never set into packet headers.
 const SoftwareGSOMaxSize = (1 << 16)
@@ -0,0 +1,109 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// RPFilterMode selects how the source addresses of the packets received on a
+// NIC are validated, like the rp_filter sysctl of Linux (RFC 3704). Modes have
+// the values of the sysctl.
+type RPFilterMode int
+
+const (
+	// RPFilterNone doesn't validate source addresses.
+	RPFilterNone RPFilterMode = 0
+
+	// RPFilterStrict drops the packets whose source address isn't routed
+	// out of the NIC they were received on.
+	RPFilterStrict RPFilterMode = 1
+
+	// RPFilterLoose drops the packets whose source address isn't routed out
+	// of any NIC.
+	RPFilterLoose RPFilterMode = 2
+)
+
+// SetRPFilter sets the reverse path filtering mode of the given NIC. It
+// returns tcpip.ErrInvalidOptionValue if mode is unknown.
+func (s *Stack) SetRPFilter(nicID tcpip.NICID, mode RPFilterMode) *tcpip.Error {
+	switch mode {
+	case RPFilterNone, RPFilterStrict, RPFilterLoose:
+	default:
+		return tcpip.ErrInvalidOptionValue
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setRPFilter(mode)
+	return nil
+}
+
+// RPFilter returns the reverse path filtering mode of the given NIC, as set by
+// SetRPFilter.
+func (s *Stack) RPFilter(nicID tcpip.NICID) (RPFilterMode, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return RPFilterNone, tcpip.ErrUnknownNICID
+	}
+
+	return nic.rpFilter(), nil
+}
+
+// CheckReversePath returns false if a packet from srcAddr received on the
+// given NIC must be dropped, as per the reverse path filtering mode of the NIC.
+//
+// The reverse path is looked up in the route table, among the routes through
+// the enabled NICs of the group of the NIC. Packets from the unspecified
+// address, which hosts use before they are configured, are always accepted.
+func (s *Stack) CheckReversePath(nicID tcpip.NICID, srcAddr tcpip.Address) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inNIC, ok := s.nics[nicID]
+	if !ok {
+		return true
+	}
+	mode := inNIC.rpFilter()
+	if mode == RPFilterNone {
+		return true
+	}
+	if len(srcAddr) == 0 || srcAddr == tcpip.Address(make([]byte, len(srcAddr))) {
+		return true
+	}
+
+	for _, route := range s.routesRLocked() {
+		if !route.Destination.Contains(srcAddr) {
+			continue
+		}
+		nic, ok := s.nics[route.NIC]
+		if !ok || !nic.Enabled() || nic.group != inNIC.group {
+			continue
+		}
+		// The packets to srcAddr would be routed out of the first matching
+		// route.
+		return mode == RPFilterLoose || route.NIC == nicID
+	}
+	return false
+}
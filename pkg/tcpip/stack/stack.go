@@ -394,6 +394,10 @@ type Stack struct {
 	// destination.
 	routeTable []tcpip.Route
 
+	// learnedRoutes holds the routes network protocols learned from the
+	// network. They are looked up after the routes of routeTable.
+	learnedRoutes learnedRoutes
+
 	*ports.PortManager
 
 	// If not nil, then any new endpoints will have this probe function
@@ -403,6 +407,10 @@ type Stack struct {
 	// clock is used to generate user-visible times.
 	clock tcpip.Clock
 
+	// timers is the pausable clock wrapping the clock given to New. clock
+	// is set to it. It is immutable.
+	timers *pausableClock
+
 	// handleLocal allows non-loopback interfaces to loop packets.
 	handleLocal bool
 
@@ -418,6 +426,18 @@ type Stack struct {
 	// by the stack.
 	icmpRateLimiter *ICMPRateLimiter
 
+	// events is the log of the anomalies detected by the stack.
+	events eventLog
+
+	// martianLogLimiter rate limits the logging of martian packets.
+	martianLogLimiter *rate.Limiter
+
+	// multicastRouting holds the multicast interfaces and routes.
+	multicastRouting multicastRoutingTable
+
+	// linkResRetryLimiter paces retransmissions of link-address requests.
+	linkResRetryLimiter *rate.Limiter
+
 	// seed is a one-time random value initialized at stack startup
 	// and is used to seed the TCP port picking on active connections
 	//
@@ -435,6 +455,9 @@ type Stack struct {
 	// integrator NUD related events.
 	nudDisp NUDDispatcher
 
+	// neighborSubs holds the subscribers to neighbor state transitions.
+	neighborSubs neighborSubscribers
+
 	// uniqueIDGenerator is a generator of unique identifiers.
 	uniqueIDGenerator UniqueID
 
@@ -453,6 +476,10 @@ type Stack struct {
 	// receiveBufferSize holds the min/default/max receive buffer sizes for
 	// endpoints other than TCP.
 	receiveBufferSize ReceiveBufferSizeOption
+
+	// flowCache caches the routes of forwarded flows. It is nil if the
+	// forwarding flow cache is disabled.
+	flowCache *flowCache
 }
 
 // UniqueID is an abstract generator of unique identifiers.
@@ -524,6 +551,11 @@ type Options struct {
 	// IPTables are the initial iptables rules. If nil, iptables will allow
 	// all traffic.
 	IPTables *IPTables
+
+	// ForwardingFlowCache enables the caching of the routes and next hops of
+	// forwarded flows, so that steady-state forwarding skips route table and
+	// neighbor lookups. It benefits stacks acting as gateways.
+	ForwardingFlowCache bool
 }
 
 // TransportEndpointInfo holds useful information about a transport endpoint
@@ -614,6 +646,7 @@ func New(opts Options) *Stack {
 	if clock == nil {
 		clock = &tcpip.StdClock{}
 	}
+	timers := newPausableClock(clock)
 
 	if opts.UniqueID == nil {
 		opts.UniqueID = new(uniqueIDGenerator)
@@ -629,6 +662,7 @@ func New(opts Options) *Stack {
 	if opts.IPTables == nil {
 		opts.IPTables = DefaultTables()
 	}
+	opts.IPTables.connections.clock = timers
 
 	opts.NUDConfigs.resetInvalidFields()
 
@@ -638,9 +672,10 @@ func New(opts Options) *Stack {
 		linkAddrResolvers:  make(map[tcpip.NetworkProtocolNumber]LinkAddressResolver),
 		nics:               make(map[tcpip.NICID]*NIC),
 		cleanupEndpoints:   make(map[TransportEndpoint]struct{}),
-		linkAddrCache:      newLinkAddrCache(ageLimit, resolutionTimeout, resolutionAttempts),
+		linkAddrCache:      newLinkAddrCache(timers, ageLimit, resolutionTimeout, resolutionAttempts),
 		PortManager:        ports.NewPortManager(),
-		clock:              clock,
+		clock:              timers,
+		timers:             timers,
 		stats:              opts.Stats.FillIn(),
 		handleLocal:        opts.HandleLocal,
 		tables:             opts.IPTables,
@@ -662,6 +697,14 @@ func New(opts Options) *Stack {
 			Max:     DefaultMaxBufferSize,
 		},
 	}
+	s.events.init()
+	s.martianLogLimiter = newMartianLogLimiter()
+	s.multicastRouting.init()
+	s.linkResRetryLimiter = newLinkResRetryLimiter()
+	s.linkAddrCache.retryLimiter = s.linkResRetryLimiter
+	if opts.ForwardingFlowCache {
+		s.flowCache = newFlowCache()
+	}
 	s.linkResQueue.init()
 
 	// Add specified network protocols.
@@ -796,6 +839,7 @@ func (s *Stack) SetForwarding(protocolNum tcpip.NetworkProtocolNumber, enable bo
 	}
 
 	forwardingProtocol.SetForwarding(enable)
+	s.flowCache.flush()
 	return nil
 }
 
@@ -824,6 +868,7 @@ func (s *Stack) SetRouteTable(table []tcpip.Route) {
 	defer s.mu.Unlock()
 
 	s.routeTable = table
+	s.flowCache.flush()
 }
 
 // GetRouteTable returns the route table which is currently in use.
@@ -838,6 +883,7 @@ func (s *Stack) AddRoute(route tcpip.Route) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.routeTable = append(s.routeTable, route)
+	s.flowCache.flush()
 }
 
 // RemoveRoutes removes matching routes from the route table.
@@ -852,6 +898,7 @@ func (s *Stack) RemoveRoutes(match func(tcpip.Route) bool) {
 		}
 	}
 	s.routeTable = filteredRoutes
+	s.flowCache.flush()
 }
 
 // NewEndpoint creates a new transport layer endpoint of the given protocol.
@@ -912,6 +959,9 @@ type NICOptions struct {
 	// should be tracked alongside a NIC, to avoid having to keep a
 	// map[tcpip.NICID]metadata mirroring stack.Stack's nic map.
 	Context NICContext
+
+	// Group is the group of the NIC. See tcpip.NICGroupID.
+	Group tcpip.NICGroupID
 }
 
 // CreateNICWithOptions creates a NIC with the provided id, LinkEndpoint, and
@@ -938,6 +988,7 @@ func (s *Stack) CreateNICWithOptions(id tcpip.NICID, ep LinkEndpoint, opts NICOp
 	}
 
 	n := newNIC(s, id, opts.Name, ep, opts.Context)
+	n.group = opts.Group
 	s.nics[id] = n
 	if !opts.Disabled {
 		return n.enable()
@@ -975,7 +1026,9 @@ func (s *Stack) EnableNIC(id tcpip.NICID) *tcpip.Error {
 		return tcpip.ErrUnknownNICID
 	}
 
-	return nic.enable()
+	err := nic.enable()
+	s.flowCache.flush()
+	return err
 }
 
 // DisableNIC disables the given NIC.
@@ -989,6 +1042,7 @@ func (s *Stack) DisableNIC(id tcpip.NICID) *tcpip.Error {
 	}
 
 	nic.disable()
+	s.flowCache.flush()
 	return nil
 }
 
@@ -1006,11 +1060,30 @@ func (s *Stack) CheckNIC(id tcpip.NICID) bool {
 }
 
 // RemoveNIC removes NIC and all related routes from the network stack.
+//
+// The NIC's addresses, routes and neighbor entries are removed, and the
+// multicast groups it joined are left, announcing it to routers. Transport
+// endpoints bound to the NIC or to one of its addresses are then notified
+// with a ControlNICRemoved control message.
 func (s *Stack) RemoveNIC(id tcpip.NICID) *tcpip.Error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	nic, ok := s.nics[id]
+	if !ok {
+		s.mu.Unlock()
+		return tcpip.ErrUnknownNICID
+	}
+	addrs := make(map[tcpip.Address]struct{})
+	for _, a := range nic.allPermanentAddresses() {
+		addrs[a.AddressWithPrefix.Address] = struct{}{}
+	}
+	err := s.removeNICLocked(id)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return s.removeNICLocked(id)
+	s.demux.nicRemoved(id, addrs)
+	return nil
 }
 
 // removeNICLocked removes NIC and all related routes from the network stack.
@@ -1022,6 +1095,13 @@ func (s *Stack) removeNICLocked(id tcpip.NICID) *tcpip.Error {
 		return tcpip.ErrUnknownNICID
 	}
 	delete(s.nics, id)
+	for _, other := range s.nics {
+		other.stopMirroringTo(nic)
+	}
+	s.multicastRouting.removeNIC(id)
+	// Release the references cached routes hold on the addresses of the NIC
+	// before removing them.
+	s.flowCache.flush()
 
 	// Remove routes in-place. n tracks the number of routes written.
 	n := 0
@@ -1035,6 +1115,7 @@ func (s *Stack) removeNICLocked(id tcpip.NICID) *tcpip.Error {
 	}
 
 	s.routeTable = s.routeTable[:n]
+	s.learnedRoutes.set(id, nil)
 
 	return nic.remove()
 }
@@ -1061,6 +1142,9 @@ type NICInfo struct {
 	// value sent in haType field of an ARP Request sent by this NIC and the
 	// value expected in the haType field of an ARP response.
 	ARPHardwareType header.ARPHardwareType
+
+	// Group is the group of the NIC.
+	Group tcpip.NICGroupID
 }
 
 // HasNIC returns true if the NICID is defined in the stack.
@@ -1093,6 +1177,7 @@ func (s *Stack) NICInfo() map[tcpip.NICID]NICInfo {
 			Stats:             nic.stats,
 			Context:           nic.context,
 			ARPHardwareType:   nic.LinkEndpoint.ARPHardwareType(),
+			Group:             nic.group,
 		}
 	}
 	return nics
@@ -1161,7 +1246,28 @@ func (s *Stack) AddProtocolAddressWithOptions(id tcpip.NICID, protocolAddress tc
 		return tcpip.ErrUnknownNICID
 	}
 
-	return nic.addAddress(protocolAddress, peb)
+	err := nic.addAddress(protocolAddress, peb)
+	// Packets destined to the address are no longer forwarded.
+	s.flowCache.flush()
+	return err
+}
+
+// AnnounceNICAddresses announces the addresses of NIC id to its neighbors, with
+// gratuitous ARP or unsolicited Neighbor Advertisements as configured for the
+// network protocols. It should be called once the link address of the NIC
+// changes; addresses are announced as they are added or when the NIC is
+// enabled otherwise.
+func (s *Stack) AnnounceNICAddresses(id tcpip.NICID) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.announceAllAddresses()
+	return nil
 }
 
 // RemoveAddress removes an existing network-layer address from the specified
@@ -1171,7 +1277,9 @@ func (s *Stack) RemoveAddress(id tcpip.NICID, addr tcpip.Address) *tcpip.Error {
 	defer s.mu.RUnlock()
 
 	if nic, ok := s.nics[id]; ok {
-		return nic.removeAddress(addr)
+		err := nic.removeAddress(addr)
+		s.flowCache.flush()
+		return err
 	}
 
 	return tcpip.ErrUnknownNICID
@@ -1231,10 +1339,10 @@ func (s *Stack) findLocalRouteFromNICRLocked(localAddressNIC *NIC, localAddr, re
 	}
 
 	// If the remote address isn't owned by the local address's NIC, check all
-	// NICs.
+	// NICs of its group.
 	if outgoingNIC == nil {
 		for _, nic := range s.nics {
-			if nic.hasAddress(netProto, remoteAddr) {
+			if nic.group == localAddressNIC.group && nic.hasAddress(netProto, remoteAddr) {
 				outgoingNIC = nic
 				break
 			}
@@ -1271,13 +1379,16 @@ func (s *Stack) findLocalRouteFromNICRLocked(localAddressNIC *NIC, localAddr, re
 // is, a local route is a route where packets never have to leave the stack.
 //
 // Precondition: s.mu must be read locked.
-func (s *Stack) findLocalRouteRLocked(localAddressNICID tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) *Route {
+func (s *Stack) findLocalRouteRLocked(group tcpip.NICGroupID, localAddressNICID tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) *Route {
 	if len(localAddr) == 0 {
 		localAddr = remoteAddr
 	}
 
 	if localAddressNICID == 0 {
 		for _, localAddressNIC := range s.nics {
+			if localAddressNIC.group != group {
+				continue
+			}
 			if r := s.findLocalRouteFromNICRLocked(localAddressNIC, localAddr, remoteAddr, netProto); r != nil {
 				return r
 			}
@@ -1304,10 +1415,36 @@ func (s *Stack) findLocalRouteRLocked(localAddressNICID tcpip.NICID, localAddr,
 // If no local address is provided, the stack will select a local address. If no
 // remote address is provided, the stack wil use a remote address equal to the
 // local address.
+//
+// The route is looked up in the group of the NIC if one is specified, and in
+// tcpip.DefaultNICGroup otherwise.
 func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, *tcpip.Error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	group := tcpip.DefaultNICGroup
+	if nic, ok := s.nics[id]; ok {
+		group = nic.group
+	}
+	return s.findRouteRLocked(group, id, localAddr, remoteAddr, netProto, multicastLoop)
+}
+
+// FindRouteInGroup is like FindRoute, but looks the route up in group. If a NIC
+// is specified, it must belong to group.
+func (s *Stack) FindRouteInGroup(group tcpip.NICGroupID, id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[id]; ok && nic.group != group {
+		return nil, tcpip.ErrNoRoute
+	}
+	return s.findRouteRLocked(group, id, localAddr, remoteAddr, netProto, multicastLoop)
+}
+
+// findRouteRLocked finds a route through the NICs of group.
+//
+// Precondition: s.mu must be read locked.
+func (s *Stack) findRouteRLocked(group tcpip.NICGroupID, id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, *tcpip.Error) {
 	isLinkLocal := header.IsV6LinkLocalAddress(remoteAddr) || header.IsV6LinkLocalMulticastAddress(remoteAddr)
 	isLocalBroadcast := remoteAddr == header.IPv4Broadcast
 	isMulticast := header.IsV4MulticastAddress(remoteAddr) || header.IsV6MulticastAddress(remoteAddr)
@@ -1315,7 +1452,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	needRoute := !(isLocalBroadcast || isMulticast || isLinkLocal || isLoopback)
 
 	if s.handleLocal && !isMulticast && !isLocalBroadcast {
-		if r := s.findLocalRouteRLocked(id, localAddr, remoteAddr, netProto); r != nil {
+		if r := s.findLocalRouteRLocked(group, id, localAddr, remoteAddr, netProto); r != nil {
 			return r, nil
 		}
 	}
@@ -1348,18 +1485,25 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 
 	// Find a route to the remote with the route table.
 	var chosenRoute tcpip.Route
-	for _, route := range s.routeTable {
+	for _, route := range s.routesRLocked() {
 		if len(remoteAddr) != 0 && !route.Destination.Contains(remoteAddr) {
 			continue
 		}
 
 		nic, ok := s.nics[route.NIC]
-		if !ok || !nic.Enabled() {
+		if !ok || !nic.Enabled() || nic.group != group {
 			continue
 		}
 
 		if id == 0 || id == route.NIC {
 			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, netProto); addressEndpoint != nil {
+				// Source-specific routes apply to the packets of the source
+				// address selected for the NIC.
+				if !route.MatchesSource(addressEndpoint.AddressWithPrefix().Address) {
+					addressEndpoint.DecRef()
+					continue
+				}
+
 				var gateway tcpip.Address
 				if needRoute {
 					gateway = route.Gateway
@@ -1378,7 +1522,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 		// is assigned to the outgoing interface. There is no requirement to do this
 		// from any RFC but simply a choice made to better follow a strong host
 		// model which the netstack follows at the time of writing.
-		if canForward && chosenRoute == (tcpip.Route{}) {
+		if canForward && chosenRoute == (tcpip.Route{}) && route.MatchesSource(localAddr) {
 			chosenRoute = route
 		}
 	}
@@ -1414,6 +1558,9 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 			// If an interface is not specified, try to find a NIC that holds the local
 			// address endpoint to construct a route.
 			for _, aNIC := range s.nics {
+				if aNIC.group != group {
+					continue
+				}
 				addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, netProto)
 				if addressEndpoint == nil {
 					continue
@@ -1435,6 +1582,18 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	return nil, tcpip.ErrNetworkUnreachable
 }
 
+// routesRLocked returns the routes of the route table followed by the learned
+// routes, in lookup order. The returned slice must not be modified.
+//
+// Precondition: s.mu must be read locked.
+func (s *Stack) routesRLocked() []tcpip.Route {
+	learned := s.learnedRoutes.get()
+	if len(learned) == 0 {
+		return s.routeTable
+	}
+	return append(s.routeTable[:len(s.routeTable):len(s.routeTable)], learned...)
+}
+
 // CheckNetworkProtocol checks if a given network protocol is enabled in the
 // stack.
 func (s *Stack) CheckNetworkProtocol(protocol tcpip.NetworkProtocolNumber) bool {
@@ -1508,6 +1667,74 @@ func (s *Stack) SetSpoofing(nicID tcpip.NICID, enable bool) *tcpip.Error {
 	return nil
 }
 
+// SetMulticastBoundary makes the given NIC an administrative scope boundary,
+// as described in RFC 2365 and RFC 4007 section 5: multicast packets with a
+// scope up to and including scope are not forwarded to or from it. A scope of
+// 0 removes the boundary.
+//
+// Link-local and narrower multicast packets are never forwarded, whether or
+// not a boundary is set.
+func (s *Stack) SetMulticastBoundary(nicID tcpip.NICID, scope header.MulticastScope) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setMulticastBoundary(scope)
+	s.flowCache.flush()
+
+	return nil
+}
+
+// MulticastBoundary returns the multicast scope boundary of the given NIC, as
+// set by SetMulticastBoundary.
+func (s *Stack) MulticastBoundary(nicID tcpip.NICID) (header.MulticastScope, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return 0, tcpip.ErrUnknownNICID
+	}
+
+	return nic.multicastBoundary(), nil
+}
+
+// CanForwardMulticast returns true if a multicast packet of the given scope
+// received on inNICID may be forwarded out of outNICID without crossing a
+// scope boundary.
+func (s *Stack) CanForwardMulticast(inNICID, outNICID tcpip.NICID, scope header.MulticastScope) bool {
+	if scope <= header.LinkLocalMulticastScope {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range []tcpip.NICID{inNICID, outNICID} {
+		if nic, ok := s.nics[id]; ok && scope <= nic.multicastBoundary() {
+			return false
+		}
+	}
+	return true
+}
+
+// NICForwardingStats returns the forwarding statistics of the given NIC.
+func (s *Stack) NICForwardingStats(nicID tcpip.NICID) (ForwardingStats, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicID]
+	if !ok {
+		return ForwardingStats{}, tcpip.ErrUnknownNICID
+	}
+
+	return nic.stats.Forwarding, nil
+}
+
 // AddLinkAddress adds a link address to the stack link cache.
 func (s *Stack) AddLinkAddress(nicID tcpip.NICID, addr tcpip.Address, linkAddr tcpip.LinkAddress) {
 	fullAddr := tcpip.FullAddress{NIC: nicID, Addr: addr}
@@ -1748,6 +1975,45 @@ func (s *Stack) Wait() {
 	}
 }
 
+// Destroy releases all resources held by the stack, making it unusable. It
+// closes all transport endpoints and protocols, cancels pending link-address
+// resolutions and drops the packets waiting for them, and removes all NICs,
+// stopping the timers of their network endpoints (e.g. IGMP, MLD and NDP) and
+// neighbor caches. Destroy returns once all goroutines started by the stack
+// have exited.
+//
+// Link endpoints are detached from the stack, but they must be stopped via an
+// implementation specific mechanism.
+func (s *Stack) Destroy() {
+	s.Close()
+	for _, e := range s.RegisteredEndpoints() {
+		e.Wait()
+	}
+	for _, e := range s.CleanupEndpoints() {
+		e.Wait()
+	}
+	for _, p := range s.transportProtocols {
+		p.proto.Wait()
+	}
+	for _, p := range s.networkProtocols {
+		p.Wait()
+	}
+
+	s.linkResQueue.cancelAll()
+	s.linkAddrCache.clear()
+
+	s.mu.Lock()
+	for id := range s.nics {
+		if err := s.removeNICLocked(id); err != nil {
+			panic(fmt.Sprintf("failed to remove NIC %d: %s", id, err))
+		}
+	}
+	s.routeTable = nil
+	s.mu.Unlock()
+
+	s.tables.stopReaper()
+}
+
 // Resume restarts the stack after a restore. This must be called after the
 // entire system has been restored.
 func (s *Stack) Resume() {
@@ -1939,7 +2205,7 @@ func (s *Stack) ICMPLimit() rate.Limit {
 // SetICMPLimit sets the maximum number of ICMP messages that be sent
 // in one second.
 func (s *Stack) SetICMPLimit(newLimit rate.Limit) {
-	s.icmpRateLimiter.SetLimit(newLimit)
+	s.icmpRateLimiter.SetLimitAt(s.clock.Now(), newLimit)
 }
 
 // ICMPBurst returns the maximum number of ICMP messages that can be sent
@@ -1951,13 +2217,13 @@ func (s *Stack) ICMPBurst() int {
 // SetICMPBurst sets the maximum number of ICMP messages that can be sent
 // in a single burst.
 func (s *Stack) SetICMPBurst(burst int) {
-	s.icmpRateLimiter.SetBurst(burst)
+	s.icmpRateLimiter.SetBurstAt(s.clock.Now(), burst)
 }
 
 // AllowICMPMessage returns true if we the rate limiter allows at least one
 // ICMP message to be sent at this instant.
 func (s *Stack) AllowICMPMessage() bool {
-	return s.icmpRateLimiter.Allow()
+	return s.icmpRateLimiter.AllowN(s.clock.Now(), 1)
 }
 
 // GetNetworkEndpoint returns the NetworkEndpoint with the specified protocol
@@ -40,6 +40,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 const (
@@ -729,6 +730,64 @@ func TestRemoveNIC(t *testing.T) {
 	}
 }
 
+func TestDestroy(t *testing.T) {
+	const (
+		nicID           = 1
+		retransmitTimer = 10 * time.Millisecond
+	)
+
+	ndpConfigs := ipv6.DefaultNDPConfigurations()
+	ndpConfigs.DupAddrDetectTransmits = 100
+	ndpConfigs.RetransmitTimer = retransmitTimer
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv6.NewProtocolWithOptions(ipv6.Options{
+			NDPConfigs:       ndpConfigs,
+			AutoGenLinkLocal: true,
+		})},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	e := linkEPWithMockedAttach{
+		LinkEndpoint: channel.New(int(ndpConfigs.DupAddrDetectTransmits), 1280, linkAddr1),
+	}
+	if err := s.CreateNIC(nicID, &e); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv6EmptySubnet, NIC: nicID}})
+
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv6.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint(%d, %d, _) = %s", udp.ProtocolNumber, ipv6.ProtocolNumber, err)
+	}
+	defer ep.Close()
+	if err := ep.Bind(tcpip.FullAddress{Port: 1234}); err != nil {
+		t.Fatalf("ep.Bind(_) = %s", err)
+	}
+
+	s.Destroy()
+
+	if nicInfo, ok := s.NICInfo()[nicID]; ok {
+		t.Errorf("got unexpected NICInfo entry for NIC %d after Destroy = %+v", nicID, nicInfo)
+	}
+	if e.isAttached() {
+		t.Error("link endpoint still attached to a network dispatcher after Destroy")
+	}
+	if routes := s.GetRouteTable(); len(routes) != 0 {
+		t.Errorf("got GetRouteTable() = %+v after Destroy, want = []", routes)
+	}
+	if eps := s.RegisteredEndpoints(); len(eps) != 0 {
+		t.Errorf("got %d registered endpoints after Destroy, want = 0", len(eps))
+	}
+
+	// DAD must not send any more solicitations.
+	linkEP := e.LinkEndpoint.(*channel.Endpoint)
+	linkEP.Drain()
+	time.Sleep(5 * retransmitTimer)
+	if n := linkEP.Drain(); n != 0 {
+		t.Errorf("got %d packets sent after Destroy, want = 0", n)
+	}
+}
+
 func TestRouteWithDownNIC(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -998,6 +1057,79 @@ func TestRoutes(t *testing.T) {
 	testNoRoute(t, s, 1, "\x03", "\x06")
 }
 
+func TestNICGroups(t *testing.T) {
+	const group = 1
+
+	// Create a stack with two NICs, the first one routing odd destination
+	// addresses and the second one even destination addresses, and move the
+	// second one to another group.
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+	})
+	if err := s.CreateNIC(1, channel.New(10, defaultMTU, "")); err != nil {
+		t.Fatal("CreateNIC failed:", err)
+	}
+	if err := s.AddAddress(1, fakeNetNumber, "\x01"); err != nil {
+		t.Fatal("AddAddress failed:", err)
+	}
+	if err := s.CreateNIC(2, channel.New(10, defaultMTU, "")); err != nil {
+		t.Fatal("CreateNIC failed:", err)
+	}
+	if err := s.AddAddress(2, fakeNetNumber, "\x02"); err != nil {
+		t.Fatal("AddAddress failed:", err)
+	}
+	{
+		subnet0, err := tcpip.NewSubnet("\x00", "\x01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnet1, err := tcpip.NewSubnet("\x01", "\x01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetRouteTable([]tcpip.Route{
+			{Destination: subnet1, Gateway: "\x00", NIC: 1},
+			{Destination: subnet0, Gateway: "\x00", NIC: 2},
+		})
+	}
+
+	if err := s.SetNICGroup(group, 2, 3); err != tcpip.ErrUnknownNICID {
+		t.Fatalf("got s.SetNICGroup(%d, 2, 3) = %v, want = %s", group, err, tcpip.ErrUnknownNICID)
+	}
+	if got, err := s.NICGroup(2); err != nil || got != tcpip.DefaultNICGroup {
+		t.Fatalf("got s.NICGroup(2) = (%d, %v), want = (%d, nil)", got, err, tcpip.DefaultNICGroup)
+	}
+	if err := s.SetNICGroup(group, 2); err != nil {
+		t.Fatalf("s.SetNICGroup(%d, 2): %s", group, err)
+	}
+	if got := s.NICInfo()[2].Group; got != group {
+		t.Errorf("got s.NICInfo()[2].Group = %d, want = %d", got, group)
+	}
+
+	// Lookups without a NIC stay in the default group, lookups through a NIC
+	// in its group.
+	testRoute(t, s, 0, "", "\x05", "\x01")
+	testNoRoute(t, s, 0, "", "\x06")
+	testRoute(t, s, 2, "", "\x06", "\x02")
+
+	r, err := s.FindRouteInGroup(group, 0, "", "\x06", fakeNetNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatal("FindRouteInGroup failed:", err)
+	}
+	if got, want := r.LocalAddress, tcpip.Address("\x02"); got != want {
+		t.Errorf("got r.LocalAddress = %s, want = %s", got, want)
+	}
+	r.Release()
+
+	// Routes through the NICs of other groups are not used, even through a
+	// given NIC.
+	for _, nicID := range []tcpip.NICID{0, 1} {
+		if _, err := s.FindRouteInGroup(group, nicID, "", "\x05", fakeNetNumber, false /* multicastLoop */); err != tcpip.ErrNoRoute {
+			t.Errorf("got FindRouteInGroup(%d, %d, ...) = %v, want = %s", group, nicID, err, tcpip.ErrNoRoute)
+		}
+	}
+}
+
 func TestAddressRemoval(t *testing.T) {
 	const localAddrByte byte = 0x01
 	localAddr := tcpip.Address([]byte{localAddrByte})
@@ -2220,6 +2352,58 @@ func TestNICStats(t *testing.T) {
 	}
 }
 
+// failingLinkEP is a link endpoint which fails to write packets.
+type failingLinkEP struct {
+	*channel.Endpoint
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket.
+func (*failingLinkEP) WritePacket(*stack.Route, *stack.GSO, tcpip.NetworkProtocolNumber, *stack.PacketBuffer) *tcpip.Error {
+	return tcpip.ErrClosedForSend
+}
+
+func TestNICErrorAndDropStats(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+	})
+	ep1 := &failingLinkEP{Endpoint: channel.New(10, defaultMTU, "")}
+	if err := s.CreateNIC(1, ep1); err != nil {
+		t.Fatal("CreateNIC failed: ", err)
+	}
+	if err := s.AddAddress(1, fakeNetNumber, "\x01"); err != nil {
+		t.Fatal("AddAddress failed:", err)
+	}
+	{
+		subnet, err := tcpip.NewSubnet("\x01", "\xff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetRouteTable([]tcpip.Route{{Destination: subnet, Gateway: "\x00", NIC: 1}})
+	}
+
+	// Packets of a protocol the NIC has no endpoint for are dropped.
+	ep1.InjectInbound(fakeNetNumber-1, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: buffer.NewView(30).ToVectorisedView(),
+	}))
+	stats := s.NICInfo()[1].Stats
+	if got, want := stats.Rx.Packets.Value(), uint64(1); got != want {
+		t.Errorf("got Rx.Packets.Value() = %d, want = %d", got, want)
+	}
+	if got, want := stats.RxDropped.Value(), uint64(1); got != want {
+		t.Errorf("got RxDropped.Value() = %d, want = %d", got, want)
+	}
+
+	if err := sendTo(s, "\x01", buffer.NewView(10)); err != tcpip.ErrClosedForSend {
+		t.Fatalf("got sendTo(_, _, _) = %v, want = %s", err, tcpip.ErrClosedForSend)
+	}
+	if got, want := stats.TxErrors.Value(), uint64(1); got != want {
+		t.Errorf("got TxErrors.Value() = %d, want = %d", got, want)
+	}
+	if got := stats.Tx.Packets.Value(); got != 0 {
+		t.Errorf("got Tx.Packets.Value() = %d, want = 0", got)
+	}
+}
+
 // TestNICContextPreservation tests that you can read out via stack.NICInfo the
 // Context data you pass via NICContext.Context in stack.CreateNICWithOptions.
 func TestNICContextPreservation(t *testing.T) {
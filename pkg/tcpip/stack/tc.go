@@ -0,0 +1,162 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// TCAttachPoint is where packet classifiers are attached to NICs, like the
+// hooks of the clsact queueing discipline of Linux.
+type TCAttachPoint int
+
+const (
+	// TCIngress classifies the packets received by a NIC, before they are
+	// handled by the stack.
+	TCIngress TCAttachPoint = iota
+
+	// TCEgress classifies the packets sent by a NIC, before they are queued
+	// by the link endpoint.
+	TCEgress
+
+	numTCAttachPoints
+)
+
+// TCAction is the action taken on a classified packet.
+type TCAction int
+
+const (
+	// TCPass lets the packet go through.
+	TCPass TCAction = iota
+
+	// TCDrop drops the packet.
+	TCDrop
+
+	// TCRedirect redirects the packet to another NIC instead.
+	TCRedirect
+)
+
+// TCVerdict is the result of the classification of a packet.
+type TCVerdict struct {
+	Action TCAction
+
+	// RedirectNIC is the NIC packets are redirected to with TCRedirect.
+	RedirectNIC tcpip.NICID
+
+	// RedirectIngress is whether redirected packets are received by
+	// RedirectNIC, rather than sent out of it.
+	RedirectIngress bool
+}
+
+// PacketClassifier decides what happens to the packets of NICs, like tc
+// filters on Linux.
+type PacketClassifier interface {
+	// Classify returns the action taken on pkt, a packet of NIC id at
+	// attach point at. pkt must be neither modified nor retained, except
+	// for its Priority.
+	//
+	// Received packets are not parsed yet, and their network packet is
+	// wholly in pkt.Data. PayloadSince(pkt.NetworkHeader()) returns the
+	// network packet at both attach points.
+	Classify(id tcpip.NICID, at TCAttachPoint, pkt *PacketBuffer) TCVerdict
+}
+
+// SetNICClassifier sets the classifier of the packets of NIC id at attach
+// point at, replacing any previous one. Packets are not classified if c is
+// nil.
+func (s *Stack) SetNICClassifier(id tcpip.NICID, at TCAttachPoint, c PacketClassifier) *tcpip.Error {
+	if at < 0 || at >= numTCAttachPoints {
+		return tcpip.ErrInvalidOptionValue
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+	nic.mu.Lock()
+	nic.mu.classifiers[at] = c
+	nic.mu.Unlock()
+	return nil
+}
+
+// NICClassifier returns the classifier of the packets of NIC id at attach point
+// at, if any.
+func (s *Stack) NICClassifier(id tcpip.NICID, at TCAttachPoint) (PacketClassifier, *tcpip.Error) {
+	if at < 0 || at >= numTCAttachPoints {
+		return nil, tcpip.ErrInvalidOptionValue
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return nil, tcpip.ErrUnknownNICID
+	}
+	nic.mu.RLock()
+	defer nic.mu.RUnlock()
+	return nic.mu.classifiers[at], nil
+}
+
+// classifier returns the classifier of n at attach point at.
+func (n *NIC) classifier(at TCAttachPoint) PacketClassifier {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mu.classifiers[at]
+}
+
+// nic returns the NIC with ID id.
+func (s *Stack) nic(id tcpip.NICID) (*NIC, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nic, ok := s.nics[id]
+	return nic, ok
+}
+
+// classify classifies pkt with c, and returns whether pkt keeps going through
+// n. Redirected packets are sent out of or delivered to their new NIC before
+// classify returns. remote and local are the link addresses of pkt.
+func (n *NIC) classify(c PacketClassifier, at TCAttachPoint, remote, local tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, pkt *PacketBuffer) bool {
+	v := c.Classify(n.id, at, pkt)
+	switch v.Action {
+	case TCPass:
+		return true
+	case TCRedirect:
+		// Like on Linux, packets redirected to a missing NIC are dropped.
+		target, ok := n.stack.nic(v.RedirectNIC)
+		if !ok || !target.Enabled() {
+			return false
+		}
+		egress := at == TCEgress
+		if !v.RedirectIngress {
+			// Redirected packets are not classified again.
+			_ = target.writeForeignPacket(egress, remote, local, protocol, pkt)
+			return false
+		}
+		// Packets received by the new NIC come from the remote end of
+		// the link, whatever their original direction.
+		src := remote
+		if egress {
+			src = local
+		}
+		target.deliverNetworkPacket(src, "" /* local */, protocol, networkPacket(pkt, 0), false /* classify */)
+		return false
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// testClassifier returns the same verdict for all packets.
+type testClassifier struct {
+	verdict stack.TCVerdict
+	pkts    int
+}
+
+func (c *testClassifier) Classify(tcpip.NICID, stack.TCAttachPoint, *stack.PacketBuffer) stack.TCVerdict {
+	c.pkts++
+	return c.verdict
+}
+
+func TestClassifierIngress(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		verdict      stack.TCVerdict
+		wantReceived uint64
+		wantTargetRx uint64
+	}{
+		{
+			name:         "pass",
+			verdict:      stack.TCVerdict{Action: stack.TCPass},
+			wantReceived: 1,
+		},
+		{
+			name:    "drop",
+			verdict: stack.TCVerdict{Action: stack.TCDrop},
+		},
+		{
+			name:    "redirect to missing NIC",
+			verdict: stack.TCVerdict{Action: stack.TCRedirect, RedirectNIC: 100},
+		},
+		{
+			name:         "redirect to ingress",
+			verdict:      stack.TCVerdict{Action: stack.TCRedirect, RedirectNIC: mirrorTargetNICID, RedirectIngress: true},
+			wantReceived: 1,
+			wantTargetRx: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, src, _ := newMirrorStack(t)
+			c := testClassifier{verdict: test.verdict}
+			if err := s.SetNICClassifier(mirrorSrcNICID, stack.TCIngress, &c); err != nil {
+				t.Fatalf("SetNICClassifier(%d, TCIngress, _): %s", mirrorSrcNICID, err)
+			}
+
+			src.InjectLinkAddr(ipv4.ProtocolNumber, mirrorRemoteLinkAddr, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Data: mirrorIPv4Packet(mirrorRemoteAddr, mirrorLocalAddr).ToVectorisedView(),
+			}))
+
+			if c.pkts != 1 {
+				t.Errorf("got %d packets classified, want 1", c.pkts)
+			}
+			if got := s.Stats().IP.PacketsReceived.Value(); got != test.wantReceived {
+				t.Errorf("got PacketsReceived = %d, want = %d", got, test.wantReceived)
+			}
+			if got := s.NICInfo()[mirrorTargetNICID].Stats.Rx.Packets.Value(); got != test.wantTargetRx {
+				t.Errorf("got %d packets received by NIC %d, want %d", got, mirrorTargetNICID, test.wantTargetRx)
+			}
+		})
+	}
+}
+
+func TestClassifierEgressRedirect(t *testing.T) {
+	s, src, target := newMirrorStack(t)
+	c := testClassifier{verdict: stack.TCVerdict{Action: stack.TCRedirect, RedirectNIC: mirrorTargetNICID}}
+	if err := s.SetNICClassifier(mirrorSrcNICID, stack.TCEgress, &c); err != nil {
+		t.Fatalf("SetNICClassifier(%d, TCEgress, _): %s", mirrorSrcNICID, err)
+	}
+
+	r, err := s.FindRoute(mirrorSrcNICID, mirrorLocalAddr, mirrorRemoteAddr, ipv4.ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(%d, %s, %s, %d, false): %s", mirrorSrcNICID, mirrorLocalAddr, mirrorRemoteAddr, ipv4.ProtocolNumber, err)
+	}
+	defer r.Release()
+	r.RemoteLinkAddress = mirrorRemoteLinkAddr
+	if err := r.WritePacket(nil /* gso */, stack.NetworkHeaderParams{Protocol: header.UDPProtocolNumber, TTL: 64}, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()),
+		Data:               buffer.View("data").ToVectorisedView(),
+	})); err != nil {
+		t.Fatalf("r.WritePacket(_, _, _): %s", err)
+	}
+
+	if n := src.Drain(); n != 0 {
+		t.Errorf("got %d packets sent on NIC %d, want 0", n, mirrorSrcNICID)
+	}
+	p, ok := target.Read()
+	if !ok {
+		t.Fatalf("no packet redirected to NIC %d", mirrorTargetNICID)
+	}
+	if p.Route.RemoteLinkAddress != mirrorRemoteLinkAddr {
+		t.Errorf("got redirected packet to %s, want to %s", p.Route.RemoteLinkAddress, mirrorRemoteLinkAddr)
+	}
+
+	// Once the classifier is removed, packets go through.
+	if err := s.SetNICClassifier(mirrorSrcNICID, stack.TCEgress, nil); err != nil {
+		t.Fatalf("SetNICClassifier(%d, TCEgress, nil): %s", mirrorSrcNICID, err)
+	}
+	if got, err := s.NICClassifier(mirrorSrcNICID, stack.TCEgress); err != nil || got != nil {
+		t.Errorf("got NICClassifier(%d, TCEgress) = (%v, %v), want = (nil, nil)", mirrorSrcNICID, got, err)
+	}
+}
@@ -30,122 +30,227 @@ type protocolIDs struct {
 	transport tcpip.TransportProtocolNumber
 }
 
+// numEndpointsShards is the number of shards each transportEndpoints splits
+// its endpoints into. Updates copy an entire shard, so sharding bounds their
+// cost as the number of registered endpoints grows. It must be a power of two.
+const numEndpointsShards = 64
+
+// endpointsMap maps endpoint IDs to endpoints. Once published in an
+// endpointsShard, an endpointsMap is never modified.
+type endpointsMap map[TransportEndpointID]*endpointsByNIC
+
+// endpointsShard holds the endpoints of a transportEndpoints whose IDs hash to
+// the same shard.
+type endpointsShard struct {
+	// mu serializes updates to endpoints. Lookups don't take it.
+	mu sync.Mutex
+
+	// endpoints is the current endpointsMap of the shard, or nil if the
+	// shard is empty.
+	endpoints endpointsMapAtomicPtr
+}
+
+// lookup returns the endpointsByNIC registered with exactly the given id, or
+// nil if there is none. It does not block.
+func (shard *endpointsShard) lookup(id TransportEndpointID) *endpointsByNIC {
+	if m := shard.endpoints.Load(); m != nil {
+		return (*m)[id]
+	}
+	return nil
+}
+
+// storeLocked publishes a copy of the shard's endpointsMap in which id maps to
+// epsByNIC, or in which id is absent if epsByNIC is nil.
+//
+// Precondition: shard.mu must be locked.
+func (shard *endpointsShard) storeLocked(id TransportEndpointID, epsByNIC *endpointsByNIC) {
+	var old endpointsMap
+	if m := shard.endpoints.Load(); m != nil {
+		old = *m
+	}
+	m := make(endpointsMap, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	if epsByNIC != nil {
+		m[id] = epsByNIC
+	} else {
+		delete(m, id)
+	}
+	shard.endpoints.Store(&m)
+}
+
 // transportEndpoints manages all endpoints of a given protocol. It has its own
 // mutex so as to reduce interference between protocols.
+//
+// Endpoint lookups, which happen for every inbound packet, are wait-free and
+// take no locks, in the manner of RCU. Endpoints are partitioned into shards by
+// a hash of their ID, and the endpointsMap of a shard, along with the
+// endpointsByNIC and multiPortEndpoints it refers to, are never modified once
+// published. Instead, writers copy what they change while holding the mutex
+// of the shard, and atomically publish the new endpointsMap. Readers therefore
+// always see a consistent snapshot, and the garbage collector reclaims old
+// snapshots once no reader refers to them.
+//
+// As a result, a packet looked up concurrently with the unregistration of its
+// endpoint may still be delivered to it, as if it had been received just
+// before. Endpoints drop the packets they receive once closed.
 type transportEndpoints struct {
-	// mu protects all fields of the transportEndpoints.
-	mu        sync.RWMutex
-	endpoints map[TransportEndpointID]*endpointsByNIC
+	// mu protects rawEndpoints.
+	mu sync.RWMutex
+
+	// shards holds the registered endpoints.
+	shards [numEndpointsShards]endpointsShard
+
+	// seed is a random secret for the hash used to select a shard. It is
+	// immutable.
+	seed uint32
+
 	// rawEndpoints contains endpoints for raw sockets, which receive all
 	// traffic of a given protocol regardless of port.
 	rawEndpoints []RawTransportEndpoint
 }
 
+// newTransportEndpoints returns a new, empty transportEndpoints.
+func newTransportEndpoints() *transportEndpoints {
+	return &transportEndpoints{
+		seed: rand.Uint32(),
+	}
+}
+
+// shard returns the shard that holds the endpoint with the given id.
+func (eps *transportEndpoints) shard(id TransportEndpointID) *endpointsShard {
+	// FNV-1a over the ID, seeded so that remote peers cannot choose IDs
+	// that all land in the same shard.
+	const prime = 16777619
+	h := eps.seed
+	h = (h ^ uint32(id.LocalPort)) * prime
+	h = (h ^ uint32(id.RemotePort)) * prime
+	for i := 0; i < len(id.LocalAddress); i++ {
+		h = (h ^ uint32(id.LocalAddress[i])) * prime
+	}
+	for i := 0; i < len(id.RemoteAddress); i++ {
+		h = (h ^ uint32(id.RemoteAddress[i])) * prime
+	}
+	return &eps.shards[h&(numEndpointsShards-1)]
+}
+
 // unregisterEndpoint unregisters the endpoint with the given id such that it
 // won't receive any more packets.
 func (eps *transportEndpoints) unregisterEndpoint(id TransportEndpointID, ep TransportEndpoint, flags ports.Flags, bindToDevice tcpip.NICID) {
-	eps.mu.Lock()
-	defer eps.mu.Unlock()
-	epsByNIC, ok := eps.endpoints[id]
-	if !ok {
+	shard := eps.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	epsByNIC := shard.lookup(id)
+	if epsByNIC == nil {
 		return
 	}
-	if !epsByNIC.unregisterEndpoint(bindToDevice, ep, flags) {
+	epsByNIC, ok := epsByNIC.unregisterEndpoint(bindToDevice, ep, flags)
+	if !ok {
 		return
 	}
-	delete(eps.endpoints, id)
+	shard.storeLocked(id, epsByNIC)
 }
 
 func (eps *transportEndpoints) transportEndpoints() []TransportEndpoint {
-	eps.mu.RLock()
-	defer eps.mu.RUnlock()
-	es := make([]TransportEndpoint, 0, len(eps.endpoints))
-	for _, e := range eps.endpoints {
-		es = append(es, e.transportEndpoints()...)
+	var es []TransportEndpoint
+	for i := range eps.shards {
+		m := eps.shards[i].endpoints.Load()
+		if m == nil {
+			continue
+		}
+		for _, e := range *m {
+			es = append(es, e.transportEndpoints()...)
+		}
 	}
 	return es
 }
 
-// iterEndpointsLocked yields all endpointsByNIC in eps that match id, in
-// descending order of match quality. If a call to yield returns false,
-// iterEndpointsLocked stops iteration and returns immediately.
-//
-// Preconditions: eps.mu must be locked.
-func (eps *transportEndpoints) iterEndpointsLocked(id TransportEndpointID, yield func(*endpointsByNIC) bool) {
+// iterEndpoints yields all endpointsByNIC in eps that match id, in descending
+// order of match quality. If a call to yield returns false, iterEndpoints
+// stops iteration and returns immediately.
+func (eps *transportEndpoints) iterEndpoints(id TransportEndpointID, yield func(*endpointsByNIC) bool) {
 	// Try to find a match with the id as provided.
-	if ep, ok := eps.endpoints[id]; ok {
-		if !yield(ep) {
-			return
-		}
+	if !eps.yieldEndpoint(id, yield) {
+		return
 	}
 
 	// Try to find a match with the id minus the local address.
 	nid := id
 
 	nid.LocalAddress = ""
-	if ep, ok := eps.endpoints[nid]; ok {
-		if !yield(ep) {
-			return
-		}
+	if !eps.yieldEndpoint(nid, yield) {
+		return
 	}
 
 	// Try to find a match with the id minus the remote part.
 	nid.LocalAddress = id.LocalAddress
 	nid.RemoteAddress = ""
 	nid.RemotePort = 0
-	if ep, ok := eps.endpoints[nid]; ok {
-		if !yield(ep) {
-			return
-		}
+	if !eps.yieldEndpoint(nid, yield) {
+		return
 	}
 
 	// Try to find a match with only the local port.
 	nid.LocalAddress = ""
-	if ep, ok := eps.endpoints[nid]; ok {
-		if !yield(ep) {
-			return
-		}
-	}
+	eps.yieldEndpoint(nid, yield)
 }
 
-// findAllEndpointsLocked returns all endpointsByNIC in eps that match id, in
+// yieldEndpoint calls yield with the endpointsByNIC registered with exactly
+// the given id, if there is one, and returns what yield returns. It returns
+// true if there is no such endpointsByNIC.
+func (eps *transportEndpoints) yieldEndpoint(id TransportEndpointID, yield func(*endpointsByNIC) bool) bool {
+	ep := eps.shard(id).lookup(id)
+	return ep == nil || yield(ep)
+}
+
+// findAllEndpoints returns all endpointsByNIC in eps that match id, in
 // descending order of match quality.
-//
-// Preconditions: eps.mu must be locked.
-func (eps *transportEndpoints) findAllEndpointsLocked(id TransportEndpointID) []*endpointsByNIC {
+func (eps *transportEndpoints) findAllEndpoints(id TransportEndpointID) []*endpointsByNIC {
 	var matchedEPs []*endpointsByNIC
-	eps.iterEndpointsLocked(id, func(ep *endpointsByNIC) bool {
+	eps.iterEndpoints(id, func(ep *endpointsByNIC) bool {
 		matchedEPs = append(matchedEPs, ep)
 		return true
 	})
 	return matchedEPs
 }
 
-// findEndpointLocked returns the endpoint that most closely matches the given id.
-//
-// Preconditions: eps.mu must be locked.
-func (eps *transportEndpoints) findEndpointLocked(id TransportEndpointID) *endpointsByNIC {
+// findEndpoint returns the endpoint that most closely matches the given id.
+func (eps *transportEndpoints) findEndpoint(id TransportEndpointID) *endpointsByNIC {
 	var matchedEP *endpointsByNIC
-	eps.iterEndpointsLocked(id, func(ep *endpointsByNIC) bool {
+	eps.iterEndpoints(id, func(ep *endpointsByNIC) bool {
 		matchedEP = ep
 		return false
 	})
 	return matchedEP
 }
 
+// endpointsByNIC holds the endpoints registered with the same ID, by the NIC
+// they are bound to. It is never modified once published in an endpointsMap,
+// and always holds at least one endpoint then.
 type endpointsByNIC struct {
-	mu        sync.RWMutex
 	endpoints map[tcpip.NICID]*multiPortEndpoint
 	// seed is a random secret for a jenkins hash.
 	seed uint32
 }
 
+// clone returns a copy of epsByNIC which can be modified before being
+// published.
+func (epsByNIC *endpointsByNIC) clone() *endpointsByNIC {
+	c := &endpointsByNIC{
+		endpoints: make(map[tcpip.NICID]*multiPortEndpoint, len(epsByNIC.endpoints)+1),
+		seed:      epsByNIC.seed,
+	}
+	for nicID, mpep := range epsByNIC.endpoints {
+		c.endpoints[nicID] = mpep
+	}
+	return c
+}
+
 func (epsByNIC *endpointsByNIC) transportEndpoints() []TransportEndpoint {
-	epsByNIC.mu.RLock()
-	defer epsByNIC.mu.RUnlock()
 	var eps []TransportEndpoint
 	for _, ep := range epsByNIC.endpoints {
-		eps = append(eps, ep.transportEndpoints()...)
+		eps = append(eps, ep.endpoints...)
 	}
 	return eps
 }
@@ -153,40 +258,39 @@ func (epsByNIC *endpointsByNIC) transportEndpoints() []TransportEndpoint {
 // HandlePacket is called by the stack when new packets arrive to this transport
 // endpoint.
 func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt *PacketBuffer) {
-	epsByNIC.mu.RLock()
-
-	mpep, ok := epsByNIC.endpoints[pkt.NICID]
-	if !ok {
+	mpep, boundToNIC := epsByNIC.endpoints[pkt.NICID]
+	if !boundToNIC {
+		var ok bool
 		if mpep, ok = epsByNIC.endpoints[0]; !ok {
-			epsByNIC.mu.RUnlock() // Don't use defer for performance reasons.
 			return
 		}
 	}
 
 	// If this is a broadcast or multicast datagram, deliver the datagram to all
-	// endpoints bound to the right device.
+	// endpoints bound to the right device as well as to all endpoints that are
+	// not bound to any device.
 	if isInboundMulticastOrBroadcast(pkt, id.LocalAddress) {
+		if boundToNIC && pkt.NICID != 0 {
+			if anyMPEP, ok := epsByNIC.endpoints[0]; ok {
+				mpep.handlePacketAll(id, pkt.Clone())
+				mpep = anyMPEP
+			}
+		}
 		mpep.handlePacketAll(id, pkt)
-		epsByNIC.mu.RUnlock() // Don't use defer for performance reasons.
 		return
 	}
 	// multiPortEndpoints are guaranteed to have at least one element.
 	transEP := selectEndpoint(id, mpep, epsByNIC.seed)
 	if queuedProtocol, mustQueue := mpep.demux.queuedProtocols[protocolIDs{mpep.netProto, mpep.transProto}]; mustQueue {
 		queuedProtocol.QueuePacket(transEP, id, pkt)
-		epsByNIC.mu.RUnlock()
 		return
 	}
 
 	transEP.HandlePacket(id, pkt)
-	epsByNIC.mu.RUnlock() // Don't use defer for performance reasons.
 }
 
 // HandleControlPacket implements stack.TransportEndpoint.HandleControlPacket.
 func (epsByNIC *endpointsByNIC) handleControlPacket(n *NIC, id TransportEndpointID, typ ControlType, extra uint32, pkt *PacketBuffer) {
-	epsByNIC.mu.RLock()
-	defer epsByNIC.mu.RUnlock()
-
 	mpep, ok := epsByNIC.endpoints[n.ID()]
 	if !ok {
 		mpep, ok = epsByNIC.endpoints[0]
@@ -202,12 +306,9 @@ func (epsByNIC *endpointsByNIC) handleControlPacket(n *NIC, id TransportEndpoint
 	selectEndpoint(id, mpep, epsByNIC.seed).HandleControlPacket(id, typ, extra, pkt)
 }
 
-// registerEndpoint returns true if it succeeds. It fails and returns
-// false if ep already has an element with the same key.
+// registerEndpoint registers t with epsByNIC, which must not have been
+// published yet.
 func (epsByNIC *endpointsByNIC) registerEndpoint(d *transportDemuxer, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, t TransportEndpoint, flags ports.Flags, bindToDevice tcpip.NICID) *tcpip.Error {
-	epsByNIC.mu.Lock()
-	defer epsByNIC.mu.Unlock()
-
 	multiPortEp, ok := epsByNIC.endpoints[bindToDevice]
 	if !ok {
 		multiPortEp = &multiPortEndpoint{
@@ -215,16 +316,16 @@ func (epsByNIC *endpointsByNIC) registerEndpoint(d *transportDemuxer, netProto t
 			netProto:   netProto,
 			transProto: transProto,
 		}
-		epsByNIC.endpoints[bindToDevice] = multiPortEp
 	}
-
-	return multiPortEp.singleRegisterEndpoint(t, flags)
+	multiPortEp, err := multiPortEp.singleRegisterEndpoint(t, flags)
+	if err != nil {
+		return err
+	}
+	epsByNIC.endpoints[bindToDevice] = multiPortEp
+	return nil
 }
 
-func (epsByNIC *endpointsByNIC) checkEndpoint(d *transportDemuxer, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, flags ports.Flags, bindToDevice tcpip.NICID) *tcpip.Error {
-	epsByNIC.mu.RLock()
-	defer epsByNIC.mu.RUnlock()
-
+func (epsByNIC *endpointsByNIC) checkEndpoint(flags ports.Flags, bindToDevice tcpip.NICID) *tcpip.Error {
 	multiPortEp, ok := epsByNIC.endpoints[bindToDevice]
 	if !ok {
 		return nil
@@ -233,18 +334,27 @@ func (epsByNIC *endpointsByNIC) checkEndpoint(d *transportDemuxer, netProto tcpi
 	return multiPortEp.singleCheckEndpoint(flags)
 }
 
-// unregisterEndpoint returns true if endpointsByNIC has to be unregistered.
-func (epsByNIC *endpointsByNIC) unregisterEndpoint(bindToDevice tcpip.NICID, t TransportEndpoint, flags ports.Flags) bool {
-	epsByNIC.mu.Lock()
-	defer epsByNIC.mu.Unlock()
+// unregisterEndpoint returns a copy of epsByNIC without t, or nil if t was its
+// last endpoint. It returns false if t isn't registered with epsByNIC.
+func (epsByNIC *endpointsByNIC) unregisterEndpoint(bindToDevice tcpip.NICID, t TransportEndpoint, flags ports.Flags) (*endpointsByNIC, bool) {
 	multiPortEp, ok := epsByNIC.endpoints[bindToDevice]
 	if !ok {
-		return false
+		return nil, false
+	}
+	multiPortEp, ok = multiPortEp.unregisterEndpoint(t, flags)
+	if !ok {
+		return nil, false
+	}
+	c := epsByNIC.clone()
+	if multiPortEp != nil {
+		c.endpoints[bindToDevice] = multiPortEp
+	} else {
+		delete(c.endpoints, bindToDevice)
 	}
-	if multiPortEp.unregisterEndpoint(t, flags) {
-		delete(epsByNIC.endpoints, bindToDevice)
+	if len(c.endpoints) == 0 {
+		return nil, true
 	}
-	return len(epsByNIC.endpoints) == 0
+	return c, true
 }
 
 // transportDemuxer demultiplexes packets targeted at a transport endpoint
@@ -278,9 +388,7 @@ func newTransportDemuxer(stack *Stack) *transportDemuxer {
 	for netProto := range stack.networkProtocols {
 		for proto := range stack.transportProtocols {
 			protoIDs := protocolIDs{netProto, proto}
-			d.protocol[protoIDs] = &transportEndpoints{
-				endpoints: make(map[TransportEndpointID]*endpointsByNIC),
-			}
+			d.protocol[protoIDs] = newTransportEndpoints()
 			qTransProto, isQueued := (stack.transportProtocols[proto].proto).(queuedTransportProtocol)
 			if isQueued {
 				d.queuedProtocols[protoIDs] = qTransProto
@@ -317,7 +425,7 @@ func (d *transportDemuxer) checkEndpoint(netProtos []tcpip.NetworkProtocolNumber
 
 // multiPortEndpoint is a container for TransportEndpoints which are bound to
 // the same pair of address and port. endpointsArr always has at least one
-// element.
+// element. Like endpointsByNIC, it is never modified once published.
 //
 // FIXME(gvisor.dev/issue/873): Restore this properly. Currently, we just save
 // this to ensure that the underlying endpoints get saved/restored, but not not
@@ -325,7 +433,6 @@ func (d *transportDemuxer) checkEndpoint(netProtos []tcpip.NetworkProtocolNumber
 //
 // +stateify savable
 type multiPortEndpoint struct {
-	mu         sync.RWMutex `state:"nosave"`
 	demux      *transportDemuxer
 	netProto   tcpip.NetworkProtocolNumber
 	transProto tcpip.TransportProtocolNumber
@@ -336,13 +443,6 @@ type multiPortEndpoint struct {
 	flags     ports.FlagCounter
 }
 
-func (ep *multiPortEndpoint) transportEndpoints() []TransportEndpoint {
-	ep.mu.RLock()
-	eps := append([]TransportEndpoint(nil), ep.endpoints...)
-	ep.mu.RUnlock()
-	return eps
-}
-
 // reciprocalScale scales a value into range [0, n).
 //
 // This is similar to val % n, but faster.
@@ -381,7 +481,6 @@ func selectEndpoint(id TransportEndpointID, mpep *multiPortEndpoint, seed uint32
 }
 
 func (ep *multiPortEndpoint) handlePacketAll(id TransportEndpointID, pkt *PacketBuffer) {
-	ep.mu.RLock()
 	queuedProtocol, mustQueue := ep.demux.queuedProtocols[protocolIDs{ep.netProto, ep.transProto}]
 	// HandlePacket takes ownership of pkt, so each endpoint needs
 	// its own copy except for the final one.
@@ -397,34 +496,23 @@ func (ep *multiPortEndpoint) handlePacketAll(id TransportEndpointID, pkt *Packet
 	} else {
 		endpoint.HandlePacket(id, pkt)
 	}
-	ep.mu.RUnlock() // Don't use defer for performance reasons.
 }
 
-// singleRegisterEndpoint tries to add an endpoint to the multiPortEndpoint
-// list. The list might be empty already.
-func (ep *multiPortEndpoint) singleRegisterEndpoint(t TransportEndpoint, flags ports.Flags) *tcpip.Error {
-	ep.mu.Lock()
-	defer ep.mu.Unlock()
-
-	bits := flags.Bits() & ports.MultiBindFlagMask
-
-	if len(ep.endpoints) != 0 {
-		// If it was previously bound, we need to check if we can bind again.
-		if ep.flags.TotalRefs() > 0 && bits&ep.flags.IntersectionRefs() == 0 {
-			return tcpip.ErrPortInUse
-		}
+// singleRegisterEndpoint returns a copy of the multiPortEndpoint with t added
+// to its list. The list might be empty already.
+func (ep *multiPortEndpoint) singleRegisterEndpoint(t TransportEndpoint, flags ports.Flags) (*multiPortEndpoint, *tcpip.Error) {
+	if err := ep.singleCheckEndpoint(flags); err != nil {
+		return nil, err
 	}
 
-	ep.endpoints = append(ep.endpoints, t)
-	ep.flags.AddRef(bits)
-
-	return nil
+	c := *ep
+	c.endpoints = make([]TransportEndpoint, 0, len(ep.endpoints)+1)
+	c.endpoints = append(append(c.endpoints, ep.endpoints...), t)
+	c.flags.AddRef(flags.Bits() & ports.MultiBindFlagMask)
+	return &c, nil
 }
 
 func (ep *multiPortEndpoint) singleCheckEndpoint(flags ports.Flags) *tcpip.Error {
-	ep.mu.RLock()
-	defer ep.mu.RUnlock()
-
 	bits := flags.Bits() & ports.MultiBindFlagMask
 
 	if len(ep.endpoints) != 0 {
@@ -437,22 +525,23 @@ func (ep *multiPortEndpoint) singleCheckEndpoint(flags ports.Flags) *tcpip.Error
 	return nil
 }
 
-// unregisterEndpoint returns true if multiPortEndpoint has to be unregistered.
-func (ep *multiPortEndpoint) unregisterEndpoint(t TransportEndpoint, flags ports.Flags) bool {
-	ep.mu.Lock()
-	defer ep.mu.Unlock()
-
+// unregisterEndpoint returns a copy of the multiPortEndpoint without t, or nil
+// if t was its last endpoint. It returns false if t isn't in its list.
+func (ep *multiPortEndpoint) unregisterEndpoint(t TransportEndpoint, flags ports.Flags) (*multiPortEndpoint, bool) {
 	for i, endpoint := range ep.endpoints {
-		if endpoint == t {
-			copy(ep.endpoints[i:], ep.endpoints[i+1:])
-			ep.endpoints[len(ep.endpoints)-1] = nil
-			ep.endpoints = ep.endpoints[:len(ep.endpoints)-1]
-
-			ep.flags.DropRef(flags.Bits() & ports.MultiBindFlagMask)
-			break
+		if endpoint != t {
+			continue
+		}
+		if len(ep.endpoints) == 1 {
+			return nil, true
 		}
+		c := *ep
+		c.endpoints = make([]TransportEndpoint, 0, len(ep.endpoints)-1)
+		c.endpoints = append(append(c.endpoints, ep.endpoints[:i]...), ep.endpoints[i+1:]...)
+		c.flags.DropRef(flags.Bits() & ports.MultiBindFlagMask)
+		return &c, true
 	}
-	return len(ep.endpoints) == 0
+	return nil, false
 }
 
 func (d *transportDemuxer) singleRegisterEndpoint(netProto tcpip.NetworkProtocolNumber, protocol tcpip.TransportProtocolNumber, id TransportEndpointID, ep TransportEndpoint, flags ports.Flags, bindToDevice tcpip.NICID) *tcpip.Error {
@@ -466,19 +555,24 @@ func (d *transportDemuxer) singleRegisterEndpoint(netProto tcpip.NetworkProtocol
 		return tcpip.ErrUnknownProtocol
 	}
 
-	eps.mu.Lock()
-	defer eps.mu.Unlock()
+	shard := eps.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	epsByNIC, ok := eps.endpoints[id]
-	if !ok {
+	var epsByNIC *endpointsByNIC
+	if old := shard.lookup(id); old != nil {
+		epsByNIC = old.clone()
+	} else {
 		epsByNIC = &endpointsByNIC{
 			endpoints: make(map[tcpip.NICID]*multiPortEndpoint),
 			seed:      rand.Uint32(),
 		}
-		eps.endpoints[id] = epsByNIC
 	}
-
-	return epsByNIC.registerEndpoint(d, netProto, protocol, ep, flags, bindToDevice)
+	if err := epsByNIC.registerEndpoint(d, netProto, protocol, ep, flags, bindToDevice); err != nil {
+		return err
+	}
+	shard.storeLocked(id, epsByNIC)
+	return nil
 }
 
 func (d *transportDemuxer) singleCheckEndpoint(netProto tcpip.NetworkProtocolNumber, protocol tcpip.TransportProtocolNumber, id TransportEndpointID, flags ports.Flags, bindToDevice tcpip.NICID) *tcpip.Error {
@@ -492,15 +586,12 @@ func (d *transportDemuxer) singleCheckEndpoint(netProto tcpip.NetworkProtocolNum
 		return tcpip.ErrUnknownProtocol
 	}
 
-	eps.mu.RLock()
-	defer eps.mu.RUnlock()
-
-	epsByNIC, ok := eps.endpoints[id]
-	if !ok {
+	epsByNIC := eps.shard(id).lookup(id)
+	if epsByNIC == nil {
 		return nil
 	}
 
-	return epsByNIC.checkEndpoint(d, netProto, protocol, flags, bindToDevice)
+	return epsByNIC.checkEndpoint(flags, bindToDevice)
 }
 
 // unregisterEndpoint unregisters the endpoint with the given id such that it
@@ -530,9 +621,7 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 	// If the packet is a UDP broadcast or multicast, then find all matching
 	// transport endpoints.
 	if protocol == header.UDPProtocolNumber && isInboundMulticastOrBroadcast(pkt, id.LocalAddress) {
-		eps.mu.RLock()
-		destEPs := eps.findAllEndpointsLocked(id)
-		eps.mu.RUnlock()
+		destEPs := eps.findAllEndpoints(id)
 		// Fail if we didn't find at least one matching transport endpoint.
 		if len(destEPs) == 0 {
 			d.stack.stats.UDP.UnknownPortErrors.Increment()
@@ -558,9 +647,7 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		return true
 	}
 
-	eps.mu.RLock()
-	ep := eps.findEndpointLocked(id)
-	eps.mu.RUnlock()
+	ep := eps.findEndpoint(id)
 	if ep == nil {
 		if protocol == header.UDPProtocolNumber {
 			d.stack.stats.UDP.UnknownPortErrors.Increment()
@@ -603,9 +690,7 @@ func (d *transportDemuxer) deliverControlPacket(n *NIC, net tcpip.NetworkProtoco
 		return false
 	}
 
-	eps.mu.RLock()
-	ep := eps.findEndpointLocked(id)
-	eps.mu.RUnlock()
+	ep := eps.findEndpoint(id)
 	if ep == nil {
 		return false
 	}
@@ -614,6 +699,45 @@ func (d *transportDemuxer) deliverControlPacket(n *NIC, net tcpip.NetworkProtoco
 	return true
 }
 
+// nicRemoved delivers a ControlNICRemoved control message to all endpoints
+// bound to NIC nicID, or to one of the NIC's addresses in addrs.
+func (d *transportDemuxer) nicRemoved(nicID tcpip.NICID, addrs map[tcpip.Address]struct{}) {
+	type target struct {
+		id TransportEndpointID
+		ep TransportEndpoint
+	}
+	var targets []target
+	// Endpoints registered for both IPv4 and IPv6 must only be notified once.
+	seen := make(map[TransportEndpoint]struct{})
+	for _, eps := range d.protocol {
+		for i := range eps.shards {
+			m := eps.shards[i].endpoints.Load()
+			if m == nil {
+				continue
+			}
+			for id, epsByNIC := range *m {
+				_, boundToAddr := addrs[id.LocalAddress]
+				for bindToDevice, mpep := range epsByNIC.endpoints {
+					if !boundToAddr && bindToDevice != nicID {
+						continue
+					}
+					for _, ep := range mpep.endpoints {
+						if _, ok := seen[ep]; !ok {
+							seen[ep] = struct{}{}
+							targets = append(targets, target{id: id, ep: ep})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Endpoints may unregister themselves when handling the message.
+	for _, t := range targets {
+		t.ep.HandleControlPacket(t.id, ControlNICRemoved, 0, nil)
+	}
+}
+
 // findTransportEndpoint find a single endpoint that most closely matches the provided id.
 func (d *transportDemuxer) findTransportEndpoint(netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, id TransportEndpointID, nicID tcpip.NICID) TransportEndpoint {
 	eps, ok := d.protocol[protocolIDs{netProto, transProto}]
@@ -621,26 +745,17 @@ func (d *transportDemuxer) findTransportEndpoint(netProto tcpip.NetworkProtocolN
 		return nil
 	}
 
-	eps.mu.RLock()
-	epsByNIC := eps.findEndpointLocked(id)
-	if epsByNIC == nil {
-		eps.mu.RUnlock()
-		return nil
-	}
-
-	epsByNIC.mu.RLock()
-	eps.mu.RUnlock()
-
-	mpep, ok := epsByNIC.endpoints[nicID]
-	if !ok {
-		if mpep, ok = epsByNIC.endpoints[0]; !ok {
-			epsByNIC.mu.RUnlock() // Don't use defer for performance reasons.
-			return nil
+	var ep TransportEndpoint
+	eps.iterEndpoints(id, func(epsByNIC *endpointsByNIC) bool {
+		mpep, ok := epsByNIC.endpoints[nicID]
+		if !ok {
+			mpep, ok = epsByNIC.endpoints[0]
 		}
-	}
-
-	ep := selectEndpoint(id, mpep, epsByNIC.seed)
-	epsByNIC.mu.RUnlock()
+		if ok {
+			ep = selectEndpoint(id, mpep, epsByNIC.seed)
+		}
+		return false
+	})
 	return ep
 }
 
@@ -383,3 +383,109 @@ func TestBindToDeviceDistribution(t *testing.T) {
 		}
 	}
 }
+
+// TestTransportDemuxerManyEndpoints checks that packets are demultiplexed
+// correctly when endpoints are spread across many demuxer shards, and that
+// unregistered endpoints stop receiving packets.
+func TestTransportDemuxerManyEndpoints(t *testing.T) {
+	const numEndpoints = 500
+
+	c := newDualTestContextMultiNIC(t, defaultMTU, []tcpip.NICID{1})
+	var eps []tcpip.Endpoint
+	for i := 0; i < numEndpoints; i++ {
+		var wq waiter.Queue
+		ep, err := c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint failed: %s", err)
+		}
+		defer ep.Close()
+		if err := ep.Bind(tcpip.FullAddress{Addr: testDstAddrV4, Port: testDstPort + uint16(i)}); err != nil {
+			t.Fatalf("ep.Bind(...) on endpoint %d failed: %s", i, err)
+		}
+		eps = append(eps, ep)
+	}
+
+	// Close every other endpoint.
+	for i := 0; i < numEndpoints; i += 2 {
+		eps[i].Close()
+	}
+
+	unknownPortErrors := c.s.Stats().UDP.UnknownPortErrors
+	for i, ep := range eps {
+		want := unknownPortErrors.Value()
+		if i%2 == 0 {
+			want++
+		}
+		c.sendV4Packet(newPayload(), &headers{srcPort: testSrcPort, dstPort: testDstPort + uint16(i)}, 1)
+		if got := unknownPortErrors.Value(); got != want {
+			t.Errorf("got UnknownPortErrors.Value() = %d after sending to endpoint %d, want = %d", got, i, want)
+		}
+		if i%2 == 0 {
+			continue
+		}
+		if _, _, err := ep.Read(nil); err != nil {
+			t.Errorf("Read on endpoint %d failed: %s", i, err)
+		}
+	}
+
+	// Reuse the ports of the closed endpoints.
+	for i := 0; i < numEndpoints; i += 2 {
+		var wq waiter.Queue
+		ep, err := c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint failed: %s", err)
+		}
+		defer ep.Close()
+		if err := ep.Bind(tcpip.FullAddress{Addr: testDstAddrV4, Port: testDstPort + uint16(i)}); err != nil {
+			t.Fatalf("ep.Bind(...) on new endpoint %d failed: %s", i, err)
+		}
+		c.sendV4Packet(newPayload(), &headers{srcPort: testSrcPort, dstPort: testDstPort + uint16(i)}, 1)
+		if _, _, err := ep.Read(nil); err != nil {
+			t.Errorf("Read on new endpoint %d failed: %s", i, err)
+		}
+	}
+}
+
+// TestTransportDemuxerConcurrentChurn registers and unregisters endpoints
+// while packets are being demultiplexed to them, to exercise the
+// demuxer's copy-on-write shards under the race detector.
+func TestTransportDemuxerConcurrentChurn(t *testing.T) {
+	const (
+		numWorkers = 4
+		iterations = 200
+	)
+
+	c := newDualTestContextMultiNIC(t, defaultMTU, []tcpip.NICID{1})
+	done := make(chan struct{}, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func(w int) {
+			defer func() { done <- struct{}{} }()
+			port := testDstPort + uint16(w)
+			for i := 0; i < iterations; i++ {
+				var wq waiter.Queue
+				ep, err := c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+				if err != nil {
+					t.Errorf("NewEndpoint failed: %s", err)
+					return
+				}
+				if err := ep.Bind(tcpip.FullAddress{Addr: testDstAddrV4, Port: port}); err != nil {
+					t.Errorf("ep.Bind(...) on port %d failed: %s", port, err)
+					ep.Close()
+					return
+				}
+				ep.Close()
+			}
+		}(w)
+	}
+
+	for finished := 0; finished < numWorkers; {
+		select {
+		case <-done:
+			finished++
+		default:
+			for w := 0; w < numWorkers; w++ {
+				c.sendV4Packet(newPayload(), &headers{srcPort: testSrcPort, dstPort: testDstPort + uint16(w)}, 1)
+			}
+		}
+	}
+}
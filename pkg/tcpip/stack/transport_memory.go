@@ -0,0 +1,114 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// TransportMemory accounts for the memory held in socket buffers by all the
+// endpoints of a transport protocol, and tracks whether the protocol is under
+// memory pressure. It is the netstack equivalent of Linux's struct proto
+// memory_allocated/memory_pressure pair. A TransportMemory may be shared by
+// the protocols of several stacks, as Linux shares them between network
+// namespaces.
+//
+// Callers charge the memory allocated to hold buffers, which may exceed the
+// size of the data they hold.
+//
+// The zero value has no limits. All methods are safe for concurrent use.
+type TransportMemory struct {
+	// state holds the number of bytes currently charged shifted left by
+	// one, with the low bit set while the protocol is under memory
+	// pressure. Packing both lets them change together, so that the
+	// pressure state always reflects the latest charge. It must be accessed
+	// atomically.
+	state int64
+
+	// limits holds the current tcpip.TransportMemoryLimitsOption, as set by
+	// SetLimits. It is nil if limits were never set.
+	limits atomic.Value
+}
+
+// SetLimits validates and installs new limits. Usage already charged is not
+// affected, but pressure is re-evaluated against the new limits.
+func (m *TransportMemory) SetLimits(l tcpip.TransportMemoryLimitsOption) *tcpip.Error {
+	if l.Min < 0 || l.Pressure < l.Min || (l.Max != 0 && l.Max < l.Pressure) {
+		return tcpip.ErrInvalidOptionValue
+	}
+	m.limits.Store(l)
+	m.add(0)
+	return nil
+}
+
+// Limits returns the current limits.
+func (m *TransportMemory) Limits() tcpip.TransportMemoryLimitsOption {
+	l, _ := m.limits.Load().(tcpip.TransportMemoryLimitsOption)
+	return l
+}
+
+// Allocated returns the number of bytes currently charged.
+func (m *TransportMemory) Allocated() int {
+	return int(atomic.LoadInt64(&m.state) >> 1)
+}
+
+// Charge records n more bytes as held by an endpoint. Charge never fails:
+// callers that may refuse memory must check OverLimit beforehand.
+func (m *TransportMemory) Charge(n int) {
+	m.add(int64(n))
+}
+
+// Release records that n previously charged bytes have been freed.
+func (m *TransportMemory) Release(n int) {
+	m.add(-int64(n))
+}
+
+// add changes the number of bytes charged by delta, and moves the pressure
+// state in response. Pressure is entered above the pressure limit and left at
+// or below the minimum, so that it doesn't flap around a single threshold.
+func (m *TransportMemory) add(delta int64) {
+	for {
+		old := atomic.LoadInt64(&m.state)
+		allocated := old>>1 + delta
+		pressure := old & 1
+		switch l := m.Limits(); {
+		case l.Max == 0:
+			pressure = 0
+		case allocated > int64(l.Pressure):
+			pressure = 1
+		case allocated <= int64(l.Min):
+			pressure = 0
+		}
+		if atomic.CompareAndSwapInt64(&m.state, old, allocated<<1|pressure) {
+			return
+		}
+	}
+}
+
+// UnderPressure returns true if the protocol is under memory pressure, in
+// which case endpoints should stop growing their buffers and advertise
+// smaller receive windows.
+func (m *TransportMemory) UnderPressure() bool {
+	return atomic.LoadInt64(&m.state)&1 != 0
+}
+
+// OverLimit returns true if the hard limit has been reached, in which case no
+// new buffers should be accepted.
+func (m *TransportMemory) OverLimit() bool {
+	max := m.Limits().Max
+	return max != 0 && m.Allocated() >= max
+}
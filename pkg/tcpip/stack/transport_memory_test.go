@@ -0,0 +1,145 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"sync"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+func TestTransportMemorySetLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  tcpip.TransportMemoryLimitsOption
+		wantErr *tcpip.Error
+	}{
+		{"Unlimited", tcpip.TransportMemoryLimitsOption{}, nil},
+		{"Valid", tcpip.TransportMemoryLimitsOption{Min: 1, Pressure: 2, Max: 3}, nil},
+		{"NegativeMin", tcpip.TransportMemoryLimitsOption{Min: -1, Pressure: 2, Max: 3}, tcpip.ErrInvalidOptionValue},
+		{"PressureBelowMin", tcpip.TransportMemoryLimitsOption{Min: 2, Pressure: 1, Max: 3}, tcpip.ErrInvalidOptionValue},
+		{"MaxBelowPressure", tcpip.TransportMemoryLimitsOption{Min: 1, Pressure: 3, Max: 2}, tcpip.ErrInvalidOptionValue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m TransportMemory
+			if err := m.SetLimits(test.limits); err != test.wantErr {
+				t.Fatalf("got m.SetLimits(%+v) = %s, want = %s", test.limits, err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if got := m.Limits(); got != test.limits {
+				t.Errorf("got m.Limits() = %+v, want = %+v", got, test.limits)
+			}
+		})
+	}
+}
+
+func TestTransportMemoryPressure(t *testing.T) {
+	var m TransportMemory
+	if err := m.SetLimits(tcpip.TransportMemoryLimitsOption{Min: 100, Pressure: 200, Max: 300}); err != nil {
+		t.Fatalf("m.SetLimits(...): %s", err)
+	}
+
+	steps := []struct {
+		delta        int
+		wantPressure bool
+		wantOver     bool
+	}{
+		{delta: 150},
+		// Entering pressure requires crossing the pressure limit.
+		{delta: 51, wantPressure: true},
+		// Leaving it requires falling to the minimum.
+		{delta: -100, wantPressure: true},
+		{delta: -1},
+		{delta: 200, wantPressure: true, wantOver: true},
+		{delta: -1, wantPressure: true},
+		{delta: -199},
+		{delta: -100},
+	}
+	for i, step := range steps {
+		if step.delta > 0 {
+			m.Charge(step.delta)
+		} else {
+			m.Release(-step.delta)
+		}
+		if got := m.UnderPressure(); got != step.wantPressure {
+			t.Errorf("step %d: got m.UnderPressure() = %t, want = %t (allocated = %d)", i, got, step.wantPressure, m.Allocated())
+		}
+		if got := m.OverLimit(); got != step.wantOver {
+			t.Errorf("step %d: got m.OverLimit() = %t, want = %t (allocated = %d)", i, got, step.wantOver, m.Allocated())
+		}
+	}
+	if got := m.Allocated(); got != 0 {
+		t.Errorf("got m.Allocated() = %d, want = 0", got)
+	}
+}
+
+func TestTransportMemoryUnlimited(t *testing.T) {
+	var m TransportMemory
+	m.Charge(1 << 30)
+	if m.UnderPressure() || m.OverLimit() {
+		t.Errorf("got m.UnderPressure() = %t, m.OverLimit() = %t with no limits, want both false", m.UnderPressure(), m.OverLimit())
+	}
+}
+
+func TestTransportMemorySetLimitsReevaluatesPressure(t *testing.T) {
+	var m TransportMemory
+	m.Charge(150)
+	if err := m.SetLimits(tcpip.TransportMemoryLimitsOption{Min: 50, Pressure: 100, Max: 200}); err != nil {
+		t.Fatalf("m.SetLimits(...): %s", err)
+	}
+	if !m.UnderPressure() {
+		t.Errorf("got m.UnderPressure() = false after lowering the pressure limit below usage, want = true")
+	}
+	if err := m.SetLimits(tcpip.TransportMemoryLimitsOption{}); err != nil {
+		t.Fatalf("m.SetLimits(...): %s", err)
+	}
+	if m.UnderPressure() {
+		t.Errorf("got m.UnderPressure() = true after removing limits, want = false")
+	}
+}
+
+func TestTransportMemoryConcurrent(t *testing.T) {
+	var m TransportMemory
+	if err := m.SetLimits(tcpip.TransportMemoryLimitsOption{Min: 100, Pressure: 200, Max: 300}); err != nil {
+		t.Fatalf("m.SetLimits(...): %s", err)
+	}
+
+	// Charges and releases racing across the thresholds must leave the
+	// pressure state consistent with the final usage.
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Charge(250)
+				m.Release(250)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := m.Allocated(); got != 0 {
+		t.Errorf("got m.Allocated() = %d, want = 0", got)
+	}
+	if m.UnderPressure() {
+		t.Errorf("got m.UnderPressure() = true with nothing allocated, want = false")
+	}
+}
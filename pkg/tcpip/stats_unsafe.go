@@ -0,0 +1,36 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcpip
+
+import (
+	"unsafe"
+)
+
+// minStackShift is the log2 of the minimum goroutine stack size.
+const minStackShift = 11
+
+// statCounterShardIndex returns a number used to pick the shard of a sharded
+// StatCounter updated by the calling goroutine.
+//
+// It hashes the address of a stack variable. Goroutine stacks don't overlap,
+// so goroutines running concurrently (e.g. the dispatchers of different NIC
+// queues) tend to update different shards, while a given goroutine keeps
+// updating the same one.
+func statCounterShardIndex() int {
+	var x byte
+	p := uint64(uintptr(unsafe.Pointer(&x)) >> minStackShift)
+	// Fibonacci hashing spreads stacks allocated next to each other.
+	return int((p * 0x9e3779b97f4a7c15) >> 32)
+}
@@ -33,6 +33,7 @@ import (
 	"fmt"
 	"math/bits"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -201,11 +202,19 @@ func (e ErrSaveRejection) Error() string {
 //
 // Times returned by a Clock should always be used for application-visible
 // time. Only monotonic times should be used for netstack internal timekeeping.
+//
+// All the timekeeping of a stack, from its timers to its RTT measurements, is
+// done with the clock it was created with, so that an embedder can drive the
+// stack with a virtual clock (see faketime.ManualClock).
 type Clock interface {
 	// NowNanoseconds returns the current real time as a number of
 	// nanoseconds since the Unix epoch.
 	NowNanoseconds() int64
 
+	// Now returns the current time, for measuring durations. It must
+	// advance along with NowMonotonic.
+	Now() time.Time
+
 	// NowMonotonic returns a monotonic time value.
 	NowMonotonic() int64
 
@@ -375,6 +384,14 @@ func (s Subnet) Equal(o Subnet) bool {
 // NICID is a number that uniquely identifies a NIC.
 type NICID int32
 
+// NICGroupID identifies a group of NICs. Each group is a separate routing
+// domain: a route is only looked up through the NICs of a single group, and a
+// route through a NIC is only used by lookups in its group.
+type NICGroupID uint32
+
+// DefaultNICGroup is the group NICs belong to unless placed in another group.
+const DefaultNICGroup NICGroupID = 0
+
 // ShutdownFlags represents flags that can be passed to the Shutdown() method
 // of the Endpoint interface.
 type ShutdownFlags int
@@ -486,11 +503,36 @@ type ControlMessages struct {
 	// TClass is the IPv6 traffic class of the associated packet.
 	TClass uint32
 
+	// HasTTL indicates whether TTL is valid/set.
+	HasTTL bool
+
+	// TTL is the IPv4 time to live of the associated packet.
+	TTL uint8
+
+	// HasHopLimit indicates whether HopLimit is valid/set.
+	HasHopLimit bool
+
+	// HopLimit is the IPv6 hop limit of the associated packet.
+	HopLimit uint8
+
+	// HasIPOptions indicates whether IPOptions is valid/set.
+	HasIPOptions bool
+
+	// IPOptions holds the IPv4 options of the associated packet.
+	IPOptions []byte
+
 	// HasIPPacketInfo indicates whether PacketInfo is set.
 	HasIPPacketInfo bool
 
 	// PacketInfo holds interface and address data on an incoming packet.
 	PacketInfo IPPacketInfo
+
+	// HasIPv6PathMTU indicates whether IPv6PathMTU is set.
+	HasIPv6PathMTU bool
+
+	// IPv6PathMTU holds the path MTU reported by an ICMPv6 Packet Too Big
+	// message, for the IPV6_PATHMTU control message.
+	IPv6PathMTU PathMTUInfo
 }
 
 // PacketOwner is used to get UID and GID of the packet.
@@ -542,10 +584,13 @@ type Endpoint interface {
 	// not). The channel is only non-nil in this case.
 	Write(Payloader, WriteOptions) (int64, <-chan struct{}, *Error)
 
-	// Peek reads data without consuming it from the endpoint.
+	// Peek reads data without consuming it from the endpoint, starting off
+	// bytes into the data pending. Datagram endpoints which support it read
+	// from the first datagram ending after off, and store its sender in addr
+	// if it isn't nil.
 	//
 	// This method does not block if there is no data pending.
-	Peek([][]byte) (int64, ControlMessages, *Error)
+	Peek(vec [][]byte, off int64, addr *FullAddress) (int64, ControlMessages, *Error)
 
 	// Connect connects the endpoint to its peer. Specifying a NIC is
 	// optional.
@@ -694,6 +739,12 @@ type WriteOptions struct {
 	// endpoint. If Atomic is false, then data fetched from the Payloader may be
 	// discarded if available endpoint buffer space is unsufficient.
 	Atomic bool
+
+	// ControlMessages holds the ancillary data of the write. If set, the
+	// TOS, TClass, TTL and HopLimit of the control messages override the
+	// socket options of the endpoint for the packets of the write. Other
+	// control messages are ignored.
+	ControlMessages ControlMessages
 }
 
 // SockOptInt represents socket options which values have the int type.
@@ -726,8 +777,16 @@ const (
 	// always return PMTUDiscoveryDont.
 	MTUDiscoverOption
 
+	// MTUOption is used by GetSockOptInt to get the path MTU of a connected
+	// endpoint, including the network header, as with IP_MTU and IPV6_MTU
+	// on Linux. It fails with ErrNotConnected if the endpoint isn't
+	// connected.
+	MTUOption
+
 	// MulticastTTLOption is used by SetSockOptInt/GetSockOptInt to control
-	// the default TTL value for multicast messages. The default is 1.
+	// the default TTL value for multicast messages. The default is set by the
+	// network protocol's DefaultMulticastTTLOption, and is restored by setting
+	// a value of -1.
 	MulticastTTLOption
 
 	// ReceiveQueueSizeOption is used in GetSockOptInt to specify that the
@@ -742,10 +801,20 @@ const (
 	// specify the receive buffer size option.
 	ReceiveBufferSizeOption
 
+	// ReceiveBufferSizeForceOption is used by SetSockOptInt to set the
+	// receive buffer size regardless of its maximum, as with
+	// SO_RCVBUFFORCE. The size is then read with ReceiveBufferSizeOption.
+	ReceiveBufferSizeForceOption
+
 	// SendQueueSizeOption is used in GetSockOptInt to specify that the
 	// number of unread bytes in the output buffer should be returned.
 	SendQueueSizeOption
 
+	// SendQueueUnsentSizeOption is used in GetSockOptInt to specify that
+	// the number of bytes in the output buffer which were not sent yet
+	// should be returned.
+	SendQueueUnsentSizeOption
+
 	// TTLOption is used by SetSockOptInt/GetSockOptInt to control the
 	// default TTL/hop limit value for unicast messages. The default is
 	// protocol specific.
@@ -805,6 +874,84 @@ func (*DefaultTTLOption) isGettableNetworkProtocolOption() {}
 
 func (*DefaultTTLOption) isSettableNetworkProtocolOption() {}
 
+// DefaultMulticastTTLOption is used by stack.(*Stack).NetworkProtocolOption to
+// specify the default TTL of multicast packets, used by endpoints which didn't
+// set MulticastTTLOption.
+type DefaultMulticastTTLOption uint8
+
+func (*DefaultMulticastTTLOption) isGettableNetworkProtocolOption() {}
+
+func (*DefaultMulticastTTLOption) isSettableNetworkProtocolOption() {}
+
+// MulticastMembershipLimitsOption is used by
+// stack.(*Stack).NetworkProtocolOption to bound the number of multicast groups
+// that may be joined through sockets. A limit of 0 means no limit.
+type MulticastMembershipLimitsOption struct {
+	// MaxSocketMemberships is the maximum number of groups a single socket
+	// may join. Analogous to Linux's net.ipv4.igmp_max_memberships.
+	MaxSocketMemberships int
+
+	// MaxNICMemberships is the maximum number of groups which may be joined on
+	// a single NIC. Groups joined implicitly by the stack, such as the
+	// all-nodes and solicited-node groups, count towards the limit but are
+	// never refused.
+	MaxNICMemberships int
+}
+
+func (*MulticastMembershipLimitsOption) isGettableNetworkProtocolOption() {}
+
+func (*MulticastMembershipLimitsOption) isSettableNetworkProtocolOption() {}
+
+// MulticastProxyOption is used by stack.(*Stack).NetworkProtocolOption to run
+// the protocol as a multicast proxy, as per RFC 4605: the memberships of the
+// hosts on the downstream NICs are aggregated and reported on the upstream
+// NIC, and multicast packets are forwarded between them accordingly. Only
+// supported by IPv6, as an MLD proxy.
+type MulticastProxyOption struct {
+	// Upstream is the NIC the aggregated memberships are reported on. Zero
+	// disables the proxy.
+	Upstream NICID
+
+	// Downstream are the NICs whose hosts' memberships are proxied.
+	Downstream []NICID
+}
+
+func (*MulticastProxyOption) isGettableNetworkProtocolOption() {}
+
+func (*MulticastProxyOption) isSettableNetworkProtocolOption() {}
+
+// ICMPEchoEnableProbeOption is used by stack.(*Stack).NetworkProtocolOption to
+// enable replies to ICMP Extended Echo Requests probing the state of local
+// interfaces, as per RFC 8335. Analogous to Linux's
+// net.ipv4.icmp_echo_enable_probe. Disabled by default.
+type ICMPEchoEnableProbeOption bool
+
+func (*ICMPEchoEnableProbeOption) isGettableNetworkProtocolOption() {}
+
+func (*ICMPEchoEnableProbeOption) isSettableNetworkProtocolOption() {}
+
+// ReassemblyMemoryLimitsOption is used by stack.(*Stack).NetworkProtocolOption
+// to specify the memory that may be used to reassemble fragmented packets.
+type ReassemblyMemoryLimitsOption struct {
+	// High is the memory used by fragments above which the least recently
+	// updated packets are evicted until Low is reached. Analogous to Linux's
+	// net.ipv4.ipfrag_high_thresh.
+	High int
+
+	// Low is the memory used by fragments that eviction brings the usage
+	// down to. Analogous to Linux's net.ipv4.ipfrag_low_thresh.
+	Low int
+
+	// PerSource is the memory the fragments sent by a single source may use,
+	// so that a peer can't evict the packets of everyone else. 0 means no
+	// limit.
+	PerSource int
+}
+
+func (*ReassemblyMemoryLimitsOption) isGettableNetworkProtocolOption() {}
+
+func (*ReassemblyMemoryLimitsOption) isSettableNetworkProtocolOption() {}
+
 // GettableTransportProtocolOption is a marker interface for transport protocol
 // options that may be queried.
 type GettableTransportProtocolOption interface {
@@ -826,6 +973,16 @@ func (*TCPSACKEnabled) isGettableTransportProtocolOption() {}
 
 func (*TCPSACKEnabled) isSettableTransportProtocolOption() {}
 
+// TCPAbortOnOverflowOption is used by stack.(*Stack).SetTransportProtocolOption
+// to make listening endpoints reset connections whose handshake completes
+// while the accept queue is full, instead of dropping the final ACK and
+// waiting for it to be retransmitted.
+type TCPAbortOnOverflowOption bool
+
+func (*TCPAbortOnOverflowOption) isGettableTransportProtocolOption() {}
+
+func (*TCPAbortOnOverflowOption) isSettableTransportProtocolOption() {}
+
 // TCPRecovery is the loss deteoction algorithm used by TCP.
 type TCPRecovery int32
 
@@ -893,6 +1050,32 @@ func (*TCPModerateReceiveBufferOption) isGettableTransportProtocolOption() {}
 
 func (*TCPModerateReceiveBufferOption) isSettableTransportProtocolOption() {}
 
+// TCPAutocorkingOption enables/disables the coalescing of small writes made in
+// quick succession while data is in flight, even with TCP_NODELAY, like the
+// tcp_autocorking sysctl of Linux.
+type TCPAutocorkingOption bool
+
+func (*TCPAutocorkingOption) isGettableTransportProtocolOption() {}
+
+func (*TCPAutocorkingOption) isSettableTransportProtocolOption() {}
+
+// TransportMemoryLimitsOption bounds the memory, in bytes, held in the socket
+// buffers of all endpoints of a transport protocol. It is the equivalent of
+// Linux's tcp_mem and udp_mem sysctls.
+//
+// Once usage rises above Pressure the protocol is under memory pressure and
+// endpoints moderate their buffers until usage falls back to Min. Above Max
+// no new buffers are accepted. A zero Max disables accounting limits.
+type TransportMemoryLimitsOption struct {
+	Min      int
+	Pressure int
+	Max      int
+}
+
+func (*TransportMemoryLimitsOption) isGettableTransportProtocolOption() {}
+
+func (*TransportMemoryLimitsOption) isSettableTransportProtocolOption() {}
+
 // GettableSocketOption is a marker interface for socket options that may be
 // queried.
 type GettableSocketOption interface {
@@ -913,12 +1096,100 @@ func (*BindToDeviceOption) isGettableSocketOption() {}
 
 func (*BindToDeviceOption) isSettableSocketOption() {}
 
+// ConnectProgressEventType is the type of a ConnectProgressEvent.
+type ConnectProgressEventType int
+
+const (
+	// ConnectSYNSent is reported when the first SYN of a connection attempt
+	// is sent.
+	ConnectSYNSent ConnectProgressEventType = iota
+
+	// ConnectSYNRetransmitted is reported each time the SYN of a connection
+	// attempt is retransmitted.
+	ConnectSYNRetransmitted
+
+	// ConnectEstablished is reported when the connection is established,
+	// after its first round trip.
+	ConnectEstablished
+
+	// ConnectFailed is reported when a connection attempt fails.
+	ConnectFailed
+)
+
+// ConnectProgressEvent describes the progress of a connection attempt.
+type ConnectProgressEvent struct {
+	Type ConnectProgressEventType
+
+	// NetProto is the network protocol of the connection attempt, which is
+	// IPv4 for IPv4-mapped addresses on dual-stack endpoints.
+	NetProto NetworkProtocolNumber
+
+	// RemoteAddress is the address being connected to.
+	RemoteAddress FullAddress
+
+	// Elapsed is the time elapsed since the first SYN was sent. For
+	// ConnectEstablished events, it is the round-trip time of the handshake.
+	Elapsed time.Duration
+
+	// Err is the reason ConnectFailed events failed.
+	Err *Error
+}
+
+// ConnectObserver observes the progress of connection attempts.
+type ConnectObserver interface {
+	// OnConnectProgress is called as the connection attempt progresses. It is
+	// called with the endpoint locked and must not call back into it.
+	OnConnectProgress(ConnectProgressEvent)
+}
+
+// ConnectObserverOption is used by SetSockOpt to observe the progress of the
+// connection attempts of an endpoint, e.g. to race the attempts of IPv4 and
+// IPv6 endpoints as per RFC 8305 (Happy Eyeballs). A nil Observer stops the
+// observation.
+type ConnectObserverOption struct {
+	Observer ConnectObserver
+}
+
+func (*ConnectObserverOption) isSettableSocketOption() {}
+
 // TCPInfoOption is used by GetSockOpt to expose TCP statistics.
 //
 // TODO(b/64800844): Add and populate stat fields.
 type TCPInfoOption struct {
 	RTT    time.Duration
 	RTTVar time.Duration
+
+	// AcceptQueueLen is the number of established connections waiting to
+	// be accepted from a listening endpoint.
+	AcceptQueueLen int
+
+	// SynQueueLen is the number of connections a listening endpoint is
+	// still completing the handshake for.
+	SynQueueLen int
+
+	// Backlog is the maximum number of connections a listening endpoint
+	// queues, including those still completing the handshake.
+	Backlog int
+
+	// Retransmits is the number of segments the endpoint retransmitted.
+	Retransmits uint64
+
+	// SegmentsSent and SegmentsReceived are the number of segments the
+	// endpoint sent and received.
+	SegmentsSent     uint64
+	SegmentsReceived uint64
+
+	// KeepaliveProbesSent is the number of keepalive probes the endpoint
+	// sent.
+	KeepaliveProbesSent uint64
+
+	// Probes is the number of unacknowledged keepalive or zero window
+	// probes.
+	Probes int
+
+	// LastAckRecv is the time elapsed since the endpoint last received an
+	// acknowledgement, or 0 if it isn't connected.
+	LastAckRecv time.Duration
 }
 
 func (*TCPInfoOption) isGettableSocketOption() {}
@@ -1058,6 +1329,48 @@ func (*TCPSynRetriesOption) isGettableTransportProtocolOption() {}
 
 func (*TCPSynRetriesOption) isSettableTransportProtocolOption() {}
 
+// TCPMTUProbingOption is used by SetTransportProtocolOption and
+// TransportProtocolOption to specify when TCP endpoints do packetization layer
+// path MTU discovery (RFC 8899), like net.ipv4.tcp_mtu_probing on Linux.
+type TCPMTUProbingOption int
+
+const (
+	// TCPMTUProbingDisabled disables probing. The MSS only follows Packet Too
+	// Big messages.
+	TCPMTUProbingDisabled TCPMTUProbingOption = iota
+
+	// TCPMTUProbingOnBlackHole starts probing once repeated retransmission
+	// timeouts suggest that Packet Too Big messages are being dropped.
+	TCPMTUProbingOnBlackHole
+
+	// TCPMTUProbingAlways always probes, starting from a small base MSS.
+	TCPMTUProbingAlways
+)
+
+func (*TCPMTUProbingOption) isGettableTransportProtocolOption() {}
+
+func (*TCPMTUProbingOption) isSettableTransportProtocolOption() {}
+
+// TCPMSSClampOption is used by SetTransportProtocolOption and
+// TransportProtocolOption to bound the MSS of all TCP connections, both the
+// one advertised in SYN segments and the one used to send data. It is useful
+// when the stack is behind tunnels that it doesn't know about, whose
+// encapsulation reduces the MTU of the path.
+//
+// The bounds apply regardless of iptables rules.
+type TCPMSSClampOption struct {
+	// Overhead is the number of bytes subtracted from the MTU of the
+	// egress route when computing the MSS.
+	Overhead uint16
+
+	// Max is the largest MSS used, or zero for no limit.
+	Max uint16
+}
+
+func (*TCPMSSClampOption) isGettableTransportProtocolOption() {}
+
+func (*TCPMSSClampOption) isSettableTransportProtocolOption() {}
+
 // MulticastInterfaceOption is used by SetSockOpt/GetSockOpt to specify a
 // default interface for multicast.
 type MulticastInterfaceOption struct {
@@ -1148,6 +1461,36 @@ func (*LingerOption) isGettableSocketOption() {}
 
 func (*LingerOption) isSettableSocketOption() {}
 
+// ICMPv4FilterOption is used by SetSockOpt/GetSockOpt to specify the types of
+// the ICMPv4 packets raw ICMPv4 endpoints do not receive, as with
+// ICMP_FILTER.
+//
+// +stateify savable
+type ICMPv4FilterOption struct {
+	// DenyType has the bit of each ICMPv4 type to filter out set. Types
+	// above 31 are never filtered out.
+	DenyType uint32
+}
+
+func (*ICMPv4FilterOption) isGettableSocketOption() {}
+
+func (*ICMPv4FilterOption) isSettableSocketOption() {}
+
+// ICMPv6FilterOption is used by SetSockOpt/GetSockOpt to specify the types of
+// the ICMPv6 packets raw ICMPv6 endpoints do not receive, as with
+// ICMPV6_FILTER.
+//
+// +stateify savable
+type ICMPv6FilterOption struct {
+	// DenyType has the bit of each ICMPv6 type to filter out set, starting
+	// with the least significant bit of its first element.
+	DenyType [8]uint32
+}
+
+func (*ICMPv6FilterOption) isGettableSocketOption() {}
+
+func (*ICMPv6FilterOption) isSettableSocketOption() {}
+
 // IPPacketInfo is the message structure for IP_PKTINFO.
 //
 // +stateify savable
@@ -1162,6 +1505,17 @@ type IPPacketInfo struct {
 	DestinationAddr Address
 }
 
+// PathMTUInfo is the message structure for IPV6_PATHMTU.
+//
+// +stateify savable
+type PathMTUInfo struct {
+	// Addr is the destination the path MTU applies to. Its port is unset.
+	Addr FullAddress
+
+	// MTU is the path MTU, including the network header.
+	MTU uint32
+}
+
 // Route is a row in the routing table. It specifies through which NIC (and
 // gateway) sets of packets should be routed. A row is considered viable if the
 // masked target address matches the destination address in the row.
@@ -1174,12 +1528,24 @@ type Route struct {
 
 	// NIC is the id of the nic to be used if this row is viable.
 	NIC NICID
+
+	// Source, if set, must contain the source address of the packets for
+	// this row to be viable, making the row source-specific.
+	Source Subnet
+}
+
+// MatchesSource returns true if the route is viable for packets from addr.
+func (r Route) MatchesSource(addr Address) bool {
+	return r.Source == (Subnet{}) || r.Source.Contains(addr)
 }
 
 // String implements the fmt.Stringer interface.
 func (r Route) String() string {
 	var out strings.Builder
 	fmt.Fprintf(&out, "%s", r.Destination)
+	if r.Source != (Subnet{}) {
+		fmt.Fprintf(&out, " from %s", r.Source)
+	}
 	if len(r.Gateway) > 0 {
 		fmt.Fprintf(&out, " via %s", r.Gateway)
 	}
@@ -1203,8 +1569,55 @@ type TransportProtocolNumber uint32
 type NetworkProtocolNumber uint32
 
 // A StatCounter keeps track of a statistic.
+//
+// The counters of a stack's Stats (see Stats.FillIn) are sharded: increments
+// update one of several slots and Value sums all slots, so that hot
+// stack-wide counters do not bounce a single cache line between CPUs. The zero
+// value is an unsharded counter, which is cheaper in memory and suits
+// per-NIC and per-endpoint statistics as well as gauges.
 type StatCounter struct {
 	count uint64
+
+	// shards holds the partial counts of a sharded counter, or is nil
+	// if the counter is unsharded. It is a pointer so that StatCounter (and
+	// the stats structs embedding it) remain comparable. It is immutable
+	// after the counter is created.
+	shards *statCounterShards
+}
+
+// cacheLineSize is the assumed size of a CPU cache line.
+const cacheLineSize = 64
+
+// maxStatCounterShards bounds the number of shards of a sharded StatCounter,
+// limiting memory use on machines with many CPUs.
+const maxStatCounterShards = 32
+
+// numStatCounterShards is the number of shards allocated for each sharded
+// StatCounter. It is GOMAXPROCS rounded up to a power of two, capped at
+// maxStatCounterShards.
+var numStatCounterShards = func() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) && n < maxStatCounterShards {
+		n <<= 1
+	}
+	return n
+}()
+
+// statCounterShards is the set of slots of a sharded StatCounter. Its length
+// is a power of two.
+type statCounterShards []statCounterShard
+
+// statCounterShard is a single slot of a sharded StatCounter, padded to a
+// cache line so that updates from different CPUs do not contend.
+type statCounterShard struct {
+	count uint64
+	_     [cacheLineSize - 8]byte
+}
+
+// newShardedStatCounter returns a new sharded StatCounter.
+func newShardedStatCounter() *StatCounter {
+	shards := make(statCounterShards, numStatCounterShards)
+	return &StatCounter{shards: &shards}
 }
 
 // Increment adds one to the counter.
@@ -1213,18 +1626,39 @@ func (s *StatCounter) Increment() {
 }
 
 // Decrement minuses one to the counter.
+//
+// Only unsharded counters may be used as gauges: the shards of a sharded
+// counter are summed without a snapshot, so a concurrent increment and
+// decrement may be observed out of order.
 func (s *StatCounter) Decrement() {
 	s.IncrementBy(^uint64(0))
 }
 
 // Value returns the current value of the counter.
+//
+// For a sharded counter, the shards are read one at a time, so the result
+// need not reflect a single point in time when there are concurrent updates.
 func (s *StatCounter) Value() uint64 {
-	return atomic.LoadUint64(&s.count)
+	v := atomic.LoadUint64(&s.count)
+	if s.shards != nil {
+		shards := *s.shards
+		for i := range shards {
+			v += atomic.LoadUint64(&shards[i].count)
+		}
+	}
+	return v
 }
 
 // IncrementBy increments the counter by v.
 func (s *StatCounter) IncrementBy(v uint64) {
-	atomic.AddUint64(&s.count, v)
+	if s.shards == nil {
+		atomic.AddUint64(&s.count, v)
+		return
+	}
+	// The shard must still be updated atomically: Value reads it
+	// concurrently, and goroutines on different CPUs may share a slot.
+	shards := *s.shards
+	atomic.AddUint64(&shards[statCounterShardIndex()&(len(shards)-1)].count, v)
 }
 
 func (s *StatCounter) String() string {
@@ -1272,6 +1706,14 @@ type ICMPv4PacketStats struct {
 	// InfoReply is the total number of ICMPv4 information reply packets
 	// counted.
 	InfoReply *StatCounter
+
+	// ExtendedEchoRequest is the total number of ICMPv4 extended echo
+	// request packets counted.
+	ExtendedEchoRequest *StatCounter
+
+	// ExtendedEchoReply is the total number of ICMPv4 extended echo reply
+	// packets counted.
+	ExtendedEchoReply *StatCounter
 }
 
 // ICMPv6PacketStats enumerates counts for all ICMPv6 packet types.
@@ -1327,9 +1769,21 @@ type ICMPv6PacketStats struct {
 	// messages counted.
 	MulticastListenerReport *StatCounter
 
+	// MulticastListenerReportV2 is the total number of Version 2 Multicast
+	// Listener Report messages counted.
+	MulticastListenerReportV2 *StatCounter
+
 	// MulticastListenerDone is the total number of Multicast Listener Done
 	// messages counted.
 	MulticastListenerDone *StatCounter
+
+	// ExtendedEchoRequest is the total number of ICMPv6 extended echo
+	// request packets counted.
+	ExtendedEchoRequest *StatCounter
+
+	// ExtendedEchoReply is the total number of ICMPv6 extended echo reply
+	// packets counted.
+	ExtendedEchoReply *StatCounter
 }
 
 // ICMPv4SentPacketStats collects outbound ICMPv4-specific stats.
@@ -1430,6 +1884,10 @@ type IGMPPacketStats struct {
 	// messages counted.
 	V2MembershipReport *StatCounter
 
+	// V3MembershipReport is the total number of Version 3 Membership Report
+	// messages counted.
+	V3MembershipReport *StatCounter
+
 	// LeaveGroup is the total number of Leave Group messages counted.
 	LeaveGroup *StatCounter
 }
@@ -1485,10 +1943,53 @@ type IPStats struct {
 	// received with an unknown or invalid destination address.
 	InvalidDestinationAddressesReceived *StatCounter
 
+	// PacketsForwarded is the total number of IP packets forwarded to their
+	// next hop.
+	PacketsForwarded *StatCounter
+
+	// HopLimitExceeded is the total number of IP packets not forwarded
+	// because their TTL or hop limit expired.
+	HopLimitExceeded *StatCounter
+
+	// ForwardingFlowCacheHits is the total number of IP packets forwarded
+	// through a route found in the forwarding flow cache.
+	ForwardingFlowCacheHits *StatCounter
+
+	// ForwardingFlowCacheMisses is the total number of IP packets to forward
+	// whose flow wasn't found in the forwarding flow cache.
+	ForwardingFlowCacheMisses *StatCounter
+
+	// MulticastScopeBoundaryDropped is the total number of multicast IP
+	// packets not forwarded because they would have left their scope.
+	MulticastScopeBoundaryDropped *StatCounter
+
+	// MulticastNoRoute is the total number of multicast IP packets not
+	// forwarded because no multicast route matches them, while multicast
+	// routing is enabled.
+	MulticastNoRoute *StatCounter
+
+	// MulticastWrongInterface is the total number of multicast IP packets
+	// not forwarded because they were received on another NIC than the
+	// input NIC of their multicast route.
+	MulticastWrongInterface *StatCounter
+
+	// SocketMembershipLimitExceeded is the total number of multicast group
+	// joins refused because the socket reached its membership limit.
+	SocketMembershipLimitExceeded *StatCounter
+
+	// NICMembershipLimitExceeded is the total number of multicast group joins
+	// refused because the NIC reached its membership limit.
+	NICMembershipLimitExceeded *StatCounter
+
 	// InvalidSourceAddressesReceived is the total number of IP packets received
 	// with a source address that should never have been received on the wire.
 	InvalidSourceAddressesReceived *StatCounter
 
+	// ReversePathFilterDropped is the total number of IP packets dropped
+	// because their source address failed the reverse path filter of the
+	// NIC they were received on.
+	ReversePathFilterDropped *StatCounter
+
 	// PacketsDelivered is the total number of incoming IP packets that
 	// are successfully delivered to the transport layer via HandlePacket.
 	PacketsDelivered *StatCounter
@@ -1508,6 +2009,19 @@ type IPStats struct {
 	// dropped due to the fragment failing validation checks.
 	MalformedFragmentsReceived *StatCounter
 
+	// AtomicFragmentsDropped is the total number of atomic fragments, which
+	// carry a Fragment header but hold a whole packet, dropped by policy.
+	AtomicFragmentsDropped *StatCounter
+
+	// OverlappingFragmentsReceived is the total number of IP fragments which
+	// overlapped with fragments previously received for the same packet,
+	// causing its reassembly to be abandoned.
+	OverlappingFragmentsReceived *StatCounter
+
+	// TinyFragmentsDropped is the total number of non-final IP fragments
+	// dropped by policy because their payload was too small.
+	TinyFragmentsDropped *StatCounter
+
 	// IPTablesPreroutingDropped is the total number of IP packets dropped
 	// in the Prerouting chain.
 	IPTablesPreroutingDropped *StatCounter
@@ -1526,6 +2040,9 @@ type IPStats struct {
 	// OptionRRReceived is the number of Record Route options seen.
 	OptionRRReceived *StatCounter
 
+	// OptionRAReceived is the number of Router Alert options seen.
+	OptionRAReceived *StatCounter
+
 	// OptionUnknownReceived is the number of unknown IP options seen.
 	OptionUnknownReceived *StatCounter
 }
@@ -1542,11 +2059,11 @@ type TCPStats struct {
 
 	// CurrentEstablished is the number of TCP connections for which the
 	// current state is ESTABLISHED.
-	CurrentEstablished *StatCounter
+	CurrentEstablished *StatCounter `stat:"gauge"`
 
 	// CurrentConnected is the number of TCP connections that
 	// are in connected state.
-	CurrentConnected *StatCounter
+	CurrentConnected *StatCounter `stat:"gauge"`
 
 	// EstablishedResets is the number of times TCP connections have made
 	// a direct transition to the CLOSED state from either the
@@ -1580,6 +2097,14 @@ type TCPStats struct {
 	// was received.
 	ListenOverflowInvalidSynCookieRcvd *StatCounter
 
+	// ListenOverflows is the number of times a listening endpoint dropped or
+	// reset a connection request because its accept queue was full.
+	ListenOverflows *StatCounter
+
+	// ListenDrops is the number of connection requests dropped or reset by
+	// listening endpoints for any reason, including ListenOverflows.
+	ListenDrops *StatCounter
+
 	// FailedConnectionAttempts is the number of calls to Connect or Listen
 	// (active and passive openings, respectively) that end in an error.
 	FailedConnectionAttempts *StatCounter
@@ -1628,6 +2153,149 @@ type TCPStats struct {
 
 	// ChecksumErrors is the number of segments dropped due to bad checksums.
 	ChecksumErrors *StatCounter
+
+	// MinTTLDrops is the number of segments dropped because their TTL or
+	// hop limit was lower than the IP_MINTTL or IPV6_MINHOPCOUNT option of
+	// their endpoint.
+	MinTTLDrops *StatCounter
+
+	// AutoCorking is the number of times a partial segment was held back to
+	// coalesce subsequent small writes into it.
+	AutoCorking *StatCounter
+
+	// MTUProbeSuccesses is the number of path MTU probes that were
+	// acknowledged, raising the MSS.
+	MTUProbeSuccesses *StatCounter
+
+	// MTUProbeFailures is the number of path MTU probes that were lost.
+	MTUProbeFailures *StatCounter
+
+	// MTUBlackHoles is the number of times the MSS was lowered because
+	// full-sized segments were repeatedly lost, suggesting that the path
+	// drops large packets without sending Packet Too Big messages.
+	MTUBlackHoles *StatCounter
+
+	// OutOfOrderQueued is the number of segments queued in the out-of-order
+	// queue.
+	OutOfOrderQueued *StatCounter
+
+	// OutOfOrderDropped is the number of segments dropped because the
+	// out-of-order queue was full.
+	OutOfOrderDropped *StatCounter
+
+	// OutOfOrderPruned is the number of segments dropped from the
+	// out-of-order queue to make room for earlier segments.
+	OutOfOrderPruned *StatCounter
+
+	// OutOfOrderMerged is the number of segments of the out-of-order queue
+	// merged into other segments when the queue was full.
+	OutOfOrderMerged *StatCounter
+
+	// HandshakeLatency is a histogram of the time taken by active
+	// connection attempts to reach the ESTABLISHED state, measured from the
+	// first SYN.
+	HandshakeLatency TCPHandshakeLatencyStats
+
+	// HandshakeSYNRetransmits is a histogram of the number of SYN
+	// retransmissions made by active connection attempts, whether they
+	// succeeded or failed.
+	HandshakeSYNRetransmits TCPHandshakeRetransmitStats
+
+	// HandshakeFailures counts failed active connection attempts by reason.
+	HandshakeFailures TCPHandshakeFailureStats
+}
+
+// TCPHandshakeLatencyStats is a histogram of TCP handshake latencies. Each
+// bucket counts the handshakes which completed in less than its bound and no
+// less than the bound of the previous bucket.
+type TCPHandshakeLatencyStats struct {
+	LessThan1ms   *StatCounter
+	LessThan10ms  *StatCounter
+	LessThan100ms *StatCounter
+	LessThan1s    *StatCounter
+	LessThan3s    *StatCounter
+	LessThan10s   *StatCounter
+	AtLeast10s    *StatCounter
+}
+
+// Record adds a handshake which completed in d to the histogram.
+func (s *TCPHandshakeLatencyStats) Record(d time.Duration) {
+	switch {
+	case d < time.Millisecond:
+		s.LessThan1ms.Increment()
+	case d < 10*time.Millisecond:
+		s.LessThan10ms.Increment()
+	case d < 100*time.Millisecond:
+		s.LessThan100ms.Increment()
+	case d < time.Second:
+		s.LessThan1s.Increment()
+	case d < 3*time.Second:
+		s.LessThan3s.Increment()
+	case d < 10*time.Second:
+		s.LessThan10s.Increment()
+	default:
+		s.AtLeast10s.Increment()
+	}
+}
+
+// TCPHandshakeRetransmitStats is a histogram of the number of SYN
+// retransmissions made during TCP handshakes.
+type TCPHandshakeRetransmitStats struct {
+	None        *StatCounter
+	One         *StatCounter
+	Two         *StatCounter
+	ThreeOrMore *StatCounter
+}
+
+// Record adds a handshake which retransmitted its SYN n times to the
+// histogram.
+func (s *TCPHandshakeRetransmitStats) Record(n int) {
+	switch {
+	case n <= 0:
+		s.None.Increment()
+	case n == 1:
+		s.One.Increment()
+	case n == 2:
+		s.Two.Increment()
+	default:
+		s.ThreeOrMore.Increment()
+	}
+}
+
+// TCPHandshakeFailureStats counts failed TCP handshakes by reason.
+type TCPHandshakeFailureStats struct {
+	// Timeout is the number of handshakes abandoned because the peer did
+	// not answer.
+	Timeout *StatCounter
+
+	// Refused is the number of handshakes reset by the peer.
+	Refused *StatCounter
+
+	// Unreachable is the number of handshakes which failed because the
+	// peer could not be reached.
+	Unreachable *StatCounter
+
+	// Aborted is the number of handshakes aborted locally.
+	Aborted *StatCounter
+
+	// Other is the number of handshakes which failed for any other reason.
+	Other *StatCounter
+}
+
+// Record counts a handshake which failed with err.
+func (s *TCPHandshakeFailureStats) Record(err *Error) {
+	switch err {
+	case ErrTimeout:
+		s.Timeout.Increment()
+	case ErrConnectionRefused:
+		s.Refused.Increment()
+	case ErrNoRoute, ErrNetworkUnreachable:
+		s.Unreachable.Increment()
+	case ErrAborted, ErrConnectionAborted:
+		s.Aborted.Increment()
+	default:
+		s.Other.Increment()
+	}
 }
 
 // UDPStats collects UDP-specific stats.
@@ -1644,6 +2312,16 @@ type UDPStats struct {
 	// due to the receiving buffer being in an invalid state.
 	ReceiveBufferErrors *StatCounter
 
+	// ReceiveBufferOverflows is the number of incoming UDP datagrams
+	// dropped because the receive buffer of their endpoint was full. They
+	// are also counted in ReceiveBufferErrors.
+	ReceiveBufferOverflows *StatCounter
+
+	// ReceiveMemoryErrors is the number of incoming UDP datagrams dropped
+	// because the memory limit of the protocol was reached. They are also
+	// counted in ReceiveBufferErrors.
+	ReceiveMemoryErrors *StatCounter
+
 	// MalformedPacketsReceived is the number of incoming UDP datagrams
 	// dropped due to the UDP header being in a malformed state.
 	MalformedPacketsReceived *StatCounter
@@ -1779,21 +2457,35 @@ func (*TransportEndpointStats) IsEndpointStats() {}
 // InitStatCounters initializes v's fields with nil StatCounter fields to new
 // StatCounters.
 func InitStatCounters(v reflect.Value) {
+	initStatCounters(v, false /* sharded */)
+}
+
+// initStatCounters is like InitStatCounters, but creates sharded StatCounters
+// if sharded is true. Fields tagged `stat:"gauge"` are always unsharded, as
+// gauges go up and down and must be read consistently.
+func initStatCounters(v reflect.Value, sharded bool) {
+	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
-		v := v.Field(i)
-		if s, ok := v.Addr().Interface().(**StatCounter); ok {
+		f := v.Field(i)
+		if s, ok := f.Addr().Interface().(**StatCounter); ok {
 			if *s == nil {
-				*s = new(StatCounter)
+				if sharded && t.Field(i).Tag.Get("stat") != "gauge" {
+					*s = newShardedStatCounter()
+				} else {
+					*s = new(StatCounter)
+				}
 			}
 		} else {
-			InitStatCounters(v)
+			initStatCounters(f, sharded)
 		}
 	}
 }
 
 // FillIn returns a copy of s with nil fields initialized to new StatCounters.
+// Counters other than gauges are sharded, since they are shared by the whole
+// stack.
 func (s Stats) FillIn() Stats {
-	InitStatCounters(reflect.ValueOf(&s).Elem())
+	initStatCounters(reflect.ValueOf(&s).Elem(), true /* sharded */)
 	return s
 }
 
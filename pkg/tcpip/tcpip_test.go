@@ -17,8 +17,11 @@ package tcpip
 import (
 	"fmt"
 	"net"
+	"reflect"
 	"strings"
 	"testing"
+
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 func TestSubnetContains(t *testing.T) {
@@ -196,6 +199,80 @@ func TestStatsString(t *testing.T) {
 	}
 }
 
+func TestStatCounter(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		counter *StatCounter
+	}{
+		{"unsharded", new(StatCounter)},
+		{"sharded", newShardedStatCounter()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			const goroutines = 8
+			const increments = 1000
+
+			s := test.counter
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < increments; j++ {
+						s.Increment()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got, want := s.Value(), uint64(goroutines*increments); got != want {
+				t.Fatalf("got s.Value() = %d, want = %d", got, want)
+			}
+
+			s.IncrementBy(10)
+			s.Decrement()
+			if got, want := s.Value(), uint64(goroutines*increments+9); got != want {
+				t.Errorf("got s.Value() = %d, want = %d", got, want)
+			}
+			if got, want := s.String(), fmt.Sprint(goroutines*increments+9); got != want {
+				t.Errorf("got s.String() = %q, want = %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFillInShardsStatCounters(t *testing.T) {
+	s := Stats{}.FillIn()
+	if s.TCP.SegmentsSent.shards == nil {
+		t.Errorf("got Stats{}.FillIn().TCP.SegmentsSent.shards = nil, want sharded counter")
+	}
+
+	// Gauges are never sharded.
+	if s.TCP.CurrentEstablished.shards != nil {
+		t.Errorf("got Stats{}.FillIn().TCP.CurrentEstablished.shards = %p, want = nil", s.TCP.CurrentEstablished.shards)
+	}
+	if s.TCP.CurrentConnected.shards != nil {
+		t.Errorf("got Stats{}.FillIn().TCP.CurrentConnected.shards = %p, want = nil", s.TCP.CurrentConnected.shards)
+	}
+
+	// Counters supplied by the caller are left alone.
+	c := new(StatCounter)
+	s = Stats{UnknownProtocolRcvdPackets: c}.FillIn()
+	if s.UnknownProtocolRcvdPackets != c {
+		t.Errorf("got Stats.FillIn().UnknownProtocolRcvdPackets = %p, want = %p", s.UnknownProtocolRcvdPackets, c)
+	}
+}
+
+func TestInitStatCountersUnsharded(t *testing.T) {
+	var s IPStats
+	InitStatCounters(reflect.ValueOf(&s).Elem())
+	if s.PacketsReceived == nil {
+		t.Fatal("got s.PacketsReceived = nil after InitStatCounters")
+	}
+	if s.PacketsReceived.shards != nil {
+		t.Errorf("got s.PacketsReceived.shards = %p, want = nil", s.PacketsReceived.shards)
+	}
+}
+
 func TestAddressWithPrefixSubnet(t *testing.T) {
 	tests := []struct {
 		addr       Address
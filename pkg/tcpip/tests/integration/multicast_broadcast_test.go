@@ -557,3 +557,208 @@ func TestReuseAddrAndBroadcast(t *testing.T) {
 		})
 	}
 }
+
+// TestUDPMulticastAll tests that multicast datagrams are only delivered to
+// endpoints that have joined the group when IP_MULTICAST_ALL is disabled, and
+// that endpoints bound to the receiving device do not shadow unbound
+// endpoints.
+func TestUDPMulticastAll(t *testing.T) {
+	const (
+		nicID      = 1
+		remotePort = 5555
+		localPort  = 80
+	)
+
+	multicastAddr := tcpip.Address("\xe0\x00\x01\x02")
+	data := []byte{1, 2, 3, 4}
+
+	endpoints := []struct {
+		name         string
+		multicastAll bool
+		join         bool
+		bindToDevice tcpip.NICID
+		expectRx     bool
+	}{
+		{
+			name:         "multicast all without membership",
+			multicastAll: true,
+			expectRx:     true,
+		},
+		{
+			name:         "multicast all with membership",
+			multicastAll: true,
+			join:         true,
+			expectRx:     true,
+		},
+		{
+			name:     "no multicast all without membership",
+			expectRx: false,
+		},
+		{
+			name:     "no multicast all with membership",
+			join:     true,
+			expectRx: true,
+		},
+		{
+			name:         "bound to receiving device",
+			multicastAll: true,
+			bindToDevice: nicID,
+			expectRx:     true,
+		},
+	}
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	e := channel.New(0, defaultMTU, "")
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	ipv4ProtoAddr := tcpip.ProtocolAddress{Protocol: header.IPv4ProtocolNumber, AddressWithPrefix: ipv4Addr}
+	if err := s.AddProtocolAddress(nicID, ipv4ProtoAddr); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v): %s", nicID, ipv4ProtoAddr, err)
+	}
+
+	var eps []tcpip.Endpoint
+	for _, test := range endpoints {
+		var wq waiter.Queue
+		ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+		if err != nil {
+			t.Fatalf("%s: NewEndpoint(%d, %d, _): %s", test.name, udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+		}
+		defer ep.Close()
+
+		ep.SocketOptions().SetReuseAddress(true)
+		ep.SocketOptions().SetMulticastAll(test.multicastAll)
+		if test.bindToDevice != 0 {
+			opt := tcpip.BindToDeviceOption(test.bindToDevice)
+			if err := ep.SetSockOpt(&opt); err != nil {
+				t.Fatalf("%s: SetSockOpt(&%T(%d)): %s", test.name, opt, opt, err)
+			}
+		}
+		if test.join {
+			opt := tcpip.AddMembershipOption{NIC: nicID, MulticastAddr: multicastAddr}
+			if err := ep.SetSockOpt(&opt); err != nil {
+				t.Fatalf("%s: SetSockOpt(&%#v): %s", test.name, opt, err)
+			}
+		}
+
+		bindAddr := tcpip.FullAddress{Port: localPort}
+		if err := ep.Bind(bindAddr); err != nil {
+			t.Fatalf("%s: ep.Bind(%+v): %s", test.name, bindAddr, err)
+		}
+		eps = append(eps, ep)
+	}
+
+	payloadLen := header.UDPMinimumSize + len(data)
+	totalLen := header.IPv4MinimumSize + payloadLen
+	hdr := buffer.NewPrependable(totalLen)
+	u := header.UDP(hdr.Prepend(payloadLen))
+	u.Encode(&header.UDPFields{
+		SrcPort: remotePort,
+		DstPort: localPort,
+		Length:  uint16(payloadLen),
+	})
+	copy(u.Payload(), data)
+	sum := header.PseudoHeaderChecksum(udp.ProtocolNumber, remoteIPv4Addr, multicastAddr, uint16(payloadLen))
+	sum = header.Checksum(data, sum)
+	u.SetChecksum(^u.CalculateChecksum(sum))
+
+	ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		TotalLength: uint16(totalLen),
+		Protocol:    uint8(udp.ProtocolNumber),
+		TTL:         ttl,
+		SrcAddr:     remoteIPv4Addr,
+		DstAddr:     multicastAddr,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+
+	e.InjectInbound(header.IPv4ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: hdr.View().ToVectorisedView(),
+	}))
+
+	for i, test := range endpoints {
+		if gotPayload, _, err := eps[i].Read(nil); test.expectRx {
+			if err != nil {
+				t.Errorf("%s: Read(nil): %s", test.name, err)
+			} else if diff := cmp.Diff(buffer.View(data), gotPayload); diff != "" {
+				t.Errorf("%s: got UDP payload mismatch (-want +got):\n%s", test.name, diff)
+			}
+		} else if err != tcpip.ErrWouldBlock {
+			t.Errorf("%s: got Read(nil) = (%x, _, %s), want = (_, _, %s)", test.name, gotPayload, err, tcpip.ErrWouldBlock)
+		}
+	}
+}
+
+// TestMulticastMembershipLimits tests that joining multicast groups through
+// sockets is bounded per socket and per NIC.
+func TestMulticastMembershipLimits(t *testing.T) {
+	const nicID = 1
+
+	groups := []tcpip.Address{
+		"\xe0\x00\x01\x01",
+		"\xe0\x00\x01\x02",
+		"\xe0\x00\x01\x03",
+	}
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	if err := s.CreateNIC(nicID, channel.New(0, defaultMTU, "")); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+
+	// The all-systems group joined by the stack counts towards the NIC limit.
+	limits := tcpip.MulticastMembershipLimitsOption{
+		MaxSocketMemberships: 2,
+		MaxNICMemberships:    3,
+	}
+	if err := s.SetNetworkProtocolOption(ipv4.ProtocolNumber, &limits); err != nil {
+		t.Fatalf("SetNetworkProtocolOption(%d, &%#v): %s", ipv4.ProtocolNumber, limits, err)
+	}
+
+	newEndpoint := func() tcpip.Endpoint {
+		t.Helper()
+		var wq waiter.Queue
+		ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+		}
+		return ep
+	}
+	join := func(ep tcpip.Endpoint, group tcpip.Address, want *tcpip.Error) {
+		t.Helper()
+		opt := tcpip.AddMembershipOption{NIC: nicID, MulticastAddr: group}
+		if got := ep.SetSockOpt(&opt); got != want {
+			t.Errorf("SetSockOpt(&%#v) = %s, want = %s", opt, got, want)
+		}
+	}
+
+	ep1 := newEndpoint()
+	defer ep1.Close()
+	join(ep1, groups[0], nil)
+	join(ep1, groups[1], nil)
+	join(ep1, groups[2], tcpip.ErrNoBufferSpace)
+	if got := s.Stats().IP.SocketMembershipLimitExceeded.Value(); got != 1 {
+		t.Errorf("got s.Stats().IP.SocketMembershipLimitExceeded.Value() = %d, want = 1", got)
+	}
+
+	ep2 := newEndpoint()
+	defer ep2.Close()
+	// Groups already joined on the NIC don't count towards its limit again.
+	join(ep2, groups[0], nil)
+	join(ep2, groups[2], tcpip.ErrNoBufferSpace)
+	if got := s.Stats().IP.NICMembershipLimitExceeded.Value(); got != 1 {
+		t.Errorf("got s.Stats().IP.NICMembershipLimitExceeded.Value() = %d, want = 1", got)
+	}
+
+	// Leaving a group makes room on the NIC.
+	leave := tcpip.RemoveMembershipOption{NIC: nicID, InterfaceAddr: header.IPv4Any, MulticastAddr: groups[1]}
+	if err := ep1.SetSockOpt(&leave); err != nil {
+		t.Fatalf("SetSockOpt(&%#v): %s", leave, err)
+	}
+	join(ep2, groups[2], nil)
+}
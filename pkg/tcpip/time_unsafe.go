@@ -40,6 +40,11 @@ func (*StdClock) NowNanoseconds() int64 {
 	return sec*1e9 + int64(nsec)
 }
 
+// Now implements Clock.Now.
+func (*StdClock) Now() time.Time {
+	return time.Now()
+}
+
 // NowMonotonic implements Clock.NowMonotonic.
 func (*StdClock) NowMonotonic() int64 {
 	_, _, mono := now()
@@ -336,10 +336,10 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 
 	switch e.NetProto {
 	case header.IPv4ProtocolNumber:
-		err = send4(route, e.ID.LocalPort, v, e.ttl, e.owner)
+		err = send4(route, e.ID.LocalPort, v, e.ttl, e.owner, e.ops.GetPriority())
 
 	case header.IPv6ProtocolNumber:
-		err = send6(route, e.ID.LocalPort, v, e.ttl)
+		err = send6(route, e.ID.LocalPort, v, e.ttl, e.owner, e.ops.GetPriority())
 	}
 
 	if err != nil {
@@ -350,7 +350,7 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 }
 
 // Peek only returns data from a single datagram, so do nothing here.
-func (e *endpoint) Peek([][]byte) (int64, tcpip.ControlMessages, *tcpip.Error) {
+func (e *endpoint) Peek([][]byte, int64, *tcpip.FullAddress) (int64, tcpip.ControlMessages, *tcpip.Error) {
 	return 0, tcpip.ControlMessages{}, nil
 }
 
@@ -392,6 +392,9 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, *tcpip.Error) {
 		}
 		e.rcvMu.Unlock()
 		return v, nil
+	case tcpip.SendQueueSizeOption:
+		// Datagrams are sent synchronously, so they are never queued.
+		return 0, nil
 	case tcpip.SendBufferSizeOption:
 		e.mu.Lock()
 		v := e.sndBufSize
@@ -429,7 +432,7 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) *tcpip.Error {
 	}
 }
 
-func send4(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpip.PacketOwner) *tcpip.Error {
+func send4(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpip.PacketOwner, priority uint32) *tcpip.Error {
 	if len(data) < header.ICMPv4MinimumSize {
 		return tcpip.ErrInvalidEndpointState
 	}
@@ -438,6 +441,7 @@ func send4(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpi
 		ReserveHeaderBytes: header.ICMPv4MinimumSize + int(r.MaxHeaderLength()),
 	})
 	pkt.Owner = owner
+	pkt.Priority = priority
 
 	icmpv4 := header.ICMPv4(pkt.TransportHeader().Push(header.ICMPv4MinimumSize))
 	pkt.TransportProtocolNumber = header.ICMPv4ProtocolNumber
@@ -448,7 +452,7 @@ func send4(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpi
 	data = data[header.ICMPv4MinimumSize:]
 
 	// Linux performs these basic checks.
-	if icmpv4.Type() != header.ICMPv4Echo || icmpv4.Code() != 0 {
+	if t := icmpv4.Type(); (t != header.ICMPv4Echo && t != header.ICMPv4ExtendedEchoRequest) || icmpv4.Code() != 0 {
 		return tcpip.ErrInvalidEndpointState
 	}
 
@@ -463,7 +467,7 @@ func send4(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpi
 	return r.WritePacket(nil /* gso */, stack.NetworkHeaderParams{Protocol: header.ICMPv4ProtocolNumber, TTL: ttl, TOS: stack.DefaultTOS}, pkt)
 }
 
-func send6(r *stack.Route, ident uint16, data buffer.View, ttl uint8) *tcpip.Error {
+func send6(r *stack.Route, ident uint16, data buffer.View, ttl uint8, owner tcpip.PacketOwner, priority uint32) *tcpip.Error {
 	if len(data) < header.ICMPv6EchoMinimumSize {
 		return tcpip.ErrInvalidEndpointState
 	}
@@ -471,6 +475,8 @@ func send6(r *stack.Route, ident uint16, data buffer.View, ttl uint8) *tcpip.Err
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: header.ICMPv6MinimumSize + int(r.MaxHeaderLength()),
 	})
+	pkt.Owner = owner
+	pkt.Priority = priority
 
 	icmpv6 := header.ICMPv6(pkt.TransportHeader().Push(header.ICMPv6MinimumSize))
 	pkt.TransportProtocolNumber = header.ICMPv6ProtocolNumber
@@ -479,7 +485,7 @@ func send6(r *stack.Route, ident uint16, data buffer.View, ttl uint8) *tcpip.Err
 	icmpv6.SetIdent(ident)
 	data = data[header.ICMPv6MinimumSize:]
 
-	if icmpv6.Type() != header.ICMPv6EchoRequest || icmpv6.Code() != 0 {
+	if t := icmpv6.Type(); (t != header.ICMPv6EchoRequest && t != header.ICMPv6ExtendedEchoRequest) || icmpv6.Code() != 0 {
 		return tcpip.ErrInvalidEndpointState
 	}
 
@@ -750,13 +756,13 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 // HandlePacket is called by the stack when new packets arrive to this transport
 // endpoint.
 func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketBuffer) {
-	// Only accept echo replies.
+	// Only accept echo and extended echo replies.
 	switch e.NetProto {
 	case header.IPv4ProtocolNumber:
 		h := header.ICMPv4(pkt.TransportHeader().View())
 		// TODO(b/129292233): Determine if len(h) check is still needed after early
 		// parsing.
-		if len(h) < header.ICMPv4MinimumSize || h.Type() != header.ICMPv4EchoReply {
+		if len(h) < header.ICMPv4MinimumSize || (h.Type() != header.ICMPv4EchoReply && h.Type() != header.ICMPv4ExtendedEchoReply) {
 			e.stack.Stats().DroppedPackets.Increment()
 			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
 			return
@@ -765,7 +771,7 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		h := header.ICMPv6(pkt.TransportHeader().View())
 		// TODO(b/129292233): Determine if len(h) check is still needed after early
 		// parsing.
-		if len(h) < header.ICMPv6MinimumSize || h.Type() != header.ICMPv6EchoReply {
+		if len(h) < header.ICMPv6MinimumSize || (h.Type() != header.ICMPv6EchoReply && h.Type() != header.ICMPv6ExtendedEchoReply) {
 			e.stack.Stats().DroppedPackets.Increment()
 			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
 			return
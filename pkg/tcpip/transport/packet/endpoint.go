@@ -206,7 +206,7 @@ func (*endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-cha
 }
 
 // Peek implements tcpip.Endpoint.Peek.
-func (*endpoint) Peek([][]byte) (int64, tcpip.ControlMessages, *tcpip.Error) {
+func (*endpoint) Peek([][]byte, int64, *tcpip.FullAddress) (int64, tcpip.ControlMessages, *tcpip.Error) {
 	return 0, tcpip.ControlMessages{}, nil
 }
 
@@ -342,14 +342,14 @@ func (ep *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		ep.mu.Unlock()
 		return nil
 
-	case tcpip.ReceiveBufferSizeOption:
+	case tcpip.ReceiveBufferSizeOption, tcpip.ReceiveBufferSizeForceOption:
 		// Make sure the receive buffer size is within the min and max
-		// allowed.
+		// allowed. ReceiveBufferSizeForceOption skips the rs.Max clamp.
 		var rs stack.ReceiveBufferSizeOption
 		if err := ep.stack.Option(&rs); err != nil {
 			panic(fmt.Sprintf("s.Option(%#v) = %s", rs, err))
 		}
-		if v > rs.Max {
+		if opt == tcpip.ReceiveBufferSizeOption && v > rs.Max {
 			v = rs.Max
 		}
 		if v < rs.Min {
@@ -46,6 +46,13 @@ type rawPacket struct {
 	timestampNS int64
 	// senderAddr is the network address of the sender.
 	senderAddr tcpip.FullAddress
+	// tos stores either the TOS or the traffic class of the packet.
+	tos uint8
+	// ttl stores either the TTL or the hop limit of the packet.
+	ttl uint8
+	// ipOptions stores the IPv4 options of the packet if IP_RECVOPTS was
+	// set when it was received.
+	ipOptions []byte
 }
 
 // endpoint is the raw socket implementation of tcpip.Endpoint. It is legal to
@@ -73,6 +80,10 @@ type endpoint struct {
 	rcvBufSize    int
 	rcvBufSizeMax int `state:".(int)"`
 	rcvClosed     bool
+	// icmpv4Filter and icmpv6Filter are the ICMP types filtered out by
+	// raw ICMP endpoints.
+	icmpv4Filter tcpip.ICMPv4FilterOption
+	icmpv6Filter tcpip.ICMPv6FilterOption
 
 	// The following fields are protected by mu.
 	mu            sync.RWMutex `state:"nosave"`
@@ -217,7 +228,31 @@ func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMess
 		*addr = pkt.senderAddr
 	}
 
-	return pkt.data.ToView(), tcpip.ControlMessages{HasTimestamp: true, Timestamp: pkt.timestampNS}, nil
+	cm := tcpip.ControlMessages{
+		HasTimestamp: true,
+		Timestamp:    pkt.timestampNS,
+	}
+	if e.ops.GetReceiveTOS() {
+		cm.HasTOS = true
+		cm.TOS = pkt.tos
+	}
+	if e.ops.GetReceiveTClass() {
+		cm.HasTClass = true
+		cm.TClass = uint32(pkt.tos)
+	}
+	if e.ops.GetReceiveTTL() {
+		cm.HasTTL = true
+		cm.TTL = pkt.ttl
+	}
+	if e.ops.GetReceiveHopLimit() {
+		cm.HasHopLimit = true
+		cm.HopLimit = pkt.ttl
+	}
+	if e.ops.GetReceiveIPOptions() && len(pkt.ipOptions) != 0 {
+		cm.HasIPOptions = true
+		cm.IPOptions = pkt.ipOptions
+	}
+	return pkt.data.ToView(), cm, nil
 }
 
 // Write implements tcpip.Endpoint.Write.
@@ -313,12 +348,12 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 				return 0, nil, tcpip.ErrInvalidEndpointState
 			}
 
-			n, ch, err := e.finishWrite(payloadBytes, savedRoute)
+			n, ch, err := e.finishWrite(payloadBytes, savedRoute, &opts.ControlMessages)
 			e.mu.Unlock()
 			return n, ch, err
 		}
 
-		n, ch, err := e.finishWrite(payloadBytes, e.route)
+		n, ch, err := e.finishWrite(payloadBytes, e.route, &opts.ControlMessages)
 		e.mu.RUnlock()
 		return n, ch, err
 	}
@@ -339,15 +374,16 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 		return 0, nil, err
 	}
 
-	n, ch, err := e.finishWrite(payloadBytes, route)
+	n, ch, err := e.finishWrite(payloadBytes, route, &opts.ControlMessages)
 	route.Release()
 	e.mu.RUnlock()
 	return n, ch, err
 }
 
-// finishWrite writes the payload to a route. It resolves the route if
-// necessary. It's really just a helper to make defer unnecessary in Write.
-func (e *endpoint) finishWrite(payloadBytes []byte, route *stack.Route) (int64, <-chan struct{}, *tcpip.Error) {
+// finishWrite writes the payload to a route, with the TOS and TTL set by the
+// control messages cm if any. It resolves the route if necessary. It's really
+// just a helper to make defer unnecessary in Write.
+func (e *endpoint) finishWrite(payloadBytes []byte, route *stack.Route, cm *tcpip.ControlMessages) (int64, <-chan struct{}, *tcpip.Error) {
 	// We may need to resolve the route (match a link layer address to the
 	// network address). If that requires blocking (e.g. to use ARP),
 	// return a channel on which the caller can wait.
@@ -364,6 +400,7 @@ func (e *endpoint) finishWrite(payloadBytes []byte, route *stack.Route) (int64,
 		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 			Data: buffer.View(payloadBytes).ToVectorisedView(),
 		})
+		pkt.Priority = e.ops.GetPriority()
 		if err := route.WriteHeaderIncludedPacket(pkt); err != nil {
 			return 0, nil, err
 		}
@@ -373,11 +410,32 @@ func (e *endpoint) finishWrite(payloadBytes []byte, route *stack.Route) (int64,
 			Data:               buffer.View(payloadBytes).ToVectorisedView(),
 		})
 		pkt.Owner = e.owner
-		if err := route.WritePacket(nil /* gso */, stack.NetworkHeaderParams{
+		pkt.Priority = e.ops.GetPriority()
+		params := stack.NetworkHeaderParams{
 			Protocol: e.TransProto,
 			TTL:      route.DefaultTTL(),
 			TOS:      stack.DefaultTOS,
-		}, pkt); err != nil {
+		}
+		switch route.NetProto {
+		case header.IPv4ProtocolNumber:
+			if cm.HasTOS {
+				params.TOS = cm.TOS
+			}
+			if cm.HasTTL {
+				params.TTL = cm.TTL
+			}
+			if opts := e.ops.GetIPv4Options(); len(opts) != 0 {
+				params.Options = header.IPv4Options(opts)
+			}
+		case header.IPv6ProtocolNumber:
+			if cm.HasTClass {
+				params.TOS = uint8(cm.TClass)
+			}
+			if cm.HasHopLimit {
+				params.TTL = cm.HopLimit
+			}
+		}
+		if err := route.WritePacket(nil /* gso */, params, pkt); err != nil {
 			return 0, nil, err
 		}
 	}
@@ -386,7 +444,7 @@ func (e *endpoint) finishWrite(payloadBytes []byte, route *stack.Route) (int64,
 }
 
 // Peek implements tcpip.Endpoint.Peek.
-func (e *endpoint) Peek([][]byte) (int64, tcpip.ControlMessages, *tcpip.Error) {
+func (e *endpoint) Peek([][]byte, int64, *tcpip.FullAddress) (int64, tcpip.ControlMessages, *tcpip.Error) {
 	return 0, tcpip.ControlMessages{}, nil
 }
 
@@ -530,6 +588,24 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) *tcpip.Error {
 		e.mu.Unlock()
 		return nil
 
+	case *tcpip.ICMPv4FilterOption:
+		if e.NetProto != header.IPv4ProtocolNumber || e.TransProto != header.ICMPv4ProtocolNumber {
+			return tcpip.ErrNotSupported
+		}
+		e.rcvMu.Lock()
+		e.icmpv4Filter = *v
+		e.rcvMu.Unlock()
+		return nil
+
+	case *tcpip.ICMPv6FilterOption:
+		if e.NetProto != header.IPv6ProtocolNumber || e.TransProto != header.ICMPv6ProtocolNumber {
+			return tcpip.ErrNotSupported
+		}
+		e.rcvMu.Lock()
+		e.icmpv6Filter = *v
+		e.rcvMu.Unlock()
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -556,14 +632,14 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		e.mu.Unlock()
 		return nil
 
-	case tcpip.ReceiveBufferSizeOption:
+	case tcpip.ReceiveBufferSizeOption, tcpip.ReceiveBufferSizeForceOption:
 		// Make sure the receive buffer size is within the min and max
-		// allowed.
+		// allowed. ReceiveBufferSizeForceOption skips the rs.Max clamp.
 		var rs stack.ReceiveBufferSizeOption
 		if err := e.stack.Option(&rs); err != nil {
 			panic(fmt.Sprintf("s.Option(%#v) = %s", rs, err))
 		}
-		if v > rs.Max {
+		if opt == tcpip.ReceiveBufferSizeOption && v > rs.Max {
 			v = rs.Max
 		}
 		if v < rs.Min {
@@ -588,6 +664,24 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) *tcpip.Error {
 		e.mu.Unlock()
 		return nil
 
+	case *tcpip.ICMPv4FilterOption:
+		if e.NetProto != header.IPv4ProtocolNumber || e.TransProto != header.ICMPv4ProtocolNumber {
+			return tcpip.ErrNotSupported
+		}
+		e.rcvMu.Lock()
+		*o = e.icmpv4Filter
+		e.rcvMu.Unlock()
+		return nil
+
+	case *tcpip.ICMPv6FilterOption:
+		if e.NetProto != header.IPv6ProtocolNumber || e.TransProto != header.ICMPv6ProtocolNumber {
+			return tcpip.ErrNotSupported
+		}
+		e.rcvMu.Lock()
+		*o = e.icmpv6Filter
+		e.rcvMu.Unlock()
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -606,6 +700,10 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, *tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.SendQueueSizeOption:
+		// Datagrams are sent synchronously, so they are never queued.
+		return 0, nil
+
 	case tcpip.SendBufferSizeOption:
 		e.mu.Lock()
 		v := e.sndBufSizeMax
@@ -671,6 +769,11 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 		return
 	}
 
+	if e.filteredLocked(pkt) {
+		e.rcvMu.Unlock()
+		return
+	}
+
 	wasEmpty := e.rcvBufSize == 0
 
 	// Push new packet into receive list and increment the buffer size.
@@ -698,6 +801,13 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 	combinedVV.Append(pkt.Data)
 	packet.data = combinedVV
 	packet.timestampNS = e.stack.Clock().NowNanoseconds()
+	packet.tos, _ = pkt.Network().TOS()
+	packet.ttl = pkt.TTL()
+	if pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber && e.ops.GetReceiveIPOptions() {
+		if opts := header.IPv4(pkt.NetworkHeader().View()).Options(); len(opts) != 0 {
+			packet.ipOptions = append([]byte(nil), opts...)
+		}
+	}
 
 	e.rcvList.PushBack(packet)
 	e.rcvBufSize += packet.data.Size()
@@ -709,6 +819,36 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 	}
 }
 
+// filteredLocked returns true if pkt is an ICMP packet filtered out with
+// ICMP_FILTER or ICMPV6_FILTER.
+//
+// Precondition: e.rcvMu must be held.
+func (e *endpoint) filteredLocked(pkt *stack.PacketBuffer) bool {
+	if e.TransProto != header.ICMPv4ProtocolNumber && e.TransProto != header.ICMPv6ProtocolNumber {
+		return false
+	}
+
+	// The ICMP header may not have been parsed yet.
+	h := pkt.TransportHeader().View()
+	if len(h) == 0 {
+		h = pkt.Data.First()
+	}
+	if len(h) == 0 {
+		// As in Linux, packets too short to have a type are filtered out.
+		return true
+	}
+	typ := h[0]
+
+	switch e.NetProto {
+	case header.IPv4ProtocolNumber:
+		return typ < 32 && e.icmpv4Filter.DenyType&(1<<typ) != 0
+	case header.IPv6ProtocolNumber:
+		return e.icmpv6Filter.DenyType[typ>>5]&(1<<(typ&31)) != 0
+	default:
+		return false
+	}
+}
+
 // State implements socket.Socket.State.
 func (e *endpoint) State() uint32 {
 	return 0
@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
 	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -72,15 +73,19 @@ func encodeMSS(mss uint16) uint32 {
 }
 
 // listenContext is used by a listening endpoint to store state used while
-// listening for connections. This struct is allocated by the listen goroutine
-// and must not be accessed or have its methods called concurrently as they
-// may mutate the stored objects.
+// listening for connections. Each listener shard allocates its own and it must
+// not be accessed or have its methods called concurrently as they may mutate
+// the stored objects.
 type listenContext struct {
 	stack *stack.Stack
 
 	// synRcvdCount is a reference to the stack level synRcvdCount.
 	synRcvdCount *synRcvdCounter
 
+	// timerWheel is a reference to the stack level timer wheel, which
+	// drives the timers of accepted endpoints.
+	timerWheel *timerWheel
+
 	// rcvWnd is the receive window that is sent by this listening context
 	// in the initial SYN-ACK.
 	rcvWnd seqnum.Size
@@ -108,9 +113,7 @@ type listenContext struct {
 	netProto tcpip.NetworkProtocolNumber
 
 	// pendingMu protects pendingEndpoints. This should only be accessed
-	// by the listening endpoint's worker goroutine.
-	//
-	// Lock Ordering: listenEP.workerMu -> pendingMu
+	// by the listener shard goroutine owning the context.
 	pendingMu sync.Mutex
 	// pending is used to wait for all pendingEndpoints to finish when
 	// a socket is closed.
@@ -121,8 +124,8 @@ type listenContext struct {
 }
 
 // timeStamp returns an 8-bit timestamp with a granularity of 64 seconds.
-func timeStamp() uint32 {
-	return uint32(time.Now().Unix()>>6) & tsMask
+func timeStamp(clock tcpip.Clock) uint32 {
+	return uint32(clock.Now().Unix()>>6) & tsMask
 }
 
 // newListenContext creates a new listen context.
@@ -141,6 +144,7 @@ func newListenContext(stk *stack.Stack, listenEP *endpoint, rcvWnd seqnum.Size,
 		panic(fmt.Sprintf("unable to get TCP protocol instance from stack: %+v", stk))
 	}
 	l.synRcvdCount = p.SynRcvdCounter()
+	l.timerWheel = &p.timerWheel
 
 	rand.Read(l.nonce[0][:])
 	rand.Read(l.nonce[1][:])
@@ -177,7 +181,7 @@ func (l *listenContext) cookieHash(id stack.TransportEndpointID, ts uint32, nonc
 // createCookie creates a SYN cookie for the given id and incoming sequence
 // number.
 func (l *listenContext) createCookie(id stack.TransportEndpointID, seq seqnum.Value, data uint32) seqnum.Value {
-	ts := timeStamp()
+	ts := timeStamp(l.stack.Clock())
 	v := l.cookieHash(id, 0, 0) + uint32(seq) + (ts << tsOffset)
 	v += (l.cookieHash(id, ts, 1) + data) & hashMask
 	return seqnum.Value(v)
@@ -187,7 +191,7 @@ func (l *listenContext) createCookie(id stack.TransportEndpointID, seq seqnum.Va
 // sequence number. If it is, it also returns the data originally encoded in the
 // cookie when createCookie was called.
 func (l *listenContext) isCookieValid(id stack.TransportEndpointID, cookie seqnum.Value, seq seqnum.Value) (uint32, bool) {
-	ts := timeStamp()
+	ts := timeStamp(l.stack.Clock())
 	v := uint32(cookie) - l.cookieHash(id, 0, 0) - uint32(seq)
 	cookieTS := v >> tsOffset
 	if ((ts - cookieTS) & tsMask) > maxTSDiff {
@@ -212,8 +216,14 @@ func (l *listenContext) createConnectingEndpoint(s *segment, iss seqnum.Value, i
 	}
 	route.ResolveWith(s.remoteLinkAddr)
 
-	n := newEndpoint(l.stack, netProto, queue)
+	n := newEndpoint(l.stack, l.timerWheel, netProto, queue)
 	n.ops.SetV6Only(l.v6Only)
+	if l.listenEP != nil {
+		// Segments of the handshake are subject to the minimum TTL of
+		// the listener.
+		n.ops.SetMinTTL(l.listenEP.ops.GetMinTTL())
+		n.ops.SetMinHopCount(l.listenEP.ops.GetMinHopCount())
+	}
 	n.ID = s.id
 	n.boundNICID = s.nicID
 	n.route = route
@@ -241,12 +251,10 @@ func (l *listenContext) createConnectingEndpoint(s *segment, iss seqnum.Value, i
 // state.
 //
 // On success, a handshake h is returned with h.ep.mu held.
-//
-// Precondition: if l.listenEP != nil, l.listenEP.mu must be locked.
 func (l *listenContext) startHandshake(s *segment, opts *header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner) (*handshake, *tcpip.Error) {
 	// Create new endpoint.
 	irs := s.sequenceNumber
-	isn := generateSecureISN(s.id, l.stack.Seed())
+	isn := generateSecureISN(s.id, l.stack.Clock(), l.stack.Seed())
 	ep, err := l.createConnectingEndpoint(s, isn, irs, opts, queue)
 	if err != nil {
 		return nil, err
@@ -285,7 +293,7 @@ func (l *listenContext) startHandshake(s *segment, opts *header.TCPSynOptions, q
 			return nil, tcpip.ErrConnectionAborted
 		}
 
-		deferAccept = l.listenEP.deferAccept
+		deferAccept = l.listenEP.listenOptions().deferAccept
 	}
 
 	// Register new endpoint so that packets are routed to it.
@@ -315,8 +323,6 @@ func (l *listenContext) startHandshake(s *segment, opts *header.TCPSynOptions, q
 
 // performHandshake performs a TCP 3-way handshake. On success, the new
 // established endpoint is returned with e.mu held.
-//
-// Precondition: if l.listenEP != nil, l.listenEP.mu must be locked.
 func (l *listenContext) performHandshake(s *segment, opts *header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner) (*endpoint, *tcpip.Error) {
 	h, err := l.startHandshake(s, opts, queue, owner)
 	if err != nil {
@@ -394,12 +400,16 @@ func (l *listenContext) cleanupCompletedHandshake(h *handshake) {
 // endpoint has transitioned out of the listen state (acceptedChan is nil),
 // the new endpoint is closed instead.
 func (e *endpoint) deliverAccepted(n *endpoint) {
-	e.mu.Lock()
+	e.acceptMu.Lock()
+	if e.acceptedChan == nil {
+		e.acceptMu.Unlock()
+		n.notifyProtocolGoroutine(notifyReset)
+		return
+	}
+	// acceptedChan is only closed with e.acceptMu held, after which the
+	// closing goroutine waits for all pending deliveries.
 	e.pendingAccepted.Add(1)
-	e.mu.Unlock()
 	defer e.pendingAccepted.Done()
-
-	e.acceptMu.Lock()
 	for {
 		if e.acceptedChan == nil {
 			e.acceptMu.Unlock()
@@ -420,13 +430,14 @@ func (e *endpoint) deliverAccepted(n *endpoint) {
 // propagateInheritableOptionsLocked propagates any options set on the listening
 // endpoint to the newly created endpoint.
 //
-// Precondition: e.mu and n.mu must be held.
+// Precondition: n.mu must be held.
 func (e *endpoint) propagateInheritableOptionsLocked(n *endpoint) {
-	n.userTimeout = e.userTimeout
-	n.portFlags = e.portFlags
-	n.boundBindToDevice = e.boundBindToDevice
-	n.boundPortFlags = e.boundPortFlags
-	n.userMSS = e.userMSS
+	opts := e.listenOptions()
+	n.userTimeout = opts.userTimeout
+	n.portFlags = opts.portFlags
+	n.boundBindToDevice = opts.boundBindToDevice
+	n.boundPortFlags = opts.boundPortFlags
+	n.userMSS = opts.userMSS
 }
 
 // reserveTupleLocked reserves an accepted endpoint's tuple.
@@ -469,8 +480,6 @@ func (e *endpoint) notifyAborted() {
 //
 // A limited number of these goroutines are allowed before TCP starts using SYN
 // cookies to accept connections.
-//
-// Precondition: if ctx.listenEP != nil, ctx.listenEP.mu must be locked.
 func (e *endpoint) handleSynSegment(ctx *listenContext, s *segment, opts *header.TCPSynOptions) *tcpip.Error {
 	defer s.decRef()
 
@@ -478,7 +487,7 @@ func (e *endpoint) handleSynSegment(ctx *listenContext, s *segment, opts *header
 	if err != nil {
 		e.stack.Stats().TCP.FailedConnectionAttempts.Increment()
 		e.stats.FailedConnectionAttempts.Increment()
-		e.synRcvdCount--
+		e.decSynRcvdCount()
 		return err
 	}
 
@@ -488,15 +497,11 @@ func (e *endpoint) handleSynSegment(ctx *listenContext, s *segment, opts *header
 			e.stack.Stats().TCP.FailedConnectionAttempts.Increment()
 			e.stats.FailedConnectionAttempts.Increment()
 			ctx.cleanupFailedHandshake(h)
-			e.mu.Lock()
-			e.synRcvdCount--
-			e.mu.Unlock()
+			e.decSynRcvdCount()
 			return
 		}
 		ctx.cleanupCompletedHandshake(h)
-		e.mu.Lock()
-		e.synRcvdCount--
-		e.mu.Unlock()
+		e.decSynRcvdCount()
 		h.ep.startAcceptedLoop()
 		e.stack.Stats().TCP.PassiveConnectionOpenings.Increment()
 		e.deliverAccepted(h.ep)
@@ -505,14 +510,24 @@ func (e *endpoint) handleSynSegment(ctx *listenContext, s *segment, opts *header
 	return nil
 }
 
+// incSynRcvdCount reserves room in the accept queue for a connection in
+// SYN-RCVD state. It fails if the accept queue is full.
 func (e *endpoint) incSynRcvdCount() bool {
 	e.acceptMu.Lock()
-	canInc := e.synRcvdCount < cap(e.acceptedChan)
-	e.acceptMu.Unlock()
-	if canInc {
-		e.synRcvdCount++
+	defer e.acceptMu.Unlock()
+	if len(e.acceptedChan)+e.synRcvdCount >= cap(e.acceptedChan) {
+		return false
 	}
-	return canInc
+	e.synRcvdCount++
+	return true
+}
+
+// decSynRcvdCount releases the room reserved by a successful call to
+// incSynRcvdCount.
+func (e *endpoint) decSynRcvdCount() {
+	e.acceptMu.Lock()
+	e.synRcvdCount--
+	e.acceptMu.Unlock()
 }
 
 func (e *endpoint) acceptQueueIsFull() bool {
@@ -525,8 +540,10 @@ func (e *endpoint) acceptQueueIsFull() bool {
 // handleListenSegment is called when a listening endpoint receives a segment
 // and needs to handle it.
 //
-// Precondition: if ctx.listenEP != nil, ctx.listenEP.mu must be locked.
+// It is called by the listener shard owning ctx, without holding e.mu, so it
+// must only use the listener's options through e.listenOptions().
 func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Error {
+	lopts := e.listenOptions()
 	e.rcvListMu.Lock()
 	rcvClosed := e.rcvClosed
 	e.rcvListMu.Unlock()
@@ -536,24 +553,25 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 		// RFC 793 section 3.4 page 35 (figure 12) outlines that a RST
 		// must be sent in response to a SYN-ACK while in the listen
 		// state to prevent completing a handshake from an old SYN.
-		return replyWithReset(e.stack, s, e.sendTOS, e.ttl)
+		return replyWithReset(e.stack, s, lopts.sendTOS, lopts.ttl)
 	}
 
 	switch {
 	case s.flags == header.TCPFlagSyn:
 		opts := parseSynSegmentOptions(s)
 		if ctx.synRcvdCount.inc() {
-			// Only handle the syn if the following conditions hold
-			//   - accept queue is not full.
-			//   - number of connections in synRcvd state is less than the
-			//     backlog.
-			if !e.acceptQueueIsFull() && e.incSynRcvdCount() {
+			// Only handle the syn if the accept queue, including the
+			// connections in synRcvd state, is not full.
+			if e.incSynRcvdCount() {
 				s.incRef()
 				_ = e.handleSynSegment(ctx, s, &opts)
 				return nil
 			}
 			ctx.synRcvdCount.dec()
+			recordEvent(e.stack, stack.EventSynFlood, s, fmt.Sprintf("accept queue of port %d full", s.id.LocalPort))
 			e.stack.Stats().TCP.ListenOverflowSynDrop.Increment()
+			e.stack.Stats().TCP.ListenOverflows.Increment()
+			e.stack.Stats().TCP.ListenDrops.Increment()
 			e.stats.ReceiveErrors.ListenOverflowSynDrop.Increment()
 			e.stack.Stats().DroppedPackets.Increment()
 			return nil
@@ -561,11 +579,15 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 			// If cookies are in use but the endpoint accept queue
 			// is full then drop the syn.
 			if e.acceptQueueIsFull() {
+				recordEvent(e.stack, stack.EventSynFlood, s, fmt.Sprintf("accept queue of port %d full", s.id.LocalPort))
 				e.stack.Stats().TCP.ListenOverflowSynDrop.Increment()
+				e.stack.Stats().TCP.ListenOverflows.Increment()
+				e.stack.Stats().TCP.ListenDrops.Increment()
 				e.stats.ReceiveErrors.ListenOverflowSynDrop.Increment()
 				e.stack.Stats().DroppedPackets.Increment()
 				return nil
 			}
+			recordEvent(e.stack, stack.EventSynFlood, s, fmt.Sprintf("SYN cookies sent for port %d", s.id.LocalPort))
 			cookie := ctx.createCookie(s.id, s.sequenceNumber, encodeMSS(opts.MSS))
 
 			route, err := e.stack.FindRoute(s.nicID, s.dstAddr, s.srcAddr, s.netProto, false /* multicastLoop */)
@@ -586,14 +608,14 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 			synOpts := header.TCPSynOptions{
 				WS:    -1,
 				TS:    opts.TS,
-				TSVal: tcpTimeStamp(time.Now(), timeStampOffset()),
+				TSVal: tcpTimeStamp(e.stack.Clock().Now(), timeStampOffset()),
 				TSEcr: opts.TSVal,
-				MSS:   calculateAdvertisedMSS(e.userMSS, route),
+				MSS:   calculateAdvertisedMSS(lopts.userMSS, route),
 			}
 			fields := tcpFields{
 				id:     s.id,
-				ttl:    e.ttl,
-				tos:    e.sendTOS,
+				ttl:    lopts.ttl,
+				tos:    lopts.sendTOS,
 				flags:  header.TCPFlagSyn | header.TCPFlagAck,
 				seq:    cookie,
 				ack:    s.sequenceNumber + 1,
@@ -608,13 +630,24 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 
 	case (s.flags & header.TCPFlagAck) != 0:
 		if e.acceptQueueIsFull() {
-			// Silently drop the ack as the application can't accept
-			// the connection at this point. The ack will be
-			// retransmitted by the sender anyway and we can
-			// complete the connection at the time of retransmit if
-			// the backlog has space.
 			e.stack.Stats().TCP.ListenOverflowAckDrop.Increment()
+			e.stack.Stats().TCP.ListenOverflows.Increment()
+			e.stack.Stats().TCP.ListenDrops.Increment()
 			e.stats.ReceiveErrors.ListenOverflowAckDrop.Increment()
+
+			// If tcp_abort_on_overflow is enabled, reset the
+			// connection so that the peer learns it won't be
+			// accepted, as Linux does.
+			var abort tcpip.TCPAbortOnOverflowOption
+			if err := e.stack.TransportProtocolOption(ProtocolNumber, &abort); err == nil && bool(abort) {
+				return replyWithReset(e.stack, s, lopts.sendTOS, lopts.ttl)
+			}
+
+			// Otherwise, silently drop the ack as the application
+			// can't accept the connection at this point. The ack
+			// will be retransmitted by the sender anyway and we can
+			// complete the connection at the time of retransmit if
+			// the backlog has space.
 			e.stack.Stats().DroppedPackets.Increment()
 			return nil
 		}
@@ -635,7 +668,7 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 			// The only time we should reach here when a connection
 			// was opened and closed really quickly and a delayed
 			// ACK was received from the sender.
-			return replyWithReset(e.stack, s, e.sendTOS, e.ttl)
+			return replyWithReset(e.stack, s, lopts.sendTOS, lopts.ttl)
 		}
 
 		iss := s.ackNumber - 1
@@ -654,6 +687,7 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 		data, ok := ctx.isCookieValid(s.id, iss, irs)
 		if !ok || int(data) >= len(mssTable) {
 			e.stack.Stats().TCP.ListenOverflowInvalidSynCookieRcvd.Increment()
+			e.stack.Stats().TCP.ListenDrops.Increment()
 			e.stack.Stats().DroppedPackets.Increment()
 			return nil
 		}
@@ -748,21 +782,200 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) *tcpip.Er
 	}
 }
 
+// listenOptions holds the options of a listening endpoint that are used to
+// handle connection requests. The listener shards read them without holding
+// the endpoint's mu, so a listenOptions is never modified once published by
+// updateListenOptionsLocked.
+type listenOptions struct {
+	userMSS           uint16
+	ttl               uint8
+	sendTOS           uint8
+	userTimeout       time.Duration
+	deferAccept       time.Duration
+	portFlags         ports.Flags
+	boundPortFlags    ports.Flags
+	boundBindToDevice tcpip.NICID
+}
+
+// listenOptions returns the options of a listening endpoint that are used to
+// handle connection requests.
+func (e *endpoint) listenOptions() *listenOptions {
+	return e.listenOpts.Load().(*listenOptions)
+}
+
+// updateListenOptionsLocked publishes the current options of a listening
+// endpoint to its listener shards. It must be called whenever one of the
+// options in listenOptions changes.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) updateListenOptionsLocked() {
+	if e.listenShards == nil {
+		return
+	}
+	e.listenOpts.Store(&listenOptions{
+		userMSS:           e.userMSS,
+		ttl:               e.ttl,
+		sendTOS:           e.sendTOS,
+		userTimeout:       e.userTimeout,
+		deferAccept:       e.deferAccept,
+		portFlags:         e.portFlags,
+		boundPortFlags:    e.boundPortFlags,
+		boundBindToDevice: e.boundBindToDevice,
+	})
+}
+
+// listenShard handles the segments received by a listening endpoint for a
+// subset of the connection requests, selected by the hash of their 4-tuple.
+// All the segments of a connection are handled by the same shard, so that
+// shards don't share any handshake state and a listener can handle connection
+// requests concurrently.
+type listenShard struct {
+	ep *endpoint
+
+	// ctx holds the state of the connection requests handled by the shard.
+	// It is only used by the shard goroutine, or by the listen goroutine
+	// while the shard goroutine is stopped.
+	ctx *listenContext
+
+	// segmentQueue holds the segments to be handled by the shard.
+	segmentQueue segmentQueue
+
+	// newSegmentWaker is used to indicate to the shard goroutine that it
+	// needs to wake up and handle new segments queued to it.
+	newSegmentWaker sleep.Waker
+
+	// stopWaker is used to indicate to the shard goroutine that it must
+	// stop.
+	stopWaker sleep.Waker
+}
+
+// newListenShardsLocked creates the listener shards of e, one per TCP
+// processor of the stack.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) newListenShardsLocked(rcvWnd seqnum.Size) {
+	p, ok := e.stack.TransportProtocolInstance(ProtocolNumber).(*protocol)
+	if !ok {
+		panic(fmt.Sprintf("unable to get TCP protocol instance from stack: %+v", e.stack))
+	}
+	v6Only := e.ops.GetV6Only()
+	e.listenSeed = generateRandUint32()
+	e.listenShards = make([]*listenShard, len(p.dispatcher.processors))
+	for i := range e.listenShards {
+		sh := &listenShard{
+			ep:  e,
+			ctx: newListenContext(e.stack, e, rcvWnd, v6Only, e.NetProto),
+		}
+		sh.segmentQueue.ep = e
+		e.listenShards[i] = sh
+	}
+}
+
+// listenShardFor returns the listener shard handling the segments of the
+// connection with the given id.
+func (e *endpoint) listenShardFor(id stack.TransportEndpointID) *listenShard {
+	return e.listenShards[hashEndpointID(e.listenSeed, id)%uint32(len(e.listenShards))]
+}
+
+// startListenShards starts the goroutines of the listener shards.
+func (e *endpoint) startListenShards() {
+	for _, sh := range e.listenShards {
+		e.listenShardsWG.Add(1)
+		go sh.run(&e.listenShardsWG) // S/R-SAFE: stopped on drain.
+	}
+}
+
+// stopListenShards stops the goroutines of the listener shards and waits for
+// them to terminate. Segments queued to the shards are left in their queues.
+func (e *endpoint) stopListenShards() {
+	for _, sh := range e.listenShards {
+		sh.stopWaker.Assert()
+	}
+	e.listenShardsWG.Wait()
+}
+
+// run is the main loop of a listener shard. It handles the segments queued to
+// the shard until the shard is stopped.
+func (sh *listenShard) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	s := sleep.Sleeper{}
+	s.AddWaker(&sh.stopWaker, wakerForNotification)
+	s.AddWaker(&sh.newSegmentWaker, wakerForNewSegment)
+	defer s.Done()
+
+	// Segments may have been queued while the shard was stopped.
+	if !sh.segmentQueue.empty() {
+		sh.newSegmentWaker.Assert()
+	}
+	for {
+		switch index, _ := s.Fetch(true); index {
+		case wakerForNotification:
+			return
+
+		case wakerForNewSegment:
+			// Process at most maxSegmentsPerWake segments.
+			mayRequeue := true
+			for i := 0; i < maxSegmentsPerWake; i++ {
+				s := sh.segmentQueue.dequeue()
+				if s == nil {
+					mayRequeue = false
+					break
+				}
+
+				// TODO(gvisor.dev/issue/4690): Better handle errors instead of
+				// silently dropping.
+				_ = sh.ep.handleListenSegment(sh.ctx, s)
+				s.decRef()
+			}
+
+			// If the queue is not empty, make sure we'll wake up
+			// in the next iteration.
+			if mayRequeue && !sh.segmentQueue.empty() {
+				sh.newSegmentWaker.Assert()
+			}
+		}
+	}
+}
+
+// handleQueuedSegments handles the segments queued to a stopped listener
+// shard.
+func (sh *listenShard) handleQueuedSegments() {
+	for s := sh.segmentQueue.dequeue(); s != nil; s = sh.segmentQueue.dequeue() {
+		// TODO(gvisor.dev/issue/4690): Better handle errors instead of
+		// silently dropping.
+		_ = sh.ep.handleListenSegment(sh.ctx, s)
+		s.decRef()
+	}
+}
+
+// drainClosingSegmentQueue tries to re-match the segments queued to a listener
+// shard of a closed endpoint to a different endpoint.
+func (sh *listenShard) drainClosingSegmentQueue() {
+	for s := sh.segmentQueue.dequeue(); s != nil; s = sh.segmentQueue.dequeue() {
+		sh.ep.tryDeliverSegmentFromClosedEndpoint(s)
+	}
+}
+
 // protocolListenLoop is the main loop of a listening TCP endpoint. It runs in
-// its own goroutine and is responsible for handling connection requests.
-func (e *endpoint) protocolListenLoop(rcvWnd seqnum.Size) {
+// its own goroutine and is responsible for handling notifications, while
+// connection requests are handled by the listener shards.
+func (e *endpoint) protocolListenLoop() {
 	e.mu.Lock()
-	v6Only := e.ops.GetV6Only()
-	ctx := newListenContext(e.stack, e, rcvWnd, v6Only, e.NetProto)
 
 	defer func() {
+		// Stop handling connection requests.
+		e.stopListenShards()
+
 		// Mark endpoint as closed. This will prevent goroutines running
 		// handleSynSegment() from attempting to queue new connections
 		// to the endpoint.
 		e.setEndpointState(StateClose)
 
 		// Close any endpoints in SYN-RCVD state.
-		ctx.closeAllPendingEndpoints()
+		for _, sh := range e.listenShards {
+			sh.ctx.closeAllPendingEndpoints()
+		}
 
 		// Do cleanup if needed.
 		e.completeWorkerLocked()
@@ -772,6 +985,9 @@ func (e *endpoint) protocolListenLoop(rcvWnd seqnum.Size) {
 		}
 		e.mu.Unlock()
 
+		for _, sh := range e.listenShards {
+			sh.drainClosingSegmentQueue()
+		}
 		e.drainClosingSegmentQueue()
 
 		// Notify waiters that the endpoint is shutdown.
@@ -780,52 +996,24 @@ func (e *endpoint) protocolListenLoop(rcvWnd seqnum.Size) {
 
 	s := sleep.Sleeper{}
 	s.AddWaker(&e.notificationWaker, wakerForNotification)
-	s.AddWaker(&e.newSegmentWaker, wakerForNewSegment)
 	for {
 		e.mu.Unlock()
-		index, _ := s.Fetch(true)
+		s.Fetch(true)
 		e.mu.Lock()
-		switch index {
-		case wakerForNotification:
-			n := e.fetchNotifications()
-			if n&notifyClose != 0 {
-				return
-			}
-			if n&notifyDrain != 0 {
-				for !e.segmentQueue.empty() {
-					s := e.segmentQueue.dequeue()
-					// TODO(gvisor.dev/issue/4690): Better handle errors instead of
-					// silently dropping.
-					_ = e.handleListenSegment(ctx, s)
-					s.decRef()
-				}
-				close(e.drainDone)
-				e.mu.Unlock()
-				<-e.undrain
-				e.mu.Lock()
-			}
-
-		case wakerForNewSegment:
-			// Process at most maxSegmentsPerWake segments.
-			mayRequeue := true
-			for i := 0; i < maxSegmentsPerWake; i++ {
-				s := e.segmentQueue.dequeue()
-				if s == nil {
-					mayRequeue = false
-					break
-				}
-
-				// TODO(gvisor.dev/issue/4690): Better handle errors instead of
-				// silently dropping.
-				_ = e.handleListenSegment(ctx, s)
-				s.decRef()
-			}
-
-			// If the queue is not empty, make sure we'll wake up
-			// in the next iteration.
-			if mayRequeue && !e.segmentQueue.empty() {
-				e.newSegmentWaker.Assert()
+		n := e.fetchNotifications()
+		if n&notifyClose != 0 {
+			return
+		}
+		if n&notifyDrain != 0 {
+			e.stopListenShards()
+			for _, sh := range e.listenShards {
+				sh.handleQueuedSegments()
 			}
+			close(e.drainDone)
+			e.mu.Unlock()
+			<-e.undrain
+			e.mu.Lock()
+			e.startListenShards()
 		}
 	}
 }
@@ -93,6 +93,10 @@ type handshake struct {
 	// startTime is the time at which the first SYN/SYN-ACK was sent.
 	startTime time.Time
 
+	// synRetransmits is the number of times the SYN was retransmitted by an
+	// active handshake.
+	synRetransmits int
+
 	// deferAccept if non-zero will drop the final ACK for a passive
 	// handshake till an ACK segment with data is received or the timeout is
 	// hit.
@@ -155,12 +159,12 @@ func (h *handshake) resetState() {
 	h.flags = header.TCPFlagSyn
 	h.ackNum = 0
 	h.mss = 0
-	h.iss = generateSecureISN(h.ep.ID, h.ep.stack.Seed())
+	h.iss = generateSecureISN(h.ep.ID, h.ep.stack.Clock(), h.ep.stack.Seed())
 }
 
 // generateSecureISN generates a secure Initial Sequence number based on the
 // recommendation here https://tools.ietf.org/html/rfc6528#page-3.
-func generateSecureISN(id stack.TransportEndpointID, seed uint32) seqnum.Value {
+func generateSecureISN(id stack.TransportEndpointID, clock tcpip.Clock, seed uint32) seqnum.Value {
 	isnHasher := jenkins.Sum32(seed)
 	isnHasher.Write([]byte(id.LocalAddress))
 	isnHasher.Write([]byte(id.RemoteAddress))
@@ -179,7 +183,7 @@ func generateSecureISN(id stack.TransportEndpointID, seed uint32) seqnum.Value {
 	//
 	// Which sort of guarantees that we won't reuse the ISN for a new
 	// connection for the same tuple for at least 274s.
-	isn := isnHasher.Sum32() + uint32(time.Now().UnixNano()>>6)
+	isn := isnHasher.Sum32() + uint32(clock.NowNanoseconds()>>6)
 	return seqnum.Value(isn)
 }
 
@@ -378,7 +382,7 @@ func (h *handshake) synRcvdState(s *segment) *tcpip.Error {
 	if s.flagIsSet(header.TCPFlagAck) {
 		// If deferAccept is not zero and this is a bare ACK and the
 		// timeout is not hit then drop the ACK.
-		if h.deferAccept != 0 && s.data.Size() == 0 && time.Since(h.startTime) < h.deferAccept {
+		if h.deferAccept != 0 && s.data.Size() == 0 && h.ep.stack.Clock().Now().Sub(h.startTime) < h.deferAccept {
 			h.acked = true
 			h.ep.stack.Stats().DroppedPackets.Increment()
 			return nil
@@ -516,7 +520,7 @@ func (h *handshake) start() *tcpip.Error {
 		}
 	}
 
-	h.startTime = time.Now()
+	h.startTime = h.ep.stack.Clock().Now()
 	h.ep.amss = calculateAdvertisedMSS(h.ep.userMSS, h.ep.route)
 	var sackEnabled tcpip.TCPSACKEnabled
 	if err := h.ep.stack.TransportProtocolOption(ProtocolNumber, &sackEnabled); err != nil {
@@ -570,7 +574,7 @@ func (h *handshake) complete() *tcpip.Error {
 	defer s.Done()
 
 	// Initialize the resend timer.
-	timer, err := newBackoffTimer(time.Second, MaxRTO, resendWaker.Assert)
+	timer, err := newBackoffTimer(h.ep.stack.Clock(), time.Second, MaxRTO, resendWaker.Assert)
 	if err != nil {
 		return err
 	}
@@ -595,7 +599,7 @@ func (h *handshake) complete() *tcpip.Error {
 			// The last is required to provide a way for the peer to complete
 			// the connection with another ACK or data (as ACKs are never
 			// retransmitted on their own).
-			if h.active || !h.acked || h.deferAccept != 0 && time.Since(h.startTime) > h.deferAccept {
+			if h.active || !h.acked || h.deferAccept != 0 && h.ep.stack.Clock().Now().Sub(h.startTime) > h.deferAccept {
 				h.ep.sendSynTCP(h.ep.route, tcpFields{
 					id:     h.ep.ID,
 					ttl:    h.ep.ttl,
@@ -605,6 +609,10 @@ func (h *handshake) complete() *tcpip.Error {
 					ack:    h.ackNum,
 					rcvWnd: h.rcvWnd,
 				}, h.sendSYNOpts)
+				if h.active {
+					h.synRetransmits++
+					h.ep.notifyConnectProgress(tcpip.ConnectSYNRetransmitted, h.ep.stack.Clock().Now().Sub(h.startTime), nil)
+				}
 			}
 
 		case wakerForNotification:
@@ -645,15 +653,15 @@ func (h *handshake) complete() *tcpip.Error {
 type backoffTimer struct {
 	timeout    time.Duration
 	maxTimeout time.Duration
-	t          *time.Timer
+	t          tcpip.Timer
 }
 
-func newBackoffTimer(timeout, maxTimeout time.Duration, f func()) (*backoffTimer, *tcpip.Error) {
+func newBackoffTimer(clock tcpip.Clock, timeout, maxTimeout time.Duration, f func()) (*backoffTimer, *tcpip.Error) {
 	if timeout > maxTimeout {
 		return nil, tcpip.ErrTimeout
 	}
 	bt := &backoffTimer{timeout: timeout, maxTimeout: maxTimeout}
-	bt.t = time.AfterFunc(timeout, f)
+	bt.t = clock.AfterFunc(timeout, f)
 	return bt, nil
 }
 
@@ -711,39 +719,28 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	// 	else: FASTOPEN (2 + len(cookie))
 	//	cookie(variable) [padding to four bytes]
 	//
-	options := getOptions()
-
 	// Always encode the mss.
-	offset := header.EncodeMSSOption(uint32(opts.MSS), options)
+	serializer := header.TCPOptionsSerializer{&header.TCPSerializableMSSOption{MSS: opts.MSS}}
 
 	// Special ordering is required here. If both TS and SACK are enabled,
 	// then the SACK option precedes TS, with no padding. If they are
 	// enabled individually, then we see padding before the option.
+	ts := &header.TCPSerializableTimestampOption{TSVal: opts.TSVal, TSEcr: opts.TSEcr}
 	if opts.TS && opts.SACKPermitted {
-		offset += header.EncodeSACKPermittedOption(options[offset:])
-		offset += header.EncodeTSOption(opts.TSVal, opts.TSEcr, options[offset:])
+		serializer = append(serializer, &header.TCPSerializableSACKPermittedOption{}, ts)
 	} else if opts.TS {
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeTSOption(opts.TSVal, opts.TSEcr, options[offset:])
+		serializer = append(serializer, &header.TCPSerializableNOPOption{}, &header.TCPSerializableNOPOption{}, ts)
 	} else if opts.SACKPermitted {
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeSACKPermittedOption(options[offset:])
+		serializer = append(serializer, &header.TCPSerializableNOPOption{}, &header.TCPSerializableNOPOption{}, &header.TCPSerializableSACKPermittedOption{})
 	}
 
 	// Initialize the WS option.
 	if opts.WS >= 0 {
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeWSOption(opts.WS, options[offset:])
-	}
-
-	// Padding to the end; note that this never apply unless we add a
-	// fastopen option, we always expect the offset to remain the same.
-	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
-		panic("unexpected option encoding")
+		serializer = append(serializer, &header.TCPSerializableNOPOption{}, &header.TCPSerializableWSOption{Shift: opts.WS})
 	}
 
+	options := getOptions()
+	offset := serializer.Serialize(options)
 	return options[:offset]
 }
 
@@ -759,6 +756,10 @@ type tcpFields struct {
 	rcvWnd seqnum.Size
 	opts   []byte
 	txHash uint32
+
+	// priority is the priority of the packets, see
+	// stack.PacketBuffer.Priority.
+	priority uint32
 }
 
 func (e *endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions) *tcpip.Error {
@@ -773,10 +774,31 @@ func (e *endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOp
 
 func (e *endpoint) sendTCP(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO) *tcpip.Error {
 	tf.txHash = e.txHash
+	tf.priority = e.ops.GetPriority()
+	var flushErr *tcpip.Error
+	if e.snd != nil && e.snd.batching {
+		if e.canBatch(r, tf, data, gso) {
+			// Segments with different network header parameters can't share
+			// a batch.
+			params := batchParams(r, tf)
+			if e.snd.batchParams != params {
+				flushErr = e.snd.flushBatch()
+			}
+			e.snd.batchParams = params
+			e.queueTCP(r, tf, data, gso)
+			return flushErr
+		}
+		// Segments that can't be batched must not overtake the ones that
+		// are already queued.
+		flushErr = e.snd.flushBatch()
+	}
 	if err := sendTCP(r, tf, data, gso, e.owner); err != nil {
 		e.stats.SendErrors.SegmentSendToNetworkFailed.Increment()
 		return err
 	}
+	if flushErr != nil {
+		return flushErr
+	}
 	e.stats.SegmentsSent.Increment()
 	return nil
 }
@@ -810,7 +832,83 @@ func buildTCPHdr(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso *sta
 	}
 }
 
-func sendTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO, owner tcpip.PacketOwner) *tcpip.Error {
+// canBatch returns true if the segment described by tf and data can be queued
+// in the current transmit pass instead of being written out immediately.
+func (e *endpoint) canBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO) bool {
+	// Looped back packets are delivered inline and can't go through
+	// WritePackets. SYN and RST segments are rare and have their own
+	// accounting, so they are always sent on their own.
+	if r != e.route || r.Loop&stack.PacketLoop != 0 || tf.flags&(header.TCPFlagSyn|header.TCPFlagRst) != 0 {
+		return false
+	}
+	// WritePackets doesn't queue packets while the link address is being
+	// resolved (see gvisor.dev/issue/4458), so leave those to WritePacket.
+	if r.IsResolutionRequired() {
+		return false
+	}
+	// Nor does it handle segments that would need to be fragmented.
+	if gso == nil && header.TCPMinimumSize+len(tf.opts)+data.Size() > int(r.MTU()) {
+		return false
+	}
+	return true
+}
+
+// batchParams returns the network header parameters used to send the segment
+// described by tf on r.
+func batchParams(r *stack.Route, tf tcpFields) stack.NetworkHeaderParams {
+	ttl := tf.ttl
+	if ttl == 0 {
+		ttl = r.DefaultTTL()
+	}
+	return stack.NetworkHeaderParams{Protocol: ProtocolNumber, TTL: ttl, TOS: tf.tos}
+}
+
+// queueTCP builds the segment(s) carrying data and queues them in the current
+// transmit pass.
+func (e *endpoint) queueTCP(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO) {
+	if tf.rcvWnd > 0xffff {
+		tf.rcvWnd = 0xffff
+	}
+	if gso != nil && gso.Type == stack.GSOSW && int(gso.MSS) < data.Size() {
+		buildTCPBatch(r, tf, data, gso, e.owner, &e.snd.batch)
+		return
+	}
+	// The packet is written out after the caller returns, so it must not
+	// share the underlying views slice with data, which may be trimmed in
+	// the meantime.
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts),
+		Data:               data.Clone(nil),
+	})
+	pkt.Hash = tf.txHash
+	pkt.Owner = e.owner
+	pkt.Priority = tf.priority
+	buildTCPHdr(r, tf, pkt, gso)
+	e.snd.batch.PushBack(pkt)
+}
+
+// sendTCPBatchQueued writes out the segments queued during a transmit pass.
+func (e *endpoint) sendTCPBatchQueued(pkts stack.PacketBufferList, params stack.NetworkHeaderParams) *tcpip.Error {
+	n := pkts.Len()
+	r := e.route
+	if r == nil {
+		// The endpoint was cleaned up in the middle of the pass.
+		e.stats.SendErrors.SegmentSendToNetworkFailed.IncrementBy(uint64(n))
+		return tcpip.ErrInvalidEndpointState
+	}
+	sent, err := r.WritePackets(e.gso, pkts, params)
+	if err != nil {
+		e.stats.SendErrors.SegmentSendToNetworkFailed.IncrementBy(uint64(n - sent))
+		r.Stats().TCP.SegmentSendErrors.IncrementBy(uint64(n - sent))
+	}
+	e.stats.SegmentsSent.IncrementBy(uint64(sent))
+	r.Stats().TCP.SegmentsSent.IncrementBy(uint64(sent))
+	return err
+}
+
+// buildTCPBatch splits data into MSS sized segments and appends them to pkts.
+// It returns the number of segments built.
+func buildTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO, owner tcpip.PacketOwner, pkts *stack.PacketBufferList) int {
 	// We need to shallow clone the VectorisedView here as ReadToView will
 	// split the VectorisedView and Trim underlying views as it splits. Not
 	// doing the clone here will cause the underlying views of data itself
@@ -818,16 +916,11 @@ func sendTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso
 	data = data.Clone(nil)
 
 	optLen := len(tf.opts)
-	if tf.rcvWnd > 0xffff {
-		tf.rcvWnd = 0xffff
-	}
-
 	mss := int(gso.MSS)
 	n := (data.Size() + mss - 1) / mss
 
 	size := data.Size()
 	hdrSize := header.TCPMinimumSize + int(r.MaxHeaderLength()) + optLen
-	var pkts stack.PacketBufferList
 	for i := 0; i < n; i++ {
 		packetSize := mss
 		if packetSize > size {
@@ -839,6 +932,7 @@ func sendTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso
 		})
 		pkt.Hash = tf.txHash
 		pkt.Owner = owner
+		pkt.Priority = tf.priority
 		pkt.EgressRoute = r
 		pkt.GSOOptions = gso
 		pkt.NetworkProtocolNumber = r.NetProto
@@ -847,6 +941,16 @@ func sendTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso
 		tf.seq = tf.seq.Add(seqnum.Size(packetSize))
 		pkts.PushBack(pkt)
 	}
+	return n
+}
+
+func sendTCPBatch(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stack.GSO, owner tcpip.PacketOwner) *tcpip.Error {
+	if tf.rcvWnd > 0xffff {
+		tf.rcvWnd = 0xffff
+	}
+
+	var pkts stack.PacketBufferList
+	n := buildTCPBatch(r, tf, data, gso, owner, &pkts)
 
 	if tf.ttl == 0 {
 		tf.ttl = r.DefaultTTL()
@@ -877,6 +981,7 @@ func sendTCP(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stac
 	})
 	pkt.Hash = tf.txHash
 	pkt.Owner = owner
+	pkt.Priority = tf.priority
 	buildTCPHdr(r, tf, pkt, gso)
 
 	if tf.ttl == 0 {
@@ -895,8 +1000,7 @@ func sendTCP(r *stack.Route, tf tcpFields, data buffer.VectorisedView, gso *stac
 
 // makeOptions makes an options slice.
 func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
-	options := getOptions()
-	offset := 0
+	var serializer header.TCPOptionsSerializer
 
 	// N.B. the ordering here matches the ordering used by Linux internally
 	// and described in the raw makeOptions function. We don't include
@@ -914,21 +1018,20 @@ func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
 		// timestamp clock.
 		//
 		// Ref: https://tools.ietf.org/html/rfc7323#section-5.4.
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeTSOption(e.timestamp(), e.recentTimestamp(), options[offset:])
+		serializer = append(serializer,
+			&header.TCPSerializableNOPOption{},
+			&header.TCPSerializableNOPOption{},
+			&header.TCPSerializableTimestampOption{TSVal: e.timestamp(), TSEcr: e.recentTimestamp()})
 	}
 	if e.sackPermitted && len(sackBlocks) > 0 {
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeNOP(options[offset:])
-		offset += header.EncodeSACKBlocks(sackBlocks, options[offset:])
-	}
-
-	// We expect the above to produce an aligned offset.
-	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
-		panic("unexpected option encoding")
+		serializer = append(serializer,
+			&header.TCPSerializableNOPOption{},
+			&header.TCPSerializableNOPOption{},
+			&header.TCPSerializableSACKBlocksOption{Blocks: sackBlocks})
 	}
 
+	options := getOptions()
+	offset := serializer.Serialize(options)
 	return options[:offset]
 }
 
@@ -965,6 +1068,9 @@ func (e *endpoint) handleWrite() *tcpip.Error {
 		e.snd.writeList.PushBackList(&e.sndQueue)
 		e.sndBufInQueue = 0
 	}
+	e.snd.more = e.sndMore
+	e.snd.push = e.snd.push || e.sndPush
+	e.sndPush = false
 
 	e.sndBufMu.Unlock()
 
@@ -1049,6 +1155,40 @@ func (e *endpoint) transitionToStateEstablishedLocked(h *handshake) {
 	e.rcvListMu.Unlock()
 
 	e.setEndpointState(StateEstablished)
+	if h.active {
+		e.notifyConnectProgress(tcpip.ConnectEstablished, e.stack.Clock().Now().Sub(h.startTime), nil)
+	}
+}
+
+// notifyConnectProgress reports the progress of the connection attempt of e
+// to the stack statistics and to its tcpip.ConnectObserver, if any.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) notifyConnectProgress(typ tcpip.ConnectProgressEventType, elapsed time.Duration, err *tcpip.Error) {
+	stats := e.stack.Stats().TCP
+	switch typ {
+	case tcpip.ConnectEstablished:
+		stats.HandshakeLatency.Record(elapsed)
+		stats.HandshakeSYNRetransmits.Record(e.h.synRetransmits)
+	case tcpip.ConnectFailed:
+		stats.HandshakeSYNRetransmits.Record(e.h.synRetransmits)
+		stats.HandshakeFailures.Record(err)
+	}
+
+	if e.connectObserver == nil {
+		return
+	}
+	e.connectObserver.OnConnectProgress(tcpip.ConnectProgressEvent{
+		Type:     typ,
+		NetProto: e.route.NetProto,
+		RemoteAddress: tcpip.FullAddress{
+			NIC:  e.route.NICID(),
+			Addr: e.ID.RemoteAddress,
+			Port: e.ID.RemotePort,
+		},
+		Elapsed: elapsed,
+		Err:     err,
+	})
 }
 
 // transitionToStateCloseLocked ensures that the endpoint is
@@ -1160,6 +1300,12 @@ func (e *endpoint) handleReset(s *segment) (ok bool, err *tcpip.Error) {
 
 // handleSegments processes all inbound segments.
 func (e *endpoint) handleSegments(fastPath bool) *tcpip.Error {
+	// All segments generated while processing this round of inbound
+	// segments, including the trailing ACK, are written out as one batch.
+	if e.snd.beginBatch() {
+		defer e.snd.endBatch()
+	}
+
 	checkRequeue := true
 	for i := 0; i < maxSegmentsPerWake; i++ {
 		if e.EndpointState().closed() {
@@ -1277,86 +1423,23 @@ func (e *endpoint) handleSegment(s *segment) (cont bool, err *tcpip.Error) {
 	return true, nil
 }
 
-// keepaliveTimerExpired is called when the keepaliveTimer fires. We send TCP
-// keepalive packets periodically when the connection is idle. If we don't hear
-// from the other side after a number of tries, we terminate the connection.
-func (e *endpoint) keepaliveTimerExpired() *tcpip.Error {
-	userTimeout := e.userTimeout
-
-	e.keepalive.Lock()
-	if !e.SocketOptions().GetKeepAlive() || !e.keepalive.timer.checkExpiration() {
-		e.keepalive.Unlock()
-		return nil
-	}
-
-	// If a userTimeout is set then abort the connection if it is
-	// exceeded.
-	if userTimeout != 0 && time.Since(e.rcv.lastRcvdAckTime) >= userTimeout && e.keepalive.unacked > 0 {
-		e.keepalive.Unlock()
-		e.stack.Stats().TCP.EstablishedTimedout.Increment()
-		return tcpip.ErrTimeout
-	}
-
-	if e.keepalive.unacked >= e.keepalive.count {
-		e.keepalive.Unlock()
-		e.stack.Stats().TCP.EstablishedTimedout.Increment()
-		return tcpip.ErrTimeout
-	}
-
-	// RFC1122 4.2.3.6: TCP keepalive is a dataless ACK with
-	// seg.seq = snd.nxt-1.
-	e.keepalive.unacked++
-	e.keepalive.Unlock()
-	e.snd.sendSegmentFromView(buffer.VectorisedView{}, header.TCPFlagAck, e.snd.sndNxt-1)
-	e.resetKeepaliveTimer(false)
-	return nil
-}
-
-// resetKeepaliveTimer restarts or stops the keepalive timer, depending on
-// whether it is enabled for this endpoint.
-func (e *endpoint) resetKeepaliveTimer(receivedData bool) {
-	e.keepalive.Lock()
-	if receivedData {
-		e.keepalive.unacked = 0
-	}
-	// Start the keepalive timer IFF it's enabled and there is no pending
-	// data to send.
-	if !e.SocketOptions().GetKeepAlive() || e.snd == nil || e.snd.sndUna != e.snd.sndNxt {
-		e.keepalive.timer.disable()
-		e.keepalive.Unlock()
-		return
-	}
-	if e.keepalive.unacked > 0 {
-		e.keepalive.timer.enable(e.keepalive.interval)
-	} else {
-		e.keepalive.timer.enable(e.keepalive.idle)
-	}
-	e.keepalive.Unlock()
-}
-
-// disableKeepaliveTimer stops the keepalive timer.
-func (e *endpoint) disableKeepaliveTimer() {
-	e.keepalive.Lock()
-	e.keepalive.timer.disable()
-	e.keepalive.Unlock()
-}
-
 // protocolMainLoop is the main loop of the TCP protocol. It runs in its own
 // goroutine and is responsible for sending segments and handling received
 // segments.
 func (e *endpoint) protocolMainLoop(handshake bool, wakerInitDone chan<- struct{}) *tcpip.Error {
 	e.mu.Lock()
-	var closeTimer *time.Timer
+	var closeTimer *timerWheelEntry
 	var closeWaker sleep.Waker
 
 	epilogue := func() {
 		// e.mu is expected to be hold upon entering this section.
 		if e.snd != nil {
 			e.snd.resendTimer.cleanup()
+			e.snd.corkTimer.cleanup()
 		}
 
 		if closeTimer != nil {
-			closeTimer.Stop()
+			closeTimer.stop()
 		}
 
 		e.completeWorkerLocked()
@@ -1381,6 +1464,9 @@ func (e *endpoint) protocolMainLoop(handshake bool, wakerInitDone chan<- struct{
 
 			e.setEndpointState(StateError)
 			e.hardError = err
+			if e.h.active {
+				e.notifyConnectProgress(tcpip.ConnectFailed, e.stack.Clock().Now().Sub(e.h.startTime), err)
+			}
 
 			e.workerCleanup = true
 			// Lock released below.
@@ -1442,6 +1528,10 @@ func (e *endpoint) protocolMainLoop(handshake bool, wakerInitDone chan<- struct{
 			w: &e.keepalive.waker,
 			f: e.keepaliveTimerExpired,
 		},
+		{
+			w: &e.snd.corkWaker,
+			f: e.snd.corkTimerExpired,
+		},
 		{
 			w: &e.notificationWaker,
 			f: func() *tcpip.Error {
@@ -1472,7 +1562,9 @@ func (e *endpoint) protocolMainLoop(handshake bool, wakerInitDone chan<- struct{
 					if e.EndpointState() == StateFinWait2 && e.closed {
 						// The socket has been closed and we are in FIN_WAIT2
 						// so start the FIN_WAIT2 timer.
-						closeTimer = time.AfterFunc(e.tcpLingerTimeout, closeWaker.Assert)
+						closeTimer = &timerWheelEntry{}
+						closeTimer.init(e.timerWheel, &closeWaker)
+						closeTimer.reset(e.tcpLingerTimeout)
 					}
 				}
 
@@ -1592,7 +1684,7 @@ loop:
 	if e.EndpointState() == StateTimeWait {
 		// Disable close timer as we now entering real TIME_WAIT.
 		if closeTimer != nil {
-			closeTimer.Stop()
+			closeTimer.stop()
 		}
 		// Mark the current sleeper done so as to free all associated
 		// wakers.
@@ -1705,8 +1797,10 @@ func (e *endpoint) doTimeWait() (twReuse func()) {
 
 	var timeWaitWaker sleep.Waker
 	s.AddWaker(&timeWaitWaker, timeWaitDone)
-	timeWaitTimer := time.AfterFunc(timeWaitDuration, timeWaitWaker.Assert)
-	defer timeWaitTimer.Stop()
+	var timeWaitTimer timerWheelEntry
+	timeWaitTimer.init(e.timerWheel, &timeWaitWaker)
+	timeWaitTimer.reset(timeWaitDuration)
+	defer timeWaitTimer.stop()
 
 	for {
 		e.mu.Unlock()
@@ -1719,7 +1813,7 @@ func (e *endpoint) doTimeWait() (twReuse func()) {
 				return reuseTW
 			}
 			if extendTimeWait {
-				timeWaitTimer.Reset(timeWaitDuration)
+				timeWaitTimer.reset(timeWaitDuration)
 			}
 		case notification:
 			n := e.fetchNotifications()
@@ -175,7 +175,7 @@ func (d *dispatcher) wait() {
 func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.TransportEndpointID, pkt *stack.PacketBuffer) {
 	ep := stackEP.(*endpoint)
 
-	s := newIncomingSegment(id, pkt)
+	s := newIncomingSegment(id, ep.stack.Clock(), pkt)
 	if !s.parse(pkt.RXTransportChecksumValidated) {
 		ep.stack.Stats().MalformedRcvdPackets.Increment()
 		ep.stack.Stats().TCP.InvalidSegmentsReceived.Increment()
@@ -188,6 +188,7 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 		ep.stack.Stats().MalformedRcvdPackets.Increment()
 		ep.stack.Stats().TCP.ChecksumErrors.Increment()
 		ep.stats.ReceiveErrors.ChecksumErrors.Increment()
+		recordEvent(ep.stack, stack.EventChecksumError, s, "bad segment checksum")
 		s.decRef()
 		return
 	}
@@ -196,6 +197,13 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 	ep.stats.SegmentsReceived.Increment()
 	if (s.flags & header.TCPFlagRst) != 0 {
 		ep.stack.Stats().TCP.ResetsReceived.Increment()
+		resetReceived(ep.stack, s)
+	}
+
+	if ep.belowMinTTL(pkt) {
+		ep.stack.Stats().TCP.MinTTLDrops.Increment()
+		s.decRef()
+		return
 	}
 
 	if !ep.enqueueSegment(s) {
@@ -222,14 +230,18 @@ func generateRandUint32() uint32 {
 }
 
 func (d *dispatcher) selectProcessor(id stack.TransportEndpointID) *processor {
+	return &d.processors[hashEndpointID(d.seed, id)%uint32(len(d.processors))]
+}
+
+// hashEndpointID returns the hash of id keyed by seed.
+func hashEndpointID(seed uint32, id stack.TransportEndpointID) uint32 {
 	var payload [4]byte
 	binary.LittleEndian.PutUint16(payload[0:], id.LocalPort)
 	binary.LittleEndian.PutUint16(payload[2:], id.RemotePort)
 
-	h := jenkins.Sum32(d.seed)
+	h := jenkins.Sum32(seed)
 	h.Write(payload[:])
 	h.Write([]byte(id.LocalAddress))
 	h.Write([]byte(id.RemoteAddress))
-
-	return &d.processors[h.Sum32()%uint32(len(d.processors))]
+	return h.Sum32()
 }
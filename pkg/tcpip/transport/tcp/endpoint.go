@@ -72,6 +72,11 @@ const (
 	// SegOverheadFactor is used to multiply the value provided by the
 	// user on a SetSockOpt for setting the socket send/receive buffer sizes.
 	SegOverheadFactor = 2
+
+	// memPressureWindowSegments is the number of segments the advertised
+	// receive window is clamped to while the protocol is under memory
+	// pressure. This mirrors Linux's tcp_clamp_window.
+	memPressureWindowSegments = 4
 )
 
 // connected returns true when s is one of the states representing an
@@ -276,6 +281,10 @@ type SendErrors struct {
 
 	// Timeouts is the number of times the RTO expired.
 	Timeouts tcpip.StatCounter
+
+	// ZeroSndWindowState is the number of times the peer advertised a zero
+	// receive window while we had data to send.
+	ZeroSndWindowState tcpip.StatCounter
 }
 
 // Stats holds statistics about the endpoint.
@@ -383,6 +392,10 @@ type endpoint struct {
 	waiterQueue *waiter.Queue `state:"wait"`
 	uniqueID    uint64
 
+	// timerWheel drives the endpoint's timers. It is the timer wheel of the
+	// protocol that created the endpoint.
+	timerWheel *timerWheel `state:"nosave"`
+
 	// hardError is meaningful only when state is stateError. It stores the
 	// error to be returned when read/write syscalls are called and the
 	// endpoint is in this state. hardError is protected by endpoint mu.
@@ -421,6 +434,13 @@ type endpoint struct {
 	// rcvMemUsed must be accessed atomically.
 	rcvMemUsed int32
 
+	// mem is the memory account shared by all TCP endpoints of the stack.
+	mem *stack.TransportMemory `state:"nosave"`
+
+	// memCharge tracks the receive and send buffer memory this endpoint has
+	// charged to mem.
+	memCharge memCharge
+
 	// mu protects all endpoint fields unless documented otherwise. mu must
 	// be acquired before interacting with the endpoint fields.
 	//
@@ -510,6 +530,11 @@ type endpoint struct {
 	// delay is a boolean (0 is false) and must be accessed atomically.
 	delay uint32
 
+	// autocork enables the coalescing of small writes made in quick
+	// succession while data is in flight. It is set from
+	// tcpip.TCPAutocorkingOption when the endpoint is created.
+	autocork bool
+
 	// scoreboard holds TCP SACK Scoreboard information for this endpoint.
 	scoreboard *SACKScoreboard
 
@@ -519,9 +544,23 @@ type endpoint struct {
 	segmentQueue segmentQueue `state:"wait"`
 
 	// synRcvdCount is the number of connections for this endpoint that are
-	// in SYN-RCVD state.
+	// in SYN-RCVD state. It is protected by acceptMu.
 	synRcvdCount int
 
+	// listenShards handle the segments received by a listening endpoint,
+	// distributed among them by the hash of their 4-tuple keyed by
+	// listenSeed. They are set up before the endpoint enters the listen
+	// state and not modified afterwards.
+	listenShards []*listenShard `state:"nosave"`
+	listenSeed   uint32         `state:"nosave"`
+
+	// listenShardsWG is used to wait for the listener shard goroutines to
+	// terminate.
+	listenShardsWG sync.WaitGroup `state:"nosave"`
+
+	// listenOpts holds the *listenOptions used by the listener shards.
+	listenOpts atomic.Value `state:"nosave"`
+
 	// userMSS if non-zero is the MSS value explicitly set by the user
 	// for this endpoint using the TCP_MAXSEG setsockopt.
 	userMSS uint16
@@ -548,6 +587,14 @@ type endpoint struct {
 	sndBufUsed    int
 	sndClosed     bool
 	sndBufInQueue seqnum.Size
+	// sndMemBlocked is set when a write was refused because the protocol
+	// ran out of memory, so that writers are woken when some is released.
+	sndMemBlocked bool
+	// sndMore is set when the data queued last was written with MSG_MORE.
+	sndMore bool
+	// sndPush is set when partial segments held back by TCP_CORK must be
+	// sent out.
+	sndPush       bool
 	sndQueue      segmentList `state:"wait"`
 	sndWaker      sleep.Waker `state:"manual"`
 	sndCloseWaker sleep.Waker `state:"manual"`
@@ -584,10 +631,20 @@ type endpoint struct {
 
 	// userTimeout if non-zero specifies a user specified timeout for
 	// a connection w/ pending data to send. A connection that has pending
-	// unacked data will be forcibily aborted if the timeout is reached
-	// without any data being acked.
+	// unacked data or keepalives will be forcibily aborted if the timeout
+	// is reached without any data being acked. See liveness.go for how it
+	// interacts with the other limits.
 	userTimeout time.Duration
 
+	// savedTime is the time at which the endpoint was saved. On restore,
+	// the time elapsed since then is discounted by the liveness checks, as
+	// the connection wasn't running.
+	savedTime time.Time `state:".(unixTime)"`
+
+	// connectObserver, if set, is notified of the progress of the
+	// connection attempt.
+	connectObserver tcpip.ConnectObserver `state:"nosave"`
+
 	// deferAccept if non-zero specifies a user specified time during
 	// which the final ACK of a handshake will be dropped provided the
 	// ACK is a bare ACK and carries no data. If the timeout is crossed then
@@ -601,7 +658,7 @@ type endpoint struct {
 	// to the acceptedChan below terminate before we close acceptedChan.
 	pendingAccepted sync.WaitGroup `state:"nosave"`
 
-	// acceptMu protects acceptedChan.
+	// acceptMu protects acceptedChan and synRcvdCount.
 	acceptMu sync.Mutex `state:"nosave"`
 
 	// acceptCond is a condition variable that can be used to block on when
@@ -618,8 +675,8 @@ type endpoint struct {
 	// full ( See: endpoint.deliverAccepted ).
 	acceptCond *sync.Cond `state:"nosave"`
 
-	// acceptedChan is used by a listening endpoint protocol goroutine to
-	// send newly accepted connections to the endpoint so that they can be
+	// acceptedChan is used by the listener shards of a listening endpoint
+	// to send newly accepted connections to the endpoint so that they can be
 	// read by Accept() calls.
 	acceptedChan chan *endpoint `state:".([]*endpoint)"`
 
@@ -686,6 +743,32 @@ func (e *endpoint) UniqueID() uint64 {
 	return e.uniqueID
 }
 
+// routeMSS returns the maximum possible MSS for r. It is derived from the MTU
+// of r, less the encapsulation overhead and bounded by the maximum set with
+// tcpip.TCPMSSClampOption. The overhead doesn't reduce the MSS below
+// header.TCPMinimumMSS.
+func routeMSS(r *stack.Route) int {
+	mss := int(r.MTU()) - header.TCPMinimumSize
+
+	var clamp tcpip.TCPMSSClampOption
+	if err := r.Stack().TransportProtocolOption(ProtocolNumber, &clamp); err != nil {
+		panic(fmt.Sprintf("unable to get MSS clamp from stack: %s", err))
+	}
+
+	floor := mss
+	if floor > header.TCPMinimumMSS {
+		floor = header.TCPMinimumMSS
+	}
+	mss -= int(clamp.Overhead)
+	if clamp.Max != 0 && mss > int(clamp.Max) {
+		mss = int(clamp.Max)
+	}
+	if mss < floor {
+		mss = floor
+	}
+	return mss
+}
+
 // calculateAdvertisedMSS calculates the MSS to advertise.
 //
 // If userMSS is non-zero and is not greater than the maximum possible MSS for
@@ -693,7 +776,7 @@ func (e *endpoint) UniqueID() uint64 {
 func calculateAdvertisedMSS(userMSS uint16, r *stack.Route) uint16 {
 	// The maximum possible MSS is dependent on the route.
 	// TODO(b/143359391): Respect TCP Min and Max size.
-	maxMSS := uint16(r.MTU() - header.TCPMinimumSize)
+	maxMSS := uint16(routeMSS(r))
 
 	if userMSS != 0 && userMSS < maxMSS {
 		return userMSS
@@ -825,7 +908,7 @@ func (e *endpoint) EndpointState() EndpointState {
 // setRecentTimestamp sets the recentTS field to the provided value.
 func (e *endpoint) setRecentTimestamp(recentTS uint32) {
 	e.recentTS = recentTS
-	e.recentTSTime = time.Now()
+	e.recentTSTime = e.stack.Clock().Now()
 }
 
 // recentTimestamp returns the value of the recentTS field.
@@ -833,23 +916,10 @@ func (e *endpoint) recentTimestamp() uint32 {
 	return e.recentTS
 }
 
-// keepalive is a synchronization wrapper used to appease stateify. See the
-// comment in endpoint, where it is used.
-//
-// +stateify savable
-type keepalive struct {
-	sync.Mutex `state:"nosave"`
-	idle       time.Duration
-	interval   time.Duration
-	count      int
-	unacked    int
-	timer      timer       `state:"nosave"`
-	waker      sleep.Waker `state:"nosave"`
-}
-
-func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
+func newEndpoint(s *stack.Stack, wheel *timerWheel, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
 	e := &endpoint{
-		stack: s,
+		stack:      s,
+		timerWheel: wheel,
 		EndpointInfo: EndpointInfo{
 			TransportEndpointInfo: stack.TransportEndpointInfo{
 				NetProto:   netProto,
@@ -874,6 +944,7 @@ func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQue
 	}
 	e.ops.InitHandler(e)
 	e.ops.SetMulticastLoop(true)
+	e.ops.SetMulticastAll(true)
 	e.ops.SetQuickAck(true)
 
 	var ss tcpip.TCPSendBufferSizeRangeOption
@@ -896,6 +967,11 @@ func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQue
 		e.rcvAutoParams.disabled = !bool(mrb)
 	}
 
+	var ac tcpip.TCPAutocorkingOption
+	if err := s.TransportProtocolOption(ProtocolNumber, &ac); err == nil {
+		e.autocork = bool(ac)
+	}
+
 	var de tcpip.TCPDelayEnabled
 	if err := s.TransportProtocolOption(ProtocolNumber, &de); err == nil && de {
 		e.ops.SetDelayOption(true)
@@ -918,7 +994,8 @@ func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQue
 	e.segmentQueue.ep = e
 	e.tsOffset = timeStampOffset()
 	e.acceptCond = sync.NewCond(&e.acceptMu)
-	e.keepalive.timer.init(&e.keepalive.waker)
+	e.keepalive.timer.init(e.timerWheel, &e.keepalive.waker)
+	e.mem = memoryFor(s)
 
 	return e
 }
@@ -955,7 +1032,7 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		// Determine if the endpoint is writable if requested.
 		if (mask & waiter.EventOut) != 0 {
 			e.sndBufMu.Lock()
-			if e.sndClosed || e.sndBufUsed < e.sndBufSize {
+			if e.sndClosed || (e.sndBufUsed < e.sndBufSize && !e.sndMemExhaustedLocked()) {
 				result |= waiter.EventOut
 			}
 			e.sndBufMu.Unlock()
@@ -1165,6 +1242,10 @@ func (e *endpoint) cleanupLocked() {
 		e.route = nil
 	}
 
+	// Segments may still be held in the receive and segment queues; their
+	// memory is no longer attributed to the protocol.
+	e.memCharge.detach(e.mem)
+
 	e.stack.CompleteTransportEndpointCleanup(e)
 	tcpip.DeleteDanglingEndpoint(e)
 }
@@ -1215,7 +1296,7 @@ func (e *endpoint) ModerateRecvBuf(copied int) {
 		e.rcvListMu.Unlock()
 		return
 	}
-	now := time.Now()
+	now := e.stack.Clock().Now()
 	if rtt := e.rcvAutoParams.rtt; rtt == 0 || now.Sub(e.rcvAutoParams.measureTime) < rtt {
 		e.rcvAutoParams.copied += copied
 		e.rcvListMu.Unlock()
@@ -1253,8 +1334,9 @@ func (e *endpoint) ModerateRecvBuf(copied int) {
 
 		// We do not adjust downwards as that can cause the receiver to
 		// reject valid data that might already be in flight as the
-		// acceptable window will shrink.
-		if rcvWnd > e.rcvBufSize {
+		// acceptable window will shrink. Nor do we grow the buffer while
+		// the protocol is under memory pressure.
+		if rcvWnd > e.rcvBufSize && !e.mem.UnderPressure() {
 			availBefore := wndFromSpace(e.receiveBufferAvailableLocked())
 			e.rcvBufSize = rcvWnd
 			availAfter := wndFromSpace(e.receiveBufferAvailableLocked())
@@ -1412,14 +1494,17 @@ func (e *endpoint) isEndpointWritableLocked() (int, *tcpip.Error) {
 	if avail <= 0 {
 		return 0, tcpip.ErrWouldBlock
 	}
+	if e.sndMemExhaustedLocked() {
+		e.sndMemBlocked = true
+		return 0, tcpip.ErrWouldBlock
+	}
 	return avail, nil
 }
 
 // Write writes data to the endpoint's peer.
 func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-chan struct{}, *tcpip.Error) {
 	// Linux completely ignores any address passed to sendto(2) for TCP sockets
-	// (without the MSG_FASTOPEN flag). Corking is unimplemented, so opts.More
-	// and opts.EndOfRecord are also ignored.
+	// (without the MSG_FASTOPEN flag). opts.EndOfRecord is also ignored.
 
 	e.LockUser()
 	e.sndBufMu.Lock()
@@ -1453,12 +1538,24 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 		return 0, nil, perr
 	}
 
+	// The memory allocated to hold the data is charged to the protocol.
+	// Payloaders may return data backed by a larger view, e.g. after a
+	// short read, so copy it to a view of its own for the charge to match
+	// the allocation.
+	if cap(v) != len(v) {
+		nv := buffer.NewView(len(v))
+		copy(nv, v)
+		v = nv
+	}
+
 	queueAndSend := func() (int64, <-chan struct{}, *tcpip.Error) {
 		// Add data to the send queue.
-		s := newOutgoingSegment(e.ID, v)
+		s := newOutgoingSegment(e.ID, e.stack.Clock(), v)
 		e.sndBufUsed += len(v)
+		e.memCharge.update(e.mem, len(v))
 		e.sndBufInQueue += seqnum.Size(len(v))
 		e.sndQueue.PushBack(s)
+		e.sndMore = opts.More
 		e.sndBufMu.Unlock()
 
 		// Do the work inline.
@@ -1495,10 +1592,8 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 	return queueAndSend()
 }
 
-// Peek reads data without consuming it from the endpoint.
-//
-// This method does not block if there is no data pending.
-func (e *endpoint) Peek(vec [][]byte) (int64, tcpip.ControlMessages, *tcpip.Error) {
+// Peek implements tcpip.Endpoint.Peek.
+func (e *endpoint) Peek(vec [][]byte, off int64, _ *tcpip.FullAddress) (int64, tcpip.ControlMessages, *tcpip.Error) {
 	e.LockUser()
 	defer e.UnlockUser()
 
@@ -1515,7 +1610,9 @@ func (e *endpoint) Peek(vec [][]byte) (int64, tcpip.ControlMessages, *tcpip.Erro
 	e.rcvListMu.Lock()
 	defer e.rcvListMu.Unlock()
 
-	if e.rcvBufUsed == 0 {
+	// There is nothing to peek at if all the data pending is before the
+	// offset.
+	if int64(e.rcvBufUsed) <= off {
 		if e.rcvClosed || !e.EndpointState().connected() {
 			e.stats.ReadErrors.ReadClosed.Increment()
 			return 0, tcpip.ControlMessages{}, tcpip.ErrClosedForReceive
@@ -1533,6 +1630,14 @@ func (e *endpoint) Peek(vec [][]byte) (int64, tcpip.ControlMessages, *tcpip.Erro
 		for i := s.viewToDeliver; i < len(views); i++ {
 			v := views[i]
 
+			// Skip the data before the offset.
+			if off >= int64(len(v)) {
+				off -= int64(len(v))
+				continue
+			}
+			v = v[off:]
+			off = 0
+
 			for len(v) > 0 {
 				if len(vec) == 0 {
 					return num, tcpip.ControlMessages{}, nil
@@ -1571,6 +1676,14 @@ func (e *endpoint) selectWindowLocked() (wnd seqnum.Size) {
 	if newWnd > wndFromUsedBytes {
 		newWnd = wndFromUsedBytes
 	}
+	// Under memory pressure, offer no more than a few segments so that the
+	// peer slows down until memory is released. This never retracts a window
+	// already advertised, see receiver.getSendParams.
+	if e.mem.UnderPressure() {
+		if maxWnd := memPressureWindowSegments * int(e.amss); maxWnd > 0 && newWnd > maxWnd {
+			newWnd = maxWnd
+		}
+	}
 	if newWnd < 0 {
 		newWnd = 0
 	}
@@ -1652,7 +1765,11 @@ func (e *endpoint) OnDelayOptionSet(v bool) {
 // OnCorkOptionSet implements tcpip.SocketOptionsHandler.OnCorkOptionSet.
 func (e *endpoint) OnCorkOptionSet(v bool) {
 	if !v {
-		// Handle the corked data.
+		// Push out the corked data, even if Nagle's algorithm would hold
+		// it back.
+		e.sndBufMu.Lock()
+		e.sndPush = true
+		e.sndBufMu.Unlock()
 		e.sndWaker.Assert()
 	}
 }
@@ -1674,6 +1791,7 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		// TODO(gvisor.dev/issue/995): ECN is not currently supported,
 		// ignore the bits for now.
 		e.sendTOS = uint8(v) & ^uint8(inetECNMask)
+		e.updateListenOptionsLocked()
 		e.UnlockUser()
 
 	case tcpip.IPv6TrafficClassOption:
@@ -1681,6 +1799,7 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		// TODO(gvisor.dev/issue/995): ECN is not currently supported,
 		// ignore the bits for now.
 		e.sendTOS = uint8(v) & ^uint8(inetECNMask)
+		e.updateListenOptionsLocked()
 		e.UnlockUser()
 
 	case tcpip.MaxSegOption:
@@ -1690,6 +1809,7 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		}
 		e.LockUser()
 		e.userMSS = uint16(userMSS)
+		e.updateListenOptionsLocked()
 		e.UnlockUser()
 		e.notifyProtocolGoroutine(notifyMSSChanged)
 
@@ -1700,15 +1820,16 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 			return tcpip.ErrNotSupported
 		}
 
-	case tcpip.ReceiveBufferSizeOption:
-		// Make sure the receive buffer size is within the min and max
-		// allowed.
+	case tcpip.ReceiveBufferSizeOption, tcpip.ReceiveBufferSizeForceOption:
+		// The size is capped at rs.Max before being scaled by
+		// SegOverheadFactor, and raised to rs.Min after.
+		// ReceiveBufferSizeForceOption skips the rs.Max clamp.
 		var rs tcpip.TCPReceiveBufferSizeRangeOption
 		if err := e.stack.TransportProtocolOption(ProtocolNumber, &rs); err != nil {
 			panic(fmt.Sprintf("e.stack.TransportProtocolOption(%d, %#v) = %s", ProtocolNumber, &rs, err))
 		}
 
-		if v > rs.Max {
+		if opt == tcpip.ReceiveBufferSizeOption && v > rs.Max {
 			v = rs.Max
 		}
 
@@ -1778,6 +1899,7 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 	case tcpip.TTLOption:
 		e.LockUser()
 		e.ttl = uint8(v)
+		e.updateListenOptionsLocked()
 		e.UnlockUser()
 
 	case tcpip.TCPSynCountOption:
@@ -1844,6 +1966,12 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) *tcpip.Error {
 	case *tcpip.TCPUserTimeoutOption:
 		e.LockUser()
 		e.userTimeout = time.Duration(*v)
+		e.updateListenOptionsLocked()
+		e.UnlockUser()
+
+	case *tcpip.ConnectObserverOption:
+		e.LockUser()
+		e.connectObserver = v.Observer
 		e.UnlockUser()
 
 	case *tcpip.CongestionControlOption:
@@ -1904,6 +2032,7 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) *tcpip.Error {
 			*v = tcpip.TCPDeferAcceptOption(MaxRTO)
 		}
 		e.deferAccept = time.Duration(*v)
+		e.updateListenOptionsLocked()
 		e.UnlockUser()
 
 	case *tcpip.SocketDetachFilterOption:
@@ -1970,9 +2099,46 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, *tcpip.Error) {
 		// it's the only one supported.
 		return tcpip.PMTUDiscoveryDont, nil
 
+	case tcpip.MTUOption:
+		e.LockUser()
+		defer e.UnlockUser()
+		if !e.EndpointState().connected() {
+			return -1, tcpip.ErrNotConnected
+		}
+		mtu := int(e.route.MTU())
+		e.sndBufMu.Lock()
+		if e.sndMTU < mtu {
+			mtu = e.sndMTU
+		}
+		e.sndBufMu.Unlock()
+		hdrLen := header.IPv6MinimumSize
+		if e.route.NetProto == header.IPv4ProtocolNumber {
+			hdrLen = header.IPv4MinimumSize
+		}
+		return mtu + hdrLen, nil
+
 	case tcpip.ReceiveQueueSizeOption:
 		return e.readyReceiveSize()
 
+	case tcpip.SendQueueSizeOption:
+		if e.EndpointState() == StateListen {
+			return 0, tcpip.ErrInvalidEndpointState
+		}
+		// Data is kept in the send buffer until it is acknowledged.
+		e.sndBufMu.Lock()
+		v := e.sndBufUsed
+		e.sndBufMu.Unlock()
+		return v, nil
+
+	case tcpip.SendQueueUnsentSizeOption:
+		if e.EndpointState() == StateListen {
+			return 0, tcpip.ErrInvalidEndpointState
+		}
+		e.LockUser()
+		v := e.unsentSize()
+		e.UnlockUser()
+		return v, nil
+
 	case tcpip.SendBufferSizeOption:
 		e.sndBufMu.Lock()
 		v := e.sndBufSize
@@ -2023,6 +2189,7 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) *tcpip.Error {
 		*o = tcpip.TCPInfoOption{}
 		e.LockUser()
 		snd := e.snd
+		listening := e.EndpointState() == StateListen
 		e.UnlockUser()
 		if snd != nil {
 			snd.rtt.Lock()
@@ -2030,6 +2197,17 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) *tcpip.Error {
 			o.RTTVar = snd.rtt.rttvar
 			snd.rtt.Unlock()
 		}
+		e.livenessInfo(o)
+		o.Retransmits = e.stats.SendErrors.Retransmits.Value()
+		o.SegmentsSent = e.stats.SegmentsSent.Value()
+		o.SegmentsReceived = e.stats.SegmentsReceived.Value()
+		if listening {
+			e.acceptMu.Lock()
+			o.AcceptQueueLen = len(e.acceptedChan)
+			o.SynQueueLen = e.synRcvdCount
+			o.Backlog = cap(e.acceptedChan)
+			e.acceptMu.Unlock()
+		}
 
 	case *tcpip.KeepaliveIdleOption:
 		e.keepalive.Lock()
@@ -2178,8 +2356,16 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, run bool) *tc
 		return tcpip.ErrInvalidEndpointState
 	}
 
+	// An endpoint bound to a device only connects through it.
+	if e.bindToDevice != 0 {
+		if nicID != 0 && nicID != e.bindToDevice {
+			return tcpip.ErrNoRoute
+		}
+		nicID = e.bindToDevice
+	}
+
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, e.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	r, err := e.stack.FindRouteInGroup(e.ops.GetNICGroup(), nicID, e.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
 	if err != nil {
 		return err
 	}
@@ -2207,12 +2393,13 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, run bool) *tc
 		// src IP to ensure that for a given tuple (srcIP, destIP,
 		// destPort) the offset used as a starting point is the same to
 		// ensure that we can cycle through the port space effectively.
+		id := make([]byte, 0, len(e.ID.LocalAddress)+len(e.ID.RemoteAddress)+2)
+		id = append(id, e.ID.LocalAddress...)
+		id = append(id, e.ID.RemoteAddress...)
+		id = append(id, 0, 0)
+		binary.LittleEndian.PutUint16(id[len(id)-2:], e.ID.RemotePort)
 		h := jenkins.Sum32(e.stack.Seed())
-		h.Write([]byte(e.ID.LocalAddress))
-		h.Write([]byte(e.ID.RemoteAddress))
-		portBuf := make([]byte, 2)
-		binary.LittleEndian.PutUint16(portBuf, e.ID.RemotePort)
-		h.Write(portBuf)
+		h.Write(id)
 		portOffset := h.Sum32()
 
 		var twReuse tcpip.TCPTimeWaitReuseOption
@@ -2230,7 +2417,7 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, run bool) *tc
 			}
 		}
 
-		if _, err := e.stack.PickEphemeralPortStable(portOffset, func(p uint16) (bool, *tcpip.Error) {
+		if _, err := e.stack.PickEphemeralPortStable(portOffset, id, func(p uint16) (bool, *tcpip.Error) {
 			if sameAddr && p == e.ID.RemotePort {
 				return false, nil
 			}
@@ -2260,7 +2447,7 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, run bool) *tc
 				// If the endpoint is not in TIME-WAIT or if it is in TIME-WAIT but
 				// less than 1 second has elapsed since its recentTS was updated then
 				// we cannot reuse the port.
-				if tcpEP.EndpointState() != StateTimeWait || time.Since(tcpEP.recentTSTime) < 1*time.Second {
+				if tcpEP.EndpointState() != StateTimeWait || tcpEP.stack.Clock().Now().Sub(tcpEP.recentTSTime) < 1*time.Second {
 					tcpEP.UnlockUser()
 					return false, nil
 				}
@@ -2347,11 +2534,13 @@ func (e *endpoint) startMainLoop(handshake bool) *tcpip.Error {
 
 				e.setEndpointState(StateError)
 				e.hardError = err
+				e.notifyConnectProgress(tcpip.ConnectFailed, 0, err)
 
 				// Call cleanupLocked to free up any reservations.
 				e.cleanupLocked()
 				return err
 			}
+			e.notifyConnectProgress(tcpip.ConnectSYNSent, 0, nil)
 		}
 		e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
 		return nil
@@ -2437,7 +2626,7 @@ func (e *endpoint) shutdownLocked(flags tcpip.ShutdownFlags) *tcpip.Error {
 			}
 
 			// Queue fin segment.
-			s := newOutgoingSegment(e.ID, nil)
+			s := newOutgoingSegment(e.ID, e.stack.Clock(), nil)
 			e.sndQueue.PushBack(s)
 			e.sndBufInQueue++
 			// Mark endpoint as closed.
@@ -2532,13 +2721,29 @@ func (e *endpoint) listen(backlog int) *tcpip.Error {
 		return tcpip.ErrInvalidEndpointState
 	}
 
+	// The endpoint may have been bound without a port with
+	// IP_BIND_ADDRESS_NO_PORT, in which case it listens on an ephemeral
+	// port.
+	if !e.isPortReserved {
+		if err := e.reservePortLocked(e.boundNICID, e.effectiveNetProtos, 0); err != nil {
+			return err
+		}
+	}
+
+	// Set up the listener shards before entering the listen state and
+	// registering the endpoint, as segments received by a listening
+	// endpoint are queued to its shards.
+	e.newListenShardsLocked(seqnum.Size(e.receiveBufferAvailable()))
+	e.updateListenOptionsLocked()
+	e.setEndpointState(StateListen)
+
 	// Register the endpoint.
 	if err := e.stack.RegisterTransportEndpoint(e.boundNICID, e.effectiveNetProtos, ProtocolNumber, e.ID, e, e.boundPortFlags, e.boundBindToDevice); err != nil {
+		e.setEndpointState(StateBound)
 		return err
 	}
 
 	e.isRegistered = true
-	e.setEndpointState(StateListen)
 
 	// The channel may be non-nil when we're restoring the endpoint, and it
 	// may be pre-populated with some previously accepted (but not Accepted)
@@ -2550,8 +2755,8 @@ func (e *endpoint) listen(backlog int) *tcpip.Error {
 	e.acceptMu.Unlock()
 
 	e.workerRunning = true
-	go e.protocolListenLoop( // S/R-SAFE: drained on save.
-		seqnum.Size(e.receiveBufferAvailable()))
+	e.startListenShards()
+	go e.protocolListenLoop() // S/R-SAFE: drained on save.
 	return nil
 }
 
@@ -2634,16 +2839,50 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) (err *tcpip.Error) {
 
 	var nic tcpip.NICID
 	// If an address is specified, we must ensure that it's one of our
-	// local addresses.
+	// local addresses, unless IP_FREEBIND allows binding to addresses
+	// which are not assigned yet.
 	if len(addr.Addr) != 0 {
 		nic = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nic == 0 {
-			return tcpip.ErrBadLocalAddress
+			if !e.ops.GetFreeBind() {
+				return tcpip.ErrBadLocalAddress
+			}
+			nic = addr.NIC
 		}
 		e.ID.LocalAddress = addr.Addr
 	}
 
-	port, err := e.stack.ReservePort(netProtos, ProtocolNumber, addr.Addr, addr.Port, e.portFlags, e.bindToDevice, tcpip.FullAddress{}, func(p uint16) bool {
+	// With IP_BIND_ADDRESS_NO_PORT, binding to port 0 only records the
+	// address, and the port is picked when the endpoint connects, which
+	// allows endpoints bound to the same address to share ephemeral ports
+	// as long as they connect to different destinations.
+	if addr.Port == 0 && e.ops.GetBindAddressNoPort() {
+		e.boundNICID = nic
+		e.effectiveNetProtos = netProtos
+		e.setEndpointState(StateBound)
+		return nil
+	}
+
+	if err := e.reservePortLocked(nic, netProtos, addr.Port); err != nil {
+		return err
+	}
+
+	// TODO(gvisor.dev/issue/3691): Add test to verify boundNICID is correct.
+	e.boundNICID = nic
+	e.effectiveNetProtos = netProtos
+
+	// Mark endpoint as bound.
+	e.setEndpointState(StateBound)
+
+	return nil
+}
+
+// reservePortLocked reserves port, or an ephemeral port if it is 0, for the
+// local address of the endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) reservePortLocked(nic tcpip.NICID, netProtos []tcpip.NetworkProtocolNumber, port uint16) *tcpip.Error {
+	port, err := e.stack.ReservePort(netProtos, ProtocolNumber, e.ID.LocalAddress, port, e.portFlags, e.bindToDevice, tcpip.FullAddress{}, func(p uint16) bool {
 		id := e.ID
 		id.LocalPort = p
 		// CheckRegisterTransportEndpoint should only return an error if there is a
@@ -2665,15 +2904,8 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) (err *tcpip.Error) {
 
 	e.boundBindToDevice = e.bindToDevice
 	e.boundPortFlags = e.portFlags
-	// TODO(gvisor.dev/issue/3691): Add test to verify boundNICID is correct.
-	e.boundNICID = nic
 	e.isPortReserved = true
-	e.effectiveNetProtos = netProtos
 	e.ID.LocalPort = port
-
-	// Mark endpoint as bound.
-	e.setEndpointState(StateBound)
-
 	return nil
 }
 
@@ -2717,16 +2949,40 @@ func (*endpoint) HandlePacket(stack.TransportEndpointID, *stack.PacketBuffer) {
 }
 
 func (e *endpoint) enqueueSegment(s *segment) bool {
-	// Send packet to worker goroutine.
-	if !e.segmentQueue.enqueue(s) {
+	// Send packet to worker goroutine, or to the listener shard of the
+	// connection if the endpoint is listening.
+	q := &e.segmentQueue
+	var sh *listenShard
+	if e.EndpointState() == StateListen {
+		sh = e.listenShardFor(s.id)
+		q = &sh.segmentQueue
+	}
+	if !q.enqueue(s) {
 		// The queue is full, so we drop the segment.
 		e.stack.Stats().DroppedPackets.Increment()
 		e.stats.ReceiveErrors.SegmentQueueDropped.Increment()
 		return false
 	}
+	if sh != nil {
+		sh.newSegmentWaker.Assert()
+	}
 	return true
 }
 
+// belowMinTTL returns true if pkt must be dropped because its TTL, or hop
+// limit, is lower than the minimum set with IP_MINTTL or IPV6_MINHOPCOUNT, as
+// used by the Generalized TTL Security Mechanism (RFC 5082).
+func (e *endpoint) belowMinTTL(pkt *stack.PacketBuffer) bool {
+	var min uint8
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		min = e.ops.GetMinTTL()
+	case header.IPv6ProtocolNumber:
+		min = e.ops.GetMinHopCount()
+	}
+	return min != 0 && pkt.TTL() < min
+}
+
 // HandleControlPacket implements stack.TransportEndpoint.HandleControlPacket.
 func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.ControlType, extra uint32, pkt *stack.PacketBuffer) {
 	switch typ {
@@ -2746,7 +3002,7 @@ func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.C
 		e.lastErrorMu.Unlock()
 		e.notifyProtocolGoroutine(notifyError)
 
-	case stack.ControlNetworkUnreachable:
+	case stack.ControlNetworkUnreachable, stack.ControlNICRemoved:
 		e.lastErrorMu.Lock()
 		e.lastError = tcpip.ErrNetworkUnreachable
 		e.lastErrorMu.Unlock()
@@ -2754,16 +3010,45 @@ func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.C
 	}
 }
 
+// unsentSize returns the number of bytes which were written to the endpoint
+// but not sent yet.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) unsentSize() int {
+	v := 0
+	if s := e.snd; s != nil {
+		for seg := s.writeNext; seg != nil; seg = seg.Next() {
+			// Segments before sndNxt are only being retransmitted.
+			if s.isAssignedSequenceNumber(seg) && seg.sequenceNumber.LessThan(s.sndNxt) {
+				continue
+			}
+			v += seg.data.Size()
+		}
+	}
+
+	e.sndBufMu.Lock()
+	for seg := e.sndQueue.Front(); seg != nil; seg = seg.Next() {
+		v += seg.data.Size()
+	}
+	e.sndBufMu.Unlock()
+	return v
+}
+
 // updateSndBufferUsage is called by the protocol goroutine when room opens up
 // in the send buffer. The number of newly available bytes is v.
 func (e *endpoint) updateSndBufferUsage(v int) {
 	e.sndBufMu.Lock()
 	notify := e.sndBufUsed >= e.sndBufSize>>1
 	e.sndBufUsed -= v
+	e.memCharge.update(e.mem, -v)
 	// We only notify when there is half the sndBufSize available after
 	// a full buffer event occurs. This ensures that we don't wake up
 	// writers to queue just 1-2 segments and go back to sleep.
 	notify = notify && e.sndBufUsed < e.sndBufSize>>1
+	// Writers turned away because the protocol ran out of memory are woken
+	// whenever some is returned, as the send buffer may be nearly empty.
+	notify = notify || e.sndMemBlocked
+	e.sndMemBlocked = false
 	e.sndBufMu.Unlock()
 
 	if notify {
@@ -2838,6 +3123,62 @@ func (e *endpoint) updateReceiveMemUsed(delta int) {
 	atomic.AddInt32(&e.rcvMemUsed, int32(delta))
 }
 
+// sndMemExhaustedLocked returns true if no more data may be queued for
+// sending because the protocol's memory limit has been reached. An endpoint
+// with an empty send buffer is always allowed to queue data so that it can
+// make progress.
+//
+// Precondition: e.sndBufMu must be held.
+func (e *endpoint) sndMemExhaustedLocked() bool {
+	return e.sndBufUsed > 0 && e.mem.OverLimit()
+}
+
+// memCharge tracks the number of bytes an endpoint has charged to its
+// protocol's stack.TransportMemory, so that they can all be returned when the
+// endpoint is torn down even if it still holds segments.
+//
+// +stateify savable
+type memCharge struct {
+	// charged is the number of bytes currently charged, or -1 once the
+	// endpoint has been detached from the account. It must be accessed
+	// atomically.
+	charged int64
+}
+
+// update charges delta more bytes to m, unless c has been detached.
+func (c *memCharge) update(m *stack.TransportMemory, delta int) {
+	for {
+		charged := atomic.LoadInt64(&c.charged)
+		if charged < 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&c.charged, charged, charged+int64(delta)) {
+			break
+		}
+	}
+	if delta > 0 {
+		m.Charge(delta)
+	} else {
+		m.Release(-delta)
+	}
+}
+
+// detach returns everything charged through c to m. Subsequent updates are
+// not charged.
+func (c *memCharge) detach(m *stack.TransportMemory) {
+	if charged := atomic.SwapInt64(&c.charged, -1); charged > 0 {
+		m.Release(int(charged))
+	}
+}
+
+// restore re-charges m with what c had charged at save time, as accounts are
+// not saved.
+func (c *memCharge) restore(m *stack.TransportMemory) {
+	if charged := atomic.LoadInt64(&c.charged); charged > 0 {
+		m.Charge(int(charged))
+	}
+}
+
 // maxReceiveBufferSize returns the stack wide maximum receive buffer size for
 // an endpoint.
 func (e *endpoint) maxReceiveBufferSize() int {
@@ -2888,7 +3229,7 @@ func (e *endpoint) maybeEnableTimestamp(synOpts *header.TCPSynOptions) {
 // timestamp returns the timestamp value to be used in the TSVal field of the
 // timestamp option for outgoing TCP segments for a given endpoint.
 func (e *endpoint) timestamp() uint32 {
-	return tcpTimeStamp(time.Now(), e.tsOffset)
+	return tcpTimeStamp(e.stack.Clock().Now(), e.tsOffset)
 }
 
 // tcpTimeStamp returns a timestamp offset by the provided offset. This is
@@ -2946,7 +3287,7 @@ func (e *endpoint) maxOptionSize() (size int) {
 // there are intervening syscalls when the state is being copied.
 func (e *endpoint) completeState() stack.TCPEndpointState {
 	var s stack.TCPEndpointState
-	s.SegTime = time.Now()
+	s.SegTime = e.stack.Clock().Now()
 
 	// Copy EndpointID.
 	s.ID = stack.TCPEndpointID(e.ID)
@@ -3029,7 +3370,7 @@ func (e *endpoint) completeState() stack.TCPEndpointState {
 			WMax:                    cubic.wMax,
 			WLastMax:                cubic.wLastMax,
 			T:                       cubic.t,
-			TimeSinceLastCongestion: time.Since(cubic.t),
+			TimeSinceLastCongestion: e.stack.Clock().Now().Sub(cubic.t),
 			C:                       cubic.c,
 			K:                       cubic.k,
 			Beta:                    cubic.beta,
@@ -3064,16 +3405,37 @@ func (e *endpoint) initHardwareGSO() {
 	}
 	gso.NeedsCsum = true
 	gso.CsumOffset = header.TCPChecksumOffset
-	gso.MaxSize = e.route.GSOMaxSize()
+	gso.MaxSize = e.gsoMaxSize()
 	e.gso = gso
 }
 
+// gsoMaxSize returns the largest TCP segment that may be handed to the route
+// for segmentation offload. The route's limit is capped so that the segment
+// and its network header still fit in the 16-bit length field of the IP
+// header, which may otherwise be exceeded by links with a 64k MTU.
+func (e *endpoint) gsoMaxSize() uint32 {
+	maxSize := e.route.GSOMaxSize()
+	var limit uint32
+	switch e.route.NetProto {
+	case header.IPv4ProtocolNumber:
+		limit = math.MaxUint16 - header.IPv4MaximumHeaderSize
+	case header.IPv6ProtocolNumber:
+		limit = header.IPv6MaximumPayloadSize
+	default:
+		return maxSize
+	}
+	if maxSize > limit {
+		maxSize = limit
+	}
+	return maxSize
+}
+
 func (e *endpoint) initGSO() {
 	if e.route.HasHardwareGSOCapability() {
 		e.initHardwareGSO()
 	} else if e.route.HasSoftwareGSOCapability() {
 		e.gso = &stack.GSO{
-			MaxSize:   e.route.GSOMaxSize(),
+			MaxSize:   e.gsoMaxSize(),
 			Type:      stack.GSOSW,
 			NeedsCsum: false,
 		}
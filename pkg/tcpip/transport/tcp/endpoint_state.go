@@ -49,6 +49,7 @@ func (e *endpoint) beforeSave() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.savedTime = e.stack.Clock().Now()
 	epState := e.EndpointState()
 	switch {
 	case epState == StateInitial || epState == StateBound:
@@ -69,6 +70,9 @@ func (e *endpoint) beforeSave() {
 		}
 		fallthrough
 	case epState == StateListen || epState == StateConnecting:
+		for _, sh := range e.listenShards {
+			sh.segmentQueue.freeze()
+		}
 		e.drainSegmentLocked()
 		// Refresh epState, since drainSegmentLocked may have changed it.
 		epState = e.EndpointState()
@@ -163,6 +167,12 @@ func (e *endpoint) loadState(epState EndpointState) {
 	atomic.StoreUint32((*uint32)(&e.state), uint32(epState))
 }
 
+// restoredTimerWheel returns the timer wheel for the timers of restored
+// endpoints, which do not hold a reference to the protocol that created them.
+func restoredTimerWheel() *timerWheel {
+	return &stack.StackFromEnv.TransportProtocolInstance(ProtocolNumber).(*protocol).timerWheel
+}
+
 // afterLoad is invoked by stateify.
 func (e *endpoint) afterLoad() {
 	e.origEndpointState = e.state
@@ -172,7 +182,10 @@ func (e *endpoint) afterLoad() {
 	// Condition variables and mutexs are not S/R'ed so reinitialize
 	// acceptCond with e.acceptMu.
 	e.acceptCond = sync.NewCond(&e.acceptMu)
-	e.keepalive.timer.init(&e.keepalive.waker)
+	e.timerWheel = restoredTimerWheel()
+	e.keepalive.timer.init(e.timerWheel, &e.keepalive.waker)
+	e.mem = memoryFor(stack.StackFromEnv)
+	e.memCharge.restore(e.mem)
 	stack.StackFromEnv.RegisterRestoredEndpoint(e)
 }
 
@@ -225,14 +238,12 @@ func (e *endpoint) Resume(s *stack.Stack) {
 				e.connectingAddress = "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\xff" + e.ID.RemoteAddress
 			}
 		}
-		// Reset the scoreboard to reinitialize the sack information as
-		// we do not restore SACK information.
-		e.scoreboard.Reset()
 		if err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.ID.RemotePort}, false, e.workerRunning); err != tcpip.ErrConnectStarted {
 			panic("endpoint connecting failed: " + err.String())
 		}
 		e.mu.Lock()
 		e.state = e.origEndpointState
+		e.restoreTimersLocked()
 		closed := e.closed
 		e.mu.Unlock()
 		e.notifyProtocolGoroutine(notifyTickleWorker)
@@ -292,6 +303,25 @@ func (e *endpoint) Resume(s *stack.Stack) {
 	}
 }
 
+// restoreTimersLocked rearms the timers of a restored connected endpoint.
+// Timers are not saved, so without this, data in flight at save time would
+// only be recovered if the peer retransmitted or acknowledged it.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) restoreTimersLocked() {
+	if e.snd == nil {
+		return
+	}
+	e.discountPausedTimeLocked(e.stack.Clock().Now().Sub(e.savedTime))
+	switch {
+	case e.snd.sndUna != e.snd.sndNxt:
+		e.snd.resendTimer.enable(e.snd.rto)
+	case e.snd.writeNext != nil && e.snd.sndWnd == 0:
+		e.snd.enableZeroWindowProbing()
+	}
+	e.resetKeepaliveTimer(false /* receivedData */)
+}
+
 // saveLastError is invoked by stateify.
 func (e *endpoint) saveLastError() string {
 	if e.lastError == nil {
@@ -320,6 +350,16 @@ func (e *endpoint) loadRecentTSTime(unix unixTime) {
 	e.recentTSTime = time.Unix(unix.second, unix.nano)
 }
 
+// saveSavedTime is invoked by stateify.
+func (e *endpoint) saveSavedTime() unixTime {
+	return unixTime{e.savedTime.Unix(), e.savedTime.UnixNano()}
+}
+
+// loadSavedTime is invoked by stateify.
+func (e *endpoint) loadSavedTime(unix unixTime) {
+	e.savedTime = time.Unix(unix.second, unix.nano)
+}
+
 // saveHardError is invoked by stateify.
 func (e *endpoint) saveHardError() string {
 	if e.hardError == nil {
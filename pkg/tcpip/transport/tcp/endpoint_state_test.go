@@ -0,0 +1,161 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// newEstablishedEndpoint returns an endpoint connected over loopback.
+func newEstablishedEndpoint(t *testing.T) *endpoint {
+	t.Helper()
+
+	const (
+		nicID = 1
+		port  = 1234
+	)
+	addr := tcpip.Address("\x7f\x00\x00\x01")
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{NewProtocol},
+	})
+	t.Cleanup(s.Close)
+	if err := s.CreateNIC(nicID, loopback.New()); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, addr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, addr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: addr.WithPrefix().Subnet(), NIC: nicID}})
+
+	var listenerWQ waiter.Queue
+	listener, err := s.NewEndpoint(ProtocolNumber, ipv4.ProtocolNumber, &listenerWQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint(%d, %d, _): %s", ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	t.Cleanup(listener.Close)
+	if err := listener.Bind(tcpip.FullAddress{Addr: addr, Port: port}); err != nil {
+		t.Fatalf("listener.Bind(_): %s", err)
+	}
+	if err := listener.Listen(1); err != nil {
+		t.Fatalf("listener.Listen(1): %s", err)
+	}
+
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint(%d, %d, _): %s", ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	t.Cleanup(ep.Close)
+	waitEntry, notifyCh := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&waitEntry, waiter.EventOut)
+	defer wq.EventUnregister(&waitEntry)
+	if err := ep.Connect(tcpip.FullAddress{Addr: addr, Port: port}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("ep.Connect(_): %s", err)
+	}
+	select {
+	case <-notifyCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be established")
+	}
+	if err := ep.LastError(); err != nil {
+		t.Fatalf("ep.LastError(): %s", err)
+	}
+
+	e := ep.(*endpoint)
+	if got := e.EndpointState(); got != StateEstablished {
+		t.Fatalf("got e.EndpointState() = %s, want = %s", got, StateEstablished)
+	}
+	return e
+}
+
+func TestRestoreTimers(t *testing.T) {
+	e := newEstablishedEndpoint(t)
+	e.SocketOptions().SetKeepAlive(true)
+
+	tests := []struct {
+		name string
+		// setup puts the sender in the state it was saved in, and returns
+		// a function reverting it.
+		setup             func() func()
+		wantResend        bool
+		wantZeroWndProbes bool
+		wantKeepalive     bool
+	}{
+		{
+			name:          "idle",
+			setup:         func() func() { return func() {} },
+			wantKeepalive: true,
+		},
+		{
+			name: "data in flight",
+			setup: func() func() {
+				e.snd.sndNxt++
+				return func() { e.snd.sndNxt-- }
+			},
+			wantResend: true,
+		},
+		{
+			name: "zero window",
+			setup: func() func() {
+				writeNext, sndWnd := e.snd.writeNext, e.snd.sndWnd
+				e.snd.writeNext = &segment{}
+				e.snd.sndWnd = 0
+				return func() {
+					e.snd.disableZeroWindowProbing()
+					e.snd.writeNext, e.snd.sndWnd = writeNext, sndWnd
+				}
+			},
+			wantResend:        true,
+			wantZeroWndProbes: true,
+			wantKeepalive:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+
+			revert := test.setup()
+			defer func() {
+				revert()
+				e.snd.resendTimer.disable()
+				e.resetKeepaliveTimer(false /* receivedData */)
+			}()
+			// Timers aren't saved, so they are all disabled on restore.
+			e.snd.resendTimer.disable()
+			e.keepalive.timer.disable()
+
+			e.restoreTimersLocked()
+			if got := e.snd.resendTimer.enabled(); got != test.wantResend {
+				t.Errorf("got e.snd.resendTimer.enabled() = %t, want = %t", got, test.wantResend)
+			}
+			if got := e.snd.zeroWindowProbing; got != test.wantZeroWndProbes {
+				t.Errorf("got e.snd.zeroWindowProbing = %t, want = %t", got, test.wantZeroWndProbes)
+			}
+			if got := e.keepalive.timer.enabled(); got != test.wantKeepalive {
+				t.Errorf("got e.keepalive.timer.enabled() = %t, want = %t", got, test.wantKeepalive)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// This file decides when a connection whose peer stopped responding is
+// aborted. As on Linux, the limits take precedence as follows:
+//
+// - When a user timeout (TCP_USER_TIMEOUT) is set, it alone bounds how long
+//   retransmitted data and keepalive probes may remain unacknowledged; the
+//   retransmission limit (TCPMaxRetriesOption) and the keepalive probe count
+//   (TCP_KEEPCNT) are ignored.
+// - Otherwise, data is abandoned after too many retransmissions of a segment
+//   and keepalives after keepalive.count unacknowledged probes.
+// - Zero window probes are bounded by both the user timeout and the
+//   retransmission limit, as a peer which acknowledges them is alive.
+
+// keepalive is a synchronization wrapper used to appease stateify. See the
+// comment in endpoint, where it is used.
+//
+// +stateify savable
+type keepalive struct {
+	sync.Mutex `state:"nosave"`
+	idle       time.Duration
+	interval   time.Duration
+	count      int
+	unacked    int
+	timer      timer       `state:"nosave"`
+	waker      sleep.Waker `state:"nosave"`
+
+	// probesSent is the number of keepalive probes sent over the lifetime
+	// of the endpoint.
+	probesSent uint64
+}
+
+// keepalivesExhaustedLocked returns true if the connection must be aborted
+// instead of sending another keepalive probe.
+//
+// Precondition: e.keepalive must be locked.
+func (e *endpoint) keepalivesExhaustedLocked() bool {
+	if uto := e.userTimeout; uto != 0 {
+		return e.keepalive.unacked > 0 && e.stack.Clock().Now().Sub(e.rcv.lastRcvdAckTime) >= uto
+	}
+	return e.keepalive.unacked >= e.keepalive.count
+}
+
+// retransmitsExhausted returns true if the connection must be aborted instead
+// of retransmitting seg.
+func (s *sender) retransmitsExhausted(seg *segment) bool {
+	// RFC 1122 4.2.3.5: Close the connection when the number of
+	// retransmissions for this segment is beyond a limit.
+	return s.ep.userTimeout == 0 && seg != nil && seg.xmitCount > s.maxRetries
+}
+
+// keepaliveTimerExpired is called when the keepaliveTimer fires. We send TCP
+// keepalive packets periodically when the connection is idle. If we don't hear
+// from the other side after a number of tries, we terminate the connection.
+func (e *endpoint) keepaliveTimerExpired() *tcpip.Error {
+	e.keepalive.Lock()
+	if !e.SocketOptions().GetKeepAlive() || !e.keepalive.timer.checkExpiration() {
+		e.keepalive.Unlock()
+		return nil
+	}
+
+	if e.keepalivesExhaustedLocked() {
+		e.keepalive.Unlock()
+		e.stack.Stats().TCP.EstablishedTimedout.Increment()
+		return tcpip.ErrTimeout
+	}
+
+	// RFC1122 4.2.3.6: TCP keepalive is a dataless ACK with
+	// seg.seq = snd.nxt-1.
+	e.keepalive.unacked++
+	e.keepalive.probesSent++
+	e.keepalive.Unlock()
+	e.snd.sendSegmentFromView(buffer.VectorisedView{}, header.TCPFlagAck, e.snd.sndNxt-1)
+	e.resetKeepaliveTimer(false)
+	return nil
+}
+
+// resetKeepaliveTimer restarts or stops the keepalive timer, depending on
+// whether it is enabled for this endpoint.
+func (e *endpoint) resetKeepaliveTimer(receivedData bool) {
+	e.keepalive.Lock()
+	if receivedData {
+		e.keepalive.unacked = 0
+	}
+	// Start the keepalive timer IFF it's enabled and there is no pending
+	// data to send.
+	if !e.SocketOptions().GetKeepAlive() || e.snd == nil || e.snd.sndUna != e.snd.sndNxt {
+		e.keepalive.timer.disable()
+		e.keepalive.Unlock()
+		return
+	}
+	if e.keepalive.unacked > 0 {
+		e.keepalive.timer.enable(e.keepalive.interval)
+	} else {
+		e.keepalive.timer.enable(e.keepalive.idle)
+	}
+	e.keepalive.Unlock()
+}
+
+// disableKeepaliveTimer stops the keepalive timer.
+func (e *endpoint) disableKeepaliveTimer() {
+	e.keepalive.Lock()
+	e.keepalive.timer.disable()
+	e.keepalive.Unlock()
+}
+
+// TimersResumed implements stack.TimersResumedEndpoint.TimersResumed.
+func (e *endpoint) TimersResumed(paused time.Duration) {
+	e.LockUser()
+	e.discountPausedTimeLocked(paused)
+	e.UnlockUser()
+}
+
+// discountPausedTimeLocked moves the times from which the liveness of the peer
+// is measured forward by paused, during which the connection didn't run, so
+// that the peer isn't deemed unresponsive because of it. The times are not
+// moved past the current time.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) discountPausedTimeLocked(paused time.Duration) {
+	if paused <= 0 {
+		return
+	}
+	now := e.stack.Clock().Now()
+	discount := func(t *time.Time) {
+		if t.IsZero() {
+			return
+		}
+		if *t = t.Add(paused); t.After(now) {
+			*t = now
+		}
+	}
+	if e.rcv != nil {
+		discount(&e.rcv.lastRcvdAckTime)
+	}
+	if s := e.snd; s != nil {
+		discount(&s.firstRetransmittedSegXmitTime)
+		discount(&s.lastSendTime)
+		for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+			discount(&seg.xmitTime)
+		}
+	}
+}
+
+// livenessInfo fills the liveness counters of o.
+func (e *endpoint) livenessInfo(o *tcpip.TCPInfoOption) {
+	var zeroWindowProbes int
+	e.LockUser()
+	if e.snd != nil {
+		zeroWindowProbes = int(e.snd.unackZeroWindowProbes)
+	}
+	if e.rcv != nil {
+		o.LastAckRecv = e.stack.Clock().Now().Sub(e.rcv.lastRcvdAckTime)
+	}
+	e.UnlockUser()
+
+	e.keepalive.Lock()
+	o.KeepaliveProbesSent = e.keepalive.probesSent
+	o.Probes = e.keepalive.unacked
+	e.keepalive.Unlock()
+	if zeroWindowProbes > o.Probes {
+		o.Probes = zeroWindowProbes
+	}
+}
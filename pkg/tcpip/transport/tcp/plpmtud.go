@@ -0,0 +1,299 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// pmtudIPv4BaseMSS is the MSS that packetization layer path MTU
+	// discovery falls back to and searches up from on IPv4 connections. It
+	// is the value of net.ipv4.tcp_base_mss on Linux.
+	pmtudIPv4BaseMSS = 1024
+
+	// pmtudIPv6BaseMSS is the MSS that packetization layer path MTU
+	// discovery falls back to and searches up from on IPv6 connections.
+	// Every IPv6 link is required to carry packets of IPv6MinimumMTU bytes.
+	pmtudIPv6BaseMSS = header.IPv6MinimumMTU - header.IPv6MinimumSize - header.TCPMinimumSize
+
+	// pmtudProbeThreshold is the number of bytes below which the search
+	// range is considered converged, and probing stops.
+	pmtudProbeThreshold = 8
+
+	// pmtudRaiseInterval is the time after which a converged search is
+	// restarted, in case the path MTU has increased. See RFC 8899 section
+	// 5.1.1 PMTU_RAISE_TIMER.
+	pmtudRaiseInterval = 10 * time.Minute
+
+	// pmtudBlackHoleRetries is the number of retransmissions of a segment
+	// after which a path is suspected of dropping Packet Too Big messages.
+	// It mirrors net.ipv4.tcp_retries1 on Linux.
+	pmtudBlackHoleRetries = 3
+
+	// pmtudFloorMSS is the smallest MSS that black hole detection lowers
+	// the MSS to. It is the value of net.ipv4.tcp_mtu_probe_floor on Linux.
+	pmtudFloorMSS = 48
+)
+
+// pmtudState holds the state of packetization layer path MTU discovery, as
+// described in RFC 8899.
+//
+// The sender searches for the largest segment size that reaches the peer,
+// between a base MSS known to work and the MSS negotiated with the peer. Probes
+// are new data segments larger than the current MSS; a probe that is acked
+// raises the MSS to its size, while one that needs to be retransmitted lowers
+// the upper bound of the search. The search runs alongside Packet Too Big
+// messages, which directly lower the upper bound.
+//
+// +stateify savable
+type pmtudState struct {
+	// mode is the probing mode configured on the stack.
+	mode tcpip.TCPMTUProbingOption
+
+	// enabled is set once probing has been started, either from the start
+	// of the connection or after a black hole was detected.
+	enabled bool
+
+	// maxSize is the largest payload size the peer accepts.
+	maxSize int
+
+	// searchLow is the largest payload size known to reach the peer.
+	searchLow int
+
+	// searchHigh is the largest payload size that may reach the peer.
+	searchHigh int
+
+	// probing is set while a probe is outstanding.
+	probing bool
+
+	// probeSeq and probeSize are the sequence number and payload size of
+	// the outstanding probe.
+	probeSeq  seqnum.Value
+	probeSize int
+
+	// searchDone is the time at which the search last converged.
+	searchDone time.Time `state:".(unixTime)"`
+}
+
+// pmtudBaseMSS returns the payload size that probing starts from.
+func (s *sender) pmtudBaseMSS() int {
+	base := pmtudIPv4BaseMSS
+	if s.ep.route.NetProto == header.IPv6ProtocolNumber {
+		base = pmtudIPv6BaseMSS
+	}
+	base -= s.ep.maxOptionSize()
+	if base > s.pmtud.maxSize {
+		base = s.pmtud.maxSize
+	}
+	return base
+}
+
+// initPMTUD initializes path MTU discovery for the connection, once the MSS
+// has been negotiated.
+func (s *sender) initPMTUD(mode tcpip.TCPMTUProbingOption) {
+	s.pmtud.mode = mode
+	s.pmtud.maxSize = s.maxPayloadSize
+	if mode == tcpip.TCPMTUProbingAlways {
+		s.enablePMTUD()
+	}
+}
+
+// enablePMTUD starts probing, from the base MSS.
+//
+// Probing isn't done when GSO is in use, as segments are then larger than the
+// MSS and can't be told apart from probes.
+func (s *sender) enablePMTUD() {
+	if s.gso {
+		return
+	}
+	s.pmtud.enabled = true
+	s.pmtud.probing = false
+	s.pmtud.searchLow = s.pmtudBaseMSS()
+	s.pmtud.searchHigh = s.pmtud.maxSize
+	s.pmtud.searchDone = time.Time{}
+	s.setMaxPayloadSize(s.pmtud.searchLow)
+}
+
+// setMaxPayloadSize sets the maximum size of the payload of segments, which
+// may be larger than the current one.
+func (s *sender) setMaxPayloadSize(m int) {
+	s.maxPayloadSize = m
+	if s.gso {
+		s.ep.gso.MSS = uint16(m)
+	}
+	s.ep.scoreboard.smss = uint16(m)
+}
+
+// pmtudConverged returns true if the search range is too narrow to be worth
+// probing.
+func (s *sender) pmtudConverged() bool {
+	return s.pmtud.searchHigh-s.pmtud.searchLow < pmtudProbeThreshold
+}
+
+// maybeSendMTUProbe sends the segment at writeNext as a probe if one is due.
+// end is the right edge of the send window. It returns true if a probe was
+// sent.
+//
+// Probes carry new data, so a lost probe is recovered from by the usual
+// retransmission mechanisms, which split it to the current MSS.
+func (s *sender) maybeSendMTUProbe(end seqnum.Value) bool {
+	p := &s.pmtud
+	if !p.enabled || p.probing || s.gso || s.state != Open || s.fr.active || s.zeroWindowProbing {
+		return false
+	}
+	// A probe counts as two packets, as it is larger than the MSS.
+	if s.sndCwnd-s.outstanding < 2 {
+		return false
+	}
+	if s.pmtudConverged() {
+		if p.searchDone.IsZero() || s.ep.stack.Clock().Now().Sub(p.searchDone) < pmtudRaiseInterval || p.searchLow >= p.maxSize {
+			return false
+		}
+		p.searchHigh = p.maxSize
+		p.searchDone = time.Time{}
+	}
+
+	seg := s.writeNext
+	if seg == nil || s.isAssignedSequenceNumber(seg) || seg.data.Size() == 0 {
+		return false
+	}
+	size := (p.searchLow + p.searchHigh + 1) / 2
+	if int(s.sndNxt.Size(end)) < size {
+		return false
+	}
+
+	// Make sure enough data is queued before merging anything, so that
+	// segments aren't merged needlessly.
+	queued := 0
+	for n := seg; n != nil && n.data.Size() != 0 && queued < size; n = n.Next() {
+		queued += n.data.Size()
+	}
+	if queued < size {
+		return false
+	}
+	for seg.data.Size() < size {
+		seg.data.Append(seg.Next().data)
+		s.writeList.Remove(seg.Next())
+	}
+	s.splitSeg(seg, size)
+
+	// Flags are assigned after splitting, as in maybeSendSegment.
+	seg.sequenceNumber = s.sndNxt
+	seg.flags = header.TCPFlagAck | header.TCPFlagPsh
+	s.sendSegment(seg)
+	s.sndNxt = seg.sequenceNumber.Add(seqnum.Size(size))
+	s.outstanding += s.pCount(seg)
+	s.writeNext = seg.Next()
+
+	p.probing = true
+	p.probeSeq = seg.sequenceNumber
+	p.probeSize = size
+	return true
+}
+
+// pmtudAcked is called when new data is acknowledged. If the outstanding probe
+// was acknowledged, the MSS is raised to its size.
+func (s *sender) pmtudAcked() {
+	p := &s.pmtud
+	if !p.probing || s.sndUna.LessThan(p.probeSeq.Add(seqnum.Size(p.probeSize))) {
+		return
+	}
+	p.probing = false
+	p.searchLow = p.probeSize
+	s.setMaxPayloadSize(p.probeSize)
+	s.ep.stack.Stats().TCP.MTUProbeSuccesses.Increment()
+	if s.pmtudConverged() {
+		p.searchDone = s.ep.stack.Clock().Now()
+	}
+}
+
+// pmtudRetransmit is called when seg is retransmitted. If seg is part of the
+// outstanding probe, the probe is deemed lost.
+func (s *sender) pmtudRetransmit(seg *segment) {
+	p := &s.pmtud
+	if !p.probing || !seg.sequenceNumber.InWindow(p.probeSeq, seqnum.Size(p.probeSize)) {
+		return
+	}
+	p.probing = false
+	p.searchHigh = p.probeSize - 1
+	s.ep.stack.Stats().TCP.MTUProbeFailures.Increment()
+	if s.pmtudConverged() {
+		p.searchDone = s.ep.stack.Clock().Now()
+	}
+}
+
+// pmtudTimeout is called when the retransmit timer expires. Repeated timeouts
+// of full-sized segments suggest that the path drops large packets without
+// sending Packet Too Big messages, in which case probing is started, or
+// restarted from a lower MSS: the base MSS, or half the current MSS once the
+// base MSS was found not to get through either.
+//
+// Smaller segments aren't considered, as their loss can't be blamed on their
+// size.
+func (s *sender) pmtudTimeout() {
+	p := &s.pmtud
+	seg := s.writeList.Front()
+	if p.mode == tcpip.TCPMTUProbingDisabled || s.gso || seg == nil || seg.xmitCount <= pmtudBlackHoleRetries {
+		return
+	}
+	if seg.data.Size() < s.maxPayloadSize {
+		return
+	}
+	if !p.enabled && s.maxPayloadSize > s.pmtudBaseMSS() {
+		s.enablePMTUD()
+		s.ep.stack.Stats().TCP.MTUBlackHoles.Increment()
+		return
+	}
+	p.enabled = true
+	low := s.pmtudBaseMSS()
+	if s.maxPayloadSize <= low {
+		low = s.maxPayloadSize / 2
+		if low < pmtudFloorMSS {
+			low = pmtudFloorMSS
+		}
+	}
+	if s.maxPayloadSize <= low {
+		return
+	}
+	p.probing = false
+	p.searchLow = low
+	p.searchHigh = s.maxPayloadSize - 1
+	p.searchDone = time.Time{}
+	s.setMaxPayloadSize(low)
+	s.ep.stack.Stats().TCP.MTUBlackHoles.Increment()
+}
+
+// pmtudTooBig is called when a Packet Too Big message lowers the maximum
+// payload size to m.
+func (s *sender) pmtudTooBig(m int) {
+	p := &s.pmtud
+	if !p.enabled {
+		return
+	}
+	if p.searchHigh > m {
+		p.searchHigh = m
+	}
+	if p.searchLow > m {
+		p.searchLow = m
+	}
+	if p.probing && p.probeSize > m {
+		p.probing = false
+	}
+}
@@ -16,6 +16,7 @@
 package tcp
 
 import (
+	"fmt"
 	"runtime"
 	"strings"
 	"time"
@@ -132,11 +133,72 @@ func (s *synRcvdCounter) Threshold() uint64 {
 	return s.threshold
 }
 
+const (
+	// resetStormThreshold is the number of resets which, when received
+	// within resetStormWindow, are recorded as a reset storm.
+	resetStormThreshold = 100
+
+	// resetStormWindow is the period over which resets are counted to
+	// detect reset storms.
+	resetStormWindow = time.Second
+)
+
+// resetCounter counts the resets received by the stack, to detect reset
+// storms.
+type resetCounter struct {
+	mu sync.Mutex
+
+	// start is the monotonic time at which the current window started, and
+	// count is the number of resets received since.
+	start int64
+	count int
+}
+
+// received counts a reset received at the monotonic time now. It returns true
+// if the reset makes the count of resets received in the current window reach
+// resetStormThreshold.
+func (c *resetCounter) received(now int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now-c.start >= int64(resetStormWindow) {
+		c.start = now
+		c.count = 0
+	}
+	c.count++
+	return c.count == resetStormThreshold
+}
+
+// recordEvent records an anomaly detected in s in the event log of the stack.
+func recordEvent(st *stack.Stack, kind stack.EventKind, s *segment, detail string) {
+	st.RecordEvent(stack.Event{
+		Kind:     kind,
+		NICID:    s.nicID,
+		Protocol: uint32(ProtocolNumber),
+		Source: tcpip.FullAddress{
+			NIC:  s.nicID,
+			Addr: s.srcAddr,
+			Port: s.id.RemotePort,
+		},
+		Detail: detail,
+	})
+}
+
+// resetReceived is called when the reset s is received, whether or not it
+// matches an endpoint. It records a reset storm once resetStormThreshold
+// resets are received within resetStormWindow.
+func resetReceived(st *stack.Stack, s *segment) {
+	p := st.TransportProtocolInstance(ProtocolNumber).(*protocol)
+	if p.resets.received(st.Clock().NowMonotonic()) {
+		recordEvent(st, stack.EventResetStorm, s, fmt.Sprintf("%d resets received within %s", resetStormThreshold, resetStormWindow))
+	}
+}
+
 type protocol struct {
 	stack *stack.Stack
 
 	mu                         sync.RWMutex
 	sackEnabled                bool
+	abortOnOverflow            bool
 	recovery                   tcpip.TCPRecovery
 	delayEnabled               bool
 	sendBufferSize             tcpip.TCPSendBufferSizeRangeOption
@@ -144,6 +206,7 @@ type protocol struct {
 	congestionControl          string
 	availableCongestionControl []string
 	moderateReceiveBuffer      bool
+	autocorking                bool
 	lingerTimeout              time.Duration
 	timeWaitTimeout            time.Duration
 	timeWaitReuse              tcpip.TCPTimeWaitReuseOption
@@ -152,7 +215,24 @@ type protocol struct {
 	maxRetries                 uint32
 	synRcvdCount               synRcvdCounter
 	synRetries                 uint8
+	mtuProbing                 tcpip.TCPMTUProbingOption
+	mssClamp                   tcpip.TCPMSSClampOption
 	dispatcher                 dispatcher
+
+	// resets counts the resets received, to detect reset storms.
+	resets resetCounter
+
+	// timerWheel drives the timers of all endpoints of the stack.
+	timerWheel timerWheel
+
+	// mem accounts for the buffer memory of all endpoints of the stack. It
+	// may be shared with the protocols of other stacks.
+	mem *stack.TransportMemory
+}
+
+// memoryFor returns the memory account shared by the TCP endpoints of s.
+func memoryFor(s *stack.Stack) *stack.TransportMemory {
+	return s.TransportProtocolInstance(ProtocolNumber).(*protocol).mem
 }
 
 // Number returns the tcp protocol number.
@@ -162,7 +242,7 @@ func (*protocol) Number() tcpip.TransportProtocolNumber {
 
 // NewEndpoint creates a new tcp endpoint.
 func (p *protocol) NewEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
-	return newEndpoint(p.stack, netProto, waiterQueue), nil
+	return newEndpoint(p.stack, &p.timerWheel, netProto, waiterQueue), nil
 }
 
 // NewRawEndpoint creates a new raw TCP endpoint. Raw TCP sockets are currently
@@ -199,14 +279,20 @@ func (p *protocol) QueuePacket(ep stack.TransportEndpoint, id stack.TransportEnd
 // particular, SYNs addressed to a non-existent connection are rejected by this
 // means."
 func (p *protocol) HandleUnknownDestinationPacket(id stack.TransportEndpointID, pkt *stack.PacketBuffer) stack.UnknownDestinationPacketDisposition {
-	s := newIncomingSegment(id, pkt)
+	s := newIncomingSegment(id, p.stack.Clock(), pkt)
 	defer s.decRef()
 
-	if !s.parse(pkt.RXTransportChecksumValidated) || !s.csumValid {
+	if !s.parse(pkt.RXTransportChecksumValidated) {
+		return stack.UnknownDestinationPacketMalformed
+	}
+	if !s.csumValid {
+		recordEvent(p.stack, stack.EventChecksumError, s, "bad segment checksum")
 		return stack.UnknownDestinationPacketMalformed
 	}
 
-	if !s.flagIsSet(header.TCPFlagRst) {
+	if s.flagIsSet(header.TCPFlagRst) {
+		resetReceived(p.stack, s)
+	} else {
 		replyWithReset(p.stack, s, stack.DefaultTOS, 0)
 	}
 
@@ -270,6 +356,12 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) *tcpi
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPAbortOnOverflowOption:
+		p.mu.Lock()
+		p.abortOnOverflow = bool(*v)
+		p.mu.Unlock()
+		return nil
+
 	case *tcpip.TCPRecovery:
 		p.mu.Lock()
 		p.recovery = *v
@@ -319,6 +411,15 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) *tcpi
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPAutocorkingOption:
+		p.mu.Lock()
+		p.autocorking = bool(*v)
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.TransportMemoryLimitsOption:
+		return p.mem.SetLimits(*v)
+
 	case *tcpip.TCPLingerTimeoutOption:
 		p.mu.Lock()
 		if *v < 0 {
@@ -389,6 +490,24 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) *tcpi
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPMTUProbingOption:
+		if *v < tcpip.TCPMTUProbingDisabled || *v > tcpip.TCPMTUProbingAlways {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.mu.Lock()
+		p.mtuProbing = *v
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.TCPMSSClampOption:
+		if v.Max != 0 && v.Max < header.TCPMinimumMSS {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.mu.Lock()
+		p.mssClamp = *v
+		p.mu.Unlock()
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -403,6 +522,12 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) *tcpip.E
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPAbortOnOverflowOption:
+		p.mu.RLock()
+		*v = tcpip.TCPAbortOnOverflowOption(p.abortOnOverflow)
+		p.mu.RUnlock()
+		return nil
+
 	case *tcpip.TCPRecovery:
 		p.mu.RLock()
 		*v = tcpip.TCPRecovery(p.recovery)
@@ -445,6 +570,16 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) *tcpip.E
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPAutocorkingOption:
+		p.mu.RLock()
+		*v = tcpip.TCPAutocorkingOption(p.autocorking)
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.TransportMemoryLimitsOption:
+		*v = p.mem.Limits()
+		return nil
+
 	case *tcpip.TCPLingerTimeoutOption:
 		p.mu.RLock()
 		*v = tcpip.TCPLingerTimeoutOption(p.lingerTimeout)
@@ -493,6 +628,18 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) *tcpip.E
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPMTUProbingOption:
+		p.mu.RLock()
+		*v = p.mtuProbing
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.TCPMSSClampOption:
+		p.mu.RLock()
+		*v = p.mssClamp
+		p.mu.RUnlock()
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -501,6 +648,7 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) *tcpip.E
 // Close implements stack.TransportProtocol.Close.
 func (p *protocol) Close() {
 	p.dispatcher.close()
+	p.timerWheel.close()
 }
 
 // Wait implements stack.TransportProtocol.Wait.
@@ -521,6 +669,19 @@ func (*protocol) Parse(pkt *stack.PacketBuffer) bool {
 
 // NewProtocol returns a TCP transport protocol.
 func NewProtocol(s *stack.Stack) stack.TransportProtocol {
+	return newProtocol(s, &stack.TransportMemory{})
+}
+
+// NewProtocolWithMemory returns a factory for TCP transport protocols that
+// charge the buffer memory of their endpoints to mem, so that the memory used
+// by several stacks is accounted for and limited together.
+func NewProtocolWithMemory(mem *stack.TransportMemory) stack.TransportProtocolFactory {
+	return func(s *stack.Stack) stack.TransportProtocol {
+		return newProtocol(s, mem)
+	}
+}
+
+func newProtocol(s *stack.Stack, mem *stack.TransportMemory) stack.TransportProtocol {
 	p := protocol{
 		stack: s,
 		sendBufferSize: tcpip.TCPSendBufferSizeRangeOption{
@@ -544,7 +705,9 @@ func NewProtocol(s *stack.Stack) stack.TransportProtocol {
 		maxRTO:                     MaxRTO,
 		maxRetries:                 MaxRetries,
 		recovery:                   tcpip.TCPRACKLossDetection,
+		mem:                        mem,
 	}
 	p.dispatcher.init(runtime.GOMAXPROCS(0))
+	p.timerWheel.init(s.Clock())
 	return &p
 }
@@ -17,6 +17,7 @@ package tcp
 import (
 	"time"
 
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
 )
 
@@ -58,8 +59,8 @@ type rackControl struct {
 
 // update will update the RACK related fields when an ACK has been received.
 // See: https://tools.ietf.org/html/draft-ietf-tcpm-rack-08#section-7.2
-func (rc *rackControl) update(seg *segment, ackSeg *segment, offset uint32) {
-	rtt := time.Now().Sub(seg.xmitTime)
+func (rc *rackControl) update(clock tcpip.Clock, seg *segment, ackSeg *segment, offset uint32) {
+	rtt := clock.Now().Sub(seg.xmitTime)
 
 	// If the ACK is for a retransmitted packet, do not update if it is a
 	// spurious inference which is determined by below checks:
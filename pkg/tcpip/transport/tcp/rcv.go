@@ -50,11 +50,11 @@ type receiver struct {
 
 	closed bool
 
-	// pendingRcvdSegments is bounded by the receive buffer size of the
-	// endpoint.
+	// pendingRcvdSegments is the out-of-order queue. It is bounded by the
+	// receive buffer size of the endpoint, see queueOutOfOrder.
 	pendingRcvdSegments segmentHeap
-	// pendingBufUsed tracks the total number of bytes (including segment
-	// overhead) currently queued in pendingRcvdSegments.
+	// pendingBufUsed tracks the total number of bytes of memory (including
+	// segment overhead) held by the segments in pendingRcvdSegments.
 	pendingBufUsed int
 
 	// Time when the last ack was received.
@@ -69,7 +69,7 @@ func newReceiver(ep *endpoint, irs seqnum.Value, rcvWnd seqnum.Size, rcvWndScale
 		rcvWnd:          rcvWnd,
 		rcvWUP:          irs + 1,
 		rcvWndScale:     rcvWndScale,
-		lastRcvdAckTime: time.Now(),
+		lastRcvdAckTime: ep.stack.Clock().Now(),
 	}
 }
 
@@ -236,7 +236,7 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 		}
 
 		for i := first; i < len(r.pendingRcvdSegments); i++ {
-			r.pendingBufUsed -= r.pendingRcvdSegments[i].segMemSize()
+			r.pendingBufUsed -= r.pendingRcvdSegments[i].segAllocSize()
 			r.pendingRcvdSegments[i].decRef()
 
 			// Note that slice truncation does not allow garbage collection of
@@ -282,7 +282,7 @@ func (r *receiver) updateRTT() {
 	r.ep.rcvListMu.Lock()
 	if r.ep.rcvAutoParams.rttMeasureTime.IsZero() {
 		// New measurement.
-		r.ep.rcvAutoParams.rttMeasureTime = time.Now()
+		r.ep.rcvAutoParams.rttMeasureTime = r.ep.stack.Clock().Now()
 		r.ep.rcvAutoParams.rttMeasureSeqNumber = r.rcvNxt.Add(r.rcvWnd)
 		r.ep.rcvListMu.Unlock()
 		return
@@ -291,14 +291,14 @@ func (r *receiver) updateRTT() {
 		r.ep.rcvListMu.Unlock()
 		return
 	}
-	rtt := time.Since(r.ep.rcvAutoParams.rttMeasureTime)
+	rtt := r.ep.stack.Clock().Now().Sub(r.ep.rcvAutoParams.rttMeasureTime)
 	// We only store the minimum observed RTT here as this is only used in
 	// absence of a SRTT available from either timestamps or a sender
 	// measurement of RTT.
 	if r.ep.rcvAutoParams.rtt == 0 || rtt < r.ep.rcvAutoParams.rtt {
 		r.ep.rcvAutoParams.rtt = rtt
 	}
-	r.ep.rcvAutoParams.rttMeasureTime = time.Now()
+	r.ep.rcvAutoParams.rttMeasureTime = r.ep.stack.Clock().Now()
 	r.ep.rcvAutoParams.rttMeasureSeqNumber = r.rcvNxt.Add(r.rcvWnd)
 	r.ep.rcvListMu.Unlock()
 }
@@ -422,23 +422,12 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err *tcpip.Error) {
 	}
 
 	// Store the time of the last ack.
-	r.lastRcvdAckTime = time.Now()
+	r.lastRcvdAckTime = r.ep.stack.Clock().Now()
 
 	// Defer segment processing if it can't be consumed now.
 	if !r.consumeSegment(s, segSeq, segLen) {
 		if segLen > 0 || s.flagIsSet(header.TCPFlagFin) {
-			// We only store the segment if it's within our buffer size limit.
-			//
-			// Only use 75% of the receive buffer queue for out-of-order
-			// segments. This ensures that we always leave some space for the inorder
-			// segments to arrive allowing pending segments to be processed and
-			// delivered to the user.
-			if r.ep.receiveBufferAvailable() > 0 && r.pendingBufUsed < r.ep.receiveBufferSize()>>2 {
-				r.ep.rcvListMu.Lock()
-				r.pendingBufUsed += s.segMemSize()
-				r.ep.rcvListMu.Unlock()
-				s.incRef()
-				heap.Push(&r.pendingRcvdSegments, s)
+			if r.queueOutOfOrder(s) {
 				UpdateSACKBlocks(&r.ep.sack, segSeq, segSeq.Add(segLen), r.rcvNxt)
 			}
 
@@ -462,6 +451,8 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err *tcpip.Error) {
 		s := r.pendingRcvdSegments[0]
 		segLen := seqnum.Size(s.data.Size())
 		segSeq := s.sequenceNumber
+		// Account for the segment before consumeSegment trims it.
+		size := s.segAllocSize()
 
 		// Skip segment altogether if it has already been acknowledged.
 		if !segSeq.Add(segLen-1).LessThan(r.rcvNxt) &&
@@ -471,7 +462,7 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err *tcpip.Error) {
 
 		heap.Pop(&r.pendingRcvdSegments)
 		r.ep.rcvListMu.Lock()
-		r.pendingBufUsed -= s.segMemSize()
+		r.pendingBufUsed -= size
 		r.ep.rcvListMu.Unlock()
 		s.decRef()
 	}
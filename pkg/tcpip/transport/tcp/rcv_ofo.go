@@ -0,0 +1,186 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"container/heap"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+)
+
+// This file bounds the memory held by the out-of-order queue. Segments are
+// accounted for by the memory backing their data rather than its length, so
+// that a peer sending tiny segments, each holding on to a whole packet buffer,
+// can't make the queue grow past its limit. When the queue is full, it is
+// handled as on Linux:
+//
+// - The queued segments are collapsed: overlapping and contiguous segments are
+//   merged, and the data of every segment is copied into a buffer of its size.
+// - If that's not enough, the queued segments with the highest sequence
+//   numbers are dropped to make room for a segment filling an earlier hole,
+//   which is more useful to the reader. The dropped data is removed from the
+//   SACK blocks, as the peer must retransmit it.
+// - Otherwise, the segment is dropped.
+
+// outOfOrderQueueFull returns true if no more segments may be queued in the
+// out-of-order queue.
+//
+// Only a quarter of the receive buffer is used for out-of-order segments. This
+// ensures that we always leave some space for the in-order segments to arrive,
+// allowing pending segments to be processed and delivered to the user.
+func (r *receiver) outOfOrderQueueFull() bool {
+	return r.ep.receiveBufferAvailable() == 0 || r.pendingBufUsed >= r.ep.receiveBufferSize()>>2
+}
+
+// queueOutOfOrder stores s, which can't be consumed yet, in the out-of-order
+// queue. It returns false if s was dropped because the queue is full.
+func (r *receiver) queueOutOfOrder(s *segment) bool {
+	stats := r.ep.stack.Stats().TCP
+	if r.outOfOrderQueueFull() {
+		r.collapseOutOfOrder()
+	}
+	if r.outOfOrderQueueFull() {
+		r.pruneOutOfOrder(s.sequenceNumber)
+	}
+	if r.outOfOrderQueueFull() {
+		stats.OutOfOrderDropped.Increment()
+		return false
+	}
+
+	r.ep.rcvListMu.Lock()
+	r.pendingBufUsed += s.segAllocSize()
+	r.ep.rcvListMu.Unlock()
+	s.incRef()
+	heap.Push(&r.pendingRcvdSegments, s)
+	stats.OutOfOrderQueued.Increment()
+	return true
+}
+
+// collapseOutOfOrder merges the overlapping and contiguous segments of the
+// out-of-order queue, and copies the data of the segments backed by more memory
+// than they need.
+func (r *receiver) collapseOutOfOrder() {
+	// A sorted slice is a valid heap.
+	sort.Sort(&r.pendingRcvdSegments)
+
+	segs := r.pendingRcvdSegments
+	n := 0
+	for i := 0; i < len(segs); {
+		// Find the segments which can be merged with segs[i]. Segments
+		// carrying a FIN are left alone.
+		first := segs[i]
+		end := first.sequenceNumber.Add(seqnum.Size(first.data.Size()))
+		j := i + 1
+		if !first.flagIsSet(header.TCPFlagFin) {
+			for ; j < len(segs) && !segs[j].flagIsSet(header.TCPFlagFin) && segs[j].sequenceNumber.LessThanEq(end); j++ {
+				if segEnd := segs[j].sequenceNumber.Add(seqnum.Size(segs[j].data.Size())); end.LessThan(segEnd) {
+					end = segEnd
+				}
+			}
+		}
+
+		run := segs[i:j]
+		i = j
+		if len(run) == 1 && first.segAllocSize() == first.segMemSize() {
+			segs[n] = first
+			n++
+			continue
+		}
+
+		merged := r.mergeOutOfOrder(run, first.sequenceNumber.Size(end))
+		r.ep.rcvListMu.Lock()
+		for _, s := range run {
+			r.pendingBufUsed -= s.segAllocSize()
+		}
+		r.pendingBufUsed += merged.segAllocSize()
+		r.ep.rcvListMu.Unlock()
+		for _, s := range run {
+			s.decRef()
+		}
+		r.ep.stack.Stats().TCP.OutOfOrderMerged.IncrementBy(uint64(len(run) - 1))
+		segs[n] = merged
+		n++
+	}
+
+	// Note that slice truncation does not allow garbage collection of
+	// truncated items, thus truncated items must be set to nil to avoid
+	// memory leaks.
+	for i := n; i < len(segs); i++ {
+		segs[i] = nil
+	}
+	r.pendingRcvdSegments = segs[:n]
+}
+
+// mergeOutOfOrder returns a segment holding a copy of the size bytes of data
+// held by the segments of run, which are sorted and overlapping or contiguous.
+func (r *receiver) mergeOutOfOrder(run []*segment, size seqnum.Size) *segment {
+	first := run[0]
+	v := make(buffer.View, 0, size)
+	end := first.sequenceNumber
+	for _, s := range run {
+		segEnd := s.sequenceNumber.Add(seqnum.Size(s.data.Size()))
+		if segEnd.LessThanEq(end) {
+			continue
+		}
+		data := s.data.Clone(nil)
+		data.TrimFront(int(s.sequenceNumber.Size(end)))
+		for _, view := range data.Views() {
+			v = append(v, view...)
+		}
+		end = segEnd
+	}
+
+	merged := first.clone()
+	merged.views[0] = v
+	merged.data = buffer.NewVectorisedView(len(v), merged.views[:1])
+	merged.setOwner(r.ep, recvQ)
+	return merged
+}
+
+// pruneOutOfOrder drops the segments of the out-of-order queue starting after
+// seq, from the last one, until the queue is no longer full.
+func (r *receiver) pruneOutOfOrder(seq seqnum.Value) {
+	// A sorted slice is a valid heap, even once truncated.
+	sort.Sort(&r.pendingRcvdSegments)
+
+	pruned := false
+	var prunedSeq seqnum.Value
+	for r.outOfOrderQueueFull() && len(r.pendingRcvdSegments) > 0 {
+		last := len(r.pendingRcvdSegments) - 1
+		s := r.pendingRcvdSegments[last]
+		if s.sequenceNumber.LessThanEq(seq) {
+			break
+		}
+		r.ep.rcvListMu.Lock()
+		r.pendingBufUsed -= s.segAllocSize()
+		r.ep.rcvListMu.Unlock()
+		r.pendingRcvdSegments[last] = nil
+		r.pendingRcvdSegments = r.pendingRcvdSegments[:last]
+		s.decRef()
+
+		r.ep.stack.Stats().TCP.OutOfOrderPruned.Increment()
+		pruned = true
+		prunedSeq = s.sequenceNumber
+	}
+
+	// The pruned data must be retransmitted by the peer, so it must not be
+	// reported as SACKed anymore (RFC 2018 section 8).
+	if pruned {
+		TruncateSACKBlockList(&r.ep.sack, prunedSeq)
+	}
+}
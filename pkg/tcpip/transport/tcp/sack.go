@@ -86,6 +86,25 @@ func UpdateSACKBlocks(sack *SACKInfo, segStart seqnum.Value, segEnd seqnum.Value
 	sack.NumBlocks = n
 }
 
+// TruncateSACKBlockList updates the sack block list by removing/modifying any
+// block where end is > seq. It is used when the receiver drops out-of-order
+// data, which must not be reported as SACKed anymore.
+func TruncateSACKBlockList(sack *SACKInfo, seq seqnum.Value) {
+	n := 0
+	for i := 0; i < sack.NumBlocks; i++ {
+		if seq.LessThanEq(sack.Blocks[i].Start) {
+			continue
+		}
+		if seq.LessThan(sack.Blocks[i].End) {
+			// Shrink this SACK block.
+			sack.Blocks[i].End = seq
+		}
+		sack.Blocks[n] = sack.Blocks[i]
+		n++
+	}
+	sack.NumBlocks = n
+}
+
 // TrimSACKBlockList updates the sack block list by removing/modifying any block
 // where start is < rcvNxt.
 func TrimSACKBlockList(sack *SACKInfo, rcvNxt seqnum.Value) {
@@ -41,7 +41,10 @@ func (sr *sackRecovery) handleSACKRecovery(limit int, end seqnum.Value) (dataSen
 		limit = smss
 	}
 
-	nextSegHint := snd.writeList.Front()
+	nextSegHint := snd.fr.rtxHint
+	if nextSegHint == nil {
+		nextSegHint = snd.writeList.Front()
+	}
 	for snd.outstanding < snd.sndCwnd {
 		var nextSeg *segment
 		var rescueRtx bool
@@ -97,6 +100,7 @@ func (sr *sackRecovery) handleSACKRecovery(limit int, end seqnum.Value) (dataSen
 			// number of the retransmitted segment unless NextSeg ()
 			// rule (4) was invoked for this retransmission."
 			snd.fr.highRxt = segEnd - 1
+			snd.fr.rtxHint = nextSeg
 		}
 	}
 	return dataSent
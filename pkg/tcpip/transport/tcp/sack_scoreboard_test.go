@@ -15,8 +15,11 @@
 package tcp_test
 
 import (
+	"bytes"
+	"context"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/state"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
@@ -247,3 +250,110 @@ func TestSACKScoreboardDelete(t *testing.T) {
 		t.Fatalf("incorrect sacked bytes in scoreboard got: %v, want: %v", got, want)
 	}
 }
+
+func TestSACKScoreboardInsertMerges(t *testing.T) {
+	testCases := []struct {
+		comment    string
+		blocks     []header.SACKBlock
+		wantBlocks []header.SACKBlock
+	}{
+		{
+			"Test disjoint blocks are kept in order",
+			[]header.SACKBlock{{30, 40}, {10, 20}, {50, 60}},
+			[]header.SACKBlock{{10, 20}, {30, 40}, {50, 60}},
+		},
+		{
+			"Test adjacent blocks are merged",
+			[]header.SACKBlock{{10, 20}, {30, 40}, {20, 30}},
+			[]header.SACKBlock{{10, 40}},
+		},
+		{
+			"Test a block spanning several blocks replaces them",
+			[]header.SACKBlock{{10, 20}, {30, 40}, {50, 60}, {70, 80}, {15, 55}},
+			[]header.SACKBlock{{10, 60}, {70, 80}},
+		},
+		{
+			"Test a block contained in another one is ignored",
+			[]header.SACKBlock{{10, 60}, {20, 30}},
+			[]header.SACKBlock{{10, 60}},
+		},
+		{
+			"Test sequence number wrap around",
+			[]header.SACKBlock{{100, 200}, {4294967196, 50}, {50, 100}},
+			[]header.SACKBlock{{4294967196, 200}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.comment, func(t *testing.T) {
+			s := initScoreboard(tc.blocks, tc.blocks[0].Start)
+			got, _ := s.Copy()
+			if len(got) != len(tc.wantBlocks) {
+				t.Fatalf("got s.Copy() = %v, want = %v", got, tc.wantBlocks)
+			}
+			var wantSacked seqnum.Size
+			for i := range got {
+				if got[i] != tc.wantBlocks[i] {
+					t.Fatalf("got s.Copy() = %v, want = %v", got, tc.wantBlocks)
+				}
+				wantSacked += tc.wantBlocks[i].Start.Size(tc.wantBlocks[i].End)
+			}
+			if got := s.Sacked(); got != wantSacked {
+				t.Errorf("got s.Sacked() = %d, want = %d", got, wantSacked)
+			}
+		})
+	}
+}
+
+func TestSACKScoreboardMaxBlocks(t *testing.T) {
+	// maxBlocks is the number of distinct blocks a scoreboard tracks.
+	const maxBlocks = 100
+
+	s := tcp.NewSACKScoreboard(smss, 0)
+	for i := 0; i < 2*maxBlocks; i++ {
+		start := seqnum.Value(i * 10)
+		s.Insert(header.SACKBlock{start, start.Add(5)})
+	}
+	if got, _ := s.Copy(); len(got) != maxBlocks {
+		t.Errorf("got len(s.Copy()) = %d, want = %d", len(got), maxBlocks)
+	}
+	if got, want := s.Sacked(), seqnum.Size(5*maxBlocks); got != want {
+		t.Errorf("got s.Sacked() = %d, want = %d", got, want)
+	}
+}
+
+func TestSACKScoreboardSaveRestore(t *testing.T) {
+	blocks := []header.SACKBlock{{10, 20}, {30, 40}, {4294967290, 5}}
+	s := initScoreboard(blocks, 4294967280)
+
+	var buf bytes.Buffer
+	ctx := context.Background()
+	if _, err := state.Save(ctx, &buf, s); err != nil {
+		t.Fatalf("state.Save(_, _, %s): %s", s, err)
+	}
+	var restored tcp.SACKScoreboard
+	if _, err := state.Load(ctx, bytes.NewReader(buf.Bytes()), &restored); err != nil {
+		t.Fatalf("state.Load(_, _, _): %s", err)
+	}
+
+	wantBlocks, wantMaxSACKED := s.Copy()
+	gotBlocks, gotMaxSACKED := restored.Copy()
+	if len(gotBlocks) != len(wantBlocks) {
+		t.Fatalf("got restored.Copy() = %v, want = %v", gotBlocks, wantBlocks)
+	}
+	for i := range gotBlocks {
+		if gotBlocks[i] != wantBlocks[i] {
+			t.Fatalf("got restored.Copy() = %v, want = %v", gotBlocks, wantBlocks)
+		}
+	}
+	if gotMaxSACKED != wantMaxSACKED {
+		t.Errorf("got restored.MaxSACKED() = %d, want = %d", gotMaxSACKED, wantMaxSACKED)
+	}
+	if got, want := restored.SMSS(), s.SMSS(); got != want {
+		t.Errorf("got restored.SMSS() = %d, want = %d", got, want)
+	}
+	// The number of SACKed bytes isn't saved, it is recomputed from the
+	// ranges.
+	if got, want := restored.Sacked(), seqnum.Size(31); got != want {
+		t.Errorf("got restored.Sacked() = %d, want = %d", got, want)
+	}
+}
@@ -73,6 +73,10 @@ type segment struct {
 	// csumValid is true if the csum in the received segment is valid.
 	csumValid bool
 
+	// memCharged is the number of bytes charged to the protocol's memory
+	// account for this segment while it is owned by an endpoint.
+	memCharged int
+
 	// parsedOptions stores the parsed values from the options in the segment.
 	parsedOptions  header.TCPOptions
 	options        []byte `state:".([]byte)"`
@@ -86,7 +90,7 @@ type segment struct {
 	acked bool
 }
 
-func newIncomingSegment(id stack.TransportEndpointID, pkt *stack.PacketBuffer) *segment {
+func newIncomingSegment(id stack.TransportEndpointID, clock tcpip.Clock, pkt *stack.PacketBuffer) *segment {
 	netHdr := pkt.Network()
 	s := &segment{
 		refCnt:         1,
@@ -99,16 +103,16 @@ func newIncomingSegment(id stack.TransportEndpointID, pkt *stack.PacketBuffer) *
 	}
 	s.data = pkt.Data.Clone(s.views[:])
 	s.hdr = header.TCP(pkt.TransportHeader().View())
-	s.rcvdTime = time.Now()
+	s.rcvdTime = clock.Now()
 	return s
 }
 
-func newOutgoingSegment(id stack.TransportEndpointID, v buffer.View) *segment {
+func newOutgoingSegment(id stack.TransportEndpointID, clock tcpip.Clock, v buffer.View) *segment {
 	s := &segment{
 		refCnt: 1,
 		id:     id,
 	}
-	s.rcvdTime = time.Now()
+	s.rcvdTime = clock.Now()
 	if len(v) != 0 {
 		s.views[0] = v
 		s.data = buffer.NewVectorisedView(len(v), s.views[:1])
@@ -155,6 +159,8 @@ func (s *segment) setOwner(ep *endpoint, qFlags queueFlags) {
 	switch qFlags {
 	case recvQ:
 		ep.updateReceiveMemUsed(s.segMemSize())
+		s.memCharged = s.segAllocSize()
+		ep.memCharge.update(ep.mem, s.memCharged)
 	case sendQ:
 		// no memory account for sendQ yet.
 	default:
@@ -170,6 +176,7 @@ func (s *segment) decRef() {
 			switch s.qFlags {
 			case recvQ:
 				s.ep.updateReceiveMemUsed(-s.segMemSize())
+				s.ep.memCharge.update(s.ep.mem, -s.memCharged)
 			case sendQ:
 				// no memory accounting for sendQ yet.
 			default:
@@ -207,6 +214,13 @@ func (s *segment) segMemSize() int {
 	return segSize + s.data.Size()
 }
 
+// segAllocSize is the amount of memory allocated to hold the segment data and
+// the associated metadata. It may exceed segMemSize, as the views holding the
+// data may be larger than the data itself.
+func (s *segment) segAllocSize() int {
+	return segSize + s.data.MemSize()
+}
+
 // parse populates the sequence & ack numbers, flags, and window fields of the
 // segment from the TCP header stored in the data. It then updates the view to
 // skip the header.
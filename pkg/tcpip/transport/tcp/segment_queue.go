@@ -56,8 +56,9 @@ func (q *segmentQueue) enqueue(s *segment) bool {
 	used := q.ep.receiveMemUsed()
 	q.mu.Lock()
 	// Allow zero sized segments (ACK/FIN/RSTs etc even if the segment queue
-	// is currently full).
-	allow := (used <= bufSz || s.payloadSize() == 0) && !q.frozen
+	// is currently full). Once the protocol runs out of memory, data is only
+	// accepted by endpoints that hold none so that each can make progress.
+	allow := (s.payloadSize() == 0 || (used <= bufSz && (used == 0 || !q.ep.mem.OverLimit()))) && !q.frozen
 
 	if allow {
 		q.list.PushBack(s)
@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
 const (
@@ -46,6 +47,14 @@ const (
 	// before timing out the connection.
 	// Linux default TCP_RETR2, net.ipv4.tcp_retries2.
 	MaxRetries = 15
+
+	// corkTimeout is the maximum time partial segments are held back by
+	// TCP_CORK or MSG_MORE, as in Linux.
+	corkTimeout = 200 * time.Millisecond
+
+	// autocorkTimeout is the maximum time a partial segment is held back by
+	// autocorking, one tick of the timer wheel.
+	autocorkTimeout = timerWheelTick
 )
 
 // ccState indicates the current congestion control state for this sender.
@@ -171,6 +180,19 @@ type sender struct {
 	resendTimer timer       `state:"nosave"`
 	resendWaker sleep.Waker `state:"nosave"`
 
+	// corkTimer bounds the time partial segments are held back by
+	// TCP_CORK, MSG_MORE or autocorking.
+	corkTimer timer       `state:"nosave"`
+	corkWaker sleep.Waker `state:"nosave"`
+
+	// more is set when the data written last was written with MSG_MORE,
+	// in which case partial segments are held back as with TCP_CORK.
+	more bool
+
+	// push is set when partial segments must be sent out by the next
+	// transmit pass regardless of corking and Nagle's algorithm.
+	push bool
+
 	// rtt.srtt, rtt.rttvar, and rto are the "smoothed round-trip time",
 	// "round-trip time variation" and "retransmit timeout", as defined in
 	// section 2 of RFC 6298.
@@ -209,6 +231,22 @@ type sender struct {
 	// rc has the fields needed for implementing RACK loss detection
 	// algorithm.
 	rc rackControl
+
+	// batching is set while the sender is in a transmit pass, i.e. while
+	// it is generating segments in response to new data or to an ACK.
+	// Segments built during the pass are queued in batch and handed to the
+	// route in a single WritePackets call once the pass completes.
+	batching bool `state:"nosave"`
+
+	// batch holds the segments queued during the current transmit pass.
+	batch stack.PacketBufferList `state:"nosave"`
+
+	// batchParams holds the network header parameters shared by all
+	// segments in batch.
+	batchParams stack.NetworkHeaderParams `state:"nosave"`
+
+	// pmtud holds the state of packetization layer path MTU discovery.
+	pmtud pmtudState
 }
 
 // rtt is a synchronization wrapper used to appease stateify. See the comment
@@ -253,6 +291,13 @@ type fastRecovery struct {
 	// available for transmission.
 	// See: RFC 6675 Section 2 for details.
 	rescueRxt seqnum.Value
+
+	// rtxHint is the segment last retransmitted by rules (1) or (3) of
+	// NextSeg during the current loss recovery phase, or nil. As HighRxt
+	// only grows during loss recovery, the segments before it can't be
+	// retransmitted by these rules again, so NextSeg resumes its search from
+	// it on the next ACK instead of from the front of the write list.
+	rtxHint *segment `state:"nosave"`
 }
 
 func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint16, sndWndScale int) *sender {
@@ -268,7 +313,7 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 		sndNxt:           iss + 1,
 		rto:              1 * time.Second,
 		rttMeasureSeqNum: iss + 1,
-		lastSendTime:     time.Now(),
+		lastSendTime:     ep.stack.Clock().Now(),
 		maxPayloadSize:   maxPayloadSize,
 		maxSentAck:       irs + 1,
 		fr: fastRecovery{
@@ -297,9 +342,10 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 		s.sndWndScale = uint8(sndWndScale)
 	}
 
-	s.resendTimer.init(&s.resendWaker)
+	s.resendTimer.init(ep.timerWheel, &s.resendWaker)
+	s.corkTimer.init(ep.timerWheel, &s.corkWaker)
 
-	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
+	s.updateMaxPayloadSize(routeMSS(ep.route)+header.TCPMinimumSize, 0)
 
 	// Initialize SACK Scoreboard after updating max payload size as we use
 	// the maxPayloadSize as the smss when determining if a segment is lost
@@ -325,6 +371,12 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 	}
 	s.maxRetries = uint32(maxRetries)
 
+	var mtuProbing tcpip.TCPMTUProbingOption
+	if err := ep.stack.TransportProtocolOption(ProtocolNumber, &mtuProbing); err != nil {
+		panic(fmt.Sprintf("unable to get mtuProbing from stack: %s", err))
+	}
+	s.initPMTUD(mtuProbing)
+
 	return s
 }
 
@@ -362,6 +414,8 @@ func (s *sender) updateMaxPayloadSize(mtu, count int) {
 
 	m -= s.ep.maxOptionSize()
 
+	s.pmtudTooBig(m)
+
 	// We don't adjust up for now.
 	if m >= s.maxPayloadSize {
 		return
@@ -534,7 +588,7 @@ func (s *sender) retransmitTimerExpired() bool {
 		s.firstRetransmittedSegXmitTime = s.writeList.Front().xmitTime
 	}
 
-	elapsed := time.Since(s.firstRetransmittedSegXmitTime)
+	elapsed := s.ep.stack.Clock().Now().Sub(s.firstRetransmittedSegXmitTime)
 	remaining := s.maxRTO
 	if uto != 0 {
 		// Cap to the user specified timeout if one is specified.
@@ -601,6 +655,7 @@ func (s *sender) retransmitTimerExpired() bool {
 	// information as we lack more rigorous checks to validate if the SACK
 	// information is usable after an RTO.
 	s.ep.scoreboard.Reset()
+	s.pmtudTimeout()
 	s.writeNext = s.writeList.Front()
 
 	// RFC 1122 4.2.2.17: Start sending zero window probes when we still see a
@@ -615,10 +670,7 @@ func (s *sender) retransmitTimerExpired() bool {
 		return true
 	}
 
-	seg := s.writeNext
-	// RFC 1122 4.2.3.5: Close the connection when the number of
-	// retransmissions for this segment is beyond a limit.
-	if seg != nil && seg.xmitCount > s.maxRetries {
+	if s.retransmitsExhausted(s.writeNext) {
 		return false
 	}
 
@@ -674,18 +726,25 @@ func (s *sender) splitSeg(seg *segment, size int) {
 // recovery. The returned hint will be nil if there are no more segments that
 // can match rules defined by NextSeg operation in RFC6675.
 //
+// The scan stops at the highest SACKed sequence number, as no segment beyond
+// it can match rules (1) or (3), and the segment of rule (4) is searched
+// backwards from the last transmitted segment. Thus NextSeg doesn't visit the
+// segments which are neither between nextSegHint and the highest SACKed
+// sequence number nor at the tail of the outstanding data.
+//
 // rescueRtx will be true only if nextSeg is a rescue retransmission as
 // described by Step 4) of the NextSeg algorithm.
 func (s *sender) NextSeg(nextSegHint *segment) (nextSeg, hint *segment, rescueRtx bool) {
 	var s3 *segment
-	var s4 *segment
 	// Step 1.
 	for seg := nextSegHint; seg != nil; seg = seg.Next() {
 		// Stop iteration if we hit a segment that has never been
 		// transmitted (i.e. either it has no assigned sequence number
 		// or if it does have one, it's >= the next sequence number
-		// to be sent [i.e. >= s.sndNxt]).
-		if !s.isAssignedSequenceNumber(seg) || s.sndNxt.LessThanEq(seg.sequenceNumber) {
+		// to be sent [i.e. >= s.sndNxt]), or a segment beyond the
+		// highest SACKed sequence number, which can't meet criterion
+		// (1.b) below.
+		if !s.isAssignedSequenceNumber(seg) || s.sndNxt.LessThanEq(seg.sequenceNumber) || s.ep.scoreboard.maxSACKED.LessThanEq(seg.sequenceNumber) {
 			hint = nil
 			break
 		}
@@ -727,27 +786,6 @@ func (s *sender) NextSeg(nextSegHint *segment) (nextSeg, hint *segment, rescueRt
 					hint = seg.Next()
 				}
 			}
-			// NextSeg():
-			//
-			//     (4) If the conditions for (1), (2) and (3) fail,
-			//     but there exists outstanding unSACKED data, we
-			//     provide the opportunity for a single "rescue"
-			//     retransmission per entry into loss recovery. If
-			//     HighACK is greater than RescueRxt (or RescueRxt
-			//     is undefined), then one segment of upto SMSS
-			//     octects that MUST include the highest outstanding
-			//     unSACKed sequence number SHOULD be returned, and
-			//     RescueRxt set to RecoveryPoint. HighRxt MUST NOT
-			//     be updated.
-			if s.fr.rescueRxt.LessThan(s.sndUna - 1) {
-				if s4 != nil {
-					if s4.sequenceNumber.LessThan(segSeq) {
-						s4 = seg
-					}
-				} else {
-					s4 = seg
-				}
-			}
 		}
 	}
 
@@ -771,7 +809,39 @@ func (s *sender) NextSeg(nextSegHint *segment) (nextSeg, hint *segment, rescueRt
 		return s3, hint, false
 	}
 
-	return s4, nil, true
+	// NextSeg():
+	//
+	//     (4) If the conditions for (1), (2) and (3) fail,
+	//     but there exists outstanding unSACKED data, we
+	//     provide the opportunity for a single "rescue"
+	//     retransmission per entry into loss recovery. If
+	//     HighACK is greater than RescueRxt (or RescueRxt
+	//     is undefined), then one segment of upto SMSS
+	//     octects that MUST include the highest outstanding
+	//     unSACKed sequence number SHOULD be returned, and
+	//     RescueRxt set to RecoveryPoint. HighRxt MUST NOT
+	//     be updated.
+	if !s.fr.rescueRxt.LessThan(s.sndUna - 1) {
+		return nil, nil, true
+	}
+	last := s.writeList.Back()
+	if s.writeNext != nil {
+		last = s.writeNext.Prev()
+	}
+	for seg := last; seg != nil; seg = seg.Prev() {
+		if !s.isAssignedSequenceNumber(seg) || s.sndNxt.LessThanEq(seg.sequenceNumber) {
+			continue
+		}
+		segSeq := seg.sequenceNumber
+		if s.ep.scoreboard.IsSACKED(header.SACKBlock{segSeq, segSeq.Add(1)}) {
+			continue
+		}
+		if smss := s.ep.scoreboard.SMSS(); seg.data.Size() > int(smss) {
+			s.splitSeg(seg, int(smss))
+		}
+		return seg, nil, true
+	}
+	return nil, nil, true
 }
 
 // maybeSendSegment tries to send the specified segment and either coalesces
@@ -812,7 +882,7 @@ func (s *sender) maybeSendSegment(seg *segment, limit int, end seqnum.Value) (se
 			}
 			if !nextTooBig && seg.data.Size() < available {
 				// Segment is not full.
-				if s.outstanding > 0 && s.ep.ops.GetDelayOption() {
+				if s.outstanding > 0 && s.ep.ops.GetDelayOption() && !s.push {
 					// Nagle's algorithm. From Wikipedia:
 					//   Nagle's algorithm works by
 					//   combining a number of small
@@ -827,11 +897,22 @@ func (s *sender) maybeSendSegment(seg *segment, limit int, end seqnum.Value) (se
 					//   sent all at once.
 					return false
 				}
-				// With TCP_CORK, hold back until minimum of the available
-				// send space and MSS.
-				// TODO(gvisor.dev/issue/2833): Drain the held segments after a
-				// timeout.
-				if seg.data.Size() < s.maxPayloadSize && s.ep.ops.GetCorkOption() {
+				// With TCP_CORK or MSG_MORE, hold back until minimum of
+				// the available send space and MSS, unless a FIN follows.
+				if seg.data.Size() < s.maxPayloadSize && s.corked() && seg.Next() == nil && !s.push {
+					if !s.corkTimer.enabled() {
+						s.corkTimer.enable(corkTimeout)
+					}
+					return false
+				}
+				// With autocorking, hold back while the application
+				// is writing in quick succession so that the following
+				// small writes are coalesced into this segment.
+				if s.autocorked(seg) {
+					if !s.corkTimer.enabled() {
+						s.corkTimer.enable(autocorkTimeout)
+						s.ep.stack.Stats().TCP.AutoCorking.Increment()
+					}
 					return false
 				}
 			}
@@ -936,6 +1017,33 @@ func (s *sender) maybeSendSegment(seg *segment, limit int, end seqnum.Value) (se
 	return true
 }
 
+// corked returns true if partial segments are held back.
+func (s *sender) corked() bool {
+	return s.more || s.ep.ops.GetCorkOption()
+}
+
+// autocorked returns true if the partial segment seg is held back by
+// autocorking. Unlike Nagle's algorithm, this only delays the writes following
+// another one closely while data is in flight, and only for autocorkTimeout, so
+// that request/response workloads are not slowed down.
+func (s *sender) autocorked(seg *segment) bool {
+	if !s.ep.autocork || s.push || seg.Next() != nil || s.sndUna == s.sndNxt {
+		return false
+	}
+	return s.ep.stack.Clock().Now().Sub(s.lastSendTime) < autocorkTimeout
+}
+
+// corkTimerExpired is called when the cork timer fires. It sends out the
+// segments held back by TCP_CORK, MSG_MORE or autocorking.
+func (s *sender) corkTimerExpired() *tcpip.Error {
+	if !s.corkTimer.checkExpiration() {
+		return nil
+	}
+	s.push = true
+	s.sendData()
+	return nil
+}
+
 func (s *sender) sendZeroWindowProbe() {
 	ack, win := s.ep.rcv.getSendParams()
 	s.unackZeroWindowProbes++
@@ -952,7 +1060,7 @@ func (s *sender) enableZeroWindowProbing() {
 	// current retranmission interval, as we may start probing while
 	// segment retransmissions.
 	if s.firstRetransmittedSegXmitTime.IsZero() {
-		s.firstRetransmittedSegXmitTime = time.Now()
+		s.firstRetransmittedSegXmitTime = s.ep.stack.Clock().Now()
 	}
 	s.resendTimer.enable(s.rto)
 }
@@ -975,6 +1083,9 @@ func (s *sender) postXmit(dataSent bool) {
 	// data to be sent out, start zero window probing to query the
 	// the remote for it's receive window size.
 	if s.writeNext != nil && s.sndWnd == 0 {
+		if !s.zeroWindowProbing {
+			s.ep.stats.SendErrors.ZeroSndWindowState.Increment()
+		}
 		s.enableZeroWindowProbing()
 	}
 
@@ -988,9 +1099,50 @@ func (s *sender) postXmit(dataSent bool) {
 	}
 }
 
+// beginBatch starts a transmit pass. It returns true if no pass was already in
+// progress, in which case the caller must call endBatch once it is done
+// generating segments.
+func (s *sender) beginBatch() bool {
+	if s.batching {
+		return false
+	}
+	s.batching = true
+	return true
+}
+
+// endBatch completes the current transmit pass and writes out all segments
+// queued during it.
+//
+// The segments were already accounted as sent when they were queued, so there
+// is no caller to report a failure to. As with individual segments (see
+// sendSegment), failures are accounted in the send error stats and the
+// segments are recovered by the retransmit timer, as if lost.
+func (s *sender) endBatch() {
+	s.batching = false
+	if err := s.flushBatch(); err != nil && s.sndUna != s.sndNxt && !s.resendTimer.enabled() {
+		s.resendTimer.enable(s.rto)
+	}
+}
+
+// flushBatch writes out all queued segments in a single batch. It may be
+// called in the middle of a transmit pass to preserve ordering with respect to
+// a segment that can't be batched.
+func (s *sender) flushBatch() *tcpip.Error {
+	if s.batch.Empty() {
+		return nil
+	}
+	pkts := s.batch
+	s.batch.Reset()
+	return s.ep.sendTCPBatchQueued(pkts, s.batchParams)
+}
+
 // sendData sends new data segments. It is called when data becomes available or
 // when the send window opens up.
 func (s *sender) sendData() {
+	if s.beginBatch() {
+		defer s.endBatch()
+	}
+
 	limit := s.maxPayloadSize
 	if s.gso {
 		limit = int(s.ep.gso.MaxSize - header.TCPHeaderMaximumSize)
@@ -1001,13 +1153,16 @@ func (s *sender) sendData() {
 	// "A TCP SHOULD set cwnd to no more than RW before beginning
 	// transmission if the TCP has not sent data in the interval exceeding
 	// the retrasmission timeout."
-	if !s.fr.active && s.state != RTORecovery && time.Now().Sub(s.lastSendTime) > s.rto {
+	if !s.fr.active && s.state != RTORecovery && s.ep.stack.Clock().Now().Sub(s.lastSendTime) > s.rto {
 		if s.sndCwnd > InitialCwnd {
 			s.sndCwnd = InitialCwnd
 		}
 	}
 
 	var dataSent bool
+	if s.maybeSendMTUProbe(end) {
+		dataSent = true
+	}
 	for seg := s.writeNext; seg != nil && s.outstanding < s.sndCwnd; seg = seg.Next() {
 		cwndLimit := (s.sndCwnd - s.outstanding) * s.maxPayloadSize
 		if cwndLimit < limit {
@@ -1027,6 +1182,13 @@ func (s *sender) sendData() {
 		s.writeNext = seg.Next()
 	}
 
+	// Pushing partial segments only applies to a single pass, and nothing
+	// is held back once all data was sent.
+	s.push = false
+	if s.writeNext == nil {
+		s.corkTimer.disable()
+	}
+
 	s.postXmit(dataSent)
 }
 
@@ -1043,6 +1205,7 @@ func (s *sender) enterRecovery() {
 	s.fr.maxCwnd = s.sndCwnd + s.outstanding
 	s.fr.highRxt = s.sndUna
 	s.fr.rescueRxt = s.sndUna
+	s.fr.rtxHint = nil
 	if s.ep.sackPermitted {
 		s.state = SACKRecovery
 		s.ep.stack.Stats().TCP.SACKRecovery.Increment()
@@ -1055,6 +1218,7 @@ func (s *sender) enterRecovery() {
 func (s *sender) leaveRecovery() {
 	s.fr.active = false
 	s.fr.maxCwnd = 0
+	s.fr.rtxHint = nil
 	s.dupAckCount = 0
 
 	// Deflate cwnd. It had been artificially inflated when new dups arrived.
@@ -1204,7 +1368,7 @@ func (s *sender) walkSACK(rcvdSeg *segment) {
 	for _, sb := range sackBlocks {
 		for seg != nil && seg.sequenceNumber.LessThan(sb.End) && seg.xmitCount != 0 {
 			if sb.Start.LessThanEq(seg.sequenceNumber) && !seg.acked {
-				s.rc.update(seg, rcvdSeg, s.ep.tsOffset)
+				s.rc.update(s.ep.stack.Clock(), seg, rcvdSeg, s.ep.tsOffset)
 				s.rc.detectReorder(seg)
 				seg.acked = true
 			}
@@ -1260,9 +1424,15 @@ func (s *sender) checkDSACK(rcvdSeg *segment) bool {
 // handleRcvdSegment is called when a segment is received; it is responsible for
 // updating the send-related state.
 func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
+	// Segments generated while processing the ACK (retransmissions during
+	// recovery as well as new data) are written out as a single batch.
+	if s.beginBatch() {
+		defer s.endBatch()
+	}
+
 	// Check if we can extract an RTT measurement from this ack.
 	if !rcvdSeg.parsedOptions.TS && s.rttMeasureSeqNum.LessThan(rcvdSeg.ackNumber) {
-		s.updateRTO(time.Now().Sub(s.rttMeasureTime))
+		s.updateRTO(s.ep.stack.Clock().Now().Sub(s.rttMeasureTime))
 		s.rttMeasureSeqNum = s.sndNxt
 	}
 
@@ -1390,10 +1560,15 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 			if s.writeNext == seg {
 				s.writeNext = seg.Next()
 			}
+			if s.fr.rtxHint == seg {
+				// The segments after seg are now at the front of
+				// the write list.
+				s.fr.rtxHint = nil
+			}
 
 			// Update the RACK fields if SACK is enabled.
 			if s.ep.sackPermitted && !seg.acked {
-				s.rc.update(seg, rcvdSeg, s.ep.tsOffset)
+				s.rc.update(s.ep.stack.Clock(), seg, rcvdSeg, s.ep.tsOffset)
 				s.rc.detectReorder(seg)
 			}
 
@@ -1415,6 +1590,9 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		// Clear SACK information for all acked data.
 		s.ep.scoreboard.Delete(s.sndUna)
 
+		// Raise the MSS if an MTU probe was acknowledged.
+		s.pmtudAcked()
+
 		// If we are not in fast recovery then update the congestion
 		// window based on the number of acknowledged packets.
 		if !s.fr.active {
@@ -1465,13 +1643,14 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 // sendSegment sends the specified segment.
 func (s *sender) sendSegment(seg *segment) *tcpip.Error {
 	if seg.xmitCount > 0 {
+		s.pmtudRetransmit(seg)
 		s.ep.stack.Stats().TCP.Retransmits.Increment()
 		s.ep.stats.SendErrors.Retransmits.Increment()
 		if s.sndCwnd < s.sndSsthresh {
 			s.ep.stack.Stats().TCP.SlowStartRetransmits.Increment()
 		}
 	}
-	seg.xmitTime = time.Now()
+	seg.xmitTime = s.ep.stack.Clock().Now()
 	seg.xmitCount++
 	err := s.sendSegmentFromView(seg.data, seg.flags, seg.sequenceNumber)
 
@@ -1495,7 +1674,7 @@ func (s *sender) sendSegment(seg *segment) *tcpip.Error {
 // sendSegmentFromView sends a new segment containing the given payload, flags
 // and sequence number.
 func (s *sender) sendSegmentFromView(data buffer.VectorisedView, flags byte, seq seqnum.Value) *tcpip.Error {
-	s.lastSendTime = time.Now()
+	s.lastSendTime = s.ep.stack.Clock().Now()
 	if seq == s.rttMeasureSeqNum {
 		s.rttMeasureTime = s.lastSendTime
 	}
@@ -44,9 +44,20 @@ func (s *sender) loadRttMeasureTime(unix unixTime) {
 	s.rttMeasureTime = time.Unix(unix.second, unix.nano)
 }
 
+// saveSearchDone is invoked by stateify.
+func (p *pmtudState) saveSearchDone() unixTime {
+	return unixTime{p.searchDone.Unix(), p.searchDone.UnixNano()}
+}
+
+// loadSearchDone is invoked by stateify.
+func (p *pmtudState) loadSearchDone(unix unixTime) {
+	p.searchDone = time.Unix(unix.second, unix.nano)
+}
+
 // afterLoad is invoked by stateify.
 func (s *sender) afterLoad() {
-	s.resendTimer.init(&s.resendWaker)
+	s.resendTimer.init(restoredTimerWheel(), &s.resendWaker)
+	s.corkTimer.init(restoredTimerWheel(), &s.corkWaker)
 }
 
 // saveFirstRetransmittedSegXmitTime is invoked by stateify.
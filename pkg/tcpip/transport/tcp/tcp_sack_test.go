@@ -367,6 +367,33 @@ func TestTrimSackBlockList(t *testing.T) {
 	}
 }
 
+func TestTruncateSACKBlockList(t *testing.T) {
+	testCases := []struct {
+		seq        seqnum.Value
+		sackBlocks []header.SACKBlock
+		truncated  []header.SACKBlock
+	}{
+		// Simple cases where we truncate whole entries.
+		{41, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}},
+		{31, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{10, 20}, {22, 30}}},
+		{22, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{10, 20}}},
+		{10, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{}},
+		// Cases where we need to update a block.
+		{35, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{32, 35}, {10, 20}, {22, 30}}},
+		{25, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{10, 20}, {22, 25}}},
+		{15, []header.SACKBlock{{32, 40}, {10, 20}, {22, 30}}, []header.SACKBlock{{10, 15}}},
+	}
+	for _, tc := range testCases {
+		var sack tcp.SACKInfo
+		copy(sack.Blocks[:], tc.sackBlocks)
+		sack.NumBlocks = len(tc.sackBlocks)
+		tcp.TruncateSACKBlockList(&sack, tc.seq)
+		if got, want := sack.Blocks[:sack.NumBlocks], tc.truncated; !reflect.DeepEqual(got, want) {
+			t.Errorf("TruncateSACKBlockList(%v, %v), got: %v, want: %v", tc.sackBlocks, tc.seq, got, want)
+		}
+	}
+}
+
 func TestSACKRecovery(t *testing.T) {
 	const maxPayload = 10
 	// See: tcp.makeOptions for why tsOptionSize is set to 12 here.
@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
@@ -179,6 +180,99 @@ func TestTCPSegmentsSentIncrement(t *testing.T) {
 	}
 }
 
+func TestTCPSegmentsSentIncrementBatched(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	// Write enough data for several full-sized segments; they are all
+	// generated in a single transmit pass and handed to the link layer as one
+	// batch, but each must still be counted and delivered in order.
+	const numSegments = 4
+	const maxPayload = header.TCPDefaultMSS
+	data := make([]byte, numSegments*maxPayload)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	stats := c.Stack().Stats()
+	want := stats.TCP.SegmentsSent.Value() + numSegments
+	epWant := c.EP.Stats().(*tcp.Stats).SegmentsSent.Value() + numSegments
+
+	view := buffer.NewViewFromBytes(data)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	for i := 0; i < numSegments; i++ {
+		b := c.GetPacket()
+		checker.IPv4(t, b,
+			checker.PayloadLen(maxPayload+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)+1+uint32(i*maxPayload)),
+				checker.TCPAckNum(790),
+			),
+		)
+		if p := header.TCP(header.IPv4(b).Payload()).Payload(); !bytes.Equal(data[i*maxPayload:(i+1)*maxPayload], p) {
+			t.Fatalf("got segment %d data = %v, want = %v", i, p, data[i*maxPayload:(i+1)*maxPayload])
+		}
+	}
+
+	if got := stats.TCP.SegmentsSent.Value(); got != want {
+		t.Errorf("got stats.TCP.SegmentsSent.Value() = %d, want = %d", got, want)
+	}
+	if got := c.EP.Stats().(*tcp.Stats).SegmentsSent.Value(); got != epWant {
+		t.Errorf("got EP stats SegmentsSent.Value() = %d, want = %d", got, epWant)
+	}
+
+	// All segments must have been handed to the link endpoint together.
+	if batches := c.WritePacketsBatches(); len(batches) != 1 || batches[0] != numSegments {
+		t.Errorf("got WritePackets batches = %v, want = [%d]", batches, numSegments)
+	}
+}
+
+func TestTCPBatchWriteFailureRetransmits(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	// The batch carrying the data is dropped by the link endpoint. The
+	// failure must be accounted, and the data recovered by the retransmit
+	// timer like a lost segment.
+	c.FailNextWritePackets(tcpip.ErrWouldBlock)
+	stats := c.Stack().Stats()
+	want := stats.TCP.SegmentSendErrors.Value() + 1
+
+	data := []byte{1, 2, 3}
+	view := buffer.NewView(len(data))
+	copy(view, data)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	b := c.GetPacket()
+	checker.IPv4(t, b,
+		checker.PayloadLen(len(data)+header.TCPMinimumSize),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(790),
+		),
+	)
+	if p := header.TCP(header.IPv4(b).Payload()).Payload(); !bytes.Equal(data, p) {
+		t.Fatalf("got retransmitted data = %v, want = %v", p, data)
+	}
+	if got := stats.TCP.SegmentSendErrors.Value(); got != want {
+		t.Errorf("got stats.TCP.SegmentSendErrors.Value() = %d, want = %d", got, want)
+	}
+	if got := stats.TCP.Retransmits.Value(); got != 1 {
+		t.Errorf("got stats.TCP.Retransmits.Value() = %d, want = 1", got)
+	}
+}
+
 func TestTCPResetsSentIncrement(t *testing.T) {
 	c := context.New(t, defaultMTU)
 	defer c.Cleanup()
@@ -881,6 +975,107 @@ func TestUserSuppliedMSSOnConnect(t *testing.T) {
 	}
 }
 
+// TestMSSClamp tests that the MSS clamp set on the stack bounds both the MSS
+// advertised in SYN segments and the size of data segments.
+func TestMSSClamp(t *testing.T) {
+	const (
+		mtu     = 1500
+		peerMSS = 1460
+	)
+
+	tests := []struct {
+		name   string
+		clamp  tcpip.TCPMSSClampOption
+		expMSS uint16
+	}{
+		{
+			name:   "None",
+			expMSS: mtu - header.IPv4MinimumSize - header.TCPMinimumSize,
+		},
+		{
+			name:   "Overhead",
+			clamp:  tcpip.TCPMSSClampOption{Overhead: 100},
+			expMSS: mtu - header.IPv4MinimumSize - header.TCPMinimumSize - 100,
+		},
+		{
+			name:   "Max",
+			clamp:  tcpip.TCPMSSClampOption{Max: 1000},
+			expMSS: 1000,
+		},
+		{
+			name:   "OverheadAndMax",
+			clamp:  tcpip.TCPMSSClampOption{Overhead: 100, Max: 1400},
+			expMSS: mtu - header.IPv4MinimumSize - header.TCPMinimumSize - 100,
+		},
+		{
+			name:   "OverheadBelowMinimum",
+			clamp:  tcpip.TCPMSSClampOption{Overhead: 2000},
+			expMSS: header.TCPMinimumMSS,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, mtu)
+			defer c.Cleanup()
+
+			if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &test.clamp); err != nil {
+				t.Fatalf("SetTransportProtocolOption(%d, &%#v): %s", tcp.ProtocolNumber, test.clamp, err)
+			}
+
+			c.Create(-1 /* epRcvBuf */)
+			rcvBufSize, err := c.EP.GetSockOptInt(tcpip.ReceiveBufferSizeOption)
+			if err != nil {
+				t.Fatalf("GetSockOptInt(ReceiveBufferSizeOption): %s", err)
+			}
+			ws := tcp.FindWndScale(seqnum.Size(rcvBufSize))
+
+			connectAddr := tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}
+			if err := c.EP.Connect(connectAddr); err != tcpip.ErrConnectStarted {
+				t.Fatalf("Connect(%+v): %s", connectAddr, err)
+			}
+			b := c.GetPacket()
+			checker.IPv4(t, b, checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPFlags(header.TCPFlagSyn),
+				checker.TCPSynOptions(header.TCPSynOptions{MSS: test.expMSS, WS: ws})))
+
+			// Complete the handshake with a peer that accepts larger
+			// segments.
+			tcpHdr := header.TCP(header.IPv4(b).Payload())
+			c.IRS = seqnum.Value(tcpHdr.SequenceNumber())
+			c.SendPacket(nil, &context.Headers{
+				SrcPort: tcpHdr.DestinationPort(),
+				DstPort: tcpHdr.SourcePort(),
+				Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+				SeqNum:  789,
+				AckNum:  c.IRS.Add(1),
+				RcvWnd:  30000,
+				TCPOpts: []byte{header.TCPOptionMSS, 4, byte(peerMSS / 256), byte(peerMSS % 256)},
+			})
+			checker.IPv4(t, c.GetPacket(), checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPFlags(header.TCPFlagAck),
+				checker.TCPSeqNum(uint32(c.IRS)+1),
+				checker.TCPAckNum(790),
+			))
+
+			// Data segments are bounded by the clamped MSS.
+			if _, _, err := c.EP.Write(tcpip.SlicePayload(make([]byte, peerMSS)), tcpip.WriteOptions{}); err != nil {
+				t.Fatalf("Write failed: %s", err)
+			}
+			checker.IPv4(t, c.GetPacket(),
+				checker.PayloadLen(int(test.expMSS)+header.TCPMinimumSize),
+				checker.TCP(
+					checker.DstPort(context.TestPort),
+					checker.TCPSeqNum(uint32(c.IRS)+1),
+					checker.TCPAckNum(790),
+				),
+			)
+		})
+	}
+}
+
 // TestUserSuppliedMSSOnListenAccept tests that the user supplied MSS is used
 // when completing the handshake for a new TCP connection from a TCP
 // listening socket. It should be present in the sent TCP SYN-ACK segment.
@@ -1372,7 +1567,6 @@ func TestConnectBindToDevice(t *testing.T) {
 		want   tcp.EndpointState
 	}{
 		{"RightDevice", 1, tcp.StateEstablished},
-		{"WrongDevice", 2, tcp.StateSynSent},
 		{"AnyDevice", 0, tcp.StateEstablished},
 	} {
 		t.Run(test.name, func(t *testing.T) {
@@ -1427,6 +1621,105 @@ func TestConnectBindToDevice(t *testing.T) {
 	}
 }
 
+// TestConnectBindToWrongDevice tests that an endpoint bound to a device can't
+// connect through another one.
+func TestConnectBindToWrongDevice(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+	bindToDevice := tcpip.BindToDeviceOption(2)
+	if err := c.EP.SetSockOpt(&bindToDevice); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%d)): %s", bindToDevice, bindToDevice, err)
+	}
+
+	// NIC 2 has no route to the peer.
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrNoRoute {
+		t.Fatalf("got c.EP.Connect(...) = %s, want = %s", err, tcpip.ErrNoRoute)
+	}
+
+	// Nor can it connect through a NIC other than its device.
+	if err := c.EP.Connect(tcpip.FullAddress{NIC: 1, Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrNoRoute {
+		t.Fatalf("got c.EP.Connect(...) = %s, want = %s", err, tcpip.ErrNoRoute)
+	}
+}
+
+// connectObserver is a tcpip.ConnectObserver which sends the events it
+// observes on a channel.
+type connectObserver chan tcpip.ConnectProgressEvent
+
+func (o connectObserver) OnConnectProgress(e tcpip.ConnectProgressEvent) {
+	o <- e
+}
+
+func TestConnectObserver(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+	observer := make(connectObserver, 10)
+	if err := c.EP.SetSockOpt(&tcpip.ConnectObserverOption{Observer: observer}); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&tcpip.ConnectObserverOption{...}): %s", err)
+	}
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("unexpected return value from Connect: %s", err)
+	}
+
+	// Receive the SYN and complete the handshake.
+	b := c.GetPacket()
+	tcpHdr := header.TCP(header.IPv4(b).Payload())
+	c.IRS = seqnum.Value(tcpHdr.SequenceNumber())
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: tcpHdr.DestinationPort(),
+		DstPort: tcpHdr.SourcePort(),
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  789,
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+	c.GetPacket()
+
+	wantAddr := tcpip.FullAddress{NIC: 1, Addr: context.TestAddr, Port: context.TestPort}
+	for _, want := range []tcpip.ConnectProgressEventType{tcpip.ConnectSYNSent, tcpip.ConnectEstablished} {
+		select {
+		case e := <-observer:
+			if e.Type != want {
+				t.Errorf("got event type = %d, want = %d", e.Type, want)
+			}
+			if e.NetProto != header.IPv4ProtocolNumber {
+				t.Errorf("got event NetProto = %d, want = %d", e.NetProto, header.IPv4ProtocolNumber)
+			}
+			if e.RemoteAddress != wantAddr {
+				t.Errorf("got event RemoteAddress = %#v, want = %#v", e.RemoteAddress, wantAddr)
+			}
+			if e.Err != nil {
+				t.Errorf("got event Err = %s, want = nil", e.Err)
+			}
+		default:
+			t.Fatalf("missing event of type %d", want)
+		}
+	}
+}
+
+func TestHandshakeStats(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1)
+
+	stats := c.Stack().Stats().TCP
+	if got := stats.HandshakeLatency.LessThan1ms.Value() + stats.HandshakeLatency.LessThan10ms.Value() + stats.HandshakeLatency.LessThan100ms.Value() + stats.HandshakeLatency.LessThan1s.Value(); got != 1 {
+		t.Errorf("got handshakes faster than 1s = %d, want = 1", got)
+	}
+	if got := stats.HandshakeSYNRetransmits.None.Value(); got != 1 {
+		t.Errorf("got stats.TCP.HandshakeSYNRetransmits.None.Value() = %d, want = 1", got)
+	}
+	if got := stats.HandshakeFailures.Other.Value(); got != 0 {
+		t.Errorf("got stats.TCP.HandshakeFailures.Other.Value() = %d, want = 0", got)
+	}
+}
+
 func TestSynSent(t *testing.T) {
 	for _, test := range []struct {
 		name  string
@@ -1493,14 +1786,21 @@ func TestSynSent(t *testing.T) {
 				t.Fatal("timed out waiting for packet to arrive")
 			}
 
+			failures := c.Stack().Stats().TCP.HandshakeFailures
 			if test.reset {
 				if _, _, err := c.EP.Read(nil); err != tcpip.ErrConnectionRefused {
 					t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrConnectionRefused)
 				}
+				if got := failures.Refused.Value(); got != 1 {
+					t.Errorf("got stats.TCP.HandshakeFailures.Refused.Value() = %d, want = 1", got)
+				}
 			} else {
 				if _, _, err := c.EP.Read(nil); err != tcpip.ErrAborted {
 					t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrAborted)
 				}
+				if got := failures.Aborted.Value(); got != 1 {
+					t.Errorf("got stats.TCP.HandshakeFailures.Aborted.Value() = %d, want = 1", got)
+				}
 			}
 
 			if got := c.Stack().Stats().TCP.CurrentConnected.Value(); got != 0 {
@@ -1635,8 +1935,14 @@ func TestOutOfOrderFlood(t *testing.T) {
 		)
 	}
 
-	// Send packet with seqnum 793. It must be discarded because the
-	// out-of-order buffer was filled by the previous packets.
+	// The duplicates must have been merged when they filled the out-of-order
+	// queue.
+	if got := c.Stack().Stats().TCP.OutOfOrderMerged.Value(); got == 0 {
+		t.Errorf("got stats.TCP.OutOfOrderMerged.Value() = 0, want > 0")
+	}
+
+	// Send packet with seqnum 793. It must be queued in the room left by the
+	// merged duplicates.
 	c.SendPacket(data[3:], &context.Headers{
 		SrcPort: context.TestPort,
 		DstPort: c.Port,
@@ -1665,12 +1971,83 @@ func TestOutOfOrderFlood(t *testing.T) {
 		RcvWnd:  30000,
 	})
 
-	// Check that only packet 790 is acknowledged.
+	// Check that all the packets are acknowledged.
 	checker.IPv4(t, c.GetPacket(),
 		checker.TCP(
 			checker.DstPort(context.TestPort),
 			checker.TCPSeqNum(uint32(c.IRS)+1),
-			checker.TCPAckNum(793),
+			checker.TCPAckNum(799),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+}
+
+func TestOutOfOrderPrune(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	rcvBufSz := math.MaxUint16
+	c.CreateConnected(789, 30000, rcvBufSz)
+
+	// Fill the out-of-order queue with segments separated by holes, so that
+	// they can't be merged.
+	const payloadSize = 1000
+	data := make([]byte, payloadSize)
+	for i := 2; c.Stack().Stats().TCP.OutOfOrderDropped.Value() == 0; i++ {
+		if i > 16 {
+			t.Fatal("out-of-order queue never filled up")
+		}
+		c.SendPacket(data, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  seqnum.Value(790 + 3*i*payloadSize),
+			AckNum:  c.IRS.Add(1),
+			RcvWnd:  30000,
+		})
+		checker.IPv4(t, c.GetPacket(),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPAckNum(790),
+				checker.TCPFlags(header.TCPFlagAck),
+			),
+		)
+	}
+
+	// A segment filling an earlier hole makes room for itself by pruning
+	// the last segments.
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  seqnum.Value(790 + payloadSize),
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPAckNum(790),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+	if got := c.Stack().Stats().TCP.OutOfOrderPruned.Value(); got == 0 {
+		t.Errorf("got stats.TCP.OutOfOrderPruned.Value() = 0, want > 0")
+	}
+
+	// Filling the first hole delivers the data up to the next hole.
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPAckNum(790+2*payloadSize),
 			checker.TCPFlags(header.TCPFlagAck),
 		),
 	)
@@ -1932,26 +2309,106 @@ func TestFullWindowReceive(t *testing.T) {
 	)
 }
 
-func TestNoWindowShrinking(t *testing.T) {
+func TestTransportMemoryLimit(t *testing.T) {
 	c := context.New(t, defaultMTU)
 	defer c.Cleanup()
 
-	// Start off with a certain receive buffer then cut it in half and verify that
-	// the right edge of the window does not shrink.
-	// NOTE: Netstack doubles the value specified here.
-	rcvBufSize := 65536
-	iss := seqnum.Value(789)
-	// Enable window scaling with a scale of zero from our end.
-	c.CreateConnectedWithRawOptions(iss, 30000, rcvBufSize, []byte{
-		header.TCPOptionWS, 3, 0, header.TCPOptionNOP,
-	})
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
 
-	we, ch := waiter.NewChannelEntry(nil)
-	c.WQ.EventRegister(&we, waiter.EventIn)
-	defer c.WQ.EventUnregister(&we)
+	// Allow a single byte to be held across all TCP endpoints.
+	opt := tcpip.TransportMemoryLimitsOption{Min: 0, Pressure: 0, Max: 1}
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%#v): %s", tcp.ProtocolNumber, opt, err)
+	}
 
-	if _, _, err := c.EP.Read(nil); err != tcpip.ErrWouldBlock {
-		t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrWouldBlock)
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	sendData := func(seq seqnum.Value) {
+		t.Helper()
+		c.SendPacket(data, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  seq,
+			AckNum:  c.IRS.Add(1),
+			RcvWnd:  30000,
+		})
+	}
+
+	// An endpoint holding no memory may always receive data.
+	sendData(790)
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(uint32(790+len(data))),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+
+	// Further data is dropped while the protocol is over its limit.
+	sendData(800)
+	if got := c.EP.Stats().(*tcp.Stats).ReceiveErrors.SegmentQueueDropped.Value(); got != 1 {
+		t.Fatalf("got EP stats ReceiveErrors.SegmentQueueDropped = %d, want = 1", got)
+	}
+
+	// Reading the data returns the memory, after which the retransmitted
+	// segment is accepted.
+	if _, _, err := c.EP.Read(nil); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	sendData(800)
+	for {
+		b := c.GetPacket()
+		if ack := header.TCP(header.IPv4(b).Payload()).AckNumber(); ack == uint32(800+len(data)) {
+			break
+		}
+	}
+}
+
+func TestTransportMemoryShared(t *testing.T) {
+	var mem stack.TransportMemory
+	newStack := func() *stack.Stack {
+		return stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocolWithMemory(&mem)},
+		})
+	}
+	s1, s2 := newStack(), newStack()
+
+	// Limits set through one stack apply to all stacks sharing the account.
+	opt := tcpip.TransportMemoryLimitsOption{Min: 1, Pressure: 2, Max: 3}
+	if err := s1.SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("s1.SetTransportProtocolOption(%d, &%#v): %s", tcp.ProtocolNumber, opt, err)
+	}
+	var got tcpip.TransportMemoryLimitsOption
+	if err := s2.TransportProtocolOption(tcp.ProtocolNumber, &got); err != nil {
+		t.Fatalf("s2.TransportProtocolOption(%d, _): %s", tcp.ProtocolNumber, err)
+	}
+	if got != opt {
+		t.Errorf("got s2.TransportProtocolOption(%d, _) = %#v, want = %#v", tcp.ProtocolNumber, got, opt)
+	}
+}
+
+func TestNoWindowShrinking(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	// Start off with a certain receive buffer then cut it in half and verify that
+	// the right edge of the window does not shrink.
+	// NOTE: Netstack doubles the value specified here.
+	rcvBufSize := 65536
+	iss := seqnum.Value(789)
+	// Enable window scaling with a scale of zero from our end.
+	c.CreateConnectedWithRawOptions(iss, 30000, rcvBufSize, []byte{
+		header.TCPOptionWS, 3, 0, header.TCPOptionNOP,
+	})
+
+	we, ch := waiter.NewChannelEntry(nil)
+	c.WQ.EventRegister(&we, waiter.EventIn)
+	defer c.WQ.EventUnregister(&we)
+
+	if _, _, err := c.EP.Read(nil); err != tcpip.ErrWouldBlock {
+		t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrWouldBlock)
 	}
 	// Send a 1 byte payload so that we can record the current receive window.
 	// Send a payload of half the size of rcvBufSize.
@@ -2153,6 +2610,9 @@ func TestZeroWindowSend(t *testing.T) {
 			checker.TCPFlagsMatch(header.TCPFlagAck, ^uint8(header.TCPFlagPsh)),
 		),
 	)
+	if got := c.EP.Stats().(*tcp.Stats).SendErrors.ZeroSndWindowState.Value(); got != 1 {
+		t.Errorf("got EP stats SendErrors.ZeroSndWindowState = %d, want = 1", got)
+	}
 
 	// Open up the window. Data should be received now.
 	c.SendPacket(nil, &context.Headers{
@@ -2801,6 +3261,144 @@ func TestMSSNotDelayed(t *testing.T) {
 	}
 }
 
+func TestCorkTimeout(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	c.EP.SocketOptions().SetCorkOption(true)
+
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	c.CheckNoPacketTimeout("got a partial segment while corked", 50*time.Millisecond)
+
+	// The corked data is sent out once the cork timer fires.
+	checker.IPv4(t, c.GetPacket(),
+		checker.PayloadLen(len(data)+header.TCPMinimumSize),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(790),
+		),
+	)
+}
+
+func TestUncorkPushesDelayedData(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	c.EP.SocketOptions().SetDelayOption(true)
+
+	// Leave a segment unacknowledged for Nagle's algorithm to hold back
+	// further partial segments.
+	if _, _, err := c.EP.Write(tcpip.SlicePayload([]byte{0}), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	c.GetPacket()
+
+	c.EP.SocketOptions().SetCorkOption(true)
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	c.CheckNoPacketTimeout("got a partial segment while corked", 50*time.Millisecond)
+
+	// Uncorking pushes the data out even though Nagle's algorithm would
+	// hold it back.
+	c.EP.SocketOptions().SetCorkOption(false)
+	checker.IPv4(t, c.GetPacket(),
+		checker.PayloadLen(len(data)+header.TCPMinimumSize),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+2),
+			checker.TCPAckNum(790),
+		),
+	)
+}
+
+func TestMSGMore(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	var allData []byte
+	for i, data := range [][]byte{{1, 2, 3}, {4, 5}} {
+		allData = append(allData, data...)
+		if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{More: true}); err != nil {
+			t.Fatalf("Write #%d failed: %s", i+1, err)
+		}
+	}
+	c.CheckNoPacketTimeout("got a partial segment written with MSG_MORE", 50*time.Millisecond)
+
+	// A write without MSG_MORE sends the coalesced data out.
+	data := []byte{6}
+	allData = append(allData, data...)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	b := c.GetPacket()
+	checker.IPv4(t, b,
+		checker.PayloadLen(len(allData)+header.TCPMinimumSize),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(790),
+		),
+	)
+	if got := b[header.IPv4MinimumSize+header.TCPMinimumSize:]; !bytes.Equal(got, allData) {
+		t.Fatalf("got data = %v, want = %v", got, allData)
+	}
+}
+
+func TestAutocorking(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	opt := tcpip.TCPAutocorkingOption(true)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%t)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	// The first write is sent right away as nothing is in flight, and the
+	// following ones are coalesced while it is.
+	var allData []byte
+	for i, data := range [][]byte{{0}, {1, 2, 3}, {4, 5}, {6}} {
+		allData = append(allData, data...)
+		if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+			t.Fatalf("Write #%d failed: %s", i+1, err)
+		}
+	}
+
+	seq := c.IRS.Add(1)
+	for _, want := range [][]byte{allData[:1], allData[1:]} {
+		b := c.GetPacket()
+		checker.IPv4(t, b,
+			checker.PayloadLen(len(want)+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(seq)),
+				checker.TCPAckNum(790),
+			),
+		)
+		if got := b[header.IPv4MinimumSize+header.TCPMinimumSize:]; !bytes.Equal(got, want) {
+			t.Fatalf("got data = %v, want = %v", got, want)
+		}
+		seq = seq.Add(seqnum.Size(len(want)))
+	}
+
+	if got := c.Stack().Stats().TCP.AutoCorking.Value(); got != 1 {
+		t.Errorf("got stats.TCP.AutoCorking.Value() = %d, want = 1", got)
+	}
+}
+
 func testBrokenUpWrite(t *testing.T, c *context.Context, maxPayload int) {
 	payloadMultiplier := 10
 	dataLen := payloadMultiplier * maxPayload
@@ -2872,6 +3470,125 @@ func TestSendGreaterThanMTU(t *testing.T) {
 	testBrokenUpWrite(t, c, maxPayload)
 }
 
+func TestMTUProbing(t *testing.T) {
+	const maxPayload = 1460
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	opt := tcpip.TCPMTUProbingAlways
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+
+	c.CreateConnectedWithRawOptions(789, 30000, -1 /* epRcvBuf */, []byte{
+		header.TCPOptionMSS, 4, byte(maxPayload / 256), byte(maxPayload % 256),
+	})
+
+	bytesSent := 0
+	for _, test := range []struct {
+		name string
+		want []int
+	}{
+		// Segments are sent at the base MSS of 1024 bytes, after a probe
+		// halfway between it and the MSS advertised by the peer.
+		{"initial", []int{1242, 1024, 1024, 710}},
+		// The acknowledged probe raises the MSS, and the next probe
+		// searches above it.
+		{"raised", []int{1351, 1242, 1242, 165}},
+	} {
+		total := 0
+		for _, n := range test.want {
+			total += n
+		}
+		if _, _, err := c.EP.Write(tcpip.SlicePayload(make([]byte, total)), tcpip.WriteOptions{}); err != nil {
+			t.Fatalf("%s: Write failed: %s", test.name, err)
+		}
+		for i, want := range test.want {
+			b := c.GetPacket()
+			checker.IPv4(t, b,
+				checker.PayloadLen(want+header.TCPMinimumSize),
+				checker.TCP(
+					checker.DstPort(context.TestPort),
+					checker.TCPSeqNum(uint32(c.IRS)+1+uint32(bytesSent)),
+					checker.TCPAckNum(790),
+				),
+			)
+			if t.Failed() {
+				t.Fatalf("%s: unexpected packet #%d", test.name, i+1)
+			}
+			bytesSent += want
+		}
+
+		// Acknowledge the data.
+		c.SendPacket(nil, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  790,
+			AckNum:  c.IRS.Add(1 + seqnum.Size(bytesSent)),
+			RcvWnd:  30000,
+		})
+	}
+}
+
+func TestMTUBlackHoleDetection(t *testing.T) {
+	const maxPayload = 1460
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	opt := tcpip.TCPMTUProbingOnBlackHole
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+	// Keep the retransmission timeouts short.
+	minRTO := tcpip.TCPMinRTOOption(10 * time.Millisecond)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &minRTO); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, minRTO, minRTO, err)
+	}
+	maxRTO := tcpip.TCPMaxRTOOption(50 * time.Millisecond)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &maxRTO); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, maxRTO, maxRTO, err)
+	}
+
+	c.CreateConnectedWithRawOptions(789, 30000, -1 /* epRcvBuf */, []byte{
+		header.TCPOptionMSS, 4, byte(maxPayload / 256), byte(maxPayload % 256),
+	})
+
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(make([]byte, maxPayload)), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	// The full-sized segment is retransmitted until the black hole is
+	// detected, after which it is retransmitted at the base MSS of 1024
+	// bytes, then at half of it as that doesn't get through either.
+	for i, want := range []struct {
+		size       int
+		blackHoles uint64
+	}{
+		{maxPayload, 0},
+		{maxPayload, 0},
+		{maxPayload, 0},
+		{maxPayload, 0},
+		{1024, 1},
+		{512, 2},
+	} {
+		checker.IPv4(t, c.GetPacket(),
+			checker.PayloadLen(want.size+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)+1),
+				checker.TCPAckNum(790),
+			),
+		)
+		if t.Failed() {
+			t.Fatalf("unexpected packet #%d", i+1)
+		}
+		if got := c.Stack().Stats().TCP.MTUBlackHoles.Value(); got != want.blackHoles {
+			t.Fatalf("got stats.TCP.MTUBlackHoles.Value() = %d after packet #%d, want = %d", got, i+1, want.blackHoles)
+		}
+	}
+}
+
 func TestSetTTL(t *testing.T) {
 	for _, wantTTL := range []uint8{1, 2, 50, 64, 128, 254, 255} {
 		t.Run(fmt.Sprintf("TTL:%d", wantTTL), func(t *testing.T) {
@@ -3406,6 +4123,83 @@ func TestRetransmitIPv4IDUniqueness(t *testing.T) {
 	}
 }
 
+// TestRetransmitManualClock tests that the retransmission timer and the RTT
+// measurements follow the clock of the stack, so that they can be driven
+// without waiting for real time to elapse.
+func TestRetransmitManualClock(t *testing.T) {
+	clock := faketime.NewManualClock()
+	c := context.NewWithOpts(t, context.Options{
+		EnableV4: true,
+		EnableV6: true,
+		MTU:      defaultMTU,
+		Clock:    clock,
+	})
+	defer c.Cleanup()
+
+	c.CreateConnected(789 /* iss */, 30000 /* rcvWnd */, -1 /* epRcvBuf */)
+
+	view := buffer.NewView(10)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	checkData := func(seq seqnum.Value) {
+		t.Helper()
+		checker.IPv4(t, c.GetPacket(),
+			checker.PayloadLen(len(view)+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(seq)),
+				checker.TCPAckNum(790),
+			),
+		)
+	}
+	ack := func(seq seqnum.Value) {
+		c.SendPacket(nil, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  790,
+			AckNum:  seq,
+			RcvWnd:  30000,
+		})
+	}
+	next := c.IRS.Add(1)
+	checkData(next)
+
+	// The initial RTO is a second, which doesn't elapse until the clock is
+	// advanced.
+	c.CheckNoPacketTimeout("data retransmitted before the clock advanced", 100*time.Millisecond)
+	clock.Advance(time.Second - 10*time.Millisecond)
+	c.CheckNoPacketTimeout("data retransmitted before the RTO elapsed", 100*time.Millisecond)
+	clock.Advance(20 * time.Millisecond)
+	checkData(next)
+	if got := c.Stack().Stats().TCP.Timeouts.Value(); got != 1 {
+		t.Errorf("got c.Stack().Stats().TCP.Timeouts.Value() = %d, want = 1", got)
+	}
+	next = next.Add(seqnum.Size(len(view)))
+	ack(next)
+
+	// The RTT of data which wasn't retransmitted is measured with the
+	// clock.
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	checkData(next)
+	const rtt = 300 * time.Millisecond
+	clock.Advance(rtt)
+	ack(next.Add(seqnum.Size(len(view))))
+	// Wait for the ACK to be processed.
+	c.CheckNoPacketTimeout("unexpected packet", 100*time.Millisecond)
+
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("c.EP.GetSockOpt(&%T): %s", info, err)
+	}
+	if info.RTT != rtt {
+		t.Errorf("got RTT = %s, want = %s", info.RTT, rtt)
+	}
+}
+
 func TestFinImmediately(t *testing.T) {
 	c := context.New(t, defaultMTU)
 	defer c.Cleanup()
@@ -4019,6 +4813,67 @@ func TestReceivedIncorrectChecksumIncrement(t *testing.T) {
 	}
 }
 
+func TestIncorrectChecksumEvent(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+	c.Stack().ClearEvents()
+
+	vv := c.BuildSegment([]byte{0x1, 0x2, 0x3}, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  seqnum.Value(790),
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+	tcpbuf := vv.ToView()[header.IPv4MinimumSize:]
+	tcpbuf[(tcpbuf[header.TCPDataOffset]>>4)*4] = 0x4
+	c.SendSegment(vv)
+
+	events := c.Stack().Events()
+	if len(events) != 1 {
+		t.Fatalf("got c.Stack().Events() = %v, want a single event", events)
+	}
+	e := events[0]
+	if e.Kind != stack.EventChecksumError || e.Protocol != uint32(tcp.ProtocolNumber) || e.Source.Addr != context.TestAddr || e.Source.Port != context.TestPort {
+		t.Errorf("got event = %s, want %s from %s:%d", e, stack.EventChecksumError, context.TestAddr, context.TestPort)
+	}
+}
+
+func TestResetStormEvent(t *testing.T) {
+	// A manual clock, so that all the resets are received within a second.
+	c := context.NewWithOpts(t, context.Options{
+		EnableV4: true,
+		EnableV6: true,
+		MTU:      defaultMTU,
+		Clock:    faketime.NewManualClock(),
+	})
+	defer c.Cleanup()
+	c.Stack().ClearEvents()
+
+	// Resets to a closed port are counted too; no endpoint is needed. The
+	// 100th one received within a second makes a storm.
+	for i := 0; i < 150; i++ {
+		c.SendPacket(nil, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: context.StackPort,
+			Flags:   header.TCPFlagRst,
+			SeqNum:  seqnum.Value(i),
+		})
+	}
+
+	var storms int
+	for _, e := range c.Stack().Events() {
+		if e.Kind == stack.EventResetStorm {
+			storms++
+		}
+	}
+	if storms != 1 {
+		t.Errorf("got %d reset storm events, want = 1; events: %v", storms, c.Stack().Events())
+	}
+}
+
 func TestReceivedSegmentQueuing(t *testing.T) {
 	// This test sends 200 segments containing a few bytes each to an
 	// endpoint and checks that they're all received and acknowledged by
@@ -4148,7 +5003,7 @@ func TestReadAfterClosedState(t *testing.T) {
 
 	// Check that peek works.
 	peekBuf := make([]byte, 10)
-	n, _, err := c.EP.Peek([][]byte{peekBuf})
+	n, _, err := c.EP.Peek([][]byte{peekBuf}, 0 /* off */, nil /* addr */)
 	if err != nil {
 		t.Fatalf("Peek failed: %s", err)
 	}
@@ -4158,6 +5013,17 @@ func TestReadAfterClosedState(t *testing.T) {
 		t.Fatalf("got data = %v, want = %v", peekBuf, data)
 	}
 
+	// Check that peek works from an offset.
+	const off = 1
+	offBuf := make([]byte, 10)
+	n, _, err = c.EP.Peek([][]byte{offBuf}, off, nil /* addr */)
+	if err != nil {
+		t.Fatalf("Peek at offset %d failed: %s", off, err)
+	}
+	if got, want := offBuf[:n], data[off:]; !bytes.Equal(got, want) {
+		t.Fatalf("got data at offset %d = %v, want = %v", off, got, want)
+	}
+
 	// Receive data.
 	v, _, err := c.EP.Read(nil)
 	if err != nil {
@@ -4174,7 +5040,7 @@ func TestReadAfterClosedState(t *testing.T) {
 		t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrClosedForReceive)
 	}
 
-	if _, _, err := c.EP.Peek([][]byte{peekBuf}); err != tcpip.ErrClosedForReceive {
+	if _, _, err := c.EP.Peek([][]byte{peekBuf}, 0 /* off */, nil /* addr */); err != tcpip.ErrClosedForReceive {
 		t.Fatalf("got c.EP.Peek(...) = %s, want = %s", err, tcpip.ErrClosedForReceive)
 	}
 }
@@ -4386,72 +5252,241 @@ func TestMinMaxBufferSizes(t *testing.T) {
 		t.Fatalf("SetSockOptInt(SendBufferSizeOption, 299) failed: %s", err)
 	}
 
-	checkSendBufferSize(t, ep, 300)
+	checkSendBufferSize(t, ep, 300)
+
+	// Set values above the max.
+	if err := ep.SetSockOptInt(tcpip.ReceiveBufferSizeOption, 1+tcp.DefaultReceiveBufferSize*20); err != nil {
+		t.Fatalf("SetSockOptInt(ReceiveBufferSizeOption) failed: %s", err)
+	}
+
+	// Values above max are capped at max and then doubled.
+	checkRecvBufferSize(t, ep, tcp.DefaultReceiveBufferSize*20*2)
+
+	if err := ep.SetSockOptInt(tcpip.SendBufferSizeOption, 1+tcp.DefaultSendBufferSize*30); err != nil {
+		t.Fatalf("SetSockOptInt(SendBufferSizeOption) failed: %s", err)
+	}
+
+	// Values above max are capped at max and then doubled.
+	checkSendBufferSize(t, ep, tcp.DefaultSendBufferSize*30*2)
+}
+
+func TestBindToDeviceOption(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol}})
+
+	ep, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("NewEndpoint failed; %s", err)
+	}
+	defer ep.Close()
+
+	if err := s.CreateNIC(321, loopback.New()); err != nil {
+		t.Errorf("CreateNIC failed: %s", err)
+	}
+
+	// nicIDPtr is used instead of taking the address of NICID literals, which is
+	// a compiler error.
+	nicIDPtr := func(s tcpip.NICID) *tcpip.NICID {
+		return &s
+	}
+
+	testActions := []struct {
+		name                 string
+		setBindToDevice      *tcpip.NICID
+		setBindToDeviceError *tcpip.Error
+		getBindToDevice      tcpip.BindToDeviceOption
+	}{
+		{"GetDefaultValue", nil, nil, 0},
+		{"BindToNonExistent", nicIDPtr(999), tcpip.ErrUnknownDevice, 0},
+		{"BindToExistent", nicIDPtr(321), nil, 321},
+		{"UnbindToDevice", nicIDPtr(0), nil, 0},
+	}
+	for _, testAction := range testActions {
+		t.Run(testAction.name, func(t *testing.T) {
+			if testAction.setBindToDevice != nil {
+				bindToDevice := tcpip.BindToDeviceOption(*testAction.setBindToDevice)
+				if gotErr, wantErr := ep.SetSockOpt(&bindToDevice), testAction.setBindToDeviceError; gotErr != wantErr {
+					t.Errorf("got SetSockOpt(&%T(%d)) = %s, want = %s", bindToDevice, bindToDevice, gotErr, wantErr)
+				}
+			}
+			bindToDevice := tcpip.BindToDeviceOption(88888)
+			if err := ep.GetSockOpt(&bindToDevice); err != nil {
+				t.Errorf("GetSockOpt(&%T): %s", bindToDevice, err)
+			} else if bindToDevice != testAction.getBindToDevice {
+				t.Errorf("got bindToDevice = %d, want %d", bindToDevice, testAction.getBindToDevice)
+			}
+		})
+	}
+}
+
+func TestFreeBind(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+
+	const unassignedAddr = tcpip.Address("\x0a\x00\x00\x63")
+	addr := tcpip.FullAddress{Addr: unassignedAddr, Port: context.StackPort}
+	if err := c.EP.Bind(addr); err != tcpip.ErrBadLocalAddress {
+		t.Fatalf("got c.EP.Bind(%+v) = %v, want = %s", addr, err, tcpip.ErrBadLocalAddress)
+	}
+
+	c.EP.SocketOptions().SetFreeBind(true)
+	if err := c.EP.Bind(addr); err != nil {
+		t.Fatalf("c.EP.Bind(%+v): %s", addr, err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("c.EP.Listen(10): %s", err)
+	}
+	got, err := c.EP.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("c.EP.GetLocalAddress(): %s", err)
+	}
+	if got != addr {
+		t.Errorf("got c.EP.GetLocalAddress() = %+v, want = %+v", got, addr)
+	}
+}
+
+func TestBindAddressNoPort(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+	c.EP.SocketOptions().SetBindAddressNoPort(true)
+
+	addr := tcpip.FullAddress{Addr: context.StackAddr}
+	if err := c.EP.Bind(addr); err != nil {
+		t.Fatalf("c.EP.Bind(%+v): %s", addr, err)
+	}
+	// The port is only picked on connect.
+	got, err := c.EP.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("c.EP.GetLocalAddress(): %s", err)
+	}
+	if got.Addr != context.StackAddr || got.Port != 0 {
+		t.Errorf("got c.EP.GetLocalAddress() = %+v, want address %s and port 0", got, context.StackAddr)
+	}
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("unexpected return value from Connect: %s", err)
+	}
+	b := c.GetPacket()
+	checker.IPv4(t, b,
+		checker.SrcAddr(context.StackAddr),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPFlags(header.TCPFlagSyn),
+		),
+	)
+	port := header.TCP(header.IPv4(b).Payload()).SourcePort()
+	if port == 0 {
+		t.Fatal("got SYN sent from port 0")
+	}
+	got, err = c.EP.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("c.EP.GetLocalAddress(): %s", err)
+	}
+	if got.Addr != context.StackAddr || got.Port != port {
+		t.Errorf("got c.EP.GetLocalAddress() = %+v, want address %s and port %d", got, context.StackAddr, port)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
 
-	// Set values above the max.
-	if err := ep.SetSockOptInt(tcpip.ReceiveBufferSizeOption, 1+tcp.DefaultReceiveBufferSize*20); err != nil {
-		t.Fatalf("SetSockOptInt(ReceiveBufferSizeOption) failed: %s", err)
+	c.Create(-1)
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("c.EP.Bind(_): %s", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("c.EP.Listen(10): %s", err)
 	}
 
-	// Values above max are capped at max and then doubled.
-	checkRecvBufferSize(t, ep, tcp.DefaultReceiveBufferSize*20*2)
-
-	if err := ep.SetSockOptInt(tcpip.SendBufferSizeOption, 1+tcp.DefaultSendBufferSize*30); err != nil {
-		t.Fatalf("SetSockOptInt(SendBufferSizeOption) failed: %s", err)
+	// The test context sends packets with a TTL of 65.
+	syn := &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  seqnum.Value(789),
+		RcvWnd:  30000,
+	}
+	c.EP.SocketOptions().SetMinTTL(66)
+	c.SendPacket(nil, syn)
+	c.CheckNoPacket("got a SYN-ACK for a SYN with a TTL below the minimum")
+	if got := c.Stack().Stats().TCP.MinTTLDrops.Value(); got != 1 {
+		t.Errorf("got MinTTLDrops = %d, want = 1", got)
 	}
 
-	// Values above max are capped at max and then doubled.
-	checkSendBufferSize(t, ep, tcp.DefaultSendBufferSize*30*2)
+	c.EP.SocketOptions().SetMinTTL(65)
+	c.SendPacket(nil, syn)
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.SrcPort(context.StackPort),
+			checker.TCPFlags(header.TCPFlagSyn|header.TCPFlagAck),
+		),
+	)
 }
 
-func TestBindToDeviceOption(t *testing.T) {
-	s := stack.New(stack.Options{
-		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
-		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol}})
+func TestSendQueueSize(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
 
-	ep, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
-	if err != nil {
-		t.Fatalf("NewEndpoint failed; %s", err)
-	}
-	defer ep.Close()
+	c.CreateConnected(789 /* iss */, 0 /* rcvWnd */, -1 /* epRcvBuf */)
 
-	if err := s.CreateNIC(321, loopback.New()); err != nil {
-		t.Errorf("CreateNIC failed: %s", err)
+	checkQueueSizes := func(wantQueued, wantUnsent int) {
+		t.Helper()
+		if err := testutil.Poll(func() error {
+			if got, err := c.EP.GetSockOptInt(tcpip.SendQueueSizeOption); err != nil || got != wantQueued {
+				return fmt.Errorf("got GetSockOptInt(tcpip.SendQueueSizeOption) = (%d, %v), want = (%d, nil)", got, err, wantQueued)
+			}
+			if got, err := c.EP.GetSockOptInt(tcpip.SendQueueUnsentSizeOption); err != nil || got != wantUnsent {
+				return fmt.Errorf("got GetSockOptInt(tcpip.SendQueueUnsentSizeOption) = (%d, %v), want = (%d, nil)", got, err, wantUnsent)
+			}
+			return nil
+		}, 1*time.Second); err != nil {
+			t.Error(err)
+		}
 	}
 
-	// nicIDPtr is used instead of taking the address of NICID literals, which is
-	// a compiler error.
-	nicIDPtr := func(s tcpip.NICID) *tcpip.NICID {
-		return &s
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
 	}
 
-	testActions := []struct {
-		name                 string
-		setBindToDevice      *tcpip.NICID
-		setBindToDeviceError *tcpip.Error
-		getBindToDevice      tcpip.BindToDeviceOption
-	}{
-		{"GetDefaultValue", nil, nil, 0},
-		{"BindToNonExistent", nicIDPtr(999), tcpip.ErrUnknownDevice, 0},
-		{"BindToExistent", nicIDPtr(321), nil, 321},
-		{"UnbindToDevice", nicIDPtr(0), nil, 0},
-	}
-	for _, testAction := range testActions {
-		t.Run(testAction.name, func(t *testing.T) {
-			if testAction.setBindToDevice != nil {
-				bindToDevice := tcpip.BindToDeviceOption(*testAction.setBindToDevice)
-				if gotErr, wantErr := ep.SetSockOpt(&bindToDevice), testAction.setBindToDeviceError; gotErr != wantErr {
-					t.Errorf("got SetSockOpt(&%T(%d)) = %s, want = %s", bindToDevice, bindToDevice, gotErr, wantErr)
-				}
-			}
-			bindToDevice := tcpip.BindToDeviceOption(88888)
-			if err := ep.GetSockOpt(&bindToDevice); err != nil {
-				t.Errorf("GetSockOpt(&%T): %s", bindToDevice, err)
-			} else if bindToDevice != testAction.getBindToDevice {
-				t.Errorf("got bindToDevice = %d, want %d", bindToDevice, testAction.getBindToDevice)
-			}
-		})
-	}
+	// The peer has a zero window, so only a probe is sent.
+	checker.IPv4(t, c.GetPacket(),
+		checker.PayloadLen(header.TCPMinimumSize),
+		checker.TCP(checker.TCPSeqNum(uint32(c.IRS))),
+	)
+	checkQueueSizes(len(data), len(data))
+
+	// Open the window for the data to be sent.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+	checker.IPv4(t, c.GetPacket(),
+		checker.PayloadLen(len(data)+header.TCPMinimumSize),
+		checker.TCP(checker.TCPSeqNum(uint32(c.IRS)+1)),
+	)
+	checkQueueSizes(len(data), 0)
+
+	// Acknowledged data leaves the send queue.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	checkQueueSizes(0, 0)
 }
 
 func makeStack() (*stack.Stack, *tcpip.Error) {
@@ -5303,6 +6338,60 @@ func TestListenBacklogFull(t *testing.T) {
 	}
 }
 
+// TestListenBacklogFullConcurrentSyns tests that the listen backlog is enforced
+// when connection requests are handled concurrently by the listener shards.
+func TestListenBacklogFullConcurrentSyns(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	// Create TCP endpoint.
+	var err *tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+
+	// Bind to wildcard.
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+
+	// Start listening.
+	const listenBacklog = 10
+	if err := c.EP.Listen(listenBacklog); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+
+	// Send more SYNs than the backlog allows at once, from different ports
+	// so that they are spread over the listener shards.
+	const synCount = 4 * listenBacklog
+	stats := c.Stack().Stats()
+	want := stats.TCP.ListenOverflowSynDrop.Value() + synCount - listenBacklog
+	for i := 0; i < synCount; i++ {
+		c.SendPacket(nil, &context.Headers{
+			SrcPort: context.TestPort + uint16(i),
+			DstPort: context.StackPort,
+			Flags:   header.TCPFlagSyn,
+			SeqNum:  seqnum.Value(789),
+			RcvWnd:  30000,
+		})
+	}
+
+	// Only as many SYNs as the backlog allows must be answered.
+	for i := 0; i < listenBacklog; i++ {
+		checker.IPv4(t, c.GetPacket(), checker.TCP(
+			checker.SrcPort(context.StackPort),
+			checker.TCPFlags(header.TCPFlagAck|header.TCPFlagSyn),
+			checker.TCPAckNum(790),
+		))
+	}
+	c.CheckNoPacketTimeout("unexpected packet received", 50*time.Millisecond)
+
+	if got := stats.TCP.ListenOverflowSynDrop.Value(); got != want {
+		t.Errorf("got stats.TCP.ListenOverflowSynDrop.Value() = %d, want = %d", got, want)
+	}
+}
+
 // TestListenNoAcceptMulticastBroadcastV4 makes sure that TCP segments with a
 // non unicast IPv4 address are not accepted.
 func TestListenNoAcceptNonUnicastV4(t *testing.T) {
@@ -5697,6 +6786,76 @@ func TestListenBacklogFullSynCookieInUse(t *testing.T) {
 	}
 }
 
+func TestListenBacklogFullAbortOnOverflow(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	opt := tcpip.TCPSynRcvdCountThresholdOption(1)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+	abort := tcpip.TCPAbortOnOverflowOption(true)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &abort); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%t)): %s", tcp.ProtocolNumber, abort, abort, err)
+	}
+
+	// Create TCP endpoint.
+	var err *tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+
+	// Bind to wildcard.
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+
+	// Start listening.
+	listenBacklog := 1
+	if err := c.EP.Listen(listenBacklog); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+
+	executeHandshake(t, c, context.TestPort, false)
+	// Wait for this to be delivered to the accept queue.
+	time.Sleep(50 * time.Millisecond)
+
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %s", info, err)
+	}
+	if info.AcceptQueueLen != 1 || info.Backlog != listenBacklog {
+		t.Errorf("got AcceptQueueLen = %d, Backlog = %d, want = 1, %d", info.AcceptQueueLen, info.Backlog, listenBacklog)
+	}
+
+	// Send an ACK completing a handshake, as if it were for a SYN cookie,
+	// while the accept queue is full.
+	overflows := c.Stack().Stats().TCP.ListenOverflows.Value()
+	irs := seqnum.Value(789)
+	ackNum := seqnum.Value(1000)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort + 1,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  irs + 1,
+		AckNum:  ackNum,
+		RcvWnd:  30000,
+	})
+
+	// The connection should be reset rather than silently dropped.
+	checker.IPv4(t, c.GetPacket(), checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(context.TestPort+1),
+		checker.TCPSeqNum(uint32(ackNum)),
+		checker.TCPAckNum(0),
+		checker.TCPFlags(header.TCPFlagRst)))
+
+	if got, want := c.Stack().Stats().TCP.ListenOverflows.Value(), overflows+1; got != want {
+		t.Errorf("got stats.TCP.ListenOverflows.Value() = %d, want = %d", got, want)
+	}
+}
+
 func TestSYNRetransmit(t *testing.T) {
 	c := context.New(t, defaultMTU)
 	defer c.Cleanup()
@@ -7291,6 +8450,115 @@ func TestKeepaliveWithUserTimeout(t *testing.T) {
 	}
 }
 
+// TestPauseTimersKeepalive tests that the keepalive timer doesn't fire while
+// the timers of the stack are paused, and that the time spent paused doesn't
+// count towards the user timeout.
+func TestPauseTimersKeepalive(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	const keepAliveInterval = 100 * time.Millisecond
+	keepAliveIdleOption := tcpip.KeepaliveIdleOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIdleOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIdleOption, keepAliveInterval, err)
+	}
+	keepAliveIntervalOption := tcpip.KeepaliveIntervalOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIntervalOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIntervalOption, keepAliveInterval, err)
+	}
+	const userTimeout = 5 * keepAliveInterval
+	userTimeoutOption := tcpip.TCPUserTimeoutOption(userTimeout)
+	if err := c.EP.SetSockOpt(&userTimeoutOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", userTimeoutOption, userTimeout, err)
+	}
+
+	origEstablishedTimedout := c.Stack().Stats().TCP.EstablishedTimedout.Value()
+	c.Stack().PauseTimers()
+	c.EP.SocketOptions().SetKeepAlive(true)
+
+	// No keepalive is sent while paused, even past the user timeout.
+	c.CheckNoPacketTimeout("keepalive sent while the timers are paused", 2*userTimeout)
+	c.Stack().ResumeTimers()
+
+	// Unacknowledged keepalives are sent until the user timeout expires,
+	// the time spent paused aside.
+	for i := 0; i < 2; i++ {
+		checker.IPv4(t, c.GetPacket(),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)),
+				checker.TCPAckNum(uint32(790)),
+				checker.TCPFlags(header.TCPFlagAck),
+			),
+		)
+	}
+	if got := c.Stack().Stats().TCP.EstablishedTimedout.Value(); got != origEstablishedTimedout {
+		t.Errorf("got c.Stack().Stats().TCP.EstablishedTimedout = %d, want = %d", got, origEstablishedTimedout)
+	}
+}
+
+// TestUserTimeoutOverridesKeepaliveCount tests that the keepalive probe count
+// doesn't apply when a user timeout is set, and that the probes are reported
+// by TCPInfoOption.
+func TestUserTimeoutOverridesKeepaliveCount(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, -1 /* epRcvBuf */)
+
+	const keepAliveInterval = 100 * time.Millisecond
+	keepAliveIdleOption := tcpip.KeepaliveIdleOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIdleOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIdleOption, keepAliveInterval, err)
+	}
+	keepAliveIntervalOption := tcpip.KeepaliveIntervalOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIntervalOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIntervalOption, keepAliveInterval, err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 1); err != nil {
+		t.Fatalf("c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 1): %s", err)
+	}
+	userTimeout := tcpip.TCPUserTimeoutOption(time.Minute)
+	if err := c.EP.SetSockOpt(&userTimeout); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", userTimeout, time.Duration(userTimeout), err)
+	}
+	c.EP.SocketOptions().SetKeepAlive(true)
+
+	// Without the user timeout, the connection would be aborted after the
+	// first unacknowledged probe.
+	const probes = 3
+	for i := 0; i < probes; i++ {
+		checker.IPv4(t, c.GetPacket(),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)),
+				checker.TCPAckNum(uint32(790)),
+				checker.TCPFlags(header.TCPFlagAck),
+			),
+		)
+	}
+
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("c.EP.GetSockOpt(&%T): %s", info, err)
+	}
+	if info.KeepaliveProbesSent < probes {
+		t.Errorf("got info.KeepaliveProbesSent = %d, want >= %d", info.KeepaliveProbesSent, probes)
+	}
+	if info.Probes < probes {
+		t.Errorf("got info.Probes = %d, want >= %d", info.Probes, probes)
+	}
+	if info.LastAckRecv < probes*keepAliveInterval {
+		t.Errorf("got info.LastAckRecv = %s, want >= %s", info.LastAckRecv, probes*keepAliveInterval)
+	}
+
+	if _, _, err := c.EP.Read(nil); err != tcpip.ErrWouldBlock {
+		t.Fatalf("got c.EP.Read(nil) = %s, want = %s", err, tcpip.ErrWouldBlock)
+	}
+}
+
 func TestIncreaseWindowOnRead(t *testing.T) {
 	// This test ensures that the endpoint sends an ack,
 	// after read() when the window grows by more than 1 MSS.
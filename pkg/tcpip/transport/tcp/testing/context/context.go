@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/checker"
@@ -122,14 +123,19 @@ type Options struct {
 
 	// MTU indicates the maximum transmission unit on the link layer.
 	MTU uint32
+
+	// Clock is the clock of the stack. If nil, the stack uses the time
+	// package.
+	Clock tcpip.Clock
 }
 
 // Context provides an initialized Network stack and a link layer endpoint
 // for use in TCP tests.
 type Context struct {
-	t      *testing.T
-	linkEP *channel.Endpoint
-	s      *stack.Stack
+	t        *testing.T
+	linkEP   *channel.Endpoint
+	recorder *batchRecorder
+	s        *stack.Stack
 
 	// IRS holds the initial sequence number in the SYN sent by endpoint in
 	// case of an active connect or the sequence number sent by the endpoint
@@ -182,6 +188,7 @@ func NewWithOpts(t *testing.T, opts Options) *Context {
 
 	stackOpts := stack.Options{
 		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+		Clock:              opts.Clock,
 	}
 	if opts.EnableV4 {
 		stackOpts.NetworkProtocols = append(stackOpts.NetworkProtocols, ipv4.NewProtocol)
@@ -215,9 +222,10 @@ func NewWithOpts(t *testing.T, opts Options) *Context {
 	// Some of the congestion control tests send up to 640 packets, we so
 	// set the channel size to 1000.
 	ep := channel.New(1000, opts.MTU, "")
-	wep := stack.LinkEndpoint(ep)
+	recorder := &batchRecorder{LinkEndpoint: ep}
+	wep := stack.LinkEndpoint(recorder)
 	if testing.Verbose() {
-		wep = sniffer.New(ep)
+		wep = sniffer.New(recorder)
 	}
 	nicOpts := stack.NICOptions{Name: "nic1"}
 	if err := s.CreateNICWithOptions(1, wep, nicOpts); err != nil {
@@ -268,6 +276,7 @@ func NewWithOpts(t *testing.T, opts Options) *Context {
 		t:           t,
 		s:           s,
 		linkEP:      ep,
+		recorder:    recorder,
 		WindowScale: uint8(tcp.FindWndScale(recvBufferSize)),
 	}
 }
@@ -285,6 +294,45 @@ func (c *Context) Stack() *stack.Stack {
 	return c.s
 }
 
+// WritePacketsBatches returns the number of packets in each call to
+// WritePackets made on the link endpoint so far.
+func (c *Context) WritePacketsBatches() []int {
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	return append([]int(nil), c.recorder.batches...)
+}
+
+// FailNextWritePackets makes the next call to WritePackets on the link
+// endpoint drop its packets and return err.
+func (c *Context) FailNextWritePackets(err *tcpip.Error) {
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	c.recorder.failNext = err
+}
+
+// batchRecorder is a link endpoint that records the size of each batch of
+// packets written through it.
+type batchRecorder struct {
+	stack.LinkEndpoint
+
+	mu       sync.Mutex
+	batches  []int
+	failNext *tcpip.Error
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+func (b *batchRecorder) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, pkts.Len())
+	err := b.failNext
+	b.failNext = nil
+	b.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return b.LinkEndpoint.WritePackets(r, gso, pkts, protocol)
+}
+
 // CheckNoPacketTimeout verifies that no packet is received during the time
 // specified by wait.
 func (c *Context) CheckNoPacketTimeout(errMsg string, wait time.Duration) {
@@ -29,8 +29,8 @@ const (
 )
 
 // timer is a timer implementation that reduces the interactions with the
-// runtime timer infrastructure by letting timers run (and potentially
-// eventually expire) even if they are stopped. It makes it cheaper to
+// stack's timer wheel by letting timers run (and potentially eventually
+// expire) even if they are stopped. It makes it cheaper to
 // disable/reenable timers at the expense of spurious wakes. This is useful for
 // cases when the same timer is disabled/reenabled repeatedly with relatively
 // long timeouts farther into the future.
@@ -39,20 +39,20 @@ const (
 // (currently at least 200ms), and get disabled when acks are received, and
 // reenabled when new pending segments are sent.
 //
-// It is advantageous to avoid interacting with the runtime because it acquires
-// a global mutex and performs O(log n) operations, where n is the global number
-// of timers, whenever a timer is enabled or disabled, and may make a syscall.
+// It is advantageous to avoid interacting with the timer wheel because it
+// acquires a mutex shared with other endpoints of the stack whenever a timer
+// is enabled or disabled.
 //
 // This struct is thread-compatible.
 type timer struct {
 	// state is the current state of the timer, it can be one of the
 	// following values:
 	//     disabled - the timer is disabled.
-	//     orphaned - the timer is disabled, but the runtime timer is
+	//     orphaned - the timer is disabled, but the wheel entry is
 	//                enabled, which means that it will evetually cause a
 	//                spurious wake (unless it gets enabled again before
 	//                then).
-	//     enabled  - the timer is enabled, but the runtime timer may be set
+	//     enabled  - the timer is enabled, but the wheel entry may be set
 	//                to an earlier expiration time due to a previous
 	//                orphaned state.
 	state timerState
@@ -61,34 +61,28 @@ type timer struct {
 	// meaningful in the enabled state.
 	target time.Time
 
-	// runtimeTarget is the expiration time of the runtime timer. It is
+	// wheelTarget is the expiration time of the wheel entry. It is
 	// meaningful in the enabled and orphaned states.
-	runtimeTarget time.Time
+	wheelTarget time.Time
 
-	// timer is the runtime timer used to wait on.
-	timer *time.Timer
+	// entry is the wheel entry used to wait on.
+	entry timerWheelEntry
 }
 
-// init initializes the timer. Once it expires, it the given waker will be
-// asserted.
-func (t *timer) init(w *sleep.Waker) {
+// init initializes the timer to run on the given timer wheel. Once it
+// expires, it the given waker will be asserted.
+func (t *timer) init(wheel *timerWheel, w *sleep.Waker) {
 	t.state = timerStateDisabled
-
-	// Initialize a runtime timer that will assert the waker, then
-	// immediately stop it.
-	t.timer = time.AfterFunc(time.Hour, func() {
-		w.Assert()
-	})
-	t.timer.Stop()
+	t.entry.init(wheel, w)
 }
 
 // cleanup frees all resources associated with the timer.
 func (t *timer) cleanup() {
-	if t.timer == nil {
+	if t.entry.shard == nil {
 		// No cleanup needed.
 		return
 	}
-	t.timer.Stop()
+	t.entry.stop()
 	*t = timer{}
 }
 
@@ -105,11 +99,11 @@ func (t *timer) checkExpiration() bool {
 	}
 
 	// The timer is enabled, but it may have expired early. Check if that's
-	// the case, and if so, reset the runtime timer to the correct time.
-	now := time.Now()
+	// the case, and if so, reset the wheel entry to the correct time.
+	now := t.entry.shard.clock.Now()
 	if now.Before(t.target) {
-		t.runtimeTarget = t.target
-		t.timer.Reset(t.target.Sub(now))
+		t.wheelTarget = t.target
+		t.entry.reset(t.target.Sub(now))
 		return false
 	}
 
@@ -132,14 +126,14 @@ func (t *timer) enabled() bool {
 	return t.state == timerStateEnabled
 }
 
-// enable enables the timer, programming the runtime timer if necessary.
+// enable enables the timer, programming the wheel entry if necessary.
 func (t *timer) enable(d time.Duration) {
-	t.target = time.Now().Add(d)
+	t.target = t.entry.shard.clock.Now().Add(d)
 
-	// Check if we need to set the runtime timer.
-	if t.state == timerStateDisabled || t.target.Before(t.runtimeTarget) {
-		t.runtimeTarget = t.target
-		t.timer.Reset(d)
+	// Check if we need to set the wheel entry.
+	if t.state == timerStateDisabled || t.target.Before(t.wheelTarget) {
+		t.wheelTarget = t.target
+		t.entry.reset(d)
 	}
 
 	t.state = timerStateEnabled
@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 )
 
 func TestCleanup(t *testing.T) {
@@ -27,9 +29,13 @@ func TestCleanup(t *testing.T) {
 		isAssertedTimeoutSeconds = timerDurationSeconds + 1
 	)
 
+	var wheel timerWheel
+	wheel.init(&tcpip.StdClock{})
+	defer wheel.close()
+
 	tmr := timer{}
 	w := sleep.Waker{}
-	tmr.init(&w)
+	tmr.init(&wheel, &w)
 	tmr.enable(timerDurationSeconds * time.Second)
 	tmr.cleanup()
 
@@ -45,3 +51,157 @@ func TestCleanup(t *testing.T) {
 		}
 	}
 }
+
+func TestTimerWheelNext(t *testing.T) {
+	for _, clk := range []uint64{0, 1, 63, 64, 1000, 123456789} {
+		for _, delta := range []uint64{1, 2, 62, 63, 64, 100, 503, 504, 4000, 60000, 7200000, 1 << 40} {
+			var wheel timerWheel
+			wheel.init(faketime.NewManualClock())
+			shard := &wheel.shards[0]
+			shard.clk = clk
+			var e timerWheelEntry
+			e.init(&wheel, &sleep.Waker{})
+			e.shard = shard
+			e.expires = clk + delta
+			shard.insertLocked(&e)
+
+			next, ok := shard.nextLocked()
+			if !ok {
+				t.Fatalf("clk=%d delta=%d: nextLocked() = (_, false), want = (_, true)", clk, delta)
+			}
+			// The entry's bucket must be visited after the current tick
+			// and no later than the entry expires, so that it can be
+			// cascaded to a finer level in time.
+			if next <= clk || next > e.expires {
+				t.Errorf("clk=%d delta=%d: got next = %d, want in (%d, %d]", clk, delta, next, clk, e.expires)
+			}
+
+			shard.removeLocked(&e)
+			if _, ok := shard.nextLocked(); ok {
+				t.Errorf("clk=%d delta=%d: nextLocked() = (_, true) after removal, want = (_, false)", clk, delta)
+			}
+		}
+	}
+}
+
+// newTestTimerWheel returns a timer wheel with a single shard, driven by a
+// manual clock.
+func newTestTimerWheel() (*timerWheel, *faketime.ManualClock) {
+	clock := faketime.NewManualClock()
+	var wheel timerWheel
+	wheel.init(clock)
+	wheel.shards = wheel.shards[:1]
+	return &wheel, clock
+}
+
+func TestTimerWheelFires(t *testing.T) {
+	wheel, clock := newTestTimerWheel()
+	defer wheel.close()
+
+	durations := []time.Duration{
+		10 * time.Millisecond,
+		30 * time.Millisecond,
+		100 * time.Millisecond,
+		250 * time.Millisecond,
+		3 * time.Second,
+		10 * time.Minute,
+	}
+	wakers := make([]sleep.Waker, len(durations))
+	entries := make([]timerWheelEntry, len(durations))
+	// Schedule the timers in reverse order to make sure firing order
+	// doesn't depend on insertion order.
+	for i := len(durations) - 1; i >= 0; i-- {
+		entries[i].init(wheel, &wakers[i])
+		entries[i].reset(durations[i])
+	}
+
+	// A stopped entry must not fire.
+	var stoppedWaker sleep.Waker
+	var stopped timerWheelEntry
+	stopped.init(wheel, &stoppedWaker)
+	stopped.reset(20 * time.Millisecond)
+	stopped.stop()
+
+	var elapsed time.Duration
+	for i, d := range durations {
+		// Timers must not fire even a tick early.
+		clock.Advance(d - timerWheelTick - elapsed)
+		elapsed = d - timerWheelTick
+		for j := i; j < len(durations); j++ {
+			if wakers[j].IsAsserted() {
+				t.Fatalf("timer %d (%s) fired after %s", j, durations[j], elapsed)
+			}
+		}
+
+		// Cascading must make timers fire on time, whatever their
+		// duration.
+		clock.Advance(timerWheelTick)
+		elapsed = d
+		if !wakers[i].IsAsserted() {
+			t.Fatalf("timer %d (%s) didn't fire after %s", i, d, elapsed)
+		}
+	}
+	if stoppedWaker.IsAsserted() {
+		t.Errorf("stopped timer fired")
+	}
+}
+
+func TestTimerWheelClose(t *testing.T) {
+	wheel, clock := newTestTimerWheel()
+
+	// Timers queued when the wheel is closed still fire on time.
+	var queuedWaker sleep.Waker
+	var queued timerWheelEntry
+	queued.init(wheel, &queuedWaker)
+	queued.reset(time.Second)
+
+	wheel.close()
+
+	// Timers scheduled after the wheel is closed too.
+	var lateWaker sleep.Waker
+	var late timerWheelEntry
+	late.init(wheel, &lateWaker)
+	late.reset(2 * time.Second)
+
+	// But not once stopped.
+	var stoppedWaker sleep.Waker
+	var stopped timerWheelEntry
+	stopped.init(wheel, &stoppedWaker)
+	stopped.reset(time.Second)
+	stopped.stop()
+
+	clock.Advance(time.Second - timerWheelTick)
+	if queuedWaker.IsAsserted() {
+		t.Fatalf("queued timer fired early")
+	}
+	clock.Advance(timerWheelTick)
+	if !queuedWaker.IsAsserted() {
+		t.Errorf("queued timer didn't fire after the wheel was closed")
+	}
+	clock.Advance(time.Second)
+	if !lateWaker.IsAsserted() {
+		t.Errorf("timer reset after the wheel was closed didn't fire")
+	}
+	if stoppedWaker.IsAsserted() {
+		t.Errorf("stopped timer fired")
+	}
+}
+
+func TestTimerWheelShards(t *testing.T) {
+	var wheel timerWheel
+	wheel.init(faketime.NewManualClock())
+	defer wheel.close()
+
+	// Entries are spread evenly over the shards.
+	counts := make(map[*timerWheelShard]int)
+	entries := make([]timerWheelEntry, 4*len(wheel.shards))
+	for i := range entries {
+		entries[i].init(&wheel, &sleep.Waker{})
+		counts[entries[i].shard]++
+	}
+	for i := range wheel.shards {
+		if got, want := counts[&wheel.shards[i]], 4; got != want {
+			t.Errorf("got %d entries on shard %d, want = %d", got, i, want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"math/bits"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// timerWheelTick is the resolution of the timer wheel.
+	timerWheelTick = time.Millisecond
+
+	// timerWheelSlotBits is log2 of the number of slots in each level of
+	// the timer wheel.
+	timerWheelSlotBits = 6
+	timerWheelSlots    = 1 << timerWheelSlotBits
+	timerWheelSlotMask = timerWheelSlots - 1
+
+	// timerWheelLevelShift is log2 of the ratio between the granularities
+	// of consecutive levels of the timer wheel.
+	timerWheelLevelShift = 3
+
+	// timerWheelLevels is the number of levels in the timer wheel. With the
+	// parameters above, the last level covers timeouts of up to ~36 hours;
+	// longer timeouts are parked there and rescheduled when visited.
+	timerWheelLevels = 8
+
+	// maxTimerWheelShards bounds the number of shards of a timer wheel.
+	maxTimerWheelShards = 16
+)
+
+// timerWheelEntry is a timer scheduled on a timerWheel. shard and waker are
+// immutable after init; all other fields are protected by shard.mu.
+type timerWheelEntry struct {
+	timerWheelEntryEntry
+
+	// shard is the shard of the wheel the entry is scheduled on.
+	shard *timerWheelShard
+
+	// expires is the wheel tick at or after which the entry fires.
+	expires uint64
+
+	// level and slot identify the bucket the entry is queued on. level is
+	// -1 if the entry is not queued.
+	level int
+	slot  int
+
+	// fallback, if not nil, is a clock timer of the entry's own that stands
+	// in for the wheel once the wheel has been closed.
+	fallback tcpip.Timer
+
+	// waker is asserted when the entry fires.
+	waker *sleep.Waker
+}
+
+// init initializes the entry to be scheduled on w, so that waker is asserted
+// when it fires.
+func (e *timerWheelEntry) init(w *timerWheel, waker *sleep.Waker) {
+	e.shard = w.nextShard()
+	e.level = -1
+	e.waker = waker
+}
+
+// reset (re)schedules e to fire after d has elapsed.
+func (e *timerWheelEntry) reset(d time.Duration) {
+	e.shard.reset(e, d)
+}
+
+// stop unschedules e. The shard's clock timer is left running if it was set
+// for e; its eventual firing is then harmless.
+func (e *timerWheelEntry) stop() {
+	s := e.shard
+	s.mu.Lock()
+	s.removeLocked(e)
+	s.mu.Unlock()
+}
+
+// timerWheel is a hierarchical timing wheel shared by all TCP endpoints of a
+// stack. It multiplexes any number of timers onto a few clock timers, so that
+// idle connections with pending keepalive, retransmit or TIME-WAIT timers do
+// not each hold a runtime timer.
+//
+// So that endpoints don't all contend on a single lock, the wheel is split
+// into independent shards, each with its own lock and clock timer. Entries
+// are assigned to shards in turn as they are initialized.
+type timerWheel struct {
+	// shards is immutable after init.
+	shards []timerWheelShard
+
+	// next is used to pick the shard of the next entry. It must be accessed
+	// atomically.
+	next uint32
+}
+
+// init initializes the wheel to run on the given clock.
+func (w *timerWheel) init(clock tcpip.Clock) {
+	n := runtime.GOMAXPROCS(0)
+	if n > maxTimerWheelShards {
+		n = maxTimerWheelShards
+	}
+	w.shards = make([]timerWheelShard, n)
+	for i := range w.shards {
+		w.shards[i].init(clock)
+	}
+}
+
+// close stops the wheel. Entries that are queued, or scheduled later on, fire
+// from clock timers of their own instead.
+func (w *timerWheel) close() {
+	for i := range w.shards {
+		w.shards[i].close()
+	}
+}
+
+// nextShard returns the shard to schedule a new entry on.
+func (w *timerWheel) nextShard() *timerWheelShard {
+	i := atomic.AddUint32(&w.next, 1)
+	return &w.shards[i%uint32(len(w.shards))]
+}
+
+// timerWheelShard is a shard of a timerWheel.
+//
+// Level l of the shard has timerWheelSlots buckets, each spanning
+// 1<<(l*timerWheelLevelShift) ticks. An entry is queued in the lowest level
+// whose range covers its timeout, in the bucket its expiration falls in. When
+// the shard reaches that bucket, entries that haven't expired yet are cascaded
+// down to a finer level. Entries therefore fire within a tick of their
+// expiration and never early, while each entry is moved at most
+// timerWheelLevels-1 times.
+type timerWheelShard struct {
+	// clock drives the shard. It is immutable.
+	clock tcpip.Clock
+
+	// start is the monotonic time at which the shard's tick 0 began. It is
+	// immutable.
+	start int64
+
+	mu sync.Mutex
+
+	// clk is the tick up to which the shard has been advanced.
+	clk uint64
+
+	// buckets holds the queued entries.
+	buckets [timerWheelLevels][timerWheelSlots]timerWheelEntryList
+
+	// occupied has bit i of element l set iff buckets[l][i] is non-empty.
+	occupied [timerWheelLevels]uint64
+
+	// timer is the clock timer that advances the shard. It is set for
+	// armedAt if armed is true.
+	timer   tcpip.Timer
+	armed   bool
+	armedAt uint64
+
+	// closed is set once the shard is stopped; it is no longer advanced
+	// afterwards.
+	closed bool
+}
+
+// init initializes the shard to run on the given clock.
+func (w *timerWheelShard) init(clock tcpip.Clock) {
+	w.clock = clock
+	w.start = clock.NowMonotonic()
+}
+
+// close stops the shard, handing the entries still queued over to fallback
+// clock timers.
+func (w *timerWheelShard) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.armed {
+		w.timer.Stop()
+		w.armed = false
+	}
+	now := w.nowLocked()
+	for level := range w.buckets {
+		for slot := range w.buckets[level] {
+			b := &w.buckets[level][slot]
+			for e := b.Front(); e != nil; {
+				next := e.Next()
+				w.removeLocked(e)
+				var d time.Duration
+				if e.expires > now {
+					d = time.Duration(e.expires-now) * timerWheelTick
+				}
+				e.fallback = w.clock.AfterFunc(d, e.waker.Assert)
+				e = next
+			}
+		}
+	}
+}
+
+// nowLocked returns the current tick, rounded down.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheelShard) nowLocked() uint64 {
+	return uint64(time.Duration(w.clock.NowMonotonic()-w.start) / timerWheelTick)
+}
+
+// reset (re)schedules e to fire after d has elapsed.
+func (w *timerWheelShard) reset(e *timerWheelEntry, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(e)
+	if w.closed {
+		// The shard no longer advances, so the entry must not wait for
+		// it: endpoints may be waiting on the entry to finish closing.
+		e.fallback = w.clock.AfterFunc(d, e.waker.Assert)
+		return
+	}
+	// Round up so that the entry never fires early.
+	e.expires = uint64((time.Duration(w.clock.NowMonotonic()-w.start) + d + timerWheelTick - 1) / timerWheelTick)
+	w.insertLocked(e)
+	w.armLocked()
+}
+
+// insertLocked queues e according to e.expires.
+//
+// Preconditions: w.mu must be locked and e must not be queued.
+func (w *timerWheelShard) insertLocked(e *timerWheelEntry) {
+	var delta uint64
+	if e.expires > w.clk {
+		delta = e.expires - w.clk
+	}
+	level := 0
+	for level < timerWheelLevels-1 && delta >= timerWheelSlots<<(level*timerWheelLevelShift) {
+		level++
+	}
+	shift := uint(level * timerWheelLevelShift)
+	// Queue the entry in the bucket its expiration falls in, which is
+	// visited no later than the expiration, so that the entry can be
+	// cascaded to a finer level in time. The bucket must be visited after
+	// the current one, and entries beyond the range of the last level are
+	// parked a full turn ahead.
+	unit := e.expires >> shift
+	if c := w.clk >> shift; unit <= c {
+		unit = c + 1
+	} else if unit > c+timerWheelSlots {
+		unit = c + timerWheelSlots
+	}
+	e.level = level
+	e.slot = int(unit & timerWheelSlotMask)
+	w.buckets[e.level][e.slot].PushBack(e)
+	w.occupied[e.level] |= 1 << uint(e.slot)
+}
+
+// removeLocked unqueues e if it is queued, and stops its fallback timer if it
+// has one.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheelShard) removeLocked(e *timerWheelEntry) {
+	if e.fallback != nil {
+		e.fallback.Stop()
+		e.fallback = nil
+	}
+	if e.level < 0 {
+		return
+	}
+	b := &w.buckets[e.level][e.slot]
+	b.Remove(e)
+	if b.Empty() {
+		w.occupied[e.level] &^= 1 << uint(e.slot)
+	}
+	e.level = -1
+}
+
+// nextLocked returns the earliest tick at which a bucket with queued entries
+// is visited, and whether there are queued entries at all.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheelShard) nextLocked() (uint64, bool) {
+	var next uint64
+	found := false
+	for level := 0; level < timerWheelLevels; level++ {
+		occ := w.occupied[level]
+		if occ == 0 {
+			continue
+		}
+		shift := uint(level * timerWheelLevelShift)
+		first := (w.clk >> shift) + 1
+		// Rotate so that bit 0 corresponds to the bucket of unit first.
+		k := bits.TrailingZeros64(bits.RotateLeft64(occ, -int(first&timerWheelSlotMask)))
+		if t := (first + uint64(k)) << shift; !found || t < next {
+			next = t
+			found = true
+		}
+	}
+	return next, found
+}
+
+// armLocked makes sure the clock timer fires no later than the next tick at
+// which a bucket with queued entries is visited.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheelShard) armLocked() {
+	next, ok := w.nextLocked()
+	if !ok || (w.armed && w.armedAt <= next) {
+		return
+	}
+	if w.armed {
+		// If the timer has already fired, advance will find nothing to
+		// do, which is harmless.
+		w.timer.Stop()
+	}
+	w.armed = true
+	w.armedAt = next
+	w.timer = w.clock.AfterFunc(time.Duration(next)*timerWheelTick-time.Duration(w.clock.NowMonotonic()-w.start), w.advance)
+}
+
+// advance moves the shard forward to the current time, firing expired entries
+// and cascading the others. It is invoked by the clock timer.
+func (w *timerWheelShard) advance() {
+	var expired []*sleep.Waker
+	var requeue timerWheelEntryList
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.armed = false
+	now := w.nowLocked()
+	for level := 0; level < timerWheelLevels; level++ {
+		shift := uint(level * timerWheelLevelShift)
+		from, to := w.clk>>shift, now>>shift
+		if from == to {
+			// Higher levels are coarser, so they haven't moved either.
+			break
+		}
+		n := to - from
+		if n > timerWheelSlots {
+			n = timerWheelSlots
+		}
+		for u := from + 1; u <= from+n; u++ {
+			slot := int(u & timerWheelSlotMask)
+			b := &w.buckets[level][slot]
+			for e := b.Front(); e != nil; {
+				next := e.Next()
+				b.Remove(e)
+				e.level = -1
+				if e.expires <= now {
+					expired = append(expired, e.waker)
+				} else {
+					requeue.PushBack(e)
+				}
+				e = next
+			}
+			w.occupied[level] &^= 1 << uint(slot)
+		}
+	}
+	w.clk = now
+	// Entries that haven't expired yet are now closer to their expiration,
+	// so they are requeued in finer levels.
+	for e := requeue.Front(); e != nil; {
+		next := e.Next()
+		requeue.Remove(e)
+		w.insertLocked(e)
+		e = next
+	}
+	w.armLocked()
+	w.mu.Unlock()
+
+	for _, w := range expired {
+		w.Assert()
+	}
+}
@@ -16,6 +16,7 @@ package udp
 
 import (
 	"fmt"
+	"math"
 	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/sleep"
@@ -37,6 +38,15 @@ type udpPacket struct {
 	timestamp     int64
 	// tos stores either the receiveTOS or receiveTClass value.
 	tos uint8
+	// ttl stores either the TTL or the hop limit of the packet.
+	ttl uint8
+	// ipOptions stores the IPv4 options of the packet if IP_RECVOPTS was
+	// set when it was received.
+	ipOptions []byte
+	// memSize is the memory used by the packet, including its metadata. It
+	// is accounted for in the receive buffer and charged to the protocol's
+	// memory account.
+	memSize int
 }
 
 // EndpointState represents the state of a UDP endpoint.
@@ -88,12 +98,23 @@ type endpoint struct {
 
 	// The following fields are used to manage the receive queue, and are
 	// protected by rcvMu.
-	rcvMu         sync.Mutex `state:"nosave"`
-	rcvReady      bool
-	rcvList       udpPacketList
+	rcvMu    sync.Mutex `state:"nosave"`
+	rcvReady bool
+	rcvList  udpPacketList
+	// rcvBufSizeMax is the size of the receive buffer, in bytes of memory
+	// as for rcvBufSize.
 	rcvBufSizeMax int `state:".(int)"`
-	rcvBufSize    int
-	rcvClosed     bool
+	// rcvBufSize is the memory used by the packets in rcvList, including
+	// their metadata, as with Linux's sk_rmem_alloc.
+	rcvBufSize int
+	rcvClosed  bool
+	// rcvPathMTU is the pending IPV6_PATHMTU notification, returned by the
+	// next read before the packets in rcvList.
+	rcvPathMTU *tcpip.PathMTUInfo
+
+	// mem is the memory account shared by all UDP endpoints of the stack.
+	// rcvBufSize bytes are charged to it.
+	mem *stack.TransportMemory `state:"nosave"`
 
 	// The following fields are protected by the mu mutex.
 	mu            sync.RWMutex `state:"nosave"`
@@ -119,6 +140,12 @@ type endpoint struct {
 	boundBindToDevice tcpip.NICID
 	boundPortFlags    ports.Flags
 
+	// pathMTU is the path MTU reported by Packet Too Big messages for the
+	// connected destination, excluding the network header, or 0 if none
+	// was reported. It is accessed atomically as control packets may be
+	// handled while mu is held.
+	pathMTU uint32
+
 	// sendTOS represents IPv4 TOS or IPv6 TrafficClass,
 	// applied while sending packets. Defaults to 0 as on Linux.
 	sendTOS uint8
@@ -157,6 +184,16 @@ type multicastMembership struct {
 	multicastAddr tcpip.Address
 }
 
+// defaultMulticastTTL returns the default TTL of multicast packets sent over
+// netProto.
+func defaultMulticastTTL(s *stack.Stack, netProto tcpip.NetworkProtocolNumber) uint8 {
+	var v tcpip.DefaultMulticastTTLOption
+	if err := s.NetworkProtocolOption(netProto, &v); err != nil {
+		return 1
+	}
+	return uint8(v)
+}
+
 func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
 	e := &endpoint{
 		stack: s,
@@ -176,16 +213,19 @@ func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQue
 		// home network) may find it useful to send traffic with IP
 		// TTL=1.
 		//
-		// Linux defaults to TTL=1.
-		multicastTTL:         1,
+		// Linux defaults to TTL=1, which is also the default of the
+		// network protocols.
+		multicastTTL:         defaultMulticastTTL(s, netProto),
 		rcvBufSizeMax:        32 * 1024,
 		sndBufSizeMax:        32 * 1024,
 		multicastMemberships: make(map[multicastMembership]struct{}),
 		state:                StateInitial,
 		uniqueID:             s.UniqueID(),
+		mem:                  memoryFor(s),
 	}
 	e.ops.InitHandler(e)
 	e.ops.SetMulticastLoop(true)
+	e.ops.SetMulticastAll(true)
 
 	// Override with stack defaults.
 	var ss stack.SendBufferSizeOption
@@ -256,6 +296,7 @@ func (e *endpoint) Close() {
 	// Close the receive list and drain it.
 	e.rcvMu.Lock()
 	e.rcvClosed = true
+	e.mem.Release(e.rcvBufSize)
 	e.rcvBufSize = 0
 	for !e.rcvList.Empty() {
 		p := e.rcvList.Front()
@@ -288,6 +329,15 @@ func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMess
 
 	e.rcvMu.Lock()
 
+	if info := e.rcvPathMTU; info != nil {
+		e.rcvPathMTU = nil
+		e.rcvMu.Unlock()
+		if addr != nil {
+			*addr = info.Addr
+		}
+		return buffer.View{}, tcpip.ControlMessages{HasIPv6PathMTU: true, IPv6PathMTU: *info}, nil
+	}
+
 	if e.rcvList.Empty() {
 		err := tcpip.ErrWouldBlock
 		if e.rcvClosed {
@@ -300,13 +350,19 @@ func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMess
 
 	p := e.rcvList.Front()
 	e.rcvList.Remove(p)
-	e.rcvBufSize -= p.data.Size()
+	e.rcvBufSize -= p.memSize
+	e.mem.Release(p.memSize)
 	e.rcvMu.Unlock()
 
 	if addr != nil {
 		*addr = p.senderAddress
 	}
+	return p.data.ToView(), e.controlMessages(p), nil
+}
 
+// controlMessages returns the control messages of p requested by the socket
+// options of the endpoint.
+func (e *endpoint) controlMessages(p *udpPacket) tcpip.ControlMessages {
 	cm := tcpip.ControlMessages{
 		HasTimestamp: true,
 		Timestamp:    p.timestamp,
@@ -320,11 +376,23 @@ func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMess
 		// Although TClass is an 8-bit value it's read in the CMsg as a uint32.
 		cm.TClass = uint32(p.tos)
 	}
+	if e.ops.GetReceiveTTL() {
+		cm.HasTTL = true
+		cm.TTL = p.ttl
+	}
+	if e.ops.GetReceiveHopLimit() {
+		cm.HasHopLimit = true
+		cm.HopLimit = p.ttl
+	}
+	if e.ops.GetReceiveIPOptions() && len(p.ipOptions) != 0 {
+		cm.HasIPOptions = true
+		cm.IPOptions = p.ipOptions
+	}
 	if e.ops.GetReceivePacketInfo() {
 		cm.HasIPPacketInfo = true
 		cm.PacketInfo = p.packetInfo
 	}
-	return p.data.ToView(), cm, nil
+	return cm
 }
 
 // prepareForWrite prepares the endpoint for sending data. In particular, it
@@ -371,6 +439,15 @@ func (e *endpoint) prepareForWrite(to *tcpip.FullAddress) (retry bool, err *tcpi
 // configured multicast interface if no interface is specified and the
 // specified address is a multicast address.
 func (e *endpoint) connectRoute(nicID tcpip.NICID, addr tcpip.FullAddress, netProto tcpip.NetworkProtocolNumber) (*stack.Route, tcpip.NICID, *tcpip.Error) {
+	// An endpoint bound to a device only sends through it, which also takes
+	// precedence over the multicast interface.
+	if e.bindToDevice != 0 {
+		if nicID != 0 && nicID != e.bindToDevice {
+			return nil, 0, tcpip.ErrNoRoute
+		}
+		nicID = e.bindToDevice
+	}
+
 	localAddr := e.ID.LocalAddress
 	if e.isBroadcastOrMulticast(nicID, netProto, localAddr) {
 		// A packet can only originate from a unicast address (i.e., an interface).
@@ -387,7 +464,7 @@ func (e *endpoint) connectRoute(nicID tcpip.NICID, addr tcpip.FullAddress, netPr
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	r, err := e.stack.FindRouteInGroup(e.ops.GetNICGroup(), nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
 	if err != nil {
 		return nil, 0, err
 	}
@@ -552,7 +629,33 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 
 	localPort := e.ID.LocalPort
 	sendTOS := e.sendTOS
+	var ipOptions stack.NetOptions
+	if opts := e.ops.GetIPv4Options(); len(opts) != 0 && route.NetProto == header.IPv4ProtocolNumber {
+		ipOptions = header.IPv4Options(opts)
+	}
+
+	// Control messages override the socket options for this write only.
+	cm := &opts.ControlMessages
+	switch route.NetProto {
+	case header.IPv4ProtocolNumber:
+		if cm.HasTOS {
+			sendTOS = cm.TOS
+		}
+		if cm.HasTTL {
+			ttl = cm.TTL
+			useDefaultTTL = false
+		}
+	case header.IPv6ProtocolNumber:
+		if cm.HasTClass {
+			sendTOS = uint8(cm.TClass)
+		}
+		if cm.HasHopLimit {
+			ttl = cm.HopLimit
+			useDefaultTTL = false
+		}
+	}
 	owner := e.owner
+	priority := e.ops.GetPriority()
 	noChecksum := e.SocketOptions().GetNoChecksum()
 	lockReleased = true
 	e.mu.RUnlock()
@@ -567,15 +670,71 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, <-c
 	//
 	// See: https://golang.org/pkg/sync/#RWMutex for details on why recursive read
 	// locking is prohibited.
-	if err := sendUDP(route, buffer.View(v).ToVectorisedView(), localPort, dstPort, ttl, useDefaultTTL, sendTOS, owner, noChecksum); err != nil {
+	if err := sendUDP(route, buffer.View(v).ToVectorisedView(), localPort, dstPort, ttl, useDefaultTTL, sendTOS, ipOptions, owner, priority, noChecksum); err != nil {
 		return 0, nil, err
 	}
 	return int64(len(v)), nil, nil
 }
 
-// Peek only returns data from a single datagram, so do nothing here.
-func (e *endpoint) Peek([][]byte) (int64, tcpip.ControlMessages, *tcpip.Error) {
-	return 0, tcpip.ControlMessages{}, nil
+// Peek implements tcpip.Endpoint.Peek.
+//
+// Like in Linux, the datagrams which end before off are skipped, and the data
+// of the next one is read from the rest of the offset onwards.
+func (e *endpoint) Peek(vec [][]byte, off int64, addr *tcpip.FullAddress) (int64, tcpip.ControlMessages, *tcpip.Error) {
+	if err := e.LastError(); err != nil {
+		return 0, tcpip.ControlMessages{}, err
+	}
+
+	e.rcvMu.Lock()
+	defer e.rcvMu.Unlock()
+
+	p := e.rcvList.Front()
+	for ; p != nil; p = p.Next() {
+		// Like in Linux, an offset of zero stops at the next datagram even
+		// if it is empty.
+		if size := int64(p.data.Size()); off > 0 && off >= size {
+			off -= size
+			continue
+		}
+		break
+	}
+	if p == nil {
+		if e.rcvClosed {
+			e.stats.ReadErrors.ReadClosed.Increment()
+			return 0, tcpip.ControlMessages{}, tcpip.ErrClosedForReceive
+		}
+		return 0, tcpip.ControlMessages{}, tcpip.ErrWouldBlock
+	}
+
+	// Make a copy of vec so we can modify the slide headers.
+	vec = append([][]byte(nil), vec...)
+
+	var num int64
+	for _, v := range p.data.Views() {
+		// Skip the data before the offset.
+		if off >= int64(len(v)) {
+			off -= int64(len(v))
+			continue
+		}
+		v = v[off:]
+		off = 0
+
+		for len(v) > 0 && len(vec) > 0 {
+			if len(vec[0]) == 0 {
+				vec = vec[1:]
+				continue
+			}
+			n := copy(vec[0], v)
+			v = v[n:]
+			vec[0] = vec[0][n:]
+			num += int64(n)
+		}
+	}
+
+	if addr != nil {
+		*addr = p.senderAddress
+	}
+	return num, e.controlMessages(p), nil
 }
 
 // OnReuseAddressSet implements tcpip.SocketOptionsHandler.OnReuseAddressSet.
@@ -604,7 +763,11 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 
 	case tcpip.MulticastTTLOption:
 		e.mu.Lock()
-		e.multicastTTL = uint8(v)
+		if v == -1 {
+			e.multicastTTL = defaultMulticastTTL(e.stack, e.NetProto)
+		} else {
+			e.multicastTTL = uint8(v)
+		}
 		e.mu.Unlock()
 
 	case tcpip.TTLOption:
@@ -622,24 +785,32 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) *tcpip.Error {
 		e.sendTOS = uint8(v)
 		e.mu.Unlock()
 
-	case tcpip.ReceiveBufferSizeOption:
-		// Make sure the receive buffer size is within the min and max
-		// allowed.
+	case tcpip.ReceiveBufferSizeOption, tcpip.ReceiveBufferSizeForceOption:
+		// The size is capped at rs.Max before being doubled, and raised to
+		// rs.Min after. ReceiveBufferSizeForceOption skips the rs.Max clamp.
 		var rs stack.ReceiveBufferSizeOption
 		if err := e.stack.Option(&rs); err != nil {
 			panic(fmt.Sprintf("e.stack.Option(%#v) = %s", rs, err))
 		}
 
+		if opt == tcpip.ReceiveBufferSizeOption && v > rs.Max {
+			v = rs.Max
+		}
+
+		// As on Linux, the size is doubled to make room for the metadata
+		// of the packets, which is accounted for in the receive buffer.
+		if v < math.MaxInt32/2 {
+			v *= 2
+		} else {
+			v = math.MaxInt32
+		}
 		if v < rs.Min {
 			v = rs.Min
 		}
-		if v > rs.Max {
-			v = rs.Max
-		}
 
-		e.mu.Lock()
+		e.rcvMu.Lock()
 		e.rcvBufSizeMax = v
-		e.mu.Unlock()
+		e.rcvMu.Unlock()
 		return nil
 	case tcpip.SendBufferSizeOption:
 		// Make sure the send buffer size is within the min and max
@@ -739,6 +910,12 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) *tcpip.Error {
 			return tcpip.ErrPortInUse
 		}
 
+		var limits tcpip.MulticastMembershipLimitsOption
+		if err := e.stack.NetworkProtocolOption(e.NetProto, &limits); err == nil && limits.MaxSocketMemberships != 0 && len(e.multicastMemberships) >= limits.MaxSocketMemberships {
+			e.stack.Stats().IP.SocketMembershipLimitExceeded.Increment()
+			return tcpip.ErrNoBufferSpace
+		}
+
 		if err := e.stack.JoinGroup(e.NetProto, nicID, v.MulticastAddr); err != nil {
 			return err
 		}
@@ -820,6 +997,18 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, *tcpip.Error) {
 		// The only supported setting is path MTU discovery disabled.
 		return tcpip.PMTUDiscoveryDont, nil
 
+	case tcpip.MTUOption:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		if e.EndpointState() != StateConnected {
+			return -1, tcpip.ErrNotConnected
+		}
+		mtu := e.route.MTU()
+		if v := atomic.LoadUint32(&e.pathMTU); v != 0 && v < mtu {
+			mtu = v
+		}
+		return int(mtu + networkHeaderSize(e.route.RemoteAddress)), nil
+
 	case tcpip.MulticastTTLOption:
 		e.mu.Lock()
 		v := int(e.multicastTTL)
@@ -836,6 +1025,10 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, *tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.SendQueueSizeOption:
+		// Datagrams are sent synchronously, so they are never queued.
+		return 0, nil
+
 	case tcpip.SendBufferSizeOption:
 		e.mu.Lock()
 		v := e.sndBufSizeMax
@@ -888,12 +1081,13 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) *tcpip.Error {
 
 // sendUDP sends a UDP segment via the provided network endpoint and under the
 // provided identity.
-func sendUDP(r *stack.Route, data buffer.VectorisedView, localPort, remotePort uint16, ttl uint8, useDefaultTTL bool, tos uint8, owner tcpip.PacketOwner, noChecksum bool) *tcpip.Error {
+func sendUDP(r *stack.Route, data buffer.VectorisedView, localPort, remotePort uint16, ttl uint8, useDefaultTTL bool, tos uint8, ipOptions stack.NetOptions, owner tcpip.PacketOwner, priority uint32, noChecksum bool) *tcpip.Error {
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: header.UDPMinimumSize + int(r.MaxHeaderLength()),
 		Data:               data,
 	})
 	pkt.Owner = owner
+	pkt.Priority = priority
 
 	// Initialize the UDP header.
 	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
@@ -926,6 +1120,7 @@ func sendUDP(r *stack.Route, data buffer.VectorisedView, localPort, remotePort u
 		Protocol: ProtocolNumber,
 		TTL:      ttl,
 		TOS:      tos,
+		Options:  ipOptions,
 	}, pkt); err != nil {
 		r.Stats().UDP.PacketSendErrors.Increment()
 		return err
@@ -991,6 +1186,7 @@ func (e *endpoint) Disconnect() *tcpip.Error {
 	e.route.Release()
 	e.route = nil
 	e.dstPort = 0
+	atomic.StoreUint32(&e.pathMTU, 0)
 
 	return nil
 }
@@ -1073,6 +1269,7 @@ func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
 	e.boundBindToDevice = btd
 	e.route = r.Clone()
 	e.dstPort = addr.Port
+	atomic.StoreUint32(&e.pathMTU, 0)
 	e.RegisterNICID = nicID
 	e.effectiveNetProtos = netProtos
 
@@ -1171,10 +1368,15 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) *tcpip.Error {
 
 	nicID := addr.NIC
 	if len(addr.Addr) != 0 && !e.isBroadcastOrMulticast(addr.NIC, netProto, addr.Addr) {
-		// A local unicast address was specified, verify that it's valid.
+		// A local unicast address was specified, verify that it's valid
+		// unless IP_FREEBIND allows binding to addresses which are not
+		// assigned yet.
 		nicID = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nicID == 0 {
-			return tcpip.ErrBadLocalAddress
+			if !e.ops.GetFreeBind() {
+				return tcpip.ErrBadLocalAddress
+			}
+			nicID = addr.NIC
 		}
 	}
 
@@ -1261,7 +1463,7 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	// Determine if the endpoint is readable if requested.
 	if (mask & waiter.EventIn) != 0 {
 		e.rcvMu.Lock()
-		if !e.rcvList.Empty() || e.rcvClosed {
+		if !e.rcvList.Empty() || e.rcvPathMTU != nil || e.rcvClosed {
 			result |= waiter.EventIn
 		}
 		e.rcvMu.Unlock()
@@ -1293,6 +1495,15 @@ func verifyChecksum(hdr header.UDP, pkt *stack.PacketBuffer) bool {
 	return true
 }
 
+// isMulticastMember returns true if the endpoint has joined multicastAddr on
+// the NIC with the given ID.
+func (e *endpoint) isMulticastMember(nicID tcpip.NICID, multicastAddr tcpip.Address) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.multicastMemberships[multicastMembership{nicID: nicID, multicastAddr: multicastAddr}]
+	return ok
+}
+
 // HandlePacket is called by the stack when new packets arrive to this transport
 // endpoint.
 func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketBuffer) {
@@ -1309,9 +1520,18 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		// Checksum Error.
 		e.stack.Stats().UDP.ChecksumErrors.Increment()
 		e.stats.ReceiveErrors.ChecksumErrors.Increment()
+		recordChecksumError(e.stack, id, pkt)
 		return
 	}
 
+	// With IP_MULTICAST_ALL disabled, only deliver multicast datagrams for
+	// groups this endpoint has joined on the receiving interface.
+	if header.IsV4MulticastAddress(id.LocalAddress) || header.IsV6MulticastAddress(id.LocalAddress) {
+		if !e.ops.GetMulticastAll() && !e.isMulticastMember(pkt.NICID, id.LocalAddress) {
+			return
+		}
+	}
+
 	e.stack.Stats().UDP.PacketsReceived.Increment()
 	e.stats.PacketsReceived.Increment()
 
@@ -1324,9 +1544,22 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		return
 	}
 
+	// As on Linux, a packet is queued as long as the receive buffer isn't
+	// full, even if it then overflows it.
 	if e.rcvBufSize >= e.rcvBufSizeMax {
 		e.rcvMu.Unlock()
 		e.stack.Stats().UDP.ReceiveBufferErrors.Increment()
+		e.stack.Stats().UDP.ReceiveBufferOverflows.Increment()
+		e.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
+		return
+	}
+
+	// Once the protocol runs out of memory, only endpoints with an empty
+	// receive buffer may queue packets.
+	if e.rcvBufSize != 0 && e.mem.OverLimit() {
+		e.rcvMu.Unlock()
+		e.stack.Stats().UDP.ReceiveBufferErrors.Increment()
+		e.stack.Stats().UDP.ReceiveMemoryErrors.Increment()
 		e.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
 		return
 	}
@@ -1343,15 +1576,24 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 	}
 	packet.data = pkt.Data
 	e.rcvList.PushBack(packet)
-	e.rcvBufSize += pkt.Data.Size()
 
 	// Save any useful information from the network header to the packet.
 	switch pkt.NetworkProtocolNumber {
 	case header.IPv4ProtocolNumber:
-		packet.tos, _ = header.IPv4(pkt.NetworkHeader().View()).TOS()
+		h := header.IPv4(pkt.NetworkHeader().View())
+		packet.tos, _ = h.TOS()
+		if opts := h.Options(); len(opts) != 0 && e.ops.GetReceiveIPOptions() {
+			packet.ipOptions = append([]byte(nil), opts...)
+		}
 	case header.IPv6ProtocolNumber:
 		packet.tos, _ = header.IPv6(pkt.NetworkHeader().View()).TOS()
 	}
+	packet.ttl = pkt.TTL()
+
+	// Account for the packet once its metadata is complete.
+	packet.memSize = packetSize + len(packet.ipOptions) + pkt.Data.MemSize()
+	e.rcvBufSize += packet.memSize
+	e.mem.Charge(packet.memSize)
 
 	// TODO(gvisor.dev/issue/3556): r.LocalAddress may be a multicast or broadcast
 	// address. packetInfo.LocalAddr should hold a unicast address that can be
@@ -1372,7 +1614,8 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 
 // HandleControlPacket implements stack.TransportEndpoint.HandleControlPacket.
 func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.ControlType, extra uint32, pkt *stack.PacketBuffer) {
-	if typ == stack.ControlPortUnreachable {
+	switch typ {
+	case stack.ControlPortUnreachable:
 		if e.EndpointState() == StateConnected {
 			e.lastErrorMu.Lock()
 			e.lastError = tcpip.ErrConnectionRefused
@@ -1381,7 +1624,47 @@ func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.C
 			e.waiterQueue.Notify(waiter.EventErr)
 			return
 		}
+
+	case stack.ControlPacketTooBig:
+		if extra == 0 {
+			return
+		}
+		if e.EndpointState() == StateConnected {
+			for {
+				v := atomic.LoadUint32(&e.pathMTU)
+				if (v != 0 && v <= extra) || atomic.CompareAndSwapUint32(&e.pathMTU, v, extra) {
+					break
+				}
+			}
+		}
+		if e.ops.GetReceivePathMTU() && e.NetProto == header.IPv6ProtocolNumber {
+			e.rcvMu.Lock()
+			e.rcvPathMTU = &tcpip.PathMTUInfo{
+				Addr: tcpip.FullAddress{NIC: pkt.NICID, Addr: id.RemoteAddress},
+				MTU:  extra + networkHeaderSize(id.RemoteAddress),
+			}
+			e.rcvMu.Unlock()
+			e.waiterQueue.Notify(waiter.EventIn)
+		}
+
+	case stack.ControlNICRemoved:
+		// The endpoint is bound to the removed NIC or one of its addresses,
+		// so it can't send or receive anymore.
+		e.lastErrorMu.Lock()
+		e.lastError = tcpip.ErrNetworkUnreachable
+		e.lastErrorMu.Unlock()
+
+		e.waiterQueue.Notify(waiter.EventErr)
+	}
+}
+
+// networkHeaderSize returns the size of the fixed network header of packets
+// sent to addr, which path MTUs include.
+func networkHeaderSize(addr tcpip.Address) uint32 {
+	if len(addr) == header.IPv4AddressSize {
+		return header.IPv4MinimumSize
 	}
+	return header.IPv6MinimumSize
 }
 
 // State implements tcpip.Endpoint.State.
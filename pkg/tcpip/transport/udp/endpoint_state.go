@@ -82,6 +82,8 @@ func (e *endpoint) loadRcvBufSizeMax(max int) {
 
 // afterLoad is invoked by stateify.
 func (e *endpoint) afterLoad() {
+	e.mem = memoryFor(stack.StackFromEnv)
+	e.mem.Charge(e.rcvBufSize)
 	stack.StackFromEnv.RegisterRestoredEndpoint(e)
 }
 
@@ -46,6 +46,15 @@ const (
 
 type protocol struct {
 	stack *stack.Stack
+
+	// mem accounts for the receive buffer memory of all endpoints of the
+	// stack. It may be shared with the protocols of other stacks.
+	mem *stack.TransportMemory
+}
+
+// memoryFor returns the memory account shared by the UDP endpoints of s.
+func memoryFor(s *stack.Stack) *stack.TransportMemory {
+	return s.TransportProtocolInstance(ProtocolNumber).(*protocol).mem
 }
 
 // Number returns the udp protocol number.
@@ -87,20 +96,50 @@ func (p *protocol) HandleUnknownDestinationPacket(id stack.TransportEndpointID,
 
 	if !verifyChecksum(hdr, pkt) {
 		p.stack.Stats().UDP.ChecksumErrors.Increment()
+		recordChecksumError(p.stack, id, pkt)
 		return stack.UnknownDestinationPacketMalformed
 	}
 
 	return stack.UnknownDestinationPacketUnhandled
 }
 
+// recordChecksumError records the bad checksum of the datagram pkt, received
+// for id, in the event log of the stack.
+func recordChecksumError(s *stack.Stack, id stack.TransportEndpointID, pkt *stack.PacketBuffer) {
+	s.RecordEvent(stack.Event{
+		Kind:     stack.EventChecksumError,
+		NICID:    pkt.NICID,
+		Protocol: uint32(ProtocolNumber),
+		Source: tcpip.FullAddress{
+			NIC:  pkt.NICID,
+			Addr: id.RemoteAddress,
+			Port: id.RemotePort,
+		},
+		Detail: "bad datagram checksum",
+	})
+}
+
 // SetOption implements stack.TransportProtocol.SetOption.
-func (*protocol) SetOption(tcpip.SettableTransportProtocolOption) *tcpip.Error {
-	return tcpip.ErrUnknownProtocolOption
+func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) *tcpip.Error {
+	switch v := option.(type) {
+	case *tcpip.TransportMemoryLimitsOption:
+		return p.mem.SetLimits(*v)
+
+	default:
+		return tcpip.ErrUnknownProtocolOption
+	}
 }
 
 // Option implements stack.TransportProtocol.Option.
-func (*protocol) Option(tcpip.GettableTransportProtocolOption) *tcpip.Error {
-	return tcpip.ErrUnknownProtocolOption
+func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) *tcpip.Error {
+	switch v := option.(type) {
+	case *tcpip.TransportMemoryLimitsOption:
+		*v = p.mem.Limits()
+		return nil
+
+	default:
+		return tcpip.ErrUnknownProtocolOption
+	}
 }
 
 // Close implements stack.TransportProtocol.Close.
@@ -116,5 +155,14 @@ func (*protocol) Parse(pkt *stack.PacketBuffer) bool {
 
 // NewProtocol returns a UDP transport protocol.
 func NewProtocol(s *stack.Stack) stack.TransportProtocol {
-	return &protocol{stack: s}
+	return &protocol{stack: s, mem: &stack.TransportMemory{}}
+}
+
+// NewProtocolWithMemory returns a factory for UDP transport protocols that
+// charge the receive buffer memory of their endpoints to mem, so that the
+// memory used by several stacks is accounted for and limited together.
+func NewProtocolWithMemory(mem *stack.TransportMemory) stack.TransportProtocolFactory {
+	return func(s *stack.Stack) stack.TransportProtocol {
+		return &protocol{stack: s, mem: mem}
+	}
 }
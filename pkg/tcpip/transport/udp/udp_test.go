@@ -579,6 +579,38 @@ func TestBindToDeviceOption(t *testing.T) {
 	}
 }
 
+// TestWriteBindToDevice tests that an endpoint bound to a device only sends
+// through it.
+func TestWriteBindToDevice(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	if err := c.s.CreateNIC(2, channel.New(1, defaultMTU, "")); err != nil {
+		t.Fatalf("CreateNIC(2, _): %s", err)
+	}
+
+	c.createEndpointForFlow(unicastV4)
+	bindToDevice := tcpip.BindToDeviceOption(2)
+	if err := c.ep.SetSockOpt(&bindToDevice); err != nil {
+		t.Fatalf("c.ep.SetSockOpt(&%T(%d)): %s", bindToDevice, bindToDevice, err)
+	}
+
+	// NIC 2 has no route to the destination, and the endpoint can't send
+	// through NIC 1.
+	for _, nicID := range []tcpip.NICID{0, 1} {
+		to := tcpip.FullAddress{NIC: nicID, Addr: testAddr, Port: testPort}
+		if _, _, err := c.ep.Write(tcpip.SlicePayload(newPayload()), tcpip.WriteOptions{To: &to}); err != tcpip.ErrNoRoute {
+			t.Errorf("got c.ep.Write(_, {To: %+v}) = (_, _, %v), want = (_, _, %s)", to, err, tcpip.ErrNoRoute)
+		}
+	}
+
+	bindToDevice = 1
+	if err := c.ep.SetSockOpt(&bindToDevice); err != nil {
+		t.Fatalf("c.ep.SetSockOpt(&%T(%d)): %s", bindToDevice, bindToDevice, err)
+	}
+	testWrite(c, unicastV4)
+}
+
 // testReadInternal sends a packet of the given test flow into the stack by
 // injecting it into the link endpoint. It then attempts to read it from the
 // UDP endpoint and depending on if this was expected to succeed verifies its
@@ -1190,6 +1222,74 @@ func TestWriteOnConnectedInvalidPort(t *testing.T) {
 	}
 }
 
+// TestRemoveNIC checks that endpoints bound to a NIC, or to one of its
+// addresses, get an error when the NIC is removed, and that others don't.
+func TestRemoveNIC(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		bind    func(ep tcpip.Endpoint) *tcpip.Error
+		wantErr *tcpip.Error
+	}{
+		{
+			name: "bound to address",
+			bind: func(ep tcpip.Endpoint) *tcpip.Error {
+				return ep.Bind(tcpip.FullAddress{Addr: stackAddr, Port: stackPort})
+			},
+			wantErr: tcpip.ErrNetworkUnreachable,
+		},
+		{
+			name: "bound to device",
+			bind: func(ep tcpip.Endpoint) *tcpip.Error {
+				opt := tcpip.BindToDeviceOption(1)
+				if err := ep.SetSockOpt(&opt); err != nil {
+					return err
+				}
+				return ep.Bind(tcpip.FullAddress{Port: stackPort})
+			},
+			wantErr: tcpip.ErrNetworkUnreachable,
+		},
+		{
+			name: "bound to any address",
+			bind: func(ep tcpip.Endpoint) *tcpip.Error {
+				return ep.Bind(tcpip.FullAddress{Port: stackPort})
+			},
+			wantErr: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newDualTestContext(t, defaultMTU)
+			defer c.cleanup()
+
+			c.createEndpoint(ipv4.ProtocolNumber)
+			if err := tc.bind(c.ep); err != nil {
+				t.Fatalf("bind failed: %s", err)
+			}
+
+			we, ch := waiter.NewChannelEntry(nil)
+			c.wq.EventRegister(&we, waiter.EventErr)
+			defer c.wq.EventUnregister(&we)
+
+			if err := c.s.RemoveNIC(1); err != nil {
+				t.Fatalf("c.s.RemoveNIC(1): %s", err)
+			}
+
+			select {
+			case <-ch:
+				if tc.wantErr == nil {
+					t.Error("got EventErr notification, want none")
+				}
+			default:
+				if tc.wantErr != nil {
+					t.Error("got no EventErr notification")
+				}
+			}
+			if err := c.ep.LastError(); err != tc.wantErr {
+				t.Errorf("got c.ep.LastError() = %v, want = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
 // TestWriteOnBoundToV4Multicast checks that we can send packets out of a socket
 // that is bound to a V4 multicast address.
 func TestWriteOnBoundToV4Multicast(t *testing.T) {
@@ -1690,6 +1790,185 @@ func TestReceiveTosTClass(t *testing.T) {
 	}
 }
 
+func TestReceiveTTLHopLimit(t *testing.T) {
+	// Injected packets have a TTL and hop limit of 65.
+	const wantTTL = 65
+
+	for _, flow := range []testFlow{unicastV4, unicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			c := newDualTestContext(t, defaultMTU)
+			defer c.cleanup()
+
+			c.createEndpointForFlow(flow)
+			if err := c.ep.Bind(tcpip.FullAddress{Port: stackPort}); err != nil {
+				c.t.Fatalf("Bind failed: %s", err)
+			}
+			if flow.isV4() {
+				c.ep.SocketOptions().SetReceiveTTL(true)
+				testRead(c, flow, checker.ReceiveTTL(wantTTL))
+			} else {
+				c.ep.SocketOptions().SetReceiveHopLimit(true)
+				testRead(c, flow, checker.ReceiveHopLimit(wantTTL))
+			}
+		})
+	}
+}
+
+func TestPathMTU(t *testing.T) {
+	const (
+		linkMTU = 1500
+		pathMTU = 1400
+	)
+
+	c := newDualTestContext(t, linkMTU)
+	defer c.cleanup()
+
+	c.createEndpoint(ipv6.ProtocolNumber)
+	c.ep.SocketOptions().SetV6Only(true)
+
+	if _, err := c.ep.GetSockOptInt(tcpip.MTUOption); err != tcpip.ErrNotConnected {
+		t.Fatalf("got c.ep.GetSockOptInt(tcpip.MTUOption) = (_, %v), want = (_, %s)", err, tcpip.ErrNotConnected)
+	}
+
+	if err := c.ep.Connect(tcpip.FullAddress{Addr: testV6Addr, Port: testPort}); err != nil {
+		t.Fatalf("c.ep.Connect(...): %s", err)
+	}
+	if v, err := c.ep.GetSockOptInt(tcpip.MTUOption); err != nil || v != linkMTU {
+		t.Fatalf("got c.ep.GetSockOptInt(tcpip.MTUOption) = (%d, %v), want = (%d, nil)", v, err, linkMTU)
+	}
+	localAddr, err := c.ep.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("c.ep.GetLocalAddress(): %s", err)
+	}
+
+	c.ep.SocketOptions().SetReceivePathMTU(true)
+	we, ch := waiter.NewChannelEntry(nil)
+	c.wq.EventRegister(&we, waiter.EventIn)
+	defer c.wq.EventUnregister(&we)
+
+	// Inject a Packet Too Big message for a packet the endpoint sent.
+	original := c.buildV6Packet(newPayload(), &header4Tuple{
+		srcAddr: tcpip.FullAddress{Addr: stackV6Addr, Port: localAddr.Port},
+		dstAddr: tcpip.FullAddress{Addr: testV6Addr, Port: testPort},
+	})
+	icmpLen := header.ICMPv6PacketTooBigMinimumSize + len(original)
+	buf := buffer.NewView(header.IPv6MinimumSize + icmpLen)
+	header.IPv6(buf).Encode(&header.IPv6Fields{
+		PayloadLength: uint16(icmpLen),
+		NextHeader:    uint8(header.ICMPv6ProtocolNumber),
+		HopLimit:      64,
+		SrcAddr:       testV6Addr,
+		DstAddr:       stackV6Addr,
+	})
+	icmpHdr := header.ICMPv6(buf[header.IPv6MinimumSize:])
+	icmpHdr.SetType(header.ICMPv6PacketTooBig)
+	icmpHdr.SetMTU(pathMTU)
+	copy(icmpHdr[header.ICMPv6PacketTooBigMinimumSize:], original)
+	icmpHdr.SetChecksum(header.ICMPv6Checksum(icmpHdr[:header.ICMPv6PacketTooBigMinimumSize], testV6Addr, stackV6Addr, buffer.View(original).ToVectorisedView()))
+	c.linkEP.InjectInbound(ipv6.ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Data: buf.ToVectorisedView(),
+	}))
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("the endpoint wasn't notified of the path MTU")
+	}
+
+	if v, err := c.ep.GetSockOptInt(tcpip.MTUOption); err != nil || v != pathMTU {
+		t.Errorf("got c.ep.GetSockOptInt(tcpip.MTUOption) = (%d, %v), want = (%d, nil)", v, err, pathMTU)
+	}
+
+	var addr tcpip.FullAddress
+	v, cm, err := c.ep.Read(&addr)
+	if err != nil {
+		t.Fatalf("c.ep.Read(_): %s", err)
+	}
+	if len(v) != 0 {
+		t.Errorf("got len(v) = %d, want = 0", len(v))
+	}
+	wantInfo := tcpip.PathMTUInfo{
+		Addr: tcpip.FullAddress{NIC: 1, Addr: testV6Addr},
+		MTU:  pathMTU,
+	}
+	if !cm.HasIPv6PathMTU || cm.IPv6PathMTU != wantInfo {
+		t.Errorf("got cm = %+v, want HasIPv6PathMTU = true and IPv6PathMTU = %+v", cm, wantInfo)
+	}
+	if addr != wantInfo.Addr {
+		t.Errorf("got addr = %+v, want = %+v", addr, wantInfo.Addr)
+	}
+
+	// The notification is only returned once.
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		t.Errorf("got c.ep.Read(nil) = (_, _, %v), want = (_, _, %s)", err, tcpip.ErrWouldBlock)
+	}
+}
+
+func TestWriteControlMessages(t *testing.T) {
+	const (
+		sockTTL = 64
+		sockTOS = 0x20
+		cmTTL   = 7
+		cmTOS   = testTOS
+	)
+
+	for _, flow := range []testFlow{unicastV4, unicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			c := newDualTestContext(t, defaultMTU)
+			defer c.cleanup()
+
+			c.createEndpointForFlow(flow)
+			tosOpt := tcpip.IPv4TOSOption
+			var cm tcpip.ControlMessages
+			if flow.isV4() {
+				cm = tcpip.ControlMessages{HasTOS: true, TOS: cmTOS, HasTTL: true, TTL: cmTTL}
+			} else {
+				tosOpt = tcpip.IPv6TrafficClassOption
+				cm = tcpip.ControlMessages{HasTClass: true, TClass: cmTOS, HasHopLimit: true, HopLimit: cmTTL}
+			}
+			if err := c.ep.SetSockOptInt(tcpip.TTLOption, sockTTL); err != nil {
+				c.t.Fatalf("SetSockOptInt(TTLOption, %d): %s", sockTTL, err)
+			}
+			if err := c.ep.SetSockOptInt(tosOpt, sockTOS); err != nil {
+				c.t.Fatalf("SetSockOptInt(%d, %d): %s", tosOpt, sockTOS, err)
+			}
+
+			// Control messages override the socket options of a single write.
+			h := flow.header4Tuple(outgoing)
+			to := tcpip.FullAddress{Addr: h.dstAddr.Addr, Port: h.dstAddr.Port}
+			payload := buffer.View(newPayload())
+			if _, _, err := c.ep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{To: &to, ControlMessages: cm}); err != nil {
+				c.t.Fatalf("Write failed: %s", err)
+			}
+			c.getPacketAndVerify(flow, checker.TTL(cmTTL), checker.TOS(cmTOS, 0))
+
+			testWrite(c, flow, checker.TTL(sockTTL), checker.TOS(sockTOS, 0))
+		})
+	}
+}
+
+func TestIPv4Options(t *testing.T) {
+	// A Router Alert option (RFC 2113).
+	routerAlert := header.IPv4Options{148, 4, 0, 0}
+
+	for _, flow := range []testFlow{unicastV4, unicastV4in6, broadcast} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			c := newDualTestContext(t, defaultMTU)
+			defer c.cleanup()
+
+			c.createEndpointForFlow(flow)
+			c.ep.SocketOptions().SetIPv4Options(routerAlert)
+			if got := header.IPv4Options(c.ep.SocketOptions().GetIPv4Options()); !bytes.Equal(got, routerAlert) {
+				c.t.Errorf("got GetIPv4Options() = %x, want = %x", got, routerAlert)
+			}
+			testWrite(c, flow, checker.IPv4Options(routerAlert))
+
+			c.ep.SocketOptions().SetIPv4Options(nil)
+			testWrite(c, flow, checker.IPv4Options(nil))
+		})
+	}
+}
+
 func TestMulticastInterfaceOption(t *testing.T) {
 	for _, flow := range []testFlow{multicastV4, multicastV4in6, multicastV6, multicastV6Only} {
 		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
@@ -2175,6 +2454,97 @@ func TestChecksumZeroV6(t *testing.T) {
 	}
 }
 
+// TestReceiveBufferSizeOption verifies that the receive buffer size is doubled
+// and clamped to the range set by stack.ReceiveBufferSizeOption, and that
+// forcing it skips the maximum.
+func TestReceiveBufferSizeOption(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	c.createEndpoint(ipv6.ProtocolNumber)
+
+	var rs stack.ReceiveBufferSizeOption
+	if err := c.s.Option(&rs); err != nil {
+		t.Fatalf("c.s.Option(%#v) = %s", rs, err)
+	}
+
+	tests := []struct {
+		name string
+		opt  tcpip.SockOptInt
+		size int
+		want int
+	}{
+		{"below minimum", tcpip.ReceiveBufferSizeOption, 0, rs.Min},
+		{"doubled", tcpip.ReceiveBufferSizeOption, rs.Min, 2 * rs.Min},
+		{"above maximum", tcpip.ReceiveBufferSizeOption, 2 * rs.Max, 2 * rs.Max},
+		{"forced above maximum", tcpip.ReceiveBufferSizeForceOption, 2 * rs.Max, 4 * rs.Max},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := c.ep.SetSockOptInt(test.opt, test.size); err != nil {
+				t.Fatalf("SetSockOptInt(%d, %d): %s", test.opt, test.size, err)
+			}
+			got, err := c.ep.GetSockOptInt(tcpip.ReceiveBufferSizeOption)
+			if err != nil {
+				t.Fatalf("GetSockOptInt(tcpip.ReceiveBufferSizeOption): %s", err)
+			}
+			if got != test.want {
+				t.Errorf("got GetSockOptInt(tcpip.ReceiveBufferSizeOption) = %d, want = %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestReceiveBufferOverflow verifies that the metadata of the packets is
+// accounted for in the receive buffer.
+func TestReceiveBufferOverflow(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	c.createEndpoint(ipv6.ProtocolNumber)
+
+	// Bind to wildcard.
+	if err := c.ep.Bind(tcpip.FullAddress{Port: stackPort}); err != nil {
+		c.t.Fatalf("Bind failed: %s", err)
+	}
+
+	if err := c.ep.SetSockOptInt(tcpip.ReceiveBufferSizeOption, 0); err != nil {
+		t.Fatalf("SetSockOptInt(tcpip.ReceiveBufferSizeOption, 0): %s", err)
+	}
+	rcvBufSz, err := c.ep.GetSockOptInt(tcpip.ReceiveBufferSizeOption)
+	if err != nil {
+		t.Fatalf("GetSockOptInt(tcpip.ReceiveBufferSizeOption): %s", err)
+	}
+
+	// The data of 4 packets fits in the receive buffer, but the 4th packet
+	// is dropped once their metadata is accounted for.
+	const packets = 4
+	payload := make([]byte, rcvBufSz/(packets-1)-1)
+	for i := 0; i < packets; i++ {
+		c.injectPacket(unicastV4, payload, false)
+	}
+
+	for i := 0; i < packets-1; i++ {
+		if _, _, err := c.ep.Read(nil); err != nil {
+			t.Fatalf("Read #%d failed: %s", i+1, err)
+		}
+	}
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		t.Fatalf("got Read = %s, want = %s", err, tcpip.ErrWouldBlock)
+	}
+
+	var want uint64 = 1
+	if got := c.s.Stats().UDP.ReceiveBufferOverflows.Value(); got != want {
+		t.Errorf("got stats.UDP.ReceiveBufferOverflows.Value() = %d, want = %d", got, want)
+	}
+	if got := c.s.Stats().UDP.ReceiveBufferErrors.Value(); got != want {
+		t.Errorf("got stats.UDP.ReceiveBufferErrors.Value() = %d, want = %d", got, want)
+	}
+	if got := c.ep.Stats().(*tcpip.TransportEndpointStats).ReceiveErrors.ReceiveBufferOverflow.Value(); got != want {
+		t.Errorf("got EP Stats.ReceiveErrors.ReceiveBufferOverflow stats = %d, want = %d", got, want)
+	}
+}
+
 // TestShutdownRead verifies endpoint read shutdown and error
 // stats increment on packet receive.
 func TestShutdownRead(t *testing.T) {
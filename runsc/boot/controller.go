@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sentry/socket/plugin"
 	"gvisor.dev/gvisor/pkg/sentry/state"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
@@ -94,6 +95,60 @@ const (
 	// and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkMirror is the URPC endpoint for changing how the traffic of a
+	// NIC is mirrored.
+	NetworkMirror = "Network.Mirror"
+
+	// NetworkRemoveLink is the URPC endpoint for removing a link from a
+	// network stack.
+	NetworkRemoveLink = "Network.RemoveLink"
+
+	// NetworkExportFlows is the URPC endpoint for exporting the accounting
+	// of flows to a collector.
+	NetworkExportFlows = "Network.ExportFlows"
+
+	// NetworkAttachBPF is the URPC endpoint for attaching eBPF classifiers
+	// to NICs.
+	NetworkAttachBPF = "Network.AttachBPF"
+
+	// NetworkBPF is the URPC endpoint for getting the state of eBPF
+	// classifiers.
+	NetworkBPF = "Network.BPF"
+
+	// NetworkState is the URPC endpoint for listing the NICs, addresses and
+	// routes of a network stack.
+	NetworkState = "Network.State"
+
+	// NetworkAddRoute and NetworkRemoveRoute are the URPC endpoints for
+	// changing the route table of a network stack.
+	NetworkAddRoute    = "Network.AddRoute"
+	NetworkRemoveRoute = "Network.RemoveRoute"
+
+	// NetworkAddAddress and NetworkRemoveAddress are the URPC endpoints for
+	// changing the addresses of NICs.
+	NetworkAddAddress    = "Network.AddAddress"
+	NetworkRemoveAddress = "Network.RemoveAddress"
+
+	// NetworkFlushNeighbors is the URPC endpoint for flushing the neighbor
+	// entries of NICs.
+	NetworkFlushNeighbors = "Network.FlushNeighbors"
+
+	// NetworkFlushConnections is the URPC endpoint for flushing the
+	// connection tracking table.
+	NetworkFlushConnections = "Network.FlushConnections"
+
+	// NetworkSetLinkOptions is the URPC endpoint for changing the options
+	// of NICs.
+	NetworkSetLinkOptions = "Network.SetLinkOptions"
+
+	// NetworkSetEgressRate is the URPC endpoint for changing the rate to
+	// which the egress of NICs is limited.
+	NetworkSetEgressRate = "Network.SetEgressRate"
+
+	// NetworkEvents is the URPC endpoint for retrieving the anomalies
+	// recorded in the event log of a network stack.
+	NetworkEvents = "Network.Events"
+
 	// RootContainerStart is the URPC endpoint for starting a new sandbox
 	// with root container.
 	RootContainerStart = "containerManager.StartRoot"
@@ -155,7 +210,8 @@ func newController(fd int, l *Loader) (*controller, error) {
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
 		net := &Network{
-			Stack: eps.Stack,
+			Stack:  eps.Stack,
+			Kernel: l.k,
 		}
 		ctrl.srv.Register(net)
 	}
@@ -340,6 +396,9 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 // Checkpoint pauses a sandbox and saves its state.
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
+	if s, ok := cm.l.k.RootNetworkNamespace().Stack().(plugin.Stack); ok && s.Capabilities()&plugin.CapabilitySaveRestore == 0 {
+		return fmt.Errorf("plugin network stack %q doesn't support checkpoint", s.Name())
+	}
 	state := control.State{
 		Kernel:   cm.l.k,
 		Watchdog: cm.l.watchdog,
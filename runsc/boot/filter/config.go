@@ -341,6 +341,11 @@ func hostInetFilters() seccomp.SyscallRules {
 				seccomp.EqualTo(syscall.SOL_IP),
 				seccomp.EqualTo(syscall.IP_RECVTOS),
 			},
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(syscall.SOL_IP),
+				seccomp.EqualTo(syscall.IP_RECVTTL),
+			},
 			{
 				seccomp.MatchAny{},
 				seccomp.EqualTo(syscall.SOL_IPV6),
@@ -351,6 +356,11 @@ func hostInetFilters() seccomp.SyscallRules {
 				seccomp.EqualTo(syscall.SOL_IPV6),
 				seccomp.EqualTo(syscall.IPV6_RECVTCLASS),
 			},
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(syscall.SOL_IPV6),
+				seccomp.EqualTo(syscall.IPV6_RECVHOPLIMIT),
+			},
 			{
 				seccomp.MatchAny{},
 				seccomp.EqualTo(syscall.SOL_IPV6),
@@ -411,6 +421,10 @@ func hostInetFilters() seccomp.SyscallRules {
 				seccomp.MatchAny{},
 				seccomp.EqualTo(syscall.TIOCINQ),
 			},
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(linux.SIOCOUTQNSD),
+			},
 		},
 		syscall.SYS_LISTEN:   {},
 		syscall.SYS_READV:    {},
@@ -468,6 +482,13 @@ func hostInetFilters() seccomp.SyscallRules {
 				seccomp.MatchAny{},
 				seccomp.EqualTo(4),
 			},
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(syscall.SOL_IP),
+				seccomp.EqualTo(syscall.IP_RECVTTL),
+				seccomp.MatchAny{},
+				seccomp.EqualTo(4),
+			},
 			{
 				seccomp.MatchAny{},
 				seccomp.EqualTo(syscall.SOL_IPV6),
@@ -482,6 +503,13 @@ func hostInetFilters() seccomp.SyscallRules {
 				seccomp.MatchAny{},
 				seccomp.EqualTo(4),
 			},
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(syscall.SOL_IPV6),
+				seccomp.EqualTo(syscall.IPV6_RECVHOPLIMIT),
+				seccomp.MatchAny{},
+				seccomp.EqualTo(4),
+			},
 		},
 		syscall.SYS_SHUTDOWN: []seccomp.Rule{
 			{
@@ -523,6 +551,37 @@ func hostInetFilters() seccomp.SyscallRules {
 	}
 }
 
+// hostInetRawFilters contains syscalls that are needed by hostinet raw IP and
+// packet sockets. The protocols match those allowed by hostinet.
+func hostInetRawFilters() seccomp.SyscallRules {
+	var rules []seccomp.Rule
+	add := func(family, stype int, protocols ...int) {
+		for _, protocol := range protocols {
+			rules = append(rules, seccomp.Rule{
+				seccomp.EqualTo(family),
+				seccomp.EqualTo(stype | syscall.SOCK_NONBLOCK | syscall.SOCK_CLOEXEC),
+				seccomp.EqualTo(protocol),
+			})
+		}
+	}
+	add(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_ICMP, syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_RAW)
+	add(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_ICMPV6, syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_RAW)
+	for _, stype := range []int{syscall.SOCK_RAW, syscall.SOCK_DGRAM} {
+		// The protocol of packet sockets is an ethertype in network byte
+		// order.
+		add(syscall.AF_PACKET, stype,
+			0,
+			0x0300, // htons(ETH_P_ALL)
+			0x0008, // htons(ETH_P_IP)
+			0x0608, // htons(ETH_P_ARP)
+			0xdd86, // htons(ETH_P_IPV6)
+		)
+	}
+	return seccomp.SyscallRules{
+		syscall.SYS_SOCKET: rules,
+	}
+}
+
 func controlServerFilters(fd int) seccomp.SyscallRules {
 	return seccomp.SyscallRules{
 		syscall.SYS_ACCEPT: []seccomp.Rule{
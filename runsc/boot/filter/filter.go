@@ -27,8 +27,13 @@ import (
 type Options struct {
 	Platform      platform.Platform
 	HostNetwork   bool
+	HostRaw       bool
 	ProfileEnable bool
 	ControllerFD  int
+
+	// NetworkPluginRules are the syscalls needed by the plugin network
+	// stack, if any.
+	NetworkPluginRules seccomp.SyscallRules
 }
 
 // Install installs seccomp filters for based on the given platform.
@@ -43,6 +48,14 @@ func Install(opt Options) error {
 	if opt.HostNetwork {
 		Report("host networking enabled: syscall filters less restrictive!")
 		s.Merge(hostInetFilters())
+		if opt.HostRaw {
+			Report("host raw sockets enabled: syscall filters less restrictive!")
+			s.Merge(hostInetRawFilters())
+		}
+	}
+	if opt.NetworkPluginRules != nil {
+		Report("plugin network stack enabled: syscall filters less restrictive!")
+		s.Merge(opt.NetworkPluginRules)
 	}
 	if opt.ProfileEnable {
 		Report("profile enabled: syscall filters less restrictive!")
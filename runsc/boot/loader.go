@@ -79,8 +79,10 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/socket/hostinet"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/sockdiag"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/uevent"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sentry/socket/plugin"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/unix"
 )
 
@@ -259,6 +261,19 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("enabling strace: %v", err)
 	}
 
+	if args.TotalMem > 0 {
+		// Adjust the total memory returned by the Sentry so that applications that
+		// use /proc/meminfo can make allocations based on this limit.
+		usage.MinimumTotalMemoryBytes = args.TotalMem
+		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
+	}
+
+	// Bound the memory held in socket buffers by the memory available to the
+	// sandbox. This must happen after the total memory is known.
+	if err := setTransportMemoryLimits(usage.TotalMemory(0, 0)); err != nil {
+		return nil, fmt.Errorf("setting socket buffer memory limits: %v", err)
+	}
+
 	// Create root network namespace/stack.
 	netns, err := newRootNetworkNamespace(args.Conf, k, k)
 	if err != nil {
@@ -291,13 +306,6 @@ func New(args Args) (*Loader, error) {
 	log.Infof("CPUs: %d", args.NumCPU)
 	runtime.GOMAXPROCS(args.NumCPU)
 
-	if args.TotalMem > 0 {
-		// Adjust the total memory returned by the Sentry so that applications that
-		// use /proc/meminfo can make allocations based on this limit.
-		usage.MinimumTotalMemoryBytes = args.TotalMem
-		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
-	}
-
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
 	if err = k.Init(kernel.InitKernelArgs{
@@ -315,6 +323,10 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("initializing kernel: %v", err)
 	}
 
+	// Forward neighbor state changes of the sandbox stack to netlink
+	// listeners. This only has effect when the neighbor cache is in use.
+	notifyNeighborEvents(k, netns)
+
 	if kernel.VFS2Enabled {
 		if err := registerFilesystems(k); err != nil {
 			return nil, fmt.Errorf("registering filesystems: %w", err)
@@ -533,9 +545,13 @@ func (l *Loader) installSeccompFilters() error {
 		opts := filter.Options{
 			Platform:      l.k.Platform,
 			HostNetwork:   l.root.conf.Network == config.NetworkHost,
+			HostRaw:       l.root.conf.HostRawSockets > 0,
 			ProfileEnable: l.root.conf.ProfileEnable,
 			ControllerFD:  l.ctrl.srv.FD(),
 		}
+		if l.root.conf.Network == config.NetworkPlugin {
+			opts.NetworkPluginRules = plugin.Registered().SeccompRules()
+		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %v", err)
 		}
@@ -568,6 +584,13 @@ func (l *Loader) run() error {
 			return err
 		}
 	}
+	if l.root.conf.Network == config.NetworkPlugin {
+		s := l.k.RootNetworkNamespace().Stack().(plugin.Stack)
+		log.Debugf("Starting plugin network stack %q", s.Name())
+		if err := s.PreStart(); err != nil {
+			return fmt.Errorf("starting plugin network stack %q: %v", s.Name(), err)
+		}
+	}
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -1061,7 +1084,9 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 	switch conf.Network {
 	case config.NetworkHost:
 		// No network namespacing support for hostinet yet, hence creator is nil.
-		return inet.NewRootNamespace(hostinet.NewStack(), nil), nil
+		s := hostinet.NewStack()
+		s.EnableRawSockets(int32(conf.HostRawSockets))
+		return inet.NewRootNamespace(s, nil), nil
 
 	case config.NetworkNone, config.NetworkSandbox:
 		s, err := newEmptySandboxNetworkStack(clock, uniqueID)
@@ -1074,6 +1099,19 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 		}
 		return inet.NewRootNamespace(s, creator), nil
 
+	case config.NetworkPlugin:
+		// No network namespacing support for plugin stacks yet, hence
+		// creator is nil.
+		s := plugin.Registered()
+		if s == nil {
+			return nil, fmt.Errorf("no plugin network stack is built into runsc")
+		}
+		if err := s.Init(&plugin.InitStackArgs{Config: conf.NetworkPluginConfig}); err != nil {
+			return nil, fmt.Errorf("initializing plugin network stack %q: %v", s.Name(), err)
+		}
+		log.Infof("Using plugin network stack %q with capabilities %s", s.Name(), s.Capabilities())
+		return inet.NewRootNamespace(s, nil), nil
+
 	default:
 		panic(fmt.Sprintf("invalid network configuration: %v", conf.Network))
 	}
@@ -1082,8 +1120,15 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 
 func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID) (inet.Stack, error) {
 	netProtos := []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol}
-	transProtos := []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4}
-	s := netstack.Stack{stack.New(stack.Options{
+	transProtos := []stack.TransportProtocolFactory{
+		tcp.NewProtocolWithMemory(&tcpMemory),
+		udp.NewProtocolWithMemory(&udpMemory),
+		icmp.NewProtocol4,
+		// ICMPv6 echo sockets, and raw ICMPv6 sockets along with their
+		// ICMPV6_FILTER, need the ICMPv6 transport protocol.
+		icmp.NewProtocol6,
+	}
+	s := netstack.Stack{Stack: stack.New(stack.Options{
 		NetworkProtocols:   netProtos,
 		TransportProtocols: transProtos,
 		Clock:              clock,
@@ -1123,9 +1168,58 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID) (in
 		}
 	}
 
+	// Coalesce small writes, as Linux does by default.
+	{
+		opt := tcpip.TCPAutocorkingOption(true)
+		if err := s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+			return nil, fmt.Errorf("SetTransportProtocolOption(%d, &%T(%t)): %s", tcp.ProtocolNumber, opt, opt, err)
+		}
+	}
+
 	return &s, nil
 }
 
+// tcpMemory and udpMemory account for the memory held in the socket buffers of
+// all netstack instances of the sandbox. As with Linux's tcp_mem and udp_mem,
+// which are shared by all network namespaces, their limits apply to the
+// sandbox as a whole and changing them affects every instance.
+var (
+	tcpMemory stack.TransportMemory
+	udpMemory stack.TransportMemory
+)
+
+// The fraction of total memory used as the memory pressure threshold of
+// transport protocols, as in Linux's tcp_init_mem and udp_init.
+const (
+	tcpMemoryShare = 16
+	udpMemoryShare = 8
+)
+
+// setTransportMemoryLimits sets the default limits of tcpMemory and udpMemory,
+// derived from the total memory of the sandbox.
+func setTransportMemoryLimits(totalMem uint64) error {
+	tcpOpt := transportMemoryLimits(totalMem / tcpMemoryShare)
+	if err := tcpMemory.SetLimits(tcpOpt); err != nil {
+		return fmt.Errorf("tcpMemory.SetLimits(%+v): %s", tcpOpt, err)
+	}
+	udpOpt := transportMemoryLimits(totalMem / udpMemoryShare)
+	if err := udpMemory.SetLimits(udpOpt); err != nil {
+		return fmt.Errorf("udpMemory.SetLimits(%+v): %s", udpOpt, err)
+	}
+	return nil
+}
+
+// transportMemoryLimits returns limits derived from the pressure threshold
+// the same way Linux sizes tcp_mem and udp_mem.
+func transportMemoryLimits(pressure uint64) tcpip.TransportMemoryLimitsOption {
+	min := int(pressure / 4 * 3)
+	return tcpip.TransportMemoryLimitsOption{
+		Min:      min,
+		Pressure: int(pressure),
+		Max:      min * 2,
+	}
+}
+
 // sandboxNetstackCreator implements kernel.NetworkStackCreator.
 //
 // +stateify savable
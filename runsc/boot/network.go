@@ -16,16 +16,29 @@ package boot
 
 import (
 	"fmt"
+	"math"
 	"net"
+	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/bpf/ebpf"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/clsbpf"
+	"gvisor.dev/gvisor/pkg/tcpip/ipfix"
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc"
 	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fifo"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
@@ -64,12 +77,30 @@ var (
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
 	Stack *stack.Stack
+
+	// Kernel is the kernel the network stack belongs to, if any. It is used
+	// to notify netlink sockets of changes made to the stack.
+	Kernel *kernel.Kernel
+
+	mu sync.Mutex
+	// pcapFiles holds the files the traffic of NICs is being captured to.
+	pcapFiles map[tcpip.NICID]*os.File
+	// stopFlowExport, if not nil, stops exporting flows and waits for the
+	// final export.
+	stopFlowExport func()
+	// egressLimits holds the endpoints limiting the egress rate of NICs, by
+	// NIC name.
+	egressLimits map[string]*qdisc.Endpoint
 }
 
 // Route represents a route in the network stack.
 type Route struct {
 	Destination net.IPNet
 	Gateway     net.IP
+
+	// Source, if set, restricts the route to packets whose source address
+	// it contains.
+	Source net.IPNet
 }
 
 // DefaultRoute represents a catch all route to the default gateway.
@@ -78,19 +109,35 @@ type DefaultRoute struct {
 	Name  string
 }
 
+// Neighbor is a static association of an address to a link address.
+type Neighbor struct {
+	Address     net.IP
+	LinkAddress net.HardwareAddr
+}
+
 // FDBasedLink configures an fd-based link.
 type FDBasedLink struct {
 	Name               string
 	MTU                int
 	Addresses          []IPWithPrefix
 	Routes             []Route
+	Neighbors          []Neighbor
 	GSOMaxSize         uint32
 	SoftwareGSOEnabled bool
 	TXChecksumOffload  bool
 	RXChecksumOffload  bool
+	NegotiateOffloads  bool
 	LinkAddress        net.HardwareAddr
 	QDisc              config.QueueingDiscipline
 
+	// EgressRate is the rate, in bytes per second, to which the traffic sent
+	// by the link is limited. Zero means unlimited.
+	EgressRate uint64
+
+	// SaveRestore indicates that connections over this link are preserved
+	// across checkpoint and restore.
+	SaveRestore bool
+
 	// NumChannels controls how many underlying FD's are to be used to
 	// create this endpoint.
 	NumChannels int
@@ -115,6 +162,11 @@ type CreateLinksAndRoutesArgs struct {
 
 	Defaultv4Gateway DefaultRoute
 	Defaultv6Gateway DefaultRoute
+
+	// SecondaryDefaultRoutes are the default routes of interfaces other than
+	// those of Defaultv4Gateway and Defaultv6Gateway. They are added after
+	// these, so they only apply to traffic bound to their interface.
+	SecondaryDefaultRoutes []DefaultRoute
 }
 
 // IPWithPrefix is an address with its subnet prefix length.
@@ -132,7 +184,7 @@ func (ip IPWithPrefix) String() string {
 
 // Empty returns true if route hasn't been set.
 func (r *Route) Empty() bool {
-	return r.Destination.IP == nil && r.Destination.Mask == nil && r.Gateway == nil
+	return r.Destination.IP == nil && r.Destination.Mask == nil && r.Gateway == nil && r.Source.IP == nil && r.Source.Mask == nil
 }
 
 func (r *Route) toTcpipRoute(id tcpip.NICID) (tcpip.Route, error) {
@@ -140,11 +192,18 @@ func (r *Route) toTcpipRoute(id tcpip.NICID) (tcpip.Route, error) {
 	if err != nil {
 		return tcpip.Route{}, err
 	}
-	return tcpip.Route{
+	rt := tcpip.Route{
 		Destination: subnet,
 		Gateway:     ipToAddress(r.Gateway),
 		NIC:         id,
-	}, nil
+	}
+	if r.Source.IP != nil {
+		rt.Source, err = tcpip.NewSubnet(ipToAddress(r.Source.IP), ipMaskToAddressMask(r.Source.Mask))
+		if err != nil {
+			return tcpip.Route{}, err
+		}
+	}
+	return rt, nil
 }
 
 // CreateLinksAndRoutes creates links and routes in a network stack.  It should
@@ -216,11 +275,30 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			SoftwareGSOEnabled: link.SoftwareGSOEnabled,
 			TXChecksumOffload:  link.TXChecksumOffload,
 			RXChecksumOffload:  link.RXChecksumOffload,
+			NegotiateOffloads:  link.NegotiateOffloads,
+			SaveRestore:        link.SaveRestore,
 		})
 		if err != nil {
 			return err
 		}
 
+		// The egress rate is limited by the innermost endpoint, out of
+		// reach of tc, so that it can't be lifted from the sandbox.
+		if link.EgressRate != 0 {
+			log.Infof("Limiting egress rate of %q to %d bytes/s", link.Name, link.EgressRate)
+			rate := link.EgressRate
+			limit := qdisc.New(linkEP, n.Stack.Clock(), func() qdisc.Discipline {
+				return newEgressLimit(rate)
+			})
+			n.mu.Lock()
+			if n.egressLimits == nil {
+				n.egressLimits = make(map[string]*qdisc.Endpoint)
+			}
+			n.egressLimits[link.Name] = limit
+			n.mu.Unlock()
+			linkEP = limit
+		}
+
 		switch link.QDisc {
 		case config.QDiscNone:
 		case config.QDiscFIFO:
@@ -231,10 +309,25 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		// Enable support for AF_PACKET sockets to receive outgoing packets.
 		linkEP = packetsocket.New(linkEP)
 
+		switch link.QDisc {
+		case config.QDiscFQCoDel:
+			log.Infof("Enabling fq_codel QDisc on %q", link.Name)
+			// The queueing discipline is the outermost endpoint so that it
+			// can be found and replaced with tc. As in Linux, AF_PACKET
+			// sockets see outgoing packets when they leave it.
+			linkEP = qdisc.New(linkEP, n.Stack.Clock(), newDefaultQDisc)
+		case config.QDiscSFQ:
+			log.Infof("Enabling sfq QDisc on %q", link.Name)
+			linkEP = qdisc.New(linkEP, n.Stack.Clock(), newSFQQDisc)
+		}
+
 		log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
 		if err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses); err != nil {
 			return err
 		}
+		if err := n.addNeighbors(nicID, link.Neighbors); err != nil {
+			return err
+		}
 
 		// Collect the routes from this link.
 		for _, r := range link.Routes {
@@ -270,13 +363,116 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		routes = append(routes, route)
 	}
 
+	for _, r := range args.SecondaryDefaultRoutes {
+		nicID, ok := nicids[r.Name]
+		if !ok {
+			return fmt.Errorf("invalid interface name %q for default route", r.Name)
+		}
+		route, err := r.Route.toTcpipRoute(nicID)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+
 	log.Infof("Setting routes %+v", routes)
 	n.Stack.SetRouteTable(routes)
 	return nil
 }
 
+// newDefaultQDisc returns the default queueing discipline of NICs using
+// config.QDiscFQCoDel.
+func newDefaultQDisc() qdisc.Discipline {
+	d, err := qdisc.NewFQCoDel(qdisc.DefaultFQCoDelOptions())
+	if err != nil {
+		panic(fmt.Sprintf("invalid default fq_codel options: %v", err))
+	}
+	return d
+}
+
+// newEgressLimit returns a discipline limiting the egress rate of a NIC to rate
+// bytes per second, or unlimited if rate is zero.
+func newEgressLimit(rate uint64) qdisc.Discipline {
+	if rate == 0 {
+		return qdisc.NewPFIFO(1000)
+	}
+	// The bucket holds 10ms worth of traffic, and at least a GSO segment,
+	// so that the rate is reached despite the timer granularity. Packets
+	// wait up to 50ms for the bucket to fill.
+	burst := rate / 100
+	if burst < 64<<10 {
+		burst = 64 << 10
+	}
+	limit := burst + rate/20
+	if limit > math.MaxUint32 {
+		limit = math.MaxUint32
+	}
+	if burst > limit {
+		burst = limit
+	}
+	d, err := qdisc.NewTBF(qdisc.TBFOptions{
+		Rate:  rate,
+		Burst: uint32(burst),
+		Limit: uint32(limit),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("invalid egress limit options: %v", err))
+	}
+	return d
+}
+
+// newSFQQDisc returns the default queueing discipline of NICs using
+// config.QDiscSFQ.
+func newSFQQDisc() qdisc.Discipline {
+	d, err := qdisc.NewSFQ(qdisc.DefaultSFQOptions())
+	if err != nil {
+		panic(fmt.Sprintf("invalid default sfq options: %v", err))
+	}
+	return d
+}
+
+// addNeighbors adds the given neighbors to the NIC id as static entries. Only
+// permanent neighbors of the host should be passed, as static entries are never
+// re-resolved.
+func (n *Network) addNeighbors(id tcpip.NICID, neighbors []Neighbor) error {
+	for _, neigh := range neighbors {
+		addr := ipToAddress(neigh.Address)
+		linkAddr := tcpip.LinkAddress(neigh.LinkAddress)
+		switch err := n.Stack.AddStaticNeighbor(id, addr, linkAddr); err {
+		case nil:
+		case tcpip.ErrNotSupported:
+			// The stack uses the link address cache rather than the neighbor
+			// cache.
+			n.Stack.AddLinkAddress(id, addr, linkAddr)
+		default:
+			return fmt.Errorf("AddStaticNeighbor(%d, %s, %s) failed: %v", id, addr, linkAddr, err)
+		}
+	}
+	return nil
+}
+
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
+// notifyNeighborEvents sends RTM_NEWNEIGH and RTM_DELNEIGH notifications to
+// the RTNLGRP_NEIGH group of netns for every neighbor state change of its
+// stack, and logs the link address conflicts of protected neighbors. It does
+// nothing if netns isn't backed by netstack.
+func notifyNeighborEvents(k *kernel.Kernel, netns *inet.Namespace) {
+	eps, ok := netns.Stack().(*netstack.Stack)
+	if !ok {
+		return
+	}
+	ctx := k.SupervisorContext()
+	eps.Stack.SubscribeNeighborEvents(func(ev stack.NeighborEvent) {
+		if ev.Reason == stack.NeighborEventConflict {
+			log.Warningf("NIC %d: ignored link address %s advertised for neighbor %s at %s, possible ARP spoofing", ev.NICID, ev.ConflictingLinkAddr, ev.Entry.Addr, ev.Entry.LinkAddr)
+			return
+		}
+		typ, n := netstack.NeighborFromEvent(ev)
+		route.NotifyNeighbor(ctx, netns, typ, n)
+	})
+}
+
 func (n *Network) createNICWithAddrs(id tcpip.NICID, name string, ep stack.LinkEndpoint, addrs []IPWithPrefix) error {
 	opts := stack.NICOptions{Name: name}
 	if err := n.Stack.CreateNICWithOptions(id, sniffer.New(ep), opts); err != nil {
@@ -296,6 +492,700 @@ func (n *Network) createNICWithAddrs(id tcpip.NICID, name string, ep stack.LinkE
 	return nil
 }
 
+// MirrorArgs are arguments to the Mirror method.
+type MirrorArgs struct {
+	// NIC is the name of the NIC whose traffic is mirrored.
+	NIC string
+
+	// Ingress and Egress select the traffic mirrored. Mirroring is stopped
+	// if neither is set.
+	Ingress bool
+	Egress  bool
+
+	// Target is the name of the NIC the traffic is mirrored to, if any.
+	Target string
+
+	// FilePayload optionally contains a file the traffic is captured to in
+	// the pcap format. The file is closed once mirroring is changed again.
+	urpc.FilePayload
+}
+
+// nicIDByName returns the ID of the NIC named name.
+func (n *Network) nicIDByName(name string) (tcpip.NICID, error) {
+	for id, info := range n.Stack.NICInfo() {
+		if info.Name == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no NIC named %q", name)
+}
+
+// Mirror changes how the traffic of a NIC is mirrored. It can be called at any
+// time without interrupting traffic.
+func (n *Network) Mirror(args *MirrorArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	var opts stack.MirrorOptions
+	if args.Ingress {
+		opts.Direction |= stack.MirrorIngress
+	}
+	if args.Egress {
+		opts.Direction |= stack.MirrorEgress
+	}
+	if args.Target != "" {
+		if opts.NIC, err = n.nicIDByName(args.Target); err != nil {
+			return err
+		}
+	}
+	var pcapFile *os.File
+	switch len(args.FilePayload.Files) {
+	case 0:
+	case 1:
+		pcapFile = args.FilePayload.Files[0]
+		sink, err := sniffer.NewPCAPSink(pcapFile, 65536)
+		if err != nil {
+			pcapFile.Close()
+			return fmt.Errorf("writing pcap header: %v", err)
+		}
+		opts.Sink = sink
+	default:
+		return fmt.Errorf("got %d files, want at most 1", len(args.FilePayload.Files))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.Stack.SetNICMirror(id, opts); err != nil {
+		if pcapFile != nil {
+			pcapFile.Close()
+		}
+		return fmt.Errorf("SetNICMirror(%d, %+v) failed: %v", id, opts, err)
+	}
+	log.Infof("Mirroring traffic of NIC %q: %+v", args.NIC, opts)
+	if old, ok := n.pcapFiles[id]; ok {
+		old.Close()
+		delete(n.pcapFiles, id)
+	}
+	if pcapFile != nil {
+		if n.pcapFiles == nil {
+			n.pcapFiles = make(map[tcpip.NICID]*os.File)
+		}
+		n.pcapFiles[id] = pcapFile
+	}
+	return nil
+}
+
+// RemoveLinkArgs are arguments to the RemoveLink method.
+type RemoveLinkArgs struct {
+	// Name is the name of the NIC to remove.
+	Name string
+}
+
+// RemoveLink removes a NIC from the network stack, as when a device is
+// unplugged. Its addresses, routes, multicast memberships and neighbor entries
+// are removed with it, sockets bound to it get an error, and netlink sockets
+// listening for link, address and route changes are notified.
+func (n *Network) RemoveLink(args *RemoveLinkArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.Name)
+	if err != nil {
+		return err
+	}
+
+	// Take a snapshot of the state the netlink notifications describe
+	// before it goes away with the NIC.
+	var (
+		ns     *inet.Namespace
+		iface  inet.Interface
+		addrs  []inet.InterfaceAddr
+		routes []inet.Route
+	)
+	idx := int32(id)
+	if n.Kernel != nil {
+		ns = n.Kernel.RootNetworkNamespace()
+		s := ns.Stack()
+		iface = s.Interfaces()[idx]
+		addrs = s.InterfaceAddrs()[idx]
+		for _, rt := range s.RouteTable() {
+			if rt.OutputInterface == idx {
+				routes = append(routes, rt)
+			}
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.Stack.RemoveNIC(id); err != nil {
+		return fmt.Errorf("RemoveNIC(%d) failed: %v", id, err)
+	}
+	log.Infof("Removed NIC %q", args.Name)
+	if f, ok := n.pcapFiles[id]; ok {
+		f.Close()
+		delete(n.pcapFiles, id)
+	}
+
+	if ns != nil {
+		route.NotifyLinkRemoved(n.Kernel.SupervisorContext(), ns, idx, iface, addrs, routes)
+	}
+	return nil
+}
+
+// ExportFlowsArgs are arguments to the ExportFlows method.
+type ExportFlowsArgs struct {
+	// Interval is the interval at which the accounting of active flows is
+	// exported.
+	Interval time.Duration
+
+	// ObservationDomainID identifies the sandbox to the collector.
+	ObservationDomainID uint32
+
+	// FilePayload contains the socket connected to the collector flows are
+	// exported to. Exporting is stopped if it is empty.
+	urpc.FilePayload
+}
+
+// ExportFlows enables flow accounting and exports it as IPFIX to a collector,
+// replacing any previous collector. The socket is closed once exporting is
+// changed again.
+func (n *Network) ExportFlows(args *ExportFlowsArgs, _ *struct{}) error {
+	var collector *os.File
+	switch len(args.FilePayload.Files) {
+	case 0:
+	case 1:
+		collector = args.FilePayload.Files[0]
+		if args.Interval <= 0 {
+			collector.Close()
+			return fmt.Errorf("invalid export interval %v", args.Interval)
+		}
+	default:
+		return fmt.Errorf("got %d files, want at most 1", len(args.FilePayload.Files))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	it := n.Stack.IPTables()
+	if n.stopFlowExport != nil {
+		it.DisableFlowAccounting()
+		n.stopFlowExport()
+		n.stopFlowExport = nil
+	}
+	if collector == nil {
+		log.Infof("Stopped exporting flows")
+		return nil
+	}
+
+	e, err := ipfix.NewExporter(collector, ipfix.Options{ObservationDomainID: args.ObservationDomainID})
+	if err != nil {
+		collector.Close()
+		return err
+	}
+	it.EnableFlowAccounting(e.FlowExpired)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer collector.Close()
+		ticker := time.NewTicker(args.Interval)
+		defer ticker.Stop()
+		for {
+			stopped := false
+			select {
+			case <-ticker.C:
+			case <-stop:
+				stopped = true
+			}
+			if err := e.Export(it.Flows(), time.Now()); err != nil {
+				log.Warningf("Exporting flows failed: %v", err)
+			}
+			if stopped {
+				return
+			}
+		}
+	}()
+	n.stopFlowExport = func() {
+		close(stop)
+		<-done
+	}
+	log.Infof("Exporting flows every %v", args.Interval)
+	return nil
+}
+
+// AttachBPFArgs are arguments to the AttachBPF method.
+type AttachBPFArgs struct {
+	// NIC is the name of the NIC the program is attached to.
+	NIC string
+
+	// Egress selects the attach point of the program, the egress of the NIC
+	// rather than its ingress.
+	Egress bool
+
+	// Section is the section of the program in the object file. It may be
+	// empty if the object file holds a single program.
+	Section string
+
+	// FilePayload contains the ELF object file of the program. The program
+	// attached to the NIC, if any, is detached if it is empty.
+	urpc.FilePayload
+}
+
+// attachPoint returns the attach point selected by egress.
+func attachPoint(egress bool) stack.TCAttachPoint {
+	if egress {
+		return stack.TCEgress
+	}
+	return stack.TCIngress
+}
+
+// AttachBPF attaches an eBPF classifier to a NIC, replacing any previous one.
+func (n *Network) AttachBPF(args *AttachBPFArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	var c stack.PacketClassifier
+	switch len(args.FilePayload.Files) {
+	case 0:
+	case 1:
+		f := args.FilePayload.Files[0]
+		defer f.Close()
+		coll, err := ebpf.LoadCollection(f)
+		if err != nil {
+			return fmt.Errorf("loading eBPF object: %v", err)
+		}
+		p, ok := coll.Programs[args.Section]
+		if args.Section == "" && len(coll.Programs) == 1 {
+			for _, p = range coll.Programs {
+			}
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("no program in section %q", args.Section)
+		}
+		c = clsbpf.New(p)
+	default:
+		return fmt.Errorf("got %d files, want at most 1", len(args.FilePayload.Files))
+	}
+
+	at := attachPoint(args.Egress)
+	if err := n.Stack.SetNICClassifier(id, at, c); err != nil {
+		return fmt.Errorf("SetNICClassifier(%d, %d, _) failed: %v", id, at, err)
+	}
+	log.Infof("eBPF classifier of NIC %q changed, egress: %t", args.NIC, args.Egress)
+	return nil
+}
+
+// BPFArgs are arguments to the BPF method.
+type BPFArgs struct {
+	// NIC is the name of the NIC the program is attached to.
+	NIC string
+
+	// Egress selects the attach point of the program, the egress of the NIC
+	// rather than its ingress.
+	Egress bool
+}
+
+// BPFMap is the content of an eBPF map.
+type BPFMap struct {
+	Name    string
+	Entries []ebpf.MapEntry
+}
+
+// BPFInfo describes an eBPF classifier.
+type BPFInfo struct {
+	// Errors is the number of runs of the program which failed.
+	Errors uint64
+
+	// Maps are the maps of the program.
+	Maps []BPFMap
+}
+
+// BPF returns the state of the eBPF classifier attached to a NIC.
+func (n *Network) BPF(args *BPFArgs, info *BPFInfo) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	c, tcpipErr := n.Stack.NICClassifier(id, attachPoint(args.Egress))
+	if tcpipErr != nil {
+		return fmt.Errorf("NICClassifier(%d, _) failed: %v", id, tcpipErr)
+	}
+	bc, ok := c.(*clsbpf.Classifier)
+	if !ok {
+		return fmt.Errorf("no eBPF classifier attached to NIC %q", args.NIC)
+	}
+	info.Errors = bc.Errors()
+	for _, m := range bc.Program().Maps() {
+		info.Maps = append(info.Maps, BPFMap{
+			Name:    m.Spec().Name,
+			Entries: m.Entries(),
+		})
+	}
+	return nil
+}
+
+// LinkState describes a NIC of the network stack.
+type LinkState struct {
+	Name        string
+	Enabled     bool
+	Promiscuous bool
+	Addresses   []IPWithPrefix
+
+	// EgressRate is the rate, in bytes per second, to which the traffic
+	// sent by the NIC is limited, or zero if unlimited.
+	EgressRate uint64
+}
+
+// RouteState describes a route of the network stack.
+type RouteState struct {
+	// NIC is the name of the NIC the route goes through.
+	NIC   string
+	Route Route
+}
+
+// NetworkState describes the NICs and routes of the network stack.
+type NetworkState struct {
+	Links  []LinkState
+	Routes []RouteState
+}
+
+// State returns the NICs, addresses and routes of the network stack.
+func (n *Network) State(_ *struct{}, state *NetworkState) error {
+	nics := n.Stack.NICInfo()
+	addrs := n.Stack.AllAddresses()
+	ids := make([]tcpip.NICID, 0, len(nics))
+	for id := range nics {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		info := nics[id]
+		link := LinkState{
+			Name:        info.Name,
+			Enabled:     info.Flags.Running,
+			Promiscuous: info.Flags.Promiscuous,
+			EgressRate:  n.egressRate(info.Name),
+		}
+		for _, a := range addrs[id] {
+			link.Addresses = append(link.Addresses, IPWithPrefix{
+				Address:   net.IP(a.AddressWithPrefix.Address),
+				PrefixLen: a.AddressWithPrefix.PrefixLen,
+			})
+		}
+		state.Links = append(state.Links, link)
+	}
+	for _, rt := range n.Stack.GetRouteTable() {
+		route := Route{
+			Destination: net.IPNet{
+				IP:   net.IP(rt.Destination.ID()),
+				Mask: net.IPMask(rt.Destination.Mask()),
+			},
+			Gateway: net.IP(rt.Gateway),
+		}
+		if rt.Source != (tcpip.Subnet{}) {
+			route.Source = net.IPNet{
+				IP:   net.IP(rt.Source.ID()),
+				Mask: net.IPMask(rt.Source.Mask()),
+			}
+		}
+		state.Routes = append(state.Routes, RouteState{
+			NIC:   nics[rt.NIC].Name,
+			Route: route,
+		})
+	}
+	return nil
+}
+
+// RouteArgs are arguments to the AddRoute and RemoveRoute methods.
+type RouteArgs struct {
+	// NIC is the name of the NIC the route goes through.
+	NIC   string
+	Route Route
+}
+
+// AddRoute appends a route to the route table of the network stack.
+func (n *Network) AddRoute(args *RouteArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	rt, err := args.Route.toTcpipRoute(id)
+	if err != nil {
+		return err
+	}
+	n.Stack.AddRoute(rt)
+	log.Infof("Added route %s", rt)
+	return nil
+}
+
+// RemoveRoute removes a route from the route table of the network stack.
+func (n *Network) RemoveRoute(args *RouteArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	rt, err := args.Route.toTcpipRoute(id)
+	if err != nil {
+		return err
+	}
+	found := false
+	n.Stack.RemoveRoutes(func(r tcpip.Route) bool {
+		if r == rt {
+			found = true
+			return true
+		}
+		return false
+	})
+	if !found {
+		return fmt.Errorf("no route %s", rt)
+	}
+	log.Infof("Removed route %s", rt)
+	return nil
+}
+
+// AddressArgs are arguments to the AddAddress and RemoveAddress methods.
+type AddressArgs struct {
+	// NIC is the name of the NIC the address is assigned to.
+	NIC     string
+	Address IPWithPrefix
+}
+
+// AddAddress assigns an address to a NIC.
+func (n *Network) AddAddress(args *AddressArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	proto, addr := ipToAddressAndProto(args.Address.Address)
+	ap := tcpip.AddressWithPrefix{
+		Address:   addr,
+		PrefixLen: args.Address.PrefixLen,
+	}
+	if err := n.Stack.AddAddressWithPrefix(id, proto, ap); err != nil {
+		return fmt.Errorf("AddAddressWithPrefix(%d, %d, %s) failed: %v", id, proto, ap, err)
+	}
+	log.Infof("Added address %s to NIC %q", args.Address, args.NIC)
+	return nil
+}
+
+// RemoveAddress removes an address from a NIC.
+func (n *Network) RemoveAddress(args *AddressArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	addr := ipToAddress(args.Address.Address)
+	if err := n.Stack.RemoveAddress(id, addr); err != nil {
+		return fmt.Errorf("RemoveAddress(%d, %s) failed: %v", id, addr, err)
+	}
+	log.Infof("Removed address %s from NIC %q", args.Address, args.NIC)
+	return nil
+}
+
+// FlushNeighborsArgs are arguments to the FlushNeighbors method.
+type FlushNeighborsArgs struct {
+	// NIC is the name of the NIC whose neighbors are flushed. The neighbors
+	// of all NICs are flushed if it is empty.
+	NIC string
+}
+
+// FlushNeighbors removes the neighbor entries of NICs, including static ones.
+func (n *Network) FlushNeighbors(args *FlushNeighborsArgs, _ *struct{}) error {
+	var ids []tcpip.NICID
+	if args.NIC != "" {
+		id, err := n.nicIDByName(args.NIC)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	} else {
+		for id := range n.Stack.NICInfo() {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		if err := n.Stack.ClearNeighbors(id); err != nil {
+			return fmt.Errorf("ClearNeighbors(%d) failed: %v", id, err)
+		}
+	}
+	log.Infof("Flushed neighbors of %d NICs", len(ids))
+	return nil
+}
+
+// FlushConnections removes all the connections tracked for NAT and flow
+// accounting, and returns how many were removed.
+func (n *Network) FlushConnections(_ *struct{}, removed *int) error {
+	*removed = n.Stack.IPTables().FlushConnections()
+	log.Infof("Flushed %d tracked connections", *removed)
+	return nil
+}
+
+// LinkOptionsArgs are arguments to the SetLinkOptions method. Only the
+// options whose Set field is true are changed.
+type LinkOptionsArgs struct {
+	// NIC is the name of the NIC whose options are changed.
+	NIC string
+
+	// SetEnabled indicates whether Enabled is set.
+	SetEnabled bool
+
+	// Enabled is whether the NIC sends and receives packets.
+	Enabled bool
+
+	// SetPromiscuous indicates whether Promiscuous is set.
+	SetPromiscuous bool
+
+	// Promiscuous is whether the NIC accepts packets addressed to any
+	// address.
+	Promiscuous bool
+
+	// SetSpoofing indicates whether Spoofing is set.
+	SetSpoofing bool
+
+	// Spoofing is whether endpoints may send packets from any address
+	// through the NIC.
+	Spoofing bool
+}
+
+// SetLinkOptions changes the options of a NIC.
+func (n *Network) SetLinkOptions(args *LinkOptionsArgs, _ *struct{}) error {
+	id, err := n.nicIDByName(args.NIC)
+	if err != nil {
+		return err
+	}
+	if args.SetEnabled {
+		var err *tcpip.Error
+		if args.Enabled {
+			err = n.Stack.EnableNIC(id)
+		} else {
+			err = n.Stack.DisableNIC(id)
+		}
+		if err != nil {
+			return fmt.Errorf("setting NIC %d enabled to %t failed: %v", id, args.Enabled, err)
+		}
+	}
+	if args.SetPromiscuous {
+		if err := n.Stack.SetPromiscuousMode(id, args.Promiscuous); err != nil {
+			return fmt.Errorf("SetPromiscuousMode(%d, %t) failed: %v", id, args.Promiscuous, err)
+		}
+	}
+	if args.SetSpoofing {
+		if err := n.Stack.SetSpoofing(id, args.Spoofing); err != nil {
+			return fmt.Errorf("SetSpoofing(%d, %t) failed: %v", id, args.Spoofing, err)
+		}
+	}
+	log.Infof("Changed options of NIC %q: %+v", args.NIC, args)
+	return nil
+}
+
+// NetworkEvent describes an anomaly recorded in the event log of the network
+// stack.
+type NetworkEvent struct {
+	Time time.Time
+	Kind string
+
+	// NIC is the name of the NIC the offending packet was received on, if
+	// known.
+	NIC string
+
+	// Protocol is the number of the network or transport protocol which
+	// recorded the event.
+	Protocol uint32
+
+	// Source and SourcePort are the source address and port of the
+	// offending packet.
+	Source     net.IP
+	SourcePort uint16
+
+	Detail string
+
+	// Suppressed is the number of events of the same kind which were not
+	// recorded since the previous one, because of rate limiting.
+	Suppressed uint64
+}
+
+// EventsArgs are arguments to the Events method.
+type EventsArgs struct {
+	// Clear indicates whether the event log is cleared once retrieved.
+	Clear bool
+}
+
+// Events returns the anomalies recorded in the event log of the network stack,
+// from the oldest to the newest.
+func (n *Network) Events(args *EventsArgs, events *[]NetworkEvent) error {
+	nics := n.Stack.NICInfo()
+	for _, e := range n.Stack.Events() {
+		*events = append(*events, NetworkEvent{
+			Time:       e.Time,
+			Kind:       e.Kind.String(),
+			NIC:        nics[e.NICID].Name,
+			Protocol:   e.Protocol,
+			Source:     net.IP(e.Source.Addr),
+			SourcePort: e.Source.Port,
+			Detail:     e.Detail,
+			Suppressed: e.Suppressed,
+		})
+	}
+	if args.Clear {
+		n.Stack.ClearEvents()
+		log.Infof("Cleared the network event log")
+	}
+	return nil
+}
+
+// egressRate returns the rate to which the egress of the NIC name is limited,
+// or zero if unlimited.
+func (n *Network) egressRate(name string) uint64 {
+	n.mu.Lock()
+	limit, ok := n.egressLimits[name]
+	n.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	if d, _, _ := limit.Discipline(); d != nil {
+		if tbf, ok := d.(*qdisc.TBF); ok {
+			return tbf.Options().Rate
+		}
+	}
+	return 0
+}
+
+// EgressRateArgs are arguments to the SetEgressRate method.
+type EgressRateArgs struct {
+	// NIC is the name of the NIC whose egress rate is changed, or empty
+	// for all the NICs.
+	NIC string
+
+	// Rate is the rate, in bytes per second, to which the traffic sent by
+	// the NIC is limited. Zero lifts the limit.
+	Rate uint64
+}
+
+// SetEgressRate changes the rate to which the traffic sent by NICs is limited.
+// Only the NICs whose egress rate was limited when they were created can be
+// changed. Packets queued when the rate is changed are dropped.
+func (n *Network) SetEgressRate(args *EgressRateArgs, _ *struct{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if args.NIC != "" {
+		limit, ok := n.egressLimits[args.NIC]
+		if !ok {
+			return fmt.Errorf("egress rate of NIC %q isn't limited, the sandbox must be started with --egress-rate", args.NIC)
+		}
+		limit.SetDiscipline(newEgressLimit(args.Rate), 0)
+		log.Infof("Limited egress rate of NIC %q to %d bytes/s", args.NIC, args.Rate)
+		return nil
+	}
+	if len(n.egressLimits) == 0 {
+		return fmt.Errorf("egress rate isn't limited, the sandbox must be started with --egress-rate")
+	}
+	for name, limit := range n.egressLimits {
+		limit.SetDiscipline(newEgressLimit(args.Rate), 0)
+		log.Infof("Limited egress rate of NIC %q to %d bytes/s", name, args.Rate)
+	}
+	return nil
+}
+
 // ipToAddressAndProto converts IP to tcpip.Address and a protocol number.
 //
 // Note: don't use 'len(ip)' to determine IP version because length is always 16.
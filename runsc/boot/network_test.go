@@ -0,0 +1,142 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const testNICName = "lo"
+
+// newTestNetwork returns a Network whose stack has a single loopback NIC named
+// testNICName.
+func newTestNetwork(t *testing.T) *Network {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+	})
+	if err := s.CreateNICWithOptions(1, loopback.New(), stack.NICOptions{Name: testNICName}); err != nil {
+		t.Fatalf("CreateNICWithOptions(1, _, %q): %s", testNICName, err)
+	}
+	return &Network{Stack: s}
+}
+
+func TestNICIDByName(t *testing.T) {
+	n := newTestNetwork(t)
+
+	if id, err := n.nicIDByName(testNICName); err != nil || id != 1 {
+		t.Errorf("got n.nicIDByName(%q) = (%d, %v), want = (1, nil)", testNICName, id, err)
+	}
+
+	const unknown = "eth0"
+	wantErr := `no NIC named "eth0"`
+	route := Route{
+		Destination: net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	}
+	for _, tc := range []struct {
+		name string
+		call func() error
+	}{
+		{"nicIDByName", func() error { _, err := n.nicIDByName(unknown); return err }},
+		{"AddRoute", func() error { return n.AddRoute(&RouteArgs{NIC: unknown, Route: route}, nil) }},
+		{"RemoveRoute", func() error { return n.RemoveRoute(&RouteArgs{NIC: unknown, Route: route}, nil) }},
+		{"AddAddress", func() error {
+			return n.AddAddress(&AddressArgs{NIC: unknown, Address: IPWithPrefix{Address: net.IPv4(10, 0, 0, 1).To4(), PrefixLen: 8}}, nil)
+		}},
+		{"FlushNeighbors", func() error { return n.FlushNeighbors(&FlushNeighborsArgs{NIC: unknown}, nil) }},
+		{"SetLinkOptions", func() error { return n.SetLinkOptions(&LinkOptionsArgs{NIC: unknown, SetEnabled: true}, nil) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.call(); err == nil || !strings.Contains(err.Error(), wantErr) {
+				t.Errorf("got %s on NIC %q = %v, want error containing %q", tc.name, unknown, err, wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	n := newTestNetwork(t)
+
+	added := Route{
+		Destination: net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+		Gateway:     net.IPv4(10, 0, 0, 1).To4(),
+	}
+	if err := n.AddRoute(&RouteArgs{NIC: testNICName, Route: added}, nil); err != nil {
+		t.Fatalf("AddRoute(%+v): %v", added, err)
+	}
+
+	other := added
+	other.Gateway = net.IPv4(10, 0, 0, 2).To4()
+	if err := n.RemoveRoute(&RouteArgs{NIC: testNICName, Route: other}, nil); err == nil || !strings.Contains(err.Error(), "no route") {
+		t.Errorf("got RemoveRoute(%+v) = %v, want a \"no route\" error", other, err)
+	}
+	if got := len(n.Stack.GetRouteTable()); got != 1 {
+		t.Errorf("got %d routes after failing to remove a route, want = 1", got)
+	}
+
+	if err := n.RemoveRoute(&RouteArgs{NIC: testNICName, Route: added}, nil); err != nil {
+		t.Errorf("RemoveRoute(%+v): %v", added, err)
+	}
+	if got := n.Stack.GetRouteTable(); len(got) != 0 {
+		t.Errorf("got route table %v after removing the route, want it empty", got)
+	}
+	if err := n.RemoveRoute(&RouteArgs{NIC: testNICName, Route: added}, nil); err == nil || !strings.Contains(err.Error(), "no route") {
+		t.Errorf("got RemoveRoute(%+v) of a removed route = %v, want a \"no route\" error", added, err)
+	}
+}
+
+// TestSourceSpecificRoute verifies that the source of routes is reported by
+// State, and taken into account by RemoveRoute.
+func TestSourceSpecificRoute(t *testing.T) {
+	n := newTestNetwork(t)
+
+	route := Route{
+		Destination: net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+		Gateway:     net.IPv4(10, 0, 0, 1).To4(),
+		Source:      net.IPNet{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+	}
+	if err := n.AddRoute(&RouteArgs{NIC: testNICName, Route: route}, nil); err != nil {
+		t.Fatalf("AddRoute(%+v): %v", route, err)
+	}
+
+	var state NetworkState
+	if err := n.State(nil, &state); err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	want := []RouteState{{NIC: testNICName, Route: route}}
+	if !reflect.DeepEqual(state.Routes, want) {
+		t.Errorf("got state.Routes = %+v, want = %+v", state.Routes, want)
+	}
+
+	anySource := route
+	anySource.Source = net.IPNet{}
+	if err := n.RemoveRoute(&RouteArgs{NIC: testNICName, Route: anySource}, nil); err == nil {
+		t.Errorf("RemoveRoute(%+v) removed a source-specific route", anySource)
+	}
+	if err := n.RemoveRoute(&RouteArgs{NIC: testNICName, Route: route}, nil); err != nil {
+		t.Errorf("RemoveRoute(%+v): %v", route, err)
+	}
+	if got := n.Stack.GetRouteTable(); len(got) != 0 {
+		t.Errorf("got route table %v after removing the route, want it empty", got)
+	}
+}
@@ -16,6 +16,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -25,6 +27,8 @@ import (
 	"github.com/google/subcommands"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/tcpip/ipfix"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -45,6 +49,31 @@ type Debug struct {
 	logPackets   string
 	duration     time.Duration
 	ps           bool
+	mirror       string
+	mirrorDir    string
+	mirrorTo     string
+	mirrorPCAP   string
+	flowExport   string
+	flowInterval time.Duration
+	bpf          string
+	bpfDir       string
+	bpfObject    string
+	bpfSection   string
+	network      bool
+	routeAdd     string
+	routeDel     string
+	addrAdd      string
+	addrDel      string
+	flushNeigh   string
+	flushConns   bool
+	link         string
+	linkEnabled  string
+	linkPromisc  string
+	linkSpoofing string
+	egressRate   string
+	egressNIC    string
+	netEvents    bool
+	clearEvents  bool
 }
 
 // Name implements subcommands.Command.
@@ -70,13 +99,38 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.profileCPU, "profile-cpu", "", "writes CPU profile to the given file.")
 	f.StringVar(&d.profileBlock, "profile-block", "", "writes block profile to the given file.")
 	f.StringVar(&d.profileMutex, "profile-mutex", "", "writes mutex profile to the given file.")
-	f.DurationVar(&d.duration, "duration", time.Second, "amount of time to wait for CPU and trace profiles")
+	f.DurationVar(&d.duration, "duration", time.Second, "amount of time to wait for CPU and trace profiles, and pcap captures")
 	f.StringVar(&d.trace, "trace", "", "writes an execution trace to the given file.")
 	f.IntVar(&d.signal, "signal", -1, "sends signal to the sandbox")
 	f.StringVar(&d.strace, "strace", "", `A comma separated list of syscalls to trace. "all" enables all traces, "off" disables all`)
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
+	f.StringVar(&d.mirror, "mirror", "", "name of the sandbox NIC whose traffic is mirrored, as configured by --mirror-dir, --mirror-to and --mirror-pcap.")
+	f.StringVar(&d.mirrorDir, "mirror-dir", "both", "traffic mirrored: ingress, egress, both or none to stop mirroring.")
+	f.StringVar(&d.mirrorTo, "mirror-to", "", "name of the sandbox NIC the traffic is mirrored to, until changed again.")
+	f.StringVar(&d.mirrorPCAP, "mirror-pcap", "", "captures the mirrored traffic to the given file in the pcap format, for the time set by --duration.")
+	f.StringVar(&d.flowExport, "flow-export", "", `exports the accounting of TCP flows as IPFIX to the given UDP collector address, until changed again. "none" stops exporting.`)
+	f.DurationVar(&d.flowInterval, "flow-interval", time.Minute, "interval at which active flows are exported, with --flow-export.")
+	f.StringVar(&d.bpf, "bpf", "", "name of the sandbox NIC whose eBPF classifier is attached with --bpf-object, or whose maps are shown otherwise.")
+	f.StringVar(&d.bpfDir, "bpf-dir", "ingress", "attach point of the eBPF classifier: ingress or egress.")
+	f.StringVar(&d.bpfObject, "bpf-object", "", `ELF object file of the eBPF classifier attached with --bpf. "none" detaches the classifier.`)
+	f.StringVar(&d.bpfSection, "bpf-section", "", "section of the eBPF classifier in the object file, if it holds several programs.")
+	f.BoolVar(&d.network, "network", false, "lists the NICs, addresses and routes of the sandbox network stack.")
+	f.StringVar(&d.routeAdd, "route-add", "", "adds a route given as <nic>,<destination>[,<gateway>[,<source>]], e.g. eth0,10.0.0.0/8,192.168.0.1. The gateway may be empty.")
+	f.StringVar(&d.routeDel, "route-del", "", "removes a route given as <nic>,<destination>[,<gateway>[,<source>]].")
+	f.StringVar(&d.addrAdd, "addr-add", "", "adds an address given as <nic>,<address>/<prefix length>, e.g. eth0,192.168.0.2/24.")
+	f.StringVar(&d.addrDel, "addr-del", "", "removes an address given as <nic>,<address>/<prefix length>.")
+	f.StringVar(&d.flushNeigh, "flush-neighbors", "", `flushes the neighbor entries of the given sandbox NIC, or of all NICs if "all".`)
+	f.BoolVar(&d.flushConns, "flush-conntrack", false, "flushes the connections tracked for NAT and flow accounting.")
+	f.StringVar(&d.link, "link", "", "name of the sandbox NIC whose options are changed with --link-enabled, --link-promisc and --link-spoofing.")
+	f.StringVar(&d.linkEnabled, "link-enabled", "", "A boolean value to enable or disable the NIC: true or false.")
+	f.StringVar(&d.linkPromisc, "link-promisc", "", "A boolean value to enable or disable promiscuous mode: true or false.")
+	f.StringVar(&d.linkSpoofing, "link-spoofing", "", "A boolean value to allow or prevent sending from any address: true or false.")
+	f.StringVar(&d.egressRate, "egress-rate", "", `changes the rate to which the egress of sandbox NICs started with --egress-rate is limited, e.g. "10mbit". "0" lifts the limit.`)
+	f.StringVar(&d.egressNIC, "egress-nic", "", "name of the sandbox NIC whose egress rate is changed with --egress-rate. All limited NICs if empty.")
+	f.BoolVar(&d.netEvents, "net-events", false, "lists the anomalies recorded by the sandbox network stack: checksum errors, reset storms, SYN floods and martian packets.")
+	f.BoolVar(&d.clearEvents, "net-events-clear", false, "clears the anomalies recorded by the sandbox network stack, after listing them with --net-events.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -214,6 +268,266 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		log.Infof("Tracing started for %v, writing to %q", d.duration, d.trace)
 	}
 
+	if d.mirror != "" {
+		args := boot.MirrorArgs{
+			NIC:    d.mirror,
+			Target: d.mirrorTo,
+		}
+		switch strings.ToLower(d.mirrorDir) {
+		case "ingress":
+			args.Ingress = true
+		case "egress":
+			args.Egress = true
+		case "both":
+			args.Ingress = true
+			args.Egress = true
+		case "none":
+		default:
+			return Errorf("invalid mirror direction %q", d.mirrorDir)
+		}
+		if d.mirrorPCAP == "" {
+			if err := c.Sandbox.Mirror(&args, nil); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("Mirroring of NIC %q changed", d.mirror)
+		} else {
+			delay = true
+			f, err := os.Create(d.mirrorPCAP)
+			if err != nil {
+				return Errorf(err.Error())
+			}
+			defer func() {
+				// Keep mirroring to the target NIC, if any.
+				stop := boot.MirrorArgs{NIC: d.mirror}
+				if d.mirrorTo != "" {
+					stop = args
+				}
+				if err := c.Sandbox.Mirror(&stop, nil); err != nil {
+					Fatalf(err.Error())
+				}
+				f.Close()
+				log.Infof("Traffic of NIC %q written to %q", d.mirror, d.mirrorPCAP)
+			}()
+			if err := c.Sandbox.Mirror(&args, f); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("Capturing traffic of NIC %q for %v, writing to %q", d.mirror, d.duration, d.mirrorPCAP)
+		}
+	}
+
+	if d.flowExport != "" {
+		// The sandbox PID identifies it to the collector.
+		args := boot.ExportFlowsArgs{
+			Interval:            d.flowInterval,
+			ObservationDomainID: uint32(c.Sandbox.Pid),
+		}
+		if strings.ToLower(d.flowExport) == "none" {
+			if err := c.Sandbox.ExportFlows(&args, nil); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("Flow export stopped")
+		} else {
+			addr := d.flowExport
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(addr, strconv.Itoa(ipfix.DefaultPort))
+			}
+			conn, err := net.Dial("udp", addr)
+			if err != nil {
+				return Errorf("connecting to flow collector %q: %v", addr, err)
+			}
+			f, err := conn.(*net.UDPConn).File()
+			conn.Close()
+			if err != nil {
+				return Errorf(err.Error())
+			}
+			defer f.Close()
+			if err := c.Sandbox.ExportFlows(&args, f); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("Exporting flows to %q every %v", addr, d.flowInterval)
+		}
+	}
+
+	if d.bpf != "" {
+		var egress bool
+		switch strings.ToLower(d.bpfDir) {
+		case "ingress":
+		case "egress":
+			egress = true
+		default:
+			return Errorf("invalid eBPF attach point %q", d.bpfDir)
+		}
+		switch d.bpfObject {
+		case "":
+			info, err := c.Sandbox.BPF(&boot.BPFArgs{NIC: d.bpf, Egress: egress})
+			if err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("eBPF classifier of NIC %q: %d failed runs", d.bpf, info.Errors)
+			for _, m := range info.Maps {
+				log.Infof("Map %q:", m.Name)
+				for _, e := range m.Entries {
+					log.Infof("  %x: %x", e.Key, e.Value)
+				}
+			}
+		case "none":
+			if err := c.Sandbox.AttachBPF(&boot.AttachBPFArgs{NIC: d.bpf, Egress: egress}, nil); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("eBPF classifier of NIC %q detached", d.bpf)
+		default:
+			f, err := os.Open(d.bpfObject)
+			if err != nil {
+				return Errorf(err.Error())
+			}
+			defer f.Close()
+			args := boot.AttachBPFArgs{
+				NIC:     d.bpf,
+				Egress:  egress,
+				Section: d.bpfSection,
+			}
+			if err := c.Sandbox.AttachBPF(&args, f); err != nil {
+				return Errorf(err.Error())
+			}
+			log.Infof("eBPF classifier %q attached to NIC %q", d.bpfObject, d.bpf)
+		}
+	}
+
+	if d.routeAdd != "" {
+		args, err := parseRoute(d.routeAdd)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkAddRoute, args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Route %q added", d.routeAdd)
+	}
+	if d.routeDel != "" {
+		args, err := parseRoute(d.routeDel)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkRemoveRoute, args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Route %q removed", d.routeDel)
+	}
+	if d.addrAdd != "" {
+		args, err := parseAddress(d.addrAdd)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkAddAddress, args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Address %q added", d.addrAdd)
+	}
+	if d.addrDel != "" {
+		args, err := parseAddress(d.addrDel)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkRemoveAddress, args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Address %q removed", d.addrDel)
+	}
+	if d.flushNeigh != "" {
+		var args boot.FlushNeighborsArgs
+		if strings.ToLower(d.flushNeigh) != "all" {
+			args.NIC = d.flushNeigh
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkFlushNeighbors, &args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Neighbors of %q flushed", d.flushNeigh)
+	}
+	if d.flushConns {
+		removed, err := c.Sandbox.FlushConnections()
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("%d tracked connections flushed", removed)
+	}
+	if d.link != "" {
+		args := boot.LinkOptionsArgs{NIC: d.link}
+		var err error
+		if args.SetEnabled, args.Enabled, err = parseOptionalBool("link-enabled", d.linkEnabled); err != nil {
+			return Errorf(err.Error())
+		}
+		if args.SetPromiscuous, args.Promiscuous, err = parseOptionalBool("link-promisc", d.linkPromisc); err != nil {
+			return Errorf(err.Error())
+		}
+		if args.SetSpoofing, args.Spoofing, err = parseOptionalBool("link-spoofing", d.linkSpoofing); err != nil {
+			return Errorf(err.Error())
+		}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkSetLinkOptions, &args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Options of NIC %q changed", d.link)
+	}
+	if d.egressRate != "" {
+		rate, err := config.ParseRate(d.egressRate)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		args := boot.EgressRateArgs{NIC: d.egressNIC, Rate: uint64(rate)}
+		if err := c.Sandbox.ChangeNetwork(boot.NetworkSetEgressRate, &args); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Egress rate changed to %d bytes/s", rate)
+	}
+	if d.network {
+		state, err := c.Sandbox.NetworkState()
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		for _, l := range state.Links {
+			log.Infof("NIC %q: enabled: %t, promiscuous: %t", l.Name, l.Enabled, l.Promiscuous)
+			if l.EgressRate != 0 {
+				log.Infof("  egress rate %d bytes/s", l.EgressRate)
+			}
+			for _, a := range l.Addresses {
+				log.Infof("  address %s", a)
+			}
+		}
+		for _, r := range state.Routes {
+			route := r.Route.Destination.String()
+			if r.Route.Source.IP != nil {
+				route += " from " + r.Route.Source.String()
+			}
+			if len(r.Route.Gateway) != 0 {
+				route += " via " + r.Route.Gateway.String()
+			}
+			log.Infof("Route %s dev %s", route, r.NIC)
+		}
+	}
+	if d.netEvents || d.clearEvents {
+		events, err := c.Sandbox.NetworkEvents(d.clearEvents)
+		if err != nil {
+			return Errorf(err.Error())
+		}
+		if d.netEvents {
+			for _, e := range events {
+				msg := fmt.Sprintf("%s %s nic %q proto %d src %s", e.Time.Format(time.RFC3339Nano), e.Kind, e.NIC, e.Protocol, e.Source)
+				if e.SourcePort != 0 {
+					msg += fmt.Sprintf(" port %d", e.SourcePort)
+				}
+				if e.Detail != "" {
+					msg += ": " + e.Detail
+				}
+				if e.Suppressed != 0 {
+					msg += fmt.Sprintf(" (%d suppressed)", e.Suppressed)
+				}
+				log.Infof("%s", msg)
+			}
+		}
+		if d.clearEvents {
+			log.Infof("Network event log cleared")
+		}
+	}
+
 	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
 		args := control.LoggingArgs{}
 		switch strings.ToLower(d.strace) {
@@ -288,3 +602,66 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	return subcommands.ExitSuccess
 }
+
+// parseRoute parses a route given as <nic>,<destination>[,<gateway>[,<source>]].
+// The gateway may be empty, and the source is a subnet.
+func parseRoute(s string) (*boot.RouteArgs, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, fmt.Errorf("invalid route %q, want <nic>,<destination>[,<gateway>[,<source>]]", s)
+	}
+	_, dst, err := net.ParseCIDR(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid route destination %q: %v", parts[1], err)
+	}
+	args := &boot.RouteArgs{
+		NIC:   parts[0],
+		Route: boot.Route{Destination: *dst},
+	}
+	if len(parts) >= 3 && parts[2] != "" {
+		if args.Route.Gateway = net.ParseIP(parts[2]); args.Route.Gateway == nil {
+			return nil, fmt.Errorf("invalid route gateway %q", parts[2])
+		}
+	}
+	if len(parts) == 4 {
+		_, src, err := net.ParseCIDR(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid route source %q: %v", parts[3], err)
+		}
+		args.Route.Source = *src
+	}
+	return args, nil
+}
+
+// parseAddress parses an address given as <nic>,<address>/<prefix length>.
+func parseAddress(s string) (*boot.AddressArgs, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid address %q, want <nic>,<address>/<prefix length>", s)
+	}
+	ip, subnet, err := net.ParseCIDR(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", parts[1], err)
+	}
+	prefixLen, _ := subnet.Mask.Size()
+	return &boot.AddressArgs{
+		NIC: parts[0],
+		Address: boot.IPWithPrefix{
+			Address:   ip,
+			PrefixLen: prefixLen,
+		},
+	}, nil
+}
+
+// parseOptionalBool parses the value of the boolean flag name, which is left
+// unset if empty.
+func parseOptionalBool(name, value string) (set bool, b bool, err error) {
+	if value == "" {
+		return false, false, nil
+	}
+	b, err = strconv.ParseBool(value)
+	if err != nil {
+		return false, false, fmt.Errorf("invalid value for %s %q", name, value)
+	}
+	return true, b, nil
+}
@@ -19,6 +19,9 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
@@ -70,11 +73,20 @@ type Config struct {
 	// Network indicates what type of network to use.
 	Network NetworkType `flag:"network"`
 
+	// NetworkPluginConfig is passed to the plugin network stack when Network
+	// is NetworkPlugin. Its format is defined by the plugin.
+	NetworkPluginConfig string `flag:"network-plugin-config"`
+
 	// EnableRaw indicates whether raw sockets should be enabled. Raw
 	// sockets are disabled by stripping CAP_NET_RAW from the list of
 	// capabilities.
 	EnableRaw bool `flag:"net-raw"`
 
+	// HostRawSockets is the maximum number of raw IP and packet sockets the
+	// sandbox may have open at once with host networking. Zero disables them.
+	// Applications still need CAP_NET_RAW, see EnableRaw.
+	HostRawSockets int `flag:"host-raw-sockets"`
+
 	// HardwareGSO indicates that hardware segmentation offload is enabled.
 	HardwareGSO bool `flag:"gso"`
 
@@ -87,10 +99,24 @@ type Config struct {
 	// RXChecksumOffload indicates that RX Checksum Offload is enabled.
 	RXChecksumOffload bool `flag:"rx-checksum-offload"`
 
+	// NegotiateOffloads indicates that checksum and segmentation offloads
+	// are negotiated with the host device by the sandbox, instead of being
+	// set by TXChecksumOffload and RXChecksumOffload.
+	NegotiateOffloads bool `flag:"negotiate-offloads"`
+
 	// QDisc indicates the type of queuening discipline to use by default
 	// for non-loopback interfaces.
 	QDisc QueueingDiscipline `flag:"qdisc"`
 
+	// EgressRate is the rate, in bytes per second, to which the traffic
+	// sent by each non-loopback interface is limited. Zero means unlimited.
+	EgressRate Rate `flag:"egress-rate"`
+
+	// NetSaveRestore indicates that established TCP connections are saved
+	// and restored with the sandbox rather than reset. It must only be set if
+	// the restored sandbox keeps the network identity of the saved one.
+	NetSaveRestore bool `flag:"net-save-restore"`
+
 	// LogPackets indicates that all network packets should be logged.
 	LogPackets bool `flag:"log-packets"`
 
@@ -187,6 +213,12 @@ func (c *Config) validate() error {
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	if c.HostRawSockets < 0 {
+		return fmt.Errorf("host_raw_sockets must be >= 0, got: %d", c.HostRawSockets)
+	}
+	if c.HostRawSockets > 0 && c.Network != NetworkHost {
+		return fmt.Errorf("host_raw_sockets requires host networking")
+	}
 	return nil
 }
 
@@ -249,6 +281,10 @@ const (
 
 	// NetworkNone sets up just loopback using netstack.
 	NetworkNone
+
+	// NetworkPlugin uses the third-party network stack linked into runsc,
+	// see package gvisor.dev/gvisor/pkg/sentry/socket/plugin.
+	NetworkPlugin
 )
 
 func networkTypePtr(v NetworkType) *NetworkType {
@@ -264,6 +300,8 @@ func (n *NetworkType) Set(v string) error {
 		*n = NetworkHost
 	case "none":
 		*n = NetworkNone
+	case "plugin":
+		*n = NetworkPlugin
 	default:
 		return fmt.Errorf("invalid network type %q", v)
 	}
@@ -284,6 +322,8 @@ func (n *NetworkType) String() string {
 		return "host"
 	case NetworkNone:
 		return "none"
+	case NetworkPlugin:
+		return "plugin"
 	}
 	panic(fmt.Sprintf("Invalid network type %v", *n))
 }
@@ -298,6 +338,15 @@ const (
 
 	// QDiscFIFO applies a simple fifo based queue to the underlying FD.
 	QDiscFIFO
+
+	// QDiscFQCoDel applies fq_codel to the underlying FD. Unlike with
+	// QDiscFIFO, the queueing discipline can be replaced with tc.
+	QDiscFQCoDel
+
+	// QDiscSFQ applies sfq to the underlying FD, which sends packets of each
+	// flow in turn so that bulk flows don't starve the others. Like with
+	// QDiscFQCoDel, the queueing discipline can be replaced with tc.
+	QDiscSFQ
 )
 
 func queueingDisciplinePtr(v QueueingDiscipline) *QueueingDiscipline {
@@ -311,6 +360,10 @@ func (q *QueueingDiscipline) Set(v string) error {
 		*q = QDiscNone
 	case "fifo":
 		*q = QDiscFIFO
+	case "fq_codel":
+		*q = QDiscFQCoDel
+	case "sfq":
+		*q = QDiscSFQ
 	default:
 		return fmt.Errorf("invalid qdisc %q", v)
 	}
@@ -329,10 +382,91 @@ func (q *QueueingDiscipline) String() string {
 		return "none"
 	case QDiscFIFO:
 		return "fifo"
+	case QDiscFQCoDel:
+		return "fq_codel"
+	case QDiscSFQ:
+		return "sfq"
 	}
 	panic(fmt.Sprintf("Invalid qdisc %v", *q))
 }
 
+// Rate is a bandwidth in bytes per second. As with tc, it is written as a
+// number optionally followed by a unit: bit, kbit, mbit or gbit for bits per
+// second, or bps, kbps, mbps or gbps for bytes per second. A number without a
+// unit is in bytes per second. Multiples are powers of 1000.
+type Rate uint64
+
+// rateUnits are the units of rates, in bytes per second, by suffix. Longer
+// suffixes come first, so that they are matched before their own suffixes.
+var rateUnits = []struct {
+	suffix string
+	mul    uint64
+}{
+	{"kbit", 1000 / 8},
+	{"mbit", 1000 * 1000 / 8},
+	{"gbit", 1000 * 1000 * 1000 / 8},
+	{"kbps", 1000},
+	{"mbps", 1000 * 1000},
+	{"gbps", 1000 * 1000 * 1000},
+	{"bit", 0},
+	{"bps", 1},
+}
+
+// ParseRate parses a rate written as described by Rate.
+func ParseRate(v string) (Rate, error) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	for _, u := range rateUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(s, u.suffix), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid rate %q: %v", v, err)
+		}
+		if u.mul == 0 {
+			// Bits per second. A zero rate means no limit, so don't
+			// let smaller rates round down to it.
+			if n != 0 && n < 8 {
+				return 0, fmt.Errorf("invalid rate %q: less than 1 byte per second", v)
+			}
+			return Rate(n / 8), nil
+		}
+		if n > math.MaxUint64/u.mul {
+			return 0, fmt.Errorf("invalid rate %q: out of range", v)
+		}
+		return Rate(n * u.mul), nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %v", v, err)
+	}
+	return Rate(n), nil
+}
+
+func ratePtr(v Rate) *Rate {
+	return &v
+}
+
+// Set implements flag.Value.
+func (r *Rate) Set(v string) error {
+	rate, err := ParseRate(v)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// Get implements flag.Value.
+func (r *Rate) Get() interface{} {
+	return *r
+}
+
+// String implements flag.Value.
+func (r *Rate) String() string {
+	return strconv.FormatUint(uint64(*r), 10)
+}
+
 func leakModePtr(v refs.LeakMode) *refs.LeakMode {
 	return &v
 }
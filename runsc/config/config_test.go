@@ -130,6 +130,10 @@ func TestInvalidFlags(t *testing.T) {
 			name:  "qdisc",
 			error: "invalid qdisc",
 		},
+		{
+			name:  "egress-rate",
+			error: "invalid rate",
+		},
 		{
 			name:  "watchdog-action",
 			error: "invalid watchdog action",
@@ -270,3 +274,33 @@ func TestOverrideError(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRate(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  Rate
+	}{
+		{value: "0", want: 0},
+		{value: "1500", want: 1500},
+		{value: "0bit", want: 0},
+		{value: "8bit", want: 1},
+		{value: "800bit", want: 100},
+		{value: "100mbit", want: 12500000},
+		{value: "1Gbit", want: 125000000},
+		{value: "10kbps", want: 10000},
+		{value: "10mbps", want: 10000000},
+		{value: "42bps", want: 42},
+		{value: "18446744073709551615bps", want: 18446744073709551615},
+	} {
+		got, err := ParseRate(tc.value)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseRate(%q) = (%d, %v), want (%d, nil)", tc.value, got, err, tc.want)
+		}
+	}
+
+	for _, value := range []string{"", "mbit", "-1", "1.5mbit", "10 apples", "1bit", "7bit", "18446744073709551615kbps", "200000000000gbit"} {
+		if _, err := ParseRate(value); err == nil || !strings.Contains(err.Error(), "invalid rate") {
+			t.Errorf("ParseRate(%q) wrong error: %v", value, err)
+		}
+	}
+}
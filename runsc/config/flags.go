@@ -75,14 +75,19 @@ func RegisterFlags() {
 		flag.Bool("fuse", false, "TEST ONLY; use while FUSE in VFSv2 is landing. This allows the use of the new experimental FUSE filesystem.")
 
 		// Flags that control sandbox runtime behavior: network related.
-		flag.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
+		flag.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none, plugin. Using network inside the sandbox is more secure because it's isolated from the host network. plugin uses the third-party network stack built into runsc, if any.")
+		flag.String("network-plugin-config", "", "configuration passed to the plugin network stack with --network=plugin.")
+		flag.Int("host-raw-sockets", 0, "maximum number of raw IP and packet sockets the sandbox may have open at once with host networking. Zero disables them. Requires --network=host, and --net-raw unless the application runs with CAP_NET_RAW otherwise. Raw sockets on the host network allow containers to capture and inject traffic of the whole host.")
 		flag.Bool("net-raw", false, "enable raw sockets. When false, raw sockets are disabled by removing CAP_NET_RAW from containers (`runsc exec` will still be able to utilize raw sockets). Raw sockets allow malicious containers to craft packets and potentially attack the network.")
 		flag.Bool("gso", true, "enable hardware segmentation offload if it is supported by a network device.")
 		flag.Bool("software-gso", true, "enable software segmentation offload when hardware offload can't be enabled.")
 		flag.Bool("tx-checksum-offload", false, "enable TX checksum offload.")
 		flag.Bool("rx-checksum-offload", true, "enable RX checksum offload.")
-		flag.Var(queueingDisciplinePtr(QDiscFIFO), "qdisc", "specifies which queueing discipline to apply by default to the non loopback nics used by the sandbox.")
+		flag.Bool("negotiate-offloads", false, "negotiate checksum and segmentation offloads with the host network device at runtime, ignoring --tx-checksum-offload and --rx-checksum-offload.")
+		flag.Var(queueingDisciplinePtr(QDiscFIFO), "qdisc", "specifies which queueing discipline to apply by default to the non loopback nics used by the sandbox: none, fifo, fq_codel or sfq. With fq_codel and sfq, the discipline can be replaced with tc.")
+		flag.Var(ratePtr(0), "egress-rate", "limits the rate of the traffic sent by each non loopback nic used by the sandbox, e.g. 100mbit or 10mbps. A number without unit is in bytes per second. 0 (default) is unlimited. The limit can be lowered, but not raised, with the dev.gvisor.net.egress-rate annotation, and changed at runtime with runsc debug --egress-rate. It can't be removed with tc.")
 		flag.Int("num-network-channels", 1, "number of underlying channels(FDs) to use for network link endpoints.")
+		flag.Bool("net-save-restore", false, "preserve established TCP connections across checkpoint and restore instead of failing the checkpoint. Only safe if the sandbox is restored with the same addresses, routes and link addresses.")
 
 		// Test flags, not to be used outside tests, ever.
 		flag.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox.")
@@ -63,11 +63,11 @@ func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *config.Con
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
 		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf.HardwareGSO, conf.SoftwareGSO, conf.TXChecksumOffload, conf.RXChecksumOffload, conf.NumNetworkChannels, conf.QDisc); err != nil {
+		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf.HardwareGSO, conf.SoftwareGSO, conf.TXChecksumOffload, conf.RXChecksumOffload, conf.NegotiateOffloads, conf.NumNetworkChannels, conf.QDisc, conf.EgressRate, conf.NetSaveRestore); err != nil {
 			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
-	case config.NetworkHost:
-		// Nothing to do here.
+	case config.NetworkHost, config.NetworkPlugin:
+		// Nothing to do here: plugin stacks configure themselves.
 	default:
 		return fmt.Errorf("invalid network type: %v", conf.Network)
 	}
@@ -116,7 +116,7 @@ func isRootNS() (bool, error) {
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
 // them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, hardwareGSO bool, softwareGSO bool, txChecksumOffload bool, rxChecksumOffload bool, numNetworkChannels int, qDisc config.QueueingDiscipline) error {
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, hardwareGSO bool, softwareGSO bool, txChecksumOffload bool, rxChecksumOffload bool, negotiateOffloads bool, numNetworkChannels int, qDisc config.QueueingDiscipline, egressRate config.Rate, saveRestore bool) error {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
@@ -180,21 +180,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, hardwareG
 		if err != nil {
 			return fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
 		}
-		if defv4 != nil {
-			if !args.Defaultv4Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv4, args.Defaultv4Gateway)
-			}
-			args.Defaultv4Gateway.Route = *defv4
-			args.Defaultv4Gateway.Name = iface.Name
-		}
-
-		if defv6 != nil {
-			if !args.Defaultv6Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv6, args.Defaultv6Gateway)
-			}
-			args.Defaultv6Gateway.Route = *defv6
-			args.Defaultv6Gateway.Name = iface.Name
-		}
+		addDefaultRoutes(&args, iface.Name, defv4, defv6)
 
 		link := boot.FDBasedLink{
 			Name:              iface.Name,
@@ -202,8 +188,11 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, hardwareG
 			Routes:            routes,
 			TXChecksumOffload: txChecksumOffload,
 			RXChecksumOffload: rxChecksumOffload,
+			NegotiateOffloads: negotiateOffloads,
 			NumChannels:       numNetworkChannels,
 			QDisc:             qDisc,
+			EgressRate:        uint64(egressRate),
+			SaveRestore:       saveRestore,
 		}
 
 		// Get the link for the interface.
@@ -213,6 +202,13 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, hardwareG
 		}
 		link.LinkAddress = ifaceLink.Attrs().HardwareAddr
 
+		// Import the permanent neighbors, which the sandbox couldn't
+		// resolve otherwise.
+		link.Neighbors, err = neighborsForLink(ifaceLink)
+		if err != nil {
+			return fmt.Errorf("getting neighbors for interface %q: %w", iface.Name, err)
+		}
+
 		log.Debugf("Setting up network channels")
 		// Create the socket for the device.
 		for i := 0; i < link.NumChannels; i++ {
@@ -417,6 +413,60 @@ func routesForIface(iface net.Interface) ([]boot.Route, *boot.Route, *boot.Route
 	return routes, defv4, defv6, nil
 }
 
+// addDefaultRoutes adds the default routes of interface name to args. The
+// first interface with a default route provides the default gateway. Default
+// routes of other interfaces are kept for traffic bound to them.
+func addDefaultRoutes(args *boot.CreateLinksAndRoutesArgs, name string, defv4, defv6 *boot.Route) {
+	if defv4 != nil {
+		if args.Defaultv4Gateway.Route.Empty() {
+			args.Defaultv4Gateway.Route = *defv4
+			args.Defaultv4Gateway.Name = name
+		} else {
+			log.Infof("Secondary default route found, interface: %v, route: %v, default route: %+v", name, defv4, args.Defaultv4Gateway)
+			args.SecondaryDefaultRoutes = append(args.SecondaryDefaultRoutes, boot.DefaultRoute{Route: *defv4, Name: name})
+		}
+	}
+
+	if defv6 != nil {
+		if args.Defaultv6Gateway.Route.Empty() {
+			args.Defaultv6Gateway.Route = *defv6
+			args.Defaultv6Gateway.Name = name
+		} else {
+			log.Infof("Secondary default route found, interface: %v, route: %v, default route: %+v", name, defv6, args.Defaultv6Gateway)
+			args.SecondaryDefaultRoutes = append(args.SecondaryDefaultRoutes, boot.DefaultRoute{Route: *defv6, Name: name})
+		}
+	}
+}
+
+// neighborsForLink returns the permanent neighbors of the given link.
+func neighborsForLink(link netlink.Link) ([]boot.Neighbor, error) {
+	ns, err := netlink.NeighList(link.Attrs().Index, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	return permanentNeighbors(ns), nil
+}
+
+// permanentNeighbors returns the neighbors in ns which are in the
+// NUD_PERMANENT state.
+//
+// Only these are imported as static neighbors. Entries in other states were
+// resolved dynamically and may become stale, so the sandbox resolves them
+// again instead.
+func permanentNeighbors(ns []netlink.Neigh) []boot.Neighbor {
+	var neighbors []boot.Neighbor
+	for _, n := range ns {
+		if n.State&netlink.NUD_PERMANENT == 0 || len(n.HardwareAddr) == 0 || n.IP == nil {
+			continue
+		}
+		neighbors = append(neighbors, boot.Neighbor{
+			Address:     n.IP,
+			LinkAddress: n.HardwareAddr,
+		})
+	}
+	return neighbors
+}
+
 // removeAddress removes IP address from network device. It's equivalent to:
 //   ip addr del <ipAndMask> dev <name>
 func removeAddress(source netlink.Link, ipAndMask string) error {
@@ -0,0 +1,176 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+func TestPermanentNeighbors(t *testing.T) {
+	ip := net.ParseIP("10.0.0.1")
+	mac := net.HardwareAddr{0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+	want := []boot.Neighbor{{Address: ip, LinkAddress: mac}}
+
+	for _, tc := range []struct {
+		name  string
+		neigh netlink.Neigh
+		want  []boot.Neighbor
+	}{
+		{
+			name:  "permanent",
+			neigh: netlink.Neigh{State: netlink.NUD_PERMANENT, IP: ip, HardwareAddr: mac},
+			want:  want,
+		},
+		{
+			name:  "permanent and noarp",
+			neigh: netlink.Neigh{State: netlink.NUD_PERMANENT | netlink.NUD_NOARP, IP: ip, HardwareAddr: mac},
+			want:  want,
+		},
+		{
+			name:  "reachable",
+			neigh: netlink.Neigh{State: netlink.NUD_REACHABLE, IP: ip, HardwareAddr: mac},
+		},
+		{
+			name:  "stale",
+			neigh: netlink.Neigh{State: netlink.NUD_STALE, IP: ip, HardwareAddr: mac},
+		},
+		{
+			name:  "delay",
+			neigh: netlink.Neigh{State: netlink.NUD_DELAY, IP: ip, HardwareAddr: mac},
+		},
+		{
+			name:  "probe",
+			neigh: netlink.Neigh{State: netlink.NUD_PROBE, IP: ip, HardwareAddr: mac},
+		},
+		{
+			name:  "incomplete",
+			neigh: netlink.Neigh{State: netlink.NUD_INCOMPLETE, IP: ip},
+		},
+		{
+			name:  "failed",
+			neigh: netlink.Neigh{State: netlink.NUD_FAILED, IP: ip},
+		},
+		{
+			name:  "permanent without link address",
+			neigh: netlink.Neigh{State: netlink.NUD_PERMANENT, IP: ip},
+		},
+		{
+			name:  "permanent without address",
+			neigh: netlink.Neigh{State: netlink.NUD_PERMANENT, HardwareAddr: mac},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := permanentNeighbors([]netlink.Neigh{tc.neigh}); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got permanentNeighbors(%+v) = %+v, want = %+v", tc.neigh, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddDefaultRoutes(t *testing.T) {
+	defv4 := func(gw string) *boot.Route {
+		return &boot.Route{
+			Destination: net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)},
+			Gateway:     net.ParseIP(gw),
+		}
+	}
+	defv6 := func(gw string) *boot.Route {
+		return &boot.Route{
+			Destination: net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)},
+			Gateway:     net.ParseIP(gw),
+		}
+	}
+
+	type iface struct {
+		name         string
+		defv4, defv6 *boot.Route
+	}
+	for _, tc := range []struct {
+		name          string
+		ifaces        []iface
+		wantv4        boot.DefaultRoute
+		wantv6        boot.DefaultRoute
+		wantSecondary []boot.DefaultRoute
+	}{
+		{
+			name: "no default routes",
+			ifaces: []iface{
+				{name: "eth0"},
+				{name: "eth1"},
+			},
+		},
+		{
+			name: "single interface",
+			ifaces: []iface{
+				{name: "eth0", defv4: defv4("10.0.0.1"), defv6: defv6("fe80::1")},
+			},
+			wantv4: boot.DefaultRoute{Route: *defv4("10.0.0.1"), Name: "eth0"},
+			wantv6: boot.DefaultRoute{Route: *defv6("fe80::1"), Name: "eth0"},
+		},
+		{
+			name: "first interface without default route",
+			ifaces: []iface{
+				{name: "eth0"},
+				{name: "eth1", defv4: defv4("10.0.1.1")},
+			},
+			wantv4: boot.DefaultRoute{Route: *defv4("10.0.1.1"), Name: "eth1"},
+		},
+		{
+			name: "secondary default routes",
+			ifaces: []iface{
+				{name: "eth0", defv4: defv4("10.0.0.1"), defv6: defv6("fe80::1")},
+				{name: "eth1", defv4: defv4("10.0.1.1"), defv6: defv6("fe80::2")},
+				{name: "eth2", defv4: defv4("10.0.2.1")},
+			},
+			wantv4: boot.DefaultRoute{Route: *defv4("10.0.0.1"), Name: "eth0"},
+			wantv6: boot.DefaultRoute{Route: *defv6("fe80::1"), Name: "eth0"},
+			wantSecondary: []boot.DefaultRoute{
+				{Route: *defv4("10.0.1.1"), Name: "eth1"},
+				{Route: *defv6("fe80::2"), Name: "eth1"},
+				{Route: *defv4("10.0.2.1"), Name: "eth2"},
+			},
+		},
+		{
+			name: "default routes of different families on different interfaces",
+			ifaces: []iface{
+				{name: "eth0", defv4: defv4("10.0.0.1")},
+				{name: "eth1", defv6: defv6("fe80::2")},
+			},
+			wantv4: boot.DefaultRoute{Route: *defv4("10.0.0.1"), Name: "eth0"},
+			wantv6: boot.DefaultRoute{Route: *defv6("fe80::2"), Name: "eth1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var args boot.CreateLinksAndRoutesArgs
+			for _, i := range tc.ifaces {
+				addDefaultRoutes(&args, i.name, i.defv4, i.defv6)
+			}
+			if !reflect.DeepEqual(args.Defaultv4Gateway, tc.wantv4) {
+				t.Errorf("got Defaultv4Gateway = %+v, want = %+v", args.Defaultv4Gateway, tc.wantv4)
+			}
+			if !reflect.DeepEqual(args.Defaultv6Gateway, tc.wantv6) {
+				t.Errorf("got Defaultv6Gateway = %+v, want = %+v", args.Defaultv6Gateway, tc.wantv6)
+			}
+			if !reflect.DeepEqual(args.SecondaryDefaultRoutes, tc.wantSecondary) {
+				t.Errorf("got SecondaryDefaultRoutes = %+v, want = %+v", args.SecondaryDefaultRoutes, tc.wantSecondary)
+			}
+		})
+	}
+}
@@ -1120,6 +1120,149 @@ func (s *Sandbox) StopTrace() error {
 	return nil
 }
 
+// Mirror changes how the traffic of a NIC of the sandbox is mirrored. If f is
+// not nil, the traffic is captured to it in the pcap format.
+func (s *Sandbox) Mirror(args *boot.MirrorArgs, f *os.File) error {
+	log.Debugf("Mirror %q: %+v", s.ID, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	a := *args
+	if f != nil {
+		a.FilePayload = urpc.FilePayload{Files: []*os.File{f}}
+	}
+	if err := conn.Call(boot.NetworkMirror, &a, nil); err != nil {
+		return fmt.Errorf("mirroring traffic of NIC %q in sandbox %q: %v", args.NIC, s.ID, err)
+	}
+	return nil
+}
+
+// ExportFlows exports the accounting of the flows of the sandbox to the
+// collector f is connected to, or stops exporting if f is nil.
+func (s *Sandbox) ExportFlows(args *boot.ExportFlowsArgs, f *os.File) error {
+	log.Debugf("ExportFlows %q: %+v", s.ID, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	a := *args
+	if f != nil {
+		a.FilePayload = urpc.FilePayload{Files: []*os.File{f}}
+	}
+	if err := conn.Call(boot.NetworkExportFlows, &a, nil); err != nil {
+		return fmt.Errorf("exporting flows of sandbox %q: %v", s.ID, err)
+	}
+	return nil
+}
+
+// AttachBPF attaches the eBPF program in the object file f to a NIC of the
+// sandbox, or detaches it if f is nil.
+func (s *Sandbox) AttachBPF(args *boot.AttachBPFArgs, f *os.File) error {
+	log.Debugf("AttachBPF %q: %+v", s.ID, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	a := *args
+	if f != nil {
+		a.FilePayload = urpc.FilePayload{Files: []*os.File{f}}
+	}
+	if err := conn.Call(boot.NetworkAttachBPF, &a, nil); err != nil {
+		return fmt.Errorf("attaching eBPF program to NIC %q in sandbox %q: %v", args.NIC, s.ID, err)
+	}
+	return nil
+}
+
+// BPF returns the state of the eBPF program attached to a NIC of the sandbox.
+func (s *Sandbox) BPF(args *boot.BPFArgs) (*boot.BPFInfo, error) {
+	log.Debugf("BPF %q: %+v", s.ID, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var info boot.BPFInfo
+	if err := conn.Call(boot.NetworkBPF, args, &info); err != nil {
+		return nil, fmt.Errorf("getting eBPF program of NIC %q in sandbox %q: %v", args.NIC, s.ID, err)
+	}
+	return &info, nil
+}
+
+// NetworkState returns the NICs, addresses and routes of the network stack of
+// the sandbox.
+func (s *Sandbox) NetworkState() (*boot.NetworkState, error) {
+	log.Debugf("NetworkState %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var state boot.NetworkState
+	if err := conn.Call(boot.NetworkState, nil, &state); err != nil {
+		return nil, fmt.Errorf("getting network state of sandbox %q: %v", s.ID, err)
+	}
+	return &state, nil
+}
+
+// ChangeNetwork calls the URPC endpoint method of the network stack of the
+// sandbox with args, to change its routes, addresses, neighbors or NICs.
+func (s *Sandbox) ChangeNetwork(method string, args interface{}) error {
+	log.Debugf("ChangeNetwork %q: %s %+v", s.ID, method, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(method, args, nil); err != nil {
+		return fmt.Errorf("calling %s in sandbox %q: %v", method, s.ID, err)
+	}
+	return nil
+}
+
+// FlushConnections flushes the connection tracking table of the network stack
+// of the sandbox, and returns how many connections were removed.
+func (s *Sandbox) FlushConnections() (int, error) {
+	log.Debugf("FlushConnections %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var removed int
+	if err := conn.Call(boot.NetworkFlushConnections, nil, &removed); err != nil {
+		return 0, fmt.Errorf("flushing tracked connections of sandbox %q: %v", s.ID, err)
+	}
+	return removed, nil
+}
+
+// NetworkEvents returns the anomalies recorded in the event log of the network
+// stack of the sandbox, and clears the log if clear is true.
+func (s *Sandbox) NetworkEvents(clear bool) ([]boot.NetworkEvent, error) {
+	log.Debugf("NetworkEvents %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var events []boot.NetworkEvent
+	if err := conn.Call(boot.NetworkEvents, &boot.EventsArgs{Clear: clear}, &events); err != nil {
+		return nil, fmt.Errorf("getting network events of sandbox %q: %v", s.ID, err)
+	}
+	return events, nil
+}
+
 // ChangeLogging changes logging options.
 func (s *Sandbox) ChangeLogging(args control.LoggingArgs) error {
 	log.Debugf("Change logging start %q", s.ID)
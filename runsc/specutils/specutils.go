@@ -39,6 +39,10 @@ import (
 	"gvisor.dev/gvisor/runsc/config"
 )
 
+// EgressRateAnnotation is the OCI annotation limiting the rate of the traffic
+// sent by each interface of the sandbox, written as with --egress-rate.
+const EgressRateAnnotation = "dev.gvisor.net.egress-rate"
+
 // ExePath must point to runsc binary, which is normally the same binary. It's
 // changed in tests that aren't linked in the same binary.
 var ExePath = "/proc/self/exe"
@@ -206,6 +210,20 @@ func ReadSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config)
 		}
 	}
 
+	// The egress rate annotation doesn't require flag overrides to be
+	// allowed, but it can only lower the rate set by flags: the spec may be
+	// controlled by the user the limit applies to.
+	if val, ok := spec.Annotations[EgressRateAnnotation]; ok {
+		rate, err := config.ParseRate(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", EgressRateAnnotation, err)
+		}
+		if rate != 0 && (conf.EgressRate == 0 || rate < conf.EgressRate) {
+			log.Infof("Limiting egress rate to %d bytes/s from annotation", rate)
+			conf.EgressRate = rate
+		}
+	}
+
 	return &spec, nil
 }
 
@@ -24,6 +24,7 @@
 #include <time.h>
 #include <unistd.h>
 
+#include <algorithm>
 #include <iostream>
 #include <unordered_map>
 
@@ -267,6 +268,54 @@ class PosixImpl final : public posix_server::Posix::Service {
     return ::grpc::Status::OK;
   }
 
+  ::grpc::Status SendMsg(::grpc::ServerContext *context,
+                         const ::posix_server::SendMsgRequest *request,
+                         ::posix_server::SendMsgResponse *response) override {
+    std::string buf = request->buf();
+    iovec iov = {.iov_base = &buf[0], .iov_len = buf.size()};
+    msghdr msg = {};
+    msg.msg_iov = &iov;
+    msg.msg_iovlen = 1;
+
+    sockaddr_storage addr;
+    if (request->has_dest_addr()) {
+      socklen_t addr_len;
+      auto err = proto_to_sockaddr(request->dest_addr(), &addr, &addr_len);
+      if (!err.ok()) {
+        return err;
+      }
+      msg.msg_name = &addr;
+      msg.msg_namelen = addr_len;
+    }
+
+    size_t control_len = 0;
+    for (const auto &cmsg : request->cmsgs()) {
+      control_len += CMSG_SPACE(cmsg.data().size());
+    }
+    // The control buffer must be suitably aligned for struct cmsghdr.
+    std::vector<cmsghdr> control((control_len + sizeof(cmsghdr) - 1) /
+                                 sizeof(cmsghdr));
+    if (control_len > 0) {
+      msg.msg_control = control.data();
+      msg.msg_controllen = control_len;
+      cmsghdr *hdr = CMSG_FIRSTHDR(&msg);
+      for (const auto &cmsg : request->cmsgs()) {
+        hdr->cmsg_level = cmsg.level();
+        hdr->cmsg_type = cmsg.type();
+        hdr->cmsg_len = CMSG_LEN(cmsg.data().size());
+        cmsg.data().copy(reinterpret_cast<char *>(CMSG_DATA(hdr)),
+                         cmsg.data().size());
+        hdr = CMSG_NXTHDR(&msg, hdr);
+      }
+    }
+
+    response->set_ret(::sendmsg(request->sockfd(), &msg, request->flags()));
+    if (response->ret() < 0) {
+      response->set_errno_(errno);
+    }
+    return ::grpc::Status::OK;
+  }
+
   ::grpc::Status SendTo(::grpc::ServerContext *context,
                         const ::posix_server::SendToRequest *request,
                         ::posix_server::SendToResponse *response) override {
@@ -360,6 +409,55 @@ class PosixImpl final : public posix_server::Posix::Service {
     }
     return ::grpc::Status::OK;
   }
+
+  ::grpc::Status RecvMsg(::grpc::ServerContext *context,
+                         const ::posix_server::RecvMsgRequest *request,
+                         ::posix_server::RecvMsgResponse *response) override {
+    std::vector<char> buf(request->len());
+    iovec iov = {.iov_base = buf.data(), .iov_len = buf.size()};
+    sockaddr_storage addr;
+    // The control buffer must be suitably aligned for struct cmsghdr.
+    std::vector<cmsghdr> control(
+        (request->cmsg_len() + sizeof(cmsghdr) - 1) / sizeof(cmsghdr));
+    msghdr msg = {};
+    msg.msg_name = &addr;
+    msg.msg_namelen = sizeof(addr);
+    msg.msg_iov = &iov;
+    msg.msg_iovlen = 1;
+    if (request->cmsg_len() > 0) {
+      msg.msg_control = control.data();
+      msg.msg_controllen = request->cmsg_len();
+    }
+
+    response->set_ret(::recvmsg(request->sockfd(), &msg, request->flags()));
+    if (response->ret() < 0) {
+      response->set_errno_(errno);
+      return ::grpc::Status::OK;
+    }
+    // recvmsg() returns the full length of the datagram when MSG_TRUNC is
+    // passed, which may exceed the buffer.
+    response->set_buf(buf.data(),
+                      std::min<size_t>(response->ret(), buf.size()));
+    response->set_msg_flags(msg.msg_flags);
+    if (msg.msg_namelen > 0) {
+      auto err =
+          sockaddr_to_proto(addr, msg.msg_namelen, response->mutable_addr());
+      if (!err.ok()) {
+        return err;
+      }
+    }
+    if (msg.msg_controllen > 0) {
+      for (cmsghdr *hdr = CMSG_FIRSTHDR(&msg); hdr != nullptr;
+           hdr = CMSG_NXTHDR(&msg, hdr)) {
+        auto cmsg = response->add_cmsgs();
+        cmsg->set_level(hdr->cmsg_level);
+        cmsg->set_type(hdr->cmsg_type);
+        cmsg->set_data(reinterpret_cast<const char *>(CMSG_DATA(hdr)),
+                       hdr->cmsg_len - CMSG_LEN(0));
+      }
+    }
+    return ::grpc::Status::OK;
+  }
 };
 
 // Parse command line options. Returns a pointer to the first argument beyond
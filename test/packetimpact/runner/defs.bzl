@@ -12,11 +12,12 @@ def _packetimpact_test_impl(ctx):
         # current user, and no other users will be mapped in that namespace.
         # Make sure that everything is readable here.
         "find . -type f -or -type d -exec chmod a+rx {} \\;",
-        "%s %s --testbench_binary %s --num_duts %d $@\n" % (
+        "%s %s --testbench_binary %s --num_duts %d --num_test_nets %d $@\n" % (
             test_runner.short_path,
             " ".join(ctx.attr.flags),
             ctx.files.testbench_binary[0].short_path,
             ctx.attr.num_duts,
+            ctx.attr.num_test_nets,
         ),
     ])
     ctx.actions.write(bench, bench_content, is_executable = True)
@@ -56,6 +57,10 @@ _packetimpact_test = rule(
             mandatory = False,
             default = 1,
         ),
+        "num_test_nets": attr.int(
+            mandatory = False,
+            default = 1,
+        ),
     },
     test = True,
     implementation = _packetimpact_test_impl,
@@ -115,7 +120,7 @@ def packetimpact_netstack_test(
         **kwargs
     )
 
-def packetimpact_go_test(name, expect_native_failure = False, expect_netstack_failure = False, num_duts = 1):
+def packetimpact_go_test(name, expect_native_failure = False, expect_netstack_failure = False, num_duts = 1, num_test_nets = 1):
     """Add packetimpact tests written in go.
 
     Args:
@@ -123,6 +128,7 @@ def packetimpact_go_test(name, expect_native_failure = False, expect_netstack_fa
         expect_native_failure: the test must fail natively
         expect_netstack_failure: the test must fail for Netstack
         num_duts: how many DUTs are needed for the test
+        num_test_nets: how many test networks are attached to each DUT
     """
     testbench_binary = name + "_test"
     packetimpact_native_test(
@@ -130,12 +136,14 @@ def packetimpact_go_test(name, expect_native_failure = False, expect_netstack_fa
         expect_failure = expect_native_failure,
         testbench_binary = testbench_binary,
         num_duts = num_duts,
+        num_test_nets = num_test_nets,
     )
     packetimpact_netstack_test(
         name = name,
         expect_failure = expect_netstack_failure,
         testbench_binary = testbench_binary,
         num_duts = num_duts,
+        num_test_nets = num_test_nets,
     )
 
 def packetimpact_testbench(name, size = "small", pure = True, **kwargs):
@@ -161,7 +169,7 @@ def packetimpact_testbench(name, size = "small", pure = True, **kwargs):
 
 PacketimpactTestInfo = provider(
     doc = "Provide information for packetimpact tests",
-    fields = ["name", "expect_netstack_failure", "num_duts"],
+    fields = ["name", "expect_netstack_failure", "num_duts", "num_test_nets"],
 )
 
 ALL_TESTS = [
@@ -59,6 +59,7 @@ var (
 	extraTestArgs   = stringList{}
 	expectFailure   = false
 	numDUTs         = 1
+	numTestNets     = 1
 
 	// DUTAddr is the IP addres for DUT.
 	DUTAddr       = net.IPv4(0, 0, 0, 10)
@@ -75,6 +76,7 @@ func RegisterFlags(fs *flag.FlagSet) {
 	fs.Var(&extraTestArgs, "extra_test_arg", "extra arguments to pass to the testbench")
 	fs.BoolVar(&expectFailure, "expect_failure", false, "expect that the test will fail when run")
 	fs.IntVar(&numDUTs, "num_duts", numDUTs, "the number of duts to create")
+	fs.IntVar(&numTestNets, "num_test_nets", numTestNets, "the number of test networks to attach to each dut")
 }
 
 const (
@@ -82,6 +84,9 @@ const (
 	CtrlPort uint16 = 40000
 	// testOutputDir is the directory in each container that holds test output.
 	testOutputDir = "/tmp/testoutput"
+	// dutControlDir is the directory in the testbench container through which
+	// the testbench asks for DUTs to be saved and restored.
+	dutControlDir = "/tmp/dutcontrol"
 )
 
 // logger implements testutil.Logger.
@@ -106,21 +111,25 @@ func (l logger) Logf(format string, args ...interface{}) {
 // dutInfo encapsulates all the essential information to set up testbench
 // container.
 type dutInfo struct {
-	dut              DUT
-	ctrlNet, testNet *dockerutil.Network
-	netInfo          *testbench.DUTTestNet
+	dut      DUT
+	ctrlNet  *dockerutil.Network
+	testNets []*dockerutil.Network
+	netInfo  *testbench.DUTTestNet
 }
 
 // setUpDUT will set up one DUT and return information for setting up the
 // container for testbench.
 func setUpDUT(ctx context.Context, t *testing.T, id int, mkDevice func(*dockerutil.Container) DUT) (dutInfo, error) {
 	// Create the networks needed for the test. One control network is needed
-	// for the gRPC control packets and one test network on which to transmit
-	// the test packets.
+	// for the gRPC control packets and at least one test network on which to
+	// transmit the test packets.
 	var info dutInfo
 	ctrlNet := dockerutil.NewNetwork(ctx, logger("ctrlNet"))
-	testNet := dockerutil.NewNetwork(ctx, logger("testNet"))
-	for _, dn := range []*dockerutil.Network{ctrlNet, testNet} {
+	var testNets []*dockerutil.Network
+	for i := 0; i < numTestNets; i++ {
+		testNets = append(testNets, dockerutil.NewNetwork(ctx, logger(fmt.Sprintf("testNet-%d", i))))
+	}
+	for _, dn := range append([]*dockerutil.Network{ctrlNet}, testNets...) {
 		for {
 			if err := createDockerNetwork(ctx, dn); err != nil {
 				t.Log("creating docker network:", err)
@@ -147,7 +156,7 @@ func setUpDUT(ctx context.Context, t *testing.T, id int, mkDevice func(*dockerut
 		}
 	}
 	info.ctrlNet = ctrlNet
-	info.testNet = testNet
+	info.testNets = testNets
 
 	// Create the Docker container for the DUT.
 	var dut DUT
@@ -166,21 +175,31 @@ func setUpDUT(ctx context.Context, t *testing.T, id int, mkDevice func(*dockerut
 		return dutInfo{}, err
 	}
 
-	ipv4PrefixLength, _ := testNet.Subnet.Mask.Size()
-	remoteIPv6, remoteMAC, dutDeviceID, dutTestNetDev, err := dut.Prepare(ctx, t, runOpts, ctrlNet, testNet)
+	ifaces, err := dut.Prepare(ctx, t, runOpts, ctrlNet, testNets)
 	if err != nil {
 		return dutInfo{}, err
 	}
-	info.netInfo = &testbench.DUTTestNet{
-		RemoteMAC:        remoteMAC,
-		RemoteIPv4:       AddressInSubnet(DUTAddr, *testNet.Subnet),
-		RemoteIPv6:       remoteIPv6,
-		RemoteDevID:      dutDeviceID,
-		RemoteDevName:    dutTestNetDev,
-		LocalIPv4:        AddressInSubnet(testbenchAddr, *testNet.Subnet),
-		IPv4PrefixLength: ipv4PrefixLength,
-		POSIXServerIP:    AddressInSubnet(DUTAddr, *ctrlNet.Subnet),
-		POSIXServerPort:  CtrlPort,
+	if got, want := len(ifaces), len(testNets); got != want {
+		return dutInfo{}, fmt.Errorf("got %d DUT interfaces, want one for each of the %d test networks", got, want)
+	}
+	for i, testNet := range testNets {
+		ipv4PrefixLength, _ := testNet.Subnet.Mask.Size()
+		netInfo := &testbench.DUTTestNet{
+			RemoteMAC:        ifaces[i].MAC,
+			RemoteIPv4:       AddressInSubnet(DUTAddr, *testNet.Subnet),
+			RemoteIPv6:       ifaces[i].IPv6,
+			RemoteDevID:      ifaces[i].DevID,
+			RemoteDevName:    ifaces[i].DevName,
+			LocalIPv4:        AddressInSubnet(testbenchAddr, *testNet.Subnet),
+			IPv4PrefixLength: ipv4PrefixLength,
+			POSIXServerIP:    AddressInSubnet(DUTAddr, *ctrlNet.Subnet),
+			POSIXServerPort:  CtrlPort,
+		}
+		if i == 0 {
+			info.netInfo = netInfo
+		} else {
+			info.netInfo.ExtraNets = append(info.netInfo.ExtraNets, netInfo)
+		}
 	}
 	return info, nil
 }
@@ -190,6 +209,9 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	if testbenchBinary == "" {
 		t.Fatal("--testbench_binary is missing")
 	}
+	if numTestNets < 1 {
+		t.Fatalf("--num_test_nets is %d, each DUT needs at least one test network", numTestNets)
+	}
 	dockerutil.EnsureSupportedDockerVersion()
 
 	dutInfoChan := make(chan dutInfo, numDUTs)
@@ -213,7 +235,8 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	for i := 0; i < numDUTs; i++ {
 		select {
 		case info := <-dutInfoChan:
-			dockerNetworks = append(dockerNetworks, info.ctrlNet, info.testNet)
+			dockerNetworks = append(dockerNetworks, info.ctrlNet)
+			dockerNetworks = append(dockerNetworks, info.testNets...)
 			dutTestNets = append(dutTestNets, info.netInfo)
 			duts = append(duts, info.dut)
 		case err := <-errChan:
@@ -233,6 +256,10 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	if _, err := mountTempDirectory(t, &runOpts, "testbench-output", testOutputDir); err != nil {
 		t.Fatal(err)
 	}
+	controlDir, err := mountTempDirectory(t, &runOpts, "testbench-control", dutControlDir)
+	if err != nil {
+		t.Fatal(err)
+	}
 	tbb := path.Base(testbenchBinary)
 	containerTestbenchBinary := filepath.Join("/packetimpact", tbb)
 	testbench.CopyFiles(&runOpts, "/packetimpact", filepath.Join("test/packetimpact/tests", tbb))
@@ -248,20 +275,42 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 		t.Fatalf("cannot start testbench container: %s", err)
 	}
 
-	for i := range dutTestNets {
-		name, info, err := deviceByIP(ctx, testbench, dutTestNets[i].LocalIPv4)
+	// allTestNets holds the test networks of all DUTs, including the extra
+	// ones.
+	var allTestNets []*testbench.DUTTestNet
+	for _, n := range dutTestNets {
+		allTestNets = append(allTestNets, n)
+		allTestNets = append(allTestNets, n.ExtraNets...)
+	}
+	for _, n := range allTestNets {
+		name, info, err := deviceByIP(ctx, testbench, n.LocalIPv4)
 		if err != nil {
-			t.Fatalf("failed to get the device name associated with %s: %s", dutTestNets[i].LocalIPv4, err)
+			t.Fatalf("failed to get the device name associated with %s: %s", n.LocalIPv4, err)
 		}
-		dutTestNets[i].LocalDevName = name
-		dutTestNets[i].LocalDevID = info.ID
-		dutTestNets[i].LocalMAC = info.MAC
+		n.LocalDevName = name
+		n.LocalDevID = info.ID
+		n.LocalMAC = info.MAC
 		localIPv6, err := getOrAssignIPv6Addr(ctx, testbench, name)
 		if err != nil {
 			t.Fatalf("failed to get IPV6 address on %s: %s", testbench.Name, err)
 		}
-		dutTestNets[i].LocalIPv6 = localIPv6
-	}
+		n.LocalIPv6 = localIPv6
+	}
+	dutsByPOSIXServerIP := make(map[string]DUT)
+	for i, n := range dutTestNets {
+		dutsByPOSIXServerIP[n.POSIXServerIP.String()] = duts[i]
+	}
+	saveRestoreCtx, stopSaveRestore := context.WithCancel(ctx)
+	saveRestoreDone := make(chan struct{})
+	go func() {
+		serveSaveRestore(saveRestoreCtx, controlDir, dutsByPOSIXServerIP)
+		close(saveRestoreDone)
+	}()
+	defer func() {
+		stopSaveRestore()
+		<-saveRestoreDone
+	}()
+
 	dutTestNetsBytes, err := json.Marshal(dutTestNets)
 	if err != nil {
 		t.Fatalf("failed to marshal %v into json: %s", dutTestNets, err)
@@ -271,7 +320,7 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	if tshark {
 		snifferProg = "tshark"
 	}
-	for _, n := range dutTestNets {
+	for _, n := range allTestNets {
 		_, err := testbench.ExecProcess(ctx, dockerutil.ExecOpts{}, snifferArgs(n.LocalDevName)...)
 		if err != nil {
 			t.Fatalf("failed to start exec a sniffer on %s: %s", n.LocalDevName, err)
@@ -309,6 +358,8 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	testArgs = append(testArgs,
 		fmt.Sprintf("--native=%t", native),
 		"--dut_test_nets_json", string(dutTestNetsBytes),
+		"--pcap_dir", testOutputDir,
+		"--dut_control_dir", dutControlDir,
 	)
 	testbenchLogs, err := testbench.Exec(ctx, dockerutil.ExecOpts{}, testArgs...)
 	if (err != nil) != expectFailure {
@@ -338,20 +389,37 @@ func TestWithDUT(ctx context.Context, t *testing.T, mkDevice func(*dockerutil.Co
 	}
 }
 
+// DUTInterface describes the interface of the DUT on a test network.
+type DUTInterface struct {
+	// IPv6 is the IPv6 address of the interface.
+	IPv6 net.IP
+	// MAC is the MAC address of the interface.
+	MAC net.HardwareAddr
+	// DevID is the ID of the interface.
+	DevID uint32
+	// DevName is the name of the interface.
+	DevName string
+}
+
 // DUT describes how to setup/teardown the dut for packetimpact tests.
 type DUT interface {
-	// Prepare prepares the dut, starts posix_server and returns the IPv6, MAC
-	// address, the interface ID, and the interface name for the testNet on DUT.
-	// The t parameter is supposed to be used for t.Cleanup. Don't use it for
-	// t.Fatal/FailNow functions.
-	Prepare(ctx context.Context, t *testing.T, runOpts dockerutil.RunOpts, ctrlNet, testNet *dockerutil.Network) (net.IP, net.HardwareAddr, uint32, string, error)
+	// Prepare prepares the dut, starts posix_server and returns the DUT's
+	// interface on each of the testNets, in the same order. The t parameter is
+	// supposed to be used for t.Cleanup. Don't use it for t.Fatal/FailNow
+	// functions.
+	Prepare(ctx context.Context, t *testing.T, runOpts dockerutil.RunOpts, ctrlNet *dockerutil.Network, testNets []*dockerutil.Network) ([]DUTInterface, error)
 	// Logs retrieves the logs from the dut.
 	Logs(ctx context.Context) (string, error)
+	// SaveRestore saves the dut to a checkpoint and restores it from there.
+	SaveRestore(ctx context.Context) error
 }
 
 // DockerDUT describes a docker based DUT.
 type DockerDUT struct {
 	c *dockerutil.Container
+	// checkpoints is the number of checkpoints of the container that were
+	// made, used to name them uniquely.
+	checkpoints int
 }
 
 // NewDockerDUT creates a docker based DUT.
@@ -362,7 +430,7 @@ func NewDockerDUT(c *dockerutil.Container) DUT {
 }
 
 // Prepare implements DUT.Prepare.
-func (dut *DockerDUT) Prepare(ctx context.Context, t *testing.T, runOpts dockerutil.RunOpts, ctrlNet, testNet *dockerutil.Network) (net.IP, net.HardwareAddr, uint32, string, error) {
+func (dut *DockerDUT) Prepare(ctx context.Context, t *testing.T, runOpts dockerutil.RunOpts, ctrlNet *dockerutil.Network, testNets []*dockerutil.Network) ([]DUTInterface, error) {
 	const containerPosixServerBinary = "/packetimpact/posix_server"
 	dut.c.CopyFiles(&runOpts, "/packetimpact", "test/packetimpact/dut/posix_server")
 
@@ -371,30 +439,41 @@ func (dut *DockerDUT) Prepare(ctx context.Context, t *testing.T, runOpts dockeru
 		runOpts,
 		dut.c,
 		DUTAddr,
-		[]*dockerutil.Network{ctrlNet, testNet},
+		append([]*dockerutil.Network{ctrlNet}, testNets...),
 		containerPosixServerBinary,
 		"--ip=0.0.0.0",
 		fmt.Sprintf("--port=%d", CtrlPort),
 	); err != nil {
-		return nil, nil, 0, "", fmt.Errorf("failed to start docker container for DUT: %w", err)
+		return nil, fmt.Errorf("failed to start docker container for DUT: %w", err)
 	}
 
 	if _, err := dut.c.WaitForOutput(ctx, "Server listening.*\n", 60*time.Second); err != nil {
-		return nil, nil, 0, "", fmt.Errorf("%s on container %s never listened: %s", containerPosixServerBinary, dut.c.Name, err)
+		return nil, fmt.Errorf("%s on container %s never listened: %s", containerPosixServerBinary, dut.c.Name, err)
 	}
 
-	dutTestDevice, dutDeviceInfo, err := deviceByIP(ctx, dut.c, AddressInSubnet(DUTAddr, *testNet.Subnet))
-	if err != nil {
-		return nil, nil, 0, "", err
-	}
+	var ifaces []DUTInterface
+	for i, testNet := range testNets {
+		dutTestDevice, dutDeviceInfo, err := deviceByIP(ctx, dut.c, AddressInSubnet(DUTAddr, *testNet.Subnet))
+		if err != nil {
+			return nil, err
+		}
 
-	remoteIPv6, err := getOrAssignIPv6Addr(ctx, dut.c, dutTestDevice)
-	if err != nil {
-		return nil, nil, 0, "", fmt.Errorf("failed to get IPv6 address on %s: %s", dut.c.Name, err)
+		remoteIPv6, err := getOrAssignIPv6Addr(ctx, dut.c, dutTestDevice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get IPv6 address on %s: %s", dut.c.Name, err)
+		}
+		// The networks are connected in order, after the control network
+		// which is eth1.
+		testNetDev := fmt.Sprintf("eth%d", i+2)
+
+		ifaces = append(ifaces, DUTInterface{
+			IPv6:    remoteIPv6,
+			MAC:     dutDeviceInfo.MAC,
+			DevID:   dutDeviceInfo.ID,
+			DevName: testNetDev,
+		})
 	}
-	const testNetDev = "eth2"
-
-	return remoteIPv6, dutDeviceInfo.MAC, dutDeviceInfo.ID, testNetDev, nil
+	return ifaces, nil
 }
 
 // Logs implements DUT.Logs.
@@ -406,6 +485,19 @@ func (dut *DockerDUT) Logs(ctx context.Context) (string, error) {
 	return logs, nil
 }
 
+// SaveRestore implements DUT.SaveRestore.
+func (dut *DockerDUT) SaveRestore(ctx context.Context) error {
+	name := fmt.Sprintf("packetimpact-%d", dut.checkpoints)
+	dut.checkpoints++
+	if err := dut.c.Checkpoint(ctx, name); err != nil {
+		return fmt.Errorf("failed to checkpoint container %s: %w", dut.c.Name, err)
+	}
+	if err := dut.c.Restore(ctx, name); err != nil {
+		return fmt.Errorf("failed to restore container %s from checkpoint %s: %w", dut.c.Name, name, err)
+	}
+	return nil
+}
+
 // AddNetworks connects docker network with the container and assigns the specific IP.
 func AddNetworks(ctx context.Context, d *dockerutil.Container, addr net.IP, networks []*dockerutil.Network) error {
 	for _, dn := range networks {
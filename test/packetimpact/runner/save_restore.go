@@ -0,0 +1,90 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+// serveSaveRestore answers the testbench's requests to save and restore DUTs,
+// made through files in dir as described by testbench.SaveRestoreRequestSuffix,
+// until ctx is done. duts maps the IP address of each DUT's POSIX server to
+// the DUT.
+func serveSaveRestore(ctx context.Context, dir string, duts map[string]DUT) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		requests, err := filepath.Glob(filepath.Join(dir, "*"+testbench.SaveRestoreRequestSuffix))
+		if err != nil {
+			log.Printf("failed to list save/restore requests: %s", err)
+			continue
+		}
+		for _, request := range requests {
+			var response string
+			if err := handleSaveRestore(ctx, request, duts); err != nil {
+				log.Printf("failed to handle save/restore request %s: %s", request, err)
+				response = err.Error()
+			}
+			base := strings.TrimSuffix(request, testbench.SaveRestoreRequestSuffix)
+			if err := writeSaveRestoreResponse(base, response); err != nil {
+				log.Printf("failed to answer save/restore request %s: %s", request, err)
+			}
+		}
+	}
+}
+
+// handleSaveRestore saves and restores the DUT named by the request file, then
+// removes the file.
+func handleSaveRestore(ctx context.Context, request string, duts map[string]DUT) error {
+	b, err := ioutil.ReadFile(request)
+	if err != nil {
+		return fmt.Errorf("failed to read request: %w", err)
+	}
+	if err := os.Remove(request); err != nil {
+		return fmt.Errorf("failed to remove request: %w", err)
+	}
+	ip := strings.TrimSpace(string(b))
+	dut, ok := duts[ip]
+	if !ok {
+		return fmt.Errorf("no DUT has its POSIX server at %q", ip)
+	}
+	log.Printf("saving and restoring the DUT with its POSIX server at %s", ip)
+	return dut.SaveRestore(ctx)
+}
+
+// writeSaveRestoreResponse writes the response to the request with the given
+// base name. The response is written to a temporary file first so that the
+// testbench never sees a partial response.
+func writeSaveRestoreResponse(base, response string) error {
+	tmp := base + ".response.tmp"
+	if err := ioutil.WriteFile(tmp, []byte(response), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, base+testbench.SaveRestoreResponseSuffix)
+}
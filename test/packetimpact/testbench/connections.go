@@ -153,6 +153,56 @@ func (*etherState) close() error {
 	return nil
 }
 
+// dot1QState maintains state about a VLAN tag of a connection.
+type dot1QState struct {
+	out, in Dot1Q
+}
+
+var _ layerState = (*dot1QState)(nil)
+
+// newDot1QState creates a new dot1QState for the VLAN with the given ID.
+func newDot1QState(vid uint16) *dot1QState {
+	return &dot1QState{
+		out: Dot1Q{VID: Uint16(vid)},
+		in:  Dot1Q{VID: Uint16(vid)},
+	}
+}
+
+func (s *dot1QState) outgoing() Layer {
+	return deepcopy.Copy(&s.out).(Layer)
+}
+
+// incoming implements layerState.incoming.
+func (s *dot1QState) incoming(Layer) Layer {
+	return deepcopy.Copy(&s.in).(Layer)
+}
+
+func (*dot1QState) sent(Layer) error {
+	return nil
+}
+
+func (*dot1QState) received(Layer) error {
+	return nil
+}
+
+func (*dot1QState) close() error {
+	return nil
+}
+
+// newLinkStates creates the link layer states of a connection: an etherState
+// followed by a dot1QState for each of the test network's VLAN IDs.
+func (n *DUTTestNet) newLinkStates() ([]layerState, error) {
+	etherState, err := n.newEtherState(Ether{}, Ether{})
+	if err != nil {
+		return nil, fmt.Errorf("can't make etherState: %w", err)
+	}
+	states := []layerState{etherState}
+	for _, vid := range n.vlanIDs {
+		states = append(states, newDot1QState(vid))
+	}
+	return states, nil
+}
+
 // ipv4State maintains state about an IPv4 connection.
 type ipv4State struct {
 	out, in IPv4
@@ -413,12 +463,86 @@ func (s *udpState) close() error {
 	return nil
 }
 
+// sctpState maintains state about an SCTP association.
+type sctpState struct {
+	out, in      SCTP
+	portPickerFD int
+}
+
+var _ layerState = (*sctpState)(nil)
+
+// newSCTPState creates a new sctpState.
+func (n *DUTTestNet) newSCTPState(domain int, out, in SCTP) (*sctpState, error) {
+	// The host running the testbench may not support SCTP, so the port is
+	// picked with a UDP socket. It still keeps the port from being shared with
+	// the other connections of the testbench.
+	portPickerFD, localPort, err := n.pickPort(domain, unix.SOCK_DGRAM)
+	if err != nil {
+		return nil, fmt.Errorf("picking port: %w", err)
+	}
+	s := sctpState{
+		out:          SCTP{SrcPort: &localPort},
+		in:           SCTP{DstPort: &localPort},
+		portPickerFD: portPickerFD,
+	}
+	if err := s.out.merge(&out); err != nil {
+		return nil, err
+	}
+	if err := s.in.merge(&in); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *sctpState) outgoing() Layer {
+	return deepcopy.Copy(&s.out).(Layer)
+}
+
+// incoming implements layerState.incoming.
+func (s *sctpState) incoming(Layer) Layer {
+	return deepcopy.Copy(&s.in).(Layer)
+}
+
+// sent expects the peer to tag its packets with the Initiate Tag of an INIT
+// or INIT ACK chunk that was sent.
+func (s *sctpState) sent(l Layer) error {
+	if init, ok := l.next().(*SCTPInit); ok {
+		s.in.VerificationTag = Uint32(*init.InitiateTag)
+	}
+	return nil
+}
+
+// received tags the packets that are sent with the Initiate Tag of an INIT or
+// INIT ACK chunk that was received.
+func (s *sctpState) received(l Layer) error {
+	if init, ok := l.next().(*SCTPInit); ok {
+		s.out.VerificationTag = Uint32(*init.InitiateTag)
+	}
+	return nil
+}
+
+// close frees the port associated with this connection.
+func (s *sctpState) close() error {
+	if err := unix.Close(s.portPickerFD); err != nil {
+		return err
+	}
+	s.portPickerFD = -1
+	return nil
+}
+
 // Connection holds a collection of layer states for maintaining a connection
 // along with sockets for sniffer and injecting packets.
 type Connection struct {
 	layerStates []layerState
 	injector    Injector
 	sniffer     Sniffer
+
+	// fragmentation, if not nil, configures the fragmentation of the IP
+	// packets that are sent.
+	fragmentation *Fragmentation
+	// nextFragmentID is the Identification of the next IPv6 packet that is
+	// fragmented.
+	nextFragmentID uint32
 }
 
 // Returns the default incoming frame against which to match. If received is
@@ -505,7 +629,7 @@ func (conn *Connection) SendFrameStateless(t *testing.T, frame Layers) {
 	if err != nil {
 		t.Fatalf("can't build outgoing packet: %s", err)
 	}
-	conn.injector.Send(t, outBytes)
+	conn.inject(t, outBytes)
 }
 
 // SendFrame sends a frame on the wire and updates the state of all layers.
@@ -516,7 +640,7 @@ func (conn *Connection) SendFrame(t *testing.T, frame Layers) {
 	if err != nil {
 		t.Fatalf("can't build outgoing packet: %s", err)
 	}
-	conn.injector.Send(t, outBytes)
+	conn.inject(t, outBytes)
 
 	// frame might have nil values where the caller wanted to use default values.
 	// sentFrame will have no nil values in it because it comes from parsing the
@@ -530,6 +654,31 @@ func (conn *Connection) SendFrame(t *testing.T, frame Layers) {
 	}
 }
 
+// inject injects a frame on the wire, split into frames carrying fragments of
+// its IP packet if the connection is configured to fragment it.
+func (conn *Connection) inject(t *testing.T, frame []byte) {
+	t.Helper()
+
+	if conn.fragmentation == nil {
+		conn.injector.Send(t, frame)
+		return
+	}
+	frames, err := conn.fragment(frame)
+	if err != nil {
+		t.Fatalf("can't fragment outgoing packet: %s", err)
+	}
+	for _, f := range frames {
+		conn.injector.Send(t, f)
+	}
+}
+
+// SetFragmentation makes the connection fragment the IP packets it sends as
+// configured by f, which must not be modified afterwards. A nil f disables
+// fragmentation.
+func (conn *Connection) SetFragmentation(f *Fragmentation) {
+	conn.fragmentation = f
+}
+
 // send sends a packet, possibly with layers of this connection overridden and
 // additional layers added.
 //
@@ -634,9 +783,9 @@ type TCPIPv4 Connection
 func (n *DUTTestNet) NewTCPIPv4(t *testing.T, outgoingTCP, incomingTCP TCP) TCPIPv4 {
 	t.Helper()
 
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make etherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv4State, err := n.newIPv4State(IPv4{}, IPv4{})
 	if err != nil {
@@ -656,7 +805,7 @@ func (n *DUTTestNet) NewTCPIPv4(t *testing.T, outgoingTCP, incomingTCP TCP) TCPI
 	}
 
 	return TCPIPv4{
-		layerStates: []layerState{etherState, ipv4State, tcpState},
+		layerStates: append(linkStates, ipv4State, tcpState),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -774,9 +923,9 @@ func (conn *TCPIPv4) Expect(t *testing.T, tcp TCP, timeout time.Duration) (*TCP,
 func (conn *TCPIPv4) tcpState(t *testing.T) *tcpState {
 	t.Helper()
 
-	state, ok := conn.layerStates[2].(*tcpState)
+	state, ok := conn.layerStates[len(conn.layerStates)-1].(*tcpState)
 	if !ok {
-		t.Fatalf("got transport-layer state type=%T, expected tcpState", conn.layerStates[2])
+		t.Fatalf("got transport-layer state type=%T, expected tcpState", conn.layerStates[len(conn.layerStates)-1])
 	}
 	return state
 }
@@ -784,9 +933,9 @@ func (conn *TCPIPv4) tcpState(t *testing.T) *tcpState {
 func (conn *TCPIPv4) ipv4State(t *testing.T) *ipv4State {
 	t.Helper()
 
-	state, ok := conn.layerStates[1].(*ipv4State)
+	state, ok := conn.layerStates[len(conn.layerStates)-2].(*ipv4State)
 	if !ok {
-		t.Fatalf("expected network-layer state type=%T, expected ipv4State", conn.layerStates[1])
+		t.Fatalf("expected network-layer state type=%T, expected ipv4State", conn.layerStates[len(conn.layerStates)-2])
 	}
 	return state
 }
@@ -836,9 +985,9 @@ type IPv4Conn Connection
 func (n *DUTTestNet) NewIPv4Conn(t *testing.T, outgoingIPv4, incomingIPv4 IPv4) IPv4Conn {
 	t.Helper()
 
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make EtherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv4State, err := n.newIPv4State(outgoingIPv4, incomingIPv4)
 	if err != nil {
@@ -855,7 +1004,7 @@ func (n *DUTTestNet) NewIPv4Conn(t *testing.T, outgoingIPv4, incomingIPv4 IPv4)
 	}
 
 	return IPv4Conn{
-		layerStates: []layerState{etherState, ipv4State},
+		layerStates: append(linkStates, ipv4State),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -869,6 +1018,12 @@ func (c *IPv4Conn) Send(t *testing.T, ipv4 IPv4, additionalLayers ...Layer) {
 	(*Connection)(c).send(t, Layers{&ipv4}, additionalLayers...)
 }
 
+// SetFragmentation makes the connection fragment the IP packets it sends as
+// configured by f. A nil f disables fragmentation.
+func (c *IPv4Conn) SetFragmentation(f *Fragmentation) {
+	(*Connection)(c).SetFragmentation(f)
+}
+
 // Close cleans up any resources held.
 func (c *IPv4Conn) Close(t *testing.T) {
 	t.Helper()
@@ -891,9 +1046,9 @@ type IPv6Conn Connection
 func (n *DUTTestNet) NewIPv6Conn(t *testing.T, outgoingIPv6, incomingIPv6 IPv6) IPv6Conn {
 	t.Helper()
 
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make EtherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv6State, err := n.newIPv6State(outgoingIPv6, incomingIPv6)
 	if err != nil {
@@ -910,7 +1065,7 @@ func (n *DUTTestNet) NewIPv6Conn(t *testing.T, outgoingIPv6, incomingIPv6 IPv6)
 	}
 
 	return IPv6Conn{
-		layerStates: []layerState{etherState, ipv6State},
+		layerStates: append(linkStates, ipv6State),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -924,6 +1079,12 @@ func (conn *IPv6Conn) Send(t *testing.T, ipv6 IPv6, additionalLayers ...Layer) {
 	(*Connection)(conn).send(t, Layers{&ipv6}, additionalLayers...)
 }
 
+// SetFragmentation makes the connection fragment the IP packets it sends as
+// configured by f. A nil f disables fragmentation.
+func (conn *IPv6Conn) SetFragmentation(f *Fragmentation) {
+	(*Connection)(conn).SetFragmentation(f)
+}
+
 // Close to clean up any resources held.
 func (conn *IPv6Conn) Close(t *testing.T) {
 	t.Helper()
@@ -946,9 +1107,9 @@ type UDPIPv4 Connection
 func (n *DUTTestNet) NewUDPIPv4(t *testing.T, outgoingUDP, incomingUDP UDP) UDPIPv4 {
 	t.Helper()
 
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make etherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv4State, err := n.newIPv4State(IPv4{}, IPv4{})
 	if err != nil {
@@ -968,7 +1129,7 @@ func (n *DUTTestNet) NewUDPIPv4(t *testing.T, outgoingUDP, incomingUDP UDP) UDPI
 	}
 
 	return UDPIPv4{
-		layerStates: []layerState{etherState, ipv4State, udpState},
+		layerStates: append(linkStates, ipv4State, udpState),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -977,9 +1138,9 @@ func (n *DUTTestNet) NewUDPIPv4(t *testing.T, outgoingUDP, incomingUDP UDP) UDPI
 func (conn *UDPIPv4) udpState(t *testing.T) *udpState {
 	t.Helper()
 
-	state, ok := conn.layerStates[2].(*udpState)
+	state, ok := conn.layerStates[len(conn.layerStates)-1].(*udpState)
 	if !ok {
-		t.Fatalf("got transport-layer state type=%T, expected udpState", conn.layerStates[2])
+		t.Fatalf("got transport-layer state type=%T, expected udpState", conn.layerStates[len(conn.layerStates)-1])
 	}
 	return state
 }
@@ -987,9 +1148,9 @@ func (conn *UDPIPv4) udpState(t *testing.T) *udpState {
 func (conn *UDPIPv4) ipv4State(t *testing.T) *ipv4State {
 	t.Helper()
 
-	state, ok := conn.layerStates[1].(*ipv4State)
+	state, ok := conn.layerStates[len(conn.layerStates)-2].(*ipv4State)
 	if !ok {
-		t.Fatalf("got network-layer state type=%T, expected ipv4State", conn.layerStates[1])
+		t.Fatalf("got network-layer state type=%T, expected ipv4State", conn.layerStates[len(conn.layerStates)-2])
 	}
 	return state
 }
@@ -1048,6 +1209,12 @@ func (conn *UDPIPv4) ExpectData(t *testing.T, udp UDP, payload Payload, timeout
 	return (*Connection)(conn).ExpectFrame(t, expected, timeout)
 }
 
+// SetFragmentation makes the connection fragment the IP packets it sends as
+// configured by f. A nil f disables fragmentation.
+func (conn *UDPIPv4) SetFragmentation(f *Fragmentation) {
+	(*Connection)(conn).SetFragmentation(f)
+}
+
 // Close frees associated resources held by the UDPIPv4 connection.
 func (conn *UDPIPv4) Close(t *testing.T) {
 	t.Helper()
@@ -1070,9 +1237,9 @@ type UDPIPv6 Connection
 func (n *DUTTestNet) NewUDPIPv6(t *testing.T, outgoingUDP, incomingUDP UDP) UDPIPv6 {
 	t.Helper()
 
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make etherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv6State, err := n.newIPv6State(IPv6{}, IPv6{})
 	if err != nil {
@@ -1091,7 +1258,7 @@ func (n *DUTTestNet) NewUDPIPv6(t *testing.T, outgoingUDP, incomingUDP UDP) UDPI
 		t.Fatalf("can't make sniffer: %s", err)
 	}
 	return UDPIPv6{
-		layerStates: []layerState{etherState, ipv6State, udpState},
+		layerStates: append(linkStates, ipv6State, udpState),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -1100,9 +1267,9 @@ func (n *DUTTestNet) NewUDPIPv6(t *testing.T, outgoingUDP, incomingUDP UDP) UDPI
 func (conn *UDPIPv6) udpState(t *testing.T) *udpState {
 	t.Helper()
 
-	state, ok := conn.layerStates[2].(*udpState)
+	state, ok := conn.layerStates[len(conn.layerStates)-1].(*udpState)
 	if !ok {
-		t.Fatalf("got transport-layer state type=%T, expected udpState", conn.layerStates[2])
+		t.Fatalf("got transport-layer state type=%T, expected udpState", conn.layerStates[len(conn.layerStates)-1])
 	}
 	return state
 }
@@ -1110,9 +1277,9 @@ func (conn *UDPIPv6) udpState(t *testing.T) *udpState {
 func (conn *UDPIPv6) ipv6State(t *testing.T) *ipv6State {
 	t.Helper()
 
-	state, ok := conn.layerStates[1].(*ipv6State)
+	state, ok := conn.layerStates[len(conn.layerStates)-2].(*ipv6State)
 	if !ok {
-		t.Fatalf("got network-layer state type=%T, expected ipv6State", conn.layerStates[1])
+		t.Fatalf("got network-layer state type=%T, expected ipv6State", conn.layerStates[len(conn.layerStates)-2])
 	}
 	return state
 }
@@ -1176,6 +1343,12 @@ func (conn *UDPIPv6) ExpectData(t *testing.T, udp UDP, payload Payload, timeout
 	return (*Connection)(conn).ExpectFrame(t, expected, timeout)
 }
 
+// SetFragmentation makes the connection fragment the IP packets it sends as
+// configured by f. A nil f disables fragmentation.
+func (conn *UDPIPv6) SetFragmentation(f *Fragmentation) {
+	(*Connection)(conn).SetFragmentation(f)
+}
+
 // Close frees associated resources held by the UDPIPv6 connection.
 func (conn *UDPIPv6) Close(t *testing.T) {
 	t.Helper()
@@ -1196,9 +1369,9 @@ type TCPIPv6 Connection
 
 // NewTCPIPv6 creates a new TCPIPv6 connection with reasonable defaults.
 func (n *DUTTestNet) NewTCPIPv6(t *testing.T, outgoingTCP, incomingTCP TCP) TCPIPv6 {
-	etherState, err := n.newEtherState(Ether{}, Ether{})
+	linkStates, err := n.newLinkStates()
 	if err != nil {
-		t.Fatalf("can't make etherState: %s", err)
+		t.Fatalf("can't make link layer states: %s", err)
 	}
 	ipv6State, err := n.newIPv6State(IPv6{}, IPv6{})
 	if err != nil {
@@ -1218,7 +1391,7 @@ func (n *DUTTestNet) NewTCPIPv6(t *testing.T, outgoingTCP, incomingTCP TCP) TCPI
 	}
 
 	return TCPIPv6{
-		layerStates: []layerState{etherState, ipv6State, tcpState},
+		layerStates: append(linkStates, ipv6State, tcpState),
 		injector:    injector,
 		sniffer:     sniffer,
 	}
@@ -1226,7 +1399,7 @@ func (n *DUTTestNet) NewTCPIPv6(t *testing.T, outgoingTCP, incomingTCP TCP) TCPI
 
 // SrcPort returns the source port from the given Connection.
 func (conn *TCPIPv6) SrcPort() uint16 {
-	state := conn.layerStates[2].(*tcpState)
+	state := conn.layerStates[len(conn.layerStates)-1].(*tcpState)
 	return *state.out.SrcPort
 }
 
@@ -1249,3 +1422,119 @@ func (conn *TCPIPv6) Close(t *testing.T) {
 
 	(*Connection)(conn).Close(t)
 }
+
+// SCTPIPv4 maintains the state for all the layers in an SCTP/IPv4
+// association.
+type SCTPIPv4 Connection
+
+// NewSCTPIPv4 creates a new SCTPIPv4 connection with reasonable defaults.
+func (n *DUTTestNet) NewSCTPIPv4(t *testing.T, outgoingSCTP, incomingSCTP SCTP) SCTPIPv4 {
+	t.Helper()
+
+	linkStates, err := n.newLinkStates()
+	if err != nil {
+		t.Fatalf("can't make link layer states: %s", err)
+	}
+	ipv4State, err := n.newIPv4State(IPv4{}, IPv4{})
+	if err != nil {
+		t.Fatalf("can't make ipv4State: %s", err)
+	}
+	sctpState, err := n.newSCTPState(unix.AF_INET, outgoingSCTP, incomingSCTP)
+	if err != nil {
+		t.Fatalf("can't make sctpState: %s", err)
+	}
+	injector, err := n.NewInjector(t)
+	if err != nil {
+		t.Fatalf("can't make injector: %s", err)
+	}
+	sniffer, err := n.NewSniffer(t)
+	if err != nil {
+		t.Fatalf("can't make sniffer: %s", err)
+	}
+
+	return SCTPIPv4{
+		layerStates: append(linkStates, ipv4State, sctpState),
+		injector:    injector,
+		sniffer:     sniffer,
+	}
+}
+
+func (conn *SCTPIPv4) sctpState(t *testing.T) *sctpState {
+	t.Helper()
+
+	state, ok := conn.layerStates[len(conn.layerStates)-1].(*sctpState)
+	if !ok {
+		t.Fatalf("got transport-layer state type=%T, expected sctpState", conn.layerStates[len(conn.layerStates)-1])
+	}
+	return state
+}
+
+func (conn *SCTPIPv4) ipv4State(t *testing.T) *ipv4State {
+	t.Helper()
+
+	state, ok := conn.layerStates[len(conn.layerStates)-2].(*ipv4State)
+	if !ok {
+		t.Fatalf("got network-layer state type=%T, expected ipv4State", conn.layerStates[len(conn.layerStates)-2])
+	}
+	return state
+}
+
+// LocalAddr gets the local socket address of this connection.
+func (conn *SCTPIPv4) LocalAddr(t *testing.T) *unix.SockaddrInet4 {
+	t.Helper()
+
+	sa := &unix.SockaddrInet4{Port: int(*conn.sctpState(t).out.SrcPort)}
+	copy(sa.Addr[:], *conn.ipv4State(t).out.SrcAddr)
+	return sa
+}
+
+// Send sends a packet made of the chunks with reasonable defaults, potentially
+// overriding the SCTP common header.
+func (conn *SCTPIPv4) Send(t *testing.T, sctp SCTP, chunks ...Layer) {
+	t.Helper()
+
+	(*Connection)(conn).send(t, Layers{&sctp}, chunks...)
+}
+
+// Expect expects a frame with the SCTP common header matching the provided
+// SCTP within the timeout specified. If it doesn't arrive in time, an error is
+// returned.
+func (conn *SCTPIPv4) Expect(t *testing.T, sctp SCTP, timeout time.Duration) (*SCTP, error) {
+	t.Helper()
+
+	layer, err := (*Connection)(conn).Expect(t, &sctp, timeout)
+	if err != nil {
+		return nil, err
+	}
+	gotSCTP, ok := layer.(*SCTP)
+	if !ok {
+		t.Fatalf("expected %s to be SCTP", layer)
+	}
+	return gotSCTP, nil
+}
+
+// ExpectChunk expects a frame whose first chunk matches chunk within the
+// timeout specified and returns the frame. If it doesn't arrive in time, an
+// error is returned.
+func (conn *SCTPIPv4) ExpectChunk(t *testing.T, chunk Layer, timeout time.Duration) (Layers, error) {
+	t.Helper()
+
+	expected := make([]Layer, len(conn.layerStates))
+	expected = append(expected, chunk)
+	return (*Connection)(conn).ExpectFrame(t, expected, timeout)
+}
+
+// Close frees associated resources held by the SCTPIPv4 connection.
+func (conn *SCTPIPv4) Close(t *testing.T) {
+	t.Helper()
+
+	(*Connection)(conn).Close(t)
+}
+
+// Drain drains the sniffer's receive buffer by receiving packets until there's
+// nothing else to receive.
+func (conn *SCTPIPv4) Drain(t *testing.T) {
+	t.Helper()
+
+	conn.sniffer.Drain(t)
+}
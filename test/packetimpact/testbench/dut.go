@@ -15,6 +15,7 @@
 package testbench
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
@@ -66,6 +67,18 @@ func (n *DUTTestNet) ConnectToDUT(t *testing.T) DUT {
 	}
 }
 
+// Nets returns all the test networks attached to the DUT, starting with
+// dut.Net. It fails the test if there are fewer than n of them.
+func (dut *DUT) Nets(t *testing.T, n int) []*DUTTestNet {
+	t.Helper()
+
+	nets := append([]*DUTTestNet{dut.Net}, dut.Net.ExtraNets...)
+	if len(nets) < n {
+		t.Fatalf("got %d test networks attached to the DUT, the test requires at least %d", len(nets), n)
+	}
+	return nets
+}
+
 // TearDownConnection closes the underlying connection.
 func (dut *DUT) TearDownConnection() {
 	dut.conn.Close()
@@ -711,6 +724,270 @@ func (dut *DUT) RecvWithErrno(ctx context.Context, t *testing.T, sockfd, len, fl
 	return resp.GetRet(), resp.GetBuf(), syscall.Errno(resp.GetErrno_())
 }
 
+// Cmsg is a control message sent with sendmsg or received by recvmsg on the
+// DUT.
+type Cmsg struct {
+	Level int32
+	Type  int32
+	Data  []byte
+}
+
+// Msg is a message received by recvmsg on the DUT.
+type Msg struct {
+	// Buf holds the data that was received.
+	Buf []byte
+	// Addr is the address the message was received from, nil if recvmsg
+	// didn't return one.
+	Addr unix.Sockaddr
+	// Flags are the flags recvmsg set in the msg_flags field.
+	Flags int32
+	// Cmsgs are the control messages that were received.
+	Cmsgs []Cmsg
+}
+
+// Cmsg returns the first control message of m with the given level and type,
+// and whether there was one.
+func (m *Msg) Cmsg(level, typ int32) (Cmsg, bool) {
+	for _, cmsg := range m.Cmsgs {
+		if cmsg.Level == level && cmsg.Type == typ {
+			return cmsg, true
+		}
+	}
+	return Cmsg{}, false
+}
+
+// IntCmsg returns a control message holding an int, such as IP_TOS or
+// IPV6_TCLASS.
+func IntCmsg(level, typ, v int32) Cmsg {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(v))
+	return Cmsg{Level: level, Type: typ, Data: data}
+}
+
+// PktInfoCmsg returns an IP_PKTINFO or IPV6_PKTINFO control message, depending
+// on the family of addr, to send a message from addr on the interface with
+// the given index.
+func PktInfoCmsg(ifindex int32, addr net.IP) Cmsg {
+	var buf bytes.Buffer
+	if addr4 := addr.To4(); addr4 != nil {
+		pktinfo := unix.Inet4Pktinfo{Ifindex: ifindex}
+		copy(pktinfo.Spec_dst[:], addr4)
+		binary.Write(&buf, binary.LittleEndian, &pktinfo)
+		return Cmsg{Level: unix.IPPROTO_IP, Type: unix.IP_PKTINFO, Data: buf.Bytes()}
+	}
+	pktinfo := unix.Inet6Pktinfo{Ifindex: uint32(ifindex)}
+	copy(pktinfo.Addr[:], addr.To16())
+	binary.Write(&buf, binary.LittleEndian, &pktinfo)
+	return Cmsg{Level: unix.IPPROTO_IPV6, Type: unix.IPV6_PKTINFO, Data: buf.Bytes()}
+}
+
+// SCTP socket options and control message types, as per RFC 6458.
+const (
+	// SCTPSndRcv is the SCTP_SNDRCV control message type.
+	SCTPSndRcv = 1
+	// SCTPInitMsg is the SCTP_INITMSG socket option.
+	SCTPInitMsg = 2
+)
+
+// SCTPSndRcvInfo is a struct sctp_sndrcvinfo, the value of an SCTP_SNDRCV
+// control message.
+type SCTPSndRcvInfo struct {
+	Stream     uint16
+	SSN        uint16
+	Flags      uint16
+	_          uint16
+	PPID       uint32
+	Context    uint32
+	TimeToLive uint32
+	TSN        uint32
+	CumTSN     uint32
+	AssocID    int32
+}
+
+// SCTPSndRcvInfoCmsg returns an SCTP_SNDRCV control message to send a message
+// with the parameters in info, such as its stream and payload protocol
+// identifier.
+func SCTPSndRcvInfoCmsg(info SCTPSndRcvInfo) Cmsg {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &info)
+	return Cmsg{Level: unix.IPPROTO_SCTP, Type: SCTPSndRcv, Data: buf.Bytes()}
+}
+
+// decode decodes the data of c into v, which must point to a fixed-size value,
+// failing the test if the sizes don't match.
+func (c Cmsg) decode(t *testing.T, v interface{}) {
+	t.Helper()
+
+	if got, want := len(c.Data), binary.Size(v); got != want {
+		t.Fatalf("got %d bytes of control message data for level %d type %d, want %d bytes for %T", got, c.Level, c.Type, want, v)
+	}
+	if err := binary.Read(bytes.NewReader(c.Data), binary.LittleEndian, v); err != nil {
+		t.Fatalf("failed to decode control message data into %T: %s", v, err)
+	}
+}
+
+// Int returns the value of a control message holding an int, such as
+// IPV6_TCLASS or IP_TTL. IP_TOS, whose value is received as a single byte, is
+// also accepted.
+func (c Cmsg) Int(t *testing.T) int32 {
+	t.Helper()
+
+	if len(c.Data) == 1 {
+		return int32(c.Data[0])
+	}
+	var v int32
+	c.decode(t, &v)
+	return v
+}
+
+// Inet4Pktinfo returns the value of an IP_PKTINFO control message.
+func (c Cmsg) Inet4Pktinfo(t *testing.T) unix.Inet4Pktinfo {
+	t.Helper()
+
+	var v unix.Inet4Pktinfo
+	c.decode(t, &v)
+	return v
+}
+
+// Inet6Pktinfo returns the value of an IPV6_PKTINFO control message.
+func (c Cmsg) Inet6Pktinfo(t *testing.T) unix.Inet6Pktinfo {
+	t.Helper()
+
+	var v unix.Inet6Pktinfo
+	c.decode(t, &v)
+	return v
+}
+
+// Timeval returns the value of an SO_TIMESTAMP control message.
+func (c Cmsg) Timeval(t *testing.T) unix.Timeval {
+	t.Helper()
+
+	var v unix.Timeval
+	c.decode(t, &v)
+	return v
+}
+
+// SockExtendedErr returns the value of an IP_RECVERR or IPV6_RECVERR control
+// message, received with MSG_ERRQUEUE, and the address of the offender that
+// follows it.
+func (c Cmsg) SockExtendedErr(t *testing.T) (unix.SockExtendedErr, net.IP) {
+	t.Helper()
+
+	var v unix.SockExtendedErr
+	size := binary.Size(&v)
+	if len(c.Data) < size {
+		t.Fatalf("got %d bytes of control message data for level %d type %d, want at least %d bytes for %T", len(c.Data), c.Level, c.Type, size, v)
+	}
+	Cmsg{Level: c.Level, Type: c.Type, Data: c.Data[:size]}.decode(t, &v)
+	// The offender is a struct sockaddr_in or sockaddr_in6.
+	offender := c.Data[size:]
+	switch {
+	case len(offender) >= unix.SizeofSockaddrInet6 && binary.LittleEndian.Uint16(offender) == unix.AF_INET6:
+		return v, net.IP(offender[8:24])
+	case len(offender) >= unix.SizeofSockaddrInet4 && binary.LittleEndian.Uint16(offender) == unix.AF_INET:
+		return v, net.IP(offender[4:8])
+	}
+	return v, nil
+}
+
+// SCTPSndRcvInfo returns the value of an SCTP_SNDRCV control message.
+func (c Cmsg) SCTPSndRcvInfo(t *testing.T) SCTPSndRcvInfo {
+	t.Helper()
+
+	var v SCTPSndRcvInfo
+	c.decode(t, &v)
+	return v
+}
+
+// SendMsg calls sendmsg on the DUT and causes a fatal test failure if it
+// doesn't succeed. If more control over the timeout or error handling is
+// needed, use SendMsgWithErrno. destAddr may be nil to send on a connected
+// socket.
+func (dut *DUT) SendMsg(t *testing.T, sockfd int32, buf []byte, flags int32, destAddr unix.Sockaddr, cmsgs []Cmsg) int32 {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+	ret, err := dut.SendMsgWithErrno(ctx, t, sockfd, buf, flags, destAddr, cmsgs)
+	if ret == -1 {
+		t.Fatalf("failed to sendmsg: %s", err)
+	}
+	return ret
+}
+
+// SendMsgWithErrno calls sendmsg on the DUT.
+func (dut *DUT) SendMsgWithErrno(ctx context.Context, t *testing.T, sockfd int32, buf []byte, flags int32, destAddr unix.Sockaddr, cmsgs []Cmsg) (int32, error) {
+	t.Helper()
+
+	req := pb.SendMsgRequest{
+		Sockfd: sockfd,
+		Buf:    buf,
+		Flags:  flags,
+	}
+	if destAddr != nil {
+		req.DestAddr = dut.sockaddrToProto(t, destAddr)
+	}
+	for _, cmsg := range cmsgs {
+		req.Cmsgs = append(req.Cmsgs, &pb.Cmsg{
+			Level: cmsg.Level,
+			Type:  cmsg.Type,
+			Data:  cmsg.Data,
+		})
+	}
+	resp, err := dut.posixServer.SendMsg(ctx, &req)
+	if err != nil {
+		t.Fatalf("failed to call SendMsg: %s", err)
+	}
+	return resp.GetRet(), syscall.Errno(resp.GetErrno_())
+}
+
+// RecvMsg calls recvmsg on the DUT, with a buffer of len bytes for the data
+// and one of cmsgLen bytes for control messages, and causes a fatal test
+// failure if it doesn't succeed. If more control over the timeout or error
+// handling is needed, use RecvMsgWithErrno.
+func (dut *DUT) RecvMsg(t *testing.T, sockfd, len, cmsgLen, flags int32) Msg {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+	ret, msg, err := dut.RecvMsgWithErrno(ctx, t, sockfd, len, cmsgLen, flags)
+	if ret == -1 {
+		t.Fatalf("failed to recvmsg: %s", err)
+	}
+	return msg
+}
+
+// RecvMsgWithErrno calls recvmsg on the DUT.
+func (dut *DUT) RecvMsgWithErrno(ctx context.Context, t *testing.T, sockfd, len, cmsgLen, flags int32) (int32, Msg, error) {
+	t.Helper()
+
+	req := pb.RecvMsgRequest{
+		Sockfd:  sockfd,
+		Len:     len,
+		CmsgLen: cmsgLen,
+		Flags:   flags,
+	}
+	resp, err := dut.posixServer.RecvMsg(ctx, &req)
+	if err != nil {
+		t.Fatalf("failed to call RecvMsg: %s", err)
+	}
+	msg := Msg{
+		Buf:   resp.GetBuf(),
+		Flags: resp.GetMsgFlags(),
+	}
+	if resp.GetAddr() != nil {
+		msg.Addr = dut.protoToSockaddr(t, resp.GetAddr())
+	}
+	for _, cmsg := range resp.GetCmsgs() {
+		msg.Cmsgs = append(msg.Cmsgs, Cmsg{
+			Level: cmsg.GetLevel(),
+			Type:  cmsg.GetType(),
+			Data:  cmsg.GetData(),
+		})
+	}
+	return resp.GetRet(), msg, syscall.Errno(resp.GetErrno_())
+}
+
 // SetSockLingerOption sets SO_LINGER socket option on the DUT.
 func (dut *DUT) SetSockLingerOption(t *testing.T, sockfd int32, timeout time.Duration, enable bool) {
 	var linger unix.Linger
@@ -725,6 +1002,114 @@ func (dut *DUT) SetSockLingerOption(t *testing.T, sockfd int32, timeout time.Dur
 	dut.SetSockOpt(t, sockfd, unix.SOL_SOCKET, unix.SO_LINGER, buf)
 }
 
+// SetSockOptSCTPInitMsg sets the SCTP_INITMSG socket option on the DUT, which
+// configures the number of streams and the retransmissions of the INIT chunks
+// of the associations of sockfd, and causes a fatal test failure if it doesn't
+// succeed. If more control over the timeout or error handling is needed, use
+// SetSockOptSCTPInitMsgWithErrno.
+func (dut *DUT) SetSockOptSCTPInitMsg(t *testing.T, sockfd int32, numOStreams, maxInStreams, maxAttempts uint16, maxInitTimeout time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+	ret, err := dut.SetSockOptSCTPInitMsgWithErrno(ctx, t, sockfd, numOStreams, maxInStreams, maxAttempts, maxInitTimeout)
+	if ret != 0 {
+		t.Fatalf("failed to set SCTP_INITMSG: %s", err)
+	}
+}
+
+// SetSockOptSCTPInitMsgWithErrno sets the SCTP_INITMSG socket option on the
+// DUT.
+func (dut *DUT) SetSockOptSCTPInitMsgWithErrno(ctx context.Context, t *testing.T, sockfd int32, numOStreams, maxInStreams, maxAttempts uint16, maxInitTimeout time.Duration) (int32, error) {
+	t.Helper()
+
+	// struct sctp_initmsg.
+	optval := make([]byte, 8)
+	binary.LittleEndian.PutUint16(optval, numOStreams)
+	binary.LittleEndian.PutUint16(optval[2:], maxInStreams)
+	binary.LittleEndian.PutUint16(optval[4:], maxAttempts)
+	binary.LittleEndian.PutUint16(optval[6:], uint16(maxInitTimeout/time.Millisecond))
+	return dut.SetSockOptWithErrno(ctx, t, sockfd, unix.IPPROTO_SCTP, SCTPInitMsg, optval)
+}
+
+// groupMembershipOpt returns the setsockopt level, option name and value to
+// join or leave the multicast group on the DUT's test network interface.
+func (dut *DUT) groupMembershipOpt(t *testing.T, group net.IP, join bool) (int32, int32, []byte) {
+	t.Helper()
+
+	if group4 := group.To4(); group4 != nil {
+		// struct ip_mreqn.
+		optval := make([]byte, 12)
+		copy(optval, group4)
+		binary.LittleEndian.PutUint32(optval[8:], dut.Net.RemoteDevID)
+		if join {
+			return unix.IPPROTO_IP, unix.IP_ADD_MEMBERSHIP, optval
+		}
+		return unix.IPPROTO_IP, unix.IP_DROP_MEMBERSHIP, optval
+	}
+	if len(group) != net.IPv6len {
+		t.Fatalf("invalid multicast group address: %s", group)
+	}
+	// struct ipv6_mreq.
+	optval := make([]byte, 20)
+	copy(optval, group)
+	binary.LittleEndian.PutUint32(optval[16:], dut.Net.RemoteDevID)
+	if join {
+		return unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, optval
+	}
+	return unix.IPPROTO_IPV6, unix.IPV6_LEAVE_GROUP, optval
+}
+
+// JoinGroup makes sockfd on the DUT join the multicast group on the DUT's test
+// network interface and causes a fatal test failure if it doesn't succeed. If
+// more control over the timeout or error handling is needed, use
+// JoinGroupWithErrno.
+func (dut *DUT) JoinGroup(t *testing.T, sockfd int32, group net.IP) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+	ret, err := dut.JoinGroupWithErrno(ctx, t, sockfd, group)
+	if ret != 0 {
+		t.Fatalf("failed to JoinGroup: %s", err)
+	}
+}
+
+// JoinGroupWithErrno makes sockfd on the DUT join the multicast group on the
+// DUT's test network interface, using IP_ADD_MEMBERSHIP or IPV6_JOIN_GROUP
+// depending on the group's address family.
+func (dut *DUT) JoinGroupWithErrno(ctx context.Context, t *testing.T, sockfd int32, group net.IP) (int32, error) {
+	t.Helper()
+
+	level, optname, optval := dut.groupMembershipOpt(t, group, true /* join */)
+	return dut.SetSockOptWithErrno(ctx, t, sockfd, level, optname, optval)
+}
+
+// LeaveGroup makes sockfd on the DUT leave the multicast group on the DUT's
+// test network interface and causes a fatal test failure if it doesn't
+// succeed. If more control over the timeout or error handling is needed, use
+// LeaveGroupWithErrno.
+func (dut *DUT) LeaveGroup(t *testing.T, sockfd int32, group net.IP) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+	ret, err := dut.LeaveGroupWithErrno(ctx, t, sockfd, group)
+	if ret != 0 {
+		t.Fatalf("failed to LeaveGroup: %s", err)
+	}
+}
+
+// LeaveGroupWithErrno makes sockfd on the DUT leave the multicast group on the
+// DUT's test network interface, using IP_DROP_MEMBERSHIP or IPV6_LEAVE_GROUP
+// depending on the group's address family.
+func (dut *DUT) LeaveGroupWithErrno(ctx context.Context, t *testing.T, sockfd int32, group net.IP) (int32, error) {
+	t.Helper()
+
+	level, optname, optval := dut.groupMembershipOpt(t, group, false /* join */)
+	return dut.SetSockOptWithErrno(ctx, t, sockfd, level, optname, optval)
+}
+
 // Shutdown calls shutdown on the DUT and causes a fatal test failure if it
 // doesn't succeed. If more control over the timeout or error handling is
 // needed, use ShutdownWithErrno.
@@ -0,0 +1,197 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Fragmentation configures a Connection to fragment the IPv4 and IPv6 packets
+// it sends that are larger than an MTU.
+type Fragmentation struct {
+	// MTU is the size in bytes of the largest IP packet that is sent
+	// unfragmented. Larger packets are split into fragments of at most MTU
+	// bytes each.
+	MTU int
+
+	// Overlap is the number of bytes that each fragment repeats from the end
+	// of the fragment before it. It must be a multiple of 8.
+	Overlap int
+
+	// Order lists the indices of the fragments to send, in the order they are
+	// sent, where the fragments are indexed by increasing offset. Fragments
+	// that are left out are not sent at all and fragments that are listed more
+	// than once are duplicated. If Order is nil, all fragments are sent once,
+	// by increasing offset.
+	Order []int
+
+	// ID is the Identification of the IPv6 fragments. If it is nil, each
+	// fragmented IPv6 packet is given the next ID of the connection. IPv4
+	// fragments always keep the ID of the packet they were split from.
+	ID *uint32
+}
+
+// fragmentRange is the range of the payload of an IP packet carried by a
+// fragment.
+type fragmentRange struct {
+	start, end int
+	more       bool
+}
+
+// split splits an IP payload of payloadLen bytes into fragments carrying at
+// most maxLen bytes and returns them in the order they should be sent.
+func (f *Fragmentation) split(payloadLen, maxLen int) ([]fragmentRange, error) {
+	if f.Overlap < 0 || f.Overlap%8 != 0 {
+		return nil, fmt.Errorf("fragment overlap of %d bytes isn't a non-negative multiple of 8", f.Overlap)
+	}
+	// All fragments but the last must carry a multiple of 8 bytes.
+	fragLen := maxLen &^ 7
+	if fragLen <= f.Overlap {
+		return nil, fmt.Errorf("MTU %d leaves room for %d bytes per fragment, which doesn't exceed the overlap of %d bytes", f.MTU, fragLen, f.Overlap)
+	}
+	var frags []fragmentRange
+	for start := 0; ; start += fragLen - f.Overlap {
+		if end := start + fragLen; end < payloadLen {
+			frags = append(frags, fragmentRange{start: start, end: end, more: true})
+			continue
+		}
+		frags = append(frags, fragmentRange{start: start, end: payloadLen})
+		break
+	}
+	if f.Order == nil {
+		return frags, nil
+	}
+	ordered := make([]fragmentRange, 0, len(f.Order))
+	for _, i := range f.Order {
+		if i < 0 || i >= len(frags) {
+			return nil, fmt.Errorf("fragment index %d out of range, the packet has %d fragments", i, len(frags))
+		}
+		ordered = append(ordered, frags[i])
+	}
+	return ordered, nil
+}
+
+// fragmentIPv4 splits the IPv4 packet pkt, preceded by the link layer headers
+// in link, into frames carrying fragments of it.
+func (f *Fragmentation) fragmentIPv4(link, pkt []byte) ([][]byte, error) {
+	h := header.IPv4(pkt)
+	hdrLen := int(h.HeaderLength())
+	payload := pkt[hdrLen:]
+	frags, err := f.split(len(payload), f.MTU-hdrLen)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for _, frag := range frags {
+		frame := make([]byte, 0, len(link)+hdrLen+frag.end-frag.start)
+		frame = append(frame, link...)
+		frame = append(frame, pkt[:hdrLen]...)
+		frame = append(frame, payload[frag.start:frag.end]...)
+		fh := header.IPv4(frame[len(link):])
+		// A packet that already is a fragment is split into fragments of it.
+		flags := h.Flags() &^ header.IPv4FlagMoreFragments
+		if frag.more || h.More() {
+			flags |= header.IPv4FlagMoreFragments
+		}
+		fh.SetFlagsFragmentOffset(flags, h.FragmentOffset()+uint16(frag.start))
+		fh.SetTotalLength(uint16(len(fh)))
+		fh.SetChecksum(0)
+		fh.SetChecksum(^fh.CalculateChecksum())
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// fragmentIPv6 splits the IPv6 packet pkt, preceded by the link layer headers
+// in link, into frames carrying fragments of it identified by id. The first
+// unfragLen bytes of pkt are the unfragmentable part of the packet and the
+// Next Header field to replace with a Fragment header is at nextHdrOffset.
+func (f *Fragmentation) fragmentIPv6(link, pkt []byte, unfragLen, nextHdrOffset int, id uint32) ([][]byte, error) {
+	payload := pkt[unfragLen:]
+	frags, err := f.split(len(payload), f.MTU-unfragLen-header.IPv6FragmentExtHdrLength)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for _, frag := range frags {
+		frame := make([]byte, 0, len(link)+unfragLen+header.IPv6FragmentExtHdrLength+frag.end-frag.start)
+		frame = append(frame, link...)
+		frame = append(frame, pkt[:unfragLen]...)
+		fragHdr := make([]byte, header.IPv6FragmentExtHdrLength)
+		fragHdr[0] = pkt[nextHdrOffset]
+		// The offset is a multiple of 8, which leaves the low bits free.
+		offsetAndMFlag := uint16(frag.start)
+		if frag.more {
+			offsetAndMFlag |= 1
+		}
+		binary.BigEndian.PutUint16(fragHdr[2:], offsetAndMFlag)
+		binary.BigEndian.PutUint32(fragHdr[4:], id)
+		frame = append(frame, fragHdr...)
+		frame = append(frame, payload[frag.start:frag.end]...)
+		fh := header.IPv6(frame[len(link):])
+		fh[nextHdrOffset] = uint8(header.IPv6FragmentExtHdrIdentifier)
+		fh.SetPayloadLength(uint16(len(fh) - header.IPv6MinimumSize))
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// fragment splits the IP packet in frame into frames carrying fragments of it,
+// as configured by conn's Fragmentation. Frames without an IP packet are
+// returned as is.
+func (conn *Connection) fragment(frame []byte) ([][]byte, error) {
+	f := conn.fragmentation
+	layers := parse(parseEther, frame)
+	linkLen := 0
+	for i, l := range layers {
+		switch l.(type) {
+		case *IPv4, *IPv6:
+			if len(frame)-linkLen <= f.MTU {
+				return [][]byte{frame}, nil
+			}
+		}
+		switch l.(type) {
+		case *IPv4:
+			return f.fragmentIPv4(frame[:linkLen], frame[linkLen:])
+		case *IPv6:
+			// The Hop-by-Hop Options and Routing headers are part of the
+			// unfragmentable part of the packet, as per RFC 8200 section 4.5.
+			unfragLen := header.IPv6MinimumSize
+			nextHdrOffset := header.IPv6NextHeaderOffset
+		exts:
+			for _, ext := range layers[i+1:] {
+				switch ext.(type) {
+				case *IPv6HopByHopOptionsExtHdr, *IPv6RoutingExtHdr:
+					nextHdrOffset = unfragLen
+					unfragLen += ext.length()
+				default:
+					break exts
+				}
+			}
+			id := conn.nextFragmentID
+			if f.ID != nil {
+				id = *f.ID
+			} else {
+				conn.nextFragmentID++
+			}
+			return f.fragmentIPv6(frame[:linkLen], frame[linkLen:], unfragLen, nextHdrOffset, id)
+		}
+		linkLen += l.length()
+	}
+	return [][]byte{frame}, nil
+}
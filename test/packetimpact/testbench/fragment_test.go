@@ -0,0 +1,169 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestFragmentation(t *testing.T) {
+	// experimentalProtocol is reserved for experimentation by RFC 3692, so the
+	// payload is never parsed as a transport protocol.
+	const experimentalProtocol = 253
+	const payloadLen = 3000
+
+	payload := make([]byte, payloadLen)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	ether := &Ether{
+		SrcAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xac\x00\x00\x01")),
+		DstAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xac\x00\x00\x02")),
+	}
+
+	type fragment struct {
+		offset int
+		length int
+		more   bool
+	}
+	for _, tt := range []struct {
+		description   string
+		ip            Layer
+		fragmentation Fragmentation
+		want          []fragment
+	}{
+		{
+			description:   "IPv4 in order",
+			ip:            &IPv4{Protocol: Uint8(experimentalProtocol), ID: Uint16(1)},
+			fragmentation: Fragmentation{MTU: 1280},
+			want: []fragment{
+				{offset: 0, length: 1256, more: true},
+				{offset: 1256, length: 1256, more: true},
+				{offset: 2512, length: 488, more: false},
+			},
+		},
+		{
+			description:   "IPv4 reordered overlapping with missing fragment",
+			ip:            &IPv4{Protocol: Uint8(experimentalProtocol), ID: Uint16(2)},
+			fragmentation: Fragmentation{MTU: 1280, Overlap: 16, Order: []int{2, 0, 0}},
+			want: []fragment{
+				{offset: 2480, length: 520, more: false},
+				{offset: 0, length: 1256, more: true},
+				{offset: 0, length: 1256, more: true},
+			},
+		},
+		{
+			description:   "IPv4 smaller than MTU",
+			ip:            &IPv4{Protocol: Uint8(experimentalProtocol), ID: Uint16(3)},
+			fragmentation: Fragmentation{MTU: 4000},
+			want:          nil,
+		},
+		{
+			description:   "IPv6 in order",
+			ip:            &IPv6{NextHeader: Uint8(experimentalProtocol)},
+			fragmentation: Fragmentation{MTU: 1280, ID: Uint32(4)},
+			want: []fragment{
+				{offset: 0, length: 1232, more: true},
+				{offset: 1232, length: 1232, more: true},
+				{offset: 2464, length: 536, more: false},
+			},
+		},
+		{
+			description:   "IPv6 reordered overlapping",
+			ip:            &IPv6{NextHeader: Uint8(experimentalProtocol)},
+			fragmentation: Fragmentation{MTU: 1280, Overlap: 32, Order: []int{1, 2, 0}, ID: Uint32(5)},
+			want: []fragment{
+				{offset: 1200, length: 1232, more: true},
+				{offset: 2400, length: 600, more: false},
+				{offset: 0, length: 1232, more: true},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			switch ip := tt.ip.(type) {
+			case *IPv4:
+				ip.SrcAddr = Address(tcpip.Address(net.ParseIP("192.168.0.1").To4()))
+				ip.DstAddr = Address(tcpip.Address(net.ParseIP("192.168.0.2").To4()))
+			case *IPv6:
+				ip.SrcAddr = Address(tcpip.Address(net.ParseIP("fe80::1")))
+				ip.DstAddr = Address(tcpip.Address(net.ParseIP("fe80::2")))
+			}
+			layers := Layers{ether, tt.ip, &Payload{Bytes: payload}}
+			frame, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			conn := Connection{fragmentation: &tt.fragmentation}
+			frames, err := conn.fragment(frame)
+			if err != nil {
+				t.Fatalf("conn.fragment(_) = (_, %s)", err)
+			}
+			if tt.want == nil {
+				if len(frames) != 1 || !bytes.Equal(frames[0], frame) {
+					t.Fatalf("got frames = %x, want unfragmented frame %x", frames, frame)
+				}
+				return
+			}
+
+			var got []fragment
+			for _, f := range frames {
+				if ipLen := len(f) - header.EthernetMinimumSize; ipLen > tt.fragmentation.MTU {
+					t.Errorf("got IP packet of %d bytes, want at most %d bytes", ipLen, tt.fragmentation.MTU)
+				}
+				parsed := parse(parseEther, f)
+				var frag fragment
+				switch ip := parsed[1].(type) {
+				case *IPv4:
+					if want := *tt.ip.(*IPv4).ID; *ip.ID != want {
+						t.Errorf("got ID = %d, want = %d", *ip.ID, want)
+					}
+					if header.IPv4(f[header.EthernetMinimumSize:]).CalculateChecksum() != 0xffff {
+						t.Errorf("bad IPv4 header checksum in %s", parsed)
+					}
+					frag.offset = int(*ip.FragmentOffset)
+					frag.more = *ip.Flags&header.IPv4FlagMoreFragments != 0
+				case *IPv6:
+					fragHdr, ok := parsed[2].(*IPv6FragmentExtHdr)
+					if !ok {
+						t.Fatalf("got %s, want an IPv6 Fragment header after the IPv6 header", parsed)
+					}
+					if got, want := *fragHdr.Identification, *tt.fragmentation.ID; got != want {
+						t.Errorf("got Identification = %d, want = %d", got, want)
+					}
+					if got, want := *fragHdr.NextHeader, header.IPv6ExtensionHeaderIdentifier(experimentalProtocol); got != want {
+						t.Errorf("got NextHeader = %d, want = %d", got, want)
+					}
+					frag.offset = int(*fragHdr.FragmentOffset) * header.IPv6FragmentExtHdrFragmentOffsetBytesPerUnit
+					frag.more = *fragHdr.MoreFragments
+				}
+				fragPayload := parsed[len(parsed)-1].(*Payload).Bytes
+				frag.length = len(fragPayload)
+				if !bytes.Equal(fragPayload, payload[frag.offset:][:frag.length]) {
+					t.Errorf("fragment at offset %d doesn't carry the matching part of the payload", frag.offset)
+				}
+				got = append(got, frag)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(fragment{})); diff != "" {
+				t.Errorf("fragments mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/mohae/deepcopy"
+	"golang.org/x/sys/unix"
+)
+
+// FuzzField identifies a field of a layer of a frame template to fuzz.
+type FuzzField struct {
+	// Layer is the index of the layer in the template.
+	Layer int
+	// Name is the name of the field in the layer's struct, such as "Checksum"
+	// or "TotalLength". The field must point to an unsigned integer or a bool.
+	Name string
+	// Bits is the width of the field on the wire, for fields narrower than
+	// their Go type such as the 3 bits of IPv4.Flags. If 0, the width of the
+	// Go type is used.
+	Bits int
+}
+
+// FuzzOptions configures the fuzzing done by Connection.Fuzz.
+type FuzzOptions struct {
+	// Fields are the fields to fuzz, one at a time.
+	Fields []FuzzField
+	// Random, if positive, is the number of random values tried for each
+	// field. Otherwise values are tried systematically: every value for fields
+	// of up to 8 bits, and for wider fields all zeros, all ones, every single
+	// bit set, and the values next to the one in the template.
+	Random int
+	// Seed seeds the random values.
+	Seed int64
+}
+
+// Fuzz sends frames made from template on conn, each with one of the fields
+// in opts set to a fuzzed value, in its own subtest. Fields that are left nil
+// in template, such as lengths and checksums, are computed for each frame
+// unless they are being fuzzed. After each frame, check, if not nil, is called
+// with the frame that was sent so that the test can assert that the DUT
+// responded as it should, then the DUT is checked to still be responsive.
+func (conn *Connection) Fuzz(t *testing.T, dut *DUT, template Layers, opts FuzzOptions, check func(t *testing.T, frame Layers)) {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	for _, field := range opts.Fields {
+		if field.Layer < 0 || field.Layer >= len(template) {
+			t.Fatalf("can't fuzz layer %d of a %d layer template", field.Layer, len(template))
+		}
+		orig, bits, err := fuzzFieldInfo(template[field.Layer], field)
+		if err != nil {
+			t.Fatalf("can't fuzz field %s of %s: %s", field.Name, template[field.Layer], err)
+		}
+		for _, v := range fuzzValues(orig, bits, opts.Random, rng) {
+			frame := make(Layers, 0, len(template))
+			for _, l := range template {
+				frame = append(frame, deepcopy.Copy(l).(Layer))
+			}
+			if err := setFuzzField(frame[field.Layer], field.Name, v); err != nil {
+				t.Fatalf("can't set field %s of %s: %s", field.Name, frame[field.Layer], err)
+			}
+			t.Run(fmt.Sprintf("%T.%s=%#x", frame[field.Layer], field.Name, v), func(t *testing.T) {
+				conn.SendFrameStateless(t, frame)
+				if check != nil {
+					check(t, frame)
+				}
+				dut.checkAlive(t)
+			})
+		}
+	}
+}
+
+// checkAlive causes a fatal test failure if the DUT doesn't respond to a
+// socket call.
+func (dut *DUT) checkAlive(t *testing.T) {
+	t.Helper()
+
+	fd, err := dut.SocketWithErrno(t, unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if fd < 0 {
+		t.Fatalf("DUT failed to create a socket after the fuzzed frame: %s", err)
+	}
+	dut.Close(t, fd)
+}
+
+// fuzzFieldInfo returns the value of field in l, nil if it isn't set, and its
+// width in bits.
+func fuzzFieldInfo(l Layer, field FuzzField) (*uint64, int, error) {
+	v, err := fuzzFieldValue(l, field.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+	var bits int
+	switch elem := v.Type().Elem(); elem.Kind() {
+	case reflect.Bool:
+		bits = 1
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits = elem.Bits()
+	default:
+		return nil, 0, fmt.Errorf("field of type %s isn't an unsigned integer or a bool", v.Type())
+	}
+	if field.Bits != 0 {
+		if field.Bits < 0 || field.Bits > bits {
+			return nil, 0, fmt.Errorf("width of %d bits doesn't fit in %s", field.Bits, v.Type())
+		}
+		bits = field.Bits
+	}
+	if v.IsNil() {
+		return nil, bits, nil
+	}
+	var orig uint64
+	if elem := v.Elem(); elem.Kind() == reflect.Bool {
+		if elem.Bool() {
+			orig = 1
+		}
+	} else {
+		orig = elem.Uint()
+	}
+	return &orig, bits, nil
+}
+
+// fuzzFieldValue returns the pointer field of l with the given name.
+func fuzzFieldValue(l Layer, name string) (reflect.Value, error) {
+	v := reflect.ValueOf(l)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("layer %T isn't a pointer to a struct", l)
+	}
+	f := v.Elem().FieldByName(name)
+	if !f.IsValid() {
+		return reflect.Value{}, fmt.Errorf("layer %T has no field %s", l, name)
+	}
+	if f.Kind() != reflect.Ptr {
+		return reflect.Value{}, fmt.Errorf("field %s of %T isn't a pointer", name, l)
+	}
+	return f, nil
+}
+
+// setFuzzField sets the field of l with the given name to v.
+func setFuzzField(l Layer, name string, v uint64) error {
+	f, err := fuzzFieldValue(l, name)
+	if err != nil {
+		return err
+	}
+	p := reflect.New(f.Type().Elem())
+	if p.Elem().Kind() == reflect.Bool {
+		p.Elem().SetBool(v != 0)
+	} else {
+		p.Elem().SetUint(v)
+	}
+	f.Set(p)
+	return nil
+}
+
+// fuzzValues returns the values to try for a field of the given width in bits
+// whose value in the template is orig, or nil if it isn't set. If random is
+// positive, that many random values are returned, otherwise the values are
+// chosen systematically.
+func fuzzValues(orig *uint64, bits, random int, rng *rand.Rand) []uint64 {
+	mask := ^uint64(0) >> (64 - bits)
+	if random > 0 {
+		values := make([]uint64, 0, random)
+		for i := 0; i < random; i++ {
+			values = append(values, rng.Uint64()&mask)
+		}
+		return values
+	}
+	if bits <= 8 {
+		values := make([]uint64, 0, mask+1)
+		for v := uint64(0); v <= mask; v++ {
+			values = append(values, v)
+		}
+		return values
+	}
+	values := []uint64{0, mask}
+	for i := 0; i < bits; i++ {
+		values = append(values, 1<<i)
+	}
+	if orig != nil {
+		values = append(values, (*orig-1)&mask, (*orig+1)&mask)
+	}
+	// Remove duplicates, keeping the first occurrence of each value.
+	seen := make(map[uint64]struct{}, len(values))
+	deduped := values[:0]
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		deduped = append(deduped, v)
+	}
+	return deduped
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestFuzzValues(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		orig        *uint64
+		bits        int
+		random      int
+		want        []uint64
+	}{
+		{
+			description: "narrow field",
+			bits:        3,
+			want:        []uint64{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			description: "wide field",
+			bits:        16,
+			want: []uint64{
+				0, 0xffff, 0x1, 0x2, 0x4, 0x8, 0x10, 0x20, 0x40, 0x80, 0x100, 0x200,
+				0x400, 0x800, 0x1000, 0x2000, 0x4000, 0x8000,
+			},
+		},
+		{
+			description: "wide field around template value",
+			orig:        func() *uint64 { v := uint64(0x1234); return &v }(),
+			bits:        16,
+			want: []uint64{
+				0, 0xffff, 0x1, 0x2, 0x4, 0x8, 0x10, 0x20, 0x40, 0x80, 0x100, 0x200,
+				0x400, 0x800, 0x1000, 0x2000, 0x4000, 0x8000, 0x1233, 0x1235,
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			got := fuzzValues(tt.orig, tt.bits, tt.random, nil)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("fuzzValues(_, %d, %d, _) mismatch (-want +got):\n%s", tt.bits, tt.random, diff)
+			}
+		})
+	}
+
+	t.Run("random", func(t *testing.T) {
+		const n = 100
+		got := fuzzValues(nil, 12, n, rand.New(rand.NewSource(1)))
+		if len(got) != n {
+			t.Fatalf("got %d values, want %d", len(got), n)
+		}
+		for _, v := range got {
+			if v > 0xfff {
+				t.Errorf("got value %#x, which doesn't fit in 12 bits", v)
+			}
+		}
+	})
+}
+
+func TestFuzzField(t *testing.T) {
+	igmp := &IGMP{Type: IGMPType(header.IGMPMembershipQuery), MaxRespCode: Uint8(100)}
+	orig, bits, err := fuzzFieldInfo(igmp, FuzzField{Name: "MaxRespCode"})
+	if err != nil {
+		t.Fatalf("fuzzFieldInfo(_, MaxRespCode) = (_, _, %s)", err)
+	}
+	if orig == nil || *orig != 100 || bits != 8 {
+		t.Errorf("got fuzzFieldInfo(_, MaxRespCode) = (%v, %d, nil), want (100, 8, nil)", orig, bits)
+	}
+	if err := setFuzzField(igmp, "Type", uint64(header.IGMPv1MembershipReport)); err != nil {
+		t.Fatalf("setFuzzField(_, Type, _) = %s", err)
+	}
+	if got, want := *igmp.Type, header.IGMPv1MembershipReport; got != want {
+		t.Errorf("got igmp.Type = %d, want = %d", got, want)
+	}
+
+	ipv4 := &IPv4{}
+	if _, bits, err := fuzzFieldInfo(ipv4, FuzzField{Name: "Flags", Bits: 3}); err != nil || bits != 3 {
+		t.Errorf("got fuzzFieldInfo(_, Flags) = (_, %d, %v), want (_, 3, nil)", bits, err)
+	}
+	if _, _, err := fuzzFieldInfo(ipv4, FuzzField{Name: "SrcAddr"}); err == nil {
+		t.Error("fuzzFieldInfo(_, SrcAddr) succeeded, want error for a non integer field")
+	}
+	if _, _, err := fuzzFieldInfo(ipv4, FuzzField{Name: "NoSuchField"}); err == nil {
+		t.Error("fuzzFieldInfo(_, NoSuchField) succeeded, want error")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"hash/crc32"
 	"reflect"
 	"strings"
 
@@ -190,19 +191,60 @@ func (l *Ether) ToBytes() ([]byte, error) {
 	if l.Type != nil {
 		fields.Type = *l.Type
 	} else {
-		switch n := l.next().(type) {
-		case *IPv4:
-			fields.Type = header.IPv4ProtocolNumber
-		case *IPv6:
-			fields.Type = header.IPv6ProtocolNumber
-		default:
-			return nil, fmt.Errorf("ethernet header's next layer is unrecognized: %#v", n)
+		t, err := etherTypeByLayer(l.next())
+		if err != nil {
+			return nil, fmt.Errorf("ethernet header's next layer is unrecognized: %w", err)
 		}
+		fields.Type = t
 	}
 	h.Encode(fields)
 	return h, nil
 }
 
+// EtherTypes of VLAN tags.
+const (
+	// EtherTypeDot1Q is the TPID of an 802.1Q customer VLAN tag.
+	EtherTypeDot1Q tcpip.NetworkProtocolNumber = 0x8100
+	// EtherTypeDot1AD is the TPID of an 802.1ad service VLAN tag, the outer
+	// tags of a QinQ stack.
+	EtherTypeDot1AD tcpip.NetworkProtocolNumber = 0x88a8
+)
+
+// etherTypeByLayer returns the EtherType that identifies l when it follows an
+// Ethernet header or a VLAN tag. A VLAN tag is identified as an 802.1ad tag
+// when it is followed by another VLAN tag and as an 802.1Q tag otherwise.
+func etherTypeByLayer(l Layer) (tcpip.NetworkProtocolNumber, error) {
+	switch l := l.(type) {
+	case *IPv4:
+		return header.IPv4ProtocolNumber, nil
+	case *IPv6:
+		return header.IPv6ProtocolNumber, nil
+	case *Dot1Q:
+		if _, ok := l.next().(*Dot1Q); ok {
+			return EtherTypeDot1AD, nil
+		}
+		return EtherTypeDot1Q, nil
+	default:
+		return 0, fmt.Errorf("no EtherType for layer: %#v", l)
+	}
+}
+
+// nextEtherPayloadParser returns the parser for the payload of an Ethernet
+// header or a VLAN tag with the given EtherType.
+func nextEtherPayloadParser(t tcpip.NetworkProtocolNumber) layerParser {
+	switch t {
+	case header.IPv4ProtocolNumber:
+		return parseIPv4
+	case header.IPv6ProtocolNumber:
+		return parseIPv6
+	case EtherTypeDot1Q, EtherTypeDot1AD:
+		return parseDot1Q
+	default:
+		// Assume that the rest is a payload.
+		return parsePayload
+	}
+}
+
 // LinkAddress is a helper routine that allocates a new tcpip.LinkAddress value
 // to store v and returns a pointer to it.
 func LinkAddress(v tcpip.LinkAddress) *tcpip.LinkAddress {
@@ -246,17 +288,7 @@ func parseEther(b []byte) (Layer, layerParser) {
 		DstAddr: LinkAddress(h.DestinationAddress()),
 		Type:    NetworkProtocolNumber(h.Type()),
 	}
-	var nextParser layerParser
-	switch h.Type() {
-	case header.IPv4ProtocolNumber:
-		nextParser = parseIPv4
-	case header.IPv6ProtocolNumber:
-		nextParser = parseIPv6
-	default:
-		// Assume that the rest is a payload.
-		nextParser = parsePayload
-	}
-	return &ether, nextParser
+	return &ether, nextEtherPayloadParser(h.Type())
 }
 
 func (l *Ether) match(other Layer) bool {
@@ -272,6 +304,88 @@ func (l *Ether) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// dot1QTagSize is the size of a VLAN tag following the TPID, which is carried
+// in the Type of the preceding layer.
+const dot1QTagSize = 4
+
+// Dot1Q can construct and match an 802.1Q or 802.1ad VLAN tag. Whether the tag
+// is a customer (802.1Q) or a service (802.1ad) tag is determined by the Type
+// of the preceding Ether or Dot1Q layer.
+type Dot1Q struct {
+	LayerBase
+	PCP  *uint8
+	DEI  *bool
+	VID  *uint16
+	Type *tcpip.NetworkProtocolNumber
+}
+
+func (l *Dot1Q) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *Dot1Q) ToBytes() ([]byte, error) {
+	var tci uint16
+	if l.PCP != nil {
+		if *l.PCP > 7 {
+			return nil, fmt.Errorf("VLAN PCP %d doesn't fit in 3 bits", *l.PCP)
+		}
+		tci |= uint16(*l.PCP) << 13
+	}
+	if l.DEI != nil && *l.DEI {
+		tci |= 1 << 12
+	}
+	if l.VID != nil {
+		if *l.VID > 0xfff {
+			return nil, fmt.Errorf("VLAN ID %d doesn't fit in 12 bits", *l.VID)
+		}
+		tci |= *l.VID
+	}
+	var t tcpip.NetworkProtocolNumber
+	if l.Type != nil {
+		t = *l.Type
+	} else {
+		var err error
+		if t, err = etherTypeByLayer(l.next()); err != nil {
+			return nil, fmt.Errorf("VLAN tag's next layer is unrecognized: %w", err)
+		}
+	}
+	b := make([]byte, dot1QTagSize)
+	binary.BigEndian.PutUint16(b, tci)
+	binary.BigEndian.PutUint16(b[2:], uint16(t))
+	return b, nil
+}
+
+// parseDot1Q parses the bytes assuming that they start with a VLAN tag
+// following its TPID and continues parsing further encapsulations.
+func parseDot1Q(b []byte) (Layer, layerParser) {
+	if len(b) < dot1QTagSize {
+		return parsePayload(b)
+	}
+	tci := binary.BigEndian.Uint16(b)
+	t := tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[2:]))
+	dot1Q := Dot1Q{
+		PCP:  Uint8(uint8(tci >> 13)),
+		DEI:  Bool(tci&(1<<12) != 0),
+		VID:  Uint16(tci & 0xfff),
+		Type: NetworkProtocolNumber(t),
+	}
+	return &dot1Q, nextEtherPayloadParser(t)
+}
+
+func (l *Dot1Q) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *Dot1Q) length() int {
+	return dot1QTagSize
+}
+
+// merge implements Layer.merge.
+func (l *Dot1Q) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
 // IPv4 can construct and match an IPv4 encapsulation.
 type IPv4 struct {
 	LayerBase
@@ -362,6 +476,10 @@ func (l *IPv4) ToBytes() ([]byte, error) {
 			fields.Protocol = uint8(header.UDPProtocolNumber)
 		case *ICMPv4:
 			fields.Protocol = uint8(header.ICMPv4ProtocolNumber)
+		case *IGMP:
+			fields.Protocol = uint8(header.IGMPProtocolNumber)
+		case *SCTP:
+			fields.Protocol = uint8(SCTPProtocolNumber)
 		default:
 			// TODO(b/150301488): Support more protocols as needed.
 			return nil, fmt.Errorf("ipv4 header's next layer is unrecognized: %#v", n)
@@ -438,6 +556,10 @@ func parseIPv4(b []byte) (Layer, layerParser) {
 		nextParser = parseUDP
 	case header.ICMPv4ProtocolNumber:
 		nextParser = parseICMPv4
+	case header.IGMPProtocolNumber:
+		nextParser = parseIGMP
+	case SCTPProtocolNumber:
+		nextParser = parseSCTP
 	default:
 		// Assume that the rest is a payload.
 		nextParser = parsePayload
@@ -528,10 +650,14 @@ func nextIPv6PayloadParser(nextHeader uint8) layerParser {
 		return parseUDP
 	case header.ICMPv6ProtocolNumber:
 		return parseICMPv6
+	case SCTPProtocolNumber:
+		return parseSCTP
 	}
 	switch header.IPv6ExtensionHeaderIdentifier(nextHeader) {
 	case header.IPv6HopByHopOptionsExtHdrIdentifier:
 		return parseIPv6HopByHopOptionsExtHdr
+	case header.IPv6RoutingExtHdrIdentifier:
+		return parseIPv6RoutingExtHdr
 	case header.IPv6DestinationOptionsExtHdrIdentifier:
 		return parseIPv6DestinationOptionsExtHdr
 	case header.IPv6FragmentExtHdrIdentifier:
@@ -588,6 +714,16 @@ type IPv6DestinationOptionsExtHdr struct {
 	Options    []byte
 }
 
+// IPv6RoutingExtHdr can construct and match an IPv6 Routing Extension Header.
+type IPv6RoutingExtHdr struct {
+	LayerBase
+	NextHeader   *header.IPv6ExtensionHeaderIdentifier
+	RoutingType  *uint8
+	SegmentsLeft *uint8
+	// Data holds the type-specific data of the routing header.
+	Data []byte
+}
+
 // IPv6FragmentExtHdr can construct and match an IPv6 Fragment Extension Header.
 type IPv6FragmentExtHdr struct {
 	LayerBase
@@ -609,10 +745,14 @@ func nextHeaderByLayer(l Layer) (uint8, error) {
 		return uint8(header.UDPProtocolNumber), nil
 	case *ICMPv6:
 		return uint8(header.ICMPv6ProtocolNumber), nil
+	case *SCTP:
+		return uint8(SCTPProtocolNumber), nil
 	case *Payload:
 		return uint8(header.IPv6NoNextHeaderIdentifier), nil
 	case *IPv6HopByHopOptionsExtHdr:
 		return uint8(header.IPv6HopByHopOptionsExtHdrIdentifier), nil
+	case *IPv6RoutingExtHdr:
+		return uint8(header.IPv6RoutingExtHdrIdentifier), nil
 	case *IPv6DestinationOptionsExtHdr:
 		return uint8(header.IPv6DestinationOptionsExtHdrIdentifier), nil
 	case *IPv6FragmentExtHdr:
@@ -665,6 +805,20 @@ func (l *IPv6DestinationOptionsExtHdr) ToBytes() ([]byte, error) {
 	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.next(), l.Options)
 }
 
+// ToBytes implements Layer.ToBytes.
+func (l *IPv6RoutingExtHdr) ToBytes() ([]byte, error) {
+	// The routing type and segments left fields are serialized as the first
+	// two octets of the options of a generic extension header.
+	var routingType, segmentsLeft uint8
+	if l.RoutingType != nil {
+		routingType = *l.RoutingType
+	}
+	if l.SegmentsLeft != nil {
+		segmentsLeft = *l.SegmentsLeft
+	}
+	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.next(), append([]byte{routingType, segmentsLeft}, l.Data...))
+}
+
 // ToBytes implements Layer.ToBytes.
 func (l *IPv6FragmentExtHdr) ToBytes() ([]byte, error) {
 	var offset, mflag uint16
@@ -701,10 +855,11 @@ func (l *IPv6FragmentExtHdr) ToBytes() ([]byte, error) {
 // next extension header.
 func parseIPv6ExtHdr(b []byte) (header.IPv6ExtensionHeaderIdentifier, []byte, layerParser) {
 	nextHeader := b[0]
-	// For HopByHop and Destination options extension headers,
+	// For HopByHop, Routing and Destination options extension headers,
 	// This field is the length of the extension header in
 	// 8-octet units, not including the first 8 octets.
 	// https://tools.ietf.org/html/rfc2460#section-4.3
+	// https://tools.ietf.org/html/rfc2460#section-4.4
 	// https://tools.ietf.org/html/rfc2460#section-4.6
 	length := b[1]*8 + 8
 	data := b[2:length]
@@ -726,6 +881,18 @@ func parseIPv6DestinationOptionsExtHdr(b []byte) (Layer, layerParser) {
 	return &IPv6DestinationOptionsExtHdr{NextHeader: &nextHeader, Options: options}, nextParser
 }
 
+// parseIPv6RoutingExtHdr parses the bytes assuming that they start with an
+// IPv6 Routing Extension Header.
+func parseIPv6RoutingExtHdr(b []byte) (Layer, layerParser) {
+	nextHeader, data, nextParser := parseIPv6ExtHdr(b)
+	return &IPv6RoutingExtHdr{
+		NextHeader:   &nextHeader,
+		RoutingType:  Uint8(data[0]),
+		SegmentsLeft: Uint8(data[1]),
+		Data:         data[2:],
+	}, nextParser
+}
+
 // Bool is a helper routine that allocates a new
 // bool value to store v and returns a pointer to it.
 func Bool(v bool) *bool {
@@ -787,6 +954,24 @@ func (l *IPv6DestinationOptionsExtHdr) String() string {
 	return stringLayer(l)
 }
 
+func (l *IPv6RoutingExtHdr) length() int {
+	return len(l.Data) + 4
+}
+
+func (l *IPv6RoutingExtHdr) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *IPv6RoutingExtHdr) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+func (l *IPv6RoutingExtHdr) String() string {
+	return stringLayer(l)
+}
+
 func (*IPv6FragmentExtHdr) length() int {
 	return header.IPv6FragmentExtHdrLength
 }
@@ -878,8 +1063,14 @@ func parseICMPv6(b []byte) (Layer, layerParser) {
 		Type:     ICMPv6Type(h.Type()),
 		Code:     ICMPv6Code(h.Code()),
 		Checksum: Uint16(h.Checksum()),
-		Payload:  h.MessageBody(),
 	}
+	switch h.Type() {
+	case header.ICMPv6MulticastListenerQuery, header.ICMPv6MulticastListenerReport, header.ICMPv6MulticastListenerDone:
+		return &icmpv6, parseMLD
+	case header.ICMPv6MulticastListenerV2Report:
+		return &icmpv6, parseMLDv2Report
+	}
+	icmpv6.Payload = h.MessageBody()
 	return &icmpv6, nil
 }
 
@@ -897,6 +1088,144 @@ func (l *ICMPv6) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// MLD can construct and match an MLD message. It is the body of an ICMPv6
+// message of one of the MLD types, so it must follow an ICMPv6 layer without
+// Payload.
+type MLD struct {
+	LayerBase
+	MaxRespCode      *uint16
+	MulticastAddress *tcpip.Address  // Not in MLDv2 Reports.
+	SFlag            *bool           // Only in MLDv2 Queries.
+	QRV              *uint8          // Only in MLDv2 Queries.
+	QQIC             *uint8          // Only in MLDv2 Queries.
+	Sources          []tcpip.Address // Only in MLDv2 Queries.
+	AddressRecords   []GroupRecord   // Only in MLDv2 Reports.
+}
+
+const (
+	// mldv2QueryMinimumSize is the minimum size of the body of an MLDv2 Query,
+	// as per RFC 3810 section 5.1.
+	mldv2QueryMinimumSize = 24
+
+	// mldv2ReportMinimumSize is the minimum size of the body of an MLDv2
+	// Report, as per RFC 3810 section 5.2.
+	mldv2ReportMinimumSize = 4
+)
+
+func (l *MLD) String() string {
+	return stringLayer(l)
+}
+
+// isV2Report returns true if l is the body of an MLDv2 Report.
+func (l *MLD) isV2Report() bool {
+	if icmpv6, ok := l.Prev().(*ICMPv6); ok && icmpv6.Type != nil {
+		return *icmpv6.Type == header.ICMPv6MulticastListenerV2Report
+	}
+	return l.AddressRecords != nil
+}
+
+// isV2Query returns true if l is the body of an MLDv2 Query.
+func (l *MLD) isV2Query() bool {
+	if l.isV2Report() {
+		return false
+	}
+	return l.SFlag != nil || l.QRV != nil || l.QQIC != nil || l.Sources != nil
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *MLD) ToBytes() ([]byte, error) {
+	b := make([]byte, l.length())
+	if l.isV2Report() {
+		binary.BigEndian.PutUint16(b[2:], uint16(len(l.AddressRecords)))
+		if err := putGroupRecords(b[mldv2ReportMinimumSize:], l.AddressRecords, header.IPv6AddressSize); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	h := header.MLD(b)
+	if l.MaxRespCode != nil {
+		h.SetMaximumResponseDelay(*l.MaxRespCode)
+	}
+	if l.MulticastAddress != nil {
+		h.SetMulticastAddress(*l.MulticastAddress)
+	}
+	if l.isV2Query() {
+		if l.SFlag != nil && *l.SFlag {
+			b[20] |= 1 << 3
+		}
+		if l.QRV != nil {
+			b[20] |= *l.QRV & 0x7
+		}
+		if l.QQIC != nil {
+			b[21] = *l.QQIC
+		}
+		binary.BigEndian.PutUint16(b[22:], uint16(len(l.Sources)))
+		if err := putAddresses(b[mldv2QueryMinimumSize:], l.Sources, header.IPv6AddressSize); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// parseMLD parses the bytes assuming that they start with the body of an MLD
+// Query, Report or Done message.
+func parseMLD(b []byte) (Layer, layerParser) {
+	if len(b) < header.MLDMinimumSize {
+		return parsePayload(b)
+	}
+	h := header.MLD(b)
+	mld := MLD{
+		MaxRespCode:      Uint16(binary.BigEndian.Uint16(b)),
+		MulticastAddress: Address(h.MulticastAddress()),
+	}
+	if len(b) >= mldv2QueryMinimumSize {
+		sources, ok := parseAddresses(b[mldv2QueryMinimumSize:], binary.BigEndian.Uint16(b[22:]), header.IPv6AddressSize)
+		if !ok {
+			return parsePayload(b)
+		}
+		mld.SFlag = Bool(b[20]&(1<<3) != 0)
+		mld.QRV = Uint8(b[20] & 0x7)
+		mld.QQIC = Uint8(b[21])
+		mld.Sources = sources
+	}
+	return &mld, nil
+}
+
+// parseMLDv2Report parses the bytes assuming that they start with the body of
+// an MLDv2 Report.
+func parseMLDv2Report(b []byte) (Layer, layerParser) {
+	if len(b) < mldv2ReportMinimumSize {
+		return parsePayload(b)
+	}
+	records, ok := parseGroupRecords(b[mldv2ReportMinimumSize:], binary.BigEndian.Uint16(b[2:]), header.IPv6AddressSize)
+	if !ok {
+		return parsePayload(b)
+	}
+	return &MLD{AddressRecords: records}, nil
+}
+
+func (l *MLD) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *MLD) length() int {
+	switch {
+	case l.isV2Report():
+		return mldv2ReportMinimumSize + groupRecordsLength(l.AddressRecords, header.IPv6AddressSize)
+	case l.isV2Query():
+		return mldv2QueryMinimumSize + len(l.Sources)*header.IPv6AddressSize
+	default:
+		return header.MLDMinimumSize
+	}
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *MLD) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
 // ICMPv4 can construct and match an ICMPv4 encapsulation.
 type ICMPv4 struct {
 	LayerBase
@@ -1009,6 +1338,261 @@ func (l *ICMPv4) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// GroupRecord is a Group Record of an IGMPv3 Membership Report or a Multicast
+// Address Record of an MLDv2 Report.
+type GroupRecord struct {
+	Type             uint8
+	MulticastAddress tcpip.Address
+	Sources          []tcpip.Address
+	// AuxData must be a multiple of 4 bytes long.
+	AuxData []byte
+}
+
+// groupRecordMinimumSize is the size of a GroupRecord without its addresses
+// and auxiliary data, as per RFC 3376 section 4.2.4 and RFC 3810 section 5.2.4.
+const groupRecordMinimumSize = 4
+
+// groupRecordsLength returns the length in bytes of the serialized records
+// holding addresses of addrSize bytes.
+func groupRecordsLength(records []GroupRecord, addrSize int) int {
+	var length int
+	for _, r := range records {
+		length += groupRecordMinimumSize + addrSize*(1+len(r.Sources)) + len(r.AuxData)
+	}
+	return length
+}
+
+// putAddresses serializes addrs into b, which must be large enough to hold
+// them.
+func putAddresses(b []byte, addrs []tcpip.Address, addrSize int) error {
+	for _, addr := range addrs {
+		if len(addr) != addrSize {
+			return fmt.Errorf("address %s must be %d bytes long", addr, addrSize)
+		}
+		b = b[copy(b, addr):]
+	}
+	return nil
+}
+
+// putGroupRecords serializes records into b, which must be
+// groupRecordsLength(records, addrSize) bytes long.
+func putGroupRecords(b []byte, records []GroupRecord, addrSize int) error {
+	for _, r := range records {
+		if len(r.AuxData)%4 != 0 {
+			return fmt.Errorf("auxiliary data must be a multiple of 4 octets long, but the length given: %d", len(r.AuxData))
+		}
+		b[0] = r.Type
+		b[1] = uint8(len(r.AuxData) / 4)
+		binary.BigEndian.PutUint16(b[2:], uint16(len(r.Sources)))
+		b = b[groupRecordMinimumSize:]
+		if err := putAddresses(b, append([]tcpip.Address{r.MulticastAddress}, r.Sources...), addrSize); err != nil {
+			return err
+		}
+		b = b[addrSize*(1+len(r.Sources)):]
+		b = b[copy(b, r.AuxData):]
+	}
+	return nil
+}
+
+// parseAddresses parses n addresses of addrSize bytes from b. It returns false
+// if b is too short to hold them.
+func parseAddresses(b []byte, n uint16, addrSize int) ([]tcpip.Address, bool) {
+	if len(b) < int(n)*addrSize {
+		return nil, false
+	}
+	addrs := make([]tcpip.Address, 0, n)
+	for i := 0; i < int(n); i++ {
+		addrs = append(addrs, tcpip.Address(b[:addrSize]))
+		b = b[addrSize:]
+	}
+	return addrs, true
+}
+
+// parseGroupRecords parses n records holding addresses of addrSize bytes from
+// b. It returns false if b is too short to hold them.
+func parseGroupRecords(b []byte, n uint16, addrSize int) ([]GroupRecord, bool) {
+	records := make([]GroupRecord, 0, n)
+	for i := 0; i < int(n); i++ {
+		if len(b) < groupRecordMinimumSize+addrSize {
+			return nil, false
+		}
+		auxDataLen := int(b[1]) * 4
+		numSources := binary.BigEndian.Uint16(b[2:])
+		r := GroupRecord{
+			Type:             b[0],
+			MulticastAddress: tcpip.Address(b[groupRecordMinimumSize:][:addrSize]),
+		}
+		b = b[groupRecordMinimumSize+addrSize:]
+		sources, ok := parseAddresses(b, numSources, addrSize)
+		if !ok {
+			return nil, false
+		}
+		r.Sources = sources
+		b = b[int(numSources)*addrSize:]
+		if len(b) < auxDataLen {
+			return nil, false
+		}
+		r.AuxData = b[:auxDataLen]
+		b = b[auxDataLen:]
+		records = append(records, r)
+	}
+	return records, true
+}
+
+// IGMP can construct and match an IGMP encapsulation.
+type IGMP struct {
+	LayerBase
+	Type         *header.IGMPType
+	MaxRespCode  *uint8
+	Checksum     *uint16
+	GroupAddress *tcpip.Address  // Not in IGMPv3 Membership Reports.
+	SFlag        *bool           // Only in IGMPv3 Membership Queries.
+	QRV          *uint8          // Only in IGMPv3 Membership Queries.
+	QQIC         *uint8          // Only in IGMPv3 Membership Queries.
+	Sources      []tcpip.Address // Only in IGMPv3 Membership Queries.
+	GroupRecords []GroupRecord   // Only in IGMPv3 Membership Reports.
+}
+
+const (
+	// igmpv3QueryMinimumSize is the minimum size of an IGMPv3 Membership
+	// Query, as per RFC 3376 section 4.1.
+	igmpv3QueryMinimumSize = 12
+
+	// igmpv3ReportNumRecordsOffset is the offset of the Number of Group
+	// Records field in an IGMPv3 Membership Report, as per RFC 3376 section
+	// 4.2.
+	igmpv3ReportNumRecordsOffset = 6
+)
+
+func (l *IGMP) String() string {
+	return stringLayer(l)
+}
+
+// IGMPType is a helper routine that allocates a new header.IGMPType value to
+// store t and returns a pointer to it.
+func IGMPType(t header.IGMPType) *header.IGMPType {
+	return &t
+}
+
+// isV3Report returns true if l is an IGMPv3 Membership Report.
+func (l *IGMP) isV3Report() bool {
+	if l.Type != nil {
+		return *l.Type == header.IGMPv3MembershipReport
+	}
+	return l.GroupRecords != nil
+}
+
+// isV3Query returns true if l is an IGMPv3 Membership Query.
+func (l *IGMP) isV3Query() bool {
+	if l.isV3Report() {
+		return false
+	}
+	return l.SFlag != nil || l.QRV != nil || l.QQIC != nil || l.Sources != nil
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *IGMP) ToBytes() ([]byte, error) {
+	b := make([]byte, l.length())
+	h := header.IGMP(b)
+	if l.Type != nil {
+		h.SetType(*l.Type)
+	} else if l.isV3Report() {
+		h.SetType(header.IGMPv3MembershipReport)
+	}
+	if l.MaxRespCode != nil {
+		h.SetMaxRespTime(*l.MaxRespCode)
+	}
+	if l.isV3Report() {
+		binary.BigEndian.PutUint16(b[igmpv3ReportNumRecordsOffset:], uint16(len(l.GroupRecords)))
+		if err := putGroupRecords(b[header.IGMPMinimumSize:], l.GroupRecords, header.IPv4AddressSize); err != nil {
+			return nil, err
+		}
+	} else {
+		if l.GroupAddress != nil {
+			h.SetGroupAddress(*l.GroupAddress)
+		}
+		if l.isV3Query() {
+			if l.SFlag != nil && *l.SFlag {
+				b[8] |= 1 << 3
+			}
+			if l.QRV != nil {
+				b[8] |= *l.QRV & 0x7
+			}
+			if l.QQIC != nil {
+				b[9] = *l.QQIC
+			}
+			binary.BigEndian.PutUint16(b[10:], uint16(len(l.Sources)))
+			if err := putAddresses(b[igmpv3QueryMinimumSize:], l.Sources, header.IPv4AddressSize); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The checksum must be handled last because the IGMP header fields are
+	// included in the computation.
+	if l.Checksum != nil {
+		h.SetChecksum(*l.Checksum)
+	} else {
+		h.SetChecksum(header.IGMPCalculateChecksum(h))
+	}
+	return h, nil
+}
+
+// parseIGMP parses the bytes assuming that they start with an IGMP header.
+func parseIGMP(b []byte) (Layer, layerParser) {
+	if len(b) < header.IGMPMinimumSize {
+		return parsePayload(b)
+	}
+	h := header.IGMP(b)
+	igmp := IGMP{
+		Type:        IGMPType(h.Type()),
+		MaxRespCode: Uint8(b[1]),
+		Checksum:    Uint16(h.Checksum()),
+	}
+	switch {
+	case h.Type() == header.IGMPv3MembershipReport:
+		records, ok := parseGroupRecords(b[header.IGMPMinimumSize:], binary.BigEndian.Uint16(b[igmpv3ReportNumRecordsOffset:]), header.IPv4AddressSize)
+		if !ok {
+			return parsePayload(b)
+		}
+		igmp.GroupRecords = records
+	case h.Type() == header.IGMPMembershipQuery && len(b) >= igmpv3QueryMinimumSize:
+		sources, ok := parseAddresses(b[igmpv3QueryMinimumSize:], binary.BigEndian.Uint16(b[10:]), header.IPv4AddressSize)
+		if !ok {
+			return parsePayload(b)
+		}
+		igmp.GroupAddress = Address(h.GroupAddress())
+		igmp.SFlag = Bool(b[8]&(1<<3) != 0)
+		igmp.QRV = Uint8(b[8] & 0x7)
+		igmp.QQIC = Uint8(b[9])
+		igmp.Sources = sources
+	default:
+		igmp.GroupAddress = Address(h.GroupAddress())
+	}
+	return &igmp, nil
+}
+
+func (l *IGMP) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *IGMP) length() int {
+	switch {
+	case l.isV3Report():
+		return header.IGMPMinimumSize + groupRecordsLength(l.GroupRecords, header.IPv4AddressSize)
+	case l.isV3Query():
+		return igmpv3QueryMinimumSize + len(l.Sources)*header.IPv4AddressSize
+	default:
+		return header.IGMPMinimumSize
+	}
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *IGMP) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
 // TCP can construct and match a TCP encapsulation.
 type TCP struct {
 	LayerBase
@@ -1095,12 +1679,28 @@ func payload(l Layer) (buffer.VectorisedView, error) {
 	return payloadBytes, nil
 }
 
+// isIPv6ExtHdr returns true if l is an IPv6 extension header.
+func isIPv6ExtHdr(l Layer) bool {
+	switch l.(type) {
+	case *IPv6HopByHopOptionsExtHdr, *IPv6RoutingExtHdr, *IPv6DestinationOptionsExtHdr, *IPv6FragmentExtHdr:
+		return true
+	default:
+		return false
+	}
+}
+
 // layerChecksum calculates the checksum of the Layer header, including the
 // peusdeochecksum of the layer before it and all the bytes after it.
 func layerChecksum(l Layer, protoNumber tcpip.TransportProtocolNumber) (uint16, error) {
 	totalLength := uint16(totalLength(l))
+	// IPv6 extension headers may sit between the network layer and l, they
+	// are not covered by the pseudo-header.
+	prev := l.Prev()
+	for isIPv6ExtHdr(prev) {
+		prev = prev.Prev()
+	}
 	var xsum uint16
-	switch p := l.Prev().(type) {
+	switch p := prev.(type) {
 	case *IPv4:
 		xsum = header.PseudoHeaderChecksum(protoNumber, *p.SrcAddr, *p.DstAddr, totalLength)
 	case *IPv6:
@@ -1249,6 +1849,459 @@ func (l *UDP) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// SCTPProtocolNumber is SCTP's transport protocol number.
+const SCTPProtocolNumber tcpip.TransportProtocolNumber = 132
+
+// SCTP chunk types, as per RFC 4960 section 3.2.
+const (
+	SCTPChunkData    = 0
+	SCTPChunkInit    = 1
+	SCTPChunkInitAck = 2
+	SCTPChunkSack    = 3
+)
+
+// Flags of an SCTP DATA chunk, as per RFC 4960 section 3.3.1.
+const (
+	SCTPDataFlagEnd       = 1 << 0
+	SCTPDataFlagBegin     = 1 << 1
+	SCTPDataFlagUnordered = 1 << 2
+)
+
+const (
+	// sctpCommonHeaderSize is the size of the SCTP common header.
+	sctpCommonHeaderSize = 12
+	// sctpChunkHeaderSize is the size of the type, flags and length fields
+	// that start every SCTP chunk.
+	sctpChunkHeaderSize = 4
+	// sctpInitChunkMinimumSize is the size of an INIT or INIT ACK chunk
+	// without parameters.
+	sctpInitChunkMinimumSize = 20
+	// sctpDataChunkMinimumSize is the size of a DATA chunk without user data.
+	sctpDataChunkMinimumSize = 16
+	// sctpSackChunkMinimumSize is the size of a SACK chunk without gap ack
+	// blocks or duplicate TSNs.
+	sctpSackChunkMinimumSize = 16
+)
+
+// sctpCRC32CTable is the table of the CRC32c checksum used by SCTP.
+var sctpCRC32CTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SCTP can construct and match the common header of an SCTP packet. The
+// chunks of the packet are the layers that follow it.
+type SCTP struct {
+	LayerBase
+	SrcPort         *uint16
+	DstPort         *uint16
+	VerificationTag *uint32
+	// Checksum is the CRC32c of the packet, which is stored on the wire in
+	// little-endian byte order as per RFC 4960 appendix B.
+	Checksum *uint32
+}
+
+func (l *SCTP) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *SCTP) ToBytes() ([]byte, error) {
+	b := make([]byte, sctpCommonHeaderSize)
+	if l.SrcPort != nil {
+		binary.BigEndian.PutUint16(b, *l.SrcPort)
+	}
+	if l.DstPort != nil {
+		binary.BigEndian.PutUint16(b[2:], *l.DstPort)
+	}
+	if l.VerificationTag != nil {
+		binary.BigEndian.PutUint32(b[4:], *l.VerificationTag)
+	}
+	if l.Checksum != nil {
+		binary.LittleEndian.PutUint32(b[8:], *l.Checksum)
+		return b, nil
+	}
+	// The checksum covers the whole packet, with the checksum field zeroed.
+	chunks, err := payload(l)
+	if err != nil {
+		return nil, err
+	}
+	xsum := crc32.Update(0, sctpCRC32CTable, b)
+	for _, v := range chunks.Views() {
+		xsum = crc32.Update(xsum, sctpCRC32CTable, v)
+	}
+	binary.LittleEndian.PutUint32(b[8:], xsum)
+	return b, nil
+}
+
+// parseSCTP parses the bytes assuming that they start with an SCTP common
+// header and continues parsing the chunks that follow it.
+func parseSCTP(b []byte) (Layer, layerParser) {
+	if len(b) < sctpCommonHeaderSize {
+		return parsePayload(b)
+	}
+	sctp := SCTP{
+		SrcPort:         Uint16(binary.BigEndian.Uint16(b)),
+		DstPort:         Uint16(binary.BigEndian.Uint16(b[2:])),
+		VerificationTag: Uint32(binary.BigEndian.Uint32(b[4:])),
+		Checksum:        Uint32(binary.LittleEndian.Uint32(b[8:])),
+	}
+	if len(b) == sctpCommonHeaderSize {
+		return &sctp, nil
+	}
+	return &sctp, parseSCTPChunk
+}
+
+func (l *SCTP) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *SCTP) length() int {
+	return sctpCommonHeaderSize
+}
+
+// merge implements Layer.merge.
+func (l *SCTP) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// sctpPaddedLength returns n rounded up to a multiple of 4 bytes, the
+// alignment of SCTP chunks.
+func sctpPaddedLength(n int) int {
+	return (n + 3) &^ 3
+}
+
+// sctpChunkToBytes serializes a chunk of type typ made of the chunk header and
+// value, padded to a multiple of 4 bytes. The length is computed unless it is
+// given.
+func sctpChunkToBytes(typ uint8, flags *uint8, length *uint16, value []byte) []byte {
+	b := make([]byte, sctpPaddedLength(sctpChunkHeaderSize+len(value)))
+	b[0] = typ
+	if flags != nil {
+		b[1] = *flags
+	}
+	if length != nil {
+		binary.BigEndian.PutUint16(b[2:], *length)
+	} else {
+		binary.BigEndian.PutUint16(b[2:], uint16(sctpChunkHeaderSize+len(value)))
+	}
+	copy(b[sctpChunkHeaderSize:], value)
+	return b
+}
+
+// parseSCTPChunk parses the bytes assuming that they start with an SCTP chunk
+// and continues parsing the chunks that follow it. Chunks that are
+// unrecognized or too short for their type are parsed as an SCTPChunk.
+func parseSCTPChunk(b []byte) (Layer, layerParser) {
+	if len(b) < sctpChunkHeaderSize {
+		return parsePayload(b)
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < sctpChunkHeaderSize || length > len(b) {
+		return parsePayload(b)
+	}
+	chunk := b[:length]
+	var l Layer
+	switch typ := chunk[0]; {
+	case (typ == SCTPChunkInit || typ == SCTPChunkInitAck) && length >= sctpInitChunkMinimumSize:
+		l = parseSCTPInit(chunk)
+	case typ == SCTPChunkData && length >= sctpDataChunkMinimumSize:
+		l = parseSCTPData(chunk)
+	case typ == SCTPChunkSack && length >= sctpSackChunkMinimumSize:
+		l = parseSCTPSack(chunk)
+	}
+	if l == nil {
+		l = &SCTPChunk{
+			Type:   Uint8(chunk[0]),
+			Flags:  Uint8(chunk[1]),
+			Length: Uint16(uint16(length)),
+			Value:  chunk[sctpChunkHeaderSize:],
+		}
+	}
+	// The padding of the last chunk may be missing.
+	if sctpPaddedLength(length) >= len(b) {
+		return l, nil
+	}
+	return l, parseSCTPChunk
+}
+
+// SCTPChunk can construct and match an SCTP chunk of any type, whose value is
+// left unparsed.
+type SCTPChunk struct {
+	LayerBase
+	Type   *uint8
+	Flags  *uint8
+	Length *uint16
+	// Value holds the chunk after its type, flags and length, without the
+	// padding.
+	Value []byte
+}
+
+func (l *SCTPChunk) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *SCTPChunk) ToBytes() ([]byte, error) {
+	if l.Type == nil {
+		return nil, fmt.Errorf("SCTP chunk type must be set")
+	}
+	return sctpChunkToBytes(*l.Type, l.Flags, l.Length, l.Value), nil
+}
+
+func (l *SCTPChunk) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *SCTPChunk) length() int {
+	return sctpPaddedLength(sctpChunkHeaderSize + len(l.Value))
+}
+
+// merge implements Layer.merge.
+func (l *SCTPChunk) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// SCTPInit can construct and match an SCTP INIT or INIT ACK chunk.
+type SCTPInit struct {
+	LayerBase
+	// Type is SCTPChunkInit or SCTPChunkInitAck. If it is nil, an INIT chunk
+	// is constructed.
+	Type                 *uint8
+	Flags                *uint8
+	Length               *uint16
+	InitiateTag          *uint32
+	AdvertisedRecvWindow *uint32
+	OutboundStreams      *uint16
+	InboundStreams       *uint16
+	InitialTSN           *uint32
+	// Params holds the parameters that follow the fixed fields, such as the
+	// State Cookie of an INIT ACK.
+	Params []byte
+}
+
+func (l *SCTPInit) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *SCTPInit) ToBytes() ([]byte, error) {
+	typ := uint8(SCTPChunkInit)
+	if l.Type != nil {
+		typ = *l.Type
+	}
+	v := make([]byte, sctpInitChunkMinimumSize-sctpChunkHeaderSize, sctpInitChunkMinimumSize-sctpChunkHeaderSize+len(l.Params))
+	if l.InitiateTag != nil {
+		binary.BigEndian.PutUint32(v, *l.InitiateTag)
+	}
+	if l.AdvertisedRecvWindow != nil {
+		binary.BigEndian.PutUint32(v[4:], *l.AdvertisedRecvWindow)
+	} else {
+		binary.BigEndian.PutUint32(v[4:], 65535)
+	}
+	if l.OutboundStreams != nil {
+		binary.BigEndian.PutUint16(v[8:], *l.OutboundStreams)
+	} else {
+		binary.BigEndian.PutUint16(v[8:], 1)
+	}
+	if l.InboundStreams != nil {
+		binary.BigEndian.PutUint16(v[10:], *l.InboundStreams)
+	} else {
+		binary.BigEndian.PutUint16(v[10:], 1)
+	}
+	if l.InitialTSN != nil {
+		binary.BigEndian.PutUint32(v[12:], *l.InitialTSN)
+	}
+	v = append(v, l.Params...)
+	return sctpChunkToBytes(typ, l.Flags, l.Length, v), nil
+}
+
+// parseSCTPInit parses an INIT or INIT ACK chunk of at least
+// sctpInitChunkMinimumSize bytes.
+func parseSCTPInit(b []byte) Layer {
+	return &SCTPInit{
+		Type:                 Uint8(b[0]),
+		Flags:                Uint8(b[1]),
+		Length:               Uint16(binary.BigEndian.Uint16(b[2:])),
+		InitiateTag:          Uint32(binary.BigEndian.Uint32(b[4:])),
+		AdvertisedRecvWindow: Uint32(binary.BigEndian.Uint32(b[8:])),
+		OutboundStreams:      Uint16(binary.BigEndian.Uint16(b[12:])),
+		InboundStreams:       Uint16(binary.BigEndian.Uint16(b[14:])),
+		InitialTSN:           Uint32(binary.BigEndian.Uint32(b[16:])),
+		Params:               b[sctpInitChunkMinimumSize:],
+	}
+}
+
+func (l *SCTPInit) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *SCTPInit) length() int {
+	return sctpPaddedLength(sctpInitChunkMinimumSize + len(l.Params))
+}
+
+// merge implements Layer.merge.
+func (l *SCTPInit) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// SCTPData can construct and match an SCTP DATA chunk.
+type SCTPData struct {
+	LayerBase
+	// Flags holds the U, B and E bits. If it is nil, the chunk carries a
+	// whole ordered message, with the B and E bits set.
+	Flags        *uint8
+	Length       *uint16
+	TSN          *uint32
+	StreamID     *uint16
+	StreamSeqNum *uint16
+	PPID         *uint32
+	Data         []byte
+}
+
+func (l *SCTPData) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *SCTPData) ToBytes() ([]byte, error) {
+	flags := l.Flags
+	if flags == nil {
+		flags = Uint8(SCTPDataFlagBegin | SCTPDataFlagEnd)
+	}
+	v := make([]byte, sctpDataChunkMinimumSize-sctpChunkHeaderSize, sctpDataChunkMinimumSize-sctpChunkHeaderSize+len(l.Data))
+	if l.TSN != nil {
+		binary.BigEndian.PutUint32(v, *l.TSN)
+	}
+	if l.StreamID != nil {
+		binary.BigEndian.PutUint16(v[4:], *l.StreamID)
+	}
+	if l.StreamSeqNum != nil {
+		binary.BigEndian.PutUint16(v[6:], *l.StreamSeqNum)
+	}
+	if l.PPID != nil {
+		binary.BigEndian.PutUint32(v[8:], *l.PPID)
+	}
+	v = append(v, l.Data...)
+	return sctpChunkToBytes(SCTPChunkData, flags, l.Length, v), nil
+}
+
+// parseSCTPData parses a DATA chunk of at least sctpDataChunkMinimumSize
+// bytes.
+func parseSCTPData(b []byte) Layer {
+	return &SCTPData{
+		Flags:        Uint8(b[1]),
+		Length:       Uint16(binary.BigEndian.Uint16(b[2:])),
+		TSN:          Uint32(binary.BigEndian.Uint32(b[4:])),
+		StreamID:     Uint16(binary.BigEndian.Uint16(b[8:])),
+		StreamSeqNum: Uint16(binary.BigEndian.Uint16(b[10:])),
+		PPID:         Uint32(binary.BigEndian.Uint32(b[12:])),
+		Data:         b[sctpDataChunkMinimumSize:],
+	}
+}
+
+func (l *SCTPData) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *SCTPData) length() int {
+	return sctpPaddedLength(sctpDataChunkMinimumSize + len(l.Data))
+}
+
+// merge implements Layer.merge.
+func (l *SCTPData) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// SCTPGapAckBlock is a Gap Ack Block of an SCTP SACK chunk. Start and End are
+// offsets from the Cumulative TSN Ack.
+type SCTPGapAckBlock struct {
+	Start, End uint16
+}
+
+// SCTPSack can construct and match an SCTP SACK chunk. The numbers of gap ack
+// blocks and duplicate TSNs are taken from the lengths of GapAckBlocks and
+// DuplicateTSNs.
+type SCTPSack struct {
+	LayerBase
+	Flags                *uint8
+	Length               *uint16
+	CumulativeTSNAck     *uint32
+	AdvertisedRecvWindow *uint32
+	GapAckBlocks         []SCTPGapAckBlock
+	DuplicateTSNs        []uint32
+}
+
+func (l *SCTPSack) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *SCTPSack) ToBytes() ([]byte, error) {
+	v := make([]byte, l.length()-sctpChunkHeaderSize)
+	if l.CumulativeTSNAck != nil {
+		binary.BigEndian.PutUint32(v, *l.CumulativeTSNAck)
+	}
+	if l.AdvertisedRecvWindow != nil {
+		binary.BigEndian.PutUint32(v[4:], *l.AdvertisedRecvWindow)
+	} else {
+		binary.BigEndian.PutUint32(v[4:], 65535)
+	}
+	binary.BigEndian.PutUint16(v[8:], uint16(len(l.GapAckBlocks)))
+	binary.BigEndian.PutUint16(v[10:], uint16(len(l.DuplicateTSNs)))
+	off := sctpSackChunkMinimumSize - sctpChunkHeaderSize
+	for _, block := range l.GapAckBlocks {
+		binary.BigEndian.PutUint16(v[off:], block.Start)
+		binary.BigEndian.PutUint16(v[off+2:], block.End)
+		off += 4
+	}
+	for _, tsn := range l.DuplicateTSNs {
+		binary.BigEndian.PutUint32(v[off:], tsn)
+		off += 4
+	}
+	return sctpChunkToBytes(SCTPChunkSack, l.Flags, l.Length, v), nil
+}
+
+// parseSCTPSack parses a SACK chunk of at least sctpSackChunkMinimumSize
+// bytes. It returns nil if the chunk is too short for the gap ack blocks and
+// duplicate TSNs it claims to hold.
+func parseSCTPSack(b []byte) Layer {
+	numGapAckBlocks := int(binary.BigEndian.Uint16(b[12:]))
+	numDuplicateTSNs := int(binary.BigEndian.Uint16(b[14:]))
+	if sctpSackChunkMinimumSize+4*(numGapAckBlocks+numDuplicateTSNs) > len(b) {
+		return nil
+	}
+	sack := SCTPSack{
+		Flags:                Uint8(b[1]),
+		Length:               Uint16(binary.BigEndian.Uint16(b[2:])),
+		CumulativeTSNAck:     Uint32(binary.BigEndian.Uint32(b[4:])),
+		AdvertisedRecvWindow: Uint32(binary.BigEndian.Uint32(b[8:])),
+	}
+	b = b[sctpSackChunkMinimumSize:]
+	for i := 0; i < numGapAckBlocks; i++ {
+		sack.GapAckBlocks = append(sack.GapAckBlocks, SCTPGapAckBlock{
+			Start: binary.BigEndian.Uint16(b),
+			End:   binary.BigEndian.Uint16(b[2:]),
+		})
+		b = b[4:]
+	}
+	for i := 0; i < numDuplicateTSNs; i++ {
+		sack.DuplicateTSNs = append(sack.DuplicateTSNs, binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	return &sack
+}
+
+func (l *SCTPSack) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *SCTPSack) length() int {
+	return sctpSackChunkMinimumSize + 4*(len(l.GapAckBlocks)+len(l.DuplicateTSNs))
+}
+
+// merge implements Layer.merge.
+func (l *SCTPSack) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
 // Payload has bytes beyond OSI layer 4.
 type Payload struct {
 	LayerBase
@@ -16,6 +16,8 @@ package testbench
 
 import (
 	"bytes"
+	"encoding/binary"
+	"hash/crc32"
 	"net"
 	"testing"
 
@@ -697,6 +699,43 @@ func TestIPv6ExtHdrOptions(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "IPv6/Routing/UDP",
+			wantBytes: []byte{
+				// IPv6 Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x1b, 0x2b, 0x40, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef,
+				// Routing ExtHdr
+				0x11, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+				// UDP
+				0x12, 0x34, 0x56, 0x78, 0x00, 0x13, 0xeb, 0x0c,
+				// Sample Data
+				0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x20, 0x44, 0x61, 0x74, 0x61,
+			},
+			wantLayers: []Layer{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+				},
+				&IPv6RoutingExtHdr{
+					NextHeader:   IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.UDPProtocolNumber)),
+					RoutingType:  Uint8(2),
+					SegmentsLeft: Uint8(0),
+					Data:         []byte{0x00, 0x00, 0x00, 0x00},
+				},
+				&UDP{
+					SrcPort:  Uint16(0x1234),
+					DstPort:  Uint16(0x5678),
+					Length:   Uint16(19),
+					Checksum: Uint16(0xeb0c),
+				},
+				&Payload{
+					Bytes: []byte("Sample Data"),
+				},
+			},
+		},
 	} {
 		t.Run(tt.description, func(t *testing.T) {
 			layers := parse(parseIPv6, tt.wantBytes)
@@ -708,12 +747,16 @@ func TestIPv6ExtHdrOptions(t *testing.T) {
 				switch layer := layer.(type) {
 				case *IPv6HopByHopOptionsExtHdr:
 					layer.NextHeader = nil
+				case *IPv6RoutingExtHdr:
+					layer.NextHeader = nil
 				case *IPv6DestinationOptionsExtHdr:
 					layer.NextHeader = nil
 				case *IPv6FragmentExtHdr:
 					layer.NextHeader = nil
 				case *ICMPv6:
 					layer.Checksum = nil
+				case *UDP:
+					layer.Checksum = nil
 				}
 			}
 			gotBytes, err := layers.ToBytes()
@@ -726,3 +769,236 @@ func TestIPv6ExtHdrOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestMulticastGroupMessages(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		parser      layerParser
+		wantBytes   []byte
+		wantLayers  Layers
+	}{
+		{
+			description: "IPv4/IGMPv3Report",
+			parser:      parseIPv4,
+			wantBytes: []byte{
+				// IPv4 Header
+				0x45, 0x00, 0x00, 0x28, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02,
+				0x19, 0x15, 0xc0, 0xa8, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x16,
+				// IGMPv3 Membership Report
+				0x22, 0x00, 0xef, 0x00, 0x00, 0x00, 0x00, 0x01,
+				// Group Record
+				0x04, 0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0xfb,
+				0x0a, 0x00, 0x00, 0x01,
+			},
+			wantLayers: []Layer{
+				&IPv4{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("192.168.0.1").To4())),
+					DstAddr: Address(tcpip.Address(net.ParseIP("224.0.0.22").To4())),
+				},
+				&IGMP{
+					Type:     IGMPType(header.IGMPv3MembershipReport),
+					Checksum: Uint16(0xef00),
+					GroupRecords: []GroupRecord{
+						{
+							Type:             4,
+							MulticastAddress: tcpip.Address(net.ParseIP("224.0.0.251").To4()),
+							Sources:          []tcpip.Address{tcpip.Address(net.ParseIP("10.0.0.1").To4())},
+							AuxData:          []byte{},
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "IPv6/ICMPv6/MLDv2Report",
+			parser:      parseIPv6,
+			wantBytes: []byte{
+				// IPv6 Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x1c, 0x3a, 0x01, 0xfe, 0x80,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x16,
+				// ICMPv6 Header
+				0x8f, 0x00, 0x6f, 0x0f,
+				// MLDv2 Report
+				0x00, 0x00, 0x00, 0x01,
+				// Multicast Address Record
+				0x04, 0x00, 0x00, 0x00, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xfb,
+			},
+			wantLayers: []Layer{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("fe80::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("ff02::16"))),
+				},
+				&ICMPv6{
+					Type:     ICMPv6Type(header.ICMPv6MulticastListenerV2Report),
+					Checksum: Uint16(0x6f0f),
+				},
+				&MLD{
+					AddressRecords: []GroupRecord{
+						{
+							Type:             4,
+							MulticastAddress: tcpip.Address(net.ParseIP("ff02::fb")),
+							Sources:          []tcpip.Address{},
+							AuxData:          []byte{},
+						},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			layers := parse(tt.parser, tt.wantBytes)
+			if !layers.match(tt.wantLayers) {
+				t.Fatalf("match failed with diff: %s", layers.diff(tt.wantLayers))
+			}
+			// Make sure we can generate correct lengths and checksums.
+			for _, layer := range layers {
+				switch layer := layer.(type) {
+				case *IPv4:
+					layer.TotalLength = nil
+					layer.Checksum = nil
+				case *IPv6:
+					layer.PayloadLength = nil
+				case *IGMP:
+					layer.Checksum = nil
+				case *ICMPv6:
+					layer.Checksum = nil
+				}
+			}
+			gotBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			if !bytes.Equal(tt.wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestVLANTags(t *testing.T) {
+	const localExperimentalEtherType tcpip.NetworkProtocolNumber = 0x88b5
+	wantBytes := []byte{
+		// Ethernet Header
+		0x02, 0x42, 0xac, 0x00, 0x00, 0x02, 0x02, 0x42, 0xac, 0x00, 0x00, 0x01,
+		0x88, 0xa8,
+		// 802.1ad Service Tag
+		0xa0, 0x64, 0x81, 0x00,
+		// 802.1Q Customer Tag
+		0x10, 0xc8, 0x88, 0xb5,
+		// Payload
+		0x01, 0x02, 0x03, 0x04,
+	}
+	wantLayers := Layers{
+		&Ether{
+			SrcAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xac\x00\x00\x01")),
+			DstAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xac\x00\x00\x02")),
+			Type:    NetworkProtocolNumber(EtherTypeDot1AD),
+		},
+		&Dot1Q{
+			PCP:  Uint8(5),
+			DEI:  Bool(false),
+			VID:  Uint16(100),
+			Type: NetworkProtocolNumber(EtherTypeDot1Q),
+		},
+		&Dot1Q{
+			PCP:  Uint8(0),
+			DEI:  Bool(true),
+			VID:  Uint16(200),
+			Type: NetworkProtocolNumber(localExperimentalEtherType),
+		},
+		&Payload{
+			Bytes: []byte{0x01, 0x02, 0x03, 0x04},
+		},
+	}
+	layers := parse(parseEther, wantBytes)
+	if !layers.match(wantLayers) {
+		t.Fatalf("match failed with diff: %s", layers.diff(wantLayers))
+	}
+	// Make sure the TPIDs are deduced from the tags that follow.
+	layers[0].(*Ether).Type = nil
+	layers[1].(*Dot1Q).Type = nil
+	gotBytes, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	if !bytes.Equal(wantBytes, gotBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+	}
+}
+
+func TestSCTPChunks(t *testing.T) {
+	layers := Layers{
+		&IPv4{
+			SrcAddr: Address(tcpip.Address(net.ParseIP("192.168.0.1").To4())),
+			DstAddr: Address(tcpip.Address(net.ParseIP("192.168.0.2").To4())),
+		},
+		&SCTP{
+			SrcPort:         Uint16(5000),
+			DstPort:         Uint16(6000),
+			VerificationTag: Uint32(0x01020304),
+		},
+		&SCTPData{
+			TSN:          Uint32(7),
+			StreamID:     Uint16(1),
+			StreamSeqNum: Uint16(2),
+			PPID:         Uint32(3),
+			Data:         []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee},
+		},
+		&SCTPSack{
+			CumulativeTSNAck:     Uint32(9),
+			AdvertisedRecvWindow: Uint32(1024),
+			GapAckBlocks:         []SCTPGapAckBlock{{Start: 2, End: 3}},
+			DuplicateTSNs:        []uint32{5},
+		},
+		&SCTPChunk{
+			Type:  Uint8(0xc0),
+			Flags: Uint8(0x01),
+			Value: []byte{0x11},
+		},
+	}
+	wantSCTPBytes := []byte{
+		// Common header, with the checksum zeroed.
+		0x13, 0x88, 0x17, 0x70, 0x01, 0x02, 0x03, 0x04,
+		0x00, 0x00, 0x00, 0x00,
+		// DATA chunk, padded.
+		0x00, 0x03, 0x00, 0x15, 0x00, 0x00, 0x00, 0x07,
+		0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00, 0x00, 0x00,
+		// SACK chunk.
+		0x03, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x09,
+		0x00, 0x00, 0x04, 0x00, 0x00, 0x01, 0x00, 0x01,
+		0x00, 0x02, 0x00, 0x03, 0x00, 0x00, 0x00, 0x05,
+		// Unrecognized chunk, padded.
+		0xc0, 0x01, 0x00, 0x05, 0x11, 0x00, 0x00, 0x00,
+	}
+	b, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	gotSCTPBytes := append([]byte(nil), b[header.IPv4MinimumSize:]...)
+	gotChecksum := binary.LittleEndian.Uint32(gotSCTPBytes[8:])
+	copy(gotSCTPBytes[8:], []byte{0, 0, 0, 0})
+	if !bytes.Equal(gotSCTPBytes, wantSCTPBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotSCTPBytes, wantSCTPBytes)
+	}
+	if wantChecksum := crc32.Checksum(wantSCTPBytes, crc32.MakeTable(crc32.Castagnoli)); gotChecksum != wantChecksum {
+		t.Errorf("got checksum = %#x, want = %#x", gotChecksum, wantChecksum)
+	}
+	if got, want := header.IPv4(b).Protocol(), uint8(SCTPProtocolNumber); got != want {
+		t.Errorf("got IPv4 protocol = %d, want = %d", got, want)
+	}
+
+	parsed := parse(parseIPv4, b)
+	if !parsed.match(layers) {
+		t.Fatalf("match failed with diff: %s", parsed.diff(layers))
+	}
+	if got, want := *parsed[2].(*SCTPData).Length, uint16(21); got != want {
+		t.Errorf("got DATA chunk length = %d, want = %d", got, want)
+	}
+	if got, want := *parsed[2].(*SCTPData).Flags, uint8(SCTPDataFlagBegin|SCTPDataFlagEnd); got != want {
+		t.Errorf("got DATA chunk flags = %#x, want = %#x", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pcapng block types and constants, as per
+// https://tools.ietf.org/html/draft-tuexen-opsawg-pcapng-02.
+const (
+	pcapngSectionHeaderBlockType        = 0x0a0d0d0a
+	pcapngInterfaceDescriptionBlockType = 0x00000001
+	pcapngEnhancedPacketBlockType       = 0x00000006
+
+	pcapngByteOrderMagic = 0x1a2b3c4d
+	pcapngMajorVersion   = 1
+	pcapngMinorVersion   = 0
+
+	// pcapngLinkTypeEthernet is the LINKTYPE_ETHERNET link type.
+	pcapngLinkTypeEthernet = 1
+)
+
+// capturedFrame is a frame recorded by a capture.
+type capturedFrame struct {
+	timestamp time.Time
+	data      []byte
+	// origLen is the length of the frame on the wire, data may be truncated.
+	origLen int
+}
+
+// capture records the frames seen by a Sniffer so that they can be written
+// out as a pcapng file at the end of a test.
+type capture struct {
+	mu     sync.Mutex
+	frames []capturedFrame
+}
+
+// newCapture returns a capture whose frames are written to PcapDir when t
+// completes, if it failed or PcapAlways is set. It returns nil if PcapDir is
+// unset.
+func newCapture(t *testing.T) *capture {
+	t.Helper()
+
+	if PcapDir == "" {
+		return nil
+	}
+	c := &capture{}
+	t.Cleanup(func() {
+		if !PcapAlways && !t.Failed() {
+			return
+		}
+		name := strings.ReplaceAll(t.Name(), "/", "_")
+		f, err := ioutil.TempFile(PcapDir, name+"-*.pcapng")
+		if err != nil {
+			t.Errorf("failed to create pcapng file for %s: %s", t.Name(), err)
+			return
+		}
+		defer f.Close()
+		if err := c.writeTo(f); err != nil {
+			t.Errorf("failed to write pcapng file %s: %s", f.Name(), err)
+			return
+		}
+		t.Logf("wrote frames seen by the testbench to %s", f.Name())
+	})
+	return c
+}
+
+// record records a frame of n bytes that was read into b, which may be too
+// short to hold all of it. It is a noop if c is nil.
+func (c *capture) record(b []byte, n int) {
+	if c == nil {
+		return
+	}
+	if n < len(b) {
+		b = b[:n]
+	}
+	frame := capturedFrame{
+		timestamp: time.Now(),
+		data:      append([]byte(nil), b...),
+		origLen:   n,
+	}
+	c.mu.Lock()
+	c.frames = append(c.frames, frame)
+	c.mu.Unlock()
+}
+
+// writeTo writes the recorded frames to w in the pcapng format.
+func (c *capture) writeTo(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buf bytes.Buffer
+	// Section Header Block, with an unspecified section length.
+	writePcapngBlock(&buf, pcapngSectionHeaderBlockType, func(b *bytes.Buffer) {
+		binary.Write(b, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+		binary.Write(b, binary.LittleEndian, uint16(pcapngMajorVersion))
+		binary.Write(b, binary.LittleEndian, uint16(pcapngMinorVersion))
+		binary.Write(b, binary.LittleEndian, int64(-1))
+	})
+	// Interface Description Block, with the default microsecond timestamp
+	// resolution and no snapshot length limit.
+	writePcapngBlock(&buf, pcapngInterfaceDescriptionBlockType, func(b *bytes.Buffer) {
+		binary.Write(b, binary.LittleEndian, uint16(pcapngLinkTypeEthernet))
+		binary.Write(b, binary.LittleEndian, uint16(0)) // reserved
+		binary.Write(b, binary.LittleEndian, uint32(0)) // snaplen
+	})
+	for _, frame := range c.frames {
+		writePcapngBlock(&buf, pcapngEnhancedPacketBlockType, func(b *bytes.Buffer) {
+			ts := uint64(frame.timestamp.UnixNano() / int64(time.Microsecond))
+			binary.Write(b, binary.LittleEndian, uint32(0)) // interface ID
+			binary.Write(b, binary.LittleEndian, uint32(ts>>32))
+			binary.Write(b, binary.LittleEndian, uint32(ts))
+			binary.Write(b, binary.LittleEndian, uint32(len(frame.data)))
+			binary.Write(b, binary.LittleEndian, uint32(frame.origLen))
+			b.Write(frame.data)
+		})
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writePcapngBlock appends a pcapng block of the given type to buf, whose body
+// is written by writeBody and padded to 32 bits.
+func writePcapngBlock(buf *bytes.Buffer, blockType uint32, writeBody func(*bytes.Buffer)) {
+	var body bytes.Buffer
+	writeBody(&body)
+	if pad := body.Len() % 4; pad != 0 {
+		body.Write(make([]byte, 4-pad))
+	}
+	// The block type and both total length fields take 12 bytes.
+	totalLength := uint32(body.Len() + 12)
+	binary.Write(buf, binary.LittleEndian, blockType)
+	binary.Write(buf, binary.LittleEndian, totalLength)
+	body.WriteTo(buf)
+	binary.Write(buf, binary.LittleEndian, totalLength)
+}
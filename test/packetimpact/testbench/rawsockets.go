@@ -29,6 +29,10 @@ import (
 // Sniffer can sniff raw packets on the wire.
 type Sniffer struct {
 	fd int
+
+	// capture records the frames read by the Sniffer, it is nil if captures
+	// are disabled.
+	capture *capture
 }
 
 func htons(x uint16) uint16 {
@@ -66,7 +70,8 @@ func (n *DUTTestNet) NewSniffer(t *testing.T) (Sniffer, error) {
 		t.Fatalf("can't setsockopt SO_RCVBUF to 10M: %s", err)
 	}
 	return Sniffer{
-		fd: snifferFd,
+		fd:      snifferFd,
+		capture: newCapture(t),
 	}, nil
 }
 
@@ -111,6 +116,7 @@ func (s *Sniffer) Recv(t *testing.T, timeout time.Duration) []byte {
 		if nread > maxReadSize {
 			t.Fatalf("received a truncated frame of %d bytes, want at most %d bytes", nread, maxReadSize)
 		}
+		s.capture.record(buf, nread)
 		return buf[:nread]
 	}
 }
@@ -130,10 +136,13 @@ func (s *Sniffer) Drain(t *testing.T) {
 	}
 	for {
 		buf := make([]byte, maxReadSize)
-		_, _, err := unix.Recvfrom(s.fd, buf, unix.MSG_TRUNC)
+		nread, _, err := unix.Recvfrom(s.fd, buf, unix.MSG_TRUNC)
 		if err == unix.EINTR || err == unix.EAGAIN || err == unix.EWOULDBLOCK {
 			break
 		}
+		if err == nil {
+			s.capture.record(buf, nread)
+		}
 	}
 	if _, err := unix.FcntlInt(uintptr(s.fd), unix.F_SETFL, flags); err != nil {
 		t.Fatalf("failed to restore sniffer socket fd flags to %b: %s", flags, err)
@@ -142,6 +151,20 @@ func (s *Sniffer) Drain(t *testing.T) {
 
 // close the socket that Sniffer is using.
 func (s *Sniffer) close() error {
+	if s.capture != nil {
+		// Record the frames that were never read.
+		for {
+			buf := make([]byte, maxReadSize)
+			nread, _, err := unix.Recvfrom(s.fd, buf, unix.MSG_TRUNC|unix.MSG_DONTWAIT)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			s.capture.record(buf, nread)
+		}
+	}
 	if err := unix.Close(s.fd); err != nil {
 		return fmt.Errorf("can't close sniffer socket: %w", err)
 	}
@@ -0,0 +1,91 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The testbench asks the test runner to save and restore a DUT by creating a
+// file in DUTControlDir whose name ends with SaveRestoreRequestSuffix and
+// which holds the IP address of the DUT's POSIX server. The test runner
+// answers with a file of the same name but ending with
+// SaveRestoreResponseSuffix, which is empty if the DUT was saved and restored
+// and holds the error otherwise.
+const (
+	SaveRestoreRequestSuffix  = ".save_restore_request"
+	SaveRestoreResponseSuffix = ".save_restore_response"
+)
+
+// SaveRestore saves the DUT to a checkpoint and restores it from there, then
+// reconnects to its POSIX server. Its sockets and network state are expected
+// to survive, so tests can check which of them do. It causes a fatal test
+// failure if the DUT can't be saved and restored, which is only supported for
+// DUTs running gVisor.
+func (dut *DUT) SaveRestore(t *testing.T) {
+	t.Helper()
+
+	if DUTControlDir == "" {
+		t.Fatal("can't save and restore the DUT: --dut_control_dir is unset")
+	}
+	// Write the request to a temporary file first so that the test runner
+	// never sees a partial request.
+	f, err := ioutil.TempFile(DUTControlDir, "request-*.tmp")
+	if err != nil {
+		t.Fatalf("failed to create save/restore request: %s", err)
+	}
+	_, err = f.WriteString(dut.Net.POSIXServerIP.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatalf("failed to write save/restore request %s: %s", f.Name(), err)
+	}
+	base := strings.TrimSuffix(f.Name(), ".tmp")
+	if err := os.Rename(f.Name(), base+SaveRestoreRequestSuffix); err != nil {
+		t.Fatalf("failed to submit save/restore request: %s", err)
+	}
+
+	response := base + SaveRestoreResponseSuffix
+	deadline := time.Now().Add(SaveRestoreTimeout)
+	for {
+		b, err := ioutil.ReadFile(response)
+		if err == nil {
+			os.Remove(response)
+			if len(b) != 0 {
+				t.Fatalf("failed to save and restore the DUT: %s", b)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			t.Fatalf("failed to read save/restore response %s: %s", response, err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for the DUT to be saved and restored", SaveRestoreTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The connection to the POSIX server doesn't survive the restore.
+	dut.TearDownConnection()
+	restored := dut.Net.ConnectToDUT(t)
+	t.Cleanup(restored.TearDownConnection)
+	dut.conn = restored.conn
+	dut.posixServer = restored.posixServer
+}
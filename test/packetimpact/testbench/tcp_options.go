@@ -0,0 +1,194 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// TCP option kinds that the header package doesn't define.
+const (
+	// TCPOptionMD5 is the TCP MD5 Signature option, as per RFC 2385.
+	TCPOptionMD5 = 19
+	// TCPOptionAO is the TCP Authentication Option, as per RFC 5925.
+	TCPOptionAO = 29
+	// TCPOptionExperimental1 and TCPOptionExperimental2 are reserved for
+	// experiments, as per RFC 4727 and RFC 6994.
+	TCPOptionExperimental1 = 253
+	TCPOptionExperimental2 = 254
+)
+
+// tcpOptionHeaderSize is the size of the kind and length of TCP options other
+// than EOL and NOP.
+const tcpOptionHeaderSize = 2
+
+// TCPOption is a TCP option. A list of them is turned into the Options of a
+// TCP layer with EncodeTCPOptions.
+type TCPOption struct {
+	Kind uint8
+	// Length is the value of the length field. If it is nil, the length of
+	// the kind, length and data fields is used. It is ignored for the EOL and
+	// NOP options, which are a single byte.
+	Length *uint8
+	// Data holds the option after its kind and length.
+	Data []byte
+}
+
+// ToBytes returns the option as it is carried in a TCP header.
+func (o TCPOption) ToBytes() []byte {
+	if o.Kind == header.TCPOptionEOL || o.Kind == header.TCPOptionNOP {
+		return []byte{o.Kind}
+	}
+	length := uint8(tcpOptionHeaderSize + len(o.Data))
+	if o.Length != nil {
+		length = *o.Length
+	}
+	return append([]byte{o.Kind, length}, o.Data...)
+}
+
+// EncodeTCPOptions returns the options in the order they are given, to be
+// used as the Options of a TCP layer. The options aren't padded, which the TCP
+// layer does with zeros when the options are sent.
+func EncodeTCPOptions(opts ...TCPOption) []byte {
+	var b []byte
+	for _, o := range opts {
+		b = append(b, o.ToBytes()...)
+	}
+	return b
+}
+
+// ParseTCPOptions parses the Options of a TCP layer. Parsing stops at the EOL
+// option or at the end of b. If an option's length is invalid or runs past
+// the end of b, the options parsed before it are returned with an error.
+func ParseTCPOptions(b []byte) ([]TCPOption, error) {
+	var opts []TCPOption
+	for len(b) > 0 {
+		kind := b[0]
+		switch kind {
+		case header.TCPOptionEOL:
+			return append(opts, TCPOption{Kind: kind}), nil
+		case header.TCPOptionNOP:
+			opts = append(opts, TCPOption{Kind: kind})
+			b = b[1:]
+			continue
+		}
+		if len(b) < tcpOptionHeaderSize {
+			return opts, fmt.Errorf("TCP option of kind %d is missing its length", kind)
+		}
+		length := int(b[1])
+		if length < tcpOptionHeaderSize || length > len(b) {
+			return opts, fmt.Errorf("TCP option of kind %d has length %d, want between %d and %d", kind, length, tcpOptionHeaderSize, len(b))
+		}
+		opts = append(opts, TCPOption{
+			Kind:   kind,
+			Length: Uint8(uint8(length)),
+			Data:   b[tcpOptionHeaderSize:length],
+		})
+		b = b[length:]
+	}
+	return opts, nil
+}
+
+// FindTCPOption returns the first option of the given kind in the Options of
+// a TCP layer, and whether there was one. Options that follow a malformed one
+// aren't found.
+func FindTCPOption(b []byte, kind uint8) (TCPOption, bool) {
+	opts, _ := ParseTCPOptions(b)
+	for _, o := range opts {
+		if o.Kind == kind {
+			return o, true
+		}
+	}
+	return TCPOption{}, false
+}
+
+// TCPEOLOption returns an End of Option List option.
+func TCPEOLOption() TCPOption {
+	return TCPOption{Kind: header.TCPOptionEOL}
+}
+
+// TCPNOPOption returns a No-Operation option.
+func TCPNOPOption() TCPOption {
+	return TCPOption{Kind: header.TCPOptionNOP}
+}
+
+// TCPMSSOption returns a Maximum Segment Size option.
+func TCPMSSOption(mss uint16) TCPOption {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, mss)
+	return TCPOption{Kind: header.TCPOptionMSS, Data: data}
+}
+
+// TCPWindowScaleOption returns a Window Scale option.
+func TCPWindowScaleOption(shift uint8) TCPOption {
+	return TCPOption{Kind: header.TCPOptionWS, Data: []byte{shift}}
+}
+
+// TCPSACKPermittedOption returns a SACK-Permitted option.
+func TCPSACKPermittedOption() TCPOption {
+	return TCPOption{Kind: header.TCPOptionSACKPermitted}
+}
+
+// TCPSACKOption returns a SACK option holding blocks.
+func TCPSACKOption(blocks []header.SACKBlock) TCPOption {
+	data := make([]byte, 0, 8*len(blocks))
+	for _, block := range blocks {
+		data = appendUint32(data, uint32(block.Start))
+		data = appendUint32(data, uint32(block.End))
+	}
+	return TCPOption{Kind: header.TCPOptionSACK, Data: data}
+}
+
+// TCPTimestampOption returns a Timestamps option.
+func TCPTimestampOption(tsVal, tsEcr uint32) TCPOption {
+	data := make([]byte, 0, 8)
+	data = appendUint32(data, tsVal)
+	data = appendUint32(data, tsEcr)
+	return TCPOption{Kind: header.TCPOptionTS, Data: data}
+}
+
+// TCPMD5Option returns an MD5 Signature option holding digest, which is 16
+// bytes long in a well-formed option.
+func TCPMD5Option(digest []byte) TCPOption {
+	return TCPOption{Kind: TCPOptionMD5, Data: digest}
+}
+
+// TCPAOOption returns a TCP Authentication Option with the given KeyID,
+// RNextKeyID and MAC.
+func TCPAOOption(keyID, rNextKeyID uint8, mac []byte) TCPOption {
+	data := make([]byte, 0, 2+len(mac))
+	data = append(data, keyID, rNextKeyID)
+	data = append(data, mac...)
+	return TCPOption{Kind: TCPOptionAO, Data: data}
+}
+
+// TCPExperimentalOption returns an experimental option of kind
+// TCPOptionExperimental1 or TCPOptionExperimental2, identified by the 16-bit
+// ExID as per RFC 6994 and followed by data.
+func TCPExperimentalOption(kind uint8, exID uint16, data []byte) TCPOption {
+	b := make([]byte, 2, 2+len(data))
+	binary.BigEndian.PutUint16(b, exID)
+	return TCPOption{Kind: kind, Data: append(b, data...)}
+}
+
+// appendUint32 appends v to b in network byte order.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
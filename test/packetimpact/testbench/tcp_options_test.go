@@ -0,0 +1,139 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbench
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestTCPOptionBuilders(t *testing.T) {
+	digest := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+		0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+	}
+	for _, tt := range []struct {
+		description string
+		opt         TCPOption
+		want        []byte
+	}{
+		{
+			description: "NOP",
+			opt:         TCPNOPOption(),
+			want:        []byte{1},
+		},
+		{
+			description: "MSS",
+			opt:         TCPMSSOption(1460),
+			want:        []byte{2, 4, 0x05, 0xb4},
+		},
+		{
+			description: "Window Scale",
+			opt:         TCPWindowScaleOption(7),
+			want:        []byte{3, 3, 7},
+		},
+		{
+			description: "SACK-Permitted",
+			opt:         TCPSACKPermittedOption(),
+			want:        []byte{4, 2},
+		},
+		{
+			description: "SACK",
+			opt:         TCPSACKOption([]header.SACKBlock{{Start: 1, End: 2}}),
+			want:        []byte{5, 10, 0, 0, 0, 1, 0, 0, 0, 2},
+		},
+		{
+			description: "Timestamps",
+			opt:         TCPTimestampOption(0x01020304, 0x05060708),
+			want:        []byte{8, 10, 1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			description: "MD5 Signature",
+			opt:         TCPMD5Option(digest),
+			want:        append([]byte{19, 18}, digest...),
+		},
+		{
+			description: "Authentication",
+			opt:         TCPAOOption(1, 2, digest[:12]),
+			want:        append([]byte{29, 16, 1, 2}, digest[:12]...),
+		},
+		{
+			description: "experimental",
+			opt:         TCPExperimentalOption(TCPOptionExperimental1, 0xf989, []byte{0xaa}),
+			want:        []byte{253, 5, 0xf9, 0x89, 0xaa},
+		},
+		{
+			description: "overridden length",
+			opt:         TCPOption{Kind: TCPOptionExperimental2, Length: Uint8(40), Data: []byte{0xaa}},
+			want:        []byte{254, 40, 0xaa},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := tt.opt.ToBytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("got %s.ToBytes() = %x, want = %x", tt.description, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTCPOptions(t *testing.T) {
+	options := EncodeTCPOptions(
+		TCPMSSOption(1460),
+		TCPNOPOption(),
+		TCPMD5Option(make([]byte, 16)),
+		TCPExperimentalOption(TCPOptionExperimental2, 0x1234, nil),
+	)
+	// Without a network layer, the checksum can't be computed.
+	tcp := TCP{Options: options, Checksum: Uint16(0)}
+	b, err := tcp.ToBytes()
+	if err != nil {
+		t.Fatalf("TCP.ToBytes() failed: %s", err)
+	}
+	parsed, _ := parseTCP(b)
+	got, err := ParseTCPOptions(parsed.(*TCP).Options)
+	if err != nil {
+		t.Fatalf("ParseTCPOptions(%x) failed: %s", parsed.(*TCP).Options, err)
+	}
+	want := []TCPOption{
+		{Kind: header.TCPOptionMSS, Length: Uint8(4), Data: []byte{0x05, 0xb4}},
+		{Kind: header.TCPOptionNOP},
+		{Kind: TCPOptionMD5, Length: Uint8(18), Data: make([]byte, 16)},
+		{Kind: TCPOptionExperimental2, Length: Uint8(4), Data: []byte{0x12, 0x34}},
+		// The padding added by the TCP layer.
+		{Kind: header.TCPOptionEOL},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("options mismatch (-want +got):\n%s", diff)
+	}
+
+	if o, ok := FindTCPOption(options, TCPOptionMD5); !ok || !bytes.Equal(o.Data, make([]byte, 16)) {
+		t.Errorf("got FindTCPOption(_, %d) = (%+v, %t), want an MD5 Signature option", TCPOptionMD5, o, ok)
+	}
+	if o, ok := FindTCPOption(options, TCPOptionAO); ok {
+		t.Errorf("got FindTCPOption(_, %d) = (%+v, true), want no option", TCPOptionAO, o)
+	}
+
+	malformed := EncodeTCPOptions(TCPNOPOption(), TCPOption{Kind: TCPOptionMD5, Length: Uint8(30)})
+	got, err = ParseTCPOptions(malformed)
+	if err == nil {
+		t.Errorf("got ParseTCPOptions(%x) = (%+v, nil), want an error", malformed, got)
+	}
+	if diff := cmp.Diff([]TCPOption{{Kind: header.TCPOptionNOP}}, got); diff != "" {
+		t.Errorf("options parsed before the malformed one mismatch (-want +got):\n%s", diff)
+	}
+}
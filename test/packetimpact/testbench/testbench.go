@@ -33,6 +33,20 @@ var (
 	RPCKeepalive = 10 * time.Second
 	// RPCTimeout is the gRPC timeout.
 	RPCTimeout = 100 * time.Millisecond
+	// PcapDir is the directory in which a pcapng file holding the frames seen
+	// by each Sniffer is written at the end of a test. No file is written if
+	// it is empty.
+	PcapDir = ""
+	// PcapAlways indicates that pcapng files are written for all tests, not
+	// only for the failing ones.
+	PcapAlways = false
+	// DUTControlDir is the directory through which the testbench asks the
+	// test runner to save and restore DUTs. Saving and restoring DUTs isn't
+	// supported if it is empty.
+	DUTControlDir = ""
+	// SaveRestoreTimeout is how long to wait for a DUT to be saved and
+	// restored.
+	SaveRestoreTimeout = time.Minute
 
 	// dutTestNetsJSON is the json string that describes all the test networks to
 	// duts available to use.
@@ -77,6 +91,15 @@ type DUTTestNet struct {
 	// POSIXServerPort is the UDP port the POSIX server is bound to on the
 	// control network.
 	POSIXServerPort uint16
+
+	// ExtraNets are the other test networks attached to the same DUT, for
+	// tests that need the DUT to have more than one interface. They don't
+	// have ExtraNets of their own.
+	ExtraNets []*DUTTestNet `json:",omitempty"`
+
+	// vlanIDs are the IDs of the VLAN tags that connections created on the
+	// test network put on their frames, outermost first.
+	vlanIDs []uint16
 }
 
 // registerFlags defines flags and associates them with the package-level
@@ -87,6 +110,10 @@ func registerFlags(fs *flag.FlagSet) {
 	fs.DurationVar(&RPCTimeout, "rpc_timeout", RPCTimeout, "gRPC timeout")
 	fs.DurationVar(&RPCKeepalive, "rpc_keepalive", RPCKeepalive, "gRPC keepalive")
 	fs.StringVar(&dutTestNetsJSON, "dut_test_nets_json", dutTestNetsJSON, "path to the dut test nets json file")
+	fs.StringVar(&PcapDir, "pcap_dir", PcapDir, "directory to write a pcapng file of the frames seen by each test to")
+	fs.BoolVar(&PcapAlways, "pcap_always", PcapAlways, "write pcapng files for passing tests too, not only for failing ones")
+	fs.StringVar(&DUTControlDir, "dut_control_dir", DUTControlDir, "directory through which to ask the test runner to save and restore DUTs")
+	fs.DurationVar(&SaveRestoreTimeout, "save_restore_timeout", SaveRestoreTimeout, "how long to wait for a DUT to be saved and restored")
 }
 
 // Initialize initializes the testbench, it parse the flags and sets up the
@@ -112,8 +139,10 @@ func loadDUTTestNets() error {
 	// Using a buffered channel as semaphore
 	dutTestNets = make(chan *DUTTestNet, len(parsedTestNets))
 	for i := range parsedTestNets {
-		parsedTestNets[i].LocalIPv4 = parsedTestNets[i].LocalIPv4.To4()
-		parsedTestNets[i].RemoteIPv4 = parsedTestNets[i].RemoteIPv4.To4()
+		for _, n := range append([]*DUTTestNet{&parsedTestNets[i]}, parsedTestNets[i].ExtraNets...) {
+			n.LocalIPv4 = n.LocalIPv4.To4()
+			n.RemoteIPv4 = n.RemoteIPv4.To4()
+		}
 		dutTestNets <- &parsedTestNets[i]
 	}
 	return nil
@@ -139,5 +168,18 @@ func GetDUTTestNet() *DUTTestNet {
 // Release releases the DUTTestNet back to the pool so that some other test
 // can use.
 func (n *DUTTestNet) Release() {
+	n.vlanIDs = nil
+	for _, extra := range n.ExtraNets {
+		extra.vlanIDs = nil
+	}
 	dutTestNets <- n
 }
+
+// SetVLANIDs makes the connections subsequently created on the test network
+// tag all their frames with VLAN tags holding the given VLAN IDs, outermost
+// first, and only accept frames carrying the same tags. With more than one ID,
+// the outer tags are 802.1ad service tags and the innermost one is an 802.1Q
+// customer tag. Calling it without IDs disables tagging.
+func (n *DUTTestNet) SetVLANIDs(vids ...uint16) {
+	n.vlanIDs = append([]uint16(nil), vids...)
+}
@@ -12,16 +12,27 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
+#include <linux/if_link.h>
+#include <linux/netlink.h>
+#include <linux/rtnetlink.h>
+#include <linux/veth.h>
 #include <net/if.h>
 #include <sched.h>
 #include <sys/ioctl.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 
+#include <string>
+
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_route_util.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
 #include "test/syscalls/linux/socket_test_util.h"
 #include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -30,6 +41,99 @@ namespace gvisor {
 namespace testing {
 namespace {
 
+constexpr uint32_t kSeq = 12345;
+constexpr char kNetNSPath[] = "/proc/thread-self/ns/net";
+
+// Appends an attribute of type type holding len bytes of data to the message
+// hdr, and returns it. The attribute can be nested by appending the nested
+// attributes right after, then calling EndNestedAttr.
+struct rtattr* AddAttr(struct nlmsghdr* hdr, int type, const void* data,
+                       int len) {
+  struct rtattr* rta = reinterpret_cast<struct rtattr*>(
+      reinterpret_cast<char*>(hdr) + NLMSG_ALIGN(hdr->nlmsg_len));
+  rta->rta_type = type;
+  rta->rta_len = RTA_LENGTH(len);
+  if (len > 0) {
+    memcpy(RTA_DATA(rta), data, len);
+  }
+  hdr->nlmsg_len = NLMSG_ALIGN(hdr->nlmsg_len) + RTA_ALIGN(rta->rta_len);
+  return rta;
+}
+
+// Sets the length of the nested attribute nest to include the attributes
+// appended to hdr since.
+void EndNestedAttr(struct nlmsghdr* hdr, struct rtattr* nest) {
+  nest->rta_len = reinterpret_cast<char*>(hdr) + hdr->nlmsg_len -
+                  reinterpret_cast<char*>(nest);
+}
+
+// Creates the veth pair name and peer_name, the latter in the network
+// namespace peer_ns_fd.
+PosixError AddVeth(const std::string& name, const std::string& peer_name,
+                   int peer_ns_fd) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd, NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct ifinfomsg ifm;
+    char attrbuf[512];
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(req.ifm));
+  req.hdr.nlmsg_type = RTM_NEWLINK;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | NLM_F_CREATE | NLM_F_EXCL;
+  req.hdr.nlmsg_seq = kSeq;
+  req.ifm.ifi_family = AF_UNSPEC;
+  AddAttr(&req.hdr, IFLA_IFNAME, name.c_str(), name.size() + 1);
+  struct rtattr* linkinfo = AddAttr(&req.hdr, IFLA_LINKINFO, nullptr, 0);
+  AddAttr(&req.hdr, IFLA_INFO_KIND, "veth", sizeof("veth"));
+  struct rtattr* data = AddAttr(&req.hdr, IFLA_INFO_DATA, nullptr, 0);
+  struct ifinfomsg peer_ifm = {};
+  struct rtattr* peer =
+      AddAttr(&req.hdr, VETH_INFO_PEER, &peer_ifm, sizeof(peer_ifm));
+  AddAttr(&req.hdr, IFLA_IFNAME, peer_name.c_str(), peer_name.size() + 1);
+  AddAttr(&req.hdr, IFLA_NET_NS_FD, &peer_ns_fd, sizeof(peer_ns_fd));
+  EndNestedAttr(&req.hdr, peer);
+  EndNestedAttr(&req.hdr, data);
+  EndNestedAttr(&req.hdr, linkinfo);
+
+  return NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len);
+}
+
+// Removes the interface name.
+PosixError DelLink(const std::string& name) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd, NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct ifinfomsg ifm;
+    char attrbuf[64];
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(req.ifm));
+  req.hdr.nlmsg_type = RTM_DELLINK;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK;
+  req.hdr.nlmsg_seq = kSeq;
+  req.ifm.ifi_family = AF_UNSPEC;
+  AddAttr(&req.hdr, IFLA_IFNAME, name.c_str(), name.size() + 1);
+
+  return NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len);
+}
+
+// Returns whether the network namespace of the calling thread has an
+// interface named name.
+PosixErrorOr<bool> HaveLink(const std::string& name) {
+  ASSIGN_OR_RETURN_ERRNO(auto links, DumpLinks());
+  for (const auto& link : links) {
+    if (link.name == name) {
+      return true;
+    }
+  }
+  return false;
+}
+
 TEST(NetworkNamespaceTest, LoopbackExists) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
 
@@ -47,6 +151,110 @@ TEST(NetworkNamespaceTest, LoopbackExists) {
   });
 }
 
+TEST(NetworkNamespaceTest, SetnsSwitchesNamespace) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  ScopedThread t([&] {
+    const FileDescriptor orig_fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+    const std::string orig_ns = ASSERT_NO_ERRNO_AND_VALUE(ReadLink(kNetNSPath));
+
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceeds());
+    EXPECT_NE(ASSERT_NO_ERRNO_AND_VALUE(ReadLink(kNetNSPath)), orig_ns);
+
+    ASSERT_THAT(setns(orig_fd.get(), CLONE_NEWNET), SyscallSucceeds());
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadLink(kNetNSPath)), orig_ns);
+  });
+}
+
+TEST(NetworkNamespaceTest, SetnsAnyType) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  ScopedThread t([&] {
+    const FileDescriptor orig_fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+    const std::string orig_ns = ASSERT_NO_ERRNO_AND_VALUE(ReadLink(kNetNSPath));
+
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceeds());
+
+    // A zero nstype allows joining any kind of namespace.
+    ASSERT_THAT(setns(orig_fd.get(), 0), SyscallSucceeds());
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadLink(kNetNSPath)), orig_ns);
+  });
+}
+
+TEST(NetworkNamespaceTest, SetnsWrongType) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+  EXPECT_THAT(setns(fd.get(), CLONE_NEWUTS), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(NetworkNamespaceTest, SetnsNotNamespace) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  EXPECT_THAT(setns(fd.get(), CLONE_NEWNET), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(NetworkNamespaceTest, SetnsBadFD) {
+  EXPECT_THAT(setns(-1, CLONE_NEWNET), SyscallFailsWithErrno(EBADF));
+}
+
+TEST(NetworkNamespaceTest, SetnsWithoutCapability) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  ScopedThread t([&] {
+    const FileDescriptor fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+
+    // Capabilities are per thread, so this only affects this thread.
+    ASSERT_NO_ERRNO(SetCapability(CAP_SYS_ADMIN, false));
+    EXPECT_THAT(setns(fd.get(), CLONE_NEWNET), SyscallFailsWithErrno(EPERM));
+  });
+}
+
+TEST(NetworkNamespaceTest, VethAcrossNamespaces) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  ScopedThread t([&] {
+    // Use two new namespaces, leaving the one of the test untouched.
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceeds());
+    const FileDescriptor peer_ns_fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceeds());
+    const FileDescriptor ns_fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(kNetNSPath, O_RDONLY));
+
+    ASSERT_NO_ERRNO(AddVeth("veth-test0", "veth-test1", peer_ns_fd.get()));
+    EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test0")));
+    EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test1")));
+
+    // The same interface can't be created twice.
+    EXPECT_THAT(AddVeth("veth-test0", "veth-test2", peer_ns_fd.get()),
+                PosixErrorIs(EEXIST, ::testing::_));
+
+    ASSERT_THAT(setns(peer_ns_fd.get(), CLONE_NEWNET), SyscallSucceeds());
+    EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test0")));
+    EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test1")));
+
+    // Removing an end of the pair removes the other.
+    ASSERT_NO_ERRNO(DelLink("veth-test1"));
+    EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test1")));
+    ASSERT_THAT(setns(ns_fd.get(), CLONE_NEWNET), SyscallSucceeds());
+    EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(HaveLink("veth-test0")));
+  });
+}
+
+TEST(NetworkNamespaceTest, DelLinkNotFound) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  ScopedThread t([&] {
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceeds());
+    EXPECT_THAT(DelLink("veth-test0"), PosixErrorIs(ENODEV, ::testing::_));
+  });
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -19,11 +19,16 @@
 #include <sys/types.h>
 #include <unistd.h>
 
+#include <string>
 #include <vector>
 
 #include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
 #include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
 #include "test/util/save_util.h"
 #include "test/util/test_util.h"
 
@@ -85,6 +90,41 @@ TEST_F(PingSocket, ICMPPortExhaustion_NoRandomSave) {
   }
 }
 
+constexpr char kPingGroupRange[] = "/proc/sys/net/ipv4/ping_group_range";
+
+// SetPingGroupRange sets ping_group_range to [low, high], and returns a Cleanup
+// restoring its previous value.
+PosixErrorOr<Cleanup> SetPingGroupRange(gid_t low, gid_t high) {
+  ASSIGN_OR_RETURN_ERRNO(std::string old, GetContents(kPingGroupRange));
+  RETURN_IF_ERRNO(SetContents(kPingGroupRange, absl::StrCat(low, " ", high)));
+  return Cleanup(
+      [old] { EXPECT_NO_ERRNO(SetContents(kPingGroupRange, old)); });
+}
+
+TEST(PingGroupRangeTest, GroupOutsideRangeIsDenied) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_OVERRIDE)));
+
+  // An empty range denies every group, whatever the capabilities of the
+  // caller.
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(SetPingGroupRange(1, 0));
+  EXPECT_THAT(socket(AF_INET, SOCK_DGRAM, IPPROTO_ICMP),
+              SyscallFailsWithErrno(EACCES));
+  EXPECT_THAT(socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6),
+              SyscallFailsWithErrno(EACCES));
+
+  // Other datagram sockets aren't affected.
+  EXPECT_NO_ERRNO(Socket(AF_INET, SOCK_DGRAM, IPPROTO_UDP));
+}
+
+TEST(PingGroupRangeTest, GroupInsideRangeIsAllowed) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_OVERRIDE)));
+
+  const gid_t gid = getegid();
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(SetPingGroupRange(gid, gid));
+  EXPECT_NO_ERRNO(Socket(AF_INET, SOCK_DGRAM, IPPROTO_ICMP));
+  EXPECT_NO_ERRNO(Socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -17,6 +17,7 @@
 #include <netinet/in.h>
 #include <poll.h>
 #include <sys/socket.h>
+#include <sys/stat.h>
 #include <sys/syscall.h>
 #include <sys/types.h>
 
@@ -27,9 +28,11 @@
 #include "absl/strings/str_cat.h"
 #include "absl/strings/str_split.h"
 #include "absl/strings/string_view.h"
+#include "absl/strings/strip.h"
 #include "absl/time/clock.h"
 #include "test/syscalls/linux/socket_test_util.h"
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/test_util.h"
@@ -556,6 +559,213 @@ TEST(ProcSysNetIpv4IpForward, CanReadAndWrite) {
   EXPECT_EQ(buf, to_write);
 }
 
+// GetSetting returns the contents of the setting file path, without the
+// trailing newline.
+PosixErrorOr<std::string> GetSetting(absl::string_view path) {
+  ASSIGN_OR_RETURN_ERRNO(std::string contents, GetContents(path));
+  return std::string(absl::StripSuffix(contents, "\n"));
+}
+
+// RestoreSetting returns a Cleanup writing the current value of the setting
+// file path back to it.
+PosixErrorOr<Cleanup> RestoreSetting(absl::string_view path) {
+  ASSIGN_OR_RETURN_ERRNO(std::string value, GetSetting(path));
+  return Cleanup([path = std::string(path), value] {
+    EXPECT_NO_ERRNO(SetContents(path, value));
+  });
+}
+
+TEST(ProcSysNetIpv4CongestionControl, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  constexpr char kCongestionControl[] =
+      "/proc/sys/net/ipv4/tcp_congestion_control";
+  std::string const available = ASSERT_NO_ERRNO_AND_VALUE(
+      GetSetting("/proc/sys/net/ipv4/tcp_available_congestion_control"));
+  auto restore =
+      ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(kCongestionControl));
+
+  // Every available algorithm can be selected.
+  for (absl::string_view cc : absl::StrSplit(available, ' ')) {
+    ASSERT_NO_ERRNO(SetContents(kCongestionControl, cc));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kCongestionControl)), cc);
+  }
+
+  // Unknown algorithms are refused.
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kCongestionControl, O_WRONLY));
+  constexpr char kUnknown[] = "unknown";
+  EXPECT_THAT(PwriteFd(fd.get(), kUnknown, strlen(kUnknown), 0),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(ProcSysNetIpv4PingGroupRange, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  constexpr char kPingGroupRange[] = "/proc/sys/net/ipv4/ping_group_range";
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(kPingGroupRange));
+
+  ASSERT_NO_ERRNO(SetContents(kPingGroupRange, "100 200"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kPingGroupRange)),
+            "100\t200");
+
+  // An empty range is reported as 1 to 0.
+  ASSERT_NO_ERRNO(SetContents(kPingGroupRange, "200 100"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kPingGroupRange)), "1\t0");
+
+  // Negative groups are refused.
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kPingGroupRange, O_WRONLY));
+  constexpr char kNegative[] = "-1 100";
+  EXPECT_THAT(PwriteFd(fd.get(), kNegative, strlen(kNegative), 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kPingGroupRange)), "1\t0");
+}
+
+TEST(ProcSysNetCore, SocketBufferSizes) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  for (auto const& name :
+       {"rmem_default", "rmem_max", "wmem_default", "wmem_max"}) {
+    SCOPED_TRACE(name);
+    std::string const path = absl::StrCat("/proc/sys/net/core/", name);
+    auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(path));
+
+    ASSERT_NO_ERRNO(SetContents(path, "425984"));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "425984");
+
+    auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_WRONLY));
+    constexpr char kZero[] = "0";
+    EXPECT_THAT(PwriteFd(fd.get(), kZero, strlen(kZero), 0),
+                SyscallFailsWithErrno(EINVAL));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "425984");
+  }
+}
+
+TEST(ProcSysNetCore, SoMaxConn) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  constexpr char kSoMaxConn[] = "/proc/sys/net/core/somaxconn";
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(kSoMaxConn));
+
+  ASSERT_NO_ERRNO(SetContents(kSoMaxConn, "4096"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kSoMaxConn)), "4096");
+}
+
+TEST(ProcSysNetIpv6ConfForwarding, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  constexpr char kForwarding[] = "/proc/sys/net/ipv6/conf/all/forwarding";
+  // IPv6 may not be supported.
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kForwarding)));
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(kForwarding));
+
+  for (auto const& value : {"1", "0"}) {
+    ASSERT_NO_ERRNO(SetContents(kForwarding, value));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kForwarding)), value);
+  }
+}
+
+constexpr char kIpv6ConfLo[] = "/proc/sys/net/ipv6/conf/lo";
+
+TEST(ProcSysNetIpv6ConfInterface, NeighborDiscoverySettings) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  for (auto const& name :
+       {"accept_ra", "autoconf", "dad_transmits", "use_tempaddr"}) {
+    SCOPED_TRACE(name);
+    std::string const path = JoinPath(kIpv6ConfLo, name);
+    auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(path));
+
+    for (auto const& value : {"1", "0"}) {
+      ASSERT_NO_ERRNO(SetContents(path, value));
+      EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), value);
+    }
+  }
+}
+
+TEST(ProcSysNetIpv6ConfInterface, BooleanSettingsReadBackAsOne) {
+  // Linux stores these settings as integers.
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  for (auto const& name : {"accept_ra", "autoconf", "use_tempaddr"}) {
+    SCOPED_TRACE(name);
+    std::string const path = JoinPath(kIpv6ConfLo, name);
+    auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(path));
+
+    ASSERT_NO_ERRNO(SetContents(path, "2"));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "1");
+    ASSERT_NO_ERRNO(SetContents(path, "-1"));
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "0");
+  }
+}
+
+TEST(ProcSysNetIpv6ConfInterface, NegativeDADTransmits) {
+  // Linux accepts any integer.
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(kIpv6ConfLo, "dad_transmits"), O_WRONLY));
+  constexpr char kNegative[] = "-1";
+  EXPECT_THAT(PwriteFd(fd.get(), kNegative, strlen(kNegative), 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(ProcSysNetIpv6ConfInterface, MTU) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  std::string const mtu =
+      ASSERT_NO_ERRNO_AND_VALUE(GetSetting(JoinPath(kIpv6ConfLo, "mtu")));
+  int value;
+  ASSERT_TRUE(absl::SimpleAtoi(mtu, &value)) << mtu;
+  EXPECT_GT(value, 0);
+}
+
+TEST(ProcSysNetIpv6ConfInterface, SetMTU) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  std::string const path = JoinPath(kIpv6ConfLo, "mtu");
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(path));
+
+  // The minimum MTU of IPv6 is 1280.
+  ASSERT_NO_ERRNO(SetContents(path, "1280"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "1280");
+
+  // The MTU can neither be below the minimum nor above the MTU of the link.
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_WRONLY));
+  for (auto const& value : {"1279", "2147483647"}) {
+    SCOPED_TRACE(value);
+    EXPECT_THAT(PwriteFd(fd.get(), value, strlen(value), 0),
+                SyscallFailsWithErrno(EINVAL));
+  }
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "1280");
+}
+
+TEST(ProcSysNetIpv6ConfInterface, HopLimit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(Exists(kIpv6ConfLo)));
+
+  constexpr char kHopLimit[] = "/proc/sys/net/ipv6/conf/all/hop_limit";
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(RestoreSetting(kHopLimit));
+
+  ASSERT_NO_ERRNO(SetContents(kHopLimit, "32"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(kHopLimit)), "32");
+
+  // Netstack doesn't support per interface hop limits, so the file of each
+  // interface shows the global setting.
+  SKIP_IF(!IsRunningOnGvisor());
+  std::string const path = JoinPath(kIpv6ConfLo, "hop_limit");
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetSetting(path)), "32");
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0444);
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <linux/capability.h>
+#include <netinet/icmp6.h>
 #include <netinet/in.h>
 #include <netinet/ip.h>
 #include <netinet/ip_icmp.h>
@@ -22,6 +23,7 @@
 
 #include <algorithm>
 #include <cstdint>
+#include <cstring>
 
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/socket_test_util.h"
@@ -38,6 +40,10 @@ namespace {
 // The size of an empty ICMP packet and IP header together.
 constexpr size_t kEmptyICMPSize = 28;
 
+// ICMP_FILTER from linux/icmp.h, which can't be included along with
+// netinet/ip_icmp.h. The filter itself is a 32-bit mask of ICMP types.
+constexpr int kICMPFilter = 1;
+
 // ICMP raw sockets get their own special tests because Linux automatically
 // responds to ICMP echo requests, and thus a single echo request sent via
 // loopback leads to 2 received ICMP packets.
@@ -451,6 +457,222 @@ TEST_F(RawSocketICMPTest, GetSocketAcceptConn) {
   EXPECT_EQ(got, 0);
 }
 
+TEST_F(RawSocketICMPTest, ICMPFilterGetSet) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  // Every type passes by default.
+  uint32_t got = ~0u;
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(s_, SOL_RAW, kICMPFilter, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(got, 0u);
+
+  const uint32_t filter = 1 << ICMP_ECHO;
+  ASSERT_THAT(setsockopt(s_, SOL_RAW, kICMPFilter, &filter, sizeof(filter)),
+              SyscallSucceeds());
+  ASSERT_THAT(getsockopt(s_, SOL_RAW, kICMPFilter, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(got, filter);
+}
+
+TEST_F(RawSocketICMPTest, ICMPFilterShortOptlen) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  const uint32_t filter = ~0u;
+  ASSERT_THAT(setsockopt(s_, SOL_RAW, kICMPFilter, &filter, sizeof(filter)),
+              SyscallSucceeds());
+
+  // Shorter values only replace the start of the filter.
+  const uint8_t start = 0;
+  ASSERT_THAT(setsockopt(s_, SOL_RAW, kICMPFilter, &start, sizeof(start)),
+              SyscallSucceeds());
+  uint32_t want = filter;
+  memcpy(&want, &start, sizeof(start));
+  uint32_t got = 0;
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(s_, SOL_RAW, kICMPFilter, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(got, want);
+
+  // Shorter buffers get the start of the filter.
+  uint16_t got_start = 0;
+  len = sizeof(got_start);
+  ASSERT_THAT(getsockopt(s_, SOL_RAW, kICMPFilter, &got_start, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got_start));
+  EXPECT_EQ(memcmp(&got_start, &want, sizeof(got_start)), 0);
+}
+
+// Only packets of the types let through by the filter are received.
+TEST_F(RawSocketICMPTest, ICMPFilterDropsFilteredTypes) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  const uint32_t filter = 1 << ICMP_ECHO;
+  ASSERT_THAT(setsockopt(s_, SOL_RAW, kICMPFilter, &filter, sizeof(filter)),
+              SyscallSucceeds());
+
+  struct icmphdr icmp;
+  icmp.type = ICMP_ECHO;
+  icmp.code = 0;
+  icmp.checksum = 0;
+  icmp.un.echo.sequence = 2012;
+  icmp.un.echo.id = 2014;
+  icmp.checksum = ICMPChecksum(icmp, NULL, 0);
+  ASSERT_NO_FATAL_FAILURE(SendEmptyICMP(icmp));
+
+  char recv_buf[kEmptyICMPSize];
+  struct sockaddr_in src;
+  ASSERT_NO_FATAL_FAILURE(
+      ReceiveICMP(recv_buf, sizeof(recv_buf), sizeof(struct icmphdr), &src));
+  struct icmphdr* recvd_icmp =
+      reinterpret_cast<struct icmphdr*>(recv_buf + sizeof(struct iphdr));
+  EXPECT_EQ(recvd_icmp->type, ICMP_ECHOREPLY);
+
+  // The request is handled before the reply is sent, so it would have been
+  // received by now.
+  EXPECT_THAT(RetryEINTR(recv)(s_, recv_buf, sizeof(recv_buf), MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST(RawSocketICMPFilterTest, ICMPFilterNotSupportedOnOtherProtocols) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_RAW, IPPROTO_UDP));
+  uint32_t filter = 0;
+  socklen_t len = sizeof(filter);
+  EXPECT_THAT(setsockopt(s.get(), SOL_RAW, kICMPFilter, &filter, len),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+  EXPECT_THAT(getsockopt(s.get(), SOL_RAW, kICMPFilter, &filter, &len),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST(RawSocketICMPFilterTest, ICMPv6FilterGetSet) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET6, SOCK_RAW, IPPROTO_ICMPV6));
+
+  // Every type passes by default.
+  struct icmp6_filter got;
+  ICMP6_FILTER_SETBLOCKALL(&got);
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  for (int type = 0; type < 256; type++) {
+    EXPECT_TRUE(ICMP6_FILTER_WILLPASS(type, &got)) << "type " << type;
+  }
+
+  struct icmp6_filter filter;
+  ICMP6_FILTER_SETPASSALL(&filter);
+  ICMP6_FILTER_SETBLOCK(ICMP6_ECHO_REQUEST, &filter);
+  ASSERT_THAT(setsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &filter,
+                         sizeof(filter)),
+              SyscallSucceeds());
+  ASSERT_THAT(getsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(memcmp(&got, &filter, sizeof(got)), 0);
+}
+
+TEST(RawSocketICMPFilterTest, ICMPv6FilterShortOptlen) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET6, SOCK_RAW, IPPROTO_ICMPV6));
+  struct icmp6_filter filter;
+  ICMP6_FILTER_SETPASSALL(&filter);
+  ICMP6_FILTER_SETBLOCK(ICMP6_ECHO_REQUEST, &filter);
+  ASSERT_THAT(setsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &filter,
+                         sizeof(filter)),
+              SyscallSucceeds());
+
+  // Shorter values only replace the start of the filter, here the types
+  // below 32.
+  const uint32_t start = ~0u;
+  ASSERT_THAT(
+      setsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &start, sizeof(start)),
+      SyscallSucceeds());
+  struct icmp6_filter got;
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  for (int type = 0; type < 32; type++) {
+    EXPECT_TRUE(ICMP6_FILTER_WILLBLOCK(type, &got)) << "type " << type;
+  }
+  EXPECT_TRUE(ICMP6_FILTER_WILLBLOCK(ICMP6_ECHO_REQUEST, &got));
+  EXPECT_TRUE(ICMP6_FILTER_WILLPASS(ICMP6_ECHO_REPLY, &got));
+
+  // Shorter buffers get the start of the filter.
+  uint32_t got_start = 0;
+  len = sizeof(got_start);
+  ASSERT_THAT(
+      getsockopt(s.get(), SOL_ICMPV6, ICMP6_FILTER, &got_start, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got_start));
+  EXPECT_EQ(got_start, start);
+}
+
+// Only packets of the types let through by the filter are received.
+TEST(RawSocketICMPFilterTest, ICMPv6FilterDropsFilteredTypes) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  FileDescriptor passes_reply =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET6, SOCK_RAW, IPPROTO_ICMPV6));
+  struct icmp6_filter filter;
+  ICMP6_FILTER_SETBLOCKALL(&filter);
+  ICMP6_FILTER_SETPASS(ICMP6_ECHO_REPLY, &filter);
+  ASSERT_THAT(setsockopt(passes_reply.get(), SOL_ICMPV6, ICMP6_FILTER,
+                         &filter, sizeof(filter)),
+              SyscallSucceeds());
+
+  FileDescriptor blocks_all =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET6, SOCK_RAW, IPPROTO_ICMPV6));
+  ICMP6_FILTER_SETBLOCKALL(&filter);
+  ASSERT_THAT(setsockopt(blocks_all.get(), SOL_ICMPV6, ICMP6_FILTER, &filter,
+                         sizeof(filter)),
+              SyscallSucceeds());
+
+  // Ping the loopback address with an ICMP echo socket, which the kernel fills
+  // the identifier and checksum of.
+  int ping = socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6);
+  // The host may restrict ICMP echo sockets with ping_group_range.
+  SKIP_IF(ping < 0 && errno == EACCES);
+  ASSERT_THAT(ping, SyscallSucceeds());
+  FileDescriptor ping_fd(ping);
+  struct sockaddr_in6 addr = {};
+  addr.sin6_family = AF_INET6;
+  addr.sin6_addr = in6addr_loopback;
+  struct icmp6_hdr icmp = {};
+  icmp.icmp6_type = ICMP6_ECHO_REQUEST;
+  ASSERT_THAT(RetryEINTR(sendto)(ping_fd.get(), &icmp, sizeof(icmp), 0,
+                                 reinterpret_cast<struct sockaddr*>(&addr),
+                                 sizeof(addr)),
+              SyscallSucceedsWithValue(sizeof(icmp)));
+  struct icmp6_hdr reply;
+  ASSERT_THAT(RetryEINTR(recv)(ping_fd.get(), &reply, sizeof(reply), 0),
+              SyscallSucceedsWithValue(sizeof(reply)));
+  ASSERT_EQ(reply.icmp6_type, ICMP6_ECHO_REPLY);
+
+  // Raw sockets get the reply before the echo socket does.
+  struct icmp6_hdr got;
+  ASSERT_THAT(RetryEINTR(recv)(passes_reply.get(), &got, sizeof(got),
+                               MSG_DONTWAIT),
+              SyscallSucceedsWithValue(sizeof(got)));
+  EXPECT_EQ(got.icmp6_type, ICMP6_ECHO_REPLY);
+  EXPECT_THAT(RetryEINTR(recv)(passes_reply.get(), &got, sizeof(got),
+                               MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+  EXPECT_THAT(
+      RetryEINTR(recv)(blocks_all.get(), &got, sizeof(got), MSG_DONTWAIT),
+      SyscallFailsWithErrno(EAGAIN));
+}
+
 void RawSocketICMPTest::ExpectICMPSuccess(const struct icmphdr& icmp) {
   // We're going to receive both the echo request and reply, but the order is
   // indeterminate.
@@ -27,6 +27,7 @@
 #include "absl/memory/memory.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/capability_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/save_util.h"
 #include "test/util/test_util.h"
@@ -2322,13 +2323,42 @@ TEST_P(IPv4UDPUnboundSocketTest, SetSocketRecvBuf) {
   ASSERT_THAT(getsockopt(s->get(), SOL_SOCKET, SO_RCVBUF, &val, &val_len),
               SyscallSucceeds());
 
-  // Linux doubles the value set by SO_SNDBUF/SO_RCVBUF.
-  if (!IsRunningOnGvisor()) {
-    quarter_sz *= 2;
-  }
+  // Linux doubles the value set by SO_RCVBUF.
+  quarter_sz *= 2;
   ASSERT_EQ(quarter_sz, val);
 }
 
+// Check that SO_RCVBUFFORCE is not clamped to the maximum receive buffer size.
+TEST_P(IPv4UDPUnboundSocketTest, SetSocketRecvBufForce) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  auto s = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  // Discover maxmimum buffer size by setting to a really large value.
+  constexpr int kRcvBufSz = 0xffffffff;
+  ASSERT_THAT(setsockopt(s->get(), SOL_SOCKET, SO_RCVBUF, &kRcvBufSz,
+                         sizeof(kRcvBufSz)),
+              SyscallSucceeds());
+
+  int max = 0;
+  socklen_t max_len = sizeof(max);
+  ASSERT_THAT(getsockopt(s->get(), SOL_SOCKET, SO_RCVBUF, &max, &max_len),
+              SyscallSucceeds());
+
+  int above_max = max;
+  ASSERT_THAT(setsockopt(s->get(), SOL_SOCKET, SO_RCVBUFFORCE, &above_max,
+                         sizeof(above_max)),
+              SyscallSucceeds());
+
+  int val = 0;
+  socklen_t val_len = sizeof(val);
+  ASSERT_THAT(getsockopt(s->get(), SOL_SOCKET, SO_RCVBUF, &val, &val_len),
+              SyscallSucceeds());
+
+  // Linux doubles the value set by SO_RCVBUFFORCE.
+  ASSERT_EQ(above_max * 2, val);
+}
+
 // Check that setting SO_SNDBUF below min is clamped to the minimum
 // send buffer size.
 TEST_P(IPv4UDPUnboundSocketTest, SetSocketSendBufBelowMin) {
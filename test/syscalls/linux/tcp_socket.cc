@@ -27,6 +27,7 @@
 #include <vector>
 
 #include "gtest/gtest.h"
+#include "absl/strings/string_view.h"
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
 #include "test/syscalls/linux/socket_test_util.h"
@@ -831,6 +832,69 @@ TEST_P(TcpSocketTest, TimeWaitPollHUP) {
   ASSERT_THAT(poll(&pfd, 1, kTimeout), SyscallSucceedsWithValue(1));
 }
 
+TEST_P(TcpSocketTest, PeekOffGetSet) {
+  int off;
+  socklen_t off_len = sizeof(off);
+  ASSERT_THAT(getsockopt(second_fd, SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+              SyscallSucceeds());
+  EXPECT_EQ(off, -1);
+
+  constexpr int kOff = 5;
+  ASSERT_THAT(
+      setsockopt(second_fd, SOL_SOCKET, SO_PEEK_OFF, &kOff, sizeof(kOff)),
+      SyscallSucceeds());
+  ASSERT_THAT(getsockopt(second_fd, SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+              SyscallSucceeds());
+  EXPECT_EQ(off, kOff);
+}
+
+TEST_P(TcpSocketTest, PeekOffMovesWithPeeksAndReads) {
+  constexpr int kOff = 0;
+  ASSERT_THAT(
+      setsockopt(second_fd, SOL_SOCKET, SO_PEEK_OFF, &kOff, sizeof(kOff)),
+      SyscallSucceeds());
+
+  constexpr char kData[] = "abcdefgh";
+  ASSERT_THAT(RetryEINTR(write)(first_fd, kData, strlen(kData)),
+              SyscallSucceedsWithValue(strlen(kData)));
+
+  auto peek_off = [&] {
+    int off = -1;
+    socklen_t off_len = sizeof(off);
+    EXPECT_THAT(getsockopt(second_fd, SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+                SyscallSucceeds());
+    return off;
+  };
+
+  // Peeking advances the offset.
+  char buf[3] = {};
+  ASSERT_THAT(RetryEINTR(recv)(second_fd, buf, 3, MSG_PEEK),
+              SyscallSucceedsWithValue(3));
+  EXPECT_EQ(absl::string_view(buf, 3), "abc");
+  EXPECT_EQ(peek_off(), 3);
+  ASSERT_THAT(RetryEINTR(recv)(second_fd, buf, 3, MSG_PEEK),
+              SyscallSucceedsWithValue(3));
+  EXPECT_EQ(absl::string_view(buf, 3), "def");
+  EXPECT_EQ(peek_off(), 6);
+
+  // Reading moves it back.
+  ASSERT_THAT(RetryEINTR(recv)(second_fd, buf, 2, 0),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(absl::string_view(buf, 2), "ab");
+  EXPECT_EQ(peek_off(), 4);
+  ASSERT_THAT(RetryEINTR(recv)(second_fd, buf, 3, MSG_PEEK),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(absl::string_view(buf, 2), "gh");
+  EXPECT_EQ(peek_off(), 6);
+
+  // Reading past the offset resets it.
+  char rest[6] = {};
+  ASSERT_THAT(RetryEINTR(recv)(second_fd, rest, sizeof(rest), 0),
+              SyscallSucceedsWithValue(sizeof(rest)));
+  EXPECT_EQ(absl::string_view(rest, sizeof(rest)), "cdefgh");
+  EXPECT_EQ(peek_off(), 0);
+}
+
 INSTANTIATE_TEST_SUITE_P(AllInetTests, TcpSocketTest,
                          ::testing::Values(AF_INET, AF_INET6));
 
@@ -28,6 +28,7 @@
 #include <sys/types.h>
 
 #include "absl/strings/str_format.h"
+#include "absl/strings/string_view.h"
 #ifndef SIOCGSTAMP
 #include <linux/sockios.h>
 #endif
@@ -39,6 +40,8 @@
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/syscalls/linux/socket_test_util.h"
 #include "test/syscalls/linux/unix_domain_socket_test_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/posix_error.h"
 #include "test/util/test_util.h"
@@ -1837,12 +1840,9 @@ TEST_P(UdpSocketTest, RecvBufLimits) {
                 SyscallSucceeds());
   }
 
-  // Now set the limit to min * 4.
-  int new_rcv_buf_sz = min * 4;
-  if (!IsRunningOnGvisor() || IsRunningWithHostinet()) {
-    // Linux doubles the value specified so just set to min * 2.
-    new_rcv_buf_sz = min * 2;
-  }
+  // Setting min * 2 yields a limit of min * 4 because the kernel doubles
+  // SO_RCVBUF for overhead.
+  int new_rcv_buf_sz = min * 2;
 
   ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_RCVBUF, &new_rcv_buf_sz,
                          sizeof(new_rcv_buf_sz)),
@@ -1873,8 +1873,8 @@ TEST_P(UdpSocketTest, RecvBufLimits) {
         SyscallSucceedsWithValue(buf.size()));
     int sent = 4;
     if (IsRunningOnGvisor() && !IsRunningWithHostinet()) {
-      // Linux seems to drop the 4th packet even though technically it should
-      // fit in the receive buffer.
+      // Linux drops the 4th packet as it accounts for more per-packet
+      // overhead than gVisor.
       ASSERT_THAT(
           sendto(sock_.get(), buf.data(), buf.size(), 0, bind_addr_, addrlen_),
           SyscallSucceedsWithValue(buf.size()));
@@ -1966,6 +1966,177 @@ TEST_P(UdpSocketTest, SendToZeroPort) {
               SyscallSucceedsWithValue(sizeof(buf)));
 }
 
+TEST_P(UdpSocketTest, PeekOffGetSet) {
+  int off;
+  socklen_t off_len = sizeof(off);
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+              SyscallSucceeds());
+  EXPECT_EQ(off, -1);
+
+  constexpr int kOff = 5;
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_PEEK_OFF, &kOff, sizeof(kOff)),
+      SyscallSucceeds());
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+              SyscallSucceeds());
+  EXPECT_EQ(off, kOff);
+}
+
+TEST_P(UdpSocketTest, PeekOffMovesWithPeeksAndReads) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  constexpr int kOff = 0;
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_PEEK_OFF, &kOff, sizeof(kOff)),
+      SyscallSucceeds());
+
+  constexpr char kFirst[] = "abcdef";
+  constexpr char kSecond[] = "ghij";
+  for (auto const& data : {kFirst, kSecond}) {
+    ASSERT_THAT(
+        sendto(sock_.get(), data, strlen(data), 0, bind_addr_, addrlen_),
+        SyscallSucceedsWithValue(strlen(data)));
+  }
+
+  auto peek_off = [&] {
+    int off = -1;
+    socklen_t off_len = sizeof(off);
+    EXPECT_THAT(
+        getsockopt(bind_.get(), SOL_SOCKET, SO_PEEK_OFF, &off, &off_len),
+        SyscallSucceeds());
+    return off;
+  };
+
+  // Peeking advances the offset within the first datagram, and then past it
+  // to the next one.
+  char buf[10] = {};
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, 2, MSG_PEEK),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(absl::string_view(buf, 2), "ab");
+  EXPECT_EQ(peek_off(), 2);
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), MSG_PEEK),
+              SyscallSucceedsWithValue(4));
+  EXPECT_EQ(absl::string_view(buf, 4), "cdef");
+  EXPECT_EQ(peek_off(), 6);
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), MSG_PEEK),
+              SyscallSucceedsWithValue(4));
+  EXPECT_EQ(absl::string_view(buf, 4), "ghij");
+  EXPECT_EQ(peek_off(), 10);
+
+  // Reading moves it back by the length read.
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(6));
+  EXPECT_EQ(absl::string_view(buf, 6), "abcdef");
+  EXPECT_EQ(peek_off(), 4);
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(4));
+  EXPECT_EQ(absl::string_view(buf, 4), "ghij");
+  EXPECT_EQ(peek_off(), 0);
+}
+
+TEST_P(UdpSocketTest, BusyPollGetSet) {
+  // SO_BUSY_POLL isn't passed through to the host.
+  SKIP_IF(IsRunningWithHostinet());
+
+  int v = -1;
+  socklen_t v_len = sizeof(v);
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &v, &v_len),
+              SyscallSucceeds());
+  EXPECT_EQ(v, 0);
+
+  // Raising the value requires CAP_NET_ADMIN.
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  constexpr int kBusyPoll = 50;
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kBusyPoll,
+                         sizeof(kBusyPoll)),
+              SyscallSucceeds());
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &v, &v_len),
+              SyscallSucceeds());
+  EXPECT_EQ(v_len, sizeof(v));
+  EXPECT_EQ(v, kBusyPoll);
+}
+
+TEST_P(UdpSocketTest, BusyPollNegative) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  constexpr int kNegative = -1;
+  EXPECT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kNegative,
+                         sizeof(kNegative)),
+              SyscallFailsWithErrno(EINVAL));
+
+  int v = -1;
+  socklen_t v_len = sizeof(v);
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &v, &v_len),
+              SyscallSucceeds());
+  EXPECT_EQ(v, 0);
+}
+
+TEST_P(UdpSocketTest, BusyPollRaiseWithoutCapability) {
+  SKIP_IF(IsRunningWithHostinet());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  constexpr int kBusyPoll = 50;
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kBusyPoll,
+                         sizeof(kBusyPoll)),
+              SyscallSucceeds());
+
+  ASSERT_NO_ERRNO(SetCapability(CAP_NET_ADMIN, false));
+  Cleanup restore_cap([] {
+    EXPECT_NO_ERRNO(SetCapability(CAP_NET_ADMIN, true));
+  });
+
+  constexpr int kHigher = kBusyPoll + 1;
+  EXPECT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kHigher,
+                         sizeof(kHigher)),
+              SyscallFailsWithErrno(EPERM));
+
+  // Keeping or lowering the value doesn't.
+  EXPECT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kBusyPoll,
+                         sizeof(kBusyPoll)),
+              SyscallSucceeds());
+  constexpr int kLower = kBusyPoll - 1;
+  EXPECT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &kLower,
+                         sizeof(kLower)),
+              SyscallSucceeds());
+
+  int v = -1;
+  socklen_t v_len = sizeof(v);
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL, &v, &v_len),
+              SyscallSucceeds());
+  EXPECT_EQ(v, kLower);
+}
+
+TEST_P(UdpSocketTest, BusyPollTimedReceive) {
+  SKIP_IF(IsRunningWithHostinet());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  ASSERT_NO_ERRNO(BindLoopback());
+  // Busy poll for longer than the receive timeout, so that the timeout
+  // expires while polling.
+  constexpr int kBusyPollUsec = 50000;
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_BUSY_POLL,
+                         &kBusyPollUsec, sizeof(kBusyPollUsec)),
+              SyscallSucceeds());
+  const struct timeval tv = {.tv_sec = 0, .tv_usec = 10000};
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_RCVTIMEO, &tv, sizeof(tv)),
+      SyscallSucceeds());
+
+  char buf[10] = {};
+  const absl::Time start = absl::Now();
+  EXPECT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), 0),
+              SyscallFailsWithErrno(EAGAIN));
+  EXPECT_GE(absl::Now() - start, absl::Milliseconds(10));
+
+  // Data that arrives is still received.
+  constexpr char kData[] = "abcdef";
+  ASSERT_THAT(
+      sendto(sock_.get(), kData, strlen(kData), 0, bind_addr_, addrlen_),
+      SyscallSucceedsWithValue(strlen(kData)));
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(strlen(kData)));
+  EXPECT_EQ(absl::string_view(buf, strlen(kData)), kData);
+}
+
 INSTANTIATE_TEST_SUITE_P(AllInetTests, UdpSocketTest,
                          ::testing::Values(AddressFamily::kIpv4,
                                            AddressFamily::kIpv6,